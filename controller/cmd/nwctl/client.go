@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// config is persisted by `nwctl login` so later commands don't need
+// credentials on the command line. NWCTL_URL / NWCTL_TOKEN override it.
+// The access token is short-lived; the client trades RefreshToken for a
+// new pair when it expires and writes the rotated pair back.
+type config struct {
+	URL          string    `json:"url"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "nwctl", "config.json"), nil
+}
+
+func loadConfig() config {
+	var cfg config
+	if p, err := configPath(); err == nil {
+		if b, err := os.ReadFile(p); err == nil {
+			_ = json.Unmarshal(b, &cfg)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("NWCTL_URL")); v != "" {
+		cfg.URL = v
+	}
+	if v := strings.TrimSpace(os.Getenv("NWCTL_TOKEN")); v != "" {
+		// An explicit token is used as-is; never refresh the stored login
+		// on its behalf.
+		cfg.Token, cfg.ExpiresAt, cfg.RefreshToken = v, time.Time{}, ""
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return cfg
+}
+
+func saveConfig(cfg config) (string, error) {
+	p, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return "", err
+	}
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return p, os.WriteFile(p, b, 0o600)
+}
+
+// apiError carries the controller's {"error": "..."} body with the status.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("controller returned HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("controller returned HTTP %d: %s", e.Status, e.Message)
+}
+
+// client is a minimal JSON client for the controller REST API.
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+
+	cfg config // refresh state; saved back after each rotation
+}
+
+func newClient(cfg config) (*client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("controller URL not set; run `nwctl login --url ...` or set NWCTL_URL")
+	}
+	return &client{base: cfg.URL, token: cfg.Token, http: &http.Client{Timeout: 60 * time.Second}, cfg: cfg}, nil
+}
+
+// tokenPair is the subset of the controller's login/refresh response the
+// CLI persists.
+type tokenPair struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// store records a new token pair on the client and in the config file.
+func (c *client) store(p tokenPair) error {
+	c.token = p.Token
+	c.cfg.Token, c.cfg.ExpiresAt, c.cfg.RefreshToken = p.Token, p.ExpiresAt, p.RefreshToken
+	_, err := saveConfig(c.cfg)
+	return err
+}
+
+// refresh trades the stored refresh token for a new pair. Refresh tokens
+// are single-use, so the rotated pair is saved before it is used.
+func (c *client) refresh() error {
+	var p tokenPair
+	if err := c.send(http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": c.cfg.RefreshToken}, &p); err != nil {
+		var ae *apiError
+		if errors.As(err, &ae) && ae.Status == http.StatusUnauthorized {
+			return errors.New("session expired; run `nwctl login` again")
+		}
+		return fmt.Errorf("refresh token: %w", err)
+	}
+	if p.Token == "" || p.RefreshToken == "" {
+		return errors.New("refresh succeeded but no token pair was returned")
+	}
+	if err := c.store(p); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	return nil
+}
+
+// do sends the request, refreshing the access token first when it has
+// expired and once more if the controller still answers 401.
+func (c *client) do(method, path string, body, out any) error {
+	if c.cfg.RefreshToken == "" {
+		return c.send(method, path, body, out)
+	}
+	if !c.cfg.ExpiresAt.IsZero() && time.Now().Add(30*time.Second).After(c.cfg.ExpiresAt) {
+		if err := c.refresh(); err != nil {
+			return err
+		}
+	}
+	err := c.send(method, path, body, out)
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.Status != http.StatusUnauthorized {
+		return err
+	}
+	if err := c.refresh(); err != nil {
+		return err
+	}
+	return c.send(method, path, body, out)
+}
+
+func (c *client) send(method, path string, body, out any) error {
+	var rdr io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, rdr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		return &apiError{Status: resp.StatusCode, Message: e.Error}
+	}
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (c *client) get(path string, out any) error {
+	return c.do(http.MethodGet, path, nil, out)
+}
+
+func (c *client) post(path string, body, out any) error {
+	return c.do(http.MethodPost, path, body, out)
+}
+
+// ---- Wire types (subset of the controller's JSON) ----
+
+type agentDTO struct {
+	ID          uint      `json:"id"`
+	WorkspaceID uint      `json:"workspace_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	Version     string    `json:"version"`
+	OS          string    `json:"os"`
+	Arch        string    `json:"arch"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+	Initialized bool      `json:"initialized"`
+}
+
+type targetDTO struct {
+	Target  string `json:"target"`
+	AgentID *uint  `json:"agent_id"`
+}
+
+type probeDTO struct {
+	ID            uint            `json:"id"`
+	AgentID       uint            `json:"agent_id"`
+	Type          string          `json:"type"`
+	Enabled       bool            `json:"enabled"`
+	IntervalSec   int             `json:"interval_sec"`
+	TimeoutSec    int             `json:"timeout_sec"`
+	Count         int             `json:"count"`
+	DurationSec   int             `json:"duration_sec"`
+	Server        bool            `json:"server"`
+	BindInterface string          `json:"bind_interface"`
+	Labels        json.RawMessage `json:"labels"`
+	Metadata      json.RawMessage `json:"metadata"`
+	Targets       []targetDTO     `json:"targets"`
+}
+
+type incidentDTO struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Severity        string   `json:"severity"`
+	Scope           string   `json:"scope"`
+	SuggestedCause  string   `json:"suggested_cause"`
+	AffectedAgents  []string `json:"affected_agents"`
+	AffectedTargets []string `json:"affected_targets"`
+	ImpactScore     float64  `json:"impact_score"`
+}
+
+func (c *client) listAgents(wsID uint) ([]agentDTO, error) {
+	var all []agentDTO
+	for offset := 0; ; offset += 200 {
+		var page struct {
+			Data  []agentDTO `json:"data"`
+			Total int        `json:"total"`
+		}
+		if err := c.get(fmt.Sprintf("/workspaces/%d/agents?limit=200&offset=%d", wsID, offset), &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Data...)
+		if len(page.Data) == 0 || len(all) >= page.Total {
+			return all, nil
+		}
+	}
+}
+
+func (c *client) listProbes(wsID, agentID uint) ([]probeDTO, error) {
+	var resp struct {
+		Data []probeDTO `json:"data"`
+	}
+	if err := c.get(fmt.Sprintf("/workspaces/%d/agents/%d/probes", wsID, agentID), &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
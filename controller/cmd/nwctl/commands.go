@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// onlineWindow matches the controller's own "online" definition.
+const onlineWindow = time.Minute
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("nwctl "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+func workspaceFlag(fs *flag.FlagSet) *uint {
+	var ws uint
+	fs.UintVar(&ws, "w", 0, "workspace ID")
+	fs.UintVar(&ws, "workspace", 0, "workspace ID")
+	return &ws
+}
+
+func requireWorkspace(ws uint) error {
+	if ws == 0 {
+		return errors.New("workspace is required (-w)")
+	}
+	return nil
+}
+
+func mustClient() (*client, error) {
+	cfg := loadConfig()
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if c.token == "" {
+		return nil, errors.New("not logged in; run `nwctl login` or set NWCTL_TOKEN")
+	}
+	return c, nil
+}
+
+// ---- login ----
+
+func cmdLogin(args []string) error {
+	fs := newFlagSet("login")
+	url := fs.String("url", "", "controller base URL (e.g. https://api.example.com)")
+	email := fs.String("email", "", "account email")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := loadConfig()
+	if *url != "" {
+		cfg.URL = strings.TrimRight(*url, "/")
+	}
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+	password := os.Getenv("NWCTL_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	var resp tokenPair
+	if err := c.send(http.MethodPost, "/auth/login", map[string]string{"email": *email, "password": password}, &resp); err != nil {
+		return err
+	}
+	if resp.Token == "" {
+		return errors.New("login succeeded but no token was returned")
+	}
+	if err := c.store(resp); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	path, _ := configPath()
+	fmt.Fprintf(os.Stderr, "logged in to %s (token saved to %s)\n", cfg.URL, path)
+	return nil
+}
+
+// ---- agents list ----
+
+func cmdAgentsList(args []string) error {
+	fs := newFlagSet("agents list")
+	ws := workspaceFlag(fs)
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireWorkspace(*ws); err != nil {
+		return err
+	}
+	c, err := mustClient()
+	if err != nil {
+		return err
+	}
+	agents, err := c.listAgents(*ws)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(agents)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tVERSION\tPLATFORM\tLOCATION\tLAST SEEN")
+	for _, a := range agents {
+		status := "offline"
+		switch {
+		case !a.Initialized:
+			status = "pending"
+		case time.Since(a.LastSeenAt) < onlineWindow:
+			status = "online"
+		}
+		platform := strings.Trim(a.OS+"/"+a.Arch, "/")
+		lastSeen := "-"
+		if !a.LastSeenAt.IsZero() {
+			lastSeen = a.LastSeenAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.ID, a.Name, status, dash(a.Version), dash(platform), dash(a.Location), lastSeen)
+	}
+	return tw.Flush()
+}
+
+// ---- probes apply / export ----
+
+// workspaceSpec is the YAML document read by `probes apply` and written
+// by `export`. Agents are referenced by name so an export can be applied
+// to a different workspace that has agents with the same names.
+type workspaceSpec struct {
+	Workspace uint        `yaml:"workspace,omitempty"`
+	Agents    []agentSpec `yaml:"agents,omitempty"`
+	Probes    []probeSpec `yaml:"probes"`
+}
+
+type agentSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Location    string `yaml:"location,omitempty"`
+}
+
+type probeSpec struct {
+	Agent         string         `yaml:"agent"` // agent name or ID
+	Type          string         `yaml:"type"`
+	Targets       []string       `yaml:"targets,omitempty"`
+	AgentTargets  []string       `yaml:"agent_targets,omitempty"` // agent names or IDs
+	Enabled       *bool          `yaml:"enabled,omitempty"`
+	IntervalSec   int            `yaml:"interval_sec,omitempty"`
+	TimeoutSec    int            `yaml:"timeout_sec,omitempty"`
+	Count         int            `yaml:"count,omitempty"`
+	DurationSec   int            `yaml:"duration_sec,omitempty"`
+	Server        bool           `yaml:"server,omitempty"`
+	BindInterface string         `yaml:"bind_interface,omitempty"`
+	Labels        map[string]any `yaml:"labels,omitempty"`
+	Metadata      map[string]any `yaml:"metadata,omitempty"`
+}
+
+// agentResolver maps names and numeric IDs to agent IDs.
+type agentResolver struct {
+	byName map[string]uint
+	byID   map[uint]agentDTO
+}
+
+func newAgentResolver(agents []agentDTO) agentResolver {
+	r := agentResolver{byName: map[string]uint{}, byID: map[uint]agentDTO{}}
+	for _, a := range agents {
+		r.byName[strings.ToLower(a.Name)] = a.ID
+		r.byID[a.ID] = a
+	}
+	return r
+}
+
+func (r agentResolver) resolve(ref string) (uint, error) {
+	ref = strings.TrimSpace(ref)
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		if _, ok := r.byID[uint(id)]; ok {
+			return uint(id), nil
+		}
+		return 0, fmt.Errorf("agent %s not found in workspace", ref)
+	}
+	if id, ok := r.byName[strings.ToLower(ref)]; ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("agent %q not found in workspace", ref)
+}
+
+func cmdProbesApply(args []string) error {
+	fs := newFlagSet("probes apply")
+	ws := workspaceFlag(fs)
+	file := fs.String("f", "", "YAML file (- for stdin)")
+	dryRun := fs.Bool("dry-run", false, "validate and print, but don't create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-f is required")
+	}
+
+	var raw []byte
+	var err error
+	if *file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	var spec workspaceSpec
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return fmt.Errorf("parse %s: %w", *file, err)
+	}
+	if *ws == 0 {
+		*ws = spec.Workspace
+	}
+	if err := requireWorkspace(*ws); err != nil {
+		return err
+	}
+
+	c, err := mustClient()
+	if err != nil {
+		return err
+	}
+	agents, err := c.listAgents(*ws)
+	if err != nil {
+		return err
+	}
+	res := newAgentResolver(agents)
+
+	var created, skipped, failed int
+	for i, p := range spec.Probes {
+		label := fmt.Sprintf("probes[%d] %s on %s", i, p.Type, p.Agent)
+		agentID, err := res.resolve(p.Agent)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", label, err)
+			failed++
+			continue
+		}
+		body := map[string]any{
+			"workspace_id":   *ws,
+			"agent_id":       agentID,
+			"type":           strings.ToUpper(p.Type),
+			"targets":        p.Targets,
+			"interval_sec":   p.IntervalSec,
+			"timeout_sec":    p.TimeoutSec,
+			"count":          p.Count,
+			"duration_sec":   p.DurationSec,
+			"server":         p.Server,
+			"bind_interface": p.BindInterface,
+			"enabled":        p.Enabled == nil || *p.Enabled,
+		}
+		var agentTargets []uint
+		for _, ref := range p.AgentTargets {
+			id, err := res.resolve(ref)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: target %v\n", label, err)
+				failed++
+				agentTargets = nil
+				break
+			}
+			agentTargets = append(agentTargets, id)
+		}
+		if len(p.AgentTargets) > 0 && agentTargets == nil {
+			continue
+		}
+		if len(agentTargets) > 0 {
+			body["agent_targets"] = agentTargets
+		}
+		if p.Labels != nil {
+			body["labels"] = p.Labels
+		}
+		if p.Metadata != nil {
+			body["metadata"] = p.Metadata
+		}
+
+		if *dryRun {
+			fmt.Printf("would create %s\n", label)
+			continue
+		}
+		var out probeDTO
+		err = c.post(fmt.Sprintf("/workspaces/%d/agents/%d/probes", *ws, agentID), body, &out)
+		var apiErr *apiError
+		switch {
+		case err == nil:
+			fmt.Printf("created probe %d (%s)\n", out.ID, label)
+			created++
+		case errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "duplicate"):
+			fmt.Printf("exists  %s\n", label)
+			skipped++
+		default:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", label, err)
+			failed++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d created, %d already present, %d failed\n", created, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d probe(s) failed", failed)
+	}
+	return nil
+}
+
+func cmdExport(args []string) error {
+	fs := newFlagSet("export")
+	ws := workspaceFlag(fs)
+	out := fs.String("o", "", "write to file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireWorkspace(*ws); err != nil {
+		return err
+	}
+	c, err := mustClient()
+	if err != nil {
+		return err
+	}
+	agents, err := c.listAgents(*ws)
+	if err != nil {
+		return err
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	res := newAgentResolver(agents)
+
+	spec := workspaceSpec{Workspace: *ws, Probes: []probeSpec{}}
+	for _, a := range agents {
+		spec.Agents = append(spec.Agents, agentSpec{Name: a.Name, Description: a.Description, Location: a.Location})
+		probes, err := c.listProbes(*ws, a.ID)
+		if err != nil {
+			return fmt.Errorf("list probes for agent %q: %w", a.Name, err)
+		}
+		for _, p := range probes {
+			spec.Probes = append(spec.Probes, exportProbe(a.Name, p, res))
+		}
+	}
+
+	b, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0o644)
+}
+
+func exportProbe(agentName string, p probeDTO, res agentResolver) probeSpec {
+	s := probeSpec{
+		Agent:         agentName,
+		Type:          p.Type,
+		IntervalSec:   p.IntervalSec,
+		TimeoutSec:    p.TimeoutSec,
+		Count:         p.Count,
+		DurationSec:   p.DurationSec,
+		Server:        p.Server,
+		BindInterface: p.BindInterface,
+	}
+	if !p.Enabled {
+		f := false
+		s.Enabled = &f
+	}
+	for _, t := range p.Targets {
+		if t.AgentID == nil {
+			if t.Target != "" {
+				s.Targets = append(s.Targets, t.Target)
+			}
+			continue
+		}
+		if a, ok := res.byID[*t.AgentID]; ok {
+			s.AgentTargets = append(s.AgentTargets, a.Name)
+		} else {
+			// Cross-workspace (global) agent: keep the numeric ID.
+			s.AgentTargets = append(s.AgentTargets, strconv.FormatUint(uint64(*t.AgentID), 10))
+		}
+	}
+	s.Labels = nonEmptyObject(p.Labels)
+	s.Metadata = nonEmptyObject(p.Metadata)
+	return s
+}
+
+func nonEmptyObject(raw json.RawMessage) map[string]any {
+	var m map[string]any
+	if len(raw) == 0 || json.Unmarshal(raw, &m) != nil || len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// ---- psk rotate ----
+
+func cmdPSKRotate(args []string) error {
+	fs := newFlagSet("psk rotate")
+	ws := workspaceFlag(fs)
+	agentRef := fs.String("agent", "", "agent name or ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireWorkspace(*ws); err != nil {
+		return err
+	}
+	if *agentRef == "" {
+		return errors.New("--agent is required")
+	}
+	c, err := mustClient()
+	if err != nil {
+		return err
+	}
+	agents, err := c.listAgents(*ws)
+	if err != nil {
+		return err
+	}
+	agentID, err := newAgentResolver(agents).resolve(*agentRef)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		PSK string `json:"psk"`
+	}
+	if err := c.post(fmt.Sprintf("/workspaces/%d/agents/%d/rotate-psk", *ws, agentID), nil, &resp); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "new PSK for agent %d (shown once; update the agent's config):\n", agentID)
+	fmt.Println(resp.PSK)
+	return nil
+}
+
+// ---- incidents tail ----
+
+func cmdIncidentsTail(args []string) error {
+	fs := newFlagSet("incidents tail")
+	ws := workspaceFlag(fs)
+	interval := fs.Duration("interval", time.Minute, "poll interval")
+	lookback := fs.Int("lookback", 60, "analysis lookback in minutes")
+	once := fs.Bool("once", false, "print current incidents and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireWorkspace(*ws); err != nil {
+		return err
+	}
+	if *interval < 10*time.Second {
+		*interval = 10 * time.Second
+	}
+	c, err := mustClient()
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+
+	active := map[string]incidentDTO{}
+	for {
+		var analysis struct {
+			Incidents []incidentDTO `json:"incidents"`
+		}
+		err := c.get(fmt.Sprintf("/workspaces/%d/analysis?lookback=%d", *ws, *lookback), &analysis)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && (apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s poll failed: %v\n", time.Now().Format(time.RFC3339), err)
+		} else {
+			now := time.Now().Format(time.RFC3339)
+			seen := map[string]bool{}
+			for _, inc := range analysis.Incidents {
+				seen[inc.ID] = true
+				if _, ok := active[inc.ID]; ok {
+					continue
+				}
+				active[inc.ID] = inc
+				fmt.Printf("%s OPEN     [%s] (impact %.0f) %s", now, strings.ToUpper(inc.Severity), inc.ImpactScore, inc.Title)
+				if len(inc.AffectedAgents) > 0 {
+					fmt.Printf(" — agents: %s", strings.Join(inc.AffectedAgents, ", "))
+				}
+				fmt.Println()
+			}
+			for id, inc := range active {
+				if !seen[id] {
+					fmt.Printf("%s RESOLVED [%s] %s\n", now, strings.ToUpper(inc.Severity), inc.Title)
+					delete(active, id)
+				}
+			}
+		}
+		if *once {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// ---- helpers ----
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
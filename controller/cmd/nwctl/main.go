@@ -0,0 +1,93 @@
+// nwctl is a small command-line client for the controller REST API,
+// covering the operations people otherwise script with curl: listing
+// agents, creating probes from YAML, rotating agent PSKs, exporting a
+// workspace's configuration, and tailing incidents.
+//
+//	nwctl login --url https://api.example.com --email ops@example.com
+//	nwctl agents list -w 3
+//	nwctl probes apply -w 3 -f probes.yaml
+//	nwctl psk rotate -w 3 --agent 12
+//	nwctl export -w 3 > workspace.yaml
+//	nwctl incidents tail -w 3
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: nwctl <command> [flags]
+
+commands:
+  login             authenticate and store a token
+  agents list       list agents in a workspace
+  probes apply      create probes from a YAML file
+  psk rotate        issue a new PSK for an agent
+  export            export agents and probes as YAML
+  incidents tail    follow workspace incidents
+
+environment:
+  NWCTL_URL, NWCTL_TOKEN   override the stored controller URL / token
+  NWCTL_PASSWORD           password for non-interactive login
+
+Run "nwctl <command> -h" for command flags.
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "nwctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("no command given")
+	}
+
+	cmd, rest := args[0], args[1:]
+	sub := ""
+	if len(rest) > 0 && len(rest[0]) > 0 && rest[0][0] != '-' {
+		sub, rest = rest[0], rest[1:]
+	}
+
+	switch {
+	case cmd == "login":
+		return cmdLogin(prepend(sub, rest))
+	case cmd == "agents" && sub == "list":
+		return cmdAgentsList(rest)
+	case cmd == "probes" && sub == "apply":
+		return cmdProbesApply(rest)
+	case cmd == "psk" && sub == "rotate":
+		return cmdPSKRotate(rest)
+	case cmd == "export":
+		return cmdExport(prepend(sub, rest))
+	case cmd == "incidents" && sub == "tail":
+		return cmdIncidentsTail(rest)
+	case cmd == "help" || cmd == "-h" || cmd == "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", joinNonEmpty(cmd, sub))
+}
+
+func prepend(s string, rest []string) []string {
+	if s == "" {
+		return rest
+	}
+	return append([]string{s}, rest...)
+}
+
+func joinNonEmpty(a, b string) string {
+	if b == "" {
+		return a
+	}
+	return a + " " + b
+}
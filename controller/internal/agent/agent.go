@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/extid"
+	"netwatcher-controller/internal/workspace"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/datatypes"
@@ -31,8 +33,13 @@ var (
 	ErrInvalidPSK      = errors.New("invalid psk")
 	ErrAgentDeleted    = errors.New("agent deleted") // Agent was soft-deleted from panel
 	ErrServerError     = errors.New("server error")  // Transient DB/infrastructure failure
+
+	ErrWorkspaceDisabled = errors.New("workspace disabled") // Workspace scheduled for deletion
 )
 
+// MaxProvisionedMbps bounds an agent's provisioned circuit speed (1 Tbps).
+const MaxProvisionedMbps = 1_000_000
+
 // -------------------- Agent (updated to your new struct) --------------------
 
 type Agent struct {
@@ -44,7 +51,9 @@ type Agent struct {
 	// Ownership / scoping
 	WorkspaceID uint `gorm:"index:idx_ws_pin,priority:1" json:"workspace_id"`
 
-	// Identity
+	// Identity. ExternalID is stable across environments (ULID unless a
+	// slug was chosen; see internal/extid) and accepted in routes.
+	ExternalID  string `gorm:"size:64" json:"external_id"`
 	Name        string `gorm:"size:255;index" json:"name" form:"name"`
 	Description string `gorm:"size:255;index" json:"description" form:"description"`
 
@@ -55,9 +64,39 @@ type Agent struct {
 	// Runtime / versioning
 	Version string `gorm:"size:64;index" json:"version"`
 
+	// Platform (reported by the agent at login; see capabilities.go)
+	OS           string         `gorm:"size:32" json:"os"`
+	Arch         string         `gorm:"size:32" json:"arch"`
+	Capabilities datatypes.JSON `gorm:"type:jsonb" json:"capabilities"`
+
+	// Config protocol announced by the agent build (see negotiation.go).
+	// NegotiatedAt is nil for agents that predate negotiation.
+	ProtocolVersion int            `gorm:"default:0" json:"protocol_version"`
+	ProbeTypes      datatypes.JSON `gorm:"type:jsonb" json:"probe_types"`
+	ConfigFeatures  datatypes.JSON `gorm:"type:jsonb" json:"config_features"`
+	NegotiatedAt    *time.Time     `json:"negotiated_at,omitempty"`
+
 	// Health
 	LastSeenAt time.Time `gorm:"index" json:"last_seen_at"`
 
+	// Connectivity grace (see connectivity.go). NetworkType picks default
+	// degraded/offline thresholds; OfflineThresholdSeconds overrides the
+	// offline one (0 = network type default).
+	NetworkType             string `gorm:"size:16" json:"network_type"`
+	OfflineThresholdSeconds int    `gorm:"default:0" json:"offline_threshold_seconds"`
+
+	// Provisioned circuit speed in Mbps (0 = unknown, at most
+	// MaxProvisionedMbps), compared against speedtest results by the
+	// analysis engine. Timezone (IANA name, empty = UTC) decides which
+	// samples fall in business hours.
+	ProvisionedDownMbps float64 `gorm:"default:0" json:"provisioned_down_mbps"`
+	ProvisionedUpMbps   float64 `gorm:"default:0" json:"provisioned_up_mbps"`
+	Timezone            string  `gorm:"size:64" json:"timezone"`
+
+	// Region whose controller owns the agent's telemetry (see
+	// internal/region); empty = the home region.
+	Region string `gorm:"size:32;index" json:"region"`
+
 	// Tags / labels
 	Labels   datatypes.JSON `gorm:"type:jsonb" json:"labels"`
 	Metadata datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
@@ -100,6 +139,7 @@ func (Auth) TableName() string { return "agent_pins" }
 
 type CreateInput struct {
 	WorkspaceID      uint
+	ExternalID       string // optional slug; a ULID is generated when empty
 	Name             string
 	Description      string
 	PinLength        int // default 9
@@ -109,6 +149,7 @@ type CreateInput struct {
 	Labels           datatypes.JSON
 	Metadata         datatypes.JSON
 	PINTTL           *time.Duration // optional expiry for bootstrap PIN
+	PIN              string         // optional fixed bootstrap PIN; generated when empty
 
 	// TrafficSim server configuration (optional at creation time)
 	TrafficSimEnabled bool
@@ -141,14 +182,26 @@ type BootstrapOutput struct {
 
 // CreateAgent inserts Agent, default probes, and issues a bootstrap PIN (in agent_pins).
 func CreateAgent(ctx context.Context, db *gorm.DB, in CreateInput) (*CreateOutput, error) {
+	if err := ValidateCreateInput(in); err != nil {
+		return nil, err
+	}
 	pinLen := in.PinLength
 	if pinLen <= 0 {
 		pinLen = 9
 	}
 
+	if in.ExternalID != "" {
+		id, err := extid.Claim(ctx, db, "agents", in.WorkspaceID, 0, in.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		in.ExternalID = id
+	}
+
 	now := time.Now()
 	a := &Agent{
 		WorkspaceID:       in.WorkspaceID,
+		ExternalID:        in.ExternalID,
 		Name:              in.Name,
 		Description:       in.Description,
 		Location:          in.Location,
@@ -179,9 +232,12 @@ func CreateAgent(ctx context.Context, db *gorm.DB, in CreateInput) (*CreateOutpu
 			expiresAt = &t
 		}
 
-		p, err := generateNumericPIN(pinLen)
-		if err != nil {
-			return err
+		p := in.PIN
+		if p == "" {
+			var err error
+			if p, err = generateNumericPIN(pinLen); err != nil {
+				return err
+			}
 		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
 		if err != nil {
@@ -218,6 +274,24 @@ func GetAgentByID(ctx context.Context, db *gorm.DB, id uint) (*Agent, error) {
 	return &a, err
 }
 
+// BeforeCreate assigns a ULID external ID when none was chosen.
+func (a *Agent) BeforeCreate(tx *gorm.DB) error {
+	if a.ExternalID == "" {
+		a.ExternalID = extid.New()
+	}
+	return nil
+}
+
+// ResolveExternalID returns the ID of the workspace's agent with the given
+// external ID.
+func ResolveExternalID(ctx context.Context, db *gorm.DB, wsID uint, ref string) (uint, error) {
+	id, err := extid.Resolve(ctx, db, "agents", wsID, ref)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
 func GetAgentByWorkspaceAndID(ctx context.Context, db *gorm.DB, wsID, id uint) (*Agent, error) {
 	var a Agent
 	err := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", wsID, id).First(&a).Error
@@ -487,6 +561,7 @@ func GetPendingPIN(ctx context.Context, db *gorm.DB, workspaceID, agentID uint)
 // AuthenticateWithPSK verifies the provided plaintext PSK against the stored bcrypt hash.
 // Returns ErrAgentDeleted if the agent was soft-deleted (should trigger 410 Gone response).
 // Returns ErrServerError for transient DB failures (should trigger 503, NOT 401).
+// Returns ErrWorkspaceDisabled while the workspace is scheduled for deletion.
 // Returns ErrInvalidPSK only when the PSK is genuinely wrong.
 func AuthenticateWithPSK(ctx context.Context, db *gorm.DB, workspaceID, agentID uint, psk string) (*Agent, error) {
 	// First check if agent exists but is soft-deleted
@@ -509,6 +584,9 @@ func AuthenticateWithPSK(ctx context.Context, db *gorm.DB, workspaceID, agentID
 	if err := bcrypt.CompareHashAndPassword([]byte(a.PSKHash), []byte(psk)); err != nil {
 		return nil, ErrInvalidPSK
 	}
+	if workspace.IsDisabled(ctx, db, a.WorkspaceID) {
+		return nil, ErrWorkspaceDisabled
+	}
 	return a, nil
 }
 
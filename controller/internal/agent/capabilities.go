@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// -------------------- Platform / Capabilities --------------------
+
+// Capability names reported by agents at login. An agent only lists the
+// capabilities it verified on its own host (e.g. it opened a raw socket,
+// found the speedtest binary), so absence means "cannot", not "unknown".
+const (
+	CapICMP       = "icmp"       // unprivileged or privileged ICMP echo (PING)
+	CapRawSocket  = "raw_socket" // raw IP sockets with TTL control (MTR)
+	CapSpeedtest  = "speedtest"  // speedtest client available (SPEEDTEST)
+	CapTrafficSim = "trafficsim" // UDP TrafficSim client/server (TRAFFICSIM, AGENT)
+	CapSNMP       = "snmp"       // SNMP client (SNMP)
+	CapPMTU       = "pmtu"       // don't-fragment sockets for path-MTU discovery (PMTU)
+)
+
+// Normalized OS values. Agents report runtime.GOOS; anything else is
+// stored lowercased as-is.
+const (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+	OSDarwin  = "darwin"
+)
+
+// PlatformInfo is what an agent reports about its host.
+type PlatformInfo struct {
+	OS           string   `json:"os"`
+	Arch         string   `json:"arch"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Empty reports whether the agent sent no platform information at all
+// (older agents that predate capability reporting).
+func (p PlatformInfo) Empty() bool {
+	return p.OS == "" && p.Arch == "" && p.Capabilities == nil
+}
+
+// normalizeOS maps common aliases onto GOOS names.
+func normalizeOS(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "macos", "mac", "osx", "darwin":
+		return OSDarwin
+	case "win", "win32", "win64", "windows":
+		return OSWindows
+	}
+	return s
+}
+
+// normalizeCapabilities lowercases, de-duplicates, and sorts capability
+// names so the stored JSON is stable across logins.
+func normalizeCapabilities(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, c := range in {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// CapabilitiesReported reports whether the agent has ever sent a
+// capability list. Agents that haven't are treated as legacy and are not
+// subject to capability checks.
+func (a *Agent) CapabilitiesReported() bool {
+	return len(a.Capabilities) > 0 && string(a.Capabilities) != "null"
+}
+
+// CapabilityList decodes the stored capability list.
+func (a *Agent) CapabilityList() []string {
+	if !a.CapabilitiesReported() {
+		return nil
+	}
+	var out []string
+	if err := json.Unmarshal(a.Capabilities, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// HasCapability reports whether the agent listed the given capability.
+func (a *Agent) HasCapability(name string) bool {
+	for _, c := range a.CapabilityList() {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateAgentPlatform persists the OS/arch/capabilities an agent reported
+// at login or bootstrap. Empty reports are ignored so older agents don't
+// wipe previously stored values.
+func UpdateAgentPlatform(ctx context.Context, db *gorm.DB, id uint, p PlatformInfo) error {
+	if p.Empty() {
+		return nil
+	}
+	updates := map[string]any{"updated_at": time.Now()}
+	if p.OS != "" {
+		updates["os"] = normalizeOS(p.OS)
+	}
+	if p.Arch != "" {
+		updates["arch"] = strings.ToLower(strings.TrimSpace(p.Arch))
+	}
+	if p.Capabilities != nil {
+		b, err := json.Marshal(normalizeCapabilities(p.Capabilities))
+		if err != nil {
+			return err
+		}
+		updates["capabilities"] = datatypes.JSON(b)
+	}
+	res := db.WithContext(ctx).Model(&Agent{}).Where("id = ?", id).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
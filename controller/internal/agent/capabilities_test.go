@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+// TestUpdateAgentPlatform_NormalizesAndKeepsOnEmpty: reported values are
+// normalized, and a later empty report (older agent build) must not wipe
+// them.
+func TestUpdateAgentPlatform_NormalizesAndKeepsOnEmpty(t *testing.T) {
+	db := newAgentTestDB(t)
+	ctx := context.Background()
+	mustCreateAgentRow(t, db, Agent{ID: 1, WorkspaceID: 1, Name: "a"})
+
+	err := UpdateAgentPlatform(ctx, db, 1, PlatformInfo{
+		OS:           "macOS",
+		Arch:         "ARM64",
+		Capabilities: []string{"speedtest", "ICMP", "icmp", " "},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := UpdateAgentPlatform(ctx, db, 1, PlatformInfo{}); err != nil {
+		t.Fatalf("empty update: %v", err)
+	}
+
+	a, err := GetAgentByID(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if a.OS != OSDarwin || a.Arch != "arm64" {
+		t.Errorf("expected darwin/arm64, got %s/%s", a.OS, a.Arch)
+	}
+	caps := a.CapabilityList()
+	if len(caps) != 2 || caps[0] != CapICMP || caps[1] != CapSpeedtest {
+		t.Errorf("expected [icmp speedtest], got %v", caps)
+	}
+	if !a.HasCapability(CapSpeedtest) || a.HasCapability(CapRawSocket) {
+		t.Errorf("HasCapability mismatch for %v", caps)
+	}
+}
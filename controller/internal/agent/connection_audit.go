@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// -------------------- Connection audit --------------------
+//
+// Every way an agent reaches the controller is recorded: the WebSocket
+// control connection, result uploads over it, and calls to the PSK agent
+// API. One row per agent, kind, source IP, user agent and TLS version
+// keeps the table small; repeats only bump LastSeenAt and Count, and are
+// written at most once per auditRefresh per row.
+//
+// A row from a network (IPv4 /24, IPv6 /48) the agent has never used
+// before, when it already has history, is reported as a NetworkChange:
+// a PSK that suddenly uploads from somewhere else may have been copied.
+
+// ConnectionKind is how the agent reached the controller.
+type ConnectionKind string
+
+const (
+	ConnControl ConnectionKind = "control" // WebSocket connect
+	ConnUpload  ConnectionKind = "upload"  // probe results over the WebSocket
+	ConnAPI     ConnectionKind = "api"     // PSK-authenticated HTTP agent API
+)
+
+const auditRefresh = 5 * time.Minute
+
+// ConnectionRecord is one distinct agent connection fingerprint.
+type ConnectionRecord struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID     uint           `gorm:"not null;index" json:"agent_id"`
+	WorkspaceID uint           `gorm:"not null;index" json:"workspace_id"`
+	Kind        ConnectionKind `gorm:"type:VARCHAR(16);not null" json:"kind"`
+	ClientIP    string         `gorm:"size:64" json:"client_ip"`
+	Network     string         `gorm:"size:64" json:"network"`
+	UserAgent   string         `gorm:"size:256" json:"user_agent,omitempty"`
+	TLSVersion  string         `gorm:"size:16" json:"tls_version,omitempty"` // empty when TLS ends at a proxy
+	FirstSeenAt time.Time      `json:"first_seen_at"`
+	LastSeenAt  time.Time      `gorm:"index" json:"last_seen_at"`
+	Count       int64          `json:"count"`
+}
+
+func (ConnectionRecord) TableName() string { return "agent_connection_audit" }
+
+// ConnectionInfo describes one connection to record.
+type ConnectionInfo struct {
+	AgentID     uint
+	WorkspaceID uint
+	Kind        ConnectionKind
+	ClientIP    string
+	UserAgent   string
+	TLSVersion  string
+}
+
+// NetworkChange is a connection from a network the agent hasn't used.
+type NetworkChange struct {
+	AgentID     uint           `json:"agent_id"`
+	WorkspaceID uint           `json:"workspace_id"`
+	Kind        ConnectionKind `json:"kind"`
+	ClientIP    string         `json:"client_ip"`
+	Network     string         `json:"network"`
+	Known       []string       `json:"known_networks"`
+}
+
+// auditSeen maps a row key to when it was last written.
+var auditSeen sync.Map
+
+// networkOf returns the /24 (IPv4) or /48 (IPv6) containing ip, or ip
+// itself when it doesn't parse.
+func networkOf(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return p.String()
+}
+
+// RecordConnection records a connection and returns a NetworkChange when
+// it is the agent's first from this network (nil otherwise).
+func RecordConnection(ctx context.Context, db *gorm.DB, in ConnectionInfo) (*NetworkChange, error) {
+	if in.AgentID == 0 || in.ClientIP == "" {
+		return nil, nil
+	}
+	if len(in.UserAgent) > 256 {
+		in.UserAgent = in.UserAgent[:256]
+	}
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%d|%s|%s|%s|%s", in.AgentID, in.Kind, in.ClientIP, in.UserAgent, in.TLSVersion)
+	if last, ok := auditSeen.Load(key); ok && now.Sub(last.(time.Time)) < auditRefresh {
+		return nil, nil
+	}
+	auditSeen.Store(key, now)
+
+	var row ConnectionRecord
+	err := db.WithContext(ctx).
+		Where("agent_id = ? AND kind = ? AND client_ip = ? AND user_agent = ? AND tls_version = ?",
+			in.AgentID, in.Kind, in.ClientIP, in.UserAgent, in.TLSVersion).
+		First(&row).Error
+	if err == nil {
+		return nil, db.WithContext(ctx).Model(&ConnectionRecord{}).Where("id = ?", row.ID).
+			Updates(map[string]any{"last_seen_at": now, "count": gorm.Expr("count + 1")}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var known []string
+	if err := db.WithContext(ctx).Model(&ConnectionRecord{}).
+		Where("agent_id = ?", in.AgentID).Distinct().Order("network").Pluck("network", &known).Error; err != nil {
+		return nil, err
+	}
+	network := networkOf(in.ClientIP)
+	row = ConnectionRecord{
+		AgentID:     in.AgentID,
+		WorkspaceID: in.WorkspaceID,
+		Kind:        in.Kind,
+		ClientIP:    in.ClientIP,
+		Network:     network,
+		UserAgent:   in.UserAgent,
+		TLSVersion:  in.TLSVersion,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+		Count:       1,
+	}
+	if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	if len(known) == 0 {
+		return nil, nil
+	}
+	for _, n := range known {
+		if n == network {
+			return nil, nil
+		}
+	}
+	return &NetworkChange{
+		AgentID:     in.AgentID,
+		WorkspaceID: in.WorkspaceID,
+		Kind:        in.Kind,
+		ClientIP:    in.ClientIP,
+		Network:     network,
+		Known:       known,
+	}, nil
+}
+
+// ListConnections returns an agent's connection records, most recently
+// seen first.
+func ListConnections(ctx context.Context, db *gorm.DB, agentID uint, limit int) ([]ConnectionRecord, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var out []ConnectionRecord
+	err := db.WithContext(ctx).Where("agent_id = ?", agentID).
+		Order("last_seen_at DESC, id DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestRecordConnection(t *testing.T) {
+	db := newAgentTestDB(t)
+	if err := db.AutoMigrate(&ConnectionRecord{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	auditSeen = sync.Map{}
+	ctx := context.Background()
+	rec := func(kind ConnectionKind, ip, tls string) *NetworkChange {
+		t.Helper()
+		nc, err := RecordConnection(ctx, db, ConnectionInfo{AgentID: 1, WorkspaceID: 1, Kind: kind, ClientIP: ip, UserAgent: "netwatcher-agent/1.4", TLSVersion: tls})
+		if err != nil {
+			t.Fatalf("record %s %s: %v", kind, ip, err)
+		}
+		return nc
+	}
+
+	if nc := rec(ConnControl, "203.0.113.10", "TLS 1.3"); nc != nil {
+		t.Errorf("first connection flagged: %+v", nc)
+	}
+	if nc := rec(ConnUpload, "203.0.113.25", "TLS 1.3"); nc != nil {
+		t.Errorf("same /24 flagged: %+v", nc)
+	}
+	// A repeat inside the refresh window isn't written again.
+	rec(ConnUpload, "203.0.113.25", "TLS 1.3")
+
+	nc := rec(ConnUpload, "198.51.100.7", "TLS 1.2")
+	if nc == nil || nc.Network != "198.51.100.0/24" || len(nc.Known) != 1 || nc.Known[0] != "203.0.113.0/24" {
+		t.Fatalf("new network = %+v", nc)
+	}
+
+	list, err := ListConnections(ctx, db, 1, 0)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("list = %d rows, %v", len(list), err)
+	}
+	for _, r := range list {
+		if r.Count != 1 {
+			t.Errorf("%s %s count = %d, want 1", r.Kind, r.ClientIP, r.Count)
+		}
+	}
+
+	if got := networkOf("2001:db8:1234:5678::1"); got != "2001:db8:1234::/48" {
+		t.Errorf("v6 network = %s", got)
+	}
+}
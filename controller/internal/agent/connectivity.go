@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Network types with their own heartbeat grace. Cellular and satellite
+// links drop heartbeats routinely without the agent being down.
+const (
+	NetworkTypeWired     = "wired"
+	NetworkTypeWiFi      = "wifi"
+	NetworkTypeCellular  = "cellular"
+	NetworkTypeSatellite = "satellite"
+)
+
+// NetworkTypeLabel is the label key consulted when an agent has no
+// NetworkType set, so whole groups can be configured through labels.
+const NetworkTypeLabel = "network_type"
+
+// Connectivity states. Degraded sits between online and offline: the
+// agent missed heartbeats but is still within its offline threshold.
+const (
+	ConnectivityOnline   = "online"
+	ConnectivityDegraded = "degraded"
+	ConnectivityOffline  = "offline"
+)
+
+// MaxOfflineThreshold bounds per-agent overrides.
+const MaxOfflineThreshold = 24 * time.Hour
+
+// ConnectivityThresholds are the last-seen ages at which an agent stops
+// being online (Degraded) and becomes offline (Offline).
+type ConnectivityThresholds struct {
+	Degraded time.Duration `json:"degraded"`
+	Offline  time.Duration `json:"offline"`
+}
+
+var networkTypeThresholds = map[string]ConnectivityThresholds{
+	NetworkTypeWired:     {Degraded: time.Minute, Offline: 5 * time.Minute},
+	NetworkTypeWiFi:      {Degraded: time.Minute, Offline: 5 * time.Minute},
+	NetworkTypeCellular:  {Degraded: 3 * time.Minute, Offline: 15 * time.Minute},
+	NetworkTypeSatellite: {Degraded: 5 * time.Minute, Offline: 30 * time.Minute},
+}
+
+// ValidNetworkType reports whether t is empty or a known network type.
+func ValidNetworkType(t string) bool {
+	_, ok := networkTypeThresholds[t]
+	return t == "" || ok
+}
+
+// ResolveConnectivityThresholds returns the thresholds for an agent: the
+// network type (or the network_type label when unset) picks the defaults,
+// and a positive offlineSeconds overrides the offline threshold.
+func ResolveConnectivityThresholds(networkType string, offlineSeconds int, labels datatypes.JSON) ConnectivityThresholds {
+	if networkType == "" {
+		networkType = labelString(labels, NetworkTypeLabel)
+	}
+	th, ok := networkTypeThresholds[strings.ToLower(networkType)]
+	if !ok {
+		th = networkTypeThresholds[NetworkTypeWired]
+	}
+	if offlineSeconds > 0 {
+		th.Offline = min(time.Duration(offlineSeconds)*time.Second, MaxOfflineThreshold)
+		th.Degraded = min(th.Degraded, th.Offline)
+	}
+	return th
+}
+
+// Classify returns the connectivity state for an agent last seen at
+// lastSeen.
+func (th ConnectivityThresholds) Classify(lastSeen, now time.Time) string {
+	switch age := now.Sub(lastSeen); {
+	case age < th.Degraded:
+		return ConnectivityOnline
+	case age < th.Offline:
+		return ConnectivityDegraded
+	default:
+		return ConnectivityOffline
+	}
+}
+
+// ConnectivityThresholds returns the agent's resolved thresholds.
+func (a *Agent) ConnectivityThresholds() ConnectivityThresholds {
+	return ResolveConnectivityThresholds(a.NetworkType, a.OfflineThresholdSeconds, a.Labels)
+}
+
+// Connectivity classifies the agent by LastSeenAt.
+func (a *Agent) Connectivity(now time.Time) string {
+	return a.ConnectivityThresholds().Classify(a.LastSeenAt, now)
+}
+
+func labelString(labels datatypes.JSON, key string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var m map[string]any
+	if json.Unmarshal(labels, &m) != nil {
+		return ""
+	}
+	s, _ := m[key].(string)
+	return s
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TestConnectivityThresholdsByNetworkType: cellular agents get a longer
+// grace than wired ones, and the label is used when the field is unset.
+func TestConnectivityThresholdsByNetworkType(t *testing.T) {
+	now := time.Now()
+	wired := Agent{LastSeenAt: now.Add(-3 * time.Minute)}
+	if got := wired.Connectivity(now); got != ConnectivityDegraded {
+		t.Errorf("wired after 3m = %q, want degraded", got)
+	}
+	cellular := Agent{LastSeenAt: now.Add(-3 * time.Minute), NetworkType: NetworkTypeCellular}
+	if got := cellular.Connectivity(now); got != ConnectivityDegraded {
+		t.Errorf("cellular after 3m = %q, want degraded", got)
+	}
+	cellular.LastSeenAt = now.Add(-10 * time.Minute)
+	if got := cellular.Connectivity(now); got != ConnectivityDegraded {
+		t.Errorf("cellular after 10m = %q, want degraded", got)
+	}
+	labeled := Agent{LastSeenAt: now.Add(-2 * time.Minute), Labels: datatypes.JSON(`{"network_type":"satellite"}`)}
+	if got := labeled.Connectivity(now); got != ConnectivityOnline {
+		t.Errorf("satellite label after 2m = %q, want online", got)
+	}
+	stale := Agent{LastSeenAt: now.Add(-6 * time.Minute)}
+	if got := stale.Connectivity(now); got != ConnectivityOffline {
+		t.Errorf("wired after 6m = %q, want offline", got)
+	}
+}
+
+// TestConnectivityThresholdOverride: an explicit offline threshold wins
+// and never leaves the degraded threshold above it.
+func TestConnectivityThresholdOverride(t *testing.T) {
+	th := ResolveConnectivityThresholds(NetworkTypeSatellite, 120, nil)
+	if th.Offline != 2*time.Minute || th.Degraded != 2*time.Minute {
+		t.Errorf("thresholds = %+v", th)
+	}
+	th = ResolveConnectivityThresholds("", int((48 * time.Hour).Seconds()), nil)
+	if th.Offline != MaxOfflineThreshold {
+		t.Errorf("offline = %s, want capped at %s", th.Offline, MaxOfflineThreshold)
+	}
+}
@@ -0,0 +1,328 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// -------------------- Merge duplicate agents --------------------
+//
+// A reinstalled agent sometimes registers as a new agent, splitting its
+// history across two IDs. MergeAgents folds the duplicate into the
+// canonical agent: probes, targets pointing at it, alerts, share links
+// and IP/onboarding history are re-pointed, probe_data is rewritten in
+// ClickHouse, labels/metadata fill gaps on the canonical agent, and the
+// duplicate is soft-deleted.
+//
+// The whole thing runs in one transaction. A dry run executes it and
+// rolls back, so the preview counts are exactly what the merge would do.
+// A real merge must repeat the duplicate's name in Confirm.
+
+var (
+	ErrMergeInvalid      = errors.New("invalid merge")
+	ErrMergeNotConfirmed = errors.New("merge not confirmed")
+)
+
+// errMergeDryRun rolls back a dry-run transaction.
+var errMergeDryRun = errors.New("dry run")
+
+// MergeInput names the agents to merge.
+type MergeInput struct {
+	CanonicalAgentID uint   `json:"canonical_agent_id"`
+	DuplicateAgentID uint   `json:"duplicate_agent_id"`
+	DryRun           bool   `json:"dry_run"`
+	Confirm          string `json:"confirm"` // must equal the duplicate's name unless DryRun
+}
+
+// MergeReport describes what a merge changed (or would change).
+type MergeReport struct {
+	CanonicalAgentID uint   `json:"canonical_agent_id"`
+	CanonicalName    string `json:"canonical_name"`
+	DuplicateAgentID uint   `json:"duplicate_agent_id"`
+	DuplicateName    string `json:"duplicate_name"`
+	WorkspaceID      uint   `json:"workspace_id"`
+	DryRun           bool   `json:"dry_run"`
+
+	// Moved counts re-pointed rows per table; Removed counts rows dropped
+	// because they can't carry over (PINs, speedtest server cache).
+	Moved   map[string]int64 `json:"moved"`
+	Removed map[string]int64 `json:"removed"`
+	// ProbesDisabled are moved probes that duplicate a probe the canonical
+	// agent already has; they are kept (with their history) but disabled.
+	ProbesDisabled []uint `json:"probes_disabled"`
+	// SelfTargetsRemoved are targets that would have pointed a probe at
+	// its own agent after the merge.
+	SelfTargetsRemoved int64    `json:"self_targets_removed"`
+	MetadataKeysAdded  []string `json:"metadata_keys_added"`
+	ProbeDataRewritten bool     `json:"probe_data_rewritten"`
+}
+
+// ProbeDataReassigner rewrites telemetry rows from one agent ID to
+// another (agent_id, probe_agent_id and target_agent).
+type ProbeDataReassigner func(ctx context.Context, from, to uint) error
+
+// mergeRepointTables have an agent_id column that moves to the canonical
+// agent as-is.
+var mergeRepointTables = []string{
+	"probes", "alert_rules", "alerts", "share_links",
+	"agent_public_ips", "onboarding_runs", "speedtest_queue",
+}
+
+// mergeDropTables hold per-agent rows that are dropped: PINs are
+// credentials of the duplicate, and the speedtest server list is a cache
+// the canonical agent refreshes itself.
+var mergeDropTables = []string{"agent_pins", "agent_speedtest_servers"}
+
+type mergeProbe struct {
+	ID      uint
+	AgentID uint
+	Type    string
+	Enabled bool
+}
+
+type mergeTarget struct {
+	ProbeID   uint
+	Target    string
+	AgentID   *uint
+	DeletedAt gorm.DeletedAt
+}
+
+// MergeAgents merges in.DuplicateAgentID into in.CanonicalAgentID. Both
+// must be live agents in the same workspace. reassign may be nil when no
+// telemetry store is configured.
+func MergeAgents(ctx context.Context, db *gorm.DB, in MergeInput, reassign ProbeDataReassigner) (*MergeReport, error) {
+	if in.CanonicalAgentID == 0 || in.DuplicateAgentID == 0 {
+		return nil, fmt.Errorf("%w: canonical_agent_id and duplicate_agent_id required", ErrMergeInvalid)
+	}
+	if in.CanonicalAgentID == in.DuplicateAgentID {
+		return nil, fmt.Errorf("%w: an agent cannot be merged into itself", ErrMergeInvalid)
+	}
+	canon, err := GetAgentByID(ctx, db, in.CanonicalAgentID)
+	if err != nil {
+		return nil, err
+	}
+	dup, err := GetAgentByID(ctx, db, in.DuplicateAgentID)
+	if err != nil {
+		return nil, err
+	}
+	if canon.WorkspaceID != dup.WorkspaceID {
+		return nil, fmt.Errorf("%w: agents belong to different workspaces", ErrMergeInvalid)
+	}
+	if !in.DryRun && in.Confirm != dup.Name {
+		return nil, fmt.Errorf("%w: confirm must equal the duplicate agent's name %q", ErrMergeNotConfirmed, dup.Name)
+	}
+
+	rep := &MergeReport{
+		CanonicalAgentID: canon.ID, CanonicalName: canon.Name,
+		DuplicateAgentID: dup.ID, DuplicateName: dup.Name,
+		WorkspaceID: canon.WorkspaceID, DryRun: in.DryRun,
+		Moved: map[string]int64{}, Removed: map[string]int64{},
+		ProbesDisabled: []uint{}, MetadataKeysAdded: []string{},
+	}
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := mergeAgentRows(tx, canon, dup, rep); err != nil {
+			return err
+		}
+		if in.DryRun {
+			return errMergeDryRun
+		}
+		// Last, so a failed rewrite rolls the Postgres side back and the
+		// merge can be retried.
+		if reassign != nil {
+			if err := reassign(ctx, dup.ID, canon.ID); err != nil {
+				return fmt.Errorf("rewrite probe data: %w", err)
+			}
+			rep.ProbeDataRewritten = true
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMergeDryRun) {
+		return nil, err
+	}
+	if !in.DryRun {
+		log.WithFields(log.Fields{"canonical": canon.ID, "duplicate": dup.ID, "workspace": canon.WorkspaceID}).
+			Infof("agent.MergeAgents: merged duplicate agent (moved=%v disabled=%v)", rep.Moved, rep.ProbesDisabled)
+	}
+	return rep, nil
+}
+
+func mergeAgentRows(tx *gorm.DB, canon, dup *Agent, rep *MergeReport) error {
+	// Probes on the duplicate that match one the canonical agent already
+	// runs would double-probe the target once moved.
+	dupes, err := mergeDuplicateProbes(tx, canon.ID, dup.ID)
+	if err != nil {
+		return err
+	}
+	if len(dupes) > 0 {
+		if err := tx.Table("probes").Where("id IN ?", dupes).Update("enabled", false).Error; err != nil {
+			return err
+		}
+		rep.ProbesDisabled = dupes
+	}
+
+	for _, table := range mergeRepointTables {
+		if !tx.Migrator().HasTable(table) {
+			continue
+		}
+		res := tx.Table(table).Where("agent_id = ?", dup.ID).Update("agent_id", canon.ID)
+		if res.Error != nil {
+			return fmt.Errorf("%s: %w", table, res.Error)
+		}
+		rep.Moved[table] = res.RowsAffected
+	}
+
+	// Targets pointing at the duplicate: those on the canonical agent's
+	// own probes (including the ones just moved) would be self-targets.
+	ownProbes := tx.Table("probes").Select("id").Where("agent_id = ? AND deleted_at IS NULL", canon.ID)
+	res := tx.Where("agent_id IN ? AND probe_id IN (?)", []uint{dup.ID, canon.ID}, ownProbes).Delete(&mergeTarget{})
+	if res.Error != nil {
+		return res.Error
+	}
+	rep.SelfTargetsRemoved = res.RowsAffected
+	res = tx.Model(&mergeTarget{}).Where("agent_id = ?", dup.ID).Update("agent_id", canon.ID)
+	if res.Error != nil {
+		return res.Error
+	}
+	rep.Moved["probe_targets"] = res.RowsAffected
+
+	for _, table := range mergeDropTables {
+		if !tx.Migrator().HasTable(table) {
+			continue
+		}
+		res := tx.Table(table).Where("agent_id = ?", dup.ID).Delete(map[string]any{})
+		if res.Error != nil {
+			return fmt.Errorf("%s: %w", table, res.Error)
+		}
+		rep.Removed[table] = res.RowsAffected
+	}
+
+	updates := map[string]any{"updated_at": time.Now()}
+	labels, addedLabels := mergeJSONObjects(canon.Labels, dup.Labels)
+	meta, addedMeta := mergeJSONObjects(canon.Metadata, dup.Metadata)
+	if len(addedLabels) > 0 {
+		updates["labels"] = labels
+	}
+	if len(addedMeta) > 0 {
+		updates["metadata"] = meta
+	}
+	for _, k := range addedLabels {
+		rep.MetadataKeysAdded = append(rep.MetadataKeysAdded, "labels."+k)
+	}
+	for _, k := range addedMeta {
+		rep.MetadataKeysAdded = append(rep.MetadataKeysAdded, "metadata."+k)
+	}
+	for col, pair := range map[string][2]string{
+		"description":        {canon.Description, dup.Description},
+		"location":           {canon.Location, dup.Location},
+		"public_ip_override": {canon.PublicIPOverride, dup.PublicIPOverride},
+	} {
+		if pair[0] == "" && pair[1] != "" {
+			updates[col] = pair[1]
+			rep.MetadataKeysAdded = append(rep.MetadataKeysAdded, col)
+		}
+	}
+	sort.Strings(rep.MetadataKeysAdded)
+	if err := tx.Model(&Agent{}).Where("id = ?", canon.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	return tx.Delete(&Agent{}, dup.ID).Error
+}
+
+// mergeDuplicateProbes returns the duplicate's probes whose type and
+// targets match a canonical probe, treating targets of either agent as
+// the canonical one.
+func mergeDuplicateProbes(tx *gorm.DB, canonID, dupID uint) ([]uint, error) {
+	var probes []mergeProbe
+	if err := tx.Table("probes").
+		Where("agent_id IN ? AND deleted_at IS NULL", []uint{canonID, dupID}).
+		Order("id").Find(&probes).Error; err != nil {
+		return nil, err
+	}
+	if len(probes) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(probes))
+	for i, p := range probes {
+		ids[i] = p.ID
+	}
+	var targets []mergeTarget
+	if err := tx.Where("probe_id IN ?", ids).Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	byProbe := make(map[uint][]string)
+	for _, t := range targets {
+		key := strings.TrimSpace(t.Target)
+		if t.AgentID != nil {
+			aid := *t.AgentID
+			if aid == dupID {
+				aid = canonID
+			}
+			key = "agent:" + strconv.FormatUint(uint64(aid), 10)
+		}
+		byProbe[t.ProbeID] = append(byProbe[t.ProbeID], key)
+	}
+	signature := func(p mergeProbe) string {
+		ts := byProbe[p.ID]
+		sort.Strings(ts)
+		return p.Type + "|" + strings.Join(ts, ",")
+	}
+
+	canonical := make(map[string]bool)
+	for _, p := range probes {
+		if p.AgentID == canonID {
+			canonical[signature(p)] = true
+		}
+	}
+	var out []uint
+	for _, p := range probes {
+		if p.AgentID == dupID && canonical[signature(p)] {
+			out = append(out, p.ID)
+		}
+	}
+	return out, nil
+}
+
+// mergeJSONObjects adds keys from extra that base lacks. Non-object
+// values leave base unchanged.
+func mergeJSONObjects(base, extra datatypes.JSON) (datatypes.JSON, []string) {
+	var b, e map[string]any
+	if len(extra) == 0 || json.Unmarshal(extra, &e) != nil || len(e) == 0 {
+		return base, nil
+	}
+	if len(base) > 0 && json.Unmarshal(base, &b) != nil {
+		return base, nil
+	}
+	if b == nil {
+		b = make(map[string]any)
+	}
+	var added []string
+	for k, v := range e {
+		if _, ok := b[k]; !ok {
+			b[k] = v
+			added = append(added, k)
+		}
+	}
+	if len(added) == 0 {
+		return base, nil
+	}
+	sort.Strings(added)
+	out, err := json.Marshal(b)
+	if err != nil {
+		return base, nil
+	}
+	return datatypes.JSON(out), added
+}
+
+func (mergeTarget) TableName() string { return "probe_targets" }
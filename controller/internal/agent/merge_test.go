@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func TestMergeAgents(t *testing.T) {
+	db := newAgentTestDB(t)
+	ctx := context.Background()
+	for _, ddl := range []string{
+		`CREATE TABLE probes (id INTEGER PRIMARY KEY, agent_id INTEGER, type TEXT, enabled BOOLEAN DEFAULT 1, deleted_at DATETIME)`,
+		`CREATE TABLE probe_targets (id INTEGER PRIMARY KEY, probe_id INTEGER, target TEXT, agent_id INTEGER, deleted_at DATETIME)`,
+		`CREATE TABLE share_links (id INTEGER PRIMARY KEY, agent_id INTEGER)`,
+		`CREATE TABLE agent_pins (id INTEGER PRIMARY KEY, agent_id INTEGER)`,
+	} {
+		if err := db.Exec(ddl).Error; err != nil {
+			t.Fatalf("%s: %v", ddl, err)
+		}
+	}
+	mustCreateAgentRow(t, db, Agent{ID: 1, WorkspaceID: 1, Name: "branch-01", Labels: datatypes.JSON(`{"site":"hq"}`)})
+	mustCreateAgentRow(t, db, Agent{ID: 2, WorkspaceID: 1, Name: "branch-01-reinstall", Location: "Calgary",
+		Labels: datatypes.JSON(`{"site":"other","rack":"r4"}`)})
+	mustCreateAgentRow(t, db, Agent{ID: 3, WorkspaceID: 1, Name: "peer"})
+	mustCreateAgentRow(t, db, Agent{ID: 4, WorkspaceID: 2, Name: "elsewhere"})
+	for _, q := range []string{
+		`INSERT INTO probes (id, agent_id, type) VALUES (10, 1, 'PING'), (20, 2, 'PING'), (21, 2, 'MTR'), (30, 3, 'AGENT'), (31, 1, 'AGENT')`,
+		`INSERT INTO probe_targets (probe_id, target, agent_id) VALUES (10, '1.1.1.1', NULL), (20, '1.1.1.1', NULL), (21, '1.1.1.1', NULL), (30, '', 2), (31, '', 2)`,
+		`INSERT INTO share_links (agent_id) VALUES (2)`,
+		`INSERT INTO agent_pins (agent_id) VALUES (2)`,
+	} {
+		if err := db.Exec(q).Error; err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if _, err := MergeAgents(ctx, db, MergeInput{CanonicalAgentID: 1, DuplicateAgentID: 4, DryRun: true}, nil); !errors.Is(err, ErrMergeInvalid) {
+		t.Errorf("cross-workspace merge: err = %v", err)
+	}
+	if _, err := MergeAgents(ctx, db, MergeInput{CanonicalAgentID: 1, DuplicateAgentID: 2}, nil); !errors.Is(err, ErrMergeNotConfirmed) {
+		t.Errorf("unconfirmed merge: err = %v", err)
+	}
+
+	// A dry run reports the plan without changing anything.
+	preview, err := MergeAgents(ctx, db, MergeInput{CanonicalAgentID: 1, DuplicateAgentID: 2, DryRun: true}, nil)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if preview.Moved["probes"] != 2 || len(preview.ProbesDisabled) != 1 || preview.ProbesDisabled[0] != 20 || preview.SelfTargetsRemoved != 1 {
+		t.Fatalf("preview = %+v", preview)
+	}
+	var stillThere int64
+	db.Table("probes").Where("agent_id = 2").Count(&stillThere)
+	if stillThere != 2 {
+		t.Fatal("dry run changed probes")
+	}
+
+	var rewrote [2]uint
+	rep, err := MergeAgents(ctx, db, MergeInput{CanonicalAgentID: 1, DuplicateAgentID: 2, Confirm: "branch-01-reinstall"},
+		func(_ context.Context, from, to uint) error { rewrote = [2]uint{from, to}; return nil })
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if rewrote != [2]uint{2, 1} || !rep.ProbeDataRewritten {
+		t.Errorf("probe data rewrite = %v", rewrote)
+	}
+	if rep.Moved["share_links"] != 1 || rep.Moved["probe_targets"] != 1 || rep.Removed["agent_pins"] != 1 {
+		t.Errorf("report = %+v", rep)
+	}
+
+	var enabled bool
+	db.Table("probes").Select("enabled").Where("id = 20").Scan(&enabled)
+	if enabled {
+		t.Error("duplicate PING probe left enabled")
+	}
+	var peerTarget struct{ AgentID uint }
+	db.Table("probe_targets").Select("agent_id").Where("probe_id = 30").Scan(&peerTarget)
+	if peerTarget.AgentID != 1 {
+		t.Errorf("peer probe target = %d, want canonical agent", peerTarget.AgentID)
+	}
+
+	canon, _ := GetAgentByID(ctx, db, 1)
+	if canon.Location != "Calgary" || string(canon.Labels) != `{"rack":"r4","site":"hq"}` {
+		t.Errorf("canonical agent = location %q labels %s", canon.Location, canon.Labels)
+	}
+	if _, err := GetAgentByID(ctx, db, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("duplicate agent still present: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// -------------------- Config Protocol Negotiation --------------------
+
+// Agents built before negotiation existed silently ignore (or crash on)
+// probe types and config fields they don't know. Newer agents announce,
+// at login or in the websocket "version" event, which config protocol
+// they speak, which probe types they can run and which optional config
+// fields they understand. Probe delivery (probe.FilterForAgent) uses the
+// announcement to withhold or trim config the agent can't handle.
+//
+// Capabilities (capabilities.go) describe what the host allows; the
+// negotiated lists describe what the agent build understands.
+
+// ConfigProtocolVersion is the newest config protocol this controller
+// speaks. Agents that never negotiated are treated as protocol 0.
+const ConfigProtocolVersion = 1
+
+// Optional probe config fields an agent may announce.
+const (
+	FeatureDSCP          = "dscp"           // Probe.DSCP packet marking
+	FeatureBindInterface = "bind_interface" // Probe.BindInterface source binding
+)
+
+// Negotiation is what an agent announces about its build.
+type Negotiation struct {
+	Protocol   int      `json:"protocol"`
+	ProbeTypes []string `json:"probe_types,omitempty"`
+	Features   []string `json:"features,omitempty"`
+}
+
+// Empty reports whether the agent announced nothing (pre-negotiation builds).
+func (n Negotiation) Empty() bool {
+	return n.Protocol == 0 && n.ProbeTypes == nil && n.Features == nil
+}
+
+// NegotiatedProtocol returns the protocol both sides speak.
+func NegotiatedProtocol(agentProtocol int) int {
+	if agentProtocol > ConfigProtocolVersion {
+		return ConfigProtocolVersion
+	}
+	if agentProtocol < 0 {
+		return 0
+	}
+	return agentProtocol
+}
+
+// normalizeProbeTypes uppercases, de-duplicates, and sorts announced
+// probe types.
+func normalizeProbeTypes(in []string) []string {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, t := range in {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Negotiated reports whether the agent has ever announced its build.
+func (a *Agent) Negotiated() bool {
+	return a.NegotiatedAt != nil
+}
+
+func decodeStringList(raw datatypes.JSON) []string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var out []string
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// SupportedProbeTypes returns the announced probe types (uppercase).
+func (a *Agent) SupportedProbeTypes() []string {
+	return decodeStringList(a.ProbeTypes)
+}
+
+// SupportedConfigFeatures returns the announced optional config fields.
+func (a *Agent) SupportedConfigFeatures() []string {
+	return decodeStringList(a.ConfigFeatures)
+}
+
+// UpdateAgentNegotiation stores an agent's announcement. Empty
+// announcements are ignored so a legacy code path can't erase a newer
+// build's record.
+func UpdateAgentNegotiation(ctx context.Context, db *gorm.DB, id uint, n Negotiation) error {
+	if n.Empty() {
+		return nil
+	}
+	types, err := json.Marshal(normalizeProbeTypes(n.ProbeTypes))
+	if err != nil {
+		return err
+	}
+	feats, err := json.Marshal(normalizeCapabilities(n.Features))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	res := db.WithContext(ctx).Model(&Agent{}).Where("id = ?", id).Updates(map[string]any{
+		"protocol_version": n.Protocol,
+		"probe_types":      datatypes.JSON(types),
+		"config_features":  datatypes.JSON(feats),
+		"negotiated_at":    now,
+		"updated_at":       now,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
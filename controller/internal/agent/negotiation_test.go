@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+// TestUpdateAgentNegotiation_NormalizesAndKeepsOnEmpty: announced lists are
+// normalized, and a later empty announcement (legacy code path) must not
+// erase them.
+func TestUpdateAgentNegotiation_NormalizesAndKeepsOnEmpty(t *testing.T) {
+	db := newAgentTestDB(t)
+	ctx := context.Background()
+	mustCreateAgentRow(t, db, Agent{ID: 1, WorkspaceID: 1, Name: "a"})
+
+	a, _ := GetAgentByID(ctx, db, 1)
+	if a.Negotiated() {
+		t.Fatal("new agent must not be negotiated")
+	}
+
+	err := UpdateAgentNegotiation(ctx, db, 1, Negotiation{
+		Protocol:   7,
+		ProbeTypes: []string{"ping", "MTR", "PING", ""},
+		Features:   []string{"DSCP"},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := UpdateAgentNegotiation(ctx, db, 1, Negotiation{}); err != nil {
+		t.Fatalf("empty update: %v", err)
+	}
+
+	a, err = GetAgentByID(ctx, db, 1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !a.Negotiated() || a.ProtocolVersion != 7 {
+		t.Errorf("expected negotiated protocol 7, got %v/%d", a.Negotiated(), a.ProtocolVersion)
+	}
+	if types := a.SupportedProbeTypes(); len(types) != 2 || types[0] != "MTR" || types[1] != "PING" {
+		t.Errorf("expected [MTR PING], got %v", types)
+	}
+	if feats := a.SupportedConfigFeatures(); len(feats) != 1 || feats[0] != FeatureDSCP {
+		t.Errorf("expected [dscp], got %v", feats)
+	}
+	if got := NegotiatedProtocol(a.ProtocolVersion); got != ConfigProtocolVersion {
+		t.Errorf("newer agent must negotiate down to %d, got %d", ConfigProtocolVersion, got)
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// -------------------- Connection status history --------------------
+//
+// LastSeenAt only says when an agent was last heard from. The controller
+// also records each WebSocket connect and disconnect so the workspace
+// timeline can show when an agent went offline and came back. Events are
+// written by the controller that holds the connection; a controller
+// restart drops connections without disconnect events, which readers
+// handle by collapsing repeated states.
+
+// StatusEvent is one agent connect (Online) or disconnect.
+type StatusEvent struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID     uint      `gorm:"not null;index" json:"agent_id"`
+	WorkspaceID uint      `gorm:"not null;index:idx_agent_status_events_ws_at,priority:1" json:"workspace_id"`
+	At          time.Time `gorm:"not null;index:idx_agent_status_events_ws_at,priority:2" json:"at"`
+	Online      bool      `json:"online"`
+	ClientIP    string    `gorm:"size:64" json:"client_ip,omitempty"`
+}
+
+func (StatusEvent) TableName() string { return "agent_status_events" }
+
+// RecordStatusEvent stores a connect or disconnect for the agent.
+func RecordStatusEvent(ctx context.Context, db *gorm.DB, ev StatusEvent) error {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	ev.At = ev.At.UTC()
+	return db.WithContext(ctx).Create(&ev).Error
+}
+
+// ListStatusEvents returns a workspace's status events in [from, to),
+// oldest first. agentID 0 lists all agents.
+func ListStatusEvents(ctx context.Context, db *gorm.DB, workspaceID, agentID uint, from, to time.Time) ([]StatusEvent, error) {
+	q := db.WithContext(ctx).Where("workspace_id = ? AND at >= ? AND at < ?", workspaceID, from, to)
+	if agentID != 0 {
+		q = q.Where("agent_id = ?", agentID)
+	}
+	var out []StatusEvent
+	err := q.Order("at, id").Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	apperr "netwatcher-controller/internal/errors"
+	"netwatcher-controller/internal/extid"
+	"netwatcher-controller/internal/region"
+)
+
+// ErrBadInput is matched by the *apperr.ValidationError agent create and
+// patch validation returns.
+var ErrBadInput = errors.New("invalid agent input")
+
+const (
+	maxNameLen    = 255
+	minPINLength  = 6
+	maxPINLength  = 32
+	maxHostLength = 64
+)
+
+// PatchInput holds the patchable agent fields that have format rules; nil
+// fields are not changed.
+type PatchInput struct {
+	ExternalID              *string
+	Name                    *string
+	Description             *string
+	Location                *string
+	PublicIPOverride        *string
+	TrafficSimHost          *string
+	TrafficSimPort          *int
+	NetworkType             *string
+	OfflineThresholdSeconds *int
+	ProvisionedDownMbps     *float64
+	ProvisionedUpMbps       *float64
+	Timezone                *string
+	Region                  *string
+}
+
+// ValidateCreateInput checks a CreateInput and reports every invalid field
+// at once.
+func ValidateCreateInput(in CreateInput) error {
+	v := &apperr.ValidationError{Kind: ErrBadInput}
+	if in.WorkspaceID == 0 {
+		v.Add("workspace_id", "required")
+	}
+	if strings.TrimSpace(in.Name) == "" {
+		v.Add("name", "required")
+	}
+	if in.PinLength != 0 && (in.PinLength < minPINLength || in.PinLength > maxPINLength) {
+		v.Add("pinLength", fmt.Sprintf("must be between %d and %d", minPINLength, maxPINLength))
+	}
+	if in.PIN != "" && (len(in.PIN) < minPINLength || len(in.PIN) > maxPINLength || strings.Trim(in.PIN, "0123456789") != "") {
+		v.Add("pin", fmt.Sprintf("must be %d to %d digits", minPINLength, maxPINLength))
+	}
+	if in.PINTTL != nil && *in.PINTTL < 0 {
+		v.Add("pinTTLSeconds", "must not be negative")
+	}
+	var port *int // 0 takes the column default
+	if in.TrafficSimPort != 0 {
+		port = &in.TrafficSimPort
+	}
+	validateCommon(v, PatchInput{
+		ExternalID:       optional(in.ExternalID),
+		Name:             &in.Name,
+		Description:      &in.Description,
+		Location:         &in.Location,
+		PublicIPOverride: &in.PublicIPOverride,
+		TrafficSimHost:   optional(in.TrafficSimHost),
+		TrafficSimPort:   port,
+	})
+	return v.Err()
+}
+
+// ValidatePatchInput checks the fields a PATCH sets and reports every
+// invalid one at once.
+func ValidatePatchInput(in PatchInput) error {
+	v := &apperr.ValidationError{Kind: ErrBadInput}
+	if in.Name != nil && strings.TrimSpace(*in.Name) == "" {
+		v.Add("name", "must not be empty")
+	}
+	validateCommon(v, in)
+	return v.Err()
+}
+
+func validateCommon(v *apperr.ValidationError, in PatchInput) {
+	if in.ExternalID != nil {
+		if _, err := extid.Normalize(*in.ExternalID); err != nil {
+			v.Add("external_id", strings.TrimPrefix(err.Error(), extid.ErrInvalid.Error()+": "))
+		}
+	}
+	if in.Name != nil && len(*in.Name) > maxNameLen {
+		v.Add("name", fmt.Sprintf("exceeds %d characters", maxNameLen))
+	}
+	if in.Description != nil && len(*in.Description) > maxNameLen {
+		v.Add("description", fmt.Sprintf("exceeds %d characters", maxNameLen))
+	}
+	if in.Location != nil && len(*in.Location) > maxNameLen {
+		v.Add("location", fmt.Sprintf("exceeds %d characters", maxNameLen))
+	}
+	if s := in.PublicIPOverride; s != nil && *s != "" && net.ParseIP(strings.TrimSpace(*s)) == nil {
+		v.Add("public_ip_override", "must be an IP address (or empty)")
+	}
+	if s := in.TrafficSimHost; s != nil {
+		if h := strings.TrimSpace(*s); h == "" || len(h) > maxHostLength || (strings.ContainsAny(h, " /:") && net.ParseIP(h) == nil) {
+			v.Add("trafficsim_host", "must be an IP address or hostname to listen on")
+		}
+	}
+	if p := in.TrafficSimPort; p != nil && (*p < 1 || *p > 65535) {
+		v.Add("trafficsim_port", "must be between 1 and 65535")
+	}
+	if in.NetworkType != nil && !ValidNetworkType(*in.NetworkType) {
+		v.Add("network_type", "must be one of wired, wifi, cellular, satellite (or empty)")
+	}
+	if s := in.OfflineThresholdSeconds; s != nil && (*s < 0 || time.Duration(*s)*time.Second > MaxOfflineThreshold) {
+		v.Add("offline_threshold_seconds", fmt.Sprintf("must be between 0 and %d", int(MaxOfflineThreshold/time.Second)))
+	}
+	if m := in.ProvisionedDownMbps; m != nil && (*m < 0 || *m > MaxProvisionedMbps) {
+		v.Add("provisioned_down_mbps", fmt.Sprintf("must be between 0 and %d", MaxProvisionedMbps))
+	}
+	if m := in.ProvisionedUpMbps; m != nil && (*m < 0 || *m > MaxProvisionedMbps) {
+		v.Add("provisioned_up_mbps", fmt.Sprintf("must be between 0 and %d", MaxProvisionedMbps))
+	}
+	if in.Timezone != nil {
+		if _, err := time.LoadLocation(*in.Timezone); err != nil {
+			v.Add("timezone", "must be an IANA time zone name such as America/Toronto (or empty for UTC)")
+		}
+	}
+	if r := in.Region; r != nil && *r != "" && !region.ValidName(*r) {
+		v.Add("region", "must be lowercase letters, digits and dashes, up to 32 characters (or empty for the home region)")
+	}
+}
+
+// optional returns nil for an empty string, so fields left to their
+// defaults on create are not checked.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
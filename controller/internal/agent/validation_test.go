@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	apperr "netwatcher-controller/internal/errors"
+)
+
+func TestValidateAgentInput(t *testing.T) {
+	if err := ValidateCreateInput(CreateInput{WorkspaceID: 1, Name: "hq", TrafficSimHost: "0.0.0.0"}); err != nil {
+		t.Fatalf("valid create: %v", err)
+	}
+
+	err := ValidateCreateInput(CreateInput{WorkspaceID: 1, PinLength: 4, PIN: "12ab", PublicIPOverride: "not-an-ip", TrafficSimPort: 70000})
+	var v *apperr.ValidationError
+	if !errors.Is(err, ErrBadInput) || !errors.As(err, &v) {
+		t.Fatalf("err = %v, want *ValidationError matching ErrBadInput", err)
+	}
+	fields := make(map[string]bool)
+	for _, f := range v.Fields {
+		fields[f.Field] = true
+	}
+	for _, want := range []string{"name", "pinLength", "pin", "public_ip_override", "trafficsim_port"} {
+		if !fields[want] {
+			t.Errorf("missing %s in %v", want, v.Fields)
+		}
+	}
+
+	empty, tz, port := "", "Mars/Olympus", 0
+	err = ValidatePatchInput(PatchInput{Name: &empty, Timezone: &tz, TrafficSimPort: &port})
+	if !errors.As(err, &v) || len(v.Fields) != 3 {
+		t.Errorf("patch: %v", err)
+	}
+	if err := ValidatePatchInput(PatchInput{}); err != nil {
+		t.Errorf("empty patch: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AgentNetworkContext describes an agent connection from a network it
+// hasn't used before (see agent.RecordConnection).
+type AgentNetworkContext struct {
+	WorkspaceID uint
+	AgentID     uint
+	AgentName   string
+	Kind        string // control, upload or api
+	ClientIP    string
+	Network     string
+	Known       []string
+}
+
+// EvaluateUnexpectedNetwork raises an alert on every enabled
+// unexpected_network rule that covers the agent. The condition is the
+// event itself, so the rule's operator and threshold are not consulted.
+func EvaluateUnexpectedNetwork(ctx context.Context, db *gorm.DB, nctx AgentNetworkContext) error {
+	var rules []AlertRule
+	err := db.WithContext(ctx).
+		Where("enabled = ? AND workspace_id = ? AND metric = ? AND (agent_id = ? OR agent_id IS NULL)",
+			true, nctx.WorkspaceID, MetricUnexpectedNetwork, nctx.AgentID).
+		Find(&rules).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch alert rules: %w", err)
+	}
+
+	message := fmt.Sprintf("Agent %s %s from %s (%s); previously seen from %s",
+		nctx.AgentName, connectionVerb(nctx.Kind), nctx.ClientIP, nctx.Network, strings.Join(nctx.Known, ", "))
+	for _, rule := range rules {
+		if isInMaintenanceWindow(ctx, db, &rule) {
+			continue
+		}
+		actx := &AlertContext{AgentID: nctx.AgentID, AgentName: nctx.AgentName}
+		key := fmt.Sprintf("agent-network:%d:%s", nctx.AgentID, nctx.Network)
+		if _, _, err := RaiseAlert(ctx, db, &rule, key, 1, message, actx); err != nil {
+			log.Errorf("alert.EvaluateUnexpectedNetwork: rule %d: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+func connectionVerb(kind string) string {
+	switch kind {
+	case "upload":
+		return "uploaded results"
+	case "api":
+		return "called the agent API"
+	}
+	return "connected"
+}
@@ -80,18 +80,6 @@ func EvaluateAgentOffline(ctx context.Context, db *gorm.DB) error {
 				triggered := ShouldTrigger(rule.Operator, minutesSinceLastSeen, rule.Threshold)
 
 				if triggered {
-					// Check if there's already an active alert for this rule + agent
-					var existing Alert
-					err := db.WithContext(ctx).
-						Where("alert_rule_id = ? AND agent_id = ? AND status = ?", rule.ID, agent.ID, StatusActive).
-						First(&existing).Error
-
-					if err == nil {
-						// Active alert already exists, skip
-						continue
-					}
-
-					// Create new alert
 					message := fmt.Sprintf("Agent offline for %.0f minutes (threshold: %.0f min)",
 						minutesSinceLastSeen, rule.Threshold)
 
@@ -100,14 +88,15 @@ func EvaluateAgentOffline(ctx context.Context, db *gorm.DB) error {
 						AgentName: agent.Name,
 					}
 
-					alertInstance, err := CreateAlert(ctx, db, &rule, minutesSinceLastSeen, message, actx)
+					// One alert per rule and agent; see RaiseAlert for renotify.
+					_, reason, err := RaiseAlert(ctx, db, &rule, fmt.Sprintf("agent:%d", agent.ID), minutesSinceLastSeen, message, actx)
 					if err != nil {
 						log.Errorf("alert.EvaluateAgentOffline: failed to create alert: %v", err)
 						continue
 					}
-
-					// Dispatch notifications
-					go DispatchNotifications(ctx, db, &rule, alertInstance)
+					if reason != ReasonNew {
+						continue
+					}
 
 					log.Infof("Agent offline alert triggered: rule=%d, agent=%d (%s), offline_minutes=%.0f, threshold=%.0f",
 						rule.ID, agent.ID, agent.Name, minutesSinceLastSeen, rule.Threshold)
@@ -54,6 +54,11 @@ const (
 	// SNMP metrics
 	MetricSNMPResponseMs Metric = "snmp_response_ms" // SNMP query response time (ms)
 	MetricSNMPTrapReceived Metric = "snmp_trap_received" // SNMP trap received from monitored device
+	// PMTU metrics
+	MetricPathMTU       Metric = "path_mtu"       // Discovered path MTU (bytes)
+	MetricPMTUBlackhole Metric = "pmtu_blackhole" // Oversized packets dropped silently (1 = blackhole)
+	// Agent connection metrics
+	MetricUnexpectedNetwork Metric = "unexpected_network" // Agent connected from a network it never used (1 = new network)
 	// AI Analysis metrics (workspace-level, generated by analysis engine)
 	MetricHealthScore     Metric = "health_score"     // Overall workspace health below threshold
 	MetricLatencyBaseline Metric = "latency_baseline" // Latency regression vs 7-day baseline
@@ -128,11 +133,12 @@ type AlertRule struct {
 	LogicalOp  LogicalOperator `gorm:"type:VARCHAR(8);default:'AND'" json:"logical_op"`
 
 	// Notification channels
-	NotifyPanel   bool   `gorm:"default:true" json:"notify_panel"`         // Show in panel alerts (always on)
-	NotifyEmail   bool   `gorm:"default:false" json:"notify_email"`        // Email workspace members
-	NotifyWebhook bool   `gorm:"default:false" json:"notify_webhook"`      // Send to webhook URL
-	WebhookURL    string `gorm:"size:512" json:"webhook_url,omitempty"`     // Webhook endpoint
-	WebhookSecret string `gorm:"size:128" json:"webhook_secret,omitempty"` // Optional HMAC secret
+	NotifyPanel      bool   `gorm:"default:true" json:"notify_panel"`      // Show in panel alerts (always on)
+	NotifyEmail      bool   `gorm:"default:false" json:"notify_email"`     // Email workspace members
+	NotifyWebhook    bool   `gorm:"default:false" json:"notify_webhook"`   // Send to webhook URL
+	WebhookURL       string `gorm:"size:512" json:"webhook_url,omitempty"` // Webhook endpoint
+	WebhookSecret    string `gorm:"size:128" json:"-"`                     // Per-rule HMAC secret, see WebhookDelivery
+	HasWebhookSecret bool   `gorm:"-" json:"has_webhook_secret"`
 
 	// Cooldown prevents alert storms by suppressing duplicate alerts for a quiet period
 	// Value is in minutes; 0 means no cooldown (alert every time threshold is breached)
@@ -146,6 +152,12 @@ type AlertRule struct {
 
 func (AlertRule) TableName() string { return "alert_rules" }
 
+// AfterFind reports whether a signing secret is set without exposing it.
+func (r *AlertRule) AfterFind(*gorm.DB) error {
+	r.HasWebhookSecret = r.WebhookSecret != ""
+	return nil
+}
+
 // Alert stores triggered alert instances
 type Alert struct {
 	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -175,6 +187,16 @@ type Alert struct {
 	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
 	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
 	AcknowledgedBy *uint      `json:"acknowledged_by,omitempty"`
+
+	// Dedup and renotify state, see notify_policy.go
+	DedupKey       string     `gorm:"size:256;index" json:"dedup_key,omitempty"`
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+	NotifyCount    int        `gorm:"default:1" json:"notify_count"`
+	// SilenceID is the silence that muted the alert's last notification
+	// (see silence.go); cleared once it notifies again.
+	SilenceID    *uint  `gorm:"index" json:"silence_id,omitempty"`
+	NotifyReason string `gorm:"-" json:"-"` // set for the dispatch in progress
+	Recovery       *Recovery  `gorm:"-" json:"-"` // set for a recovery dispatch
 }
 
 func (Alert) TableName() string { return "alerts" }
@@ -290,7 +312,7 @@ type UpdateRuleInput struct {
 
 // Migrate creates the tables
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(&AlertRule{}, &Alert{}, &MaintenanceWindow{})
+	return db.AutoMigrate(&AlertRule{}, &Alert{}, &MaintenanceWindow{}, &NotificationPolicy{}, &Silence{})
 }
 
 // CreateRule creates a new alert rule
@@ -364,9 +386,31 @@ func CreateRule(ctx context.Context, db *gorm.DB, in CreateRuleInput) (*AlertRul
 	}
 	rule.MaintenanceWindowID = in.MaintenanceWindowID
 
+	// Notification channels
+	rule.NotifyPanel = true
+	if in.NotifyEmail != nil {
+		rule.NotifyEmail = *in.NotifyEmail
+	}
+	if in.NotifyWebhook != nil {
+		rule.NotifyWebhook = *in.NotifyWebhook
+	}
+	if err := validateWebhookURL(in.WebhookURL); err != nil {
+		return nil, err
+	}
+	rule.WebhookURL = in.WebhookURL
+	rule.WebhookSecret = in.WebhookSecret
+	if rule.NotifyWebhook && rule.WebhookURL != "" && rule.WebhookSecret == "" {
+		secret, err := GenerateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		rule.WebhookSecret = secret
+	}
+
 	if err := db.WithContext(ctx).Create(rule).Error; err != nil {
 		return nil, err
 	}
+	rule.HasWebhookSecret = rule.WebhookSecret != ""
 	return rule, nil
 }
 
@@ -453,6 +497,22 @@ func UpdateRule(ctx context.Context, db *gorm.DB, in UpdateRuleInput) (*AlertRul
 	if in.MaintenanceWindowID != nil {
 		updates["maintenance_window_id"] = *in.MaintenanceWindowID
 	}
+	// Notification channels
+	if in.NotifyEmail != nil {
+		updates["notify_email"] = *in.NotifyEmail
+	}
+	if in.NotifyWebhook != nil {
+		updates["notify_webhook"] = *in.NotifyWebhook
+	}
+	if in.WebhookURL != nil {
+		if err := validateWebhookURL(*in.WebhookURL); err != nil {
+			return nil, err
+		}
+		updates["webhook_url"] = *in.WebhookURL
+	}
+	if in.WebhookSecret != nil {
+		updates["webhook_secret"] = *in.WebhookSecret
+	}
 
 	res := db.WithContext(ctx).Model(&AlertRule{}).Where("id = ?", in.ID).Updates(updates)
 	if res.Error != nil {
@@ -462,7 +522,19 @@ func UpdateRule(ctx context.Context, db *gorm.DB, in UpdateRuleInput) (*AlertRul
 		return nil, ErrNotFound
 	}
 
-	return GetRuleByID(ctx, db, in.ID)
+	rule, err := GetRuleByID(ctx, db, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	// A webhook is never delivered unsigned: enabling one without a
+	// secret generates it.
+	if rule.NotifyWebhook && rule.WebhookURL != "" && rule.WebhookSecret == "" {
+		if _, err := RotateWebhookSecret(ctx, db, rule.ID); err != nil {
+			return nil, err
+		}
+		return GetRuleByID(ctx, db, in.ID)
+	}
+	return rule, nil
 }
 
 // DeleteRule deletes an alert rule
@@ -487,6 +559,8 @@ type AlertContext struct {
 	ProbeTarget string
 	AgentID     uint
 	AgentName   string
+	Severity    Severity // overrides the rule's severity when set
+	DedupKey    string
 }
 
 // CreateAlert creates a new alert instance with optional contextual information
@@ -519,7 +593,13 @@ func CreateAlert(ctx context.Context, db *gorm.DB, rule *AlertRule, value float6
 		alert.ProbeName = actx.ProbeName
 		alert.ProbeTarget = actx.ProbeTarget
 		alert.AgentName = actx.AgentName
+		if actx.Severity != "" {
+			alert.Severity = actx.Severity
+		}
+		alert.DedupKey = actx.DedupKey
 	}
+	alert.LastNotifiedAt = &alert.TriggeredAt
+	alert.NotifyCount = 1
 
 	if err := db.WithContext(ctx).Create(alert).Error; err != nil {
 		return nil, err
@@ -162,14 +162,16 @@ func getOrZero(pcts map[float64]float64, p float64) float64 {
 	return 0
 }
 
-type pingPayload struct {
-	AvgRTT     int64   `json:"avg_rtt"`
-	MinRTT     int64   `json:"min_rtt"`
-	MaxRTT     int64   `json:"max_rtt"`
-	PacketLoss float64 `json:"packet_loss"`
-}
+// ParsePingPayload decodes a stored PING payload into its average RTT and
+// packet loss (percent). The probe package installs probe.ParsePingPayload
+// here, so baselines read every payload version the same way as the rest
+// of the controller; alert can't import probe directly.
+var ParsePingPayload func(raw []byte) (avgRTT time.Duration, packetLoss float64, err error)
 
 func fetchPingMetric(ctx context.Context, ch *sql.DB, probeID uint, metric Metric, from time.Time) []float64 {
+	if ParsePingPayload == nil {
+		return nil
+	}
 	q := fmt.Sprintf(`
 		SELECT payload_raw
 		FROM probe_data
@@ -190,18 +192,18 @@ func fetchPingMetric(ctx context.Context, ch *sql.DB, probeID uint, metric Metri
 		if err := rows.Scan(&raw); err != nil {
 			continue
 		}
-		var p pingPayload
-		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		avgRTT, loss, err := ParsePingPayload([]byte(raw))
+		if err != nil {
 			continue
 		}
 		switch metric {
 		case MetricLatency:
-			if p.AvgRTT > 0 {
-				vals = append(vals, float64(p.AvgRTT)/1e6)
+			if avgRTT > 0 {
+				vals = append(vals, float64(avgRTT)/1e6)
 			}
 		case MetricPacketLoss:
-			if p.PacketLoss >= 0 {
-				vals = append(vals, p.PacketLoss)
+			if loss >= 0 {
+				vals = append(vals, loss)
 			}
 		}
 	}
@@ -78,6 +78,8 @@ func EvaluateProbeData(ctx context.Context, db *gorm.DB, ch *sql.DB, pctx ProbeC
 			result = evaluateTlsRule(&rule, pctx, payloadJSON)
 		case "SNMP":
 			result = evaluateSnmpRule(&rule, pctx, payloadJSON)
+		case "PMTU":
+			result = evaluatePmtuRule(&rule, pctx, payloadJSON)
 		default:
 			result = evaluateStandardRule(ctx, db, ch, &rule, pctx, payloadJSON)
 		}
@@ -99,18 +101,8 @@ func EvaluateProbeData(ctx context.Context, db *gorm.DB, ch *sql.DB, pctx ProbeC
 				continue
 			}
 
-			// Check if there's already an active alert for this rule
-			var existing Alert
-			err := db.WithContext(ctx).
-				Where("alert_rule_id = ? AND status = ?", rule.ID, StatusActive).
-				First(&existing).Error
-
-			if err == nil {
-				// Active alert already exists, skip
-				continue
-			}
-
-			// Create new alert with context
+			// One alert per rule and probe; the workspace notification
+			// policy decides whether an active one notifies again.
 			actx := &AlertContext{
 				ProbeID:     pctx.ProbeID,
 				ProbeType:   pctx.ProbeType,
@@ -120,14 +112,14 @@ func EvaluateProbeData(ctx context.Context, db *gorm.DB, ch *sql.DB, pctx ProbeC
 				AgentName:   pctx.AgentName,
 			}
 
-			alertInstance, err := CreateAlert(ctx, db, &rule, result.Value, result.Message, actx)
+			_, reason, err := RaiseAlert(ctx, db, &rule, fmt.Sprintf("probe:%d", pctx.ProbeID), result.Value, result.Message, actx)
 			if err != nil {
 				log.Errorf("alert.EvaluateProbeData: failed to create alert: %v", err)
 				continue
 			}
-
-			// Dispatch notifications
-			go DispatchNotifications(ctx, db, &rule, alertInstance)
+			if reason != ReasonNew {
+				continue
+			}
 
 			log.Infof("Alert triggered: rule=%d, probe=%d (%s), metric=%s, value=%.2f",
 				rule.ID, pctx.ProbeID, pctx.ProbeType, result.Metric, result.Value)
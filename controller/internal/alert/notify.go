@@ -3,9 +3,6 @@ package alert
 import (
 	"bytes"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -33,6 +30,13 @@ type NotificationPayload struct {
 	Severity    string    `json:"severity"`
 	Message     string    `json:"message"`
 	TriggeredAt time.Time `json:"triggered_at"`
+	// Notification is "new", "renotify", "escalation" or "recovery";
+	// NotifyCount counts deliveries for this alert including this one.
+	Notification string `json:"notification,omitempty"`
+	NotifyCount  int    `json:"notify_count,omitempty"`
+	// Recovery is set on "recovery" notifications.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Recovery   *Recovery  `json:"recovery,omitempty"`
 }
 
 // buildPanelURL constructs a deep link to the relevant agent/probe page
@@ -64,6 +68,11 @@ func DispatchNotifications(ctx context.Context, db *gorm.DB, rule *AlertRule, al
 		Severity:    string(alertInstance.Severity),
 		Message:     alertInstance.Message,
 		TriggeredAt: alertInstance.TriggeredAt,
+
+		Notification: alertInstance.NotifyReason,
+		NotifyCount:  alertInstance.NotifyCount,
+		ResolvedAt:   alertInstance.ResolvedAt,
+		Recovery:     alertInstance.Recovery,
 	}
 
 	// Panel notifications are automatic (stored in DB, fetched by frontend)
@@ -97,12 +106,10 @@ func sendWebhookNotification(webhookURL, secret string, payload NotificationPayl
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "NetWatcher-Alert/1.0")
 
-	// Add HMAC signature if secret is configured
-	if secret != "" {
-		mac := hmac.New(sha256.New, []byte(secret))
-		mac.Write(jsonPayload)
-		signature := hex.EncodeToString(mac.Sum(nil))
-		req.Header.Set("X-NetWatcher-Signature", fmt.Sprintf("sha256=%s", signature))
+	// Timestamp, delivery ID and HMAC signatures (see webhook_signing.go)
+	if err := SignWebhookRequest(req, secret, jsonPayload, time.Now()); err != nil {
+		log.Errorf("alert.sendWebhookNotification: failed to sign request: %v", err)
+		return
 	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -252,8 +259,17 @@ func buildAlertEmailContent(rule *AlertRule, alertInstance *Alert) alertEmailCon
 
 	metricLabel := string(alertInstance.Metric)
 	panelURL := buildPanelURL(alertInstance)
+	if rec := alertInstance.Recovery; rec != nil {
+		return buildRecoveryEmailContent(alertInstance, rec, metricLabel, panelURL)
+	}
 
 	subject := fmt.Sprintf("[%s] NetWatcher Alert: %s on %s", severityLabel, metricLabel, alertInstance.ProbeName)
+	switch alertInstance.NotifyReason {
+	case ReasonRenotify:
+		subject = "Still active: " + subject
+	case ReasonEscalation:
+		subject = "Escalated: " + subject
+	}
 	body := fmt.Sprintf(`NetWatcher Alert
 
 Severity: %s
@@ -282,9 +298,46 @@ NetWatcher.io - Open Source Network Monitoring`,
 	}
 }
 
+// buildRecoveryEmailContent is the email for a "recovery" notification.
+func buildRecoveryEmailContent(alertInstance *Alert, rec *Recovery, metricLabel, panelURL string) alertEmailContent {
+	duration := formatDuration(time.Duration(rec.DurationSeconds) * time.Second)
+	peak := rec.PeakSeverity
+	if peak == "" {
+		peak = string(alertInstance.Severity)
+	}
+	summary := fmt.Sprintf("Resolved after %s (peak severity: %s, peak impact: %.0f)", duration, peak, rec.PeakImpact)
+
+	subject := fmt.Sprintf("[Resolved] NetWatcher Alert: %s on %s", metricLabel, alertInstance.ProbeName)
+	body := fmt.Sprintf(`NetWatcher Alert Resolved
+
+Metric: %s
+Message: %s
+%s
+
+Opened: %s
+Resolved: %s
+
+View details: %s
+
+---
+NetWatcher.io - Open Source Network Monitoring`,
+		metricLabel, alertInstance.Message, summary,
+		rec.OpenedAt.Format(time.RFC822), rec.RecoveredAt.Format(time.RFC822), panelURL)
+
+	resolved := *alertInstance
+	resolved.Message = alertInstance.Message + " — " + summary
+	return alertEmailContent{
+		Subject:  subject,
+		Body:     body,
+		BodyHTML: buildAlertEmailHTML("Resolved", metricLabel, &resolved, panelURL),
+	}
+}
+
 func buildAlertEmailHTML(severityLabel, metricLabel string, alertInstance *Alert, panelURL string) string {
 	bgColor := "#f59e0b" // warning amber
-	if alertInstance.Severity == SeverityCritical {
+	if alertInstance.Recovery != nil {
+		bgColor = "#10b981" // resolved green
+	} else if alertInstance.Severity == SeverityCritical {
 		bgColor = "#ef4444" // critical red
 	}
 
@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// -------------------- Notification Policy --------------------
+//
+// An alert is one firing condition — a rule on one probe, one agent, or one
+// analysis incident — identified by its DedupKey. While it stays active the
+// evaluators keep seeing the condition; the workspace's notification policy
+// decides whether that re-sends notifications:
+//
+//	once        notify when the alert opens, never again while it is active
+//	renotify    also re-send every RenotifyMinutes, and on escalation
+//	escalation  also re-send when the severity rises (warning → critical)
+//
+// Workspaces without a policy use "once", the behavior before policies.
+
+type NotifyMode string
+
+const (
+	NotifyOnce       NotifyMode = "once"
+	NotifyRenotify   NotifyMode = "renotify"
+	NotifyEscalation NotifyMode = "escalation"
+)
+
+const (
+	minRenotifyMinutes = 5
+	maxRenotifyMinutes = 7 * 24 * 60
+)
+
+// NotifyReason values set on Alert.NotifyReason and in webhook payloads.
+const (
+	ReasonNew        = "new"
+	ReasonRenotify   = "renotify"
+	ReasonEscalation = "escalation"
+	ReasonRecovery   = "recovery" // see recovery.go
+	// ReasonSilenced is returned (never sent) when a silence muted the
+	// alert; see silence.go.
+	ReasonSilenced = "silenced"
+)
+
+// NotificationPolicy is a workspace's dedup/renotify setting.
+type NotificationPolicy struct {
+	WorkspaceID     uint       `gorm:"primaryKey" json:"workspace_id"`
+	Mode            NotifyMode `gorm:"type:VARCHAR(16);not null" json:"mode"`
+	RenotifyMinutes int        `json:"renotify_minutes,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	UpdatedBy       uint       `json:"updated_by,omitempty"`
+}
+
+func (NotificationPolicy) TableName() string { return "workspace_notification_policies" }
+
+// NotificationPolicyInput is the PUT body.
+type NotificationPolicyInput struct {
+	Mode            NotifyMode `json:"mode"`
+	RenotifyMinutes int        `json:"renotify_minutes"`
+}
+
+// GetNotificationPolicy returns a workspace's policy, or the "once"
+// default when none is set.
+func GetNotificationPolicy(ctx context.Context, db *gorm.DB, workspaceID uint) (NotificationPolicy, error) {
+	var p NotificationPolicy
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotificationPolicy{WorkspaceID: workspaceID, Mode: NotifyOnce}, nil
+	}
+	return p, err
+}
+
+// SetNotificationPolicy validates and saves a workspace's policy.
+func SetNotificationPolicy(ctx context.Context, db *gorm.DB, workspaceID, userID uint, in NotificationPolicyInput) (NotificationPolicy, error) {
+	p := NotificationPolicy{WorkspaceID: workspaceID, Mode: in.Mode, UpdatedAt: time.Now(), UpdatedBy: userID}
+	switch in.Mode {
+	case NotifyOnce, NotifyEscalation:
+	case NotifyRenotify:
+		if in.RenotifyMinutes < minRenotifyMinutes || in.RenotifyMinutes > maxRenotifyMinutes {
+			return p, fmt.Errorf("%w: renotify_minutes must be between %d and %d", ErrBadInput, minRenotifyMinutes, maxRenotifyMinutes)
+		}
+		p.RenotifyMinutes = in.RenotifyMinutes
+	default:
+		return p, fmt.Errorf("%w: mode must be once, renotify or escalation", ErrBadInput)
+	}
+	err := db.WithContext(ctx).Save(&p).Error
+	return p, err
+}
+
+// severityRank orders severities for escalation checks.
+func severityRank(s Severity) int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	}
+	return 0
+}
+
+// renotifyReason decides whether a still-firing active alert notifies
+// again, returning the reason or "" to stay quiet.
+func renotifyReason(p NotificationPolicy, existing *Alert, severity Severity, now time.Time) string {
+	escalated := severityRank(severity) > severityRank(existing.Severity)
+	switch p.Mode {
+	case NotifyEscalation:
+		if escalated {
+			return ReasonEscalation
+		}
+	case NotifyRenotify:
+		if escalated {
+			return ReasonEscalation
+		}
+		last := existing.TriggeredAt
+		if existing.LastNotifiedAt != nil {
+			last = *existing.LastNotifiedAt
+		}
+		if p.RenotifyMinutes > 0 && now.Sub(last) >= time.Duration(p.RenotifyMinutes)*time.Minute {
+			return ReasonRenotify
+		}
+	}
+	return ""
+}
+
+// RaiseAlert records a firing condition. With no active alert for the
+// rule and dedupKey it opens one and notifies; otherwise the workspace
+// policy decides whether to notify again. It returns the alert and the
+// notify reason ("" when suppressed). actx.Severity overrides the rule's.
+//
+// Alerts from before dedup keys have an empty key; they still match on the
+// probe or agent in actx, as the evaluators used to.
+//
+// An active silence matching the alert mutes it: a new alert is recorded
+// with reason ReasonSilenced and an active one does not renotify.
+func RaiseAlert(ctx context.Context, db *gorm.DB, rule *AlertRule, dedupKey string, value float64, message string, actx *AlertContext) (*Alert, string, error) {
+	if actx == nil {
+		actx = &AlertContext{}
+	}
+	actx.DedupKey = dedupKey
+	severity := rule.Severity
+	if actx.Severity != "" {
+		severity = actx.Severity
+	}
+	// Silence lookups fail open: a database error never mutes an alert.
+	silence, err := activeSilence(ctx, db, rule.WorkspaceID, alertLabels(rule, dedupKey, severity, actx))
+	if err != nil {
+		log.Warnf("alert.RaiseAlert: workspace %d silences: %v", rule.WorkspaceID, err)
+	}
+
+	legacy := db.Where("dedup_key = '' OR dedup_key IS NULL")
+	switch {
+	case actx.ProbeID != 0:
+		legacy = legacy.Where("probe_id = ?", actx.ProbeID)
+	case actx.AgentID != 0:
+		legacy = legacy.Where("agent_id = ?", actx.AgentID)
+	}
+	var existing Alert
+	err = db.WithContext(ctx).
+		Where("alert_rule_id = ? AND status = ?", rule.ID, StatusActive).
+		Where(db.Where("dedup_key = ?", dedupKey).Or(legacy)).
+		Order("id DESC").
+		First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		a, err := CreateAlert(ctx, db, rule, value, message, actx)
+		if err != nil {
+			return nil, "", err
+		}
+		if silence != nil {
+			// Never notified: NotifyCount 0 lets it notify once the
+			// silence ends.
+			if err := db.WithContext(ctx).Model(&Alert{}).Where("id = ?", a.ID).Updates(map[string]any{
+				"silence_id": silence.ID, "notify_count": 0, "last_notified_at": nil,
+			}).Error; err != nil {
+				return nil, "", err
+			}
+			a.SilenceID, a.NotifyCount, a.LastNotifiedAt = &silence.ID, 0, nil
+			log.Infof("Alert silenced: id=%d, rule=%d, key=%s, silence=%d", a.ID, rule.ID, dedupKey, silence.ID)
+			return a, ReasonSilenced, nil
+		}
+		a.NotifyReason = ReasonNew
+		go DispatchNotifications(ctx, db, rule, a)
+		return a, ReasonNew, nil
+	}
+
+	policy, err := GetNotificationPolicy(ctx, db, rule.WorkspaceID)
+	if err != nil {
+		log.Warnf("alert.RaiseAlert: workspace %d policy: %v", rule.WorkspaceID, err)
+	}
+	if silence != nil {
+		if existing.SilenceID == nil || *existing.SilenceID != silence.ID {
+			if err := db.WithContext(ctx).Model(&Alert{}).Where("id = ?", existing.ID).
+				Update("silence_id", silence.ID).Error; err != nil {
+				return nil, "", err
+			}
+			existing.SilenceID = &silence.ID
+		}
+		return &existing, "", nil
+	}
+	now := time.Now()
+	reason := renotifyReason(policy, &existing, severity, now)
+	if existing.NotifyCount == 0 {
+		reason = ReasonNew // opened during a silence that has ended
+	}
+	if reason == "" {
+		return &existing, "", nil
+	}
+
+	updates := map[string]any{
+		"value":            value,
+		"message":          message,
+		"last_notified_at": now,
+		"notify_count":     gorm.Expr("notify_count + 1"),
+		"silence_id":       nil,
+		"updated_at":       now,
+	}
+	if severityRank(severity) > severityRank(existing.Severity) {
+		updates["severity"] = severity
+		existing.Severity = severity
+	}
+	if err := db.WithContext(ctx).Model(&Alert{}).Where("id = ?", existing.ID).Updates(updates).Error; err != nil {
+		return nil, "", err
+	}
+	existing.Value, existing.Message, existing.LastNotifiedAt = value, message, &now
+	existing.NotifyCount++
+	existing.SilenceID = nil
+	existing.NotifyReason = reason
+	go DispatchNotifications(ctx, db, rule, &existing)
+	log.Infof("Alert re-notified (%s): id=%d, rule=%d, key=%s, count=%d", reason, existing.ID, rule.ID, dedupKey, existing.NotifyCount)
+	return &existing, reason, nil
+}
@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PMTUAlertPayload represents the PMTU probe fields needed for alert evaluation
+type PMTUAlertPayload struct {
+	PathMTU    int    `json:"path_mtu"`
+	Blackhole  bool   `json:"blackhole"`
+	FloorBytes int    `json:"floor_bytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// GetPMTUMetricValue extracts a specific metric value from a PMTU payload
+func GetPMTUMetricValue(payload *PMTUAlertPayload, metric Metric) *float64 {
+	var v float64
+	switch metric {
+	case MetricPathMTU:
+		if payload.Error != "" {
+			return nil // a failed run says nothing about the path
+		}
+		v = float64(payload.PathMTU)
+	case MetricPMTUBlackhole:
+		if payload.Blackhole {
+			v = 1
+		}
+	default:
+		return nil
+	}
+	return &v
+}
+
+// evaluatePmtuRule evaluates PMTU-specific alert rules
+func evaluatePmtuRule(rule *AlertRule, pctx ProbeContext, payloadJSON []byte) *EvaluationResult {
+	if rule.Metric != MetricPathMTU && rule.Metric != MetricPMTUBlackhole {
+		return nil
+	}
+
+	var payload PMTUAlertPayload
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		log.Warnf("alert.evaluatePmtuRule: failed to parse PMTU payload: %v", err)
+		return nil
+	}
+
+	value := GetPMTUMetricValue(&payload, rule.Metric)
+	if value == nil {
+		return nil
+	}
+
+	if !ShouldTrigger(rule.Operator, *value, rule.Threshold) {
+		return &EvaluationResult{Triggered: false}
+	}
+
+	msg := fmt.Sprintf("Path MTU to %s is %d bytes (threshold: %.0f)", pctx.ProbeTarget, payload.PathMTU, rule.Threshold)
+	if rule.Metric == MetricPMTUBlackhole {
+		msg = fmt.Sprintf("MTU blackhole to %s: packets above %d bytes dropped without ICMP fragmentation-needed", pctx.ProbeTarget, payload.PathMTU)
+	}
+	return &EvaluationResult{
+		Triggered: true,
+		Value:     *value,
+		Metric:    string(rule.Metric),
+		Message:   msg,
+	}
+}
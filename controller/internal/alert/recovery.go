@@ -0,0 +1,100 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// -------------------- Recovery --------------------
+//
+// Analysis incidents resolve on their own once their conditions have
+// stayed clear for the stabilization period (see
+// probe.RecordIncidentHistory). RecoverAlerts then closes the alerts that
+// were raised for the incident and sends each one's rule a "recovery"
+// notification with the incident's total duration and peak impact.
+
+// Recovery summarizes a condition that has cleared.
+type Recovery struct {
+	OpenedAt        time.Time `json:"opened_at"`
+	RecoveredAt     time.Time `json:"recovered_at"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	PeakSeverity    string    `json:"peak_severity,omitempty"`
+	PeakImpact      float64   `json:"peak_impact"`
+}
+
+// RecoverAlerts resolves the workspace's active and acknowledged alerts
+// with dedupKey and notifies their enabled rules of the recovery. It
+// returns the number of alerts resolved.
+func RecoverAlerts(ctx context.Context, db *gorm.DB, workspaceID uint, dedupKey string, rec Recovery) (int, error) {
+	var open []Alert
+	if err := db.WithContext(ctx).
+		Where("workspace_id = ? AND dedup_key = ? AND status IN ?", workspaceID, dedupKey, []Status{StatusActive, StatusAcknowledged}).
+		Find(&open).Error; err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for i := range open {
+		a := &open[i]
+		res := db.WithContext(ctx).Model(&Alert{}).
+			Where("id = ? AND status <> ?", a.ID, StatusResolved).
+			Updates(map[string]any{
+				"status":      StatusResolved,
+				"resolved_at": rec.RecoveredAt,
+				"updated_at":  time.Now(),
+			})
+		if res.Error != nil {
+			return resolved, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // resolved meanwhile, e.g. by a user
+		}
+		resolved++
+
+		rule, err := GetRuleByID(ctx, db, a.AlertRuleID)
+		if err != nil {
+			log.Warnf("alert.RecoverAlerts: rule %d for alert %d: %v", a.AlertRuleID, a.ID, err)
+			continue
+		}
+		if !rule.Enabled {
+			continue
+		}
+		// Alerts that never notified, or are muted now, recover quietly.
+		if a.NotifyCount == 0 {
+			continue
+		}
+		actx := &AlertContext{AgentID: derefUint(a.AgentID), AgentName: a.AgentName, ProbeTarget: a.ProbeTarget, ProbeType: a.ProbeType}
+		if s, err := activeSilence(ctx, db, workspaceID, alertLabels(rule, dedupKey, a.Severity, actx)); err == nil && s != nil {
+			continue
+		}
+		r := rec
+		a.Status, a.ResolvedAt = StatusResolved, &r.RecoveredAt
+		a.NotifyReason = ReasonRecovery
+		a.Recovery = &r
+		go DispatchNotifications(ctx, db, rule, a)
+		log.Infof("Alert recovered: id=%d, rule=%d, key=%s, duration=%ds", a.ID, rule.ID, dedupKey, r.DurationSeconds)
+	}
+	return resolved, nil
+}
+
+func derefUint(p *uint) uint {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// formatDuration renders a recovery duration as "45s", "12m" or "2h5m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return d.Round(time.Second).String()
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,297 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// -------------------- Silences --------------------
+//
+// A silence mutes notifications for the alerts its matchers select, from
+// StartsAt to EndsAt, as in Alertmanager. Silenced alerts are still
+// recorded and resolve as usual; they carry the SilenceID and send
+// nothing. An alert that opened silenced and is still firing when the
+// silence ends notifies then, on its next evaluation. Expiring a silence
+// early sets EndsAt to now.
+//
+// Every matcher must match. Labels an alert has:
+//
+//	agent          agent name
+//	agent_id       agent ID
+//	target         probe target
+//	severity       warning | critical
+//	incident_type  the rule metric (packet_loss, offline, latency_baseline, …)
+//	incident       analysis incident ID (latency_regression_…, agent_offline_7, …)
+//	probe_type     PING, MTR, …
+//	rule           alert rule name
+//
+// Operators: = and != compare exactly; =~ and !~ match a regular
+// expression against the whole value. A label the alert lacks is "".
+
+// MatchOp is a silence matcher operator.
+type MatchOp string
+
+const (
+	MatchEqual    MatchOp = "="
+	MatchNotEqual MatchOp = "!="
+	MatchRegex    MatchOp = "=~"
+	MatchNotRegex MatchOp = "!~"
+)
+
+// SilenceLabels are the label names matchers may use.
+var SilenceLabels = []string{"agent", "agent_id", "target", "severity", "incident_type", "incident", "probe_type", "rule"}
+
+const (
+	maxSilenceMatchers = 16
+	maxSilenceDuration = 90 * 24 * time.Hour
+)
+
+// Silence states, derived from the time window.
+const (
+	SilencePending = "pending"
+	SilenceActive  = "active"
+	SilenceExpired = "expired"
+)
+
+// Matcher selects alerts by one label.
+type Matcher struct {
+	Name  string  `json:"name"`
+	Op    MatchOp `json:"op"`
+	Value string  `json:"value"`
+}
+
+// Silence mutes matching alerts in a workspace for a time window.
+type Silence struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	WorkspaceID uint      `gorm:"index;not null" json:"workspace_id"`
+
+	Matchers datatypes.JSONSlice[Matcher] `json:"matchers"`
+	StartsAt time.Time                    `gorm:"index;not null" json:"starts_at"`
+	EndsAt   time.Time                    `gorm:"index;not null" json:"ends_at"`
+
+	CreatedBy uint   `json:"created_by"`
+	Comment   string `gorm:"size:1024" json:"comment"`
+	// ExpiredBy is set when a user ended the silence early.
+	ExpiredBy *uint `json:"expired_by,omitempty"`
+
+	State string `gorm:"-" json:"state"`
+}
+
+func (Silence) TableName() string { return "alert_silences" }
+
+// AfterFind fills State.
+func (s *Silence) AfterFind(*gorm.DB) error {
+	s.State = s.stateAt(time.Now())
+	return nil
+}
+
+func (s *Silence) stateAt(now time.Time) string {
+	switch {
+	case now.Before(s.StartsAt):
+		return SilencePending
+	case now.Before(s.EndsAt):
+		return SilenceActive
+	}
+	return SilenceExpired
+}
+
+// SilenceInput is the POST body. EndsAt or DurationMinutes is required;
+// StartsAt defaults to now.
+type SilenceInput struct {
+	Matchers        []Matcher  `json:"matchers"`
+	StartsAt        *time.Time `json:"starts_at,omitempty"`
+	EndsAt          *time.Time `json:"ends_at,omitempty"`
+	DurationMinutes int        `json:"duration_minutes,omitempty"`
+	Comment         string     `json:"comment"`
+}
+
+// CreateSilence validates and stores a silence.
+func CreateSilence(ctx context.Context, db *gorm.DB, workspaceID, userID uint, in SilenceInput) (*Silence, error) {
+	now := time.Now()
+	s := &Silence{WorkspaceID: workspaceID, CreatedBy: userID, StartsAt: now, Comment: strings.TrimSpace(in.Comment)}
+	if in.StartsAt != nil {
+		s.StartsAt = *in.StartsAt
+	}
+	switch {
+	case in.EndsAt != nil:
+		s.EndsAt = *in.EndsAt
+	case in.DurationMinutes > 0:
+		s.EndsAt = s.StartsAt.Add(time.Duration(in.DurationMinutes) * time.Minute)
+	default:
+		return nil, fmt.Errorf("%w: ends_at or duration_minutes required", ErrBadInput)
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return nil, fmt.Errorf("%w: ends_at must be after starts_at and in the future", ErrBadInput)
+	}
+	if s.EndsAt.Sub(s.StartsAt) > maxSilenceDuration {
+		return nil, fmt.Errorf("%w: a silence can last at most %d days", ErrBadInput, int(maxSilenceDuration.Hours()/24))
+	}
+	if s.Comment == "" {
+		return nil, fmt.Errorf("%w: comment required", ErrBadInput)
+	}
+	if len(s.Comment) > 1024 {
+		return nil, fmt.Errorf("%w: comment too long", ErrBadInput)
+	}
+	if err := validateMatchers(in.Matchers); err != nil {
+		return nil, err
+	}
+	s.Matchers = in.Matchers
+
+	if err := db.WithContext(ctx).Create(s).Error; err != nil {
+		return nil, err
+	}
+	s.State = s.stateAt(now)
+	return s, nil
+}
+
+func validateMatchers(ms []Matcher) error {
+	if len(ms) == 0 {
+		return fmt.Errorf("%w: at least one matcher required", ErrBadInput)
+	}
+	if len(ms) > maxSilenceMatchers {
+		return fmt.Errorf("%w: at most %d matchers", ErrBadInput, maxSilenceMatchers)
+	}
+	for _, m := range ms {
+		known := false
+		for _, l := range SilenceLabels {
+			known = known || l == m.Name
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown matcher label %q (want one of %s)", ErrBadInput, m.Name, strings.Join(SilenceLabels, ", "))
+		}
+		switch m.Op {
+		case MatchEqual, MatchNotEqual:
+		case MatchRegex, MatchNotRegex:
+			if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				return fmt.Errorf("%w: matcher %s: %v", ErrBadInput, m.Name, err)
+			}
+		default:
+			return fmt.Errorf("%w: matcher %s: op must be =, !=, =~ or !~", ErrBadInput, m.Name)
+		}
+	}
+	return nil
+}
+
+// ListSilences returns a workspace's silences, newest first. states
+// filters by SilencePending / SilenceActive / SilenceExpired; none means
+// all.
+func ListSilences(ctx context.Context, db *gorm.DB, workspaceID uint, states ...string) ([]Silence, error) {
+	q := db.WithContext(ctx).Where("workspace_id = ?", workspaceID)
+	if len(states) > 0 {
+		now := time.Now()
+		or := db.Where("1 = 0")
+		for _, st := range states {
+			switch st {
+			case SilencePending:
+				or = or.Or("starts_at > ?", now)
+			case SilenceActive:
+				or = or.Or("starts_at <= ? AND ends_at > ?", now, now)
+			case SilenceExpired:
+				or = or.Or("ends_at <= ?", now)
+			}
+		}
+		q = q.Where(or)
+	}
+	var out []Silence
+	err := q.Order("id DESC").Find(&out).Error
+	return out, err
+}
+
+// GetSilence returns one of a workspace's silences.
+func GetSilence(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*Silence, error) {
+	var s Silence
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).First(&s, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return &s, err
+}
+
+// ExpireSilence ends a silence now. Expiring an expired silence is a
+// no-op; a pending one ends before it starts.
+func ExpireSilence(ctx context.Context, db *gorm.DB, workspaceID, id, userID uint) (*Silence, error) {
+	s, err := GetSilence(ctx, db, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if s.stateAt(now) == SilenceExpired {
+		return s, nil
+	}
+	updates := map[string]any{"ends_at": now, "expired_by": userID, "updated_at": now}
+	if s.StartsAt.After(now) {
+		updates["starts_at"] = now
+	}
+	if err := db.WithContext(ctx).Model(&Silence{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return GetSilence(ctx, db, workspaceID, id)
+}
+
+// alertLabels are the values silences match an alert against.
+func alertLabels(rule *AlertRule, dedupKey string, severity Severity, actx *AlertContext) map[string]string {
+	l := map[string]string{
+		"agent":         actx.AgentName,
+		"target":        actx.ProbeTarget,
+		"severity":      string(severity),
+		"incident_type": string(rule.Metric),
+		"probe_type":    actx.ProbeType,
+		"rule":          rule.Name,
+	}
+	if actx.AgentID != 0 {
+		l["agent_id"] = strconv.FormatUint(uint64(actx.AgentID), 10)
+	}
+	if id, ok := strings.CutPrefix(dedupKey, "incident:"); ok {
+		l["incident"] = id
+	}
+	return l
+}
+
+// Matches reports whether every matcher matches labels.
+func (s *Silence) Matches(labels map[string]string) bool {
+	for _, m := range s.Matchers {
+		v := labels[m.Name]
+		var ok bool
+		switch m.Op {
+		case MatchEqual:
+			ok = v == m.Value
+		case MatchNotEqual:
+			ok = v != m.Value
+		case MatchRegex, MatchNotRegex:
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return false
+			}
+			ok = re.MatchString(v) == (m.Op == MatchRegex)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return len(s.Matchers) > 0
+}
+
+// activeSilence returns the first silence active now in the workspace that
+// matches labels, or nil.
+func activeSilence(ctx context.Context, db *gorm.DB, workspaceID uint, labels map[string]string) (*Silence, error) {
+	active, err := ListSilences(ctx, db, workspaceID, SilenceActive)
+	if err != nil {
+		return nil, err
+	}
+	for i := range active {
+		if active[i].Matches(labels) {
+			return &active[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,109 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	s := Silence{Matchers: []Matcher{
+		{Name: "agent", Op: MatchRegex, Value: "branch-.*"},
+		{Name: "severity", Op: MatchNotEqual, Value: "critical"},
+	}}
+	cases := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"agent": "branch-12", "severity": "warning"}, true},
+		{map[string]string{"agent": "branch-12", "severity": "critical"}, false},
+		{map[string]string{"agent": "hq-branch-1", "severity": "warning"}, false}, // regex is anchored
+		{map[string]string{"severity": "warning"}, false},
+	}
+	for _, c := range cases {
+		if got := s.Matches(c.labels); got != c.want {
+			t.Errorf("Matches(%v) = %v, want %v", c.labels, got, c.want)
+		}
+	}
+	if (&Silence{}).Matches(map[string]string{}) {
+		t.Error("a silence without matchers must match nothing")
+	}
+}
+
+func TestCreateSilenceValidation(t *testing.T) {
+	db := newSilenceTestDB(t)
+	ctx := context.Background()
+	ok := []Matcher{{Name: "target", Op: MatchEqual, Value: "8.8.8.8"}}
+	past := time.Now().Add(-time.Hour)
+	for name, in := range map[string]SilenceInput{
+		"no end":        {Matchers: ok, Comment: "x"},
+		"no comment":    {Matchers: ok, DurationMinutes: 60},
+		"no matchers":   {DurationMinutes: 60, Comment: "x"},
+		"unknown label": {Matchers: []Matcher{{Name: "colour", Op: MatchEqual, Value: "red"}}, DurationMinutes: 60, Comment: "x"},
+		"bad regex":     {Matchers: []Matcher{{Name: "agent", Op: MatchRegex, Value: "("}}, DurationMinutes: 60, Comment: "x"},
+		"ended":         {Matchers: ok, EndsAt: &past, Comment: "x"},
+	} {
+		if _, err := CreateSilence(ctx, db, 1, 1, in); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", name, err)
+		}
+	}
+}
+
+func TestRaiseAlertSilenced(t *testing.T) {
+	db := newSilenceTestDB(t)
+	ctx := context.Background()
+	rule := &AlertRule{WorkspaceID: 1, Name: "loss", Metric: MetricPacketLoss, Operator: OperatorGT, Severity: SeverityWarning, Enabled: true}
+	if err := db.Create(rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	s, err := CreateSilence(ctx, db, 1, 9, SilenceInput{
+		Matchers:        []Matcher{{Name: "target", Op: MatchRegex, Value: `10\.0\..*`}},
+		DurationMinutes: 30,
+		Comment:         "carrier maintenance",
+	})
+	if err != nil || s.State != SilenceActive {
+		t.Fatalf("create = %+v, %v", s, err)
+	}
+
+	actx := &AlertContext{ProbeID: 5, ProbeTarget: "10.0.0.1"}
+	a, reason, err := RaiseAlert(ctx, db, rule, "probe:5", 40, "loss", actx)
+	if err != nil || reason != ReasonSilenced || a.SilenceID == nil || *a.SilenceID != s.ID || a.NotifyCount != 0 {
+		t.Fatalf("silenced raise = %+v, %q, %v", a, reason, err)
+	}
+
+	// Still firing after the silence is expired: it notifies as new.
+	if _, err := ExpireSilence(ctx, db, 1, s.ID, 9); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := ListSilences(ctx, db, 1, SilenceActive); len(active) != 0 {
+		t.Fatalf("expired silence still active: %+v", active)
+	}
+	a, reason, err = RaiseAlert(ctx, db, rule, "probe:5", 40, "loss", actx)
+	if err != nil || reason != ReasonNew || a.SilenceID != nil || a.NotifyCount != 1 {
+		t.Fatalf("raise after expiry = %+v, %q, %v", a, reason, err)
+	}
+	var n int64
+	db.Model(&Alert{}).Count(&n)
+	if n != 1 {
+		t.Errorf("alerts = %d, want the silenced alert reused", n)
+	}
+}
+
+func newSilenceTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
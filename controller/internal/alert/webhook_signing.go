@@ -0,0 +1,194 @@
+package alert
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// -------------------- Webhook Signing --------------------
+//
+// Every alert rule with a webhook has its own secret. Deliveries carry a
+// timestamp and a unique delivery ID, and the signature covers both plus
+// the raw body, so a captured request cannot be replayed outside the
+// window or with a different ID. The legacy body-only signature header is
+// still sent for receivers written against it.
+
+const (
+	// HeaderWebhookSignature is the legacy "sha256=<hex>" HMAC of the body.
+	HeaderWebhookSignature = "X-NetWatcher-Signature"
+	// HeaderWebhookSignatureV1 is "t=<unix>,v1=<hex>" over "<t>.<delivery>.<body>".
+	HeaderWebhookSignatureV1 = "X-NetWatcher-Signature-V1"
+	HeaderWebhookTimestamp   = "X-NetWatcher-Timestamp"
+	HeaderWebhookDelivery    = "X-NetWatcher-Delivery"
+
+	// WebhookReplayWindow is how far a delivery timestamp may be from the
+	// receiver's clock before it should be rejected.
+	WebhookReplayWindow = 5 * time.Minute
+
+	webhookSecretPrefix = "whsec_"
+)
+
+var (
+	ErrWebhookSignatureMalformed = errors.New("malformed webhook signature")
+	ErrWebhookSignatureMismatch  = errors.New("webhook signature mismatch")
+	ErrWebhookSignatureExpired   = errors.New("webhook timestamp outside replay window")
+)
+
+// GenerateWebhookSecret returns a new random per-rule signing secret.
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<unix>.<deliveryID>.<body>".
+func SignWebhook(secret string, ts time.Time, deliveryID string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s.", ts.Unix(), deliveryID)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a X-NetWatcher-Signature-V1 header value
+// against the body and delivery ID, rejecting timestamps more than window
+// away from now. Receivers should also drop delivery IDs already seen
+// within the window.
+func VerifyWebhookSignature(secret, header, deliveryID string, body []byte, now time.Time, window time.Duration) error {
+	var ts int64
+	var sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return ErrWebhookSignatureMalformed
+			}
+			ts = n
+		case "v1":
+			sig = v
+		}
+	}
+	if ts == 0 || sig == "" {
+		return ErrWebhookSignatureMalformed
+	}
+	sent := time.Unix(ts, 0)
+	if d := now.Sub(sent); d > window || d < -window {
+		return ErrWebhookSignatureExpired
+	}
+	want := SignWebhook(secret, sent, deliveryID, body)
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return ErrWebhookSignatureMismatch
+	}
+	return nil
+}
+
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: webhook_url must be an http(s) URL", ErrBadInput)
+	}
+	return nil
+}
+
+// SignWebhookRequest sets the delivery and signature headers on an
+// outgoing webhook. Only the delivery headers are set without a secret.
+func SignWebhookRequest(req *http.Request, secret string, body []byte, now time.Time) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	deliveryID := hex.EncodeToString(id)
+	req.Header.Set(HeaderWebhookTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderWebhookDelivery, deliveryID)
+	if secret == "" {
+		return nil
+	}
+
+	legacy := hmac.New(sha256.New, []byte(secret))
+	legacy.Write(body)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+hex.EncodeToString(legacy.Sum(nil)))
+	req.Header.Set(HeaderWebhookSignatureV1,
+		fmt.Sprintf("t=%d,v1=%s", now.Unix(), SignWebhook(secret, now, deliveryID, body)))
+	return nil
+}
+
+// WebhookDeliveryInfo describes how a rule's webhook deliveries are signed
+// so receivers can implement verification.
+type WebhookDeliveryInfo struct {
+	RuleID              uint              `json:"rule_id"`
+	Enabled             bool              `json:"enabled"`
+	URL                 string            `json:"url,omitempty"`
+	Secret              string            `json:"secret,omitempty"`
+	Algorithm           string            `json:"algorithm"`
+	Headers             map[string]string `json:"headers"`
+	SignedPayload       string            `json:"signed_payload"`
+	ReplayWindowSeconds int               `json:"replay_window_seconds"`
+	VerificationSteps   []string          `json:"verification_steps"`
+}
+
+// WebhookDelivery returns the signing metadata for a rule, including its
+// secret.
+func WebhookDelivery(rule *AlertRule) WebhookDeliveryInfo {
+	return WebhookDeliveryInfo{
+		RuleID:    rule.ID,
+		Enabled:   rule.NotifyWebhook && rule.WebhookURL != "",
+		URL:       rule.WebhookURL,
+		Secret:    rule.WebhookSecret,
+		Algorithm: "HMAC-SHA256",
+		Headers: map[string]string{
+			HeaderWebhookTimestamp:   "Unix seconds when the delivery was signed",
+			HeaderWebhookDelivery:    "Unique delivery ID (hex); reject IDs already seen",
+			HeaderWebhookSignatureV1: "t=<timestamp>,v1=<hex signature>",
+			HeaderWebhookSignature:   "sha256=<hex HMAC of the body> (legacy, no replay protection)",
+		},
+		SignedPayload:       "<timestamp>.<delivery id>.<raw request body>",
+		ReplayWindowSeconds: int(WebhookReplayWindow / time.Second),
+		VerificationSteps: []string{
+			"Read the raw request body before parsing it",
+			fmt.Sprintf("Parse t and v1 from the %s header", HeaderWebhookSignatureV1),
+			fmt.Sprintf("Reject the request if t is more than %d seconds from your clock", int(WebhookReplayWindow/time.Second)),
+			fmt.Sprintf("Compute hex(HMAC-SHA256(secret, t + \".\" + %s + \".\" + body))", HeaderWebhookDelivery),
+			"Compare it to v1 with a constant-time comparison",
+			fmt.Sprintf("Reject %s values already seen within the window", HeaderWebhookDelivery),
+		},
+	}
+}
+
+// RotateWebhookSecret replaces a rule's signing secret and returns the new
+// one. Deliveries signed with the old secret stop verifying immediately.
+func RotateWebhookSecret(ctx context.Context, db *gorm.DB, ruleID uint) (string, error) {
+	secret, err := GenerateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+	res := db.WithContext(ctx).Model(&AlertRule{}).Where("id = ?", ruleID).
+		Updates(map[string]any{"webhook_secret": secret, "updated_at": time.Now()})
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
@@ -0,0 +1,95 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSignWebhookKnownAnswer pins the signed payload format so receivers
+// built from the docs keep verifying.
+func TestSignWebhookKnownAnswer(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	body := []byte(`{"alert":1}`)
+	const want = "397c8f97b2b1a3b76645c446f50abcf6de37ffdb92b37f571cfec083a9cc0f7a"
+	if got := SignWebhook("whsec_test", ts, "abc123", body); got != want {
+		t.Fatalf("SignWebhook = %s, want %s", got, want)
+	}
+	header := "t=1700000000,v1=" + want
+	if err := VerifyWebhookSignature("whsec_test", header, "abc123", body, ts.Add(time.Minute), WebhookReplayWindow); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+// TestVerifyWebhookSignature verifies tampering, a replayed delivery ID,
+// stale or future timestamps and malformed headers are all rejected.
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"alert":1}`)
+	header := fmt.Sprintf("t=%d,v1=%s", now.Unix(), SignWebhook("whsec_test", now, "abc123", body))
+
+	cases := []struct {
+		name     string
+		secret   string
+		header   string
+		delivery string
+		body     string
+		at       time.Time
+		want     error
+	}{
+		{"valid", "whsec_test", header, "abc123", `{"alert":1}`, now, nil},
+		{"wrong secret", "whsec_other", header, "abc123", `{"alert":1}`, now, ErrWebhookSignatureMismatch},
+		{"tampered body", "whsec_test", header, "abc123", `{"alert":2}`, now, ErrWebhookSignatureMismatch},
+		{"other delivery id", "whsec_test", header, "def456", `{"alert":1}`, now, ErrWebhookSignatureMismatch},
+		{"replayed late", "whsec_test", header, "abc123", `{"alert":1}`, now.Add(WebhookReplayWindow + time.Second), ErrWebhookSignatureExpired},
+		{"from the future", "whsec_test", header, "abc123", `{"alert":1}`, now.Add(-WebhookReplayWindow - time.Second), ErrWebhookSignatureExpired},
+		{"missing v1", "whsec_test", "t=1700000000", "abc123", `{"alert":1}`, now, ErrWebhookSignatureMalformed},
+		{"bad timestamp", "whsec_test", "t=soon,v1=00", "abc123", `{"alert":1}`, now, ErrWebhookSignatureMalformed},
+	}
+	for _, tc := range cases {
+		err := VerifyWebhookSignature(tc.secret, tc.header, tc.delivery, []byte(tc.body), tc.at, WebhookReplayWindow)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+// TestSignWebhookRequest verifies outgoing deliveries carry a timestamp, a
+// fresh delivery ID and signatures a receiver can check.
+func TestSignWebhookRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"alert":1}`)
+	req := httptest.NewRequest("POST", "https://hooks.example/alert", nil)
+	if err := SignWebhookRequest(req, "whsec_test", body, now); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if got := req.Header.Get(HeaderWebhookTimestamp); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("timestamp = %q", got)
+	}
+	delivery := req.Header.Get(HeaderWebhookDelivery)
+	if len(delivery) != 32 {
+		t.Errorf("delivery ID = %q, want 32 hex chars", delivery)
+	}
+	if err := VerifyWebhookSignature("whsec_test", req.Header.Get(HeaderWebhookSignatureV1), delivery, body, now, WebhookReplayWindow); err != nil {
+		t.Errorf("v1 signature: %v", err)
+	}
+	const legacy = "sha256=5364b11e723e88bd6096e29f56536fc4693b504ded8ebc8522cdcc01f1018780"
+	if got := req.Header.Get(HeaderWebhookSignature); got != legacy {
+		t.Errorf("legacy signature = %q, want %q", got, legacy)
+	}
+
+	again := httptest.NewRequest("POST", "https://hooks.example/alert", nil)
+	_ = SignWebhookRequest(again, "whsec_test", body, now)
+	if again.Header.Get(HeaderWebhookDelivery) == delivery {
+		t.Error("delivery IDs must be unique per request")
+	}
+
+	unsigned := httptest.NewRequest("POST", "https://hooks.example/alert", nil)
+	_ = SignWebhookRequest(unsigned, "", body, now)
+	if unsigned.Header.Get(HeaderWebhookSignatureV1) != "" || unsigned.Header.Get(HeaderWebhookDelivery) == "" {
+		t.Error("without a secret only the delivery headers should be set")
+	}
+}
@@ -0,0 +1,93 @@
+// Package audit records configuration changes made through the workspace
+// API. Each successful POST/PATCH/PUT/DELETE under /workspaces/:id writes
+// one Entry naming the user, the route and the resource it touched, so
+// "who changed what, when" can be answered without digging through access
+// logs. Entries are append-only; request bodies are not stored, since they
+// can carry credentials (webhook secrets, ticketing tokens).
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrBadInput = errors.New("bad input")
+
+// Actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Entry is one recorded configuration change.
+type Entry struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `gorm:"index:idx_workspace_audit_ws_created,priority:2" json:"created_at"`
+	WorkspaceID uint      `gorm:"not null;index:idx_workspace_audit_ws_created,priority:1" json:"workspace_id"`
+	UserID      uint      `gorm:"index" json:"user_id,omitempty"`
+
+	Action    string         `gorm:"size:32;not null" json:"action"`     // create, update, delete or an operation ("rotate-psk")
+	Resource  string         `gorm:"size:64;not null" json:"resource"`   // e.g. "probe", "alert-rule"
+	TargetID  uint           `json:"target_id,omitempty"`                // ID from the path, when the route has one
+	AgentID   *uint          `gorm:"index" json:"agent_id,omitempty"`    // for agent-scoped routes
+	Method    string         `gorm:"size:8;not null" json:"method"`      // HTTP method
+	Route     string         `gorm:"size:255;not null" json:"route"`     // route pattern, e.g. /workspaces/:id/agents/:agentID
+	Params    datatypes.JSON `gorm:"type:jsonb" json:"params,omitempty"` // path parameters
+	Status    int            `json:"status"`
+	RequestID string         `gorm:"size:64" json:"request_id,omitempty"`
+}
+
+func (Entry) TableName() string { return "workspace_audit_log" }
+
+// Summary renders the entry as a short sentence ("updated probe 12").
+func (e Entry) Summary() string {
+	verb := map[string]string{ActionCreate: "created", ActionUpdate: "updated", ActionDelete: "deleted"}[e.Action]
+	if verb == "" {
+		verb = strings.ReplaceAll(e.Action, "-", " ")
+	}
+	s := verb + " " + strings.ReplaceAll(e.Resource, "-", " ")
+	if e.TargetID != 0 {
+		s += fmt.Sprintf(" %d", e.TargetID)
+	}
+	return s
+}
+
+// Record stores e. CreatedAt defaults to now.
+func Record(ctx context.Context, db *gorm.DB, e *Entry) error {
+	if e.WorkspaceID == 0 || e.Action == "" || e.Resource == "" {
+		return fmt.Errorf("%w: workspace, action and resource required", ErrBadInput)
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	return db.WithContext(ctx).Create(e).Error
+}
+
+// ListOptions filters List.
+type ListOptions struct {
+	From, To time.Time // required; To is exclusive
+	AgentID  uint      // 0 = all
+	Limit    int       // 0 = 500
+}
+
+// List returns a workspace's entries in the window, newest first.
+func List(ctx context.Context, db *gorm.DB, workspaceID uint, opts ListOptions) ([]Entry, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = 500
+	}
+	q := db.WithContext(ctx).
+		Where("workspace_id = ? AND created_at >= ? AND created_at < ?", workspaceID, opts.From, opts.To)
+	if opts.AgentID != 0 {
+		q = q.Where("agent_id = ?", opts.AgentID)
+	}
+	var out []Entry
+	err := q.Order("created_at DESC, id DESC").Limit(opts.Limit).Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,278 @@
+// Package bootstrap configures a fresh deployment from the environment and
+// an optional YAML file, so automated installs come up with an admin, a
+// workspace and enrolled-ready agents without any panel steps.
+//
+// Every step is idempotent: the admin is only created on an empty users
+// table (see admin.BootstrapDefaultAdmin), and the workspace and agents are
+// matched by name and left alone when they already exist. Re-running with
+// the same file on every start is therefore safe.
+//
+// The file is expanded with os.ExpandEnv before parsing so secrets such as
+// the admin password and agent PINs can stay in the environment:
+//
+//	admin:
+//	  email: ops@example.com
+//	  password: ${NW_ADMIN_PASSWORD}
+//	workspace:
+//	  name: Production
+//	  description: Edge monitoring
+//	agents:
+//	  - name: edge-fra-1
+//	    location: Frankfurt
+//	    pin: ${NW_EDGE_FRA_1_PIN}
+//	  - name: edge-nyc-1
+//	    default_probes: false
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/admin"
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/limits"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/users"
+	"netwatcher-controller/internal/workspace"
+)
+
+// Spec is the bootstrap document. BOOTSTRAP_WORKSPACE and
+// BOOTSTRAP_WORKSPACE_DESCRIPTION fill in the workspace when no file is
+// given or the file leaves it out.
+type Spec struct {
+	Admin     AdminSpec     `yaml:"admin,omitempty"`
+	Workspace WorkspaceSpec `yaml:"workspace,omitempty"`
+	Agents    []AgentSpec   `yaml:"agents,omitempty"`
+
+	// PINFile (BOOTSTRAP_PIN_FILE) receives generated agent PINs; when
+	// empty they are printed to stdout. They never go to the log.
+	PINFile string `yaml:"-"`
+}
+
+// AdminSpec overrides DEFAULT_ADMIN_EMAIL / DEFAULT_ADMIN_PASSWORD.
+type AdminSpec struct {
+	Email    string `yaml:"email,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// WorkspaceSpec names the workspace to find or create.
+type WorkspaceSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// AgentSpec is one agent to create in the workspace. PIN is optional;
+// one is generated (and reported once, see Spec.PINFile) when empty.
+type AgentSpec struct {
+	Name          string            `yaml:"name"`
+	Description   string            `yaml:"description,omitempty"`
+	Location      string            `yaml:"location,omitempty"`
+	PIN           string            `yaml:"pin,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	DefaultProbes *bool             `yaml:"default_probes,omitempty"` // default true
+}
+
+// LoadSpec reads BOOTSTRAP_FILE (if set) and applies the BOOTSTRAP_WORKSPACE
+// fallbacks. An empty Spec means there is nothing to bootstrap.
+func LoadSpec() (Spec, error) {
+	var spec Spec
+	if path := strings.TrimSpace(os.Getenv("BOOTSTRAP_FILE")); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return spec, fmt.Errorf("read %s: %w", path, err)
+		}
+		if spec, err = ParseSpec(raw); err != nil {
+			return spec, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if spec.Workspace.Name == "" {
+		spec.Workspace.Name = strings.TrimSpace(os.Getenv("BOOTSTRAP_WORKSPACE"))
+	}
+	if spec.Workspace.Description == "" {
+		spec.Workspace.Description = strings.TrimSpace(os.Getenv("BOOTSTRAP_WORKSPACE_DESCRIPTION"))
+	}
+	spec.PINFile = strings.TrimSpace(os.Getenv("BOOTSTRAP_PIN_FILE"))
+	return spec, nil
+}
+
+// ParseSpec expands environment references in raw and decodes it. Agent
+// names must be unique and agents need a workspace to go into.
+func ParseSpec(raw []byte) (Spec, error) {
+	var spec Spec
+	dec := yaml.NewDecoder(strings.NewReader(os.ExpandEnv(string(raw))))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
+		return spec, err
+	}
+	spec.Workspace.Name = strings.TrimSpace(spec.Workspace.Name)
+	seen := map[string]bool{}
+	for i, a := range spec.Agents {
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			return spec, fmt.Errorf("agents[%d]: name is required", i)
+		}
+		if seen[strings.ToLower(name)] {
+			return spec, fmt.Errorf("agents[%d]: duplicate name %q", i, name)
+		}
+		seen[strings.ToLower(name)] = true
+		spec.Agents[i].Name = name
+	}
+	return spec, nil
+}
+
+// ApplyAdmin copies the file's admin credentials over the env defaults.
+func (s Spec) ApplyAdmin(cfg *admin.Config) {
+	if s.Admin.Email != "" {
+		cfg.DefaultAdminEmail = s.Admin.Email
+	}
+	if s.Admin.Password != "" {
+		cfg.DefaultAdminPassword = s.Admin.Password
+	}
+}
+
+// Result reports what Run created; existing objects are not listed.
+type Result struct {
+	WorkspaceID      uint
+	WorkspaceCreated bool
+	AgentsCreated    []string
+}
+
+// Run finds or creates the workspace, owned by ownerEmail (normally the
+// bootstrapped admin), and creates any missing agents in it.
+func Run(ctx context.Context, db *gorm.DB, spec Spec, ownerEmail string) (*Result, error) {
+	if spec.Workspace.Name == "" {
+		if len(spec.Agents) > 0 {
+			return nil, errors.New("agents listed without a workspace name")
+		}
+		return &Result{}, nil
+	}
+	res := &Result{}
+
+	store := workspace.NewStore(db)
+	ws, err := store.GetWorkspaceByName(ctx, spec.Workspace.Name)
+	switch {
+	case err == nil:
+	case errors.Is(err, workspace.ErrNotFound):
+		owner, err := users.GetByEmail(ctx, db, strings.ToLower(strings.TrimSpace(ownerEmail)))
+		if err != nil {
+			return nil, fmt.Errorf("workspace owner %q: %w", ownerEmail, err)
+		}
+		ws, err = store.CreateWorkspace(ctx, workspace.CreateWorkspaceInput{
+			Name:        spec.Workspace.Name,
+			OwnerID:     owner.ID,
+			Description: spec.Workspace.Description,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create workspace: %w", err)
+		}
+		res.WorkspaceCreated = true
+		log.WithFields(log.Fields{"workspace_id": ws.ID, "name": ws.Name}).Info("[bootstrap] workspace created")
+	default:
+		return nil, err
+	}
+	res.WorkspaceID = ws.ID
+
+	// Report generated PINs even when a later agent fails, since the
+	// agents already created are not retried.
+	var pins []generatedPIN
+	defer func() {
+		if err := reportPINs(spec.PINFile, ws.ID, pins); err != nil {
+			log.WithError(err).Error("[bootstrap] generated agent PINs could not be written")
+		}
+	}()
+
+	maxProbes := limits.LoadFromEnv().MaxProbesPerAgent
+	for _, as := range spec.Agents {
+		var existing agent.Agent
+		if err := db.WithContext(ctx).Where("workspace_id = ? AND LOWER(name) = ?", ws.ID, strings.ToLower(as.Name)).
+			Limit(1).Find(&existing).Error; err != nil {
+			return res, err
+		}
+		if existing.ID != 0 {
+			continue
+		}
+		out, err := agent.CreateAgent(ctx, db, agent.CreateInput{
+			WorkspaceID: ws.ID,
+			Name:        as.Name,
+			Description: as.Description,
+			Location:    as.Location,
+			PIN:         as.PIN,
+			Labels:      labelsJSON(as.Labels),
+		})
+		if err != nil {
+			return res, fmt.Errorf("create agent %q: %w", as.Name, err)
+		}
+		res.AgentsCreated = append(res.AgentsCreated, as.Name)
+
+		log.WithFields(log.Fields{"workspace_id": ws.ID, "agent_id": out.Agent.ID, "name": as.Name}).Info("[bootstrap] agent created")
+		if as.PIN == "" {
+			pins = append(pins, generatedPIN{agentID: out.Agent.ID, name: as.Name, pin: out.PIN})
+		}
+
+		if as.DefaultProbes == nil || *as.DefaultProbes {
+			if _, err := probe.ApplyDefaultProbeBundle(ctx, db, ws.ID, out.Agent.ID, maxProbes); err != nil {
+				log.Warnf("[bootstrap] default probe bundle for agent %d incomplete: %v", out.Agent.ID, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// generatedPIN is a PIN Run generated for an agent without one in the spec.
+type generatedPIN struct {
+	agentID uint
+	name    string
+	pin     string
+}
+
+// pinStdout is where PINs go without a PIN file; swapped in tests.
+var pinStdout io.Writer = os.Stdout
+
+// reportPINs appends the generated PINs to path, created 0600, or prints
+// them to stdout once. They are kept out of the structured log, which is
+// usually shipped and retained elsewhere.
+func reportPINs(path string, workspaceID uint, pins []generatedPIN) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	w := pinStdout
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// An existing file keeps its mode on open; tighten it.
+		if err := f.Chmod(0o600); err != nil {
+			return err
+		}
+		w = f
+	}
+	for _, p := range pins {
+		if _, err := fmt.Fprintf(w, "workspace=%d agent_id=%d name=%q pin=%s\n", workspaceID, p.agentID, p.name, p.pin); err != nil {
+			return err
+		}
+	}
+	if path != "" {
+		log.WithFields(log.Fields{"workspace_id": workspaceID, "count": len(pins), "file": path}).Info("[bootstrap] generated agent PINs written")
+	}
+	return nil
+}
+
+func labelsJSON(m map[string]string) datatypes.JSON {
+	if len(m) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(m)
+	return datatypes.JSON(b)
+}
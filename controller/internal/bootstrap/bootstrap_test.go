@@ -0,0 +1,92 @@
+package bootstrap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"netwatcher-controller/internal/admin"
+)
+
+func TestParseSpec(t *testing.T) {
+	t.Setenv("TEST_BOOT_PIN", "123456789")
+	spec, err := ParseSpec([]byte(`
+admin:
+  email: ops@example.com
+workspace:
+  name: " Production "
+agents:
+  - name: edge-1
+    pin: ${TEST_BOOT_PIN}
+  - name: edge-2
+    default_probes: false
+`))
+	if err != nil {
+		t.Fatalf("ParseSpec: %v", err)
+	}
+	if spec.Workspace.Name != "Production" || len(spec.Agents) != 2 {
+		t.Fatalf("spec = %+v", spec)
+	}
+	if spec.Agents[0].PIN != "123456789" {
+		t.Errorf("pin = %q, want expanded env value", spec.Agents[0].PIN)
+	}
+	if p := spec.Agents[1].DefaultProbes; p == nil || *p {
+		t.Errorf("default_probes = %v, want false", p)
+	}
+
+	cfg := admin.Config{DefaultAdminEmail: "admin@netwatcher.local", DefaultAdminPassword: "from-env"}
+	spec.ApplyAdmin(&cfg)
+	if cfg.DefaultAdminEmail != "ops@example.com" || cfg.DefaultAdminPassword != "from-env" {
+		t.Errorf("admin config = %+v", cfg)
+	}
+
+	for name, doc := range map[string]string{
+		"duplicate agent": "workspace: {name: w}\nagents: [{name: a}, {name: A}]",
+		"unnamed agent":   "workspace: {name: w}\nagents: [{location: x}]",
+		"unknown field":   "workspace: {name: w, owner: bob}",
+	} {
+		if _, err := ParseSpec([]byte(doc)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if spec, err := ParseSpec(nil); err != nil || spec.Workspace.Name != "" {
+		t.Errorf("empty document = %+v, %v", spec, err)
+	}
+}
+
+// TestReportPINs verifies generated PINs go to a 0600 file when one is
+// configured and to stdout otherwise.
+func TestReportPINs(t *testing.T) {
+	pins := []generatedPIN{{agentID: 3, name: "edge 1", pin: "123456"}}
+
+	path := filepath.Join(t.TempDir(), "pins.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reportPINs(path, 9, pins); err != nil {
+		t.Fatalf("reportPINs: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "workspace=9 agent_id=3 name=\"edge 1\" pin=123456\n"; string(raw) != want {
+		t.Errorf("file = %q, want %q", raw, want)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v (%v), want 0600", fi.Mode().Perm(), err)
+	}
+
+	var out bytes.Buffer
+	pinStdout = &out
+	t.Cleanup(func() { pinStdout = os.Stdout })
+	if err := reportPINs("", 9, pins); err != nil || !strings.Contains(out.String(), "pin=123456") {
+		t.Errorf("stdout = %q (%v)", out.String(), err)
+	}
+	out.Reset()
+	if err := reportPINs("", 9, nil); err != nil || out.Len() != 0 {
+		t.Errorf("no PINs wrote %q (%v)", out.String(), err)
+	}
+}
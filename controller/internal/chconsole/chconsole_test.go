@@ -0,0 +1,149 @@
+package chconsole
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testTables = []string{"probe_data", "speedtest_data"}
+
+func TestValidateAccepts(t *testing.T) {
+	for q, want := range map[string][]string{
+		"SELECT count() FROM probe_data":                                                      {"probe_data"},
+		"select * from probe_data where probe_id = 4 limit 10;":                               {"probe_data"},
+		"SELECT p.type, s.id FROM probe_data AS p JOIN speedtest_data s ON p.probe_id = s.id": {"probe_data", "speedtest_data"},
+		"SELECT * FROM probe_data p, speedtest_data":                                          {"probe_data", "speedtest_data"},
+		"WITH recent AS (SELECT * FROM probe_data) SELECT count() FROM recent":                {"probe_data"},
+		"SELECT * FROM (SELECT * FROM probe_data) AS x":                                       {"probe_data"},
+		"SELECT extract(DAY FROM created_at), format('{}', type) FROM probe_data":             {"probe_data"},
+		"SELECT x FROM probe_data ARRAY JOIN arr AS x":                                        {"probe_data"},
+		"SELECT * FROM probe_data WHERE payload LIKE '%DROP TABLE%; --'":                      {"probe_data"},
+		"SELECT * FROM `probe_data` WHERE probe_id IN speedtest_data":                         {"probe_data", "speedtest_data"},
+		"SELECT * FROM probe_data WHERE probe_id IN (1, 2, 3)":                                {"probe_data"},
+	} {
+		got, err := Validate(q, testTables)
+		if err != nil {
+			t.Errorf("%q: %v", q, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: tables = %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"  ;",
+		"DROP TABLE probe_data",
+		"INSERT INTO probe_data SELECT * FROM probe_data",
+		"SELECT 1; DROP TABLE probe_data",
+		"SELECT * FROM probe_data -- comment",
+		"SELECT * FROM probe_data /* comment */",
+		"SELECT * FROM probe_data # comment",
+		"SELECT * FROM users",
+		"SELECT * FROM system.tables",
+		"SELECT * FROM default.probe_data",
+		"SELECT * FROM url('http://example.com', CSV)",
+		"SELECT * FROM remote('other:9000', default, probe_data)",
+		"SELECT * FROM probe_data JOIN workspaces ON 1",
+		"SELECT * FROM probe_data, workspaces",
+		"SELECT * FROM (SELECT * FROM probe_data) AS x, secrets.tokens",
+		"SELECT * FROM (SELECT * FROM ip_whois_cache)",
+		"SELECT * FROM probe_data WHERE probe_id IN workspaces",
+		"SELECT dictGetString('d', 'a', 1) FROM probe_data",
+		"SELECT joinGet('j', 'v', 1) FROM probe_data",
+		"SELECT * FROM probe_data SETTINGS readonly = 0",
+		"SELECT * FROM probe_data FORMAT JSON",
+		"SELECT * FROM probe_data INTO OUTFILE '/tmp/x'",
+		"SELECT 1",
+		"SELECT * FROM probe_data WHERE type = 'PING",
+		"SELECT * FROM probe_data)",
+		"SHOW TABLES",
+	} {
+		if _, err := Validate(q, testTables); !errors.Is(err, ErrRejected) {
+			t.Errorf("%q: err = %v, want ErrRejected", q, err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("CH_CONSOLE_ENABLED", "true")
+	t.Setenv("CH_CONSOLE_TABLES", " probe_data , Speedtest_Data,")
+	t.Setenv("CH_CONSOLE_MAX_ROWS", "50000")
+	t.Setenv("CH_CONSOLE_TIMEOUT_SEC", "10")
+	cfg := LoadConfig()
+	if !cfg.Enabled || !reflect.DeepEqual(cfg.Tables, testTables) || cfg.MaxRows != maxMaxRows || cfg.Timeout != 10*time.Second || cfg.TimeoutSec != 10 {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+// TestRunAndRecord runs queries against SQLite (the settings ClickHouse
+// uses are context values other drivers ignore) and audits them.
+func TestRunAndRecord(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "console.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&QueryLog{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE probe_data (probe_id INTEGER, type TEXT, payload BLOB)").Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		db.Exec("INSERT INTO probe_data VALUES (?, 'PING', ?)", i, []byte(`{"rtt":1}`))
+	}
+	sqlDB, _ := db.DB()
+	ctx := context.Background()
+	cfg := Config{Tables: testTables, MaxRows: 3, Timeout: 5 * time.Second}
+
+	res, err := Run(ctx, sqlDB, cfg, "SELECT probe_id, type, payload FROM probe_data ORDER BY probe_id")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.RowCount != 3 || !res.Truncated || len(res.Columns) != 3 || res.Columns[1].Name != "type" {
+		t.Errorf("result = %+v", res)
+	}
+	if s, ok := res.Rows[0][2].(string); !ok || s != `{"rtt":1}` {
+		t.Errorf("payload = %#v, want string", res.Rows[0][2])
+	}
+	if err := Record(ctx, db, NewQueryLog(7, "q1", res, nil)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	res, err = Run(ctx, sqlDB, cfg, "SELECT * FROM workspaces")
+	if !errors.Is(err, ErrRejected) || res != nil {
+		t.Fatalf("rejected run = %v, %v", res, err)
+	}
+	_ = Record(ctx, db, NewQueryLog(7, "q2", res, err))
+
+	res, err = Run(ctx, sqlDB, cfg, "SELECT missing_column FROM probe_data")
+	if err == nil || res == nil || len(res.Tables) != 1 {
+		t.Fatalf("failing run = %+v, %v", res, err)
+	}
+	_ = Record(ctx, db, NewQueryLog(8, "q3", res, err))
+
+	all, err := ListLog(ctx, db, 0, 10)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("log = %v, %v", all, err)
+	}
+	if all[0].Status != StatusError || all[1].Status != StatusRejected || all[2].Status != StatusOK {
+		t.Errorf("statuses = %s, %s, %s", all[0].Status, all[1].Status, all[2].Status)
+	}
+	if all[2].Tables != "probe_data" || all[2].Rows != 3 || !all[2].Truncated {
+		t.Errorf("ok entry = %+v", all[2])
+	}
+	if mine, _ := ListLog(ctx, db, 7, 10); len(mine) != 2 {
+		t.Errorf("user 7 has %d entries, want 2", len(mine))
+	}
+}
@@ -0,0 +1,251 @@
+// Package chconsole runs read-only ClickHouse queries for site admins, so
+// support can look into data issues without shell access to ClickHouse.
+// Queries are limited to one SELECT over an allowlist of tables, run with
+// readonly, row and time limits, and every attempt is recorded in the
+// admin_clickhouse_queries audit table.
+package chconsole
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/probe"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"gorm.io/gorm"
+)
+
+// ErrRejected is returned for queries the console will not run.
+var ErrRejected = errors.New("query rejected")
+
+const (
+	defaultMaxRows = 1000
+	maxMaxRows     = 10000
+	defaultTimeout = 30 * time.Second
+	maxTimeout     = 120 * time.Second
+)
+
+// defaultTables are the telemetry tables the console may read. Caches and
+// internal bookkeeping tables are left out.
+var defaultTables = []string{"probe_data", "speedtest_data", "analysis_snapshots", "analysis_snapshot_versions"}
+
+// Config holds the console limits.
+type Config struct {
+	Enabled bool          `json:"enabled"`
+	Tables  []string      `json:"tables"`
+	MaxRows int           `json:"max_rows"`
+	Timeout time.Duration `json:"-"`
+	// TimeoutSec mirrors Timeout for the API.
+	TimeoutSec int `json:"timeout_sec"`
+}
+
+// LoadConfig reads the console settings from the environment:
+//
+//	CH_CONSOLE_ENABLED      "true" to enable (default off)
+//	CH_CONSOLE_TABLES       comma-separated allowlist (default probe_data,
+//	                        speedtest_data, analysis_snapshots,
+//	                        analysis_snapshot_versions)
+//	CH_CONSOLE_MAX_ROWS     rows returned per query (default 1000, max 10000)
+//	CH_CONSOLE_TIMEOUT_SEC  execution time limit (default 30, max 120)
+func LoadConfig() Config {
+	cfg := Config{
+		Tables:  defaultTables,
+		MaxRows: defaultMaxRows,
+		Timeout: defaultTimeout,
+	}
+	cfg.Enabled, _ = strconv.ParseBool(os.Getenv("CH_CONSOLE_ENABLED"))
+	if v := os.Getenv("CH_CONSOLE_TABLES"); v != "" {
+		var tables []string
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tables = append(tables, strings.ToLower(t))
+			}
+		}
+		if len(tables) > 0 {
+			cfg.Tables = tables
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("CH_CONSOLE_MAX_ROWS")); err == nil && n > 0 {
+		cfg.MaxRows = min(n, maxMaxRows)
+	}
+	if n, err := strconv.Atoi(os.Getenv("CH_CONSOLE_TIMEOUT_SEC")); err == nil && n > 0 {
+		cfg.Timeout = min(time.Duration(n)*time.Second, maxTimeout)
+	}
+	cfg.TimeoutSec = int(cfg.Timeout / time.Second)
+	return cfg
+}
+
+// Column describes one result column.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Result is a query's output.
+type Result struct {
+	Tables    []string `json:"tables"`
+	Columns   []Column `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	RowCount  int      `json:"row_count"`
+	Truncated bool     `json:"truncated"` // more rows than MaxRows
+	ElapsedMs int64    `json:"elapsed_ms"`
+}
+
+// Run validates query and executes it under the configured limits. Tables
+// is filled in even when execution fails.
+func Run(ctx context.Context, ch *sql.DB, cfg Config, query string) (*Result, error) {
+	tables, err := Validate(query, cfg.Tables)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Tables: tables, Columns: []Column{}, Rows: [][]any{}}
+
+	ctx, cancel := probe.WithCHBudget(ctx, cfg.Timeout, "chconsole")
+	defer cancel()
+	// WithSettings replaces the settings WithCHBudget attached, so the tag
+	// is carried over. readonly=2 still lets the query set its limits.
+	settings := clickhouse.Settings{
+		"readonly":             2,
+		"max_execution_time":   int(cfg.Timeout / time.Second),
+		"max_result_rows":      cfg.MaxRows + 1,
+		"result_overflow_mode": "break",
+	}
+	if tag, ok := probe.CHQueryTag(ctx); ok {
+		settings["log_comment"] = tag
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+	stop := probe.KillCHQueriesOnCancel(ctx, ch)
+	defer stop()
+
+	start := time.Now()
+	defer func() { res.ElapsedMs = time.Since(start).Milliseconds() }()
+	rows, err := ch.QueryContext(ctx, query)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return res, err
+	}
+	for _, t := range types {
+		res.Columns = append(res.Columns, Column{Name: t.Name(), Type: t.DatabaseTypeName()})
+	}
+	for rows.Next() {
+		if len(res.Rows) == cfg.MaxRows {
+			res.Truncated = true
+			break
+		}
+		vals := make([]any, len(types))
+		ptrs := make([]any, len(types))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return res, err
+		}
+		for i, v := range vals {
+			vals[i] = jsonValue(v)
+		}
+		res.Rows = append(res.Rows, vals)
+	}
+	res.RowCount = len(res.Rows)
+	return res, rows.Err()
+}
+
+// jsonValue makes a scanned value safe for encoding/json: bytes become
+// strings and non-finite floats, which JSON can't carry, their names.
+func jsonValue(v any) any {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+	case float32:
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return strconv.FormatFloat(float64(x), 'g', -1, 32)
+		}
+	}
+	return v
+}
+
+// -------------------- Audit Log --------------------
+
+// Query statuses.
+const (
+	StatusOK       = "ok"
+	StatusRejected = "rejected" // failed validation, never sent
+	StatusError    = "error"    // ClickHouse returned an error
+)
+
+// QueryLog records one console query attempt.
+type QueryLog struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	UserID     uint   `gorm:"index" json:"user_id"`
+	Query      string `gorm:"type:text" json:"query"`
+	Tables     string `gorm:"size:512" json:"tables"` // comma-separated
+	Status     string `gorm:"size:16;index" json:"status"`
+	Error      string `gorm:"size:1024" json:"error,omitempty"`
+	Rows       int    `json:"rows"`
+	Truncated  bool   `json:"truncated"`
+	DurationMs int64  `json:"duration_ms"`
+	RequestID  string `gorm:"size:64" json:"request_id,omitempty"`
+	ClientIP   string `gorm:"size:64" json:"client_ip,omitempty"`
+}
+
+func (QueryLog) TableName() string { return "admin_clickhouse_queries" }
+
+// NewQueryLog builds the audit entry for a Run outcome.
+func NewQueryLog(userID uint, query string, res *Result, err error) *QueryLog {
+	e := &QueryLog{UserID: userID, Query: query, Status: StatusOK}
+	if res != nil {
+		e.Tables = strings.Join(res.Tables, ",")
+		e.Rows = res.RowCount
+		e.Truncated = res.Truncated
+		e.DurationMs = res.ElapsedMs
+	}
+	switch {
+	case errors.Is(err, ErrRejected):
+		e.Status = StatusRejected
+	case err != nil:
+		e.Status = StatusError
+	}
+	if err != nil {
+		e.Error = err.Error()
+		if len(e.Error) > 1024 {
+			e.Error = e.Error[:1024]
+		}
+	}
+	return e
+}
+
+// Record stores an audit entry.
+func Record(ctx context.Context, db *gorm.DB, e *QueryLog) error {
+	if err := db.WithContext(ctx).Create(e).Error; err != nil {
+		return fmt.Errorf("record console query: %w", err)
+	}
+	return nil
+}
+
+// ListLog returns the newest audit entries first.
+func ListLog(ctx context.Context, db *gorm.DB, userID uint, limit int) ([]QueryLog, error) {
+	q := db.WithContext(ctx).Order("id DESC").Limit(limit)
+	if userID > 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var out []QueryLog
+	err := q.Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,323 @@
+package chconsole
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Query Validation ──
+//
+// A console query must be one SELECT (or WITH … SELECT) that reads only
+// allowlisted tables. The check is lexical and deliberately narrow:
+// anything it can't classify is rejected. ClickHouse enforces readonly
+// on top, so a statement that slips past the parser still cannot write.
+//
+// Rejected:
+//   - comments and more than one statement
+//   - write, DDL and session keywords (INSERT, ALTER, SETTINGS, INTO
+//     OUTFILE, FORMAT, …)
+//   - table functions and database-qualified names after FROM, JOIN
+//     and IN, so system.* and url()/s3()/remote() are unreachable
+//   - scalar functions that read other tables or files (dictGet,
+//     joinGet, file, …)
+
+// maxQueryLen bounds the statement text.
+const maxQueryLen = 20000
+
+// forbiddenKeywords may not appear as bare words. As a function name
+// (followed by "(") they are allowed, so format() still works.
+var forbiddenKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "alter": true, "drop": true,
+	"create": true, "attach": true, "detach": true, "optimize": true, "truncate": true,
+	"rename": true, "exchange": true, "undrop": true, "kill": true, "system": true,
+	"grant": true, "revoke": true, "set": true, "settings": true, "into": true,
+	"outfile": true, "format": true, "use": true, "backup": true, "restore": true,
+	"move": true, "check": true,
+}
+
+// forbiddenFunctions read outside the allowlisted tables.
+var forbiddenFunctions = map[string]bool{
+	"file": true, "url": true, "remote": true, "remotesecure": true, "s3": true,
+	"s3cluster": true, "hdfs": true, "mysql": true, "postgresql": true, "jdbc": true,
+	"odbc": true, "input": true, "executable": true, "cluster": true,
+	"clusterallreplicas": true, "dictionary": true, "merge": true, "azureblobstorage": true,
+	"gcs": true, "mongodb": true, "redis": true, "sqlite": true, "deltalake": true,
+	"iceberg": true, "hudi": true, "joinget": true, "joingetornull": true,
+	"dicthas": true, "dictisin": true, "hascolumnintable": true, "generaterandom": true,
+}
+
+// forbiddenFunctionPrefixes cover function families (dictGetString, …).
+var forbiddenFunctionPrefixes = []string{"dictget"}
+
+// fromFunctions take FROM as an argument separator, not a table clause.
+var fromFunctions = map[string]bool{"extract": true, "trim": true, "substring": true, "position": true}
+
+// clauseKeywords end a table reference's alias.
+var clauseKeywords = map[string]bool{
+	"where": true, "prewhere": true, "group": true, "order": true, "limit": true,
+	"having": true, "join": true, "inner": true, "left": true, "right": true,
+	"full": true, "cross": true, "any": true, "all": true, "asof": true, "semi": true,
+	"anti": true, "array": true, "global": true, "on": true, "using": true,
+	"union": true, "except": true, "intersect": true, "final": true, "sample": true,
+	"window": true, "qualify": true, "paste": true,
+}
+
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota // bare identifier or keyword
+	tokQuoted                  // `identifier` or "identifier"
+	tokString                  // 'literal'
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // words lower-cased, quoted identifiers unquoted
+}
+
+func (t token) is(kind tokenKind, text string) bool { return t.kind == kind && t.text == text }
+
+// tokenize splits a statement into tokens, rejecting comments and
+// unterminated literals.
+func tokenize(q string) ([]token, error) {
+	var out []token
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(q) && q[i+1] == '-', c == '/' && i+1 < len(q) && q[i+1] == '*', c == '#':
+			return nil, fmt.Errorf("%w: comments are not allowed", ErrRejected)
+		case c == '\'' || c == '`' || c == '"':
+			j := i + 1
+			var b strings.Builder
+			closed := false
+			for j < len(q) {
+				if q[j] == '\\' && j+1 < len(q) {
+					b.WriteByte(q[j+1])
+					j += 2
+					continue
+				}
+				if q[j] == c {
+					if j+1 < len(q) && q[j+1] == c { // doubled quote
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					closed = true
+					j++
+					break
+				}
+				b.WriteByte(q[j])
+				j++
+			}
+			if !closed {
+				return nil, fmt.Errorf("%w: unterminated quote", ErrRejected)
+			}
+			kind := tokQuoted
+			if c == '\'' {
+				kind = tokString
+			}
+			out = append(out, token{kind, b.String()})
+			i = j
+		case isWordStart(c):
+			j := i
+			for j < len(q) && isWordPart(q[j]) {
+				j++
+			}
+			out = append(out, token{tokWord, strings.ToLower(q[i:j])})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(q) && (isWordPart(q[j]) || q[j] == '.' ||
+				((q[j] == '+' || q[j] == '-') && (q[j-1] == 'e' || q[j-1] == 'E'))) {
+				j++
+			}
+			out = append(out, token{tokNumber, q[i:j]})
+			i = j
+		default:
+			out = append(out, token{tokPunct, string(c)})
+			i++
+		}
+	}
+	return out, nil
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordPart(c byte) bool { return isWordStart(c) || c == '$' || (c >= '0' && c <= '9') }
+
+// isName reports whether t can name a table.
+func isName(t token) bool { return t.kind == tokWord || t.kind == tokQuoted }
+
+// Validate checks q against the allowlist and returns the tables it
+// reads.
+func Validate(q string, allowed []string) ([]string, error) {
+	if len(q) > maxQueryLen {
+		return nil, fmt.Errorf("%w: query is longer than %d characters", ErrRejected, maxQueryLen)
+	}
+	toks, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+	for len(toks) > 0 && toks[len(toks)-1].is(tokPunct, ";") {
+		toks = toks[:len(toks)-1]
+	}
+	if len(toks) == 0 {
+		return nil, fmt.Errorf("%w: query is empty", ErrRejected)
+	}
+	if first := toks[0]; !first.is(tokWord, "select") && !first.is(tokWord, "with") {
+		return nil, fmt.Errorf("%w: only SELECT queries are allowed", ErrRejected)
+	}
+
+	allow := make(map[string]bool, len(allowed))
+	for _, t := range allowed {
+		allow[t] = true
+	}
+	// Common table expressions: name AS ( … ).
+	ctes := make(map[string]bool)
+	for i := 0; i+2 < len(toks); i++ {
+		if isName(toks[i]) && toks[i+1].is(tokWord, "as") && toks[i+2].is(tokPunct, "(") {
+			ctes[toks[i].text] = true
+		}
+	}
+
+	tables := make(map[string]bool)
+	subqueries := make(map[int]bool) // "(" positions opening a FROM/JOIN subquery
+	// tableRef checks the table reference starting at i and returns the
+	// index after it.
+	tableRef := func(i int) (int, error) {
+		if i >= len(toks) {
+			return i, fmt.Errorf("%w: missing table name", ErrRejected)
+		}
+		if toks[i].is(tokPunct, "(") {
+			subqueries[i] = true // checked as the scan continues
+			return i, nil
+		}
+		if !isName(toks[i]) {
+			return i, fmt.Errorf("%w: unexpected %q after FROM", ErrRejected, toks[i].text)
+		}
+		name := toks[i].text
+		if i+1 < len(toks) && toks[i+1].is(tokPunct, ".") {
+			return i, fmt.Errorf("%w: database-qualified table %q is not allowed", ErrRejected, name)
+		}
+		if i+1 < len(toks) && toks[i+1].is(tokPunct, "(") {
+			return i, fmt.Errorf("%w: table function %s() is not allowed", ErrRejected, name)
+		}
+		if !allow[name] && !ctes[name] {
+			return i, fmt.Errorf("%w: table %q is not in the console allowlist", ErrRejected, name)
+		}
+		if allow[name] {
+			tables[name] = true
+		}
+		return i + 1, nil
+	}
+	// moreRefs follows a table reference ending before j through
+	// "[AS] alias, next" and returns the index after the last one.
+	moreRefs := func(j int) (int, error) {
+		for j < len(toks) {
+			k := j
+			if toks[k].is(tokWord, "as") {
+				k++
+			}
+			if k < len(toks) && isName(toks[k]) && !clauseKeywords[toks[k].text] {
+				k++
+			}
+			if k >= len(toks) || !toks[k].is(tokPunct, ",") {
+				break
+			}
+			next, err := tableRef(k + 1)
+			if err != nil || subqueries[next] {
+				return next, err
+			}
+			j = next
+		}
+		return j, nil
+	}
+
+	// calls tracks, per open parenthesis, the function it belongs to;
+	// subquery parentheses are marked subqueryCall.
+	const subqueryCall = "\x00"
+	var calls []string
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		next := token{kind: tokPunct}
+		if i+1 < len(toks) {
+			next = toks[i+1]
+		}
+		switch {
+		case t.is(tokPunct, ";"):
+			return nil, fmt.Errorf("%w: only one statement is allowed", ErrRejected)
+		case t.is(tokPunct, "("):
+			fn := ""
+			if subqueries[i] {
+				fn = subqueryCall
+			} else if i > 0 && toks[i-1].kind == tokWord {
+				fn = toks[i-1].text
+			}
+			calls = append(calls, fn)
+		case t.is(tokPunct, ")"):
+			if len(calls) == 0 {
+				return nil, fmt.Errorf("%w: unbalanced parentheses", ErrRejected)
+			}
+			fn := calls[len(calls)-1]
+			calls = calls[:len(calls)-1]
+			if fn == subqueryCall {
+				// FROM (SELECT …) AS x, next
+				j, err := moreRefs(i + 1)
+				if err != nil {
+					return nil, err
+				}
+				i = j - 1
+			}
+		case t.kind != tokWord:
+		case next.is(tokPunct, "(") && t.text != "from" && t.text != "join":
+			if forbiddenFunctions[t.text] {
+				return nil, fmt.Errorf("%w: function %s() is not allowed", ErrRejected, t.text)
+			}
+			for _, p := range forbiddenFunctionPrefixes {
+				if strings.HasPrefix(t.text, p) {
+					return nil, fmt.Errorf("%w: function %s() is not allowed", ErrRejected, t.text)
+				}
+			}
+		case forbiddenKeywords[t.text]:
+			return nil, fmt.Errorf("%w: %s is not allowed", ErrRejected, strings.ToUpper(t.text))
+		case t.text == "from" && len(calls) > 0 && fromFunctions[calls[len(calls)-1]]:
+			// extract(DAY FROM ts)
+		case t.text == "from" || (t.text == "join" && !(i > 0 && toks[i-1].is(tokWord, "array"))):
+			j, err := tableRef(i + 1)
+			if err != nil {
+				return nil, err
+			}
+			if !subqueries[j] {
+				// Comma joins: FROM a [AS] x, b
+				if j, err = moreRefs(j); err != nil {
+					return nil, err
+				}
+			}
+			i = j - 1
+		case t.text == "in" && isName(next) && !(i+2 < len(toks) && toks[i+2].is(tokPunct, "(")):
+			// x IN table
+			j, err := tableRef(i + 1)
+			if err != nil {
+				return nil, err
+			}
+			i = j - 1
+		}
+	}
+
+	out := make([]string, 0, len(tables))
+	for _, t := range allowed {
+		if tables[t] {
+			out = append(out, t)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: the query must read an allowlisted table", ErrRejected)
+	}
+	return out, nil
+}
@@ -6,10 +6,20 @@ import (
 	"fmt"
 	"netwatcher-controller/internal/agent"
 	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/audit"
+	"netwatcher-controller/internal/chconsole"
+	"netwatcher-controller/internal/datastream"
 	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/extid"
+	"netwatcher-controller/internal/features"
+	"netwatcher-controller/internal/llm"
 	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/scheduler"
+	"netwatcher-controller/internal/settings"
 	"netwatcher-controller/internal/share"
 	"netwatcher-controller/internal/speedtest"
+	"netwatcher-controller/internal/sqlsafe"
+	"netwatcher-controller/internal/ticketing"
 	"netwatcher-controller/internal/users"
 	"netwatcher-controller/internal/workspace"
 	"os"
@@ -39,6 +49,10 @@ func OpenFromEnv() (*gorm.DB, error) {
 		return nil, fmt.Errorf("open postgres: %w", err)
 	}
 
+	if err := sqlsafe.InstallAudit(db); err != nil {
+		return nil, fmt.Errorf("sql audit: %w", err)
+	}
+
 	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, fmt.Errorf("db(): %w", err)
@@ -168,32 +182,83 @@ func CreateIndexes(db *gorm.DB) error {
 		return fmt.Errorf("workspace api keys automigrate: %w", err)
 	}
 
+	if err := workspace.NewStore(db).AutoMigrateServiceAccounts(context.TODO()); err != nil {
+		return fmt.Errorf("workspace service accounts automigrate: %w", err)
+	}
+
 	// 2) Remaining models (ordered loosely by dependency)
 	if err := db.WithContext(context.TODO()).AutoMigrate(
 		&users.User{},
-		&users.Session{},   // TableName(): "sessions"
-		&users.UserToken{}, // TableName(): "user_tokens" - email verification, password reset
+		&users.Session{},      // TableName(): "sessions"
+		&users.UserToken{},    // TableName(): "user_tokens" - email verification, password reset
+		&users.RefreshToken{}, // TableName(): "refresh_tokens"
 
 		&agent.Agent{},
-		&agent.Auth{}, // TableName(): "agent_pins"
-
-		&probe.Probe{},  // TableName(): "probes"
-		&probe.Target{}, // TableName(): "probe_targets"
+		&agent.Auth{},             // TableName(): "agent_pins"
+		&agent.StatusEvent{},      // TableName(): "agent_status_events"
+		&agent.ConnectionRecord{}, // TableName(): "agent_connection_audit"
+
+		&probe.Probe{},               // TableName(): "probes"
+		&probe.Target{},              // TableName(): "probe_targets"
+		&probe.TargetCriticality{},   // TableName(): "target_criticality"
+		&probe.TargetMaintenance{},   // TableName(): "target_maintenance"
+		&probe.CatalogEntry{},        // TableName(): "target_catalog"
+		&probe.TargetGroup{},         // TableName(): "target_groups"
+		&probe.IncidentEvidence{},    // TableName(): "incident_evidence"
+		&probe.IncidentMapSnapshot{}, // TableName(): "incident_map_snapshots"
+		&probe.IncidentRecord{},      // TableName(): "incident_history"
+		&probe.IncidentSample{},      // TableName(): "incident_samples"
+		&probe.Runbook{},             // TableName(): "runbooks"
+		&probe.ReprocessJob{},        // TableName(): "analysis_reprocess_jobs"
+		&probe.AgentPublicIP{},       // TableName(): "agent_public_ips"
+		&probe.OnboardingRun{},       // TableName(): "onboarding_runs"
+		&probe.TimelineAnnotation{},  // TableName(): "timeline_annotations"
+		&probe.DefaultProbe{},        // TableName(): "workspace_default_probes"
 
 		&speedtest.QueueItem{},    // TableName(): "speedtest_queue"
 		&speedtest.CachedServer{}, // TableName(): "agent_speedtest_servers"
 
-		&alert.AlertRule{},     // TableName(): "alert_rules"
-		&alert.Alert{},         // TableName(): "alerts"
-		&alert.RouteBaseline{}, // TableName(): "route_baselines"
+		&alert.AlertRule{},          // TableName(): "alert_rules"
+		&alert.Alert{},              // TableName(): "alerts"
+		&alert.RouteBaseline{},      // TableName(): "route_baselines"
+		&alert.NotificationPolicy{}, // TableName(): "workspace_notification_policies"
+		&alert.Silence{},            // TableName(): "alert_silences"
 
 		&share.ShareLink{}, // TableName(): "share_links"
+		&share.Badge{},     // TableName(): "badges"
+
+		&ticketing.Integration{}, // TableName(): "ticket_integrations"
+		&ticketing.Ticket{},      // TableName(): "incident_tickets"
+
+		&datastream.Stream{}, // TableName(): "data_streams"
 
 		&deletion.DeletionJob{}, // TableName(): "deletion_jobs"
+
+		&features.Override{}, // TableName(): "workspace_feature_flags"
+		&settings.Override{}, // TableName(): "controller_settings"
+
+		&chconsole.QueryLog{}, // TableName(): "admin_clickhouse_queries"
+
+		&llm.WorkspaceSettings{}, // TableName(): "workspace_llm_settings"
+		&llm.Usage{},             // TableName(): "llm_usage"
+		&llm.Job{},               // TableName(): "llm_enrichment_jobs"
+
+		&scheduler.SystemIncident{},    // TableName(): "system_incidents"
+		&scheduler.ArchivedPartition{}, // TableName(): "archived_partitions"
+
+		&audit.Entry{}, // TableName(): "workspace_audit_log"
 	); err != nil {
 		return fmt.Errorf("automigrate: %w", err)
 	}
 
+	// External IDs: rows created before the column existed get a ULID so
+	// the unique indexes below can be built.
+	for _, table := range []string{"agents", "probes"} {
+		if _, err := extid.Backfill(context.TODO(), db, table); err != nil {
+			return fmt.Errorf("backfill %s external ids: %w", table, err)
+		}
+	}
+
 	stmts := []string{
 		// users: guard against case-variant duplicates
 		`CREATE UNIQUE INDEX IF NOT EXISTS ux_users_email_lower ON users (LOWER(email));`,
@@ -207,6 +272,7 @@ func CreateIndexes(db *gorm.DB) error {
 		// agents
 		`CREATE INDEX IF NOT EXISTS idx_agents_ws_name ON agents (workspace_id, name);`,
 		`CREATE INDEX IF NOT EXISTS idx_agents_last_seen ON agents (last_seen_at);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS ux_agents_ws_external_id ON agents (workspace_id, external_id) WHERE deleted_at IS NULL;`,
 
 		// agent_pins (agent.Auth → "agent_pins")
 		`CREATE INDEX IF NOT EXISTS idx_agent_pins_ws ON agent_pins (workspace_id);`,
@@ -220,6 +286,7 @@ func CreateIndexes(db *gorm.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_probes_type ON probes (type);`,
 		`CREATE INDEX IF NOT EXISTS idx_probes_enabled ON probes (enabled);`,
 		`CREATE INDEX IF NOT EXISTS idx_probes_agent_type ON probes (agent_id, type);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS ux_probes_ws_external_id ON probes (workspace_id, external_id) WHERE deleted_at IS NULL;`,
 
 		// probe_targets
 		`CREATE INDEX IF NOT EXISTS idx_probe_targets_probe ON probe_targets (probe_id);`,
@@ -0,0 +1,216 @@
+package datastream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/alert"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestStreamMatches(t *testing.T) {
+	s := Stream{
+		WorkspaceID: 1,
+		Types:       datatypes.JSONSlice[string]{"PING", "MTR"},
+		Labels:      datatypes.NewJSONType(map[string]string{"site": "hq"}),
+	}
+	for name, tc := range map[string]struct {
+		rec  Record
+		want bool
+	}{
+		"match":           {Record{WorkspaceID: 1, Type: "PING", Labels: map[string]string{"site": "hq", "env": "prod"}}, true},
+		"other workspace": {Record{WorkspaceID: 2, Type: "PING", Labels: map[string]string{"site": "hq"}}, false},
+		"other type":      {Record{WorkspaceID: 1, Type: "DNS", Labels: map[string]string{"site": "hq"}}, false},
+		"label differs":   {Record{WorkspaceID: 1, Type: "MTR", Labels: map[string]string{"site": "branch"}}, false},
+		"label missing":   {Record{WorkspaceID: 1, Type: "MTR"}, false},
+	} {
+		if got := s.Matches(&tc.rec); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", name, got, tc.want)
+		}
+	}
+
+	all := Stream{WorkspaceID: 1}
+	if !all.Matches(&Record{WorkspaceID: 1, Type: "SPEEDTEST"}) {
+		t.Error("stream without filters should match every record of its workspace")
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	for name, in := range map[string]StreamInput{
+		"bad kind":      {Kind: ptr("sqs"), URL: ptr("https://example.com")},
+		"bad url":       {Kind: ptr("webhook"), URL: ptr("ftp://example.com")},
+		"kafka topic":   {Kind: ptr("kafka"), URL: ptr("https://proxy.example.com")},
+		"bad topic":     {Kind: ptr("kafka"), URL: ptr("https://proxy.example.com"), Topic: ptr("probe data")},
+		"empty label":   {Kind: ptr("webhook"), URL: ptr("https://example.com"), Labels: &map[string]string{" ": "x"}},
+		"missing input": {},
+	} {
+		if err := in.apply(&Stream{}); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", name, err)
+		}
+	}
+
+	s := &Stream{}
+	in := StreamInput{Kind: ptr("Kafka"), URL: ptr("https://proxy.example.com"), Topic: ptr("netwatcher.probe-data"), Types: &[]string{"ping", " PING", "mtr"}}
+	if err := in.apply(s); err != nil {
+		t.Fatalf("valid kafka stream: %v", err)
+	}
+	if s.Kind != KindKafka || len(s.Types) != 2 || s.Types[0] != "PING" || s.Types[1] != "MTR" {
+		t.Errorf("normalized stream = %+v", s)
+	}
+}
+
+func TestDeliverWebhookSigned(t *testing.T) {
+	var got webhookBody
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := alert.VerifyWebhookSignature("whsec_test", r.Header.Get(alert.HeaderWebhookSignatureV1),
+			r.Header.Get(alert.HeaderWebhookDelivery), body, time.Now(), alert.WebhookReplayWindow)
+		if err != nil {
+			t.Errorf("signature: %v", err)
+		}
+		_ = json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	s := &Stream{ID: 7, Kind: KindWebhook, URL: srv.URL, Secret: "whsec_test"}
+	if err := deliver(context.Background(), srv.Client(), s, []Record{{WorkspaceID: 1, ProbeID: 3, Type: "PING", Payload: json.RawMessage(`{}`)}}); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if got.StreamID != 7 || len(got.Records) != 1 || got.Records[0].ProbeID != 3 {
+		t.Errorf("received %+v", got)
+	}
+}
+
+func TestDeliverKafkaRESTProxy(t *testing.T) {
+	var path, contentType, user, pass string
+	var body struct {
+		Records []kafkaRecord `json:"records"`
+	}
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		user, pass, _ = r.BasicAuth()
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if fail {
+			w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":40403,"error":"Schema not found"}]}`))
+			return
+		}
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":12}]}`))
+	}))
+	defer srv.Close()
+
+	s := &Stream{Kind: KindKafka, URL: srv.URL + "/", Topic: "probe-data", Username: "svc", Secret: "pw"}
+	batch := []Record{{WorkspaceID: 1, ProbeID: 9, Type: "MTR", Payload: json.RawMessage(`{}`)}}
+	if err := deliver(context.Background(), srv.Client(), s, batch); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if path != "/topics/probe-data" || contentType != kafkaJSONType || user != "svc" || pass != "pw" {
+		t.Errorf("request path %q, content type %q, auth %q:%q", path, contentType, user, pass)
+	}
+	if len(body.Records) != 1 || body.Records[0].Key != "9" || body.Records[0].Value.Type != "MTR" {
+		t.Errorf("records = %+v", body.Records)
+	}
+
+	fail = true
+	if err := deliver(context.Background(), srv.Client(), s, batch); err == nil {
+		t.Error("per-record produce error not reported")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if retryable(&statusError{code: http.StatusBadRequest}) {
+		t.Error("400 should not be retried")
+	}
+	if !retryable(&statusError{code: http.StatusServiceUnavailable}) || !retryable(&statusError{code: http.StatusTooManyRequests}) {
+		t.Error("503 and 429 should be retried")
+	}
+	if !retryable(errors.New("connection refused")) {
+		t.Error("network errors should be retried")
+	}
+}
+
+// TestDispatcherDelivers runs records through the dispatcher into a
+// webhook and checks filtering, batching and the counters.
+func TestDispatcherDelivers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "streams.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&Stream{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var mu sync.Mutex
+	var received []Record
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b webhookBody
+		_ = json.NewDecoder(r.Body).Decode(&b)
+		mu.Lock()
+		received = append(received, b.Records...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	s, err := CreateStream(ctx, db, 1, StreamInput{Kind: ptr("webhook"), URL: ptr(srv.URL), Types: &[]string{"PING"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	disabled, err := CreateStream(ctx, db, 1, StreamInput{Kind: ptr("webhook"), URL: ptr(srv.URL), Enabled: ptr(false)})
+	if err != nil {
+		t.Fatalf("create disabled: %v", err)
+	}
+
+	d := NewDispatcher(db, Config{BatchSize: 2, FlushInterval: 20 * time.Millisecond, QueueSize: 10, RefreshInterval: time.Minute})
+	if err := d.Reload(ctx); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	d.Publish(Record{WorkspaceID: 1, ProbeID: 1, Type: "PING"})
+	d.Publish(Record{WorkspaceID: 1, ProbeID: 2, Type: "MTR"})  // filtered by type
+	d.Publish(Record{WorkspaceID: 2, ProbeID: 3, Type: "PING"}) // other workspace
+	d.Publish(Record{WorkspaceID: 1, ProbeID: 4, Type: "PING"})
+	d.Publish(Record{WorkspaceID: 1, ProbeID: 5, Type: "PING"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.stopAll()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 3 {
+		t.Fatalf("received %d records, want 3: %+v", len(received), received)
+	}
+	for _, r := range received {
+		if r.Type != "PING" || r.WorkspaceID != 1 {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+	if st := d.Stats(s.ID); st == nil || st.Delivered != 3 || st.Dropped != 0 || st.Failed != 0 || st.LastDeliveryAt == nil {
+		t.Errorf("stats = %+v", st)
+	}
+	if st := d.Stats(disabled.ID); st != nil {
+		t.Errorf("disabled stream has stats %+v", st)
+	}
+}
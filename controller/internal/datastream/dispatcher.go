@@ -0,0 +1,571 @@
+package datastream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/health"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Dispatch ──
+//
+// Publish is called on the ingest path for every probe result and must
+// not block it: each enabled stream has a bounded queue, and records that
+// find it full are dropped and counted. A worker per stream sends a batch
+// when it reaches BatchSize records or FlushInterval has passed, retrying
+// failed batches with backoff before dropping them as failed.
+//
+// The enabled streams are reloaded every RefreshInterval and right after
+// a change made through this controller. Counters are kept in memory by
+// each controller; the latest delivery error is also stored on the
+// stream so every replica reports it.
+
+const (
+	maxAttempts     = 3
+	retryBackoff    = time.Second
+	deliveryTimeout = 15 * time.Second
+	drainTimeout    = 5 * time.Second
+	kafkaJSONType   = "application/vnd.kafka.json.v2+json"
+)
+
+// Config tunes batching and queueing.
+type Config struct {
+	BatchSize       int           // records per delivery
+	FlushInterval   time.Duration // longest a record waits for a batch
+	QueueSize       int           // records buffered per stream
+	RefreshInterval time.Duration // stream reload period
+}
+
+// LoadConfig reads DATA_STREAM_* from the environment.
+func LoadConfig() Config {
+	cfg := Config{BatchSize: 100, FlushInterval: 2 * time.Second, QueueSize: 10000, RefreshInterval: 30 * time.Second}
+	if v := os.Getenv("DATA_STREAM_BATCH_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.BatchSize = n
+		}
+	}
+	if v := os.Getenv("DATA_STREAM_FLUSH_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.FlushInterval = time.Duration(n) * time.Millisecond
+		}
+	}
+	if v := os.Getenv("DATA_STREAM_QUEUE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.QueueSize = n
+		}
+	}
+	return cfg
+}
+
+// Record is one probe result as delivered to a stream.
+type Record struct {
+	WorkspaceID  uint              `json:"workspace_id"`
+	ProbeID      uint              `json:"probe_id"`
+	AgentID      uint              `json:"agent_id"`
+	ProbeAgentID uint              `json:"probe_agent_id,omitempty"`
+	TargetAgent  uint              `json:"target_agent,omitempty"`
+	Type         string            `json:"type"`
+	Target       string            `json:"target,omitempty"`
+	Triggered    bool              `json:"triggered,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ReceivedAt   time.Time         `json:"received_at"`
+	Labels       map[string]string `json:"labels,omitempty"` // the probe's labels
+	Payload      json.RawMessage   `json:"payload"`
+}
+
+// ProbeLabels flattens a probe's labels JSON to strings for filtering.
+// Values that are not strings, numbers or booleans are skipped.
+func ProbeLabels(raw []byte) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			out[k] = v
+		case float64:
+			out[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			out[k] = strconv.FormatBool(v)
+		}
+	}
+	return out
+}
+
+// StreamStats are a stream's delivery counters on this controller since
+// it started.
+type StreamStats struct {
+	Queued         int        `json:"queued"`
+	Delivered      int64      `json:"delivered"`
+	Dropped        int64      `json:"dropped"` // queue full
+	Failed         int64      `json:"failed"`  // delivery gave up
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time `json:"last_error_at,omitempty"`
+}
+
+// counters outlive a stream's worker, so a reload after an edit keeps
+// them.
+type counters struct {
+	delivered, dropped, failed atomic.Int64
+
+	mu             sync.Mutex
+	lastDeliveryAt time.Time
+	lastError      string
+	lastErrorAt    time.Time
+	storedError    string // last_error as written to the database
+}
+
+// sink is the running worker of one stream.
+type sink struct {
+	stream Stream
+	queue  chan Record
+	stats  *counters
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Dispatcher fans ingested records out to the enabled streams.
+type Dispatcher struct {
+	db     *gorm.DB
+	cfg    Config
+	client *http.Client
+
+	mu     sync.RWMutex
+	sinks  map[uint]*sink   // by stream ID
+	byWS   map[uint][]*sink // by workspace ID
+	stats  map[uint]*counters
+	reload chan struct{}
+}
+
+// NewDispatcher returns a dispatcher with no streams loaded.
+func NewDispatcher(db *gorm.DB, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		cfg:    cfg,
+		client: &http.Client{Timeout: deliveryTimeout},
+		sinks:  make(map[uint]*sink),
+		byWS:   make(map[uint][]*sink),
+		stats:  make(map[uint]*counters),
+		reload: make(chan struct{}, 1),
+	}
+}
+
+var (
+	defaultMu         sync.RWMutex
+	defaultDispatcher *Dispatcher
+)
+
+// Start runs the controller's dispatcher until ctx is done.
+func Start(ctx context.Context, db *gorm.DB, cfg Config) {
+	d := NewDispatcher(db, cfg)
+	defaultMu.Lock()
+	defaultDispatcher = d
+	defaultMu.Unlock()
+	d.Run(ctx)
+}
+
+func current() *Dispatcher {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultDispatcher
+}
+
+// Publish offers a record to the matching streams. It never blocks.
+func Publish(rec Record) {
+	if d := current(); d != nil {
+		d.Publish(rec)
+	}
+}
+
+// Changed reloads the streams after one was created, edited or deleted.
+func Changed() {
+	if d := current(); d != nil {
+		d.Changed()
+	}
+}
+
+// Stats returns a stream's counters, or nil before anything was queued
+// for it or when the dispatcher is not running.
+func Stats(streamID uint) *StreamStats {
+	if d := current(); d != nil {
+		return d.Stats(streamID)
+	}
+	return nil
+}
+
+// Run loads the streams and reloads them until ctx is done, then drains
+// the queues.
+func (d *Dispatcher) Run(ctx context.Context) {
+	health.Register("data_streams", d.cfg.RefreshInterval, 0)
+	defer health.Stop("data_streams")
+
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.Reload(ctx); err != nil && ctx.Err() == nil {
+			log.WithError(err).Warn("data streams: reload failed")
+		}
+		health.Beat("data_streams")
+		select {
+		case <-ctx.Done():
+			d.stopAll()
+			return
+		case <-ticker.C:
+		case <-d.reload:
+		}
+	}
+}
+
+// Changed requests a reload.
+func (d *Dispatcher) Changed() {
+	select {
+	case d.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Reload starts workers for new and edited streams and stops those of
+// deleted or disabled ones.
+func (d *Dispatcher) Reload(ctx context.Context) error {
+	streams, err := listEnabled(ctx, d.db)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	var stopped []*sink
+	next := make(map[uint]*sink, len(streams))
+	for _, s := range streams {
+		if old, ok := d.sinks[s.ID]; ok && old.stream.UpdatedAt.Equal(s.UpdatedAt) {
+			next[s.ID] = old
+			continue
+		}
+		if old, ok := d.sinks[s.ID]; ok {
+			stopped = append(stopped, old)
+		}
+		c := d.stats[s.ID]
+		if c == nil {
+			c = &counters{}
+			d.stats[s.ID] = c
+		}
+		c.mu.Lock()
+		c.storedError = s.LastError // an edit clears it
+		c.mu.Unlock()
+		sk := &sink{
+			stream: s,
+			queue:  make(chan Record, d.cfg.QueueSize),
+			stats:  c,
+			stop:   make(chan struct{}),
+			done:   make(chan struct{}),
+		}
+		next[s.ID] = sk
+		go d.work(sk)
+	}
+	for id, old := range d.sinks {
+		if _, ok := next[id]; !ok {
+			stopped = append(stopped, old)
+		}
+	}
+	byWS := make(map[uint][]*sink)
+	for _, sk := range next {
+		byWS[sk.stream.WorkspaceID] = append(byWS[sk.stream.WorkspaceID], sk)
+	}
+	d.sinks, d.byWS = next, byWS
+	d.mu.Unlock()
+
+	// Stopped workers deliver what they had queued.
+	for _, sk := range stopped {
+		close(sk.stop)
+	}
+	return nil
+}
+
+func (d *Dispatcher) stopAll() {
+	d.mu.Lock()
+	sinks := d.sinks
+	d.sinks, d.byWS = make(map[uint]*sink), make(map[uint][]*sink)
+	d.mu.Unlock()
+	for _, sk := range sinks {
+		close(sk.stop)
+	}
+	for _, sk := range sinks {
+		<-sk.done
+	}
+}
+
+// Publish queues a record on every matching stream of its workspace.
+func (d *Dispatcher) Publish(rec Record) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, sk := range d.byWS[rec.WorkspaceID] {
+		if !sk.stream.Matches(&rec) {
+			continue
+		}
+		select {
+		case sk.queue <- rec:
+		default:
+			sk.stats.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns a stream's counters.
+func (d *Dispatcher) Stats(streamID uint) *StreamStats {
+	d.mu.RLock()
+	c := d.stats[streamID]
+	sk := d.sinks[streamID]
+	d.mu.RUnlock()
+	if c == nil {
+		return nil
+	}
+	st := &StreamStats{
+		Delivered: c.delivered.Load(),
+		Dropped:   c.dropped.Load(),
+		Failed:    c.failed.Load(),
+	}
+	if sk != nil {
+		st.Queued = len(sk.queue)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastDeliveryAt.IsZero() {
+		t := c.lastDeliveryAt
+		st.LastDeliveryAt = &t
+	}
+	if c.lastError != "" {
+		t := c.lastErrorAt
+		st.LastError, st.LastErrorAt = c.lastError, &t
+	}
+	return st
+}
+
+// work batches a stream's queue until its sink is stopped.
+func (d *Dispatcher) work(sk *sink) {
+	defer close(sk.done)
+	ticker := time.NewTicker(d.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, d.cfg.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		d.deliverBatch(ctx, sk, batch)
+		batch = make([]Record, 0, d.cfg.BatchSize)
+	}
+	for {
+		select {
+		case rec := <-sk.queue:
+			batch = append(batch, rec)
+			if len(batch) >= d.cfg.BatchSize {
+				flush(context.Background())
+			}
+		case <-ticker.C:
+			flush(context.Background())
+		case <-sk.stop:
+			ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+		drain:
+			for {
+				select {
+				case rec := <-sk.queue:
+					batch = append(batch, rec)
+					if len(batch) >= d.cfg.BatchSize {
+						flush(ctx)
+					}
+				default:
+					break drain
+				}
+			}
+			flush(ctx)
+			return
+		}
+	}
+}
+
+// deliverBatch sends a batch with retries and records the outcome.
+func (d *Dispatcher) deliverBatch(ctx context.Context, sk *sink, batch []Record) {
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(retryBackoff << (attempt - 1)):
+			case <-ctx.Done():
+			}
+		}
+		if err = deliver(ctx, d.client, &sk.stream, batch); err == nil || !retryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	c := sk.stats
+	now := time.Now()
+	c.mu.Lock()
+	var stored string
+	if err != nil {
+		c.failed.Add(int64(len(batch)))
+		c.lastError, c.lastErrorAt = err.Error(), now
+		stored = c.lastError
+	} else {
+		c.delivered.Add(int64(len(batch)))
+		c.lastDeliveryAt = now
+	}
+	changed := stored != c.storedError
+	c.storedError = stored
+	c.mu.Unlock()
+
+	if err != nil {
+		log.WithError(err).WithField("stream", sk.stream.ID).Warnf("data streams: dropped %d records", len(batch))
+	}
+	if changed {
+		if err := setLastError(context.Background(), d.db, sk.stream.ID, stored); err != nil {
+			log.WithError(err).WithField("stream", sk.stream.ID).Warn("data streams: store last error")
+		}
+	}
+}
+
+// -------------------- Delivery --------------------
+
+// statusError is a non-2xx response.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("endpoint returned %d", e.code)
+	}
+	return fmt.Sprintf("endpoint returned %d: %s", e.code, e.body)
+}
+
+// retryable reports whether a failed delivery may succeed if repeated:
+// network errors, 429 and 5xx.
+func retryable(err error) bool {
+	se, ok := err.(*statusError)
+	return !ok || se.code == http.StatusTooManyRequests || se.code >= 500
+}
+
+// webhookBody is the JSON POSTed to a webhook.
+type webhookBody struct {
+	StreamID uint     `json:"stream_id"`
+	Records  []Record `json:"records"`
+}
+
+// kafkaRecord is one record of a REST proxy produce request, keyed by
+// probe so one probe's results stay in order within a partition.
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Record `json:"value"`
+}
+
+// kafkaResponse is the part of a produce response that reports
+// per-record failures.
+type kafkaResponse struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// deliver sends one batch to a stream's endpoint.
+func deliver(ctx context.Context, client *http.Client, s *Stream, batch []Record) error {
+	var (
+		target      string
+		contentType string
+		body        []byte
+		err         error
+	)
+	switch s.Kind {
+	case KindKafka:
+		records := make([]kafkaRecord, len(batch))
+		for i, r := range batch {
+			records[i] = kafkaRecord{Key: strconv.FormatUint(uint64(r.ProbeID), 10), Value: r}
+		}
+		target = strings.TrimSuffix(s.URL, "/") + "/topics/" + s.Topic
+		contentType = kafkaJSONType
+		body, err = json.Marshal(map[string]any{"records": records})
+	default:
+		target, contentType = s.URL, "application/json"
+		body, err = json.Marshal(webhookBody{StreamID: s.ID, Records: batch})
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "NetWatcher-DataStream/1.0")
+	switch s.Kind {
+	case KindKafka:
+		req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+		if s.Username != "" || s.Secret != "" {
+			req.SetBasicAuth(s.Username, s.Secret)
+		}
+	default:
+		if err := alert.SignWebhookRequest(req, s.Secret, body, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		return &statusError{code: resp.StatusCode, body: msg}
+	}
+	if s.Kind == KindKafka {
+		var kr kafkaResponse
+		if json.Unmarshal(respBody, &kr) == nil {
+			for _, o := range kr.Offsets {
+				if o.ErrorCode != nil || o.Error != "" {
+					return fmt.Errorf("kafka rejected a record: %s", o.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SendTest delivers one sample record to a stream synchronously.
+func SendTest(ctx context.Context, s *Stream) error {
+	now := time.Now().UTC()
+	rec := Record{
+		WorkspaceID: s.WorkspaceID,
+		Type:        "TEST",
+		CreatedAt:   now,
+		ReceivedAt:  now,
+		Payload:     json.RawMessage(`{"test":true}`),
+	}
+	return deliver(ctx, &http.Client{Timeout: deliveryTimeout}, s, []Record{rec})
+}
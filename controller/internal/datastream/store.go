@@ -0,0 +1,269 @@
+// Package datastream forwards probe data to customer pipelines as it is
+// ingested. A workspace configures streams, each selecting probe data by
+// type and probe labels and delivering it in batches to an HTTP webhook
+// or to a Kafka topic through a Kafka REST Proxy (Confluent REST API v2).
+package datastream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBadInput = errors.New("bad input")
+	ErrNotFound = errors.New("not found")
+)
+
+// Stream kinds.
+const (
+	KindWebhook = "webhook" // POST {"records": [...]} to URL
+	KindKafka   = "kafka"   // produce to Topic via the REST proxy at URL
+)
+
+const (
+	maxStreamTypes  = 32
+	maxStreamLabels = 16
+)
+
+// topicPattern is Kafka's legal topic name.
+var topicPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+// -------------------- Models --------------------
+
+// Stream forwards a workspace's probe data to an external endpoint.
+type Stream struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	WorkspaceID uint   `gorm:"index;not null" json:"workspace_id"`
+	Name        string `gorm:"size:128" json:"name"`
+	Kind        string `gorm:"size:16;not null" json:"kind"` // webhook, kafka
+	URL         string `gorm:"size:1024;not null" json:"url"`
+	Topic       string `gorm:"size:255" json:"topic,omitempty"` // kafka
+
+	// Secret signs webhook deliveries with the alert webhook scheme
+	// (X-NetWatcher-Signature-V1). Kafka: REST proxy basic auth.
+	Secret    string `gorm:"size:512" json:"-"`
+	HasSecret bool   `gorm:"-" json:"has_secret"`
+	Username  string `gorm:"size:255" json:"username,omitempty"` // kafka
+
+	// Filters. No types selects every type; every label must equal the
+	// probe's label of that name.
+	Types  datatypes.JSONSlice[string]           `json:"types"`
+	Labels datatypes.JSONType[map[string]string] `json:"labels"`
+
+	Enabled   bool   `gorm:"default:true;index" json:"enabled"`
+	LastError string `gorm:"size:512" json:"last_error,omitempty"`
+
+	// Stats are this controller's delivery counters, filled in by the API.
+	Stats *StreamStats `gorm:"-" json:"stats,omitempty"`
+}
+
+func (Stream) TableName() string { return "data_streams" }
+
+// AfterFind exposes whether a secret is stored without exposing it.
+func (s *Stream) AfterFind(*gorm.DB) error {
+	s.HasSecret = s.Secret != ""
+	return nil
+}
+
+// Matches reports whether a record passes the stream's filters.
+func (s *Stream) Matches(rec *Record) bool {
+	if rec.WorkspaceID != s.WorkspaceID {
+		return false
+	}
+	if len(s.Types) > 0 {
+		ok := false
+		for _, t := range s.Types {
+			if t == rec.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	for k, v := range s.Labels.Data() {
+		if got, ok := rec.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// -------------------- CRUD --------------------
+
+// StreamInput creates or updates a stream. Nil fields are left unchanged
+// on update.
+type StreamInput struct {
+	Name     *string            `json:"name"`
+	Kind     *string            `json:"kind"`
+	URL      *string            `json:"url"`
+	Topic    *string            `json:"topic"`
+	Secret   *string            `json:"secret"`
+	Username *string            `json:"username"`
+	Types    *[]string          `json:"types"`
+	Labels   *map[string]string `json:"labels"`
+	Enabled  *bool              `json:"enabled"`
+}
+
+func (in StreamInput) apply(s *Stream) error {
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	set(&s.Name, in.Name)
+	set(&s.Kind, in.Kind)
+	set(&s.URL, in.URL)
+	set(&s.Topic, in.Topic)
+	set(&s.Secret, in.Secret)
+	set(&s.Username, in.Username)
+	if in.Types != nil {
+		types := make([]string, 0, len(*in.Types))
+		seen := make(map[string]bool)
+		for _, t := range *in.Types {
+			t = strings.ToUpper(strings.TrimSpace(t))
+			if t != "" && !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+		s.Types = types
+	}
+	if in.Labels != nil {
+		labels := make(map[string]string, len(*in.Labels))
+		for k, v := range *in.Labels {
+			if k = strings.TrimSpace(k); k == "" {
+				return fmt.Errorf("%w: label names must not be empty", ErrBadInput)
+			}
+			labels[k] = v
+		}
+		s.Labels = datatypes.NewJSONType(labels)
+	}
+	if in.Enabled != nil {
+		s.Enabled = *in.Enabled
+	}
+	return validateStream(s)
+}
+
+func validateStream(s *Stream) error {
+	s.Kind = strings.ToLower(s.Kind)
+	if s.Kind != KindWebhook && s.Kind != KindKafka {
+		return fmt.Errorf("%w: kind must be webhook or kafka", ErrBadInput)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http(s) URL", ErrBadInput)
+	}
+	if s.Kind == KindKafka && !topicPattern.MatchString(s.Topic) {
+		return fmt.Errorf("%w: topic is required for kafka and may contain letters, digits, '.', '_' and '-'", ErrBadInput)
+	}
+	if s.Kind == KindWebhook {
+		s.Topic, s.Username = "", ""
+	}
+	if len(s.Types) > maxStreamTypes {
+		return fmt.Errorf("%w: at most %d types", ErrBadInput, maxStreamTypes)
+	}
+	if len(s.Labels.Data()) > maxStreamLabels {
+		return fmt.Errorf("%w: at most %d labels", ErrBadInput, maxStreamLabels)
+	}
+	if len(s.Name) > 128 {
+		return fmt.Errorf("%w: name must be at most 128 characters", ErrBadInput)
+	}
+	return nil
+}
+
+// CreateStream validates and stores a new stream.
+func CreateStream(ctx context.Context, db *gorm.DB, workspaceID uint, in StreamInput) (*Stream, error) {
+	s := &Stream{WorkspaceID: workspaceID, Enabled: true}
+	if err := in.apply(s); err != nil {
+		return nil, err
+	}
+	// gorm replaces zero values with column defaults on Create (and copies
+	// the default back), so the boolean is written again explicitly.
+	enabled := s.Enabled
+	if err := db.WithContext(ctx).Create(s).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Model(s).UpdateColumn("enabled", enabled).Error; err != nil {
+		return nil, err
+	}
+	s.Enabled = enabled
+	s.HasSecret = s.Secret != ""
+	return s, nil
+}
+
+// GetStream loads a stream scoped to its workspace.
+func GetStream(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*Stream, error) {
+	var s Stream
+	err := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListStreams returns a workspace's streams.
+func ListStreams(ctx context.Context, db *gorm.DB, workspaceID uint) ([]Stream, error) {
+	var out []Stream
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("id ASC").Find(&out).Error
+	return out, err
+}
+
+// UpdateStream applies a partial update.
+func UpdateStream(ctx context.Context, db *gorm.DB, workspaceID, id uint, in StreamInput) (*Stream, error) {
+	s, err := GetStream(ctx, db, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.apply(s); err != nil {
+		return nil, err
+	}
+	s.LastError = ""
+	if err := db.WithContext(ctx).Select("*").Omit("created_at").Save(s).Error; err != nil {
+		return nil, err
+	}
+	s.HasSecret = s.Secret != ""
+	return s, nil
+}
+
+// DeleteStream removes a stream.
+func DeleteStream(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).Delete(&Stream{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// listEnabled returns every enabled stream across workspaces.
+func listEnabled(ctx context.Context, db *gorm.DB) ([]Stream, error) {
+	var out []Stream
+	err := db.WithContext(ctx).Where("enabled = ?", true).Order("id ASC").Find(&out).Error
+	return out, err
+}
+
+// setLastError records the latest delivery failure; "" clears it.
+func setLastError(ctx context.Context, db *gorm.DB, id uint, msg string) error {
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	return db.WithContext(ctx).Model(&Stream{}).Where("id = ?", id).UpdateColumn("last_error", msg).Error
+}
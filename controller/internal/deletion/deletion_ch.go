@@ -6,11 +6,25 @@ import (
 	"fmt"
 )
 
+// Telemetry tables the worker clears, by the entity whose rows it deletes.
+// probe_data and speedtest_data carry no workspace_id, so a workspace
+// purge clears them agent by agent and only the analysis tables by
+// workspace. The *_restored copies exist only after an archive restore and
+// are skipped when absent.
+var (
+	ProbeDataTables = []string{"probe_data", "speedtest_data", "probe_data_restored", "speedtest_data_restored"}
+	WorkspaceTables = []string{
+		"analysis_snapshots", "analysis_snapshot_enrichments", "analysis_snapshot_versions",
+		"analysis_snapshots_restored",
+	}
+)
+
 // CHOps is the abstraction the worker uses to dispatch ClickHouse mutations.
 // Production code wires a *CHClient; tests can substitute an in-memory fake.
 type CHOps interface {
 	DeleteProbeDataByProbeID(ctx context.Context, probeID uint) error
 	DeleteProbeDataByAgentID(ctx context.Context, agentID uint) error
+	DeleteWorkspaceData(ctx context.Context, workspaceID uint) error
 }
 
 // CHClient is a *sql.DB-backed implementation of CHOps.
@@ -19,17 +33,32 @@ type CHClient struct {
 }
 
 func (c *CHClient) DeleteProbeDataByProbeID(ctx context.Context, probeID uint) error {
-	q := fmt.Sprintf("ALTER TABLE probe_data DELETE WHERE probe_id = %d", probeID)
-	if _, err := c.DB.ExecContext(ctx, q); err != nil {
-		return fmt.Errorf("clickhouse delete by probe_id=%d: %w", probeID, err)
-	}
-	return nil
+	return c.deleteWhere(ctx, ProbeDataTables, "probe_id", probeID)
 }
 
 func (c *CHClient) DeleteProbeDataByAgentID(ctx context.Context, agentID uint) error {
-	q := fmt.Sprintf("ALTER TABLE probe_data DELETE WHERE agent_id = %d", agentID)
-	if _, err := c.DB.ExecContext(ctx, q); err != nil {
-		return fmt.Errorf("clickhouse delete by agent_id=%d: %w", agentID, err)
+	return c.deleteWhere(ctx, ProbeDataTables, "agent_id", agentID)
+}
+
+func (c *CHClient) DeleteWorkspaceData(ctx context.Context, workspaceID uint) error {
+	return c.deleteWhere(ctx, WorkspaceTables, "workspace_id", workspaceID)
+}
+
+// deleteWhere runs one DELETE mutation per existing table.
+func (c *CHClient) deleteWhere(ctx context.Context, tables []string, column string, id uint) error {
+	for _, table := range tables {
+		var n uint64
+		if err := c.DB.QueryRowContext(ctx,
+			`SELECT count() FROM system.tables WHERE database = currentDatabase() AND name = ?`, table).Scan(&n); err != nil {
+			return fmt.Errorf("clickhouse delete by %s=%d: %w", column, id, err)
+		}
+		if n == 0 {
+			continue
+		}
+		q := fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s = %d", table, column, id)
+		if _, err := c.DB.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("clickhouse delete %s by %s=%d: %w", table, column, id, err)
+		}
 	}
 	return nil
 }
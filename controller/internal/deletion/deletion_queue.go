@@ -10,8 +10,9 @@ import (
 )
 
 const (
-	EntityProbe = "probe"
-	EntityAgent = "agent"
+	EntityProbe     = "probe"
+	EntityAgent     = "agent"
+	EntityWorkspace = "workspace"
 
 	StatusPending    = "pending"
 	StatusProcessing = "processing"
@@ -56,8 +57,12 @@ func (s *QueueStore) AutoMigrate(ctx context.Context) error {
 	return s.db.WithContext(ctx).AutoMigrate(&DeletionJob{})
 }
 
+func validEntity(entityType string) bool {
+	return entityType == EntityProbe || entityType == EntityAgent || entityType == EntityWorkspace
+}
+
 func (s *QueueStore) Enqueue(ctx context.Context, entityType string, entityID uint) error {
-	if entityType != EntityProbe && entityType != EntityAgent {
+	if !validEntity(entityType) {
 		return ErrBadEntity
 	}
 	if entityID == 0 {
@@ -79,7 +84,7 @@ func (s *QueueStore) Enqueue(ctx context.Context, entityType string, entityID ui
 }
 
 func (s *QueueStore) EnqueueBackfill(ctx context.Context, entityType string, entityID uint) error {
-	if entityType != EntityProbe && entityType != EntityAgent {
+	if !validEntity(entityType) {
 		return ErrBadEntity
 	}
 	if entityID == 0 {
@@ -216,3 +221,41 @@ func BackoffDuration(attempts int) time.Duration {
 	}
 	return time.Duration(secs) * time.Second
 }
+
+// EntityProgress classifies entities by their deletion jobs: done when any
+// job completed, open when one is pending or processing, failed when every
+// job exhausted its retries. Entities without a job are returned in missing.
+func (s *QueueStore) EntityProgress(ctx context.Context, entityType string, ids []uint) (done, open, failed int, missing []uint, err error) {
+	if len(ids) == 0 {
+		return 0, 0, 0, nil, nil
+	}
+	var rows []struct {
+		EntityID uint
+		Status   string
+	}
+	if err := s.db.WithContext(ctx).
+		Model(&DeletionJob{}).
+		Select("entity_id, status").
+		Where("entity_type = ? AND entity_id IN ?", entityType, ids).
+		Scan(&rows).Error; err != nil {
+		return 0, 0, 0, nil, err
+	}
+	rank := map[string]int{StatusFailed: 1, StatusPending: 2, StatusProcessing: 2, StatusCompleted: 3}
+	best := make(map[uint]int, len(ids))
+	for _, r := range rows {
+		best[r.EntityID] = max(best[r.EntityID], rank[r.Status])
+	}
+	for _, id := range ids {
+		switch best[id] {
+		case 3:
+			done++
+		case 2:
+			open++
+		case 1:
+			failed++
+		default:
+			missing = append(missing, id)
+		}
+	}
+	return done, open, failed, missing, nil
+}
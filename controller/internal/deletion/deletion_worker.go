@@ -6,6 +6,8 @@ import (
 	"sync"
 	"time"
 
+	"netwatcher-controller/internal/health"
+
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -55,6 +57,7 @@ func (w *Worker) Start() error {
 		"ch_timeout":    w.chTimeout,
 	}).Info("Deletion worker started")
 
+	health.Register("deletion_worker", w.pollInterval, 0)
 	w.wg.Add(1)
 	go w.run()
 	return nil
@@ -63,6 +66,7 @@ func (w *Worker) Start() error {
 func (w *Worker) Stop() {
 	w.cancel()
 	w.wg.Wait()
+	health.Stop("deletion_worker")
 	log.Info("Deletion worker stopped")
 }
 
@@ -78,6 +82,7 @@ func (w *Worker) run() {
 			return
 		case <-ticker.C:
 			w.processBatch()
+			health.Beat("deletion_worker")
 		}
 	}
 }
@@ -120,6 +125,8 @@ func (w *Worker) processJob(j DeletionJob) {
 		runErr = w.ch.DeleteProbeDataByProbeID(ctx, j.EntityID)
 	case EntityAgent:
 		runErr = w.ch.DeleteProbeDataByAgentID(ctx, j.EntityID)
+	case EntityWorkspace:
+		runErr = w.ch.DeleteWorkspaceData(ctx, j.EntityID)
 	default:
 		runErr = ErrBadEntity
 	}
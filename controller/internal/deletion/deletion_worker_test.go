@@ -11,6 +11,7 @@ type fakeCH struct {
 	mu         sync.Mutex
 	probeCalls []uint
 	agentCalls []uint
+	wsCalls    []uint
 	failNext   bool
 	failErr    error
 }
@@ -39,6 +40,13 @@ func (f *fakeCH) DeleteProbeDataByAgentID(_ context.Context, id uint) error {
 	return nil
 }
 
+func (f *fakeCH) DeleteWorkspaceData(_ context.Context, id uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wsCalls = append(f.wsCalls, id)
+	return nil
+}
+
 func TestWorkerProcessesPendingJobs(t *testing.T) {
 	db := newTestDB(t)
 	store := NewQueueStore(db)
@@ -49,6 +57,9 @@ func TestWorkerProcessesPendingJobs(t *testing.T) {
 	if err := store.Enqueue(ctx, EntityAgent, 202); err != nil {
 		t.Fatalf("enqueue agent: %v", err)
 	}
+	if err := store.Enqueue(ctx, EntityWorkspace, 3); err != nil {
+		t.Fatalf("enqueue workspace: %v", err)
+	}
 
 	ch := &fakeCH{}
 	w := NewWorkerWithOps(db, ch)
@@ -60,6 +71,9 @@ func TestWorkerProcessesPendingJobs(t *testing.T) {
 	if len(ch.agentCalls) != 1 || ch.agentCalls[0] != 202 {
 		t.Errorf("agent calls = %v, want [202]", ch.agentCalls)
 	}
+	if len(ch.wsCalls) != 1 || ch.wsCalls[0] != 3 {
+		t.Errorf("workspace calls = %v, want [3]", ch.wsCalls)
+	}
 
 	n, err := store.CountCompletedForEntity(ctx, EntityProbe, 101)
 	if err != nil {
@@ -0,0 +1,389 @@
+// Package devdata fabricates agents, probes and streaming telemetry for
+// local development, so the frontend and the analysis engine can be worked
+// on without real agents. It is off unless DEV_DATA_GENERATOR=true and
+// must never be enabled on a real deployment: it writes to the configured
+// workspace through the normal ingest handlers (alerts included).
+package devdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/probe"
+)
+
+// Degradation scenarios. Each runs once per scenario period in its own
+// slice of the period, so they don't overlap.
+const (
+	ScenarioLossBurst    = "loss_burst"    // first agent → first target: 20-40% loss
+	ScenarioRouteFlap    = "route_flap"    // second agent's MTR alternates between two paths
+	ScenarioAgentOffline = "agent_offline" // last agent stops reporting and heartbeating
+)
+
+// Targets are documentation addresses (RFC 5737), so generated data can't
+// be mistaken for a real path.
+var devTargets = []string{"198.51.100.10", "198.51.100.20", "203.0.113.30"}
+
+// Config controls the generator (env: DEV_DATA_*).
+type Config struct {
+	Enabled        bool
+	WorkspaceID    uint
+	Agents         int
+	Interval       time.Duration
+	Scenarios      []string
+	ScenarioPeriod time.Duration
+	Backfill       time.Duration
+}
+
+// LoadConfig reads the generator configuration from the environment.
+func LoadConfig() Config {
+	cfg := Config{
+		Enabled:        os.Getenv("DEV_DATA_GENERATOR") == "true",
+		WorkspaceID:    uint(envInt("DEV_DATA_WORKSPACE_ID", 0)),
+		Agents:         min(max(envInt("DEV_DATA_AGENTS", 4), 1), 50),
+		Interval:       time.Duration(max(envInt("DEV_DATA_INTERVAL_SEC", 60), 5)) * time.Second,
+		ScenarioPeriod: time.Duration(max(envInt("DEV_DATA_SCENARIO_PERIOD_MIN", 30), 3)) * time.Minute,
+		Backfill:       time.Duration(max(envInt("DEV_DATA_BACKFILL_MINUTES", 60), 0)) * time.Minute,
+		Scenarios:      []string{ScenarioLossBurst, ScenarioRouteFlap, ScenarioAgentOffline},
+	}
+	if v, ok := os.LookupEnv("DEV_DATA_SCENARIOS"); ok {
+		cfg.Scenarios = nil
+		for _, s := range strings.Split(v, ",") {
+			switch s = strings.TrimSpace(s); s {
+			case ScenarioLossBurst, ScenarioRouteFlap, ScenarioAgentOffline:
+				cfg.Scenarios = append(cfg.Scenarios, s)
+			case "", "none":
+			default:
+				log.Warnf("[devdata] ignoring unknown scenario %q", s)
+			}
+		}
+	}
+	return cfg
+}
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return n
+	}
+	return def
+}
+
+// Generator owns the fabricated agents and probes of one workspace.
+type Generator struct {
+	db  *gorm.DB
+	cfg Config
+	rng *rand.Rand
+
+	agents []devAgent
+	online map[uint]bool // last recorded status per agent
+}
+
+type devAgent struct {
+	index  int
+	id     uint
+	ping   uint // probe IDs
+	mtr    uint
+	public string
+}
+
+// New returns a generator; call Start to seed and stream.
+func New(db *gorm.DB, cfg Config) *Generator {
+	return &Generator{
+		db:     db,
+		cfg:    cfg,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		online: make(map[uint]bool),
+	}
+}
+
+// Start seeds the workspace, backfills history and then emits one round
+// of telemetry per interval until ctx is done.
+func (g *Generator) Start(ctx context.Context) {
+	if g.cfg.WorkspaceID == 0 {
+		log.Warn("[devdata] DEV_DATA_GENERATOR is set but DEV_DATA_WORKSPACE_ID is not; generator disabled")
+		return
+	}
+	log.Warnf("[devdata] DEV DATA GENERATOR ENABLED: fabricating %d agents in workspace %d (scenarios: %v)",
+		g.cfg.Agents, g.cfg.WorkspaceID, g.cfg.Scenarios)
+
+	if err := g.seed(ctx); err != nil {
+		log.WithError(err).Error("[devdata] seeding failed; generator disabled")
+		return
+	}
+
+	now := time.Now().UTC()
+	if g.cfg.Backfill > 0 {
+		for at := now.Add(-g.cfg.Backfill); at.Before(now); at = at.Add(g.cfg.Interval) {
+			g.tick(ctx, at)
+		}
+		log.Infof("[devdata] backfilled %s of telemetry", g.cfg.Backfill)
+	}
+
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		g.tick(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// seed finds or creates the dev agents ("dev-agent-N") and their PING and
+// MTR probes, then reports a NETINFO for each.
+func (g *Generator) seed(ctx context.Context) error {
+	meta := datatypes.JSON(`{"devdata":true}`)
+	for i := 0; i < g.cfg.Agents; i++ {
+		name := fmt.Sprintf("dev-agent-%d", i+1)
+		var a agent.Agent
+		err := g.db.WithContext(ctx).Where("workspace_id = ? AND name = ?", g.cfg.WorkspaceID, name).Limit(1).Find(&a).Error
+		if err != nil {
+			return err
+		}
+		if a.ID == 0 {
+			out, err := agent.CreateAgent(ctx, g.db, agent.CreateInput{
+				WorkspaceID: g.cfg.WorkspaceID,
+				Name:        name,
+				Description: "Fabricated by the dev data generator",
+				Location:    devLocations[i%len(devLocations)],
+				Version:     "dev",
+				Metadata:    meta,
+			})
+			if err != nil {
+				return fmt.Errorf("create %s: %w", name, err)
+			}
+			a = *out.Agent
+		}
+		if err := g.db.WithContext(ctx).Model(&agent.Agent{}).Where("id = ?", a.ID).
+			Updates(map[string]any{"initialized": true, "os": "linux", "arch": "amd64"}).Error; err != nil {
+			return err
+		}
+
+		da := devAgent{index: i, id: a.ID, public: fmt.Sprintf("192.0.2.%d", 10+i)}
+		if da.ping, err = g.ensureProbe(ctx, a.ID, probe.TypePing); err != nil {
+			return err
+		}
+		if da.mtr, err = g.ensureProbe(ctx, a.ID, probe.TypeMTR); err != nil {
+			return err
+		}
+		g.agents = append(g.agents, da)
+
+		raw, _ := json.Marshal(map[string]any{
+			"local_address":   fmt.Sprintf("10.%d.0.10", i+1),
+			"default_gateway": fmt.Sprintf("10.%d.0.1", i+1),
+			"public_address":  da.public,
+			"dns_servers":     []string{fmt.Sprintf("10.%d.0.1", i+1)},
+			"timestamp":       time.Now().UTC(),
+		})
+		g.dispatch(ctx, probe.ProbeData{AgentID: a.ID, Type: probe.TypeNetInfo, CreatedAt: time.Now().UTC(), Payload: raw})
+	}
+	return nil
+}
+
+var devLocations = []string{"Head Office", "Branch East", "Branch West", "Data Center", "Remote Lab"}
+
+// ensureProbe returns the agent's probe of a type, creating it with all
+// dev targets if missing.
+func (g *Generator) ensureProbe(ctx context.Context, agentID uint, typ probe.Type) (uint, error) {
+	var existing probe.Probe
+	err := g.db.WithContext(ctx).Where("agent_id = ? AND type = ?", agentID, typ).Limit(1).Find(&existing).Error
+	if err != nil {
+		return 0, err
+	}
+	if existing.ID != 0 {
+		return existing.ID, nil
+	}
+	p, err := probe.Create(ctx, g.db, probe.CreateInput{
+		WorkspaceID: g.cfg.WorkspaceID,
+		AgentID:     agentID,
+		Type:        typ,
+		Enabled:     true,
+		IntervalSec: int(g.cfg.Interval / time.Second),
+		Targets:     devTargets,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create %s probe for agent %d: %w", typ, agentID, err)
+	}
+	return p.ID, nil
+}
+
+// tick emits one round of PING and MTR results for every agent that is not
+// in the agent_offline scenario, and moves their last_seen_at.
+func (g *Generator) tick(ctx context.Context, at time.Time) {
+	for _, a := range g.agents {
+		offline := g.active(ScenarioAgentOffline, at) && a.index == len(g.agents)-1 && len(g.agents) > 1
+		g.setOnline(ctx, a, !offline, at)
+		if offline {
+			continue
+		}
+		for ti, target := range devTargets {
+			ping := g.pingPayload(a.index, ti, at)
+			raw, _ := json.Marshal(ping)
+			g.dispatch(ctx, probe.ProbeData{
+				ProbeID: a.ping, ProbeAgentID: a.id, AgentID: a.id, Type: probe.TypePing,
+				CreatedAt: at, ReceivedAt: at, Target: target, Payload: raw,
+			})
+
+			flapped := g.active(ScenarioRouteFlap, at) && a.index == min(1, len(g.agents)-1) &&
+				(at.Unix()/int64(g.cfg.Interval/time.Second))%2 == 1
+			mtr := mtrPayload(a.index, ti, at, ping, flapped)
+			raw, _ = json.Marshal(mtr)
+			g.dispatch(ctx, probe.ProbeData{
+				ProbeID: a.mtr, ProbeAgentID: a.id, AgentID: a.id, Type: probe.TypeMTR,
+				CreatedAt: at, ReceivedAt: at, Target: target, Payload: raw,
+			})
+		}
+	}
+}
+
+// active reports whether a configured scenario's window covers at. The
+// period is split into sixths: loss burst [0, 1/6), route flap [2/6, 4/6),
+// agent offline [4/6, 1).
+func (g *Generator) active(scenario string, at time.Time) bool {
+	enabled := false
+	for _, s := range g.cfg.Scenarios {
+		enabled = enabled || s == scenario
+	}
+	if !enabled {
+		return false
+	}
+	return scenarioActive(scenario, at, g.cfg.ScenarioPeriod)
+}
+
+func scenarioActive(scenario string, at time.Time, period time.Duration) bool {
+	phase := float64(at.UnixNano()%int64(period)) / float64(period)
+	switch scenario {
+	case ScenarioLossBurst:
+		return phase < 1.0/6
+	case ScenarioRouteFlap:
+		return phase >= 2.0/6 && phase < 4.0/6
+	case ScenarioAgentOffline:
+		return phase >= 4.0/6
+	}
+	return false
+}
+
+// baseLatency is a stable per-path RTT: agents are progressively further
+// away and later targets add a few milliseconds.
+func baseLatency(agentIdx, targetIdx int) float64 {
+	return 8 + 6*float64(agentIdx) + 3*float64(targetIdx)
+}
+
+func (g *Generator) pingPayload(agentIdx, targetIdx int, at time.Time) probe.PingPayload {
+	base := baseLatency(agentIdx, targetIdx)
+	// A slow daily swell plus noise.
+	swell := 1 + 0.15*math.Sin(2*math.Pi*float64(at.Unix()%86400)/86400)
+	avg := base*swell + g.rng.Float64()*2
+	jitter := 0.5 + g.rng.Float64()*1.5
+
+	const sent = 10
+	lost := 0
+	if g.rng.Float64() < 0.03 {
+		lost = 1
+	}
+	if agentIdx == 0 && targetIdx == 0 && g.active(ScenarioLossBurst, at) {
+		lost = 2 + g.rng.Intn(3)
+		avg *= 1.8
+		jitter *= 4
+	}
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	return probe.PingPayload{
+		StartTimestamp: at.Add(-10 * time.Second),
+		StopTimestamp:  at,
+		PacketsSent:    sent,
+		PacketsRecv:    sent - lost,
+		PacketLoss:     float64(lost) / sent * 100,
+		Addr:           devTargets[targetIdx],
+		MinRtt:         ms(avg - jitter),
+		MaxRtt:         ms(avg + 2*jitter),
+		AvgRtt:         ms(avg),
+		StdDevRtt:      ms(jitter),
+	}
+}
+
+// mtrPayload builds a trace consistent with the PING result: a LAN hop,
+// two ISP hops, a carrier core hop (which moves when flapped) and the
+// target, with the last hop carrying the PING loss and latency.
+func mtrPayload(agentIdx, targetIdx int, at time.Time, ping probe.PingPayload, flapped bool) probe.MtrPayload {
+	avg := float64(ping.AvgRtt) / float64(time.Millisecond)
+	core := "198.18.0.1"
+	if flapped {
+		core = "198.18.64.1"
+		avg += 7
+	}
+	hops := []struct {
+		ip   string
+		frac float64
+	}{
+		{fmt.Sprintf("10.%d.0.1", agentIdx+1), 0.05},
+		{fmt.Sprintf("100.64.%d.1", agentIdx+1), 0.3},
+		{"100.64.255.1", 0.45},
+		{core, 0.7},
+		{devTargets[targetIdx], 1},
+	}
+	report := probe.MtrReport{}
+	for i, h := range hops {
+		loss := 0.0
+		if i == len(hops)-1 {
+			loss = ping.PacketLoss
+		}
+		lat := avg * h.frac
+		report.Hops = append(report.Hops, probe.MtrHop{
+			TTL:     i + 1,
+			Hosts:   []probe.MtrHopHost{{IP: h.ip}},
+			LossPct: fmt.Sprintf("%.1f", loss),
+			Sent:    10,
+			Recv:    10 - int(loss/10),
+			Avg:     fmt.Sprintf("%.2f", lat),
+			Best:    fmt.Sprintf("%.2f", lat*0.9),
+			Worst:   fmt.Sprintf("%.2f", lat*1.3),
+			Last:    fmt.Sprintf("%.2f", lat),
+			StdDev:  fmt.Sprintf("%.2f", lat*0.05),
+		})
+	}
+	return probe.MtrPayload{
+		Report:         report,
+		StartTimestamp: probe.NewTimestamp(at.Add(-20 * time.Second)),
+		StopTimestamp:  probe.NewTimestamp(at),
+	}
+}
+
+// setOnline moves last_seen_at for online agents and records status
+// transitions so the timeline and connectivity views see them.
+func (g *Generator) setOnline(ctx context.Context, a devAgent, online bool, at time.Time) {
+	if online {
+		if err := g.db.WithContext(ctx).Model(&agent.Agent{}).Where("id = ?", a.id).
+			Update("last_seen_at", at).Error; err != nil {
+			log.WithError(err).Warnf("[devdata] agent %d heartbeat", a.id)
+		}
+	}
+	if prev, ok := g.online[a.id]; ok && prev == online {
+		return
+	}
+	g.online[a.id] = online
+	ev := agent.StatusEvent{AgentID: a.id, WorkspaceID: g.cfg.WorkspaceID, At: at, Online: online, ClientIP: a.public}
+	if err := agent.RecordStatusEvent(ctx, g.db, ev); err != nil {
+		log.WithError(err).Warnf("[devdata] agent %d status event", a.id)
+	}
+}
+
+func (g *Generator) dispatch(ctx context.Context, data probe.ProbeData) {
+	data.WorkspaceID = g.cfg.WorkspaceID
+	if err := probe.Dispatch(ctx, data); err != nil {
+		log.WithError(err).Debugf("[devdata] dispatch %s for agent %d", data.Type, data.AgentID)
+	}
+}
@@ -0,0 +1,54 @@
+package devdata
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestScenarioWindows(t *testing.T) {
+	period := 30 * time.Minute
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) // period boundary
+	for _, tc := range []struct {
+		offset   time.Duration
+		scenario string
+	}{
+		{1 * time.Minute, ScenarioLossBurst},
+		{12 * time.Minute, ScenarioRouteFlap},
+		{25 * time.Minute, ScenarioAgentOffline},
+	} {
+		at := start.Add(tc.offset)
+		for _, s := range []string{ScenarioLossBurst, ScenarioRouteFlap, ScenarioAgentOffline} {
+			if got := scenarioActive(s, at, period); got != (s == tc.scenario) {
+				t.Errorf("+%s %s active = %v", tc.offset, s, got)
+			}
+		}
+	}
+	if scenarioActive(ScenarioLossBurst, start.Add(7*time.Minute), period) {
+		t.Error("gap between windows should be quiet")
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	g := &Generator{
+		cfg: Config{Scenarios: []string{ScenarioLossBurst}, ScenarioPeriod: 30 * time.Minute},
+		rng: rand.New(rand.NewSource(1)),
+	}
+	burst := time.Date(2026, 3, 1, 12, 2, 0, 0, time.UTC)
+	if p := g.pingPayload(0, 0, burst); p.PacketLoss < 20 || p.PacketsRecv+int(p.PacketLoss/10) != p.PacketsSent {
+		t.Errorf("loss burst ping = %+v", p)
+	}
+	if p := g.pingPayload(1, 0, burst); p.PacketLoss > 10 {
+		t.Errorf("other agents should be unaffected: %+v", p)
+	}
+
+	ping := g.pingPayload(2, 1, burst)
+	normal := mtrPayload(2, 1, burst, ping, false)
+	flapped := mtrPayload(2, 1, burst, ping, true)
+	if normal.Report.HopFinalIP() != devTargets[1] || len(normal.Report.Hops) != len(flapped.Report.Hops) {
+		t.Fatalf("trace = %+v", normal.Report)
+	}
+	if normal.Report.Hops[3].Hosts[0].IP == flapped.Report.Hops[3].Hosts[0].IP {
+		t.Error("flapped trace should take a different core hop")
+	}
+}
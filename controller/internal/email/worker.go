@@ -6,6 +6,8 @@ import (
 	"sync"
 	"time"
 
+	"netwatcher-controller/internal/health"
+
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
@@ -85,6 +87,7 @@ func (w *Worker) Start() error {
 		log.Warn("Email worker started (queue-only mode - no delivery configured)")
 	}
 
+	health.Register("email_worker", w.pollInterval, 0)
 	w.wg.Add(1)
 	go w.run()
 
@@ -95,6 +98,7 @@ func (w *Worker) Start() error {
 func (w *Worker) Stop() {
 	w.cancel()
 	w.wg.Wait()
+	health.Stop("email_worker")
 	log.Info("Email worker stopped")
 }
 
@@ -111,6 +115,7 @@ func (w *Worker) run() {
 			return
 		case <-ticker.C:
 			w.processBatch()
+			health.Beat("email_worker")
 		}
 	}
 }
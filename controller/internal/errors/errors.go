@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // -------------------- Sentinel Errors --------------------
@@ -176,3 +177,65 @@ func WrapField(field string, err error) error {
 func FieldError(field, message string) error {
 	return fmt.Errorf("%s: %s", field, message)
 }
+
+// -------------------- Validation Errors --------------------
+
+// FieldIssue is one invalid input field. Index is set for list fields
+// (e.g. the third entry of targets).
+type FieldIssue struct {
+	Field  string `json:"field"`
+	Index  *int   `json:"index,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (f FieldIssue) String() string {
+	if f.Index != nil {
+		return fmt.Sprintf("%s[%d]: %s", f.Field, *f.Index, f.Reason)
+	}
+	return fmt.Sprintf("%s: %s", f.Field, f.Reason)
+}
+
+// ValidationError collects every invalid field of an input so clients can
+// point at each one. It matches ErrInvalidInput and Kind with errors.Is;
+// Kind is the owning package's sentinel (e.g. probe.ErrBadInput).
+type ValidationError struct {
+	Kind   error
+	Fields []FieldIssue
+}
+
+// Add records an invalid field.
+func (e *ValidationError) Add(field, reason string) {
+	e.Fields = append(e.Fields, FieldIssue{Field: field, Reason: reason})
+}
+
+// AddIndex records an invalid entry of a list field.
+func (e *ValidationError) AddIndex(field string, index int, reason string) {
+	e.Fields = append(e.Fields, FieldIssue{Field: field, Index: &index, Reason: reason})
+}
+
+// Err returns e, or nil when no field was recorded.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.String()
+	}
+	msg := "invalid input"
+	if e.Kind != nil {
+		msg = e.Kind.Error()
+	}
+	return msg + ": " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{ErrInvalidInput}
+	}
+	return []error{ErrInvalidInput, e.Kind}
+}
@@ -0,0 +1,135 @@
+// Package extid generates and validates the stable external IDs of agents
+// and probes. Auto-increment IDs differ between environments; an external
+// ID is a ULID assigned at creation, or a slug chosen by the user (for
+// GitOps configs that recreate the same objects everywhere), and routes
+// accept it wherever they accept the numeric ID.
+package extid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalid = errors.New("invalid external id")
+	ErrTaken   = errors.New("external id already in use")
+)
+
+// MaxLen is the longest external ID accepted.
+const MaxLen = 64
+
+var slugRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// crockford is the ULID alphabet, lowercased to match slugs.
+const crockford = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// New returns a new lowercase ULID: 48 bits of Unix milliseconds then 80
+// random bits, 26 characters of Crockford base32. IDs sort by creation.
+func New() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(fmt.Sprintf("extid: crypto/rand: %v", err))
+	}
+	// 128 bits → 26 base32 digits, most significant first (2 leading
+	// bits of padding).
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// IsRef reports whether a route parameter is an external ID rather than
+// a numeric one.
+func IsRef(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases and validates a user-chosen external ID: 1-64
+// characters of a-z, 0-9, '-' and '_', starting with a letter or digit,
+// and not all digits (those are numeric IDs).
+func Normalize(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || len(s) > MaxLen || !slugRe.MatchString(s) {
+		return "", fmt.Errorf("%w: use 1-%d characters of a-z, 0-9, '-' and '_'", ErrInvalid, MaxLen)
+	}
+	if !IsRef(s) {
+		return "", fmt.Errorf("%w: must contain a non-digit", ErrInvalid)
+	}
+	return s, nil
+}
+
+// Backfill assigns a ULID to every row of table without an external ID
+// and returns how many were updated. Run at startup before the unique
+// index is created.
+func Backfill(ctx context.Context, db *gorm.DB, table string) (int, error) {
+	var ids []uint
+	if err := db.WithContext(ctx).Table(table).
+		Where("external_id IS NULL OR external_id = ''").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := db.WithContext(ctx).Table(table).Where("id = ?", id).
+			Update("external_id", New()).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Claim normalizes a user-chosen external ID for a row of table in a
+// workspace and checks no other live row there uses it. excludeID is the
+// row being updated (0 on create).
+func Claim(ctx context.Context, db *gorm.DB, table string, workspaceID, excludeID uint, s string) (string, error) {
+	s, err := Normalize(s)
+	if err != nil {
+		return "", err
+	}
+	var n int64
+	if err := db.WithContext(ctx).Table(table).
+		Where("workspace_id = ? AND external_id = ? AND id <> ? AND deleted_at IS NULL", workspaceID, s, excludeID).
+		Count(&n).Error; err != nil {
+		return "", err
+	}
+	if n > 0 {
+		return "", fmt.Errorf("%w: %s", ErrTaken, s)
+	}
+	return s, nil
+}
+
+// Resolve returns the ID of the live row of table in a workspace with the
+// given external ID, or gorm.ErrRecordNotFound.
+func Resolve(ctx context.Context, db *gorm.DB, table string, workspaceID uint, ref string) (uint, error) {
+	var ids []uint
+	if err := db.WithContext(ctx).Table(table).
+		Where("workspace_id = ? AND external_id = ? AND deleted_at IS NULL", workspaceID, strings.ToLower(ref)).
+		Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return ids[0], nil
+}
@@ -0,0 +1,93 @@
+package extid
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestNew(t *testing.T) {
+	a := New()
+	time.Sleep(2 * time.Millisecond)
+	b := New()
+	if len(a) != 26 || a == b || a >= b {
+		t.Errorf("New() = %q then %q; want 26 chars, increasing", a, b)
+	}
+	if _, err := Normalize(a); err != nil {
+		t.Errorf("ULID rejected: %v", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if s, err := Normalize(" HQ-Ping_1 "); err != nil || s != "hq-ping_1" {
+		t.Errorf("Normalize = %q, %v", s, err)
+	}
+	for _, bad := range []string{"", "42", "-lead", "has space", "a/b", string(make([]byte, MaxLen+1))} {
+		if _, err := Normalize(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Normalize(%q) err = %v, want ErrInvalid", bad, err)
+		}
+	}
+	if IsRef("123") || !IsRef("01hz") || IsRef("") {
+		t.Error("IsRef misclassifies")
+	}
+}
+
+type row struct {
+	ID          uint `gorm:"primaryKey"`
+	WorkspaceID uint
+	ExternalID  string
+	DeletedAt   gorm.DeletedAt
+}
+
+func (row) TableName() string { return "things" }
+
+// TestClaimResolveBackfill covers per-workspace uniqueness, soft-deleted
+// rows releasing their IDs, and backfill.
+func TestClaimResolveBackfill(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	db.Create(&[]row{{WorkspaceID: 1, ExternalID: "edge"}, {WorkspaceID: 1}, {WorkspaceID: 2}})
+
+	if _, err := Claim(ctx, db, "things", 1, 0, "Edge"); !errors.Is(err, ErrTaken) {
+		t.Errorf("claim taken: err = %v", err)
+	}
+	if s, err := Claim(ctx, db, "things", 1, 1, "edge"); err != nil || s != "edge" {
+		t.Errorf("re-claim own = %q, %v", s, err)
+	}
+	if _, err := Claim(ctx, db, "things", 2, 0, "edge"); err != nil {
+		t.Errorf("other workspace: err = %v", err)
+	}
+	if id, err := Resolve(ctx, db, "things", 1, "EDGE"); err != nil || id != 1 {
+		t.Errorf("resolve = %d, %v", id, err)
+	}
+	if _, err := Resolve(ctx, db, "things", 2, "edge"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("resolve in other workspace: err = %v", err)
+	}
+
+	db.Delete(&row{}, 1)
+	if _, err := Claim(ctx, db, "things", 1, 0, "edge"); err != nil {
+		t.Errorf("claim after delete: err = %v", err)
+	}
+
+	if n, err := Backfill(ctx, db, "things"); err != nil || n != 2 {
+		t.Fatalf("backfill = %d, %v", n, err)
+	}
+	var rows []row
+	db.Find(&rows)
+	for _, r := range rows {
+		if len(r.ExternalID) == 0 {
+			t.Errorf("row %d not backfilled", r.ID)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package features provides per-workspace feature flags for experimental
+// or optional subsystems. Each flag has a built-in default that can be
+// changed deployment-wide with FEATURE_<KEY> (e.g. FEATURE_LLM_ENRICHMENT=false)
+// and overridden per workspace in Postgres. Lookups are served from an
+// in-memory cache so hot paths (the analysis loop) can check flags freely.
+package features
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Flag keys.
+const (
+	LLMEnrichment    = "llm_enrichment"
+	ExternalVantage  = "external_vantage"
+	IncidentEvidence = "incident_evidence"
+	TicketSync       = "ticket_sync"
+	AdaptiveProbing  = "adaptive_probing"
+	CustomAnalyzers  = "custom_analyzers"
+)
+
+// Flag describes one feature flag.
+type Flag struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	// Agent flags are also served to agents via /agent/api/features.
+	Agent bool `json:"agent"`
+}
+
+var registry = []Flag{
+	{Key: LLMEnrichment, Default: true, Description: "LLM summaries on workspace analysis (requires LLM_PROVIDER)"},
+	{Key: ExternalVantage, Default: true, Description: "Compare degraded targets against third-party vantage points (requires VANTAGE_PROVIDER)"},
+	{Key: IncidentEvidence, Default: true, Description: "Persist raw evidence bundles for warning and critical incidents, the samples behind each incident, and network map snapshots for critical ones"},
+	{Key: TicketSync, Default: true, Description: "Create and sync Jira / ServiceNow tickets from the analysis loop"},
+	{Key: CustomAnalyzers, Default: true, Description: "Run registered custom analyzers during probe and workspace analysis"},
+	{Key: AdaptiveProbing, Default: false, Agent: true, Description: "Agents shorten probe intervals while a target is degraded"},
+}
+
+// Flags returns all known flags with deployment defaults applied.
+func Flags() []Flag {
+	out := make([]Flag, len(registry))
+	for i, f := range registry {
+		f.Default = envDefault(f)
+		out[i] = f
+	}
+	return out
+}
+
+func lookup(key string) (Flag, bool) {
+	for _, f := range registry {
+		if f.Key == key {
+			f.Default = envDefault(f)
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+func envDefault(f Flag) bool {
+	v := strings.TrimSpace(os.Getenv("FEATURE_" + strings.ToUpper(f.Key)))
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b
+	}
+	return f.Default
+}
+
+// Override is a per-workspace flag value.
+type Override struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:ux_feature_flags_ws_key" json:"workspace_id"`
+	Key         string    `gorm:"size:64;not null;uniqueIndex:ux_feature_flags_ws_key" json:"key"`
+	Enabled     bool      `json:"enabled"`
+	UpdatedBy   uint      `json:"updated_by"`
+}
+
+func (Override) TableName() string { return "workspace_feature_flags" }
+
+// State is a flag's effective value in one workspace.
+type State struct {
+	Flag
+	Enabled    bool `json:"enabled"`
+	Overridden bool `json:"overridden"`
+}
+
+// cacheTTL bounds how stale a flag can be on another controller replica;
+// writes through this process invalidate immediately.
+const cacheTTL = 30 * time.Second
+
+type cacheEntry struct {
+	overrides map[string]bool
+	loadedAt  time.Time
+}
+
+// Store reads and writes flags through a process-wide cache.
+type Store struct {
+	db    *gorm.DB
+	mu    sync.Mutex
+	cache map[uint]cacheEntry
+}
+
+var (
+	defaultStore   *Store
+	defaultStoreMu sync.Mutex
+)
+
+// Default returns the process-wide store used by Enabled, creating it on
+// first use. main calls it at startup; later calls share the same cache.
+func Default(db *gorm.DB) *Store {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+	if defaultStore == nil {
+		defaultStore = NewStore(db)
+	}
+	return defaultStore
+}
+
+// NewStore returns a store with an empty cache.
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db, cache: make(map[uint]cacheEntry)}
+}
+
+// Enabled reports a flag through the process-wide store. Before Default
+// is called it returns the flag's deployment default.
+func Enabled(ctx context.Context, workspaceID uint, key string) bool {
+	defaultStoreMu.Lock()
+	s := defaultStore
+	defaultStoreMu.Unlock()
+	if s == nil {
+		f, _ := lookup(key)
+		return f.Default
+	}
+	return s.Enabled(ctx, workspaceID, key)
+}
+
+// Enabled reports whether key is on in a workspace. Lookup errors fall
+// back to the default so a database hiccup never flips a feature.
+func (s *Store) Enabled(ctx context.Context, workspaceID uint, key string) bool {
+	f, ok := lookup(key)
+	if !ok {
+		return false
+	}
+	overrides, err := s.overrides(ctx, workspaceID)
+	if err != nil {
+		return f.Default
+	}
+	if v, ok := overrides[key]; ok {
+		return v
+	}
+	return f.Default
+}
+
+// List returns every flag's state in a workspace.
+func (s *Store) List(ctx context.Context, workspaceID uint) ([]State, error) {
+	overrides, err := s.overrides(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	flags := Flags()
+	out := make([]State, 0, len(flags))
+	for _, f := range flags {
+		st := State{Flag: f, Enabled: f.Default}
+		if v, ok := overrides[f.Key]; ok {
+			st.Enabled, st.Overridden = v, true
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Set overrides a flag in a workspace. A nil value removes the override
+// so the workspace follows the deployment default again.
+func (s *Store) Set(ctx context.Context, workspaceID uint, key string, enabled *bool, userID uint) error {
+	if _, ok := lookup(key); !ok {
+		return ErrUnknownFlag
+	}
+	defer s.invalidate(workspaceID)
+	if enabled == nil {
+		return s.db.WithContext(ctx).
+			Where("workspace_id = ? AND key = ?", workspaceID, key).
+			Delete(&Override{}).Error
+	}
+	row := Override{WorkspaceID: workspaceID, Key: key, Enabled: *enabled, UpdatedBy: userID}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_by", "updated_at"}),
+	}).Create(&row).Error
+}
+
+func (s *Store) overrides(ctx context.Context, workspaceID uint) (map[string]bool, error) {
+	s.mu.Lock()
+	e, ok := s.cache[workspaceID]
+	s.mu.Unlock()
+	if ok && time.Since(e.loadedAt) < cacheTTL {
+		return e.overrides, nil
+	}
+
+	var rows []Override
+	if err := s.db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	m := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		m[r.Key] = r.Enabled
+	}
+	s.mu.Lock()
+	s.cache[workspaceID] = cacheEntry{overrides: m, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return m, nil
+}
+
+func (s *Store) invalidate(workspaceID uint) {
+	s.mu.Lock()
+	delete(s.cache, workspaceID)
+	s.mu.Unlock()
+}
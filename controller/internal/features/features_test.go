@@ -0,0 +1,89 @@
+package features
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&Override{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewStore(db)
+}
+
+// TestOverrideLifecycle verifies overrides win over defaults, are isolated
+// per workspace, and that clearing one restores the default.
+func TestOverrideLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	if !s.Enabled(ctx, 1, LLMEnrichment) {
+		t.Fatal("llm_enrichment should default on")
+	}
+	off := false
+	if err := s.Set(ctx, 1, LLMEnrichment, &off, 7); err != nil {
+		t.Fatal(err)
+	}
+	if s.Enabled(ctx, 1, LLMEnrichment) {
+		t.Error("override should turn the flag off")
+	}
+	if !s.Enabled(ctx, 2, LLMEnrichment) {
+		t.Error("override leaked into another workspace")
+	}
+
+	on := true
+	if err := s.Set(ctx, 1, LLMEnrichment, &on, 7); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enabled(ctx, 1, LLMEnrichment) {
+		t.Error("updated override not visible (cache not invalidated?)")
+	}
+
+	if err := s.Set(ctx, 1, LLMEnrichment, nil, 7); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range list {
+		if st.Key == LLMEnrichment && (st.Overridden || !st.Enabled) {
+			t.Errorf("cleared override still applied: %+v", st)
+		}
+	}
+}
+
+func TestUnknownFlag(t *testing.T) {
+	s := newTestStore(t)
+	on := true
+	if err := s.Set(context.Background(), 1, "no_such_flag", &on, 0); err != ErrUnknownFlag {
+		t.Errorf("err = %v, want ErrUnknownFlag", err)
+	}
+	if s.Enabled(context.Background(), 1, "no_such_flag") {
+		t.Error("unknown flag should be off")
+	}
+}
+
+func TestEnvDefault(t *testing.T) {
+	t.Setenv("FEATURE_ADAPTIVE_PROBING", "true")
+	f, _ := lookup(AdaptiveProbing)
+	if !f.Default {
+		t.Error("FEATURE_ADAPTIVE_PROBING=true should flip the default")
+	}
+	t.Setenv("FEATURE_ADAPTIVE_PROBING", "garbage")
+	if f, _ := lookup(AdaptiveProbing); f.Default {
+		t.Error("unparsable env value should keep the built-in default")
+	}
+}
@@ -0,0 +1,101 @@
+// Package health tracks liveness of the controller's background workers.
+//
+// Each long-running loop registers itself with its expected tick interval
+// and calls Beat after every iteration. A worker whose last beat is older
+// than staleAfter intervals is reported as stalled by /livez, so a
+// wedged loop (stuck query, deadlock) can be surfaced to an orchestrator
+// instead of silently stopping work.
+package health
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// staleAfter is how many missed intervals mark a worker as stalled. A
+// single slow iteration shouldn't flap liveness, so allow a few.
+const staleAfter = 3
+
+// minGrace is added to every threshold so short-interval workers aren't
+// failed by one slow database round trip.
+const minGrace = time.Minute
+
+type worker struct {
+	interval time.Duration
+	started  time.Time
+	lastBeat time.Time
+	stopped  bool
+}
+
+var (
+	mu      sync.Mutex
+	workers = map[string]*worker{}
+)
+
+// WorkerStatus is the liveness report for one worker.
+type WorkerStatus struct {
+	Name     string     `json:"name"`
+	Alive    bool       `json:"alive"`
+	Interval string     `json:"interval"`
+	LastBeat *time.Time `json:"last_beat,omitempty"`
+	Stopped  bool       `json:"stopped,omitempty"`
+}
+
+// Register records a worker that is expected to Beat at least once per
+// interval. initialDelay covers loops that sleep before their first run.
+func Register(name string, interval, initialDelay time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	workers[name] = &worker{interval: interval, started: time.Now().Add(initialDelay)}
+}
+
+// Beat marks the named worker as having completed an iteration.
+func Beat(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if w, ok := workers[name]; ok {
+		w.lastBeat = time.Now()
+	}
+}
+
+// Stop marks a worker as intentionally stopped (shutdown), so it is no
+// longer counted against liveness.
+func Stop(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if w, ok := workers[name]; ok {
+		w.stopped = true
+	}
+}
+
+// Workers returns the status of every registered worker, sorted by name.
+func Workers() []WorkerStatus {
+	return workersAt(time.Now())
+}
+
+func workersAt(now time.Time) []WorkerStatus {
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := make([]WorkerStatus, 0, len(workers))
+	for name, w := range workers {
+		ref := w.started
+		if w.lastBeat.After(ref) {
+			ref = w.lastBeat
+		}
+		st := WorkerStatus{
+			Name:     name,
+			Interval: w.interval.String(),
+			Stopped:  w.stopped,
+			Alive:    w.stopped || now.Sub(ref) <= staleAfter*w.interval+minGrace,
+		}
+		if !w.lastBeat.IsZero() {
+			lb := w.lastBeat
+			st.LastBeat = &lb
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
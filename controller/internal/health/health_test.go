@@ -0,0 +1,41 @@
+package health
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkerStaleness verifies a worker is alive while beating, stalled
+// once it misses several intervals, and not counted after Stop.
+func TestWorkerStaleness(t *testing.T) {
+	const name = "test_worker"
+	Register(name, time.Second, 0)
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(workers, name)
+		mu.Unlock()
+	})
+
+	find := func(now time.Time) WorkerStatus {
+		for _, w := range workersAt(now) {
+			if w.Name == name {
+				return w
+			}
+		}
+		t.Fatalf("worker %q not registered", name)
+		return WorkerStatus{}
+	}
+
+	Beat(name)
+	if !find(time.Now()).Alive {
+		t.Fatal("worker should be alive right after a beat")
+	}
+	if find(time.Now().Add(2 * time.Hour)).Alive {
+		t.Fatal("worker should be stalled after missing beats")
+	}
+
+	Stop(name)
+	if st := find(time.Now().Add(2 * time.Hour)); !st.Alive || !st.Stopped {
+		t.Fatalf("stopped worker should not fail liveness: %+v", st)
+	}
+}
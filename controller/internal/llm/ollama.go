@@ -35,16 +35,17 @@ func NewOllamaProvider(cfg Config) *OllamaProvider {
 func (p *OllamaProvider) Available() bool { return p.url != "" }
 func (p *OllamaProvider) Name() string    { return "ollama" }
 
-func (p *OllamaProvider) Summarize(ctx context.Context, req SummarizeRequest) (string, error) {
+func (p *OllamaProvider) Summarize(ctx context.Context, req SummarizeRequest) (Result, error) {
 	contextJSON, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("marshaling context: %w", err)
+		return Result{}, fmt.Errorf("marshaling context: %w", err)
 	}
+	prompt := fmt.Sprintf("Summarize this network analysis:\n\n```json\n%s\n```", string(contextJSON))
 
 	body := map[string]any{
 		"model":  p.model,
 		"system": SystemPrompt,
-		"prompt": fmt.Sprintf("Summarize this network analysis:\n\n```json\n%s\n```", string(contextJSON)),
+		"prompt": prompt,
 		"stream": false,
 		"options": map[string]any{
 			"temperature": 0.3,
@@ -54,36 +55,50 @@ func (p *OllamaProvider) Summarize(ctx context.Context, req SummarizeRequest) (s
 
 	bodyJSON, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("marshaling request: %w", err)
+		return Result{}, fmt.Errorf("marshaling request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.url+"/api/generate", bytes.NewReader(bodyJSON))
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return Result{}, fmt.Errorf("creating request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("Ollama request: %w", err)
+		return Result{}, fmt.Errorf("Ollama request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading response: %w", err)
+		return Result{}, fmt.Errorf("reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("Ollama returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
-		Response string `json:"response"`
+		Response        string `json:"response"`
+		PromptEvalCount int    `json:"prompt_eval_count"`
+		EvalCount       int    `json:"eval_count"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("parsing response: %w", err)
+		return Result{}, fmt.Errorf("parsing response: %w", err)
 	}
 
-	return result.Response, nil
+	out := Result{
+		Text:             result.Response,
+		Provider:         p.Name(),
+		PromptTokens:     result.PromptEvalCount,
+		CompletionTokens: result.EvalCount,
+	}
+	if out.PromptTokens == 0 {
+		out.PromptTokens = estimateTokens(SystemPrompt + prompt)
+	}
+	if out.CompletionTokens == 0 {
+		out.CompletionTokens = estimateTokens(out.Text)
+	}
+	return out, nil
 }
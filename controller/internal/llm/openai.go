@@ -37,17 +37,18 @@ func NewOpenAIProvider(cfg Config) *OpenAIProvider {
 func (p *OpenAIProvider) Available() bool { return p.apiKey != "" }
 func (p *OpenAIProvider) Name() string    { return "openai" }
 
-func (p *OpenAIProvider) Summarize(ctx context.Context, req SummarizeRequest) (string, error) {
+func (p *OpenAIProvider) Summarize(ctx context.Context, req SummarizeRequest) (Result, error) {
 	contextJSON, err := json.Marshal(req)
 	if err != nil {
-		return "", fmt.Errorf("marshaling context: %w", err)
+		return Result{}, fmt.Errorf("marshaling context: %w", err)
 	}
+	prompt := fmt.Sprintf("Summarize this network analysis:\n\n```json\n%s\n```", string(contextJSON))
 
 	body := map[string]any{
 		"model": p.model,
 		"messages": []map[string]string{
 			{"role": "system", "content": SystemPrompt},
-			{"role": "user", "content": fmt.Sprintf("Summarize this network analysis:\n\n```json\n%s\n```", string(contextJSON))},
+			{"role": "user", "content": prompt},
 		},
 		"max_tokens":  p.maxTokens,
 		"temperature": 0.3,
@@ -55,29 +56,29 @@ func (p *OpenAIProvider) Summarize(ctx context.Context, req SummarizeRequest) (s
 
 	bodyJSON, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("marshaling request: %w", err)
+		return Result{}, fmt.Errorf("marshaling request: %w", err)
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.apiURL+"/chat/completions", bytes.NewReader(bodyJSON))
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return Result{}, fmt.Errorf("creating request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return "", fmt.Errorf("API request: %w", err)
+		return Result{}, fmt.Errorf("API request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading response: %w", err)
+		return Result{}, fmt.Errorf("reading response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("API returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
@@ -86,14 +87,30 @@ func (p *OpenAIProvider) Summarize(ctx context.Context, req SummarizeRequest) (s
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("parsing response: %w", err)
+		return Result{}, fmt.Errorf("parsing response: %w", err)
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+		return Result{}, fmt.Errorf("no choices in response")
 	}
 
-	return result.Choices[0].Message.Content, nil
+	out := Result{
+		Text:             result.Choices[0].Message.Content,
+		Provider:         p.Name(),
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+	}
+	if out.PromptTokens == 0 {
+		out.PromptTokens = estimateTokens(SystemPrompt + prompt)
+	}
+	if out.CompletionTokens == 0 {
+		out.CompletionTokens = estimateTokens(out.Text)
+	}
+	return out, nil
 }
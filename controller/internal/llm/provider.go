@@ -6,10 +6,11 @@ package llm
 import (
 	"context"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"netwatcher-controller/internal/settings"
 )
 
 // SummarizeRequest contains the pre-processed analysis context sent to the LLM.
@@ -39,13 +40,27 @@ type IncidentSummary struct {
 	Evidence        []string `json:"evidence"`
 }
 
+// Result is a provider's summary plus the tokens it consumed.
+type Result struct {
+	Text             string
+	Provider         string
+	PromptTokens     int
+	CompletionTokens int
+	// Cached is set when the text was reused from an earlier call with
+	// the same inputs; no tokens were consumed.
+	Cached bool
+}
+
+// TotalTokens is prompt plus completion tokens.
+func (r Result) TotalTokens() int { return r.PromptTokens + r.CompletionTokens }
+
 // Provider defines the interface for LLM providers.
 // Implementations must be safe for concurrent use.
 type Provider interface {
 	// Summarize generates a natural language summary of the analysis.
-	// Returns the enriched summary text, or error if the LLM call fails.
-	// The caller should fall back to rule-based summary on error.
-	Summarize(ctx context.Context, req SummarizeRequest) (string, error)
+	// Returns the enriched summary and token usage, or error if the LLM
+	// call fails. The caller should fall back to rule-based summary on error.
+	Summarize(ctx context.Context, req SummarizeRequest) (Result, error)
 
 	// Available returns true if the provider is properly configured.
 	Available() bool
@@ -66,17 +81,18 @@ type Config struct {
 	MaxTokens    int           // Max tokens in response (default: 512)
 }
 
-// LoadConfig loads LLM configuration from environment variables
+// LoadConfig loads LLM configuration from environment variables (or their
+// runtime overrides, see internal/settings)
 func LoadConfig() Config {
 	maxTokens := 512
-	if v := os.Getenv("LLM_MAX_TOKENS"); v != "" {
+	if v := settings.Getenv("LLM_MAX_TOKENS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			maxTokens = n
 		}
 	}
 	return Config{
-		Provider:    os.Getenv("LLM_PROVIDER"),
-		APIKey:      os.Getenv("LLM_API_KEY"),
+		Provider:    settings.Getenv("LLM_PROVIDER"),
+		APIKey:      settings.Getenv("LLM_API_KEY"),
 		APIURL:      envOrDefault("LLM_API_URL", "https://api.openai.com/v1"),
 		Model:       envOrDefault("LLM_MODEL", "gpt-4o-mini"),
 		OllamaURL:   envOrDefault("OLLAMA_URL", "http://localhost:11434"),
@@ -127,22 +143,27 @@ func NewChainProvider(providers []Provider) *ChainProvider {
 	return &ChainProvider{providers: providers}
 }
 
-func (c *ChainProvider) Summarize(ctx context.Context, req SummarizeRequest) (string, error) {
+func (c *ChainProvider) Summarize(ctx context.Context, req SummarizeRequest) (Result, error) {
 	var lastErr error
+	var spent Result
 	for _, p := range c.providers {
 		if !p.Available() {
 			continue
 		}
 		result, err := p.Summarize(ctx, req)
-		if err == nil && result != "" {
+		// Tokens burned by a failed attempt still count against budgets.
+		spent.PromptTokens += result.PromptTokens
+		spent.CompletionTokens += result.CompletionTokens
+		if err == nil && result.Text != "" {
+			result.PromptTokens, result.CompletionTokens = spent.PromptTokens, spent.CompletionTokens
 			return result, nil
 		}
 		lastErr = err
 	}
 	if lastErr != nil {
-		return "", lastErr
+		return spent, lastErr
 	}
-	return "", fmt.Errorf("no available LLM provider in chain")
+	return spent, fmt.Errorf("no available LLM provider in chain")
 }
 
 func (c *ChainProvider) Available() bool {
@@ -162,8 +183,14 @@ func (c *ChainProvider) Name() string {
 	return strings.Join(names, "+")
 }
 
+// estimateTokens approximates a token count (~4 bytes per token) for
+// endpoints that don't report usage.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
 func envOrDefault(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
+	if v := settings.Getenv(key); v != "" {
 		return v
 	}
 	return fallback
@@ -0,0 +1,304 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"netwatcher-controller/internal/health"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// Enrichment queue.
+//
+// Summaries are generated off the analysis path so a slow or failing
+// provider never delays analysis. Analysis calls Enrich with the inputs'
+// cache key: a finished job's text is returned at once; otherwise a job is
+// queued and analysis keeps its rule-based message with status "pending".
+// RunQueue works the queue, retrying provider errors with backoff, and
+// hands every finished job to a callback that records it for what was
+// saved meanwhile (analysis snapshots).
+//
+// Jobs live in Postgres, one per workspace and cache key, so pending work
+// survives restarts and a finished summary is reused by every replica
+// until the workspace's incidents change. Failed or skipped jobs are
+// retried by the next analysis after jobRequeueAfter.
+
+// JobStatus is the state of an enrichment job.
+type JobStatus string
+
+const (
+	JobPending    JobStatus = "pending"
+	JobProcessing JobStatus = "processing"
+	JobDone       JobStatus = "done"
+	// JobFailed: the provider failed jobMaxAttempts times.
+	JobFailed JobStatus = "failed"
+	// JobSkipped: enrichment was disabled, the budget exhausted or no
+	// provider configured when the job ran.
+	JobSkipped JobStatus = "skipped"
+)
+
+const (
+	jobMaxAttempts   = 4
+	jobBackoff       = 30 * time.Second // doubled after every failed attempt
+	jobStaleAfter    = 5 * time.Minute  // processing jobs of a crashed worker
+	jobRequeueAfter  = 15 * time.Minute
+	jobRetention     = 7 * 24 * time.Hour
+	queuePollEvery   = 2 * time.Second
+	queuePruneEvery  = time.Hour
+	queueBatchSize   = 8
+	queueCallTimeout = 2 * time.Minute
+)
+
+// Job is one queued summary.
+type Job struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `gorm:"index" json:"updated_at"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:ux_llm_job_ws_key" json:"workspace_id"`
+	CacheKey    string    `gorm:"size:64;not null;uniqueIndex:ux_llm_job_ws_key" json:"cache_key"`
+	// Settings is the workspace's provider|model when the job was queued;
+	// a change requeues it.
+	Settings      string    `gorm:"size:192" json:"settings"`
+	Request       string    `gorm:"type:text" json:"-"` // SummarizeRequest JSON
+	Status        JobStatus `gorm:"size:16;not null;index" json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `gorm:"index" json:"next_attempt_at"`
+	LastError     string    `gorm:"type:text" json:"last_error,omitempty"`
+
+	Summary          string     `gorm:"type:text" json:"summary,omitempty"`
+	Provider         string     `gorm:"size:64" json:"provider,omitempty"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+func (Job) TableName() string { return "llm_enrichment_jobs" }
+
+// Enrich returns the summary for a workspace's inputs if one is ready, or
+// queues it. The status is JobDone with the (cached) result, JobPending
+// while it is queued or running, or JobFailed / JobSkipped when the last
+// attempt gave up. ErrDisabled is returned when the workspace has
+// enrichment off.
+func (m *Manager) Enrich(ctx context.Context, workspaceID uint, key string, req SummarizeRequest) (Result, JobStatus, error) {
+	s, err := m.Settings(ctx, workspaceID)
+	if err != nil {
+		return Result{}, "", err
+	}
+	if !s.Enabled {
+		return Result{}, "", ErrDisabled
+	}
+	settings := s.Provider + "|" + s.Model
+
+	var rows []Job
+	if err := m.db.WithContext(ctx).Where("workspace_id = ? AND cache_key = ?", workspaceID, key).
+		Limit(1).Find(&rows).Error; err != nil {
+		return Result{}, "", err
+	}
+	if len(rows) == 1 && rows[0].Settings == settings {
+		j := rows[0]
+		switch j.Status {
+		case JobDone:
+			return Result{Text: j.Summary, Provider: j.Provider, Cached: true}, JobDone, nil
+		case JobPending, JobProcessing:
+			return Result{}, JobPending, nil
+		}
+		if time.Since(j.UpdatedAt) < jobRequeueAfter {
+			return Result{}, j.Status, nil
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, "", err
+	}
+	job := Job{
+		WorkspaceID:   workspaceID,
+		CacheKey:      key,
+		Settings:      settings,
+		Request:       string(body),
+		Status:        JobPending,
+		NextAttemptAt: time.Now(),
+	}
+	// Queue it, or reset the existing row; a job already picked up by
+	// another analysis in the meantime is left alone.
+	err = m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "workspace_id"}, {Name: "cache_key"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"settings": settings, "request": job.Request, "status": JobPending,
+			"attempts": 0, "next_attempt_at": job.NextAttemptAt, "last_error": "",
+			"summary": "", "provider": "", "prompt_tokens": 0, "completion_tokens": 0,
+			"finished_at": nil, "updated_at": time.Now(),
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL:  "llm_enrichment_jobs.status NOT IN (?, ?)",
+			Vars: []any{JobPending, JobProcessing},
+		}}},
+	}).Create(&job).Error
+	if err != nil {
+		return Result{}, "", err
+	}
+	return Result{}, JobPending, nil
+}
+
+// QueueDepth is the number of jobs waiting or running.
+func (m *Manager) QueueDepth(ctx context.Context) (int64, error) {
+	var n int64
+	err := m.db.WithContext(ctx).Model(&Job{}).Where("status IN ?", []JobStatus{JobPending, JobProcessing}).Count(&n).Error
+	return n, err
+}
+
+// RunQueue works the enrichment queue until ctx ends. finished is called
+// with every job that reaches JobDone, JobFailed or JobSkipped.
+func (m *Manager) RunQueue(ctx context.Context, finished func(context.Context, Job)) {
+	health.Register("llm_queue", queuePollEvery, 0)
+	defer health.Stop("llm_queue")
+
+	poll := time.NewTicker(queuePollEvery)
+	defer poll.Stop()
+	lastPrune := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-poll.C:
+			if now.Sub(lastPrune) >= queuePruneEvery {
+				m.pruneJobs(ctx, now)
+				lastPrune = now
+			}
+			if m.Available() {
+				m.processQueue(ctx, finished)
+			} else {
+				m.skipQueue(ctx, finished)
+			}
+			health.Beat("llm_queue")
+		}
+	}
+}
+
+// processQueue runs the jobs that are due, oldest first.
+func (m *Manager) processQueue(ctx context.Context, finished func(context.Context, Job)) {
+	now := time.Now()
+	db := m.db.WithContext(ctx)
+	// Jobs left processing by a worker that died go back to pending.
+	db.Model(&Job{}).Where("status = ? AND updated_at < ?", JobProcessing, now.Add(-jobStaleAfter)).
+		Updates(map[string]any{"status": JobPending, "updated_at": now})
+
+	var due []Job
+	if err := db.Where("status = ? AND next_attempt_at <= ?", JobPending, now).
+		Order("id").Limit(queueBatchSize).Find(&due).Error; err != nil {
+		log.WithError(err).Warn("[llm] failed to read enrichment queue")
+		return
+	}
+	for _, j := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		// Claim it; another replica may have been first.
+		res := db.Model(&Job{}).Where("id = ? AND status = ?", j.ID, JobPending).
+			Updates(map[string]any{"status": JobProcessing, "updated_at": time.Now()})
+		if res.Error != nil || res.RowsAffected != 1 {
+			continue
+		}
+		j = m.runJob(ctx, j)
+		if j.Status != JobPending && finished != nil {
+			finished(ctx, j)
+		}
+	}
+}
+
+// skipQueue finishes the waiting jobs as skipped while no provider is
+// configured, so what was saved meanwhile is not left pending. The next
+// analysis after jobRequeueAfter queues them again.
+func (m *Manager) skipQueue(ctx context.Context, finished func(context.Context, Job)) {
+	db := m.db.WithContext(ctx)
+	var due []Job
+	if err := db.Where("status = ?", JobPending).Order("id").Limit(queueBatchSize).Find(&due).Error; err != nil {
+		log.WithError(err).Warn("[llm] failed to read enrichment queue")
+		return
+	}
+	for _, j := range due {
+		now := time.Now()
+		res := db.Model(&Job{}).Where("id = ? AND status = ?", j.ID, JobPending).Updates(map[string]any{
+			"status": JobSkipped, "last_error": ErrNoProvider.Error(), "finished_at": now, "updated_at": now,
+		})
+		if res.Error != nil || res.RowsAffected != 1 {
+			continue
+		}
+		j.Status, j.LastError, j.FinishedAt = JobSkipped, ErrNoProvider.Error(), &now
+		if finished != nil {
+			finished(ctx, j)
+		}
+	}
+}
+
+// runJob calls the provider for one claimed job and stores the outcome.
+func (m *Manager) runJob(ctx context.Context, j Job) Job {
+	var req SummarizeRequest
+	err := json.Unmarshal([]byte(j.Request), &req)
+	var res Result
+	if err == nil {
+		callCtx, cancel := context.WithTimeout(ctx, queueCallTimeout)
+		res, err = m.SummarizeCached(callCtx, j.WorkspaceID, j.CacheKey, req)
+		cancel()
+	}
+	if ctx.Err() != nil {
+		// Shutting down: leave it for the next start.
+		m.db.Model(&Job{}).Where("id = ?", j.ID).Updates(map[string]any{"status": JobPending, "updated_at": time.Now()})
+		j.Status = JobPending
+		return j
+	}
+
+	now := time.Now()
+	j.Attempts++
+	j.LastError = ""
+	switch {
+	case err == nil && res.Text != "":
+		j.Status, j.Summary, j.Provider = JobDone, res.Text, res.Provider
+		j.PromptTokens, j.CompletionTokens = res.PromptTokens, res.CompletionTokens
+		j.FinishedAt = &now
+	case errors.Is(err, ErrDisabled) || errors.Is(err, ErrBudgetExceeded):
+		j.Status, j.LastError, j.FinishedAt = JobSkipped, err.Error(), &now
+	default:
+		if err == nil {
+			err = errors.New("empty summary")
+		}
+		j.LastError = err.Error()
+		if j.Attempts >= jobMaxAttempts {
+			j.Status, j.FinishedAt = JobFailed, &now
+		} else {
+			j.Status = JobPending
+			j.NextAttemptAt = now.Add(jobBackoff << (j.Attempts - 1))
+		}
+		log.WithError(err).WithField("workspace_id", j.WorkspaceID).
+			Warnf("[llm] enrichment attempt %d/%d failed", j.Attempts, jobMaxAttempts)
+	}
+
+	if err := m.db.Model(&Job{}).Where("id = ?", j.ID).Updates(map[string]any{
+		"status":            j.Status,
+		"attempts":          j.Attempts,
+		"next_attempt_at":   j.NextAttemptAt,
+		"last_error":        j.LastError,
+		"summary":           j.Summary,
+		"provider":          j.Provider,
+		"prompt_tokens":     j.PromptTokens,
+		"completion_tokens": j.CompletionTokens,
+		"finished_at":       j.FinishedAt,
+		"updated_at":        now,
+	}).Error; err != nil {
+		log.WithError(err).WithField("workspace_id", j.WorkspaceID).Warn("[llm] failed to store enrichment result")
+	}
+	return j
+}
+
+// pruneJobs drops finished jobs untouched for jobRetention.
+func (m *Manager) pruneJobs(ctx context.Context, now time.Time) {
+	err := m.db.WithContext(ctx).Where("status IN ? AND updated_at < ?",
+		[]JobStatus{JobDone, JobFailed, JobSkipped}, now.Add(-jobRetention)).Delete(&Job{}).Error
+	if err != nil {
+		log.WithError(err).Warn("[llm] failed to prune enrichment jobs")
+	}
+}
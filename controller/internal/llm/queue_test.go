@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type fakeProvider struct {
+	err   error
+	calls int
+}
+
+func (f *fakeProvider) Summarize(context.Context, SummarizeRequest) (Result, error) {
+	f.calls++
+	if f.err != nil {
+		return Result{}, f.err
+	}
+	return Result{Text: "Upstream loss at the ISP.", Provider: "fake", PromptTokens: 50, CompletionTokens: 10}, nil
+}
+func (f *fakeProvider) Available() bool { return true }
+func (f *fakeProvider) Name() string    { return "fake" }
+
+func newQueueTestManager(t *testing.T, p Provider) *Manager {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&WorkspaceSettings{}, &Usage{}, &Job{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	m := NewManager(db, Config{Provider: "fake"})
+	m.providers["|"] = p
+	return m
+}
+
+func TestEnrichmentQueue(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeProvider{err: errors.New("503 from provider")}
+	m := newQueueTestManager(t, p)
+	req := SummarizeRequest{Status: "degraded"}
+
+	if _, st, err := m.Enrich(ctx, 1, "abc", req); err != nil || st != JobPending {
+		t.Fatalf("first Enrich = %q, %v; want pending", st, err)
+	}
+	// A second analysis with the same inputs does not queue again.
+	if _, st, _ := m.Enrich(ctx, 1, "abc", req); st != JobPending {
+		t.Fatalf("second Enrich = %q", st)
+	}
+
+	var finished []Job
+	done := func(_ context.Context, j Job) { finished = append(finished, j) }
+
+	m.processQueue(ctx, done)
+	var j Job
+	m.db.First(&j)
+	if p.calls != 1 || j.Status != JobPending || j.Attempts != 1 || !j.NextAttemptAt.After(time.Now()) || len(finished) != 0 {
+		t.Fatalf("after provider error: calls=%d job=%+v", p.calls, j)
+	}
+
+	// Backoff holds the retry back until it is due.
+	m.processQueue(ctx, done)
+	if p.calls != 1 {
+		t.Fatalf("retried before backoff elapsed")
+	}
+	m.db.Model(&Job{}).Where("id = ?", j.ID).Update("next_attempt_at", time.Now().Add(-time.Second))
+	p.err = nil
+	m.processQueue(ctx, done)
+	if len(finished) != 1 || finished[0].Status != JobDone || finished[0].PromptTokens != 50 {
+		t.Fatalf("finished = %+v", finished)
+	}
+
+	res, st, err := m.Enrich(ctx, 1, "abc", req)
+	if err != nil || st != JobDone || res.Text != "Upstream loss at the ISP." || !res.Cached {
+		t.Fatalf("Enrich after done = %+v, %q, %v", res, st, err)
+	}
+	if u, _ := m.usage(ctx, 1, time.Now().UTC().Format("2006-01")); u.TotalTokens() != 60 {
+		t.Errorf("usage = %d tokens, want 60", u.TotalTokens())
+	}
+}
+
+func TestEnrichmentQueueGivesUp(t *testing.T) {
+	ctx := context.Background()
+	p := &fakeProvider{err: errors.New("timeout")}
+	m := newQueueTestManager(t, p)
+	if _, _, err := m.Enrich(ctx, 2, "k", SummarizeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	var finished []Job
+	for i := 0; i < jobMaxAttempts; i++ {
+		m.db.Model(&Job{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+		m.processQueue(ctx, func(_ context.Context, j Job) { finished = append(finished, j) })
+	}
+	if p.calls != jobMaxAttempts || len(finished) != 1 || finished[0].Status != JobFailed {
+		t.Fatalf("calls=%d finished=%+v", p.calls, finished)
+	}
+	if _, st, _ := m.Enrich(ctx, 2, "k", SummarizeRequest{}); st != JobFailed {
+		t.Errorf("Enrich after giving up = %q, want failed until requeue", st)
+	}
+}
+
+func TestEnrichmentQueueSkipsWithoutProvider(t *testing.T) {
+	ctx := context.Background()
+	m := newQueueTestManager(t, &fakeProvider{})
+	if _, _, err := m.Enrich(ctx, 3, "k", SummarizeRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	var finished []Job
+	m.skipQueue(ctx, func(_ context.Context, j Job) { finished = append(finished, j) })
+	if len(finished) != 1 || finished[0].Status != JobSkipped || finished[0].LastError != ErrNoProvider.Error() {
+		t.Fatalf("finished = %+v", finished)
+	}
+	if _, st, _ := m.Enrich(ctx, 3, "k", SummarizeRequest{}); st != JobSkipped {
+		t.Errorf("Enrich after skip = %q, want skipped until requeue", st)
+	}
+	if n, _ := m.QueueDepth(ctx); n != 0 {
+		t.Errorf("queue depth = %d, want 0", n)
+	}
+}
@@ -0,0 +1,414 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"netwatcher-controller/internal/settings"
+)
+
+// Per-workspace LLM settings and usage accounting.
+//
+// The deployment configures which providers exist (LLM_PROVIDER and
+// credentials). Each workspace can turn enrichment off, pick one of the
+// deployment's providers and override the model. Token usage is recorded
+// per workspace per calendar month (UTC) and enforced against a monthly
+// budget so one tenant can't exhaust the deployment's quota.
+//
+// Budgets: LLM_WORKSPACE_MONTHLY_TOKENS is the default for every workspace
+// (0 = unlimited). Site admins can override it per workspace; -1 there
+// means unlimited. The check happens before each call, so a workspace can
+// overshoot by at most one summary.
+
+var (
+	ErrDisabled       = errors.New("LLM enrichment disabled for workspace")
+	ErrBudgetExceeded = errors.New("workspace monthly LLM token budget exhausted")
+	ErrBadSettings    = errors.New("invalid LLM settings")
+	ErrNoProvider     = errors.New("no LLM provider configured")
+)
+
+// WorkspaceSettings is a workspace's LLM configuration. A workspace with no
+// row follows the deployment defaults with enrichment enabled.
+type WorkspaceSettings struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex" json:"workspace_id"`
+	Enabled     bool      `json:"enabled"`
+	// Provider is one of the deployment's providers; "" uses LLM_PROVIDER.
+	Provider string `gorm:"size:32" json:"provider"`
+	// Model overrides LLM_MODEL / OLLAMA_MODEL for the chosen provider.
+	Model string `gorm:"size:128" json:"model"`
+	// MonthlyTokenBudget is set by site admins: 0 = deployment default,
+	// -1 = unlimited.
+	MonthlyTokenBudget int64 `json:"monthly_token_budget"`
+	UpdatedBy          uint  `json:"updated_by"`
+}
+
+func (WorkspaceSettings) TableName() string { return "workspace_llm_settings" }
+
+// Usage is one workspace's token consumption for one month.
+type Usage struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	WorkspaceID      uint      `gorm:"not null;uniqueIndex:ux_llm_usage_ws_month" json:"workspace_id"`
+	Month            string    `gorm:"size:7;not null;uniqueIndex:ux_llm_usage_ws_month" json:"month"` // YYYY-MM (UTC)
+	Requests         int64     `json:"requests"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	// Rejected counts calls skipped because the budget was exhausted.
+	Rejected int64 `json:"rejected"`
+}
+
+func (Usage) TableName() string { return "llm_usage" }
+
+// TotalTokens is prompt plus completion tokens.
+func (u Usage) TotalTokens() int64 { return u.PromptTokens + u.CompletionTokens }
+
+// SettingsInput is a partial update from a workspace admin.
+type SettingsInput struct {
+	Enabled  *bool   `json:"enabled"`
+	Provider *string `json:"provider"`
+	Model    *string `json:"model"`
+}
+
+// WorkspaceStatus is the settings, effective budget and usage for a workspace.
+type WorkspaceStatus struct {
+	Settings           WorkspaceSettings `json:"settings"`
+	AvailableProviders []string          `json:"available_providers"`
+	// MonthlyTokenBudget is the effective budget; 0 = unlimited.
+	MonthlyTokenBudget int64   `json:"monthly_token_budget"`
+	CurrentMonth       Usage   `json:"current_month"`
+	RemainingTokens    *int64  `json:"remaining_tokens,omitempty"`
+	History            []Usage `json:"history"`
+}
+
+// Manager resolves per-workspace providers and enforces budgets. It is
+// safe for concurrent use.
+type Manager struct {
+	db            *gorm.DB
+	cfg           Config
+	defaultBudget int64
+
+	mu        sync.Mutex
+	providers map[string]Provider // by provider+model
+
+	cacheMu sync.Mutex
+	cache   map[uint]cachedSummary // last summary per workspace
+}
+
+// cachedSummary is the last summary generated for a workspace, with the
+// inputs it was generated from.
+type cachedSummary struct {
+	key      string // caller's hash of the summarized inputs
+	settings string // provider|model in effect
+	result   Result
+}
+
+var (
+	managersMu sync.Mutex
+	managers   []*Manager
+)
+
+// NewManager returns a manager for the deployment configuration.
+func NewManager(db *gorm.DB, cfg Config) *Manager {
+	m := &Manager{db: db, cfg: cfg, defaultBudget: loadDefaultBudget(), providers: make(map[string]Provider), cache: make(map[uint]cachedSummary)}
+	managersMu.Lock()
+	managers = append(managers, m)
+	managersMu.Unlock()
+	return m
+}
+
+func loadDefaultBudget() int64 {
+	if n, err := strconv.ParseInt(strings.TrimSpace(settings.Getenv("LLM_WORKSPACE_MONTHLY_TOKENS")), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// Reconfigure replaces the deployment configuration and re-reads the
+// default budget. Providers are rebuilt on next use; cached summaries stay
+// valid until the workspace's inputs change.
+func (m *Manager) Reconfigure(cfg Config) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.defaultBudget = loadDefaultBudget()
+	m.providers = make(map[string]Provider)
+	m.mu.Unlock()
+}
+
+// ReconfigureAll applies cfg to every manager created by NewManager.
+func ReconfigureAll(cfg Config) {
+	managersMu.Lock()
+	all := append([]*Manager(nil), managers...)
+	managersMu.Unlock()
+	for _, m := range all {
+		m.Reconfigure(cfg)
+	}
+	log.WithField("provider", cfg.Provider).Info("[llm] configuration reloaded")
+}
+
+// Available reports whether the deployment has any provider configured.
+func (m *Manager) Available() bool {
+	p := m.provider("", "")
+	return p != nil && p.Available()
+}
+
+// AvailableProviders lists the providers a workspace may choose.
+func (m *Manager) AvailableProviders() []string {
+	m.mu.Lock()
+	provider := m.cfg.Provider
+	m.mu.Unlock()
+	switch provider {
+	case "openai", "ollama":
+		return []string{provider}
+	case "openai+ollama", "openai,ollama":
+		return []string{"openai", "ollama"}
+	}
+	return []string{}
+}
+
+// Summarize runs a summary for a workspace using its settings, records
+// token usage and enforces its monthly budget.
+func (m *Manager) Summarize(ctx context.Context, workspaceID uint, req SummarizeRequest) (Result, error) {
+	return m.SummarizeCached(ctx, workspaceID, "", req)
+}
+
+// SummarizeCached is Summarize with reuse: when key matches the key of the
+// workspace's last summary (and its provider settings are unchanged) the
+// cached text is returned with Cached set and no tokens are spent. An
+// empty key always calls the provider. The cache is in memory, so the
+// first analysis after a restart regenerates the summary.
+func (m *Manager) SummarizeCached(ctx context.Context, workspaceID uint, key string, req SummarizeRequest) (Result, error) {
+	s, err := m.Settings(ctx, workspaceID)
+	if err != nil {
+		return Result{}, err
+	}
+	if !s.Enabled {
+		return Result{}, ErrDisabled
+	}
+	settings := s.Provider + "|" + s.Model
+	if key != "" {
+		m.cacheMu.Lock()
+		c, ok := m.cache[workspaceID]
+		m.cacheMu.Unlock()
+		if ok && c.key == key && c.settings == settings {
+			return Result{Text: c.result.Text, Provider: c.result.Provider, Cached: true}, nil
+		}
+	}
+
+	month := time.Now().UTC().Format("2006-01")
+	if budget := m.effectiveBudget(s); budget > 0 {
+		used, err := m.usage(ctx, workspaceID, month)
+		if err != nil {
+			return Result{}, err
+		}
+		if used.TotalTokens() >= budget {
+			m.record(ctx, workspaceID, month, Usage{Rejected: 1})
+			return Result{}, ErrBudgetExceeded
+		}
+	}
+
+	p := m.provider(s.Provider, s.Model)
+	if p == nil || !p.Available() {
+		return Result{}, fmt.Errorf("LLM provider %q not available", s.Provider)
+	}
+	res, err := p.Summarize(ctx, req)
+	if res.TotalTokens() > 0 {
+		m.record(ctx, workspaceID, month, Usage{
+			Requests:         1,
+			PromptTokens:     int64(res.PromptTokens),
+			CompletionTokens: int64(res.CompletionTokens),
+		})
+	}
+	if err != nil {
+		return res, err
+	}
+	if key != "" && res.Text != "" {
+		m.cacheMu.Lock()
+		m.cache[workspaceID] = cachedSummary{key: key, settings: settings, result: res}
+		m.cacheMu.Unlock()
+	}
+	return res, nil
+}
+
+// Settings returns a workspace's settings, or the defaults if unset.
+func (m *Manager) Settings(ctx context.Context, workspaceID uint) (WorkspaceSettings, error) {
+	var rows []WorkspaceSettings
+	if err := m.db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Limit(1).Find(&rows).Error; err != nil {
+		return WorkspaceSettings{}, err
+	}
+	if len(rows) == 0 {
+		return WorkspaceSettings{WorkspaceID: workspaceID, Enabled: true}, nil
+	}
+	return rows[0], nil
+}
+
+// UpdateSettings applies a workspace admin's changes.
+func (m *Manager) UpdateSettings(ctx context.Context, workspaceID uint, in SettingsInput, userID uint) (WorkspaceSettings, error) {
+	s, err := m.Settings(ctx, workspaceID)
+	if err != nil {
+		return s, err
+	}
+	if in.Enabled != nil {
+		s.Enabled = *in.Enabled
+	}
+	if in.Provider != nil {
+		s.Provider = strings.ToLower(strings.TrimSpace(*in.Provider))
+	}
+	if in.Model != nil {
+		s.Model = strings.TrimSpace(*in.Model)
+	}
+	if err := m.validate(s); err != nil {
+		return s, err
+	}
+	s.UpdatedBy = userID
+	return s, m.save(ctx, &s, "enabled", "provider", "model", "updated_by", "updated_at")
+}
+
+// SetBudget sets a workspace's monthly token budget (site admins only).
+// 0 restores the deployment default; -1 means unlimited.
+func (m *Manager) SetBudget(ctx context.Context, workspaceID uint, budget int64, userID uint) (WorkspaceSettings, error) {
+	if budget < -1 {
+		return WorkspaceSettings{}, fmt.Errorf("%w: monthly_token_budget must be -1, 0 or positive", ErrBadSettings)
+	}
+	s, err := m.Settings(ctx, workspaceID)
+	if err != nil {
+		return s, err
+	}
+	s.MonthlyTokenBudget = budget
+	s.UpdatedBy = userID
+	return s, m.save(ctx, &s, "monthly_token_budget", "updated_by", "updated_at")
+}
+
+// Status returns settings, effective budget and the last 12 months of usage.
+func (m *Manager) Status(ctx context.Context, workspaceID uint) (*WorkspaceStatus, error) {
+	s, err := m.Settings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	month := time.Now().UTC().Format("2006-01")
+	var history []Usage
+	if err := m.db.WithContext(ctx).Where("workspace_id = ?", workspaceID).
+		Order("month DESC").Limit(12).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	st := &WorkspaceStatus{
+		Settings:           s,
+		AvailableProviders: m.AvailableProviders(),
+		MonthlyTokenBudget: m.effectiveBudget(s),
+		CurrentMonth:       Usage{WorkspaceID: workspaceID, Month: month},
+		History:            history,
+	}
+	if len(history) > 0 && history[0].Month == month {
+		st.CurrentMonth = history[0]
+	}
+	if st.MonthlyTokenBudget > 0 {
+		rem := st.MonthlyTokenBudget - st.CurrentMonth.TotalTokens()
+		if rem < 0 {
+			rem = 0
+		}
+		st.RemainingTokens = &rem
+	}
+	return st, nil
+}
+
+func (m *Manager) effectiveBudget(s WorkspaceSettings) int64 {
+	switch {
+	case s.MonthlyTokenBudget > 0:
+		return s.MonthlyTokenBudget
+	case s.MonthlyTokenBudget < 0:
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.defaultBudget
+}
+
+func (m *Manager) validate(s WorkspaceSettings) error {
+	if s.Provider != "" {
+		ok := false
+		for _, p := range m.AvailableProviders() {
+			ok = ok || p == s.Provider
+		}
+		if !ok {
+			return fmt.Errorf("%w: provider %q is not configured on this deployment", ErrBadSettings, s.Provider)
+		}
+	}
+	if s.Model != "" && s.Provider == "" && len(m.AvailableProviders()) > 1 {
+		return fmt.Errorf("%w: choose a provider when overriding the model", ErrBadSettings)
+	}
+	if len(s.Model) > 128 {
+		return fmt.Errorf("%w: model name too long", ErrBadSettings)
+	}
+	return nil
+}
+
+func (m *Manager) save(ctx context.Context, s *WorkspaceSettings, cols ...string) error {
+	if s.ID != 0 {
+		return m.db.WithContext(ctx).Model(s).Select(cols).Updates(s).Error
+	}
+	return m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}},
+		DoUpdates: clause.AssignmentColumns(cols),
+	}).Create(s).Error
+}
+
+func (m *Manager) usage(ctx context.Context, workspaceID uint, month string) (Usage, error) {
+	var u Usage
+	err := m.db.WithContext(ctx).Where("workspace_id = ? AND month = ?", workspaceID, month).Limit(1).Find(&u).Error
+	return u, err
+}
+
+// record adds delta to a workspace's monthly usage row.
+func (m *Manager) record(ctx context.Context, workspaceID uint, month string, delta Usage) {
+	row := delta
+	row.WorkspaceID, row.Month = workspaceID, month
+	err := m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "workspace_id"}, {Name: "month"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"requests":          gorm.Expr("llm_usage.requests + ?", delta.Requests),
+			"prompt_tokens":     gorm.Expr("llm_usage.prompt_tokens + ?", delta.PromptTokens),
+			"completion_tokens": gorm.Expr("llm_usage.completion_tokens + ?", delta.CompletionTokens),
+			"rejected":          gorm.Expr("llm_usage.rejected + ?", delta.Rejected),
+			"updated_at":        time.Now(),
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		log.WithError(err).WithField("workspace_id", workspaceID).Warn("[llm] failed to record usage")
+	}
+}
+
+// provider returns a cached provider for a workspace's choice.
+func (m *Manager) provider(name, model string) Provider {
+	key := name + "|" + model
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.providers[key]; ok {
+		return p
+	}
+	cfg := m.cfg
+	if name != "" {
+		cfg.Provider = name
+	}
+	if model != "" {
+		switch cfg.Provider {
+		case "ollama":
+			cfg.OllamaModel = model
+		default:
+			cfg.Model = model
+		}
+	}
+	p := NewProvider(cfg)
+	m.providers[key] = p
+	return p
+}
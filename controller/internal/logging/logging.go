@@ -0,0 +1,193 @@
+// Package logging gives each controller subsystem its own logrus level,
+// adjustable at runtime, on top of the global logger.
+//
+// Packages take an entry once and log through it:
+//
+//	var mapLog = logging.For(logging.Map)
+//	mapLog.WithField(logging.FieldWorkspace, wsID).Debug("built network map")
+//
+// Each subsystem has its own *logrus.Logger sharing the global logger's
+// output, formatter and hooks, so a level change affects only that
+// subsystem. Levels start from LOG_LEVEL and LOG_LEVELS and can be changed
+// through SetLevel (the admin log-levels endpoint). Untagged log.* calls
+// keep using the global logger, whose level is the "default" entry.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Subsystems with their own level.
+const (
+	Analysis = "analysis" // analysis loop, incident detection, LLM summaries
+	Ingest   = "ingest"   // probe results from agents and their handlers
+	Web      = "web"      // HTTP API and WebSocket connections
+	Map      = "map"      // network map building
+)
+
+// Default names the global logger in Levels and SetLevel.
+const Default = "default"
+
+// Standard structured field names. Use these instead of ad-hoc keys so
+// log queries work across packages.
+const (
+	FieldSubsystem = "subsystem"
+	FieldWorkspace = "workspace_id"
+	FieldAgent     = "agent_id"
+	FieldProbe     = "probe_id"
+	FieldType      = "probe_type"
+	FieldTarget    = "target"
+	FieldRequest   = "request_id"
+	FieldUser      = "user_id"
+	FieldDuration  = "duration_ms"
+)
+
+var subsystems = []string{Analysis, Ingest, Web, Map}
+
+var (
+	mu      sync.Mutex
+	loggers = map[string]*log.Logger{}
+	hooks   []log.Hook // added through AddHook
+	out     = &syncWriter{w: os.Stderr}
+)
+
+// syncWriter serializes writes from the global and subsystem loggers,
+// which each hold their own lock.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// Subsystems returns the subsystem names.
+func Subsystems() []string { return append([]string(nil), subsystems...) }
+
+func validSubsystem(name string) bool {
+	for _, s := range subsystems {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// logger returns the subsystem's logger, creating it from the global
+// logger's settings on first use.
+func logger(name string) *log.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	std := log.StandardLogger()
+	l := log.New()
+	l.SetOutput(out)
+	l.SetFormatter(std.Formatter)
+	l.SetLevel(std.GetLevel())
+	l.SetReportCaller(std.ReportCaller)
+	l.ExitFunc = std.ExitFunc
+	for _, h := range hooks {
+		l.AddHook(h)
+	}
+	loggers[name] = l
+	return l
+}
+
+// For returns the log entry for a subsystem, tagged with its name. Unknown
+// names log through the global logger.
+func For(name string) *log.Entry {
+	if !validSubsystem(name) {
+		return log.WithField(FieldSubsystem, name)
+	}
+	return logger(name).WithField(FieldSubsystem, name)
+}
+
+// Configure applies LOG_LEVEL (or DEBUG=true), LOG_LEVELS
+// ("analysis=debug,web=warn") and LOG_FORMAT ("json" or "text"). Call it
+// once at startup, before other goroutines log.
+func Configure() {
+	std := log.StandardLogger()
+	std.SetOutput(out)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		std.SetFormatter(&log.JSONFormatter{})
+	}
+
+	level := strings.TrimSpace(os.Getenv("LOG_LEVEL"))
+	if level == "" && os.Getenv("DEBUG") == "true" {
+		level = "debug"
+	}
+	if level != "" {
+		if err := SetLevel(Default, level); err != nil {
+			log.Warnf("LOG_LEVEL: %v", err)
+		}
+	}
+
+	mu.Lock()
+	for _, l := range loggers {
+		l.SetFormatter(std.Formatter)
+		l.SetLevel(std.GetLevel())
+	}
+	mu.Unlock()
+
+	for _, pair := range strings.Split(os.Getenv("LOG_LEVELS"), ",") {
+		name, lvl, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if err := SetLevel(strings.TrimSpace(name), strings.TrimSpace(lvl)); err != nil {
+			log.Warnf("LOG_LEVELS: %v", err)
+		}
+	}
+}
+
+// SetLevel changes a subsystem's level, or the global one for Default.
+// Safe to call while other goroutines log.
+func SetLevel(name, level string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("%s: invalid level %q", name, level)
+	}
+	if name == Default {
+		log.SetLevel(lvl)
+		return nil
+	}
+	if !validSubsystem(name) {
+		return fmt.Errorf("unknown subsystem %q (want %s or %s)", name, Default, strings.Join(subsystems, ", "))
+	}
+	logger(name).SetLevel(lvl)
+	return nil
+}
+
+// Levels returns the current level of the global logger and every
+// subsystem.
+func Levels() map[string]string {
+	levels := map[string]string{Default: log.GetLevel().String()}
+	for _, name := range subsystems {
+		levels[name] = logger(name).GetLevel().String()
+	}
+	return levels
+}
+
+// AddHook adds a hook to the global logger and every subsystem logger,
+// including ones created later. Hooks added with log.AddHook directly
+// only see untagged logs.
+func AddHook(h log.Hook) {
+	log.AddHook(h)
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, h)
+	for _, l := range loggers {
+		l.AddHook(h)
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestSubsystemLevels verifies a subsystem's level is independent of the
+// global logger and of other subsystems.
+func TestSubsystemLevels(t *testing.T) {
+	var buf bytes.Buffer
+	prev := out.w
+	out.w = &buf
+	defer func() { out.w = prev }()
+	defer func(l log.Level) { log.SetLevel(l) }(log.GetLevel())
+
+	mapLog := For(Map)
+	webLog := For(Web)
+	if err := SetLevel(Default, "info"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel(Map, "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel(Web, "warn"); err != nil {
+		t.Fatal(err)
+	}
+
+	mapLog.WithField(FieldAgent, 7).Debug("map detail")
+	webLog.Info("web noise")
+	webLog.Warn("web warning")
+
+	got := buf.String()
+	if !strings.Contains(got, "map detail") || !strings.Contains(got, "subsystem=map") || !strings.Contains(got, "agent_id=7") {
+		t.Errorf("map debug line missing: %q", got)
+	}
+	if strings.Contains(got, "web noise") || !strings.Contains(got, "web warning") {
+		t.Errorf("web level not applied: %q", got)
+	}
+
+	lv := Levels()
+	if lv[Default] != "info" || lv[Map] != "debug" || lv[Web] != "warning" {
+		t.Errorf("levels = %v", lv)
+	}
+	if err := SetLevel("storage", "debug"); err == nil {
+		t.Error("unknown subsystem should be rejected")
+	}
+	if err := SetLevel(Map, "loud"); err == nil {
+		t.Error("unknown level should be rejected")
+	}
+}
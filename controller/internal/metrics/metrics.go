@@ -19,6 +19,15 @@ type Metrics struct {
 	WorkspaceCount prometheus.Gauge
 	ProbeDataTotal *prometheus.CounterVec
 	HTTPRequestDur *prometheus.HistogramVec
+
+	UnknownPayloadVersion *prometheus.CounterVec
+	IngestThrottled       prometheus.Counter
+
+	JanitorDeleted *prometheus.CounterVec
+	JanitorLastRun prometheus.Gauge
+
+	ClickHouseDiskUsedPct *prometheus.GaugeVec
+	ClickHouseMaxParts    *prometheus.GaugeVec
 }
 
 var (
@@ -77,6 +86,48 @@ func New(db *gorm.DB, ch *sql.DB) *Metrics {
 				Help:      "HTTP request duration in seconds",
 				Buckets:   prometheus.DefBuckets,
 			}, []string{"method", "path", "status"}),
+
+			UnknownPayloadVersion: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "netwatcher",
+				Subsystem: "probe_data",
+				Name:      "unknown_payload_version_total",
+				Help:      "Probe payloads skipped because their format version has no registered parser",
+			}, []string{"type", "version"}),
+
+			IngestThrottled: promauto.NewCounter(prometheus.CounterOpts{
+				Namespace: "netwatcher",
+				Subsystem: "probe_data",
+				Name:      "throttled_total",
+				Help:      "Probe results rejected by the per-agent ingest rate limit",
+			}),
+
+			JanitorDeleted: promauto.NewCounterVec(prometheus.CounterOpts{
+				Namespace: "netwatcher",
+				Subsystem: "janitor",
+				Name:      "deleted_total",
+				Help:      "Expired rows removed by the janitor, by table",
+			}, []string{"table"}),
+
+			JanitorLastRun: promauto.NewGauge(prometheus.GaugeOpts{
+				Namespace: "netwatcher",
+				Subsystem: "janitor",
+				Name:      "last_run_unix",
+				Help:      "Unix time of the last janitor run",
+			}),
+
+			ClickHouseDiskUsedPct: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Namespace: "netwatcher",
+				Subsystem: "clickhouse",
+				Name:      "disk_used_percent",
+				Help:      "Used space on each ClickHouse disk, in percent",
+			}, []string{"disk"}),
+
+			ClickHouseMaxParts: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Namespace: "netwatcher",
+				Subsystem: "clickhouse",
+				Name:      "max_parts_per_partition",
+				Help:      "Most active parts in any one partition, by table",
+			}, []string{"table"}),
 		}
 	})
 	return global
@@ -0,0 +1,159 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"netwatcher-controller/internal/agent"
+
+	"gorm.io/gorm"
+)
+
+// -------------------- Agent Config Compatibility --------------------
+//
+// Probe config is filtered per agent at delivery (probe_get) using what the
+// agent announced at connect (agent.Negotiation). Probe types the agent
+// doesn't list are withheld; optional fields it doesn't list are cleared
+// and the probe is sent without them. Each adjustment yields a
+// DeliveryWarning, logged at delivery and served by the compatibility
+// endpoint so the panel can explain why a probe isn't running.
+
+// legacyProbeTypes are the probe types agents handled before negotiation
+// existed; agents that never negotiated receive only these. Do not add
+// new types here — agents must announce them.
+var legacyProbeTypes = map[Type]bool{
+	TypeRPerf: true, TypeMTR: true, TypePing: true, TypeNetInfo: true, TypeSysInfo: true,
+	TypeSpeedtest: true, TypeSpeedtestServer: true, TypeAgent: true, TypeTrafficSim: true,
+	TypeDNS: true, TypeHTTP: true, TypeTLS: true, TypeSNMP: true, TypePMTU: true,
+}
+
+// legacyConfigFeatures are the optional fields pre-negotiation agents
+// already understood.
+var legacyConfigFeatures = map[string]bool{
+	agent.FeatureDSCP:          true,
+	agent.FeatureBindInterface: true,
+}
+
+// configField is an optional probe field gated by an agent feature.
+type configField struct {
+	feature string
+	used    func(p *Probe) bool
+	clear   func(p *Probe)
+}
+
+var configFields = []configField{
+	{agent.FeatureDSCP, func(p *Probe) bool { return p.DSCP != 0 }, func(p *Probe) { p.DSCP = 0 }},
+	{agent.FeatureBindInterface, func(p *Probe) bool { return p.BindInterface != "" }, func(p *Probe) { p.BindInterface = "" }},
+}
+
+// DeliveryWarning explains a probe that was withheld from an agent or
+// delivered without one of its fields.
+type DeliveryWarning struct {
+	ProbeID  uint   `json:"probe_id"`
+	Type     Type   `json:"type"`
+	Field    string `json:"field,omitempty"` // set when only a field was dropped
+	Withheld bool   `json:"withheld"`        // true when the whole probe was not delivered
+	Reason   string `json:"reason"`
+}
+
+func agentSupportsType(a *agent.Agent, t Type) bool {
+	if a == nil || !a.Negotiated() {
+		return legacyProbeTypes[t]
+	}
+	for _, s := range a.SupportedProbeTypes() {
+		if Type(s) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func agentSupportsFeature(a *agent.Agent, feature string) bool {
+	if a == nil || !a.Negotiated() {
+		return legacyConfigFeatures[feature]
+	}
+	for _, f := range a.SupportedConfigFeatures() {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterForAgent returns the probes agent a can be sent, with unsupported
+// fields cleared, and a warning per adjustment. The input is not modified.
+func FilterForAgent(a *agent.Agent, probes []Probe) ([]Probe, []DeliveryWarning) {
+	out := make([]Probe, 0, len(probes))
+	var warnings []DeliveryWarning
+	for _, p := range probes {
+		if !agentSupportsType(a, p.Type) {
+			reason := fmt.Sprintf("agent build does not support %s probes", p.Type)
+			if a == nil || !a.Negotiated() {
+				reason = fmt.Sprintf("%s probes need an agent that announces support; this agent predates config negotiation", p.Type)
+			}
+			warnings = append(warnings, DeliveryWarning{ProbeID: p.ID, Type: p.Type, Withheld: true, Reason: reason})
+			continue
+		}
+		for _, f := range configFields {
+			if f.used(&p) && !agentSupportsFeature(a, f.feature) {
+				f.clear(&p)
+				warnings = append(warnings, DeliveryWarning{
+					ProbeID: p.ID, Type: p.Type, Field: f.feature,
+					Reason: fmt.Sprintf("agent build does not support %s; probe sent without it", f.feature),
+				})
+			}
+		}
+		out = append(out, p)
+	}
+	return out, warnings
+}
+
+// AgentCompat is an agent's negotiated config protocol and the probes it
+// cannot fully receive.
+type AgentCompat struct {
+	AgentID            uint              `json:"agent_id"`
+	Version            string            `json:"version"`
+	Negotiated         bool              `json:"negotiated"`
+	Protocol           int               `json:"protocol"`
+	ControllerProtocol int               `json:"controller_protocol"`
+	ProbeTypes         []string          `json:"probe_types"`
+	Features           []string          `json:"features"`
+	Warnings           []DeliveryWarning `json:"warnings"`
+}
+
+// CheckAgentCompat reports what probe_get would withhold or trim for a.
+func CheckAgentCompat(ctx context.Context, db *gorm.DB, ch *sql.DB, a *agent.Agent) (*AgentCompat, error) {
+	probes, err := ListForAgent(ctx, db, ch, a.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list probes for agent: %w", err)
+	}
+	_, warnings := FilterForAgent(a, probes)
+	if warnings == nil {
+		warnings = []DeliveryWarning{}
+	}
+
+	out := &AgentCompat{
+		AgentID:            a.ID,
+		Version:            a.Version,
+		Negotiated:         a.Negotiated(),
+		ControllerProtocol: agent.ConfigProtocolVersion,
+		Warnings:           warnings,
+	}
+	if out.Negotiated {
+		out.Protocol = agent.NegotiatedProtocol(a.ProtocolVersion)
+		out.ProbeTypes = a.SupportedProbeTypes()
+		out.Features = a.SupportedConfigFeatures()
+	} else {
+		for t := range legacyProbeTypes {
+			out.ProbeTypes = append(out.ProbeTypes, string(t))
+		}
+		for f := range legacyConfigFeatures {
+			out.Features = append(out.Features, f)
+		}
+		sort.Strings(out.ProbeTypes)
+		sort.Strings(out.Features)
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+)
+
+// TestFilterForAgent_LegacyAgent: agents that never negotiated keep
+// receiving the pre-negotiation probe types and fields unchanged.
+func TestFilterForAgent_LegacyAgent(t *testing.T) {
+	a := &agent.Agent{ID: 1}
+	in := []Probe{
+		{ID: 1, Type: TypePing, DSCP: 46},
+		{ID: 2, Type: TypeMTR, BindInterface: "eth1"},
+		{ID: 3, Type: Type("QUIC")},
+	}
+	out, warnings := FilterForAgent(a, in)
+	if len(out) != 2 || out[0].DSCP != 46 || out[1].BindInterface != "eth1" {
+		t.Errorf("legacy probes must pass unchanged, got %+v", out)
+	}
+	if len(warnings) != 1 || warnings[0].ProbeID != 3 || !warnings[0].Withheld {
+		t.Errorf("expected probe 3 withheld, got %+v", warnings)
+	}
+}
+
+// TestFilterForAgent_NegotiatedAgent: negotiated agents only receive the
+// types they announced, and unannounced fields are cleared.
+func TestFilterForAgent_NegotiatedAgent(t *testing.T) {
+	now := time.Now()
+	a := &agent.Agent{
+		ID:             1,
+		NegotiatedAt:   &now,
+		ProbeTypes:     []byte(`["PING","MTR"]`),
+		ConfigFeatures: []byte(`["bind_interface"]`),
+	}
+	in := []Probe{
+		{ID: 1, Type: TypePing, DSCP: 46, BindInterface: "eth1"},
+		{ID: 2, Type: TypeSNMP},
+	}
+	out, warnings := FilterForAgent(a, in)
+	if len(out) != 1 || out[0].ID != 1 {
+		t.Fatalf("expected only probe 1 delivered, got %+v", out)
+	}
+	if out[0].DSCP != 0 || out[0].BindInterface != "eth1" {
+		t.Errorf("expected dscp cleared and bind_interface kept, got %+v", out[0])
+	}
+	if in[0].DSCP != 46 {
+		t.Error("input must not be modified")
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %+v", warnings)
+	}
+	if warnings[0].Field != agent.FeatureDSCP || warnings[0].Withheld {
+		t.Errorf("expected dscp field warning, got %+v", warnings[0])
+	}
+	if warnings[1].ProbeID != 2 || !warnings[1].Withheld {
+		t.Errorf("expected SNMP probe withheld, got %+v", warnings[1])
+	}
+}
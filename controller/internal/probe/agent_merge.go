@@ -0,0 +1,36 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ReassignAgentProbeData rewrites probe_data rows of agent from to agent
+// to: as reporter (agent_id), probe owner (probe_agent_id) and target
+// (target_agent). Used by agent.MergeAgents. On ClickHouse this is an
+// asynchronous mutation; none of the columns are in the sorting key, so
+// it is a plain column rewrite.
+func ReassignAgentProbeData(ctx context.Context, ch *sql.DB, from, to uint) error {
+	if ch == nil {
+		return nil
+	}
+	_, err := ch.ExecContext(ctx, reassignAgentSQL(from, to, EmbeddedTelemetry()))
+	return err
+}
+
+func reassignAgentSQL(from, to uint, embedded bool) string {
+	where := fmt.Sprintf("agent_id = %d OR probe_agent_id = %d OR target_agent = %d", from, from, from)
+	if embedded {
+		return fmt.Sprintf(`UPDATE probe_data SET
+	agent_id = CASE WHEN agent_id = %[1]d THEN %[2]d ELSE agent_id END,
+	probe_agent_id = CASE WHEN probe_agent_id = %[1]d THEN %[2]d ELSE probe_agent_id END,
+	target_agent = CASE WHEN target_agent = %[1]d THEN %[2]d ELSE target_agent END
+WHERE %[3]s`, from, to, where)
+	}
+	return fmt.Sprintf(`ALTER TABLE probe_data UPDATE
+	agent_id = if(agent_id = %[1]d, %[2]d, agent_id),
+	probe_agent_id = if(probe_agent_id = %[1]d, %[2]d, probe_agent_id),
+	target_agent = if(target_agent = %[1]d, %[2]d, target_agent)
+WHERE %[3]s`, from, to, where)
+}
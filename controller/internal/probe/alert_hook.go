@@ -27,8 +27,11 @@ func SaveRecordWithAlertEval(
 		return err
 	}
 
+	// Loss spikes and resuming agents bring the next analysis forward
+	noteIngestSample(ctx, pg, data, kind, payload)
+
 	// Only evaluate alerts for types that have metrics we can check
-	if kind != string(TypePing) && kind != string(TypeTrafficSim) && kind != string(TypeMTR) && kind != string(TypeSysInfo) && kind != string(TypeDNS) && kind != string(TypeHTTP) && kind != string(TypeSNMP) {
+	if kind != string(TypePing) && kind != string(TypeTrafficSim) && kind != string(TypeMTR) && kind != string(TypeSysInfo) && kind != string(TypeDNS) && kind != string(TypeHTTP) && kind != string(TypeSNMP) && kind != string(TypePMTU) {
 		return nil
 	}
 
@@ -70,12 +73,19 @@ func SaveRecordWithAlertEval(
 		return nil
 	}
 
+	// Probe metadata names the target for humans ("Circuit MPLS-117 (10.0.0.1)")
+	probeName := string(probe.Type)
+	meta := ParseProbeMetadata(probe.Metadata)
+	if label := meta.Label(); label != "" {
+		probeName = label
+	}
+
 	// Build probe context with enriched information
 	pctx := alert.ProbeContext{
 		ProbeID:         data.ProbeID,
 		ProbeType:       kind,
-		ProbeName:       string(probe.Type), // Use probe type as display name
-		ProbeTarget:     targetStr,
+		ProbeName:       probeName,
+		ProbeTarget:     meta.Describe(targetStr),
 		AgentID:         probe.AgentID,
 		AgentName:       agent.Name,
 		WorkspaceID:     agent.WorkspaceID,
@@ -5,7 +5,12 @@ package probe
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"math"
+	"slices"
+	"strings"
 	"time"
 
 	"netwatcher-controller/internal/llm"
@@ -13,9 +18,10 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// llmProvider is the optional LLM provider for enriching analysis summaries.
-// Nil by default (disabled). Set via SetLLMProvider during startup.
-var llmProvider llm.Provider
+// llmManager resolves per-workspace LLM providers and budgets for
+// enriching analysis summaries. Nil by default (disabled). Set via
+// SetLLMManager during startup.
+var llmManager *llm.Manager
 
 // GeoIPResolver is a minimal interface satisfied by *geoip.Store. Decoupling
 // keeps the probe package free of an import cycle on geoip (which itself
@@ -25,17 +31,51 @@ type GeoIPResolver interface {
 	LookupASN(ipStr string) (asn uint, org string, ok bool)
 }
 
-// SetLLMProvider configures the optional LLM provider for analysis enrichment.
-func SetLLMProvider(p llm.Provider) {
-	llmProvider = p
-	if p != nil && p.Available() {
-		log.Infof("[analysis] LLM enrichment enabled (provider: %s)", p.Name())
+// SetLLMManager configures optional LLM enrichment for analysis.
+func SetLLMManager(m *llm.Manager) {
+	llmManager = m
+	if m != nil && m.Available() {
+		log.Infof("[analysis] LLM enrichment enabled (providers: %v)", m.AvailableProviders())
 	}
 }
 
-// enrichWithLLM attempts to get a natural language summary from the LLM.
-// Returns empty string on any error (caller falls back to rule-based message).
-func enrichWithLLM(ctx context.Context, status StatusSummary, incidents []DetectedIncident, agents []AgentHealthSummary, health HealthVector, totalProbes int) string {
+// LLMUsage describes the LLM call behind a workspace analysis summary.
+type LLMUsage struct {
+	Provider         string `json:"provider,omitempty"`
+	CacheKey         string `json:"cache_key"`
+	Cached           bool   `json:"cached"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+// llmCacheKey hashes the inputs a summary depends on: the health grade,
+// status and the incident set (ID, severity and affected agents/targets).
+// Evidence and scores move every run and are left out, so the summary is
+// reused until an incident opens, resolves, escalates or spreads.
+func llmCacheKey(status StatusSummary, health HealthVector, incidents []DetectedIncident) string {
+	parts := make([]string, 0, len(incidents))
+	for _, inc := range incidents {
+		agents := slices.Clone(inc.AffectedAgents)
+		targets := slices.Clone(inc.AffectedTargets)
+		slices.Sort(agents)
+		slices.Sort(targets)
+		parts = append(parts, inc.ID+"|"+inc.Severity+"|"+strings.Join(agents, ",")+"|"+strings.Join(targets, ","))
+	}
+	slices.Sort(parts)
+	h := sha256.New()
+	h.Write([]byte(health.Grade + "\n" + status.Status + "\n"))
+	for _, p := range parts {
+		h.Write([]byte(p + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// enrichWithLLM looks up the LLM summary for the workspace's current
+// inputs (llmCacheKey), queueing it when there is none yet (see
+// llm.Manager.Enrich). It returns the summary, or "" while it is pending or
+// after it failed (caller keeps the rule-based message), plus the
+// enrichment status. usage is nil when enrichment does not apply.
+func enrichWithLLM(ctx context.Context, workspaceID uint, status StatusSummary, incidents []DetectedIncident, agents []AgentHealthSummary, health HealthVector, totalProbes int) (string, *LLMUsage, string) {
 	incidentSummaries := make([]llm.IncidentSummary, len(incidents))
 	for i, inc := range incidents {
 		incidentSummaries[i] = llm.IncidentSummary{
@@ -66,12 +106,25 @@ func enrichWithLLM(ctx context.Context, status StatusSummary, incidents []Detect
 		TotalProbes:  totalProbes,
 	}
 
-	enriched, err := llmProvider.Summarize(ctx, req)
+	key := llmCacheKey(status, health, incidents)
+	res, state, err := llmManager.Enrich(ctx, workspaceID, key, req)
+	if errors.Is(err, llm.ErrDisabled) {
+		log.Debugf("[analysis] workspace %d: skipping LLM enrichment: %v", workspaceID, err)
+		return "", nil, ""
+	}
 	if err != nil {
-		log.Warnf("[analysis] LLM enrichment failed (falling back to rule-based): %v", err)
-		return ""
+		log.Warnf("[analysis] LLM enrichment queue unavailable (falling back to rule-based): %v", err)
+		return "", nil, ""
 	}
-	return enriched
+	// The key is kept while the summary is pending so the snapshot saved
+	// now can be updated when it arrives (see applyLLMEnrichment).
+	usage := &LLMUsage{CacheKey: key}
+	if state != llm.JobDone {
+		return "", usage, string(state)
+	}
+	usage.Provider, usage.Cached = res.Provider, res.Cached
+	usage.PromptTokens, usage.CompletionTokens = res.PromptTokens, res.CompletionTokens
+	return res.Text, usage, string(state)
 }
 
 // ── Health Vector Model ──
@@ -84,6 +137,9 @@ type HealthVector struct {
 	MosScore        float64 `json:"mos_score"`         // 1.0-4.5
 	OverallHealth   float64 `json:"overall_health"`    // 0-100
 	Grade           string  `json:"grade"`             // excellent/good/fair/poor/critical
+	P50LatencyMs    float64 `json:"p50_latency_ms,omitempty"`
+	P99LatencyMs    float64 `json:"p99_latency_ms,omitempty"`
+	MaxLatencyMs    float64 `json:"max_latency_ms,omitempty"`
 }
 
 // ProbeMetrics holds raw metrics for a single probe direction
@@ -92,6 +148,7 @@ type ProbeMetrics struct {
 	MedianLatency float64 `json:"median_latency"` // ms
 	P95Latency    float64 `json:"p95_latency"`    // ms
 	P99Latency    float64 `json:"p99_latency"`    // ms
+	MaxLatency    float64 `json:"max_latency"`    // ms
 	PacketLoss    float64 `json:"packet_loss"`    // percentage
 	JitterAvg     float64 `json:"jitter_avg"`     // ms (stddev)
 	JitterMedian  float64 `json:"jitter_median"`  // ms
@@ -101,12 +158,13 @@ type ProbeMetrics struct {
 
 // AnalysisSignal represents a detected signal (anomaly, artifact, etc.)
 type AnalysisSignal struct {
-	Type       string  `json:"type"`     // icmp_artifact, route_change, high_loss, high_latency, jitter_anomaly
+	Type       string  `json:"type"`     // icmp_artifact, route_change, high_loss, high_latency, p99_spike, jitter_anomaly
 	Severity   string  `json:"severity"` // info, warning, critical
 	Title      string  `json:"title"`
 	Evidence   string  `json:"evidence"`
 	Confidence float64 `json:"confidence"` // 0-1.0
 	HopNumber  int     `json:"hop_number,omitempty"`
+	Source     string  `json:"source,omitempty"` // custom analyzer name; empty for built-in signals
 }
 
 // AnalysisFinding is a diagnostic conclusion from data analysis
@@ -118,6 +176,7 @@ type AnalysisFinding struct {
 	Summary  string   `json:"summary"`
 	Evidence []string `json:"evidence"`
 	Steps    []string `json:"recommended_steps"`
+	Source   string   `json:"source,omitempty"` // custom analyzer name; empty for built-in findings
 }
 
 // MtrPathAnalysis contains route-level diagnostic data from MTR traces
@@ -127,8 +186,10 @@ type MtrPathAnalysis struct {
 	RouteStabilityPct  float64     `json:"route_stability_pct"`
 	AvgEndHopLatency   float64     `json:"avg_end_hop_latency"`
 	AvgEndHopLoss      float64     `json:"avg_end_hop_loss"`
-	AvgEndHopJitterAvg float64     `json:"avg_end_hop_jitter"` // stddev from end hop
-	TraceCount         int         `json:"trace_count"`        // number of MTR traces analysed
+	AvgEndHopJitterAvg float64     `json:"avg_end_hop_jitter"`         // stddev from end hop
+	AvgEndHopJavg      float64     `json:"avg_end_hop_javg,omitempty"` // mean jitter (javg) at the end hop
+	JitterOnsetHop     int         `json:"jitter_onset_hop,omitempty"` // first hop where jitter rises and persists (see mtr_jitter.go)
+	TraceCount         int         `json:"trace_count"`                // number of MTR traces analysed
 	RateLimitedHops    []int       `json:"rate_limited_hops"`
 	TimeoutSegments    []string    `json:"timeout_segments"`
 	LatestHopsDetail   []HopDetail `json:"latest_hops_detail,omitempty"` // Enriched hop info with agent names
@@ -143,6 +204,7 @@ type ProbeAnalysis struct {
 	Target       string           `json:"target"`
 	AgentID      uint             `json:"agent_id"`
 	AgentName    string           `json:"agent_name"`
+	Metadata     *ProbeMetadata   `json:"metadata,omitempty"` // display name, circuit, owner (see probe_metadata.go)
 	Health       HealthVector     `json:"health"`
 	Metrics      ProbeMetrics     `json:"metrics"`
 	PathAnalysis *MtrPathAnalysis `json:"path_analysis,omitempty"`
@@ -150,10 +212,15 @@ type ProbeAnalysis struct {
 	// CombinedHealth merges forward and reverse health for bidirectional probes,
 	// weighted toward the worse direction (a path is only as usable as its worse
 	// direction). Nil when no reverse data exists.
-	CombinedHealth *HealthVector     `json:"combined_health,omitempty"`
-	Signals        []AnalysisSignal  `json:"signals"`
-	Findings       []AnalysisFinding `json:"findings"`
-	GeneratedAt    time.Time         `json:"generated_at"`
+	CombinedHealth *HealthVector `json:"combined_health,omitempty"`
+	// ReverseEstimate is the return-path loss inferred from TrafficSim
+	// server counters when no reverse data exists (see
+	// analysis_reverse_inference.go).
+	ReverseEstimate *ReverseLossEstimate `json:"reverse_estimate,omitempty"`
+	Signals         []AnalysisSignal     `json:"signals"`
+	Findings        []AnalysisFinding    `json:"findings"`
+	Freshness       *DataFreshness       `json:"freshness,omitempty"`
+	GeneratedAt     time.Time            `json:"generated_at"`
 }
 
 // ── Workspace-level Analysis ──
@@ -171,10 +238,23 @@ type ProbeHealthEntry struct {
 type AgentHealthSummary struct {
 	AgentID     uint               `json:"agent_id"`
 	AgentName   string             `json:"agent_name"`
-	IsOnline    bool               `json:"is_online"`
+	IsOnline    bool               `json:"is_online"` // false only when offline; degraded agents are still online
 	Health      HealthVector       `json:"health"`
 	ProbeCount  int                `json:"probe_count"`
 	WorstProbes []ProbeHealthEntry `json:"worst_probes"`
+
+	// Mode is passive when the agent has no probe data and is scored from
+	// SYSINFO/NETINFO alone (see analysis_passive.go); Passive holds that
+	// host view.
+	Mode    string             `json:"mode,omitempty"` // active, passive
+	Passive *PassiveHostHealth `json:"passive,omitempty"`
+
+	Connectivity            string `json:"connectivity"` // online, degraded, offline
+	SecondsSinceSeen        int    `json:"seconds_since_seen,omitempty"`
+	OfflineThresholdSeconds int    `json:"offline_threshold_seconds,omitempty"`
+
+	// Region that analysed the agent, in federated analyses (see federation.go)
+	Region string `json:"region,omitempty"`
 }
 
 // DetectedIncident is a correlated event detected across agents/probes
@@ -191,6 +271,33 @@ type DetectedIncident struct {
 	Confidence      float64  `json:"confidence"`       // 0-1.0, based on proportion of agents affected
 	LookbackMinutes int      `json:"lookback_minutes"` // time window being analyzed
 	MatchedCriteria string   `json:"matched_criteria"` // what triggered the incident (e.g., "packet_loss > 1%")
+
+	// Prioritization (see analysis_impact.go)
+	ImpactScore     float64    `json:"impact_score"`            // 0-100, incidents are sorted by this
+	Criticality     string     `json:"criticality,omitempty"`   // highest criticality among affected targets
+	FirstSeenAt     *time.Time `json:"first_seen_at,omitempty"` // start of the current run in analysis snapshots
+	DurationMinutes int        `json:"duration_minutes"`
+
+	// Third-party vantage comparison (see analysis_vantage.go)
+	ExternalView *ExternalVantageView `json:"external_view,omitempty"`
+
+	// Linked Jira / ServiceNow tickets (see analysis_tickets.go)
+	Tickets []IncidentTicket `json:"tickets,omitempty"`
+
+	// Probe metadata of affected targets, keyed by target (see probe_metadata.go)
+	TargetMetadata map[string]*ProbeMetadata `json:"target_metadata,omitempty"`
+
+	// Source names the custom analyzer that raised the incident (see
+	// analysis_plugins.go); empty for built-in detectors.
+	Source string `json:"source,omitempty"`
+
+	// Region that detected the incident, in federated analyses
+	Region string `json:"region,omitempty"`
+
+	// MeasurementArtifact marks an incident explained by how the data was
+	// measured rather than by the network, e.g. a bandwidth drop that
+	// coincides with a speedtest server switch. Such incidents are info.
+	MeasurementArtifact bool `json:"measurement_artifact,omitempty"`
 }
 
 // StatusSummary is a high-level "what's happening right now" overview
@@ -209,7 +316,27 @@ type WorkspaceAnalysis struct {
 	Agents        []AgentHealthSummary `json:"agents"`
 	TotalProbes   int                  `json:"total_probes"`
 	TotalAgents   int                  `json:"total_agents"`
+	Freshness     *DataFreshness       `json:"freshness,omitempty"`
 	GeneratedAt   time.Time            `json:"generated_at"`
+	// MaintenanceTargets were excluded from scoring and incidents.
+	MaintenanceTargets []string `json:"maintenance_targets,omitempty"`
+	// Findings are workspace-level conclusions: controller checks such
+	// as ingest throttling, then custom analyzers.
+	Findings []AnalysisFinding `json:"findings,omitempty"`
+	// LLM is set when the status message came from LLM enrichment, or
+	// with only CacheKey while the summary is queued.
+	LLM *LLMUsage `json:"llm,omitempty"`
+	// EnrichmentStatus is the LLM summary's state: pending (status message
+	// is rule-based until the queue delivers), done, failed or skipped
+	// (disabled or over budget). Empty when enrichment does not apply.
+	EnrichmentStatus string `json:"enrichment_status,omitempty"`
+	// Partial is set when queries failed or the time budget ran out;
+	// PartialReasons says what is missing.
+	Partial        bool     `json:"partial,omitempty"`
+	PartialReasons []string `json:"partial_reasons,omitempty"`
+	// Region is the controller's region in a multi-region deployment; the
+	// analysis then covers only that region's agents (see internal/region).
+	Region string `json:"region,omitempty"`
 }
 
 // ── Scoring Functions ──
@@ -354,5 +481,8 @@ func computeHealthVector(metrics ProbeMetrics, routeStability float64) HealthVec
 		MosScore:        mos,
 		OverallHealth:   overall,
 		Grade:           gradeFromScore(overall),
+		P50LatencyMs:    metrics.MedianLatency,
+		P99LatencyMs:    metrics.P99Latency,
+		MaxLatencyMs:    metrics.MaxLatency,
 	}
 }
@@ -104,13 +104,22 @@ func ComputePerAgentAnalysis(ctx context.Context, db *gorm.DB, ch *sql.DB, agent
 	}
 
 	// Check if online
-	isOnline := agentObj.LastSeenAt.After(time.Now().UTC().Add(-5 * time.Minute))
+	isOnline := agentObj.Connectivity(time.Now().UTC()) != agent.ConnectivityOffline
 
 	// Agent health: per-probe combined health first; voice scores
 	// enrich the vector rather than define it. Falls back to the
 	// voice-derived score when probes produced no analyzable samples,
-	// and to "unknown" when there's no data at all.
+	// then, for agents without active probes configured, to the passive
+	// host score (SYSINFO/NETINFO), and to "unknown" when there's no
+	// data at all.
+	active, err := activeProbeAgents(ctx, db, []uint{agentID})
+	if err != nil {
+		log.Warnf("[analysis] failed to list active probes for agent %d: %v", agentID, err)
+	}
+	hasActiveProbes := active[agentID] || (active == nil && len(probeAnalyses)+len(returnAnalyses) > 0)
 	var health HealthVector
+	mode := AgentModeActive
+	var passive *PassiveHostHealth
 	switch {
 	case len(healthScores) > 0:
 		overall := clampScore(avg(healthScores))
@@ -133,8 +142,18 @@ func ComputePerAgentAnalysis(ctx context.Context, db *gorm.DB, ch *sql.DB, agent
 			MosScore:        vq.OverallMos,
 			Grade:           vq.OverallGrade,
 		}
-	default:
+	case hasActiveProbes:
+		// Probes are configured but sent nothing: a data gap, not a
+		// passive host.
 		health = HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0}
+	default:
+		mode = AgentModePassive
+		passive = computeAgentPassiveHealth(ctx, ch, agentID, agentObj.CreatedAt, from)
+		if passive != nil {
+			health = passiveHealthVector(passive)
+		} else {
+			health = HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0}
+		}
 	}
 
 	log.Infof("[analysis] agent %d (%s): %d owned probes analyzed, %d return-path, %d health samples → %.1f (%s)",
@@ -145,6 +164,8 @@ func ComputePerAgentAnalysis(ctx context.Context, db *gorm.DB, ch *sql.DB, agent
 		AgentName:        agentObj.Name,
 		IsOnline:         isOnline,
 		Health:           health,
+		Mode:             mode,
+		Passive:          passive,
 		VoiceQuality:     vq,
 		Probes:           probeAnalyses,
 		ReturnPathProbes: returnAnalyses,
@@ -47,29 +47,23 @@ func EvaluateAnalysisIncidents(ctx context.Context, pg *gorm.DB, workspaceID uin
 				continue
 			}
 
-			// Deduplicate: check if an active alert already exists for this rule
-			if hasActiveAlert(ctx, pg, rule.ID) {
-				continue
-			}
-
-			// Create alert through the existing pipeline
+			// One alert per rule and incident (or per rule for workspace-wide
+			// metrics); the workspace notification policy handles repeats.
 			actx := &alert.AlertContext{
 				AgentName: result.agentName,
-			}
-			if result.agentID != 0 {
-				actx.AgentID = result.agentID
+				AgentID:   result.agentID,
+				Severity:  result.severity,
 			}
 
-			alertInstance, err := alert.CreateAlert(ctx, pg, &rule, result.value, result.message, actx)
+			alertInstance, reason, err := alert.RaiseAlert(ctx, pg, &rule, result.dedupKey, result.value, result.message, actx)
 			if err != nil {
 				log.Warnf("[analysis_alert] failed to create alert for rule %d: %v", rule.ID, err)
 				continue
 			}
-
-			// Dispatch notifications (webhook, email, panel)
-			alert.DispatchNotifications(ctx, pg, &rule, alertInstance)
-			log.Infof("[analysis_alert] triggered alert %d for rule '%s' (workspace %d): %s",
-				alertInstance.ID, rule.Name, workspaceID, result.message)
+			if reason == alert.ReasonNew {
+				log.Infof("[analysis_alert] triggered alert %d for rule '%s' (workspace %d): %s",
+					alertInstance.ID, rule.Name, workspaceID, result.message)
+			}
 		}
 	}
 
@@ -96,8 +90,31 @@ type analysisEvalResult struct {
 	message   string
 	agentName string
 	agentID   uint
+	dedupKey  string
+	severity  alert.Severity // empty = rule severity
 }
 
+// incidentResult is the alert result for one analysis incident. Its
+// severity follows the incident, so a warning that turns critical can
+// escalate the active alert.
+func incidentResult(inc DetectedIncident, message string) analysisEvalResult {
+	r := analysisEvalResult{
+		triggered: true,
+		value:     1,
+		message:   message,
+		agentName: firstOrEmpty(inc.AffectedAgents),
+		dedupKey:  incidentDedupKey(inc.ID),
+	}
+	switch alert.Severity(inc.Severity) {
+	case alert.SeverityWarning, alert.SeverityCritical:
+		r.severity = alert.Severity(inc.Severity)
+	}
+	return r
+}
+
+// incidentDedupKey is the alert dedup key for an analysis incident.
+func incidentDedupKey(id string) string { return "incident:" + id }
+
 func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []analysisEvalResult {
 	var results []analysisEvalResult
 
@@ -109,6 +126,7 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 				triggered: true,
 				value:     value,
 				message:   fmt.Sprintf("Workspace health score dropped to %.0f (threshold: %.0f)", value, rule.Threshold),
+				dedupKey:  "workspace",
 			})
 		}
 
@@ -121,6 +139,7 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 				triggered: true,
 				value:     count,
 				message:   fmt.Sprintf("%d active incidents detected (%s)", int(count), severities),
+				dedupKey:  "workspace",
 			})
 		}
 
@@ -129,12 +148,7 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 			if !strings.Contains(inc.ID, "latency_regression") {
 				continue
 			}
-			results = append(results, analysisEvalResult{
-				triggered: true,
-				value:     1,
-				message:   inc.Title + " — " + inc.SuggestedCause,
-				agentName: firstOrEmpty(inc.AffectedAgents),
-			})
+			results = append(results, incidentResult(inc, inc.Title+" — "+inc.SuggestedCause))
 		}
 
 	case alert.MetricLossBaseline:
@@ -142,12 +156,7 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 			if !strings.Contains(inc.ID, "loss_regression") {
 				continue
 			}
-			results = append(results, analysisEvalResult{
-				triggered: true,
-				value:     1,
-				message:   inc.Title + " — " + inc.SuggestedCause,
-				agentName: firstOrEmpty(inc.AffectedAgents),
-			})
+			results = append(results, incidentResult(inc, inc.Title+" — "+inc.SuggestedCause))
 		}
 
 	case alert.MetricIPChange:
@@ -155,12 +164,7 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 			if !strings.Contains(inc.ID, "ip_change") {
 				continue
 			}
-			results = append(results, analysisEvalResult{
-				triggered: true,
-				value:     1,
-				message:   inc.Title + " — " + strings.Join(inc.Evidence, "; "),
-				agentName: firstOrEmpty(inc.AffectedAgents),
-			})
+			results = append(results, incidentResult(inc, inc.Title+" — "+strings.Join(inc.Evidence, "; ")))
 		}
 
 	case alert.MetricISPChange:
@@ -168,26 +172,13 @@ func evaluateAnalysisRule(rule *alert.AlertRule, analysis *WorkspaceAnalysis) []
 			if !strings.Contains(inc.ID, "isp_change") {
 				continue
 			}
-			results = append(results, analysisEvalResult{
-				triggered: true,
-				value:     1,
-				message:   inc.Title + " — " + inc.SuggestedCause,
-				agentName: firstOrEmpty(inc.AffectedAgents),
-			})
+			results = append(results, incidentResult(inc, inc.Title+" — "+inc.SuggestedCause))
 		}
 	}
 
 	return results
 }
 
-func hasActiveAlert(ctx context.Context, pg *gorm.DB, ruleID uint) bool {
-	var count int64
-	pg.WithContext(ctx).Model(&alert.Alert{}).
-		Where("alert_rule_id = ? AND status = ?", ruleID, alert.StatusActive).
-		Count(&count)
-	return count > 0
-}
-
 func countSeverities(incidents []DetectedIncident) string {
 	critical, warning, info := 0, 0, 0
 	for _, inc := range incidents {
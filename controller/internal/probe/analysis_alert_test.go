@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"netwatcher-controller/internal/alert"
+)
+
+// TestAnalysisAlertDedup verifies analysis alerts are deduplicated per
+// incident and that the workspace policy controls re-notification.
+func TestAnalysisAlertDedup(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&alert.AlertRule{}, &alert.Alert{}, &alert.NotificationPolicy{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := alert.CreateRule(ctx, db, alert.CreateRuleInput{
+		WorkspaceID: 1, Name: "latency", Metric: alert.MetricLatencyBaseline, Operator: alert.OperatorGT,
+	}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	incident := func(id, severity string) DetectedIncident {
+		return DetectedIncident{ID: id, Severity: severity, Title: id, AffectedAgents: []string{"hq"}}
+	}
+	run := func(incs ...DetectedIncident) []alert.Alert {
+		t.Helper()
+		if err := EvaluateAnalysisIncidents(ctx, db, 1, &WorkspaceAnalysis{WorkspaceID: 1, Incidents: incs}); err != nil {
+			t.Fatalf("evaluate: %v", err)
+		}
+		var alerts []alert.Alert
+		db.Order("id").Find(&alerts)
+		return alerts
+	}
+
+	a := run(incident("latency_regression_1", "warning"))
+	if len(a) != 1 || a[0].NotifyCount != 1 || a[0].DedupKey != "incident:latency_regression_1" {
+		t.Fatalf("first run = %+v", a)
+	}
+
+	// Default "once": escalation alone doesn't re-notify.
+	a = run(incident("latency_regression_1", "critical"))
+	if len(a) != 1 || a[0].NotifyCount != 1 || a[0].Severity != alert.SeverityWarning {
+		t.Fatalf("once policy = %+v", a)
+	}
+
+	if _, err := alert.SetNotificationPolicy(ctx, db, 1, 0, alert.NotificationPolicyInput{Mode: alert.NotifyEscalation}); err != nil {
+		t.Fatalf("set policy: %v", err)
+	}
+	a = run(incident("latency_regression_1", "critical"), incident("latency_regression_2", "warning"))
+	if len(a) != 2 {
+		t.Fatalf("alerts = %d, want one per incident", len(a))
+	}
+	if a[0].NotifyCount != 2 || a[0].Severity != alert.SeverityCritical {
+		t.Errorf("escalated alert = %+v", a[0])
+	}
+
+	// Same severity again: nothing new.
+	a = run(incident("latency_regression_1", "critical"))
+	if a[0].NotifyCount != 2 {
+		t.Errorf("notify_count = %d after unchanged run, want 2", a[0].NotifyCount)
+	}
+
+	if _, err := alert.SetNotificationPolicy(ctx, db, 1, 0, alert.NotificationPolicyInput{Mode: alert.NotifyRenotify, RenotifyMinutes: 1}); err == nil {
+		t.Error("renotify below the minimum interval should be rejected")
+	}
+}
@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Best-Path Recommendation ──
+//
+// For targets probed by more than one agent, rank the agents by their
+// current PING path health so customers running their own traffic
+// steering (or picking a backup path mid-incident) know which vantage
+// to prefer. Scores reuse computeHealthVector so the ranking matches the
+// health grades shown elsewhere.
+
+const (
+	// bestPathMinSamples is the minimum PING cycles for an agent to be
+	// ranked at all.
+	bestPathMinSamples = 3
+	// A recommendation is confident when the best agent leads the
+	// runner-up by this many health points and has enough samples.
+	bestPathConfidentMargin  = 5.0
+	bestPathConfidentSamples = 10
+	// bestPathOnlineWindow matches the agent online check used elsewhere.
+	bestPathOnlineWindow = 5 * time.Minute
+)
+
+// PathCandidate is one agent's current path to a shared target.
+type PathCandidate struct {
+	AgentID     uint    `json:"agent_id"`
+	AgentName   string  `json:"agent_name"`
+	Online      bool    `json:"online"`
+	AvgLatency  float64 `json:"avg_latency"`
+	P95Latency  float64 `json:"p95_latency"`
+	PacketLoss  float64 `json:"packet_loss"`
+	Samples     int     `json:"samples"`
+	HealthScore float64 `json:"health_score"`
+	Grade       string  `json:"grade"`
+	// Eligible is false for offline agents and agents with too few samples;
+	// they are listed after the ranked candidates.
+	Eligible bool `json:"eligible"`
+}
+
+// PathRecommendation ranks the agents probing one target.
+type PathRecommendation struct {
+	Target     string          `json:"target"`
+	Best       *PathCandidate  `json:"best,omitempty"`
+	Candidates []PathCandidate `json:"candidates"`
+	Margin     float64         `json:"margin"` // health points between best and runner-up
+	Confident  bool            `json:"confident"`
+	Reason     string          `json:"reason"`
+}
+
+// BestPathReport lists recommendations for every shared target.
+type BestPathReport struct {
+	WorkspaceID     uint                 `json:"workspace_id"`
+	LookbackMinutes int                  `json:"lookback_minutes"`
+	Targets         []PathRecommendation `json:"targets"`
+	GeneratedAt     time.Time            `json:"generated_at"`
+}
+
+// RecommendBestPaths ranks agents per target over the lookback window.
+// With target set only that target is returned (even if a single agent
+// probes it); otherwise every target probed by two or more agents is.
+func RecommendBestPaths(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, target string, lookbackMinutes int) (*BestPathReport, error) {
+	if lookbackMinutes <= 0 {
+		lookbackMinutes = 15
+	}
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	agentByID := make(map[uint]agentInfo, len(agents))
+	agentIDs := make([]uint, 0, len(agents))
+	for _, a := range agents {
+		agentByID[a.ID] = a
+		agentIDs = append(agentIDs, a.ID)
+	}
+
+	var onlineIDs []uint
+	if err := pg.WithContext(ctx).Table("agents").
+		Where("workspace_id = ? AND last_seen_at > ?", workspaceID, time.Now().UTC().Add(-bestPathOnlineWindow)).
+		Pluck("id", &onlineIDs).Error; err != nil {
+		return nil, fmt.Errorf("get online agents: %w", err)
+	}
+	online := make(map[uint]bool, len(onlineIDs))
+	for _, id := range onlineIDs {
+		online[id] = true
+	}
+
+	from := time.Now().UTC().Add(-time.Duration(lookbackMinutes) * time.Minute)
+	ping, err := getWorkspacePingMetrics(ctx, ch, agentIDs, from)
+	if err != nil {
+		return nil, err
+	}
+
+	want := stripPort(strings.TrimSpace(target))
+	byTarget := make(map[string][]PathCandidate)
+	for key, st := range ping {
+		i := strings.IndexByte(key, ':')
+		if i <= 0 {
+			continue
+		}
+		host := stripPort(key[i+1:])
+		if want != "" && host != want {
+			continue
+		}
+		id := parseUint(key[:i])
+		byTarget[host] = append(byTarget[host], pathCandidate(id, agentByID[id].Name, online[id], st))
+	}
+
+	report := &BestPathReport{
+		WorkspaceID:     workspaceID,
+		LookbackMinutes: lookbackMinutes,
+		Targets:         []PathRecommendation{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	for host, cands := range byTarget {
+		if want == "" && len(cands) < 2 {
+			continue
+		}
+		report.Targets = append(report.Targets, rankPathCandidates(host, cands))
+	}
+	sort.Slice(report.Targets, func(i, j int) bool { return report.Targets[i].Target < report.Targets[j].Target })
+	return report, nil
+}
+
+func pathCandidate(agentID uint, name string, online bool, st pingStats) PathCandidate {
+	h := computeHealthVector(ProbeMetrics{
+		AvgLatency:    st.AvgLatency,
+		MedianLatency: st.Latency.P50,
+		P95Latency:    st.Latency.P95,
+		P99Latency:    st.Latency.P99,
+		MaxLatency:    st.Latency.Max,
+		PacketLoss:    st.PacketLoss,
+		SampleCount:   st.Count,
+	}, 100)
+	return PathCandidate{
+		AgentID:     agentID,
+		AgentName:   name,
+		Online:      online,
+		AvgLatency:  sanitizeFloat(st.AvgLatency),
+		P95Latency:  sanitizeFloat(st.Latency.P95),
+		PacketLoss:  sanitizeFloat(st.PacketLoss),
+		Samples:     st.Count,
+		HealthScore: h.OverallHealth,
+		Grade:       h.Grade,
+		Eligible:    online && st.Count >= bestPathMinSamples,
+	}
+}
+
+// rankPathCandidates orders eligible candidates by health (then loss,
+// then latency) and picks the best.
+func rankPathCandidates(target string, cands []PathCandidate) PathRecommendation {
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.Eligible != b.Eligible {
+			return a.Eligible
+		}
+		if a.HealthScore != b.HealthScore {
+			return a.HealthScore > b.HealthScore
+		}
+		if a.PacketLoss != b.PacketLoss {
+			return a.PacketLoss < b.PacketLoss
+		}
+		return a.AvgLatency < b.AvgLatency
+	})
+
+	rec := PathRecommendation{Target: target, Candidates: cands}
+	if len(cands) == 0 || !cands[0].Eligible {
+		rec.Reason = "No online agent has enough recent PING data for this target."
+		return rec
+	}
+	best := cands[0]
+	rec.Best = &best
+	if len(cands) < 2 || !cands[1].Eligible {
+		rec.Reason = fmt.Sprintf("%s is the only agent with a usable path (%.1fms, %.1f%% loss).", best.AgentName, best.AvgLatency, best.PacketLoss)
+		return rec
+	}
+	next := cands[1]
+	rec.Margin = clampScore(best.HealthScore - next.HealthScore)
+	rec.Confident = rec.Margin >= bestPathConfidentMargin && best.Samples >= bestPathConfidentSamples
+	if rec.Confident {
+		rec.Reason = fmt.Sprintf("%s has the best path (%.1fms, %.1f%% loss) vs %s (%.1fms, %.1f%% loss).",
+			best.AgentName, best.AvgLatency, best.PacketLoss, next.AgentName, next.AvgLatency, next.PacketLoss)
+	} else {
+		rec.Reason = fmt.Sprintf("%s and %s have comparable paths; either is a reasonable choice.", best.AgentName, next.AgentName)
+	}
+	return rec
+}
@@ -0,0 +1,45 @@
+package probe
+
+import "testing"
+
+// TestRankPathCandidatesPrefersHealthyOnlineAgent verifies the lossy path
+// ranks below the clean one and offline agents are never recommended.
+func TestRankPathCandidatesPrefersHealthyOnlineAgent(t *testing.T) {
+	cands := []PathCandidate{
+		pathCandidate(1, "branch", true, pingStats{AvgLatency: 25, PacketLoss: 8, Count: 60}),
+		pathCandidate(2, "hq", true, pingStats{AvgLatency: 20, PacketLoss: 0, Count: 60}),
+		pathCandidate(3, "dc", false, pingStats{AvgLatency: 5, PacketLoss: 0, Count: 60}),
+	}
+	rec := rankPathCandidates("example.com", cands)
+	if rec.Best == nil || rec.Best.AgentID != 2 {
+		t.Fatalf("best = %+v, want hq", rec.Best)
+	}
+	if !rec.Confident {
+		t.Errorf("expected a confident recommendation, margin %.1f", rec.Margin)
+	}
+	if last := rec.Candidates[len(rec.Candidates)-1]; last.AgentID != 3 || last.Eligible {
+		t.Errorf("offline agent should be last and ineligible, got %+v", last)
+	}
+}
+
+// TestRankPathCandidatesComparablePaths verifies near-identical paths
+// produce a non-confident recommendation.
+func TestRankPathCandidatesComparablePaths(t *testing.T) {
+	rec := rankPathCandidates("example.com", []PathCandidate{
+		pathCandidate(1, "a", true, pingStats{AvgLatency: 20, Count: 60}),
+		pathCandidate(2, "b", true, pingStats{AvgLatency: 21, Count: 60}),
+	})
+	if rec.Best == nil || rec.Confident {
+		t.Errorf("got best %+v confident %v", rec.Best, rec.Confident)
+	}
+}
+
+// TestRankPathCandidatesNoEligible verifies thin data yields no pick.
+func TestRankPathCandidatesNoEligible(t *testing.T) {
+	rec := rankPathCandidates("example.com", []PathCandidate{
+		pathCandidate(1, "a", true, pingStats{AvgLatency: 20, Count: 1}),
+	})
+	if rec.Best != nil {
+		t.Errorf("best = %+v, want none", rec.Best)
+	}
+}
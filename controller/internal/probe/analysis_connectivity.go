@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"fmt"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+)
+
+// ── Agent Connectivity ──
+//
+// Agents are classified online / degraded / offline by heartbeat age
+// against per-agent thresholds (network type, label or explicit
+// override), so a cellular or satellite agent missing a few heartbeats
+// shows degraded connectivity rather than an outage.
+
+const (
+	ConnectivityOnline   = agent.ConnectivityOnline
+	ConnectivityDegraded = agent.ConnectivityDegraded
+	ConnectivityOffline  = agent.ConnectivityOffline
+
+	// degradedConnectivityPenalty is subtracted from an agent's health
+	// while it is missing heartbeats.
+	degradedConnectivityPenalty = 10.0
+)
+
+func (a agentInfo) connectivityThresholds() agent.ConnectivityThresholds {
+	return agent.ResolveConnectivityThresholds(a.NetworkType, a.OfflineThresholdSeconds, a.Labels)
+}
+
+// connectivity classifies the agent by heartbeat age at now. Agents
+// predating last_seen_at tracking fall back to updated_at.
+func (a agentInfo) connectivity(now time.Time) string {
+	seen := a.LastSeenAt
+	if seen.IsZero() {
+		seen = a.UpdatedAt
+	}
+	return a.connectivityThresholds().Classify(seen, now)
+}
+
+// secondsSinceSeen is the heartbeat age at now; zero when reprocessing,
+// where connection state is not known.
+func secondsSinceSeen(a agentInfo, now time.Time, reprocessing bool) int {
+	if reprocessing {
+		return 0
+	}
+	seen := a.LastSeenAt
+	if seen.IsZero() {
+		seen = a.UpdatedAt
+	}
+	return max(0, int(now.Sub(seen)/time.Second))
+}
+
+// offlineEvidence describes how long an offline agent has been silent.
+func offlineEvidence(a AgentHealthSummary) string {
+	if a.SecondsSinceSeen == 0 || a.OfflineThresholdSeconds == 0 {
+		return "Agent has not sent a heartbeat within the expected interval"
+	}
+	return fmt.Sprintf("No heartbeat for %s (offline threshold %s)",
+		time.Duration(a.SecondsSinceSeen)*time.Second, time.Duration(a.OfflineThresholdSeconds)*time.Second)
+}
+
+// degradedConnectivityIncident reports an agent that missed heartbeats
+// but is still inside its offline threshold.
+func degradedConnectivityIncident(a AgentHealthSummary) DetectedIncident {
+	return DetectedIncident{
+		ID:              fmt.Sprintf("agent_connectivity_degraded_%d", a.AgentID),
+		Title:           fmt.Sprintf("%s has degraded connectivity", a.AgentName),
+		Severity:        "warning",
+		Scope:           "agent-specific",
+		SuggestedCause:  "Agent is missing heartbeats but is still within its offline threshold — typical of an unstable uplink (cellular, satellite, congested Wi-Fi)",
+		AffectedAgents:  []string{a.AgentName},
+		AffectedTargets: []string{},
+		Evidence: []string{
+			fmt.Sprintf("Last heartbeat %s ago; considered offline after %s",
+				time.Duration(a.SecondsSinceSeen)*time.Second, time.Duration(a.OfflineThresholdSeconds)*time.Second),
+		},
+		Recommendations: []string{
+			fmt.Sprintf("Check the uplink stability at %s's location", a.AgentName),
+			"If the agent is on a cellular or satellite link, set its network type so heartbeats get a longer grace",
+		},
+		Confidence: 0.7,
+	}
+}
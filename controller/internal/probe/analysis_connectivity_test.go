@@ -0,0 +1,39 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestAgentInfoConnectivity verifies the network type grace and the
+// updated_at fallback for agents without last_seen_at.
+func TestAgentInfoConnectivity(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		a    agentInfo
+		want string
+	}{
+		{agentInfo{LastSeenAt: now.Add(-30 * time.Second)}, ConnectivityOnline},
+		{agentInfo{LastSeenAt: now.Add(-3 * time.Minute)}, ConnectivityDegraded},
+		{agentInfo{LastSeenAt: now.Add(-10 * time.Minute)}, ConnectivityOffline},
+		{agentInfo{LastSeenAt: now.Add(-10 * time.Minute), NetworkType: "satellite"}, ConnectivityDegraded},
+		{agentInfo{LastSeenAt: now.Add(-10 * time.Minute), NetworkType: "satellite", OfflineThresholdSeconds: 300}, ConnectivityOffline},
+		{agentInfo{UpdatedAt: now}, ConnectivityOnline},
+	}
+	for i, c := range cases {
+		if got := c.a.connectivity(now); got != c.want {
+			t.Errorf("case %d: connectivity = %q, want %q", i, got, c.want)
+		}
+	}
+}
+
+// TestBuildStatusSummaryDegradedConnectivity verifies an agent with
+// degraded connectivity marks the workspace degraded, not in outage.
+func TestBuildStatusSummaryDegradedConnectivity(t *testing.T) {
+	agents := []AgentHealthSummary{
+		{AgentName: "lte", IsOnline: true, Connectivity: ConnectivityDegraded, Health: HealthVector{Grade: "good"}},
+	}
+	if got := buildStatusSummary(HealthVector{Grade: "good"}, agents, nil); got.Status != "degraded" {
+		t.Errorf("status = %q, want degraded", got.Status)
+	}
+}
@@ -0,0 +1,592 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Capacity Planning Forecasts ─────────────────────────────────────────────
+//
+// Projects latency / loss / bandwidth trends forward from daily rollups
+// so operators can see which paths are drifting toward an SLO breach
+// before it happens. Per-probe series come from PING and TRAFFICSIM rows
+// aggregated server-side to one point per day; per-agent series come
+// from the stored analysis_snapshots (health score) plus SPEEDTEST
+// results (bandwidth). Each series gets an ordinary least-squares fit —
+// deliberately simple: the question is "which way and how fast", not a
+// precise prediction, and a linear fit over weeks of daily averages is
+// robust to the diurnal noise that trips up fancier models.
+
+// ForecastSLO holds the thresholds a projected series is checked against.
+type ForecastSLO struct {
+	LatencyMs     float64 `json:"latency_ms"`     // breach when latency rises above
+	LossPct       float64 `json:"loss_pct"`       // breach when loss rises above
+	BandwidthMbps float64 `json:"bandwidth_mbps"` // breach when download falls below
+	HealthScore   float64 `json:"health_score"`   // breach when agent health falls below
+}
+
+// DefaultForecastSLO mirrors the boundaries the scoring functions treat as
+// the start of "poor": 150ms latency, 2% loss, 25 Mbps, health "fair".
+var DefaultForecastSLO = ForecastSLO{
+	LatencyMs:     150,
+	LossPct:       2,
+	BandwidthMbps: 25,
+	HealthScore:   55,
+}
+
+// ForecastPoint is one daily rollup value.
+type ForecastPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// MetricForecast is the linear projection of one metric series.
+type MetricForecast struct {
+	Metric        string          `json:"metric"` // latency, packet_loss, bandwidth_down, health
+	Unit          string          `json:"unit"`
+	Current       float64         `json:"current"`         // fitted value today
+	SlopePerWeek  float64         `json:"slope_per_week"`  // change per 7 days
+	Projected     float64         `json:"projected"`       // fitted value at the horizon
+	Threshold     float64         `json:"threshold"`       // SLO boundary
+	Direction     string          `json:"direction"`       // "above" or "below" = breach side
+	WillBreach    bool            `json:"will_breach"`     // breach within the horizon
+	BreachAt      *time.Time      `json:"breach_at"`       // projected crossing (nil if none)
+	WeeksToBreach float64         `json:"weeks_to_breach"` // 0 when already breaching
+	RSquared      float64         `json:"r_squared"`       // fit quality 0-1
+	Points        []ForecastPoint `json:"points"`
+}
+
+// ProbeForecast groups the metric forecasts for one probe.
+type ProbeForecast struct {
+	ProbeID   uint             `json:"probe_id"`
+	ProbeType string           `json:"probe_type"`
+	Target    string           `json:"target"`
+	AgentID   uint             `json:"agent_id"`
+	AgentName string           `json:"agent_name"`
+	Metrics   []MetricForecast `json:"metrics"`
+	AtRisk    bool             `json:"at_risk"`
+}
+
+// AgentForecast groups the metric forecasts for one agent.
+type AgentForecast struct {
+	AgentID   uint             `json:"agent_id"`
+	AgentName string           `json:"agent_name"`
+	Metrics   []MetricForecast `json:"metrics"`
+	AtRisk    bool             `json:"at_risk"`
+}
+
+// WorkspaceForecast is the full forecast payload.
+type WorkspaceForecast struct {
+	WorkspaceID  uint            `json:"workspace_id"`
+	LookbackDays int             `json:"lookback_days"`
+	HorizonWeeks int             `json:"horizon_weeks"`
+	SLO          ForecastSLO     `json:"slo"`
+	Probes       []ProbeForecast `json:"probes"`
+	Agents       []AgentForecast `json:"agents"`
+	AtRiskCount  int             `json:"at_risk_count"`
+	GeneratedAt  time.Time       `json:"generated_at"`
+}
+
+// ForecastOptions selects the scope and horizon of a forecast run.
+type ForecastOptions struct {
+	LookbackDays int // history to fit (default 30)
+	HorizonWeeks int // how far ahead to look for breaches (default 4)
+	SLO          ForecastSLO
+	ProbeID      uint // restrict to one probe (0 = all)
+	AgentID      uint // restrict to one agent (0 = all)
+}
+
+// minForecastPoints is the fewest daily points a fit is attempted on.
+// Fewer than a week of history gives slopes dominated by noise.
+const minForecastPoints = 7
+
+// ComputeWorkspaceForecast builds per-probe and per-agent trend
+// projections for a workspace.
+func ComputeWorkspaceForecast(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, opts ForecastOptions) (*WorkspaceForecast, error) {
+	if opts.LookbackDays <= 0 {
+		opts.LookbackDays = 30
+	}
+	if opts.HorizonWeeks <= 0 {
+		opts.HorizonWeeks = 4
+	}
+	slo := opts.SLO
+	if slo.LatencyMs <= 0 {
+		slo.LatencyMs = DefaultForecastSLO.LatencyMs
+	}
+	if slo.LossPct <= 0 {
+		slo.LossPct = DefaultForecastSLO.LossPct
+	}
+	if slo.BandwidthMbps <= 0 {
+		slo.BandwidthMbps = DefaultForecastSLO.BandwidthMbps
+	}
+	if slo.HealthScore <= 0 {
+		slo.HealthScore = DefaultForecastSLO.HealthScore
+	}
+
+	now := time.Now().UTC()
+	from := now.AddDate(0, 0, -opts.LookbackDays)
+	horizon := time.Duration(opts.HorizonWeeks) * 7 * 24 * time.Hour
+
+	out := &WorkspaceForecast{
+		WorkspaceID:  workspaceID,
+		LookbackDays: opts.LookbackDays,
+		HorizonWeeks: opts.HorizonWeeks,
+		SLO:          slo,
+		Probes:       []ProbeForecast{},
+		Agents:       []AgentForecast{},
+		GeneratedAt:  now,
+	}
+
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	agentByID := make(map[uint]agentInfo, len(agents))
+	var agentIDs []uint
+	for _, a := range agents {
+		if opts.AgentID != 0 && a.ID != opts.AgentID {
+			continue
+		}
+		agentByID[a.ID] = a
+		agentIDs = append(agentIDs, a.ID)
+	}
+	if len(agentIDs) == 0 {
+		return out, nil
+	}
+
+	// ── Per-probe latency / loss ──
+	var probes []Probe
+	q := pg.WithContext(ctx).Preload("Targets").
+		Where("workspace_id = ? AND agent_id IN ? AND type IN ?", workspaceID, agentIDs, []Type{TypePing, TypeTrafficSim})
+	if opts.ProbeID != 0 {
+		q = q.Where("id = ?", opts.ProbeID)
+	}
+	if err := q.Find(&probes).Error; err != nil {
+		return nil, fmt.Errorf("list probes: %w", err)
+	}
+
+	rollups, err := getDailyProbeRollups(ctx, ch, agentIDs, from)
+	if err != nil {
+		log.Warnf("[forecast] workspace=%d probe rollup query error: %v", workspaceID, err)
+	}
+
+	for _, p := range probes {
+		r, ok := rollups[dailyRollupKey{ProbeID: p.ID, AgentID: p.AgentID}]
+		if !ok {
+			continue
+		}
+		pf := ProbeForecast{
+			ProbeID:   p.ID,
+			ProbeType: string(p.Type),
+			Target:    forecastProbeTarget(p, agentByID),
+			AgentID:   p.AgentID,
+			AgentName: agentByID[p.AgentID].Name,
+		}
+		if f, ok := forecastSeries("latency", "ms", r.latency, slo.LatencyMs, true, now, horizon); ok {
+			pf.Metrics = append(pf.Metrics, f)
+		}
+		if f, ok := forecastSeries("packet_loss", "%", r.loss, slo.LossPct, true, now, horizon); ok {
+			pf.Metrics = append(pf.Metrics, f)
+		}
+		if len(pf.Metrics) == 0 {
+			continue
+		}
+		pf.AtRisk = anyBreach(pf.Metrics)
+		out.Probes = append(out.Probes, pf)
+	}
+
+	// ── Per-agent health (snapshots) and bandwidth (speedtest) ──
+	if opts.ProbeID == 0 {
+		health := getDailyAgentHealth(ctx, ch, workspaceID, from)
+		bandwidth := getDailyAgentBandwidth(ctx, ch, agentIDs, from)
+		for _, id := range agentIDs {
+			af := AgentForecast{AgentID: id, AgentName: agentByID[id].Name}
+			if f, ok := forecastSeries("health", "score", health[id], slo.HealthScore, false, now, horizon); ok {
+				af.Metrics = append(af.Metrics, f)
+			}
+			if f, ok := forecastSeries("bandwidth_down", "Mbps", bandwidth[id], slo.BandwidthMbps, false, now, horizon); ok {
+				af.Metrics = append(af.Metrics, f)
+			}
+			if len(af.Metrics) == 0 {
+				continue
+			}
+			af.AtRisk = anyBreach(af.Metrics)
+			out.Agents = append(out.Agents, af)
+		}
+	}
+
+	// At-risk first, then soonest breach.
+	sort.SliceStable(out.Probes, func(i, j int) bool {
+		return forecastRank(out.Probes[i].AtRisk, out.Probes[i].Metrics) < forecastRank(out.Probes[j].AtRisk, out.Probes[j].Metrics)
+	})
+	sort.SliceStable(out.Agents, func(i, j int) bool {
+		return forecastRank(out.Agents[i].AtRisk, out.Agents[i].Metrics) < forecastRank(out.Agents[j].AtRisk, out.Agents[j].Metrics)
+	})
+	for _, p := range out.Probes {
+		if p.AtRisk {
+			out.AtRiskCount++
+		}
+	}
+	for _, a := range out.Agents {
+		if a.AtRisk {
+			out.AtRiskCount++
+		}
+	}
+	return out, nil
+}
+
+// forecastSeries fits a line through the daily points and checks whether
+// the projection crosses threshold within horizon. breachAbove selects
+// the breach side (latency/loss rise, bandwidth/health fall). Returns
+// false when the series is too short to fit.
+func forecastSeries(metric, unit string, points []ForecastPoint, threshold float64, breachAbove bool, now time.Time, horizon time.Duration) (MetricForecast, bool) {
+	if len(points) < minForecastPoints {
+		return MetricForecast{}, false
+	}
+	origin := points[0].Timestamp
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i] = p.Timestamp.Sub(origin).Hours() / 24
+		ys[i] = p.Value
+	}
+	slope, intercept, r2 := linearFit(xs, ys)
+
+	at := func(t time.Time) float64 {
+		return intercept + slope*t.Sub(origin).Hours()/24
+	}
+	current := at(now)
+	projected := at(now.Add(horizon))
+
+	f := MetricForecast{
+		Metric:       metric,
+		Unit:         unit,
+		Current:      roundTo(current, 2),
+		SlopePerWeek: roundTo(slope*7, 3),
+		Projected:    roundTo(projected, 2),
+		Threshold:    threshold,
+		Direction:    "above",
+		RSquared:     roundTo(r2, 3),
+		Points:       points,
+	}
+	if !breachAbove {
+		f.Direction = "below"
+	}
+
+	breached := func(v float64) bool {
+		if breachAbove {
+			return v > threshold
+		}
+		return v < threshold
+	}
+	switch {
+	case breached(current):
+		t := now
+		f.WillBreach = true
+		f.BreachAt = &t
+	case slope != 0 && breached(projected):
+		// Solve intercept + slope*x = threshold for the crossing day.
+		days := (threshold - intercept) / slope
+		t := origin.Add(time.Duration(days * 24 * float64(time.Hour)))
+		f.WillBreach = true
+		f.BreachAt = &t
+		f.WeeksToBreach = roundTo(t.Sub(now).Hours()/(24*7), 1)
+	}
+	return f, true
+}
+
+// linearFit returns the least-squares slope, intercept, and coefficient
+// of determination for y = intercept + slope*x. A flat or degenerate
+// series returns slope 0 with the mean as intercept.
+func linearFit(xs, ys []float64) (slope, intercept, r2 float64) {
+	n := float64(len(xs))
+	if n == 0 || len(xs) != len(ys) {
+		return 0, 0, 0
+	}
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, meanY, 0
+	}
+	slope = sxy / sxx
+	intercept = meanY - slope*meanX
+	if syy > 0 {
+		r2 = (sxy * sxy) / (sxx * syy)
+	}
+	return slope, intercept, r2
+}
+
+func anyBreach(ms []MetricForecast) bool {
+	for _, m := range ms {
+		if m.WillBreach {
+			return true
+		}
+	}
+	return false
+}
+
+// forecastRank orders entries by soonest projected breach; entries that
+// never breach sort last.
+func forecastRank(atRisk bool, ms []MetricForecast) float64 {
+	if !atRisk {
+		return math.MaxFloat64
+	}
+	best := math.MaxFloat64
+	for _, m := range ms {
+		if m.WillBreach && m.WeeksToBreach < best {
+			best = m.WeeksToBreach
+		}
+	}
+	return best
+}
+
+func forecastProbeTarget(p Probe, agentByID map[uint]agentInfo) string {
+	if len(p.Targets) == 0 {
+		return ""
+	}
+	t := p.Targets[0]
+	if t.AgentID != nil {
+		if a, ok := agentByID[*t.AgentID]; ok {
+			return a.Name
+		}
+		return fmt.Sprintf("agent %d", *t.AgentID)
+	}
+	return stripPort(t.Target)
+}
+
+func roundTo(v float64, places int) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
+
+// ── Rollup fetchers ──
+
+type dailyRollupKey struct {
+	ProbeID uint
+	AgentID uint
+}
+
+type dailyRollup struct {
+	latency []ForecastPoint
+	loss    []ForecastPoint
+}
+
+// getDailyProbeRollups aggregates PING and TRAFFICSIM rows to one
+// latency/loss point per (probe, reporting agent, day). Aggregation runs
+// in ClickHouse so a month of 1-minute samples comes back as ~30 rows
+// per probe rather than ~43k raw payloads.
+func getDailyProbeRollups(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) (map[dailyRollupKey]*dailyRollup, error) {
+	out := make(map[dailyRollupKey]*dailyRollup)
+	if len(agentIDs) == 0 {
+		return out, nil
+	}
+	agentIDStrs := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		agentIDStrs[i] = fmt.Sprintf("%d", id)
+	}
+
+	q := fmt.Sprintf(`
+SELECT
+    probe_id,
+    agent_id,
+    toStartOfDay(created_at) AS day,
+    avg(if(type = 'PING',
+        %s / 1000000.0,
+        JSONExtractFloat(payload_raw, 'averageRTT'))) AS lat,
+    avg(if(type = 'PING',
+        %s,
+        JSONExtractFloat(payload_raw, 'lossPercentage'))) AS loss
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND agent_id IN (%s)
+  AND created_at >= %s
+GROUP BY probe_id, agent_id, day
+ORDER BY day ASC
+`, pingAvgRttNsSQL, pingLossSQL, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var probeID, agentID uint64
+		var day time.Time
+		var lat, loss sql.NullFloat64
+		if err := rows.Scan(&probeID, &agentID, &day, &lat, &loss); err != nil {
+			continue
+		}
+		key := dailyRollupKey{ProbeID: uint(probeID), AgentID: uint(agentID)}
+		r := out[key]
+		if r == nil {
+			r = &dailyRollup{}
+			out[key] = r
+		}
+		if lat.Valid && lat.Float64 > 0 {
+			r.latency = append(r.latency, ForecastPoint{Timestamp: day.UTC(), Value: roundTo(lat.Float64, 2)})
+		}
+		if loss.Valid {
+			r.loss = append(r.loss, ForecastPoint{Timestamp: day.UTC(), Value: roundTo(loss.Float64, 3)})
+		}
+	}
+	return out, rows.Err()
+}
+
+// getDailyAgentHealth averages each agent's overall health per day from
+// the stored analysis snapshots.
+func getDailyAgentHealth(ctx context.Context, ch *sql.DB, workspaceID uint, from time.Time) map[uint][]ForecastPoint {
+	out := make(map[uint][]ForecastPoint)
+
+	q := fmt.Sprintf(`
+SELECT generated_at, agents_json
+FROM analysis_snapshots
+WHERE workspace_id = %d
+  AND generated_at >= %s
+ORDER BY generated_at ASC
+`, workspaceID, chQuoteTime(from))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		log.Warnf("[forecast] workspace=%d snapshot query error: %v", workspaceID, err)
+		return out
+	}
+	defer rows.Close()
+
+	type accum struct {
+		total float64
+		count int
+	}
+	byAgentDay := make(map[uint]map[time.Time]*accum)
+	for rows.Next() {
+		var generatedAt time.Time
+		var agentsJSON string
+		if err := rows.Scan(&generatedAt, &agentsJSON); err != nil || agentsJSON == "" {
+			continue
+		}
+		var agents []AgentHealthSummary
+		if err := json.Unmarshal([]byte(agentsJSON), &agents); err != nil {
+			continue
+		}
+		day := generatedAt.UTC().Truncate(24 * time.Hour)
+		for _, a := range agents {
+			// Offline/no-data snapshots carry a synthetic 0 that would
+			// swamp the trend; forecast only measured health.
+			if !a.IsOnline || a.Health.Grade == "unknown" {
+				continue
+			}
+			if byAgentDay[a.AgentID] == nil {
+				byAgentDay[a.AgentID] = make(map[time.Time]*accum)
+			}
+			acc := byAgentDay[a.AgentID][day]
+			if acc == nil {
+				acc = &accum{}
+				byAgentDay[a.AgentID][day] = acc
+			}
+			acc.total += a.Health.OverallHealth
+			acc.count++
+		}
+	}
+
+	for agentID, days := range byAgentDay {
+		pts := make([]ForecastPoint, 0, len(days))
+		for day, acc := range days {
+			pts = append(pts, ForecastPoint{Timestamp: day, Value: roundTo(acc.total/float64(acc.count), 1)})
+		}
+		sort.Slice(pts, func(i, j int) bool { return pts[i].Timestamp.Before(pts[j].Timestamp) })
+		out[agentID] = pts
+	}
+	return out
+}
+
+// getDailyAgentBandwidth averages each agent's speedtest download rate
+// (Mbps) per day.
+func getDailyAgentBandwidth(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) map[uint][]ForecastPoint {
+	out := make(map[uint][]ForecastPoint)
+	if len(agentIDs) == 0 {
+		return out
+	}
+	agentIDStrs := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		agentIDStrs[i] = fmt.Sprintf("%d", id)
+	}
+
+	q := fmt.Sprintf(`
+SELECT agent_id, created_at, dl_bps
+FROM speedtest_data
+WHERE type = 'SPEEDTEST'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND dl_bps > 0
+ORDER BY created_at ASC
+LIMIT 5000
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		log.Warnf("[forecast] speedtest query error: %v", err)
+		return out
+	}
+	defer rows.Close()
+
+	type accum struct {
+		total float64
+		count int
+	}
+	byAgentDay := make(map[uint]map[time.Time]*accum)
+	for rows.Next() {
+		var agentID uint64
+		var createdAt time.Time
+		var dlBps float64
+		if err := rows.Scan(&agentID, &createdAt, &dlBps); err != nil {
+			continue
+		}
+		mbps := dlBps / 1_000_000
+		aid := uint(agentID)
+		day := createdAt.UTC().Truncate(24 * time.Hour)
+		if byAgentDay[aid] == nil {
+			byAgentDay[aid] = make(map[time.Time]*accum)
+		}
+		acc := byAgentDay[aid][day]
+		if acc == nil {
+			acc = &accum{}
+			byAgentDay[aid][day] = acc
+		}
+		acc.total += mbps
+		acc.count++
+	}
+
+	for agentID, days := range byAgentDay {
+		pts := make([]ForecastPoint, 0, len(days))
+		for day, acc := range days {
+			pts = append(pts, ForecastPoint{Timestamp: day, Value: roundTo(acc.total/float64(acc.count), 1)})
+		}
+		sort.Slice(pts, func(i, j int) bool { return pts[i].Timestamp.Before(pts[j].Timestamp) })
+		out[agentID] = pts
+	}
+	return out
+}
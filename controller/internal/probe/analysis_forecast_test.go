@@ -0,0 +1,92 @@
+package probe
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func forecastTestSeries(start time.Time, days int, f func(day int) float64) []ForecastPoint {
+	pts := make([]ForecastPoint, days)
+	for i := 0; i < days; i++ {
+		pts[i] = ForecastPoint{Timestamp: start.AddDate(0, 0, i), Value: f(i)}
+	}
+	return pts
+}
+
+// TestLinearFitExact verifies slope/intercept recovery on a perfect line
+// and that a flat series reports zero slope.
+func TestLinearFitExact(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	ys := []float64{10, 12, 14, 16, 18}
+	slope, intercept, r2 := linearFit(xs, ys)
+	if math.Abs(slope-2) > 1e-9 || math.Abs(intercept-10) > 1e-9 {
+		t.Errorf("expected slope=2 intercept=10, got slope=%v intercept=%v", slope, intercept)
+	}
+	if math.Abs(r2-1) > 1e-9 {
+		t.Errorf("expected r2=1 for perfect fit, got %v", r2)
+	}
+
+	slope, intercept, _ = linearFit([]float64{0, 1, 2}, []float64{5, 5, 5})
+	if slope != 0 || intercept != 5 {
+		t.Errorf("flat series: expected slope=0 intercept=5, got %v %v", slope, intercept)
+	}
+}
+
+// TestForecastSeriesProjectsBreach verifies a rising latency series is
+// flagged with a breach date inside the horizon.
+func TestForecastSeriesProjectsBreach(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 100ms rising 2ms/day; day 29 = 158ms is already over 150, so use
+	// a 20-day window: day 19 = 138ms, crossing 150 on day 25.
+	pts := forecastTestSeries(start, 20, func(d int) float64 { return 100 + 2*float64(d) })
+	now := start.AddDate(0, 0, 19)
+
+	f, ok := forecastSeries("latency", "ms", pts, 150, true, now, 4*7*24*time.Hour)
+	if !ok {
+		t.Fatal("expected a forecast for 20 points")
+	}
+	if !f.WillBreach || f.BreachAt == nil {
+		t.Fatalf("expected breach within horizon, got %+v", f)
+	}
+	want := start.AddDate(0, 0, 25)
+	if d := f.BreachAt.Sub(want); d > time.Hour || d < -time.Hour {
+		t.Errorf("breach at %v, want ~%v", f.BreachAt, want)
+	}
+	if f.WeeksToBreach <= 0 || f.WeeksToBreach > 1 {
+		t.Errorf("expected ~0.9 weeks to breach, got %v", f.WeeksToBreach)
+	}
+	if math.Abs(f.SlopePerWeek-14) > 1e-6 {
+		t.Errorf("expected slope 14ms/week, got %v", f.SlopePerWeek)
+	}
+}
+
+// TestForecastSeriesBelowThreshold verifies falling bandwidth breaches
+// the "below" side and that an improving series does not.
+func TestForecastSeriesBelowThreshold(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.AddDate(0, 0, 13)
+	horizon := 4 * 7 * 24 * time.Hour
+
+	falling := forecastTestSeries(start, 14, func(d int) float64 { return 60 - float64(d) })
+	f, _ := forecastSeries("bandwidth_down", "Mbps", falling, 25, false, now, horizon)
+	if !f.WillBreach || f.Direction != "below" {
+		t.Errorf("falling bandwidth should breach below 25 Mbps, got %+v", f)
+	}
+
+	rising := forecastTestSeries(start, 14, func(d int) float64 { return 60 + float64(d) })
+	f, _ = forecastSeries("bandwidth_down", "Mbps", rising, 25, false, now, horizon)
+	if f.WillBreach {
+		t.Errorf("rising bandwidth should not breach, got %+v", f)
+	}
+}
+
+// TestForecastSeriesTooShort verifies sparse series are skipped rather
+// than fitted.
+func TestForecastSeriesTooShort(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pts := forecastTestSeries(start, minForecastPoints-1, func(d int) float64 { return 10 })
+	if _, ok := forecastSeries("latency", "ms", pts, 150, true, start, time.Hour); ok {
+		t.Error("expected no forecast below minForecastPoints")
+	}
+}
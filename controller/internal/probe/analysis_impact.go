@@ -0,0 +1,199 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Incident Impact Scoring ──
+//
+// Impact ranks incidents so the most important one is listed first. It
+// blends four inputs into a 0-100 score:
+//
+//	severity     45%  critical 1.0, warning 0.6, info 0.25
+//	breadth      30%  share of workspace agents affected, plus a
+//	                  log-scaled count of affected targets
+//	duration     25%  log-scaled minutes since the incident was first seen
+//	                  in consecutive analysis snapshots (saturates at 24h)
+//
+// and multiplies by the criticality weight of the most important
+// affected target (see target_criticality.go), clamped to 100.
+
+const (
+	impactWeightSeverity = 0.45
+	impactWeightBreadth  = 0.30
+	impactWeightDuration = 0.25
+
+	// impactDurationSaturation is the age at which the duration term
+	// reaches 1.0.
+	impactDurationSaturation = 24 * time.Hour
+)
+
+var severityImpact = map[string]float64{
+	"critical": 1.0,
+	"warning":  0.6,
+	"info":     0.25,
+}
+
+// scoreIncidentImpact computes the impact score for one incident.
+func scoreIncidentImpact(inc DetectedIncident, totalAgents int, crit Criticality, age time.Duration) float64 {
+	sev, ok := severityImpact[inc.Severity]
+	if !ok {
+		sev = severityImpact["info"]
+	}
+
+	agentFrac := 0.0
+	if totalAgents > 0 {
+		agentFrac = math.Min(1, float64(len(inc.AffectedAgents))/float64(totalAgents))
+	}
+	// 1 target → 0.25, 3 → 0.5, 15 → 1.0
+	targetTerm := math.Min(1, math.Log2(1+float64(len(inc.AffectedTargets)))/4)
+	breadth := 0.6*agentFrac + 0.4*targetTerm
+
+	dur := 0.0
+	if age > 0 {
+		dur = math.Min(1, math.Log1p(age.Minutes())/math.Log1p(impactDurationSaturation.Minutes()))
+	}
+
+	w, ok := criticalityWeight[crit]
+	if !ok {
+		w = criticalityWeight[CriticalityNormal]
+	}
+
+	score := 100 * (impactWeightSeverity*sev + impactWeightBreadth*breadth + impactWeightDuration*dur) * w
+	return math.Round(math.Min(100, score)*10) / 10
+}
+
+// highestCriticality returns the most important label among targets.
+func highestCriticality(targets []string, labels map[string]Criticality) Criticality {
+	best := CriticalityNormal
+	if len(labels) == 0 {
+		return best
+	}
+	bestSet := false
+	for _, t := range targets {
+		c, ok := labels[t]
+		if !ok {
+			c = CriticalityNormal
+		}
+		if !bestSet || criticalityWeight[c] > criticalityWeight[best] {
+			best, bestSet = c, true
+		}
+	}
+	return best
+}
+
+// incidentFirstSeen walks analysis snapshots newest-first and returns,
+// per incident ID, the earliest generated_at of the unbroken run of
+// snapshots that contain it. IDs are stable across runs (derived from
+// target / agent keys), which is what makes this lookup possible.
+func incidentFirstSeen(ctx context.Context, ch *sql.DB, workspaceID uint, ids map[string]bool, now time.Time) map[string]time.Time {
+	out := make(map[string]time.Time)
+	if ch == nil || len(ids) == 0 {
+		return out
+	}
+	snaps, err := GetAnalysisSnapshots(ctx, ch, workspaceID, now.Add(-impactDurationSaturation), now, 0)
+	if err != nil {
+		return out
+	}
+
+	open := make(map[string]bool, len(ids))
+	for id := range ids {
+		open[id] = true
+	}
+	for _, s := range snaps {
+		if len(open) == 0 {
+			break
+		}
+		var seen []struct {
+			ID string `json:"id"`
+		}
+		if s.IncidentsJSON == "" || json.Unmarshal([]byte(s.IncidentsJSON), &seen) != nil {
+			continue
+		}
+		present := make(map[string]bool, len(seen))
+		for _, inc := range seen {
+			present[inc.ID] = true
+		}
+		for id := range open {
+			if present[id] {
+				out[id] = s.GeneratedAt
+			} else {
+				delete(open, id) // run broken; earlier sightings are a different occurrence
+			}
+		}
+	}
+	return out
+}
+
+// applyIncidentImpact fills in impact fields and sorts incidents by
+// impact (highest first), breaking ties by severity then ID so the order
+// is stable between refreshes.
+func applyIncidentImpact(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, incidents []DetectedIncident, totalAgents int, now time.Time) {
+	if len(incidents) == 0 {
+		return
+	}
+	labels := targetCriticalityMap(ctx, pg, workspaceID)
+	// Probe metadata criticality applies where no explicit label exists.
+	for _, inc := range incidents {
+		for t, m := range inc.TargetMetadata {
+			if _, ok := labels[t]; !ok && m.Criticality != "" {
+				labels[t] = Criticality(m.Criticality)
+			}
+		}
+	}
+	ids := make(map[string]bool, len(incidents))
+	for _, inc := range incidents {
+		ids[inc.ID] = true
+	}
+	firstSeen := incidentFirstSeen(ctx, ch, workspaceID, ids, now)
+
+	for i := range incidents {
+		inc := &incidents[i]
+		crit := highestCriticality(inc.AffectedTargets, labels)
+		var age time.Duration
+		if t, ok := firstSeen[inc.ID]; ok {
+			ft := t
+			inc.FirstSeenAt = &ft
+			age = now.Sub(t)
+			inc.DurationMinutes = int(age.Minutes())
+		}
+		inc.Criticality = string(crit)
+		inc.ImpactScore = scoreIncidentImpact(*inc, totalAgents, crit, age)
+	}
+
+	sortIncidentsByImpact(incidents)
+}
+
+func sortIncidentsByImpact(incidents []DetectedIncident) {
+	sort.SliceStable(incidents, func(i, j int) bool {
+		a, b := incidents[i], incidents[j]
+		if a.ImpactScore != b.ImpactScore {
+			return a.ImpactScore > b.ImpactScore
+		}
+		if sa, sb := severityImpact[a.Severity], severityImpact[b.Severity]; sa != sb {
+			return sa > sb
+		}
+		return a.ID < b.ID
+	})
+}
+
+// FilterIncidentsByImpact drops incidents below minImpact in place.
+func FilterIncidentsByImpact(incidents []DetectedIncident, minImpact float64) []DetectedIncident {
+	if minImpact <= 0 {
+		return incidents
+	}
+	out := incidents[:0]
+	for _, inc := range incidents {
+		if inc.ImpactScore >= minImpact {
+			out = append(out, inc)
+		}
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestIncidentImpactOrdering verifies that breadth, duration and target
+// criticality lift an incident above a narrower one of equal severity.
+func TestIncidentImpactOrdering(t *testing.T) {
+	narrow := DetectedIncident{ID: "a", Severity: "warning", AffectedAgents: []string{"a1"}, AffectedTargets: []string{"10.0.0.1"}}
+	wide := DetectedIncident{ID: "b", Severity: "warning", AffectedAgents: []string{"a1", "a2", "a3"}, AffectedTargets: []string{"10.0.0.2"}}
+
+	n := scoreIncidentImpact(narrow, 4, CriticalityNormal, 0)
+	w := scoreIncidentImpact(wide, 4, CriticalityNormal, 0)
+	if w <= n {
+		t.Errorf("wide incident %.1f should outrank narrow %.1f", w, n)
+	}
+
+	if old := scoreIncidentImpact(narrow, 4, CriticalityNormal, 6*time.Hour); old <= n {
+		t.Errorf("long-running incident %.1f should outrank fresh %.1f", old, n)
+	}
+	if crit := scoreIncidentImpact(narrow, 4, CriticalityCritical, 0); crit <= w {
+		t.Errorf("critical-target incident %.1f should outrank wide normal %.1f", crit, w)
+	}
+	if info := scoreIncidentImpact(DetectedIncident{Severity: "info"}, 4, CriticalityCritical, 48*time.Hour); info > 100 {
+		t.Errorf("impact %.1f exceeds 100", info)
+	}
+}
+
+// TestApplyIncidentImpactUsesCriticality verifies labels stored for a
+// workspace are picked up and incidents come back sorted by impact.
+func TestApplyIncidentImpactUsesCriticality(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&TargetCriticality{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := SetTargetCriticality(ctx, db, 1, "pay.example.com", CriticalityCritical); err != nil {
+		t.Fatalf("set criticality: %v", err)
+	}
+	// Upsert and clear paths.
+	if _, err := SetTargetCriticality(ctx, db, 1, "test.example.com", CriticalityHigh); err != nil {
+		t.Fatalf("set criticality: %v", err)
+	}
+	if _, err := SetTargetCriticality(ctx, db, 1, "test.example.com", CriticalityNormal); err != nil {
+		t.Fatalf("clear criticality: %v", err)
+	}
+	if rows, _ := ListTargetCriticality(ctx, db, 1); len(rows) != 1 {
+		t.Fatalf("expected 1 labelled target, got %d", len(rows))
+	}
+
+	incidents := []DetectedIncident{
+		{ID: "test", Severity: "warning", AffectedAgents: []string{"a1", "a2"}, AffectedTargets: []string{"test.example.com"}},
+		{ID: "pay", Severity: "warning", AffectedAgents: []string{"a1"}, AffectedTargets: []string{"pay.example.com"}},
+	}
+	applyIncidentImpact(ctx, nil, db, 1, incidents, 4, time.Now())
+
+	if incidents[0].ID != "pay" {
+		t.Fatalf("expected critical-target incident first, got %q (%.1f vs %.1f)",
+			incidents[0].ID, incidents[0].ImpactScore, incidents[1].ImpactScore)
+	}
+	if incidents[0].Criticality != string(CriticalityCritical) {
+		t.Errorf("criticality = %q, want critical", incidents[0].Criticality)
+	}
+	if got := FilterIncidentsByImpact(incidents, incidents[0].ImpactScore); len(got) != 1 {
+		t.Errorf("min_impact filter kept %d incidents, want 1", len(got))
+	}
+}
@@ -174,7 +174,7 @@ func detectIncidents(
 				SuggestedCause:  "Agent has not reported in — possible host outage, network partition, or agent service failure",
 				AffectedAgents:  []string{agent.AgentName},
 				AffectedTargets: []string{},
-				Evidence:        []string{"Agent has not sent a heartbeat within the expected interval"},
+				Evidence:        []string{offlineEvidence(agent)},
 				Recommendations: []string{
 					fmt.Sprintf("Check if the host running %s is reachable", agent.AgentName),
 					"Verify the agent service is running (systemctl status netwatcher-agent)",
@@ -182,6 +182,8 @@ func detectIncidents(
 				},
 				Confidence: 0.95,
 			})
+		} else if agent.Connectivity == ConnectivityDegraded {
+			incidents = append(incidents, degradedConnectivityIncident(agent))
 		} else if agent.Health.Grade == "critical" || agent.Health.Grade == "poor" {
 			var worstTargets []string
 			for _, p := range agent.WorstProbes {
@@ -213,7 +215,7 @@ func detectIncidents(
 	// 3. Infrastructure-wide detection: majority of agents degraded
 	degradedCount := 0
 	for _, agent := range agents {
-		if !agent.IsOnline || agent.Health.Grade == "critical" || agent.Health.Grade == "poor" {
+		if !agent.IsOnline || agent.Connectivity == ConnectivityDegraded || agent.Health.Grade == "critical" || agent.Health.Grade == "poor" {
 			degradedCount++
 		}
 	}
@@ -299,7 +301,7 @@ func buildStatusSummary(health HealthVector, agents []AgentHealthSummary, incide
 	for _, a := range agents {
 		if !a.IsOnline {
 			offlineCount++
-		} else if a.Health.Grade == "critical" || a.Health.Grade == "poor" {
+		} else if a.Connectivity == ConnectivityDegraded || a.Health.Grade == "critical" || a.Health.Grade == "poor" {
 			degradedCount++
 		}
 	}
@@ -560,7 +562,7 @@ func detectTemporalChanges(
 		}
 	}
 
-	// 4. NetInfo changes (IP/ISP changes)
+	// 4. NetInfo changes (IP/ISP, gateway, DNS, interfaces, VPN)
 	for _, change := range netInfoChanges {
 		agentName := fmt.Sprintf("Agent %d", change.AgentID)
 		if a, ok := agentByID[change.AgentID]; ok {
@@ -605,6 +607,10 @@ func detectTemporalChanges(
 					"Review SD-WAN or dual-WAN configuration if applicable",
 				},
 			})
+		default:
+			if inc, ok := netInfoChangeIncident(change, agentName); ok {
+				incidents = append(incidents, inc)
+			}
 		}
 	}
 
@@ -637,6 +643,7 @@ func detectSpeedtestIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint,
 
 		agentName := resolveAgentName(key, agentByID)
 		target := extractTarget(key)
+		serverFrom, serverTo, serverSwitched := speedtestServerSwitch(base, curr)
 
 		// Download regression: >50% drop when baseline was >10 Mbps
 		if base.AvgDownload > 10 && curr.AvgDownload < base.AvgDownload*0.5 {
@@ -664,6 +671,9 @@ func detectSpeedtestIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint,
 				},
 				Confidence: 0.75,
 			})
+			if serverSwitched {
+				markSpeedtestServerArtifact(&incidents[len(incidents)-1], "Download", base.AvgDownload, curr.AvgDownload, serverFrom, serverTo)
+			}
 		}
 
 		// Upload regression
@@ -690,6 +700,9 @@ func detectSpeedtestIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint,
 				},
 				Confidence: 0.70,
 			})
+			if serverSwitched {
+				markSpeedtestServerArtifact(&incidents[len(incidents)-1], "Upload", base.AvgUpload, curr.AvgUpload, serverFrom, serverTo)
+			}
 		}
 	}
 
@@ -713,10 +726,10 @@ SELECT agent_id, target, payload_raw
 FROM probe_data
 WHERE type = 'DNS'
   AND agent_id IN (%s)
-  AND created_at >= %s
+  AND created_at >= %s%s
 ORDER BY created_at DESC
 LIMIT 1000
-`, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
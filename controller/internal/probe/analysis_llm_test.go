@@ -0,0 +1,38 @@
+package probe
+
+import "testing"
+
+func TestLLMCacheKey(t *testing.T) {
+	status := StatusSummary{Status: "degraded"}
+	health := HealthVector{Grade: "fair", OverallHealth: 71}
+	incidents := []DetectedIncident{
+		{ID: "shared_target_1_1_1_1", Severity: "warning", AffectedAgents: []string{"hq", "branch"}, Evidence: []string{"loss 3%"}},
+		{ID: "agent_offline_4", Severity: "critical", AffectedAgents: []string{"lab"}},
+	}
+	key := llmCacheKey(status, health, incidents)
+
+	// Order, evidence and scores don't change the key.
+	same := []DetectedIncident{
+		{ID: "agent_offline_4", Severity: "critical", AffectedAgents: []string{"lab"}},
+		{ID: "shared_target_1_1_1_1", Severity: "warning", AffectedAgents: []string{"branch", "hq"}, Evidence: []string{"loss 5%"}},
+	}
+	if got := llmCacheKey(status, HealthVector{Grade: "fair", OverallHealth: 68}, same); got != key {
+		t.Errorf("key changed for equivalent inputs: %s != %s", got, key)
+	}
+
+	escalated := append([]DetectedIncident(nil), incidents...)
+	escalated[0].Severity = "critical"
+	spread := append([]DetectedIncident(nil), incidents...)
+	spread[0].AffectedAgents = []string{"hq", "branch", "dc"}
+	for name, k := range map[string]string{
+		"grade":     llmCacheKey(status, HealthVector{Grade: "poor"}, incidents),
+		"status":    llmCacheKey(StatusSummary{Status: "outage"}, health, incidents),
+		"resolved":  llmCacheKey(status, health, incidents[:1]),
+		"escalated": llmCacheKey(status, health, escalated),
+		"spread":    llmCacheKey(status, health, spread),
+	} {
+		if k == key {
+			t.Errorf("%s: key unchanged", name)
+		}
+	}
+}
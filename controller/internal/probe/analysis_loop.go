@@ -3,13 +3,15 @@ package probe
 import (
 	"context"
 	"database/sql"
-	"os"
 	"runtime"
 	"strconv"
 	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/logging"
+	"netwatcher-controller/internal/settings"
+
 	"gorm.io/gorm"
 )
 
@@ -22,13 +24,13 @@ type AnalysisLoopConfig struct {
 // LoadAnalysisLoopConfig loads config from environment variables
 func LoadAnalysisLoopConfig() AnalysisLoopConfig {
 	interval := 300 // default 5 minutes
-	if v := os.Getenv("ANALYSIS_INTERVAL"); v != "" {
+	if v := settings.Getenv("ANALYSIS_INTERVAL"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			interval = n
 		}
 	}
 	maxConcurrent := runtime.GOMAXPROCS(0) * 4
-	if v := os.Getenv("ANALYSIS_MAX_CONCURRENT"); v != "" {
+	if v := settings.Getenv("ANALYSIS_MAX_CONCURRENT"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil && n > 0 {
 			maxConcurrent = n
 		}
@@ -39,12 +41,33 @@ func LoadAnalysisLoopConfig() AnalysisLoopConfig {
 	}
 }
 
+// analysisReconfig carries a new config to the running loop.
+var analysisReconfig = make(chan AnalysisLoopConfig, 1)
+
+// ReconfigureAnalysisLoop applies a new interval and concurrency to the
+// running analysis loop, from its next cycle.
+func ReconfigureAnalysisLoop(config AnalysisLoopConfig) {
+	if config.Interval <= 0 || config.MaxConcurrent <= 0 {
+		return
+	}
+	select {
+	case <-analysisReconfig:
+	default:
+	}
+	analysisReconfig <- config
+}
+
 // StartAnalysisLoop runs workspace analysis periodically in the background.
 // It evaluates all workspaces with active agents, computes health analysis,
 // and fires alerts for any detected incidents matching alert rules.
 // Large deployments are processed in parallel up to MaxConcurrent workers.
 func StartAnalysisLoop(ctx context.Context, ch *sql.DB, pg *gorm.DB, config AnalysisLoopConfig) {
-	log.Infof("[analysis_loop] starting background analysis (interval: %s, max_concurrent: %d)", config.Interval, config.MaxConcurrent)
+	analysisLog.Infof("[analysis_loop] starting background analysis (interval: %s, max_concurrent: %d)", config.Interval, config.MaxConcurrent)
+
+	health.Register("analysis_loop", config.Interval, 30*time.Second)
+
+	// Ingest-triggered runs (see analysis_trigger.go)
+	go runAnalysisTriggers(ctx, ch, pg, config.MaxConcurrent)
 
 	// Initial delay to let the system settle after startup
 	select {
@@ -59,10 +82,17 @@ func StartAnalysisLoop(ctx context.Context, ch *sql.DB, pg *gorm.DB, config Anal
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("[analysis_loop] shutting down")
+			health.Stop("analysis_loop")
+			analysisLog.Info("[analysis_loop] shutting down")
 			return
+		case next := <-analysisReconfig:
+			config = next
+			ticker.Reset(config.Interval)
+			health.Register("analysis_loop", config.Interval, 0)
+			analysisLog.Infof("[analysis_loop] reconfigured (interval: %s, max_concurrent: %d)", config.Interval, config.MaxConcurrent)
 		case <-ticker.C:
 			runAnalysisCycle(ctx, ch, pg, config)
+			health.Beat("analysis_loop")
 		}
 	}
 }
@@ -73,7 +103,7 @@ func runAnalysisCycle(ctx context.Context, ch *sql.DB, pg *gorm.DB, config Analy
 	// Get all workspace IDs that have at least one agent
 	workspaceIDs, err := getActiveWorkspaceIDs(ctx, pg)
 	if err != nil {
-		log.Warnf("[analysis_loop] failed to get workspace IDs: %v", err)
+		analysisLog.Warnf("[analysis_loop] failed to get workspace IDs: %v", err)
 		return
 	}
 
@@ -89,21 +119,41 @@ func runAnalysisCycle(ctx context.Context, ch *sql.DB, pg *gorm.DB, config Analy
 	}
 
 	elapsed := time.Since(start)
-	log.Debugf("[analysis_loop] completed %d workspaces in %s", len(workspaceIDs), elapsed.Round(time.Millisecond))
+	analysisLog.WithField(logging.FieldDuration, elapsed.Milliseconds()).Debugf("[analysis_loop] completed %d workspaces in %s", len(workspaceIDs), elapsed.Round(time.Millisecond))
 }
 
-func runSingleWorkspace(ctx context.Context, ch *sql.DB, pg *gorm.DB, wsID uint) {
+// runSingleWorkspace analyses one workspace and acts on the result. It
+// returns the number of incidents detected.
+func runSingleWorkspace(ctx context.Context, ch *sql.DB, pg *gorm.DB, wsID uint) int {
+	defer lockWorkspaceRun(wsID)()
+
 	analysis, err := ComputeWorkspaceAnalysis(ctx, ch, pg, wsID, 60)
 	if err != nil {
-		log.Warnf("[analysis_loop] workspace %d analysis failed: %v", wsID, err)
-		return
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] analysis failed: %v", err)
+		return 0
 	}
 	if err := SaveAnalysisSnapshot(ctx, ch, analysis); err != nil {
-		log.Warnf("[analysis_loop] workspace %d snapshot save failed: %v", wsID, err)
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] snapshot save failed: %v", err)
+	}
+	if err := CaptureIncidentEvidence(ctx, ch, pg, analysis); err != nil {
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] evidence capture failed: %v", err)
+	}
+	if err := CaptureIncidentMapSnapshots(ctx, ch, pg, analysis); err != nil {
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] map snapshot capture failed: %v", err)
+	}
+	if err := RecordIncidentHistory(ctx, pg, analysis); err != nil {
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] incident history failed: %v", err)
+	}
+	if err := CaptureIncidentSamples(ctx, ch, pg, analysis); err != nil {
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] incident samples failed: %v", err)
+	}
+	if err := SyncIncidentTickets(ctx, pg, analysis); err != nil {
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] ticket sync failed: %v", err)
 	}
 	if err := EvaluateAnalysisIncidents(ctx, pg, wsID, analysis); err != nil {
-		log.Warnf("[analysis_loop] workspace %d alert eval failed: %v", wsID, err)
+		analysisLog.WithField(logging.FieldWorkspace, wsID).Warnf("[analysis_loop] alert eval failed: %v", err)
 	}
+	return len(analysis.Incidents)
 }
 
 func runWorkspacesParallel(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceIDs []uint, maxConcurrent int) {
@@ -119,33 +169,22 @@ func runWorkspacesParallel(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspa
 			sem <- struct{}{}        // acquire
 			defer func() { <-sem }()  // release
 
-			analysis, err := ComputeWorkspaceAnalysis(ctx, ch, pg, id, 60)
-			if err != nil {
-				log.Warnf("[analysis_loop] workspace %d analysis failed: %v", id, err)
-				return
-			}
-			if err := SaveAnalysisSnapshot(ctx, ch, analysis); err != nil {
-				log.Warnf("[analysis_loop] workspace %d snapshot save failed: %v", id, err)
-			}
-			if err := EvaluateAnalysisIncidents(ctx, pg, id, analysis); err != nil {
-				log.Warnf("[analysis_loop] workspace %d alert eval failed: %v", id, err)
-			}
+			n := runSingleWorkspace(ctx, ch, pg, id)
 			mu.Lock()
-			totalIncidents += len(analysis.Incidents)
+			totalIncidents += n
 			mu.Unlock()
 		}(wsID)
 	}
 
 	wg.Wait()
 	if totalIncidents > 0 {
-		log.Infof("[analysis_loop] completed %d workspaces in parallel (%d incidents detected)", len(workspaceIDs), totalIncidents)
+		analysisLog.Infof("[analysis_loop] completed %d workspaces in parallel (%d incidents detected)", len(workspaceIDs), totalIncidents)
 	}
 }
 
 func getActiveWorkspaceIDs(ctx context.Context, pg *gorm.DB) ([]uint, error) {
 	var ids []uint
-	err := pg.WithContext(ctx).
-		Table("agents").
+	err := ownedAgents(pg.WithContext(ctx).Table("agents")).
 		Where("deleted_at IS NULL").
 		Distinct("workspace_id").
 		Pluck("workspace_id", &ids).Error
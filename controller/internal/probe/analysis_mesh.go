@@ -212,7 +212,7 @@ func buildHealthMesh(
 			AgentID:   a.ID,
 			AgentName: a.Name,
 			Location:  a.Location,
-			IsOnline:  time.Since(a.UpdatedAt) < time.Minute,
+			IsOnline:  a.connectivity(time.Now()) != ConnectivityOffline,
 			LinkCount: nodeLinks[a.ID],
 		}
 		if w := nodeWeight[a.ID]; w > 0 {
@@ -0,0 +1,260 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Full-Mesh Health Matrix ─────────────────────────────────────────────────
+//
+// NxN source→destination matrix of latency / loss / MOS for workspaces
+// that probe between their own agents (PING and TRAFFICSIM with a
+// target_agent). Unlike the chord mesh in analysis_mesh.go this
+// aggregates entirely in ClickHouse — one GROUP BY over
+// (agent_id, target_agent) — so it stays cheap for large meshes where
+// pulling raw payloads would hit row limits.
+//
+// Rows are sources (the reporting agent), columns are destinations.
+// With group_by=location agents sharing a Location collapse into one
+// site and cells become sample-weighted site-to-site aggregates; the
+// diagonal then holds intra-site paths.
+
+// MeshGroupBy selects the matrix axis granularity.
+type MeshGroupBy string
+
+const (
+	MeshGroupByAgent    MeshGroupBy = "agent"
+	MeshGroupByLocation MeshGroupBy = "location"
+)
+
+// MeshMatrixAxis is one row/column label.
+type MeshMatrixAxis struct {
+	Key      string `json:"key"` // agent ID, or location name
+	Name     string `json:"name"`
+	AgentIDs []uint `json:"agent_ids"`
+}
+
+// MeshMatrixCell is one source→destination aggregate. Nil cells in the
+// matrix mean no probe data between that pair.
+type MeshMatrixCell struct {
+	LatencyMs    float64  `json:"latency_ms"`
+	P95LatencyMs float64  `json:"p95_latency_ms"`
+	LossPct      float64  `json:"loss_pct"`
+	JitterMs     float64  `json:"jitter_ms"`
+	Mos          float64  `json:"mos"`
+	Health       float64  `json:"health"`
+	Grade        string   `json:"grade"`
+	Samples      int      `json:"samples"`
+	ProbeTypes   []string `json:"probe_types"`
+}
+
+// WorkspaceMeshMatrix is the heatmap payload.
+type WorkspaceMeshMatrix struct {
+	WorkspaceID     uint                `json:"workspace_id"`
+	GroupBy         MeshGroupBy         `json:"group_by"`
+	LookbackMinutes int                 `json:"lookback_minutes"`
+	Axis            []MeshMatrixAxis    `json:"axis"`
+	Cells           [][]*MeshMatrixCell `json:"cells"` // [source][destination]
+	GeneratedAt     time.Time           `json:"generated_at"`
+}
+
+// meshPairRow is one (source, destination, probe type) aggregate from
+// ClickHouse.
+type meshPairRow struct {
+	src, dst  uint
+	probeType string
+	samples   int
+	latency   float64
+	p95       float64
+	loss      float64
+	jitter    float64
+}
+
+// ComputeWorkspaceMeshMatrix builds the NxN matrix for a workspace.
+func ComputeWorkspaceMeshMatrix(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, lookbackMinutes int, groupBy MeshGroupBy) (*WorkspaceMeshMatrix, error) {
+	if lookbackMinutes <= 0 {
+		lookbackMinutes = 60
+	}
+	if groupBy != MeshGroupByLocation {
+		groupBy = MeshGroupByAgent
+	}
+	from := time.Now().UTC().Add(-time.Duration(lookbackMinutes) * time.Minute)
+
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+
+	rows, err := getMeshPairRows(ctx, ch, agents, from)
+	if err != nil {
+		return nil, fmt.Errorf("mesh query: %w", err)
+	}
+
+	m := buildMeshMatrix(agents, rows, groupBy)
+	m.WorkspaceID = workspaceID
+	m.LookbackMinutes = lookbackMinutes
+	return m, nil
+}
+
+func getMeshPairRows(ctx context.Context, ch *sql.DB, agents []agentInfo, from time.Time) ([]meshPairRow, error) {
+	if len(agents) < 2 {
+		return nil, nil
+	}
+	ids := make([]string, len(agents))
+	for i, a := range agents {
+		ids[i] = fmt.Sprintf("%d", a.ID)
+	}
+	idList := strings.Join(ids, ", ")
+
+	pingLat := pingAvgRttNsSQL + " / 1000000.0"
+	q := fmt.Sprintf(`
+SELECT
+    agent_id,
+    target_agent,
+    type,
+    count() AS samples,
+    avg(if(type = 'PING', %[1]s, JSONExtractFloat(payload_raw, 'averageRTT'))) AS lat,
+    quantile(0.95)(if(type = 'PING', %[1]s, JSONExtractFloat(payload_raw, 'averageRTT'))) AS p95,
+    avg(if(type = 'PING', %[2]s, JSONExtractFloat(payload_raw, 'lossPercentage'))) AS loss,
+    avg(if(type = 'PING', %[3]s / 1000000.0, JSONExtractFloat(payload_raw, 'jitterAvg'))) AS jitter
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND agent_id IN (%[4]s)
+  AND target_agent IN (%[4]s)
+  AND target_agent != agent_id
+  AND created_at >= %[5]s
+GROUP BY agent_id, target_agent, type
+`, pingLat, pingLossSQL, pingStdDevNsSQL, idList, chQuoteTime(from))
+
+	rs, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	var out []meshPairRow
+	for rs.Next() {
+		var src, dst, n uint64
+		var typ string
+		var lat, p95, loss, jit sql.NullFloat64
+		if err := rs.Scan(&src, &dst, &typ, &n, &lat, &p95, &loss, &jit); err != nil {
+			return nil, err
+		}
+		out = append(out, meshPairRow{
+			src:       uint(src),
+			dst:       uint(dst),
+			probeType: typ,
+			samples:   int(n),
+			latency:   sanitizeFloat(lat.Float64),
+			p95:       sanitizeFloat(p95.Float64),
+			loss:      sanitizeFloat(loss.Float64),
+			jitter:    sanitizeFloat(jit.Float64),
+		})
+	}
+	return out, rs.Err()
+}
+
+// buildMeshMatrix is the pure aggregation step, separated from the
+// ClickHouse query for tests.
+func buildMeshMatrix(agents []agentInfo, rows []meshPairRow, groupBy MeshGroupBy) *WorkspaceMeshMatrix {
+	// Axis: one entry per agent, or per distinct location. Agents with no
+	// location stay their own site.
+	axisIdx := make(map[uint]int, len(agents))
+	var axis []MeshMatrixAxis
+	sorted := append([]agentInfo(nil), agents...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if groupBy == MeshGroupByLocation && sorted[i].Location != sorted[j].Location {
+			return sorted[i].Location < sorted[j].Location
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	byKey := make(map[string]int)
+	for _, a := range sorted {
+		key, name := fmt.Sprintf("%d", a.ID), a.Name
+		if groupBy == MeshGroupByLocation {
+			if loc := strings.TrimSpace(a.Location); loc != "" {
+				key, name = loc, loc
+			}
+		}
+		i, ok := byKey[key]
+		if !ok {
+			i = len(axis)
+			byKey[key] = i
+			axis = append(axis, MeshMatrixAxis{Key: key, Name: name})
+		}
+		axis[i].AgentIDs = append(axis[i].AgentIDs, a.ID)
+		axisIdx[a.ID] = i
+	}
+
+	type cellAccum struct {
+		samples                int
+		lat, p95, loss, jitter float64 // Σ value × samples
+		types                  map[string]bool
+	}
+	acc := make(map[[2]int]*cellAccum)
+	for _, r := range rows {
+		si, ok1 := axisIdx[r.src]
+		di, ok2 := axisIdx[r.dst]
+		if !ok1 || !ok2 || r.samples <= 0 || r.src == r.dst {
+			continue
+		}
+		k := [2]int{si, di}
+		a := acc[k]
+		if a == nil {
+			a = &cellAccum{types: map[string]bool{}}
+			acc[k] = a
+		}
+		w := float64(r.samples)
+		a.samples += r.samples
+		a.lat += r.latency * w
+		a.p95 += r.p95 * w
+		a.loss += r.loss * w
+		a.jitter += r.jitter * w
+		a.types[r.probeType] = true
+	}
+
+	cells := make([][]*MeshMatrixCell, len(axis))
+	for i := range cells {
+		cells[i] = make([]*MeshMatrixCell, len(axis))
+	}
+	for k, a := range acc {
+		n := float64(a.samples)
+		m := ProbeMetrics{
+			AvgLatency:  a.lat / n,
+			P95Latency:  a.p95 / n,
+			PacketLoss:  a.loss / n,
+			JitterAvg:   a.jitter / n,
+			SampleCount: a.samples,
+		}
+		h := computeHealthVector(m, 100)
+		types := make([]string, 0, len(a.types))
+		for t := range a.types {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		cells[k[0]][k[1]] = &MeshMatrixCell{
+			LatencyMs:    roundTo(m.AvgLatency, 2),
+			P95LatencyMs: roundTo(m.P95Latency, 2),
+			LossPct:      roundTo(m.PacketLoss, 3),
+			JitterMs:     roundTo(m.JitterAvg, 2),
+			Mos:          roundTo(h.MosScore, 2),
+			Health:       h.OverallHealth,
+			Grade:        h.Grade,
+			Samples:      a.samples,
+			ProbeTypes:   types,
+		}
+	}
+
+	return &WorkspaceMeshMatrix{
+		GroupBy:     groupBy,
+		Axis:        axis,
+		Cells:       cells,
+		GeneratedAt: time.Now().UTC(),
+	}
+}
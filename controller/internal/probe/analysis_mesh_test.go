@@ -114,3 +114,66 @@ func TestBuildHealthMeshEmptyWorkspace(t *testing.T) {
 		t.Errorf("empty mesh grade = %q, want unknown", mesh.OverallHealth.Grade)
 	}
 }
+
+// TestBuildMeshMatrixAgentCells verifies the NxN matrix places directed
+// pairs at [source][destination], blends probe types by sample weight and
+// leaves unprobed pairs nil.
+func TestBuildMeshMatrixAgentCells(t *testing.T) {
+	rows := []meshPairRow{
+		{src: 1, dst: 2, probeType: "PING", samples: 30, latency: 20, p95: 25, loss: 0},
+		{src: 1, dst: 2, probeType: "TRAFFICSIM", samples: 10, latency: 40, p95: 50, loss: 2},
+		{src: 2, dst: 3, probeType: "PING", samples: 20, latency: 80, p95: 90, loss: 5},
+		{src: 9, dst: 1, probeType: "PING", samples: 20, latency: 5}, // not in workspace
+	}
+	m := buildMeshMatrix(meshTestAgents(), rows, MeshGroupByAgent)
+
+	if len(m.Axis) != 3 || len(m.Cells) != 3 || len(m.Cells[0]) != 3 {
+		t.Fatalf("expected 3x3 matrix, got axis=%d cells=%d", len(m.Axis), len(m.Cells))
+	}
+	c := m.Cells[0][1]
+	if c == nil {
+		t.Fatal("missing 1→2 cell")
+	}
+	if c.Samples != 40 || c.LatencyMs != 25 || c.LossPct != 0.5 {
+		t.Errorf("1→2 cell = %+v, want 40 samples, 25ms, 0.5%% loss", c)
+	}
+	if len(c.ProbeTypes) != 2 || c.Grade == "" || c.Mos <= 1 {
+		t.Errorf("1→2 cell missing types/grade/mos: %+v", c)
+	}
+	if m.Cells[1][0] != nil {
+		t.Error("2→1 has no data and should be nil")
+	}
+	if m.Cells[1][2] == nil || m.Cells[1][2].Health >= c.Health {
+		t.Errorf("lossy 2→3 cell should grade worse than 1→2: %+v", m.Cells[1][2])
+	}
+}
+
+// TestBuildMeshMatrixLocationGrouping verifies site-to-site grouping
+// collapses agents sharing a location and keeps intra-site paths on the
+// diagonal.
+func TestBuildMeshMatrixLocationGrouping(t *testing.T) {
+	agents := []agentInfo{
+		{ID: 1, Name: "nyc-a", Location: "NYC"},
+		{ID: 2, Name: "nyc-b", Location: "NYC"},
+		{ID: 3, Name: "lon-a", Location: "London"},
+	}
+	rows := []meshPairRow{
+		{src: 1, dst: 2, probeType: "PING", samples: 10, latency: 1},
+		{src: 1, dst: 3, probeType: "PING", samples: 10, latency: 70},
+		{src: 2, dst: 3, probeType: "PING", samples: 10, latency: 72},
+	}
+	m := buildMeshMatrix(agents, rows, MeshGroupByLocation)
+
+	if len(m.Axis) != 2 || m.Axis[0].Name != "London" || m.Axis[1].Name != "NYC" {
+		t.Fatalf("unexpected axis: %+v", m.Axis)
+	}
+	if len(m.Axis[1].AgentIDs) != 2 {
+		t.Errorf("NYC should group 2 agents, got %v", m.Axis[1].AgentIDs)
+	}
+	if c := m.Cells[1][0]; c == nil || c.Samples != 20 || c.LatencyMs != 71 {
+		t.Errorf("NYC→London cell = %+v, want 20 samples at 71ms", c)
+	}
+	if c := m.Cells[1][1]; c == nil || c.LatencyMs != 1 {
+		t.Errorf("NYC intra-site cell = %+v, want 1ms", c)
+	}
+}
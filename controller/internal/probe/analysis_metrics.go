@@ -20,6 +20,8 @@ type speedtestStats struct {
 	AvgLatency   float64 // ms
 	AvgJitterAvg float64 // ms
 	Count        int
+	// Servers counts the results per tested server (speedtestServerKey).
+	Servers map[string]int
 }
 
 func getWorkspaceSpeedtestMetrics(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) (map[string]speedtestStats, error) {
@@ -31,14 +33,15 @@ func getWorkspaceSpeedtestMetrics(ctx context.Context, ch *sql.DB, agentIDs []ui
 		agentIDStrs[i] = fmt.Sprintf("%d", id)
 	}
 	q := fmt.Sprintf(`
-SELECT agent_id, target, payload_raw
-FROM probe_data
+SELECT agent_id, target, dl_bps, ul_bps, latency_ms, jitter_ms, server_id, server_host
+FROM speedtest_data
 WHERE type = 'SPEEDTEST'
   AND agent_id IN (%s)
   AND created_at >= %s
+  AND server_count > 0%s
 ORDER BY created_at DESC
 LIMIT 500
-`, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -49,30 +52,31 @@ LIMIT 500
 	type accum struct {
 		dlTotal, ulTotal, latTotal, jitterTotal float64
 		count                                   int
+		servers                                 map[string]int
 	}
 	acc := make(map[string]*accum)
 
 	for rows.Next() {
 		var agentID uint64
-		var target, payloadRaw string
-		if err := rows.Scan(&agentID, &target, &payloadRaw); err != nil || payloadRaw == "" {
+		var target string
+		var dl, ul, lat, jitter float64
+		var serverID, serverHost string
+		if err := rows.Scan(&agentID, &target, &dl, &ul, &lat, &jitter, &serverID, &serverHost); err != nil {
 			continue
 		}
-		var result SpeedTestResult
-		if err := json.Unmarshal([]byte(payloadRaw), &result); err != nil || len(result.TestData) == 0 {
-			continue
-		}
-		srv := result.TestData[0]
 		key := fmt.Sprintf("%d:%s", agentID, target)
 		if acc[key] == nil {
-			acc[key] = &accum{}
+			acc[key] = &accum{servers: make(map[string]int)}
 		}
 		a := acc[key]
-		a.dlTotal += float64(srv.DLSpeed) // bytes/sec → will convert later
-		a.ulTotal += float64(srv.ULSpeed)
-		a.latTotal += float64(srv.Latency) / float64(time.Millisecond)
-		a.jitterTotal += float64(srv.Jitter) / float64(time.Millisecond)
+		a.dlTotal += dl // bits/sec → will convert later
+		a.ulTotal += ul
+		a.latTotal += lat
+		a.jitterTotal += jitter
 		a.count++
+		if sk := speedtestServerKey(serverID, serverHost); sk != "" {
+			a.servers[sk]++
+		}
 	}
 
 	out := make(map[string]speedtestStats, len(acc))
@@ -81,11 +85,12 @@ LIMIT 500
 			continue
 		}
 		out[k] = speedtestStats{
-			AvgDownload:  (a.dlTotal / float64(a.count)) * 8 / 1_000_000, // bytes/s → Mbps
-			AvgUpload:    (a.ulTotal / float64(a.count)) * 8 / 1_000_000,
+			AvgDownload:  (a.dlTotal / float64(a.count)) / 1_000_000, // bits/s → Mbps
+			AvgUpload:    (a.ulTotal / float64(a.count)) / 1_000_000,
 			AvgLatency:   a.latTotal / float64(a.count),
 			AvgJitterAvg: a.jitterTotal / float64(a.count),
 			Count:        a.count,
+			Servers:      a.servers,
 		}
 	}
 	return out, nil
@@ -97,6 +102,9 @@ type sysInfoStats struct {
 	MemTotalBytes uint64
 	MemUsedBytes  uint64
 	Hostname      string
+	DiskPctMax    *float64  // fullest filesystem; nil when not reported
+	BootTime      time.Time // zero when not reported
+	ReportedAt    time.Time
 }
 
 func getWorkspaceSysInfoMetrics(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) (map[string]sysInfoStats, error) {
@@ -107,16 +115,19 @@ func getWorkspaceSysInfoMetrics(ctx context.Context, ch *sql.DB, agentIDs []uint
 	for i, id := range agentIDs {
 		agentIDStrs[i] = fmt.Sprintf("%d", id)
 	}
-	// Get only the latest per agent
+	// Only the latest report per agent (see getLatestNetInfoForAgents).
 	q := fmt.Sprintf(`
-SELECT agent_id, payload_raw
-FROM probe_data
-WHERE type = 'SYSINFO'
-  AND agent_id IN (%s)
-  AND created_at >= %s
-ORDER BY created_at DESC
-LIMIT 100
-`, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+SELECT agent_id, payload_raw, created_at
+FROM (
+    SELECT agent_id, payload_raw, created_at,
+           row_number() OVER (PARTITION BY agent_id ORDER BY created_at DESC) AS rn
+    FROM probe_data
+    WHERE type = 'SYSINFO'
+      AND agent_id IN (%s)
+      AND created_at >= %s%s
+)
+WHERE rn = 1
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -125,51 +136,62 @@ LIMIT 100
 	defer rows.Close()
 
 	out := make(map[string]sysInfoStats)
-	seen := make(map[string]bool) // only keep latest per agent
-
 	for rows.Next() {
 		var agentID uint64
 		var payloadRaw string
-		if err := rows.Scan(&agentID, &payloadRaw); err != nil || payloadRaw == "" {
+		var createdAt time.Time
+		if err := rows.Scan(&agentID, &payloadRaw, &createdAt); err != nil || payloadRaw == "" {
 			continue
 		}
 		key := fmt.Sprintf("%d", agentID)
-		if seen[key] {
-			continue
-		}
-		seen[key] = true
 
 		var p sysInfoPayload
-		if err := json.Unmarshal([]byte(payloadRaw), &p); err != nil {
+		if err := json.Unmarshal(UnsealAgentPayload(ctx, uint(agentID), []byte(payloadRaw)), &p); err != nil {
 			continue
 		}
+		out[key] = sysInfoStatsFromPayload(p, createdAt)
+	}
+	return out, nil
+}
 
-		cpuTotal := p.CPUTimes.User + p.CPUTimes.System + p.CPUTimes.Idle + p.CPUTimes.IOWait + p.CPUTimes.Nice + p.CPUTimes.SoftIRQ + p.CPUTimes.Steal + p.CPUTimes.IRQ
-		cpuBusy := cpuTotal - p.CPUTimes.Idle
-		cpuPct := 0.0
-		if cpuTotal > 0 {
-			cpuPct = (float64(cpuBusy) / float64(cpuTotal)) * 100
-		}
+// sysInfoStatsFromPayload derives usage percentages from one report.
+func sysInfoStatsFromPayload(p sysInfoPayload, at time.Time) sysInfoStats {
+	cpuTotal := p.CPUTimes.User + p.CPUTimes.System + p.CPUTimes.Idle + p.CPUTimes.IOWait + p.CPUTimes.Nice + p.CPUTimes.SoftIRQ + p.CPUTimes.Steal + p.CPUTimes.IRQ
+	cpuBusy := cpuTotal - p.CPUTimes.Idle
+	cpuPct := 0.0
+	if cpuTotal > 0 {
+		cpuPct = (float64(cpuBusy) / float64(cpuTotal)) * 100
+	}
 
-		memPct := 0.0
-		if p.MemoryInfo.Total > 0 {
-			memPct = (float64(p.MemoryInfo.Used) / float64(p.MemoryInfo.Total)) * 100
-		}
+	memPct := 0.0
+	if p.MemoryInfo.Total > 0 {
+		memPct = (float64(p.MemoryInfo.Used) / float64(p.MemoryInfo.Total)) * 100
+	}
 
-		out[key] = sysInfoStats{
-			CPUUsagePct:   cpuPct,
-			MemUsagePct:   memPct,
-			MemTotalBytes: p.MemoryInfo.Total,
-			MemUsedBytes:  p.MemoryInfo.Used,
-			Hostname:      p.HostInfo.Hostname,
+	si := sysInfoStats{
+		CPUUsagePct:   cpuPct,
+		MemUsagePct:   memPct,
+		MemTotalBytes: p.MemoryInfo.Total,
+		MemUsedBytes:  p.MemoryInfo.Used,
+		Hostname:      p.HostInfo.Hostname,
+		BootTime:      p.HostInfo.BootTime.UTC(),
+		ReportedAt:    at.UTC(),
+	}
+	for _, d := range p.Disks {
+		if d.Total == 0 {
+			continue
+		}
+		pct := float64(d.Used) / float64(d.Total) * 100
+		if si.DiskPctMax == nil || pct > *si.DiskPctMax {
+			si.DiskPctMax = &pct
 		}
 	}
-	return out, nil
+	return si
 }
 
 type netInfoChange struct {
 	AgentID    uint
-	Field      string // "public_ip", "isp", "interface"
+	Field      string // "public_ip", "isp", or a netInfoField* constant
 	OldValue   string
 	NewValue   string
 	DetectedAt time.Time
@@ -201,10 +223,10 @@ FROM (
     FROM probe_data
     WHERE type = 'NETINFO'
       AND agent_id IN (%s)
-      AND created_at >= %s
+      AND created_at >= %s%s
 )
 WHERE rn = 1
-`, agentIDList, chQuoteTime(from))
+`, agentIDList, chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -220,7 +242,7 @@ WHERE rn = 1
 			continue
 		}
 		var p netInfoPayload
-		if err := json.Unmarshal([]byte(payloadRaw), &p); err != nil {
+		if err := json.Unmarshal(UnsealAgentPayload(ctx, uint(agentID), []byte(payloadRaw)), &p); err != nil {
 			continue
 		}
 		p.NormalizeFromLegacy()
@@ -249,11 +271,11 @@ FROM (
     FROM probe_data
     WHERE type = 'NETINFO'
       AND agent_id IN (%s)
-      AND created_at >= %s
+      AND created_at >= %s%s
 )
 WHERE rn <= 2
 ORDER BY agent_id, created_at DESC
-`, strings.Join(agentIDStrs, ", "), chQuoteTime(from))
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -276,7 +298,7 @@ ORDER BY agent_id, created_at DESC
 			continue
 		}
 		var p netInfoPayload
-		if err := json.Unmarshal([]byte(payloadRaw), &p); err != nil {
+		if err := json.Unmarshal(UnsealAgentPayload(ctx, uint(agentID), []byte(payloadRaw)), &p); err != nil {
 			continue
 		}
 		aid := uint(agentID)
@@ -292,27 +314,7 @@ ORDER BY agent_id, created_at DESC
 		}
 		newer := records[0] // latest
 		older := records[1] // previous
-
-		if newer.payload.PublicAddress != older.payload.PublicAddress && newer.payload.PublicAddress != "" {
-			changes = append(changes, netInfoChange{
-				AgentID:    aid,
-				Field:      "public_ip",
-				OldValue:   older.payload.PublicAddress,
-				NewValue:   newer.payload.PublicAddress,
-				DetectedAt: newer.createdAt,
-			})
-		}
-		newISP := newer.payload.GetISP()
-		oldISP := older.payload.GetISP()
-		if newISP != oldISP && newISP != "" && oldISP != "" {
-			changes = append(changes, netInfoChange{
-				AgentID:    aid,
-				Field:      "isp",
-				OldValue:   oldISP,
-				NewValue:   newISP,
-				DetectedAt: newer.createdAt,
-			})
-		}
+		changes = append(changes, diffNetInfo(aid, older.payload, newer.payload, newer.createdAt)...)
 	}
 	return changes, nil
 }
@@ -339,33 +341,6 @@ func latencyScore(latMs float64) float64 {
 	}
 }
 
-// speedtestBandwidthScore scores download+upload bandwidth (Mbps), 0-100
-func speedtestBandwidthScore(dlMbps, ulMbps float64) float64 {
-	// Weighted: download 70%, upload 30%
-	dlScore := bwScore(dlMbps)
-	ulScore := bwScore(ulMbps)
-	return 0.7*dlScore + 0.3*ulScore
-}
-
-func bwScore(mbps float64) float64 {
-	switch {
-	case mbps >= 100:
-		return 100
-	case mbps >= 50:
-		return 90 + (mbps-50)*0.2 // 90-100
-	case mbps >= 25:
-		return 75 + (mbps-25)*0.6 // 75-90
-	case mbps >= 10:
-		return 50 + (mbps-10)*1.67 // 50-75
-	case mbps >= 5:
-		return 30 + (mbps-5)*4 // 30-50
-	case mbps > 0:
-		return mbps * 6 // 0-30
-	default:
-		return 0
-	}
-}
-
 // sysInfoHealthScore converts CPU/memory usage to a health score (higher = healthier)
 func sysInfoHealthScore(si sysInfoStats) float64 {
 	// CPU: <50% = 100, 50-80% = 80-60, 80-95% = 60-20, >95% = critical
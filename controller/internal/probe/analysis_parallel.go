@@ -0,0 +1,222 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/settings"
+
+	"gorm.io/gorm"
+)
+
+// ── Parallel Workspace Analysis ──
+//
+// ComputeWorkspaceAnalysis fetches each probe type's metrics concurrently,
+// scores agents in a bounded worker pool and runs the ClickHouse-backed
+// detectors side by side. The ClickHouse queries and agent scoring share a
+// per-request time budget (ANALYSIS_TIME_BUDGET_SECONDS); work that misses
+// it is left out and the analysis is marked Partial with the reasons.
+// Partial analyses do not resolve incident history or external tickets,
+// since an incident missing from them may just not have been evaluated.
+
+const defaultAnalysisTimeBudget = 20 * time.Second
+
+// analysisTimeBudget reads ANALYSIS_TIME_BUDGET_SECONDS. It is read per
+// analysis, so runtime overrides apply to the next run.
+func analysisTimeBudget() time.Duration {
+	if n, err := strconv.Atoi(settings.Getenv("ANALYSIS_TIME_BUDGET_SECONDS")); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return defaultAnalysisTimeBudget
+}
+
+// analysisAgentWorkers bounds the per-workspace agent scoring pool.
+func analysisAgentWorkers(agents int) int {
+	n := runtime.GOMAXPROCS(0)
+	if agents < n {
+		n = agents
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// workspaceMetrics holds the per-type metrics one analysis works from.
+// Maps are never nil, so a failed fetch reads as "no data".
+type workspaceMetrics struct {
+	ping           map[string]pingStats
+	mtr            map[string]mtrStats
+	traffic        map[string]trafficStats
+	sysInfo        map[string]sysInfoStats
+	netInfoChanges []netInfoChange
+	hostActivity   map[uint]hostActivity // SYSINFO/NETINFO reporting, for passive agents
+	activeAgents   map[uint]bool         // agents with active probes configured; nil if unknown
+	from           time.Time             // analysis window start
+
+	baselinePing    map[string]pingStats
+	baselineTraffic map[string]trafficStats
+}
+
+// partialReasons collects why an analysis is incomplete. Safe for
+// concurrent use.
+type partialReasons struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (p *partialReasons) add(format string, args ...any) {
+	p.mu.Lock()
+	p.reasons = append(p.reasons, fmt.Sprintf(format, args...))
+	p.mu.Unlock()
+}
+
+func (p *partialReasons) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.reasons...)
+}
+
+// runParallel runs fns concurrently and waits for all of them.
+func runParallel(fns ...func()) {
+	var wg sync.WaitGroup
+	wg.Add(len(fns))
+	for _, fn := range fns {
+		go func(fn func()) {
+			defer wg.Done()
+			fn()
+		}(fn)
+	}
+	wg.Wait()
+}
+
+// fetchWorkspaceMetrics runs the window and baseline metric queries
+// concurrently. A failed query leaves its metrics empty and adds a reason.
+func fetchWorkspaceMetrics(ctx context.Context, ch *sql.DB, pg *gorm.DB, agentIDs []uint, from, baselineFrom, now time.Time, partial *partialReasons) workspaceMetrics {
+	m := workspaceMetrics{from: from}
+	note := func(what string, err error) {
+		if err != nil {
+			partial.add("%s: %v", what, err)
+		}
+	}
+	runParallel(
+		func() {
+			var err error
+			m.ping, err = getWorkspacePingMetrics(ctx, ch, agentIDs, from)
+			note("ping metrics", err)
+		},
+		func() {
+			var err error
+			m.mtr, err = getWorkspaceMTRMetrics(ctx, ch, pg, agentIDs, from)
+			note("mtr metrics", err)
+		},
+		func() {
+			var err error
+			m.traffic, err = getWorkspaceTrafficSimMetrics(ctx, ch, agentIDs, from)
+			note("trafficsim metrics", err)
+		},
+		func() {
+			var err error
+			m.sysInfo, err = getWorkspaceSysInfoMetrics(ctx, ch, agentIDs, from)
+			note("sysinfo metrics", err)
+		},
+		func() {
+			var err error
+			m.netInfoChanges, err = getWorkspaceNetInfoChanges(ctx, ch, agentIDs, from)
+			note("netinfo changes", err)
+		},
+		func() {
+			var err error
+			m.hostActivity, err = getWorkspaceHostActivity(ctx, ch, agentIDs, from, now)
+			note("host activity", err)
+		},
+		func() {
+			var err error
+			m.activeAgents, err = activeProbeAgents(ctx, pg, agentIDs)
+			note("active probes", err)
+		},
+		func() {
+			var err error
+			m.baselinePing, err = getWorkspacePingMetrics(ctx, ch, agentIDs, baselineFrom)
+			note("ping baseline", err)
+		},
+		func() {
+			var err error
+			m.baselineTraffic, err = getWorkspaceTrafficSimMetrics(ctx, ch, agentIDs, baselineFrom)
+			note("trafficsim baseline", err)
+		},
+	)
+	if m.ping == nil {
+		m.ping = make(map[string]pingStats)
+	}
+	if m.mtr == nil {
+		m.mtr = make(map[string]mtrStats)
+	}
+	if m.traffic == nil {
+		m.traffic = make(map[string]trafficStats)
+	}
+	if m.sysInfo == nil {
+		m.sysInfo = make(map[string]sysInfoStats)
+	}
+	if m.hostActivity == nil {
+		m.hostActivity = make(map[uint]hostActivity)
+	}
+	if m.baselinePing == nil {
+		m.baselinePing = make(map[string]pingStats)
+	}
+	if m.baselineTraffic == nil {
+		m.baselineTraffic = make(map[string]trafficStats)
+	}
+	return m
+}
+
+// summarizeAgents scores agents in a bounded worker pool, keeping the
+// input order. Agents not reached before ctx is done are returned with an
+// unknown grade and scored=false.
+func summarizeAgents(ctx context.Context, agents []agentInfo, m *workspaceMetrics, agentByID map[uint]agentInfo, now time.Time, reprocessing bool) (summaries []AgentHealthSummary, scored []bool) {
+	summaries = make([]AgentHealthSummary, len(agents))
+	scored = make([]bool, len(agents))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := analysisAgentWorkers(len(agents)); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					summaries[i] = unscoredAgentSummary(agents[i], now, reprocessing)
+					continue
+				}
+				summaries[i] = summarizeAgent(agents[i], m, agentByID, now, reprocessing)
+				scored[i] = true
+			}
+		}()
+	}
+	for i := range agents {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return summaries, scored
+}
+
+// unscoredAgentSummary stands in for an agent the time budget skipped.
+func unscoredAgentSummary(agent agentInfo, now time.Time, reprocessing bool) AgentHealthSummary {
+	connectivity := agent.connectivity(now)
+	return AgentHealthSummary{
+		AgentID:     agent.ID,
+		AgentName:   agent.Name,
+		IsOnline:    connectivity != ConnectivityOffline,
+		Health:      HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0},
+		WorstProbes: []ProbeHealthEntry{},
+
+		Connectivity:            connectivity,
+		SecondsSinceSeen:        secondsSinceSeen(agent, now, reprocessing),
+		OfflineThresholdSeconds: int(agent.connectivityThresholds().Offline / time.Second),
+	}
+}
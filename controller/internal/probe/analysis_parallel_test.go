@@ -0,0 +1,74 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSummarizeAgents verifies the worker pool keeps agent order, matches
+// the sequential scoring and marks agents skipped after the budget ran out.
+func TestSummarizeAgents(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	var agents []agentInfo
+	agentByID := make(map[uint]agentInfo)
+	m := &workspaceMetrics{
+		ping:    make(map[string]pingStats),
+		mtr:     make(map[string]mtrStats),
+		traffic: make(map[string]trafficStats),
+		sysInfo: make(map[string]sysInfoStats),
+	}
+	for id := uint(1); id <= 40; id++ {
+		a := agentInfo{ID: id, Name: "agent", LastSeenAt: now}
+		agents = append(agents, a)
+		agentByID[id] = a
+		if id%2 == 0 {
+			m.ping[fmt.Sprintf("%d:1.1.1.1", id)] = pingStats{AvgLatency: float64(id), Count: 10}
+		}
+	}
+
+	got, scored := summarizeAgents(context.Background(), agents, m, agentByID, now, false)
+	for i, s := range got {
+		want := summarizeAgent(agents[i], m, agentByID, now, false)
+		if !scored[i] || s.AgentID != agents[i].ID || s.ProbeCount != want.ProbeCount || s.Health.OverallHealth != want.Health.OverallHealth {
+			t.Fatalf("agent %d = %+v (scored %v), want %+v", i, s, scored[i], want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, scored = summarizeAgents(ctx, agents, m, agentByID, now, false)
+	for i, s := range got {
+		if scored[i] || s.AgentID != agents[i].ID || s.Health.Grade != "unknown" || s.ProbeCount != 0 {
+			t.Fatalf("budget exhausted: agent %d = %+v (scored %v)", i, s, scored[i])
+		}
+	}
+}
+
+// TestRecordIncidentHistoryPartial verifies a partial analysis keeps open
+// incidents it didn't see.
+func TestRecordIncidentHistoryPartial(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&IncidentRecord{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := RecordIncidentHistory(ctx, db, &WorkspaceAnalysis{WorkspaceID: 4, GeneratedAt: t0,
+		Incidents: []DetectedIncident{{ID: "loss_1", Severity: "warning"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordIncidentHistory(ctx, db, &WorkspaceAnalysis{WorkspaceID: 4, GeneratedAt: t0.Add(time.Minute), Partial: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, _ := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Status: IncidentStatusOpen}); n != 1 {
+		t.Errorf("open after partial = %d, want 1", n)
+	}
+	if err := RecordIncidentHistory(ctx, db, &WorkspaceAnalysis{WorkspaceID: 4, GeneratedAt: t0.Add(2 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, _ := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Status: IncidentStatusOpen}); n != 0 {
+		t.Errorf("open after complete = %d, want 0", n)
+	}
+}
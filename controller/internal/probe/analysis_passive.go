@@ -0,0 +1,262 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Passive Agents ──
+//
+// Inventory-style agents run no PING/MTR/TRAFFICSIM probes, and nothing
+// probes them, so the network scores have nothing to work with. They still
+// send SYSINFO and NETINFO, and those alone are enough to say whether the
+// host is up and healthy. Such an agent is scored in passive mode:
+//
+//   - host score: CPU and memory as for active agents (sysInfoHealthScore),
+//     blended with the fullest disk when the agent reports disks
+//   - reporting: the share of 5-minute slots in the window with at least
+//     one SYSINFO or NETINFO report, i.e. the host's uptime as seen by the
+//     controller
+//
+// The passive health is 60% host score and 40% reporting, minus a small
+// penalty when the host rebooted within the window. Passive agents count
+// towards the workspace health but not towards its latency, loss and
+// route sub-scores.
+//
+// The mode follows the agent's configured probes (activeProbeAgents), not
+// the data in the window: an active agent whose probes stop reporting is
+// still active, and shows up as a data gap rather than a healthy host.
+
+// Agent scoring modes.
+const (
+	AgentModeActive  = "active"  // scored from probe data
+	AgentModePassive = "passive" // scored from SYSINFO/NETINFO only
+)
+
+const (
+	// passiveReportSlot is the granularity of reporting coverage. Agents
+	// send SYSINFO and NETINFO every minute or so; a slot without either
+	// means the agent (or its host) was down.
+	passiveReportSlot = 5 * time.Minute
+
+	passiveHostWeight      = 0.6
+	passiveReportingWeight = 0.4
+	passiveRebootPenalty   = 5.0
+)
+
+// PassiveHostHealth is the host view behind a passive agent's score.
+type PassiveHostHealth struct {
+	Score     float64  `json:"score"`
+	HostScore *float64 `json:"host_score,omitempty"` // nil without SYSINFO
+	CPUPct    float64  `json:"cpu_pct"`
+	MemPct    float64  `json:"mem_pct"`
+	DiskPct   *float64 `json:"disk_pct,omitempty"` // fullest filesystem
+
+	// ReportingPct is the share of the window in which the agent reported,
+	// nil when the window is shorter than one slot.
+	ReportingPct     *float64   `json:"reporting_pct,omitempty"`
+	Reports          int        `json:"reports"`
+	SlotsReported    int        `json:"slots_reported"`
+	SlotsExpected    int        `json:"slots_expected"`
+	LastSysInfoAt    *time.Time `json:"last_sysinfo_at,omitempty"`
+	BootTime         *time.Time `json:"boot_time,omitempty"`
+	UptimeSeconds    int64      `json:"uptime_seconds,omitempty"`
+	RebootedInWindow bool       `json:"rebooted_in_window,omitempty"`
+}
+
+// hostActivity is an agent's SYSINFO/NETINFO reporting over whole slots.
+type hostActivity struct {
+	Reports int
+	Slots   int // passiveReportSlot slots with at least one report
+}
+
+// passiveSlotRange returns the whole slots in [from, now): the first slot
+// starting at or after from, and the start of the current (incomplete)
+// slot.
+func passiveSlotRange(from, now time.Time) (start, end time.Time) {
+	start = from.Truncate(passiveReportSlot)
+	if start.Before(from) {
+		start = start.Add(passiveReportSlot)
+	}
+	return start, now.Truncate(passiveReportSlot)
+}
+
+// getWorkspaceHostActivity counts each agent's SYSINFO/NETINFO reports and
+// the slots they fall in, over the whole slots since from.
+func getWorkspaceHostActivity(ctx context.Context, ch *sql.DB, agentIDs []uint, from, now time.Time) (map[uint]hostActivity, error) {
+	out := make(map[uint]hostActivity)
+	start, end := passiveSlotRange(from, now)
+	if len(agentIDs) == 0 || !end.After(start) {
+		return out, nil
+	}
+	agentIDStrs := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		agentIDStrs[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT agent_id, count() AS reports,
+       uniqExact(toStartOfInterval(created_at, INTERVAL %d SECOND)) AS slots
+FROM probe_data
+WHERE type IN ('SYSINFO', 'NETINFO')
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at < %s
+GROUP BY agent_id
+`, int(passiveReportSlot/time.Second), strings.Join(agentIDStrs, ", "), chQuoteTime(start), chQuoteTime(end))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var agentID, reports, slots uint64
+		if err := rows.Scan(&agentID, &reports, &slots); err != nil {
+			return nil, err
+		}
+		out[uint(agentID)] = hostActivity{Reports: int(reports), Slots: int(slots)}
+	}
+	return out, rows.Err()
+}
+
+// hostResourceScore is sysInfoHealthScore with the fullest disk folded in:
+// below 80% full costs nothing, 95% and above is critical.
+func hostResourceScore(si sysInfoStats) float64 {
+	score := sysInfoHealthScore(si)
+	if si.DiskPctMax == nil {
+		return score
+	}
+	diskScore := 100.0
+	switch d := *si.DiskPctMax; {
+	case d >= 95:
+		diskScore = 10
+	case d > 80:
+		diskScore = 100 - (d-80)*4 // 40 at 95%
+	}
+	return (2*score + diskScore) / 3
+}
+
+// computePassiveHealth scores a passive agent. windowStart is the later of
+// the analysis window start and the agent's creation, so a new agent isn't
+// charged for slots before it existed. Returns nil when the agent sent
+// nothing to score.
+func computePassiveHealth(si *sysInfoStats, act hostActivity, windowStart, now time.Time) *PassiveHostHealth {
+	start, end := passiveSlotRange(windowStart, now)
+	expected := 0
+	if end.After(start) {
+		expected = int(end.Sub(start) / passiveReportSlot)
+	}
+	if si == nil && act.Reports == 0 {
+		return nil
+	}
+
+	ph := &PassiveHostHealth{Reports: act.Reports, SlotsReported: min(act.Slots, expected), SlotsExpected: expected}
+	var parts, weights float64
+	if si != nil {
+		hs := clampScore(hostResourceScore(*si))
+		ph.HostScore = &hs
+		ph.CPUPct, ph.MemPct, ph.DiskPct = si.CPUUsagePct, si.MemUsagePct, si.DiskPctMax
+		if !si.ReportedAt.IsZero() {
+			at := si.ReportedAt
+			ph.LastSysInfoAt = &at
+		}
+		if !si.BootTime.IsZero() && !si.BootTime.After(now) {
+			boot := si.BootTime
+			ph.BootTime = &boot
+			ph.UptimeSeconds = int64(now.Sub(boot) / time.Second)
+			ph.RebootedInWindow = boot.After(windowStart)
+		}
+		parts += passiveHostWeight * hs
+		weights += passiveHostWeight
+	}
+	if expected > 0 {
+		pct := math.Round(float64(ph.SlotsReported)/float64(expected)*1000) / 10
+		ph.ReportingPct = &pct
+		parts += passiveReportingWeight * pct
+		weights += passiveReportingWeight
+	}
+	if weights == 0 {
+		return nil // reports predate the agent's window
+	}
+	ph.Score = parts / weights
+	if ph.RebootedInWindow {
+		ph.Score -= passiveRebootPenalty
+	}
+	ph.Score = clampScore(ph.Score)
+	return ph
+}
+
+// passiveWindowStart is where an agent's reporting coverage starts.
+func passiveWindowStart(from, createdAt time.Time) time.Time {
+	if createdAt.After(from) {
+		return createdAt
+	}
+	return from
+}
+
+// passiveHealthVector is the agent health of a passive agent. The network
+// sub-scores have no data, so they are left at their neutral values.
+func passiveHealthVector(ph *PassiveHostHealth) HealthVector {
+	return HealthVector{
+		OverallHealth:  ph.Score,
+		Grade:          gradeFromScore(ph.Score),
+		RouteStability: 100,
+		MosScore:       1.0,
+	}
+}
+
+// activeProbeTypes are the probe types that make an agent active, whether
+// it runs them or is their target.
+var activeProbeTypes = []Type{TypeAgent, TypePing, TypeMTR, TypeTrafficSim}
+
+// activeProbeAgents returns which of agentIDs run an enabled active probe
+// or are the target of one. Reprocessing uses the current configuration.
+func activeProbeAgents(ctx context.Context, pg *gorm.DB, agentIDs []uint) (map[uint]bool, error) {
+	if pg == nil || len(agentIDs) == 0 {
+		return nil, nil
+	}
+	var owners, targets []uint
+	if err := pg.WithContext(ctx).Table("probes").
+		Where("agent_id IN ? AND type IN ? AND enabled = ? AND deleted_at IS NULL", agentIDs, activeProbeTypes, true).
+		Distinct().Pluck("agent_id", &owners).Error; err != nil {
+		return nil, err
+	}
+	if err := pg.WithContext(ctx).Table("probe_targets t").
+		Joins("JOIN probes p ON p.id = t.probe_id").
+		Where("t.agent_id IN ? AND t.deleted_at IS NULL AND p.type IN ? AND p.enabled = ? AND p.deleted_at IS NULL", agentIDs, activeProbeTypes, true).
+		Distinct().Pluck("t.agent_id", &targets).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[uint]bool, len(owners)+len(targets))
+	for _, id := range append(owners, targets...) {
+		out[id] = true
+	}
+	return out, nil
+}
+
+// computeAgentPassiveHealth is computePassiveHealth for one agent, reading
+// its latest SYSINFO and reporting since from.
+func computeAgentPassiveHealth(ctx context.Context, ch *sql.DB, agentID uint, createdAt, from time.Time) *PassiveHostHealth {
+	now := time.Now().UTC()
+	ids := []uint{agentID}
+	sysInfo, err := getWorkspaceSysInfoMetrics(ctx, ch, ids, from)
+	if err != nil {
+		log.Warnf("[analysis] passive sysinfo for agent %d: %v", agentID, err)
+	}
+	activity, err := getWorkspaceHostActivity(ctx, ch, ids, from, now)
+	if err != nil {
+		log.Warnf("[analysis] passive host activity for agent %d: %v", agentID, err)
+	}
+	var sip *sysInfoStats
+	if si, ok := sysInfo[fmt.Sprintf("%d", agentID)]; ok {
+		sip = &si
+	}
+	return computePassiveHealth(sip, activity[agentID], passiveWindowStart(from, createdAt), now)
+}
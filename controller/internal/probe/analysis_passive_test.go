@@ -0,0 +1,168 @@
+package probe
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputePassiveHealth(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 2, 0, 0, time.UTC)
+	from := now.Add(-time.Hour) // whole slots 11:05–12:00: 11 expected
+	healthy := &sysInfoStats{CPUUsagePct: 20, MemUsagePct: 40, BootTime: now.Add(-48 * time.Hour), ReportedAt: now}
+
+	if ph := computePassiveHealth(nil, hostActivity{}, from, now); ph != nil {
+		t.Errorf("no data: %+v, want nil", ph)
+	}
+
+	ph := computePassiveHealth(healthy, hostActivity{Reports: 22, Slots: 11}, from, now)
+	if ph == nil || ph.SlotsExpected != 11 || *ph.ReportingPct != 100 || ph.Score != 100 || ph.UptimeSeconds != 48*3600 || ph.RebootedInWindow {
+		t.Fatalf("healthy host = %+v", ph)
+	}
+
+	// Reported in 5 of 11 slots: the host score is perfect, reporting drags.
+	ph = computePassiveHealth(healthy, hostActivity{Reports: 10, Slots: 5}, from, now)
+	want := passiveHostWeight*100 + passiveReportingWeight*45.5
+	if math.Abs(ph.Score-want) > 0.01 {
+		t.Errorf("half reporting score = %.2f, want %.2f", ph.Score, want)
+	}
+
+	// NETINFO only: reporting alone.
+	ph = computePassiveHealth(nil, hostActivity{Reports: 11, Slots: 11}, from, now)
+	if ph == nil || ph.HostScore != nil || ph.Score != 100 {
+		t.Errorf("netinfo only = %+v", ph)
+	}
+
+	// Rebooted 10 minutes ago.
+	rebooted := *healthy
+	rebooted.BootTime = now.Add(-10 * time.Minute)
+	ph = computePassiveHealth(&rebooted, hostActivity{Reports: 22, Slots: 11}, from, now)
+	if !ph.RebootedInWindow || ph.Score != 100-passiveRebootPenalty {
+		t.Errorf("rebooted = %+v", ph)
+	}
+
+	// An agent created 20 minutes ago is only expected for its own slots.
+	created := now.Add(-20 * time.Minute)
+	ph = computePassiveHealth(healthy, hostActivity{Reports: 6, Slots: 3}, passiveWindowStart(from, created), now)
+	if ph.SlotsExpected != 3 || *ph.ReportingPct != 100 {
+		t.Errorf("new agent = %+v", ph)
+	}
+
+	// A nearly full disk lowers the host score.
+	disk := 97.0
+	full := *healthy
+	full.DiskPctMax = &disk
+	ph = computePassiveHealth(&full, hostActivity{Reports: 22, Slots: 11}, from, now)
+	if *ph.HostScore != 70 || *ph.DiskPct != 97 {
+		t.Errorf("full disk = host %.1f disk %v", *ph.HostScore, ph.DiskPct)
+	}
+}
+
+// TestSummarizeAgentPassive verifies an agent with only SYSINFO/NETINFO is
+// graded in passive mode and kept out of the network sub-scores.
+func TestSummarizeAgentPassive(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	from := now.Add(-time.Hour)
+	active := agentInfo{ID: 1, Name: "active", LastSeenAt: now}
+	passive := agentInfo{ID: 2, Name: "inventory", LastSeenAt: now}
+	silent := agentInfo{ID: 3, Name: "silent", LastSeenAt: now}
+	agentByID := map[uint]agentInfo{1: active, 2: passive, 3: silent}
+	m := &workspaceMetrics{
+		ping:         map[string]pingStats{"1:1.1.1.1": {AvgLatency: 300, PacketLoss: 5, Count: 10}},
+		mtr:          make(map[string]mtrStats),
+		traffic:      make(map[string]trafficStats),
+		sysInfo:      map[string]sysInfoStats{"2": {CPUUsagePct: 10, MemUsagePct: 30, ReportedAt: now}},
+		hostActivity: map[uint]hostActivity{2: {Reports: 24, Slots: 12}},
+		from:         from,
+	}
+
+	a := summarizeAgent(active, m, agentByID, now, false)
+	if a.Mode != AgentModeActive || a.Passive != nil {
+		t.Errorf("active agent = %+v", a)
+	}
+	p := summarizeAgent(passive, m, agentByID, now, false)
+	if p.Mode != AgentModePassive || p.Passive == nil || p.Health.Grade == "unknown" || p.Health.OverallHealth != 100 {
+		t.Fatalf("passive agent = %+v", p)
+	}
+	if p.ProbeCount != 1 || p.WorstProbes[0].ProbeType != "SYSINFO" {
+		t.Errorf("passive probes = %+v", p.WorstProbes)
+	}
+	s := summarizeAgent(silent, m, agentByID, now, false)
+	if s.Mode != AgentModePassive || s.Passive != nil || s.Health.Grade == gradeFromScore(100) {
+		t.Errorf("silent agent = %+v", s)
+	}
+
+	summaries := []AgentHealthSummary{a, p}
+	if got := extractHealthField(summaries, "latency_score"); len(got) != 1 || got[0] != a.Health.LatencyScore {
+		t.Errorf("latency scores = %v, want only the active agent", got)
+	}
+
+	// With probes configured, an agent whose probes sent nothing stays
+	// active: a data gap, not a healthy passive host.
+	stalled := agentInfo{ID: 4, Name: "stalled", LastSeenAt: now}
+	agentByID[4] = stalled
+	m.sysInfo["4"] = sysInfoStats{CPUUsagePct: 10, MemUsagePct: 30, ReportedAt: now}
+	m.hostActivity[4] = hostActivity{Reports: 24, Slots: 12}
+	m.activeAgents = map[uint]bool{1: true, 4: true}
+	st := summarizeAgent(stalled, m, agentByID, now, false)
+	if st.Mode != AgentModeActive || st.Passive != nil || st.Health.OverallHealth != 0 {
+		t.Errorf("stalled active agent = %+v", st)
+	}
+	if got := extractHealthField([]AgentHealthSummary{a, st}, "latency_score"); len(got) != 2 {
+		t.Errorf("latency scores = %v, want the stalled agent included", got)
+	}
+	if p := summarizeAgent(passive, m, agentByID, now, false); p.Mode != AgentModePassive {
+		t.Errorf("unconfigured agent mode = %q, want passive", p.Mode)
+	}
+
+	// Offline passive agents still score 0.
+	passive.LastSeenAt = now.Add(-time.Hour)
+	if off := summarizeAgent(passive, m, agentByID, now, false); off.IsOnline || off.Health.OverallHealth != 0 {
+		t.Errorf("offline passive agent = %+v", off)
+	}
+}
+
+// TestActiveProbeAgents verifies agents are active when they run or are
+// targeted by an enabled PING/MTR/TRAFFICSIM/AGENT probe.
+func TestActiveProbeAgents(t *testing.T) {
+	db := newTestDB(t)
+	target := uint(3)
+	probes := []Probe{
+		{WorkspaceID: 1, AgentID: 1, Type: TypePing, Targets: []Target{{Target: "1.1.1.1"}}},
+		{WorkspaceID: 1, AgentID: 2, Type: TypeAgent, Targets: []Target{{AgentID: &target}}},
+		{WorkspaceID: 1, AgentID: 4, Type: TypeSysInfo},
+		{WorkspaceID: 1, AgentID: 5, Type: TypeMTR},
+	}
+	for i := range probes {
+		if err := db.Create(&probes[i]).Error; err != nil {
+			t.Fatalf("probe: %v", err)
+		}
+	}
+	db.Model(&Probe{}).Where("agent_id = ?", 5).Update("enabled", false)
+
+	got, err := activeProbeAgents(context.Background(), db, []uint{1, 2, 3, 4, 5, 6})
+	if err != nil {
+		t.Fatalf("activeProbeAgents: %v", err)
+	}
+	want := map[uint]bool{1: true, 2: true, 3: true}
+	if len(got) != len(want) {
+		t.Errorf("active = %v, want %v", got, want)
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("agent %d not active: %v", id, got)
+		}
+	}
+}
+
+func TestSysInfoStatsFromPayload(t *testing.T) {
+	var p sysInfoPayload
+	p.CPUTimes.User, p.CPUTimes.Idle = 25, 75
+	p.MemoryInfo.Total, p.MemoryInfo.Used = 100, 50
+	p.Disks = []SystemDiskInfo{{Mountpoint: "/", Total: 100, Used: 30}, {Mountpoint: "/var", Total: 200, Used: 180}, {Mountpoint: "/proc"}}
+	si := sysInfoStatsFromPayload(p, time.Now())
+	if si.CPUUsagePct != 25 || si.MemUsagePct != 50 || si.DiskPctMax == nil || *si.DiskPctMax != 90 {
+		t.Errorf("stats = %+v", si)
+	}
+}
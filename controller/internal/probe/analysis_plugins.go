@@ -0,0 +1,329 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/features"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Custom Analyzers ──
+//
+// Domain-specific checks can be plugged into analysis without touching the
+// built-in detectors. An analyzer is registered once at startup, either
+// compiled in (RegisterAnalyzer from an init or main) or as an HTTP sidecar
+// (ANALYZER_SIDECARS, see analysis_plugins_http.go). Probe analyzers run
+// after the built-in signals and findings are computed; workspace analyzers
+// run after the built-in incident detectors, so their incidents still go
+// through maintenance filtering, impact scoring, runbooks and tickets.
+//
+// Each call is bounded by a timeout and isolated from panics; a failing
+// analyzer is logged and skipped, never failing the analysis run. Every
+// contribution is tagged with the analyzer's name in Source.
+
+// Analyzer is a named custom analyzer. It must also implement ProbeAnalyzer,
+// WorkspaceAnalyzer, or both.
+type Analyzer interface {
+	Name() string
+}
+
+// ProbeAnalyzer contributes signals and findings to per-probe analysis.
+type ProbeAnalyzer interface {
+	Analyzer
+	AnalyzeProbe(ctx context.Context, in ProbeAnalyzerInput) (ProbeContribution, error)
+}
+
+// WorkspaceAnalyzer contributes incidents and findings to workspace analysis.
+type WorkspaceAnalyzer interface {
+	Analyzer
+	AnalyzeWorkspace(ctx context.Context, in WorkspaceAnalyzerInput) (WorkspaceContribution, error)
+}
+
+// ProbeAnalyzerInput is the built-in result an analyzer builds on. Analysis
+// is shared with the caller and must be treated as read-only; CH and PG are
+// available to compiled-in analyzers that need their own queries.
+type ProbeAnalyzerInput struct {
+	WorkspaceID     uint           `json:"workspace_id"`
+	LookbackMinutes int            `json:"lookback_minutes"`
+	Analysis        *ProbeAnalysis `json:"analysis"`
+
+	CH *sql.DB  `json:"-"`
+	PG *gorm.DB `json:"-"`
+}
+
+// WorkspaceAnalyzerInput is the workspace state after built-in detection.
+// Slices are shared with the caller and must be treated as read-only.
+type WorkspaceAnalyzerInput struct {
+	WorkspaceID     uint                 `json:"workspace_id"`
+	LookbackMinutes int                  `json:"lookback_minutes"`
+	Now             time.Time            `json:"now"`
+	Reprocessing    bool                 `json:"reprocessing"`
+	Agents          []AgentHealthSummary `json:"agents"`
+	Incidents       []DetectedIncident   `json:"incidents"`
+
+	CH *sql.DB  `json:"-"`
+	PG *gorm.DB `json:"-"`
+}
+
+// ProbeContribution is what a probe analyzer adds to a ProbeAnalysis.
+type ProbeContribution struct {
+	Signals  []AnalysisSignal  `json:"signals,omitempty"`
+	Findings []AnalysisFinding `json:"findings,omitempty"`
+}
+
+// WorkspaceContribution is what a workspace analyzer adds to a WorkspaceAnalysis.
+type WorkspaceContribution struct {
+	Incidents []DetectedIncident `json:"incidents,omitempty"`
+	Findings  []AnalysisFinding  `json:"findings,omitempty"`
+}
+
+var (
+	ErrAnalyzerInvalid   = errors.New("analyzer must have a name and implement ProbeAnalyzer or WorkspaceAnalyzer")
+	ErrAnalyzerDuplicate = errors.New("analyzer already registered")
+)
+
+// defaultAnalyzerTimeout bounds a single analyzer call.
+const defaultAnalyzerTimeout = 5 * time.Second
+
+// maxAnalyzerItems caps how many signals, findings or incidents one analyzer
+// may add per run so a misbehaving plugin can't flood the result.
+const maxAnalyzerItems = 50
+
+var (
+	analyzersMu     sync.RWMutex
+	analyzers       []Analyzer
+	analyzerTimeout = defaultAnalyzerTimeout
+)
+
+// RegisterAnalyzer adds a custom analyzer. Call during startup, before the
+// analysis loop starts.
+func RegisterAnalyzer(a Analyzer) error {
+	if a == nil || strings.TrimSpace(a.Name()) == "" {
+		return ErrAnalyzerInvalid
+	}
+	_, isProbe := a.(ProbeAnalyzer)
+	_, isWorkspace := a.(WorkspaceAnalyzer)
+	if !isProbe && !isWorkspace {
+		return ErrAnalyzerInvalid
+	}
+
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	for _, existing := range analyzers {
+		if existing.Name() == a.Name() {
+			return fmt.Errorf("%w: %s", ErrAnalyzerDuplicate, a.Name())
+		}
+	}
+	analyzers = append(analyzers, a)
+	log.Infof("[analysis] custom analyzer registered: %s (probe=%t, workspace=%t)", a.Name(), isProbe, isWorkspace)
+	return nil
+}
+
+// SetAnalyzerTimeout overrides the per-call analyzer timeout.
+func SetAnalyzerTimeout(d time.Duration) {
+	if d <= 0 {
+		d = defaultAnalyzerTimeout
+	}
+	analyzersMu.Lock()
+	analyzerTimeout = d
+	analyzersMu.Unlock()
+}
+
+// RegisteredAnalyzers returns the names of registered analyzers, sorted.
+func RegisteredAnalyzers() []string {
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	names := make([]string, len(analyzers))
+	for i, a := range analyzers {
+		names[i] = a.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+func analyzerSnapshot() ([]Analyzer, time.Duration) {
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	return append([]Analyzer(nil), analyzers...), analyzerTimeout
+}
+
+// callAnalyzer runs fn with a timeout, converting panics into errors. An
+// analyzer that ignores ctx is abandoned once the timeout passes.
+func callAnalyzer[T any](ctx context.Context, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		out T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				done <- result{zero, fmt.Errorf("panic: %v\n%s", r, debug.Stack())}
+			}
+		}()
+		out, err := fn(ctx)
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// applyProbeAnalyzers appends custom analyzer contributions to result.
+// Analyzers see the reverse direction via result.Reverse; their output is
+// attached to the forward result.
+func applyProbeAnalyzers(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, lookbackMinutes int, result *ProbeAnalysis) {
+	list, timeout := analyzerSnapshot()
+	if len(list) == 0 || !features.Enabled(ctx, workspaceID, features.CustomAnalyzers) {
+		return
+	}
+	for _, a := range list {
+		pa, ok := a.(ProbeAnalyzer)
+		if !ok {
+			continue
+		}
+		in := ProbeAnalyzerInput{WorkspaceID: workspaceID, LookbackMinutes: lookbackMinutes, Analysis: result, CH: ch, PG: pg}
+		out, err := callAnalyzer(ctx, timeout, func(ctx context.Context) (ProbeContribution, error) {
+			return pa.AnalyzeProbe(ctx, in)
+		})
+		if err != nil {
+			log.Warnf("[analysis] custom analyzer %s failed for probe %d: %v", a.Name(), result.ProbeID, err)
+			continue
+		}
+		result.Signals = append(result.Signals, normalizeAnalyzerSignals(a.Name(), out.Signals)...)
+		result.Findings = append(result.Findings, normalizeAnalyzerFindings(a.Name(), out.Findings)...)
+	}
+}
+
+// applyWorkspaceAnalyzers returns custom analyzer incidents and findings for
+// a workspace run.
+func applyWorkspaceAnalyzers(ctx context.Context, in WorkspaceAnalyzerInput) ([]DetectedIncident, []AnalysisFinding) {
+	list, timeout := analyzerSnapshot()
+	if len(list) == 0 || !features.Enabled(ctx, in.WorkspaceID, features.CustomAnalyzers) {
+		return nil, nil
+	}
+	var incidents []DetectedIncident
+	var findings []AnalysisFinding
+	for _, a := range list {
+		wa, ok := a.(WorkspaceAnalyzer)
+		if !ok {
+			continue
+		}
+		out, err := callAnalyzer(ctx, timeout, func(ctx context.Context) (WorkspaceContribution, error) {
+			return wa.AnalyzeWorkspace(ctx, in)
+		})
+		if err != nil {
+			log.Warnf("[analysis] custom analyzer %s failed for workspace %d: %v", a.Name(), in.WorkspaceID, err)
+			continue
+		}
+		incidents = append(incidents, normalizeAnalyzerIncidents(a.Name(), in.LookbackMinutes, out.Incidents)...)
+		findings = append(findings, normalizeAnalyzerFindings(a.Name(), out.Findings)...)
+	}
+	return incidents, findings
+}
+
+// ── Normalization ──
+// Contributions are clamped to the same shape built-in results have, and
+// IDs are namespaced by analyzer so they can't collide with built-in ones
+// (incident IDs feed snapshot run tracking and tickets).
+
+func analyzerSeverity(s string) string {
+	switch s {
+	case "info", "warning", "critical":
+		return s
+	}
+	return "info"
+}
+
+func analyzerID(name, id string, i int) string {
+	if id == "" {
+		id = fmt.Sprintf("%d", i)
+	}
+	if strings.HasPrefix(id, name+":") {
+		return id
+	}
+	return name + ":" + id
+}
+
+func normalizeAnalyzerSignals(name string, in []AnalysisSignal) []AnalysisSignal {
+	if len(in) > maxAnalyzerItems {
+		in = in[:maxAnalyzerItems]
+	}
+	out := make([]AnalysisSignal, 0, len(in))
+	for _, s := range in {
+		if s.Type == "" || s.Title == "" {
+			continue
+		}
+		s.Severity = analyzerSeverity(s.Severity)
+		s.Confidence = clamp01(sanitizeFloat(s.Confidence))
+		s.Source = name
+		out = append(out, s)
+	}
+	return out
+}
+
+func normalizeAnalyzerFindings(name string, in []AnalysisFinding) []AnalysisFinding {
+	if len(in) > maxAnalyzerItems {
+		in = in[:maxAnalyzerItems]
+	}
+	out := make([]AnalysisFinding, 0, len(in))
+	for i, f := range in {
+		if f.Title == "" {
+			continue
+		}
+		f.ID = analyzerID(name, f.ID, i)
+		f.Severity = analyzerSeverity(f.Severity)
+		if f.Category == "" {
+			f.Category = "custom"
+		}
+		f.Source = name
+		out = append(out, f)
+	}
+	return out
+}
+
+func normalizeAnalyzerIncidents(name string, lookbackMinutes int, in []DetectedIncident) []DetectedIncident {
+	if len(in) > maxAnalyzerItems {
+		in = in[:maxAnalyzerItems]
+	}
+	out := make([]DetectedIncident, 0, len(in))
+	for i, inc := range in {
+		if inc.Title == "" {
+			continue
+		}
+		inc.ID = analyzerID(name, inc.ID, i)
+		inc.Severity = analyzerSeverity(inc.Severity)
+		inc.Confidence = clamp01(sanitizeFloat(inc.Confidence))
+		if inc.Scope == "" {
+			inc.Scope = "target-specific"
+		}
+		if inc.LookbackMinutes == 0 {
+			inc.LookbackMinutes = lookbackMinutes
+		}
+		// Prioritization and tickets are computed by the pipeline.
+		inc.ImpactScore, inc.Criticality, inc.FirstSeenAt, inc.DurationMinutes = 0, "", nil, 0
+		inc.ExternalView, inc.Tickets = nil, nil
+		inc.Source = name
+		out = append(out, inc)
+	}
+	return out
+}
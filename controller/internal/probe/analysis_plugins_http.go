@@ -0,0 +1,143 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── Sidecar Analyzers ──
+//
+// A sidecar is an HTTP service that implements both analyzer kinds behind
+// one endpoint. Each call is a JSON POST of the analyzer input with a
+// "kind" field ("probe" or "workspace"); the response is a
+// ProbeContribution or WorkspaceContribution. Configure with
+//
+//	ANALYZER_SIDECARS=bgp=http://bgp-checks:8080/analyze,voip=http://voip:9000/analyze
+//	ANALYZER_SIDECAR_TOKEN=...     (optional, sent as a Bearer token)
+//	ANALYZER_TIMEOUT=5s            (per call, all analyzers)
+
+// maxSidecarResponseBytes bounds a sidecar's response body.
+const maxSidecarResponseBytes = 1 << 20
+
+// HTTPAnalyzer is a ProbeAnalyzer and WorkspaceAnalyzer backed by a sidecar.
+type HTTPAnalyzer struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPAnalyzer creates a sidecar analyzer. Timeouts come from the
+// analysis context, so the client itself has none.
+func NewHTTPAnalyzer(name, endpoint, token string) (*HTTPAnalyzer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("analyzer %s: invalid endpoint %q", name, endpoint)
+	}
+	return &HTTPAnalyzer{name: name, url: endpoint, token: token, client: &http.Client{}}, nil
+}
+
+func (a *HTTPAnalyzer) Name() string { return a.name }
+
+func (a *HTTPAnalyzer) AnalyzeProbe(ctx context.Context, in ProbeAnalyzerInput) (ProbeContribution, error) {
+	var out ProbeContribution
+	err := a.post(ctx, struct {
+		Kind string `json:"kind"`
+		ProbeAnalyzerInput
+	}{"probe", in}, &out)
+	return out, err
+}
+
+func (a *HTTPAnalyzer) AnalyzeWorkspace(ctx context.Context, in WorkspaceAnalyzerInput) (WorkspaceContribution, error) {
+	var out WorkspaceContribution
+	err := a.post(ctx, struct {
+		Kind string `json:"kind"`
+		WorkspaceAnalyzerInput
+	}{"workspace", in}, &out)
+	return out, err
+}
+
+func (a *HTTPAnalyzer) post(ctx context.Context, payload any, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sidecar request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxSidecarResponseBytes))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	// 204 means "nothing to add".
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sidecar returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// RegisterSidecarAnalyzersFromEnv registers the sidecars listed in
+// ANALYZER_SIDECARS and applies ANALYZER_TIMEOUT. Invalid entries are
+// logged and skipped. Returns the number registered.
+func RegisterSidecarAnalyzersFromEnv() int {
+	if v := os.Getenv("ANALYZER_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			SetAnalyzerTimeout(d)
+		} else {
+			log.Warnf("[analysis] invalid ANALYZER_TIMEOUT %q, using %s", v, defaultAnalyzerTimeout)
+		}
+	}
+
+	token := os.Getenv("ANALYZER_SIDECAR_TOKEN")
+	n := 0
+	for _, entry := range strings.Split(os.Getenv("ANALYZER_SIDECARS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, endpoint, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Warnf("[analysis] ANALYZER_SIDECARS entry %q is not name=url", entry)
+			continue
+		}
+		a, err := NewHTTPAnalyzer(strings.TrimSpace(name), strings.TrimSpace(endpoint), token)
+		if err != nil {
+			log.Warnf("[analysis] %v", err)
+			continue
+		}
+		if err := RegisterAnalyzer(a); err != nil {
+			log.Warnf("[analysis] sidecar %s: %v", name, err)
+			continue
+		}
+		n++
+	}
+	return n
+}
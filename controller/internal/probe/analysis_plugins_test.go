@@ -0,0 +1,190 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stubAnalyzer struct {
+	name string
+	fn   func(ctx context.Context, in ProbeAnalyzerInput) (ProbeContribution, error)
+}
+
+func (s stubAnalyzer) Name() string { return s.name }
+func (s stubAnalyzer) AnalyzeProbe(ctx context.Context, in ProbeAnalyzerInput) (ProbeContribution, error) {
+	return s.fn(ctx, in)
+}
+
+type namedOnly struct{}
+
+func (namedOnly) Name() string { return "named-only" }
+
+// withAnalyzers swaps the registry for the duration of a test.
+func withAnalyzers(t *testing.T, timeout time.Duration, list ...Analyzer) {
+	t.Helper()
+	analyzersMu.Lock()
+	prev, prevTimeout := analyzers, analyzerTimeout
+	analyzers, analyzerTimeout = nil, timeout
+	analyzersMu.Unlock()
+	t.Cleanup(func() {
+		analyzersMu.Lock()
+		analyzers, analyzerTimeout = prev, prevTimeout
+		analyzersMu.Unlock()
+	})
+	for _, a := range list {
+		if err := RegisterAnalyzer(a); err != nil {
+			t.Fatalf("register %s: %v", a.Name(), err)
+		}
+	}
+}
+
+func TestRegisterAnalyzerValidation(t *testing.T) {
+	ok := stubAnalyzer{name: "bgp", fn: func(context.Context, ProbeAnalyzerInput) (ProbeContribution, error) {
+		return ProbeContribution{}, nil
+	}}
+	withAnalyzers(t, time.Second, ok)
+
+	if err := RegisterAnalyzer(ok); !errors.Is(err, ErrAnalyzerDuplicate) {
+		t.Errorf("duplicate: got %v", err)
+	}
+	if err := RegisterAnalyzer(namedOnly{}); !errors.Is(err, ErrAnalyzerInvalid) {
+		t.Errorf("no analyze methods: got %v", err)
+	}
+	if err := RegisterAnalyzer(stubAnalyzer{name: " "}); !errors.Is(err, ErrAnalyzerInvalid) {
+		t.Errorf("blank name: got %v", err)
+	}
+	if got := RegisteredAnalyzers(); len(got) != 1 || got[0] != "bgp" {
+		t.Errorf("registered = %v", got)
+	}
+}
+
+func TestApplyProbeAnalyzers(t *testing.T) {
+	withAnalyzers(t, 50*time.Millisecond,
+		stubAnalyzer{name: "voip", fn: func(_ context.Context, in ProbeAnalyzerInput) (ProbeContribution, error) {
+			if in.Analysis.Target != "10.0.0.1" {
+				t.Errorf("analyzer saw target %q", in.Analysis.Target)
+			}
+			return ProbeContribution{
+				Signals: []AnalysisSignal{
+					{Type: "codec_risk", Title: "G.711 at risk", Severity: "bogus", Confidence: 3},
+					{Type: "", Title: "dropped: no type"},
+				},
+				Findings: []AnalysisFinding{{ID: "codec", Title: "Switch codec", Severity: "warning"}},
+			}, nil
+		}},
+		stubAnalyzer{name: "panics", fn: func(context.Context, ProbeAnalyzerInput) (ProbeContribution, error) {
+			panic("boom")
+		}},
+		stubAnalyzer{name: "slow", fn: func(context.Context, ProbeAnalyzerInput) (ProbeContribution, error) {
+			time.Sleep(time.Second)
+			return ProbeContribution{Findings: []AnalysisFinding{{Title: "too late"}}}, nil
+		}},
+		stubAnalyzer{name: "errors", fn: func(context.Context, ProbeAnalyzerInput) (ProbeContribution, error) {
+			return ProbeContribution{Findings: []AnalysisFinding{{Title: "ignored"}}}, errors.New("down")
+		}},
+	)
+
+	result := &ProbeAnalysis{ProbeID: 7, Target: "10.0.0.1", Findings: []AnalysisFinding{{ID: "overall_good", Title: "Healthy"}}}
+	applyProbeAnalyzers(context.Background(), nil, nil, 1, 60, result)
+
+	if len(result.Signals) != 1 {
+		t.Fatalf("signals = %+v", result.Signals)
+	}
+	s := result.Signals[0]
+	if s.Source != "voip" || s.Severity != "info" || s.Confidence != 1 {
+		t.Errorf("signal not normalized: %+v", s)
+	}
+	if len(result.Findings) != 2 {
+		t.Fatalf("findings = %+v", result.Findings)
+	}
+	f := result.Findings[1]
+	if f.ID != "voip:codec" || f.Category != "custom" || f.Source != "voip" {
+		t.Errorf("finding not normalized: %+v", f)
+	}
+}
+
+func TestNormalizeAnalyzerIncidents(t *testing.T) {
+	now := time.Now()
+	in := []DetectedIncident{
+		{Title: "BGP leak", Severity: "critical", ImpactScore: 99, FirstSeenAt: &now, Confidence: -1},
+		{ID: "bgp:hijack", Title: "Hijack", Scope: "infrastructure", LookbackMinutes: 30},
+		{ID: "untitled"},
+	}
+	out := normalizeAnalyzerIncidents("bgp", 60, in)
+	if len(out) != 2 {
+		t.Fatalf("incidents = %+v", out)
+	}
+	if out[0].ID != "bgp:0" || out[0].ImpactScore != 0 || out[0].FirstSeenAt != nil || out[0].Confidence != 0 ||
+		out[0].Scope != "target-specific" || out[0].LookbackMinutes != 60 || out[0].Source != "bgp" {
+		t.Errorf("first incident not normalized: %+v", out[0])
+	}
+	if out[1].ID != "bgp:hijack" || out[1].Scope != "infrastructure" || out[1].LookbackMinutes != 30 {
+		t.Errorf("second incident changed unexpectedly: %+v", out[1])
+	}
+}
+
+func TestHTTPAnalyzer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			Kind        string `json:"kind"`
+			WorkspaceID uint   `json:"workspace_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Kind {
+		case "probe":
+			w.WriteHeader(http.StatusNoContent)
+		case "workspace":
+			_ = json.NewEncoder(w).Encode(WorkspaceContribution{
+				Incidents: []DetectedIncident{{ID: "leak", Title: "Route leak", Severity: "warning"}},
+			})
+		default:
+			http.Error(w, "bad kind", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPAnalyzer("x", "ftp://nope", ""); err == nil {
+		t.Error("expected invalid endpoint error")
+	}
+	a, err := NewHTTPAnalyzer("sidecar", srv.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := a.AnalyzeProbe(context.Background(), ProbeAnalyzerInput{WorkspaceID: 1, Analysis: &ProbeAnalysis{}})
+	if err != nil || len(pc.Signals)+len(pc.Findings) != 0 {
+		t.Errorf("probe: %+v, %v", pc, err)
+	}
+	wc, err := a.AnalyzeWorkspace(context.Background(), WorkspaceAnalyzerInput{WorkspaceID: 1})
+	if err != nil || len(wc.Incidents) != 1 || wc.Incidents[0].ID != "leak" {
+		t.Errorf("workspace: %+v, %v", wc, err)
+	}
+
+	bad, _ := NewHTTPAnalyzer("sidecar", srv.URL, "wrong")
+	if _, err := bad.AnalyzeWorkspace(context.Background(), WorkspaceAnalyzerInput{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected 401 error, got %v", err)
+	}
+}
+
+func TestRegisterSidecarAnalyzersFromEnv(t *testing.T) {
+	withAnalyzers(t, defaultAnalyzerTimeout)
+	t.Setenv("ANALYZER_SIDECARS", "a=http://a:8080/analyze, broken ,b=not-a-url,c=https://c/analyze")
+	t.Setenv("ANALYZER_TIMEOUT", "2s")
+
+	if n := RegisterSidecarAnalyzersFromEnv(); n != 2 {
+		t.Errorf("registered %d, want 2", n)
+	}
+	if _, timeout := analyzerSnapshot(); timeout != 2*time.Second {
+		t.Errorf("timeout = %s", timeout)
+	}
+}
@@ -48,6 +48,7 @@ LIMIT 2000
 	defer rows.Close()
 
 	var latencies []float64
+	var maxRtt float64
 	var totalLoss float64
 	var totalJitterAvg float64
 	var count int
@@ -62,19 +63,18 @@ LIMIT 2000
 			continue
 		}
 
-		var payload struct {
-			AvgRTT     int64   `json:"avg_rtt"`
-			StdDevRTT  int64   `json:"std_dev_rtt"`
-			PacketLoss float64 `json:"packet_loss"`
-		}
-		if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
+		payload, err := ParsePingPayload([]byte(payloadRaw))
+		if err != nil {
 			continue
 		}
 
-		latMs := float64(payload.AvgRTT) / 1_000_000.0 // ns to ms
-		jitterMs := float64(payload.StdDevRTT) / 1_000_000.0
+		latMs := float64(payload.AvgRtt) / 1_000_000.0 // ns to ms
+		jitterMs := float64(payload.StdDevRtt) / 1_000_000.0
 
 		latencies = append(latencies, latMs)
+		if ms := float64(payload.MaxRtt) / 1_000_000.0; ms > maxRtt {
+			maxRtt = ms
+		}
 		totalLoss += payload.PacketLoss
 		totalJitterAvg += jitterMs
 		count++
@@ -84,18 +84,25 @@ LIMIT 2000
 		return ProbeMetrics{}, nil
 	}
 
-	// Calculate percentiles
+	// Calculate percentiles. Per-cycle MaxRtt is the true worst RTT; the
+	// max of cycle averages only stands in when agents don't report it.
 	avgLat := avg(latencies)
-	p95Lat := percentile(latencies, 95)
+	pct := computeLatencyPercentiles(latencies)
+	if maxRtt < pct.Max {
+		maxRtt = pct.Max
+	}
 	avgLoss := totalLoss / float64(count)
 	avgJitterAvg := totalJitterAvg / float64(count)
 
 	return ProbeMetrics{
-		AvgLatency:  sanitizeFloat(avgLat),
-		P95Latency:  sanitizeFloat(p95Lat),
-		PacketLoss:  sanitizeFloat(avgLoss),
-		JitterAvg:   sanitizeFloat(avgJitterAvg),
-		SampleCount: count,
+		AvgLatency:    sanitizeFloat(avgLat),
+		MedianLatency: pct.P50,
+		P95Latency:    pct.P95,
+		P99Latency:    pct.P99,
+		MaxLatency:    sanitizeFloat(maxRtt),
+		PacketLoss:    sanitizeFloat(avgLoss),
+		JitterAvg:     sanitizeFloat(avgJitterAvg),
+		SampleCount:   count,
 	}, nil
 }
 
@@ -134,6 +141,7 @@ LIMIT 2000
 	var medianRTTs []float64
 	var p95RTTs []float64
 	var p99RTTs []float64
+	var maxRTT float64
 	var jitters []float64
 	var jitterMedians []float64
 	var jitterP95s []float64
@@ -151,6 +159,7 @@ LIMIT 2000
 			MedianRTT      float64 `json:"medianRTT,omitempty"`
 			P95RTT         float64 `json:"p95RTT,omitempty"`
 			P99RTT         float64 `json:"p99RTT,omitempty"`
+			MaxRTT         float64 `json:"maxRTT"`
 			StdDevRTT      float64 `json:"stdDevRTT"`
 			JitterAvg      float64 `json:"jitterAvg,omitempty"`
 			JitterMedian   float64 `json:"jitterMedian,omitempty"`
@@ -171,6 +180,9 @@ LIMIT 2000
 		if payload.P99RTT > 0 {
 			p99RTTs = append(p99RTTs, payload.P99RTT)
 		}
+		if payload.MaxRTT > maxRTT {
+			maxRTT = payload.MaxRTT
+		}
 
 		jitterVal := payload.JitterAvg
 		if jitterVal == 0 {
@@ -212,6 +224,10 @@ LIMIT 2000
 		_, _, p99Lat = FallbackPercentiles(latencies)
 	}
 
+	if m := maxF(latencies); m > maxRTT {
+		maxRTT = m
+	}
+
 	// Jitter median and P95
 	var jitterMedian, jitterP95 float64
 	if len(jitterMedians) > 0 {
@@ -226,6 +242,7 @@ LIMIT 2000
 		MedianLatency: sanitizeFloat(medianLat),
 		P95Latency:    sanitizeFloat(p95Lat),
 		P99Latency:    sanitizeFloat(p99Lat),
+		MaxLatency:    sanitizeFloat(maxRTT),
 		PacketLoss:    sanitizeFloat(totalLoss / float64(count)),
 		JitterAvg:     sanitizeFloat(avg(jitters)),
 		JitterMedian:  sanitizeFloat(jitterMedian),
@@ -285,6 +302,8 @@ LIMIT 100
 	var totalEndHopLatency float64
 	var totalEndHopLoss float64
 	var totalEndHopJitterAvg float64
+	var totalEndHopJavg float64
+	var endHopJavgCount int
 	var rateLimitedHops []int
 	var timeoutSegments []string
 	var maxHops int
@@ -325,6 +344,14 @@ LIMIT 100
 				ha.totalLatency += parseFloat(hop.Avg)
 				ha.totalLoss += parseFloat(hop.LossPct)
 				ha.count++
+				if hop.StdDev != "" && hop.Recv > 0 {
+					ha.sdMeans = append(ha.sdMeans, parseFloat(hop.Avg))
+					ha.stdDevs = append(ha.stdDevs, parseFloat(hop.StdDev))
+				}
+				ha.javgs = appendJitter(ha.javgs, hop.Javg)
+				if j := parseFloat(hop.Jmax); j > ha.jmax {
+					ha.jmax = j
+				}
 				hopMetrics[i] = ha
 			}
 		}
@@ -347,6 +374,10 @@ LIMIT 100
 		totalEndHopLatency += parseFloat(lastHop.Avg)
 		totalEndHopLoss += parseFloat(lastHop.LossPct)
 		totalEndHopJitterAvg += parseFloat(lastHop.StdDev)
+		if lastHop.Javg != "" {
+			totalEndHopJavg += parseFloat(lastHop.Javg)
+			endHopJavgCount++
+		}
 
 		// Detect ICMP rate limiting and timeout segments (only on first trace)
 		if totalTraces == 1 {
@@ -411,9 +442,14 @@ LIMIT 100
 		TimeoutSegments:    timeoutSegments,
 	}
 
+	if endHopJavgCount > 0 {
+		analysis.AvgEndHopJavg = sanitizeFloat(totalEndHopJavg / float64(endHopJavgCount))
+	}
+
 	// Build enriched hop details with agent names and per-hop metrics
 	if firstPayload != nil {
 		analysis.LatestHopsDetail = buildHopDetailsForMtrPayload(firstPayload, agentIPToID, agentByID, hopMetrics, rateLimitedSet)
+		analysis.JitterOnsetHop = jitterOnsetHop(analysis.LatestHopsDetail)
 	}
 
 	// Generate signals
@@ -453,6 +489,22 @@ LIMIT 100
 		})
 	}
 
+	if h := analysis.JitterOnsetHop; h > 0 {
+		for _, hd := range analysis.LatestHopsDetail {
+			if hd.Hop != h {
+				continue
+			}
+			signals = append(signals, AnalysisSignal{
+				Type:       "jitter_anomaly",
+				Severity:   "info",
+				Title:      "Jitter Rises at Hop",
+				Evidence:   fmt.Sprintf("Mean jitter rises to %.1fms at hop %d (%s) and persists to the destination (%.1fms); queueing likely starts there", hd.JitterAvg, h, hd.IP, analysis.AvgEndHopJavg),
+				Confidence: 0.70,
+				HopNumber:  h,
+			})
+		}
+	}
+
 	if analysis.AvgEndHopLoss > 3 {
 		sev := "warning"
 		if analysis.AvgEndHopLoss > 10 {
@@ -500,21 +552,8 @@ func findSiblingProbeIDs(ctx context.Context, db *gorm.DB, p *Probe) map[Type]ui
 			continue
 		}
 
-		sibTarget := sib.Targets[0]
-
-		// Match by agent_id target
-		if firstTarget.AgentID != nil && sibTarget.AgentID != nil {
-			if *firstTarget.AgentID == *sibTarget.AgentID {
-				result[sib.Type] = sib.ID
-				continue
-			}
-		}
-
-		// Match by literal target string (case-insensitive, trimmed)
-		if firstTarget.Target != "" && sibTarget.Target != "" {
-			if strings.EqualFold(strings.TrimSpace(firstTarget.Target), strings.TrimSpace(sibTarget.Target)) {
-				result[sib.Type] = sib.ID
-			}
+		if sameTarget(firstTarget, sib.Targets[0]) {
+			result[sib.Type] = sib.ID
 		}
 	}
 
@@ -525,6 +564,17 @@ func findSiblingProbeIDs(ctx context.Context, db *gorm.DB, p *Probe) map[Type]ui
 	return result
 }
 
+// sameTarget reports whether two probe targets name the same destination:
+// the same target agent, or the same literal target (case-insensitive,
+// trimmed).
+func sameTarget(a, b Target) bool {
+	if a.AgentID != nil && b.AgentID != nil && *a.AgentID == *b.AgentID {
+		return true
+	}
+	return a.Target != "" && b.Target != "" &&
+		strings.EqualFold(strings.TrimSpace(a.Target), strings.TrimSpace(b.Target))
+}
+
 // ── Public API ──
 
 // ComputeProbeAnalysis computes full health vector + signals for a specific probe
@@ -611,6 +661,7 @@ func ComputeProbeAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspac
 		Target:       targetName,
 		AgentID:      p.AgentID,
 		AgentName:    agentName,
+		Metadata:     ParseProbeMetadata(p.Metadata),
 		Health:       fwd.Health,
 		Metrics:      fwd.Metrics,
 		PathAnalysis: fwd.Path,
@@ -682,9 +733,47 @@ func ComputeProbeAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspac
 
 			combined := combineDirectionHealth(fwd.Health, rev.Health)
 			result.CombinedHealth = &combined
+		} else if p.Type == TypeAgent || p.Type == TypeTrafficSim {
+			// No reverse probe: estimate the return path from the
+			// TrafficSim server's receive counts instead.
+			if est := inferReverseLoss(ctx, ch, p.AgentID, targetAgentID, from); est != nil {
+				revAgentName := targetName
+				fwdLabel := fmt.Sprintf("%s → %s", agentName, revAgentName)
+				revLabel := fmt.Sprintf("%s → %s", revAgentName, agentName)
+				asymSignals, asymFindings := inferredDirectionalitySignals(est, fwdLabel, revLabel)
+				result.Signals = append(result.Signals, asymSignals...)
+				result.Findings = append(result.Findings, asymFindings...)
+				result.ReverseEstimate = est
+			}
 		}
 	}
 
+	// HTTP and TLS probes report the served certificate.
+	if p.Type == TypeHTTP || p.Type == TypeTLS {
+		certFindings := detectCertExpiryFindings(ctx, ch, []uint{p.AgentID}, probeID, from, time.Now().UTC(), agentByID)
+		result.Findings = append(result.Findings, certFindings...)
+	}
+
+	// Custom analyzers add domain-specific signals and findings.
+	applyProbeAnalyzers(ctx, ch, pg, workspaceID, lookbackMinutes, result)
+
+	// Workspace runbooks extend the built-in remediation steps.
+	if runbooks := loadRunbooks(ctx, pg, workspaceID); len(runbooks) > 0 {
+		applyRunbooksToFindings(runbooks, result.Target, result.Findings)
+		if result.Reverse != nil {
+			applyRunbooksToFindings(runbooks, result.Reverse.Target, result.Reverse.Findings)
+		}
+	}
+
+	// Freshness covers both reporters of the probe's rows.
+	var reporters []agentInfo
+	for _, id := range []uint{p.AgentID, targetAgentID} {
+		if a, ok := agentByID[id]; ok {
+			reporters = append(reporters, a)
+		}
+	}
+	result.Freshness = computeDataFreshness(ctx, ch, reporters)
+
 	return result, nil
 }
 
@@ -750,6 +839,9 @@ func analyzeProbeDirection(ctx context.Context, ch *sql.DB, in directionInput, f
 				if metrics.P99Latency == 0 {
 					metrics.P99Latency = tsMetrics.P99Latency
 				}
+				if tsMetrics.MaxLatency > metrics.MaxLatency {
+					metrics.MaxLatency = tsMetrics.MaxLatency
+				}
 				if metrics.JitterMedian == 0 {
 					metrics.JitterMedian = tsMetrics.JitterMedian
 				}
@@ -804,6 +896,10 @@ func analyzeProbeDirection(ctx context.Context, ch *sql.DB, in directionInput, f
 		})
 	}
 
+	if sig := p99SpikeSignal(metrics); sig != nil {
+		signals = append(signals, *sig)
+	}
+
 	if metrics.JitterAvg > 30 {
 		signals = append(signals, AnalysisSignal{
 			Type:       "jitter_anomaly",
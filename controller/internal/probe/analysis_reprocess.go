@@ -0,0 +1,490 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Snapshot Reprocessing ──
+//
+// Live analysis snapshots are scored by whatever code was running when
+// they were written, so a change to health scoring, payload parsers or
+// incident detection leaves history inconsistent. A reprocess job
+// re-runs ComputeWorkspaceAnalysis "as of" points in a historical range —
+// every metric query gains an upper bound at that instant — and writes the
+// results to analysis_snapshot_versions tagged with the current
+// ScoringVersion and the job ID. Live snapshots are never modified, so old
+// and new scores can be compared side by side.
+//
+// Reprocessed points skip data freshness and LLM enrichment, and count an
+// agent as online when it reported data in the lookback window (connection
+// state is not recorded historically). Rollups are computed on read from
+// probe_data, so there is nothing further to rebuild.
+
+// ScoringVersion identifies the scoring and detection logic that produced
+// a snapshot. Bump it when a change alters scores for the same raw data.
+//
+//	1: initial versioned scoring
+//	2: workspace PING/TrafficSim entries score with their real p95
+const ScoringVersion uint32 = 2
+
+const (
+	ReprocessPending   = "pending"
+	ReprocessRunning   = "running"
+	ReprocessCompleted = "completed"
+	ReprocessFailed    = "failed"
+
+	// maxReprocessPoints caps the snapshots one job may compute.
+	maxReprocessPoints = 2000
+	// maxReprocessRange caps the historical range of one job.
+	maxReprocessRange = 90 * 24 * time.Hour
+)
+
+// analysisSnapshotVersionsDDL creates the ClickHouse table for reprocessed
+// snapshots; %d is the retention in days.
+const analysisSnapshotVersionsDDL = `
+	CREATE TABLE IF NOT EXISTS analysis_snapshot_versions (
+		job_id            UInt64,
+		workspace_id      UInt64,
+		generated_at      DateTime('UTC'),
+		scoring_version   UInt32,
+		overall_health    Float64,
+		grade             LowCardinality(String),
+		latency_score     Float64,
+		packet_loss_score Float64,
+		route_stability   Float64,
+		mos_score         Float64,
+		status            LowCardinality(String),
+		incident_count    UInt32,
+		total_agents      UInt32,
+		online_agents     UInt32,
+		total_probes      UInt32,
+		incidents_json    String,
+		agents_json       String,
+		reprocessed_at    DateTime('UTC')
+	)
+	ENGINE = MergeTree
+	PARTITION BY toYYYYMM(generated_at)
+	ORDER BY (workspace_id, job_id, generated_at)
+	TTL %s
+	SETTINGS index_granularity = 8192%s;
+`
+
+// ReprocessJob is a request to recompute snapshots over a range.
+// StepMinutes 0 reprocesses at the timestamps of the live snapshots in the
+// range, so every reprocessed row has an exact counterpart.
+type ReprocessJob struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	WorkspaceID     uint       `gorm:"index;not null" json:"workspace_id"`
+	RangeFrom       time.Time  `gorm:"not null" json:"from"`
+	RangeTo         time.Time  `gorm:"not null" json:"to"`
+	StepMinutes     int        `gorm:"not null;default:0" json:"step_minutes"`
+	LookbackMinutes int        `gorm:"not null;default:60" json:"lookback_minutes"`
+	ScoringVersion  uint32     `gorm:"not null" json:"scoring_version"`
+	Status          string     `gorm:"size:20;not null;index" json:"status"`
+	Total           int        `json:"total"`
+	Processed       int        `json:"processed"`
+	Written         int        `json:"written"`
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	RequestedBy     uint       `json:"requested_by,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+func (ReprocessJob) TableName() string { return "analysis_reprocess_jobs" }
+
+// ReprocessInput is the create body.
+type ReprocessInput struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	StepMinutes     int       `json:"step_minutes"`
+	LookbackMinutes int       `json:"lookback_minutes"`
+}
+
+// CreateReprocessJob validates the range and queues a job.
+func CreateReprocessJob(ctx context.Context, pg *gorm.DB, workspaceID, userID uint, in ReprocessInput) (*ReprocessJob, error) {
+	from, to := in.From.UTC(), in.To.UTC()
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, fmt.Errorf("%w: from and to required, with to after from", ErrBadInput)
+	}
+	if to.After(time.Now().UTC()) {
+		return nil, fmt.Errorf("%w: to must not be in the future", ErrBadInput)
+	}
+	if to.Sub(from) > maxReprocessRange {
+		return nil, fmt.Errorf("%w: range exceeds %d days", ErrBadInput, int(maxReprocessRange.Hours()/24))
+	}
+	if in.StepMinutes < 0 || in.LookbackMinutes < 0 {
+		return nil, fmt.Errorf("%w: step_minutes and lookback_minutes must be positive", ErrBadInput)
+	}
+	if in.StepMinutes > 0 && int(to.Sub(from)/(time.Duration(in.StepMinutes)*time.Minute)) >= maxReprocessPoints {
+		return nil, fmt.Errorf("%w: more than %d points; increase step_minutes", ErrBadInput, maxReprocessPoints)
+	}
+	if in.LookbackMinutes == 0 {
+		in.LookbackMinutes = 60
+	}
+
+	job := &ReprocessJob{
+		WorkspaceID:     workspaceID,
+		RangeFrom:       from,
+		RangeTo:         to,
+		StepMinutes:     in.StepMinutes,
+		LookbackMinutes: in.LookbackMinutes,
+		ScoringVersion:  ScoringVersion,
+		Status:          ReprocessPending,
+		RequestedBy:     userID,
+	}
+	if err := pg.WithContext(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListReprocessJobs returns a workspace's jobs, newest first.
+func ListReprocessJobs(ctx context.Context, pg *gorm.DB, workspaceID uint) ([]ReprocessJob, error) {
+	var jobs []ReprocessJob
+	err := pg.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("id DESC").
+		Limit(100).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// GetReprocessJob returns one job scoped to its workspace.
+func GetReprocessJob(ctx context.Context, pg *gorm.DB, workspaceID, jobID uint) (*ReprocessJob, error) {
+	var job ReprocessJob
+	err := pg.WithContext(ctx).
+		Where("id = ? AND workspace_id = ?", jobID, workspaceID).
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ---- As-of context ----
+
+type analysisAsOfKey struct{}
+
+// withAnalysisAsOf makes analysis run as if the current time were t.
+func withAnalysisAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, analysisAsOfKey{}, t.UTC())
+}
+
+// analysisNow returns the as-of time and true while reprocessing,
+// otherwise the current time.
+func analysisNow(ctx context.Context) (time.Time, bool) {
+	if t, ok := ctx.Value(analysisAsOfKey{}).(time.Time); ok {
+		return t, true
+	}
+	return time.Now().UTC(), false
+}
+
+// asOfBound is an extra created_at upper bound for analysis queries
+// ("" outside reprocessing).
+func asOfBound(ctx context.Context) string {
+	if t, ok := ctx.Value(analysisAsOfKey{}).(time.Time); ok {
+		return " AND created_at <= " + chQuoteTime(t)
+	}
+	return ""
+}
+
+// ---- Worker ----
+
+// StartReprocessWorker runs queued reprocess jobs one at a time until ctx
+// is cancelled. Jobs interrupted by a restart are picked up again; their
+// partial rows are replaced.
+func StartReprocessWorker(ctx context.Context, ch *sql.DB, pg *gorm.DB) {
+	if err := pg.WithContext(ctx).Model(&ReprocessJob{}).
+		Where("status = ?", ReprocessRunning).
+		Update("status", ReprocessPending).Error; err != nil {
+		log.Warnf("[reprocess] failed to requeue interrupted jobs: %v", err)
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		for {
+			var job ReprocessJob
+			err := pg.WithContext(ctx).
+				Where("status = ?", ReprocessPending).
+				Order("id ASC").
+				First(&job).Error
+			if err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) && ctx.Err() == nil {
+					log.Warnf("[reprocess] poll failed: %v", err)
+				}
+				break
+			}
+			runReprocessJob(ctx, ch, pg, &job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runReprocessJob(ctx context.Context, ch *sql.DB, pg *gorm.DB, job *ReprocessJob) {
+	started := time.Now().UTC()
+	job.Status = ReprocessRunning
+	job.StartedAt = &started
+	job.Processed, job.Written, job.LastError = 0, 0, ""
+	pg.WithContext(ctx).Save(job)
+
+	fail := func(err error) {
+		done := time.Now().UTC()
+		job.Status = ReprocessFailed
+		job.LastError = err.Error()
+		job.CompletedAt = &done
+		pg.WithContext(context.Background()).Save(job)
+		log.Warnf("[reprocess] job %d workspace %d failed: %v", job.ID, job.WorkspaceID, err)
+	}
+
+	points, err := reprocessPoints(ctx, ch, job)
+	if err != nil {
+		fail(fmt.Errorf("list points: %w", err))
+		return
+	}
+	if err := deleteReprocessedRows(ctx, ch, job); err != nil {
+		fail(fmt.Errorf("clear previous rows: %w", err))
+		return
+	}
+	job.Total = len(points)
+	pg.WithContext(ctx).Save(job)
+	log.Infof("[reprocess] job %d workspace %d: %d points (scoring v%d)", job.ID, job.WorkspaceID, len(points), job.ScoringVersion)
+
+	for i, at := range points {
+		if ctx.Err() != nil {
+			// Shutdown: leave it running so the next start requeues it.
+			return
+		}
+		analysis, err := ComputeWorkspaceAnalysis(withAnalysisAsOf(ctx, at), ch, pg, job.WorkspaceID, job.LookbackMinutes)
+		job.Processed++
+		if err != nil {
+			job.LastError = err.Error()
+		} else if err := saveReprocessedSnapshot(ctx, ch, job, analysis); err != nil {
+			job.LastError = err.Error()
+		} else {
+			job.Written++
+		}
+		if (i+1)%25 == 0 {
+			pg.WithContext(ctx).Save(job)
+		}
+	}
+
+	if job.Written == 0 && job.Total > 0 {
+		fail(fmt.Errorf("no snapshots written: %s", job.LastError))
+		return
+	}
+	done := time.Now().UTC()
+	job.Status = ReprocessCompleted
+	job.CompletedAt = &done
+	pg.WithContext(ctx).Save(job)
+	log.Infof("[reprocess] job %d complete: %d/%d snapshots in %v", job.ID, job.Written, job.Total, done.Sub(started).Round(time.Second))
+}
+
+// reprocessPoints returns the as-of times for a job: the live snapshot
+// timestamps in range, or a fixed grid when StepMinutes is set.
+func reprocessPoints(ctx context.Context, ch *sql.DB, job *ReprocessJob) ([]time.Time, error) {
+	if job.StepMinutes > 0 {
+		step := time.Duration(job.StepMinutes) * time.Minute
+		var out []time.Time
+		for t := job.RangeFrom; !t.After(job.RangeTo) && len(out) < maxReprocessPoints; t = t.Add(step) {
+			out = append(out, t)
+		}
+		return out, nil
+	}
+	snaps, err := GetAnalysisSnapshots(ctx, ch, job.WorkspaceID, job.RangeFrom, job.RangeTo, maxReprocessPoints)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]time.Time, 0, len(snaps))
+	for _, s := range snaps {
+		out = append(out, s.GeneratedAt.UTC())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out, nil
+}
+
+func deleteReprocessedRows(ctx context.Context, ch *sql.DB, job *ReprocessJob) error {
+	q := fmt.Sprintf("DELETE FROM analysis_snapshot_versions WHERE job_id = %d", job.ID)
+	if !EmbeddedTelemetry() {
+		q = fmt.Sprintf("ALTER TABLE analysis_snapshot_versions DELETE WHERE job_id = %d", job.ID)
+	}
+	_, err := ch.ExecContext(ctx, q)
+	return err
+}
+
+func saveReprocessedSnapshot(ctx context.Context, ch *sql.DB, job *ReprocessJob, analysis *WorkspaceAnalysis) error {
+	onlineCount := 0
+	for _, a := range analysis.Agents {
+		if a.IsOnline {
+			onlineCount++
+		}
+	}
+	incidentsJSON, _ := json.Marshal(analysis.Incidents)
+	agentsJSON, _ := json.Marshal(analysis.Agents)
+
+	const ins = `
+INSERT INTO analysis_snapshot_versions
+(job_id, workspace_id, generated_at, scoring_version, overall_health, grade,
+ latency_score, packet_loss_score, route_stability, mos_score, status,
+ incident_count, total_agents, online_agents, total_probes,
+ incidents_json, agents_json, reprocessed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+	_, err := ch.ExecContext(ctx, ins,
+		uint64(job.ID),
+		uint64(analysis.WorkspaceID),
+		analysis.GeneratedAt,
+		job.ScoringVersion,
+		analysis.OverallHealth.OverallHealth,
+		analysis.OverallHealth.Grade,
+		analysis.OverallHealth.LatencyScore,
+		analysis.OverallHealth.PacketLossScore,
+		analysis.OverallHealth.RouteStability,
+		analysis.OverallHealth.MosScore,
+		analysis.Status.Status,
+		uint32(len(analysis.Incidents)),
+		uint32(analysis.TotalAgents),
+		uint32(onlineCount),
+		uint32(analysis.TotalProbes),
+		string(incidentsJSON),
+		string(agentsJSON),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// ---- Comparison ----
+
+// SnapshotScore is the comparable part of a snapshot.
+type SnapshotScore struct {
+	ScoringVersion  uint32  `json:"scoring_version"`
+	OverallHealth   float64 `json:"overall_health"`
+	Grade           string  `json:"grade"`
+	LatencyScore    float64 `json:"latency_score"`
+	PacketLossScore float64 `json:"packet_loss_score"`
+	RouteStability  float64 `json:"route_stability"`
+	MosScore        float64 `json:"mos_score"`
+	Status          string  `json:"status"`
+	IncidentCount   int     `json:"incident_count"`
+}
+
+// SnapshotComparison pairs a reprocessed snapshot with the live snapshot
+// at the same instant (nil when none exists, e.g. a step grid).
+type SnapshotComparison struct {
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Original     *SnapshotScore `json:"original,omitempty"`
+	Reprocessed  SnapshotScore  `json:"reprocessed"`
+	HealthDelta  *float64       `json:"health_delta,omitempty"`
+	GradeChanged bool           `json:"grade_changed"`
+}
+
+// ReprocessComparison summarizes a job's output against live history.
+type ReprocessComparison struct {
+	Job             ReprocessJob         `json:"job"`
+	Points          []SnapshotComparison `json:"points"`
+	Matched         int                  `json:"matched"`
+	MeanHealthDelta float64              `json:"mean_health_delta"`
+	MaxAbsDelta     float64              `json:"max_abs_health_delta"`
+	GradeChanges    int                  `json:"grade_changes"`
+}
+
+// CompareReprocessJob pairs a job's reprocessed snapshots with the live
+// snapshots written at the same times.
+func CompareReprocessJob(ctx context.Context, ch *sql.DB, job *ReprocessJob) (*ReprocessComparison, error) {
+	q := fmt.Sprintf(`
+SELECT generated_at, scoring_version, overall_health, grade, latency_score,
+       packet_loss_score, route_stability, mos_score, status, incident_count
+FROM analysis_snapshot_versions
+WHERE workspace_id = %d AND job_id = %d
+ORDER BY generated_at ASC
+LIMIT %d
+`, job.WorkspaceID, job.ID, maxReprocessPoints)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := &ReprocessComparison{Job: *job, Points: []SnapshotComparison{}}
+	for rows.Next() {
+		var p SnapshotComparison
+		r := &p.Reprocessed
+		if err := rows.Scan(&p.GeneratedAt, &r.ScoringVersion, &r.OverallHealth, &r.Grade, &r.LatencyScore,
+			&r.PacketLossScore, &r.RouteStability, &r.MosScore, &r.Status, &r.IncidentCount); err != nil {
+			return nil, err
+		}
+		p.GeneratedAt = p.GeneratedAt.UTC()
+		out.Points = append(out.Points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	live, err := GetAnalysisSnapshots(ctx, ch, job.WorkspaceID, job.RangeFrom, job.RangeTo, maxReprocessPoints)
+	if err != nil {
+		return nil, err
+	}
+	matchSnapshotComparisons(out, live)
+	return out, nil
+}
+
+// matchSnapshotComparisons attaches live snapshots to reprocessed points
+// at the same second and fills in the summary.
+func matchSnapshotComparisons(out *ReprocessComparison, live []AnalysisSnapshot) {
+	byTime := make(map[int64]AnalysisSnapshot, len(live))
+	for _, s := range live {
+		byTime[s.GeneratedAt.Unix()] = s
+	}
+
+	var sum float64
+	for i := range out.Points {
+		p := &out.Points[i]
+		s, ok := byTime[p.GeneratedAt.Unix()]
+		if !ok {
+			continue
+		}
+		p.Original = &SnapshotScore{
+			ScoringVersion:  s.ScoringVersion,
+			OverallHealth:   s.OverallHealth,
+			Grade:           s.Grade,
+			LatencyScore:    s.LatencyScore,
+			PacketLossScore: s.PacketLossScore,
+			RouteStability:  s.RouteStability,
+			MosScore:        s.MosScore,
+			Status:          s.Status,
+			IncidentCount:   s.IncidentCount,
+		}
+		d := p.Reprocessed.OverallHealth - s.OverallHealth
+		p.HealthDelta = &d
+		p.GradeChanged = p.Reprocessed.Grade != s.Grade
+		out.Matched++
+		sum += d
+		out.MaxAbsDelta = math.Max(out.MaxAbsDelta, math.Abs(d))
+		if p.GradeChanged {
+			out.GradeChanges++
+		}
+	}
+	if out.Matched > 0 {
+		out.MeanHealthDelta = sum / float64(out.Matched)
+	}
+}
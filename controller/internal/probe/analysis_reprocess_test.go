@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAnalysisAsOf verifies the as-of context bounds analysis queries and
+// replaces the wall clock only while reprocessing.
+func TestAnalysisAsOf(t *testing.T) {
+	ctx := context.Background()
+	if _, reprocessing := analysisNow(ctx); reprocessing || asOfBound(ctx) != "" {
+		t.Fatal("plain context should not be reprocessing")
+	}
+
+	at := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	ctx = withAnalysisAsOf(ctx, at)
+	if now, reprocessing := analysisNow(ctx); !reprocessing || !now.Equal(at) {
+		t.Errorf("analysisNow = %v, %v", now, reprocessing)
+	}
+	if got := asOfBound(ctx); !strings.Contains(got, "created_at <= '2026-03-01 10:30:00'") {
+		t.Errorf("asOfBound = %q", got)
+	}
+}
+
+// TestMatchSnapshotComparisons verifies reprocessed points pair with live
+// snapshots at the same second and the summary counts only matches.
+func TestMatchSnapshotComparisons(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	out := &ReprocessComparison{Points: []SnapshotComparison{
+		{GeneratedAt: t0, Reprocessed: SnapshotScore{OverallHealth: 80, Grade: "good"}},
+		{GeneratedAt: t0.Add(5 * time.Minute), Reprocessed: SnapshotScore{OverallHealth: 60, Grade: "fair"}},
+		{GeneratedAt: t0.Add(7 * time.Minute), Reprocessed: SnapshotScore{OverallHealth: 90, Grade: "excellent"}},
+	}}
+	live := []AnalysisSnapshot{
+		{GeneratedAt: t0, OverallHealth: 70, Grade: "good"},
+		{GeneratedAt: t0.Add(5 * time.Minute), OverallHealth: 75, Grade: "good"},
+	}
+
+	matchSnapshotComparisons(out, live)
+	if out.Matched != 2 || out.GradeChanges != 1 {
+		t.Fatalf("matched = %d, grade changes = %d", out.Matched, out.GradeChanges)
+	}
+	if out.MeanHealthDelta != -2.5 || out.MaxAbsDelta != 15 {
+		t.Errorf("mean = %v, max = %v", out.MeanHealthDelta, out.MaxAbsDelta)
+	}
+	if out.Points[2].Original != nil || out.Points[2].HealthDelta != nil {
+		t.Errorf("unmatched point got original: %+v", out.Points[2])
+	}
+}
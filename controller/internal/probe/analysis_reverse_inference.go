@@ -0,0 +1,224 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── Reverse-path inference ──
+//
+// Without a reverse probe there is no return-path data to compare against,
+// but a TrafficSim client/server pair still observes both halves of the
+// round trip: the client counts probes whose echo never came back
+// (round-trip loss), and the server counts how many of the client's packets
+// actually arrived (forward loss). A packet survives the round trip only if
+// it survives both legs, so
+//
+//	(1 - roundTrip) = (1 - forward) × (1 - reverse)
+//
+// and the reverse loss falls out without any measurement from the far end.
+//
+// Both sides are bucketed by reverseInferenceBucket and only buckets both
+// sides reported are compared, so a server that started reporting late or
+// went quiet doesn't look like forward loss.
+
+const (
+	reverseInferenceBucket     = 5 * time.Minute
+	reverseInferenceMinPackets = 100
+	reverseInferenceMinBuckets = 2
+)
+
+// ReverseLossEstimate is the return-path loss inferred from TrafficSim
+// client and server counters for a probe with no reverse data.
+type ReverseLossEstimate struct {
+	RoundTripLossPct float64 `json:"round_trip_loss_pct"` // client-observed
+	ForwardLossPct   float64 `json:"forward_loss_pct"`    // server-observed
+	ReverseLossPct   float64 `json:"reverse_loss_pct"`    // inferred
+	PacketsSent      uint64  `json:"packets_sent"`
+	PacketsLost      uint64  `json:"packets_lost"`
+	ServerReceived   uint64  `json:"server_received"`
+	Buckets          int     `json:"buckets"`
+}
+
+// tsClientBucket is the client's TrafficSim counters in one bucket.
+type tsClientBucket struct {
+	Sent uint64
+	Lost uint64
+}
+
+// estimateReverseLoss combines client and server counters over the buckets
+// both reported. Nil when there is too little overlap to say anything.
+func estimateReverseLoss(client map[time.Time]tsClientBucket, server map[time.Time]uint64) *ReverseLossEstimate {
+	var est ReverseLossEstimate
+	for b, c := range client {
+		recv, ok := server[b]
+		if !ok || c.Sent == 0 {
+			continue
+		}
+		est.PacketsSent += c.Sent
+		est.PacketsLost += min(c.Lost, c.Sent)
+		// Duplicates can push the server count past what was sent.
+		est.ServerReceived += min(recv, c.Sent)
+		est.Buckets++
+	}
+	if est.Buckets < reverseInferenceMinBuckets || est.PacketsSent < reverseInferenceMinPackets {
+		return nil
+	}
+
+	sent := float64(est.PacketsSent)
+	roundTrip := float64(est.PacketsLost) / sent
+	forward := 1 - float64(est.ServerReceived)/sent
+	// The forward leg can't lose more than the round trip did; a higher
+	// value is clock skew between buckets, not loss.
+	forward = math.Min(forward, roundTrip)
+	reverse := 0.0
+	if forward < 1 {
+		reverse = math.Max(0, 1-(1-roundTrip)/(1-forward))
+	}
+
+	est.RoundTripLossPct = roundTo(roundTrip*100, 2)
+	est.ForwardLossPct = roundTo(forward*100, 2)
+	est.ReverseLossPct = roundTo(reverse*100, 2)
+	return &est
+}
+
+// fetchReverseInferenceCounters reads the client's sent/lost counters for
+// TrafficSim traffic from ownerID to targetID and the server's received
+// counts for the same client, bucketed.
+func fetchReverseInferenceCounters(ctx context.Context, ch *sql.DB, ownerID, targetID uint, from time.Time) (map[time.Time]tsClientBucket, map[time.Time]uint64, error) {
+	bucket := fmt.Sprintf("toStartOfInterval(created_at, INTERVAL %d SECOND)", int(reverseInferenceBucket.Seconds()))
+
+	clientQ := fmt.Sprintf(`
+SELECT %s AS b,
+    sum(JSONExtractUInt(payload_raw, 'totalPackets')) AS sent,
+    sum(JSONExtractUInt(payload_raw, 'lostPackets')) AS lost
+FROM probe_data
+WHERE type = 'TRAFFICSIM'
+  AND agent_id = %d
+  AND target_agent = %d
+  AND created_at >= %s%s
+  AND JSONHas(payload_raw, 'totalPackets')
+GROUP BY b
+`, bucket, ownerID, targetID, chQuoteTime(from), asOfBound(ctx))
+
+	rows, err := ch.QueryContext(ctx, clientQ)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client counters: %w", err)
+	}
+	client := make(map[time.Time]tsClientBucket)
+	for rows.Next() {
+		var b time.Time
+		var c tsClientBucket
+		if err := rows.Scan(&b, &c.Sent, &c.Lost); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		client[b.UTC()] = c
+	}
+	rows.Close()
+	if len(client) == 0 {
+		return client, nil, nil
+	}
+
+	// Servers report the packets they received from each client; older
+	// agents use the camelCase key.
+	serverQ := fmt.Sprintf(`
+SELECT %s AS b,
+    sum(greatest(JSONExtractUInt(payload_raw, 'packets_received'), JSONExtractUInt(payload_raw, 'packetsReceived'))) AS recv
+FROM probe_data
+WHERE type = 'TRAFFICSIM'
+  AND agent_id = %d
+  AND target_agent = %d
+  AND created_at >= %s%s
+  AND (JSONHas(payload_raw, 'packets_received') OR JSONHas(payload_raw, 'packetsReceived'))
+GROUP BY b
+`, bucket, targetID, ownerID, chQuoteTime(from), asOfBound(ctx))
+
+	rows, err = ch.QueryContext(ctx, serverQ)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server counters: %w", err)
+	}
+	defer rows.Close()
+	server := make(map[time.Time]uint64)
+	for rows.Next() {
+		var b time.Time
+		var recv uint64
+		if err := rows.Scan(&b, &recv); err != nil {
+			return nil, nil, err
+		}
+		server[b.UTC()] = recv
+	}
+	return client, server, rows.Err()
+}
+
+// inferReverseLoss estimates the return-path loss from ownerID's TrafficSim
+// traffic to targetID's server. Nil when the server doesn't report receive
+// counts or there is too little data.
+func inferReverseLoss(ctx context.Context, ch *sql.DB, ownerID, targetID uint, from time.Time) *ReverseLossEstimate {
+	if ch == nil || ownerID == 0 || targetID == 0 {
+		return nil
+	}
+	client, server, err := fetchReverseInferenceCounters(ctx, ch, ownerID, targetID, from)
+	if err != nil {
+		log.Warnf("[Analysis] reverse-loss inference %d→%d: %v", ownerID, targetID, err)
+		return nil
+	}
+	return estimateReverseLoss(client, server)
+}
+
+// inferredDirectionalitySignals turns an estimate into the same loss
+// asymmetry signal and finding a reverse probe would produce, at lower
+// confidence and labelled as inferred.
+func inferredDirectionalitySignals(est *ReverseLossEstimate, fwdLabel, revLabel string) ([]AnalysisSignal, []AnalysisFinding) {
+	if est == nil {
+		return nil, nil
+	}
+	diff := est.ForwardLossPct - est.ReverseLossPct
+	maxLoss := math.Max(est.ForwardLossPct, est.ReverseLossPct)
+	if math.Abs(diff) < 2 || maxLoss < 1 {
+		return nil, nil
+	}
+	sev := "warning"
+	if maxLoss > 5 && math.Abs(diff) >= 5 {
+		sev = "critical"
+	}
+	dir, other := revLabel, fwdLabel
+	if diff > 0 {
+		dir, other = fwdLabel, revLabel
+	}
+
+	evidence := []string{
+		fmt.Sprintf("Round trip (client-observed): %.1f%% of %d packets lost", est.RoundTripLossPct, est.PacketsSent),
+		fmt.Sprintf("%s (server-observed): %.1f%% loss, %d of %d packets received", fwdLabel, est.ForwardLossPct, est.ServerReceived, est.PacketsSent),
+		fmt.Sprintf("%s (inferred): %.1f%% loss", revLabel, est.ReverseLossPct),
+		fmt.Sprintf("Compared over %d %.0f-minute intervals reported by both ends", est.Buckets, reverseInferenceBucket.Minutes()),
+	}
+	signals := []AnalysisSignal{{
+		Type:     "loss_asymmetry_inferred",
+		Severity: sev,
+		Title:    "Directional Packet Loss (Inferred)",
+		Evidence: fmt.Sprintf("%s: %.1f%% loss (server-observed) vs %s: %.1f%% loss (inferred from round trip)",
+			fwdLabel, est.ForwardLossPct, revLabel, est.ReverseLossPct),
+		Confidence: 0.7,
+	}}
+	findings := []AnalysisFinding{{
+		ID:       "loss-asymmetry-inferred",
+		Title:    fmt.Sprintf("Packet loss appears concentrated in one direction (%s)", dir),
+		Severity: sev,
+		Category: "directionality",
+		Summary: fmt.Sprintf("There is no reverse probe for this path, but the TrafficSim server's receive counts show the %s direction losing about %.1f%% of packets against %.1f%% for %s. This is an estimate from round-trip and server-side counters; add a reverse probe to measure the return path directly.",
+			dir, maxLoss, math.Min(est.ForwardLossPct, est.ReverseLossPct), other),
+		Evidence: evidence,
+		Steps: []string{
+			"Check upload utilization/saturation at the source of the degraded direction",
+			"Look for one-way QoS policing or rate limiting (especially on DSCP-marked traffic)",
+			"Enable bidirectional mode on the AGENT probe to measure the return path directly",
+		},
+	}}
+	return signals, findings
+}
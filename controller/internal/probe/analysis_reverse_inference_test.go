@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEstimateReverseLoss verifies the reverse leg is derived from the
+// round trip and server counts over buckets both ends reported.
+func TestEstimateReverseLoss(t *testing.T) {
+	t0 := time.Date(2026, 5, 5, 12, 0, 0, 0, time.UTC)
+	b := func(i int) time.Time { return t0.Add(time.Duration(i) * reverseInferenceBucket) }
+
+	// 1000 sent, 100 lost round trip, server received 990: forward 1%,
+	// reverse 1 - 0.9/0.99 ≈ 9.09%.
+	client := map[time.Time]tsClientBucket{
+		b(0): {Sent: 500, Lost: 50},
+		b(1): {Sent: 500, Lost: 50},
+		b(2): {Sent: 500, Lost: 500}, // server never reported this bucket
+	}
+	server := map[time.Time]uint64{b(0): 495, b(1): 495}
+
+	est := estimateReverseLoss(client, server)
+	if est == nil {
+		t.Fatal("expected an estimate")
+	}
+	if est.Buckets != 2 || est.PacketsSent != 1000 {
+		t.Errorf("buckets=%d sent=%d, want 2/1000", est.Buckets, est.PacketsSent)
+	}
+	if est.RoundTripLossPct != 10 || est.ForwardLossPct != 1 || est.ReverseLossPct != 9.09 {
+		t.Errorf("loss rt=%.2f fwd=%.2f rev=%.2f, want 10/1/9.09", est.RoundTripLossPct, est.ForwardLossPct, est.ReverseLossPct)
+	}
+
+	signals, findings := inferredDirectionalitySignals(est, "A → B", "B → A")
+	if len(signals) != 1 || signals[0].Severity != "critical" {
+		t.Fatalf("signals = %+v", signals)
+	}
+	if len(findings) != 1 || !strings.Contains(findings[0].Title, "B → A") {
+		t.Errorf("finding should name the return path B → A: %+v", findings)
+	}
+
+	// Server counting more than the round trip lost (bucket skew) clamps
+	// the forward leg to the round trip.
+	skewed := estimateReverseLoss(
+		map[time.Time]tsClientBucket{b(0): {Sent: 100, Lost: 1}, b(1): {Sent: 100, Lost: 1}},
+		map[time.Time]uint64{b(0): 80, b(1): 80},
+	)
+	if skewed == nil || skewed.ForwardLossPct != 1 || skewed.ReverseLossPct != 0 {
+		t.Errorf("skewed = %+v", skewed)
+	}
+	if sig, _ := inferredDirectionalitySignals(skewed, "A → B", "B → A"); len(sig) != 0 {
+		t.Errorf("symmetric low loss should not signal: %+v", sig)
+	}
+
+	// Too little overlap.
+	if est := estimateReverseLoss(client, map[time.Time]uint64{b(0): 495}); est != nil {
+		t.Errorf("single bucket should not estimate: %+v", est)
+	}
+}
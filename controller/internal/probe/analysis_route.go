@@ -40,6 +40,12 @@ type HopDetail struct {
 	Latency       float64 `json:"latency,omitempty"`
 	Loss          float64 `json:"loss,omitempty"`
 	IsRateLimited bool    `json:"is_rate_limited,omitempty"`
+	// Per-hop spread across traces (see mtr_jitter.go); omitted when the
+	// agent does not report it.
+	Hop       int     `json:"hop,omitempty"` // 1-based position in the trace
+	StdDev    float64 `json:"stddev,omitempty"`
+	JitterAvg float64 `json:"jitter_avg,omitempty"`
+	JitterMax float64 `json:"jitter_max,omitempty"`
 }
 
 // hopAgg holds aggregated metrics for a single hop index across traces
@@ -47,6 +53,10 @@ type hopAgg struct {
 	totalLatency float64
 	totalLoss    float64
 	count        int
+	sdMeans      []float64
+	stdDevs      []float64
+	javgs        []float64
+	jmax         float64
 }
 
 // buildHopDetails creates enriched hop details from raw MTR hops, matching IPs to agents (uses MtrPayload from clickhouse.go)
@@ -93,9 +103,13 @@ func buildHopDetailsForMtrPayload(mtrPayload *mtrPayload, agentIPToID map[string
 			Hostname: hop.Hosts[0].Hostname,
 		}
 		// Populate per-hop aggregated metrics
+		hd.Hop = i + 1
 		if ha, ok := hopMetrics[i]; ok && ha.count > 0 {
 			hd.Latency = sanitizeFloat(ha.totalLatency / float64(ha.count))
 			hd.Loss = sanitizeFloat(ha.totalLoss / float64(ha.count))
+			hd.StdDev = pooledStdDev(ha.sdMeans, ha.stdDevs)
+			hd.JitterAvg = sanitizeFloat(avg(ha.javgs))
+			hd.JitterMax = sanitizeFloat(ha.jmax)
 		}
 		if rateLimitedSet[i] {
 			hd.IsRateLimited = true
@@ -147,6 +161,7 @@ type HopMetric struct {
 	IP       string  `json:"ip"`
 	Loss     float64 `json:"loss"`
 	Latency  float64 `json:"latency"`
+	Jitter   float64 `json:"jitter,omitempty"` // mean jitter (javg), when reported
 	HopIndex int     `json:"hop_index"`
 }
 
@@ -160,13 +175,14 @@ type HopMetrics struct {
 
 // AgentRouteInfo holds route/path data for a single agent.
 type AgentRouteInfo struct {
-	AgentID      uint             `json:"agent_id"`
-	AgentName    string           `json:"agent_name"`
-	PublicIP     string           `json:"public_ip,omitempty"`
-	ISP          string           `json:"isp,omitempty"`
-	HasIPChange  bool             `json:"has_ip_change"`
-	HasISPChange bool             `json:"has_isp_change"`
-	Routes       []ProbeRouteInfo `json:"routes"`
+	AgentID          uint             `json:"agent_id"`
+	AgentName        string           `json:"agent_name"`
+	PublicIP         string           `json:"public_ip,omitempty"`
+	ISP              string           `json:"isp,omitempty"`
+	HasIPChange      bool             `json:"has_ip_change"`
+	HasISPChange     bool             `json:"has_isp_change"`
+	HasNetworkChange bool             `json:"has_network_change"` // gateway, DNS, interface or VPN change
+	Routes           []ProbeRouteInfo `json:"routes"`
 }
 
 // SharedHopInfo represents a hop that appears in multiple agent routes.
@@ -184,7 +200,7 @@ type SharedHopInfo struct {
 // RouteIncident is a lightweight incident specifically for route/path issues.
 type RouteIncident struct {
 	ID         string   `json:"id"`
-	Type       string   `json:"type"` // ip_change, isp_change, route_change
+	Type       string   `json:"type"` // ip_change, isp_change, network_change, route_change
 	Severity   string   `json:"severity"`
 	AgentID    uint     `json:"agent_id"`
 	AgentName  string   `json:"agent_name"`
@@ -331,8 +347,11 @@ func ComputeWorkspaceRouteAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB,
 			agentIPToID[ni.PublicAddress] = agentID
 		}
 	}
+	// 2c. Addresses the agents held earlier in the MTR window, so traces
+	// taken before a public IP change still label the agent hop.
+	mergePublicIPHistory(agentIPToID, publicIPsInWindow(ctx, pg, agentIDs, mtrFrom, time.Now().UTC()))
 
-	// 3. Detect IP/ISP changes
+	// 3. Detect IP/ISP and network changes
 	netInfoChanges, _ := getWorkspaceNetInfoChanges(ctx, ch, agentIDs, netInfoFrom)
 	changeByAgent := make(map[uint][]netInfoChange)
 	for _, c := range netInfoChanges {
@@ -391,6 +410,20 @@ func ComputeWorkspaceRouteAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB,
 						Evidence:   []string{fmt.Sprintf("Previous ISP: %s", c.OldValue), fmt.Sprintf("Current ISP: %s", c.NewValue)},
 						DetectedAt: c.DetectedAt.Format(time.RFC3339),
 					})
+				default:
+					if inc, ok := netInfoChangeIncident(c, a.Name); ok {
+						ari.HasNetworkChange = true
+						routeIncidents = append(routeIncidents, RouteIncident{
+							ID:         inc.ID,
+							Type:       "network_change",
+							Severity:   inc.Severity,
+							AgentID:    a.ID,
+							AgentName:  a.Name,
+							Message:    inc.Title,
+							Evidence:   inc.Evidence,
+							DetectedAt: c.DetectedAt.Format(time.RFC3339),
+						})
+					}
 				}
 			}
 		}
@@ -992,6 +1025,7 @@ func (a *mtrPathAgg) process(pathKey mtrPathKey, rows []ProbeData, routeIncident
 					IP:       hop.Hosts[0].IP,
 					Loss:     parseLossPct(hop.LossPct),
 					Latency:  parseLatency(hop.Avg),
+					Jitter:   parseLatency(hop.Javg),
 					HopIndex: i,
 				})
 			}
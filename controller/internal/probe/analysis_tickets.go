@@ -0,0 +1,107 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"netwatcher-controller/internal/features"
+	"netwatcher-controller/internal/ticketing"
+
+	"gorm.io/gorm"
+)
+
+// ── External Tickets ──
+//
+// Incidents are linked to Jira / ServiceNow tickets by incident ID (see
+// internal/ticketing). The analysis loop syncs tickets after each run and
+// live analysis shows the linked tickets on each incident.
+
+// IncidentTicket is a ticket reference shown on an incident.
+type IncidentTicket struct {
+	Provider       string `json:"provider"`
+	Key            string `json:"key"`
+	URL            string `json:"url"`
+	State          string `json:"state"` // open, resolved
+	ExternalStatus string `json:"external_status,omitempty"`
+	ResolvedBy     string `json:"resolved_by,omitempty"`
+}
+
+// TicketIncident converts an analysis incident for the ticketing package.
+func TicketIncident(inc DetectedIncident) ticketing.Incident {
+	return ticketing.Incident{
+		ID:              inc.ID,
+		Title:           inc.Title,
+		Severity:        inc.Severity,
+		Scope:           inc.Scope,
+		SuggestedCause:  inc.SuggestedCause,
+		AffectedAgents:  inc.AffectedAgents,
+		AffectedTargets: inc.AffectedTargets,
+		Evidence:        inc.Evidence,
+		Recommendations: inc.Recommendations,
+		FirstSeenAt:     inc.FirstSeenAt,
+	}
+}
+
+// SyncIncidentTickets reconciles external tickets with a live analysis.
+// Gated by the ticket_sync feature flag. Partial analyses are skipped so
+// tickets aren't closed for incidents that weren't evaluated.
+func SyncIncidentTickets(ctx context.Context, pg *gorm.DB, analysis *WorkspaceAnalysis) error {
+	if analysis == nil || analysis.Partial || !features.Enabled(ctx, analysis.WorkspaceID, features.TicketSync) {
+		return nil
+	}
+	incidents := make([]ticketing.Incident, len(analysis.Incidents))
+	for i, inc := range analysis.Incidents {
+		incidents[i] = TicketIncident(inc)
+	}
+	return ticketing.SyncWorkspace(ctx, pg, analysis.WorkspaceID, incidents)
+}
+
+// applyIncidentTickets attaches linked tickets to incidents in place.
+func applyIncidentTickets(ctx context.Context, pg *gorm.DB, workspaceID uint, incidents []DetectedIncident) {
+	if len(incidents) == 0 {
+		return
+	}
+	ids := make([]string, len(incidents))
+	for i, inc := range incidents {
+		ids[i] = inc.ID
+	}
+	linked := ticketing.TicketsForIncidents(ctx, pg, workspaceID, ids)
+	for i := range incidents {
+		for _, t := range linked[incidents[i].ID] {
+			incidents[i].Tickets = append(incidents[i].Tickets, IncidentTicket{
+				Provider:       t.Provider,
+				Key:            t.ExternalKey,
+				URL:            t.URL,
+				State:          t.State,
+				ExternalStatus: t.ExternalStatus,
+				ResolvedBy:     t.ResolvedBy,
+			})
+		}
+	}
+}
+
+// FindRecentIncident looks an incident up in the newest analysis snapshot
+// from the last hour, for creating tickets on demand.
+func FindRecentIncident(ctx context.Context, ch *sql.DB, workspaceID uint, incidentID string) (*DetectedIncident, error) {
+	now := time.Now().UTC()
+	snaps, err := GetAnalysisSnapshots(ctx, ch, workspaceID, now.Add(-time.Hour), now, 1)
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+	if len(snaps) == 0 || snaps[0].IncidentsJSON == "" {
+		return nil, ErrNotFound
+	}
+	var incidents []DetectedIncident
+	if err := json.Unmarshal([]byte(snaps[0].IncidentsJSON), &incidents); err != nil {
+		return nil, fmt.Errorf("decode incidents: %w", err)
+	}
+	for i := range incidents {
+		if incidents[i].ID == incidentID {
+			return &incidents[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
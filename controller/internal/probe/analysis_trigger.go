@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/logging"
+	"netwatcher-controller/internal/settings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Event-Driven Analysis ──
+//
+// The loop analyses every workspace each ANALYSIS_INTERVAL, so an outage can
+// wait minutes for its incident. Ingest shortens that by flagging samples
+// that mark an event:
+//
+//   - a loss spike: a PING, TrafficSim or MTR (final hop) result with loss
+//     of at least ANALYSIS_TRIGGER_LOSS_PCT (default 50) when the same
+//     probe's previous result from that agent was below it;
+//   - an agent resuming: its first result after ANALYSIS_TRIGGER_SILENCE_MINUTES
+//     (default 10) without any.
+//
+// A flagged workspace is analysed ANALYSIS_TRIGGER_DELAY_SECONDS (default 5)
+// later, so the burst of results around an event lands in one run, and at
+// most once per ANALYSIS_TRIGGER_COOLDOWN_SECONDS (default 60). Triggered
+// runs are full workspace runs (snapshot, incident history, alerts) and
+// never overlap a scheduled run of the same workspace. Either threshold set
+// to 0 turns that trigger off.
+//
+// Sample history is kept in memory per controller: after a restart, an
+// agent's or probe's first result does not trigger.
+
+// Trigger reasons.
+const (
+	TriggerLossSpike    = "loss_spike"
+	TriggerAgentResumed = "agent_resumed"
+)
+
+type analysisTriggerConfig struct {
+	LossPct  float64
+	Silence  time.Duration
+	Delay    time.Duration
+	Cooldown time.Duration
+}
+
+func loadAnalysisTriggerConfig() analysisTriggerConfig {
+	envInt := func(key string, def int) int {
+		if n, err := strconv.Atoi(settings.Getenv(key)); err == nil && n >= 0 {
+			return n
+		}
+		return def
+	}
+	return analysisTriggerConfig{
+		LossPct:  float64(envInt("ANALYSIS_TRIGGER_LOSS_PCT", 50)),
+		Silence:  time.Duration(envInt("ANALYSIS_TRIGGER_SILENCE_MINUTES", 10)) * time.Minute,
+		Delay:    time.Duration(envInt("ANALYSIS_TRIGGER_DELAY_SECONDS", 5)) * time.Second,
+		Cooldown: time.Duration(envInt("ANALYSIS_TRIGGER_COOLDOWN_SECONDS", 60)) * time.Second,
+	}
+}
+
+// sampleLoss returns a result's packet loss in percent, if it has one.
+func sampleLoss(payload any) (float64, bool) {
+	switch p := payload.(type) {
+	case PingPayload:
+		return p.PacketLoss, true
+	case TrafficSimResult:
+		return p.LossPercentage, true
+	case mtrPayload:
+		if n := len(p.Report.Hops); n > 0 {
+			return parseLossPct(p.Report.Hops[n-1].LossPct), true
+		}
+	}
+	return 0, false
+}
+
+type lossSeries struct {
+	probeID, agentID uint
+	kind             string
+}
+
+// ingestAnomalies remembers recent samples to tell events from steady state.
+type ingestAnomalies struct {
+	mu       sync.Mutex
+	lastSeen map[uint]time.Time  // agent → last result
+	lossy    map[lossSeries]bool // series → previous result was over the threshold
+}
+
+func newIngestAnomalies() *ingestAnomalies {
+	return &ingestAnomalies{lastSeen: make(map[uint]time.Time), lossy: make(map[lossSeries]bool)}
+}
+
+var ingestAnomalyState = newIngestAnomalies()
+
+// observe records a result and returns the trigger reason it warrants, or "".
+func (a *ingestAnomalies) observe(cfg analysisTriggerConfig, data ProbeData, kind string, payload any, now time.Time) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reason := ""
+	prev, seen := a.lastSeen[data.AgentID]
+	a.lastSeen[data.AgentID] = now
+	if seen && cfg.Silence > 0 && now.Sub(prev) >= cfg.Silence {
+		reason = TriggerAgentResumed
+	}
+
+	if loss, ok := sampleLoss(payload); ok && cfg.LossPct > 0 {
+		key := lossSeries{data.ProbeID, data.AgentID, kind}
+		wasLossy, known := a.lossy[key]
+		isLossy := loss >= cfg.LossPct
+		a.lossy[key] = isLossy
+		if isLossy && known && !wasLossy && reason == "" {
+			reason = TriggerLossSpike
+		}
+	}
+	return reason
+}
+
+type analysisTrigger struct {
+	workspaceID uint
+	reason      string
+	agentID     uint
+}
+
+// analysisTriggers feeds the trigger worker. Triggers are dropped rather
+// than block ingest when it is full; the scheduled loop still runs.
+var analysisTriggers = make(chan analysisTrigger, 256)
+
+// noteIngestSample checks a stored result for a trigger and queues its
+// workspace. The workspace lookup only happens for flagged results.
+func noteIngestSample(ctx context.Context, pg *gorm.DB, data ProbeData, kind string, payload any) {
+	reason := ingestAnomalyState.observe(loadAnalysisTriggerConfig(), data, kind, payload, time.Now())
+	if reason == "" {
+		return
+	}
+	var wsID uint
+	if err := pg.WithContext(ctx).Table("agents").Select("workspace_id").
+		Where("id = ?", data.AgentID).Scan(&wsID).Error; err != nil || wsID == 0 {
+		return
+	}
+	select {
+	case analysisTriggers <- analysisTrigger{workspaceID: wsID, reason: reason, agentID: data.AgentID}:
+	default:
+	}
+}
+
+// triggerSchedule debounces triggers into at most one pending run per
+// workspace and enforces the cooldown between triggered runs.
+type triggerSchedule struct {
+	pending map[uint]time.Time // workspace → when to run
+	lastRun map[uint]time.Time
+}
+
+func newTriggerSchedule() *triggerSchedule {
+	return &triggerSchedule{pending: make(map[uint]time.Time), lastRun: make(map[uint]time.Time)}
+}
+
+// add schedules a run for wsID and reports whether it was not already
+// pending.
+func (s *triggerSchedule) add(wsID uint, cfg analysisTriggerConfig, now time.Time) bool {
+	if _, ok := s.pending[wsID]; ok {
+		return false
+	}
+	due := now.Add(cfg.Delay)
+	if last, ok := s.lastRun[wsID]; ok && last.Add(cfg.Cooldown).After(due) {
+		due = last.Add(cfg.Cooldown)
+	}
+	s.pending[wsID] = due
+	return true
+}
+
+// due removes and returns the workspaces whose run time has come.
+func (s *triggerSchedule) due(now time.Time) []uint {
+	var out []uint
+	for ws, at := range s.pending {
+		if !now.Before(at) {
+			out = append(out, ws)
+			delete(s.pending, ws)
+			s.lastRun[ws] = now
+		}
+	}
+	return out
+}
+
+// runAnalysisTriggers analyses flagged workspaces until ctx ends.
+// maxConcurrent bounds triggered runs in flight.
+func runAnalysisTriggers(ctx context.Context, ch *sql.DB, pg *gorm.DB, maxConcurrent int) {
+	sched := newTriggerSchedule()
+	sem := make(chan struct{}, maxConcurrent)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-analysisTriggers:
+			if sched.add(t.workspaceID, loadAnalysisTriggerConfig(), time.Now()) {
+				analysisLog.WithFields(log.Fields{
+					logging.FieldWorkspace: t.workspaceID,
+					logging.FieldAgent:     t.agentID,
+				}).Infof("[analysis_trigger] %s: analysis scheduled", t.reason)
+			}
+		case now := <-tick.C:
+			for _, ws := range sched.due(now) {
+				select {
+				case sem <- struct{}{}:
+				default:
+					// Busy; try again next tick.
+					sched.pending[ws] = now
+					continue
+				}
+				go func(id uint) {
+					defer func() { <-sem }()
+					runSingleWorkspace(ctx, ch, pg, id)
+				}(ws)
+			}
+		}
+	}
+}
+
+// workspaceRuns keeps scheduled and triggered runs of one workspace from
+// overlapping.
+var workspaceRuns = struct {
+	mu    sync.Mutex
+	locks map[uint]*sync.Mutex
+}{locks: make(map[uint]*sync.Mutex)}
+
+func lockWorkspaceRun(wsID uint) func() {
+	workspaceRuns.mu.Lock()
+	l, ok := workspaceRuns.locks[wsID]
+	if !ok {
+		l = &sync.Mutex{}
+		workspaceRuns.locks[wsID] = l
+	}
+	workspaceRuns.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
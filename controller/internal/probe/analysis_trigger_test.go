@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestAnomalies(t *testing.T) {
+	cfg := analysisTriggerConfig{LossPct: 50, Silence: 10 * time.Minute}
+	a := newIngestAnomalies()
+	now := time.Now()
+	ping := func(loss float64) PingPayload { return PingPayload{PacketLoss: loss} }
+	data := ProbeData{ProbeID: 1, AgentID: 7}
+
+	steps := []struct {
+		at      time.Duration
+		payload any
+		want    string
+	}{
+		{0, ping(80), ""},                                // first result: no history
+		{time.Minute, ping(0), ""},                       // recovered
+		{2 * time.Minute, ping(60), TriggerLossSpike},    // spike
+		{3 * time.Minute, ping(90), ""},                  // still lossy
+		{20 * time.Minute, ping(0), TriggerAgentResumed}, // back after silence
+	}
+	for i, s := range steps {
+		if got := a.observe(cfg, data, string(TypePing), s.payload, now.Add(s.at)); got != s.want {
+			t.Errorf("step %d: got %q, want %q", i, got, s.want)
+		}
+	}
+
+	// Thresholds of 0 turn triggers off.
+	off := newIngestAnomalies()
+	off.observe(analysisTriggerConfig{}, data, string(TypePing), ping(0), now)
+	if got := off.observe(analysisTriggerConfig{}, data, string(TypePing), ping(100), now.Add(time.Hour)); got != "" {
+		t.Errorf("disabled triggers fired %q", got)
+	}
+}
+
+func TestTriggerSchedule(t *testing.T) {
+	cfg := analysisTriggerConfig{Delay: 5 * time.Second, Cooldown: time.Minute}
+	s := newTriggerSchedule()
+	now := time.Now()
+
+	if !s.add(3, cfg, now) || s.add(3, cfg, now.Add(time.Second)) {
+		t.Fatal("second trigger while pending should be merged")
+	}
+	if got := s.due(now.Add(4 * time.Second)); len(got) != 0 {
+		t.Errorf("ran before the delay: %v", got)
+	}
+	if got := s.due(now.Add(5 * time.Second)); len(got) != 1 || got[0] != 3 {
+		t.Fatalf("due = %v, want [3]", got)
+	}
+
+	// The next trigger waits out the cooldown.
+	s.add(3, cfg, now.Add(10*time.Second))
+	if got := s.due(now.Add(30 * time.Second)); len(got) != 0 {
+		t.Errorf("ran inside the cooldown: %v", got)
+	}
+	if got := s.due(now.Add(65 * time.Second)); len(got) != 1 {
+		t.Errorf("due after cooldown = %v", got)
+	}
+}
@@ -0,0 +1,297 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/vantage"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── External Vantage Comparison ──
+//
+// When a third-party vantage provider is configured (Globalping, RIPE
+// Atlas), degraded targets are also pinged from public probes. If the
+// outside world sees the target healthy while agents do not, the problem
+// is most likely on the agents' side of the network; if external probes
+// see it degraded too, the target or its upstream is at fault. Analysis
+// only reads cached results and queues refreshes, so the next run picks
+// up measurements started by this one.
+
+// vantageChecker is the optional external vantage checker. Nil by default
+// (disabled). Set via SetVantageChecker during startup.
+var vantageChecker *vantage.Checker
+
+// SetVantageChecker configures the optional third-party vantage checker.
+func SetVantageChecker(c *vantage.Checker) {
+	vantageChecker = c
+	if c != nil {
+		log.Infof("[analysis] external vantage comparison enabled (provider: %s)", c.Name())
+	}
+}
+
+// ErrVantageUnavailable is returned when no vantage provider is configured.
+var ErrVantageUnavailable = errors.New("external vantage checks are not configured")
+
+const (
+	// maxVantageRefreshesPerRun bounds third-party measurements queued by a
+	// single workspace analysis.
+	maxVantageRefreshesPerRun = 3
+	// External loss below this counts as healthy; at or above
+	// vantageDegradedLossPct (or no probe reaching it) counts as degraded.
+	vantageHealthyLossPct  = 2.0
+	vantageDegradedLossPct = 10.0
+
+	VantageTargetHealthy  = "target_healthy"
+	VantageTargetDegraded = "target_degraded"
+	VantageInconclusive   = "inconclusive"
+)
+
+// ExternalVantageView is the external probes' view of an incident target.
+type ExternalVantageView struct {
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	Verdict    string    `json:"verdict"` // target_healthy, target_degraded, inconclusive
+	Probes     int       `json:"probes"`
+	Reachable  int       `json:"reachable"`
+	AvgRTTMs   float64   `json:"avg_rtt_ms"`
+	LossPct    float64   `json:"loss_pct"`
+	Locations  []string  `json:"locations,omitempty"`
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+func externalView(r *vantage.Result) *ExternalVantageView {
+	v := &ExternalVantageView{
+		Source:     r.Source,
+		Target:     r.Target,
+		Probes:     r.Probes,
+		Reachable:  r.Reachable,
+		AvgRTTMs:   sanitizeFloat(r.AvgRTTMs),
+		LossPct:    sanitizeFloat(r.LossPct),
+		Locations:  r.Locations,
+		MeasuredAt: r.MeasuredAt,
+	}
+	switch {
+	case r.Reachable == 0 || r.LossPct >= vantageDegradedLossPct:
+		v.Verdict = VantageTargetDegraded
+	case r.LossPct < vantageHealthyLossPct:
+		v.Verdict = VantageTargetHealthy
+	default:
+		v.Verdict = VantageInconclusive
+	}
+	return v
+}
+
+// externallyCheckable returns the host part of target if third parties
+// can reach it: public IPs and dotted hostnames that are not agent names.
+func externallyCheckable(target string, agentNames map[string]bool) (string, bool) {
+	host := stripPort(strings.TrimSpace(target))
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" || agentNames[host] {
+		return "", false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || !ip.IsGlobalUnicast() {
+			return "", false
+		}
+		return host, true
+	}
+	if !strings.Contains(host, ".") || strings.ContainsAny(host, " /") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") || strings.HasSuffix(host, ".lan") {
+		return "", false
+	}
+	return host, true
+}
+
+// applyExternalVantage annotates warning/critical incidents with cached
+// external results for their first checkable target and queues refreshes
+// for targets without one.
+func applyExternalVantage(c *vantage.Checker, incidents []DetectedIncident, agentByID map[uint]agentInfo) {
+	if c == nil {
+		return
+	}
+	agentNames := make(map[string]bool, len(agentByID))
+	for _, a := range agentByID {
+		agentNames[a.Name] = true
+	}
+	refreshes := 0
+	for i := range incidents {
+		inc := &incidents[i]
+		if inc.Severity != "warning" && inc.Severity != "critical" {
+			continue
+		}
+		for _, t := range inc.AffectedTargets {
+			host, ok := externallyCheckable(t, agentNames)
+			if !ok {
+				continue
+			}
+			if r, ok := c.Cached(host); ok {
+				annotateExternalView(inc, externalView(r))
+			} else if refreshes < maxVantageRefreshesPerRun {
+				c.Refresh(host)
+				refreshes++
+			}
+			break
+		}
+	}
+}
+
+// annotateExternalView attaches the view and states what it implies.
+func annotateExternalView(inc *DetectedIncident, v *ExternalVantageView) {
+	inc.ExternalView = v
+	inc.Evidence = append(inc.Evidence, fmt.Sprintf("External probes (%s, %d/%d reachable): %.1fms avg, %.1f%% loss",
+		v.Source, v.Reachable, v.Probes, v.AvgRTTMs, v.LossPct))
+	switch v.Verdict {
+	case VantageTargetHealthy:
+		inc.SuggestedCause = strings.TrimSpace(inc.SuggestedCause + fmt.Sprintf(
+			" External probes see %s healthy — the issue is likely local to your network.", v.Target))
+		inc.Recommendations = append(inc.Recommendations, "Focus on the local network and ISP path: external vantage points reach the target normally")
+	case VantageTargetDegraded:
+		inc.SuggestedCause = strings.TrimSpace(inc.SuggestedCause + fmt.Sprintf(
+			" External probes also see %s degraded — the issue is likely at the target or its upstream.", v.Target))
+		inc.Recommendations = append(inc.Recommendations, "Contact the target's operator: the degradation is visible from outside your network")
+	}
+}
+
+// ExternalComparison pairs the agents' view of a target with an external
+// vantage measurement.
+type ExternalComparison struct {
+	Target   string               `json:"target"`
+	Agents   []ExternalAgentView  `json:"agents"`
+	External *ExternalVantageView `json:"external"`
+	Pending  bool                 `json:"pending"` // measurement still running
+	Summary  string               `json:"summary"`
+}
+
+// ExternalAgentView is one agent's PING view of the target.
+type ExternalAgentView struct {
+	AgentID    uint    `json:"agent_id"`
+	AgentName  string  `json:"agent_name"`
+	AvgLatency float64 `json:"avg_latency"`
+	PacketLoss float64 `json:"packet_loss"`
+	Samples    int     `json:"samples"`
+}
+
+// CompareExternalVantage compares the workspace agents' PING data for
+// target over the lookback window with a cached external measurement,
+// starting one when none is cached. Only targets one of the workspace's
+// probes already measures are accepted, so the endpoint can't be used to
+// run third-party measurements against arbitrary hosts.
+func CompareExternalVantage(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, target string, lookbackMinutes int) (*ExternalComparison, error) {
+	if vantageChecker == nil {
+		return nil, ErrVantageUnavailable
+	}
+	if lookbackMinutes <= 0 {
+		lookbackMinutes = 60
+	}
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	agentByID := make(map[uint]agentInfo, len(agents))
+	agentNames := make(map[string]bool, len(agents))
+	agentIDs := make([]uint, 0, len(agents))
+	for _, a := range agents {
+		agentByID[a.ID] = a
+		agentNames[a.Name] = true
+		agentIDs = append(agentIDs, a.ID)
+	}
+	host, ok := externallyCheckable(target, agentNames)
+	if !ok {
+		return nil, fmt.Errorf("%w: target must be a public IP or hostname", ErrBadInput)
+	}
+	probed, err := workspaceProbesHost(ctx, pg, workspaceID, host)
+	if err != nil {
+		return nil, fmt.Errorf("get probe targets: %w", err)
+	}
+	if !probed {
+		return nil, fmt.Errorf("%w: target is not measured by any probe in this workspace", ErrBadInput)
+	}
+
+	out := &ExternalComparison{Target: host, Agents: []ExternalAgentView{}}
+	from := time.Now().Add(-time.Duration(lookbackMinutes) * time.Minute)
+	ping, err := getWorkspacePingMetrics(ctx, ch, agentIDs, from)
+	if err != nil {
+		return nil, err
+	}
+	var agentLoss []float64
+	for key, st := range ping {
+		i := strings.IndexByte(key, ':')
+		if i <= 0 || stripPort(key[i+1:]) != host {
+			continue
+		}
+		id := parseUint(key[:i])
+		out.Agents = append(out.Agents, ExternalAgentView{
+			AgentID:    id,
+			AgentName:  agentByID[id].Name,
+			AvgLatency: sanitizeFloat(st.AvgLatency),
+			PacketLoss: sanitizeFloat(st.PacketLoss),
+			Samples:    st.Count,
+		})
+		agentLoss = append(agentLoss, st.PacketLoss)
+	}
+
+	// Measurements can take minutes (RIPE Atlas), longer than a request
+	// may stay open: start one and let the caller poll.
+	r, ok := vantageChecker.Cached(host)
+	if !ok {
+		vantageChecker.Refresh(host)
+		out.Pending = true
+		out.Summary = fmt.Sprintf("External measurement of %s started via %s; retry shortly.", host, vantageChecker.Name())
+		return out, nil
+	}
+	out.External = externalView(r)
+	out.Summary = externalComparisonSummary(out.External, agentLoss)
+	return out, nil
+}
+
+// workspaceProbesHost reports whether a live probe in the workspace
+// targets host, ignoring ports and URL schemes.
+func workspaceProbesHost(ctx context.Context, pg *gorm.DB, workspaceID uint, host string) (bool, error) {
+	var targets []string
+	err := pg.WithContext(ctx).Table("probe_targets t").
+		Joins("JOIN probes p ON p.id = t.probe_id").
+		Where("p.workspace_id = ? AND p.deleted_at IS NULL AND t.deleted_at IS NULL AND t.target <> ''", workspaceID).
+		Distinct().Pluck("t.target", &targets).Error
+	if err != nil {
+		return false, err
+	}
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if u, err := url.Parse(t); err == nil && u.Scheme != "" && u.Host != "" {
+			t = u.Host
+		}
+		h := strings.TrimSuffix(strings.TrimPrefix(stripPort(t), "["), "]")
+		if strings.EqualFold(h, host) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func externalComparisonSummary(v *ExternalVantageView, agentLoss []float64) string {
+	if len(agentLoss) == 0 {
+		return fmt.Sprintf("No agent PING data for %s in the window; external probes report %s.", v.Target, strings.ReplaceAll(v.Verdict, "_", " "))
+	}
+	agentsDegraded := avg(agentLoss) >= vantageHealthyLossPct
+	switch {
+	case agentsDegraded && v.Verdict == VantageTargetHealthy:
+		return fmt.Sprintf("External probes see %s healthy — the issue is likely local to your network.", v.Target)
+	case agentsDegraded && v.Verdict == VantageTargetDegraded:
+		return fmt.Sprintf("External probes also see %s degraded — the issue is likely at the target or its upstream.", v.Target)
+	case !agentsDegraded && v.Verdict == VantageTargetDegraded:
+		return fmt.Sprintf("Your agents reach %s normally while external probes see it degraded.", v.Target)
+	case !agentsDegraded:
+		return fmt.Sprintf("Agents and external probes both see %s healthy.", v.Target)
+	default:
+		return "External results are inconclusive."
+	}
+}
@@ -0,0 +1,134 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/vantage"
+)
+
+type fakeVantageProvider struct{ loss float64 }
+
+func (f fakeVantageProvider) Measure(_ context.Context, target string) (*vantage.Result, error) {
+	return &vantage.Result{Source: "fake", Target: target, Probes: 3, Reachable: 3, AvgRTTMs: 20, LossPct: f.loss}, nil
+}
+func (fakeVantageProvider) Available() bool { return true }
+func (fakeVantageProvider) Name() string    { return "fake" }
+
+// TestExternallyCheckable verifies private addresses, agent names and
+// internal hostnames are never sent to third parties.
+func TestExternallyCheckable(t *testing.T) {
+	agents := map[string]bool{"branch.office": true}
+	for target, want := range map[string]string{
+		"8.8.8.8":           "8.8.8.8",
+		"example.com:443":   "example.com",
+		"10.0.0.5":          "",
+		"192.168.1.1":       "",
+		"branch.office":     "",
+		"printer.local":     "",
+		"fileserver":        "",
+		"[2001:4860::8888]": "2001:4860::8888",
+	} {
+		got, ok := externallyCheckable(target, agents)
+		if got != want || ok != (want != "") {
+			t.Errorf("externallyCheckable(%q) = %q, %v; want %q", target, got, ok, want)
+		}
+	}
+}
+
+// TestApplyExternalVantage verifies a cached healthy external result marks
+// a degraded target incident as likely local, and a cache miss only
+// queues a measurement.
+func TestApplyExternalVantage(t *testing.T) {
+	c := vantage.NewChecker(fakeVantageProvider{loss: 0}, vantage.Config{CacheTTL: time.Minute})
+	incidents := []DetectedIncident{{
+		ID:              "loss_example",
+		Severity:        "critical",
+		SuggestedCause:  "Packet loss to example.com.",
+		AffectedTargets: []string{"example.com"},
+	}}
+
+	applyExternalVantage(c, incidents, nil)
+	if incidents[0].ExternalView != nil {
+		t.Fatal("cache miss should not annotate")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := c.Cached("example.com"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh never populated the cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	applyExternalVantage(c, incidents, nil)
+	v := incidents[0].ExternalView
+	if v == nil || v.Verdict != VantageTargetHealthy {
+		t.Fatalf("external view = %+v", v)
+	}
+	if !strings.Contains(incidents[0].SuggestedCause, "likely local to your network") {
+		t.Errorf("cause = %q", incidents[0].SuggestedCause)
+	}
+}
+
+// TestExternalViewVerdict verifies loss thresholds and unreachable targets.
+func TestExternalViewVerdict(t *testing.T) {
+	cases := []struct {
+		r    vantage.Result
+		want string
+	}{
+		{vantage.Result{Probes: 3, Reachable: 3, LossPct: 0}, VantageTargetHealthy},
+		{vantage.Result{Probes: 3, Reachable: 3, LossPct: 5}, VantageInconclusive},
+		{vantage.Result{Probes: 3, Reachable: 2, LossPct: 33}, VantageTargetDegraded},
+		{vantage.Result{Probes: 3, Reachable: 0, LossPct: 100}, VantageTargetDegraded},
+	}
+	for _, c := range cases {
+		if got := externalView(&c.r).Verdict; got != c.want {
+			t.Errorf("%+v: verdict %s, want %s", c.r, got, c.want)
+		}
+	}
+}
+
+// TestCompareExternalVantageRequiresProbedTarget verifies only hosts one of
+// the workspace's own probes measures can be sent to the external provider.
+func TestCompareExternalVantageRequiresProbedTarget(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	for _, p := range []Probe{
+		{WorkspaceID: 1, AgentID: 1, Type: TypePing, Targets: []Target{{Target: "example.com"}}},
+		{WorkspaceID: 1, AgentID: 1, Type: TypeHTTP, Targets: []Target{{Target: "https://api.example.org:8443/health"}}},
+		{WorkspaceID: 2, AgentID: 2, Type: TypePing, Targets: []Target{{Target: "other.example.net"}}},
+	} {
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create probe: %v", err)
+		}
+	}
+
+	for host, want := range map[string]bool{
+		"example.com":       true,
+		"EXAMPLE.com":       true,
+		"api.example.org":   true,
+		"other.example.net": false,
+		"1.1.1.1":           false,
+	} {
+		got, err := workspaceProbesHost(ctx, db, 1, host)
+		if err != nil {
+			t.Fatalf("%s: %v", host, err)
+		}
+		if got != want {
+			t.Errorf("workspaceProbesHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	prev := vantageChecker
+	SetVantageChecker(vantage.NewChecker(fakeVantageProvider{}, vantage.Config{CacheTTL: time.Minute}))
+	t.Cleanup(func() { vantageChecker = prev })
+	if _, err := CompareExternalVantage(ctx, nil, db, 1, "other.example.net", 60); !errors.Is(err, ErrBadInput) {
+		t.Errorf("other workspace's target err = %v, want ErrBadInput", err)
+	}
+}
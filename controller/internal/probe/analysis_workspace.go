@@ -8,6 +8,10 @@ import (
 	"strings"
 	"time"
 
+	"netwatcher-controller/internal/features"
+	"netwatcher-controller/internal/logging"
+	"netwatcher-controller/internal/region"
+
 	"gorm.io/gorm"
 )
 
@@ -16,7 +20,9 @@ func ComputeWorkspaceAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, work
 	if lookbackMinutes <= 0 {
 		lookbackMinutes = 60
 	}
-	from := time.Now().UTC().Add(-time.Duration(lookbackMinutes) * time.Minute)
+	// now is the wall clock, or the as-of time when reprocessing history.
+	now, reprocessing := analysisNow(ctx)
+	from := now.Add(-time.Duration(lookbackMinutes) * time.Minute)
 
 	// Get agents
 	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
@@ -29,7 +35,8 @@ func ComputeWorkspaceAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, work
 			WorkspaceID:   workspaceID,
 			OverallHealth: HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0},
 			Agents:        []AgentHealthSummary{},
-			GeneratedAt:   time.Now().UTC(),
+			GeneratedAt:   now,
+			Region:        region.Local(),
 		}, nil
 	}
 
@@ -40,242 +47,42 @@ func ComputeWorkspaceAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, work
 		agentByID[a.ID] = a
 	}
 
-	// Fetch metrics for all agents
-	pingMetrics, _ := getWorkspacePingMetrics(ctx, ch, agentIDs, from)
-	mtrMetrics, _ := getWorkspaceMTRMetrics(ctx, ch, pg, agentIDs, from)
-	trafficMetrics, _ := getWorkspaceTrafficSimMetrics(ctx, ch, agentIDs, from)
-	sysInfoMetrics, _ := getWorkspaceSysInfoMetrics(ctx, ch, agentIDs, from)
-	netInfoChanges, _ := getWorkspaceNetInfoChanges(ctx, ch, agentIDs, from)
-
-	// Fetch baseline metrics (7-day rolling average) for change detection
-	baselineFrom := time.Now().UTC().Add(-7 * 24 * time.Hour)
-	baselinePing, _ := getWorkspacePingMetrics(ctx, ch, agentIDs, baselineFrom)
-	baselineTraffic, _ := getWorkspaceTrafficSimMetrics(ctx, ch, agentIDs, baselineFrom)
+	// Fetch metrics for all agents, plus the baseline (7-day rolling
+	// average) for change detection, concurrently and within the budget.
+	budgetCtx, cancel := context.WithTimeout(ctx, analysisTimeBudget())
+	defer cancel()
+	var partial partialReasons
+	baselineFrom := now.Add(-7 * 24 * time.Hour)
+	metrics := fetchWorkspaceMetrics(budgetCtx, ch, pg, agentIDs, from, baselineFrom, now, &partial)
+	pingMetrics, mtrMetrics, trafficMetrics := metrics.ping, metrics.mtr, metrics.traffic
+	sysInfoMetrics, netInfoChanges := metrics.sysInfo, metrics.netInfoChanges
+	baselinePing, baselineTraffic := metrics.baselinePing, metrics.baselineTraffic
+
+	// ── Target Maintenance ──
+	// Targets flagged as expected down keep recording data but are left
+	// out of scoring and incident detection.
+	maintenance := activeMaintenanceTargets(ctx, pg, workspaceID, now)
+	dropMaintenanceKeys(pingMetrics, maintenance)
+	dropMaintenanceKeys(mtrMetrics, maintenance)
+	dropMaintenanceKeys(trafficMetrics, maintenance)
+	dropMaintenanceKeys(baselinePing, maintenance)
+	dropMaintenanceKeys(baselineTraffic, maintenance)
 
 	// Build per-agent summaries
-	var agentSummaries []AgentHealthSummary
+	agentSummaries, scored := summarizeAgents(budgetCtx, agents, &metrics, agentByID, now, reprocessing)
 	var allHealthScores []float64
 	totalProbes := 0
-
-	for _, agent := range agents {
-		isOnline := time.Since(agent.UpdatedAt) < time.Minute
-
-		// Collect metrics for probes FROM this agent
-		var agentLatencies []float64
-		var agentLoss []float64
-		var agentJitterAvg []float64
-		var probeEntries []ProbeHealthEntry
-
-		prefix := fmt.Sprintf("%d:", agent.ID)
-
-		// PING metrics
-		for key, stats := range pingMetrics {
-			if !strings.HasPrefix(key, prefix) {
-				continue
-			}
-			target := key[len(prefix):]
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgLatency,
-				PacketLoss:  stats.PacketLoss,
-				SampleCount: stats.Count,
-			}
-			h := computeHealthVector(m, 100)
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    stripPort(target),
-				ProbeType: "PING",
-				Health:    h,
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgLatency)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-		}
-
-		// MTR metrics
-		for key, stats := range mtrMetrics {
-			if !strings.HasPrefix(key, prefix) {
-				continue
-			}
-			target := key[len(prefix):]
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgLatency,
-				PacketLoss:  stats.PacketLoss,
-				JitterAvg:   stats.Jitter,
-				SampleCount: stats.Count,
-			}
-			h := computeHealthVector(m, 100)
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    stripPort(target),
-				ProbeType: "MTR",
-				Health:    h,
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgLatency)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-			agentJitterAvg = append(agentJitterAvg, stats.Jitter)
-		}
-
-		// TrafficSim metrics
-		for key, stats := range trafficMetrics {
-			if !strings.HasPrefix(key, prefix) {
-				continue
-			}
-			target := key[len(prefix):]
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgRTT,
-				PacketLoss:  stats.PacketLoss,
-				SampleCount: stats.Count,
-			}
-			h := computeHealthVector(m, 100)
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    stripPort(target),
-				ProbeType: "TRAFFICSIM",
-				Health:    h,
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgRTT)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-		}
-
-		// Inbound paths: probes owned by OTHER agents that target this
-		// agent. The path toward an agent is as much a part of its
-		// health as the paths it originates — without these entries a
-		// target-only agent (e.g. a fax server that never runs probes)
-		// always graded "unknown" no matter how degraded the routes to
-		// it were.
-		inboundSrc := func(key string) string {
-			// Metric keys are "<srcAgentID>:<target>".
-			if i := strings.IndexByte(key, ':'); i > 0 {
-				var srcID uint64
-				fmt.Sscanf(key[:i], "%d", &srcID)
-				if a, ok := agentByID[uint(srcID)]; ok {
-					return a.Name
-				}
-			}
-			return "remote agent"
-		}
-		for key, stats := range pingMetrics {
-			if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
-				continue
-			}
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgLatency,
-				PacketLoss:  stats.PacketLoss,
-				SampleCount: stats.Count,
-			}
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    "from " + inboundSrc(key),
-				ProbeType: "PING (inbound)",
-				Health:    computeHealthVector(m, 100),
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgLatency)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-		}
-		for key, stats := range mtrMetrics {
-			if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
-				continue
-			}
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgLatency,
-				PacketLoss:  stats.PacketLoss,
-				JitterAvg:   stats.Jitter,
-				SampleCount: stats.Count,
-			}
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    "from " + inboundSrc(key),
-				ProbeType: "MTR (inbound)",
-				Health:    computeHealthVector(m, 100),
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgLatency)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-			agentJitterAvg = append(agentJitterAvg, stats.Jitter)
-		}
-		for key, stats := range trafficMetrics {
-			if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
-				continue
-			}
-			m := ProbeMetrics{
-				AvgLatency:  stats.AvgRTT,
-				PacketLoss:  stats.PacketLoss,
-				SampleCount: stats.Count,
-			}
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    "from " + inboundSrc(key),
-				ProbeType: "TRAFFICSIM (inbound)",
-				Health:    computeHealthVector(m, 100),
-				Metrics:   m,
-			})
-			agentLatencies = append(agentLatencies, stats.AvgRTT)
-			agentLoss = append(agentLoss, stats.PacketLoss)
-		}
-
-		// SysInfo metrics (host health)
-		if si, ok := sysInfoMetrics[fmt.Sprintf("%d", agent.ID)]; ok {
-			sysScore := sysInfoHealthScore(si)
-			probeEntries = append(probeEntries, ProbeHealthEntry{
-				Target:    "host-resources",
-				ProbeType: "SYSINFO",
-				Health: HealthVector{
-					OverallHealth:  clampScore(sysScore),
-					Grade:          gradeFromScore(sysScore),
-					RouteStability: 100,
-					MosScore:       1.0,
-				},
-				Metrics: ProbeMetrics{SampleCount: 1},
-			})
-		}
-
-		totalProbes += len(probeEntries)
-
-		// Compute agent-level health
-		var agentHealth HealthVector
-		var dataGap bool
-		if len(probeEntries) > 0 {
-			avgLat := avg(agentLatencies)
-			avgLossVal := avg(agentLoss)
-			avgJitterAvgVal := avg(agentJitterAvg)
-
-			agentMetrics := ProbeMetrics{
-				AvgLatency: avgLat,
-				PacketLoss: avgLossVal,
-				JitterAvg:  avgJitterAvgVal,
-			}
-			agentHealth = computeHealthVector(agentMetrics, 100)
-		} else {
-			dataGap = true
-			agentHealth = HealthVector{
-				Grade:          "unknown",
-				RouteStability: 100,
-				MosScore:       1.0,
-			}
-		}
-
-		if !isOnline {
-			agentHealth.OverallHealth = 0
-			agentHealth.Grade = gradeFromScore(0)
-		} else if isOnline && dataGap {
-			agentHealth.OverallHealth = math.Max(0, agentHealth.OverallHealth-10)
-			agentHealth.Grade = gradeFromScore(agentHealth.OverallHealth)
-		}
-
-		allHealthScores = append(allHealthScores, agentHealth.OverallHealth)
-
-		// Sort worst probes (by lowest overall health)
-		sortProbesByHealth(probeEntries)
-		worstCount := 3
-		if len(probeEntries) < worstCount {
-			worstCount = len(probeEntries)
+	skipped := 0
+	for i, a := range agentSummaries {
+		if !scored[i] {
+			skipped++
+			continue
 		}
-
-		agentSummaries = append(agentSummaries, AgentHealthSummary{
-			AgentID:     agent.ID,
-			AgentName:   agent.Name,
-			IsOnline:    isOnline,
-			Health:      agentHealth,
-			ProbeCount:  len(probeEntries),
-			WorstProbes: probeEntries[:worstCount],
-		})
+		allHealthScores = append(allHealthScores, a.Health.OverallHealth)
+		totalProbes += a.ProbeCount
+	}
+	if skipped > 0 {
+		partial.add("time budget exceeded: %d of %d agents not scored", skipped, len(agents))
 	}
 
 	// Compute overall workspace health
@@ -295,33 +102,122 @@ func ComputeWorkspaceAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, work
 		overallHealth = HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0}
 	}
 
+	// ── ClickHouse-backed Detectors ──
+	// Independent queries run concurrently within the time budget; their
+	// results are combined below in a fixed order.
+	var (
+		netInfoByAgent                                  map[uint]*netInfoPayload
+		publicIPs                                       map[string]uint
+		speedtestIncidents, dnsIncidents, portIncidents []DetectedIncident
+		dscpIncidents, pmtuIncidents, owdIncidents      []DetectedIncident
+		certFindings, bandwidthFindings                 []AnalysisFinding
+		freshness                                       *DataFreshness
+	)
+	runParallel(
+		func() { netInfoByAgent = getLatestNetInfoForAgents(budgetCtx, ch, agentIDs, from) },
+		func() { publicIPs = publicIPsInWindow(ctx, pg, agentIDs, from, now) },
+		func() {
+			speedtestIncidents = detectSpeedtestIncidents(budgetCtx, ch, agentIDs, from, baselineFrom, agentByID)
+		},
+		func() { dnsIncidents = detectDNSIncidents(budgetCtx, ch, agentIDs, from, agentByID) },
+		func() { portIncidents = detectPortThrottlingIncidents(budgetCtx, ch, agentIDs, from, agentByID) },
+		func() { dscpIncidents = detectDSCPIncidents(budgetCtx, ch, agentIDs, from, agentByID) },
+		func() { pmtuIncidents = detectPMTUIncidents(budgetCtx, ch, agentIDs, from, agentByID) },
+		func() { owdIncidents = detectAsymmetricCongestionIncidents(budgetCtx, ch, agentIDs, from, agentByID) },
+		func() { certFindings = detectCertExpiryFindings(budgetCtx, ch, agentIDs, 0, from, now, agentByID) },
+		// Speedtests run a few times a day, so this looks at the baseline week.
+		func() { bandwidthFindings = detectProvisionedBandwidthFindings(budgetCtx, ch, agents, baselineFrom) },
+		func() {
+			// Only meaningful live; reprocessed snapshots skip it.
+			if !reprocessing {
+				freshness = computeDataFreshness(budgetCtx, ch, agents)
+			}
+		},
+	)
+	if budgetCtx.Err() != nil {
+		partial.add("time budget exceeded: some incident detectors returned no results")
+	}
+
 	// ── Cross-Agent Correlation & Incident Detection ──
-	// Pull latest NETINFO for each agent so IP→agent resolution in
-	// "Shared degradation" titles can map the agent's real public IP back
+	// The latest NETINFO for each agent lets IP→agent resolution in
+	// "Shared degradation" titles map the agent's real public IP back
 	// to its name when PublicIPOverride is unset.
-	netInfoByAgent := getLatestNetInfoForAgents(ctx, ch, agentIDs, from)
 	agentIPToID := buildAgentIPToIDMap(agentSummaries, agentByID, netInfoByAgent)
+	mergePublicIPHistory(agentIPToID, publicIPs)
 	incidents := detectIncidents(agentSummaries, pingMetrics, mtrMetrics, trafficMetrics, agentByID, lookbackMinutes, agentIPToID)
 
 	// ── Temporal Change Detection ──
 	changeIncidents := detectTemporalChanges(pingMetrics, baselinePing, trafficMetrics, baselineTraffic, netInfoChanges, sysInfoMetrics, agentByID)
 	incidents = append(incidents, changeIncidents...)
 
-	// ── Speedtest Bandwidth Regression Detection ──
-	speedtestIncidents := detectSpeedtestIncidents(ctx, ch, agentIDs, from, baselineFrom, agentByID)
+	// ── Speedtest Bandwidth Regression, DNS Patterns, TrafficSim Port
+	// Throttling, DSCP Class Comparison, Path MTU, One-Way Delay ──
 	incidents = append(incidents, speedtestIncidents...)
-
-	// ── DNS Pattern Detection ──
-	dnsIncidents := detectDNSIncidents(ctx, ch, agentIDs, from, agentByID)
 	incidents = append(incidents, dnsIncidents...)
+	incidents = append(incidents, portIncidents...)
+	incidents = append(incidents, dscpIncidents...)
+	incidents = append(incidents, pmtuIncidents...)
+	incidents = append(incidents, owdIncidents...)
+
+	// ── Custom Analyzers ──
+	customIncidents, customFindings := applyWorkspaceAnalyzers(ctx, WorkspaceAnalyzerInput{
+		WorkspaceID: workspaceID, LookbackMinutes: lookbackMinutes, Now: now, Reprocessing: reprocessing,
+		Agents: agentSummaries, Incidents: incidents, CH: ch, PG: pg,
+	})
+	incidents = append(incidents, customIncidents...)
+
+	incidents = filterMaintenanceIncidents(incidents, maintenance)
+
+	// ── External Vantage Comparison ──
+	// Live only: historical points cannot be measured from outside.
+	if !reprocessing && features.Enabled(ctx, workspaceID, features.ExternalVantage) {
+		applyExternalVantage(vantageChecker, incidents, agentByID)
+	}
+
+	// ── Probe Metadata ──
+	applyProbeMetadataToIncidents(loadProbeMetadataIndex(ctx, pg, workspaceID), incidents)
+
+	// ── Impact Scoring ──
+	applyIncidentImpact(ctx, ch, pg, workspaceID, incidents, len(agents), now)
+
+	// ── Workspace Runbooks ──
+	applyRunbooksToIncidents(loadRunbooks(ctx, pg, workspaceID), incidents)
+
+	// ── External Tickets ──
+	if !reprocessing {
+		applyIncidentTickets(ctx, pg, workspaceID, incidents)
+	}
+
+	// ── Ingest Throttling ──
+	// Live limiter state only; it can't be reconstructed for past points.
+	var findings []AnalysisFinding
+	if !reprocessing {
+		findings = workspaceIngestFindings(agentByID, now)
+	}
+
+	// ── Certificate Expiry, Provisioned Bandwidth ──
+	findings = append(findings, certFindings...)
+	findings = append(findings, bandwidthFindings...)
+	findings = append(findings, customFindings...)
 
 	// Build status summary
 	status := buildStatusSummary(overallHealth, agentSummaries, incidents)
 
+	reasons := partial.list()
+	if len(reasons) > 0 {
+		analysisLog.WithField(logging.FieldWorkspace, workspaceID).Warnf("[analysis] partial result: %s", strings.Join(reasons, "; "))
+	}
+
 	// ── Optional LLM Enrichment ──
 	// Trigger on incidents OR healthy state (periodic "all clear" summaries)
-	if llmProvider != nil && llmProvider.Available() && (len(incidents) > 0 || status.Status == "healthy") {
-		enriched := enrichWithLLM(ctx, status, incidents, agentSummaries, overallHealth, totalProbes)
+	// The summary is produced by the LLM queue; until it is, the
+	// rule-based message stands and enrichmentStatus says so.
+	var llmUsage *LLMUsage
+	var enrichmentStatus string
+	if !reprocessing && llmManager != nil && llmManager.Available() && (len(incidents) > 0 || status.Status == "healthy") &&
+		features.Enabled(ctx, workspaceID, features.LLMEnrichment) {
+		var enriched string
+		enriched, llmUsage, enrichmentStatus = enrichWithLLM(ctx, workspaceID, status, incidents, agentSummaries, overallHealth, totalProbes)
 		if enriched != "" {
 			status.Message = enriched
 		}
@@ -335,10 +231,299 @@ func ComputeWorkspaceAnalysis(ctx context.Context, ch *sql.DB, pg *gorm.DB, work
 		Agents:        agentSummaries,
 		TotalProbes:   totalProbes,
 		TotalAgents:   len(agents),
-		GeneratedAt:   time.Now().UTC(),
+		Freshness:     freshness,
+		GeneratedAt:   now,
+
+		MaintenanceTargets: maintenance.sorted(),
+		Findings:           findings,
+		LLM:                llmUsage,
+		EnrichmentStatus:   enrichmentStatus,
+		Partial:            len(reasons) > 0,
+		PartialReasons:     reasons,
+		Region:             region.Local(),
 	}, nil
 }
 
+// summarizeAgent scores one agent from the probes it runs, the probes
+// targeting it and its host resources.
+func summarizeAgent(agent agentInfo, m *workspaceMetrics, agentByID map[uint]agentInfo, now time.Time, reprocessing bool) AgentHealthSummary {
+	connectivity := agent.connectivity(now)
+	isOnline := connectivity != ConnectivityOffline
+
+	// Collect metrics for probes FROM this agent
+	var agentLatencies []float64
+	var agentLoss []float64
+	var agentJitterAvg []float64
+	var probeEntries []ProbeHealthEntry
+
+	prefix := fmt.Sprintf("%d:", agent.ID)
+
+	// PING metrics
+	for key, stats := range m.ping {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		target := key[len(prefix):]
+		m := ProbeMetrics{
+			AvgLatency:    stats.AvgLatency,
+			MedianLatency: stats.Latency.P50,
+			P95Latency:    stats.Latency.P95,
+			P99Latency:    stats.Latency.P99,
+			MaxLatency:    stats.Latency.Max,
+			PacketLoss:    stats.PacketLoss,
+			SampleCount:   stats.Count,
+		}
+		h := computeHealthVector(m, 100)
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    stripPort(target),
+			ProbeType: "PING",
+			Health:    h,
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgLatency)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+	}
+
+	// MTR metrics
+	for key, stats := range m.mtr {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		target := key[len(prefix):]
+		m := ProbeMetrics{
+			AvgLatency:  stats.AvgLatency,
+			PacketLoss:  stats.PacketLoss,
+			JitterAvg:   stats.Jitter,
+			SampleCount: stats.Count,
+		}
+		h := computeHealthVector(m, 100)
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    stripPort(target),
+			ProbeType: "MTR",
+			Health:    h,
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgLatency)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+		agentJitterAvg = append(agentJitterAvg, stats.Jitter)
+	}
+
+	// TrafficSim metrics
+	for key, stats := range m.traffic {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		target := key[len(prefix):]
+		m := ProbeMetrics{
+			AvgLatency:    stats.AvgRTT,
+			MedianLatency: stats.Latency.P50,
+			P95Latency:    stats.Latency.P95,
+			P99Latency:    stats.Latency.P99,
+			MaxLatency:    stats.Latency.Max,
+			PacketLoss:    stats.PacketLoss,
+			SampleCount:   stats.Count,
+		}
+		h := computeHealthVector(m, 100)
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    stripPort(target),
+			ProbeType: "TRAFFICSIM",
+			Health:    h,
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgRTT)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+	}
+
+	// Inbound paths: probes owned by OTHER agents that target this
+	// agent. The path toward an agent is as much a part of its
+	// health as the paths it originates — without these entries a
+	// target-only agent (e.g. a fax server that never runs probes)
+	// always graded "unknown" no matter how degraded the routes to
+	// it were.
+	inboundSrc := func(key string) string {
+		// Metric keys are "<srcAgentID>:<target>".
+		if i := strings.IndexByte(key, ':'); i > 0 {
+			var srcID uint64
+			fmt.Sscanf(key[:i], "%d", &srcID)
+			if a, ok := agentByID[uint(srcID)]; ok {
+				return a.Name
+			}
+		}
+		return "remote agent"
+	}
+	for key, stats := range m.ping {
+		if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
+			continue
+		}
+		m := ProbeMetrics{
+			AvgLatency:    stats.AvgLatency,
+			MedianLatency: stats.Latency.P50,
+			P95Latency:    stats.Latency.P95,
+			P99Latency:    stats.Latency.P99,
+			MaxLatency:    stats.Latency.Max,
+			PacketLoss:    stats.PacketLoss,
+			SampleCount:   stats.Count,
+		}
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    "from " + inboundSrc(key),
+			ProbeType: "PING (inbound)",
+			Health:    computeHealthVector(m, 100),
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgLatency)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+	}
+	for key, stats := range m.mtr {
+		if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
+			continue
+		}
+		m := ProbeMetrics{
+			AvgLatency:  stats.AvgLatency,
+			PacketLoss:  stats.PacketLoss,
+			JitterAvg:   stats.Jitter,
+			SampleCount: stats.Count,
+		}
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    "from " + inboundSrc(key),
+			ProbeType: "MTR (inbound)",
+			Health:    computeHealthVector(m, 100),
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgLatency)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+		agentJitterAvg = append(agentJitterAvg, stats.Jitter)
+	}
+	for key, stats := range m.traffic {
+		if strings.HasPrefix(key, prefix) || stats.TargetAgent != agent.ID {
+			continue
+		}
+		m := ProbeMetrics{
+			AvgLatency:    stats.AvgRTT,
+			MedianLatency: stats.Latency.P50,
+			P95Latency:    stats.Latency.P95,
+			P99Latency:    stats.Latency.P99,
+			MaxLatency:    stats.Latency.Max,
+			PacketLoss:    stats.PacketLoss,
+			SampleCount:   stats.Count,
+		}
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    "from " + inboundSrc(key),
+			ProbeType: "TRAFFICSIM (inbound)",
+			Health:    computeHealthVector(m, 100),
+			Metrics:   m,
+		})
+		agentLatencies = append(agentLatencies, stats.AvgRTT)
+		agentLoss = append(agentLoss, stats.PacketLoss)
+	}
+
+	// No active probes in either direction: score the host itself. An
+	// agent with probes configured stays active even when they sent
+	// nothing; without the configuration, the data decides.
+	mode := AgentModeActive
+	var passive *PassiveHostHealth
+	si, hasSysInfo := m.sysInfo[fmt.Sprintf("%d", agent.ID)]
+	configured := m.activeAgents[agent.ID]
+	if m.activeAgents == nil {
+		configured = len(probeEntries) > 0
+	}
+	if !configured && len(probeEntries) == 0 {
+		mode = AgentModePassive
+		var sip *sysInfoStats
+		if hasSysInfo {
+			sip = &si
+		}
+		passive = computePassiveHealth(sip, m.hostActivity[agent.ID], passiveWindowStart(m.from, agent.CreatedAt), now)
+	}
+
+	// SysInfo metrics (host health)
+	if hasSysInfo {
+		sysScore := sysInfoHealthScore(si)
+		if passive != nil && passive.HostScore != nil {
+			sysScore = *passive.HostScore
+		}
+		probeEntries = append(probeEntries, ProbeHealthEntry{
+			Target:    "host-resources",
+			ProbeType: "SYSINFO",
+			Health: HealthVector{
+				OverallHealth:  clampScore(sysScore),
+				Grade:          gradeFromScore(sysScore),
+				RouteStability: 100,
+				MosScore:       1.0,
+			},
+			Metrics: ProbeMetrics{SampleCount: 1},
+		})
+	}
+
+	// Connection state is not recorded historically; when reprocessing,
+	// an agent that reported data in the window counts as online.
+	if reprocessing {
+		isOnline = len(probeEntries) > 0 || passive != nil
+		connectivity = ConnectivityOffline
+		if isOnline {
+			connectivity = ConnectivityOnline
+		}
+	}
+
+	// Compute agent-level health
+	var agentHealth HealthVector
+	var dataGap bool
+	if passive != nil {
+		agentHealth = passiveHealthVector(passive)
+	} else if len(agentLatencies) > 0 {
+		avgLat := avg(agentLatencies)
+		avgLossVal := avg(agentLoss)
+		avgJitterAvgVal := avg(agentJitterAvg)
+
+		agentMetrics := ProbeMetrics{
+			AvgLatency: avgLat,
+			PacketLoss: avgLossVal,
+			JitterAvg:  avgJitterAvgVal,
+		}
+		agentHealth = computeHealthVector(agentMetrics, 100)
+	} else {
+		dataGap = true
+		agentHealth = HealthVector{
+			Grade:          "unknown",
+			RouteStability: 100,
+			MosScore:       1.0,
+		}
+	}
+
+	if !isOnline {
+		agentHealth.OverallHealth = 0
+		agentHealth.Grade = gradeFromScore(0)
+	} else if isOnline && dataGap {
+		agentHealth.OverallHealth = math.Max(0, agentHealth.OverallHealth-10)
+		agentHealth.Grade = gradeFromScore(agentHealth.OverallHealth)
+	}
+	if connectivity == ConnectivityDegraded && !dataGap {
+		agentHealth.OverallHealth = math.Max(0, agentHealth.OverallHealth-degradedConnectivityPenalty)
+		agentHealth.Grade = gradeFromScore(agentHealth.OverallHealth)
+	}
+
+	// Sort worst probes (by lowest overall health)
+	sortProbesByHealth(probeEntries)
+	worstCount := 3
+	if len(probeEntries) < worstCount {
+		worstCount = len(probeEntries)
+	}
+
+	return AgentHealthSummary{
+		AgentID:     agent.ID,
+		AgentName:   agent.Name,
+		IsOnline:    isOnline,
+		Health:      agentHealth,
+		ProbeCount:  len(probeEntries),
+		WorstProbes: probeEntries[:worstCount],
+		Mode:        mode,
+		Passive:     passive,
+
+		Connectivity:            connectivity,
+		SecondsSinceSeen:        secondsSinceSeen(agent, now, reprocessing),
+		OfflineThresholdSeconds: int(agent.connectivityThresholds().Offline / time.Second),
+	}
+}
+
 // ── Helpers ──
 
 func buildFindings(health HealthVector, metrics ProbeMetrics, path *MtrPathAnalysis, signals []AnalysisSignal) []AnalysisFinding {
@@ -462,7 +647,7 @@ func sortProbesByHealth(entries []ProbeHealthEntry) {
 func extractField(summaries []AgentHealthSummary, field string) []float64 {
 	var out []float64
 	for _, s := range summaries {
-		if s.ProbeCount == 0 {
+		if s.ProbeCount == 0 || s.Mode == AgentModePassive {
 			continue
 		}
 		switch field {
@@ -498,7 +683,7 @@ func extractField(summaries []AgentHealthSummary, field string) []float64 {
 func extractHealthField(summaries []AgentHealthSummary, field string) []float64 {
 	var out []float64
 	for _, s := range summaries {
-		if s.ProbeCount == 0 {
+		if s.ProbeCount == 0 || s.Mode == AgentModePassive {
 			continue
 		}
 		switch field {
@@ -0,0 +1,193 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+
+	"gorm.io/gorm"
+)
+
+// ── SLA Badges ──
+//
+// Badges are embedded in third-party pages and fetched on every render,
+// so summaries are cached briefly per subject and window instead of
+// re-running the probe/agent analysis for every hit.
+
+// badgeCacheTTL bounds how stale an embedded badge can be.
+const badgeCacheTTL = time.Minute
+
+// BadgeSummary is the aggregated SLA view of one probe or agent.
+type BadgeSummary struct {
+	Kind            string    `json:"kind"` // probe, agent
+	SubjectID       uint      `json:"subject_id"`
+	Name            string    `json:"name"`
+	UptimePct       float64   `json:"uptime_pct"`        // 100 - sample-weighted packet loss
+	MedianLatencyMs float64   `json:"median_latency_ms"` // sample-weighted median RTT
+	HealthScore     float64   `json:"health_score"`
+	Grade           string    `json:"grade"` // excellent/good/fair/poor/critical, unknown without data
+	Samples         int       `json:"samples"`
+	Online          *bool     `json:"online,omitempty"` // agents only
+	WindowMinutes   int       `json:"window_minutes"`
+	GeneratedAt     time.Time `json:"generated_at"`
+}
+
+type badgeCacheEntry struct {
+	summary *BadgeSummary
+	expires time.Time
+}
+
+var (
+	badgeCacheMu sync.Mutex
+	badgeCache   = make(map[string]badgeCacheEntry)
+)
+
+// ComputeBadge returns the cached badge summary for a probe or agent in
+// the workspace, computing it on a miss. Returns ErrNotFound when the
+// subject does not belong to the workspace.
+func ComputeBadge(ctx context.Context, ch *sql.DB, pg *gorm.DB, kind string, workspaceID, subjectID uint, windowMinutes int) (*BadgeSummary, error) {
+	key := fmt.Sprintf("%s:%d:%d:%d", kind, workspaceID, subjectID, windowMinutes)
+	now := time.Now()
+
+	badgeCacheMu.Lock()
+	if e, ok := badgeCache[key]; ok && now.Before(e.expires) {
+		badgeCacheMu.Unlock()
+		return e.summary, nil
+	}
+	for k, e := range badgeCache {
+		if now.After(e.expires) {
+			delete(badgeCache, k)
+		}
+	}
+	badgeCacheMu.Unlock()
+
+	var (
+		s   *BadgeSummary
+		err error
+	)
+	switch kind {
+	case "probe":
+		s, err = computeProbeBadge(ctx, ch, pg, workspaceID, subjectID, windowMinutes)
+	case "agent":
+		s, err = computeAgentBadge(ctx, ch, pg, workspaceID, subjectID, windowMinutes)
+	default:
+		return nil, fmt.Errorf("%w: unknown badge kind %q", ErrBadInput, kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	badgeCacheMu.Lock()
+	badgeCache[key] = badgeCacheEntry{summary: s, expires: now.Add(badgeCacheTTL)}
+	badgeCacheMu.Unlock()
+	return s, nil
+}
+
+func computeProbeBadge(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID, probeID uint, windowMinutes int) (*BadgeSummary, error) {
+	p, err := GetByID(ctx, pg, probeID)
+	if err != nil {
+		return nil, err
+	}
+	if p.WorkspaceID != workspaceID {
+		return nil, ErrNotFound
+	}
+	pa, err := ComputeProbeAnalysis(ctx, ch, pg, workspaceID, probeID, windowMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	health := pa.Health
+	if pa.CombinedHealth != nil {
+		health = *pa.CombinedHealth
+	}
+	name := pa.Target
+	if pa.AgentName != "" && name != "" {
+		name = pa.AgentName + " → " + name
+	}
+	s := &BadgeSummary{
+		Kind:          "probe",
+		SubjectID:     probeID,
+		Name:          name,
+		HealthScore:   sanitizeFloat(health.OverallHealth),
+		Grade:         health.Grade,
+		WindowMinutes: windowMinutes,
+		GeneratedAt:   time.Now().UTC(),
+	}
+	applyBadgeMetrics(s, []ProbeAnalysis{*pa})
+	return s, nil
+}
+
+func computeAgentBadge(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID, agentID uint, windowMinutes int) (*BadgeSummary, error) {
+	if _, err := agent.GetAgentByWorkspaceAndID(ctx, pg, workspaceID, agentID); err != nil {
+		if errors.Is(err, agent.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	aa, err := ComputePerAgentAnalysis(ctx, pg, ch, agentID, windowMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	online := aa.IsOnline
+	s := &BadgeSummary{
+		Kind:          "agent",
+		SubjectID:     agentID,
+		Name:          aa.AgentName,
+		HealthScore:   sanitizeFloat(aa.Health.OverallHealth),
+		Grade:         aa.Health.Grade,
+		Online:        &online,
+		WindowMinutes: windowMinutes,
+		GeneratedAt:   time.Now().UTC(),
+	}
+	applyBadgeMetrics(s, append(aa.Probes, aa.ReturnPathProbes...))
+	return s, nil
+}
+
+// applyBadgeMetrics fills uptime, median latency and sample count from the
+// forward and reverse metrics of analyses, weighting each direction by its
+// sample count. Uptime follows the report convention of 100 - loss.
+func applyBadgeMetrics(s *BadgeSummary, analyses []ProbeAnalysis) {
+	var lossSum, latSum float64
+	var samples, latSamples int
+	add := func(m ProbeMetrics) {
+		if m.SampleCount == 0 {
+			return
+		}
+		w := float64(m.SampleCount)
+		lossSum += m.PacketLoss * w
+		samples += m.SampleCount
+		lat := m.MedianLatency
+		if lat <= 0 {
+			lat = m.AvgLatency
+		}
+		if lat > 0 {
+			latSum += lat * w
+			latSamples += m.SampleCount
+		}
+	}
+	for _, pa := range analyses {
+		add(pa.Metrics)
+		if pa.Reverse != nil {
+			add(pa.Reverse.Metrics)
+		}
+	}
+
+	s.Samples = samples
+	if samples == 0 {
+		s.Grade = "unknown"
+		return
+	}
+	// Two decimals: SLA figures like 99.95% must not round to 100.
+	uptime := math.Max(0, math.Min(100, 100-lossSum/float64(samples)))
+	s.UptimePct = sanitizeFloat(math.Round(uptime*100) / 100)
+	if latSamples > 0 {
+		s.MedianLatencyMs = sanitizeFloat(math.Round(latSum/float64(latSamples)*10) / 10)
+	}
+}
@@ -0,0 +1,38 @@
+package probe
+
+import "testing"
+
+// TestApplyBadgeMetricsWeightsBySamples verifies uptime and median latency
+// are sample-weighted across probes and directions.
+func TestApplyBadgeMetricsWeightsBySamples(t *testing.T) {
+	s := &BadgeSummary{Grade: "good"}
+	applyBadgeMetrics(s, []ProbeAnalysis{
+		{
+			Metrics: ProbeMetrics{SampleCount: 300, PacketLoss: 0, MedianLatency: 10},
+			Reverse: &ProbeAnalysis{Metrics: ProbeMetrics{SampleCount: 100, PacketLoss: 0.2, MedianLatency: 30}},
+		},
+		{Metrics: ProbeMetrics{SampleCount: 0, PacketLoss: 100}},
+	})
+	if s.Samples != 400 {
+		t.Errorf("samples = %d, want 400", s.Samples)
+	}
+	if s.UptimePct != 99.95 {
+		t.Errorf("uptime = %v, want 99.95", s.UptimePct)
+	}
+	if s.MedianLatencyMs != 15 {
+		t.Errorf("median latency = %v, want 15", s.MedianLatencyMs)
+	}
+	if s.Grade != "good" {
+		t.Errorf("grade = %q, want unchanged", s.Grade)
+	}
+}
+
+// TestApplyBadgeMetricsNoData verifies a subject without samples is graded
+// unknown rather than reported as 100% up.
+func TestApplyBadgeMetricsNoData(t *testing.T) {
+	s := &BadgeSummary{Grade: "excellent"}
+	applyBadgeMetrics(s, nil)
+	if s.Grade != "unknown" || s.UptimePct != 0 {
+		t.Errorf("got grade %q uptime %v", s.Grade, s.UptimePct)
+	}
+}
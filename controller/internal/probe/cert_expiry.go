@@ -0,0 +1,204 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Certificate Expiry ──────────────────────────────────────────────────────
+//
+// HTTP and TLS probes both report the leaf certificate a target serves.
+// A certificate that expires in under certExpiryWarnDays raises a
+// cert_expiry finding on the probe's analysis and on the workspace's; under
+// certExpiryCriticalDays, or already expired, the finding is critical.
+// Days are counted from NotAfter against the analysis time, not the
+// agent's sample, so the finding escalates even if the probe stops.
+
+const (
+	certExpiryWarnDays     = 14
+	certExpiryCriticalDays = 3
+)
+
+// certSample is the latest certificate one probe saw at one target.
+type certSample struct {
+	ProbeID     uint
+	AgentID     uint
+	Type        Type
+	Target      string
+	Subject     string
+	Issuer      string
+	NotAfter    time.Time
+	Fingerprint string
+}
+
+// certDaysLeft is whole days until notAfter; negative once expired.
+func certDaysLeft(notAfter, now time.Time) int {
+	return int(math.Floor(notAfter.Sub(now).Hours() / 24))
+}
+
+// parseCertSample extracts the leaf certificate from an HTTP or TLS payload.
+func parseCertSample(typ Type, raw string) (certSample, bool) {
+	s := certSample{Type: typ}
+	switch typ {
+	case TypeHTTP:
+		var p HTTPPayload
+		if err := json.Unmarshal([]byte(raw), &p); err != nil || p.CertificateInfo == nil {
+			return s, false
+		}
+		c := p.CertificateInfo
+		s.Subject, s.Issuer, s.NotAfter, s.Fingerprint = c.Subject, c.Issuer, c.NotAfter, c.Fingerprint
+		if p.URL != "" {
+			s.Target = p.URL
+		}
+	case TypeTLS:
+		var p TLSPayload
+		if err := json.Unmarshal([]byte(raw), &p); err != nil || p.Certificate == nil {
+			return s, false
+		}
+		c := p.Certificate
+		s.Subject, s.Issuer, s.NotAfter, s.Fingerprint = c.Subject, c.Issuer, c.NotAfter, c.Fingerprint
+		if s.Fingerprint == "" {
+			s.Fingerprint = p.CertFingerprint
+		}
+	default:
+		return s, false
+	}
+	return s, !s.NotAfter.IsZero()
+}
+
+// fetchLatestCertSamples returns the latest certificate per probe, agent
+// and target. probeID 0 covers every HTTP/TLS probe of the agents.
+func fetchLatestCertSamples(ctx context.Context, ch *sql.DB, agentIDs []uint, probeID uint, from time.Time) []certSample {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	probeFilter := ""
+	if probeID > 0 {
+		probeFilter = fmt.Sprintf("\n  AND probe_id = %d", probeID)
+	}
+	q := fmt.Sprintf(`
+SELECT probe_id, agent_id, type, target, argMax(payload_raw, created_at)
+FROM probe_data
+WHERE type IN ('HTTP', 'TLS')
+  AND agent_id IN (%s)%s
+  AND created_at >= %s%s
+GROUP BY probe_id, agent_id, type, target
+`, strings.Join(ids, ", "), probeFilter, chQuoteTime(from), asOfBound(ctx))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var out []certSample
+	for rows.Next() {
+		var pid, aid uint64
+		var typ, target, raw string
+		if err := rows.Scan(&pid, &aid, &typ, &target, &raw); err != nil {
+			continue
+		}
+		s, ok := parseCertSample(Type(typ), raw)
+		if !ok {
+			continue
+		}
+		s.ProbeID, s.AgentID = uint(pid), uint(aid)
+		if s.Target == "" {
+			s.Target = target
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// certExpiryFindings builds one finding per target whose certificate
+// expires within certExpiryWarnDays of now. Agents that see the same
+// target are merged; the soonest expiry wins.
+func certExpiryFindings(samples []certSample, agentByID map[uint]agentInfo, now time.Time) []AnalysisFinding {
+	type group struct {
+		soonest certSample
+		agents  []string
+	}
+	byTarget := make(map[string]*group)
+	var order []string
+	for _, s := range samples {
+		if certDaysLeft(s.NotAfter, now) >= certExpiryWarnDays {
+			continue
+		}
+		name := fmt.Sprintf("agent %d", s.AgentID)
+		if a, ok := agentByID[s.AgentID]; ok && a.Name != "" {
+			name = a.Name
+		}
+		g, ok := byTarget[s.Target]
+		if !ok {
+			g = &group{soonest: s}
+			byTarget[s.Target] = g
+			order = append(order, s.Target)
+		} else if s.NotAfter.Before(g.soonest.NotAfter) {
+			g.soonest = s
+		}
+		g.agents = append(g.agents, name)
+	}
+	sort.Strings(order)
+
+	out := make([]AnalysisFinding, 0, len(order))
+	for _, target := range order {
+		g := byTarget[target]
+		s := g.soonest
+		days := certDaysLeft(s.NotAfter, now)
+		sort.Strings(g.agents)
+
+		severity, title, summary := "warning",
+			fmt.Sprintf("Certificate for %s expires in %d days", target, days),
+			fmt.Sprintf("The certificate served by %s expires on %s. Clients will reject it after that.", target, s.NotAfter.UTC().Format("2006-01-02"))
+		switch {
+		case days < 0:
+			severity = "critical"
+			title = fmt.Sprintf("Certificate for %s has expired", target)
+			summary = fmt.Sprintf("The certificate served by %s expired on %s. Clients that validate certificates are already failing.", target, s.NotAfter.UTC().Format("2006-01-02"))
+		case days < certExpiryCriticalDays:
+			severity = "critical"
+		}
+
+		evidence := []string{
+			fmt.Sprintf("Subject: %s", s.Subject),
+			fmt.Sprintf("Issuer: %s", s.Issuer),
+			fmt.Sprintf("Not after: %s", s.NotAfter.UTC().Format(time.RFC3339)),
+		}
+		if s.Fingerprint != "" {
+			evidence = append(evidence, fmt.Sprintf("SHA-256 fingerprint: %s", s.Fingerprint))
+		}
+		evidence = append(evidence, fmt.Sprintf("Seen by %s (%s probe)", strings.Join(g.agents, ", "), s.Type))
+
+		out = append(out, AnalysisFinding{
+			ID:       "cert_expiry_" + sanitizeKey(target),
+			Title:    title,
+			Severity: severity,
+			Category: "certificate",
+			Summary:  summary,
+			Evidence: evidence,
+			Steps: []string{
+				"Renew the certificate and deploy it to every server behind this name",
+				"If renewal is automated (ACME), check the renewal job's logs for failures",
+				"After deploying, confirm the probe reports the new expiry and fingerprint",
+			},
+		})
+	}
+	return out
+}
+
+// detectCertExpiryFindings is certExpiryFindings over the latest HTTP/TLS
+// samples of the agents (or of one probe when probeID is set).
+func detectCertExpiryFindings(ctx context.Context, ch *sql.DB, agentIDs []uint, probeID uint, from, now time.Time, agentByID map[uint]agentInfo) []AnalysisFinding {
+	return certExpiryFindings(fetchLatestCertSamples(ctx, ch, agentIDs, probeID, from), agentByID, now)
+}
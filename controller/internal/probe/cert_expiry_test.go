@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TestCertExpiryFindings verifies the 14-day threshold, critical
+// escalation, and that agents seeing the same target share one finding.
+func TestCertExpiryFindings(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	agents := map[uint]agentInfo{1: {ID: 1, Name: "hq"}, 2: {ID: 2, Name: "branch"}}
+	samples := []certSample{
+		{AgentID: 1, Type: TypeHTTP, Target: "https://shop.example.com", NotAfter: now.Add(10 * 24 * time.Hour)},
+		{AgentID: 2, Type: TypeHTTP, Target: "https://shop.example.com", NotAfter: now.Add(9 * 24 * time.Hour)},
+		{AgentID: 1, Type: TypeTLS, Target: "mail.example.com:993", NotAfter: now.Add(-time.Hour)},
+		{AgentID: 1, Type: TypeTLS, Target: "api.example.com:443", NotAfter: now.Add(2 * 24 * time.Hour)},
+		{AgentID: 1, Type: TypeHTTP, Target: "https://ok.example.com", NotAfter: now.Add(14 * 24 * time.Hour)},
+	}
+	got := certExpiryFindings(samples, agents, now)
+	if len(got) != 3 {
+		t.Fatalf("findings = %d, want 3: %+v", len(got), got)
+	}
+	bySev := map[string]string{}
+	for _, f := range got {
+		bySev[f.ID] = f.Severity
+	}
+	for id, want := range map[string]string{
+		"cert_expiry_" + sanitizeKey("https://shop.example.com"): "warning",
+		"cert_expiry_" + sanitizeKey("mail.example.com:993"):     "critical",
+		"cert_expiry_" + sanitizeKey("api.example.com:443"):      "critical",
+	} {
+		if bySev[id] != want {
+			t.Errorf("%s severity = %q, want %q", id, bySev[id], want)
+		}
+	}
+	for _, f := range got {
+		if f.ID == "cert_expiry_"+sanitizeKey("https://shop.example.com") && f.Title != "Certificate for https://shop.example.com expires in 9 days" {
+			t.Errorf("merged finding should use the soonest expiry: %q", f.Title)
+		}
+	}
+}
+
+func TestParseCertSample(t *testing.T) {
+	notAfter := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	httpRaw, _ := json.Marshal(HTTPPayload{
+		URL:             "https://example.com",
+		ALPN:            "h2",
+		HTTP3:           &HTTP3Result{Attempted: true, Supported: true},
+		CertificateInfo: &CertInfo{Subject: "CN=example.com", NotAfter: notAfter, Fingerprint: "ab12", ChainLength: 2},
+	})
+	s, ok := parseCertSample(TypeHTTP, string(httpRaw))
+	if !ok || s.Target != "https://example.com" || !s.NotAfter.Equal(notAfter) || s.Fingerprint != "ab12" {
+		t.Errorf("HTTP sample = %+v, %v", s, ok)
+	}
+
+	tlsRaw, _ := json.Marshal(TLSPayload{Certificate: &ChainCert{Subject: "CN=mail", NotAfter: notAfter}, CertFingerprint: "cd34"})
+	if s, ok := parseCertSample(TypeTLS, string(tlsRaw)); !ok || s.Fingerprint != "cd34" {
+		t.Errorf("TLS sample = %+v, %v", s, ok)
+	}
+
+	noCert, _ := json.Marshal(HTTPPayload{URL: "http://example.com"})
+	if _, ok := parseCertSample(TypeHTTP, string(noCert)); ok {
+		t.Error("plain HTTP sample should have no certificate")
+	}
+}
+
+func TestValidateHTTPOptions(t *testing.T) {
+	for raw, wantErr := range map[string]bool{
+		`{"http":{"alpn":["h2","http/1.1"],"http3":true}}`: false,
+		`{"http":{"alpn":["spdy/3"]}}`:                     true,
+		`{"http":{"http3":"yes"}}`:                         true,
+		`{"http":"h3"}`:                                    true,
+	} {
+		err := validateProbeMetadata(datatypes.JSON(raw))
+		if (err != nil) != wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", raw, err, wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", raw, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ── ClickHouse Query Budgets ──
+//
+// clickhouse-go already does the right thing with a context: on
+// cancellation it sends a Cancel packet and drops the connection, and when
+// the context has a deadline it sets max_execution_time to the remaining
+// time (+5s) on every query. Both only help if callers pass a context that
+// actually ends, so HTTP requests get one bounded by a budget and cancelled
+// when the client goes away (see web.RequestContextMiddleware).
+//
+// If the Cancel packet is lost with the connection, the server keeps
+// executing until it next tries to write. For heavy endpoints
+// KillCHQueriesOnCancel issues a KILL QUERY for everything the request
+// started. Queries are tagged through the log_comment setting rather than
+// query_id: a query_id must be unique among running queries and one
+// request may run several at once.
+
+// chQueryTagPrefix marks log_comment values set by WithCHBudget so KILL
+// never matches a comment set by someone else.
+const chQueryTagPrefix = "netwatcher:"
+
+// chKillTimeout bounds the KILL QUERY itself.
+const chKillTimeout = 5 * time.Second
+
+type chTagKey struct{}
+
+// WithCHBudget bounds ctx by budget (unless ctx already ends sooner) and
+// tags every ClickHouse query run under it with tag. A budget <= 0 only
+// tags.
+func WithCHBudget(ctx context.Context, budget time.Duration, tag string) (context.Context, context.CancelFunc) {
+	cancel := context.CancelFunc(func() {})
+	if budget > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget)
+	}
+	if tag == "" {
+		return ctx, cancel
+	}
+	comment := chQueryTagPrefix + tag
+	ctx = context.WithValue(ctx, chTagKey{}, comment)
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"log_comment": comment}))
+	return ctx, cancel
+}
+
+// CHQueryTag returns the log_comment WithCHBudget attached to ctx.
+func CHQueryTag(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(chTagKey{}).(string)
+	return tag, ok
+}
+
+// KillCHQueriesOnCancel kills the ClickHouse queries tagged on ctx if ctx
+// ends (deadline or client gone) before stop is called. Call stop once
+// the work finishes normally; it reports whether the kill was prevented.
+func KillCHQueriesOnCancel(ctx context.Context, ch *sql.DB) (stop func() bool) {
+	tag, ok := CHQueryTag(ctx)
+	if !ok || ch == nil || EmbeddedTelemetry() {
+		// SQLite interrupts the statement itself on cancellation.
+		return func() bool { return true }
+	}
+	return context.AfterFunc(ctx, func() {
+		kctx, cancel := context.WithTimeout(context.Background(), chKillTimeout)
+		defer cancel()
+		if err := killCHQueries(kctx, ch, tag); err != nil {
+			log.Warnf("[clickhouse] kill queries %q after %v: %v", tag, context.Cause(ctx), err)
+			return
+		}
+		log.Debugf("[clickhouse] killed queries %q after %v", tag, context.Cause(ctx))
+	})
+}
+
+func killCHQueries(ctx context.Context, ch *sql.DB, tag string) error {
+	_, err := ch.ExecContext(ctx, killCHQueriesSQL(tag))
+	return err
+}
+
+// killCHQueriesSQL is asynchronous so the KILL returns as soon as the
+// queries are flagged instead of waiting for them to unwind.
+func killCHQueriesSQL(tag string) string {
+	return fmt.Sprintf("KILL QUERY WHERE Settings['log_comment'] = %s ASYNC", chQuoteString(tag))
+}
@@ -0,0 +1,56 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithCHBudget(t *testing.T) {
+	ctx, cancel := WithCHBudget(context.Background(), time.Minute, "req-1/ab")
+	defer cancel()
+
+	tag, ok := CHQueryTag(ctx)
+	if !ok || tag != "netwatcher:req-1/ab" {
+		t.Errorf("tag = %q, %v", tag, ok)
+	}
+	dl, ok := ctx.Deadline()
+	if !ok || time.Until(dl) > time.Minute {
+		t.Errorf("deadline = %v, %v; want within a minute", dl, ok)
+	}
+
+	// A parent that ends sooner keeps its deadline.
+	parent, pcancel := context.WithTimeout(context.Background(), time.Second)
+	defer pcancel()
+	ctx2, cancel2 := WithCHBudget(parent, time.Hour, "x")
+	defer cancel2()
+	if dl2, _ := ctx2.Deadline(); time.Until(dl2) > time.Second {
+		t.Errorf("budget extended parent deadline to %v", dl2)
+	}
+
+	ctx3, cancel3 := WithCHBudget(context.Background(), 0, "")
+	defer cancel3()
+	if _, ok := ctx3.Deadline(); ok {
+		t.Error("zero budget set a deadline")
+	}
+	if _, ok := CHQueryTag(ctx3); ok {
+		t.Error("empty tag was attached")
+	}
+}
+
+func TestKillCHQueriesSQLQuotesTag(t *testing.T) {
+	got := killCHQueriesSQL(`netwatcher:it's`)
+	want := `KILL QUERY WHERE Settings['log_comment'] = 'netwatcher:it''s' ASYNC`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestKillCHQueriesOnCancelWithoutClickHouse(t *testing.T) {
+	ctx, cancel := WithCHBudget(context.Background(), time.Minute, "t")
+	stop := KillCHQueriesOnCancel(ctx, nil)
+	cancel()
+	if !stop() {
+		t.Error("stop without ClickHouse should report nothing to kill")
+	}
+}
@@ -13,6 +13,10 @@ import (
 	"strings"
 	"time"
 
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/logging"
+	"netwatcher-controller/internal/settings"
+
 	"github.com/ClickHouse/clickhouse-go/v2"
 	log "github.com/sirupsen/logrus"
 )
@@ -97,12 +101,24 @@ func MigrateCH(ctx context.Context, ch *sql.DB, retentionDays int) error {
 	ENGINE = MergeTree
 	PARTITION BY toYYYYMM(created_at)
 	ORDER BY (type, probe_id, created_at)
-	TTL created_at + INTERVAL %d DAY DELETE
-	SETTINGS index_granularity = 8192;
-`, retentionDays)
+	TTL %s
+	SETTINGS index_granularity = 8192%s;
+`, RetentionTTL("probe_data", "created_at", retentionDays), StorageTiers().settingsClause())
 	if _, err := ch.ExecContext(ctx, ddl); err != nil {
 		return err
 	}
+	// DSCP marking the agent sent with (0 = best effort / unknown).
+	if _, err := ch.ExecContext(ctx, `ALTER TABLE probe_data ADD COLUMN IF NOT EXISTS dscp UInt8 DEFAULT 0`); err != nil {
+		return err
+	}
+	// Denormalized probe labels (CH_LABEL_COLUMNS), see label_columns.go.
+	if err := migrateLabelColumnsCH(ctx, ch); err != nil {
+		return err
+	}
+	// Speedtest payloads, kept out of probe_data (see speedtest_store.go).
+	if err := migrateSpeedtestCH(ctx, ch, retentionDays); err != nil {
+		return err
+	}
 
 	// Analysis snapshots — stores periodic workspace health analysis results
 	// for long-term trend analysis. Top-level metrics are native columns for
@@ -130,11 +146,46 @@ func MigrateCH(ctx context.Context, ch *sql.DB, retentionDays int) error {
 	ENGINE = MergeTree
 	PARTITION BY toYYYYMM(generated_at)
 	ORDER BY (workspace_id, generated_at)
-	TTL generated_at + INTERVAL %d DAY DELETE
-	SETTINGS index_granularity = 8192;
-`, retentionDays)
-	_, err := ch.ExecContext(ctx, snapshotDDL)
-	return err
+	TTL %s
+	SETTINGS index_granularity = 8192%s;
+`, RetentionTTL("analysis_snapshots", "generated_at", retentionDays), StorageTiers().settingsClause())
+	if _, err := ch.ExecContext(ctx, snapshotDDL); err != nil {
+		return err
+	}
+	// Scoring code version that produced the row (0 = before versioning).
+	if _, err := ch.ExecContext(ctx, `ALTER TABLE analysis_snapshots ADD COLUMN IF NOT EXISTS scoring_version UInt32 DEFAULT 0`); err != nil {
+		return err
+	}
+	// LLM summary cache key and the tokens the summary cost (0 when cached).
+	for _, col := range []string{
+		"llm_cache_key String DEFAULT ''",
+		"llm_cached UInt8 DEFAULT 0",
+		"llm_prompt_tokens UInt32 DEFAULT 0",
+		"llm_completion_tokens UInt32 DEFAULT 0",
+		// State of the queued LLM summary (see llm_enrichment.go).
+		"enrichment_status LowCardinality(String) DEFAULT ''",
+	} {
+		if _, err := ch.ExecContext(ctx, `ALTER TABLE analysis_snapshots ADD COLUMN IF NOT EXISTS `+col); err != nil {
+			return err
+		}
+	}
+
+	// Finished LLM summaries for snapshots saved while they were pending.
+	if _, err := ch.ExecContext(ctx, fmt.Sprintf(analysisEnrichmentsDDL,
+		RetentionTTL("analysis_snapshot_enrichments", "generated_at", retentionDays))); err != nil {
+		return err
+	}
+
+	// Reprocessed snapshots — analysis recomputed over history by a
+	// reprocess job, kept apart from live snapshots for comparison.
+	if _, err := ch.ExecContext(ctx, fmt.Sprintf(analysisSnapshotVersionsDDL,
+		RetentionTTL("analysis_snapshot_versions", "generated_at", retentionDays), StorageTiers().settingsClause())); err != nil {
+		return err
+	}
+
+	// Storage policy and TTL moves for tables created before tiering was
+	// configured (see storage_tiers.go).
+	return migrateStorageTiersCH(ctx, ch, retentionDays)
 }
 
 // MigrateCHWithDefaults creates the table with default 90-day retention
@@ -157,6 +208,8 @@ type chRecord struct {
 	Target          string
 	TargetAgent     uint64
 	PayloadRaw      string
+	DSCP            uint8
+	Labels          []string // LabelColumnKeys order
 }
 
 // CHBatchWriter buffers probe data rows and flushes them in batches to
@@ -165,6 +218,7 @@ type CHBatchWriter struct {
 	ch       *sql.DB
 	records  chan chRecord
 	done     chan struct{}
+	reconfig chan BatchWriterConfig
 	maxBatch int
 	interval time.Duration
 }
@@ -175,22 +229,58 @@ const (
 	batchChanSize        = 2000 // buffer up to 2 000 records before blocking
 )
 
+// BatchWriterConfig sizes the batch writer's inserts.
+type BatchWriterConfig struct {
+	BatchSize     int           // rows per INSERT (BATCH_WRITER_SIZE)
+	FlushInterval time.Duration // partial batch flush period (BATCH_WRITER_FLUSH_MS)
+}
+
+// LoadBatchWriterConfig reads the batch writer settings.
+func LoadBatchWriterConfig() BatchWriterConfig {
+	cfg := BatchWriterConfig{BatchSize: defaultBatchSize, FlushInterval: defaultFlushInterval}
+	if n, err := strconv.Atoi(settings.Getenv("BATCH_WRITER_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if n, err := strconv.Atoi(settings.Getenv("BATCH_WRITER_FLUSH_MS")); err == nil && n > 0 {
+		cfg.FlushInterval = time.Duration(n) * time.Millisecond
+	}
+	return cfg
+}
+
 // globalBatchWriter is the package-level singleton initialised at startup.
 var globalBatchWriter *CHBatchWriter
 
 // InitBatchWriter creates and starts the global batch writer.
 // Call this once at startup, after MigrateCH.
 func InitBatchWriter(ch *sql.DB) {
+	cfg := LoadBatchWriterConfig()
 	w := &CHBatchWriter{
 		ch:       ch,
 		records:  make(chan chRecord, batchChanSize),
 		done:     make(chan struct{}),
-		maxBatch: defaultBatchSize,
-		interval: defaultFlushInterval,
+		reconfig: make(chan BatchWriterConfig, 1),
+		maxBatch: cfg.BatchSize,
+		interval: cfg.FlushInterval,
 	}
 	globalBatchWriter = w
+	health.Register("batch_writer", w.interval, 0)
 	go w.loop()
-	log.Info("ClickHouse batch writer started")
+	log.Infof("ClickHouse batch writer started (batch size: %d, flush interval: %s)", w.maxBatch, w.interval)
+}
+
+// ReconfigureBatchWriter applies new batch settings to the running writer
+// at its next loop iteration. The queue capacity is fixed at startup.
+func ReconfigureBatchWriter(cfg BatchWriterConfig) {
+	w := globalBatchWriter
+	if w == nil || cfg.BatchSize <= 0 || cfg.FlushInterval <= 0 {
+		return
+	}
+	// Replace a pending change that the loop hasn't picked up yet.
+	select {
+	case <-w.reconfig:
+	default:
+	}
+	w.reconfig <- cfg
 }
 
 // StopBatchWriter signals the writer to flush remaining records and stop.
@@ -200,6 +290,7 @@ func StopBatchWriter() {
 	}
 	close(globalBatchWriter.records)
 	<-globalBatchWriter.done // wait for final flush
+	health.Stop("batch_writer")
 	log.Info("ClickHouse batch writer stopped")
 }
 
@@ -209,6 +300,17 @@ func (w *CHBatchWriter) enqueue(r chRecord) {
 	w.records <- r
 }
 
+// BatchWriterBacklog reports how many records are queued for the next
+// ClickHouse flush and the queue capacity. ok is false before
+// InitBatchWriter has run.
+func BatchWriterBacklog() (queued, capacity int, ok bool) {
+	w := globalBatchWriter
+	if w == nil {
+		return 0, 0, false
+	}
+	return len(w.records), cap(w.records), true
+}
+
 // loop is the background goroutine that reads from the channel and
 // flushes in batches.
 func (w *CHBatchWriter) loop() {
@@ -233,11 +335,21 @@ func (w *CHBatchWriter) loop() {
 				w.flush(buf)
 				buf = buf[:0]
 			}
+		case cfg := <-w.reconfig:
+			w.maxBatch, w.interval = cfg.BatchSize, cfg.FlushInterval
+			ticker.Reset(w.interval)
+			health.Register("batch_writer", w.interval, 0)
+			if len(buf) >= w.maxBatch {
+				w.flush(buf)
+				buf = buf[:0]
+			}
+			log.Infof("ClickHouse batch writer reconfigured (batch size: %d, flush interval: %s)", w.maxBatch, w.interval)
 		case <-ticker.C:
 			if len(buf) > 0 {
 				w.flush(buf)
 				buf = buf[:0]
 			}
+			health.Beat("batch_writer")
 		}
 	}
 }
@@ -250,22 +362,16 @@ func (w *CHBatchWriter) flush(batch []chRecord) {
 
 	// Build multi-row VALUES
 	var sb strings.Builder
-	sb.WriteString(`INSERT INTO probe_data
-(created_at, received_at, type, probe_id, probe_agent_id, agent_id,
- triggered, triggered_reason, target, target_agent, payload_raw) VALUES `)
+	sb.WriteString("INSERT INTO probe_data\n(" + probeDataInsertColumns() + ") VALUES ")
 
-	args := make([]any, 0, len(batch)*11)
+	placeholder := probeDataRowPlaceholder()
+	args := make([]any, 0, len(batch)*(12+len(LabelColumnKeys())))
 	for i, r := range batch {
 		if i > 0 {
 			sb.WriteString(", ")
 		}
-		sb.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
-		args = append(args,
-			r.CreatedAt, r.ReceivedAt, r.Kind,
-			r.ProbeID, r.ProbeAgentID, r.AgentID,
-			r.Triggered, r.TriggeredReason,
-			r.Target, r.TargetAgent, r.PayloadRaw,
-		)
+		sb.WriteString(placeholder)
+		args = append(args, r.args()...)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -287,11 +393,13 @@ func SaveRecordCH(ctx context.Context, ch *sql.DB, data ProbeData, kind string,
 		return fmt.Errorf("marshal payload: %w", err)
 	}
 
-	created := data.CreatedAt
+	// Normalized to UTC: ClickHouse stores DateTime('UTC') regardless, and
+	// the embedded SQLite backend compares timestamps as text.
+	created := data.CreatedAt.UTC()
 	if created.IsZero() {
 		created = time.Now().UTC()
 	}
-	received := data.ReceivedAt
+	received := data.ReceivedAt.UTC()
 	if received.IsZero() {
 		received = time.Now().UTC()
 	}
@@ -308,6 +416,8 @@ func SaveRecordCH(ctx context.Context, ch *sql.DB, data ProbeData, kind string,
 		Target:          data.Target,
 		TargetAgent:     uint64(data.TargetAgent),
 		PayloadRaw:      string(raw),
+		DSCP:            data.DSCP,
+		Labels:          labelColumnRow(data.Labels),
 	}
 
 	// Use batch writer if available, otherwise direct INSERT
@@ -317,21 +427,25 @@ func SaveRecordCH(ctx context.Context, ch *sql.DB, data ProbeData, kind string,
 	}
 
 	// Fallback: direct single-row INSERT (for tests / one-off scripts)
-	const ins = `
-INSERT INTO probe_data
-(created_at, received_at, type, probe_id, probe_agent_id, agent_id,
- triggered, triggered_reason, target, target_agent, payload_raw)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-`
-	_, err = ch.ExecContext(ctx, ins,
-		rec.CreatedAt, rec.ReceivedAt, rec.Kind,
-		rec.ProbeID, rec.ProbeAgentID, rec.AgentID,
-		rec.Triggered, rec.TriggeredReason,
-		rec.Target, rec.TargetAgent, rec.PayloadRaw,
-	)
+	ins := "INSERT INTO probe_data\n(" + probeDataInsertColumns() + ")\nVALUES " + probeDataRowPlaceholder()
+	_, err = ch.ExecContext(ctx, ins, rec.args()...)
 	return err
 }
 
+// args returns the INSERT values in probeDataInsertColumns order.
+func (r chRecord) args() []any {
+	out := []any{
+		r.CreatedAt, r.ReceivedAt, r.Kind,
+		r.ProbeID, r.ProbeAgentID, r.AgentID,
+		r.Triggered, r.TriggeredReason,
+		r.Target, r.TargetAgent, r.PayloadRaw, r.DSCP,
+	}
+	for _, v := range r.Labels {
+		out = append(out, v)
+	}
+	return out
+}
+
 func boolToUInt8(b bool) uint8 {
 	if b {
 		return 1
@@ -351,6 +465,35 @@ func (e ProbeData) DecodePayload(v any) error {
 	return json.Unmarshal([]byte(e.Payload), v)
 }
 
+// scanProbeDataRows reads rows selected with the standard getter column
+// list (created_at … payload_raw) into ProbeData.
+func scanProbeDataRows(ctx context.Context, rows *sql.Rows, err error) ([]ProbeData, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ProbeData
+	for rows.Next() {
+		var r ProbeData
+		var trigBool bool
+		var typeStr string
+		var payloadStr string
+		if err := rows.Scan(
+			&r.CreatedAt, &r.ReceivedAt, &typeStr, &r.ProbeID, &r.AgentID, &r.ProbeAgentID,
+			&trigBool, &r.TriggeredReason, &r.Target, &r.TargetAgent, &payloadStr,
+		); err != nil {
+			return nil, err
+		}
+		r.Type = Type(typeStr)
+		r.Triggered = trigBool
+		r.Payload = json.RawMessage(UnsealAgentPayload(ctx, r.AgentID, []byte(payloadStr)))
+		normalizeProbeDataTimes(&r)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
 // -------------------------------------------
 // Simple, focused helpers
 // -------------------------------------------
@@ -406,7 +549,7 @@ func GetProbeDataByProbe(
 SELECT
     created_at, received_at, type, probe_id, agent_id, probe_agent_id,
     triggered, triggered_reason, target, target_agent, payload_raw
-FROM probe_data
+FROM ` + probeDataTable(typeFilter) + `
 WHERE ` + strings.Join(clauses, " AND ") + `
 ORDER BY created_at ` + order
 
@@ -434,7 +577,8 @@ ORDER BY created_at ` + order
 		}
 		r.Type = Type(typeStr)
 		r.Triggered = trigBool
-		r.Payload = json.RawMessage(payloadStr)
+		r.Payload = json.RawMessage(UnsealAgentPayload(ctx, r.AgentID, []byte(payloadStr)))
+		normalizeProbeDataTimes(&r)
 		out = append(out, r)
 	}
 	return out, rows.Err()
@@ -467,7 +611,7 @@ func GetLatestByTypeAndAgent(
 SELECT
     created_at, received_at, type, probe_id, agent_id, probe_agent_id,
     triggered, triggered_reason, target, target_agent, payload_raw
-FROM probe_data
+FROM ` + probeDataTable(typ) + `
 WHERE ` + strings.Join(clauses, " AND ") + `
 ORDER BY created_at DESC
 LIMIT 1
@@ -490,7 +634,8 @@ LIMIT 1
 	}
 	r.Type = Type(typeStr)
 	r.Triggered = trigBool
-	r.Payload = json.RawMessage(payloadStr)
+	r.Payload = json.RawMessage(UnsealAgentPayload(ctx, r.AgentID, []byte(payloadStr)))
+	normalizeProbeDataTimes(&r)
 	return &r, nil
 }
 
@@ -511,6 +656,9 @@ type FindParams struct {
 	To           time.Time // created_at <=
 	Limit        int       // LIMIT N
 	Ascending    bool      // ORDER BY created_at ASC (default DESC)
+	// Labels filters on denormalized label columns (label_<key> = value);
+	// keys must be in LabelColumnKeys.
+	Labels map[string]string
 }
 
 // REWRITE FindProbeData: inline literals (no args / ? placeholders)
@@ -553,6 +701,20 @@ func FindProbeData(ctx context.Context, db *sql.DB, p FindParams) ([]ProbeData,
 		}
 		clauses = append(clauses, fmt.Sprintf("triggered = %d", v))
 	}
+	table := "probe_data"
+	if p.Type != nil {
+		table = probeDataTable(*p.Type)
+	}
+	if len(p.Labels) > 0 {
+		if table != "probe_data" {
+			return nil, fmt.Errorf("%w: label filters are not supported for %s", ErrBadInput, *p.Type)
+		}
+		lc, err := labelFilterClauses(p.Labels)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, lc...)
+	}
 
 	where := "1"
 	if len(clauses) > 0 {
@@ -568,7 +730,7 @@ func FindProbeData(ctx context.Context, db *sql.DB, p FindParams) ([]ProbeData,
 SELECT
     created_at, received_at, type, probe_id, agent_id, probe_agent_id,
     triggered, triggered_reason, target, target_agent, payload_raw
-FROM probe_data
+FROM ` + table + `
 WHERE ` + where + `
 ORDER BY created_at ` + order
 
@@ -596,7 +758,8 @@ ORDER BY created_at ` + order
 		}
 		r.Type = Type(typeStr)
 		r.Triggered = trigBool
-		r.Payload = json.RawMessage(payloadStr)
+		r.Payload = json.RawMessage(UnsealAgentPayload(ctx, r.AgentID, []byte(payloadStr)))
+		normalizeProbeDataTimes(&r)
 		out = append(out, r)
 	}
 	return out, rows.Err()
@@ -617,6 +780,65 @@ func GetLatest(ctx context.Context, db *sql.DB, p FindParams) (*ProbeData, error
 	return &rows[0], nil
 }
 
+// GetLatestMany returns the newest row for each probe ID in a single
+// query (argMax per probe) instead of one GetLatest round trip per probe.
+// Probes without data are absent from the result.
+func GetLatestMany(ctx context.Context, db *sql.DB, probeIDs []uint) (map[uint]*ProbeData, error) {
+	out := make(map[uint]*ProbeData, len(probeIDs))
+	if len(probeIDs) == 0 {
+		return out, nil
+	}
+	idStrs := make([]string, len(probeIDs))
+	for i, id := range probeIDs {
+		idStrs[i] = fmt.Sprintf("%d", id)
+	}
+
+	// latest_at must not be aliased as created_at: ClickHouse substitutes
+	// aliases inside expressions, which would nest the aggregates.
+	q := fmt.Sprintf(`
+SELECT
+    probe_id,
+    max(created_at) AS latest_at,
+    argMax(received_at, created_at),
+    argMax(type, created_at),
+    argMax(agent_id, created_at),
+    argMax(probe_agent_id, created_at),
+    argMax(triggered, created_at),
+    argMax(triggered_reason, created_at),
+    argMax(target, created_at),
+    argMax(target_agent, created_at),
+    argMax(payload_raw, created_at)
+FROM probe_data
+WHERE probe_id IN (%s)
+GROUP BY probe_id
+`, strings.Join(idStrs, ", "))
+
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r ProbeData
+		var trigBool bool
+		var typeStr string
+		var payloadStr string
+		if err := rows.Scan(
+			&r.ProbeID, &r.CreatedAt, &r.ReceivedAt, &typeStr, &r.AgentID, &r.ProbeAgentID,
+			&trigBool, &r.TriggeredReason, &r.Target, &r.TargetAgent, &payloadStr,
+		); err != nil {
+			return nil, err
+		}
+		r.Type = Type(typeStr)
+		r.Triggered = trigBool
+		r.Payload = json.RawMessage(UnsealAgentPayload(ctx, r.AgentID, []byte(payloadStr)))
+		normalizeProbeDataTimes(&r)
+		out[r.ProbeID] = &r
+	}
+	return out, rows.Err()
+}
+
 // Convenience wrapper for your stated use-case:
 // “ONLY the newest entry for probe with type NETINFO and agent (reporting agent) id = X”
 func GetLatestNetInfoForAgent(
@@ -625,7 +847,7 @@ func GetLatestNetInfoForAgent(
 	agentID uint64,
 	probeID *uint64, // pass nil to ignore probe_id
 ) (*ProbeData, error) {
-	log.Infof("[IP-DEBUG] GetLatestNetInfoForAgent: querying NETINFO for agent_id=%d", agentID)
+	entry := ingestLog.WithField(logging.FieldAgent, agentID)
 	typ := string(TypeNetInfo) // or string(probe.TypeNetInfo) if you prefer
 	params := FindParams{
 		Type:    &typ,
@@ -636,14 +858,13 @@ func GetLatestNetInfoForAgent(
 	}
 	result, err := GetLatest(ctx, db, params)
 	if err != nil {
-		log.Errorf("[IP-DEBUG] GetLatestNetInfoForAgent: query error for agent %d: %v", agentID, err)
+		entry.WithError(err).Error("GetLatestNetInfoForAgent: query failed")
 		return nil, err
 	}
 	if result != nil {
-		log.Infof("[IP-DEBUG] GetLatestNetInfoForAgent: found record for agent %d - result.AgentID=%d, ProbeID=%d",
-			agentID, result.AgentID, result.ProbeID)
+		entry.WithField(logging.FieldProbe, result.ProbeID).Debug("GetLatestNetInfoForAgent: found NETINFO record")
 	} else {
-		log.Warnf("[IP-DEBUG] GetLatestNetInfoForAgent: no record found for agent %d", agentID)
+		entry.Debug("GetLatestNetInfoForAgent: no NETINFO record")
 	}
 	return result, nil
 }
@@ -732,23 +953,6 @@ func GetProbeDataAggregated(
 	}
 }
 
-// pingAggInputPayload represents the JSON structure for PING probe data (used for aggregation input)
-// This matches the snake_case format sent by the agent (PingResult struct in agent/probes/ping.go)
-// RTT values are time.Duration which serializes as nanoseconds (int64)
-type pingAggInputPayload struct {
-	StartTimestamp        string  `json:"start_timestamp"`
-	StopTimestamp         string  `json:"stop_timestamp"`
-	PacketsRecv           int     `json:"packets_recv"`
-	PacketsSent           int     `json:"packets_sent"`
-	PacketsRecvDuplicates int     `json:"packets_recv_duplicates"`
-	PacketLoss            float64 `json:"packet_loss"`
-	Addr                  string  `json:"addr"`
-	MinRtt                int64   `json:"min_rtt"` // nanoseconds
-	MaxRtt                int64   `json:"max_rtt"` // nanoseconds
-	AvgRtt                int64   `json:"avg_rtt"` // nanoseconds
-	StdDevRtt             int64   `json:"std_dev_rtt"`
-}
-
 // AggregatedPingPayload represents aggregated PING data
 type AggregatedPingPayload struct {
 	Latency     float64 `json:"latency"`
@@ -820,7 +1024,7 @@ type MtrHop struct {
 	Best    string       `json:"best"`
 	Worst   string       `json:"worst"`
 	Last    string       `json:"last"`
-	StdDev  string       `json:"stdev"`
+	StdDev  string       `json:"stddev"`
 	Jitter  string       `json:"jitter"`
 	Javg    string       `json:"javg"`
 	Jmax    string       `json:"jmax"`
@@ -850,15 +1054,20 @@ func (r MtrReport) HopFinalIP() string {
 
 type MtrPayload struct {
 	Report         MtrReport `json:"report"`
-	StopTimestamp  string    `json:"stop_timestamp"`
-	StartTimestamp string    `json:"start_timestamp"`
+	StopTimestamp  Timestamp `json:"stop_timestamp"`
+	StartTimestamp Timestamp `json:"start_timestamp"`
 }
 
-// AggregatedMtrPayload represents aggregated MTR data for a time bucket
+// AggregatedMtrPayload represents aggregated MTR data for a time bucket.
+// Start and stop are the earliest start and latest stop of the
+// aggregated traces (null when none reported one); the bucket bounds
+// are set on aggregated entries only.
 type AggregatedMtrPayload struct {
-	Report                 MtrReport `json:"report"` // Aggregated hop data
-	StopTimestamp          string    `json:"stop_timestamp"`
-	StartTimestamp         string    `json:"start_timestamp"`
+	Report                 MtrReport  `json:"report"` // Aggregated hop data
+	StopTimestamp          Timestamp  `json:"stop_timestamp"`
+	StartTimestamp         Timestamp  `json:"start_timestamp"`
+	BucketStart            *Timestamp `json:"bucket_start,omitempty"`
+	BucketEnd              *Timestamp `json:"bucket_end,omitempty"`
 	RouteSignature         string    `json:"route_signature"`          // Route signature for grouping
 	PreviousRouteSignature string    `json:"previous_route_signature"` // Previous route (for route-change diff)
 	TraceCount             int       `json:"trace_count"`              // Number of traces in this bucket
@@ -1051,7 +1260,7 @@ func aggregateMtrData(rawData []ProbeData, bucketDuration time.Duration, limit i
 		}
 
 		// Aggregate the matching payloads
-		aggPayload := aggregateMtrPayloads(matchingPayloads, bucketTime, primarySignature)
+		aggPayload := aggregateMtrPayloads(matchingPayloads, bucketTime, bucketDuration, primarySignature)
 
 		payload, _ := json.Marshal(aggPayload)
 		pd := b.lastData
@@ -1074,7 +1283,7 @@ func aggregateMtrData(rawData []ProbeData, bucketDuration time.Duration, limit i
 }
 
 // aggregateMtrPayloads creates an aggregated MTR payload from multiple traces
-func aggregateMtrPayloads(payloads []MtrPayload, bucketTime time.Time, signature string) AggregatedMtrPayload {
+func aggregateMtrPayloads(payloads []MtrPayload, bucketTime time.Time, bucketDuration time.Duration, signature string) AggregatedMtrPayload {
 	if len(payloads) == 0 {
 		return AggregatedMtrPayload{IsAggregated: true}
 	}
@@ -1092,6 +1301,7 @@ func aggregateMtrPayloads(payloads []MtrPayload, bucketTime time.Time, signature
 	aggHops := make([]MtrHop, maxHops)
 	for hopIdx := 0; hopIdx < maxHops; hopIdx++ {
 		var avgLatencies, bestLatencies, worstLatencies []float64
+		var sdMeans, stdDevs, jitters, javgs, jmaxes, jints []float64
 		var totalSent, totalRecv int
 		var hosts []MtrHopHost
 		var ttl int
@@ -1116,6 +1326,16 @@ func aggregateMtrPayloads(payloads []MtrPayload, bucketTime time.Time, signature
 			if lat := parseLatency(hop.Worst); lat > 0 {
 				worstLatencies = append(worstLatencies, lat)
 			}
+			// Stddev pairs with the trace's mean so the bucket's spread
+			// includes drift between traces.
+			if hop.StdDev != "" && hop.Recv > 0 {
+				sdMeans = append(sdMeans, parseLatency(hop.Avg))
+				stdDevs = append(stdDevs, parseLatency(hop.StdDev))
+			}
+			jitters = appendJitter(jitters, hop.Jitter)
+			javgs = appendJitter(javgs, hop.Javg)
+			jmaxes = appendJitter(jmaxes, hop.Jmax)
+			jints = appendJitter(jints, hop.Jint)
 		}
 
 		lossPct := 0.0
@@ -1133,14 +1353,38 @@ func aggregateMtrPayloads(payloads []MtrPayload, bucketTime time.Time, signature
 			Best:    fmt.Sprintf("%.2f", minF(bestLatencies)),
 			Worst:   fmt.Sprintf("%.2f", maxF(worstLatencies)),
 		}
+		if len(stdDevs) > 0 {
+			aggHops[hopIdx].StdDev = fmt.Sprintf("%.2f", pooledStdDev(sdMeans, stdDevs))
+		}
+		if len(javgs) > 0 {
+			aggHops[hopIdx].Jitter = fmt.Sprintf("%.2f", avg(jitters))
+			aggHops[hopIdx].Javg = fmt.Sprintf("%.2f", avg(javgs))
+			aggHops[hopIdx].Jmax = fmt.Sprintf("%.2f", maxF(jmaxes))
+			aggHops[hopIdx].Jint = fmt.Sprintf("%.2f", avg(jints))
+		}
 	}
 
+	// The traces' own span; the bucket is reported separately rather than
+	// standing in for it.
+	var start, stop Timestamp
+	for _, p := range payloads {
+		if !p.StartTimestamp.IsZero() && (start.IsZero() || p.StartTimestamp.Before(start.Time)) {
+			start = p.StartTimestamp
+		}
+		if !p.StopTimestamp.IsZero() && p.StopTimestamp.After(stop.Time) {
+			stop = p.StopTimestamp
+		}
+	}
+	bucketStart, bucketEnd := NewTimestamp(bucketTime), NewTimestamp(bucketTime.Add(bucketDuration))
+
 	return AggregatedMtrPayload{
 		Report: MtrReport{
 			Hops: aggHops,
 		},
-		StartTimestamp: bucketTime.UTC().Format(time.RFC3339),
-		StopTimestamp:  bucketTime.Add(time.Minute).UTC().Format(time.RFC3339),
+		StartTimestamp: start,
+		StopTimestamp:  stop,
+		BucketStart:    &bucketStart,
+		BucketEnd:      &bucketEnd,
 		RouteSignature: signature,
 		TraceCount:     len(payloads),
 		IsAggregated:   true,
@@ -1174,10 +1418,9 @@ func aggregatePingData(rawData []ProbeData, bucketDuration time.Duration, limit
 		if d.Payload == nil || len(d.Payload) == 0 {
 			continue
 		}
-		// Use pingAggInputPayload which matches the snake_case JSON format from the agent
-		var p pingAggInputPayload
-		if err := json.Unmarshal(d.Payload, &p); err != nil {
-			continue // Skip malformed payloads
+		p, err := ParsePingPayload(d.Payload)
+		if err != nil {
+			continue // Skip malformed or unknown-version payloads
 		}
 
 		key := pingBucketKey{t: getBucketKey(d.CreatedAt, bucketDuration), agentID: d.AgentID}
@@ -1557,12 +1800,20 @@ type AnalysisSnapshot struct {
 	IncidentsJSON   string    `json:"incidents_json,omitempty"`
 	AgentsJSON      string    `json:"agents_json,omitempty"`
 	LLMSummary      string    `json:"llm_summary,omitempty"`
+	ScoringVersion  uint32    `json:"scoring_version"`
+	// LLM usage for the summary; tokens are 0 when it was reused.
+	LLMCacheKey         string `json:"llm_cache_key,omitempty"`
+	LLMCached           bool   `json:"llm_cached"`
+	LLMPromptTokens     int    `json:"llm_prompt_tokens"`
+	LLMCompletionTokens int    `json:"llm_completion_tokens"`
+	// EnrichmentStatus is pending until the LLM queue finishes the job.
+	EnrichmentStatus string `json:"enrichment_status,omitempty"`
 }
 
 // SaveAnalysisSnapshot persists a workspace analysis result to ClickHouse.
 // The LLM summary is only stored if it was already generated during analysis
-// (no additional LLM calls are made). Errors are non-fatal — callers should
-// log and continue.
+// (no additional LLM calls are made); a pending one is recorded later by
+// applyLLMEnrichment. Errors are non-fatal — callers should log and continue.
 func SaveAnalysisSnapshot(ctx context.Context, ch *sql.DB, analysis *WorkspaceAnalysis) error {
 	if analysis == nil {
 		return nil
@@ -1588,13 +1839,24 @@ func SaveAnalysisSnapshot(ctx context.Context, ch *sql.DB, analysis *WorkspaceAn
 		llmSummary = analysis.Status.Message
 	}
 
+	var usage LLMUsage
+	if analysis.LLM != nil {
+		usage = *analysis.LLM
+	}
+	var cached uint8
+	if usage.Cached {
+		cached = 1
+	}
+
 	const ins = `
 INSERT INTO analysis_snapshots
 (workspace_id, generated_at, overall_health, grade, latency_score,
  packet_loss_score, route_stability, mos_score, status, status_message,
  incident_count, total_agents, online_agents, total_probes,
- incidents_json, agents_json, llm_summary)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ incidents_json, agents_json, llm_summary, scoring_version,
+ llm_cache_key, llm_cached, llm_prompt_tokens, llm_completion_tokens,
+ enrichment_status)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 	_, err := ch.ExecContext(ctx, ins,
 		uint64(analysis.WorkspaceID),
@@ -1614,6 +1876,12 @@ VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		string(incidentsJSON),
 		string(agentsJSON),
 		llmSummary,
+		ScoringVersion,
+		usage.CacheKey,
+		cached,
+		uint32(usage.PromptTokens),
+		uint32(usage.CompletionTokens),
+		analysis.EnrichmentStatus,
 	)
 	return err
 }
@@ -1628,28 +1896,30 @@ func GetAnalysisSnapshots(
 	limit int,
 ) ([]AnalysisSnapshot, error) {
 	var clauses []string
-	clauses = append(clauses, fmt.Sprintf("workspace_id = %d", workspaceID))
+	clauses = append(clauses, fmt.Sprintf("s.workspace_id = %d", workspaceID))
 
 	if !from.IsZero() {
-		clauses = append(clauses, fmt.Sprintf("generated_at >= %s", chQuoteTime(from)))
+		clauses = append(clauses, fmt.Sprintf("s.generated_at >= %s", chQuoteTime(from)))
 	}
 	if !to.IsZero() {
-		clauses = append(clauses, fmt.Sprintf("generated_at <= %s", chQuoteTime(to)))
+		clauses = append(clauses, fmt.Sprintf("s.generated_at <= %s", chQuoteTime(to)))
 	}
 
 	if limit <= 0 {
 		limit = 288 // 24h of 5-min intervals
 	}
 
+	// Finished LLM enrichments are stored apart (see llm_enrichment.go).
 	q := `
 SELECT
-    workspace_id, generated_at, overall_health, grade,
-    latency_score, packet_loss_score, route_stability, mos_score,
-    status, status_message, incident_count, total_agents,
-    online_agents, total_probes, incidents_json, agents_json, llm_summary
-FROM analysis_snapshots
+    s.workspace_id, s.generated_at, s.overall_health, s.grade,
+    s.latency_score, s.packet_loss_score, s.route_stability, s.mos_score,
+    s.status, s.incident_count, s.total_agents,
+    s.online_agents, s.total_probes, s.incidents_json, s.agents_json,
+    s.scoring_version, s.llm_cache_key,` + snapshotEnrichedColumnsSQL + `
+FROM analysis_snapshots s` + enrichmentJoinSQL(workspaceID, EmbeddedTelemetry()) + `
 WHERE ` + strings.Join(clauses, " AND ") + `
-ORDER BY generated_at DESC
+ORDER BY s.generated_at DESC
 ` + fmt.Sprintf("LIMIT %d", limit)
 
 	rows, err := ch.QueryContext(ctx, q)
@@ -1661,15 +1931,20 @@ ORDER BY generated_at DESC
 	var out []AnalysisSnapshot
 	for rows.Next() {
 		var s AnalysisSnapshot
+		var cached uint8
 		if err := rows.Scan(
 			&s.WorkspaceID, &s.GeneratedAt, &s.OverallHealth, &s.Grade,
 			&s.LatencyScore, &s.PacketLossScore, &s.RouteStability, &s.MosScore,
-			&s.Status, &s.StatusMessage, &s.IncidentCount, &s.TotalAgents,
+			&s.Status, &s.IncidentCount, &s.TotalAgents,
 			&s.OnlineAgents, &s.TotalProbes, &s.IncidentsJSON, &s.AgentsJSON,
-			&s.LLMSummary,
+			&s.ScoringVersion, &s.LLMCacheKey,
+			&s.StatusMessage, &s.LLMSummary,
+			&cached, &s.LLMPromptTokens, &s.LLMCompletionTokens,
+			&s.EnrichmentStatus,
 		); err != nil {
 			return nil, err
 		}
+		s.LLMCached = cached == 1
 		out = append(out, s)
 	}
 	return out, rows.Err()
@@ -95,10 +95,10 @@ func TestAggregatePingDataSeparatesDirections(t *testing.T) {
 	base := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
 
 	mkRow := func(agentID uint, rttMs int64, at time.Time) ProbeData {
-		payload, _ := json.Marshal(pingAggInputPayload{
-			AvgRtt:      rttMs * int64(time.Millisecond),
-			MinRtt:      (rttMs - 1) * int64(time.Millisecond),
-			MaxRtt:      (rttMs + 1) * int64(time.Millisecond),
+		payload, _ := json.Marshal(PingPayload{
+			AvgRtt:      time.Duration(rttMs) * time.Millisecond,
+			MinRtt:      time.Duration(rttMs-1) * time.Millisecond,
+			MaxRtt:      time.Duration(rttMs+1) * time.Millisecond,
 			PacketsSent: 60,
 			PacketsRecv: 60,
 		})
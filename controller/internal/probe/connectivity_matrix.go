@@ -96,7 +96,7 @@ func GetWorkspaceConnectivityMatrix(ctx context.Context, ch *sql.DB, pg *gorm.DB
 		sourceAgents[i] = AgentSummary{
 			ID:       a.ID,
 			Name:     a.Name,
-			IsOnline: time.Since(a.UpdatedAt) < time.Minute,
+			IsOnline: a.connectivity(time.Now()) != ConnectivityOffline,
 		}
 	}
 
@@ -197,10 +197,10 @@ SELECT
 FROM probe_data
 WHERE type = 'MTR'
   AND agent_id IN (%s)
-  AND created_at >= %s
+  AND created_at >= %s%s
 ORDER BY created_at DESC
 LIMIT 500
-`, agentIDList, chQuoteTime(from))
+`, agentIDList, chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -0,0 +1,219 @@
+// internal/probe/default_bundle.go
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Workspace default probe bundle.
+//
+// NETINFO, SYSINFO, SPEEDTEST and SPEEDTEST_SERVERS are injected for every
+// agent at config time and are not part of the bundle. The bundle is the
+// workspace's list of real probes (e.g. PING and MTR to its core services)
+// created on every new agent that isn't copied from a template agent. An
+// empty bundle creates nothing, which is the behavior before bundles.
+
+const maxDefaultProbes = 32
+
+// bundleExcludedTypes are probe types that can't be in a bundle: the
+// virtual defaults above, and AGENT probes, whose targets are agents.
+var bundleExcludedTypes = map[Type]bool{
+	TypeNetInfo:         true,
+	TypeSysInfo:         true,
+	TypeSpeedtest:       true,
+	TypeSpeedtestServer: true,
+	TypeAgent:           true,
+}
+
+// DefaultProbe is one entry of a workspace's default probe bundle.
+type DefaultProbe struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	WorkspaceID uint           `gorm:"index;not null" json:"workspace_id"`
+	Position    int            `gorm:"not null" json:"position"`
+	Type        Type           `gorm:"type:VARCHAR(64);not null" json:"type"`
+	Enabled     bool           `gorm:"not null" json:"enabled"`
+	IntervalSec int            `json:"interval_sec"`
+	TimeoutSec  int            `json:"timeout_sec"`
+	Count       int            `json:"count,omitempty"`
+	DurationSec int            `json:"duration_sec,omitempty"`
+	DSCP        int            `json:"dscp,omitempty"`
+	Targets     datatypes.JSON `gorm:"type:jsonb" json:"targets"` // []string
+	Labels      datatypes.JSON `gorm:"type:jsonb" json:"labels,omitempty"`
+	Metadata    datatypes.JSON `gorm:"type:jsonb" json:"metadata,omitempty"`
+	UpdatedBy   uint           `json:"updated_by"`
+}
+
+func (DefaultProbe) TableName() string { return "workspace_default_probes" }
+
+// DefaultProbeInput is one bundle entry in a PUT body.
+type DefaultProbeInput struct {
+	Type        Type           `json:"type"`
+	Enabled     *bool          `json:"enabled"`
+	IntervalSec int            `json:"interval_sec"`
+	TimeoutSec  int            `json:"timeout_sec"`
+	Count       int            `json:"count"`
+	DurationSec int            `json:"duration_sec"`
+	DSCP        int            `json:"dscp"`
+	Targets     []string       `json:"targets"`
+	Labels      map[string]any `json:"labels"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+// toRow validates an entry and converts it to a row.
+func (in DefaultProbeInput) toRow(workspaceID uint, pos int) (DefaultProbe, error) {
+	typ := Type(strings.ToUpper(strings.TrimSpace(string(in.Type))))
+	if typ == "" {
+		return DefaultProbe{}, fmt.Errorf("%w: entry %d: type required", ErrBadInput, pos)
+	}
+	if bundleExcludedTypes[typ] {
+		return DefaultProbe{}, fmt.Errorf("%w: entry %d: %s probes can't be in the default bundle", ErrBadInput, pos, typ)
+	}
+	if !typ.Valid() {
+		return DefaultProbe{}, fmt.Errorf("%w: entry %d: unknown probe type %q", ErrBadInput, pos, in.Type)
+	}
+	if in.IntervalSec < 0 || in.TimeoutSec < 0 || in.Count < 0 || in.DurationSec < 0 {
+		return DefaultProbe{}, fmt.Errorf("%w: entry %d: negative interval/timeout/count/duration", ErrBadInput, pos)
+	}
+	if err := validateDSCP(typ, in.DSCP); err != nil {
+		return DefaultProbe{}, fmt.Errorf("entry %d: %w", pos, err)
+	}
+	targets := make([]string, 0, len(in.Targets))
+	for _, t := range in.Targets {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !validateTargetForType(t, typ) {
+			return DefaultProbe{}, fmt.Errorf("%w: entry %d: %q", ErrTargetFormat, pos, t)
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return DefaultProbe{}, fmt.Errorf("%w: entry %d: at least one target required", ErrBadInput, pos)
+	}
+	meta := bundleJSON(in.Metadata)
+	if err := validateProbeMetadata(meta); err != nil {
+		return DefaultProbe{}, fmt.Errorf("entry %d: %w", pos, err)
+	}
+	rawTargets, _ := json.Marshal(targets)
+	return DefaultProbe{
+		WorkspaceID: workspaceID,
+		Position:    pos,
+		Type:        typ,
+		Enabled:     boolOr(in.Enabled, true),
+		IntervalSec: ifZero(in.IntervalSec, 60),
+		TimeoutSec:  ifZero(in.TimeoutSec, 10),
+		Count:       in.Count,
+		DurationSec: in.DurationSec,
+		DSCP:        in.DSCP,
+		Targets:     rawTargets,
+		Labels:      bundleJSON(in.Labels),
+		Metadata:    meta,
+	}, nil
+}
+
+func bundleJSON(m map[string]any) datatypes.JSON {
+	if len(m) == 0 {
+		return datatypes.JSON(`{}`)
+	}
+	b, _ := json.Marshal(m)
+	return b
+}
+
+// GetDefaultProbeBundle returns a workspace's bundle in creation order.
+func GetDefaultProbeBundle(ctx context.Context, db *gorm.DB, workspaceID uint) ([]DefaultProbe, error) {
+	var rows []DefaultProbe
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("position, id").Find(&rows).Error
+	return rows, err
+}
+
+// SetDefaultProbeBundle replaces a workspace's bundle. Existing agents are
+// not changed.
+func SetDefaultProbeBundle(ctx context.Context, db *gorm.DB, workspaceID, userID uint, in []DefaultProbeInput) ([]DefaultProbe, error) {
+	if len(in) > maxDefaultProbes {
+		return nil, fmt.Errorf("%w: at most %d default probes", ErrBadInput, maxDefaultProbes)
+	}
+	rows := make([]DefaultProbe, 0, len(in))
+	for i, e := range in {
+		row, err := e.toRow(workspaceID, i)
+		if err != nil {
+			return nil, err
+		}
+		row.UpdatedBy = userID
+		rows = append(rows, row)
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&DefaultProbe{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ApplyDefaultProbeBundle creates the workspace's bundle on a new agent.
+// maxProbes is the per-agent probe limit (0 = unlimited); entries past it
+// are not created. Entries that fail (e.g. a type the agent can't run) are
+// skipped and reported in the joined error; the created probes are
+// returned either way.
+func ApplyDefaultProbeBundle(ctx context.Context, db *gorm.DB, workspaceID, agentID uint, maxProbes int) ([]Probe, error) {
+	bundle, err := GetDefaultProbeBundle(ctx, db, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	var created []Probe
+	var errs []error
+	for i, d := range bundle {
+		if maxProbes > 0 && i >= maxProbes {
+			errs = append(errs, fmt.Errorf("%d bundle entries skipped: agent probe limit is %d", len(bundle)-i, maxProbes))
+			break
+		}
+		var targets []string
+		_ = json.Unmarshal(d.Targets, &targets)
+		p, err := Create(ctx, db, CreateInput{
+			WorkspaceID: workspaceID,
+			AgentID:     agentID,
+			Type:        d.Type,
+			Enabled:     d.Enabled,
+			IntervalSec: d.IntervalSec,
+			TimeoutSec:  d.TimeoutSec,
+			Count:       d.Count,
+			DurationSec: d.DurationSec,
+			DSCP:        d.DSCP,
+			Targets:     targets,
+			Labels:      d.Labels,
+			Metadata:    d.Metadata,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %v: %w", d.Type, targets, err))
+			continue
+		}
+		// Enabled has a column default of true, so GORM skips false on insert.
+		if !d.Enabled {
+			if err := db.WithContext(ctx).Model(p).Update("enabled", false).Error; err != nil {
+				errs = append(errs, fmt.Errorf("%s %v: disable: %w", d.Type, targets, err))
+			}
+		}
+		created = append(created, *p)
+	}
+	if len(bundle) > 0 {
+		log.Infof("[agent %d] applied default probe bundle: %d/%d probes created", agentID, len(created), len(bundle))
+	}
+	return created, errors.Join(errs...)
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"netwatcher-controller/internal/agent"
+)
+
+func TestDefaultProbeBundleValidation(t *testing.T) {
+	for name, in := range map[string]DefaultProbeInput{
+		"virtual type": {Type: TypeNetInfo, Targets: []string{"ok"}},
+		"agent type":   {Type: TypeAgent, Targets: []string{"2"}},
+		"unknown type": {Type: "WEATHER", Targets: []string{"1.1.1.1"}},
+		"no targets":   {Type: TypePing, Targets: []string{" "}},
+		"bad dscp":     {Type: TypeMTR, DSCP: 46, Targets: []string{"1.1.1.1"}},
+	} {
+		if _, err := in.toRow(1, 0); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", name, err)
+		}
+	}
+
+	row, err := DefaultProbeInput{Type: "ping", Targets: []string{" 10.0.0.53 "}}.toRow(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Type != TypePing || !row.Enabled || row.IntervalSec != 60 || row.Position != 3 || string(row.Targets) != `["10.0.0.53"]` {
+		t.Errorf("row = %+v", row)
+	}
+}
+
+func TestApplyDefaultProbeBundle(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&DefaultProbe{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	mustCreateAgent(t, db, agent.Agent{ID: 1, WorkspaceID: 1, Name: "new"})
+
+	off := false
+	if _, err := SetDefaultProbeBundle(ctx, db, 1, 9, []DefaultProbeInput{
+		{Type: TypePing, Targets: []string{"10.0.0.53", "erp.example.com"}, IntervalSec: 30},
+		{Type: TypeMTR, Targets: []string{"erp.example.com"}, Enabled: &off},
+		{Type: TypeDNS, Targets: []string{"example.com"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := ApplyDefaultProbeBundle(ctx, db, 1, 1, 2)
+	if err == nil || !strings.Contains(err.Error(), "1 bundle entries skipped") {
+		t.Errorf("err = %v, want limit skip", err)
+	}
+	if len(created) != 2 || created[0].Type != TypePing || created[0].IntervalSec != 30 || created[1].Enabled {
+		t.Fatalf("created = %+v", created)
+	}
+
+	var targets []Target
+	db.Where("probe_id = ?", created[0].ID).Find(&targets)
+	if len(targets) != 2 {
+		t.Errorf("ping targets = %+v", targets)
+	}
+
+	// Replacing the bundle with an empty list clears it.
+	if _, err := SetDefaultProbeBundle(ctx, db, 1, 9, nil); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := GetDefaultProbeBundle(ctx, db, 1); len(list) != 0 {
+		t.Errorf("bundle = %+v, want empty", list)
+	}
+}
@@ -0,0 +1,200 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/logging"
+
+	"gorm.io/gorm"
+)
+
+// ── Destination Materializer ──
+//
+// Building a network map scans MTR, PING, TrafficSim and speedtest rows for
+// every agent in the workspace, which takes seconds on a busy workspace,
+// and the map panel polls it. The materializer rebuilds each active
+// workspace's map — nodes, edges and the per-destination summaries — once
+// per interval in the background and keeps the result in memory, so map
+// requests for the materialized lookback are answered from the latest
+// build. Other lookbacks, and workspaces whose build is missing or stale,
+// are computed live as before.
+
+// DestinationMaterializerConfig controls the background map builds.
+type DestinationMaterializerConfig struct {
+	Interval        time.Duration // rebuild period; 0 disables (default 1 minute)
+	LookbackMinutes int           // window materialized (default 15, the map panel's default)
+	MaxConcurrent   int           // workspaces built in parallel (default 2)
+}
+
+// LoadDestinationMaterializerConfig reads DEST_SUMMARY_INTERVAL (seconds),
+// DEST_SUMMARY_LOOKBACK (minutes) and DEST_SUMMARY_MAX_CONCURRENT.
+func LoadDestinationMaterializerConfig() DestinationMaterializerConfig {
+	cfg := DestinationMaterializerConfig{Interval: time.Minute, LookbackMinutes: 15, MaxConcurrent: 2}
+	if v := os.Getenv("DEST_SUMMARY_INTERVAL"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			cfg.Interval = time.Duration(n) * time.Second
+		}
+	}
+	if v := os.Getenv("DEST_SUMMARY_LOOKBACK"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.LookbackMinutes = n
+		}
+	}
+	if v := os.Getenv("DEST_SUMMARY_MAX_CONCURRENT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.MaxConcurrent = n
+		}
+	}
+	return cfg
+}
+
+// materializedMaps holds the latest build per workspace.
+type materializedMaps struct {
+	mu       sync.RWMutex
+	lookback int
+	maxAge   time.Duration
+	maps     map[uint]*NetworkMapData
+}
+
+var destinationStore = &materializedMaps{maps: make(map[uint]*NetworkMapData)}
+
+// configure sets the window served from the store; builds older than
+// maxAge are not served.
+func (s *materializedMaps) configure(lookback int, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookback, s.maxAge = lookback, maxAge
+}
+
+func (s *materializedMaps) put(m *NetworkMapData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maps[m.WorkspaceID] = m
+}
+
+// get returns the workspace's build when it covers lookback and is fresh
+// at now.
+func (s *materializedMaps) get(workspaceID uint, lookback int, now time.Time) (*NetworkMapData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.lookback == 0 || lookback != s.lookback {
+		return nil, false
+	}
+	m, ok := s.maps[workspaceID]
+	if !ok || now.Sub(m.GeneratedAt) > s.maxAge {
+		return nil, false
+	}
+	return m, true
+}
+
+// retain drops builds for workspaces not in ids.
+func (s *materializedMaps) retain(ids []uint) {
+	keep := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.maps {
+		if !keep[id] {
+			delete(s.maps, id)
+		}
+	}
+}
+
+// MaterializedNetworkMap returns the workspace's map for lookbackMinutes,
+// from the latest background build when there is a fresh one and computed
+// live otherwise. A materialized map is shared between callers and must not
+// be modified.
+func MaterializedNetworkMap(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, lookbackMinutes int) (*NetworkMapData, error) {
+	if m, ok := destinationStore.get(workspaceID, lookbackMinutes, time.Now().UTC()); ok {
+		return m, nil
+	}
+	return GetWorkspaceNetworkMap(ctx, ch, pg, workspaceID, lookbackMinutes)
+}
+
+// MaterializedDestinations returns the workspace's destination summaries
+// and when they were built, like MaterializedNetworkMap.
+func MaterializedDestinations(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, lookbackMinutes int) ([]DestinationSummary, time.Time, error) {
+	m, err := MaterializedNetworkMap(ctx, ch, pg, workspaceID, lookbackMinutes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if m.Destinations == nil {
+		return []DestinationSummary{}, m.GeneratedAt, nil
+	}
+	return m.Destinations, m.GeneratedAt, nil
+}
+
+// StartDestinationMaterializer rebuilds every active workspace's network map
+// once per interval until ctx is done. A cycle that overruns the interval
+// delays the next one rather than overlapping it.
+func StartDestinationMaterializer(ctx context.Context, ch *sql.DB, pg *gorm.DB, config DestinationMaterializerConfig) {
+	if config.Interval <= 0 {
+		mapLog.Info("[dest-materializer] disabled; network maps are computed per request")
+		return
+	}
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 1
+	}
+	mapLog.Infof("[dest-materializer] starting (interval: %s, lookback: %dm, max_concurrent: %d)",
+		config.Interval, config.LookbackMinutes, config.MaxConcurrent)
+
+	// Two missed cycles and requests fall back to live computation.
+	destinationStore.configure(config.LookbackMinutes, 2*config.Interval+config.Interval/2)
+	health.Register("dest_materializer", config.Interval, time.Minute)
+	defer health.Stop("dest_materializer")
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		runDestinationMaterialization(ctx, ch, pg, config)
+		health.Beat("dest_materializer")
+		select {
+		case <-ctx.Done():
+			mapLog.Info("[dest-materializer] shutting down")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runDestinationMaterialization(ctx context.Context, ch *sql.DB, pg *gorm.DB, config DestinationMaterializerConfig) {
+	start := time.Now()
+	ids, err := getActiveWorkspaceIDs(ctx, pg)
+	if err != nil {
+		mapLog.Warnf("[dest-materializer] failed to get workspace IDs: %v", err)
+		return
+	}
+	destinationStore.retain(ids)
+
+	sem := make(chan struct{}, config.MaxConcurrent)
+	var wg sync.WaitGroup
+	for _, wsID := range ids {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			m, err := GetWorkspaceNetworkMap(ctx, ch, pg, id, config.LookbackMinutes)
+			if err != nil {
+				// Keep serving the previous build until it goes stale.
+				mapLog.WithField(logging.FieldWorkspace, id).Warnf("[dest-materializer] build failed: %v", err)
+				return
+			}
+			destinationStore.put(m)
+		}(wsID)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	mapLog.WithField(logging.FieldDuration, elapsed.Milliseconds()).
+		Debugf("[dest-materializer] built %d workspace maps in %s", len(ids), elapsed.Round(time.Millisecond))
+}
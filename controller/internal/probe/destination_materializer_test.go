@@ -0,0 +1,37 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestMaterializedMapsFreshness verifies builds are only served for the
+// materialized lookback while fresh, and dropped for inactive workspaces.
+func TestMaterializedMapsFreshness(t *testing.T) {
+	s := &materializedMaps{maps: make(map[uint]*NetworkMapData)}
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.put(&NetworkMapData{WorkspaceID: 3, GeneratedAt: t0})
+
+	if _, ok := s.get(3, 15, t0); ok {
+		t.Fatal("unconfigured store served a build")
+	}
+	s.configure(15, 150*time.Second)
+
+	if m, ok := s.get(3, 15, t0.Add(time.Minute)); !ok || m.WorkspaceID != 3 {
+		t.Errorf("fresh build not served: %v, %v", m, ok)
+	}
+	if _, ok := s.get(3, 60, t0.Add(time.Minute)); ok {
+		t.Error("served a build for another lookback")
+	}
+	if _, ok := s.get(3, 15, t0.Add(3*time.Minute)); ok {
+		t.Error("served a stale build")
+	}
+	if _, ok := s.get(4, 15, t0); ok {
+		t.Error("served a workspace that was never built")
+	}
+
+	s.retain([]uint{4})
+	if _, ok := s.get(3, 15, t0); ok {
+		t.Error("build kept for an inactive workspace")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"database/sql"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -37,11 +36,11 @@ func initDns(ch *sql.DB, pg *gorm.DB) {
 		},
 		func(ctx context.Context, data ProbeData, p DNSPayload) error {
 			if err := SaveRecordWithAlertEval(ctx, ch, pg, data, string(TypeDNS), p); err != nil {
-				log.WithError(err).Error("save DNS record (CH)")
+				ingestEntry(data).WithError(err).Error("save DNS record (CH)")
 				return err
 			}
 
-			log.Printf("[dns] pid=%d server=%s type=%s target=%s rcode=%s time=%.2fms answers=%d",
+			ingestEntry(data).Infof("[dns] pid=%d server=%s type=%s target=%s rcode=%s time=%.2fms answers=%d",
 				data.ProbeID, p.DNSServer, p.RecordType, p.Target, p.ResponseCode, p.QueryTimeMs, len(p.Answers))
 			return nil
 		},
@@ -0,0 +1,396 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── DSCP / QoS Marking ──────────────────────────────────────────────────────
+//
+// PING and TRAFFICSIM probes carry a DSCP codepoint (Probe.DSCP) that the
+// agent sets on outgoing packets. Results are stored with the marking the
+// agent reports (ProbeData.DSCP, or TrafficSim's dscpValue) in the
+// probe_data.dscp column, so running the same path under two classes —
+// e.g. one probe at EF (46) and one unmarked — lets analysis compare them.
+// A marked class doing materially worse than best effort on the same path
+// means something along it is de-prioritizing (or policing) that marking.
+//
+// TrafficSim agents historically read metadata.trafficsim.dscp; the column
+// and that key are kept in sync at delivery time.
+
+const maxDSCP = 63
+
+// DSCP de-prioritization thresholds, marked class vs best effort on the
+// same agent→host path and probe type.
+const (
+	dscpMinSamples      = 5
+	dscpLossDeltaPct    = 1.0  // percentage points
+	dscpLatencyRatio    = 1.3  // × best-effort average RTT
+	dscpLatencyMinDelta = 5.0  // ms
+	dscpCriticalLossPct = 10.0 // loss delta that makes it critical
+)
+
+// dscpClassNames maps common codepoints to their PHB names.
+var dscpClassNames = map[int]string{
+	0: "BE", 8: "CS1", 10: "AF11", 12: "AF12", 14: "AF13",
+	16: "CS2", 18: "AF21", 20: "AF22", 22: "AF23",
+	24: "CS3", 26: "AF31", 28: "AF32", 30: "AF33",
+	32: "CS4", 34: "AF41", 36: "AF42", 38: "AF43",
+	40: "CS5", 44: "VOICE-ADMIT", 46: "EF", 48: "CS6", 56: "CS7",
+}
+
+// DSCPClassName returns the PHB name for a codepoint, or "DSCP n".
+func DSCPClassName(v int) string {
+	if name, ok := dscpClassNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("DSCP %d", v)
+}
+
+// validateDSCP checks the codepoint range and that the probe type can
+// mark packets. AGENT probes pass it on to their PING/TRAFFICSIM children.
+func validateDSCP(probeType Type, v int) error {
+	if v == 0 {
+		return nil
+	}
+	if v < 0 || v > maxDSCP {
+		return fmt.Errorf("%w: dscp must be 0-%d", ErrBadInput, maxDSCP)
+	}
+	switch probeType {
+	case TypePing, TypeTrafficSim, TypeAgent:
+		return nil
+	}
+	return fmt.Errorf("%w: dscp is only supported on PING, TRAFFICSIM and AGENT probes", ErrBadInput)
+}
+
+// metadataDSCP reads the legacy metadata.trafficsim.dscp value.
+func metadataDSCP(md datatypes.JSON) int {
+	if len(md) == 0 {
+		return 0
+	}
+	var m struct {
+		TrafficSim struct {
+			DSCP float64 `json:"dscp"`
+		} `json:"trafficsim"`
+	}
+	if err := json.Unmarshal(md, &m); err != nil {
+		return 0
+	}
+	if v := int(m.TrafficSim.DSCP); v > 0 && v <= maxDSCP {
+		return v
+	}
+	return 0
+}
+
+// expandedProbeDSCP is the marking an AGENT probe's child of probeType
+// runs with. MTR is never marked.
+func expandedProbeDSCP(source *Probe, probeType Type) int {
+	if probeType != TypePing && probeType != TypeTrafficSim {
+		return 0
+	}
+	if source.DSCP > 0 {
+		return source.DSCP
+	}
+	if probeType == TypeTrafficSim {
+		return metadataDSCP(source.Metadata)
+	}
+	return 0
+}
+
+// applyDeliveredDSCP reconciles Probe.DSCP with metadata.trafficsim.dscp
+// on a probe about to be sent to an agent, so both old and new agents see
+// the same marking. Probes of other types are left unchanged.
+func applyDeliveredDSCP(p *Probe) {
+	if p.Type != TypeTrafficSim {
+		return
+	}
+	legacy := metadataDSCP(p.Metadata)
+	switch {
+	case p.DSCP == 0:
+		p.DSCP = legacy
+	case legacy != p.DSCP:
+		var md map[string]any
+		if len(p.Metadata) > 0 {
+			if err := json.Unmarshal(p.Metadata, &md); err != nil {
+				md = nil
+			}
+		}
+		if md == nil {
+			md = make(map[string]any)
+		}
+		ts, ok := md["trafficsim"].(map[string]any)
+		if !ok {
+			ts = make(map[string]any)
+		}
+		ts["dscp"] = p.DSCP
+		md["trafficsim"] = ts
+		if b, err := json.Marshal(md); err == nil {
+			p.Metadata = datatypes.JSON(b)
+		}
+	}
+}
+
+// ── Per-class comparison ──
+
+// dscpClassRow is one (agent, target, type, dscp) aggregate.
+type dscpClassRow struct {
+	agentID   uint
+	target    string
+	probeType string
+	dscp      int
+	samples   int
+	latencyMs float64
+	lossPct   float64
+}
+
+// DSCPClassStats is one marking's aggregate on a path.
+type DSCPClassStats struct {
+	DSCP      int     `json:"dscp"`
+	Class     string  `json:"class"`
+	LatencyMs float64 `json:"latency_ms"`
+	LossPct   float64 `json:"loss_pct"`
+	Samples   int     `json:"samples"`
+}
+
+// DSCPPathComparison compares classes on one agent→host path.
+type DSCPPathComparison struct {
+	AgentID       uint             `json:"agent_id"`
+	AgentName     string           `json:"agent_name,omitempty"`
+	Host          string           `json:"host"`
+	ProbeType     string           `json:"probe_type"`
+	Classes       []DSCPClassStats `json:"classes"`                 // sorted by DSCP; BE first when present
+	Deprioritized []string         `json:"deprioritized,omitempty"` // classes worse than BE
+}
+
+// WorkspaceDSCPComparison is the /analysis/dscp payload.
+type WorkspaceDSCPComparison struct {
+	WorkspaceID     uint                 `json:"workspace_id"`
+	LookbackMinutes int                  `json:"lookback_minutes"`
+	Paths           []DSCPPathComparison `json:"paths"`
+	GeneratedAt     time.Time            `json:"generated_at"`
+}
+
+// compareDSCPClasses groups rows by agent, host and probe type and
+// returns every path measured under more than one marking. Ports are
+// folded into the host so TrafficSim port sets still compare.
+func compareDSCPClasses(rows []dscpClassRow) []DSCPPathComparison {
+	type pathKey struct {
+		agent uint
+		host  string
+		typ   string
+	}
+	type accum struct{ samples, lat, loss float64 }
+	groups := make(map[pathKey]map[int]*accum)
+	for _, r := range rows {
+		if r.samples <= 0 {
+			continue
+		}
+		k := pathKey{r.agentID, stripPort(r.target), r.probeType}
+		if groups[k] == nil {
+			groups[k] = make(map[int]*accum)
+		}
+		a := groups[k][r.dscp]
+		if a == nil {
+			a = &accum{}
+			groups[k][r.dscp] = a
+		}
+		w := float64(r.samples)
+		a.samples += w
+		a.lat += r.latencyMs * w
+		a.loss += r.lossPct * w
+	}
+
+	var out []DSCPPathComparison
+	for k, classes := range groups {
+		if len(classes) < 2 {
+			continue
+		}
+		cmp := DSCPPathComparison{AgentID: k.agent, Host: k.host, ProbeType: k.typ}
+		for dscp, a := range classes {
+			cmp.Classes = append(cmp.Classes, DSCPClassStats{
+				DSCP:      dscp,
+				Class:     DSCPClassName(dscp),
+				LatencyMs: roundTo(a.lat/a.samples, 2),
+				LossPct:   roundTo(a.loss/a.samples, 3),
+				Samples:   int(a.samples),
+			})
+		}
+		sort.Slice(cmp.Classes, func(i, j int) bool { return cmp.Classes[i].DSCP < cmp.Classes[j].DSCP })
+
+		if be := cmp.Classes[0]; be.DSCP == 0 && be.Samples >= dscpMinSamples {
+			for _, c := range cmp.Classes[1:] {
+				if c.Samples >= dscpMinSamples && dscpWorseThan(c, be) {
+					cmp.Deprioritized = append(cmp.Deprioritized, c.Class)
+				}
+			}
+		}
+		out = append(out, cmp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AgentID != out[j].AgentID {
+			return out[i].AgentID < out[j].AgentID
+		}
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].ProbeType < out[j].ProbeType
+	})
+	return out
+}
+
+// dscpWorseThan reports whether a marked class is materially worse than
+// best effort.
+func dscpWorseThan(marked, be DSCPClassStats) bool {
+	if marked.LossPct-be.LossPct >= dscpLossDeltaPct {
+		return true
+	}
+	return be.LatencyMs > 0 &&
+		marked.LatencyMs >= be.LatencyMs*dscpLatencyRatio &&
+		marked.LatencyMs-be.LatencyMs >= dscpLatencyMinDelta
+}
+
+// getDSCPClassRows aggregates PING and TRAFFICSIM results per agent,
+// target, type and DSCP marking.
+func getDSCPClassRows(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) ([]dscpClassRow, error) {
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT
+    agent_id,
+    target,
+    type,
+    dscp,
+    count() AS samples,
+    avg(if(type = 'PING', %s / 1000000.0, JSONExtractFloat(payload_raw, 'averageRTT'))) AS lat,
+    avg(if(type = 'PING', %s, JSONExtractFloat(payload_raw, 'lossPercentage'))) AS loss
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND agent_id IN (%s)
+  AND created_at >= %s%s
+  AND target != ''
+GROUP BY agent_id, target, type, dscp
+`, pingAvgRttNsSQL, pingLossSQL, strings.Join(ids, ", "), chQuoteTime(from), asOfBound(ctx))
+
+	rs, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	var out []dscpClassRow
+	for rs.Next() {
+		var agentID, n uint64
+		var dscp uint8
+		var target, typ string
+		var lat, loss sql.NullFloat64
+		if err := rs.Scan(&agentID, &target, &typ, &dscp, &n, &lat, &loss); err != nil {
+			return nil, err
+		}
+		out = append(out, dscpClassRow{
+			agentID:   uint(agentID),
+			target:    target,
+			probeType: typ,
+			dscp:      int(dscp),
+			samples:   int(n),
+			latencyMs: sanitizeFloat(lat.Float64),
+			lossPct:   sanitizeFloat(loss.Float64),
+		})
+	}
+	return out, rs.Err()
+}
+
+// ComputeWorkspaceDSCPComparison returns every path in the workspace
+// measured under more than one DSCP class.
+func ComputeWorkspaceDSCPComparison(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, lookbackMinutes int) (*WorkspaceDSCPComparison, error) {
+	if lookbackMinutes <= 0 {
+		lookbackMinutes = 60
+	}
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	out := &WorkspaceDSCPComparison{
+		WorkspaceID:     workspaceID,
+		LookbackMinutes: lookbackMinutes,
+		Paths:           []DSCPPathComparison{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	if len(agents) == 0 {
+		return out, nil
+	}
+	ids := make([]uint, len(agents))
+	names := make(map[uint]string, len(agents))
+	for i, a := range agents {
+		ids[i] = a.ID
+		names[a.ID] = a.Name
+	}
+	rows, err := getDSCPClassRows(ctx, ch, ids, out.GeneratedAt.Add(-time.Duration(lookbackMinutes)*time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("dscp query: %w", err)
+	}
+	for _, p := range compareDSCPClasses(rows) {
+		p.AgentName = names[p.AgentID]
+		out.Paths = append(out.Paths, p)
+	}
+	return out, nil
+}
+
+// detectDSCPIncidents raises an incident for each path where a marked
+// class does worse than best effort.
+func detectDSCPIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time, agentByID map[uint]agentInfo) []DetectedIncident {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	rows, err := getDSCPClassRows(ctx, ch, agentIDs, from)
+	if err != nil {
+		return nil
+	}
+
+	var incidents []DetectedIncident
+	for _, p := range compareDSCPClasses(rows) {
+		if len(p.Deprioritized) == 0 {
+			continue
+		}
+		agentName := fmt.Sprintf("%d", p.AgentID)
+		if a, ok := agentByID[p.AgentID]; ok {
+			agentName = a.Name
+		}
+		be := p.Classes[0]
+		severity := "warning"
+		evidence := []string{fmt.Sprintf("BE: %.2f%% loss, %.1fms avg RTT (%d samples)", be.LossPct, be.LatencyMs, be.Samples)}
+		for _, c := range p.Classes[1:] {
+			evidence = append(evidence, fmt.Sprintf("%s: %.2f%% loss, %.1fms avg RTT (%d samples)", c.Class, c.LossPct, c.LatencyMs, c.Samples))
+			if c.LossPct-be.LossPct >= dscpCriticalLossPct {
+				severity = "critical"
+			}
+		}
+		incidents = append(incidents, DetectedIncident{
+			ID:              fmt.Sprintf("dscp_deprioritized_%d_%s_%s", p.AgentID, sanitizeKey(p.Host), strings.ToLower(p.ProbeType)),
+			Title:           fmt.Sprintf("%s traffic de-prioritized from %s to %s", strings.Join(p.Deprioritized, ", "), agentName, p.Host),
+			Severity:        severity,
+			Scope:           "target-specific",
+			SuggestedCause:  "Marked traffic performs worse than unmarked traffic on the same path — an ISP or middlebox is likely re-marking, policing, or queueing the class below best effort",
+			AffectedAgents:  []string{agentName},
+			AffectedTargets: []string{p.Host},
+			Evidence:        evidence,
+			Recommendations: []string{
+				"Check whether the ISP honours or bleaches DSCP markings at the handoff",
+				"Review QoS policy and policer rates for the affected class on edge devices",
+			},
+			Confidence:      math.Min(0.9, 0.5+float64(be.Samples)/200),
+			MatchedCriteria: fmt.Sprintf("marked class loss +%.0fpp or RTT ×%.1f vs BE", dscpLossDeltaPct, dscpLatencyRatio),
+		})
+	}
+	return incidents
+}
@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+// TestValidateDSCP verifies range and probe-type gating.
+func TestValidateDSCP(t *testing.T) {
+	if err := validateDSCP(TypePing, 46); err != nil {
+		t.Errorf("PING EF rejected: %v", err)
+	}
+	if err := validateDSCP(TypeMTR, 0); err != nil {
+		t.Errorf("unmarked MTR rejected: %v", err)
+	}
+	if err := validateDSCP(TypeMTR, 46); err == nil {
+		t.Error("MTR with DSCP should be rejected")
+	}
+	if err := validateDSCP(TypeTrafficSim, 64); err == nil {
+		t.Error("DSCP 64 should be rejected")
+	}
+}
+
+// TestApplyDeliveredDSCP verifies the column and the legacy
+// metadata.trafficsim.dscp key are reconciled for TrafficSim agents.
+func TestApplyDeliveredDSCP(t *testing.T) {
+	legacy := Probe{Type: TypeTrafficSim, Metadata: datatypes.JSON(`{"trafficsim":{"dscp":46,"voip_mode":true}}`)}
+	applyDeliveredDSCP(&legacy)
+	if legacy.DSCP != 46 {
+		t.Errorf("DSCP from metadata = %d, want 46", legacy.DSCP)
+	}
+
+	column := Probe{Type: TypeTrafficSim, DSCP: 34, Metadata: datatypes.JSON(`{"trafficsim":{"voip_mode":true}}`)}
+	applyDeliveredDSCP(&column)
+	if got := metadataDSCP(column.Metadata); got != 34 {
+		t.Errorf("metadata dscp = %d, want 34", got)
+	}
+	if m := decodeMD(t, column); m["trafficsim"].(map[string]any)["voip_mode"] != true {
+		t.Errorf("existing trafficsim metadata clobbered: %v", m)
+	}
+
+	agentProbe := &Probe{Type: TypeAgent, DSCP: 46}
+	if got := expandedProbeDSCP(agentProbe, TypeMTR); got != 0 {
+		t.Errorf("MTR child DSCP = %d, want 0", got)
+	}
+	if got := expandedProbeDSCP(agentProbe, TypePing); got != 46 {
+		t.Errorf("PING child DSCP = %d, want 46", got)
+	}
+}
+
+// TestCompareDSCPClasses verifies an EF class losing more than BE on the
+// same path is flagged, ports are folded into the host, and single-class
+// paths are omitted.
+func TestCompareDSCPClasses(t *testing.T) {
+	rows := []dscpClassRow{
+		{agentID: 1, target: "10.0.0.5:5000", probeType: "TRAFFICSIM", dscp: 0, samples: 20, latencyMs: 20, lossPct: 0.1},
+		{agentID: 1, target: "10.0.0.5:5001", probeType: "TRAFFICSIM", dscp: 46, samples: 20, latencyMs: 22, lossPct: 4},
+		{agentID: 1, target: "10.0.0.6", probeType: "PING", dscp: 0, samples: 20, latencyMs: 30, lossPct: 0},
+		{agentID: 1, target: "10.0.0.6", probeType: "PING", dscp: 46, samples: 20, latencyMs: 29, lossPct: 0},
+		{agentID: 2, target: "10.0.0.7", probeType: "PING", dscp: 0, samples: 20, latencyMs: 30, lossPct: 0},
+	}
+	got := compareDSCPClasses(rows)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 multi-class paths, got %+v", got)
+	}
+	if got[0].Host != "10.0.0.5" || len(got[0].Deprioritized) != 1 || got[0].Deprioritized[0] != "EF" {
+		t.Errorf("trafficsim path = %+v, want EF deprioritized", got[0])
+	}
+	if len(got[1].Deprioritized) != 0 {
+		t.Errorf("healthy EF path flagged: %+v", got[1])
+	}
+}
@@ -0,0 +1,420 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/logging"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Duplicate Probes ──
+//
+// Two probes with the same agent, type and targets measure the same thing
+// twice and double the data. Create rejects them with a
+// *DuplicateProbeError naming the existing probe (callers can opt in with
+// AllowDuplicate). FindDuplicateProbeGroups lists the duplicates that
+// already exist, with each probe's stored history, and MergeDuplicateProbes
+// folds them into one: the history the kept probe lacks (results older
+// than its first one) is moved over, alert rules are re-pointed, and the
+// rest are deleted.
+
+// DuplicateProbeError is returned by Create when the agent already runs a
+// probe of the same type on one of the targets. It matches ErrDuplicate.
+type DuplicateProbeError struct {
+	ExistingProbeID uint     `json:"existing_probe_id"`
+	AgentID         uint     `json:"agent_id"`
+	Type            Type     `json:"type"`
+	Targets         []string `json:"targets"`
+}
+
+func (e *DuplicateProbeError) Error() string {
+	return fmt.Sprintf("%s: probe with same type and target already exists on agent %d (probe ID: %d)",
+		ErrDuplicate, e.AgentID, e.ExistingProbeID)
+}
+
+func (e *DuplicateProbeError) Unwrap() error { return ErrDuplicate }
+
+// FindDuplicate returns the existing probe a CreateInput would duplicate,
+// or nil.
+func FindDuplicate(ctx context.Context, db *gorm.DB, in CreateInput) (*DuplicateProbeError, error) {
+	err := checkDuplicateProbe(ctx, db, in)
+	var dup *DuplicateProbeError
+	if errors.As(err, &dup) {
+		return dup, nil
+	}
+	return nil, err
+}
+
+// duplicateTargetKey normalizes a literal target for duplicate checks:
+// the type's normalization, then trimmed and lowercased.
+func duplicateTargetKey(t string, typ Type) string {
+	return strings.ToLower(strings.TrimSpace(normalizeProbeTarget(strings.TrimSpace(t), typ)))
+}
+
+func probeTargetStrings(p Probe) []string {
+	out := make([]string, 0, len(p.Targets))
+	for _, t := range p.Targets {
+		if t.AgentID != nil {
+			out = append(out, "agent:"+strconv.FormatUint(uint64(*t.AgentID), 10))
+		} else if t.Target != "" {
+			out = append(out, t.Target)
+		}
+	}
+	return out
+}
+
+// duplicateSignature identifies probes that measure the same thing: type,
+// sorted target keys, and the resolver for DNS probes.
+func duplicateSignature(p Probe) string {
+	keys := make([]string, 0, len(p.Targets))
+	for _, t := range p.Targets {
+		if t.AgentID != nil {
+			keys = append(keys, "agent:"+strconv.FormatUint(uint64(*t.AgentID), 10))
+		} else if t.Target != "" {
+			keys = append(keys, duplicateTargetKey(t.Target, p.Type))
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	sig := string(p.Type) + "|" + strings.Join(keys, ",")
+	if p.Type == TypeDNS && len(p.Metadata) > 0 {
+		var meta map[string]any
+		if json.Unmarshal(p.Metadata, &meta) == nil {
+			if srv, ok := meta["dns_server"].(string); ok {
+				sig += "|" + srv
+			}
+		}
+	}
+	return sig
+}
+
+// DuplicateProbeHistory is one probe of a duplicate group with its stored
+// results.
+type DuplicateProbeHistory struct {
+	ProbeID   uint       `json:"probe_id"`
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	Samples   uint64     `json:"samples"`
+	FirstAt   *time.Time `json:"first_at,omitempty"`
+	LastAt    *time.Time `json:"last_at,omitempty"`
+}
+
+// DuplicateProbeGroup is a set of probes on one agent with the same type
+// and targets. KeepProbeID is the suggested survivor: the probe with the
+// longest history (earliest stored result, then lowest ID).
+type DuplicateProbeGroup struct {
+	WorkspaceID uint                    `json:"workspace_id"`
+	AgentID     uint                    `json:"agent_id"`
+	AgentName   string                  `json:"agent_name"`
+	Type        Type                    `json:"type"`
+	Targets     []string                `json:"targets"`
+	Probes      []DuplicateProbeHistory `json:"probes"`
+	KeepProbeID uint                    `json:"keep_probe_id"`
+}
+
+// FindDuplicateProbeGroups lists duplicate probe groups in a workspace, or
+// across all workspaces when workspaceID is 0. ch may be nil, in which
+// case history is left empty and the oldest probe is suggested.
+func FindDuplicateProbeGroups(ctx context.Context, db *gorm.DB, ch *sql.DB, workspaceID uint) ([]DuplicateProbeGroup, error) {
+	q := db.WithContext(ctx).Preload("Targets").Order("id")
+	if workspaceID != 0 {
+		q = q.Where("workspace_id = ?", workspaceID)
+	}
+	var probes []Probe
+	if err := q.Find(&probes).Error; err != nil {
+		return nil, err
+	}
+
+	type groupKey struct {
+		agentID uint
+		sig     string
+	}
+	bySig := make(map[groupKey][]Probe)
+	var order []groupKey
+	for _, p := range probes {
+		sig := duplicateSignature(p)
+		if sig == "" {
+			continue
+		}
+		k := groupKey{p.AgentID, sig}
+		if _, ok := bySig[k]; !ok {
+			order = append(order, k)
+		}
+		bySig[k] = append(bySig[k], p)
+	}
+
+	var groups []DuplicateProbeGroup
+	var ids []uint
+	for _, k := range order {
+		ps := bySig[k]
+		if len(ps) < 2 {
+			continue
+		}
+		g := DuplicateProbeGroup{
+			WorkspaceID: ps[0].WorkspaceID,
+			AgentID:     ps[0].AgentID,
+			Type:        ps[0].Type,
+			Targets:     probeTargetStrings(ps[0]),
+		}
+		for _, p := range ps {
+			g.Probes = append(g.Probes, DuplicateProbeHistory{ProbeID: p.ID, Enabled: p.Enabled, CreatedAt: p.CreatedAt})
+			ids = append(ids, p.ID)
+		}
+		groups = append(groups, g)
+	}
+	if len(groups) == 0 {
+		return []DuplicateProbeGroup{}, nil
+	}
+
+	history := map[uint]storedProbeSummary{}
+	if ch != nil {
+		var err error
+		if history, err = probeHistorySummaries(ctx, ch, ids); err != nil {
+			return nil, fmt.Errorf("probe history: %w", err)
+		}
+	}
+	agentIDs := make([]uint, 0, len(groups))
+	for _, g := range groups {
+		agentIDs = append(agentIDs, g.AgentID)
+	}
+	names := make(map[uint]string)
+	var agents []struct {
+		ID   uint
+		Name string
+	}
+	if err := db.WithContext(ctx).Table("agents").Select("id, name").Where("id IN ?", agentIDs).Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range agents {
+		names[a.ID] = a.Name
+	}
+
+	for i := range groups {
+		g := &groups[i]
+		g.AgentName = names[g.AgentID]
+		for j := range g.Probes {
+			if h, ok := history[g.Probes[j].ProbeID]; ok && h.Count > 0 {
+				first, last := h.FirstAt, h.LastAt
+				g.Probes[j].Samples, g.Probes[j].FirstAt, g.Probes[j].LastAt = h.Count, &first, &last
+			}
+		}
+		g.KeepProbeID = suggestKeepProbe(g.Probes)
+	}
+	return groups, nil
+}
+
+// suggestKeepProbe picks the probe with the earliest stored result; probes
+// without history come last, and ties go to the lowest ID.
+func suggestKeepProbe(ps []DuplicateProbeHistory) uint {
+	best := ps[0]
+	for _, p := range ps[1:] {
+		switch {
+		case p.FirstAt != nil && (best.FirstAt == nil || p.FirstAt.Before(*best.FirstAt)):
+			best = p
+		case (p.FirstAt == nil) == (best.FirstAt == nil) &&
+			(p.FirstAt == nil || p.FirstAt.Equal(*best.FirstAt)) && p.ProbeID < best.ProbeID:
+			best = p
+		}
+	}
+	return best.ProbeID
+}
+
+// probeHistorySummaries returns the stored result count and range of
+// each probe.
+func probeHistorySummaries(ctx context.Context, ch *sql.DB, probeIDs []uint) (map[uint]storedProbeSummary, error) {
+	out := make(map[uint]storedProbeSummary)
+	if len(probeIDs) == 0 {
+		return out, nil
+	}
+	ids := make([]string, len(probeIDs))
+	for i, id := range probeIDs {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	rows, err := ch.QueryContext(ctx, fmt.Sprintf(`
+SELECT probe_id, count(*), min(created_at), max(created_at)
+FROM probe_data
+WHERE probe_id IN (%s)
+GROUP BY probe_id
+`, strings.Join(ids, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, n uint64
+		var first, last time.Time
+		if err := rows.Scan(&id, &n, &first, &last); err != nil {
+			return nil, err
+		}
+		out[uint(id)] = storedProbeSummary{Count: n, FirstAt: first.UTC(), LastAt: last.UTC()}
+	}
+	return out, rows.Err()
+}
+
+// MergeProbesInput names a duplicate group to fold into one probe.
+type MergeProbesInput struct {
+	KeepProbeID       uint   `json:"keep_probe_id"`
+	DuplicateProbeIDs []uint `json:"duplicate_probe_ids"`
+	DryRun            bool   `json:"dry_run"`
+}
+
+// MergeProbesResult is one duplicate's part in a merge.
+type MergeProbesResult struct {
+	ProbeID uint `json:"probe_id"`
+	// HistoryMoved counts results older than anything the kept probe had,
+	// which are moved to it. The rest overlap the kept probe's own
+	// results and are deleted with the duplicate.
+	HistoryMoved uint64 `json:"history_moved"`
+	HistoryFrom  string `json:"history_from,omitempty"`
+	AlertRules   int64  `json:"alert_rules_moved"`
+}
+
+// MergeProbesReport describes what a merge did (or would do).
+type MergeProbesReport struct {
+	KeepProbeID uint                `json:"keep_probe_id"`
+	DryRun      bool                `json:"dry_run"`
+	Merged      []MergeProbesResult `json:"merged"`
+}
+
+// MergeDuplicateProbes folds duplicates into the kept probe. All probes
+// must be live, on the same agent and share type and targets. ch may be
+// nil when no telemetry store is configured; history then stays with the
+// deleted duplicates until the deletion worker removes it.
+func MergeDuplicateProbes(ctx context.Context, db *gorm.DB, ch *sql.DB, deletionStore *deletion.QueueStore, in MergeProbesInput) (*MergeProbesReport, error) {
+	if in.KeepProbeID == 0 || len(in.DuplicateProbeIDs) == 0 {
+		return nil, fmt.Errorf("%w: keep_probe_id and duplicate_probe_ids required", ErrBadInput)
+	}
+	keep, err := GetByID(ctx, db, in.KeepProbeID)
+	if err != nil {
+		return nil, err
+	}
+	sig := duplicateSignature(*keep)
+	dups := make([]*Probe, 0, len(in.DuplicateProbeIDs))
+	for _, id := range in.DuplicateProbeIDs {
+		if id == keep.ID {
+			return nil, fmt.Errorf("%w: probe %d is both kept and merged", ErrBadInput, id)
+		}
+		d, err := GetByID(ctx, db, id)
+		if err != nil {
+			return nil, err
+		}
+		if d.AgentID != keep.AgentID || duplicateSignature(*d) != sig {
+			return nil, fmt.Errorf("%w: probe %d is not a duplicate of probe %d", ErrBadInput, id, keep.ID)
+		}
+		dups = append(dups, d)
+	}
+
+	history := map[uint]storedProbeSummary{}
+	if ch != nil {
+		ids := append([]uint{keep.ID}, in.DuplicateProbeIDs...)
+		if history, err = probeHistorySummaries(ctx, ch, ids); err != nil {
+			return nil, fmt.Errorf("probe history: %w", err)
+		}
+	}
+	// Oldest history first, so each duplicate only contributes results
+	// older than everything already kept.
+	sort.SliceStable(dups, func(i, j int) bool {
+		hi, hj := history[dups[i].ID], history[dups[j].ID]
+		if hi.Count == 0 || hj.Count == 0 {
+			return hi.Count > hj.Count
+		}
+		return hi.FirstAt.Before(hj.FirstAt)
+	})
+
+	rep := &MergeProbesReport{KeepProbeID: keep.ID, DryRun: in.DryRun, Merged: []MergeProbesResult{}}
+	keptFrom := history[keep.ID].FirstAt
+	if history[keep.ID].Count == 0 {
+		keptFrom = time.Time{}
+	}
+	for _, d := range dups {
+		res := MergeProbesResult{ProbeID: d.ID}
+		if h := history[d.ID]; h.Count > 0 && (keptFrom.IsZero() || h.FirstAt.Before(keptFrom)) {
+			n, err := countProbeHistoryBefore(ctx, ch, d.ID, keptFrom)
+			if err != nil {
+				return nil, fmt.Errorf("probe %d history: %w", d.ID, err)
+			}
+			res.HistoryMoved = n
+			res.HistoryFrom = h.FirstAt.Format(time.RFC3339)
+			if !in.DryRun && n > 0 {
+				if err := moveProbeHistory(ctx, ch, d.ID, keep.ID, keptFrom); err != nil {
+					return nil, fmt.Errorf("move probe %d history: %w", d.ID, err)
+				}
+			}
+			keptFrom = h.FirstAt
+		}
+
+		if !in.DryRun {
+			err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				moved := tx.Table("alert_rules").Where("probe_id = ?", d.ID).Update("probe_id", keep.ID)
+				if moved.Error != nil {
+					return moved.Error
+				}
+				res.AlertRules = moved.RowsAffected
+				return tx.Table("alerts").Where("probe_id = ?", d.ID).Update("probe_id", keep.ID).Error
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := Delete(ctx, db, deletionStore, d.ID); err != nil {
+				return nil, fmt.Errorf("delete probe %d: %w", d.ID, err)
+			}
+		} else {
+			if err := db.WithContext(ctx).Table("alert_rules").Where("probe_id = ? AND deleted_at IS NULL", d.ID).Count(&res.AlertRules).Error; err != nil {
+				return nil, err
+			}
+		}
+		rep.Merged = append(rep.Merged, res)
+	}
+	if !in.DryRun {
+		log.WithFields(log.Fields{logging.FieldWorkspace: keep.WorkspaceID, "keep": keep.ID}).
+			Infof("probe.MergeDuplicateProbes: merged %d duplicate(s)", len(rep.Merged))
+	}
+	return rep, nil
+}
+
+// historyBeforeClause restricts probe_data to a probe's rows older than
+// before (all rows when before is zero).
+func historyBeforeClause(probeID uint, before time.Time) string {
+	where := fmt.Sprintf("probe_id = %d", probeID)
+	if !before.IsZero() {
+		where += " AND created_at < " + chQuoteTime(before)
+	}
+	return where
+}
+
+func countProbeHistoryBefore(ctx context.Context, ch *sql.DB, probeID uint, before time.Time) (uint64, error) {
+	var n uint64
+	err := ch.QueryRowContext(ctx, "SELECT count(*) FROM probe_data WHERE "+historyBeforeClause(probeID, before)).Scan(&n)
+	return n, err
+}
+
+// moveProbeHistory re-assigns a probe's results older than before to
+// another probe. probe_id is in the ClickHouse sorting key, so the rows
+// are copied with the new ID and the originals deleted; the embedded
+// backend updates in place.
+func moveProbeHistory(ctx context.Context, ch *sql.DB, from, to uint, before time.Time) error {
+	where := historyBeforeClause(from, before)
+	if EmbeddedTelemetry() {
+		_, err := ch.ExecContext(ctx, fmt.Sprintf("UPDATE probe_data SET probe_id = %d WHERE %s", to, where))
+		return err
+	}
+	if _, err := ch.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO probe_data SELECT * REPLACE (toUInt64(%d) AS probe_id) FROM probe_data WHERE %s", to, where)); err != nil {
+		return err
+	}
+	_, err := ch.ExecContext(ctx, "ALTER TABLE probe_data DELETE WHERE "+where)
+	return err
+}
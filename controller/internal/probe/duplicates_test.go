@@ -0,0 +1,67 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCreateRejectsDuplicateProbe(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	seedAgent(t, db, 1, "203.0.113.1", false, 0)
+
+	first, err := Create(ctx, db, CreateInput{WorkspaceID: 1, AgentID: 1, Type: TypePing, Enabled: true, Targets: []string{"Example.com"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	in := CreateInput{WorkspaceID: 1, AgentID: 1, Type: TypePing, Enabled: true, Targets: []string{" example.com"}}
+	_, err = Create(ctx, db, in)
+	var dup *DuplicateProbeError
+	if !errors.As(err, &dup) || !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("err = %v, want DuplicateProbeError", err)
+	}
+	if dup.ExistingProbeID != first.ID {
+		t.Errorf("existing = %d, want %d", dup.ExistingProbeID, first.ID)
+	}
+
+	in.AllowDuplicate = true
+	second, err := Create(ctx, db, in)
+	if err != nil {
+		t.Fatalf("create with allow_duplicate: %v", err)
+	}
+	if _, err := Create(ctx, db, CreateInput{WorkspaceID: 1, AgentID: 1, Type: TypeMTR, Enabled: true, Targets: []string{"example.com"}}); err != nil {
+		t.Errorf("other type rejected: %v", err)
+	}
+
+	groups, err := FindDuplicateProbeGroups(ctx, db, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Probes) != 2 {
+		t.Fatalf("groups = %+v, want one pair", groups)
+	}
+	if g := groups[0]; g.KeepProbeID != first.ID || g.Probes[1].ProbeID != second.ID {
+		t.Errorf("group = %+v, want keep %d", g, first.ID)
+	}
+}
+
+func TestSuggestKeepProbe(t *testing.T) {
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(24 * time.Hour)
+	for _, tc := range []struct {
+		name   string
+		probes []DuplicateProbeHistory
+		want   uint
+	}{
+		{"no history", []DuplicateProbeHistory{{ProbeID: 7}, {ProbeID: 3}}, 3},
+		{"longest history", []DuplicateProbeHistory{{ProbeID: 3, FirstAt: &late}, {ProbeID: 7, FirstAt: &early}}, 7},
+		{"history beats none", []DuplicateProbeHistory{{ProbeID: 3}, {ProbeID: 7, FirstAt: &late}}, 7},
+		{"tie", []DuplicateProbeHistory{{ProbeID: 9, FirstAt: &early}, {ProbeID: 4, FirstAt: &early}}, 4},
+	} {
+		if got := suggestKeepProbe(tc.probes); got != tc.want {
+			t.Errorf("%s: keep = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ── Federated Analysis ──
+//
+// In a multi-region deployment each controller analyses only the agents
+// whose telemetry it holds (see internal/region). MergeRegionalAnalyses
+// combines those per-region analyses of one workspace into a single view:
+// agents and incidents are concatenated and tagged with their region, the
+// overall health is averaged over every scored agent, and the status is
+// rebuilt from the combined agents and incidents. A region that could not
+// be reached makes the result partial rather than failing it.
+
+// RegionalAnalysis is one region's analysis, or the error fetching it.
+type RegionalAnalysis struct {
+	Region   string
+	Analysis *WorkspaceAnalysis
+	Err      error
+}
+
+// RegionStatus reports how one region contributed to a federated analysis.
+type RegionStatus struct {
+	Region      string     `json:"region"`
+	OK          bool       `json:"ok"`
+	Error       string     `json:"error,omitempty"`
+	TotalAgents int        `json:"total_agents"`
+	GeneratedAt *time.Time `json:"generated_at,omitempty"`
+	Partial     bool       `json:"partial,omitempty"`
+}
+
+// FederatedAnalysis is a workspace analysis combined across regions.
+type FederatedAnalysis struct {
+	*WorkspaceAnalysis
+	Regions []RegionStatus `json:"regions"`
+}
+
+// MergeRegionalAnalyses combines per-region analyses of workspaceID.
+func MergeRegionalAnalyses(workspaceID uint, parts []RegionalAnalysis) *FederatedAnalysis {
+	out := &WorkspaceAnalysis{
+		WorkspaceID: workspaceID,
+		Incidents:   []DetectedIncident{},
+		Agents:      []AgentHealthSummary{},
+	}
+	fed := &FederatedAnalysis{WorkspaceAnalysis: out}
+
+	maintenance := make(map[string]bool)
+	var scoreSum, latencySum, lossSum, routeSum, mosSum float64
+	scored := 0
+	for _, p := range parts {
+		st := RegionStatus{Region: p.Region}
+		if p.Err != nil || p.Analysis == nil {
+			st.Error = "no analysis returned"
+			if p.Err != nil {
+				st.Error = p.Err.Error()
+			}
+			out.Partial = true
+			out.PartialReasons = append(out.PartialReasons, fmt.Sprintf("region %s unavailable: %s", p.Region, st.Error))
+			fed.Regions = append(fed.Regions, st)
+			continue
+		}
+		a := p.Analysis
+		generated := a.GeneratedAt
+		st.OK, st.TotalAgents, st.GeneratedAt, st.Partial = true, a.TotalAgents, &generated, a.Partial
+		fed.Regions = append(fed.Regions, st)
+
+		for _, ag := range a.Agents {
+			ag.Region = p.Region
+			out.Agents = append(out.Agents, ag)
+			if ag.Health.Grade != "" && ag.Health.Grade != "unknown" {
+				scored++
+				scoreSum += ag.Health.OverallHealth
+				latencySum += ag.Health.LatencyScore
+				lossSum += ag.Health.PacketLossScore
+				routeSum += ag.Health.RouteStability
+				mosSum += ag.Health.MosScore
+			}
+		}
+		for _, inc := range a.Incidents {
+			inc.Region = p.Region
+			out.Incidents = append(out.Incidents, inc)
+		}
+		out.Findings = append(out.Findings, a.Findings...)
+		for _, t := range a.MaintenanceTargets {
+			maintenance[t] = true
+		}
+		out.TotalAgents += a.TotalAgents
+		out.TotalProbes += a.TotalProbes
+		// The combined view is as old as its oldest part.
+		if out.GeneratedAt.IsZero() || a.GeneratedAt.Before(out.GeneratedAt) {
+			out.GeneratedAt = a.GeneratedAt
+		}
+		if a.Partial {
+			out.Partial = true
+			for _, r := range a.PartialReasons {
+				out.PartialReasons = append(out.PartialReasons, fmt.Sprintf("region %s: %s", p.Region, r))
+			}
+		}
+	}
+
+	if scored > 0 {
+		n := float64(scored)
+		out.OverallHealth = HealthVector{
+			OverallHealth:   clampScore(scoreSum / n),
+			Grade:           gradeFromScore(scoreSum / n),
+			LatencyScore:    clampScore(latencySum / n),
+			PacketLossScore: clampScore(lossSum / n),
+			RouteStability:  clampScore(routeSum / n),
+			MosScore:        mosSum / n,
+		}
+	} else {
+		out.OverallHealth = HealthVector{Grade: "unknown", RouteStability: 100, MosScore: 1.0}
+	}
+	sortIncidentsByImpact(out.Incidents)
+	out.Status = buildStatusSummary(out.OverallHealth, out.Agents, out.Incidents)
+	for t := range maintenance {
+		out.MaintenanceTargets = append(out.MaintenanceTargets, t)
+	}
+	sort.Strings(out.MaintenanceTargets)
+	if out.GeneratedAt.IsZero() {
+		out.GeneratedAt = time.Now().UTC()
+	}
+	return fed
+}
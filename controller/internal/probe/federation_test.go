@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMergeRegionalAnalyses(t *testing.T) {
+	now := time.Now()
+	eu := &WorkspaceAnalysis{
+		Agents: []AgentHealthSummary{
+			{AgentID: 1, IsOnline: true, Health: HealthVector{OverallHealth: 90, Grade: "excellent", MosScore: 4.3}},
+			{AgentID: 2, IsOnline: true, Health: HealthVector{OverallHealth: 70, Grade: "fair", MosScore: 3.9}},
+		},
+		Incidents:   []DetectedIncident{{ID: "a", ImpactScore: 10}},
+		TotalAgents: 2,
+		GeneratedAt: now,
+	}
+	us := &WorkspaceAnalysis{
+		Agents:         []AgentHealthSummary{{AgentID: 3, IsOnline: true, Health: HealthVector{OverallHealth: 50, Grade: "poor", MosScore: 3.0}}},
+		Incidents:      []DetectedIncident{{ID: "b", ImpactScore: 40}},
+		TotalAgents:    1,
+		GeneratedAt:    now.Add(-time.Minute),
+		Partial:        true,
+		PartialReasons: []string{"time budget exceeded"},
+	}
+
+	fed := MergeRegionalAnalyses(9, []RegionalAnalysis{
+		{Region: "eu", Analysis: eu},
+		{Region: "us", Analysis: us},
+		{Region: "ap", Err: errors.New("connection refused")},
+	})
+
+	if fed.WorkspaceID != 9 || fed.TotalAgents != 3 || len(fed.Agents) != 3 {
+		t.Fatalf("merged = %+v", fed.WorkspaceAnalysis)
+	}
+	if fed.OverallHealth.OverallHealth != 70 {
+		t.Errorf("overall health = %v, want the mean over agents (70)", fed.OverallHealth.OverallHealth)
+	}
+	if fed.Incidents[0].ID != "b" || fed.Incidents[0].Region != "us" || fed.Agents[2].Region != "us" {
+		t.Errorf("incidents not sorted by impact or not tagged: %+v", fed.Incidents)
+	}
+	if !fed.GeneratedAt.Equal(us.GeneratedAt) {
+		t.Errorf("generated_at = %v, want the oldest part", fed.GeneratedAt)
+	}
+	if !fed.Partial || len(fed.PartialReasons) != 2 {
+		t.Errorf("partial reasons = %v", fed.PartialReasons)
+	}
+	if len(fed.Regions) != 3 || fed.Regions[2].OK || fed.Regions[2].Error == "" || !fed.Regions[0].OK {
+		t.Errorf("regions = %+v", fed.Regions)
+	}
+}
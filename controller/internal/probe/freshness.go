@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/settings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Data Freshness ──
+//
+// When ingestion lags (batch writer backlog, a ClickHouse mutation holding
+// parts) the read APIs keep answering from whatever has landed, and old
+// data looks current. The freshness watermark is the latest received_at
+// per reporting agent; a connected agent whose watermark is older than
+// DATA_FRESHNESS_STALE_MINUTES (default 10) marks the response degraded.
+//
+// Offline agents are listed but never degrade freshness — their data is
+// old because they stopped reporting, not because ingestion is behind.
+
+const (
+	defaultFreshnessStaleMinutes = 10
+	// freshnessScanWindow bounds the max(received_at) scan; agents with
+	// nothing newer report no watermark.
+	freshnessScanWindow = 24 * time.Hour
+	// freshnessOnlineWindow mirrors the is_online check used by analysis.
+	freshnessOnlineWindow = time.Minute
+)
+
+// AgentWatermark is the ingestion watermark for one reporting agent.
+type AgentWatermark struct {
+	AgentID    uint       `json:"agent_id"`
+	AgentName  string     `json:"agent_name,omitempty"`
+	ReceivedAt *time.Time `json:"received_at"` // nil when nothing arrived in the scan window
+	LagSeconds int        `json:"lag_seconds"`
+	Online     bool       `json:"online"`
+	Stale      bool       `json:"stale"`
+}
+
+// DataFreshness is attached to analysis, network map and probe data responses.
+type DataFreshness struct {
+	// Watermark is the oldest per-agent watermark among online agents:
+	// everything up to this instant has been ingested for every agent.
+	Watermark    *time.Time       `json:"watermark"`
+	LagSeconds   int              `json:"lag_seconds"`
+	StaleMinutes int              `json:"stale_minutes"`
+	Degraded     bool             `json:"degraded"`
+	Warning      string           `json:"warning,omitempty"`
+	Agents       []AgentWatermark `json:"agents"`
+}
+
+// freshnessStaleMinutes reads DATA_FRESHNESS_STALE_MINUTES.
+func freshnessStaleMinutes() int {
+	if v, err := strconv.Atoi(strings.TrimSpace(settings.Getenv("DATA_FRESHNESS_STALE_MINUTES"))); err == nil && v > 0 {
+		return v
+	}
+	return defaultFreshnessStaleMinutes
+}
+
+// getAgentWatermarks returns max(received_at) per agent.
+func getAgentWatermarks(ctx context.Context, ch *sql.DB, agentIDs []uint, now time.Time) (map[uint]time.Time, error) {
+	out := make(map[uint]time.Time)
+	if ch == nil || len(agentIDs) == 0 {
+		return out, nil
+	}
+	agentIDStrs := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		agentIDStrs[i] = fmt.Sprintf("%d", id)
+	}
+
+	q := fmt.Sprintf(`
+SELECT agent_id, max(received_at)
+FROM probe_data
+WHERE agent_id IN (%s)
+  AND received_at >= %s
+GROUP BY agent_id
+`, strings.Join(agentIDStrs, ", "), chQuoteTime(now.Add(-freshnessScanWindow)))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint64
+		var ts time.Time
+		if err := rows.Scan(&id, &ts); err != nil {
+			return nil, err
+		}
+		out[uint(id)] = ts.UTC()
+	}
+	return out, rows.Err()
+}
+
+// buildDataFreshness folds per-agent watermarks into a DataFreshness.
+func buildDataFreshness(agents []agentInfo, marks map[uint]time.Time, now time.Time, staleMinutes int) *DataFreshness {
+	staleAfter := time.Duration(staleMinutes) * time.Minute
+	f := &DataFreshness{StaleMinutes: staleMinutes, Agents: make([]AgentWatermark, 0, len(agents))}
+
+	var staleNames []string
+	for _, a := range agents {
+		w := AgentWatermark{
+			AgentID:   a.ID,
+			AgentName: a.Name,
+			Online:    now.Sub(a.UpdatedAt) < freshnessOnlineWindow,
+		}
+		if ts, ok := marks[a.ID]; ok {
+			t := ts
+			w.ReceivedAt = &t
+			w.LagSeconds = int(now.Sub(ts).Seconds())
+			if w.LagSeconds < 0 {
+				w.LagSeconds = 0
+			}
+			w.Stale = w.Online && now.Sub(ts) > staleAfter
+			if w.Online && (f.Watermark == nil || ts.Before(*f.Watermark)) {
+				f.Watermark = &t
+			}
+		}
+		if w.Stale {
+			staleNames = append(staleNames, a.Name)
+		}
+		f.Agents = append(f.Agents, w)
+	}
+
+	if f.Watermark != nil {
+		f.LagSeconds = int(now.Sub(*f.Watermark).Seconds())
+		if f.LagSeconds < 0 {
+			f.LagSeconds = 0
+		}
+	}
+	if len(staleNames) > 0 {
+		f.Degraded = true
+		f.Warning = fmt.Sprintf("Data from %d connected agent(s) is more than %d minutes old (%s); results may not reflect current conditions",
+			len(staleNames), staleMinutes, strings.Join(staleNames, ", "))
+	}
+	return f
+}
+
+// computeDataFreshness queries watermarks for agents. Query errors are
+// logged and yield nil so the caller's response is unaffected.
+func computeDataFreshness(ctx context.Context, ch *sql.DB, agents []agentInfo) *DataFreshness {
+	if ch == nil || len(agents) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	ids := make([]uint, len(agents))
+	for i, a := range agents {
+		ids[i] = a.ID
+	}
+	marks, err := getAgentWatermarks(ctx, ch, ids, now)
+	if err != nil {
+		log.Warnf("[freshness] watermark query failed: %v", err)
+		return nil
+	}
+	return buildDataFreshness(agents, marks, now, freshnessStaleMinutes())
+}
+
+// GetDataFreshness returns the freshness watermark for a workspace. When
+// agentIDs is non-empty only those workspace agents are considered.
+func GetDataFreshness(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, agentIDs ...uint) (*DataFreshness, error) {
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	if len(agentIDs) > 0 {
+		want := make(map[uint]bool, len(agentIDs))
+		for _, id := range agentIDs {
+			want[id] = true
+		}
+		filtered := agents[:0]
+		for _, a := range agents {
+			if want[a.ID] {
+				filtered = append(filtered, a)
+			}
+		}
+		agents = filtered
+	}
+	return computeDataFreshness(ctx, ch, agents), nil
+}
@@ -0,0 +1,44 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestBuildDataFreshness verifies only connected agents with a lagging
+// watermark degrade freshness, and the watermark is the oldest of them.
+func TestBuildDataFreshness(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	agents := []agentInfo{
+		{ID: 1, Name: "fresh", UpdatedAt: now.Add(-10 * time.Second)},
+		{ID: 2, Name: "lagging", UpdatedAt: now.Add(-5 * time.Second)},
+		{ID: 3, Name: "offline", UpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: 4, Name: "no-data", UpdatedAt: now},
+	}
+	marks := map[uint]time.Time{
+		1: now.Add(-30 * time.Second),
+		2: now.Add(-25 * time.Minute),
+		3: now.Add(-2 * time.Hour),
+	}
+
+	f := buildDataFreshness(agents, marks, now, 10)
+	if !f.Degraded || f.Warning == "" {
+		t.Fatalf("expected degraded freshness, got %+v", f)
+	}
+	if f.Watermark == nil || !f.Watermark.Equal(marks[2]) {
+		t.Errorf("watermark = %v, want %v", f.Watermark, marks[2])
+	}
+	if f.LagSeconds != 25*60 {
+		t.Errorf("lag = %d, want %d", f.LagSeconds, 25*60)
+	}
+	for _, w := range f.Agents {
+		if w.Stale != (w.AgentID == 2) {
+			t.Errorf("agent %d stale = %v", w.AgentID, w.Stale)
+		}
+	}
+
+	delete(marks, 2)
+	if f := buildDataFreshness(agents, marks, now, 10); f.Degraded {
+		t.Errorf("offline agent degraded freshness: %+v", f)
+	}
+}
@@ -0,0 +1,426 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ── Agent Host History ──
+//
+// GetLatestSysInfoForAgent / GetLatestNetInfoForAgent only return the
+// newest report. The host health tab needs trends, so these read an
+// agent's SYSINFO and NETINFO reports over a window and fold them into
+// fixed-width buckets. Payloads are JSON, so like GetProbeDataAggregated
+// the rows are fetched raw (newest first, capped) and bucketed in Go.
+// Buckets without reports are omitted rather than zero-filled.
+
+const (
+	defaultHostHistoryWindow = 24 * time.Hour
+	maxHostHistoryWindow     = 30 * 24 * time.Hour
+	minHostHistoryBucket     = 60 * time.Second
+
+	// hostHistoryTargetPoints sizes the automatic bucket; maxHostHistoryPoints
+	// widens an explicit bucket that would produce more.
+	hostHistoryTargetPoints = 300
+	maxHostHistoryPoints    = 2000
+)
+
+// hostHistoryBucketSteps are the automatic bucket widths.
+var hostHistoryBucketSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// HostHistoryQuery selects one agent's reports. Zero From/To default to
+// the last 24h; BucketSec 0 picks a width giving about 300 points.
+type HostHistoryQuery struct {
+	AgentID   uint
+	From      time.Time
+	To        time.Time
+	BucketSec int
+}
+
+func (q *HostHistoryQuery) normalize(now time.Time) (time.Duration, error) {
+	if q.AgentID == 0 {
+		return 0, fmt.Errorf("%w: agent required", ErrBadInput)
+	}
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultHostHistoryWindow)
+	}
+	window := q.To.Sub(q.From)
+	if window <= 0 {
+		return 0, fmt.Errorf("%w: from must be before to", ErrBadInput)
+	}
+	if window > maxHostHistoryWindow {
+		return 0, fmt.Errorf("%w: window exceeds %d days", ErrBadInput, int(maxHostHistoryWindow.Hours()/24))
+	}
+	if q.BucketSec < 0 {
+		return 0, fmt.Errorf("%w: bucket must be positive", ErrBadInput)
+	}
+
+	bucket := time.Duration(q.BucketSec) * time.Second
+	if bucket == 0 {
+		want := window / hostHistoryTargetPoints
+		bucket = hostHistoryBucketSteps[len(hostHistoryBucketSteps)-1]
+		for _, step := range hostHistoryBucketSteps {
+			if step >= want {
+				bucket = step
+				break
+			}
+		}
+	}
+	if bucket < minHostHistoryBucket {
+		bucket = minHostHistoryBucket
+	}
+	if floor := window / maxHostHistoryPoints; bucket < floor {
+		bucket = floor.Round(time.Second)
+	}
+	q.BucketSec = int(bucket / time.Second)
+	return bucket, nil
+}
+
+// hostReport is one raw SYSINFO/NETINFO row.
+type hostReport struct {
+	At      time.Time
+	Payload []byte
+}
+
+// fetchHostReports returns an agent's reports of type t in [from, to),
+// oldest first. Past MaxRawRowsForAggregation the oldest are dropped and
+// truncated is true.
+func fetchHostReports(ctx context.Context, ch *sql.DB, t Type, q HostHistoryQuery) (reports []hostReport, truncated bool, err error) {
+	sqlq := fmt.Sprintf(`
+SELECT created_at, payload_raw
+FROM probe_data
+WHERE type = %s
+  AND agent_id = %d
+  AND created_at >= %s
+  AND created_at < %s
+ORDER BY created_at DESC
+LIMIT %d`, chQuoteString(string(t)), q.AgentID, chQuoteTime(q.From), chQuoteTime(q.To), MaxRawRowsForAggregation+1)
+
+	rows, err := ch.QueryContext(ctx, sqlq)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r hostReport
+		var raw string
+		if err := rows.Scan(&r.At, &raw); err != nil {
+			return nil, false, err
+		}
+		if raw == "" {
+			continue
+		}
+		r.Payload = UnsealAgentPayload(ctx, q.AgentID, []byte(raw))
+		reports = append(reports, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(reports) > MaxRawRowsForAggregation {
+		reports, truncated = reports[:MaxRawRowsForAggregation], true
+	}
+	for i, j := 0, len(reports)-1; i < j; i, j = i+1, j-1 {
+		reports[i], reports[j] = reports[j], reports[i]
+	}
+	return reports, truncated, nil
+}
+
+// bucketStart floors at to a bucket boundary aligned on from.
+func bucketStart(at, from time.Time, bucket time.Duration) time.Time {
+	return from.Add(at.Sub(from) / bucket * bucket)
+}
+
+// ── SYSINFO ──
+
+// SysInfoHistoryPoint summarizes one bucket of SYSINFO reports.
+type SysInfoHistoryPoint struct {
+	Time          time.Time `json:"time"` // bucket start
+	Samples       int       `json:"samples"`
+	CPUPctAvg     float64   `json:"cpu_pct_avg"`
+	CPUPctMax     float64   `json:"cpu_pct_max"`
+	MemPctAvg     float64   `json:"mem_pct_avg"`
+	MemPctMax     float64   `json:"mem_pct_max"`
+	MemUsedBytes  uint64    `json:"mem_used_bytes"`  // highest in the bucket
+	MemTotalBytes uint64    `json:"mem_total_bytes"` // latest in the bucket
+	// DiskPctMax is the fullest reported filesystem; nil when the agent
+	// does not report disks.
+	DiskPctMax *float64 `json:"disk_pct_max,omitempty"`
+	Reboots    int      `json:"reboots,omitempty"` // boot time changed within the bucket
+}
+
+// SysInfoHistory is an agent's bucketed SYSINFO series.
+type SysInfoHistory struct {
+	AgentID   uint                  `json:"agent_id"`
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+	BucketSec int                   `json:"bucket_sec"`
+	Hostname  string                `json:"hostname,omitempty"` // from the latest report
+	Points    []SysInfoHistoryPoint `json:"points"`
+	Truncated bool                  `json:"truncated,omitempty"`
+}
+
+// GetSysInfoHistory returns CPU, memory and disk usage over time for an
+// agent.
+func GetSysInfoHistory(ctx context.Context, ch *sql.DB, q HostHistoryQuery) (*SysInfoHistory, error) {
+	bucket, err := q.normalize(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	reports, truncated, err := fetchHostReports(ctx, ch, TypeSysInfo, q)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]sysInfoSample, 0, len(reports))
+	for _, r := range reports {
+		var p sysInfoPayload
+		if json.Unmarshal(r.Payload, &p) == nil {
+			samples = append(samples, sysInfoSample{At: r.At, P: p})
+		}
+	}
+	out := &SysInfoHistory{
+		AgentID: q.AgentID, From: q.From, To: q.To, BucketSec: q.BucketSec,
+		Points:    bucketSysInfo(samples, q.From, bucket),
+		Truncated: truncated,
+	}
+	if n := len(samples); n > 0 {
+		out.Hostname = samples[n-1].P.HostInfo.Hostname
+	}
+	return out, nil
+}
+
+type sysInfoSample struct {
+	At time.Time
+	P  sysInfoPayload
+}
+
+func cpuTotal(t SystemCPUTimes) time.Duration {
+	return t.User + t.System + t.Idle + t.IOWait + t.Nice + t.SoftIRQ + t.Steal + t.IRQ
+}
+
+// cpuPercent uses the delta since the previous report when both come from
+// the same boot; CPU times are cumulative, so a lone report only gives
+// the average since boot.
+func cpuPercent(prev *sysInfoPayload, cur sysInfoPayload) float64 {
+	total, idle := cpuTotal(cur.CPUTimes), cur.CPUTimes.Idle
+	if prev != nil && prev.HostInfo.BootTime.Equal(cur.HostInfo.BootTime) {
+		if dt := total - cpuTotal(prev.CPUTimes); dt > 0 && idle >= prev.CPUTimes.Idle {
+			total, idle = dt, idle-prev.CPUTimes.Idle
+		}
+	}
+	if total <= 0 {
+		return 0
+	}
+	return math.Max(0, float64(total-idle)/float64(total)*100)
+}
+
+func diskPercent(disks []SystemDiskInfo) (float64, bool) {
+	var worst float64
+	ok := false
+	for _, d := range disks {
+		if d.Total == 0 {
+			continue
+		}
+		if pct := float64(d.Used) / float64(d.Total) * 100; !ok || pct > worst {
+			worst, ok = pct, true
+		}
+	}
+	return worst, ok
+}
+
+// bucketSysInfo folds samples (oldest first) into buckets.
+func bucketSysInfo(samples []sysInfoSample, from time.Time, bucket time.Duration) []SysInfoHistoryPoint {
+	points := []SysInfoHistoryPoint{}
+	var cur *SysInfoHistoryPoint
+	var cpuSum, memSum float64
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.CPUPctAvg = roundTo(cpuSum/float64(cur.Samples), 2)
+		cur.MemPctAvg = roundTo(memSum/float64(cur.Samples), 2)
+		cur.CPUPctMax = roundTo(cur.CPUPctMax, 2)
+		cur.MemPctMax = roundTo(cur.MemPctMax, 2)
+		if cur.DiskPctMax != nil {
+			v := roundTo(*cur.DiskPctMax, 2)
+			cur.DiskPctMax = &v
+		}
+		points = append(points, *cur)
+	}
+
+	var prev *sysInfoPayload
+	for i := range samples {
+		s := samples[i]
+		start := bucketStart(s.At, from, bucket)
+		if cur == nil || !cur.Time.Equal(start) {
+			flush()
+			cur = &SysInfoHistoryPoint{Time: start}
+			cpuSum, memSum = 0, 0
+		}
+		cpu := cpuPercent(prev, s.P)
+		mem := 0.0
+		if s.P.MemoryInfo.Total > 0 {
+			mem = float64(s.P.MemoryInfo.Used) / float64(s.P.MemoryInfo.Total) * 100
+		}
+		cur.Samples++
+		cpuSum += cpu
+		memSum += mem
+		cur.CPUPctMax = math.Max(cur.CPUPctMax, cpu)
+		cur.MemPctMax = math.Max(cur.MemPctMax, mem)
+		if s.P.MemoryInfo.Used > cur.MemUsedBytes {
+			cur.MemUsedBytes = s.P.MemoryInfo.Used
+		}
+		cur.MemTotalBytes = s.P.MemoryInfo.Total
+		if d, ok := diskPercent(s.P.Disks); ok && (cur.DiskPctMax == nil || d > *cur.DiskPctMax) {
+			cur.DiskPctMax = &d
+		}
+		if prev != nil && !s.P.HostInfo.BootTime.IsZero() && !prev.HostInfo.BootTime.Equal(s.P.HostInfo.BootTime) {
+			cur.Reboots++
+		}
+		prev = &samples[i].P
+	}
+	flush()
+	return points
+}
+
+// ── NETINFO ──
+
+// HostInterfaceState is one interface as of the end of a bucket.
+type HostInterfaceState struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type,omitempty"`
+	Up        bool     `json:"up"`
+	IsDefault bool     `json:"is_default,omitempty"`
+	IPv4      []string `json:"ipv4,omitempty"`
+}
+
+// NetInfoHistoryPoint is the network state at the end of one bucket.
+type NetInfoHistoryPoint struct {
+	Time           time.Time            `json:"time"` // bucket start
+	Samples        int                  `json:"samples"`
+	PublicIP       string               `json:"public_ip,omitempty"`
+	PublicIPs      []string             `json:"public_ips,omitempty"` // every public IP seen in the bucket, when more than one
+	ISP            string               `json:"isp,omitempty"`
+	ASN            uint                 `json:"asn,omitempty"`
+	LocalAddress   string               `json:"local_address,omitempty"`
+	DefaultGateway string               `json:"default_gateway,omitempty"`
+	DNSServers     []string             `json:"dns_servers,omitempty"`
+	Interfaces     []HostInterfaceState `json:"interfaces,omitempty"`
+}
+
+// HostNetChange is a change between two consecutive NETINFO reports.
+type HostNetChange struct {
+	At       time.Time `json:"at"`
+	Field    string    `json:"field"` // public_ip, isp, gateway, dns_servers, interface_added, ...
+	OldValue string    `json:"old_value,omitempty"`
+	NewValue string    `json:"new_value,omitempty"`
+}
+
+// NetInfoHistory is an agent's bucketed NETINFO series.
+type NetInfoHistory struct {
+	AgentID   uint                  `json:"agent_id"`
+	From      time.Time             `json:"from"`
+	To        time.Time             `json:"to"`
+	BucketSec int                   `json:"bucket_sec"`
+	Points    []NetInfoHistoryPoint `json:"points"`
+	Changes   []HostNetChange       `json:"changes"`
+	Truncated bool                  `json:"truncated,omitempty"`
+}
+
+// GetNetInfoHistory returns ISP, IP and interface state over time for an
+// agent, plus every change between consecutive reports.
+func GetNetInfoHistory(ctx context.Context, ch *sql.DB, q HostHistoryQuery) (*NetInfoHistory, error) {
+	bucket, err := q.normalize(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	reports, truncated, err := fetchHostReports(ctx, ch, TypeNetInfo, q)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]netInfoSample, 0, len(reports))
+	for _, r := range reports {
+		var p netInfoPayload
+		if json.Unmarshal(r.Payload, &p) == nil {
+			samples = append(samples, netInfoSample{At: r.At, P: p})
+		}
+	}
+	points, changes := bucketNetInfo(q.AgentID, samples, q.From, bucket)
+	return &NetInfoHistory{
+		AgentID: q.AgentID, From: q.From, To: q.To, BucketSec: q.BucketSec,
+		Points: points, Changes: changes, Truncated: truncated,
+	}, nil
+}
+
+type netInfoSample struct {
+	At time.Time
+	P  netInfoPayload
+}
+
+// bucketNetInfo folds samples (oldest first) into buckets and diffs
+// consecutive reports.
+func bucketNetInfo(agentID uint, samples []netInfoSample, from time.Time, bucket time.Duration) ([]NetInfoHistoryPoint, []HostNetChange) {
+	points := []NetInfoHistoryPoint{}
+	changes := []HostNetChange{}
+	var cur *NetInfoHistoryPoint
+	for i, s := range samples {
+		if i > 0 {
+			for _, c := range diffNetInfo(agentID, samples[i-1].P, s.P, s.At) {
+				changes = append(changes, HostNetChange{At: c.DetectedAt, Field: c.Field, OldValue: c.OldValue, NewValue: c.NewValue})
+			}
+		}
+
+		start := bucketStart(s.At, from, bucket)
+		if cur == nil || !cur.Time.Equal(start) {
+			if cur != nil {
+				points = append(points, *cur)
+			}
+			cur = &NetInfoHistoryPoint{Time: start}
+		}
+		cur.Samples++
+		p := s.P
+		if p.PublicAddress != "" {
+			cur.PublicIP = p.PublicAddress
+			seen := false
+			for _, ip := range cur.PublicIPs {
+				seen = seen || ip == p.PublicAddress
+			}
+			if !seen {
+				cur.PublicIPs = append(cur.PublicIPs, p.PublicAddress)
+			}
+		}
+		cur.ISP = p.GetISP()
+		cur.ASN, _ = p.GetASN()
+		cur.LocalAddress = p.LocalAddress
+		cur.DefaultGateway = p.DefaultGateway
+		cur.DNSServers = p.DNSServers
+		cur.Interfaces = nil
+		for _, iface := range p.Interfaces {
+			if iface.Type == "loopback" {
+				continue
+			}
+			cur.Interfaces = append(cur.Interfaces, HostInterfaceState{
+				Name: iface.Name, Type: iface.Type, Up: interfaceUp(iface),
+				IsDefault: iface.IsDefault, IPv4: iface.IPv4,
+			})
+		}
+	}
+	if cur != nil {
+		points = append(points, *cur)
+	}
+	for i := range points {
+		if len(points[i].PublicIPs) < 2 {
+			points[i].PublicIPs = nil
+		}
+	}
+	return points, changes
+}
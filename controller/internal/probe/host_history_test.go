@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHostHistoryQueryNormalize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	q := HostHistoryQuery{AgentID: 1}
+	bucket, err := q.normalize(now)
+	if err != nil || !q.To.Equal(now) || !q.From.Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("defaults: %+v, %v", q, err)
+	}
+	if bucket != 5*time.Minute || q.BucketSec != 300 {
+		t.Errorf("auto bucket for 24h = %v, want 5m", bucket)
+	}
+
+	// An explicit bucket is widened to keep the point count bounded.
+	q = HostHistoryQuery{AgentID: 1, From: now.Add(-30 * 24 * time.Hour), To: now, BucketSec: 60}
+	if bucket, _ := q.normalize(now); bucket < 30*24*time.Hour/maxHostHistoryPoints {
+		t.Errorf("bucket %v allows more than %d points", bucket, maxHostHistoryPoints)
+	}
+
+	for _, bad := range []HostHistoryQuery{
+		{},
+		{AgentID: 1, From: now, To: now.Add(-time.Hour)},
+		{AgentID: 1, From: now.Add(-31 * 24 * time.Hour), To: now},
+		{AgentID: 1, BucketSec: -5},
+	} {
+		if _, err := bad.normalize(now); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%+v: err = %v, want ErrBadInput", bad, err)
+		}
+	}
+}
+
+func TestBucketSysInfo(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	boot := from.Add(-time.Hour)
+	report := func(min int, busy, idle time.Duration, used uint64, bootAt time.Time) sysInfoSample {
+		var p sysInfoPayload
+		p.HostInfo.BootTime = bootAt
+		p.CPUTimes = SystemCPUTimes{User: busy, Idle: idle}
+		p.MemoryInfo = SystemHostMemoryInfo{Total: 100, Used: used}
+		return sysInfoSample{At: from.Add(time.Duration(min) * time.Minute), P: p}
+	}
+	samples := []sysInfoSample{
+		report(1, 10*time.Second, 90*time.Second, 40, boot),  // since boot: 10%
+		report(3, 40*time.Second, 100*time.Second, 60, boot), // delta: 30/40 = 75%
+		report(7, 1*time.Second, 3*time.Second, 50, from),    // rebooted: since boot 25%
+	}
+	samples[2].P.Disks = []SystemDiskInfo{{Mountpoint: "/", Total: 200, Used: 150}, {Mountpoint: "/boot", Total: 10, Used: 1}}
+
+	points := bucketSysInfo(samples, from, 5*time.Minute)
+	if len(points) != 2 {
+		t.Fatalf("points = %+v, want 2 buckets", points)
+	}
+	p0, p1 := points[0], points[1]
+	if p0.Samples != 2 || p0.CPUPctMax != 75 || p0.CPUPctAvg != 42.5 || p0.MemPctMax != 60 || p0.MemUsedBytes != 60 {
+		t.Errorf("first bucket = %+v", p0)
+	}
+	if p0.DiskPctMax != nil {
+		t.Error("disk usage reported without disks")
+	}
+	if !p1.Time.Equal(from.Add(5*time.Minute)) || p1.CPUPctAvg != 25 || p1.Reboots != 1 {
+		t.Errorf("second bucket = %+v", p1)
+	}
+	if p1.DiskPctMax == nil || *p1.DiskPctMax != 75 {
+		t.Errorf("disk pct = %v, want fullest filesystem (75)", p1.DiskPctMax)
+	}
+}
+
+func TestBucketNetInfo(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return from.Add(time.Duration(min) * time.Minute) }
+	samples := []netInfoSample{
+		{At: at(0), P: netInfoPayload{PublicAddress: "198.51.100.1", InternetProvider: "ISP A", DefaultGateway: "10.0.0.1"}},
+		{At: at(2), P: netInfoPayload{PublicAddress: "198.51.100.2", InternetProvider: "ISP A", DefaultGateway: "10.0.0.1"}},
+		{At: at(12), P: netInfoPayload{PublicAddress: "198.51.100.2", InternetProvider: "ISP B", DefaultGateway: "10.0.0.1",
+			Interfaces: []InterfaceInfo{{Name: "lo", Type: "loopback"}, {Name: "eth0", Type: "ethernet", Flags: []string{"up"}, IsDefault: true}}}},
+	}
+
+	points, changes := bucketNetInfo(5, samples, from, 10*time.Minute)
+	if len(points) != 2 {
+		t.Fatalf("points = %+v", points)
+	}
+	if points[0].PublicIP != "198.51.100.2" || len(points[0].PublicIPs) != 2 {
+		t.Errorf("first bucket = %+v, want last IP and both IPs listed", points[0])
+	}
+	if points[1].PublicIPs != nil || points[1].ISP != "ISP B" || len(points[1].Interfaces) != 1 || !points[1].Interfaces[0].Up {
+		t.Errorf("second bucket = %+v", points[1])
+	}
+	if len(changes) != 2 || changes[0].Field != "public_ip" || changes[1].Field != "isp" || !changes[1].At.Equal(at(12)) {
+		t.Errorf("changes = %+v", changes)
+	}
+}
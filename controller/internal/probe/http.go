@@ -3,12 +3,25 @@ package probe
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+// ── HTTP Probes ─────────────────────────────────────────────────────────────
+//
+// Optional protocol tests are configured per probe in metadata:
+//
+//	{"http": {"alpn": ["h2", "http/1.1"], "http3": true}}
+//
+// alpn is the protocol list the agent offers in the TLS handshake (the
+// negotiated one is reported in ALPN); http3 makes the agent repeat the
+// request over QUIC and report it in HTTP3. TLS details are stored per
+// sample, and the controller recomputes days-to-expiry from NotAfter at
+// ingest so a stale agent clock can't hide an expiring certificate.
+
 type HTTPPayload struct {
 	StartTimestamp    time.Time         `json:"start_timestamp"`
 	StopTimestamp     time.Time         `json:"stop_timestamp"`
@@ -27,7 +40,9 @@ type HTTPPayload struct {
 	Protocol          string            `json:"protocol"`
 	TLSVersion        string            `json:"tls_version,omitempty"`
 	TLSCipherSuite    string            `json:"tls_cipher_suite,omitempty"`
+	ALPN              string            `json:"alpn,omitempty"` // negotiated ALPN protocol, e.g. "h2"
 	CertificateInfo   *CertInfo         `json:"certificate_info,omitempty"`
+	HTTP3             *HTTP3Result      `json:"http3,omitempty"`
 	ContentMatch      bool              `json:"content_match"`
 	ContentMatchFound string            `json:"content_match_found,omitempty"`
 	Error             string            `json:"error,omitempty"`
@@ -40,6 +55,54 @@ type CertInfo struct {
 	NotAfter        time.Time `json:"not_after"`
 	DaysUntilExpiry int       `json:"days_until_expiry"`
 	SANs            []string  `json:"sans"`
+	Fingerprint     string    `json:"fingerprint,omitempty"`  // SHA-256 of the leaf certificate
+	ChainSHA256     string    `json:"chain_sha256,omitempty"` // SHA-256 over the DER chain as served
+	ChainLength     int       `json:"chain_length,omitempty"` // certificates served, leaf included
+}
+
+// HTTP3Result is the outcome of the optional HTTP/3 (QUIC) attempt.
+type HTTP3Result struct {
+	Attempted  bool    `json:"attempted"`
+	Supported  bool    `json:"supported"`
+	AltSvc     string  `json:"alt_svc,omitempty"` // Alt-Svc header from the HTTP/1-2 response
+	TotalMs    float64 `json:"total_ms,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// HTTPOptions are the per-probe metadata.http settings.
+type HTTPOptions struct {
+	ALPN  []string `json:"alpn,omitempty"`
+	HTTP3 bool     `json:"http3,omitempty"`
+}
+
+// httpALPNProtocols are the ALPN IDs the agent can offer.
+var httpALPNProtocols = map[string]bool{"h3": true, "h2": true, "http/1.1": true}
+
+// validateHTTPOptions checks metadata.http when present.
+func validateHTTPOptions(v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%w: metadata.http must be an object", ErrBadInput)
+	}
+	var o HTTPOptions
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return fmt.Errorf("%w: metadata.http: alpn must be a list of strings and http3 a boolean", ErrBadInput)
+	}
+	for _, p := range o.ALPN {
+		if !httpALPNProtocols[p] {
+			return fmt.Errorf("%w: metadata.http.alpn: unsupported protocol %q (h3, h2, http/1.1)", ErrBadInput, p)
+		}
+	}
+	return nil
+}
+
+// normalizeCertExpiry recomputes DaysUntilExpiry from NotAfter.
+func normalizeCertExpiry(c *CertInfo, now time.Time) {
+	if c == nil || c.NotAfter.IsZero() {
+		return
+	}
+	c.DaysUntilExpiry = certDaysLeft(c.NotAfter, now)
 }
 
 func initHTTP(ch *sql.DB, pg *gorm.DB) {
@@ -49,8 +112,9 @@ func initHTTP(ch *sql.DB, pg *gorm.DB) {
 			return nil
 		},
 		func(ctx context.Context, data ProbeData, p HTTPPayload) error {
+			normalizeCertExpiry(p.CertificateInfo, time.Now())
 			if err := SaveRecordWithAlertEval(ctx, ch, pg, data, string(TypeHTTP), p); err != nil {
-				log.WithError(err).Error("save HTTP record (CH)")
+				ingestEntry(data).WithError(err).Error("save HTTP record (CH)")
 				return err
 			}
 
@@ -64,8 +128,13 @@ func initHTTP(ch *sql.DB, pg *gorm.DB) {
 				certInfo = p.CertificateInfo.Subject
 			}
 
-			log.Printf("[http] pid=%d url=%s status=%d time=%.2fms tls=%s cipher=%s cert=%s",
-				data.ProbeID, target, p.StatusCode, p.TotalMs, p.TLSVersion, p.TLSCipherSuite, certInfo)
+			h3 := "-"
+			if p.HTTP3 != nil && p.HTTP3.Attempted {
+				h3 = fmt.Sprintf("%v", p.HTTP3.Supported)
+			}
+
+			ingestEntry(data).Infof("[http] pid=%d url=%s status=%d time=%.2fms proto=%s alpn=%s h3=%s tls=%s cipher=%s cert=%s",
+				data.ProbeID, target, p.StatusCode, p.TotalMs, p.Protocol, p.ALPN, h3, p.TLSVersion, p.TLSCipherSuite, certInfo)
 			return nil
 		},
 	))
@@ -0,0 +1,378 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/features"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Incident Evidence ──
+//
+// Analysis snapshots and raw probe data live in ClickHouse and expire with
+// its TTL. When the analysis loop records a warning or critical incident
+// we copy the data behind it into Postgres — the worst PING samples, a
+// short timeline for charting, a few MTR traces, and before/after stats —
+// so the evidence can still be attached to a ticket after CH drops it.
+
+const (
+	evidenceWorstSamples = 50
+	evidenceMTRTraces    = 3
+	// evidenceTimelineMax caps the chronological series kept for charts.
+	evidenceTimelineMax = 240
+	// evidenceRecapture is how long one bundle covers an incident ID; a
+	// still-open incident is not re-captured on every analysis cycle.
+	evidenceRecapture = 6 * time.Hour
+	// evidenceRowLimit bounds the raw PING rows read per incident.
+	evidenceRowLimit = 5000
+)
+
+// IncidentEvidence is a persisted evidence bundle for one incident.
+type IncidentEvidence struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time      `gorm:"index" json:"created_at"`
+	WorkspaceID uint           `gorm:"not null;index:idx_incident_evidence_ws_incident" json:"workspace_id"`
+	IncidentID  string         `gorm:"size:255;not null;index:idx_incident_evidence_ws_incident" json:"incident_id"`
+	Severity    string         `gorm:"size:16" json:"severity"`
+	Title       string         `gorm:"size:512" json:"title"`
+	SizeBytes   int            `json:"size_bytes"`
+	Bundle      datatypes.JSON `gorm:"type:jsonb" json:"bundle,omitempty"`
+}
+
+func (IncidentEvidence) TableName() string { return "incident_evidence" }
+
+// EvidenceSample is one PING cycle copied from probe_data.
+type EvidenceSample struct {
+	Time       time.Time `json:"time"`
+	AgentID    uint      `json:"agent_id"`
+	Target     string    `json:"target"`
+	AvgLatency float64   `json:"avg_latency"` // ms
+	MaxLatency float64   `json:"max_latency"` // ms
+	PacketLoss float64   `json:"packet_loss"` // percent
+}
+
+// EvidenceStats summarizes the PING samples in one window.
+type EvidenceStats struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Samples    int       `json:"samples"`
+	AvgLatency float64   `json:"avg_latency"`
+	P95Latency float64   `json:"p95_latency"`
+	PacketLoss float64   `json:"packet_loss"`
+}
+
+// EvidenceTrace is a raw MTR payload copied from probe_data.
+type EvidenceTrace struct {
+	Time    time.Time       `json:"time"`
+	AgentID uint            `json:"agent_id"`
+	Target  string          `json:"target"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// EvidenceBundle is the stored evidence for one incident.
+type EvidenceBundle struct {
+	Incident     DetectedIncident `json:"incident"`
+	AgentIDs     []uint           `json:"agent_ids"`
+	CapturedAt   time.Time        `json:"captured_at"`
+	Before       EvidenceStats    `json:"before"`
+	After        EvidenceStats    `json:"after"`
+	WorstSamples []EvidenceSample `json:"worst_samples"`
+	Timeline     []EvidenceSample `json:"timeline"`
+	MTRTraces    []EvidenceTrace  `json:"mtr_traces"`
+}
+
+// CaptureIncidentEvidence stores a bundle for each warning or critical
+// incident in the analysis that has no bundle within evidenceRecapture.
+// ClickHouse read failures are logged per incident and skip only that
+// incident. Gated by the incident_evidence feature flag.
+func CaptureIncidentEvidence(ctx context.Context, ch *sql.DB, pg *gorm.DB, analysis *WorkspaceAnalysis) error {
+	if analysis == nil || len(analysis.Incidents) == 0 || !features.Enabled(ctx, analysis.WorkspaceID, features.IncidentEvidence) {
+		return nil
+	}
+
+	agentIDByName := make(map[string]uint, len(analysis.Agents))
+	for _, a := range analysis.Agents {
+		agentIDByName[a.AgentName] = a.AgentID
+	}
+
+	for _, inc := range analysis.Incidents {
+		if inc.Severity != "warning" && inc.Severity != "critical" {
+			continue
+		}
+		var recent int64
+		if err := pg.WithContext(ctx).Model(&IncidentEvidence{}).
+			Where("workspace_id = ? AND incident_id = ? AND created_at > ?", analysis.WorkspaceID, inc.ID, analysis.GeneratedAt.Add(-evidenceRecapture)).
+			Count(&recent).Error; err != nil {
+			return fmt.Errorf("check evidence: %w", err)
+		}
+		if recent > 0 {
+			continue
+		}
+
+		var agentIDs []uint
+		for _, name := range inc.AffectedAgents {
+			if id, ok := agentIDByName[name]; ok {
+				agentIDs = append(agentIDs, id)
+			}
+		}
+		bundle, err := buildEvidenceBundle(ctx, ch, inc, agentIDs, analysis.GeneratedAt)
+		if err != nil {
+			log.Warnf("[evidence] workspace %d incident %s: %v", analysis.WorkspaceID, inc.ID, err)
+			continue
+		}
+		raw, err := json.Marshal(bundle)
+		if err != nil {
+			continue
+		}
+		row := IncidentEvidence{
+			WorkspaceID: analysis.WorkspaceID,
+			IncidentID:  inc.ID,
+			Severity:    inc.Severity,
+			Title:       inc.Title,
+			SizeBytes:   len(raw),
+			Bundle:      datatypes.JSON(raw),
+		}
+		if err := pg.WithContext(ctx).Create(&row).Error; err != nil {
+			return fmt.Errorf("save evidence: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListIncidentEvidence returns bundle metadata for a workspace, newest
+// first, without the bundles themselves. incidentID filters when set.
+func ListIncidentEvidence(ctx context.Context, db *gorm.DB, workspaceID uint, incidentID string, limit int) ([]IncidentEvidence, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := db.WithContext(ctx).Omit("bundle").Where("workspace_id = ?", workspaceID)
+	if incidentID != "" {
+		q = q.Where("incident_id = ?", incidentID)
+	}
+	var out []IncidentEvidence
+	err := q.Order("created_at DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+// GetIncidentEvidence loads one bundle scoped to its workspace.
+func GetIncidentEvidence(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*IncidentEvidence, error) {
+	var row IncidentEvidence
+	err := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// buildEvidenceBundle reads the incident window plus an equally long
+// window before it. Incidents without resolvable agents (e.g.
+// infrastructure-wide) keep only the incident itself.
+func buildEvidenceBundle(ctx context.Context, ch *sql.DB, inc DetectedIncident, agentIDs []uint, now time.Time) (*EvidenceBundle, error) {
+	lookback := inc.LookbackMinutes
+	if lookback <= 0 {
+		lookback = 60
+	}
+	window := time.Duration(lookback) * time.Minute
+	start := now.Add(-window)
+	beforeStart := start.Add(-window)
+
+	bundle := &EvidenceBundle{
+		Incident:     inc,
+		AgentIDs:     agentIDs,
+		CapturedAt:   now,
+		Before:       EvidenceStats{From: beforeStart, To: start},
+		After:        EvidenceStats{From: start, To: now},
+		WorstSamples: []EvidenceSample{},
+		Timeline:     []EvidenceSample{},
+		MTRTraces:    []EvidenceTrace{},
+	}
+	if ch == nil || len(agentIDs) == 0 {
+		return bundle, nil
+	}
+
+	targets := make(map[string]bool, len(inc.AffectedTargets))
+	for _, t := range inc.AffectedTargets {
+		targets[stripPort(t)] = true
+	}
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	idList := strings.Join(ids, ", ")
+
+	samples, err := queryEvidencePing(ctx, ch, idList, targets, beforeStart, now)
+	if err != nil {
+		return nil, fmt.Errorf("ping samples: %w", err)
+	}
+	var before, after []EvidenceSample
+	for _, s := range samples {
+		if s.Time.Before(start) {
+			before = append(before, s)
+		} else {
+			after = append(after, s)
+		}
+	}
+	fillEvidenceStats(&bundle.Before, before)
+	fillEvidenceStats(&bundle.After, after)
+	bundle.WorstSamples = worstEvidenceSamples(after, evidenceWorstSamples)
+	bundle.Timeline = evidenceTimeline(samples, evidenceTimelineMax)
+
+	traces, err := queryEvidenceMTR(ctx, ch, idList, targets, start, evidenceMTRTraces)
+	if err != nil {
+		return nil, fmt.Errorf("mtr traces: %w", err)
+	}
+	bundle.MTRTraces = traces
+	return bundle, nil
+}
+
+// queryEvidencePing returns PING samples for the agents, chronologically.
+// Targets are matched in Go so target strings never reach the SQL.
+func queryEvidencePing(ctx context.Context, ch *sql.DB, idList string, targets map[string]bool, from, to time.Time) ([]EvidenceSample, error) {
+	q := fmt.Sprintf(`
+SELECT agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE type = 'PING'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at <= %s
+ORDER BY created_at ASC
+LIMIT %d
+`, idList, chQuoteTime(from), chQuoteTime(to), evidenceRowLimit)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvidenceSample
+	for rows.Next() {
+		var agentID uint64
+		var target, payloadRaw string
+		var createdAt time.Time
+		if err := rows.Scan(&agentID, &target, &createdAt, &payloadRaw); err != nil {
+			continue
+		}
+		if len(targets) > 0 && !targets[stripPort(target)] {
+			continue
+		}
+		payload, err := ParsePingPayload([]byte(payloadRaw))
+		if err != nil {
+			continue
+		}
+		out = append(out, EvidenceSample{
+			Time:       createdAt.UTC(),
+			AgentID:    uint(agentID),
+			Target:     target,
+			AvgLatency: sanitizeFloat(float64(payload.AvgRtt) / 1e6),
+			MaxLatency: sanitizeFloat(float64(payload.MaxRtt) / 1e6),
+			PacketLoss: sanitizeFloat(payload.PacketLoss),
+		})
+	}
+	return out, rows.Err()
+}
+
+// queryEvidenceMTR returns up to limit of the newest MTR traces.
+func queryEvidenceMTR(ctx context.Context, ch *sql.DB, idList string, targets map[string]bool, from time.Time, limit int) ([]EvidenceTrace, error) {
+	q := fmt.Sprintf(`
+SELECT agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE type = 'MTR'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+ORDER BY created_at DESC
+LIMIT 200
+`, idList, chQuoteTime(from))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []EvidenceTrace{}
+	for rows.Next() && len(out) < limit {
+		var agentID uint64
+		var target, payloadRaw string
+		var createdAt time.Time
+		if err := rows.Scan(&agentID, &target, &createdAt, &payloadRaw); err != nil {
+			continue
+		}
+		if len(targets) > 0 && !targets[stripPort(target)] {
+			continue
+		}
+		if !json.Valid([]byte(payloadRaw)) {
+			continue
+		}
+		out = append(out, EvidenceTrace{
+			Time:    createdAt.UTC(),
+			AgentID: uint(agentID),
+			Target:  target,
+			Payload: json.RawMessage(payloadRaw),
+		})
+	}
+	return out, rows.Err()
+}
+
+func fillEvidenceStats(st *EvidenceStats, samples []EvidenceSample) {
+	st.Samples = len(samples)
+	if len(samples) == 0 {
+		return
+	}
+	lat := make([]float64, len(samples))
+	var sumLat, sumLoss float64
+	for i, s := range samples {
+		lat[i] = s.AvgLatency
+		sumLat += s.AvgLatency
+		sumLoss += s.PacketLoss
+	}
+	n := float64(len(samples))
+	st.AvgLatency = math.Round(sumLat/n*100) / 100
+	st.P95Latency = computeLatencyPercentiles(lat).P95
+	st.PacketLoss = math.Round(sumLoss/n*100) / 100
+}
+
+// worstEvidenceSamples ranks by loss, then latency.
+func worstEvidenceSamples(samples []EvidenceSample, n int) []EvidenceSample {
+	out := append([]EvidenceSample(nil), samples...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].PacketLoss != out[j].PacketLoss {
+			return out[i].PacketLoss > out[j].PacketLoss
+		}
+		return out[i].AvgLatency > out[j].AvgLatency
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	if out == nil {
+		out = []EvidenceSample{}
+	}
+	return out
+}
+
+// evidenceTimeline evenly thins chronological samples to at most n.
+func evidenceTimeline(samples []EvidenceSample, n int) []EvidenceSample {
+	if len(samples) <= n {
+		return append([]EvidenceSample{}, samples...)
+	}
+	out := make([]EvidenceSample, 0, n)
+	step := float64(len(samples)) / float64(n)
+	for i := 0; i < n; i++ {
+		out = append(out, samples[int(float64(i)*step)])
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestWorstEvidenceSamples verifies ranking by loss, then latency, and
+// the cap on returned samples.
+func TestWorstEvidenceSamples(t *testing.T) {
+	samples := []EvidenceSample{
+		{AgentID: 1, AvgLatency: 80},
+		{AgentID: 2, AvgLatency: 20, PacketLoss: 10},
+		{AgentID: 3, AvgLatency: 40, PacketLoss: 10},
+		{AgentID: 4, AvgLatency: 10},
+	}
+	got := worstEvidenceSamples(samples, 3)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(got))
+	}
+	want := []uint{3, 2, 1}
+	for i, id := range want {
+		if got[i].AgentID != id {
+			t.Errorf("position %d: got agent %d, want %d", i, got[i].AgentID, id)
+		}
+	}
+	if samples[0].AgentID != 1 {
+		t.Error("input slice was reordered")
+	}
+	if out := worstEvidenceSamples(nil, 3); out == nil {
+		t.Error("expected empty slice, got nil")
+	}
+}
+
+func TestEvidenceTimelineThinning(t *testing.T) {
+	start := time.Now()
+	samples := make([]EvidenceSample, 1000)
+	for i := range samples {
+		samples[i] = EvidenceSample{Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	got := evidenceTimeline(samples, 240)
+	if len(got) != 240 {
+		t.Fatalf("expected 240 points, got %d", len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i].Time.After(got[i-1].Time) {
+			t.Fatalf("timeline not chronological at %d", i)
+		}
+	}
+}
+
+// TestBuildEvidenceBundleWithoutAgents verifies incidents with no
+// resolvable agents still produce a bundle without touching ClickHouse.
+func TestBuildEvidenceBundleWithoutAgents(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	inc := DetectedIncident{ID: "infra", Severity: "critical", LookbackMinutes: 30}
+	b, err := buildEvidenceBundle(context.Background(), nil, inc, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Incident.ID != "infra" || b.After.From != now.Add(-30*time.Minute) || b.Before.From != now.Add(-time.Hour) {
+		t.Errorf("unexpected windows: before=%v after=%v", b.Before, b.After)
+	}
+	if b.WorstSamples == nil || b.MTRTraces == nil {
+		t.Error("expected empty slices for JSON, got nil")
+	}
+}
+
+func TestFillEvidenceStats(t *testing.T) {
+	var st EvidenceStats
+	fillEvidenceStats(&st, []EvidenceSample{{AvgLatency: 10, PacketLoss: 0}, {AvgLatency: 20, PacketLoss: 5}})
+	if st.Samples != 2 || st.AvgLatency != 15 || st.PacketLoss != 2.5 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+}
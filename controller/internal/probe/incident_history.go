@@ -0,0 +1,348 @@
+package probe
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/settings"
+	"netwatcher-controller/internal/sqlsafe"
+)
+
+// ── Incident History ──
+//
+// Analysis snapshots hold the incidents open at each run, which answers
+// "what is wrong now" but not "what went wrong last week". The analysis
+// loop records each incident run as one row here: opened when an incident
+// first appears, updated while it stays open (severity and impact keep
+// their peak, affected agents and targets accumulate), and resolved once it
+// has been absent for INCIDENT_STABILIZATION_MINUTES (default 0: the first
+// run it is absent from). Until then the row stays open with ClearedAt set,
+// and an incident that returns in that window continues the same row
+// instead of flapping. An incident that reopens after resolving gets a new
+// row.
+//
+// Resolving closes the alerts raised for the incident and sends their
+// rules a recovery notification with the duration and peak impact.
+
+const (
+	IncidentStatusOpen     = "open"
+	IncidentStatusResolved = "resolved"
+)
+
+// IncidentRecord is one run of a detected incident, from open to resolve.
+type IncidentRecord struct {
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	WorkspaceID     uint           `gorm:"not null;index:idx_incident_history_ws_status" json:"workspace_id"`
+	IncidentID      string         `gorm:"size:255;not null;index" json:"incident_id"`
+	Status          string         `gorm:"size:16;not null;index:idx_incident_history_ws_status" json:"status"`
+	Title           string         `gorm:"size:512" json:"title"`
+	Severity        string         `gorm:"size:16;index" json:"severity"` // peak severity
+	Scope           string         `gorm:"size:32" json:"scope"`
+	SuggestedCause  string         `gorm:"type:text" json:"suggested_cause"`
+	AffectedAgents  datatypes.JSON `gorm:"type:jsonb" json:"affected_agents"`  // []string
+	AffectedTargets datatypes.JSON `gorm:"type:jsonb" json:"affected_targets"` // []string
+	ImpactScore     float64        `json:"impact_score"`                       // peak impact
+	Criticality     string         `gorm:"size:16" json:"criticality,omitempty"`
+	OpenedAt        time.Time      `gorm:"not null;index" json:"opened_at"`
+	LastSeenAt      time.Time      `json:"last_seen_at"`
+	ClearedAt       *time.Time     `json:"cleared_at,omitempty"` // absent since; resolves after the stabilization period
+	ResolvedAt      *time.Time     `json:"resolved_at,omitempty"`
+}
+
+func (IncidentRecord) TableName() string { return "incident_history" }
+
+const defaultIncidentStabilization = 0
+
+// incidentStabilization reads INCIDENT_STABILIZATION_MINUTES. It is read
+// per analysis, so runtime overrides apply to the next run.
+func incidentStabilization() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(settings.Getenv("INCIDENT_STABILIZATION_MINUTES"))); err == nil && n >= 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return defaultIncidentStabilization
+}
+
+// DurationMinutes is how long the incident has been (or was) open.
+func (r IncidentRecord) DurationMinutes() int {
+	end := r.LastSeenAt
+	if r.ResolvedAt != nil {
+		end = *r.ResolvedAt
+	}
+	return int(end.Sub(r.OpenedAt).Minutes())
+}
+
+// RecordIncidentHistory updates the workspace's incident history with one
+// analysis run: open rows for new incidents, peaks and last-seen for
+// ongoing ones, and resolves open rows whose incident has stayed gone for
+// the stabilization period, notifying recovery for each.
+func RecordIncidentHistory(ctx context.Context, pg *gorm.DB, analysis *WorkspaceAnalysis) error {
+	if analysis == nil || analysis.WorkspaceID == 0 {
+		return nil
+	}
+	now := analysis.GeneratedAt
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	var open []IncidentRecord
+	if err := pg.WithContext(ctx).
+		Where("workspace_id = ? AND status = ?", analysis.WorkspaceID, IncidentStatusOpen).
+		Find(&open).Error; err != nil {
+		return fmt.Errorf("load open incidents: %w", err)
+	}
+	openByID := make(map[string]*IncidentRecord, len(open))
+	for i := range open {
+		openByID[open[i].IncidentID] = &open[i]
+	}
+
+	stabilization := incidentStabilization()
+	var recovered []IncidentRecord
+	err := pg.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seen := make(map[string]bool, len(analysis.Incidents))
+		for _, inc := range analysis.Incidents {
+			seen[inc.ID] = true
+			row, ok := openByID[inc.ID]
+			if !ok {
+				opened := now
+				if inc.FirstSeenAt != nil && !inc.FirstSeenAt.IsZero() {
+					opened = *inc.FirstSeenAt
+				}
+				row = &IncidentRecord{
+					WorkspaceID: analysis.WorkspaceID,
+					IncidentID:  inc.ID,
+					Status:      IncidentStatusOpen,
+					OpenedAt:    opened,
+				}
+			}
+			if inc.Title != "" {
+				row.Title = inc.Title
+			}
+			if inc.Scope != "" {
+				row.Scope = inc.Scope
+			}
+			if inc.SuggestedCause != "" {
+				row.SuggestedCause = inc.SuggestedCause
+			}
+			row.LastSeenAt = now
+			row.ClearedAt = nil
+			if !ok || severityImpact[inc.Severity] > severityImpact[row.Severity] {
+				row.Severity = inc.Severity
+			}
+			if inc.ImpactScore > row.ImpactScore {
+				row.ImpactScore = inc.ImpactScore
+				row.Criticality = inc.Criticality
+			}
+			row.AffectedAgents = mergeJSONStrings(row.AffectedAgents, inc.AffectedAgents)
+			row.AffectedTargets = mergeJSONStrings(row.AffectedTargets, inc.AffectedTargets)
+			if err := tx.Save(row).Error; err != nil {
+				return fmt.Errorf("save incident %s: %w", inc.ID, err)
+			}
+		}
+
+		// A partial analysis may have skipped the work that would have
+		// seen an open incident, so only a complete one resolves.
+		for id, row := range openByID {
+			if seen[id] || analysis.Partial {
+				continue
+			}
+			if row.ClearedAt == nil {
+				cleared := now
+				row.ClearedAt = &cleared
+				if err := tx.Model(&IncidentRecord{}).Where("id = ?", row.ID).
+					Update("cleared_at", cleared).Error; err != nil {
+					return fmt.Errorf("clear incident %s: %w", id, err)
+				}
+			}
+			if now.Sub(*row.ClearedAt) < stabilization {
+				continue
+			}
+			// Resolved as of when it cleared, so the duration excludes
+			// the stabilization wait.
+			if err := tx.Model(&IncidentRecord{}).Where("id = ?", row.ID).
+				Updates(map[string]any{"status": IncidentStatusResolved, "resolved_at": *row.ClearedAt}).Error; err != nil {
+				return fmt.Errorf("resolve incident %s: %w", id, err)
+			}
+			row.Status, row.ResolvedAt = IncidentStatusResolved, row.ClearedAt
+			recovered = append(recovered, *row)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, row := range recovered {
+		notifyIncidentRecovery(ctx, pg, row)
+	}
+	return nil
+}
+
+// notifyIncidentRecovery resolves the alerts raised for a resolved
+// incident and sends their recovery notifications.
+func notifyIncidentRecovery(ctx context.Context, pg *gorm.DB, row IncidentRecord) {
+	rec := alert.Recovery{
+		OpenedAt:        row.OpenedAt,
+		RecoveredAt:     *row.ResolvedAt,
+		DurationSeconds: int64(row.ResolvedAt.Sub(row.OpenedAt) / time.Second),
+		PeakSeverity:    row.Severity,
+		PeakImpact:      row.ImpactScore,
+	}
+	n, err := alert.RecoverAlerts(ctx, pg, row.WorkspaceID, incidentDedupKey(row.IncidentID), rec)
+	if err != nil {
+		analysisLog.Warnf("[incident_history] recover alerts for %s (workspace %d): %v", row.IncidentID, row.WorkspaceID, err)
+		return
+	}
+	analysisLog.Debugf("[incident_history] incident %s resolved after %ds (%d alerts recovered)", row.IncidentID, rec.DurationSeconds, n)
+}
+
+// mergeJSONStrings returns the sorted union of a JSON string array and add.
+func mergeJSONStrings(existing datatypes.JSON, add []string) datatypes.JSON {
+	var cur []string
+	if len(existing) > 0 {
+		_ = json.Unmarshal(existing, &cur)
+	}
+	set := make(map[string]bool, len(cur)+len(add))
+	for _, s := range append(cur, add...) {
+		if s != "" {
+			set[s] = true
+		}
+	}
+	out := make([]string, 0, len(set))
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	raw, _ := json.Marshal(out)
+	return datatypes.JSON(raw)
+}
+
+// IncidentHistoryQuery filters and pages the incident history. Zero values
+// match everything.
+type IncidentHistoryQuery struct {
+	WorkspaceID uint
+	Status      string // open, resolved
+	Severity    string
+	Scope       string
+	Agent       string // affected agent name
+	Target      string // affected target; "host" also matches "host:port"
+	From        time.Time
+	To          time.Time
+	Sort        string // opened_at (default, newest first) or impact
+	Limit       int
+	Offset      int
+}
+
+// ListIncidentHistory returns one page of incidents matching q and the
+// total number that match. Incidents overlapping [From, To] are included,
+// so one still open when the range starts is listed.
+func ListIncidentHistory(ctx context.Context, db *gorm.DB, q IncidentHistoryQuery) ([]IncidentRecord, int64, error) {
+	switch q.Status {
+	case "", IncidentStatusOpen, IncidentStatusResolved:
+	default:
+		return nil, 0, fmt.Errorf("%w: status must be open or resolved", ErrBadInput)
+	}
+	order := "opened_at DESC, id DESC"
+	switch q.Sort {
+	case "", "opened_at":
+	case "impact":
+		order = "impact_score DESC, opened_at DESC, id DESC"
+	default:
+		return nil, 0, fmt.Errorf("%w: sort must be opened_at or impact", ErrBadInput)
+	}
+
+	tx := db.WithContext(ctx).Model(&IncidentRecord{}).Where("workspace_id = ?", q.WorkspaceID)
+	if q.Status != "" {
+		tx = tx.Where("status = ?", q.Status)
+	}
+	if q.Severity != "" {
+		tx = tx.Where("severity = ?", q.Severity)
+	}
+	if q.Scope != "" {
+		tx = tx.Where("scope = ?", q.Scope)
+	}
+	// The arrays are matched on their JSON text so the filter works the
+	// same on Postgres jsonb and SQLite. Values are escaped so % and _
+	// match literally.
+	if q.Agent != "" {
+		quoted, _ := json.Marshal(q.Agent)
+		tx = tx.Where(`CAST(affected_agents AS TEXT) LIKE ? ESCAPE '\'`, "%"+sqlsafe.EscapeLike(string(quoted))+"%")
+	}
+	if q.Target != "" {
+		quoted, _ := json.Marshal(q.Target)
+		prefix := strings.TrimSuffix(string(quoted), `"`)
+		tx = tx.Where(`(CAST(affected_targets AS TEXT) LIKE ? ESCAPE '\' OR CAST(affected_targets AS TEXT) LIKE ? ESCAPE '\')`,
+			"%"+sqlsafe.EscapeLike(string(quoted))+"%", "%"+sqlsafe.EscapeLike(prefix)+":%")
+	}
+	if !q.From.IsZero() {
+		tx = tx.Where("(resolved_at IS NULL OR resolved_at >= ?)", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("opened_at <= ?", q.To)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []IncidentRecord
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	if err := tx.Order(order).Offset(q.Offset).Find(&out).Error; err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// WriteIncidentHistoryCSV writes incidents as CSV, one row each. Affected
+// agents and targets are joined with "; ".
+func WriteIncidentHistoryCSV(w io.Writer, rows []IncidentRecord) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"id", "incident_id", "status", "severity", "scope", "title", "impact_score",
+		"criticality", "opened_at", "resolved_at", "duration_minutes",
+		"affected_agents", "affected_targets", "suggested_cause",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		var agents, targets []string
+		_ = json.Unmarshal(r.AffectedAgents, &agents)
+		_ = json.Unmarshal(r.AffectedTargets, &targets)
+		resolved := ""
+		if r.ResolvedAt != nil {
+			resolved = r.ResolvedAt.UTC().Format(time.RFC3339)
+		}
+		if err := cw.Write([]string{
+			strconv.FormatUint(uint64(r.ID), 10),
+			r.IncidentID,
+			r.Status,
+			r.Severity,
+			r.Scope,
+			r.Title,
+			strconv.FormatFloat(r.ImpactScore, 'f', 1, 64),
+			r.Criticality,
+			r.OpenedAt.UTC().Format(time.RFC3339),
+			resolved,
+			strconv.Itoa(r.DurationMinutes()),
+			strings.Join(agents, "; "),
+			strings.Join(targets, "; "),
+			r.SuggestedCause,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,162 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/alert"
+)
+
+// TestRecordIncidentHistory verifies an incident run is opened once,
+// keeps its peaks while open, resolves when gone and reopens as a new row.
+func TestRecordIncidentHistory(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&IncidentRecord{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	run := func(at time.Time, incs ...DetectedIncident) {
+		t.Helper()
+		if err := RecordIncidentHistory(ctx, db, &WorkspaceAnalysis{WorkspaceID: 4, GeneratedAt: at, Incidents: incs}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	run(t0,
+		DetectedIncident{ID: "loss_1", Severity: "critical", Scope: "agent-specific", ImpactScore: 70, AffectedAgents: []string{"hq"}, AffectedTargets: []string{"1.1.1.1:443"}},
+		DetectedIncident{ID: "latency_1", Severity: "warning", Scope: "infrastructure", ImpactScore: 20},
+	)
+	run(t0.Add(5*time.Minute),
+		DetectedIncident{ID: "loss_1", Severity: "warning", ImpactScore: 40, AffectedAgents: []string{"branch"}},
+	)
+
+	rows, total, err := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Sort: "impact"})
+	if err != nil || total != 2 {
+		t.Fatalf("list = %d, %v", total, err)
+	}
+	loss := rows[0]
+	if loss.IncidentID != "loss_1" || loss.Status != IncidentStatusOpen {
+		t.Fatalf("first by impact = %+v", loss)
+	}
+	if loss.Severity != "critical" || loss.ImpactScore != 70 {
+		t.Errorf("peaks = %s/%.0f, want critical/70", loss.Severity, loss.ImpactScore)
+	}
+	if string(loss.AffectedAgents) != `["branch","hq"]` {
+		t.Errorf("agents = %s", loss.AffectedAgents)
+	}
+	if rows[1].Status != IncidentStatusResolved || rows[1].DurationMinutes() != 5 {
+		t.Errorf("latency = %s after %d min, want resolved after 5", rows[1].Status, rows[1].DurationMinutes())
+	}
+
+	// Filters.
+	for name, q := range map[string]IncidentHistoryQuery{
+		"agent":    {Agent: "hq"},
+		"target":   {Target: "1.1.1.1"},
+		"severity": {Severity: "critical"},
+		"status":   {Status: IncidentStatusOpen},
+		"scope":    {Scope: "agent-specific"},
+	} {
+		q.WorkspaceID = 4
+		if _, n, err := ListIncidentHistory(ctx, db, q); err != nil || n != 1 {
+			t.Errorf("%s filter = %d, %v, want 1", name, n, err)
+		}
+	}
+	for _, q := range []IncidentHistoryQuery{{Agent: "h_"}, {Agent: "%"}, {Target: "1.1.1._"}, {Target: "%"}} {
+		q.WorkspaceID = 4
+		if _, n, err := ListIncidentHistory(ctx, db, q); err != nil || n != 0 {
+			t.Errorf("wildcard filter %+v = %d, %v, want 0", q, n, err)
+		}
+	}
+	if _, n, _ := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, From: t0.Add(time.Hour)}); n != 1 {
+		t.Errorf("from filter = %d, want only the open incident", n)
+	}
+	if _, _, err := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Sort: "name"}); err == nil {
+		t.Error("unknown sort should fail")
+	}
+
+	// Resolve and reopen.
+	run(t0.Add(10 * time.Minute))
+	run(t0.Add(15*time.Minute), DetectedIncident{ID: "loss_1", Severity: "warning"})
+	if _, n, _ := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Agent: "hq", Status: IncidentStatusResolved}); n != 1 {
+		t.Errorf("resolved loss_1 runs = %d, want 1", n)
+	}
+	rows, total, _ = ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4, Limit: 1})
+	if total != 3 || len(rows) != 1 || rows[0].Status != IncidentStatusOpen {
+		t.Errorf("newest = %+v of %d", rows, total)
+	}
+
+	var buf bytes.Buffer
+	all, _, _ := ListIncidentHistory(ctx, db, IncidentHistoryQuery{WorkspaceID: 4})
+	if err := WriteIncidentHistoryCSV(&buf, all); err != nil {
+		t.Fatalf("csv: %v", err)
+	}
+	recs, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(recs) != 4 {
+		t.Fatalf("csv rows = %d, %v", len(recs), err)
+	}
+	if !strings.Contains(strings.Join(recs[3], ","), "branch; hq") {
+		t.Errorf("oldest row = %v", recs[3])
+	}
+}
+
+// TestIncidentStabilization verifies an incident only resolves after
+// staying clear for INCIDENT_STABILIZATION_MINUTES, that a return within
+// the window continues the same row, and that resolving closes the
+// incident's alerts.
+func TestIncidentStabilization(t *testing.T) {
+	t.Setenv("INCIDENT_STABILIZATION_MINUTES", "10")
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&IncidentRecord{}, &alert.AlertRule{}, &alert.Alert{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	rule := alert.AlertRule{WorkspaceID: 4, Name: "loss", Metric: alert.MetricLossBaseline, Severity: alert.SeverityWarning, Enabled: true}
+	if err := db.Create(&rule).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&alert.Alert{AlertRuleID: rule.ID, WorkspaceID: 4, Status: alert.StatusActive, DedupKey: incidentDedupKey("loss_1")}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	run := func(at time.Time, incs ...DetectedIncident) IncidentRecord {
+		t.Helper()
+		if err := RecordIncidentHistory(ctx, db, &WorkspaceAnalysis{WorkspaceID: 4, GeneratedAt: at, Incidents: incs}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+		var rows []IncidentRecord
+		db.Order("id").Find(&rows)
+		if len(rows) != 1 {
+			t.Fatalf("rows = %d, want one run", len(rows))
+		}
+		return rows[0]
+	}
+	inc := DetectedIncident{ID: "loss_1", Severity: "critical", ImpactScore: 60}
+
+	run(t0, inc)
+	if r := run(t0.Add(5 * time.Minute)); r.Status != IncidentStatusOpen || r.ClearedAt == nil {
+		t.Fatalf("after first clear run = %+v, want open and cleared", r)
+	}
+	if r := run(t0.Add(10*time.Minute), inc); r.ClearedAt != nil {
+		t.Fatalf("returned within window: cleared_at = %v, want reset", r.ClearedAt)
+	}
+	run(t0.Add(15 * time.Minute))
+	if r := run(t0.Add(20 * time.Minute)); r.Status != IncidentStatusOpen {
+		t.Fatalf("5 min clear = %s, want still open", r.Status)
+	}
+	r := run(t0.Add(25 * time.Minute))
+	if r.Status != IncidentStatusResolved || r.DurationMinutes() != 15 {
+		t.Fatalf("10 min clear = %s after %d min, want resolved after 15", r.Status, r.DurationMinutes())
+	}
+
+	var a alert.Alert
+	db.First(&a)
+	if a.Status != alert.StatusResolved || a.ResolvedAt == nil || !a.ResolvedAt.Equal(t0.Add(15*time.Minute)) {
+		t.Errorf("incident alert = %s at %v, want resolved at the clear time", a.Status, a.ResolvedAt)
+	}
+}
@@ -0,0 +1,230 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/features"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Incident Map Snapshots ──
+//
+// The network map is built from the last hour of MTR/PING data, so once
+// routes recover the path an incident took is gone from it. When a
+// critical incident opens, the analysis loop stores the part of the map
+// covering the incident's agents and targets in Postgres, linked to the
+// incident ID, so the topology as it was can be reviewed afterwards.
+//
+// One snapshot is taken per incident run: an incident that stays open is
+// not re-captured, one that resolves and reopens is. Gated by the
+// incident_evidence feature flag, like evidence bundles.
+
+// IncidentMapSnapshot is the network map around one incident when it
+// opened.
+type IncidentMapSnapshot struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time      `gorm:"index" json:"created_at"`
+	WorkspaceID uint           `gorm:"not null;index:idx_incident_map_ws_incident" json:"workspace_id"`
+	IncidentID  string         `gorm:"size:255;not null;index:idx_incident_map_ws_incident" json:"incident_id"`
+	Severity    string         `gorm:"size:16" json:"severity"`
+	Title       string         `gorm:"size:512" json:"title"`
+	NodeCount   int            `json:"node_count"`
+	EdgeCount   int            `json:"edge_count"`
+	Map         datatypes.JSON `gorm:"type:jsonb" json:"map,omitempty"` // NetworkMapData
+}
+
+func (IncidentMapSnapshot) TableName() string { return "incident_map_snapshots" }
+
+// mapSnapshotRecapture bounds how far back an existing snapshot counts for
+// incidents without a known start.
+const mapSnapshotRecapture = 6 * time.Hour
+
+// CaptureIncidentMapSnapshots stores a map snapshot for each critical
+// incident in the analysis that has none since it opened. The workspace
+// map is built at most once per call, and only when needed.
+func CaptureIncidentMapSnapshots(ctx context.Context, ch *sql.DB, pg *gorm.DB, analysis *WorkspaceAnalysis) error {
+	if analysis == nil || len(analysis.Incidents) == 0 || !features.Enabled(ctx, analysis.WorkspaceID, features.IncidentEvidence) {
+		return nil
+	}
+
+	agentIDByName := make(map[string]uint, len(analysis.Agents))
+	for _, a := range analysis.Agents {
+		agentIDByName[a.AgentName] = a.AgentID
+	}
+
+	var full *NetworkMapData
+	for _, inc := range analysis.Incidents {
+		if inc.Severity != "critical" {
+			continue
+		}
+		since := analysis.GeneratedAt.Add(-mapSnapshotRecapture)
+		if inc.FirstSeenAt != nil {
+			since = *inc.FirstSeenAt
+		}
+		var existing int64
+		if err := pg.WithContext(ctx).Model(&IncidentMapSnapshot{}).
+			Where("workspace_id = ? AND incident_id = ? AND created_at >= ?", analysis.WorkspaceID, inc.ID, since).
+			Count(&existing).Error; err != nil {
+			return fmt.Errorf("check map snapshot: %w", err)
+		}
+		if existing > 0 {
+			continue
+		}
+
+		if full == nil {
+			m, err := GetWorkspaceNetworkMap(ctx, ch, pg, analysis.WorkspaceID, 60)
+			if err != nil {
+				return fmt.Errorf("build network map: %w", err)
+			}
+			full = m
+		}
+		var agentIDs []uint
+		for _, name := range inc.AffectedAgents {
+			if id, ok := agentIDByName[name]; ok {
+				agentIDs = append(agentIDs, id)
+			}
+		}
+		sub := incidentSubMap(full, agentIDs, inc.AffectedTargets)
+		raw, err := json.Marshal(sub)
+		if err != nil {
+			continue
+		}
+		row := IncidentMapSnapshot{
+			WorkspaceID: analysis.WorkspaceID,
+			IncidentID:  inc.ID,
+			Severity:    inc.Severity,
+			Title:       inc.Title,
+			NodeCount:   len(sub.Nodes),
+			EdgeCount:   len(sub.Edges),
+			Map:         datatypes.JSON(raw),
+		}
+		if err := pg.WithContext(ctx).Create(&row).Error; err != nil {
+			return fmt.Errorf("save map snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// incidentSubMap returns the part of m on paths from the agents to the
+// targets. Either list may be empty to match all; when both are, the whole
+// map is kept (infrastructure-wide incidents).
+func incidentSubMap(m *NetworkMapData, agentIDs []uint, targets []string) *NetworkMapData {
+	out := &NetworkMapData{
+		Nodes:        []NetworkMapNode{},
+		Edges:        []NetworkMapEdge{},
+		Destinations: []DestinationSummary{},
+		GeneratedAt:  m.GeneratedAt,
+		WorkspaceID:  m.WorkspaceID,
+	}
+	if len(agentIDs) == 0 && len(targets) == 0 {
+		out.Nodes, out.Edges, out.Destinations = m.Nodes, m.Edges, m.Destinations
+		return out
+	}
+
+	agentNode := make(map[string]bool, len(agentIDs))
+	agentPrefix := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		agentNode[fmt.Sprintf("agent:%d", id)] = true
+		agentPrefix[i] = fmt.Sprintf("%d:", id)
+	}
+	// Destinations are keyed by target (or "agent:N"); incidents name them
+	// by target or, for agent targets, by label.
+	wantTarget := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		wantTarget[stripPort(t)] = true
+	}
+	destLabel := make(map[string]string)
+	for _, n := range m.Nodes {
+		if n.Type == "destination" || n.Type == "agent" {
+			destLabel[n.ID] = n.Label
+		}
+	}
+	targetMatch := func(dest string) bool {
+		return len(wantTarget) == 0 || wantTarget[stripPort(dest)] || wantTarget[destLabel[dest]]
+	}
+	pathMatch := func(pathID string) bool {
+		rest := pathID
+		if len(agentPrefix) > 0 {
+			found := false
+			for _, p := range agentPrefix {
+				if strings.HasPrefix(pathID, p) {
+					rest, found = strings.TrimPrefix(pathID, p), true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		} else if i := strings.Index(pathID, ":"); i >= 0 {
+			rest = pathID[i+1:]
+		}
+		return targetMatch(rest)
+	}
+
+	keepNode := make(map[string]bool)
+	for _, e := range m.Edges {
+		keep := false
+		for _, p := range e.PathIDs {
+			if pathMatch(p) {
+				keep = true
+				break
+			}
+		}
+		// Direct agent→destination edges (PING/TrafficSim only) have no
+		// path IDs.
+		if len(e.PathIDs) == 0 && (len(agentNode) == 0 || agentNode[e.Source]) && strings.HasPrefix(e.Source, "agent:") && targetMatch(e.Target) {
+			keep = true
+		}
+		if keep {
+			out.Edges = append(out.Edges, e)
+			keepNode[e.Source], keepNode[e.Target] = true, true
+		}
+	}
+	for _, n := range m.Nodes {
+		if keepNode[n.ID] || agentNode[n.ID] {
+			out.Nodes = append(out.Nodes, n)
+		}
+	}
+	for _, d := range m.Destinations {
+		if keepNode[d.Target] {
+			out.Destinations = append(out.Destinations, d)
+		}
+	}
+	return out
+}
+
+// ListIncidentMapSnapshots returns snapshot metadata for a workspace,
+// newest first, without the maps. incidentID filters when set.
+func ListIncidentMapSnapshots(ctx context.Context, db *gorm.DB, workspaceID uint, incidentID string, limit int) ([]IncidentMapSnapshot, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := db.WithContext(ctx).Omit("map").Where("workspace_id = ?", workspaceID)
+	if incidentID != "" {
+		q = q.Where("incident_id = ?", incidentID)
+	}
+	var out []IncidentMapSnapshot
+	err := q.Order("created_at DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+// GetIncidentMapSnapshot loads one snapshot scoped to its workspace.
+func GetIncidentMapSnapshot(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*IncidentMapSnapshot, error) {
+	var row IncidentMapSnapshot
+	err := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
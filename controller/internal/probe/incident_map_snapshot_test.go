@@ -0,0 +1,104 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func ptrUint(v uint) *uint { return &v }
+
+// TestIncidentSubMap verifies only paths from the affected agents to the
+// affected targets are kept, including direct edges without path IDs.
+func TestIncidentSubMap(t *testing.T) {
+	m := &NetworkMapData{
+		WorkspaceID: 1,
+		Nodes: []NetworkMapNode{
+			{ID: "agent:1", Type: "agent", Label: "hq", AgentID: ptrUint(1)},
+			{ID: "agent:2", Type: "agent", Label: "branch", AgentID: ptrUint(2)},
+			{ID: "hop:10.0.0.1", Type: "hop"},
+			{ID: "hop:10.0.0.2", Type: "hop"},
+			{ID: "1.1.1.1", Type: "destination", Label: "1.1.1.1"},
+			{ID: "8.8.8.8", Type: "destination", Label: "8.8.8.8"},
+		},
+		Edges: []NetworkMapEdge{
+			{ID: "a", Source: "agent:1", Target: "hop:10.0.0.1", PathIDs: []string{"1:1.1.1.1", "1:8.8.8.8"}},
+			{ID: "b", Source: "hop:10.0.0.1", Target: "1.1.1.1", PathIDs: []string{"1:1.1.1.1"}},
+			{ID: "c", Source: "hop:10.0.0.1", Target: "8.8.8.8", PathIDs: []string{"1:8.8.8.8"}},
+			{ID: "d", Source: "agent:2", Target: "hop:10.0.0.2", PathIDs: []string{"2:1.1.1.1"}},
+			{ID: "e", Source: "hop:10.0.0.2", Target: "1.1.1.1", PathIDs: []string{"2:1.1.1.1"}},
+			{ID: "f", Source: "agent:1", Target: "1.1.1.1"}, // PING only
+		},
+		Destinations: []DestinationSummary{{Target: "1.1.1.1"}, {Target: "8.8.8.8"}},
+	}
+
+	sub := incidentSubMap(m, []uint{1}, []string{"1.1.1.1:443"})
+	edges := map[string]bool{}
+	for _, e := range sub.Edges {
+		edges[e.ID] = true
+	}
+	if len(edges) != 3 || !edges["a"] || !edges["b"] || !edges["f"] {
+		t.Errorf("edges = %v, want a, b, f", edges)
+	}
+	if len(sub.Nodes) != 3 {
+		t.Errorf("nodes = %d, want agent:1, hop:10.0.0.1, 1.1.1.1", len(sub.Nodes))
+	}
+	if len(sub.Destinations) != 1 || sub.Destinations[0].Target != "1.1.1.1" {
+		t.Errorf("destinations = %+v", sub.Destinations)
+	}
+
+	// Target only: both agents' paths to it.
+	if sub := incidentSubMap(m, nil, []string{"1.1.1.1"}); len(sub.Edges) != 5 {
+		t.Errorf("target-only edges = %d, want 5", len(sub.Edges))
+	}
+	// Neither: the whole map.
+	if sub := incidentSubMap(m, nil, nil); len(sub.Edges) != len(m.Edges) {
+		t.Errorf("infrastructure edges = %d, want %d", len(sub.Edges), len(m.Edges))
+	}
+}
+
+// TestCaptureIncidentMapSnapshots verifies one snapshot per incident run
+// and that non-critical incidents are skipped.
+func TestCaptureIncidentMapSnapshots(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&IncidentMapSnapshot{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	opened := time.Now().UTC().Add(-10 * time.Minute)
+	analysis := &WorkspaceAnalysis{
+		WorkspaceID: 9,
+		GeneratedAt: time.Now().UTC(),
+		Incidents: []DetectedIncident{
+			{ID: "loss_1", Severity: "critical", Title: "Loss", FirstSeenAt: &opened},
+			{ID: "latency_1", Severity: "warning"},
+		},
+	}
+	// The workspace has no agents, so the map is built without ClickHouse.
+	for i := 0; i < 2; i++ {
+		if err := CaptureIncidentMapSnapshots(ctx, nil, db, analysis); err != nil {
+			t.Fatalf("capture: %v", err)
+		}
+	}
+	list, err := ListIncidentMapSnapshots(ctx, db, 9, "", 0)
+	if err != nil || len(list) != 1 || list[0].IncidentID != "loss_1" {
+		t.Fatalf("snapshots = %+v, %v", list, err)
+	}
+	if list[0].Map != nil {
+		t.Error("list should omit the map")
+	}
+	row, err := GetIncidentMapSnapshot(ctx, db, 9, list[0].ID)
+	if err != nil || len(row.Map) == 0 {
+		t.Fatalf("get = %+v, %v", row, err)
+	}
+
+	// Reopened later: a new run gets a new snapshot.
+	reopened := time.Now().UTC().Add(time.Minute)
+	analysis.Incidents[0].FirstSeenAt = &reopened
+	if err := CaptureIncidentMapSnapshots(ctx, nil, db, analysis); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if list, _ := ListIncidentMapSnapshots(ctx, db, 9, "loss_1", 0); len(list) != 2 {
+		t.Errorf("after reopen: %d snapshots, want 2", len(list))
+	}
+}
@@ -0,0 +1,390 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/features"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ── Incident Samples ──
+//
+// Evidence bundles re-read an approximate window around an incident. To
+// answer "which samples triggered this" precisely, the analysis loop also
+// records references to the probe_data rows behind each incident run: the
+// PING and TRAFFICSIM cycles from the affected agents to the affected
+// targets that breached the detection thresholds (loss > 1% or latency >
+// 100ms). Each reference points at its incident_history row and carries
+// the probe_data key (type, probe_id, agent_id, target, created_at), so
+// the exact rows can be read back from ClickHouse. The headline latency
+// and loss are stored too, and survive the rows' TTL.
+
+const (
+	// incidentSampleMax caps the references kept per incident run.
+	incidentSampleMax = 2000
+	// incidentSampleLoss and incidentSampleLatency are the per-sample
+	// thresholds, matching the degraded-target criteria in detectIncidents.
+	incidentSampleLoss    = 1.0   // percent
+	incidentSampleLatency = 100.0 // ms
+)
+
+// IncidentSample references one probe_data row that contributed to an
+// incident run.
+type IncidentSample struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	IncidentRecordID uint      `gorm:"not null;uniqueIndex:idx_incident_samples_key" json:"incident_record_id"` // incident_history.id
+	WorkspaceID      uint      `gorm:"not null;index" json:"workspace_id"`
+	IncidentID       string    `gorm:"size:255;not null" json:"incident_id"`
+	Type             string    `gorm:"size:16;not null;uniqueIndex:idx_incident_samples_key" json:"type"`
+	ProbeID          uint      `gorm:"not null;uniqueIndex:idx_incident_samples_key" json:"probe_id"`
+	AgentID          uint      `gorm:"not null;uniqueIndex:idx_incident_samples_key" json:"agent_id"`
+	Target           string    `gorm:"size:255;not null;uniqueIndex:idx_incident_samples_key" json:"target"`
+	SampleAt         time.Time `gorm:"not null;uniqueIndex:idx_incident_samples_key" json:"sample_at"` // probe_data.created_at
+	Latency          float64   `json:"latency"`                                                        // ms
+	PacketLoss       float64   `json:"packet_loss"`                                                    // percent
+	Reason           string    `gorm:"size:32" json:"reason"`                                          // loss, latency or loss+latency
+	CreatedAt        time.Time `json:"created_at"`
+
+	// Payload is the raw probe_data row, filled on request while
+	// ClickHouse still holds it.
+	Payload json.RawMessage `gorm:"-" json:"payload,omitempty"`
+}
+
+func (IncidentSample) TableName() string { return "incident_samples" }
+
+// incidentSampleRow is a PING or TRAFFICSIM row read for sample capture.
+type incidentSampleRow struct {
+	Type       string
+	ProbeID    uint
+	AgentID    uint
+	Target     string
+	CreatedAt  time.Time
+	PayloadRaw string
+}
+
+// sampleKey is the probe_data natural key of a row or reference.
+func sampleKey(typ string, probeID, agentID uint, target string, at time.Time) string {
+	return fmt.Sprintf("%s|%d|%d|%s|%d", typ, probeID, agentID, target, at.UTC().Unix())
+}
+
+// CaptureIncidentSamples records the breaching samples behind each open
+// incident run in the analysis. It runs after RecordIncidentHistory, which
+// creates the runs, and reads from the run's latest reference on, so
+// repeated analyses extend the set instead of re-reading the window.
+// ClickHouse read failures are logged per incident and skip only that
+// incident. Gated by the incident_evidence feature flag.
+func CaptureIncidentSamples(ctx context.Context, ch *sql.DB, pg *gorm.DB, analysis *WorkspaceAnalysis) error {
+	if ch == nil || analysis == nil || len(analysis.Incidents) == 0 || !features.Enabled(ctx, analysis.WorkspaceID, features.IncidentEvidence) {
+		return nil
+	}
+	now := analysis.GeneratedAt
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+
+	incidentIDs := make([]string, len(analysis.Incidents))
+	for i, inc := range analysis.Incidents {
+		incidentIDs[i] = inc.ID
+	}
+	var open []IncidentRecord
+	if err := pg.WithContext(ctx).
+		Where("workspace_id = ? AND status = ? AND incident_id IN ?", analysis.WorkspaceID, IncidentStatusOpen, incidentIDs).
+		Find(&open).Error; err != nil {
+		return fmt.Errorf("load open incidents: %w", err)
+	}
+	recordByIncident := make(map[string]IncidentRecord, len(open))
+	for _, r := range open {
+		recordByIncident[r.IncidentID] = r
+	}
+	agentIDByName := make(map[string]uint, len(analysis.Agents))
+	for _, a := range analysis.Agents {
+		agentIDByName[a.AgentName] = a.AgentID
+	}
+
+	for _, inc := range analysis.Incidents {
+		rec, ok := recordByIncident[inc.ID]
+		if !ok {
+			continue
+		}
+		var agentIDs []string
+		for _, name := range inc.AffectedAgents {
+			if id, ok := agentIDByName[name]; ok {
+				agentIDs = append(agentIDs, fmt.Sprintf("%d", id))
+			}
+		}
+		if len(agentIDs) == 0 {
+			continue
+		}
+
+		var stored int64
+		if err := pg.WithContext(ctx).Model(&IncidentSample{}).
+			Where("incident_record_id = ?", rec.ID).Count(&stored).Error; err != nil {
+			return fmt.Errorf("count samples: %w", err)
+		}
+		if stored >= incidentSampleMax {
+			continue
+		}
+		lookback := inc.LookbackMinutes
+		if lookback <= 0 {
+			lookback = 60
+		}
+		from := now.Add(-time.Duration(lookback) * time.Minute)
+		var latest IncidentSample
+		err := pg.WithContext(ctx).Where("incident_record_id = ?", rec.ID).
+			Order("sample_at DESC").Limit(1).Find(&latest).Error
+		if err != nil {
+			return fmt.Errorf("latest sample: %w", err)
+		}
+		if latest.ID != 0 && latest.SampleAt.After(from) {
+			from = latest.SampleAt
+		}
+
+		rows, err := queryIncidentSampleRows(ctx, ch, strings.Join(agentIDs, ", "), from, now)
+		if err != nil {
+			log.Warnf("[incident_samples] workspace %d incident %s: %v", analysis.WorkspaceID, inc.ID, err)
+			continue
+		}
+		samples := breachingSamples(rec, inc.AffectedTargets, rows, incidentSampleMax-int(stored))
+		if err := saveIncidentSamples(ctx, pg, samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryIncidentSampleRows returns the agents' PING and TRAFFICSIM rows in
+// [from, to], oldest first.
+func queryIncidentSampleRows(ctx context.Context, ch *sql.DB, idList string, from, to time.Time) ([]incidentSampleRow, error) {
+	q := fmt.Sprintf(`
+SELECT type, probe_id, agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at <= %s
+ORDER BY created_at ASC
+LIMIT %d
+`, idList, chQuoteTime(from), chQuoteTime(to), evidenceRowLimit)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []incidentSampleRow
+	for rows.Next() {
+		var r incidentSampleRow
+		var probeID, agentID uint64
+		if err := rows.Scan(&r.Type, &probeID, &agentID, &r.Target, &r.CreatedAt, &r.PayloadRaw); err != nil {
+			continue
+		}
+		r.ProbeID, r.AgentID, r.CreatedAt = uint(probeID), uint(agentID), r.CreatedAt.UTC()
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// breachingSamples turns the rows to the incident's targets that breach
+// the sample thresholds into references for rec, up to limit. Targets are
+// matched in Go so target strings never reach the SQL; no targets matches
+// every row.
+func breachingSamples(rec IncidentRecord, affectedTargets []string, rows []incidentSampleRow, limit int) []IncidentSample {
+	targets := make(map[string]bool, len(affectedTargets))
+	for _, t := range affectedTargets {
+		targets[stripPort(t)] = true
+	}
+	var out []IncidentSample
+	for _, r := range rows {
+		if len(out) >= limit {
+			break
+		}
+		if len(targets) > 0 && !targets[stripPort(r.Target)] {
+			continue
+		}
+		latency, loss, ok := sampleMetrics(r.Type, r.PayloadRaw)
+		if !ok {
+			continue
+		}
+		var reasons []string
+		if loss > incidentSampleLoss {
+			reasons = append(reasons, "loss")
+		}
+		if latency > incidentSampleLatency {
+			reasons = append(reasons, "latency")
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		out = append(out, IncidentSample{
+			IncidentRecordID: rec.ID,
+			WorkspaceID:      rec.WorkspaceID,
+			IncidentID:       rec.IncidentID,
+			Type:             r.Type,
+			ProbeID:          r.ProbeID,
+			AgentID:          r.AgentID,
+			Target:           r.Target,
+			SampleAt:         r.CreatedAt,
+			Latency:          latency,
+			PacketLoss:       loss,
+			Reason:           strings.Join(reasons, "+"),
+		})
+	}
+	return out
+}
+
+// sampleMetrics reads the average latency (ms) and loss (percent) of a
+// PING or TRAFFICSIM payload.
+func sampleMetrics(typ, raw string) (latency, loss float64, ok bool) {
+	switch Type(typ) {
+	case TypePing:
+		p, err := ParsePingPayload([]byte(raw))
+		if err != nil {
+			return 0, 0, false
+		}
+		return sanitizeFloat(float64(p.AvgRtt) / 1e6), sanitizeFloat(p.PacketLoss), true
+	case TypeTrafficSim:
+		var p struct {
+			AverageRTT     float64 `json:"averageRTT"`
+			LossPercentage float64 `json:"lossPercentage"`
+		}
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			return 0, 0, false
+		}
+		return sanitizeFloat(p.AverageRTT), sanitizeFloat(p.LossPercentage), true
+	}
+	return 0, 0, false
+}
+
+// saveIncidentSamples stores references, skipping ones already recorded.
+func saveIncidentSamples(ctx context.Context, pg *gorm.DB, samples []IncidentSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	err := pg.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&samples, 200).Error
+	if err != nil {
+		return fmt.Errorf("save samples: %w", err)
+	}
+	return nil
+}
+
+// IncidentSampleQuery filters and pages the samples of one incident run.
+// Zero values match everything.
+type IncidentSampleQuery struct {
+	WorkspaceID uint
+	RecordID    uint // incident_history.id
+	Type        string
+	AgentID     uint
+	Limit       int
+	Offset      int
+}
+
+// ListIncidentSamples returns one page of an incident run's samples,
+// oldest first, and the total number that match. Returns ErrNotFound when
+// the run is not in the workspace.
+func ListIncidentSamples(ctx context.Context, db *gorm.DB, q IncidentSampleQuery) ([]IncidentSample, int64, error) {
+	switch Type(q.Type) {
+	case "", TypePing, TypeTrafficSim:
+	default:
+		return nil, 0, fmt.Errorf("%w: type must be PING or TRAFFICSIM", ErrBadInput)
+	}
+	var rec IncidentRecord
+	err := db.WithContext(ctx).Select("id").Where("workspace_id = ? AND id = ?", q.WorkspaceID, q.RecordID).First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx := db.WithContext(ctx).Model(&IncidentSample{}).Where("incident_record_id = ?", q.RecordID)
+	if q.Type != "" {
+		tx = tx.Where("type = ?", q.Type)
+	}
+	if q.AgentID != 0 {
+		tx = tx.Where("agent_id = ?", q.AgentID)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	out := []IncidentSample{}
+	err = tx.Order("sample_at ASC, id ASC").Limit(q.Limit).Offset(q.Offset).Find(&out).Error
+	return out, total, err
+}
+
+// AttachSamplePayloads fills Payload on each sample from its probe_data
+// row. Rows ClickHouse has already expired are left without one.
+func AttachSamplePayloads(ctx context.Context, ch *sql.DB, samples []IncidentSample) error {
+	if ch == nil || len(samples) == 0 {
+		return nil
+	}
+	byKey := make(map[string][]int, len(samples))
+	probeIDs := make(map[uint]bool)
+	agentIDs := make(map[uint]bool)
+	from, to := samples[0].SampleAt, samples[0].SampleAt
+	for i, s := range samples {
+		k := sampleKey(s.Type, s.ProbeID, s.AgentID, s.Target, s.SampleAt)
+		byKey[k] = append(byKey[k], i)
+		probeIDs[s.ProbeID], agentIDs[s.AgentID] = true, true
+		if s.SampleAt.Before(from) {
+			from = s.SampleAt
+		}
+		if s.SampleAt.After(to) {
+			to = s.SampleAt
+		}
+	}
+	idList := func(set map[uint]bool) string {
+		ids := make([]string, 0, len(set))
+		for id := range set {
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+		return strings.Join(ids, ", ")
+	}
+
+	// Keys are matched in Go; the SQL only narrows to the rows' range.
+	q := fmt.Sprintf(`
+SELECT type, probe_id, agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND probe_id IN (%s)
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at <= %s
+LIMIT %d
+`, idList(probeIDs), idList(agentIDs), chQuoteTime(from), chQuoteTime(to), evidenceRowLimit)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var typ, target, payloadRaw string
+		var probeID, agentID uint64
+		var createdAt time.Time
+		if err := rows.Scan(&typ, &probeID, &agentID, &target, &createdAt, &payloadRaw); err != nil {
+			continue
+		}
+		idx, ok := byKey[sampleKey(typ, uint(probeID), uint(agentID), target, createdAt)]
+		if !ok || !json.Valid([]byte(payloadRaw)) {
+			continue
+		}
+		for _, i := range idx {
+			samples[i].Payload = json.RawMessage(payloadRaw)
+		}
+	}
+	return rows.Err()
+}
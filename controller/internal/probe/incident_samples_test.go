@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestIncidentSamples verifies only breaching rows to the incident's
+// targets are referenced, re-captures are idempotent, and reads are scoped
+// to the incident run's workspace.
+func TestIncidentSamples(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&IncidentRecord{}, &IncidentSample{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	rec := IncidentRecord{WorkspaceID: 4, IncidentID: "loss_1", Status: IncidentStatusOpen, OpenedAt: t0}
+	if err := db.Create(&rec).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	rows := []incidentSampleRow{
+		{Type: "PING", ProbeID: 1, AgentID: 7, Target: "1.1.1.1", CreatedAt: t0, PayloadRaw: `{"avg_rtt":20000000,"packet_loss":5}`},
+		{Type: "PING", ProbeID: 1, AgentID: 7, Target: "1.1.1.1", CreatedAt: t0.Add(time.Minute), PayloadRaw: `{"avg_rtt":20000000,"packet_loss":0}`},
+		{Type: "PING", ProbeID: 2, AgentID: 7, Target: "8.8.8.8", CreatedAt: t0, PayloadRaw: `{"avg_rtt":300000000,"packet_loss":9}`},
+		{Type: "TRAFFICSIM", ProbeID: 3, AgentID: 7, Target: "1.1.1.1:5000", CreatedAt: t0, PayloadRaw: `{"averageRTT":150,"lossPercentage":2}`},
+		{Type: "PING", ProbeID: 1, AgentID: 7, Target: "1.1.1.1", CreatedAt: t0.Add(2 * time.Minute), PayloadRaw: `not json`},
+	}
+	samples := breachingSamples(rec, []string{"1.1.1.1:443"}, rows, incidentSampleMax)
+	if len(samples) != 2 {
+		t.Fatalf("%d samples, want the lossy PING and the TRAFFICSIM: %+v", len(samples), samples)
+	}
+	if s := samples[0]; s.Reason != "loss" || s.Latency != 20 || s.IncidentRecordID != rec.ID || s.WorkspaceID != 4 {
+		t.Errorf("ping sample = %+v", s)
+	}
+	if s := samples[1]; s.Reason != "loss+latency" || s.Type != "TRAFFICSIM" {
+		t.Errorf("trafficsim sample = %+v", s)
+	}
+	if got := breachingSamples(rec, nil, rows, 1); len(got) != 1 {
+		t.Errorf("limit 1 = %d samples", len(got))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := saveIncidentSamples(ctx, db, samples); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+	list, total, err := ListIncidentSamples(ctx, db, IncidentSampleQuery{WorkspaceID: 4, RecordID: rec.ID})
+	if err != nil || total != 2 || len(list) != 2 {
+		t.Fatalf("list = %d, %v", total, err)
+	}
+	if _, total, _ := ListIncidentSamples(ctx, db, IncidentSampleQuery{WorkspaceID: 4, RecordID: rec.ID, Type: "TRAFFICSIM"}); total != 1 {
+		t.Errorf("TRAFFICSIM filter = %d, want 1", total)
+	}
+	if _, _, err := ListIncidentSamples(ctx, db, IncidentSampleQuery{WorkspaceID: 5, RecordID: rec.ID}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other workspace err = %v, want ErrNotFound", err)
+	}
+	if _, _, err := ListIncidentSamples(ctx, db, IncidentSampleQuery{WorkspaceID: 4, RecordID: rec.ID, Type: "MTR"}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("MTR filter err = %v, want ErrBadInput", err)
+	}
+}
@@ -0,0 +1,269 @@
+package probe
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"netwatcher-controller/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── Agent Ingest Rate Limiting ──
+//
+// When INGEST_RATE_PER_SEC is set, each agent gets a token bucket for
+// probe_post: that many results per second sustained, with INGEST_BURST
+// on top so a whole probe cycle finishing at once (or a reconnect
+// flushing a backlog) is not throttled. Limiting is off by default:
+// rejected results are dropped, and agents that ignore the backoff reply
+// would lose data. Rejected results get a backoff reply telling the agent
+// how long to wait. An agent throttled without a break for
+// INGEST_THROTTLE_FINDING_MINUTES shows up as a workspace analysis
+// finding, since that is nearly always a misconfigured probe interval.
+
+const (
+	defaultIngestRate           = 0.0 // disabled
+	defaultIngestBurst          = 200
+	defaultThrottleFindingAfter = 10 * time.Minute
+
+	// throttleStreakGap is how long an agent must go unthrottled for a
+	// throttling streak to end.
+	throttleStreakGap = 2 * time.Minute
+)
+
+// IngestLimitConfig configures the per-agent ingest limiter.
+type IngestLimitConfig struct {
+	RatePerSec   float64       // sustained results/second; 0 disables limiting
+	Burst        int           // bucket size
+	FindingAfter time.Duration // throttled this long → analysis finding
+}
+
+// LoadIngestLimitConfig reads INGEST_RATE_PER_SEC, INGEST_BURST and
+// INGEST_THROTTLE_FINDING_MINUTES.
+func LoadIngestLimitConfig() IngestLimitConfig {
+	cfg := IngestLimitConfig{
+		RatePerSec:   defaultIngestRate,
+		Burst:        defaultIngestBurst,
+		FindingAfter: defaultThrottleFindingAfter,
+	}
+	if v := os.Getenv("INGEST_RATE_PER_SEC"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			cfg.RatePerSec = f
+		} else {
+			log.Warnf("INGEST_RATE_PER_SEC: invalid value %q, using %v", v, defaultIngestRate)
+		}
+	}
+	if v := os.Getenv("INGEST_BURST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			cfg.Burst = n
+		} else {
+			log.Warnf("INGEST_BURST: invalid value %q, using %d", v, defaultIngestBurst)
+		}
+	}
+	if v := os.Getenv("INGEST_THROTTLE_FINDING_MINUTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 {
+			cfg.FindingAfter = time.Duration(n) * time.Minute
+		} else {
+			log.Warnf("INGEST_THROTTLE_FINDING_MINUTES: invalid value %q, using %v", v, defaultThrottleFindingAfter)
+		}
+	}
+	return cfg
+}
+
+// IngestBackoff is sent to an agent as probe_post_backoff in place of
+// probe_post_ok when a result is rejected.
+type IngestBackoff struct {
+	Reason       string  `json:"reason"` // rate_limited
+	ProbeID      uint    `json:"probe_id,omitempty"`
+	RetryAfterMs int64   `json:"retry_after_ms"`
+	RatePerSec   float64 `json:"rate_per_sec"`
+	Burst        int     `json:"burst"`
+}
+
+// IngestThrottleState describes an agent's current throttling streak.
+type IngestThrottleState struct {
+	AgentID       uint      `json:"agent_id"`
+	Since         time.Time `json:"since"`          // first rejection of the streak
+	LastThrottled time.Time `json:"last_throttled"` // most recent rejection
+	Rejected      int64     `json:"rejected"`       // rejections in the streak
+}
+
+type ingestBucket struct {
+	tokens float64
+	last   time.Time
+
+	// current throttling streak; zero Since when not throttled
+	since    time.Time
+	lastHit  time.Time
+	rejected int64
+}
+
+// IngestLimiter is an in-memory per-agent token bucket. Like the HTTP
+// rate limiter it is per controller instance.
+type IngestLimiter struct {
+	cfg     IngestLimitConfig
+	mu      sync.Mutex
+	buckets map[uint]*ingestBucket
+}
+
+// NewIngestLimiter builds a limiter from cfg.
+func NewIngestLimiter(cfg IngestLimitConfig) *IngestLimiter {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	return &IngestLimiter{cfg: cfg, buckets: make(map[uint]*ingestBucket)}
+}
+
+// Config returns the limiter's configuration.
+func (l *IngestLimiter) Config() IngestLimitConfig { return l.cfg }
+
+// Allow takes one token from the agent's bucket. When none is left it
+// returns false and how long until one is.
+func (l *IngestLimiter) Allow(agentID uint, now time.Time) (bool, time.Duration) {
+	if l.cfg.RatePerSec <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(l.cfg.Burst)
+	b, ok := l.buckets[agentID]
+	if !ok {
+		b = &ingestBucket{tokens: burst, last: now}
+		l.buckets[agentID] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*l.cfg.RatePerSec)
+		b.last = now
+	}
+	if !b.since.IsZero() && now.Sub(b.lastHit) > throttleStreakGap {
+		b.since, b.rejected = time.Time{}, 0
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if b.since.IsZero() {
+		b.since = now
+		log.Warnf("[ingest] agent %d exceeds %.1f results/s (burst %d); throttling", agentID, l.cfg.RatePerSec, l.cfg.Burst)
+	}
+	b.lastHit = now
+	b.rejected++
+	wait := time.Duration((1 - b.tokens) / l.cfg.RatePerSec * float64(time.Second))
+	return false, wait
+}
+
+// Throttled returns agents whose throttling streak has lasted at least
+// FindingAfter and is still ongoing, sorted by agent ID.
+func (l *IngestLimiter) Throttled(now time.Time) []IngestThrottleState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []IngestThrottleState
+	for id, b := range l.buckets {
+		if b.since.IsZero() || now.Sub(b.lastHit) > throttleStreakGap || now.Sub(b.since) < l.cfg.FindingAfter {
+			continue
+		}
+		out = append(out, IngestThrottleState{AgentID: id, Since: b.since, LastThrottled: b.lastHit, Rejected: b.rejected})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AgentID < out[j].AgentID })
+	return out
+}
+
+// prune drops buckets that are full and not throttled; they behave the
+// same as a fresh bucket.
+func (l *IngestLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, b := range l.buckets {
+		refilled := b.tokens + now.Sub(b.last).Seconds()*l.cfg.RatePerSec
+		if refilled >= float64(l.cfg.Burst) && (b.since.IsZero() || now.Sub(b.lastHit) > throttleStreakGap) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+var ingestLimiter = sync.OnceValue(func() *IngestLimiter {
+	l := NewIngestLimiter(LoadIngestLimitConfig())
+	go func() {
+		t := time.NewTicker(10 * time.Minute)
+		defer t.Stop()
+		for now := range t.C {
+			l.prune(now)
+		}
+	}()
+	return l
+})
+
+// AllowIngest applies the process-wide limiter to one probe result from
+// agentID. On rejection it returns the backoff to send the agent.
+func AllowIngest(agentID, probeID uint) (bool, IngestBackoff) {
+	l := ingestLimiter()
+	ok, wait := l.Allow(agentID, time.Now())
+	if ok {
+		return true, IngestBackoff{}
+	}
+	if m := metrics.Get(); m != nil && m.IngestThrottled != nil {
+		m.IngestThrottled.Inc()
+	}
+	ms := wait.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	return false, IngestBackoff{
+		Reason:       "rate_limited",
+		ProbeID:      probeID,
+		RetryAfterMs: ms,
+		RatePerSec:   l.cfg.RatePerSec,
+		Burst:        l.cfg.Burst,
+	}
+}
+
+// ingestThrottleFindings turns persistently throttled agents of the
+// workspace into analysis findings.
+func ingestThrottleFindings(states []IngestThrottleState, agentByID map[uint]agentInfo, cfg IngestLimitConfig, now time.Time) []AnalysisFinding {
+	var out []AnalysisFinding
+	for _, st := range states {
+		a, ok := agentByID[st.AgentID]
+		if !ok {
+			continue
+		}
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("agent %d", st.AgentID)
+		}
+		out = append(out, AnalysisFinding{
+			ID:       fmt.Sprintf("ingest-throttled-%d", st.AgentID),
+			Title:    fmt.Sprintf("%s is being rate limited by the controller", name),
+			Severity: "warning",
+			Category: "measurement_artifact",
+			Summary: fmt.Sprintf("%s has sent probe results faster than %.4g/s for %s. Rejected results are not stored, so its graphs and health scores have gaps.",
+				name, cfg.RatePerSec, now.Sub(st.Since).Round(time.Minute)),
+			Evidence: []string{
+				fmt.Sprintf("%d results rejected since %s", st.Rejected, st.Since.UTC().Format(time.RFC3339)),
+				fmt.Sprintf("Limit: %.4g results/s sustained, burst %d", cfg.RatePerSec, cfg.Burst),
+			},
+			Steps: []string{
+				"Check the agent's probes for very short intervals (e.g. 1s) and raise them",
+				"Remove duplicate probes to the same target",
+				"If the volume is intended, raise INGEST_RATE_PER_SEC / INGEST_BURST on the controller",
+			},
+		})
+	}
+	return out
+}
+
+// workspaceIngestFindings is ingestThrottleFindings for the live limiter.
+func workspaceIngestFindings(agentByID map[uint]agentInfo, now time.Time) []AnalysisFinding {
+	l := ingestLimiter()
+	if l.cfg.RatePerSec <= 0 {
+		return nil
+	}
+	return ingestThrottleFindings(l.Throttled(now), agentByID, l.cfg, now)
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestLimiterBurstThenRate(t *testing.T) {
+	l := NewIngestLimiter(IngestLimitConfig{RatePerSec: 2, Burst: 5, FindingAfter: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Allow(1, now); !ok {
+			t.Fatalf("burst result %d rejected", i)
+		}
+	}
+	ok, wait := l.Allow(1, now)
+	if ok {
+		t.Fatal("result past burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("retry after = %v, want 500ms at 2/s", wait)
+	}
+
+	// Other agents have their own bucket.
+	if ok, _ := l.Allow(2, now); !ok {
+		t.Error("agent 2 throttled by agent 1's traffic")
+	}
+
+	// Half a second refills one token.
+	if ok, _ := l.Allow(1, now.Add(500*time.Millisecond)); !ok {
+		t.Error("refilled token rejected")
+	}
+
+	if ok, _ := NewIngestLimiter(IngestLimitConfig{}).Allow(1, now); !ok {
+		t.Error("rate 0 should disable limiting")
+	}
+}
+
+func TestIngestLimiterPersistentThrottling(t *testing.T) {
+	l := NewIngestLimiter(IngestLimitConfig{RatePerSec: 1, Burst: 1, FindingAfter: 5 * time.Minute})
+	start := time.Unix(1_700_000_000, 0)
+
+	// Two results a second for six minutes: every other one is rejected.
+	for s := 0; s < 6*60; s++ {
+		now := start.Add(time.Duration(s) * time.Second)
+		l.Allow(7, now)
+		l.Allow(7, now)
+	}
+	now := start.Add(6 * time.Minute)
+	got := l.Throttled(now)
+	if len(got) != 1 || got[0].AgentID != 7 || !got[0].Since.Equal(start) || got[0].Rejected < 300 {
+		t.Fatalf("Throttled = %+v, want agent 7 throttled since start", got)
+	}
+
+	findings := ingestThrottleFindings(got, map[uint]agentInfo{7: {ID: 7, Name: "branch-01"}}, l.Config(), now)
+	if len(findings) != 1 || findings[0].ID != "ingest-throttled-7" || findings[0].Severity != "warning" {
+		t.Errorf("findings = %+v", findings)
+	}
+	if f := ingestThrottleFindings(got, map[uint]agentInfo{}, l.Config(), now); len(f) != 0 {
+		t.Error("finding raised for an agent outside the workspace")
+	}
+
+	// A quiet spell longer than the streak gap ends the streak.
+	later := now.Add(throttleStreakGap + time.Second)
+	if ok, _ := l.Allow(7, later); !ok {
+		t.Fatal("result after quiet spell rejected")
+	}
+	if got := l.Throttled(later); len(got) != 0 {
+		t.Errorf("Throttled after quiet spell = %+v, want none", got)
+	}
+}
@@ -0,0 +1,317 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Ingest Validation ──
+//
+// When an operator suspects results are being lost between an agent and
+// ClickHouse (queue overflow on the agent, rejected batches, a dropped
+// WebSocket), the agent's local cache is the ground truth. The agent — or
+// an operator holding its numbers — submits what it sent per probe for a
+// window (row count, first and last result time) and the controller diffs
+// that against probe_data for the same agent and window.
+//
+// Probes with missing rows are also scanned for gaps: stretches of more
+// than three probe intervals with no stored result, which show where in
+// the window the loss happened.
+
+const (
+	// maxIngestValidationWindow bounds the compared window.
+	maxIngestValidationWindow = 24 * time.Hour
+	// maxIngestGapScanRows bounds the timestamps read per probe for gaps.
+	maxIngestGapScanRows = 100000
+	// ingestGapIntervals is how many missed intervals make a gap.
+	ingestGapIntervals = 3
+	// ingestEdgeTolerance absorbs clock skew and batching at the window
+	// edges before a head or tail is reported missing.
+	ingestEdgeTolerance = 5 * time.Second
+)
+
+// Ingest validation statuses, per probe.
+const (
+	IngestOK         = "ok"
+	IngestMissing    = "missing_rows" // fewer rows stored than sent
+	IngestNotStored  = "not_stored"   // nothing stored
+	IngestExtra      = "extra_rows"   // more rows stored than sent (duplicates)
+	IngestUnreported = "unreported"   // stored but absent from the agent's summary
+)
+
+// LocalProbeSummary is what the agent sent for one probe in the window.
+type LocalProbeSummary struct {
+	ProbeID uint      `json:"probe_id"`
+	Count   uint64    `json:"count"`
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// IngestValidationRequest is the agent-local summary to check.
+type IngestValidationRequest struct {
+	From   time.Time           `json:"from"`
+	To     time.Time           `json:"to"`
+	Probes []LocalProbeSummary `json:"probes"`
+}
+
+// storedProbeSummary is the same summary read from probe_data.
+type storedProbeSummary struct {
+	Count   uint64
+	FirstAt time.Time
+	LastAt  time.Time
+}
+
+// IngestGap is a stretch of the window with no stored results.
+type IngestGap struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Seconds int       `json:"seconds"`
+}
+
+// IngestProbeDiff compares one probe.
+type IngestProbeDiff struct {
+	ProbeID       uint        `json:"probe_id"`
+	Type          Type        `json:"type,omitempty"`
+	Status        string      `json:"status"`
+	LocalCount    uint64      `json:"local_count"`
+	StoredCount   uint64      `json:"stored_count"`
+	Missing       uint64      `json:"missing"`
+	Extra         uint64      `json:"extra"`
+	LocalFirstAt  *time.Time  `json:"local_first_at,omitempty"`
+	LocalLastAt   *time.Time  `json:"local_last_at,omitempty"`
+	StoredFirstAt *time.Time  `json:"stored_first_at,omitempty"`
+	StoredLastAt  *time.Time  `json:"stored_last_at,omitempty"`
+	MissingHead   bool        `json:"missing_head"` // stored results start later than the agent's
+	MissingTail   bool        `json:"missing_tail"` // stored results end earlier than the agent's
+	Gaps          []IngestGap `json:"gaps,omitempty"`
+}
+
+// IngestValidationReport is the diff for one agent and window.
+type IngestValidationReport struct {
+	WorkspaceID  uint              `json:"workspace_id"`
+	AgentID      uint              `json:"agent_id"`
+	From         time.Time         `json:"from"`
+	To           time.Time         `json:"to"`
+	LocalTotal   uint64            `json:"local_total"`
+	StoredTotal  uint64            `json:"stored_total"`
+	MissingTotal uint64            `json:"missing_total"`
+	Consistent   bool              `json:"consistent"` // every reported probe is ok
+	Probes       []IngestProbeDiff `json:"probes"`
+	GeneratedAt  time.Time         `json:"generated_at"`
+}
+
+// ValidateIngest diffs an agent's local summary against the rows stored
+// with that agent as the runner. Probes must belong to the workspace;
+// reverse and AGENT-expanded probes owned by another agent are allowed,
+// since the agent runs them too.
+func ValidateIngest(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID, agentID uint, req IngestValidationRequest) (*IngestValidationReport, error) {
+	from, to := req.From.UTC(), req.To.UTC()
+	if from.IsZero() || to.IsZero() || !to.After(from) {
+		return nil, fmt.Errorf("%w: from and to required, from before to", ErrBadInput)
+	}
+	if to.Sub(from) > maxIngestValidationWindow {
+		return nil, fmt.Errorf("%w: window exceeds %s", ErrBadInput, maxIngestValidationWindow)
+	}
+
+	var probes []Probe
+	if err := pg.WithContext(ctx).Where("workspace_id = ?", workspaceID).
+		Find(&probes).Error; err != nil {
+		return nil, fmt.Errorf("list probes: %w", err)
+	}
+	known := make(map[uint]Probe, len(probes))
+	for _, p := range probes {
+		known[p.ID] = p
+	}
+	for _, l := range req.Probes {
+		if _, ok := known[l.ProbeID]; !ok {
+			return nil, fmt.Errorf("%w: probe %d not found in workspace", ErrBadInput, l.ProbeID)
+		}
+	}
+
+	stored, err := storedProbeSummaries(ctx, ch, agentID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query probe_data: %w", err)
+	}
+	report := diffIngestSummaries(req.Probes, stored)
+	report.WorkspaceID, report.AgentID, report.From, report.To = workspaceID, agentID, from, to
+
+	for i := range report.Probes {
+		d := &report.Probes[i]
+		p, ok := known[d.ProbeID]
+		if ok {
+			d.Type = p.Type
+		}
+		// Without the agent's range there is nothing to scan for gaps.
+		if d.Status != IngestMissing || !ok || d.LocalFirstAt == nil {
+			continue
+		}
+		interval := time.Duration(ifZero(p.IntervalSec, 60)) * time.Second
+		times, err := storedResultTimes(ctx, ch, agentID, d.ProbeID, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("scan probe %d: %w", d.ProbeID, err)
+		}
+		d.Gaps = findIngestGaps(times, *d.LocalFirstAt, *d.LocalLastAt, interval)
+	}
+	return report, nil
+}
+
+// storedProbeSummaries counts an agent's stored results per probe.
+func storedProbeSummaries(ctx context.Context, ch *sql.DB, agentID uint, from, to time.Time) (map[uint]storedProbeSummary, error) {
+	q := fmt.Sprintf(`
+SELECT probe_id, count(*), min(created_at), max(created_at)
+FROM probe_data
+WHERE agent_id = %d
+  AND created_at >= %s AND created_at <= %s
+GROUP BY probe_id
+`, agentID, chQuoteTime(from), chQuoteTime(to))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[uint]storedProbeSummary)
+	for rows.Next() {
+		var id, n uint64
+		var first, last time.Time
+		if err := rows.Scan(&id, &n, &first, &last); err != nil {
+			return nil, err
+		}
+		out[uint(id)] = storedProbeSummary{Count: n, FirstAt: first.UTC(), LastAt: last.UTC()}
+	}
+	return out, rows.Err()
+}
+
+// storedResultTimes returns a probe's stored result times, oldest first.
+func storedResultTimes(ctx context.Context, ch *sql.DB, agentID, probeID uint, from, to time.Time) ([]time.Time, error) {
+	q := fmt.Sprintf(`
+SELECT created_at
+FROM probe_data
+WHERE agent_id = %d AND probe_id = %d
+  AND created_at >= %s AND created_at <= %s
+ORDER BY created_at
+LIMIT %d
+`, agentID, probeID, chQuoteTime(from), chQuoteTime(to), maxIngestGapScanRows)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t.UTC())
+	}
+	return out, rows.Err()
+}
+
+// diffIngestSummaries compares local and stored summaries. Probes only
+// found in storage are listed as unreported but don't make the report
+// inconsistent: the agent may simply not have cached them.
+func diffIngestSummaries(local []LocalProbeSummary, stored map[uint]storedProbeSummary) *IngestValidationReport {
+	report := &IngestValidationReport{Consistent: true, Probes: []IngestProbeDiff{}, GeneratedAt: time.Now().UTC()}
+	seen := make(map[uint]bool, len(local))
+	for _, l := range local {
+		seen[l.ProbeID] = true
+		s := stored[l.ProbeID]
+		d := IngestProbeDiff{ProbeID: l.ProbeID, Status: IngestOK, LocalCount: l.Count, StoredCount: s.Count}
+		if !l.FirstAt.IsZero() {
+			first, last := l.FirstAt.UTC(), l.LastAt.UTC()
+			d.LocalFirstAt, d.LocalLastAt = &first, &last
+		}
+		if s.Count > 0 {
+			first, last := s.FirstAt, s.LastAt
+			d.StoredFirstAt, d.StoredLastAt = &first, &last
+		}
+		switch {
+		case l.Count > 0 && s.Count == 0:
+			d.Status, d.Missing = IngestNotStored, l.Count
+		case s.Count < l.Count:
+			d.Status, d.Missing = IngestMissing, l.Count-s.Count
+		case s.Count > l.Count:
+			d.Status, d.Extra = IngestExtra, s.Count-l.Count
+		}
+		if d.LocalFirstAt != nil && d.StoredFirstAt != nil {
+			d.MissingHead = d.StoredFirstAt.Sub(*d.LocalFirstAt) > ingestEdgeTolerance
+			d.MissingTail = d.LocalLastAt.Sub(*d.StoredLastAt) > ingestEdgeTolerance
+		}
+		if d.Status != IngestOK || d.MissingHead || d.MissingTail {
+			report.Consistent = false
+		}
+		report.LocalTotal += l.Count
+		report.StoredTotal += s.Count
+		report.MissingTotal += d.Missing
+		report.Probes = append(report.Probes, d)
+	}
+	for id, s := range stored {
+		if seen[id] {
+			continue
+		}
+		first, last := s.FirstAt, s.LastAt
+		report.StoredTotal += s.Count
+		report.Probes = append(report.Probes, IngestProbeDiff{
+			ProbeID: id, Status: IngestUnreported, StoredCount: s.Count, Extra: s.Count,
+			StoredFirstAt: &first, StoredLastAt: &last,
+		})
+	}
+
+	rank := map[string]int{IngestNotStored: 0, IngestMissing: 1, IngestExtra: 2, IngestOK: 3, IngestUnreported: 4}
+	sort.SliceStable(report.Probes, func(i, j int) bool {
+		a, b := report.Probes[i], report.Probes[j]
+		if rank[a.Status] != rank[b.Status] {
+			return rank[a.Status] < rank[b.Status]
+		}
+		if a.Missing != b.Missing {
+			return a.Missing > b.Missing
+		}
+		return a.ProbeID < b.ProbeID
+	})
+	return report
+}
+
+// findIngestGaps returns the stretches of [first, last] longer than
+// ingestGapIntervals × interval without a stored result. times must be
+// sorted.
+func findIngestGaps(times []time.Time, first, last time.Time, interval time.Duration) []IngestGap {
+	limit := time.Duration(ingestGapIntervals) * interval
+	var gaps []IngestGap
+	add := func(a, b time.Time) {
+		if b.Sub(a) > limit {
+			gaps = append(gaps, IngestGap{From: a, To: b, Seconds: int(b.Sub(a).Seconds())})
+		}
+	}
+	prev := first
+	for _, t := range times {
+		if t.Before(first) || t.After(last) {
+			continue
+		}
+		add(prev, t)
+		prev = t
+	}
+	add(prev, last)
+	return gaps
+}
+
+// String summarises the report in one line for logs.
+func (r *IngestValidationReport) String() string {
+	var bad []string
+	for _, d := range r.Probes {
+		if d.Status != IngestOK && d.Status != IngestUnreported {
+			bad = append(bad, fmt.Sprintf("probe %d %s (%d/%d)", d.ProbeID, d.Status, d.StoredCount, d.LocalCount))
+		}
+	}
+	if len(bad) == 0 {
+		return fmt.Sprintf("agent %d: %d/%d rows stored, consistent", r.AgentID, r.StoredTotal, r.LocalTotal)
+	}
+	return fmt.Sprintf("agent %d: %d of %d rows missing; %s", r.AgentID, r.MissingTotal, r.LocalTotal, strings.Join(bad, ", "))
+}
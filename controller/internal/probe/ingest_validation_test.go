@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDiffIngestSummaries verifies per-probe statuses, edge detection and
+// ordering of the diff.
+func TestDiffIngestSummaries(t *testing.T) {
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	hour := t0.Add(time.Hour)
+	local := []LocalProbeSummary{
+		{ProbeID: 1, Count: 60, FirstAt: t0, LastAt: hour},
+		{ProbeID: 2, Count: 60, FirstAt: t0, LastAt: hour},
+		{ProbeID: 3, Count: 30, FirstAt: t0, LastAt: hour},
+		{ProbeID: 4, Count: 10, FirstAt: t0, LastAt: hour},
+	}
+	stored := map[uint]storedProbeSummary{
+		1: {Count: 60, FirstAt: t0, LastAt: hour.Add(-2 * time.Second)},
+		2: {Count: 45, FirstAt: t0, LastAt: t0.Add(45 * time.Minute)},
+		4: {Count: 12, FirstAt: t0, LastAt: hour},
+		9: {Count: 5, FirstAt: t0, LastAt: hour},
+	}
+	r := diffIngestSummaries(local, stored)
+
+	if r.Consistent {
+		t.Error("report with missing rows is consistent")
+	}
+	if r.LocalTotal != 160 || r.StoredTotal != 122 || r.MissingTotal != 45 {
+		t.Errorf("totals = %d/%d/%d", r.LocalTotal, r.StoredTotal, r.MissingTotal)
+	}
+	want := []struct {
+		id     uint
+		status string
+	}{{3, IngestNotStored}, {2, IngestMissing}, {4, IngestExtra}, {1, IngestOK}, {9, IngestUnreported}}
+	if len(r.Probes) != len(want) {
+		t.Fatalf("probes = %+v", r.Probes)
+	}
+	for i, w := range want {
+		if d := r.Probes[i]; d.ProbeID != w.id || d.Status != w.status {
+			t.Errorf("probes[%d] = %d %s, want %d %s", i, d.ProbeID, d.Status, w.id, w.status)
+		}
+	}
+	if d := r.Probes[1]; d.Missing != 15 || !d.MissingTail || d.MissingHead {
+		t.Errorf("probe 2 = missing %d, head %v, tail %v", d.Missing, d.MissingHead, d.MissingTail)
+	}
+	if d := r.Probes[3]; d.MissingTail {
+		t.Error("probe 1 tail within tolerance reported missing")
+	}
+
+	ok := diffIngestSummaries(local[:1], map[uint]storedProbeSummary{1: stored[1], 9: stored[9]})
+	if !ok.Consistent {
+		t.Error("unreported probes made the report inconsistent")
+	}
+}
+
+// TestFindIngestGaps verifies gaps are stretches over three intervals,
+// including at the edges of the agent's range.
+func TestFindIngestGaps(t *testing.T) {
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	var times []time.Time
+	for m := 0; m <= 60; m++ {
+		if (m >= 20 && m < 30) || m > 55 {
+			continue
+		}
+		times = append(times, t0.Add(time.Duration(m)*time.Minute))
+	}
+	gaps := findIngestGaps(times, t0, t0.Add(time.Hour), time.Minute)
+	if len(gaps) != 2 {
+		t.Fatalf("gaps = %+v", gaps)
+	}
+	if !gaps[0].From.Equal(t0.Add(19*time.Minute)) || gaps[0].Seconds != 660 {
+		t.Errorf("interior gap = %+v", gaps[0])
+	}
+	if !gaps[1].To.Equal(t0.Add(time.Hour)) || gaps[1].Seconds != 300 {
+		t.Errorf("tail gap = %+v", gaps[1])
+	}
+	if g := findIngestGaps(times[:20], t0, t0.Add(19*time.Minute), time.Minute); len(g) != 0 {
+		t.Errorf("complete run has gaps: %+v", g)
+	}
+}
@@ -0,0 +1,204 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+)
+
+// ── Probe Label Columns ──
+//
+// Probe.Labels live in Postgres, so slicing telemetry by label would need
+// a join per query. The label keys listed in CH_LABEL_COLUMNS are copied
+// onto every probe_data row at ingest as label_<key> LowCardinality
+// columns, and FindParams.Labels filters on them directly. Values are
+// captured when the row is written: relabelling a probe affects new rows
+// only, and rows written before a key was configured hold ''.
+
+const (
+	defaultLabelColumns = "env,site,region"
+	maxLabelColumns     = 8
+	maxLabelValueLen    = 128
+)
+
+var labelKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+var labelColumns = sync.OnceValue(func() []string {
+	v, ok := os.LookupEnv("CH_LABEL_COLUMNS")
+	if !ok {
+		v = defaultLabelColumns
+	}
+	return parseLabelColumns(v)
+})
+
+// parseLabelColumns turns a comma-separated key list into valid,
+// de-duplicated keys, capped at maxLabelColumns.
+func parseLabelColumns(s string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, k := range strings.Split(s, ",") {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" || seen[k] {
+			continue
+		}
+		if !labelKeyRe.MatchString(k) {
+			log.Warnf("CH_LABEL_COLUMNS: ignoring invalid label key %q", k)
+			continue
+		}
+		if len(out) == maxLabelColumns {
+			log.Warnf("CH_LABEL_COLUMNS: more than %d keys, ignoring %q", maxLabelColumns, k)
+			continue
+		}
+		seen[k] = true
+		out = append(out, k)
+	}
+	return out
+}
+
+// LabelColumnKeys returns the label keys denormalized into probe_data.
+func LabelColumnKeys() []string { return labelColumns() }
+
+// IsLabelColumn reports whether key is denormalized into probe_data.
+func IsLabelColumn(key string) bool {
+	for _, k := range labelColumns() {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func labelColumnName(key string) string { return "label_" + key }
+
+// LabelColumnValues extracts the configured keys from a probe's labels.
+// Non-string scalars are stringified; objects, arrays and null are skipped.
+func LabelColumnValues(labels datatypes.JSON) map[string]string {
+	if len(labels) == 0 || len(labelColumns()) == 0 {
+		return nil
+	}
+	var m map[string]any
+	if err := json.Unmarshal(labels, &m); err != nil {
+		return nil
+	}
+	var out map[string]string
+	for _, k := range labelColumns() {
+		var s string
+		switch v := m[k].(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			s = strconv.FormatBool(v)
+		default:
+			continue
+		}
+		if len(s) > maxLabelValueLen {
+			s = s[:maxLabelValueLen]
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[k] = s
+	}
+	return out
+}
+
+// labelColumnRow returns a row's label values in LabelColumnKeys order.
+func labelColumnRow(labels map[string]string) []string {
+	keys := labelColumns()
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = labels[k]
+	}
+	return out
+}
+
+// probeDataInsertColumns is the INSERT column list including label columns.
+func probeDataInsertColumns() string {
+	cols := `created_at, received_at, type, probe_id, probe_agent_id, agent_id,
+ triggered, triggered_reason, target, target_agent, payload_raw, dscp`
+	for _, k := range labelColumns() {
+		cols += ", " + labelColumnName(k)
+	}
+	return cols
+}
+
+// probeDataRowPlaceholder is one "(?, ...)" VALUES tuple.
+func probeDataRowPlaceholder() string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", 12+len(labelColumns())), ", ") + ")"
+}
+
+// labelFilterClauses builds WHERE clauses for FindParams.Labels.
+func labelFilterClauses(labels map[string]string) ([]string, error) {
+	var out []string
+	for _, k := range sortedLabelKeys(labels) {
+		if !IsLabelColumn(k) {
+			return nil, fmt.Errorf("%w: label %q is not a probe_data label column (CH_LABEL_COLUMNS)", ErrBadInput, k)
+		}
+		out = append(out, fmt.Sprintf("%s = %s", labelColumnName(k), chQuoteString(labels[k])))
+	}
+	return out, nil
+}
+
+func sortedLabelKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// migrateLabelColumnsCH adds missing label columns to probe_data.
+func migrateLabelColumnsCH(ctx context.Context, ch *sql.DB) error {
+	for _, k := range labelColumns() {
+		q := fmt.Sprintf("ALTER TABLE probe_data ADD COLUMN IF NOT EXISTS %s LowCardinality(String) DEFAULT ''", labelColumnName(k))
+		if _, err := ch.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("add label column %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// migrateLabelColumnsSQLite adds missing label columns to the embedded
+// probe_data table; SQLite has no ADD COLUMN IF NOT EXISTS.
+func migrateLabelColumnsSQLite(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info('probe_data')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, k := range labelColumns() {
+		col := labelColumnName(k)
+		if existing[col] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE probe_data ADD COLUMN %s TEXT NOT NULL DEFAULT ''", col)); err != nil {
+			return fmt.Errorf("add label column %s: %w", k, err)
+		}
+	}
+	return nil
+}
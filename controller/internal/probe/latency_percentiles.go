@@ -0,0 +1,79 @@
+package probe
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ── Latency Percentiles ──
+//
+// Averages and p95 hide the tail: a path can look healthy at p95 while a
+// few percent of samples take seconds. Fetchers report p50/p95/p99/max
+// alongside the average, and a p99 that sits far above the median is
+// raised as a p99_spike signal distinct from high_latency.
+//
+// The fetchers still aggregate payloads in Go; once aggregation moves
+// server-side these map onto quantiles(0.5, 0.95, 0.99)(rtt) and max(rtt).
+
+const (
+	// p99SpikeRatio is how many times the median p99 must reach.
+	p99SpikeRatio = 3.0
+	// p99SpikeMinDeltaMs keeps fast paths (1ms → 4ms) from being flagged.
+	p99SpikeMinDeltaMs = 50.0
+	// p99SpikeCriticalRatio and p99SpikeCriticalDeltaMs escalate to critical.
+	p99SpikeCriticalRatio   = 6.0
+	p99SpikeCriticalDeltaMs = 150.0
+)
+
+// latencyPercentiles is the latency distribution of one series, in ms.
+type latencyPercentiles struct {
+	P50 float64
+	P95 float64
+	P99 float64
+	Max float64
+}
+
+// computeLatencyPercentiles sorts vals once and reads every percentile
+// from the same copy, using the same nearest-rank index as percentile.
+func computeLatencyPercentiles(vals []float64) latencyPercentiles {
+	if len(vals) == 0 {
+		return latencyPercentiles{}
+	}
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	at := func(pct int) float64 {
+		return sorted[int(float64(len(sorted)-1)*float64(pct)/100.0)]
+	}
+	return latencyPercentiles{
+		P50: sanitizeFloat(at(50)),
+		P95: sanitizeFloat(at(95)),
+		P99: sanitizeFloat(at(99)),
+		Max: sanitizeFloat(sorted[len(sorted)-1]),
+	}
+}
+
+// p99SpikeSignal flags a latency tail far above the median. It returns
+// nil when percentiles are missing or the tail is within bounds.
+func p99SpikeSignal(m ProbeMetrics) *AnalysisSignal {
+	if m.MedianLatency <= 0 || m.P99Latency <= 0 {
+		return nil
+	}
+	ratio := m.P99Latency / m.MedianLatency
+	delta := m.P99Latency - m.MedianLatency
+	if ratio < p99SpikeRatio || delta < p99SpikeMinDeltaMs {
+		return nil
+	}
+	sev := "warning"
+	if ratio >= p99SpikeCriticalRatio && delta >= p99SpikeCriticalDeltaMs {
+		sev = "critical"
+	}
+	return &AnalysisSignal{
+		Type:     "p99_spike",
+		Severity: sev,
+		Title:    "Latency Spikes (P99)",
+		Evidence: fmt.Sprintf("P50: %.1fms, P99: %.1fms (%.1f×), Max: %.1fms",
+			m.MedianLatency, m.P99Latency, ratio, m.MaxLatency),
+		Confidence: 0.85,
+	}
+}
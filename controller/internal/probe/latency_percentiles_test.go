@@ -0,0 +1,58 @@
+package probe
+
+import "testing"
+
+// TestComputeLatencyPercentiles verifies the single-sort percentiles match
+// percentile() and that the input is left unsorted.
+func TestComputeLatencyPercentiles(t *testing.T) {
+	vals := make([]float64, 0, 100)
+	for i := 100; i >= 1; i-- {
+		vals = append(vals, float64(i))
+	}
+	got := computeLatencyPercentiles(vals)
+	for _, c := range []struct {
+		name string
+		pct  int
+		v    float64
+	}{{"p50", 50, got.P50}, {"p95", 95, got.P95}, {"p99", 99, got.P99}} {
+		if want := percentile(vals, c.pct); c.v != want {
+			t.Errorf("%s = %v, want %v", c.name, c.v, want)
+		}
+	}
+	if got.Max != 100 {
+		t.Errorf("max = %v, want 100", got.Max)
+	}
+	if vals[0] != 100 {
+		t.Error("input slice was reordered")
+	}
+	if (computeLatencyPercentiles(nil) != latencyPercentiles{}) {
+		t.Error("empty input should give zero percentiles")
+	}
+}
+
+// TestP99SpikeSignal verifies only a tail both far above and well clear of
+// the median is flagged, and large spikes escalate to critical.
+func TestP99SpikeSignal(t *testing.T) {
+	cases := []struct {
+		name     string
+		p50, p99 float64
+		want     string // severity, "" for no signal
+	}{
+		{"steady", 40, 60, ""},
+		{"fast path ratio only", 2, 20, ""},
+		{"warning", 40, 150, "warning"},
+		{"critical", 30, 400, "critical"},
+		{"no percentiles", 0, 0, ""},
+	}
+	for _, c := range cases {
+		sig := p99SpikeSignal(ProbeMetrics{MedianLatency: c.p50, P99Latency: c.p99, MaxLatency: c.p99 * 2})
+		switch {
+		case c.want == "" && sig != nil:
+			t.Errorf("%s: unexpected signal %+v", c.name, sig)
+		case c.want != "" && sig == nil:
+			t.Errorf("%s: expected %s signal", c.name, c.want)
+		case sig != nil && (sig.Type != "p99_spike" || sig.Severity != c.want):
+			t.Errorf("%s: got %s/%s, want p99_spike/%s", c.name, sig.Type, sig.Severity, c.want)
+		}
+	}
+}
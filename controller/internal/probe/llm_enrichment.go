@@ -0,0 +1,160 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/llm"
+	"netwatcher-controller/internal/logging"
+)
+
+// ── Async LLM Enrichment ──
+//
+// Analysis never waits for the LLM: it queues the summary (enrichWithLLM)
+// and saves its snapshot with the rule-based message and
+// enrichment_status "pending". When the queue finishes the job, each
+// pending snapshot with the same cache key gets a row in
+// analysis_snapshot_enrichments, keyed by the snapshot's workspace_id and
+// generated_at, which GetAnalysisSnapshots lays over the snapshot.
+// Snapshots themselves are never rewritten. The tokens are booked on the
+// oldest of them, the one saved when the job was queued; the rest count as
+// reused. A failed or skipped job (including one skipped because no
+// provider is configured) only records the status.
+//
+// Later analyses with the same inputs pick the finished summary up
+// directly, so only snapshots saved while the job ran need a row.
+
+// StartLLMEnrichmentWorker works the LLM enrichment queue until ctx ends.
+// It does nothing when no LLM manager is configured.
+func StartLLMEnrichmentWorker(ctx context.Context, ch *sql.DB) {
+	if llmManager == nil {
+		return
+	}
+	analysisLog.Info("[llm_queue] enrichment worker started")
+	llmManager.RunQueue(ctx, func(ctx context.Context, job llm.Job) {
+		if err := applyLLMEnrichment(ctx, ch, job); err != nil {
+			analysisLog.WithField(logging.FieldWorkspace, job.WorkspaceID).Warnf("[llm_queue] snapshot update failed: %v", err)
+		}
+	})
+}
+
+// analysisEnrichmentsDDL is the ClickHouse table of finished enrichments.
+// Rows are only appended; a duplicate for the same snapshot (two replicas
+// finishing the same job) collapses to the latest.
+const analysisEnrichmentsDDL = `
+	CREATE TABLE IF NOT EXISTS analysis_snapshot_enrichments (
+		workspace_id          UInt64,
+		generated_at          DateTime('UTC'),
+		enrichment_status     LowCardinality(String),
+		llm_summary           String,
+		llm_cached            UInt8,
+		llm_prompt_tokens     UInt32,
+		llm_completion_tokens UInt32,
+		applied_at            DateTime('UTC') DEFAULT now('UTC')
+	)
+	ENGINE = ReplacingMergeTree(applied_at)
+	PARTITION BY toYYYYMM(generated_at)
+	ORDER BY (workspace_id, generated_at)
+	TTL %s;
+`
+
+// applyLLMEnrichment records a finished job for the snapshots waiting for it.
+func applyLLMEnrichment(ctx context.Context, ch *sql.DB, job llm.Job) error {
+	if ch == nil {
+		return nil
+	}
+	rows, err := ch.QueryContext(ctx, fmt.Sprintf(`
+SELECT generated_at FROM analysis_snapshots
+WHERE workspace_id = %d AND llm_cache_key = %s AND enrichment_status = 'pending'
+  AND generated_at NOT IN (SELECT generated_at FROM analysis_snapshot_enrichments WHERE workspace_id = %d)
+ORDER BY generated_at`, job.WorkspaceID, chQuoteString(job.CacheKey), job.WorkspaceID))
+	if err != nil {
+		return err
+	}
+	var pending []time.Time
+	for rows.Next() {
+		var at time.Time
+		if err := rows.Scan(&at); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, at)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil // no snapshot was saved while the job ran
+	}
+
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO analysis_snapshot_enrichments\n" +
+		"(workspace_id, generated_at, enrichment_status, llm_summary, llm_cached, llm_prompt_tokens, llm_completion_tokens, applied_at)\nVALUES ")
+	args := make([]any, 0, len(pending)*8)
+	now := time.Now().UTC()
+	for i, at := range pending {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?, ?, ?, ?)")
+		var summary string
+		var cached uint8
+		var prompt, completion uint32
+		if job.Status == llm.JobDone {
+			summary = job.Summary
+			if i == 0 {
+				prompt, completion = uint32(job.PromptTokens), uint32(job.CompletionTokens)
+			} else {
+				cached = 1
+			}
+		}
+		args = append(args, uint64(job.WorkspaceID), at, string(job.Status), summary, cached, prompt, completion, now)
+	}
+	_, err = ch.ExecContext(ctx, sb.String(), args...)
+	return err
+}
+
+// enrichmentJoinSQL joins a workspace's enrichments (alias e) onto
+// analysis_snapshots (alias s); see snapshotColumnsSQL.
+func enrichmentJoinSQL(workspaceID uint, embedded bool) string {
+	final := " FINAL"
+	if embedded {
+		final = ""
+	}
+	return fmt.Sprintf(`
+LEFT JOIN (
+    SELECT generated_at, enrichment_status, llm_summary, llm_cached, llm_prompt_tokens, llm_completion_tokens
+    FROM analysis_snapshot_enrichments%s
+    WHERE workspace_id = %d
+) e ON e.generated_at = s.generated_at`, final, workspaceID)
+}
+
+// snapshotEnrichedColumnsSQL selects the enrichment-dependent snapshot
+// columns, taking the recorded enrichment when there is one. Unmatched
+// rows are NULL on SQLite and defaults on ClickHouse, hence COALESCE.
+const snapshotEnrichedColumnsSQL = `
+    CASE WHEN COALESCE(e.enrichment_status, '') = 'done' THEN e.llm_summary ELSE s.status_message END,
+    CASE WHEN COALESCE(e.enrichment_status, '') = 'done' THEN e.llm_summary ELSE s.llm_summary END,
+    CASE WHEN COALESCE(e.enrichment_status, '') = '' THEN s.llm_cached ELSE e.llm_cached END,
+    CASE WHEN COALESCE(e.enrichment_status, '') = '' THEN s.llm_prompt_tokens ELSE e.llm_prompt_tokens END,
+    CASE WHEN COALESCE(e.enrichment_status, '') = '' THEN s.llm_completion_tokens ELSE e.llm_completion_tokens END,
+    CASE WHEN COALESCE(e.enrichment_status, '') = '' THEN s.enrichment_status ELSE e.enrichment_status END`
+
+// migrateEnrichmentColumnSQLite adds enrichment_status to embedded
+// analysis_snapshots tables created before it existed.
+func migrateEnrichmentColumnSQLite(ctx context.Context, db *sql.DB) error {
+	var n int
+	if err := db.QueryRowContext(ctx,
+		`SELECT count(*) FROM pragma_table_info('analysis_snapshots') WHERE name = 'enrichment_status'`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `ALTER TABLE analysis_snapshots ADD COLUMN enrichment_status TEXT NOT NULL DEFAULT ''`)
+	return err
+}
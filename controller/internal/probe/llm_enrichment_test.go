@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/llm"
+)
+
+// TestApplyLLMEnrichment checks that a finished job replaces the message of
+// the snapshots saved while it was pending, booking tokens once, without
+// rewriting the snapshot rows.
+func TestApplyLLMEnrichment(t *testing.T) {
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	prev := activeTelemetryBackend
+	activeTelemetryBackend = TelemetrySQLite
+	defer func() { activeTelemetryBackend = prev }()
+	db := store.DB()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, key := range []string{"k1", "k1", "k2"} {
+		a := &WorkspaceAnalysis{
+			WorkspaceID:      4,
+			GeneratedAt:      now.Add(time.Duration(i) * time.Minute),
+			Status:           StatusSummary{Status: "degraded", Message: "rule-based"},
+			LLM:              &LLMUsage{CacheKey: key},
+			EnrichmentStatus: string(llm.JobPending),
+		}
+		if err := SaveAnalysisSnapshot(ctx, db, a); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	job := llm.Job{WorkspaceID: 4, CacheKey: "k1", Status: llm.JobDone, Summary: "It's the ISP.", PromptTokens: 100, CompletionTokens: 20}
+	if err := applyLLMEnrichment(ctx, db, job); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	snaps, err := GetAnalysisSnapshots(ctx, db, 4, time.Time{}, time.Time{}, 10)
+	if err != nil || len(snaps) != 3 {
+		t.Fatalf("snapshots = %d, %v", len(snaps), err)
+	}
+	// Newest first: k2, k1 (reused), k1 (first).
+	if s := snaps[0]; s.StatusMessage != "rule-based" || s.EnrichmentStatus != "pending" {
+		t.Errorf("other key updated: %+v", s)
+	}
+	if s := snaps[1]; s.StatusMessage != job.Summary || s.EnrichmentStatus != "done" || !s.LLMCached || s.LLMPromptTokens != 0 {
+		t.Errorf("later snapshot = %+v", s)
+	}
+	if s := snaps[2]; s.StatusMessage != job.Summary || s.LLMCached || s.LLMPromptTokens != 100 || s.LLMCompletionTokens != 20 {
+		t.Errorf("first snapshot = %+v", s)
+	}
+
+	// The snapshots themselves are not rewritten, and a second delivery of
+	// the same job adds nothing.
+	var rewritten, recorded int
+	db.QueryRow(`SELECT count(*) FROM analysis_snapshots WHERE status_message <> 'rule-based' OR enrichment_status <> 'pending'`).Scan(&rewritten)
+	if err := applyLLMEnrichment(ctx, db, job); err != nil {
+		t.Fatalf("apply again: %v", err)
+	}
+	db.QueryRow(`SELECT count(*) FROM analysis_snapshot_enrichments`).Scan(&recorded)
+	if rewritten != 0 || recorded != 2 {
+		t.Errorf("rewritten snapshots = %d, enrichment rows = %d; want 0 and 2", rewritten, recorded)
+	}
+
+	if err := applyLLMEnrichment(ctx, db, llm.Job{WorkspaceID: 4, CacheKey: "k2", Status: llm.JobFailed}); err != nil {
+		t.Fatalf("apply failed job: %v", err)
+	}
+	snaps, _ = GetAnalysisSnapshots(ctx, db, 4, time.Time{}, time.Time{}, 1)
+	if snaps[0].EnrichmentStatus != "failed" || snaps[0].StatusMessage != "rule-based" {
+		t.Errorf("failed job: %+v", snaps[0])
+	}
+}
@@ -0,0 +1,25 @@
+package probe
+
+import (
+	"netwatcher-controller/internal/logging"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Subsystem loggers (see internal/logging). Their levels are set per
+// subsystem at runtime, independent of the global logger.
+var (
+	analysisLog = logging.For(logging.Analysis)
+	ingestLog   = logging.For(logging.Ingest)
+	mapLog      = logging.For(logging.Map)
+)
+
+// ingestEntry returns the ingest logger tagged with a result's agent,
+// probe and type.
+func ingestEntry(d ProbeData) *log.Entry {
+	return ingestLog.WithFields(log.Fields{
+		logging.FieldAgent: d.AgentID,
+		logging.FieldProbe: d.ProbeID,
+		logging.FieldType:  string(d.Type),
+	})
+}
@@ -5,11 +5,12 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	log "github.com/sirupsen/logrus"
+	"fmt"
 	"gorm.io/gorm"
 	"time"
 
 	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/logging"
 )
 
 func initMtr(db *sql.DB, pg *gorm.DB) {
@@ -19,23 +20,41 @@ func initMtr(db *sql.DB, pg *gorm.DB) {
 			if len(p.Report.Hops) == 0 {
 				return errors.New("no hops")
 			}
+			if !p.StartTimestamp.IsZero() && !p.StopTimestamp.IsZero() && p.StopTimestamp.Before(p.StartTimestamp.Time) {
+				return fmt.Errorf("%w: stop_timestamp %s is before start_timestamp %s", ErrBadInput, p.StopTimestamp, p.StartTimestamp)
+			}
 			return nil
 		},
 		func(ctx context.Context, data ProbeData, p mtrPayload) error {
+			fillMtrTimestamps(&p, data.CreatedAt)
 			if err := SaveRecordWithAlertEval(ctx, db, pg, data, string(TypeMTR), p); err != nil {
-				log.WithError(err).Error("save mtr record (CH)")
+				ingestEntry(data).WithError(err).Error("save mtr record (CH)")
 				return err
 			}
 
 			captureMtrBaseline(ctx, pg, data.ProbeID, data.AgentID, p)
 
-			log.Printf("[mtr] probe=%d hops=%d triggered=%v",
+			ingestEntry(data).Infof("[mtr] probe=%d hops=%d triggered=%v",
 				data.ProbeID, len(p.Report.Hops), data.Triggered)
 			return nil
 		},
 	))
 }
 
+// fillMtrTimestamps stores a trace's missing start and stop times as the
+// result's creation time, so every stored trace has both.
+func fillMtrTimestamps(p *mtrPayload, createdAt time.Time) {
+	if p.StartTimestamp.IsZero() {
+		p.StartTimestamp = NewTimestamp(createdAt)
+		if !p.StopTimestamp.IsZero() && p.StopTimestamp.Before(createdAt) {
+			p.StartTimestamp = p.StopTimestamp
+		}
+	}
+	if p.StopTimestamp.IsZero() {
+		p.StopTimestamp = p.StartTimestamp
+	}
+}
+
 // captureMtrBaseline records the "expected" route for change detection. It
 // only ever runs for the FORWARD direction of a probe (the rows reported by
 // the probe owner) so that a single bidirectional AGENT probe — which stores
@@ -52,7 +71,7 @@ func captureMtrBaseline(ctx context.Context, pg *gorm.DB, probeID, reporterAgent
 	// sharing the same probe_id.
 	var ownerAgentID uint
 	if err := pg.WithContext(ctx).Model(&Probe{}).Select("agent_id").Where("id = ?", probeID).Scan(&ownerAgentID).Error; err != nil {
-		log.WithError(err).Warnf("mtr: failed to read probe owner for baseline gate (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).WithError(err).Warn("mtr: failed to read probe owner for baseline gate")
 		return
 	}
 	if ownerAgentID == 0 || ownerAgentID != reporterAgentID {
@@ -63,31 +82,31 @@ func captureMtrBaseline(ctx context.Context, pg *gorm.DB, probeID, reporterAgent
 
 	payloadJSON, err := json.Marshal(p)
 	if err != nil {
-		log.WithError(err).Warnf("mtr: failed to marshal payload for baseline capture (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).WithError(err).Warn("mtr: failed to marshal payload for baseline capture")
 		return
 	}
 	parsed, err := alert.ParseMtrPayload(payloadJSON)
 	if err != nil {
-		log.WithError(err).Warnf("mtr: failed to parse payload for baseline capture (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).WithError(err).Warn("mtr: failed to parse payload for baseline capture")
 		return
 	}
 	fp := alert.GetRouteFingerprint(parsed)
 	path := alert.GetRoutePathString(parsed)
 	hops := len(parsed.Report.Hops)
 	if _, err := alert.EnsureRouteBaseline(ctx, pg, probeID, fp, path, hops); err != nil {
-		log.WithError(err).Warnf("mtr: failed to ensure route baseline (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).WithError(err).Warn("mtr: failed to ensure route baseline")
 		return
 	}
 	if refreshed, err := alert.RefreshRouteBaselineIfStale(ctx, pg, probeID, fp, path, hops, routeBaselineStaleThreshold); err != nil {
-		log.WithError(err).Warnf("mtr: failed to refresh route baseline (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).WithError(err).Warn("mtr: failed to refresh route baseline")
 	} else if refreshed {
-		log.Infof("mtr: refreshed stale route baseline (probe=%d)", probeID)
+		ingestLog.WithField(logging.FieldProbe, probeID).Info("mtr: refreshed stale route baseline")
 	}
 }
 
 type mtrPayload struct {
-	StartTimestamp time.Time `json:"start_timestamp" bson:"start_timestamp"`
-	StopTimestamp  time.Time `json:"stop_timestamp" bson:"stop_timestamp"`
+	StartTimestamp Timestamp `json:"start_timestamp" bson:"start_timestamp"`
+	StopTimestamp  Timestamp `json:"stop_timestamp" bson:"stop_timestamp"`
 	Report         struct {
 		Info struct {
 			Target struct {
@@ -110,6 +129,9 @@ type mtrPayload struct {
 			Best       string   `json:"best" bson:"best"`
 			Worst      string   `json:"worst" bson:"worst"`
 			StdDev     string   `json:"stddev" bson:"stddev"`
+			Jitter     string   `json:"jitter" bson:"jitter"`
+			Javg       string   `json:"javg" bson:"javg"`
+			Jmax       string   `json:"jmax" bson:"jmax"`
 		} `json:"hops" bson:"hops"`
 	} `json:"report" bson:"report"`
 }
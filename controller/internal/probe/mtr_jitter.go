@@ -0,0 +1,70 @@
+package probe
+
+import "math"
+
+// ── MTR Per-Hop Jitter ──
+//
+// mtr reports, per hop, the latency stddev and jitter (last, mean "javg",
+// worst "jmax", interarrival "jint"). Queueing shows up as jitter at the
+// congested hop before it shows as loss or a higher mean, so the bucket
+// aggregation, path analysis and network map carry these per hop, and
+// path analysis reports the first hop where jitter rises and persists to
+// the destination.
+
+const (
+	// jitterOnsetMinMs and jitterOnsetRatio: a hop's mean jitter must
+	// reach this and be this many times the previous responding hop's.
+	jitterOnsetMinMs = 5.0
+	jitterOnsetRatio = 3.0
+	// jitterOnsetCarry is the share of the onset jitter the end hop must
+	// still show; a rise that fades downstream is the router's control
+	// plane answering ICMP slowly, not queueing on the path.
+	jitterOnsetCarry = 0.5
+)
+
+// appendJitter appends a parsed mtr jitter field, skipping empty ones so
+// agents that don't report jitter don't pull averages to zero.
+func appendJitter(vals []float64, s string) []float64 {
+	if s == "" {
+		return vals
+	}
+	return append(vals, parseLatency(s))
+}
+
+// pooledStdDev combines per-trace means and stddevs into the stddev of all
+// samples: within-trace variance plus the variance between trace means.
+// Traces are weighted equally.
+func pooledStdDev(means, sds []float64) float64 {
+	n := len(sds)
+	if n == 0 || len(means) != n {
+		return 0
+	}
+	mean := avg(means)
+	var v float64
+	for i := range sds {
+		d := means[i] - mean
+		v += sds[i]*sds[i] + d*d
+	}
+	return sanitizeFloat(math.Sqrt(v / float64(n)))
+}
+
+// jitterOnsetHop returns the hop number of the first hop where mean
+// jitter jumps and stays high through the final hop, or 0. hops are the
+// responding hops in path order.
+func jitterOnsetHop(hops []HopDetail) int {
+	if len(hops) < 2 {
+		return 0
+	}
+	end := hops[len(hops)-1].JitterAvg
+	prev := hops[0].JitterAvg
+	for i := 1; i < len(hops); i++ {
+		j := hops[i].JitterAvg
+		if j >= jitterOnsetMinMs && j >= prev*jitterOnsetRatio && end >= j*jitterOnsetCarry {
+			return hops[i].Hop
+		}
+		if j > 0 {
+			prev = j
+		}
+	}
+	return 0
+}
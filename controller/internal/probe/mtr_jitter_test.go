@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregateMtrPayloadsKeepsJitter(t *testing.T) {
+	trace := func(avg, sd, javg, jmax string) MtrPayload {
+		return MtrPayload{Report: MtrReport{Hops: []MtrHop{
+			{TTL: 1, Hosts: []MtrHopHost{{IP: "10.0.0.1"}}, Sent: 10, Recv: 10, Avg: "1.0", StdDev: "0.1"},
+			{TTL: 2, Hosts: []MtrHopHost{{IP: "192.0.2.1"}}, Sent: 10, Recv: 10, Avg: avg, StdDev: sd, Javg: javg, Jmax: jmax, Jitter: javg},
+		}}}
+	}
+	agg := aggregateMtrPayloads([]MtrPayload{trace("10", "3", "2.0", "6.0"), trace("14", "3", "4.0", "9.5")}, time.Now(), time.Minute, "sig")
+	hop := agg.Report.Hops[1]
+	// Pooled: sqrt(mean(3²) + variance of means (2²)) = sqrt(13).
+	if want := math.Sqrt(13); math.Abs(parseLatency(hop.StdDev)-want) > 0.01 {
+		t.Errorf("stddev = %s, want %.2f", hop.StdDev, want)
+	}
+	if hop.Javg != "3.00" || hop.Jmax != "9.50" || hop.Jitter != "3.00" {
+		t.Errorf("jitter = %s/%s/%s, want 3.00/9.50/3.00", hop.Jitter, hop.Javg, hop.Jmax)
+	}
+	if first := agg.Report.Hops[0]; first.Javg != "" || first.StdDev != "0.10" {
+		t.Errorf("hop 1 = %+v, want stddev only", first)
+	}
+}
+
+func TestJitterOnsetHop(t *testing.T) {
+	hops := func(j ...float64) []HopDetail {
+		out := make([]HopDetail, len(j))
+		for i, v := range j {
+			out[i] = HopDetail{Hop: i + 2, JitterAvg: v}
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		hops []HopDetail
+		want int
+	}{
+		{"flat", hops(0.5, 0.8, 1.0, 1.2), 0},
+		{"onset persists", hops(0.5, 0.8, 9, 8, 10), 4},
+		{"slow control plane", hops(0.5, 12, 1.0, 1.1), 0},
+		{"too small", hops(0.2, 0.9, 1.0), 0},
+	} {
+		if got := jitterOnsetHop(tc.hops); got != tc.want {
+			t.Errorf("%s: onset = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
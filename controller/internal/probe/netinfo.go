@@ -6,23 +6,39 @@ import (
 	"fmt"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
-func initNetInfo(db *sql.DB) {
+func initNetInfo(db *sql.DB, pg *gorm.DB) {
 	Register(NewHandler[netInfoPayload](
 		TypeNetInfo,
 		func(p netInfoPayload) error {
 			return nil
 		},
 		func(ctx context.Context, data ProbeData, p netInfoPayload) error {
-			if err := SaveRecordCH(ctx, db, data, string(TypeNetInfo), p); err != nil {
-				log.WithError(err).Error("save netinfo record (CH)")
+			stored, sealed, err := sealPayloadFor(ctx, data, TypeNetInfo, p)
+			if err != nil {
+				ingestEntry(data).WithError(err).Error("seal netinfo record")
 				return err
 			}
+			if err := SaveRecordCH(ctx, db, data, string(TypeNetInfo), stored); err != nil {
+				ingestEntry(data).WithError(err).Error("save netinfo record (CH)")
+				return err
+			}
+			// Public IP history feeds probe target resolution, so it is
+			// recorded even when the stored payload is sealed.
+			if pg != nil {
+				if err := RecordPublicIP(ctx, pg, data.AgentID, p, data.CreatedAt); err != nil {
+					ingestEntry(data).WithError(err).Warnf("[netinfo] agent=%d: record public IP history", data.AgentID)
+				}
+			}
+			if sealed {
+				ingestEntry(data).Debugf("[netinfo] agent=%d probe=%d stored sealed", data.AgentID, data.ProbeID)
+				return nil
+			}
 
 			// Log with agent ID for debugging IP resolution issues
-			log.Infof("[netinfo] agent=%d probe=%d wan=%s lan=%s gw=%s source=%s",
+			ingestEntry(data).Infof("[netinfo] agent=%d probe=%d wan=%s lan=%s gw=%s source=%s",
 				data.AgentID, data.ProbeID, p.PublicAddress, p.LocalAddress, p.DefaultGateway, p.Source)
 			return nil
 		},
@@ -80,6 +96,7 @@ type netInfoPayload struct {
 	// P1.1: Rich interface and route data (optional, new agents only)
 	Interfaces []InterfaceInfo `json:"interfaces,omitempty" bson:"interfaces,omitempty"`
 	Routes     []RouteEntry    `json:"routes,omitempty" bson:"routes,omitempty"`
+	DNSServers []string        `json:"dns_servers,omitempty" bson:"dns_servers,omitempty"`
 
 	// New: Rich geographic info (optional, new agents only)
 	Geo *GeoInfo `json:"geo,omitempty" bson:"geo,omitempty"`
@@ -0,0 +1,222 @@
+package probe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── NETINFO Change Detection ──
+//
+// Consecutive NETINFO reports are diffed per agent. Besides public IP and
+// ISP, newer agents report their interface inventory and DNS servers, so
+// gateway swaps, interfaces appearing or disappearing, resolver changes
+// and VPN tunnels coming up or going down are detected too. Diffs that
+// need the inventory only run when both reports carry it, so an agent
+// upgrade does not look like every interface being added.
+
+// netInfoChange fields beyond public_ip / isp.
+const (
+	netInfoFieldGateway          = "gateway"
+	netInfoFieldDNS              = "dns_servers"
+	netInfoFieldInterfaceAdded   = "interface_added"
+	netInfoFieldInterfaceRemoved = "interface_removed"
+	netInfoFieldVPNUp            = "vpn_up"
+	netInfoFieldVPNDown          = "vpn_down"
+)
+
+// vpnInterfacePrefixes are interface names treated as VPN tunnels when the
+// agent does not report Type "vpn".
+var vpnInterfacePrefixes = []string{"tun", "tap", "wg", "utun", "ppp", "ipsec", "zt", "tailscale"}
+
+// diffNetInfo returns the changes between an agent's previous and latest
+// NETINFO reports.
+func diffNetInfo(agentID uint, older, newer netInfoPayload, at time.Time) []netInfoChange {
+	var changes []netInfoChange
+	add := func(field, oldV, newV string) {
+		changes = append(changes, netInfoChange{
+			AgentID:    agentID,
+			Field:      field,
+			OldValue:   oldV,
+			NewValue:   newV,
+			DetectedAt: at,
+		})
+	}
+
+	if newer.PublicAddress != older.PublicAddress && newer.PublicAddress != "" {
+		add("public_ip", older.PublicAddress, newer.PublicAddress)
+	}
+	newISP := newer.GetISP()
+	oldISP := older.GetISP()
+	if newISP != oldISP && newISP != "" && oldISP != "" {
+		add("isp", oldISP, newISP)
+	}
+
+	if newer.DefaultGateway != older.DefaultGateway && newer.DefaultGateway != "" && older.DefaultGateway != "" {
+		add(netInfoFieldGateway, older.DefaultGateway, newer.DefaultGateway)
+	}
+
+	if len(newer.DNSServers) > 0 && len(older.DNSServers) > 0 {
+		oldDNS, newDNS := joinSorted(older.DNSServers), joinSorted(newer.DNSServers)
+		if oldDNS != newDNS {
+			add(netInfoFieldDNS, oldDNS, newDNS)
+		}
+	}
+
+	if len(newer.Interfaces) == 0 || len(older.Interfaces) == 0 {
+		return changes
+	}
+	oldIfaces, oldVPN := indexInterfaces(older.Interfaces)
+	newIfaces, newVPN := indexInterfaces(newer.Interfaces)
+	for _, name := range sortedKeys(newIfaces) {
+		if _, ok := oldIfaces[name]; !ok {
+			add(netInfoFieldInterfaceAdded, "", name)
+		}
+	}
+	for _, name := range sortedKeys(oldIfaces) {
+		if _, ok := newIfaces[name]; !ok {
+			add(netInfoFieldInterfaceRemoved, name, "")
+		}
+	}
+	for _, name := range sortedKeys(newVPN) {
+		if !oldVPN[name] && newVPN[name] {
+			add(netInfoFieldVPNUp, "", name)
+		}
+	}
+	for _, name := range sortedKeys(oldVPN) {
+		if oldVPN[name] && !newVPN[name] {
+			add(netInfoFieldVPNDown, name, "")
+		}
+	}
+	return changes
+}
+
+// indexInterfaces splits an inventory into physical interfaces (by name)
+// and VPN tunnels (name → up). Loopbacks are ignored; a VPN interface that
+// is present but not up counts as down.
+func indexInterfaces(ifaces []InterfaceInfo) (map[string]bool, map[string]bool) {
+	phys := make(map[string]bool)
+	vpn := make(map[string]bool)
+	for _, iface := range ifaces {
+		if iface.Name == "" || strings.EqualFold(iface.Type, "loopback") {
+			continue
+		}
+		if isVPNInterface(iface) {
+			vpn[iface.Name] = vpn[iface.Name] || interfaceUp(iface)
+			continue
+		}
+		phys[iface.Name] = true
+	}
+	return phys, vpn
+}
+
+func isVPNInterface(iface InterfaceInfo) bool {
+	if strings.EqualFold(iface.Type, "vpn") {
+		return true
+	}
+	name := strings.ToLower(iface.Name)
+	for _, p := range vpnInterfacePrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceUp treats a missing flag list as up: older agents only report
+// interfaces that are configured.
+func interfaceUp(iface InterfaceInfo) bool {
+	if len(iface.Flags) == 0 {
+		return true
+	}
+	for _, f := range iface.Flags {
+		if strings.EqualFold(f, "up") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinSorted(vals []string) string {
+	sorted := append([]string(nil), vals...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// netInfoChangeIncident builds the workspace incident for a gateway, DNS,
+// interface or VPN change. public_ip and isp are handled by the caller.
+func netInfoChangeIncident(change netInfoChange, agentName string) (DetectedIncident, bool) {
+	inc := DetectedIncident{
+		Scope:           "agent-specific",
+		AffectedAgents:  []string{agentName},
+		AffectedTargets: []string{},
+	}
+	switch change.Field {
+	case netInfoFieldGateway:
+		inc.ID = fmt.Sprintf("gateway_change_%d", change.AgentID)
+		inc.Title = fmt.Sprintf("Default gateway changed on %s", agentName)
+		inc.Severity = "warning"
+		inc.SuggestedCause = "The default gateway changed — this may indicate a router replacement, DHCP change or failover to a backup link"
+		inc.Evidence = []string{
+			fmt.Sprintf("Previous gateway: %s", change.OldValue),
+			fmt.Sprintf("Current gateway: %s", change.NewValue),
+		}
+		inc.Recommendations = []string{
+			"Verify the new gateway is expected for this site",
+			"Compare latency and loss before and after the change",
+		}
+	case netInfoFieldDNS:
+		inc.ID = fmt.Sprintf("dns_servers_change_%d", change.AgentID)
+		inc.Title = fmt.Sprintf("DNS servers changed on %s", agentName)
+		inc.Severity = "info"
+		inc.SuggestedCause = "The configured DNS resolvers changed — this may follow a DHCP lease, VPN connection or manual reconfiguration"
+		inc.Evidence = []string{
+			fmt.Sprintf("Previous: %s", change.OldValue),
+			fmt.Sprintf("Current: %s", change.NewValue),
+		}
+		inc.Recommendations = []string{
+			"Verify the new resolvers are approved for this site",
+			"Check DNS probe latency against the new resolvers",
+		}
+	case netInfoFieldInterfaceAdded, netInfoFieldInterfaceRemoved:
+		name, verb := change.NewValue, "added"
+		if change.Field == netInfoFieldInterfaceRemoved {
+			name, verb = change.OldValue, "removed"
+		}
+		inc.ID = fmt.Sprintf("interface_%s_%d_%s", verb, change.AgentID, sanitizeKey(name))
+		inc.Title = fmt.Sprintf("Interface %s %s on %s", name, verb, agentName)
+		inc.Severity = "info"
+		inc.SuggestedCause = fmt.Sprintf("Network interface %s was %s — this may indicate a cable, adapter or virtual network change", name, verb)
+		inc.Evidence = []string{fmt.Sprintf("Interface: %s (%s)", name, verb)}
+		inc.Recommendations = []string{
+			"Confirm the hardware or configuration change was planned",
+		}
+	case netInfoFieldVPNUp, netInfoFieldVPNDown:
+		name, state, sev := change.NewValue, "up", "info"
+		if change.Field == netInfoFieldVPNDown {
+			name, state, sev = change.OldValue, "down", "warning"
+		}
+		inc.ID = fmt.Sprintf("vpn_%s_%d_%s", state, change.AgentID, sanitizeKey(name))
+		inc.Title = fmt.Sprintf("VPN %s went %s on %s", name, state, agentName)
+		inc.Severity = sev
+		inc.SuggestedCause = fmt.Sprintf("VPN tunnel %s went %s — traffic may now take a different path", name, state)
+		inc.Evidence = []string{fmt.Sprintf("Tunnel: %s (%s)", name, state)}
+		inc.Recommendations = []string{
+			"Check whether probe results changed with the tunnel state",
+			"Verify the VPN client or site-to-site tunnel is healthy",
+		}
+	default:
+		return DetectedIncident{}, false
+	}
+	return inc, true
+}
@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDiffNetInfo verifies gateway, DNS, interface and VPN changes are
+// reported alongside public IP, and that order-only DNS differences and
+// loopbacks are ignored.
+func TestDiffNetInfo(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	older := netInfoPayload{
+		PublicAddress:  "203.0.113.10",
+		DefaultGateway: "192.168.1.1",
+		DNSServers:     []string{"1.1.1.1", "8.8.8.8"},
+		Interfaces: []InterfaceInfo{
+			{Name: "lo", Type: "loopback"},
+			{Name: "eth0", Type: "ethernet", Flags: []string{"up"}},
+			{Name: "wlan0", Type: "wifi", Flags: []string{"up"}},
+			{Name: "wg0", Flags: []string{"up"}},
+		},
+	}
+	newer := netInfoPayload{
+		PublicAddress:  "203.0.113.10",
+		DefaultGateway: "10.0.0.1",
+		DNSServers:     []string{"8.8.8.8", "1.1.1.1"},
+		Interfaces: []InterfaceInfo{
+			{Name: "eth0", Type: "ethernet", Flags: []string{"up"}},
+			{Name: "eth1", Type: "ethernet", Flags: []string{"up"}},
+			{Name: "wg0", Flags: []string{"broadcast"}},
+			{Name: "tun0", Type: "vpn"},
+		},
+	}
+
+	got := make(map[string]netInfoChange)
+	for _, c := range diffNetInfo(7, older, newer, at) {
+		if c.AgentID != 7 || !c.DetectedAt.Equal(at) {
+			t.Errorf("change %+v has wrong agent or time", c)
+		}
+		got[c.Field+":"+c.OldValue+">"+c.NewValue] = c
+	}
+	want := []string{
+		"gateway:192.168.1.1>10.0.0.1",
+		"interface_added:>eth1",
+		"interface_removed:wlan0>",
+		"vpn_up:>tun0",
+		"vpn_down:wg0>",
+	}
+	for _, k := range want {
+		if _, ok := got[k]; !ok {
+			t.Errorf("missing change %s (got %v)", k, got)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d changes, want %d: %v", len(got), len(want), got)
+	}
+
+	// An agent that starts reporting its inventory is not a change.
+	legacy := netInfoPayload{PublicAddress: "203.0.113.10", DefaultGateway: "10.0.0.1"}
+	if changes := diffNetInfo(7, legacy, newer, at); len(changes) != 0 {
+		t.Errorf("upgrade produced changes: %+v", changes)
+	}
+}
+
+// TestNetInfoChangeIncident verifies new change fields map to scoped
+// incidents and unknown fields are skipped.
+func TestNetInfoChangeIncident(t *testing.T) {
+	inc, ok := netInfoChangeIncident(netInfoChange{AgentID: 3, Field: netInfoFieldGateway, OldValue: "a", NewValue: "b"}, "Branch")
+	if !ok || inc.Title != "Default gateway changed on Branch" || inc.Scope != "agent-specific" || inc.Severity != "warning" {
+		t.Errorf("gateway incident = %+v", inc)
+	}
+	inc, ok = netInfoChangeIncident(netInfoChange{AgentID: 3, Field: netInfoFieldVPNDown, OldValue: "wg0"}, "Branch")
+	if !ok || inc.ID != "vpn_down_3_wg0" || inc.Severity != "warning" {
+		t.Errorf("vpn incident = %+v", inc)
+	}
+	if _, ok := netInfoChangeIncident(netInfoChange{Field: "public_ip"}, "Branch"); ok {
+		t.Error("public_ip should be left to the caller")
+	}
+}
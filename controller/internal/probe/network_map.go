@@ -13,7 +13,11 @@ import (
 	"strings"
 	"time"
 
+	"netwatcher-controller/internal/logging"
+	"netwatcher-controller/internal/region"
+
 	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -68,14 +72,22 @@ type NetworkMapNode struct {
 	HopNumber  int     `json:"hop_number,omitempty"`
 	AvgLatency float64 `json:"avg_latency"`
 	PacketLoss float64 `json:"packet_loss"`
-	PathCount  int     `json:"path_count"`
-	IsOnline   bool    `json:"is_online,omitempty"`
+	// Hop nodes: latency spread and mean/worst jitter from MTR, averaged
+	// over the paths through the hop like avg_latency. Jitter that starts
+	// at a hop is often the first sign of congestion there.
+	StdDev    float64 `json:"stddev,omitempty"`
+	Jitter    float64 `json:"jitter,omitempty"`
+	JitterMax float64 `json:"jitter_max,omitempty"`
+	PathCount int     `json:"path_count"`
+	IsOnline  bool    `json:"is_online,omitempty"`
 	// Visualization fields
 	Layer  int    `json:"layer,omitempty"`  // 0=agent, 1-N=hops, 100=destination
 	Status string `json:"status,omitempty"` // "healthy", "degraded", "critical"
 	// Shared hop tracking
 	SharedAgents []uint   `json:"shared_agents,omitempty"` // Agent IDs that traverse this hop
 	PathIDs      []string `json:"path_ids,omitempty"`      // Traceroute paths through this hop
+	// Probe metadata of a destination (see probe_metadata.go)
+	Metadata *ProbeMetadata `json:"metadata,omitempty"`
 }
 
 // NetworkMapEdge represents an edge (link) between nodes
@@ -87,6 +99,15 @@ type NetworkMapEdge struct {
 	PacketLoss float64  `json:"packet_loss"`
 	PathCount  int      `json:"path_count"`
 	PathIDs    []string `json:"path_ids,omitempty"` // All path identifiers that use this edge (agent:target format)
+	// Utilization weighting (see network_map_utilization.go)
+	TrafficPackets int64   `json:"traffic_packets,omitempty"` // TrafficSim packets sent over paths using this edge
+	ThroughputMbps float64 `json:"throughput_mbps,omitempty"` // Speedtest download of the source agent (first-hop edges)
+	Utilization    float64 `json:"utilization"`               // 0-1, relative to the busiest edge in the map
+	Weight         string  `json:"weight,omitempty"`          // "heavy", "moderate", "light", "idle"
+	LoadedLossy    bool    `json:"loaded_lossy,omitempty"`    // Heavily used and losing packets
+	PriorityScore  float64 `json:"priority_score"`            // 0-100, loss weighted by utilization
+	// Stands in for hops cut by a max_hops filter (see network_map_filter.go)
+	Collapsed bool `json:"collapsed,omitempty"`
 }
 
 // EndpointInfo contains IP with associated agent context
@@ -136,6 +157,7 @@ type DestinationSummary struct {
 	LastUpdated       string                `json:"last_updated,omitempty"`
 	HasBidirectional  bool                  `json:"has_bidirectional"`  // ANY bidirectional probe exists
 	ExpandedEndpoints []ProbeEndpointDetail `json:"expanded_endpoints"` // ALL endpoints with per-agent details
+	Metadata          *ProbeMetadata        `json:"metadata,omitempty"` // display name, circuit, owner of the probe(s)
 }
 
 // NetworkMapData contains the complete topology data for a workspace
@@ -143,8 +165,14 @@ type NetworkMapData struct {
 	Nodes        []NetworkMapNode     `json:"nodes"`
 	Edges        []NetworkMapEdge     `json:"edges"`
 	Destinations []DestinationSummary `json:"destinations"` // Quick overview panel
+	Freshness    *DataFreshness       `json:"freshness,omitempty"`
 	GeneratedAt  time.Time            `json:"generated_at"`
 	WorkspaceID  uint                 `json:"workspace_id"`
+	// Set when node/edge caps trimmed the map; totals are before capping
+	// (see network_map_filter.go)
+	Truncated  bool `json:"truncated,omitempty"`
+	TotalNodes int  `json:"total_nodes,omitempty"`
+	TotalEdges int  `json:"total_edges,omitempty"`
 }
 
 // Agent model for querying (simplified)
@@ -154,7 +182,19 @@ type agentInfo struct {
 	Description      string
 	PublicIPOverride string `gorm:"column:public_ip_override"`
 	Location         string
+	CreatedAt        time.Time
 	UpdatedAt        time.Time
+
+	// Connectivity inputs (see agent.ResolveConnectivityThresholds)
+	LastSeenAt              time.Time
+	NetworkType             string
+	OfflineThresholdSeconds int
+	Labels                  datatypes.JSON
+
+	// Provisioned circuit (see provisioned_bandwidth.go)
+	ProvisionedDownMbps float64
+	ProvisionedUpMbps   float64
+	Timezone            string
 }
 
 // GetWorkspaceNetworkMap builds aggregated network topology from MTR/PING/TrafficSim data
@@ -218,13 +258,26 @@ func GetWorkspaceNetworkMap(ctx context.Context, ch *sql.DB, pg *gorm.DB, worksp
 	probePlans, err := workspaceAgentProbePlans(ctx, pg, workspaceID)
 	if err != nil {
 		// Non-fatal - we'll still have data-derived enablement
-		log.Warnf("[network-map] workspace=%d probe plan query error: %v", workspaceID, err)
+		mapLog.WithField(logging.FieldWorkspace, workspaceID).Warnf("[network-map] probe plan query error: %v", err)
 		probePlans = nil
 	}
 
 	// 5. Build the topology graph
 	mapData := buildNetworkMap(agents, mtrData, pingMetrics, trafficMetrics, workspaceID, probePlans)
 
+	// 5b. Weight edges by TrafficSim volume and speedtest throughput
+	speedMetrics, err := getWorkspaceSpeedtestMetrics(ctx, ch, agentIDs, from)
+	if err != nil {
+		speedMetrics = nil
+	}
+	applyEdgeUtilization(mapData.Edges, agentDownloadMbps(speedMetrics))
+
+	// 5c. Name destinations from probe metadata (display name, circuit)
+	applyProbeMetadataToMap(mapData, loadProbeMetadataIndex(ctx, pg, workspaceID))
+
+	// 6. Ingestion watermark so a lagging pipeline isn't mistaken for current state
+	mapData.Freshness = computeDataFreshness(ctx, ch, agents)
+
 	return mapData, nil
 }
 
@@ -238,11 +291,12 @@ func GetWorkspaceMTRDataForDebug(ctx context.Context, ch *sql.DB, pg *gorm.DB, a
 	return getWorkspaceMTRData(ctx, ch, pg, agentIDs, from)
 }
 
+// getWorkspaceAgents lists the workspace's agents whose telemetry this
+// controller holds: in a multi-region deployment, only its own region's.
 func getWorkspaceAgents(ctx context.Context, pg *gorm.DB, workspaceID uint) ([]agentInfo, error) {
 	var agents []agentInfo
-	err := pg.WithContext(ctx).
-		Table("agents").
-		Select("id, name, description, public_ip_override, location, updated_at").
+	err := ownedAgents(pg.WithContext(ctx).Table("agents")).
+		Select("id, name, description, public_ip_override, location, created_at, updated_at, last_seen_at, network_type, offline_threshold_seconds, labels, provisioned_down_mbps, provisioned_up_mbps, timezone").
 		Where("workspace_id = ?", workspaceID).
 		Scan(&agents).Error
 	if err != nil {
@@ -251,12 +305,24 @@ func getWorkspaceAgents(ctx context.Context, pg *gorm.DB, workspaceID uint) ([]a
 	return agents, nil
 }
 
+// ownedAgents limits an agents query to this controller's region (see
+// internal/region).
+func ownedAgents(q *gorm.DB) *gorm.DB {
+	if owned := region.OwnedRegions(); owned != nil {
+		return q.Where("region IN ?", owned)
+	}
+	return q
+}
+
 // mtrHop represents a single hop in an MTR trace
 type mtrHop struct {
 	IP         string
 	Hostname   string
 	AvgLatency float64
 	PacketLoss float64
+	StdDev     float64
+	JitterAvg  float64
+	JitterMax  float64
 }
 
 // mtrTrace represents a complete MTR trace from agent to target
@@ -307,14 +373,14 @@ SELECT
 FROM probe_data
 WHERE type = 'MTR'
   AND agent_id IN (%s)
-  AND created_at >= %s
+  AND created_at >= %s%s
 ORDER BY created_at DESC
 LIMIT %d
-`, agentIDList, chQuoteTime(from), mtrRowLimit)
+`, agentIDList, chQuoteTime(from), asOfBound(ctx), mtrRowLimit)
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
-		log.Printf("[NetworkMap] MTR query error: %v", err)
+		mapLog.Warnf("[network-map] MTR query error: %v", err)
 		return nil, err
 	}
 
@@ -331,7 +397,7 @@ LIMIT %d
 	for rows.Next() {
 		var r rawRow
 		if err := rows.Scan(&r.agentID, &r.target, &r.targetAgent, &r.probeAgentID, &r.probeID, &r.payloadRaw); err != nil {
-			log.Printf("[NetworkMap] Row scan error: %v", err)
+			mapLog.Warnf("[network-map] row scan error: %v", err)
 			continue
 		}
 		rawRows = append(rawRows, r)
@@ -436,7 +502,7 @@ LIMIT %d
 
 		// Skip if still no target — can't draw an edge to nothing.
 		if target == "" {
-			log.Printf("[NetworkMap] Agent %d: no target found in DB, probe, or payload, skipping", r.agentID)
+			mapLog.WithField(logging.FieldAgent, r.agentID).Debug("[network-map] no target found in DB, probe, or payload, skipping")
 			continue
 		}
 
@@ -456,12 +522,12 @@ LIMIT %d
 		}
 		seenPaths[pathKey] = true
 
-		log.Printf("[NetworkMap] Agent %d -> %s (targetAgent=%d) parsed", r.agentID, target, targetAgent)
+		mapLog.WithFields(log.Fields{logging.FieldAgent: r.agentID, logging.FieldTarget: target}).Debugf("[network-map] parsed (targetAgent=%d)", targetAgent)
 
 		// Parse hops.
 		var payload mtrPayload
 		if err := json.Unmarshal([]byte(r.payloadRaw), &payload); err != nil {
-			log.Printf("[NetworkMap] JSON parse error for agent %d: %v", r.agentID, err)
+			mapLog.WithField(logging.FieldAgent, r.agentID).Warnf("[network-map] JSON parse error: %v", err)
 			continue
 		}
 		var hops []mtrHop
@@ -476,10 +542,13 @@ LIMIT %d
 				Hostname:   hostname,
 				AvgLatency: parseFloat(hop.Avg),
 				PacketLoss: parseFloat(hop.LossPct),
+				StdDev:     parseFloat(hop.StdDev),
+				JitterAvg:  parseFloat(hop.Javg),
+				JitterMax:  parseFloat(hop.Jmax),
 			})
 		}
 
-		log.Printf("[NetworkMap] Trace: agent %d -> %s has %d hops", r.agentID, target, len(hops))
+		mapLog.WithFields(log.Fields{logging.FieldAgent: r.agentID, logging.FieldTarget: target}).Debugf("[network-map] trace has %d hops", len(hops))
 		traces = append(traces, mtrTrace{
 			AgentID:      uint(r.agentID),
 			Target:       target,
@@ -490,12 +559,13 @@ LIMIT %d
 		})
 	}
 
-	log.Printf("[NetworkMap] MTR query returned %d rows, parsed %d traces", rowCount, len(traces))
+	mapLog.Debugf("[network-map] MTR query returned %d rows, parsed %d traces", rowCount, len(traces))
 	return traces, nil
 }
 
 type pingStats struct {
 	AvgLatency  float64
+	Latency     latencyPercentiles // p50/p95/p99 of cycle averages; Max is the worst MaxRtt
 	PacketLoss  float64
 	Count       int
 	TargetAgent uint   // Agent ID if target is an agent, 0 otherwise
@@ -525,10 +595,10 @@ SELECT
 FROM probe_data
 WHERE type = 'PING'
   AND agent_id IN (%s)
-  AND created_at >= %s
+  AND created_at >= %s%s
 ORDER BY created_at DESC
 LIMIT 5000
-`, agentIDList, chQuoteTime(from))
+`, agentIDList, chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -539,6 +609,8 @@ LIMIT 5000
 	// Aggregate in Go
 	type pingAccum struct {
 		totalLatency float64
+		latencies    []float64
+		maxRtt       float64
 		totalLoss    float64
 		count        int
 		targetAgent  uint
@@ -561,12 +633,8 @@ LIMIT 5000
 			continue
 		}
 
-		// Parse ping payload
-		var payload struct {
-			AvgRTT     int64   `json:"avg_rtt"`     // nanoseconds
-			PacketLoss float64 `json:"packet_loss"` // percentage
-		}
-		if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
+		payload, err := ParsePingPayload([]byte(payloadRaw))
+		if err != nil {
 			continue
 		}
 
@@ -577,7 +645,12 @@ LIMIT 5000
 				probeAgents: make(map[uint]bool),
 			}
 		}
-		accum[key].totalLatency += float64(payload.AvgRTT) / 1000000.0 // ns to ms
+		latMs := float64(payload.AvgRtt) / 1000000.0 // ns to ms
+		accum[key].totalLatency += latMs
+		accum[key].latencies = append(accum[key].latencies, latMs)
+		if maxMs := float64(payload.MaxRtt) / 1000000.0; maxMs > accum[key].maxRtt {
+			accum[key].maxRtt = maxMs
+		}
 		accum[key].totalLoss += payload.PacketLoss
 		accum[key].count++
 		// Track unique probe agent IDs
@@ -594,8 +667,13 @@ LIMIT 5000
 			for agentID := range a.probeAgents {
 				probeAgents = append(probeAgents, agentID)
 			}
+			pct := computeLatencyPercentiles(a.latencies)
+			if a.maxRtt > pct.Max {
+				pct.Max = sanitizeFloat(a.maxRtt)
+			}
 			results[key] = pingStats{
 				AvgLatency:  a.totalLatency / float64(a.count),
+				Latency:     pct,
 				PacketLoss:  a.totalLoss / float64(a.count),
 				Count:       a.count,
 				TargetAgent: a.targetAgent,
@@ -609,8 +687,10 @@ LIMIT 5000
 
 type trafficStats struct {
 	AvgRTT      float64
+	Latency     latencyPercentiles // p50/p95/p99 of cycle averages; Max is the worst maxRTT
 	PacketLoss  float64
 	Count       int
+	Packets     int64  // Total packets sent across all samples
 	TargetAgent uint   // Track if this is targeting another agent
 	ProbeAgents []uint // All unique probe agent IDs (owners) that contributed to these metrics
 }
@@ -638,10 +718,10 @@ SELECT
 FROM probe_data
 WHERE type = 'TRAFFICSIM'
   AND agent_id IN (%s)
-  AND created_at >= %s
+  AND created_at >= %s%s
 ORDER BY created_at DESC
 LIMIT 5000
-`, agentIDList, chQuoteTime(from))
+`, agentIDList, chQuoteTime(from), asOfBound(ctx))
 
 	rows, err := ch.QueryContext(ctx, q)
 	if err != nil {
@@ -652,7 +732,10 @@ LIMIT 5000
 	// Aggregate in Go
 	type trafficAccum struct {
 		totalRTT    float64
+		rtts        []float64
+		maxRTT      float64
 		totalLoss   float64
+		packets     int64
 		count       int
 		targetAgent uint
 		probeAgents map[uint]bool // Track all unique probe agent IDs
@@ -678,6 +761,8 @@ LIMIT 5000
 		var payload struct {
 			AverageRTT     float64 `json:"averageRTT"`     // milliseconds
 			LossPercentage float64 `json:"lossPercentage"` // percentage
+			MaxRTT         float64 `json:"maxRTT"`         // milliseconds
+			TotalPackets   int64   `json:"totalPackets"`
 		}
 		if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
 			continue
@@ -691,7 +776,12 @@ LIMIT 5000
 			}
 		}
 		accum[key].totalRTT += payload.AverageRTT
+		accum[key].rtts = append(accum[key].rtts, payload.AverageRTT)
+		if payload.MaxRTT > accum[key].maxRTT {
+			accum[key].maxRTT = payload.MaxRTT
+		}
 		accum[key].totalLoss += payload.LossPercentage
+		accum[key].packets += payload.TotalPackets
 		accum[key].count++
 		// Track unique probe agent IDs
 		if probeAgentID > 0 {
@@ -707,10 +797,16 @@ LIMIT 5000
 			for agentID := range a.probeAgents {
 				probeAgents = append(probeAgents, agentID)
 			}
+			pct := computeLatencyPercentiles(a.rtts)
+			if a.maxRTT > pct.Max {
+				pct.Max = sanitizeFloat(a.maxRTT)
+			}
 			results[key] = trafficStats{
 				AvgRTT:      a.totalRTT / float64(a.count),
+				Latency:     pct,
 				PacketLoss:  a.totalLoss / float64(a.count),
 				Count:       a.count,
+				Packets:     a.packets,
 				TargetAgent: a.targetAgent,
 				ProbeAgents: probeAgents,
 			}
@@ -757,6 +853,7 @@ func applyProbePlan(detail *ProbeEndpointDetail, plans map[uint]map[uint][]strin
 func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[string]pingStats, trafficMetrics map[string]trafficStats, workspaceID uint, probePlans map[uint]map[uint][]string) *NetworkMapData {
 	nodeMap := make(map[string]*NetworkMapNode)
 	edgeMap := make(map[string]*NetworkMapEdge)
+	trafficPathVolume := make(map[string]int64) // pathID -> TrafficSim packets
 
 	// Track destination metrics for summary
 	destMetrics := make(map[string]*DestinationSummary)
@@ -777,7 +874,7 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 	// final pass) inherits the agent name for agent-to-agent paths.
 	for _, agent := range agents {
 		nodeID := fmt.Sprintf("agent:%d", agent.ID)
-		isOnline := time.Since(agent.UpdatedAt) < time.Minute
+		isOnline := agent.connectivity(time.Now()) != ConnectivityOffline
 		status := "healthy"
 		if !isOnline {
 			status = "unknown"
@@ -1067,7 +1164,7 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 		prevNodeID := agentNodeID
 		var lastHopID string
 
-		log.Printf("[NetworkMap] Processing trace agent %d -> %s with %d hops", trace.AgentID, trace.Target, len(trace.Hops))
+		mapLog.WithFields(log.Fields{logging.FieldAgent: trace.AgentID, logging.FieldTarget: trace.Target}).Debugf("[network-map] processing trace with %d hops", len(trace.Hops))
 
 		// First pass: identify context for unknown hops (prev/next known IPs)
 		// This allows unknowns to merge when they're between the same known infrastructure
@@ -1155,6 +1252,9 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 					HopNumber:    0, // Don't track hop number since it varies by source
 					AvgLatency:   hop.AvgLatency,
 					PacketLoss:   hop.PacketLoss,
+					StdDev:       hop.StdDev,
+					Jitter:       hop.JitterAvg,
+					JitterMax:    hop.JitterMax,
 					PathCount:    1,
 					Layer:        i + 1, // Use for initial positioning only
 					Status:       hopStatus,
@@ -1166,6 +1266,11 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 				node := nodeMap[hopNodeID]
 				node.AvgLatency = (node.AvgLatency*float64(node.PathCount) + hop.AvgLatency) / float64(node.PathCount+1)
 				node.PacketLoss = (node.PacketLoss*float64(node.PathCount) + hop.PacketLoss) / float64(node.PathCount+1)
+				node.StdDev = (node.StdDev*float64(node.PathCount) + hop.StdDev) / float64(node.PathCount+1)
+				node.Jitter = (node.Jitter*float64(node.PathCount) + hop.JitterAvg) / float64(node.PathCount+1)
+				if hop.JitterMax > node.JitterMax {
+					node.JitterMax = hop.JitterMax
+				}
 				node.PathCount++
 				// Add agent to shared agents if not already present
 				agentFound := false
@@ -1544,6 +1649,7 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 		}
 		destAgents[destKey][agentID] = true
 		destProbes[destKey]["TRAFFICSIM"] = true
+		trafficPathVolume[fmt.Sprintf("%d:%s", agentID, destKey)] += stats.Packets
 
 		// Update metrics
 		if destMetrics[destKey].AvgLatency == 0 {
@@ -1894,6 +2000,7 @@ func buildNetworkMap(agents []agentInfo, mtrData []mtrTrace, pingMetrics map[str
 	for _, edge := range edgeMap {
 		edge.AvgLatency = sanitizeFloat(edge.AvgLatency)
 		edge.PacketLoss = sanitizeFloat(edge.PacketLoss)
+		edge.TrafficPackets = edgeTrafficVolume(edge, trafficPathVolume)
 		edges = append(edges, *edge)
 	}
 
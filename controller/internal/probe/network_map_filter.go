@@ -0,0 +1,464 @@
+package probe
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ── Network Map Filtering ──
+//
+// A large workspace's map has thousands of nodes, more than a browser can
+// lay out. FilterNetworkMap narrows a built map to what a client asked for
+// without touching the (possibly shared, materialized) original:
+//
+//   - agent_ids, targets, probe_types and min_severity select paths. A path
+//     is one agent's route to one destination: an MTR trace, or the direct
+//     edge PING/TrafficSim draw when there is no trace.
+//   - max_hops cuts traces after that many hops. The destination stays,
+//     joined to the last kept hop by a "collapsed" edge.
+//   - max_nodes and max_edges cap the result, keeping agents and the
+//     least healthy nodes and highest-priority edges first. Capped maps set
+//     Truncated along with the counts before capping.
+//
+// The caps always apply, up to NETWORK_MAP_MAX_NODES (default 5000) and
+// NETWORK_MAP_MAX_EDGES (default 20000).
+
+const (
+	defaultMapMaxNodes = 5000
+	defaultMapMaxEdges = 20000
+)
+
+// NetworkMapFilter selects part of a network map. Zero values select
+// everything.
+type NetworkMapFilter struct {
+	AgentIDs    []uint
+	Targets     []string // case-insensitive globs on a destination's ID, label, hostname or IP
+	ProbeTypes  []string // MTR, PING, TRAFFICSIM
+	MinSeverity string   // "", "degraded" or "critical"
+	MaxHops     int
+	MaxNodes    int // 0 or above the deployment cap = the cap
+	MaxEdges    int
+}
+
+// selectsPaths reports whether f drops any paths.
+func (f NetworkMapFilter) selectsPaths() bool {
+	return len(f.AgentIDs) > 0 || len(f.Targets) > 0 || len(f.ProbeTypes) > 0 || f.MinSeverity != ""
+}
+
+func (f *NetworkMapFilter) normalize() error {
+	for i, t := range f.ProbeTypes {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		switch t {
+		case "MTR", "PING", "TRAFFICSIM":
+		default:
+			return fmt.Errorf("%w: probe_types must be MTR, PING or TRAFFICSIM", ErrBadInput)
+		}
+		f.ProbeTypes[i] = t
+	}
+	switch f.MinSeverity {
+	case "", "degraded", "critical":
+	default:
+		return fmt.Errorf("%w: min_severity must be degraded or critical", ErrBadInput)
+	}
+	for i, t := range f.Targets {
+		f.Targets[i] = strings.ToLower(strings.TrimSpace(t))
+		if _, err := path.Match(f.Targets[i], ""); err != nil {
+			return fmt.Errorf("%w: invalid target pattern %q", ErrBadInput, t)
+		}
+	}
+	if f.MaxHops < 0 || f.MaxNodes < 0 || f.MaxEdges < 0 {
+		return fmt.Errorf("%w: max_hops, max_nodes and max_edges must not be negative", ErrBadInput)
+	}
+	maxNodes, maxEdges := networkMapCaps()
+	if f.MaxNodes == 0 || f.MaxNodes > maxNodes {
+		f.MaxNodes = maxNodes
+	}
+	if f.MaxEdges == 0 || f.MaxEdges > maxEdges {
+		f.MaxEdges = maxEdges
+	}
+	return nil
+}
+
+// networkMapCaps reads NETWORK_MAP_MAX_NODES and NETWORK_MAP_MAX_EDGES.
+func networkMapCaps() (nodes, edges int) {
+	nodes, edges = defaultMapMaxNodes, defaultMapMaxEdges
+	if n, err := strconv.Atoi(os.Getenv("NETWORK_MAP_MAX_NODES")); err == nil && n > 0 {
+		nodes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("NETWORK_MAP_MAX_EDGES")); err == nil && n > 0 {
+		edges = n
+	}
+	return nodes, edges
+}
+
+// statusRank orders node statuses for min_severity and capping.
+func statusRank(status string) int {
+	switch status {
+	case "critical":
+		return 2
+	case "degraded":
+		return 1
+	}
+	return 0
+}
+
+// mapPath is one agent's route to one destination in a built map.
+type mapPath struct {
+	id      string
+	agentID uint
+	dest    string
+	mtr     bool
+	edges   []int    // indexes into NetworkMapData.Edges
+	seq     []string // node IDs from the agent to the destination (MTR only)
+}
+
+// collectMapPaths groups the map's edges by path. MTR edges carry their
+// path IDs; a direct PING/TrafficSim edge is its own path.
+func collectMapPaths(m *NetworkMapData) map[string]*mapPath {
+	paths := make(map[string]*mapPath)
+	for i, e := range m.Edges {
+		ids, mtr := e.PathIDs, len(e.PathIDs) > 0
+		if !mtr {
+			if !strings.HasPrefix(e.Source, "agent:") {
+				continue
+			}
+			ids = []string{strings.TrimPrefix(e.Source, "agent:") + ":" + e.Target}
+		}
+		for _, id := range ids {
+			p := paths[id]
+			if p == nil {
+				agentPart, dest, _ := strings.Cut(id, ":")
+				agentID, _ := strconv.ParseUint(agentPart, 10, 64)
+				p = &mapPath{id: id, agentID: uint(agentID), dest: dest, mtr: mtr}
+				paths[id] = p
+			}
+			p.edges = append(p.edges, i)
+		}
+	}
+	for _, p := range paths {
+		if p.mtr {
+			p.seq = walkMapPath(m, p)
+		}
+	}
+	return paths
+}
+
+// walkMapPath orders an MTR path's nodes by following its edges from the
+// agent.
+func walkMapPath(m *NetworkMapData, p *mapPath) []string {
+	next := make(map[string]string, len(p.edges))
+	for _, i := range p.edges {
+		next[m.Edges[i].Source] = m.Edges[i].Target
+	}
+	cur := fmt.Sprintf("agent:%d", p.agentID)
+	seq := []string{cur}
+	seen := map[string]bool{cur: true}
+	for {
+		n, ok := next[cur]
+		if !ok || seen[n] {
+			return seq
+		}
+		seq = append(seq, n)
+		seen[n] = true
+		cur = n
+	}
+}
+
+// FilterNetworkMap returns the part of m selected by f. m is not modified;
+// the result may share it when nothing is filtered out.
+func FilterNetworkMap(m *NetworkMapData, f NetworkMapFilter) (*NetworkMapData, error) {
+	if err := f.normalize(); err != nil {
+		return nil, err
+	}
+	if !f.selectsPaths() && f.MaxHops == 0 && len(m.Nodes) <= f.MaxNodes && len(m.Edges) <= f.MaxEdges {
+		return m, nil
+	}
+
+	nodeByID := make(map[string]*NetworkMapNode, len(m.Nodes))
+	for i := range m.Nodes {
+		nodeByID[m.Nodes[i].ID] = &m.Nodes[i]
+	}
+	destByTarget := make(map[string]*DestinationSummary, len(m.Destinations))
+	for i := range m.Destinations {
+		destByTarget[m.Destinations[i].Target] = &m.Destinations[i]
+	}
+
+	paths := collectMapPaths(m)
+	kept := make(map[string]bool, len(paths))
+	keptDests := make(map[string]bool)
+	for id, p := range paths {
+		if f.keepPath(m, p, nodeByID, destByTarget[p.dest]) {
+			kept[id] = true
+			keptDests[p.dest] = true
+		}
+	}
+
+	// Edges of kept paths, cut at max_hops.
+	edgeIDs := make(map[string]int)
+	var edges []NetworkMapEdge
+	addEdge := func(e NetworkMapEdge, pathID string) {
+		if i, ok := edgeIDs[e.ID]; ok {
+			if pathID != "" {
+				edges[i].PathIDs = append(edges[i].PathIDs, pathID)
+				edges[i].PathCount = len(edges[i].PathIDs)
+			}
+			return
+		}
+		if pathID != "" {
+			e.PathIDs, e.PathCount = []string{pathID}, 1
+		}
+		edgeIDs[e.ID] = len(edges)
+		edges = append(edges, e)
+	}
+	for _, id := range sortedKeys(kept) {
+		p := paths[id]
+		if !p.mtr {
+			for _, i := range p.edges {
+				addEdge(m.Edges[i], "")
+			}
+			continue
+		}
+		allowed := make(map[string]bool, len(p.seq))
+		cut := f.MaxHops > 0 && len(p.seq)-2 > f.MaxHops
+		for i, n := range p.seq {
+			if !cut || i <= f.MaxHops || i == len(p.seq)-1 {
+				allowed[n] = true
+			}
+		}
+		for _, i := range p.edges {
+			e := m.Edges[i]
+			if allowed[e.Source] && allowed[e.Target] {
+				addEdge(e, id)
+			}
+		}
+		if cut {
+			src, dst := p.seq[f.MaxHops], p.seq[len(p.seq)-1]
+			addEdge(NetworkMapEdge{ID: src + "->" + dst, Source: src, Target: dst, Collapsed: true}, id)
+		}
+	}
+
+	// Nodes on kept edges; agents and unconnected destinations only when
+	// no path filter applies (or the agent was asked for).
+	onEdge := make(map[string]bool, len(edges)*2)
+	for _, e := range edges {
+		onEdge[e.Source], onEdge[e.Target] = true, true
+	}
+	agentSel := make(map[uint]bool, len(f.AgentIDs))
+	for _, id := range f.AgentIDs {
+		agentSel[id] = true
+	}
+	var nodes []NetworkMapNode
+	for _, n := range m.Nodes {
+		keep := onEdge[n.ID]
+		switch {
+		case n.Type == "agent" && n.AgentID != nil:
+			keep = keep || agentSel[*n.AgentID] || !f.selectsPaths()
+		case n.Type == "destination":
+			keep = keep || !f.selectsPaths()
+		}
+		if !keep {
+			continue
+		}
+		if len(n.PathIDs) > 0 {
+			var ids []string
+			for _, id := range n.PathIDs {
+				if kept[id] {
+					ids = append(ids, id)
+				}
+			}
+			n.PathIDs = ids
+		}
+		nodes = append(nodes, n)
+	}
+
+	out := *m
+	out.Nodes, out.Edges = nodes, edges
+	if f.selectsPaths() {
+		out.Destinations = nil
+		for _, d := range m.Destinations {
+			if keptDests[d.Target] {
+				out.Destinations = append(out.Destinations, d)
+			}
+		}
+	}
+	capNetworkMap(&out, f.MaxNodes, f.MaxEdges)
+	if out.Nodes == nil {
+		out.Nodes = []NetworkMapNode{}
+	}
+	if out.Edges == nil {
+		out.Edges = []NetworkMapEdge{}
+	}
+	if out.Destinations == nil {
+		out.Destinations = []DestinationSummary{}
+	}
+	return &out, nil
+}
+
+// keepPath applies the path filters.
+func (f NetworkMapFilter) keepPath(m *NetworkMapData, p *mapPath, nodeByID map[string]*NetworkMapNode, dest *DestinationSummary) bool {
+	if len(f.AgentIDs) > 0 && !containsUint(f.AgentIDs, p.agentID) {
+		return false
+	}
+	if len(f.Targets) > 0 {
+		names := []string{p.dest}
+		if n := nodeByID[p.dest]; n != nil {
+			names = append(names, n.Label, n.Hostname, n.IP)
+		}
+		if dest != nil {
+			names = append(names, dest.Hostname)
+		}
+		if !matchAnyPattern(f.Targets, names) {
+			return false
+		}
+	}
+	if len(f.ProbeTypes) > 0 {
+		var types []string
+		if p.mtr {
+			types = []string{"MTR"}
+		} else if dest != nil {
+			for _, ep := range dest.ExpandedEndpoints {
+				if ep.AgentID != p.agentID {
+					continue
+				}
+				if ep.HasPing {
+					types = append(types, "PING")
+				}
+				if ep.HasTrafficSim {
+					types = append(types, "TRAFFICSIM")
+				}
+			}
+		}
+		if !intersects(f.ProbeTypes, types) {
+			return false
+		}
+	}
+	if f.MinSeverity != "" {
+		worst := 0
+		if dest != nil {
+			worst = statusRank(dest.Status)
+		}
+		for _, i := range p.edges {
+			e := m.Edges[i]
+			for _, id := range []string{e.Source, e.Target} {
+				if n := nodeByID[id]; n != nil && statusRank(n.Status) > worst {
+					worst = statusRank(n.Status)
+				}
+			}
+		}
+		if worst < statusRank(f.MinSeverity) {
+			return false
+		}
+	}
+	return true
+}
+
+// capNetworkMap trims the map to maxNodes and maxEdges. Agents go first,
+// then nodes by worst status and most paths; edges by priority score,
+// loss and path count. Edges of dropped nodes go with them.
+func capNetworkMap(m *NetworkMapData, maxNodes, maxEdges int) {
+	totalNodes, totalEdges := len(m.Nodes), len(m.Edges)
+	if totalNodes <= maxNodes && totalEdges <= maxEdges {
+		return
+	}
+	m.Truncated, m.TotalNodes, m.TotalEdges = true, totalNodes, totalEdges
+
+	if len(m.Nodes) > maxNodes {
+		order := make([]int, len(m.Nodes))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			na, nb := m.Nodes[order[a]], m.Nodes[order[b]]
+			if (na.Type == "agent") != (nb.Type == "agent") {
+				return na.Type == "agent"
+			}
+			if ra, rb := statusRank(na.Status), statusRank(nb.Status); ra != rb {
+				return ra > rb
+			}
+			return na.PathCount > nb.PathCount
+		})
+		keep := make(map[int]bool, maxNodes)
+		for _, i := range order[:maxNodes] {
+			keep[i] = true
+		}
+		ids := make(map[string]bool, maxNodes)
+		nodes := make([]NetworkMapNode, 0, maxNodes)
+		for i, n := range m.Nodes {
+			if keep[i] {
+				nodes = append(nodes, n)
+				ids[n.ID] = true
+			}
+		}
+		m.Nodes = nodes
+		edges := m.Edges[:0:0]
+		for _, e := range m.Edges {
+			if ids[e.Source] && ids[e.Target] {
+				edges = append(edges, e)
+			}
+		}
+		m.Edges = edges
+	}
+
+	if len(m.Edges) > maxEdges {
+		order := make([]int, len(m.Edges))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ea, eb := m.Edges[order[a]], m.Edges[order[b]]
+			if ea.PriorityScore != eb.PriorityScore {
+				return ea.PriorityScore > eb.PriorityScore
+			}
+			if ea.PacketLoss != eb.PacketLoss {
+				return ea.PacketLoss > eb.PacketLoss
+			}
+			return ea.PathCount > eb.PathCount
+		})
+		keep := order[:maxEdges]
+		sort.Ints(keep)
+		edges := make([]NetworkMapEdge, 0, maxEdges)
+		for _, i := range keep {
+			edges = append(edges, m.Edges[i])
+		}
+		m.Edges = edges
+	}
+}
+
+func matchAnyPattern(patterns, names []string) bool {
+	for _, n := range names {
+		n = strings.ToLower(n)
+		if n == "" {
+			continue
+		}
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsUint(s []uint, v uint) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func filterFixture() *NetworkMapData {
+	agents := makeAgents(
+		agentSpec(10, "A", "10.0.0.1"),
+		agentSpec(20, "B", "10.0.0.2"),
+	)
+	hops := func(edge, last string, loss float64) []mtrHop {
+		return []mtrHop{
+			{IP: "192.168.1.1", AvgLatency: 1},
+			{IP: "100.64.0.1", AvgLatency: 3},
+			{IP: edge, AvgLatency: 8, PacketLoss: loss},
+			{IP: last, AvgLatency: 12, PacketLoss: loss},
+		}
+	}
+	mtr := []mtrTrace{
+		{AgentID: 10, Target: "8.8.8.8", ProbeAgentID: 10, ProbeID: 1, Hops: hops("203.0.113.1", "8.8.8.8", 0)},
+		{AgentID: 10, Target: "1.1.1.1", ProbeAgentID: 10, ProbeID: 2, Hops: hops("198.51.100.1", "1.1.1.1", 60)},
+		{AgentID: 20, Target: "8.8.8.8", ProbeAgentID: 20, ProbeID: 3, Hops: hops("203.0.113.1", "8.8.8.8", 0)},
+	}
+	return buildNetworkMap(agents, mtr, nil, nil, 2, nil)
+}
+
+func mapNodeIDs(m *NetworkMapData) map[string]bool {
+	ids := make(map[string]bool, len(m.Nodes))
+	for _, n := range m.Nodes {
+		ids[n.ID] = true
+	}
+	return ids
+}
+
+func TestFilterNetworkMap(t *testing.T) {
+	full := filterFixture()
+	nodesBefore, edgesBefore := len(full.Nodes), len(full.Edges)
+
+	t.Run("no filter", func(t *testing.T) {
+		out, err := FilterNetworkMap(full, NetworkMapFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Nodes) != nodesBefore || len(out.Edges) != edgesBefore || out.Truncated {
+			t.Errorf("unfiltered map changed: %d nodes %d edges truncated=%v", len(out.Nodes), len(out.Edges), out.Truncated)
+		}
+	})
+
+	t.Run("agent", func(t *testing.T) {
+		out, err := FilterNetworkMap(full, NetworkMapFilter{AgentIDs: []uint{20}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := mapNodeIDs(out)
+		if !ids["agent:20"] || ids["agent:10"] {
+			t.Errorf("agent filter kept %v", ids)
+		}
+		for _, e := range out.Edges {
+			for _, p := range e.PathIDs {
+				if !strings.HasPrefix(p, "20:") {
+					t.Errorf("edge %s kept path %s", e.ID, p)
+				}
+			}
+		}
+		if len(out.Destinations) != 1 {
+			t.Errorf("destinations = %d, want 1", len(out.Destinations))
+		}
+	})
+
+	t.Run("target and severity", func(t *testing.T) {
+		out, err := FilterNetworkMap(full, NetworkMapFilter{Targets: []string{"1.1.*"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Destinations) != 1 || !strings.Contains(out.Destinations[0].Target, "1.1.1.1") {
+			t.Errorf("target filter destinations = %+v", out.Destinations)
+		}
+		crit, err := FilterNetworkMap(full, NetworkMapFilter{MinSeverity: "critical"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(crit.Destinations) != 1 || crit.Destinations[0].Target != out.Destinations[0].Target {
+			t.Errorf("critical filter destinations = %+v", crit.Destinations)
+		}
+	})
+
+	t.Run("max hops", func(t *testing.T) {
+		out, err := FilterNetworkMap(full, NetworkMapFilter{AgentIDs: []uint{10}, Targets: []string{"8.8.8.8"}, MaxHops: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var collapsed int
+		for _, e := range out.Edges {
+			if e.Collapsed {
+				collapsed++
+			}
+		}
+		// agent → hop 1 → (collapsed) → destination
+		if len(out.Nodes) != 3 || len(out.Edges) != 2 || collapsed != 1 {
+			t.Errorf("max_hops=1: %d nodes, %d edges, %d collapsed", len(out.Nodes), len(out.Edges), collapsed)
+		}
+	})
+
+	t.Run("caps", func(t *testing.T) {
+		out, err := FilterNetworkMap(full, NetworkMapFilter{MaxNodes: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !out.Truncated || out.TotalNodes != nodesBefore || out.TotalEdges != edgesBefore || len(out.Nodes) != 3 {
+			t.Errorf("capped map: truncated=%v totals=%d/%d nodes=%d", out.Truncated, out.TotalNodes, out.TotalEdges, len(out.Nodes))
+		}
+		ids := mapNodeIDs(out)
+		if !ids["agent:10"] || !ids["agent:20"] {
+			t.Errorf("cap dropped an agent: %v", ids)
+		}
+		for _, e := range out.Edges {
+			if !ids[e.Source] || !ids[e.Target] {
+				t.Errorf("edge %s left dangling", e.ID)
+			}
+		}
+	})
+
+	t.Run("bad input", func(t *testing.T) {
+		for _, f := range []NetworkMapFilter{
+			{ProbeTypes: []string{"DNS"}},
+			{MinSeverity: "bad"},
+			{Targets: []string{"["}},
+			{MaxHops: -1},
+		} {
+			if _, err := FilterNetworkMap(full, f); !errors.Is(err, ErrBadInput) {
+				t.Errorf("%+v: err = %v, want ErrBadInput", f, err)
+			}
+		}
+	})
+
+	if len(full.Nodes) != nodesBefore || len(full.Edges) != edgesBefore {
+		t.Errorf("FilterNetworkMap modified its input")
+	}
+}
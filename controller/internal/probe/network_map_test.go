@@ -409,3 +409,53 @@ func stringSliceEqual(a, b []string) bool {
 	}
 	return true
 }
+
+// ---------- Edge utilization ----------
+
+// TestBuildNetworkMap_EdgeUtilization verifies TrafficSim volume lands on
+// the edges of the matching MTR paths and a busy lossy edge is flagged
+// above an idle one.
+func TestBuildNetworkMap_EdgeUtilization(t *testing.T) {
+	agents := makeAgents(
+		agentSpec(10, "A", "10.0.0.1"),
+		agentSpec(20, "B", "10.0.0.2"),
+	)
+	mtr := []mtrTrace{
+		{AgentID: 10, Target: "10.0.0.2", TargetAgent: 20, ProbeAgentID: 10, ProbeID: 1,
+			Hops: lastHopFor("10.0.0.2", 5.0, 3.0)},
+		{AgentID: 20, Target: "10.0.0.1", TargetAgent: 10, ProbeAgentID: 20, ProbeID: 2,
+			Hops: lastHopFor("10.0.0.1", 5.0, 0.0)},
+	}
+	traffic := map[string]trafficStats{
+		"10:10.0.0.2:5000": {AvgRTT: 5, PacketLoss: 3, Count: 10, Packets: 10000, TargetAgent: 20, ProbeAgents: []uint{10}},
+	}
+
+	data := buildNetworkMap(agents, mtr, nil, traffic, 2, nil)
+	applyEdgeUtilization(data.Edges, map[uint]float64{20: 500})
+
+	var busy, idle *NetworkMapEdge
+	for i := range data.Edges {
+		e := &data.Edges[i]
+		switch e.Source {
+		case "agent:10":
+			busy = e
+		case "agent:20":
+			idle = e
+		}
+	}
+	if busy == nil || idle == nil {
+		t.Fatalf("expected edges from both agents, got %+v", data.Edges)
+	}
+	if busy.TrafficPackets != 10000 || busy.Utilization != 1 || busy.Weight != "heavy" {
+		t.Errorf("busy edge = %+v", *busy)
+	}
+	if !busy.LoadedLossy {
+		t.Errorf("busy lossy edge not flagged: %+v", *busy)
+	}
+	if idle.TrafficPackets != 0 || idle.ThroughputMbps != 500 || idle.Weight != "light" {
+		t.Errorf("idle edge = %+v", *idle)
+	}
+	if busy.PriorityScore <= idle.PriorityScore {
+		t.Errorf("priority busy=%v idle=%v", busy.PriorityScore, idle.PriorityScore)
+	}
+}
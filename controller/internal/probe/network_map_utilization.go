@@ -0,0 +1,122 @@
+package probe
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ── Edge Utilization ──
+//
+// Latency and loss alone make an idle backup link look as important as
+// the path carrying most of the traffic. Edges are additionally weighted
+// by observed TrafficSim packet volume over the paths that use them, and
+// first-hop edges carry the source agent's speedtest download when one
+// ran in the window. Utilization is relative to the busiest edge in the
+// map, so it describes where the workspace's traffic goes rather than link
+// capacity. An edge that is both heavily used and lossy is flagged
+// LoadedLossy and scores highest in PriorityScore.
+
+const (
+	edgeHeavyUtilization    = 0.6
+	edgeModerateUtilization = 0.25
+	// edgeLossyPct is the loss at which a loaded edge is flagged.
+	edgeLossyPct = 1.0
+	// edgeLossSaturationPct is the loss that maxes out the priority score.
+	edgeLossSaturationPct = 10.0
+	// edgeThroughputOnlyMax caps utilization inferred from speedtest
+	// throughput alone: capacity is not use, so such edges stay "light".
+	edgeThroughputOnlyMax = 0.2
+)
+
+// edgeTrafficVolume sums TrafficSim packets over the paths using an edge.
+// Direct agent→destination edges carry no PathIDs; their path is derived
+// from the endpoints.
+func edgeTrafficVolume(edge *NetworkMapEdge, pathVolume map[string]int64) int64 {
+	if len(pathVolume) == 0 {
+		return 0
+	}
+	if len(edge.PathIDs) == 0 {
+		if id, ok := strings.CutPrefix(edge.Source, "agent:"); ok {
+			return pathVolume[fmt.Sprintf("%s:%s", id, edge.Target)]
+		}
+		return 0
+	}
+	var total int64
+	seen := make(map[string]bool, len(edge.PathIDs))
+	for _, id := range edge.PathIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		total += pathVolume[id]
+	}
+	return total
+}
+
+// agentDownloadMbps reduces speedtest stats ("<agentID>:<server>") to the
+// best average download per agent.
+func agentDownloadMbps(stats map[string]speedtestStats) map[uint]float64 {
+	out := make(map[uint]float64)
+	for key, st := range stats {
+		i := strings.IndexByte(key, ':')
+		if i <= 0 {
+			continue
+		}
+		id := parseUint(key[:i])
+		if st.AvgDownload > out[id] {
+			out[id] = st.AvgDownload
+		}
+	}
+	return out
+}
+
+// applyEdgeUtilization fills utilization, weight and priority on edges
+// whose TrafficPackets are already set.
+func applyEdgeUtilization(edges []NetworkMapEdge, downloadMbps map[uint]float64) {
+	var maxPackets int64
+	var maxTput float64
+	for i := range edges {
+		e := &edges[i]
+		if id, ok := strings.CutPrefix(e.Source, "agent:"); ok {
+			e.ThroughputMbps = sanitizeFloat(downloadMbps[parseUint(id)])
+		}
+		if e.TrafficPackets > maxPackets {
+			maxPackets = e.TrafficPackets
+		}
+		if e.ThroughputMbps > maxTput {
+			maxTput = e.ThroughputMbps
+		}
+	}
+
+	for i := range edges {
+		e := &edges[i]
+		var util float64
+		if maxPackets > 0 {
+			util = float64(e.TrafficPackets) / float64(maxPackets)
+		}
+		// Throughput only informs edges without measured volume.
+		if e.TrafficPackets == 0 && maxTput > 0 {
+			util = e.ThroughputMbps / maxTput * edgeThroughputOnlyMax
+		}
+		e.Utilization = math.Round(util*1000) / 1000
+		e.Weight = edgeWeight(e.Utilization, e.TrafficPackets > 0 || e.ThroughputMbps > 0)
+		e.LoadedLossy = e.Utilization >= edgeHeavyUtilization && e.PacketLoss >= edgeLossyPct
+
+		lossSeverity := math.Min(e.PacketLoss/edgeLossSaturationPct, 1)
+		e.PriorityScore = math.Round(lossSeverity*(0.25+0.75*e.Utilization)*1000) / 10
+	}
+}
+
+func edgeWeight(util float64, observed bool) string {
+	switch {
+	case !observed:
+		return "idle"
+	case util >= edgeHeavyUtilization:
+		return "heavy"
+	case util >= edgeModerateUtilization:
+		return "moderate"
+	default:
+		return "light"
+	}
+}
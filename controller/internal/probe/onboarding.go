@@ -0,0 +1,451 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/speedtest"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Onboarding Validation ──
+//
+// After an installer bootstraps an agent, an onboarding run proves the
+// agent is fully functional before they leave site. Starting a run
+// creates temporary PING and MTR smoke probes (picked up on the agent's
+// next probe_get poll) and queues one speedtest. Each evaluation then
+// re-checks the run against live state and ClickHouse: the agent is
+// connected, each smoke test produced a row, and probe data is landing.
+// A run passes once every check passes and fails on the first failed
+// check or when onboardingRunTimeout elapses. Smoke probes are deleted
+// when the run finishes.
+
+const (
+	onboardingRunTimeout = 10 * time.Minute
+	// onboardingSeenWindow is how recent LastSeenAt must be to count the
+	// agent as reachable when it isn't connected at evaluation time.
+	onboardingSeenWindow    = 2 * time.Minute
+	defaultOnboardingTarget = "1.1.1.1"
+)
+
+// Onboarding run statuses.
+const (
+	OnboardingRunning = "running"
+	OnboardingPassed  = "passed"
+	OnboardingFailed  = "failed"
+)
+
+// Onboarding check statuses.
+const (
+	CheckPass    = "pass"
+	CheckPending = "pending"
+	CheckFail    = "fail"
+	CheckSkipped = "skipped"
+)
+
+// OnboardingRun is one onboarding validation of an agent.
+type OnboardingRun struct {
+	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	WorkspaceID      uint           `gorm:"index;not null" json:"workspace_id"`
+	AgentID          uint           `gorm:"index;not null" json:"agent_id"`
+	Target           string         `gorm:"size:255" json:"target"`
+	Status           string         `gorm:"size:20;not null;index" json:"status"`
+	PingProbeID      uint           `json:"ping_probe_id,omitempty"`
+	MTRProbeID       uint           `json:"mtr_probe_id,omitempty"`
+	SpeedtestQueueID uint           `json:"speedtest_queue_id,omitempty"`
+	SetupErrors      datatypes.JSON `gorm:"type:jsonb" json:"-"` // check key → error creating its smoke test
+	Checks           datatypes.JSON `gorm:"type:jsonb" json:"-"` // last evaluated checklist
+	RequestedBy      uint           `json:"requested_by,omitempty"`
+	StartedAt        time.Time      `json:"started_at"`
+	ExpiresAt        time.Time      `json:"expires_at"`
+	CompletedAt      *time.Time     `json:"completed_at,omitempty"`
+}
+
+func (OnboardingRun) TableName() string { return "onboarding_runs" }
+
+// OnboardingCheck is one readiness checklist item.
+type OnboardingCheck struct {
+	Key    string `json:"key"`
+	Label  string `json:"label"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// OnboardingReport is a run with its evaluated checklist.
+type OnboardingReport struct {
+	Run    OnboardingRun     `json:"run"`
+	Ready  bool              `json:"ready"`
+	Checks []OnboardingCheck `json:"checks"`
+}
+
+// OnboardingInput starts a run.
+type OnboardingInput struct {
+	Target        string `json:"target"`         // smoke test target (default 1.1.1.1)
+	SkipSpeedtest bool   `json:"skip_speedtest"` // e.g. metered links
+}
+
+// StartOnboarding creates a run for the agent, or returns the agent's
+// running one. Smoke test setup errors are recorded as failed checks
+// rather than returned, so the installer sees them in the checklist.
+func StartOnboarding(ctx context.Context, db *gorm.DB, workspaceID, agentID, userID uint, in OnboardingInput) (*OnboardingRun, error) {
+	a, err := agent.GetAgentByWorkspaceAndID(ctx, db, workspaceID, agentID)
+	if err != nil {
+		if errors.Is(err, agent.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var active []OnboardingRun
+	if err := db.WithContext(ctx).Where("agent_id = ? AND status = ?", a.ID, OnboardingRunning).
+		Order("id DESC").Limit(1).Find(&active).Error; err != nil {
+		return nil, err
+	}
+	if len(active) > 0 {
+		return &active[0], nil
+	}
+
+	if in.Target == "" {
+		in.Target = getenv("ONBOARDING_TARGET", defaultOnboardingTarget)
+	}
+	now := time.Now().UTC()
+	run := &OnboardingRun{
+		WorkspaceID: workspaceID,
+		AgentID:     a.ID,
+		Target:      in.Target,
+		Status:      OnboardingRunning,
+		RequestedBy: userID,
+		StartedAt:   now,
+		ExpiresAt:   now.Add(onboardingRunTimeout),
+	}
+
+	setupErrors := map[string]string{}
+	meta := datatypes.JSON([]byte(`{"onboarding":true}`))
+	for _, smoke := range []struct {
+		key string
+		typ Type
+		id  *uint
+	}{
+		{"ping", TypePing, &run.PingProbeID},
+		{"mtr", TypeMTR, &run.MTRProbeID},
+	} {
+		p, err := Create(ctx, db, CreateInput{
+			WorkspaceID: workspaceID,
+			AgentID:     a.ID,
+			Type:        smoke.typ,
+			Enabled:     true,
+			IntervalSec: 30,
+			Targets:     []string{in.Target},
+			Metadata:    meta,
+		})
+		if err != nil {
+			setupErrors[smoke.key] = err.Error()
+			continue
+		}
+		*smoke.id = p.ID
+	}
+	if in.SkipSpeedtest {
+		setupErrors["speedtest"] = "skipped"
+	} else {
+		item, err := speedtest.CreateQueueItem(ctx, db, speedtest.CreateQueueInput{
+			WorkspaceID: workspaceID,
+			AgentID:     a.ID,
+			ServerName:  "onboarding (auto)",
+			RequestedBy: userID,
+		})
+		if err != nil {
+			setupErrors["speedtest"] = err.Error()
+		} else {
+			run.SpeedtestQueueID = item.ID
+		}
+	}
+	setupRaw, err := json.Marshal(setupErrors)
+	if err != nil {
+		return nil, err
+	}
+	run.SetupErrors = datatypes.JSON(setupRaw)
+	run.Checks = datatypes.JSON([]byte(`[]`))
+
+	if err := db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, err
+	}
+	log.Infof("[onboarding] run %d started for agent %d (target=%s)", run.ID, a.ID, in.Target)
+	return run, nil
+}
+
+// LatestOnboardingRun returns the agent's newest run, or ErrNotFound.
+func LatestOnboardingRun(ctx context.Context, db *gorm.DB, workspaceID, agentID uint) (*OnboardingRun, error) {
+	var runs []OnboardingRun
+	if err := db.WithContext(ctx).Where("workspace_id = ? AND agent_id = ?", workspaceID, agentID).
+		Order("id DESC").Limit(1).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &runs[0], nil
+}
+
+// onboardingState is what an evaluation observed.
+type onboardingState struct {
+	now           time.Time
+	connected     bool
+	lastSeen      time.Time
+	setupErrors   map[string]string
+	pingRows      int
+	pingLatency   float64 // ms, newest row
+	pingLoss      float64
+	mtrRows       int
+	mtrHops       int
+	speedStatus   speedtest.QueueStatus
+	speedError    string
+	speedRows     int
+	agentRows     int
+	lastReceived  time.Time
+	chUnavailable bool
+}
+
+// EvaluateOnboarding re-checks a run. connected is whether the agent
+// holds a websocket connection now. Finished runs return their stored
+// checklist unchanged.
+func EvaluateOnboarding(ctx context.Context, db *gorm.DB, ch *sql.DB, deletionStore *deletion.QueueStore, run *OnboardingRun, connected bool) (*OnboardingReport, error) {
+	if run.Status != OnboardingRunning {
+		var checks []OnboardingCheck
+		_ = json.Unmarshal(run.Checks, &checks)
+		return &OnboardingReport{Run: *run, Ready: run.Status == OnboardingPassed, Checks: checks}, nil
+	}
+
+	st := onboardingState{now: time.Now().UTC(), connected: connected, setupErrors: map[string]string{}}
+	_ = json.Unmarshal(run.SetupErrors, &st.setupErrors)
+	if a, err := agent.GetAgentByID(ctx, db, run.AgentID); err == nil {
+		st.lastSeen = a.LastSeenAt
+	}
+	if run.SpeedtestQueueID != 0 {
+		if item, err := speedtest.GetQueueItem(ctx, db, run.SpeedtestQueueID); err == nil && item != nil {
+			st.speedStatus, st.speedError = item.Status, item.ErrorMessage
+		}
+	}
+	if ch == nil {
+		st.chUnavailable = true
+	} else if err := loadOnboardingRows(ctx, ch, run, &st); err != nil {
+		return nil, fmt.Errorf("onboarding clickhouse check: %w", err)
+	}
+
+	checks := onboardingChecks(st)
+	status := onboardingStatus(checks, st.now, run.ExpiresAt)
+	if status == OnboardingFailed && st.now.After(run.ExpiresAt) {
+		for i := range checks {
+			if checks[i].Status == CheckPending {
+				checks[i].Status = CheckFail
+				checks[i].Detail = "timed out after " + onboardingRunTimeout.String()
+			}
+		}
+	}
+
+	checksRaw, err := json.Marshal(checks)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]any{"checks": datatypes.JSON(checksRaw), "status": status, "updated_at": st.now}
+	if status != OnboardingRunning {
+		updates["completed_at"] = st.now
+		cleanupOnboardingProbes(ctx, db, deletionStore, run)
+		log.Infof("[onboarding] run %d for agent %d %s", run.ID, run.AgentID, status)
+	}
+	if err := db.WithContext(ctx).Model(&OnboardingRun{}).Where("id = ?", run.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	run.Status, run.Checks, run.UpdatedAt = status, datatypes.JSON(checksRaw), st.now
+	if status != OnboardingRunning {
+		run.CompletedAt = &st.now
+	}
+	return &OnboardingReport{Run: *run, Ready: status == OnboardingPassed, Checks: checks}, nil
+}
+
+// onboardingChecks builds the checklist from observed state.
+func onboardingChecks(st onboardingState) []OnboardingCheck {
+	var out []OnboardingCheck
+
+	reach := OnboardingCheck{Key: "controller_reachable", Label: "Agent connected to controller"}
+	switch {
+	case st.connected:
+		reach.Status, reach.Detail = CheckPass, "websocket connected"
+	case !st.lastSeen.IsZero() && st.now.Sub(st.lastSeen) <= onboardingSeenWindow:
+		reach.Status, reach.Detail = CheckPass, fmt.Sprintf("last seen %s ago", st.now.Sub(st.lastSeen).Round(time.Second))
+	case st.lastSeen.IsZero():
+		reach.Status, reach.Detail = CheckPending, "agent has never connected"
+	default:
+		reach.Status, reach.Detail = CheckPending, fmt.Sprintf("not connected; last seen %s ago", st.now.Sub(st.lastSeen).Round(time.Second))
+	}
+	out = append(out, reach)
+
+	smoke := func(key, label string, rows int, passDetail string) OnboardingCheck {
+		c := OnboardingCheck{Key: key, Label: label}
+		switch {
+		case st.setupErrors[key] != "":
+			c.Status, c.Detail = CheckFail, "could not create smoke test: "+st.setupErrors[key]
+		case st.chUnavailable:
+			c.Status, c.Detail = CheckFail, "ClickHouse not available"
+		case rows > 0:
+			c.Status, c.Detail = CheckPass, passDetail
+		default:
+			c.Status, c.Detail = CheckPending, "waiting for the agent to run it (probes refresh every 60s)"
+		}
+		return c
+	}
+	out = append(out,
+		smoke("ping", "PING smoke test", st.pingRows, fmt.Sprintf("%.1f ms, %.0f%% loss", st.pingLatency, st.pingLoss)),
+		smoke("mtr", "MTR smoke test", st.mtrRows, fmt.Sprintf("%d hops traced", st.mtrHops)),
+	)
+
+	speed := OnboardingCheck{Key: "speedtest", Label: "Speedtest smoke test"}
+	switch {
+	case st.setupErrors["speedtest"] == "skipped":
+		speed.Status, speed.Detail = CheckSkipped, "skipped on request"
+	case st.setupErrors["speedtest"] != "":
+		speed.Status, speed.Detail = CheckFail, "could not queue speedtest: "+st.setupErrors["speedtest"]
+	case st.speedStatus == speedtest.StatusFailed:
+		speed.Status, speed.Detail = CheckFail, "speedtest failed: "+st.speedError
+	case st.speedStatus == speedtest.StatusExpired || st.speedStatus == speedtest.StatusCancelled:
+		speed.Status, speed.Detail = CheckFail, "speedtest "+string(st.speedStatus)+" before the agent ran it"
+	case st.speedStatus == speedtest.StatusCompleted && st.speedRows > 0:
+		speed.Status, speed.Detail = CheckPass, "result stored"
+	case st.speedStatus == speedtest.StatusCompleted && st.chUnavailable:
+		speed.Status, speed.Detail = CheckFail, "ClickHouse not available"
+	default:
+		speed.Status, speed.Detail = CheckPending, "queued; the agent polls the speedtest queue every 30s"
+	}
+	out = append(out, speed)
+
+	ingest := OnboardingCheck{Key: "data_ingest", Label: "Probe data stored in ClickHouse"}
+	switch {
+	case st.chUnavailable:
+		ingest.Status, ingest.Detail = CheckFail, "ClickHouse not available"
+	case st.agentRows > 0:
+		ingest.Status, ingest.Detail = CheckPass, fmt.Sprintf("%d rows since the run started, newest received %s ago",
+			st.agentRows, st.now.Sub(st.lastReceived).Round(time.Second))
+	default:
+		ingest.Status, ingest.Detail = CheckPending, "no rows from this agent since the run started"
+	}
+	out = append(out, ingest)
+	return out
+}
+
+// onboardingStatus derives the run status from its checklist.
+func onboardingStatus(checks []OnboardingCheck, now, expires time.Time) string {
+	pending := false
+	for _, c := range checks {
+		switch c.Status {
+		case CheckFail:
+			return OnboardingFailed
+		case CheckPending:
+			pending = true
+		}
+	}
+	if !pending {
+		return OnboardingPassed
+	}
+	if now.After(expires) {
+		return OnboardingFailed
+	}
+	return OnboardingRunning
+}
+
+// loadOnboardingRows reads the run's smoke test rows from ClickHouse.
+func loadOnboardingRows(ctx context.Context, ch *sql.DB, run *OnboardingRun, st *onboardingState) error {
+	since := chQuoteTime(run.StartedAt)
+
+	if err := ch.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT count(), max(received_at)
+FROM probe_data
+WHERE agent_id = %d AND received_at >= %s`, run.AgentID, since)).Scan(&st.agentRows, &st.lastReceived); err != nil {
+		return err
+	}
+	if err := ch.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT count()
+FROM speedtest_data
+WHERE type = 'SPEEDTEST' AND agent_id = %d AND received_at >= %s`, run.AgentID, since)).Scan(&st.speedRows); err != nil {
+		return err
+	}
+
+	for _, p := range []struct {
+		id   uint
+		kind Type
+	}{{run.PingProbeID, TypePing}, {run.MTRProbeID, TypeMTR}} {
+		if p.id == 0 {
+			continue
+		}
+		rows, err := GetProbeDataByProbe(ctx, ch, uint64(p.id), nil, run.StartedAt, time.Time{}, false, 1, string(p.kind))
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		switch p.kind {
+		case TypePing:
+			st.pingRows = len(rows)
+			if payload, err := ParsePingPayload(rows[0].Payload); err == nil {
+				st.pingLatency = sanitizeFloat(float64(payload.AvgRtt) / 1e6)
+				st.pingLoss = sanitizeFloat(payload.PacketLoss)
+			}
+		case TypeMTR:
+			st.mtrRows = len(rows)
+			var mp MtrPayload
+			if err := json.Unmarshal(rows[0].Payload, &mp); err == nil {
+				st.mtrHops = len(mp.Report.Hops)
+			}
+		}
+	}
+	return nil
+}
+
+// cleanupOnboardingProbes deletes the run's smoke probes.
+func cleanupOnboardingProbes(ctx context.Context, db *gorm.DB, deletionStore *deletion.QueueStore, run *OnboardingRun) {
+	for _, id := range []uint{run.PingProbeID, run.MTRProbeID} {
+		if id == 0 {
+			continue
+		}
+		if err := Delete(ctx, db, deletionStore, id); err != nil && !errors.Is(err, ErrNotFound) {
+			log.WithError(err).Warnf("[onboarding] run %d: delete smoke probe %d", run.ID, id)
+		}
+	}
+}
+
+// StartOnboardingSweeper evaluates running onboarding runs every minute
+// until ctx is cancelled, so runs finish and their smoke probes are
+// removed even when nobody polls the endpoint.
+func StartOnboardingSweeper(ctx context.Context, ch *sql.DB, pg *gorm.DB, deletionStore *deletion.QueueStore) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var runs []OnboardingRun
+		if err := pg.WithContext(ctx).Where("status = ?", OnboardingRunning).Find(&runs).Error; err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("[onboarding] sweep failed: %v", err)
+			}
+			continue
+		}
+		for i := range runs {
+			if _, err := EvaluateOnboarding(ctx, pg, ch, deletionStore, &runs[i], false); err != nil {
+				log.Warnf("[onboarding] run %d: %v", runs[i].ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/speedtest"
+)
+
+func checkStatus(checks []OnboardingCheck, key string) string {
+	for _, c := range checks {
+		if c.Key == key {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+// TestOnboardingChecksReady verifies a run passes once every smoke test
+// has landed and the agent is reachable.
+func TestOnboardingChecksReady(t *testing.T) {
+	now := time.Now()
+	st := onboardingState{
+		now:          now,
+		lastSeen:     now.Add(-30 * time.Second),
+		setupErrors:  map[string]string{},
+		pingRows:     1,
+		mtrRows:      1,
+		mtrHops:      9,
+		speedStatus:  speedtest.StatusCompleted,
+		speedRows:    1,
+		agentRows:    12,
+		lastReceived: now.Add(-5 * time.Second),
+	}
+	checks := onboardingChecks(st)
+	for _, c := range checks {
+		if c.Status != CheckPass {
+			t.Errorf("%s = %s (%s), want pass", c.Key, c.Status, c.Detail)
+		}
+	}
+	if got := onboardingStatus(checks, now, now.Add(time.Minute)); got != OnboardingPassed {
+		t.Errorf("status = %s, want passed", got)
+	}
+}
+
+func TestOnboardingChecksPendingAndFailures(t *testing.T) {
+	now := time.Now()
+	st := onboardingState{
+		now:         now,
+		setupErrors: map[string]string{"mtr": "agent cannot run MTR", "speedtest": "skipped"},
+		speedStatus: speedtest.StatusPending,
+	}
+	checks := onboardingChecks(st)
+	if s := checkStatus(checks, "controller_reachable"); s != CheckPending {
+		t.Errorf("never-seen agent: reachable = %s, want pending", s)
+	}
+	if s := checkStatus(checks, "ping"); s != CheckPending {
+		t.Errorf("ping = %s, want pending", s)
+	}
+	if s := checkStatus(checks, "mtr"); s != CheckFail {
+		t.Errorf("mtr with setup error = %s, want fail", s)
+	}
+	if s := checkStatus(checks, "speedtest"); s != CheckSkipped {
+		t.Errorf("skipped speedtest = %s, want skipped", s)
+	}
+	if got := onboardingStatus(checks, now, now.Add(time.Minute)); got != OnboardingFailed {
+		t.Errorf("status with a failed check = %s, want failed", got)
+	}
+
+	delete(st.setupErrors, "mtr")
+	checks = onboardingChecks(st)
+	if got := onboardingStatus(checks, now, now.Add(time.Minute)); got != OnboardingRunning {
+		t.Errorf("status with pending checks = %s, want running", got)
+	}
+	if got := onboardingStatus(checks, now, now.Add(-time.Second)); got != OnboardingFailed {
+		t.Errorf("status past expiry = %s, want failed", got)
+	}
+}
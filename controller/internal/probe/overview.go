@@ -0,0 +1,201 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Workspace Overview ──────────────────────────────────────────────────────
+//
+// One compact document per agent for the dashboard, replacing the
+// agents-list + latest-sysinfo + latest-netinfo + probe-count + health
+// fan-out the panel used to do. Health comes from the newest stored
+// analysis snapshot (written by the analysis loop) rather than a fresh
+// ComputeWorkspaceAnalysis, so the endpoint costs two bounded ClickHouse
+// queries regardless of workspace size:
+//
+//	1. latest analysis_snapshots row (LIMIT 1, last overviewHealthMaxAge)
+//	2. latest NETINFO per agent (window function, last overviewNetInfoMaxAge)
+
+const (
+	// overviewHealthMaxAge bounds how stale a snapshot may be before the
+	// overview reports health as unknown rather than misleading.
+	overviewHealthMaxAge = time.Hour
+	// overviewNetInfoMaxAge covers agents that report NETINFO rarely.
+	overviewNetInfoMaxAge = 24 * time.Hour
+)
+
+// Agent connection states, matching the Prometheus agent status gauge.
+const (
+	AgentStatusOnline  = "online"
+	AgentStatusStale   = "stale"
+	AgentStatusOffline = "offline"
+)
+
+// AgentOverview is one agent's dashboard card.
+type AgentOverview struct {
+	AgentID    uint              `json:"agent_id"`
+	Name       string            `json:"name"`
+	Location   string            `json:"location,omitempty"`
+	Version    string            `json:"version,omitempty"`
+	OS         string            `json:"os,omitempty"`
+	Status     string            `json:"status"` // online, stale, offline
+	LastSeenAt time.Time         `json:"last_seen_at"`
+	PublicIP   string            `json:"public_ip,omitempty"`
+	ISP        string            `json:"isp,omitempty"`
+	ProbeCount int               `json:"probe_count"`
+	Health     *HealthVector     `json:"health,omitempty"`
+	WorstProbe *ProbeHealthEntry `json:"worst_probe,omitempty"`
+
+	// Connectivity applies the agent's own thresholds (network type or
+	// override); Status keeps the fixed Prometheus gauge thresholds.
+	Connectivity string `json:"connectivity"` // online, degraded, offline
+}
+
+// WorkspaceOverview is the full dashboard payload.
+type WorkspaceOverview struct {
+	WorkspaceID uint            `json:"workspace_id"`
+	Agents      []AgentOverview `json:"agents"`
+	Online      int             `json:"online"`
+	Total       int             `json:"total"`
+	HealthAsOf  *time.Time      `json:"health_as_of,omitempty"` // snapshot time health was taken from
+	GeneratedAt time.Time       `json:"generated_at"`
+}
+
+// agentConnStatus classifies an agent by last-seen age.
+func agentConnStatus(lastSeen, now time.Time) string {
+	switch age := now.Sub(lastSeen); {
+	case age < time.Minute:
+		return AgentStatusOnline
+	case age < 5*time.Minute:
+		return AgentStatusStale
+	default:
+		return AgentStatusOffline
+	}
+}
+
+// ComputeWorkspaceOverview assembles the per-agent dashboard overview.
+func ComputeWorkspaceOverview(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint) (*WorkspaceOverview, error) {
+	now := time.Now().UTC()
+
+	var agents []agent.Agent
+	if err := pg.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("name ASC").
+		Find(&agents).Error; err != nil {
+		return nil, err
+	}
+
+	probeCounts, err := countProbesByAgent(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	agentIDs := make([]uint, len(agents))
+	for i, a := range agents {
+		agentIDs[i] = a.ID
+	}
+	netInfo := getLatestNetInfoForAgents(ctx, ch, agentIDs, now.Add(-overviewNetInfoMaxAge))
+
+	healthByAgent, asOf := latestSnapshotAgentHealth(ctx, ch, workspaceID, now)
+
+	out := &WorkspaceOverview{
+		WorkspaceID: workspaceID,
+		Agents:      make([]AgentOverview, 0, len(agents)),
+		Total:       len(agents),
+		HealthAsOf:  asOf,
+		GeneratedAt: now,
+	}
+	for _, a := range agents {
+		o := AgentOverview{
+			AgentID:    a.ID,
+			Name:       a.Name,
+			Location:   a.Location,
+			Version:    a.Version,
+			OS:         a.OS,
+			Status:     agentConnStatus(a.LastSeenAt, now),
+			LastSeenAt: a.LastSeenAt,
+			ProbeCount: probeCounts[a.ID],
+			PublicIP:   a.PublicIPOverride,
+		}
+		o.Connectivity = a.Connectivity(now)
+		if ni := netInfo[a.ID]; ni != nil {
+			if o.PublicIP == "" {
+				o.PublicIP = ni.PublicAddress
+			}
+			o.ISP = ni.GetISP()
+		}
+		if h, ok := healthByAgent[a.ID]; ok {
+			hv := h.Health
+			o.Health = &hv
+			if len(h.WorstProbes) > 0 {
+				wp := h.WorstProbes[0]
+				o.WorstProbe = &wp
+			}
+		}
+		if o.Status == AgentStatusOnline {
+			out.Online++
+		}
+		out.Agents = append(out.Agents, o)
+	}
+	return out, nil
+}
+
+// countProbesByAgent returns agent ID → number of probes in a workspace.
+func countProbesByAgent(ctx context.Context, pg *gorm.DB, workspaceID uint) (map[uint]int, error) {
+	var rows []struct {
+		AgentID uint
+		N       int
+	}
+	err := pg.WithContext(ctx).
+		Model(&Probe{}).
+		Select("agent_id, COUNT(*) AS n").
+		Where("workspace_id = ?", workspaceID).
+		Group("agent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint]int, len(rows))
+	for _, r := range rows {
+		out[r.AgentID] = r.N
+	}
+	return out, nil
+}
+
+// latestSnapshotAgentHealth decodes per-agent health from the newest
+// analysis snapshot. Worst probes are re-sorted so [0] is the worst.
+func latestSnapshotAgentHealth(ctx context.Context, ch *sql.DB, workspaceID uint, now time.Time) (map[uint]AgentHealthSummary, *time.Time) {
+	out := make(map[uint]AgentHealthSummary)
+	if ch == nil {
+		return out, nil
+	}
+	snaps, err := GetAnalysisSnapshots(ctx, ch, workspaceID, now.Add(-overviewHealthMaxAge), time.Time{}, 1)
+	if err != nil {
+		log.Warnf("[overview] workspace=%d snapshot query error: %v", workspaceID, err)
+		return out, nil
+	}
+	if len(snaps) == 0 || snaps[0].AgentsJSON == "" {
+		return out, nil
+	}
+	var agents []AgentHealthSummary
+	if err := json.Unmarshal([]byte(snaps[0].AgentsJSON), &agents); err != nil {
+		return out, nil
+	}
+	for _, a := range agents {
+		sort.SliceStable(a.WorstProbes, func(i, j int) bool {
+			return a.WorstProbes[i].Health.OverallHealth < a.WorstProbes[j].Health.OverallHealth
+		})
+		out[a.AgentID] = a
+	}
+	asOf := snaps[0].GeneratedAt
+	return out, &asOf
+}
@@ -0,0 +1,53 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+)
+
+// TestAgentConnStatus verifies the online/stale/offline thresholds match
+// the Prometheus agent status gauge.
+func TestAgentConnStatus(t *testing.T) {
+	now := time.Now()
+	cases := map[time.Duration]string{
+		10 * time.Second: AgentStatusOnline,
+		3 * time.Minute:  AgentStatusStale,
+		time.Hour:        AgentStatusOffline,
+	}
+	for age, want := range cases {
+		if got := agentConnStatus(now.Add(-age), now); got != want {
+			t.Errorf("age %s: status = %q, want %q", age, got, want)
+		}
+	}
+}
+
+// TestCountProbesByAgent verifies probe counts are grouped per agent and
+// scoped to the workspace.
+func TestCountProbesByAgent(t *testing.T) {
+	db := newTestDB(t)
+	mustCreateAgent(t, db, agent.Agent{ID: 1, WorkspaceID: 1, Name: "a"})
+	mustCreateAgent(t, db, agent.Agent{ID: 2, WorkspaceID: 1, Name: "b"})
+	mustCreateAgent(t, db, agent.Agent{ID: 3, WorkspaceID: 2, Name: "other"})
+	for _, p := range []Probe{
+		{WorkspaceID: 1, AgentID: 1, Type: TypePing},
+		{WorkspaceID: 1, AgentID: 1, Type: TypeMTR},
+		{WorkspaceID: 1, AgentID: 2, Type: TypePing},
+		{WorkspaceID: 2, AgentID: 3, Type: TypePing},
+	} {
+		p := p
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatalf("create probe: %v", err)
+		}
+	}
+
+	got, err := countProbesByAgent(context.Background(), db, 1)
+	if err != nil {
+		t.Fatalf("countProbesByAgent: %v", err)
+	}
+	if got[1] != 2 || got[2] != 1 || got[3] != 0 {
+		t.Errorf("counts = %v, want map[1:2 2:1]", got)
+	}
+}
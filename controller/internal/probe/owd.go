@@ -0,0 +1,343 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── One-Way Delay ──
+//
+// TrafficSim between two agents can time each direction separately: the
+// receiver subtracts the sender's transmit timestamp from its own receive
+// time. Those raw one-way delays include the difference between the two
+// agents' clocks, so each agent estimates its offset from the controller
+// (an NTP-style exchange on /agent/api/clock/sync, or its own NTP
+// discipline) and reports it to /agent/api/clock/offset. At ingest the
+// controller corrects the raw values with both agents' offsets.
+//
+// Asymmetric congestion is judged on queuing delay (a direction's average
+// minus its minimum), which a constant clock offset cancels out of, so it
+// works even for samples that could not be corrected.
+
+// clockOffsetMaxAge is how long a reported clock offset is trusted.
+const clockOffsetMaxAge = 10 * time.Minute
+
+const (
+	// owdAsymmetryMinQueueMs is the least queuing delay, in ms, the
+	// congested direction must show.
+	owdAsymmetryMinQueueMs = 10.0
+	// owdAsymmetryRatio is how many times the other direction's queuing
+	// delay the congested direction must reach.
+	owdAsymmetryRatio = 3.0
+	// owdAsymmetryCriticalQueueMs escalates the incident to critical.
+	owdAsymmetryCriticalQueueMs = 50.0
+	// owdMinSamples is the fewest OWD cycles a pair needs to be judged.
+	owdMinSamples = 3
+)
+
+// OneWayDelay holds per-direction delays for an agent-to-agent TrafficSim
+// cycle, in milliseconds. Forward is reporting agent → target agent,
+// reverse is target agent → reporting agent.
+type OneWayDelay struct {
+	ForwardMs    float64 `json:"forwardMs"`
+	ReverseMs    float64 `json:"reverseMs"`
+	ForwardMinMs float64 `json:"forwardMinMs,omitempty"`
+	ReverseMinMs float64 `json:"reverseMinMs,omitempty"`
+	ForwardP95Ms float64 `json:"forwardP95Ms,omitempty"`
+	ReverseP95Ms float64 `json:"reverseP95Ms,omitempty"`
+
+	// Corrected is true once the delays account for both agents' clock
+	// offsets, either by the agent or at ingest.
+	Corrected bool `json:"corrected"`
+	// ClockOffsetMs and PeerClockOffsetMs are the offsets applied for the
+	// reporting and target agent.
+	ClockOffsetMs     float64 `json:"clockOffsetMs,omitempty"`
+	PeerClockOffsetMs float64 `json:"peerClockOffsetMs,omitempty"`
+	// SyncErrorMs bounds the correction error: half of each agent's
+	// synchronization round trip.
+	SyncErrorMs float64 `json:"syncErrorMs,omitempty"`
+}
+
+// ClockSample is an agent's estimated clock offset from the controller.
+// OffsetMs is added to the agent's clock to get controller time.
+type ClockSample struct {
+	OffsetMs   float64   `json:"offset_ms"`
+	RTTMs      float64   `json:"rtt_ms"`
+	Source     string    `json:"source"` // "controller" or "ntp"
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+var clockOffsets = struct {
+	mu sync.RWMutex
+	m  map[uint]ClockSample
+}{m: make(map[uint]ClockSample)}
+
+// RecordClockOffset stores an agent's latest clock offset.
+func RecordClockOffset(agentID uint, s ClockSample) {
+	if s.MeasuredAt.IsZero() {
+		s.MeasuredAt = time.Now()
+	}
+	clockOffsets.mu.Lock()
+	clockOffsets.m[agentID] = s
+	clockOffsets.mu.Unlock()
+}
+
+// ClockOffset returns an agent's clock offset if one was reported within
+// clockOffsetMaxAge of now.
+func ClockOffset(agentID uint, now time.Time) (ClockSample, bool) {
+	clockOffsets.mu.RLock()
+	s, ok := clockOffsets.m[agentID]
+	clockOffsets.mu.RUnlock()
+	if !ok || now.Sub(s.MeasuredAt) > clockOffsetMaxAge {
+		return ClockSample{}, false
+	}
+	return s, true
+}
+
+// ClockOffsetFromExchange computes an agent's offset and round trip from
+// one sync exchange: t0 agent send, t1 controller receive, t2 controller
+// send, t3 agent receive. t0 and t3 are on the agent's clock.
+func ClockOffsetFromExchange(t0, t1, t2, t3 time.Time) (offsetMs, rttMs float64) {
+	offset := (t1.Sub(t0) + t2.Sub(t3)) / 2
+	rtt := t3.Sub(t0) - t2.Sub(t1)
+	return durationMs(offset), math.Max(0, durationMs(rtt))
+}
+
+// correctOneWayDelay applies the reporting (src) and target (dst) agents'
+// clock offsets to raw one-way delays. It reports false, leaving owd
+// untouched, when either offset is unknown.
+func correctOneWayDelay(owd *OneWayDelay, src, dst uint, now time.Time) bool {
+	if owd == nil || owd.Corrected {
+		return false
+	}
+	so, ok := ClockOffset(src, now)
+	if !ok {
+		return false
+	}
+	do, ok := ClockOffset(dst, now)
+	if !ok {
+		return false
+	}
+	// Forward is received on dst's clock and sent on src's; reverse the
+	// other way round.
+	fwd := do.OffsetMs - so.OffsetMs
+	owd.ForwardMs += fwd
+	owd.ReverseMs -= fwd
+	if owd.ForwardMinMs != 0 {
+		owd.ForwardMinMs += fwd
+	}
+	if owd.ReverseMinMs != 0 {
+		owd.ReverseMinMs -= fwd
+	}
+	if owd.ForwardP95Ms != 0 {
+		owd.ForwardP95Ms += fwd
+	}
+	if owd.ReverseP95Ms != 0 {
+		owd.ReverseP95Ms -= fwd
+	}
+	owd.Corrected = true
+	owd.ClockOffsetMs = so.OffsetMs
+	owd.PeerClockOffsetMs = do.OffsetMs
+	owd.SyncErrorMs = (so.RTTMs + do.RTTMs) / 2
+	return true
+}
+
+// owdPairStats is one agent pair's OWD over the window.
+type owdPairStats struct {
+	agentID, targetAgent uint
+	samples              int
+	forwardAvgMs         float64
+	reverseAvgMs         float64
+	forwardMinMs         float64
+	reverseMinMs         float64
+	corrected            int
+}
+
+// forwardQueueMs and reverseQueueMs are each direction's queuing delay.
+func (s owdPairStats) forwardQueueMs() float64 { return math.Max(0, s.forwardAvgMs-s.forwardMinMs) }
+func (s owdPairStats) reverseQueueMs() float64 { return math.Max(0, s.reverseAvgMs-s.reverseMinMs) }
+
+// congestedDirection returns "forward" or "reverse" when one direction's
+// queuing delay is at least owdAsymmetryMinQueueMs and owdAsymmetryRatio
+// times the other's, or "" when the pair is symmetric.
+func (s owdPairStats) congestedDirection() string {
+	if s.samples < owdMinSamples {
+		return ""
+	}
+	f, r := s.forwardQueueMs(), s.reverseQueueMs()
+	switch {
+	case f >= owdAsymmetryMinQueueMs && f >= owdAsymmetryRatio*r:
+		return "forward"
+	case r >= owdAsymmetryMinQueueMs && r >= owdAsymmetryRatio*f:
+		return "reverse"
+	}
+	return ""
+}
+
+// aggregateOWD folds per-cycle OWD samples into per-pair stats. The
+// minimum is the lowest cycle minimum, or cycle average when the agent
+// didn't report one.
+func aggregateOWD(agentID, targetAgent uint, cycles []OneWayDelay) owdPairStats {
+	s := owdPairStats{agentID: agentID, targetAgent: targetAgent, forwardMinMs: math.Inf(1), reverseMinMs: math.Inf(1)}
+	for _, c := range cycles {
+		s.samples++
+		s.forwardAvgMs += c.ForwardMs
+		s.reverseAvgMs += c.ReverseMs
+		fmin, rmin := c.ForwardMs, c.ReverseMs
+		if c.ForwardMinMs != 0 {
+			fmin = c.ForwardMinMs
+		}
+		if c.ReverseMinMs != 0 {
+			rmin = c.ReverseMinMs
+		}
+		s.forwardMinMs = math.Min(s.forwardMinMs, fmin)
+		s.reverseMinMs = math.Min(s.reverseMinMs, rmin)
+		if c.Corrected {
+			s.corrected++
+		}
+	}
+	if s.samples == 0 {
+		return owdPairStats{agentID: agentID, targetAgent: targetAgent}
+	}
+	s.forwardAvgMs /= float64(s.samples)
+	s.reverseAvgMs /= float64(s.samples)
+	return s
+}
+
+// getOWDPairStats returns OWD stats for each agent-to-agent TrafficSim
+// pair reported by agentIDs since from.
+func getOWDPairStats(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) ([]owdPairStats, error) {
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT agent_id, target_agent, payload_raw
+FROM probe_data
+WHERE type = 'TRAFFICSIM'
+  AND agent_id IN (%s)
+  AND target_agent != 0
+  AND created_at >= %s%s
+  AND payload_raw LIKE '%%"owd"%%'
+ORDER BY created_at DESC
+LIMIT 5000
+`, strings.Join(ids, ", "), chQuoteTime(from), asOfBound(ctx))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Corrected and raw cycles differ by the clock offset, so they're
+	// kept apart and each pair is judged on whichever it has more of.
+	type pair struct {
+		agent, target uint
+		corrected     bool
+	}
+	cycles := make(map[pair][]OneWayDelay)
+	for rows.Next() {
+		var agentID, targetAgent uint64
+		var payloadRaw string
+		if err := rows.Scan(&agentID, &targetAgent, &payloadRaw); err != nil {
+			return nil, err
+		}
+		var payload struct {
+			OWD *OneWayDelay `json:"owd"`
+		}
+		if json.Unmarshal([]byte(payloadRaw), &payload) != nil || payload.OWD == nil {
+			continue
+		}
+		k := pair{uint(agentID), uint(targetAgent), payload.OWD.Corrected}
+		cycles[k] = append(cycles[k], *payload.OWD)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]owdPairStats, 0, len(cycles))
+	for k, c := range cycles {
+		other := cycles[pair{k.agent, k.target, !k.corrected}]
+		if len(other) > len(c) || (len(other) == len(c) && !k.corrected) {
+			continue
+		}
+		out = append(out, aggregateOWD(k.agent, k.target, c))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].agentID != out[j].agentID {
+			return out[i].agentID < out[j].agentID
+		}
+		return out[i].targetAgent < out[j].targetAgent
+	})
+	return out, nil
+}
+
+// detectAsymmetricCongestionIncidents flags agent pairs where one
+// direction queues far more than the other — congestion an RTT, which
+// sums both directions, can't place.
+func detectAsymmetricCongestionIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time, agentByID map[uint]agentInfo) []DetectedIncident {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	pairs, err := getOWDPairStats(ctx, ch, agentIDs, from)
+	if err != nil {
+		return nil
+	}
+
+	name := func(id uint) string {
+		if a, ok := agentByID[id]; ok {
+			return a.Name
+		}
+		return fmt.Sprintf("%d", id)
+	}
+	var incidents []DetectedIncident
+	for _, p := range pairs {
+		dir := p.congestedDirection()
+		if dir == "" {
+			continue
+		}
+		src, dst := name(p.agentID), name(p.targetAgent)
+		queue, other := p.forwardQueueMs(), p.reverseQueueMs()
+		if dir == "reverse" {
+			src, dst = dst, src
+			queue, other = other, queue
+		}
+		severity := "warning"
+		if queue >= owdAsymmetryCriticalQueueMs {
+			severity = "critical"
+		}
+		evidence := []string{
+			fmt.Sprintf("%s → %s: %.1fms avg one-way delay, %.1fms above its minimum", name(p.agentID), name(p.targetAgent), p.forwardAvgMs, p.forwardQueueMs()),
+			fmt.Sprintf("%s → %s: %.1fms avg one-way delay, %.1fms above its minimum", name(p.targetAgent), name(p.agentID), p.reverseAvgMs, p.reverseQueueMs()),
+			fmt.Sprintf("%d cycles, %d clock-corrected", p.samples, p.corrected),
+		}
+		incidents = append(incidents, DetectedIncident{
+			ID:              fmt.Sprintf("owd_asymmetric_%d_%d_%s", p.agentID, p.targetAgent, dir),
+			Title:           fmt.Sprintf("Congestion from %s to %s only", src, dst),
+			Severity:        severity,
+			Scope:           "target-specific",
+			SuggestedCause:  fmt.Sprintf("Queuing delay builds up from %s to %s (%.1fms) but not the other way (%.1fms) — likely a saturated upstream link or asymmetric route on that side", src, dst, queue, other),
+			AffectedAgents:  []string{src, dst},
+			AffectedTargets: []string{dst},
+			Evidence:        evidence,
+			Recommendations: []string{
+				fmt.Sprintf("Check upload utilisation and shaping at %s and download at %s", src, dst),
+				"Compare MTR from both agents to see whether the two directions take different routes",
+			},
+			Confidence:      math.Min(0.9, 0.5+float64(p.samples)/100),
+			MatchedCriteria: fmt.Sprintf("one-way queuing ≥%.0fms and ≥%.0f× the reverse direction", owdAsymmetryMinQueueMs, owdAsymmetryRatio),
+		})
+	}
+	return incidents
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,70 @@
+package probe
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClockOffsetFromExchange(t *testing.T) {
+	// Agent clock runs 50ms behind the controller; 10ms each way.
+	t0 := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(60 * time.Millisecond)
+	t2 := t1.Add(2 * time.Millisecond)
+	t3 := t0.Add(22 * time.Millisecond)
+	off, rtt := ClockOffsetFromExchange(t0, t1, t2, t3)
+	if math.Abs(off-50) > 1e-9 || math.Abs(rtt-20) > 1e-9 {
+		t.Errorf("offset, rtt = %.3f, %.3f; want 50, 20", off, rtt)
+	}
+}
+
+// TestCorrectOneWayDelay verifies raw delays are shifted by the offset
+// difference, and left alone when a peer's offset is unknown or stale.
+func TestCorrectOneWayDelay(t *testing.T) {
+	now := time.Now()
+	RecordClockOffset(9001, ClockSample{OffsetMs: 5, RTTMs: 2, MeasuredAt: now})
+	RecordClockOffset(9002, ClockSample{OffsetMs: -15, RTTMs: 4, MeasuredAt: now})
+	RecordClockOffset(9003, ClockSample{OffsetMs: 1, MeasuredAt: now.Add(-time.Hour)})
+
+	// True delays 10ms each way; dst's clock is 20ms ahead of src's.
+	owd := &OneWayDelay{ForwardMs: 30, ReverseMs: -10, ForwardMinMs: 28}
+	if !correctOneWayDelay(owd, 9001, 9002, now) {
+		t.Fatal("not corrected")
+	}
+	if owd.ForwardMs != 10 || owd.ReverseMs != 10 || owd.ForwardMinMs != 8 || owd.ReverseMinMs != 0 || owd.SyncErrorMs != 3 {
+		t.Errorf("corrected = %+v", owd)
+	}
+	if correctOneWayDelay(owd, 9001, 9002, now) {
+		t.Error("corrected twice")
+	}
+	if correctOneWayDelay(&OneWayDelay{ForwardMs: 30}, 9001, 9003, now) {
+		t.Error("corrected with stale peer offset")
+	}
+}
+
+func TestCongestedDirection(t *testing.T) {
+	cycles := func(fwd, rev []float64) []OneWayDelay {
+		out := make([]OneWayDelay, len(fwd))
+		for i := range fwd {
+			// A constant clock offset must not matter.
+			out[i] = OneWayDelay{ForwardMs: fwd[i] + 500, ReverseMs: rev[i] - 500}
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name     string
+		fwd, rev []float64
+		want     string
+	}{
+		{"symmetric", []float64{10, 20, 30}, []float64{10, 20, 30}, ""},
+		{"forward congested", []float64{10, 40, 50}, []float64{10, 11, 12}, "forward"},
+		{"reverse congested", []float64{10, 11, 10}, []float64{10, 60, 70}, "reverse"},
+		{"too small", []float64{10, 14, 15}, []float64{10, 10, 10}, ""},
+		{"too few samples", []float64{10, 90}, []float64{10, 10}, ""},
+	} {
+		s := aggregateOWD(1, 2, cycles(tc.fwd, tc.rev))
+		if got := s.congestedDirection(); got != tc.want {
+			t.Errorf("%s: direction = %q, want %q (queue %.1f/%.1f)", tc.name, got, tc.want, s.forwardQueueMs(), s.reverseQueueMs())
+		}
+	}
+}
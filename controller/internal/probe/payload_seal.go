@@ -0,0 +1,409 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Sensitive payload field sealing ─────────────────────────────────────────
+//
+// SYSINFO and NETINFO payloads carry hostnames, interface addresses and
+// ISP details that some workspaces don't want stored in the clear. When a
+// workspace opts in (workspace.settings.encrypt_sensitive_fields = true)
+// the designated fields are removed from the payload before it is written
+// to ClickHouse and stored AES-256-GCM encrypted under a "_sealed" key:
+//
+//	{"memoryInfo": {...}, "_sealed": {"v": 1, "ws": 12, "ct": "<base64>"}}
+//
+// Everything else stays plaintext so server-side JSONExtract aggregations
+// (CPU / memory alerting, baselines) keep working. Each workspace gets its
+// own key derived from the controller's sealed secret (PAYLOAD_SEAL_KEY),
+// and the workspace ID is bound as additional authenticated data so a
+// ciphertext can't be replayed into another workspace's rows. If sealing
+// fails the fields are dropped rather than stored in the clear.
+//
+// Data streams get the stored form too (ExportPayload).
+//
+// The read paths that decode NETINFO / SYSINFO (FindProbeData, GetLatest*,
+// the analysis fetchers) call UnsealAgentPayload, so API consumers — who
+// are already workspace-authorized by the route middleware — see the
+// original payload. The key is chosen by the workspace of the row's
+// reporting agent, never by the envelope, and an envelope naming another
+// workspace is left sealed. Rows written before sealing was enabled pass
+// through untouched.
+
+// sealedPayloadFields lists the JSON paths (dot-separated) sealed per type.
+var sealedPayloadFields = map[Type][]string{
+	TypeNetInfo: {
+		"local_address", "default_gateway", "public_address",
+		"interfaces", "routes", "geo", "internet_provider", "lat", "long",
+	},
+	TypeSysInfo: {
+		"hostInfo.name", "hostInfo.ip", "hostInfo.mac", "hostInfo.id",
+	},
+}
+
+const (
+	sealedKey           = "_sealed"
+	sealVersion         = 1
+	sealSettingsKey     = "encrypt_sensitive_fields"
+	sealSettingsTTL     = time.Minute
+	payloadSealKeyBytes = 32
+)
+
+var (
+	// ErrSealCorrupt is returned when a sealed envelope fails to decrypt.
+	ErrSealCorrupt = errors.New("sealed payload could not be opened")
+	// ErrSealWorkspace is returned when an envelope names a workspace other
+	// than the one the row belongs to.
+	ErrSealWorkspace = errors.New("sealed payload belongs to another workspace")
+)
+
+// PayloadSealConfig holds the controller-wide sealed secret.
+type PayloadSealConfig struct {
+	Key []byte // 32-byte master key; nil disables sealing
+}
+
+// LoadPayloadSealConfig reads PAYLOAD_SEAL_KEY (base64, 32 bytes).
+func LoadPayloadSealConfig() (PayloadSealConfig, error) {
+	v := strings.TrimSpace(os.Getenv("PAYLOAD_SEAL_KEY"))
+	if v == "" {
+		return PayloadSealConfig{}, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return PayloadSealConfig{}, fmt.Errorf("PAYLOAD_SEAL_KEY: %w", err)
+	}
+	if len(key) != payloadSealKeyBytes {
+		return PayloadSealConfig{}, fmt.Errorf("PAYLOAD_SEAL_KEY must decode to %d bytes, got %d", payloadSealKeyBytes, len(key))
+	}
+	return PayloadSealConfig{Key: key}, nil
+}
+
+// PayloadSealer seals and opens payload fields. Workspace opt-in lookups
+// are cached briefly so the ingest path doesn't hit Postgres per row.
+type PayloadSealer struct {
+	master []byte
+	pg     *gorm.DB
+
+	mu      sync.Mutex
+	enabled map[uint]sealSetting
+	agentWS map[uint]uint // agent ID → workspace ID; agents never move
+}
+
+type sealSetting struct {
+	on      bool
+	fetched time.Time
+}
+
+var payloadSealer *PayloadSealer
+
+// InitPayloadSealer installs the global sealer. With no key configured
+// sealing is disabled and sealed rows are returned as stored.
+func InitPayloadSealer(pg *gorm.DB, cfg PayloadSealConfig) {
+	if len(cfg.Key) == 0 {
+		log.Info("[seal] PAYLOAD_SEAL_KEY not set — sensitive field sealing disabled")
+		payloadSealer = nil
+		return
+	}
+	payloadSealer = &PayloadSealer{master: cfg.Key, pg: pg, enabled: make(map[uint]sealSetting), agentWS: make(map[uint]uint)}
+	log.Info("[seal] sensitive payload field sealing available (per-workspace opt-in)")
+}
+
+// workspaceEnabled reports whether the workspace opted in to sealing.
+func (s *PayloadSealer) workspaceEnabled(ctx context.Context, workspaceID uint) bool {
+	if workspaceID == 0 || s.pg == nil {
+		return false
+	}
+	s.mu.Lock()
+	cached, ok := s.enabled[workspaceID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetched) < sealSettingsTTL {
+		return cached.on
+	}
+
+	var raw []byte
+	err := s.pg.WithContext(ctx).Raw(`SELECT settings FROM workspaces WHERE id = ? AND deleted_at IS NULL`, workspaceID).Row().Scan(&raw)
+	on := false
+	if err == nil && len(raw) > 0 {
+		var settings map[string]any
+		if json.Unmarshal(raw, &settings) == nil {
+			on, _ = settings[sealSettingsKey].(bool)
+		}
+	}
+
+	s.mu.Lock()
+	s.enabled[workspaceID] = sealSetting{on: on, fetched: time.Now()}
+	s.mu.Unlock()
+	return on
+}
+
+// agentWorkspace returns the workspace of a reporting agent, including
+// deleted agents whose rows are still stored. Returns 0 when unknown.
+func (s *PayloadSealer) agentWorkspace(ctx context.Context, agentID uint) uint {
+	s.mu.Lock()
+	wsID, ok := s.agentWS[agentID]
+	s.mu.Unlock()
+	if ok || agentID == 0 || s.pg == nil {
+		return wsID
+	}
+	if err := s.pg.WithContext(ctx).Raw(`SELECT workspace_id FROM agents WHERE id = ?`, agentID).Row().Scan(&wsID); err != nil {
+		return 0
+	}
+	s.mu.Lock()
+	s.agentWS[agentID] = wsID
+	s.mu.Unlock()
+	return wsID
+}
+
+// workspaceAEAD derives the workspace's AES-256-GCM cipher from the master key.
+func (s *PayloadSealer) workspaceAEAD(workspaceID uint) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, s.master)
+	fmt.Fprintf(mac, "netwatcher/payload-seal/v%d/workspace/%d", sealVersion, workspaceID)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealAAD(workspaceID uint) []byte {
+	return []byte(fmt.Sprintf("ws:%d", workspaceID))
+}
+
+type sealedEnvelope struct {
+	V  int    `json:"v"`
+	WS uint   `json:"ws"`
+	CT string `json:"ct"`
+}
+
+// seal removes the designated fields from payload and stores them encrypted.
+func (s *PayloadSealer) seal(workspaceID uint, kind Type, payload []byte) ([]byte, error) {
+	paths := sealedPayloadFields[kind]
+	if len(paths) == 0 {
+		return payload, nil
+	}
+	doc, err := decodeJSONObject(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make(map[string]any)
+	for _, p := range paths {
+		if v, ok := takePath(doc, p); ok {
+			secret[p] = v
+		}
+	}
+	if len(secret) == 0 {
+		return payload, nil
+	}
+
+	plain, err := json.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := s.workspaceAEAD(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ct := aead.Seal(nonce, nonce, plain, sealAAD(workspaceID))
+	doc[sealedKey] = sealedEnvelope{V: sealVersion, WS: workspaceID, CT: base64.StdEncoding.EncodeToString(ct)}
+	return json.Marshal(doc)
+}
+
+// open restores sealed fields into a payload stored for workspaceID. An
+// envelope sealed for any other workspace is rejected.
+func (s *PayloadSealer) open(workspaceID uint, payload []byte) ([]byte, error) {
+	doc, err := decodeJSONObject(payload)
+	if err != nil {
+		return nil, err
+	}
+	rawEnv, ok := doc[sealedKey]
+	if !ok {
+		return payload, nil
+	}
+	envBytes, _ := json.Marshal(rawEnv)
+	var env sealedEnvelope
+	if err := json.Unmarshal(envBytes, &env); err != nil || env.V != sealVersion {
+		return nil, ErrSealCorrupt
+	}
+	if workspaceID == 0 || env.WS != workspaceID {
+		return nil, ErrSealWorkspace
+	}
+	ct, err := base64.StdEncoding.DecodeString(env.CT)
+	if err != nil {
+		return nil, ErrSealCorrupt
+	}
+	aead, err := s.workspaceAEAD(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ct) < aead.NonceSize() {
+		return nil, ErrSealCorrupt
+	}
+	plain, err := aead.Open(nil, ct[:aead.NonceSize()], ct[aead.NonceSize():], sealAAD(workspaceID))
+	if err != nil {
+		return nil, ErrSealCorrupt
+	}
+	secret, err := decodeJSONObject(plain)
+	if err != nil {
+		return nil, ErrSealCorrupt
+	}
+	delete(doc, sealedKey)
+	for p, v := range secret {
+		putPath(doc, p, v)
+	}
+	return json.Marshal(doc)
+}
+
+// sealPayloadFor returns the payload to store for data: sealed when the
+// reporting workspace opted in, otherwise the payload unchanged. sealed
+// reports that the sensitive fields are not in the returned payload. If
+// sealing fails the fields are dropped instead — an opted-in workspace
+// never stores them in the clear — and an error is returned only when the
+// payload can't be redacted at all.
+func sealPayloadFor(ctx context.Context, data ProbeData, kind Type, payload any) (stored any, sealed bool, err error) {
+	s := payloadSealer
+	if s == nil || len(sealedPayloadFields[kind]) == 0 || !s.workspaceEnabled(ctx, data.WorkspaceID) {
+		return payload, false, nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := s.seal(data.WorkspaceID, kind, raw)
+	if err != nil {
+		log.WithError(err).Errorf("[seal] workspace=%d type=%s seal failed; storing without sensitive fields", data.WorkspaceID, kind)
+		if out, err = redactPayload(kind, raw); err != nil {
+			return nil, false, fmt.Errorf("seal %s payload: %w", kind, err)
+		}
+	}
+	return json.RawMessage(out), true, nil
+}
+
+// ExportPayload returns data's payload as it is stored: sealed when the
+// workspace opted in (redacted if sealing fails), otherwise unchanged.
+// Copies that leave the controller, such as data streams, use it so sealed
+// fields are never forwarded in the clear.
+func ExportPayload(ctx context.Context, data ProbeData) (json.RawMessage, error) {
+	stored, sealed, err := sealPayloadFor(ctx, data, data.Type, data.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if !sealed {
+		return data.Payload, nil
+	}
+	return stored.(json.RawMessage), nil
+}
+
+// redactPayload removes the sealed fields of kind from payload.
+func redactPayload(kind Type, payload []byte) ([]byte, error) {
+	doc, err := decodeJSONObject(payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range sealedPayloadFields[kind] {
+		takePath(doc, p)
+	}
+	return json.Marshal(doc)
+}
+
+// UnsealPayload restores sealed fields in a payload stored for
+// workspaceID. Payloads without a "_sealed" envelope, sealed payloads when
+// no key is configured, and envelopes for another workspace are returned
+// unchanged.
+func UnsealPayload(workspaceID uint, raw []byte) []byte {
+	if !bytes.Contains(raw, []byte(`"`+sealedKey+`"`)) {
+		return raw
+	}
+	s := payloadSealer
+	if s == nil {
+		return raw
+	}
+	out, err := s.open(workspaceID, raw)
+	if err != nil {
+		log.WithError(err).Warnf("[seal] failed to open sealed payload for workspace %d", workspaceID)
+		return raw
+	}
+	return out
+}
+
+// UnsealAgentPayload is UnsealPayload for a row reported by agentID,
+// opened with that agent's workspace key.
+func UnsealAgentPayload(ctx context.Context, agentID uint, raw []byte) []byte {
+	if !bytes.Contains(raw, []byte(`"`+sealedKey+`"`)) {
+		return raw
+	}
+	s := payloadSealer
+	if s == nil {
+		return raw
+	}
+	return UnsealPayload(s.agentWorkspace(ctx, agentID), raw)
+}
+
+// decodeJSONObject decodes a JSON object keeping numbers as json.Number so
+// large counters (CPU time in ns, byte totals) survive the round-trip
+// without float64 precision loss.
+func decodeJSONObject(b []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// takePath removes and returns the value at a dot-separated path.
+func takePath(doc map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	last := parts[len(parts)-1]
+	v, ok := cur[last]
+	if ok {
+		delete(cur, last)
+	}
+	return v, ok
+}
+
+// putPath sets the value at a dot-separated path, creating objects as needed.
+func putPath(doc map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			cur[p] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = v
+}
@@ -0,0 +1,178 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func withTestSealer(t *testing.T) *PayloadSealer {
+	t.Helper()
+	prev := payloadSealer
+	s := &PayloadSealer{master: bytes.Repeat([]byte{7}, payloadSealKeyBytes), enabled: map[uint]sealSetting{}, agentWS: map[uint]uint{}}
+	payloadSealer = s
+	t.Cleanup(func() { payloadSealer = prev })
+	return s
+}
+
+// TestSealRoundTripNetInfo verifies designated NETINFO fields are removed
+// from the stored payload and restored by UnsealPayload.
+func TestSealRoundTripNetInfo(t *testing.T) {
+	s := withTestSealer(t)
+	in := netInfoPayload{
+		LocalAddress:     "10.0.0.5",
+		PublicAddress:    "203.0.113.9",
+		InternetProvider: "Example ISP",
+		Source:           "controller",
+	}
+	raw, _ := json.Marshal(in)
+
+	sealed, err := s.seal(42, TypeNetInfo, raw)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	for _, leak := range []string{"10.0.0.5", "203.0.113.9", "Example ISP"} {
+		if strings.Contains(string(sealed), leak) {
+			t.Errorf("sealed payload leaks %q: %s", leak, sealed)
+		}
+	}
+	if !strings.Contains(string(sealed), `"source":"controller"`) {
+		t.Errorf("non-sensitive field should stay plaintext: %s", sealed)
+	}
+
+	var out netInfoPayload
+	if err := json.Unmarshal(UnsealPayload(42, sealed), &out); err != nil {
+		t.Fatalf("unmarshal unsealed: %v", err)
+	}
+	if out.LocalAddress != in.LocalAddress || out.PublicAddress != in.PublicAddress || out.InternetProvider != in.InternetProvider {
+		t.Errorf("round trip mismatch: got %+v", out)
+	}
+}
+
+// TestSealNestedSysInfoKeepsLargeCounters verifies dotted paths seal
+// nested hostInfo fields and that ns-scale counters survive intact.
+func TestSealNestedSysInfoKeepsLargeCounters(t *testing.T) {
+	s := withTestSealer(t)
+	raw := []byte(`{"hostInfo":{"name":"db-01","architecture":"amd64"},"CPUTimes":{"user":9007199254740993}}`)
+
+	sealed, err := s.seal(1, TypeSysInfo, raw)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if strings.Contains(string(sealed), "db-01") {
+		t.Errorf("hostname leaked: %s", sealed)
+	}
+	opened := UnsealPayload(1, sealed)
+	if !strings.Contains(string(opened), `"name":"db-01"`) || !strings.Contains(string(opened), `"architecture":"amd64"`) {
+		t.Errorf("hostInfo not restored: %s", opened)
+	}
+	if !strings.Contains(string(opened), "9007199254740993") {
+		t.Errorf("large counter lost precision: %s", opened)
+	}
+}
+
+// TestUnsealRejectsCrossWorkspace verifies an envelope relabelled with a
+// different workspace ID fails authentication and is left sealed.
+func TestUnsealRejectsCrossWorkspace(t *testing.T) {
+	s := withTestSealer(t)
+	raw, _ := json.Marshal(netInfoPayload{PublicAddress: "203.0.113.9"})
+	sealed, err := s.seal(42, TypeNetInfo, raw)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	tampered := bytes.Replace(sealed, []byte(`"ws":42`), []byte(`"ws":43`), 1)
+	if _, err := s.open(43, tampered); err == nil {
+		t.Fatal("expected cross-workspace envelope to fail")
+	}
+	if strings.Contains(string(UnsealPayload(43, tampered)), "203.0.113.9") {
+		t.Error("tampered envelope must not decrypt")
+	}
+}
+
+// TestUnsealUsesRowWorkspace verifies the key comes from the row's
+// workspace: an intact envelope stored under another workspace's agent is
+// left sealed, even though it names its own workspace.
+func TestUnsealUsesRowWorkspace(t *testing.T) {
+	s := withTestSealer(t)
+	s.agentWS[7], s.agentWS[8] = 42, 43
+	raw, _ := json.Marshal(netInfoPayload{PublicAddress: "203.0.113.9"})
+	sealed, err := s.seal(42, TypeNetInfo, raw)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if _, err := s.open(43, sealed); !errors.Is(err, ErrSealWorkspace) {
+		t.Errorf("open for workspace 43 err = %v, want ErrSealWorkspace", err)
+	}
+	if strings.Contains(string(UnsealAgentPayload(context.Background(), 8, sealed)), "203.0.113.9") {
+		t.Error("row of another workspace's agent must not decrypt")
+	}
+	if !strings.Contains(string(UnsealAgentPayload(context.Background(), 7, sealed)), "203.0.113.9") {
+		t.Error("row of the sealing workspace's agent should decrypt")
+	}
+	if strings.Contains(string(UnsealAgentPayload(context.Background(), 9, sealed)), "203.0.113.9") {
+		t.Error("row of an unknown agent must not decrypt")
+	}
+}
+
+// TestSealRedactsOnFailure verifies a payload that can't be sealed is
+// stored without its sensitive fields rather than in the clear.
+func TestSealRedactsOnFailure(t *testing.T) {
+	withTestSealer(t)
+	raw := []byte(`{"hostInfo":{"name":"db-01","architecture":"amd64"}}`)
+	out, err := redactPayload(TypeSysInfo, raw)
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	if strings.Contains(string(out), "db-01") || !strings.Contains(string(out), "amd64") {
+		t.Errorf("redacted = %s", out)
+	}
+	if _, err := redactPayload(TypeSysInfo, []byte(`not json`)); err == nil {
+		t.Error("expected an error for a payload that can't be redacted")
+	}
+}
+
+// TestUnsealPassesThroughPlainRows verifies legacy unsealed payloads are
+// returned byte-for-byte.
+func TestUnsealPassesThroughPlainRows(t *testing.T) {
+	withTestSealer(t)
+	raw := []byte(`{"public_address":"198.51.100.1"}`)
+	if got := UnsealPayload(1, raw); !bytes.Equal(got, raw) {
+		t.Errorf("plain payload modified: %s", got)
+	}
+}
+
+// TestExportPayloadSealsOptedInWorkspaces verifies streamed payloads carry
+// the stored (sealed) form for opted-in workspaces and pass through
+// otherwise.
+func TestExportPayloadSealsOptedInWorkspaces(t *testing.T) {
+	s := withTestSealer(t)
+	s.pg = newTestDB(t)
+	if err := s.pg.Exec(`CREATE TABLE workspaces (id INTEGER PRIMARY KEY, settings TEXT, deleted_at DATETIME)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.pg.Exec(`INSERT INTO workspaces (id, settings) VALUES (1, '{"encrypt_sensitive_fields": true}'), (2, '{}')`)
+
+	raw := json.RawMessage(`{"local_address":"10.0.0.5","public_address":"203.0.113.9","source":"agent"}`)
+	out, err := ExportPayload(context.Background(), ProbeData{WorkspaceID: 1, Type: TypeNetInfo, Payload: raw})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if strings.Contains(string(out), "10.0.0.5") || !strings.Contains(string(out), `"_sealed"`) || !strings.Contains(string(out), `"source":"agent"`) {
+		t.Errorf("opted-in export = %s", out)
+	}
+	if got := UnsealPayload(1, out); !strings.Contains(string(got), "203.0.113.9") {
+		t.Errorf("exported payload does not open: %s", got)
+	}
+
+	for _, d := range []ProbeData{
+		{WorkspaceID: 2, Type: TypeNetInfo, Payload: raw},
+		{WorkspaceID: 1, Type: TypePing, Payload: json.RawMessage(`{"avg_rtt":1}`)},
+	} {
+		if out, err := ExportPayload(context.Background(), d); err != nil || !bytes.Equal(out, d.Payload) {
+			t.Errorf("workspace %d %s export = %s, %v; want unchanged", d.WorkspaceID, d.Type, out, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"netwatcher-controller/internal/metrics"
+)
+
+// ── Payload format versioning ───────────────────────────────────────────────
+//
+// Agents serialize probe results in whatever shape their build uses, and
+// that shape has changed over time (the earliest agents marshalled
+// pro-bing's Statistics struct directly, producing PascalCase keys; the
+// current agent sends snake_case). Readers that hard-code one shape
+// silently see zeros for the other.
+//
+// Payloads may now carry an explicit "payload_version". When absent the
+// version is inferred from the keys present. Each (type, version) pair
+// has a parser registered below that converts the payload to one
+// canonical form; every read path (ingest, aggregation, analysis, network
+// map, reports) goes through the registry. Payloads from a version with
+// no registered parser are counted in
+// netwatcher_probe_data_unknown_payload_version_total and skipped rather
+// than misread.
+
+// PayloadVersionKey is the optional version field in probe payloads.
+const PayloadVersionKey = "payload_version"
+
+// Known PING payload versions.
+const (
+	PingPayloadV0 = 0 // legacy: pro-bing Statistics, PascalCase keys, ns RTTs
+	PingPayloadV1 = 1 // current: snake_case keys, ns RTTs
+)
+
+// ErrUnknownPayloadVersion is returned for payloads whose version has no
+// registered parser.
+var ErrUnknownPayloadVersion = errors.New("unknown payload version")
+
+type payloadParserKey struct {
+	kind    Type
+	version int
+}
+
+type payloadFormat struct {
+	version int
+	parse   func(raw []byte) (any, error)
+	// detect reports whether an unversioned payload is in this format.
+	detect func(probe map[string]json.RawMessage) bool
+}
+
+var (
+	payloadParsersMu sync.RWMutex
+	payloadParsers   = map[payloadParserKey]payloadFormat{}
+	payloadFormats   = map[Type][]payloadFormat{}
+)
+
+// RegisterPayloadParser installs a parser for one (type, version) pair.
+// detect may be nil when the version is only ever sent explicitly.
+func RegisterPayloadParser(kind Type, version int, detect func(map[string]json.RawMessage) bool, parse func([]byte) (any, error)) {
+	payloadParsersMu.Lock()
+	defer payloadParsersMu.Unlock()
+	f := payloadFormat{version: version, parse: parse, detect: detect}
+	payloadParsers[payloadParserKey{kind, version}] = f
+	payloadFormats[kind] = append(payloadFormats[kind], f)
+}
+
+// DetectPayloadVersion returns the payload's explicit version, or the
+// version inferred from its keys. ok is false when neither applies.
+func DetectPayloadVersion(kind Type, raw []byte) (version int, ok bool) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return 0, false
+	}
+	// Version 0 is never sent explicitly (it predates the field), so a
+	// zero value is treated as absent and falls through to detection.
+	if v, has := keys[PayloadVersionKey]; has {
+		n, err := strconv.Atoi(string(bytes.TrimSpace(v)))
+		if err != nil {
+			return 0, false
+		}
+		if n > 0 {
+			return n, true
+		}
+	}
+	payloadParsersMu.RLock()
+	defer payloadParsersMu.RUnlock()
+	for _, f := range payloadFormats[kind] {
+		if f.detect != nil && f.detect(keys) {
+			return f.version, true
+		}
+	}
+	return 0, false
+}
+
+// ParsePayload decodes raw with the parser registered for its version.
+func ParsePayload(kind Type, raw []byte) (any, int, error) {
+	version, ok := DetectPayloadVersion(kind, raw)
+	if !ok {
+		recordUnknownPayloadVersion(kind, "unrecognized")
+		return nil, 0, fmt.Errorf("%w: %s payload format not recognized", ErrUnknownPayloadVersion, kind)
+	}
+	payloadParsersMu.RLock()
+	f, found := payloadParsers[payloadParserKey{kind, version}]
+	payloadParsersMu.RUnlock()
+	if !found {
+		recordUnknownPayloadVersion(kind, strconv.Itoa(version))
+		return nil, version, fmt.Errorf("%w: %s v%d", ErrUnknownPayloadVersion, kind, version)
+	}
+	out, err := f.parse(raw)
+	return out, version, err
+}
+
+var unknownVersionLogged sync.Map // "TYPE/version" → struct{}
+
+func recordUnknownPayloadVersion(kind Type, version string) {
+	if m := metrics.Get(); m != nil && m.UnknownPayloadVersion != nil {
+		m.UnknownPayloadVersion.WithLabelValues(string(kind), version).Inc()
+	}
+	// Log once per (type, version) — these arrive on every sample.
+	if _, seen := unknownVersionLogged.LoadOrStore(string(kind)+"/"+version, struct{}{}); !seen {
+		log.Warnf("[payload] %s payload version %s has no registered parser; samples will be skipped", kind, version)
+	}
+}
+
+// ── PING ──
+
+// ParsePingPayload decodes a stored or incoming PING payload of any
+// supported version into the canonical PingPayload.
+func ParsePingPayload(raw []byte) (PingPayload, error) {
+	v, _, err := ParsePayload(TypePing, raw)
+	if err != nil {
+		return PingPayload{}, err
+	}
+	return v.(PingPayload), nil
+}
+
+// pingPayloadV0 is the legacy shape: pro-bing's Statistics marshalled
+// without json tags.
+type pingPayloadV0 struct {
+	PacketsRecv           int
+	PacketsSent           int
+	PacketsRecvDuplicates int
+	PacketLoss            float64
+	Addr                  string
+	MinRtt                time.Duration
+	MaxRtt                time.Duration
+	AvgRtt                time.Duration
+	StdDevRtt             time.Duration
+}
+
+// pingPayloadV1 decodes the current shape without recursing into
+// PingPayload.UnmarshalJSON.
+type pingPayloadV1 PingPayload
+
+func init() {
+	RegisterPayloadParser(TypePing, PingPayloadV0,
+		func(k map[string]json.RawMessage) bool {
+			_, ok := k["AvgRtt"]
+			return ok
+		},
+		func(raw []byte) (any, error) {
+			var p pingPayloadV0
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, err
+			}
+			return PingPayload{
+				PayloadVersion:        PingPayloadV1,
+				PacketsRecv:           p.PacketsRecv,
+				PacketsSent:           p.PacketsSent,
+				PacketsRecvDuplicates: p.PacketsRecvDuplicates,
+				PacketLoss:            p.PacketLoss,
+				Addr:                  p.Addr,
+				MinRtt:                p.MinRtt,
+				MaxRtt:                p.MaxRtt,
+				AvgRtt:                p.AvgRtt,
+				StdDevRtt:             p.StdDevRtt,
+			}, nil
+		})
+
+	RegisterPayloadParser(TypePing, PingPayloadV1,
+		func(k map[string]json.RawMessage) bool {
+			_, ok := k["avg_rtt"]
+			return ok
+		},
+		func(raw []byte) (any, error) {
+			var p pingPayloadV1
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, err
+			}
+			p.PayloadVersion = PingPayloadV1
+			return PingPayload(p), nil
+		})
+}
+
+// pingAvgRttNsSQL / pingStdDevNsSQL / pingLossSQL extract PING avg RTT
+// (ns), RTT stddev (ns) and loss (%) server-side for both the current and
+// legacy key names, for queries that aggregate in ClickHouse instead of
+// going through the registry.
+const (
+	pingAvgRttNsSQL = `if(JSONHas(payload_raw, 'avg_rtt'), JSONExtractFloat(payload_raw, 'avg_rtt'), JSONExtractFloat(payload_raw, 'AvgRtt'))`
+	pingStdDevNsSQL = `if(JSONHas(payload_raw, 'std_dev_rtt'), JSONExtractFloat(payload_raw, 'std_dev_rtt'), JSONExtractFloat(payload_raw, 'StdDevRtt'))`
+	pingLossSQL     = `if(JSONHas(payload_raw, 'packet_loss'), JSONExtractFloat(payload_raw, 'packet_loss'), JSONExtractFloat(payload_raw, 'PacketLoss'))`
+)
@@ -0,0 +1,82 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/alert"
+)
+
+// TestParsePingPayloadCurrent verifies the current snake_case format is
+// detected as v1 without an explicit version field.
+func TestParsePingPayloadCurrent(t *testing.T) {
+	raw := []byte(`{"avg_rtt":12000000,"std_dev_rtt":2000000,"packet_loss":1.5,"packets_sent":10,"packets_recv":9}`)
+	p, err := ParsePingPayload(raw)
+	if err != nil {
+		t.Fatalf("ParsePingPayload: %v", err)
+	}
+	if p.AvgRtt != 12*time.Millisecond || p.StdDevRtt != 2*time.Millisecond {
+		t.Errorf("rtt = %v / %v, want 12ms / 2ms", p.AvgRtt, p.StdDevRtt)
+	}
+	if p.PacketLoss != 1.5 || p.PacketsSent != 10 || p.PacketsRecv != 9 {
+		t.Errorf("unexpected counters: %+v", p)
+	}
+	if p.PayloadVersion != PingPayloadV1 {
+		t.Errorf("PayloadVersion = %d, want %d", p.PayloadVersion, PingPayloadV1)
+	}
+}
+
+// TestParsePingPayloadLegacy verifies PascalCase payloads from early agents
+// are converted rather than read as zeros.
+func TestParsePingPayloadLegacy(t *testing.T) {
+	raw := []byte(`{"AvgRtt":30000000,"MinRtt":25000000,"MaxRtt":40000000,"PacketLoss":5,"PacketsSent":20,"PacketsRecv":19,"Addr":"192.0.2.1"}`)
+	p, err := ParsePingPayload(raw)
+	if err != nil {
+		t.Fatalf("ParsePingPayload: %v", err)
+	}
+	if p.AvgRtt != 30*time.Millisecond || p.MaxRtt != 40*time.Millisecond {
+		t.Errorf("rtt = %v / %v, want 30ms / 40ms", p.AvgRtt, p.MaxRtt)
+	}
+	if p.PacketLoss != 5 || p.Addr != "192.0.2.1" {
+		t.Errorf("unexpected fields: %+v", p)
+	}
+
+	// Re-marshalled payloads carry the current version and shape.
+	out, _ := json.Marshal(p)
+	if v, ok := DetectPayloadVersion(TypePing, out); !ok || v != PingPayloadV1 {
+		t.Errorf("re-marshalled version = %d (ok=%v), want %d", v, ok, PingPayloadV1)
+	}
+}
+
+// TestAlertBaselineParsesLegacyPing verifies alert baselines read PING
+// payloads through the versioned parser.
+func TestAlertBaselineParsesLegacyPing(t *testing.T) {
+	for _, raw := range []string{
+		`{"avg_rtt":30000000,"packet_loss":5,"packets_sent":20,"packets_recv":19}`,
+		`{"AvgRtt":30000000,"PacketLoss":5,"PacketsSent":20,"PacketsRecv":19}`,
+	} {
+		avg, loss, err := alert.ParsePingPayload([]byte(raw))
+		if err != nil || avg != 30*time.Millisecond || loss != 5 {
+			t.Errorf("%s = %v, %v, %v", raw, avg, loss, err)
+		}
+	}
+}
+
+// TestParsePingPayloadUnknownVersion verifies an unregistered version is
+// rejected, both directly and through PingPayload.UnmarshalJSON at ingest.
+func TestParsePingPayloadUnknownVersion(t *testing.T) {
+	raw := []byte(`{"payload_version":99,"avg_rtt":1000000}`)
+	if _, err := ParsePingPayload(raw); !errors.Is(err, ErrUnknownPayloadVersion) {
+		t.Fatalf("err = %v, want ErrUnknownPayloadVersion", err)
+	}
+	var p PingPayload
+	if err := json.Unmarshal(raw, &p); !errors.Is(err, ErrUnknownPayloadVersion) {
+		t.Fatalf("UnmarshalJSON err = %v, want ErrUnknownPayloadVersion", err)
+	}
+
+	if _, err := ParsePingPayload([]byte(`{"rtt":5}`)); !errors.Is(err, ErrUnknownPayloadVersion) {
+		t.Errorf("unrecognized shape err = %v, want ErrUnknownPayloadVersion", err)
+	}
+}
@@ -5,10 +5,18 @@ import (
 	"database/sql"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/alert"
 )
 
+func init() {
+	alert.ParsePingPayload = func(raw []byte) (time.Duration, float64, error) {
+		p, err := ParsePingPayload(raw)
+		return p.AvgRtt, p.PacketLoss, err
+	}
+}
+
 func initPing(db *sql.DB, pg *gorm.DB) {
 	Register(NewHandler[PingPayload](
 		TypePing,
@@ -17,19 +25,22 @@ func initPing(db *sql.DB, pg *gorm.DB) {
 		},
 		func(ctx context.Context, data ProbeData, p PingPayload) error {
 			if err := SaveRecordWithAlertEval(ctx, db, pg, data, string(TypePing), p); err != nil {
-				log.WithError(err).Error("save ping record (CH)")
+				ingestEntry(data).WithError(err).Error("save ping record (CH)")
 				return err
 			}
 
 			// Store to DB / compute / alert as needed:
-			log.Printf("[ping] pid=%d ploss=%v rtt=%d",
+			ingestEntry(data).Infof("[ping] pid=%d ploss=%v rtt=%d",
 				data.ProbeID, p.PacketLoss, p.AvgRtt)
 			return nil
 		},
 	))
 }
 
+// PingPayload is the canonical PING result. Incoming and stored payloads
+// of older formats are converted to it by ParsePingPayload.
 type PingPayload struct {
+	PayloadVersion        int           `json:"payload_version,omitempty" bson:"payload_version,omitempty"`
 	StartTimestamp        time.Time     `json:"start_timestamp" bson:"start_timestamp"`
 	StopTimestamp         time.Time     `json:"stop_timestamp" bson:"stop_timestamp"`
 	PacketsRecv           int           `json:"packets_recv" bson:"packets_recv"`
@@ -41,4 +52,17 @@ type PingPayload struct {
 	MaxRtt                time.Duration `json:"max_rtt" bson:"max_rtt"`
 	AvgRtt                time.Duration `json:"avg_rtt" bson:"avg_rtt"`
 	StdDevRtt             time.Duration `json:"std_dev_rtt" bson:"std_dev_rtt"`
+	MaxConsecutiveLoss    uint64        `json:"max_consecutive_loss,omitempty" bson:"max_consecutive_loss,omitempty"`
+	TotalBursts           uint64        `json:"total_bursts,omitempty" bson:"total_bursts,omitempty"`
+}
+
+// UnmarshalJSON routes through the payload parser registry so legacy
+// formats are converted and unknown versions are rejected, not zeroed.
+func (p *PingPayload) UnmarshalJSON(b []byte) error {
+	v, err := ParsePingPayload(b)
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
 }
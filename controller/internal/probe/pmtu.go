@@ -0,0 +1,225 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Path-MTU Discovery ──────────────────────────────────────────────────────
+//
+// PMTU probes send don't-fragment packets of increasing size to a target
+// and report the largest one that got through. Two failure shapes matter:
+//
+//   - Low PMTU: the path MTU is below what the workspace expects (tunnels,
+//     PPPoE, stacked VPN overhead). The floor comes from the probe's
+//     metadata {"pmtu": {"floor": 1400}}, falling back to PMTU_FLOOR_DEFAULT
+//     and then defaultPMTUFloor.
+//   - Blackhole: large packets vanish without an ICMP "fragmentation
+//     needed" / "packet too big" reply, so endpoints never learn to shrink
+//     and connections hang after the handshake.
+//
+// The controller stamps the floor and both verdicts onto the stored
+// payload, so alerts and analysis read them without re-deriving.
+
+const (
+	defaultPMTUFloor = 1400
+	// pmtuEthernetMTU is the MTU a clean path is expected to carry.
+	pmtuEthernetMTU = 1500
+)
+
+// PMTUStep is one size the agent tried.
+type PMTUStep struct {
+	Size       int  `json:"size"` // IP packet size in bytes
+	OK         bool `json:"ok"`
+	FragNeeded bool `json:"frag_needed,omitempty"` // ICMP frag-needed / PTB received
+}
+
+// PMTUPayload is the result of one path-MTU discovery run.
+type PMTUPayload struct {
+	PathMTU        int        `json:"path_mtu"`                   // largest unfragmented IP packet (bytes); 0 = nothing got through
+	MaxPayload     int        `json:"max_payload"`                // largest ICMP/UDP payload at PathMTU
+	Protocol       string     `json:"protocol,omitempty"`         // icmp | udp
+	FragNeededMTU  int        `json:"frag_needed_mtu,omitempty"`  // next-hop MTU from the frag-needed reply
+	FragNeededFrom string     `json:"frag_needed_from,omitempty"` // router that sent it
+	Steps          []PMTUStep `json:"steps,omitempty"`
+	Blackhole      bool       `json:"blackhole"`
+	FloorBytes     int        `json:"floor_bytes,omitempty"` // stamped by the controller
+	BelowFloor     bool       `json:"below_floor"`           // stamped by the controller
+	Error          string     `json:"error,omitempty"`
+}
+
+func initPMTU(ch *sql.DB, pg *gorm.DB) {
+	Register(NewHandler[PMTUPayload](
+		TypePMTU,
+		func(p PMTUPayload) error {
+			if p.PathMTU < 0 || p.PathMTU > math.MaxUint16 {
+				return fmt.Errorf("path_mtu %d out of range", p.PathMTU)
+			}
+			return nil
+		},
+		func(ctx context.Context, data ProbeData, p PMTUPayload) error {
+			p.FloorBytes = pmtuFloorForProbe(ctx, pg, data.ProbeID)
+			classifyPMTU(&p)
+
+			if err := SaveRecordWithAlertEval(ctx, ch, pg, data, string(TypePMTU), p); err != nil {
+				ingestEntry(data).WithError(err).Error("save PMTU record (CH)")
+				return err
+			}
+
+			ingestEntry(data).Infof("[pmtu] pid=%d target=%s pmtu=%d floor=%d below_floor=%v blackhole=%v",
+				data.ProbeID, data.Target, p.PathMTU, p.FloorBytes, p.BelowFloor, p.Blackhole)
+			return nil
+		},
+	))
+}
+
+// classifyPMTU sets BelowFloor and Blackhole. An agent-reported blackhole
+// is kept; otherwise a size that failed silently (no frag-needed) above
+// a sub-Ethernet PMTU, with no frag-needed seen at all, is a blackhole.
+func classifyPMTU(p *PMTUPayload) {
+	if p.Error == "" && p.FloorBytes > 0 {
+		p.BelowFloor = p.PathMTU < p.FloorBytes
+	}
+	if p.Blackhole || p.FragNeededMTU > 0 || p.PathMTU >= pmtuEthernetMTU {
+		return
+	}
+	for _, s := range p.Steps {
+		if s.FragNeeded {
+			return
+		}
+	}
+	for _, s := range p.Steps {
+		if !s.OK && s.Size > p.PathMTU && s.Size <= pmtuEthernetMTU {
+			p.Blackhole = true
+			return
+		}
+	}
+}
+
+// pmtuFloorForProbe reads metadata.pmtu.floor for a probe.
+func pmtuFloorForProbe(ctx context.Context, pg *gorm.DB, probeID uint) int {
+	floor := defaultPMTUFloor
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("PMTU_FLOOR_DEFAULT"))); err == nil && v > 0 {
+		floor = v
+	}
+	if pg == nil || probeID == 0 {
+		return floor
+	}
+	var p Probe
+	if err := pg.WithContext(ctx).Select("id", "metadata").First(&p, probeID).Error; err != nil || len(p.Metadata) == 0 {
+		return floor
+	}
+	var md struct {
+		PMTU struct {
+			Floor int `json:"floor"`
+		} `json:"pmtu"`
+	}
+	if err := json.Unmarshal(p.Metadata, &md); err == nil && md.PMTU.Floor > 0 {
+		return md.PMTU.Floor
+	}
+	return floor
+}
+
+// detectPMTUIncidents raises an incident for each agent→target whose
+// latest PMTU result is a blackhole or below its floor.
+func detectPMTUIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time, agentByID map[uint]agentInfo) []DetectedIncident {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT agent_id, target, argMax(payload_raw, created_at)
+FROM probe_data
+WHERE type = 'PMTU'
+  AND agent_id IN (%s)
+  AND created_at >= %s%s
+GROUP BY agent_id, target
+`, strings.Join(ids, ", "), chQuoteTime(from), asOfBound(ctx))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var incidents []DetectedIncident
+	for rows.Next() {
+		var agentID uint64
+		var target, raw string
+		if err := rows.Scan(&agentID, &target, &raw); err != nil {
+			continue
+		}
+		var p PMTUPayload
+		if err := json.Unmarshal([]byte(raw), &p); err != nil {
+			continue
+		}
+		if inc := pmtuIncident(uint(agentID), target, p, agentByID); inc != nil {
+			incidents = append(incidents, *inc)
+		}
+	}
+	return incidents
+}
+
+// pmtuIncident builds the incident for one latest result, or nil.
+func pmtuIncident(agentID uint, target string, p PMTUPayload, agentByID map[uint]agentInfo) *DetectedIncident {
+	if !p.Blackhole && !p.BelowFloor {
+		return nil
+	}
+	agentName := fmt.Sprintf("%d", agentID)
+	if a, ok := agentByID[agentID]; ok {
+		agentName = a.Name
+	}
+	key := sanitizeKey(fmt.Sprintf("%d_%s", agentID, target))
+	evidence := []string{fmt.Sprintf("Path MTU %d bytes (floor %d)", p.PathMTU, p.FloorBytes)}
+	if p.FragNeededMTU > 0 {
+		evidence = append(evidence, fmt.Sprintf("Fragmentation needed: next-hop MTU %d from %s", p.FragNeededMTU, p.FragNeededFrom))
+	}
+
+	if p.Blackhole {
+		evidence = append(evidence, "Larger don't-fragment packets were dropped without an ICMP fragmentation-needed reply")
+		return &DetectedIncident{
+			ID:              "pmtu_blackhole_" + key,
+			Title:           fmt.Sprintf("MTU blackhole from %s to %s", agentName, target),
+			Severity:        "critical",
+			Scope:           "target-specific",
+			SuggestedCause:  "A device on the path drops oversized packets and filters the ICMP that would tell senders to shrink them — TCP sessions stall after the handshake",
+			AffectedAgents:  []string{agentName},
+			AffectedTargets: []string{target},
+			Evidence:        evidence,
+			Recommendations: []string{
+				"Allow ICMP type 3 code 4 (IPv4) / ICMPv6 Packet Too Big through firewalls on the path",
+				"Clamp TCP MSS on the tunnel or edge router to the measured path MTU",
+			},
+			Confidence:      0.85,
+			MatchedCriteria: "pmtu_blackhole",
+		}
+	}
+	return &DetectedIncident{
+		ID:              "pmtu_low_" + key,
+		Title:           fmt.Sprintf("Path MTU %d below %d from %s to %s", p.PathMTU, p.FloorBytes, agentName, target),
+		Severity:        "warning",
+		Scope:           "target-specific",
+		SuggestedCause:  "Encapsulation overhead (VPN, GRE, PPPoE) or a misconfigured interface MTU is shrinking packets on this path",
+		AffectedAgents:  []string{agentName},
+		AffectedTargets: []string{target},
+		Evidence:        evidence,
+		Recommendations: []string{
+			"Check tunnel and interface MTU settings along the path",
+			"Clamp TCP MSS so applications do not rely on fragmentation",
+		},
+		Confidence:      0.8,
+		MatchedCriteria: fmt.Sprintf("path_mtu < %d", p.FloorBytes),
+	}
+}
@@ -0,0 +1,57 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+// TestClassifyPMTU verifies floor and blackhole verdicts: a silent drop
+// above the discovered MTU is a blackhole, a frag-needed reply is not.
+func TestClassifyPMTU(t *testing.T) {
+	silent := PMTUPayload{PathMTU: 1420, FloorBytes: 1400, Steps: []PMTUStep{
+		{Size: 1400, OK: true}, {Size: 1420, OK: true}, {Size: 1460, OK: false},
+	}}
+	classifyPMTU(&silent)
+	if !silent.Blackhole || silent.BelowFloor {
+		t.Errorf("silent drop: blackhole=%v below_floor=%v, want true/false", silent.Blackhole, silent.BelowFloor)
+	}
+
+	signalled := PMTUPayload{PathMTU: 1360, FloorBytes: 1400, FragNeededMTU: 1360, Steps: []PMTUStep{
+		{Size: 1360, OK: true}, {Size: 1400, OK: false, FragNeeded: true},
+	}}
+	classifyPMTU(&signalled)
+	if signalled.Blackhole || !signalled.BelowFloor {
+		t.Errorf("frag-needed: blackhole=%v below_floor=%v, want false/true", signalled.Blackhole, signalled.BelowFloor)
+	}
+
+	clean := PMTUPayload{PathMTU: 1500, FloorBytes: 1400, Steps: []PMTUStep{{Size: 1500, OK: true}, {Size: 1600, OK: false}}}
+	classifyPMTU(&clean)
+	if clean.Blackhole || clean.BelowFloor {
+		t.Errorf("clean path flagged: %+v", clean)
+	}
+	if pmtuIncident(1, "10.0.0.1", clean, nil) != nil {
+		t.Error("clean path produced an incident")
+	}
+	if inc := pmtuIncident(1, "10.0.0.1", silent, nil); inc == nil || inc.Severity != "critical" {
+		t.Errorf("blackhole incident = %+v", inc)
+	}
+}
+
+// TestPMTUFloorForProbe verifies the per-probe metadata floor overrides
+// the default.
+func TestPMTUFloorForProbe(t *testing.T) {
+	db := newTestDB(t)
+	p := Probe{WorkspaceID: 1, AgentID: 1, Type: TypePMTU, Metadata: datatypes.JSON(`{"pmtu":{"floor":1280}}`)}
+	if err := db.Create(&p).Error; err != nil {
+		t.Fatalf("create probe: %v", err)
+	}
+	ctx := context.Background()
+	if got := pmtuFloorForProbe(ctx, db, p.ID); got != 1280 {
+		t.Errorf("floor = %d, want 1280", got)
+	}
+	if got := pmtuFloorForProbe(ctx, db, p.ID+100); got != defaultPMTUFloor {
+		t.Errorf("missing probe floor = %d, want %d", got, defaultPMTUFloor)
+	}
+}
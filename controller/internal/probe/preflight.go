@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ── Pre-flight checks ──────────────────────────────────────────────────────
+//
+// A probe with a typo'd hostname is accepted, handed to the agent, and
+// then reports nothing for hours. Pre-flight catches the obvious cases at
+// create time: it resolves each target from the controller and tries a
+// TCP connection to it. A refused connection still counts as reachable —
+// the host answered. ICMP needs privileges the controller usually doesn't
+// have, so PING and MTR targets are checked over TCP 443 and 80 instead.
+//
+// The controller is not on the agent's network: internal names may not
+// resolve and private addresses may not route from here. Findings are
+// therefore warnings, never errors, and a target with any internal
+// address skips the reachability check. The dial goes to the addresses
+// that were vetted, never to the name, so a second lookup can't swap in
+// an internal address.
+
+// PreflightStatus summarizes one target's checks.
+type PreflightStatus string
+
+const (
+	PreflightOK      PreflightStatus = "ok"
+	PreflightWarning PreflightStatus = "warning"
+	PreflightSkipped PreflightStatus = "skipped"
+)
+
+const (
+	preflightTimeout    = 3 * time.Second
+	preflightMaxTargets = 20
+)
+
+// PreflightCheck is the result for one target.
+type PreflightCheck struct {
+	Target      string          `json:"target"`
+	Host        string          `json:"host,omitempty"`
+	Resolved    []string        `json:"resolved,omitempty"`
+	Reachable   *bool           `json:"reachable,omitempty"`
+	ReachMethod string          `json:"reach_method,omitempty"` // e.g. "tcp/443"
+	RTTMs       float64         `json:"rtt_ms,omitempty"`
+	Status      PreflightStatus `json:"status"`
+	Warnings    []string        `json:"warnings,omitempty"`
+}
+
+// PreflightReport is the result for a probe's targets.
+type PreflightReport struct {
+	Type         Type             `json:"type"`
+	Checks       []PreflightCheck `json:"checks"`
+	WarningCount int              `json:"warning_count"`
+}
+
+// Lookup and dial hooks, replaced in tests.
+var (
+	preflightLookup = net.DefaultResolver.LookupHost
+	preflightDial   = (&net.Dialer{}).DialContext
+)
+
+// Preflight checks the literal targets of a probe about to be created.
+// Agent targets and types without a network target are skipped.
+func Preflight(ctx context.Context, typ Type, targets []string) PreflightReport {
+	rep := PreflightReport{Type: typ, Checks: make([]PreflightCheck, 0, len(targets))}
+	if len(targets) > preflightMaxTargets {
+		targets = targets[:preflightMaxTargets]
+	}
+	checks := make([]PreflightCheck, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t string) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+			defer cancel()
+			checks[i] = preflightTarget(cctx, typ, t)
+		}(i, t)
+	}
+	wg.Wait()
+	for _, c := range checks {
+		if c.Status == PreflightWarning {
+			rep.WarningCount++
+		}
+		rep.Checks = append(rep.Checks, c)
+	}
+	return rep
+}
+
+// preflightAddress returns the host and the TCP ports worth trying for a
+// target, or ok=false when the type has nothing to check from here.
+func preflightAddress(typ Type, target string) (host string, ports []string, ok bool) {
+	switch typ {
+	case TypePing, TypeMTR:
+		host = target
+		if h, _, err := net.SplitHostPort(target); err == nil {
+			host = h
+		}
+		return strings.Trim(host, "[]"), []string{"443", "80"}, true
+	case TypeHTTP:
+		u, err := url.Parse(normalizeProbeTarget(target, TypeHTTP))
+		if err != nil || u.Hostname() == "" {
+			return "", nil, false
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+			if u.Scheme == "http" {
+				port = "80"
+			}
+		}
+		return u.Hostname(), []string{port}, true
+	case TypeTLS:
+		t := normalizeProbeTarget(target, TypeTLS)
+		if h, p, err := net.SplitHostPort(t); err == nil {
+			return h, []string{p}, true
+		}
+		return t, []string{"443"}, true
+	case TypeTrafficSim:
+		// UDP: resolution only.
+		addrs, err := ExpandTrafficSimTarget(target)
+		if err != nil || len(addrs) == 0 {
+			return "", nil, false
+		}
+		h, _, err := net.SplitHostPort(addrs[0])
+		if err != nil {
+			h = addrs[0]
+		}
+		return h, nil, true
+	}
+	return "", nil, false
+}
+
+func preflightTarget(ctx context.Context, typ Type, target string) PreflightCheck {
+	c := PreflightCheck{Target: target, Status: PreflightSkipped}
+	if !validateTargetForType(target, typ) {
+		c.Status = PreflightWarning
+		c.Warnings = append(c.Warnings, "target is not a valid host, address or URL")
+		return c
+	}
+	host, ports, ok := preflightAddress(typ, target)
+	if !ok || host == "" {
+		return c
+	}
+	c.Host = host
+	c.Status = PreflightOK
+
+	var addrs []netip.Addr
+	if a, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{a}
+	} else {
+		resolved, err := preflightLookup(ctx, host)
+		if err != nil || len(resolved) == 0 {
+			c.Status = PreflightWarning
+			c.Warnings = append(c.Warnings, fmt.Sprintf("%s does not resolve from the controller (%s); check for a typo unless it is an internal name", host, lookupReason(err)))
+			return c
+		}
+		c.Resolved = resolved
+		for _, r := range resolved {
+			if a, err := netip.ParseAddr(r); err == nil {
+				addrs = append(addrs, a)
+			}
+		}
+	}
+
+	if len(ports) == 0 {
+		return c
+	}
+	if len(addrs) == 0 {
+		return c
+	}
+	if anyInternal(addrs) {
+		c.Warnings = append(c.Warnings, "private address; reachability is only checked by the agent")
+		return c
+	}
+
+	for _, port := range ports {
+		for _, a := range addrs {
+			start := time.Now()
+			conn, err := preflightDial(ctx, "tcp", net.JoinHostPort(a.String(), port))
+			if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+				if conn != nil {
+					conn.Close()
+				}
+				reachable := true
+				c.Reachable = &reachable
+				c.ReachMethod = "tcp/" + port
+				c.RTTMs = float64(time.Since(start).Microseconds()) / 1000
+				return c
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	reachable := false
+	c.Reachable = &reachable
+	c.Status = PreflightWarning
+	c.Warnings = append(c.Warnings, fmt.Sprintf("no TCP response on port %s from the controller; the target may be down or filtered", strings.Join(ports, "/")))
+	return c
+}
+
+func lookupReason(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return "no such host"
+		}
+		if dnsErr.IsTimeout {
+			return "lookup timed out"
+		}
+	}
+	if err == nil {
+		return "no addresses"
+	}
+	return err.Error()
+}
+
+// cgnatPrefix is the shared address space of RFC 6598.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// anyInternal reports whether any address is private, loopback,
+// link-local, unspecified, multicast or carrier-grade NAT.
+func anyInternal(addrs []netip.Addr) bool {
+	for _, a := range addrs {
+		a = a.Unmap()
+		if !a.IsGlobalUnicast() || a.IsPrivate() || cgnatPrefix.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
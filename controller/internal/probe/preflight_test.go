@@ -0,0 +1,91 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// TestPreflight verifies resolution failures and unreachable targets are
+// warnings, refused connections count as reachable, targets with any
+// internal address skip the reachability check, and only vetted addresses
+// are dialed.
+func TestPreflight(t *testing.T) {
+	lookup, dial := preflightLookup, preflightDial
+	defer func() { preflightLookup, preflightDial = lookup, dial }()
+
+	preflightLookup = func(_ context.Context, host string) ([]string, error) {
+		switch host {
+		case "example.com":
+			return []string{"93.184.216.34"}, nil
+		case "nas.lan":
+			return []string{"192.168.1.20"}, nil
+		case "mixed.example":
+			return []string{"93.184.216.35", "10.0.0.1"}, nil
+		case "cgnat.example":
+			return []string{"100.64.1.1"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var (
+		mu     sync.Mutex
+		dialed []string
+	)
+	preflightDial = func(_ context.Context, _, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		switch addr {
+		case "93.184.216.34:443":
+			return nil, &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+		case "93.184.216.34:8443":
+			c, s := net.Pipe()
+			s.Close()
+			return c, nil
+		}
+		return nil, &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}
+	}
+
+	rep := Preflight(context.Background(), TypePing, []string{"example.com", "exmaple.cm", "nas.lan", "203.0.113.9", "mixed.example", "cgnat.example", "0.0.0.0"})
+	if rep.WarningCount != 2 {
+		t.Fatalf("warnings = %d, want 2: %+v", rep.WarningCount, rep.Checks)
+	}
+	want := []PreflightStatus{PreflightOK, PreflightWarning, PreflightOK, PreflightWarning, PreflightOK, PreflightOK, PreflightOK}
+	for i, c := range rep.Checks {
+		if c.Status != want[i] {
+			t.Errorf("%s status = %s, want %s (%v)", c.Target, c.Status, want[i], c.Warnings)
+		}
+	}
+	if c := rep.Checks[0]; c.Reachable == nil || !*c.Reachable || c.ReachMethod != "tcp/443" {
+		t.Errorf("refused connection should be reachable: %+v", c)
+	}
+	for _, i := range []int{2, 4, 5, 6} {
+		if c := rep.Checks[i]; c.Reachable != nil || len(c.Warnings) != 1 {
+			t.Errorf("internal target should skip reachability: %+v", c)
+		}
+	}
+
+	rep = Preflight(context.Background(), TypeHTTP, []string{"https://example.com:8443/health"})
+	if c := rep.Checks[0]; c.Status != PreflightOK || c.ReachMethod != "tcp/8443" {
+		t.Errorf("http target = %+v", c)
+	}
+
+	for _, addr := range dialed {
+		if _, err := netip.ParseAddrPort(addr); err != nil {
+			t.Errorf("dialed %q; only resolved addresses may be dialed", addr)
+		}
+		if strings.HasPrefix(addr, "10.") || strings.HasPrefix(addr, "100.64.") || strings.HasPrefix(addr, "0.") {
+			t.Errorf("dialed internal address %s", addr)
+		}
+	}
+
+	rep = Preflight(context.Background(), TypeAgent, []string{"example.com"})
+	if rep.Checks[0].Status != PreflightSkipped {
+		t.Errorf("AGENT target should be skipped: %+v", rep.Checks[0])
+	}
+}
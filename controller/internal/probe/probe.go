@@ -9,6 +9,7 @@ import (
 	"net"
 	"netwatcher-controller/internal/agent"
 	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/extid"
 	"netwatcher-controller/internal/speedtest"
 	"strconv"
 	"strings"
@@ -39,6 +40,7 @@ const (
 	TypeHTTP       Type = "HTTP"
 	TypeTLS        Type = "TLS"
 	TypeSNMP       Type = "SNMP"
+	TypePMTU       Type = "PMTU"
 )
 
 var (
@@ -48,13 +50,14 @@ var (
 	ErrTargetFormat = errors.New("invalid target format")
 	ErrDuplicate    = errors.New("duplicate probe already exists")
 	ErrSelfTarget   = errors.New("probe cannot target itself")
+	ErrUnsupported  = errors.New("agent does not support probe type")
 )
 
 func (t Type) Valid() bool {
 	switch t {
 	case TypeRPerf, TypeMTR, TypePing, TypeNetInfo, TypeSysInfo,
 		TypeSpeedtest, TypeSpeedtestServer, TypeAgent, TypeTrafficSim, TypeDNS,
-		TypeHTTP, TypeTLS, TypeSNMP:
+		TypeHTTP, TypeTLS, TypeSNMP, TypePMTU:
 		return true
 	default:
 		return false
@@ -71,6 +74,7 @@ type Probe struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	WorkspaceID   uint           `gorm:"index" json:"workspace_id"`
+	ExternalID    string         `gorm:"size:64" json:"external_id"` // stable across environments; see internal/extid
 	AgentID       uint           `gorm:"index" json:"agent_id"`
 	Type          Type           `gorm:"type:VARCHAR(64);index" json:"type"`
 	Enabled       bool           `gorm:"default:true;index" json:"enabled"`
@@ -80,6 +84,7 @@ type Probe struct {
 	DurationSec   int            `json:"duration_sec"`
 	Server        bool           `json:"server"`
 	BindInterface string         `gorm:"size:128" json:"bind_interface,omitempty"` // Interface name to bind to (empty = OS default)
+	DSCP          int            `gorm:"default:0" json:"dscp,omitempty"`            // DSCP codepoint 0-63 for PING/TRAFFICSIM (0 = best effort)
 	Labels        datatypes.JSON `gorm:"type:jsonb" json:"labels"`
 	Metadata      datatypes.JSON `gorm:"type:jsonb" json:"metadata"`
 
@@ -88,6 +93,24 @@ type Probe struct {
 
 func (Probe) TableName() string { return "probes" }
 
+// BeforeCreate assigns a ULID external ID when none was chosen.
+func (p *Probe) BeforeCreate(tx *gorm.DB) error {
+	if p.ExternalID == "" {
+		p.ExternalID = extid.New()
+	}
+	return nil
+}
+
+// ResolveExternalID returns the ID of the workspace's probe with the given
+// external ID.
+func ResolveExternalID(ctx context.Context, db *gorm.DB, workspaceID uint, ref string) (uint, error) {
+	id, err := extid.Resolve(ctx, db, "probes", workspaceID, ref)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
 // Target can be a literal host[:port], or reference another agent via AgentID.
 type Target struct {
 	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -108,31 +131,37 @@ func (Target) TableName() string { return "probe_targets" }
 // -------------------- DTOs --------------------
 
 type CreateInput struct {
-	WorkspaceID   uint           `gorm:"index" json:"workspace_id"`
-	AgentID       uint           `gorm:"index" json:"agent_id"`
-	Type          Type           `gorm:"type:VARCHAR(64);index" json:"type"`
-	Enabled       bool           `gorm:"default:true;index" json:"enabled,omitempty"`
-	IntervalSec   int            `gorm:"default:60" json:"interval_sec,omitempty"`
-	TimeoutSec    int            `gorm:"default:10" json:"timeout_sec,omitempty"`
-	Count         int            `json:"count,omitempty"`
-	DurationSec   int            `json:"duration_sec,omitempty"`
-	Server        bool           `json:"server,omitempty"`
-	BindInterface string         `json:"bind_interface,omitempty"` // Interface name to bind to
-	Targets       []string       `json:"targets,omitempty"`
-	AgentTargets  []uint         `json:"agent_targets,omitempty"`
-	Labels        datatypes.JSON `gorm:"type:jsonb" json:"labels,omitempty"`
-	Metadata      datatypes.JSON `gorm:"type:jsonb" json:"metadata,omitempty"`
-	Bidirectional bool           `json:"bidirectional,omitempty"` // Create matching probe on target agent(s)
+	WorkspaceID    uint           `gorm:"index" json:"workspace_id"`
+	ExternalID     string         `json:"external_id,omitempty"` // Optional slug; a ULID is generated when empty
+	AgentID        uint           `gorm:"index" json:"agent_id"`
+	Type           Type           `gorm:"type:VARCHAR(64);index" json:"type"`
+	Enabled        bool           `gorm:"default:true;index" json:"enabled,omitempty"`
+	IntervalSec    int            `gorm:"default:60" json:"interval_sec,omitempty"`
+	TimeoutSec     int            `gorm:"default:10" json:"timeout_sec,omitempty"`
+	Count          int            `json:"count,omitempty"`
+	DurationSec    int            `json:"duration_sec,omitempty"`
+	Server         bool           `json:"server,omitempty"`
+	BindInterface  string         `json:"bind_interface,omitempty"` // Interface name to bind to
+	DSCP           int            `json:"dscp,omitempty"`           // DSCP codepoint (PING/TRAFFICSIM only)
+	Targets        []string       `json:"targets,omitempty"`
+	AgentTargets   []uint         `json:"agent_targets,omitempty"`
+	CatalogTargets []uint         `json:"catalog_targets,omitempty"` // Target catalog entry IDs, added to Targets
+	Labels         datatypes.JSON `gorm:"type:jsonb" json:"labels,omitempty"`
+	Metadata       datatypes.JSON `gorm:"type:jsonb" json:"metadata,omitempty"`
+	Bidirectional  bool           `json:"bidirectional,omitempty"` // Create matching probe on target agent(s)
+	AllowDuplicate bool           `json:"allow_duplicate,omitempty"` // Skip the duplicate check (see DuplicateProbeError)
 }
 
 type UpdateInput struct {
 	ID            uint
+	ExternalID    *string // Rename the external ID (nil = don't change)
 	Enabled       *bool
 	IntervalSec   *int
 	TimeoutSec    *int
 	Count         *int    // Update packet count (nil = don't change)
 	DurationSec   *int    // Update duration (nil = don't change)
 	BindInterface *string // Update interface binding (nil = don't change)
+	DSCP          *int    // Update DSCP marking (nil = don't change)
 	Labels        *datatypes.JSON
 	Metadata      *datatypes.JSON
 
@@ -232,7 +261,7 @@ func normalizeProbeTarget(t string, probeType Type) string {
 }
 
 // checkDuplicateProbe checks if a probe with the same agent, type, and targets already exists.
-// Returns ErrDuplicate if a matching probe is found.
+// Returns a *DuplicateProbeError (matching ErrDuplicate) if a matching probe is found.
 func checkDuplicateProbe(ctx context.Context, db *gorm.DB, in CreateInput) error {
 	// Find existing probes with the same agent and type
 	var existing []Probe
@@ -247,7 +276,7 @@ func checkDuplicateProbe(ctx context.Context, db *gorm.DB, in CreateInput) error
 	// Build sets of incoming targets for comparison
 	incomingLiteralTargets := make(map[string]bool)
 	for _, t := range in.Targets {
-		incomingLiteralTargets[t] = true
+		incomingLiteralTargets[duplicateTargetKey(t, in.Type)] = true
 	}
 	incomingAgentTargets := make(map[uint]bool)
 	for _, aid := range in.AgentTargets {
@@ -274,7 +303,7 @@ func checkDuplicateProbe(ctx context.Context, db *gorm.DB, in CreateInput) error
 			if t.AgentID != nil {
 				existingAgentTargets[*t.AgentID] = true
 			} else if t.Target != "" {
-				existingLiteralTargets[t.Target] = true
+				existingLiteralTargets[duplicateTargetKey(t.Target, p.Type)] = true
 			}
 		}
 
@@ -316,8 +345,7 @@ func checkDuplicateProbe(ctx context.Context, db *gorm.DB, in CreateInput) error
 
 			log.Warnf("Duplicate probe detected: existing probe %d (agent=%d, type=%s) has overlapping targets",
 				p.ID, p.AgentID, p.Type)
-			return fmt.Errorf("%w: probe with same type and target already exists on agent %d (probe ID: %d)",
-				ErrDuplicate, in.AgentID, p.ID)
+			return &DuplicateProbeError{ExistingProbeID: p.ID, AgentID: p.AgentID, Type: p.Type, Targets: probeTargetStrings(p)}
 		}
 	}
 
@@ -329,9 +357,14 @@ func checkDuplicateProbe(ctx context.Context, db *gorm.DB, in CreateInput) error
 // Create creates a probe and its targets in a single transaction.
 // When Bidirectional is true and AgentTargets are specified, it also creates
 // matching reverse probes on each target agent pointing back to the source.
+// in.WorkspaceID must come from the route, not the request body: catalog
+// targets are looked up against it.
 func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*Probe, error) {
-	if in.WorkspaceID == 0 || in.AgentID == 0 || in.Type == "" {
-		return nil, fmt.Errorf("%w: workspaceId/agentId/type required", ErrBadInput)
+	if err := ValidateCreateInput(in); err != nil {
+		return nil, err
+	}
+	if err := ExpandCatalogTargets(ctx, db, in.WorkspaceID, &in); err != nil {
+		return nil, err
 	}
 	if len(in.Targets) == 0 && len(in.AgentTargets) == 0 {
 		return nil, ErrNoTargets
@@ -351,14 +384,39 @@ func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*Probe, error) {
 		return nil, err
 	}
 
-	// Check for duplicate probe (same agent, type, and targets)
-	if err := checkDuplicateProbe(ctx, db, in); err != nil {
+	// The owning agent must be able to run this probe type on its platform.
+	if err := validateAgentCapabilities(ctx, db, in.AgentID, in.Type); err != nil {
+		return nil, err
+	}
+
+	if err := validateDSCP(in.Type, in.DSCP); err != nil {
 		return nil, err
 	}
 
+	if err := validateProbeMetadata(in.Metadata); err != nil {
+		return nil, err
+	}
+
+	// Check for duplicate probe (same agent, type, and targets) unless the
+	// caller chose to create it anyway.
+	if !in.AllowDuplicate {
+		if err := checkDuplicateProbe(ctx, db, in); err != nil {
+			return nil, err
+		}
+	}
+
+	if in.ExternalID != "" {
+		id, err := extid.Claim(ctx, db, "probes", in.WorkspaceID, 0, in.ExternalID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadInput, err)
+		}
+		in.ExternalID = id
+	}
+
 	now := time.Now()
 	p := &Probe{
 		WorkspaceID:   in.WorkspaceID,
+		ExternalID:    in.ExternalID,
 		AgentID:       in.AgentID,
 		Type:          in.Type,
 		Enabled:       boolOr(&in.Enabled, true),
@@ -368,6 +426,7 @@ func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*Probe, error) {
 		DurationSec:   in.DurationSec,
 		Server:        in.Server, // TRAFFICSIM server mode
 		BindInterface: in.BindInterface,
+		DSCP:          in.DSCP,
 		Labels:        coalesceJSON(in.Labels),
 		Metadata:      coalesceJSON(in.Metadata),
 		CreatedAt:     now,
@@ -391,7 +450,7 @@ func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*Probe, error) {
 		// Build targets
 		var rows []Target
 		for _, t := range in.Targets {
-			if !validateLiteralTarget(t) {
+			if !validateTargetForType(t, p.Type) {
 				return fmt.Errorf("%w: %q", ErrTargetFormat, t)
 			}
 			// Normalize target based on probe type
@@ -585,7 +644,10 @@ func ListForAgent(ctx context.Context, db *gorm.DB, ch *sql.DB, agentID uint) ([
 				}
 			}
 
-			out = append(out, *p)
+			applyDeliveredDSCP(p)
+
+			// TRAFFICSIM port sets become one target per port
+			out = append(out, expandTrafficSimPorts(*p))
 		}
 	}
 
@@ -952,6 +1014,59 @@ func validateAgentProbeTargets(ctx context.Context, db *gorm.DB, probeType Type,
 	return nil
 }
 
+// probeTypeCapabilities lists the agent capabilities each probe type needs.
+// Types not listed (DNS, HTTP, TLS, SYSINFO, NETINFO) use plain sockets or
+// host APIs available on every supported platform.
+var probeTypeCapabilities = map[Type][]string{
+	TypePing:            {agent.CapICMP},
+	TypeMTR:             {agent.CapRawSocket},
+	TypeSpeedtest:       {agent.CapSpeedtest},
+	TypeSpeedtestServer: {agent.CapSpeedtest},
+	TypeTrafficSim:      {agent.CapTrafficSim},
+	TypeAgent:           {agent.CapTrafficSim, agent.CapICMP, agent.CapRawSocket},
+	TypeSNMP:            {agent.CapSNMP},
+	TypePMTU:            {agent.CapPMTU},
+}
+
+// missingCapabilities returns the capabilities probeType needs that the
+// agent did not report, or nil when the agent never reported any (legacy
+// agents are not checked).
+func missingCapabilities(a *agent.Agent, probeType Type) []string {
+	if a == nil || !a.CapabilitiesReported() {
+		return nil
+	}
+	var missing []string
+	for _, c := range probeTypeCapabilities[probeType] {
+		if !a.HasCapability(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// validateAgentCapabilities rejects probe types the owning agent reported
+// it cannot run, e.g. MTR on a host without raw socket access.
+func validateAgentCapabilities(ctx context.Context, db *gorm.DB, agentID uint, probeType Type) error {
+	a, err := agent.GetAgentByID(ctx, db, agentID)
+	if err != nil {
+		// Ownership is enforced elsewhere; nothing to check against.
+		return nil
+	}
+	missing := missingCapabilities(a, probeType)
+	if len(missing) == 0 {
+		return nil
+	}
+	platform := a.OS
+	if platform == "" {
+		platform = "unknown OS"
+	}
+	if a.Arch != "" {
+		platform += "/" + a.Arch
+	}
+	return fmt.Errorf("%w: %s probes require %s, which agent %q (%s) does not report",
+		ErrUnsupported, probeType, strings.Join(missing, ", "), a.Name, platform)
+}
+
 // expandAgentProbeForOwner expands an AGENT probe for the owning agent.
 // The target agent's public IP is resolved and used as the destination.
 func expandAgentProbeForOwner(ctx context.Context, db *gorm.DB, ch *sql.DB,
@@ -1123,6 +1238,7 @@ func createExpandedProbe(source *Probe, probeType Type, targetIP string, targetA
 		TimeoutSec:  timeoutSec,
 		Count:       count,
 		DurationSec: source.DurationSec,
+		DSCP:        expandedProbeDSCP(source, probeType),
 		Labels:      source.Labels,
 		Metadata:    source.Metadata,
 		Targets: []Target{
@@ -1538,6 +1654,10 @@ func getPublicIP(ctx context.Context, db *gorm.DB, ch *sql.DB, agentID uint) (st
 	if agentByID.PublicIPOverride != "" {
 		publicIP = agentByID.PublicIPOverride
 		log.Debugf("[getPublicIP] agent %d: using PublicIPOverride=%q", agentID, publicIP)
+	} else if ip, ok := CurrentPublicIP(ctx, db, agentID, netInfoMaxAge); ok {
+		// Recorded from NETINFO at ingest (see public_ip_history.go).
+		publicIP = ip
+		log.Debugf("[getPublicIP] agent %d: using public IP history=%q", agentID, publicIP)
 	} else {
 		netInfoPayload, err := GetLatestNetInfoForAgent(ctx, ch, uint64(agentID), nil)
 		if err != nil {
@@ -1635,6 +1755,13 @@ type ReverseProbeView struct {
 // read-only "configured elsewhere, targeting me" section. Excludes soft-deleted
 // and disabled probes.
 func ListReverseAgentProbes(ctx context.Context, db *gorm.DB, workspaceID, targetAgentID uint) ([]Probe, error) {
+	return listReverseProbes(ctx, db, workspaceID, targetAgentID, TypeAgent)
+}
+
+// listReverseProbes lists other agents' probes of probeType ("" = any type)
+// with a target row pointing at targetAgentID, scoped as described on
+// ListReverseAgentProbes.
+func listReverseProbes(ctx context.Context, db *gorm.DB, workspaceID, targetAgentID uint, probeType Type) ([]Probe, error) {
 	if workspaceID == 0 || targetAgentID == 0 {
 		return nil, fmt.Errorf("%w: workspaceID and targetAgentID required", ErrBadInput)
 	}
@@ -1653,8 +1780,11 @@ func ListReverseAgentProbes(ctx context.Context, db *gorm.DB, workspaceID, targe
 	q := db.WithContext(ctx).
 		Preload("Targets", "deleted_at IS NULL").
 		Joins("JOIN probe_targets t ON t.probe_id = probes.id AND t.deleted_at IS NULL").
-		Where("probes.type = ? AND t.agent_id = ? AND probes.agent_id <> ? AND probes.enabled = ? AND probes.deleted_at IS NULL",
-			TypeAgent, targetAgentID, targetAgentID, true)
+		Where("t.agent_id = ? AND probes.agent_id <> ? AND probes.enabled = ? AND probes.deleted_at IS NULL",
+			targetAgentID, targetAgentID, true)
+	if probeType != "" {
+		q = q.Where("probes.type = ?", probeType)
+	}
 	if !targetAgent.IsGlobal {
 		q = q.Where("probes.workspace_id = ?", workspaceID)
 	}
@@ -1675,6 +1805,11 @@ func ListReverseAgentProbesWithOwners(ctx context.Context, db *gorm.DB, workspac
 	if err != nil {
 		return nil, err
 	}
+	return reverseProbeViews(ctx, db, probes)
+}
+
+// reverseProbeViews names the owners of reverse probes.
+func reverseProbeViews(ctx context.Context, db *gorm.DB, probes []Probe) ([]ReverseProbeView, error) {
 	if len(probes) == 0 {
 		return []ReverseProbeView{}, nil
 	}
@@ -1726,21 +1861,34 @@ func Update(ctx context.Context, db *gorm.DB, in UpdateInput) (*Probe, error) {
 		return nil, fmt.Errorf("%w: id required", ErrBadInput)
 	}
 
-	// AGENT-probe targets must have a TrafficSim server enabled. The existing
-	// probe's type is needed to gate this check, so we look it up front.
+	// Field checks depend on the existing probe's type and timing, so we
+	// look it up front.
+	existing, err := GetByID(ctx, db, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateUpdateInput(in, existing); err != nil {
+		return nil, err
+	}
+	// AGENT-probe targets must have a TrafficSim server enabled.
 	if len(in.ReplaceAgentTargets) > 0 {
-		existing, err := GetByID(ctx, db, in.ID)
-		if err != nil {
-			return nil, err
-		}
 		if err := validateAgentProbeTargets(ctx, db, existing.Type, in.ReplaceAgentTargets); err != nil {
 			return nil, err
 		}
 	}
+	var externalID string
+	if in.ExternalID != nil {
+		if externalID, err = extid.Claim(ctx, db, "probes", existing.WorkspaceID, in.ID, *in.ExternalID); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadInput, err)
+		}
+	}
 
 	now := time.Now()
-	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		updates := map[string]any{"updated_at": now}
+		if externalID != "" {
+			updates["external_id"] = externalID
+		}
 		if in.Enabled != nil {
 			updates["enabled"] = *in.Enabled
 		}
@@ -1765,6 +1913,9 @@ func Update(ctx context.Context, db *gorm.DB, in UpdateInput) (*Probe, error) {
 		if in.BindInterface != nil {
 			updates["bind_interface"] = *in.BindInterface
 		}
+		if in.DSCP != nil {
+			updates["dscp"] = *in.DSCP
+		}
 
 		res := tx.Model(&Probe{}).Where("id = ?", in.ID).Updates(updates)
 		if res.Error != nil {
@@ -1779,9 +1930,13 @@ func Update(ctx context.Context, db *gorm.DB, in UpdateInput) (*Probe, error) {
 			if err := tx.Where("probe_id = ?", in.ID).Delete(&Target{}).Error; err != nil {
 				return err
 			}
+			var probeType Type
+			if err := tx.Model(&Probe{}).Select("type").Where("id = ?", in.ID).Scan(&probeType).Error; err != nil {
+				return err
+			}
 			var rows []Target
 			for _, t := range in.ReplaceTargets {
-				if !validateLiteralTarget(t) {
+				if !validateTargetForType(t, probeType) {
 					return fmt.Errorf("%w: %q", ErrTargetFormat, t)
 				}
 				rows = append(rows, Target{
@@ -2009,6 +2164,7 @@ func CopyProbes(ctx context.Context, db *gorm.DB, in CopyInput) (*CopyOutput, er
 				Count:       srcProbe.Count,
 				DurationSec: srcProbe.DurationSec,
 				Server:      srcProbe.Server,
+				DSCP:        srcProbe.DSCP,
 				Labels:      srcProbe.Labels,
 				Metadata:    srcProbe.Metadata,
 			}
@@ -0,0 +1,325 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Probe Placement Advisor ──
+//
+// Recommends the probes missing for full coverage of an SLO scope (a set
+// of agents and targets), from the probes already configured and, when
+// a latency SLO is given, recent PING results:
+//
+//   - mesh: two agents in scope have no inter-agent probe in either
+//     direction, so a problem between sites can't be told apart from a
+//     problem at the shared targets they both reach.
+//   - target_coverage: a target in scope is probed from some agents but
+//     not others, so an outage seen only from the missing site goes
+//     unnoticed.
+//   - path_visibility: an agent pings a target but has no MTR to it, so a
+//     latency SLO breach can't be localised to a hop. Paths already over
+//     the SLO rank first.
+//
+// A target is in scope when an agent in scope probes it with PING or MTR
+// and it passes the scope's target and criticality filters.
+
+// PlacementScope selects the agents and targets to cover. Zero values
+// mean everything in the workspace.
+type PlacementScope struct {
+	WorkspaceID     uint        `json:"workspace_id"`
+	AgentIDs        []uint      `json:"agent_ids,omitempty"`
+	Targets         []string    `json:"targets,omitempty"`
+	MinCriticality  Criticality `json:"min_criticality,omitempty"`
+	LatencyMs       float64     `json:"latency_ms,omitempty"` // latency SLO
+	LookbackMinutes int         `json:"lookback_minutes"`
+}
+
+// PlacementRecommendation is one probe to add.
+type PlacementRecommendation struct {
+	Kind            string `json:"kind"`     // mesh, target_coverage, path_visibility
+	Priority        string `json:"priority"` // high, medium, low
+	ProbeType       Type   `json:"probe_type"`
+	AgentID         uint   `json:"agent_id"`
+	AgentName       string `json:"agent_name"`
+	TargetAgentID   uint   `json:"target_agent_id,omitempty"`
+	TargetAgentName string `json:"target_agent_name,omitempty"`
+	Target          string `json:"target,omitempty"`
+	Reason          string `json:"reason"`
+}
+
+// PlacementCoverage counts what the scope covers today.
+type PlacementCoverage struct {
+	Agents             int     `json:"agents"`
+	Targets            int     `json:"targets"`
+	TargetPairs        int     `json:"target_pairs"` // agent × target
+	TargetPairsCovered int     `json:"target_pairs_covered"`
+	MeshPairs          int     `json:"mesh_pairs"` // unordered agent pairs
+	MeshPairsCovered   int     `json:"mesh_pairs_covered"`
+	CoveragePct        float64 `json:"coverage_pct"`
+}
+
+// PlacementAdvice is the advisor's result for one scope.
+type PlacementAdvice struct {
+	Scope           PlacementScope            `json:"scope"`
+	Coverage        PlacementCoverage         `json:"coverage"`
+	Recommendations []PlacementRecommendation `json:"recommendations"`
+	GeneratedAt     time.Time                 `json:"generated_at"`
+}
+
+// AdviseProbePlacement loads the workspace's agents and enabled probes and
+// returns the recommendations for scope. ch may be nil; recent latency is
+// then not considered.
+func AdviseProbePlacement(ctx context.Context, ch *sql.DB, pg *gorm.DB, scope PlacementScope) (*PlacementAdvice, error) {
+	if scope.MinCriticality != "" {
+		if _, ok := criticalityWeight[scope.MinCriticality]; !ok {
+			return nil, fmt.Errorf("%w: unknown criticality %q", ErrBadInput, scope.MinCriticality)
+		}
+	}
+	if scope.LookbackMinutes <= 0 {
+		scope.LookbackMinutes = 60
+	}
+
+	agents, err := getWorkspaceAgents(ctx, pg, scope.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	var probes []Probe
+	if err := pg.WithContext(ctx).Preload("Targets").
+		Where("workspace_id = ? AND enabled = ?", scope.WorkspaceID, true).
+		Find(&probes).Error; err != nil {
+		return nil, fmt.Errorf("list probes: %w", err)
+	}
+
+	var observed map[string]pingStats
+	if ch != nil && scope.LatencyMs > 0 && len(agents) > 0 {
+		ids := make([]uint, len(agents))
+		for i, a := range agents {
+			ids[i] = a.ID
+		}
+		from := time.Now().UTC().Add(-time.Duration(scope.LookbackMinutes) * time.Minute)
+		// Latency only sharpens priorities; advice without it is still useful.
+		observed, _ = getWorkspacePingMetrics(ctx, ch, ids, from)
+	}
+
+	return advisePlacement(agents, probes, targetCriticalityMap(ctx, pg, scope.WorkspaceID), observed, scope), nil
+}
+
+// advisePlacement computes the advice from loaded inputs. observed is
+// keyed like getWorkspacePingMetrics ("agentID:target").
+func advisePlacement(agents []agentInfo, probes []Probe, crit map[string]Criticality, observed map[string]pingStats, scope PlacementScope) *PlacementAdvice {
+	inScope := make(map[uint]bool, len(scope.AgentIDs))
+	for _, id := range scope.AgentIDs {
+		inScope[id] = true
+	}
+	var scoped []agentInfo
+	for _, a := range agents {
+		if len(inScope) == 0 || inScope[a.ID] {
+			scoped = append(scoped, a)
+		}
+	}
+	sort.Slice(scoped, func(i, j int) bool { return scoped[i].Name < scoped[j].Name })
+	name := make(map[uint]string, len(agents))
+	for _, a := range agents {
+		name[a.ID] = a.Name
+	}
+
+	wantTarget := make(map[string]bool, len(scope.Targets))
+	for _, t := range scope.Targets {
+		wantTarget[stripPort(strings.TrimSpace(t))] = true
+	}
+	critOf := func(host string) Criticality {
+		if c, ok := crit[host]; ok {
+			return c
+		}
+		for t, c := range crit {
+			if stripPort(t) == host {
+				return c
+			}
+		}
+		return CriticalityNormal
+	}
+
+	// What each agent runs: PING/MTR per target host, and any probe to
+	// another agent.
+	type reach struct{ ping, mtr bool }
+	reaches := make(map[uint]map[string]*reach)
+	meshed := make(map[[2]uint]bool)
+	for _, p := range probes {
+		for _, t := range p.Targets {
+			if t.AgentID != nil {
+				if *t.AgentID != p.AgentID {
+					meshed[agentPair(p.AgentID, *t.AgentID)] = true
+				}
+				continue
+			}
+			if p.Type != TypePing && p.Type != TypeMTR {
+				continue
+			}
+			host := stripPort(strings.TrimSpace(t.Target))
+			if host == "" {
+				continue
+			}
+			if reaches[p.AgentID] == nil {
+				reaches[p.AgentID] = make(map[string]*reach)
+			}
+			r := reaches[p.AgentID][host]
+			if r == nil {
+				r = &reach{}
+				reaches[p.AgentID][host] = r
+			}
+			r.ping = r.ping || p.Type == TypePing
+			r.mtr = r.mtr || p.Type == TypeMTR
+		}
+	}
+
+	// Targets in scope.
+	targetSet := make(map[string]bool)
+	for _, a := range scoped {
+		for host := range reaches[a.ID] {
+			if len(wantTarget) > 0 && !wantTarget[host] {
+				continue
+			}
+			if scope.MinCriticality != "" && criticalityWeight[critOf(host)] < criticalityWeight[scope.MinCriticality] {
+				continue
+			}
+			targetSet[host] = true
+		}
+	}
+	targets := make([]string, 0, len(targetSet))
+	for t := range targetSet {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	advice := &PlacementAdvice{
+		Scope:           scope,
+		Recommendations: []PlacementRecommendation{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+	cov := &advice.Coverage
+	cov.Agents, cov.Targets = len(scoped), len(targets)
+	add := func(r PlacementRecommendation) {
+		advice.Recommendations = append(advice.Recommendations, r)
+	}
+
+	for _, t := range targets {
+		c := critOf(t)
+		var from []string
+		for _, a := range scoped {
+			if reaches[a.ID][t] != nil {
+				from = append(from, a.Name)
+			}
+		}
+		for _, a := range scoped {
+			cov.TargetPairs++
+			r := reaches[a.ID][t]
+			if r == nil {
+				add(PlacementRecommendation{
+					Kind: "target_coverage", Priority: criticalityPriority(c, "medium"), ProbeType: TypePing,
+					AgentID: a.ID, AgentName: a.Name, Target: t,
+					Reason: fmt.Sprintf("%s is probed from %d of %d agents in scope (%s); add it on %s for full coverage",
+						t, len(from), len(scoped), strings.Join(from, ", "), a.Name),
+				})
+				continue
+			}
+			cov.TargetPairsCovered++
+			if r.mtr {
+				continue
+			}
+			prio := criticalityPriority(c, "low")
+			reason := fmt.Sprintf("%s pings %s but has no MTR to it, so latency changes can't be localised to a hop", a.Name, t)
+			if s, ok := observed[fmt.Sprintf("%d:%s", a.ID, t)]; ok && scope.LatencyMs > 0 && s.AvgLatency > scope.LatencyMs {
+				prio = "high"
+				reason = fmt.Sprintf("%s → %s averages %.1f ms against a %.0f ms latency SLO and has no MTR to localise it", a.Name, t, s.AvgLatency, scope.LatencyMs)
+			}
+			add(PlacementRecommendation{
+				Kind: "path_visibility", Priority: prio, ProbeType: TypeMTR,
+				AgentID: a.ID, AgentName: a.Name, Target: t, Reason: reason,
+			})
+		}
+	}
+
+	for i, a := range scoped {
+		for _, b := range scoped[i+1:] {
+			cov.MeshPairs++
+			if meshed[agentPair(a.ID, b.ID)] {
+				cov.MeshPairsCovered++
+				continue
+			}
+			var shared []string
+			top := CriticalityLow
+			for _, t := range targets {
+				if reaches[a.ID][t] != nil && reaches[b.ID][t] != nil {
+					shared = append(shared, t)
+					if c := critOf(t); criticalityWeight[c] > criticalityWeight[top] {
+						top = c
+					}
+				}
+			}
+			prio := "low"
+			reason := fmt.Sprintf("No inter-agent probe exists between %s and %s", a.Name, b.Name)
+			if len(shared) > 0 {
+				prio = criticalityPriority(top, "medium")
+				reason = fmt.Sprintf("%s and %s both reach %s but no inter-agent probe exists between them, so a problem between the sites can't be told apart from one at the target",
+					a.Name, b.Name, describeTargets(shared))
+			}
+			add(PlacementRecommendation{
+				Kind: "mesh", Priority: prio, ProbeType: TypeAgent,
+				AgentID: a.ID, AgentName: a.Name, TargetAgentID: b.ID, TargetAgentName: name[b.ID], Reason: reason,
+			})
+		}
+	}
+
+	if total := cov.TargetPairs + cov.MeshPairs; total > 0 {
+		cov.CoveragePct = roundTo(float64(cov.TargetPairsCovered+cov.MeshPairsCovered)/float64(total)*100, 1)
+	}
+
+	kindOrder := map[string]int{"mesh": 0, "target_coverage": 1, "path_visibility": 2}
+	prioOrder := map[string]int{"high": 0, "medium": 1, "low": 2}
+	sort.SliceStable(advice.Recommendations, func(i, j int) bool {
+		ri, rj := advice.Recommendations[i], advice.Recommendations[j]
+		if prioOrder[ri.Priority] != prioOrder[rj.Priority] {
+			return prioOrder[ri.Priority] < prioOrder[rj.Priority]
+		}
+		return kindOrder[ri.Kind] < kindOrder[rj.Kind]
+	})
+	return advice
+}
+
+// agentPair is an unordered key for two agents.
+func agentPair(a, b uint) [2]uint {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]uint{a, b}
+}
+
+// criticalityPriority raises def to high for high and critical targets and
+// lowers it for low ones.
+func criticalityPriority(c Criticality, def string) string {
+	switch c {
+	case CriticalityHigh, CriticalityCritical:
+		return "high"
+	case CriticalityLow:
+		return "low"
+	}
+	return def
+}
+
+// describeTargets names the first target and counts the rest.
+func describeTargets(ts []string) string {
+	switch len(ts) {
+	case 1:
+		return ts[0]
+	case 2:
+		return ts[0] + " and 1 other target"
+	}
+	return fmt.Sprintf("%s and %d other targets", ts[0], len(ts)-1)
+}
@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAdvisePlacement verifies missing mesh, coverage and MTR probes are
+// recommended, with the latency SLO and criticality raising priority.
+func TestAdvisePlacement(t *testing.T) {
+	agents := []agentInfo{{ID: 1, Name: "hq"}, {ID: 2, Name: "branch"}, {ID: 3, Name: "dc"}}
+	two := uint(2)
+	probes := []Probe{
+		{AgentID: 1, Type: TypePing, Targets: []Target{{Target: "1.1.1.1"}, {Target: "pay.example.com"}}},
+		{AgentID: 1, Type: TypeMTR, Targets: []Target{{Target: "1.1.1.1"}}},
+		{AgentID: 2, Type: TypePing, Targets: []Target{{Target: "1.1.1.1:443"}}},
+		{AgentID: 2, Type: TypeMTR, Targets: []Target{{Target: "1.1.1.1"}}},
+		{AgentID: 3, Type: TypePing, Targets: []Target{{Target: "1.1.1.1"}}},
+		{AgentID: 3, Type: TypeAgent, Targets: []Target{{AgentID: &two}}},
+		{AgentID: 3, Type: TypeDNS, Targets: []Target{{Target: "internal.example.com"}}},
+	}
+	crit := map[string]Criticality{"pay.example.com": CriticalityCritical}
+	observed := map[string]pingStats{"3:1.1.1.1": {AvgLatency: 180}}
+
+	adv := advisePlacement(agents, probes, crit, observed, PlacementScope{LatencyMs: 150})
+	cov := adv.Coverage
+	if cov.Agents != 3 || cov.Targets != 2 || cov.TargetPairs != 6 || cov.TargetPairsCovered != 4 {
+		t.Errorf("target coverage = %+v", cov)
+	}
+	if cov.MeshPairs != 3 || cov.MeshPairsCovered != 1 {
+		t.Errorf("mesh coverage = %+v", cov)
+	}
+
+	got := map[string]PlacementRecommendation{}
+	for _, r := range adv.Recommendations {
+		key := r.Kind + ":" + r.AgentName + ">" + r.Target + r.TargetAgentName
+		got[key] = r
+	}
+	if len(got) != 6 {
+		t.Fatalf("recommendations = %+v", adv.Recommendations)
+	}
+	if r := got["target_coverage:dc>pay.example.com"]; r.Priority != "high" || r.ProbeType != TypePing {
+		t.Errorf("critical target coverage = %+v", r)
+	}
+	if r := got["path_visibility:dc>1.1.1.1"]; r.Priority != "high" || !strings.Contains(r.Reason, "150 ms") {
+		t.Errorf("SLO breach without MTR = %+v", r)
+	}
+	if r, ok := got["mesh:branch>hq"]; !ok || !strings.Contains(r.Reason, "both reach 1.1.1.1") || r.ProbeType != TypeAgent {
+		t.Errorf("branch/hq mesh = %+v", r)
+	}
+	if _, ok := got["mesh:branch>dc"]; ok {
+		t.Error("dc already probes branch")
+	}
+	if adv.Recommendations[0].Priority != "high" {
+		t.Errorf("high priority first: %+v", adv.Recommendations[0])
+	}
+
+	// Scoped to critical targets and two agents.
+	adv = advisePlacement(agents, probes, crit, nil, PlacementScope{AgentIDs: []uint{1, 3}, MinCriticality: CriticalityHigh})
+	if adv.Coverage.Targets != 1 || len(adv.Recommendations) != 3 {
+		t.Errorf("critical scope = %+v", adv.Recommendations)
+	}
+}
@@ -458,3 +458,44 @@ func mustFindReverseForCount(t *testing.T, db *gorm.DB, target uint) int {
 // Compile-time guard: mustFindReverseForCount must use the package's gorm.DB
 // (importing here is intentional to keep the test file self-contained).
 var _ = func() *gorm.DB { return nil }
+
+// -------------------- validateAgentCapabilities --------------------
+
+// TestValidateAgentCapabilities_LegacyAgentPasses: agents that never
+// reported capabilities are not gated.
+func TestValidateAgentCapabilities_LegacyAgentPasses(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	mustCreateAgent(t, db, agent.Agent{ID: 1, WorkspaceID: 1, Name: "legacy"})
+
+	if err := validateAgentCapabilities(ctx, db, 1, TypeMTR); err != nil {
+		t.Errorf("legacy agent must pass, got: %v", err)
+	}
+}
+
+// TestValidateAgentCapabilities_RejectsMissing: an agent without raw
+// sockets cannot own an MTR probe, and the error names what's missing.
+func TestValidateAgentCapabilities_RejectsMissing(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	mustCreateAgent(t, db, agent.Agent{
+		ID: 1, WorkspaceID: 1, Name: "laptop", OS: "darwin", Arch: "arm64",
+		Capabilities: []byte(`["icmp","trafficsim"]`),
+	})
+
+	err := validateAgentCapabilities(ctx, db, 1, TypeMTR)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "raw_socket") || !strings.Contains(err.Error(), "darwin/arm64") {
+		t.Errorf("error must name the capability and platform, got: %q", err.Error())
+	}
+	if err := validateAgentCapabilities(ctx, db, 1, TypePing); err != nil {
+		t.Errorf("PING must pass with icmp capability, got: %v", err)
+	}
+	if err := validateAgentCapabilities(ctx, db, 1, TypeDNS); err != nil {
+		t.Errorf("DNS needs no capability, got: %v", err)
+	}
+}
@@ -31,7 +31,7 @@ func newTestDB(t *testing.T) *gorm.DB {
 	}
 	// A single connection keeps the in-memory database alive and shared.
 	sqlDB.SetMaxOpenConns(1)
-	if err := db.AutoMigrate(&agent.Agent{}, &Probe{}, &Target{}); err != nil {
+	if err := db.AutoMigrate(&agent.Agent{}, &Probe{}, &Target{}, &AgentPublicIP{}); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
 	return db
@@ -0,0 +1,332 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Bulk Probe Health ──
+//
+// Probe tables show a health chip per row. Running ComputeProbeAnalysis
+// for every row is far too heavy, so ComputeProbeHealthBulk scores a list
+// of probes from one ClickHouse aggregation: PING / TRAFFICSIM latency,
+// p95, loss and jitter per probe over the lookback, forward direction
+// only (rows reported by the probe's owner). Route stability is not part
+// of the compact vector and scores 100. MTR and DNS probes take the
+// health of their PING sibling to the same target, as the probe page
+// does; other types without one are "unknown".
+//
+// Results are cached per probe and lookback for probeHealthCacheTTL, so a
+// table re-rendering or paging only queries the probes it has not shown.
+
+const (
+	probeHealthCacheTTL = time.Minute
+	// MaxProbeHealthIDs caps one bulk request.
+	MaxProbeHealthIDs = 500
+	// MaxProbeHealthLookback caps the lookback in minutes.
+	MaxProbeHealthLookback = 24 * 60
+)
+
+// ProbeHealth is the compact health vector of one probe.
+type ProbeHealth struct {
+	ProbeID uint   `json:"probe_id"`
+	Type    string `json:"type"`
+	// SourceProbeID is the PING sibling the metrics came from, when not
+	// the probe itself.
+	SourceProbeID   uint    `json:"source_probe_id,omitempty"`
+	Grade           string  `json:"grade"` // excellent/good/fair/poor/critical, unknown without data
+	OverallHealth   float64 `json:"overall_health"`
+	LatencyScore    float64 `json:"latency_score"`
+	PacketLossScore float64 `json:"packet_loss_score"`
+	MosScore        float64 `json:"mos_score"`
+	AvgLatencyMs    float64 `json:"avg_latency_ms"`
+	P95LatencyMs    float64 `json:"p95_latency_ms"`
+	PacketLoss      float64 `json:"packet_loss"`
+	JitterMs        float64 `json:"jitter_ms"`
+	Samples         int     `json:"samples"`
+}
+
+// ProbeHealthList is the bulk health response.
+type ProbeHealthList struct {
+	WorkspaceID     uint          `json:"workspace_id"`
+	LookbackMinutes int           `json:"lookback_minutes"`
+	Probes          []ProbeHealth `json:"probes"`
+	// NotFound lists requested IDs that are not probes of the workspace.
+	NotFound    []uint    `json:"not_found,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+type probeHealthCacheEntry struct {
+	health  ProbeHealth
+	expires time.Time
+}
+
+var (
+	probeHealthCacheMu sync.Mutex
+	probeHealthCache   = make(map[string]probeHealthCacheEntry)
+)
+
+func probeHealthCacheKey(workspaceID, probeID uint, lookbackMinutes int) string {
+	return fmt.Sprintf("%d:%d:%d", workspaceID, probeID, lookbackMinutes)
+}
+
+// ComputeProbeHealthBulk returns the compact health of each requested
+// probe of the workspace, in request order.
+func ComputeProbeHealthBulk(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, probeIDs []uint, lookbackMinutes int) (*ProbeHealthList, error) {
+	if lookbackMinutes <= 0 {
+		lookbackMinutes = 60
+	}
+	if lookbackMinutes > MaxProbeHealthLookback {
+		return nil, fmt.Errorf("%w: lookback must be at most %d minutes", ErrBadInput, MaxProbeHealthLookback)
+	}
+	ids := make([]uint, 0, len(probeIDs))
+	seen := make(map[uint]bool, len(probeIDs))
+	for _, id := range probeIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: probe_ids required", ErrBadInput)
+	}
+	if len(ids) > MaxProbeHealthIDs {
+		return nil, fmt.Errorf("%w: at most %d probe_ids", ErrBadInput, MaxProbeHealthIDs)
+	}
+
+	out := &ProbeHealthList{
+		WorkspaceID:     workspaceID,
+		LookbackMinutes: lookbackMinutes,
+		Probes:          make([]ProbeHealth, 0, len(ids)),
+		GeneratedAt:     time.Now().UTC(),
+	}
+
+	// Serve what is cached; score the rest.
+	now := time.Now()
+	cached := make(map[uint]ProbeHealth)
+	var misses []uint
+	probeHealthCacheMu.Lock()
+	for k, e := range probeHealthCache {
+		if now.After(e.expires) {
+			delete(probeHealthCache, k)
+		}
+	}
+	for _, id := range ids {
+		if e, ok := probeHealthCache[probeHealthCacheKey(workspaceID, id, lookbackMinutes)]; ok {
+			cached[id] = e.health
+		} else {
+			misses = append(misses, id)
+		}
+	}
+	probeHealthCacheMu.Unlock()
+
+	if len(misses) > 0 {
+		scored, err := scoreProbeHealth(ctx, ch, pg, workspaceID, misses, lookbackMinutes)
+		if err != nil {
+			return nil, err
+		}
+		probeHealthCacheMu.Lock()
+		for id, h := range scored {
+			cached[id] = h
+			probeHealthCache[probeHealthCacheKey(workspaceID, id, lookbackMinutes)] = probeHealthCacheEntry{
+				health: h, expires: now.Add(probeHealthCacheTTL),
+			}
+		}
+		probeHealthCacheMu.Unlock()
+	}
+
+	for _, id := range ids {
+		if h, ok := cached[id]; ok {
+			out.Probes = append(out.Probes, h)
+		} else {
+			out.NotFound = append(out.NotFound, id)
+		}
+	}
+	return out, nil
+}
+
+// scoreProbeHealth scores the workspace's probes among ids. IDs that are
+// not probes of the workspace are absent from the result.
+func scoreProbeHealth(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, ids []uint, lookbackMinutes int) (map[uint]ProbeHealth, error) {
+	var probes []Probe
+	if err := pg.WithContext(ctx).Preload("Targets").
+		Where("workspace_id = ? AND id IN ?", workspaceID, ids).
+		Find(&probes).Error; err != nil {
+		return nil, fmt.Errorf("get probes: %w", err)
+	}
+	if len(probes) == 0 {
+		return map[uint]ProbeHealth{}, nil
+	}
+
+	// PING siblings for probes that have no latency data of their own.
+	var siblingAgents []uint
+	for _, p := range probes {
+		if !hasLatencyRows(p.Type) {
+			siblingAgents = append(siblingAgents, p.AgentID)
+		}
+	}
+	var pings []Probe
+	if len(siblingAgents) > 0 {
+		if err := pg.WithContext(ctx).Preload("Targets").
+			Where("workspace_id = ? AND agent_id IN ? AND type = ?", workspaceID, siblingAgents, TypePing).
+			Order("id").Find(&pings).Error; err != nil {
+			return nil, fmt.Errorf("get sibling probes: %w", err)
+		}
+	}
+	sources := probeHealthSources(probes, pings)
+
+	from := time.Now().UTC().Add(-time.Duration(lookbackMinutes) * time.Minute)
+	rows, err := getProbeHealthRows(ctx, ch, sources, from)
+	if err != nil {
+		return nil, fmt.Errorf("probe health query: %w", err)
+	}
+
+	out := make(map[uint]ProbeHealth, len(probes))
+	for _, p := range probes {
+		h := ProbeHealth{ProbeID: p.ID, Type: string(p.Type), Grade: "unknown"}
+		src, ok := sources[p.ID]
+		if ok {
+			if src.probeID != p.ID {
+				h.SourceProbeID = src.probeID
+			}
+			if m, ok := rows[src]; ok && m.SampleCount > 0 {
+				applyProbeHealthMetrics(&h, m)
+			}
+		}
+		out[p.ID] = h
+	}
+	return out, nil
+}
+
+// hasLatencyRows reports whether probes of type t report PING or
+// TRAFFICSIM rows under their own ID.
+func hasLatencyRows(t Type) bool {
+	return t == TypePing || t == TypeTrafficSim || t == TypeAgent
+}
+
+// probeHealthSource identifies the rows a probe is scored from.
+type probeHealthSource struct {
+	probeID  uint
+	reporter uint
+}
+
+// probeHealthSources maps each probe to its metric source: itself for
+// PING / TRAFFICSIM / AGENT probes, the lowest-ID PING probe of the same
+// agent to the same first target for MTR and DNS probes. Probes with
+// neither are left out.
+func probeHealthSources(probes, pings []Probe) map[uint]probeHealthSource {
+	out := make(map[uint]probeHealthSource, len(probes))
+	for _, p := range probes {
+		if hasLatencyRows(p.Type) {
+			out[p.ID] = probeHealthSource{probeID: p.ID, reporter: p.AgentID}
+			continue
+		}
+		if (p.Type != TypeMTR && p.Type != TypeDNS) || len(p.Targets) == 0 {
+			continue
+		}
+		for _, s := range pings {
+			if s.AgentID == p.AgentID && len(s.Targets) > 0 && sameTarget(p.Targets[0], s.Targets[0]) {
+				out[p.ID] = probeHealthSource{probeID: s.ID, reporter: s.AgentID}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// getProbeHealthRows aggregates the PING and TRAFFICSIM rows of every
+// source over the window, one ProbeMetrics per source.
+func getProbeHealthRows(ctx context.Context, ch *sql.DB, sources map[uint]probeHealthSource, from time.Time) (map[probeHealthSource]ProbeMetrics, error) {
+	out := make(map[probeHealthSource]ProbeMetrics)
+	probeSet := make(map[uint]bool)
+	agentSet := make(map[uint]bool)
+	wanted := make(map[probeHealthSource]bool)
+	for _, s := range sources {
+		probeSet[s.probeID] = true
+		agentSet[s.reporter] = true
+		wanted[s] = true
+	}
+	if len(wanted) == 0 {
+		return out, nil
+	}
+
+	lat := fmt.Sprintf("if(type = 'PING', %s / 1000000.0, JSONExtractFloat(payload_raw, 'averageRTT'))", pingAvgRttNsSQL)
+	q := fmt.Sprintf(`
+SELECT
+    probe_id,
+    agent_id,
+    count() AS samples,
+    avg(%[1]s) AS lat,
+    quantile(0.95)(%[1]s) AS p95,
+    avg(if(type = 'PING', %[2]s, JSONExtractFloat(payload_raw, 'lossPercentage'))) AS loss,
+    avg(if(type = 'PING', %[3]s / 1000000.0, JSONExtractFloat(payload_raw, 'jitterAvg'))) AS jitter
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND probe_id IN (%[4]s)
+  AND agent_id IN (%[5]s)
+  AND created_at >= %[6]s
+GROUP BY probe_id, agent_id
+`, lat, pingLossSQL, pingStdDevNsSQL, uintList(probeSet), uintList(agentSet), chQuoteTime(from))
+
+	rs, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		var probeID, agentID, n uint64
+		var avgLat, p95, loss, jit sql.NullFloat64
+		if err := rs.Scan(&probeID, &agentID, &n, &avgLat, &p95, &loss, &jit); err != nil {
+			return nil, err
+		}
+		key := probeHealthSource{probeID: uint(probeID), reporter: uint(agentID)}
+		if !wanted[key] {
+			continue // reverse-direction rows of a bidirectional probe
+		}
+		out[key] = ProbeMetrics{
+			AvgLatency:  sanitizeFloat(avgLat.Float64),
+			P95Latency:  sanitizeFloat(p95.Float64),
+			PacketLoss:  sanitizeFloat(loss.Float64),
+			JitterAvg:   sanitizeFloat(jit.Float64),
+			SampleCount: int(n),
+		}
+	}
+	return out, rs.Err()
+}
+
+// applyProbeHealthMetrics scores m into h.
+func applyProbeHealthMetrics(h *ProbeHealth, m ProbeMetrics) {
+	hv := computeHealthVector(m, 100)
+	h.Grade = hv.Grade
+	h.OverallHealth = hv.OverallHealth
+	h.LatencyScore = hv.LatencyScore
+	h.PacketLossScore = hv.PacketLossScore
+	h.MosScore = roundTo(hv.MosScore, 2)
+	h.AvgLatencyMs = roundTo(m.AvgLatency, 2)
+	h.P95LatencyMs = roundTo(m.P95Latency, 2)
+	h.PacketLoss = roundTo(m.PacketLoss, 3)
+	h.JitterMs = roundTo(m.JitterAvg, 2)
+	h.Samples = m.SampleCount
+}
+
+// uintList renders a set of IDs as a sorted, comma-separated SQL list.
+func uintList(set map[uint]bool) string {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%d", id)
+	}
+	return strings.Join(parts, ", ")
+}
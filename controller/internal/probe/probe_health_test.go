@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestProbeHealthSources(t *testing.T) {
+	probes := []Probe{
+		{ID: 1, AgentID: 10, Type: TypePing, Targets: []Target{{Target: "8.8.8.8"}}},
+		{ID: 2, AgentID: 10, Type: TypeMTR, Targets: []Target{{Target: " 8.8.8.8 "}}},
+		{ID: 3, AgentID: 10, Type: TypeMTR, Targets: []Target{{Target: "1.1.1.1"}}},
+		{ID: 4, AgentID: 10, Type: TypeAgent, Targets: []Target{{AgentID: ptrUint(11)}}},
+		{ID: 5, AgentID: 10, Type: TypeDNS, Targets: []Target{{AgentID: ptrUint(11)}}},
+		{ID: 6, AgentID: 12, Type: TypeHTTP, Targets: []Target{{Target: "https://example.com"}}},
+	}
+	pings := []Probe{
+		{ID: 1, AgentID: 10, Type: TypePing, Targets: []Target{{Target: "8.8.8.8"}}},
+		{ID: 7, AgentID: 10, Type: TypePing, Targets: []Target{{AgentID: ptrUint(11)}}},
+		{ID: 8, AgentID: 12, Type: TypePing, Targets: []Target{{Target: "1.1.1.1"}}}, // other agent
+	}
+
+	got := probeHealthSources(probes, pings)
+	want := map[uint]probeHealthSource{
+		1: {probeID: 1, reporter: 10},
+		2: {probeID: 1, reporter: 10},
+		4: {probeID: 4, reporter: 10},
+		5: {probeID: 7, reporter: 10},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sources = %+v, want %+v", got, want)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("probe %d source = %+v, want %+v", id, got[id], w)
+		}
+	}
+}
+
+func TestApplyProbeHealthMetrics(t *testing.T) {
+	var good, bad ProbeHealth
+	applyProbeHealthMetrics(&good, ProbeMetrics{AvgLatency: 12, P95Latency: 15, JitterAvg: 1, SampleCount: 60})
+	applyProbeHealthMetrics(&bad, ProbeMetrics{AvgLatency: 250, P95Latency: 400, PacketLoss: 12, JitterAvg: 40, SampleCount: 60})
+
+	if good.Grade != "excellent" || good.Samples != 60 {
+		t.Errorf("clean path = %+v, want excellent with 60 samples", good)
+	}
+	if bad.OverallHealth >= good.OverallHealth || bad.Grade == "excellent" || bad.Grade == "good" {
+		t.Errorf("lossy path scored %v (%s), clean %v", bad.OverallHealth, bad.Grade, good.OverallHealth)
+	}
+}
+
+func TestComputeProbeHealthBulkValidation(t *testing.T) {
+	ctx := context.Background()
+	many := make([]uint, MaxProbeHealthIDs+1)
+	for i := range many {
+		many[i] = uint(i + 1)
+	}
+	for name, tc := range map[string]struct {
+		ids      []uint
+		lookback int
+	}{
+		"empty":       {nil, 60},
+		"only zero":   {[]uint{0}, 60},
+		"too many":    {many, 60},
+		"long window": {[]uint{1}, MaxProbeHealthLookback + 1},
+	} {
+		if _, err := ComputeProbeHealthBulk(ctx, nil, nil, 1, tc.ids, tc.lookback); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", name, err)
+		}
+	}
+}
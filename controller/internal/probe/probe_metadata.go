@@ -0,0 +1,248 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Probe Metadata ──
+//
+// Probe.Metadata is a free-form JSON object that also carries
+// type-specific settings (dns_server, trafficsim.dscp, onboarding). A few
+// top-level keys describe what the probe is watching and are surfaced in
+// analysis, incidents, the network map and alerts, so an operator reads
+// "Circuit MPLS-117" instead of a bare IP:
+//
+//	display_name  human name for the target ("HQ internet uplink")
+//	criticality   low | normal | high | critical (fallback when the target
+//	              has no explicit criticality label)
+//	owner_team    team to contact when the target degrades
+//	circuit_id    carrier circuit reference
+//
+// Other keys are left untouched.
+
+// maxMetadataValueLen bounds each descriptive metadata value.
+const maxMetadataValueLen = 128
+
+// ProbeMetadata is the descriptive subset of Probe.Metadata.
+type ProbeMetadata struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Criticality string `json:"criticality,omitempty"`
+	OwnerTeam   string `json:"owner_team,omitempty"`
+	CircuitID   string `json:"circuit_id,omitempty"`
+}
+
+var probeMetadataKeys = []string{"display_name", "criticality", "owner_team", "circuit_id"}
+
+// ParseProbeMetadata extracts the descriptive keys from a probe's
+// metadata. It returns nil when none are set or the JSON is unreadable.
+func ParseProbeMetadata(raw datatypes.JSON) *ProbeMetadata {
+	if len(raw) == 0 {
+		return nil
+	}
+	var m ProbeMetadata
+	if json.Unmarshal(raw, &m) != nil {
+		return nil
+	}
+	m.DisplayName = strings.TrimSpace(m.DisplayName)
+	m.OwnerTeam = strings.TrimSpace(m.OwnerTeam)
+	m.CircuitID = strings.TrimSpace(m.CircuitID)
+	if c, err := ParseCriticality(m.Criticality); err == nil {
+		m.Criticality = string(c)
+	} else {
+		m.Criticality = ""
+	}
+	if m == (ProbeMetadata{}) {
+		return nil
+	}
+	return &m
+}
+
+// Label is the short human name: the display name, the circuit, or both.
+func (m *ProbeMetadata) Label() string {
+	if m == nil {
+		return ""
+	}
+	switch {
+	case m.DisplayName != "" && m.CircuitID != "":
+		return fmt.Sprintf("%s, circuit %s", m.DisplayName, m.CircuitID)
+	case m.DisplayName != "":
+		return m.DisplayName
+	case m.CircuitID != "":
+		return "Circuit " + m.CircuitID
+	}
+	return ""
+}
+
+// Describe names target for humans, e.g. "Circuit MPLS-117 (10.0.0.1)".
+// Without a label it returns target unchanged.
+func (m *ProbeMetadata) Describe(target string) string {
+	label := m.Label()
+	switch {
+	case label == "":
+		return target
+	case target == "":
+		return label
+	}
+	return fmt.Sprintf("%s (%s)", label, target)
+}
+
+// validateProbeMetadata checks the descriptive keys and metadata.http on
+// create/update. Other keys are not inspected.
+func validateProbeMetadata(raw datatypes.JSON) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return fmt.Errorf("%w: metadata must be a JSON object", ErrBadInput)
+	}
+	for _, k := range probeMetadataKeys {
+		v, ok := obj[k]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%w: metadata.%s must be a string", ErrBadInput, k)
+		}
+		if len(s) > maxMetadataValueLen {
+			return fmt.Errorf("%w: metadata.%s exceeds %d characters", ErrBadInput, k, maxMetadataValueLen)
+		}
+		if k == "criticality" && strings.TrimSpace(s) != "" {
+			if _, err := ParseCriticality(s); err != nil {
+				return fmt.Errorf("metadata.%w", err)
+			}
+		}
+	}
+	if v, ok := obj["http"]; ok && v != nil {
+		return validateHTTPOptions(v)
+	}
+	return nil
+}
+
+// probeMetadataIndex looks up metadata by probe ID or literal target.
+type probeMetadataIndex struct {
+	byProbe  map[uint]*ProbeMetadata
+	byTarget map[string]*ProbeMetadata
+}
+
+// forTarget matches a target with or without its port.
+func (ix probeMetadataIndex) forTarget(target string) *ProbeMetadata {
+	if m, ok := ix.byTarget[target]; ok {
+		return m
+	}
+	return ix.byTarget[stripPort(target)]
+}
+
+// buildProbeMetadataIndex indexes probes that carry descriptive metadata.
+// When several probes watch the same target, the lowest probe ID wins.
+func buildProbeMetadataIndex(probes []Probe) probeMetadataIndex {
+	ix := probeMetadataIndex{byProbe: map[uint]*ProbeMetadata{}, byTarget: map[string]*ProbeMetadata{}}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].ID < probes[j].ID })
+	for _, p := range probes {
+		m := ParseProbeMetadata(p.Metadata)
+		if m == nil {
+			continue
+		}
+		ix.byProbe[p.ID] = m
+		for _, t := range p.Targets {
+			if t.AgentID != nil || t.Target == "" {
+				continue
+			}
+			for _, key := range []string{t.Target, stripPort(t.Target)} {
+				if _, taken := ix.byTarget[key]; !taken {
+					ix.byTarget[key] = m
+				}
+			}
+		}
+	}
+	return ix
+}
+
+// loadProbeMetadataIndex indexes a workspace's probe metadata, then its
+// target catalog for targets no probe describes. Errors degrade to an
+// empty index, like targetCriticalityMap.
+func loadProbeMetadataIndex(ctx context.Context, pg *gorm.DB, workspaceID uint) probeMetadataIndex {
+	if pg == nil {
+		return buildProbeMetadataIndex(nil)
+	}
+	var probes []Probe
+	if err := pg.WithContext(ctx).Preload("Targets").
+		Where("workspace_id = ?", workspaceID).
+		Find(&probes).Error; err != nil {
+		return buildProbeMetadataIndex(nil)
+	}
+	ix := buildProbeMetadataIndex(probes)
+	if catalog, err := ListCatalog(ctx, pg, workspaceID, ""); err == nil {
+		ix.addCatalog(catalog)
+	}
+	return ix
+}
+
+// applyProbeMetadataToIncidents attaches target metadata to incidents and
+// adds an evidence line naming each described target.
+func applyProbeMetadataToIncidents(ix probeMetadataIndex, incidents []DetectedIncident) {
+	for i := range incidents {
+		inc := &incidents[i]
+		for _, t := range inc.AffectedTargets {
+			m := ix.forTarget(t)
+			if m == nil {
+				continue
+			}
+			if inc.TargetMetadata == nil {
+				inc.TargetMetadata = make(map[string]*ProbeMetadata)
+			}
+			inc.TargetMetadata[t] = m
+			line := "Target " + m.Describe(t)
+			if m.OwnerTeam != "" {
+				line += ", owned by " + m.OwnerTeam
+			}
+			inc.Evidence = append(inc.Evidence, line)
+		}
+	}
+}
+
+// applyProbeMetadataToMap attaches metadata to destination summaries and
+// nodes, and labels described destination nodes with their display name.
+func applyProbeMetadataToMap(data *NetworkMapData, ix probeMetadataIndex) {
+	byDest := make(map[string]*ProbeMetadata)
+	for i := range data.Destinations {
+		d := &data.Destinations[i]
+		m := ix.forTarget(d.Target)
+		for _, ep := range d.ExpandedEndpoints {
+			if m != nil {
+				break
+			}
+			m = ix.byProbe[ep.ProbeID]
+		}
+		if m == nil {
+			continue
+		}
+		d.Metadata = m
+		byDest[d.Target] = m
+	}
+	for i := range data.Nodes {
+		n := &data.Nodes[i]
+		if n.Type != "destination" {
+			continue
+		}
+		m, ok := byDest[n.ID]
+		if !ok {
+			m = ix.forTarget(n.ID)
+		}
+		if m == nil {
+			continue
+		}
+		n.Metadata = m
+		if label := m.Label(); label != "" {
+			n.Label = label
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func TestParseProbeMetadata(t *testing.T) {
+	m := ParseProbeMetadata(datatypes.JSON(`{"circuit_id":" MPLS-117 ","criticality":"HIGH","dns_server":"1.1.1.1"}`))
+	if m == nil || m.CircuitID != "MPLS-117" || m.Criticality != "high" {
+		t.Fatalf("parsed = %+v", m)
+	}
+	if got := m.Describe("10.0.0.1"); got != "Circuit MPLS-117 (10.0.0.1)" {
+		t.Errorf("Describe = %q", got)
+	}
+	m.DisplayName = "HQ uplink"
+	if got := m.Label(); got != "HQ uplink, circuit MPLS-117" {
+		t.Errorf("Label = %q", got)
+	}
+
+	if m := ParseProbeMetadata(datatypes.JSON(`{"dns_server":"1.1.1.1"}`)); m != nil {
+		t.Errorf("metadata without descriptive keys parsed as %+v", m)
+	}
+	var none *ProbeMetadata
+	if got := none.Describe("10.0.0.1"); got != "10.0.0.1" {
+		t.Errorf("nil Describe = %q", got)
+	}
+}
+
+func TestValidateProbeMetadata(t *testing.T) {
+	for _, ok := range []string{``, `{}`, `{"criticality":"critical","owner_team":"WAN"}`, `{"trafficsim":{"dscp":46}}`} {
+		if err := validateProbeMetadata(datatypes.JSON(ok)); err != nil {
+			t.Errorf("%s: %v", ok, err)
+		}
+	}
+	for _, bad := range []string{`[]`, `{"criticality":"urgent"}`, `{"circuit_id":117}`} {
+		if err := validateProbeMetadata(datatypes.JSON(bad)); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", bad, err)
+		}
+	}
+}
+
+func TestProbeMetadataSurfacing(t *testing.T) {
+	ix := buildProbeMetadataIndex([]Probe{
+		{ID: 2, Metadata: datatypes.JSON(`{"circuit_id":"MPLS-117","owner_team":"WAN","criticality":"critical"}`),
+			Targets: []Target{{Target: "10.0.0.1:443"}}},
+		{ID: 5, Metadata: datatypes.JSON(`{"display_name":"Other"}`), Targets: []Target{{Target: "10.0.0.1"}}},
+	})
+
+	incidents := []DetectedIncident{{ID: "x", AffectedTargets: []string{"10.0.0.1", "10.0.0.9"}}}
+	applyProbeMetadataToIncidents(ix, incidents)
+	if m := incidents[0].TargetMetadata["10.0.0.1"]; m == nil || m.CircuitID != "MPLS-117" {
+		t.Fatalf("target metadata = %+v, want lowest probe ID's", incidents[0].TargetMetadata)
+	}
+	if len(incidents[0].Evidence) != 1 || incidents[0].Evidence[0] != "Target Circuit MPLS-117 (10.0.0.1), owned by WAN" {
+		t.Errorf("evidence = %q", incidents[0].Evidence)
+	}
+
+	data := &NetworkMapData{
+		Nodes:        []NetworkMapNode{{ID: "10.0.0.1", Type: "destination", Label: "10.0.0.1"}, {ID: "10.0.0.1", Type: "hop"}},
+		Destinations: []DestinationSummary{{Target: "10.0.0.1"}},
+	}
+	applyProbeMetadataToMap(data, ix)
+	if data.Destinations[0].Metadata == nil || data.Nodes[0].Label != "Circuit MPLS-117" {
+		t.Errorf("destination = %+v, node = %+v", data.Destinations[0], data.Nodes[0])
+	}
+	if data.Nodes[1].Metadata != nil {
+		t.Error("metadata attached to a hop node")
+	}
+}
@@ -0,0 +1,251 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Provisioned Bandwidth ───────────────────────────────────────────────────
+//
+// 80 Mbps is a fine result on a 100 Mbps circuit and a bad one on a 1 Gbps
+// circuit, so speedtests are judged against the speed each agent's circuit
+// is provisioned for (agent provisioned_down_mbps / provisioned_up_mbps)
+// rather than on an absolute scale. Agents without a provisioned speed are
+// skipped.
+//
+// Samples are split into business hours (Mon–Fri 08:00–18:00 in the
+// agent's timezone, UTC when unset) and off-hours, because a circuit that
+// only falls short during the day is congested, not mis-provisioned. Each
+// period needs provisionedMinSamples tests; the median percentage of the
+// worse period decides the finding.
+
+const (
+	provisionedWarnPct     = 70
+	provisionedCriticalPct = 40
+	provisionedMinSamples  = 3
+
+	businessHourStart = 8
+	businessHourEnd   = 18
+
+	// provisionedGapPct is how much better off-hours must be for the
+	// shortfall to be attributed to daytime congestion.
+	provisionedGapPct = 20
+)
+
+// bandwidthSample is one speedtest result in Mbps.
+type bandwidthSample struct {
+	AgentID uint
+	At      time.Time
+	DLMbps  float64
+	ULMbps  float64
+}
+
+// inBusinessHours reports whether t falls on a weekday between
+// businessHourStart and businessHourEnd in loc.
+func inBusinessHours(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+	if wd := local.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return local.Hour() >= businessHourStart && local.Hour() < businessHourEnd
+}
+
+// agentLocation returns the agent's timezone, or UTC when unset or unknown.
+func agentLocation(a agentInfo) *time.Location {
+	if a.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// fetchBandwidthSamples returns SPEEDTEST results for the agents since from.
+func fetchBandwidthSamples(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) []bandwidthSample {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT agent_id, created_at, dl_bps, ul_bps
+FROM speedtest_data
+WHERE type = 'SPEEDTEST'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND server_count > 0%s
+ORDER BY created_at
+LIMIT 5000
+`, strings.Join(ids, ", "), chQuoteTime(from), asOfBound(ctx))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var out []bandwidthSample
+	for rows.Next() {
+		var aid uint64
+		var at time.Time
+		var dl, ul float64
+		if err := rows.Scan(&aid, &at, &dl, &ul); err != nil {
+			continue
+		}
+		out = append(out, bandwidthSample{AgentID: uint(aid), At: at, DLMbps: dl / 1e6, ULMbps: ul / 1e6})
+	}
+	return out
+}
+
+// provisionedPeriod is the median percentage of provisioned speed reached
+// in one period.
+type provisionedPeriod struct {
+	Name    string // "business hours" or "off-hours"
+	Pct     float64
+	Mbps    float64
+	Samples int
+}
+
+// provisionedPeriods splits one direction's samples into business hours and
+// off-hours. Periods with too few samples are left out.
+func provisionedPeriods(samples []bandwidthSample, loc *time.Location, provisioned float64, mbps func(bandwidthSample) float64) []provisionedPeriod {
+	var business, off []float64
+	for _, s := range samples {
+		if inBusinessHours(s.At, loc) {
+			business = append(business, mbps(s))
+		} else {
+			off = append(off, mbps(s))
+		}
+	}
+	var out []provisionedPeriod
+	for _, p := range []struct {
+		name string
+		vals []float64
+	}{{"business hours", business}, {"off-hours", off}} {
+		if len(p.vals) < provisionedMinSamples {
+			continue
+		}
+		m := median(p.vals)
+		out = append(out, provisionedPeriod{Name: p.name, Pct: math.Round(m / provisioned * 100), Mbps: m, Samples: len(p.vals)})
+	}
+	return out
+}
+
+// provisionedFindings builds one finding per agent and direction whose
+// speedtests reach less than provisionedWarnPct of the provisioned speed
+// in either period.
+func provisionedFindings(samples []bandwidthSample, agentByID map[uint]agentInfo) []AnalysisFinding {
+	byAgent := make(map[uint][]bandwidthSample)
+	for _, s := range samples {
+		byAgent[s.AgentID] = append(byAgent[s.AgentID], s)
+	}
+	ids := make([]uint, 0, len(byAgent))
+	for id := range byAgent {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var out []AnalysisFinding
+	for _, id := range ids {
+		a, ok := agentByID[id]
+		if !ok {
+			continue
+		}
+		name := a.Name
+		if name == "" {
+			name = fmt.Sprintf("agent %d", id)
+		}
+		loc := agentLocation(a)
+		for _, dir := range []struct {
+			key, label  string
+			provisioned float64
+			mbps        func(bandwidthSample) float64
+		}{
+			{"down", "downstream", a.ProvisionedDownMbps, func(s bandwidthSample) float64 { return s.DLMbps }},
+			{"up", "upstream", a.ProvisionedUpMbps, func(s bandwidthSample) float64 { return s.ULMbps }},
+		} {
+			if dir.provisioned <= 0 {
+				continue
+			}
+			periods := provisionedPeriods(byAgent[id], loc, dir.provisioned, dir.mbps)
+			if len(periods) == 0 {
+				continue
+			}
+			worst, best := periods[0], periods[0]
+			for _, p := range periods[1:] {
+				if p.Pct < worst.Pct {
+					worst = p
+				}
+				if p.Pct > best.Pct {
+					best = p
+				}
+			}
+			if worst.Pct >= provisionedWarnPct {
+				continue
+			}
+			severity := "warning"
+			if worst.Pct < provisionedCriticalPct {
+				severity = "critical"
+			}
+
+			summary := fmt.Sprintf("Speedtests from %s reach a median of %.1f of the %.0f Mbps provisioned %s during %s.",
+				name, worst.Mbps, dir.provisioned, dir.label, worst.Name)
+			steps := []string{
+				"Confirm the provisioned speed recorded for the agent matches the circuit contract",
+				"Check the agent host's link speed and duplex, and whether other traffic shares the circuit",
+				"Raise the shortfall with the ISP with these results if the circuit is under-delivering",
+			}
+			if worst.Name == "business hours" && best.Pct-worst.Pct >= provisionedGapPct {
+				summary += fmt.Sprintf(" Off-hours tests reach %.0f%%, so the circuit is likely congested by daytime traffic rather than under-delivering.", best.Pct)
+				steps = []string{
+					"Review what consumes the circuit during business hours (backups, updates, video)",
+					"Consider QoS or rate limits for bulk traffic, or a larger circuit",
+					"Confirm the provisioned speed recorded for the agent matches the circuit contract",
+				}
+			}
+
+			evidence := []string{fmt.Sprintf("Provisioned %s: %.0f Mbps", dir.label, dir.provisioned)}
+			for _, p := range periods {
+				evidence = append(evidence, fmt.Sprintf("%s: median %.1f Mbps (%.0f%%) over %d tests", strings.ToUpper(p.Name[:1])+p.Name[1:], p.Mbps, p.Pct, p.Samples))
+			}
+			evidence = append(evidence, fmt.Sprintf("Business hours: Mon–Fri %02d:00–%02d:00 %s", businessHourStart, businessHourEnd, loc))
+
+			out = append(out, AnalysisFinding{
+				ID:       fmt.Sprintf("provisioned_%s_%d", dir.key, id),
+				Title:    fmt.Sprintf("%s achieving %.0f%% of provisioned %s during %s", name, worst.Pct, dir.label, worst.Name),
+				Severity: severity,
+				Category: "performance",
+				Summary:  summary,
+				Evidence: evidence,
+				Steps:    steps,
+			})
+		}
+	}
+	return out
+}
+
+// detectProvisionedBandwidthFindings is provisionedFindings over the
+// speedtests since from for agents with a provisioned speed.
+func detectProvisionedBandwidthFindings(ctx context.Context, ch *sql.DB, agents []agentInfo, from time.Time) []AnalysisFinding {
+	var ids []uint
+	agentByID := make(map[uint]agentInfo)
+	for _, a := range agents {
+		if a.ProvisionedDownMbps > 0 || a.ProvisionedUpMbps > 0 {
+			ids = append(ids, a.ID)
+			agentByID[a.ID] = a
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return provisionedFindings(fetchBandwidthSamples(ctx, ch, ids, from), agentByID)
+}
@@ -0,0 +1,61 @@
+package probe
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProvisionedFindings verifies the business-hours split in the agent's
+// timezone, the percentage in the title, and that agents without a
+// provisioned speed or with too few samples are skipped.
+func TestProvisionedFindings(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	// Tuesday 2026-05-05: 14:00 Toronto is business hours, 02:00 is not.
+	day := func(d, hour int) time.Time { return time.Date(2026, 5, d, hour, 0, 0, 0, toronto) }
+	if !inBusinessHours(day(5, 14), toronto) || inBusinessHours(day(5, 2), toronto) || inBusinessHours(day(9, 14), toronto) {
+		t.Fatal("inBusinessHours misclassified weekday/weekend hours")
+	}
+	// 14:00 Toronto is 18:00 UTC: outside business hours when read as UTC.
+	if inBusinessHours(day(5, 14), time.UTC) {
+		t.Error("14:00 Toronto counted as business hours in UTC")
+	}
+
+	agents := map[uint]agentInfo{
+		1: {ID: 1, Name: "hq", ProvisionedDownMbps: 500, ProvisionedUpMbps: 50, Timezone: "America/Toronto"},
+		2: {ID: 2, Name: "branch"},
+		3: {ID: 3, Name: "lab", ProvisionedDownMbps: 100},
+	}
+	var samples []bandwidthSample
+	for d := 5; d <= 7; d++ {
+		// hq: 210 Mbps down by day, 480 at night; upload fine.
+		samples = append(samples,
+			bandwidthSample{AgentID: 1, At: day(d, 14), DLMbps: 210, ULMbps: 48},
+			bandwidthSample{AgentID: 1, At: day(d, 2), DLMbps: 480, ULMbps: 49},
+			bandwidthSample{AgentID: 2, At: day(d, 14), DLMbps: 1, ULMbps: 1},
+		)
+	}
+	// lab has only two samples per period.
+	samples = append(samples,
+		bandwidthSample{AgentID: 3, At: day(5, 14), DLMbps: 10},
+		bandwidthSample{AgentID: 3, At: day(6, 14), DLMbps: 10},
+	)
+
+	got := provisionedFindings(samples, agents)
+	if len(got) != 1 {
+		t.Fatalf("findings = %d, want 1: %+v", len(got), got)
+	}
+	f := got[0]
+	if f.ID != "provisioned_down_1" || f.Severity != "warning" {
+		t.Errorf("finding = %s/%s", f.ID, f.Severity)
+	}
+	if f.Title != "hq achieving 42% of provisioned downstream during business hours" {
+		t.Errorf("title = %q", f.Title)
+	}
+	if !strings.Contains(f.Summary, "congested") {
+		t.Errorf("summary should attribute the daytime shortfall to congestion: %q", f.Summary)
+	}
+}
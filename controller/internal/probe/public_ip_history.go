@@ -0,0 +1,138 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Agent Public IP History ──
+//
+// Each NETINFO report's public address is recorded at ingest as a "stint":
+// one row per continuous period an agent was seen behind an IP. A report
+// with the same IP as the agent's latest row extends it; a different IP
+// opens a new row, so A → B → A yields three rows and the table is the IP
+// change timeline. Target resolution (getPublicIP) reads the current stint
+// instead of querying ClickHouse, and reverse-probe / MTR hop matching
+// uses every IP an agent held during the analysed window, so traces taken
+// before an address change still resolve to the agent.
+//
+// Workspaces that seal NETINFO payloads are not recorded, so their
+// addresses never leave the encrypted ClickHouse column.
+
+// AgentPublicIP is one period an agent was seen behind a public IP.
+type AgentPublicIP struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID   uint      `gorm:"not null;index:idx_agent_public_ips_agent_seen,priority:1" json:"agent_id"`
+	IP        string    `gorm:"size:64;not null;index" json:"ip"`
+	FirstSeen time.Time `gorm:"not null" json:"first_seen"`
+	LastSeen  time.Time `gorm:"not null;index:idx_agent_public_ips_agent_seen,priority:2" json:"last_seen"`
+	ASN       uint      `json:"asn,omitempty"`
+	ASNOrg    string    `gorm:"size:255" json:"asn_org,omitempty"`
+	ISP       string    `gorm:"size:255" json:"isp,omitempty"`
+	Reports   int64     `json:"reports"`
+}
+
+func (AgentPublicIP) TableName() string { return "agent_public_ips" }
+
+// RecordPublicIP extends the agent's current stint or opens a new one.
+// Reports older than the current stint's last_seen are ignored so a
+// delayed batch can't reorder the timeline.
+func RecordPublicIP(ctx context.Context, pg *gorm.DB, agentID uint, p netInfoPayload, at time.Time) error {
+	ip := strings.TrimSpace(p.PublicAddress)
+	if agentID == 0 || net.ParseIP(ip) == nil {
+		return nil
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.UTC()
+	asn, asnOrg := p.GetASN()
+	isp := p.GetISP()
+
+	var cur []AgentPublicIP
+	if err := pg.WithContext(ctx).Where("agent_id = ?", agentID).
+		Order("last_seen DESC").Limit(1).Find(&cur).Error; err != nil {
+		return err
+	}
+	if len(cur) == 1 {
+		if at.Before(cur[0].LastSeen) {
+			return nil
+		}
+		if cur[0].IP == ip {
+			updates := map[string]any{"last_seen": at, "reports": gorm.Expr("reports + 1")}
+			if asn != 0 && cur[0].ASN == 0 {
+				updates["asn"], updates["asn_org"] = asn, asnOrg
+			}
+			if isp != "" && cur[0].ISP == "" {
+				updates["isp"] = isp
+			}
+			return pg.WithContext(ctx).Model(&AgentPublicIP{}).Where("id = ?", cur[0].ID).Updates(updates).Error
+		}
+	}
+	return pg.WithContext(ctx).Create(&AgentPublicIP{
+		AgentID: agentID, IP: ip, FirstSeen: at, LastSeen: at,
+		ASN: asn, ASNOrg: asnOrg, ISP: isp, Reports: 1,
+	}).Error
+}
+
+// CurrentPublicIP returns the agent's latest recorded IP if it was seen
+// within maxAge.
+func CurrentPublicIP(ctx context.Context, pg *gorm.DB, agentID uint, maxAge time.Duration) (string, bool) {
+	var cur []AgentPublicIP
+	err := pg.WithContext(ctx).Where("agent_id = ? AND last_seen >= ?", agentID, time.Now().UTC().Add(-maxAge)).
+		Order("last_seen DESC").Limit(1).Find(&cur).Error
+	if err != nil || len(cur) == 0 {
+		return "", false
+	}
+	return cur[0].IP, true
+}
+
+// ListPublicIPHistory returns an agent's IP timeline, newest first.
+func ListPublicIPHistory(ctx context.Context, pg *gorm.DB, agentID uint, from time.Time, limit int) ([]AgentPublicIP, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	q := pg.WithContext(ctx).Where("agent_id = ?", agentID)
+	if !from.IsZero() {
+		q = q.Where("last_seen >= ?", from)
+	}
+	var rows []AgentPublicIP
+	if err := q.Order("last_seen DESC").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("list public ip history: %w", err)
+	}
+	return rows, nil
+}
+
+// publicIPsInWindow maps every IP the agents held during [from, to] to
+// the agent that held it most recently.
+func publicIPsInWindow(ctx context.Context, pg *gorm.DB, agentIDs []uint, from, to time.Time) map[string]uint {
+	out := make(map[string]uint)
+	if pg == nil || len(agentIDs) == 0 {
+		return out
+	}
+	var rows []AgentPublicIP
+	if err := pg.WithContext(ctx).
+		Where("agent_id IN ? AND last_seen >= ? AND first_seen <= ?", agentIDs, from, to).
+		Order("last_seen ASC").Find(&rows).Error; err != nil {
+		return out
+	}
+	for _, r := range rows {
+		out[r.IP] = r.AgentID // ascending, so the latest holder wins
+	}
+	return out
+}
+
+// mergePublicIPHistory adds historical agent IPs to an IP→agent map
+// without overriding entries already resolved from overrides or NETINFO.
+func mergePublicIPHistory(agentIPToID map[string]uint, history map[string]uint) {
+	for ip, id := range history {
+		if _, exists := agentIPToID[ip]; !exists {
+			agentIPToID[ip] = id
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package probe
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestRecordPublicIPStints verifies a repeated IP extends the current
+// stint, a change opens a new one, and a late report is ignored.
+func TestRecordPublicIPStints(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	report := func(ip string, at time.Time) {
+		t.Helper()
+		p := netInfoPayload{PublicAddress: ip, Geo: &GeoInfo{ASN: 64500, ASNOrg: "Example ISP"}}
+		if err := RecordPublicIP(ctx, db, 7, p, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report("203.0.113.5", t0)
+	report("203.0.113.5", t0.Add(5*time.Minute))
+	report("198.51.100.9", t0.Add(10*time.Minute))
+	report("203.0.113.5", t0.Add(2*time.Minute)) // late, ignored
+	report("203.0.113.5", t0.Add(20*time.Minute))
+	report("not-an-ip", t0.Add(25*time.Minute))
+
+	rows, err := ListPublicIPHistory(ctx, db, 7, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 stints, got %d: %+v", len(rows), rows)
+	}
+	first := rows[2]
+	if first.IP != "203.0.113.5" || first.Reports != 2 || !first.LastSeen.Equal(t0.Add(5*time.Minute)) {
+		t.Errorf("first stint not extended: %+v", first)
+	}
+	if first.ASN != 64500 {
+		t.Errorf("ASN not recorded: %+v", first)
+	}
+	if rows[0].IP != "203.0.113.5" || rows[1].IP != "198.51.100.9" {
+		t.Errorf("unexpected order: %+v", rows)
+	}
+
+	window := publicIPsInWindow(ctx, db, []uint{7}, t0.Add(8*time.Minute), t0.Add(15*time.Minute))
+	if window["198.51.100.9"] != 7 || len(window) != 1 {
+		t.Errorf("window lookup = %v, want only 198.51.100.9", window)
+	}
+}
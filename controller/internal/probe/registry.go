@@ -27,6 +27,13 @@ type ProbeData struct {
 	// Optional: carry target string if you still resolve AGENT types dynamically
 	Target      string `json:"target,omitempty"`
 	TargetAgent uint   `json:"target_agent,omitempty"`
+	// DSCP codepoint the agent marked packets with (PING/TRAFFICSIM).
+	DSCP uint8 `json:"dscp,omitempty"`
+	// Reporting agent's workspace, set by the ingest path; not persisted.
+	WorkspaceID uint `json:"-"`
+	// Probe label values for the CH_LABEL_COLUMNS keys, set by the ingest
+	// path and written to the label_<key> columns.
+	Labels map[string]string `json:"-"`
 }
 
 // ---- Non-generic handler interface the registry stores ----
@@ -152,7 +159,7 @@ func Dispatch(ctx context.Context, pp ProbeData) error {
 }
 
 func InitWorkers(ch *sql.DB, pg *gorm.DB) {
-	initNetInfo(ch)
+	initNetInfo(ch, pg)
 	initSysInfo(ch)
 	initMtr(ch, pg)
 	initPing(ch, pg)
@@ -161,4 +168,5 @@ func InitWorkers(ch *sql.DB, pg *gorm.DB) {
 	initDns(ch, pg)
 	initHTTP(ch, pg)
 	initTLS(ch, pg)
+	initPMTU(ch, pg)
 }
@@ -0,0 +1,75 @@
+// internal/probe/reverse_health.go
+package probe
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ReverseProbeHealth is a probe owned by another agent that targets this
+// one, with its latest health. Health is the owner → this agent direction;
+// ReturnHealth is this agent → owner for bidirectional probes, and
+// CombinedHealth merges the two (see ProbeAnalysis).
+type ReverseProbeHealth struct {
+	ReverseProbeView
+	Health         *HealthVector `json:"health,omitempty"`
+	ReturnHealth   *HealthVector `json:"return_health,omitempty"`
+	CombinedHealth *HealthVector `json:"combined_health,omitempty"`
+	Metrics        *ProbeMetrics `json:"metrics,omitempty"`
+	// HasData is false when the lookback window has no samples, or the
+	// type is not analyzed (only AGENT, PING, MTR and TRAFFICSIM are).
+	HasData bool `json:"has_data"`
+}
+
+// reverseAnalyzable are the probe types ComputeProbeAnalysis scores.
+var reverseAnalyzable = map[Type]bool{TypeAgent: true, TypePing: true, TypeMTR: true, TypeTrafficSim: true}
+
+// ListReverseProbesWithHealth returns every enabled probe of any type that
+// other agents run against targetAgentID (scoped like
+// ListReverseAgentProbes), with owner names and the health over the last
+// lookbackMinutes. A probe whose analysis fails is returned without health.
+func ListReverseProbesWithHealth(ctx context.Context, ch *sql.DB, db *gorm.DB, workspaceID, targetAgentID uint, lookbackMinutes int) ([]ReverseProbeHealth, error) {
+	probes, err := listReverseProbes(ctx, db, workspaceID, targetAgentID, "")
+	if err != nil {
+		return nil, err
+	}
+	views, err := reverseProbeViews(ctx, db, probes)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ReverseProbeHealth, 0, len(views))
+	for _, v := range views {
+		rh := ReverseProbeHealth{ReverseProbeView: v}
+		if reverseAnalyzable[v.Probe.Type] && ctx.Err() == nil {
+			pa, err := ComputeProbeAnalysis(ctx, ch, db, v.Probe.WorkspaceID, v.Probe.ID, lookbackMinutes)
+			if err != nil {
+				log.Warnf("[reverse-probes] agent %d: analysis of probe %d failed: %v", targetAgentID, v.Probe.ID, err)
+			} else if pa != nil {
+				applyReverseHealth(&rh, pa)
+			}
+		}
+		out = append(out, rh)
+	}
+	return out, nil
+}
+
+// applyReverseHealth copies a probe analysis onto a reverse probe row.
+func applyReverseHealth(rh *ReverseProbeHealth, pa *ProbeAnalysis) {
+	rh.HasData = pa.Metrics.SampleCount > 0 || pa.CombinedHealth != nil
+	if !rh.HasData {
+		return
+	}
+	if pa.Metrics.SampleCount > 0 {
+		h, m := pa.Health, pa.Metrics
+		rh.Health, rh.Metrics = &h, &m
+	}
+	if pa.Reverse != nil && pa.Reverse.Metrics.SampleCount > 0 {
+		h := pa.Reverse.Health
+		rh.ReturnHealth = &h
+	}
+	rh.CombinedHealth = pa.CombinedHealth
+}
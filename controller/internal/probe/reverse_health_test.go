@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"context"
+	"testing"
+
+	"netwatcher-controller/internal/agent"
+)
+
+func TestListReverseProbesAnyType(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	mustCreateAgent(t, db, agent.Agent{ID: 1, WorkspaceID: 1, Name: "target"})
+	mustCreateAgent(t, db, agent.Agent{ID: 2, WorkspaceID: 1, Name: "owner"})
+	mkAgentProbe(t, db, 1, 2, 1, false)
+
+	// A legacy reverse PING probe also targets the agent by ID.
+	p := &Probe{WorkspaceID: 1, AgentID: 2, Type: TypePing, Enabled: true}
+	if err := db.Create(p).Error; err != nil {
+		t.Fatal(err)
+	}
+	tgt := uint(1)
+	if err := db.Create(&Target{ProbeID: p.ID, AgentID: &tgt}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	agentOnly, _ := ListReverseAgentProbes(ctx, db, 1, 1)
+	all, err := listReverseProbes(ctx, db, 1, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agentOnly) != 1 || len(all) != 2 {
+		t.Fatalf("agent-only = %d, any type = %d; want 1 and 2", len(agentOnly), len(all))
+	}
+	views, err := reverseProbeViews(ctx, db, all)
+	if err != nil || views[0].OwnerAgentName != "owner" {
+		t.Errorf("views = %+v, %v", views, err)
+	}
+}
+
+func TestApplyReverseHealth(t *testing.T) {
+	var rh ReverseProbeHealth
+	applyReverseHealth(&rh, &ProbeAnalysis{})
+	if rh.HasData || rh.Health != nil {
+		t.Errorf("no samples: %+v", rh)
+	}
+
+	combined := HealthVector{OverallHealth: 70, Grade: "fair"}
+	applyReverseHealth(&rh, &ProbeAnalysis{
+		Health:         HealthVector{OverallHealth: 95, Grade: "excellent"},
+		Metrics:        ProbeMetrics{SampleCount: 60, AvgLatency: 12},
+		Reverse:        &ProbeAnalysis{Health: HealthVector{OverallHealth: 60, Grade: "fair"}, Metrics: ProbeMetrics{SampleCount: 55}},
+		CombinedHealth: &combined,
+	})
+	if !rh.HasData || rh.Health.OverallHealth != 95 || rh.ReturnHealth.OverallHealth != 60 ||
+		rh.CombinedHealth.Grade != "fair" || rh.Metrics.AvgLatency != 12 {
+		t.Errorf("health = %+v", rh)
+	}
+}
@@ -64,7 +64,7 @@ func TestMtrPayloadUnmarshalFromAgent(t *testing.T) {
 		t.Fatalf("Unmarshal failed: %v", err)
 	}
 
-	if mp.StartTimestamp == "" {
+	if mp.StartTimestamp.IsZero() {
 		t.Errorf("Expected StartTimestamp to be parsed")
 	}
 	if len(mp.Report.Hops) != 2 {
@@ -0,0 +1,398 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Route Search ──
+//
+// "Which of our paths go through this router?" A carrier reports trouble
+// on a hop or a prefix; SearchRoutesByHop scans the workspace's recent MTR
+// traces in ClickHouse and returns every agent → target path that crossed
+// it, whether the latest trace still does, and the path's current health.
+//
+// The scan is one GROUP BY over MTR rows in the window. A literal
+// substring of the address (the exact IP, or the leading octets/hextet of
+// a prefix) narrows the rows ClickHouse has to hand back; hop IPs are then
+// checked against the prefix in Go, so the substring only needs to be a
+// superset.
+
+const (
+	routeSearchDefaultLookback = 60
+	routeSearchMaxLookback     = 7 * 24 * 60
+	// routeSearchMaxPaths caps the paths returned (and read from CH).
+	routeSearchMaxPaths = 500
+	// routeSearchHealthWindow is the PING window used for current health.
+	routeSearchHealthWindow = 15 * time.Minute
+	// Broader prefixes would match most of the internet.
+	routeSearchMinBitsV4 = 8
+	routeSearchMinBitsV6 = 16
+)
+
+// RouteSearchQuery selects MTR paths traversing a hop IP or prefix.
+type RouteSearchQuery struct {
+	WorkspaceID     uint
+	Hop             string // IP ("203.0.113.9") or CIDR ("203.0.113.0/24")
+	LookbackMinutes int    // 0 = 60, max 7 days
+	AgentID         uint   // 0 = all agents
+}
+
+// RouteSearchHop is a hop inside the searched prefix.
+type RouteSearchHop struct {
+	TTL        int     `json:"ttl"`
+	IP         string  `json:"ip"`
+	Hostname   string  `json:"hostname,omitempty"`
+	AvgLatency float64 `json:"avg_latency"` // ms
+	PacketLoss float64 `json:"packet_loss"` // percent
+}
+
+// RouteSearchPath is one agent → target path that traversed the hop.
+type RouteSearchPath struct {
+	AgentID         uint   `json:"agent_id"`
+	AgentName       string `json:"agent_name"`
+	ProbeID         uint   `json:"probe_id"`
+	Target          string `json:"target"`
+	TargetAgentID   uint   `json:"target_agent_id,omitempty"`
+	TargetAgentName string `json:"target_agent_name,omitempty"`
+
+	// MatchedHops are the hops inside the prefix on the most recent
+	// trace that crossed it.
+	MatchedHops   []RouteSearchHop `json:"matched_hops"`
+	LastMatchedAt time.Time        `json:"last_matched_at"`
+	// Current is true when the path's latest trace still crosses the
+	// prefix; false means the route has moved away from it.
+	Current       bool      `json:"current"`
+	LatestTraceAt time.Time `json:"latest_trace_at"`
+
+	// Health of the path now: PING over the last 15 minutes when the agent
+	// pings the target, otherwise the final hop of the latest trace.
+	Status       string  `json:"status"` // healthy, degraded, critical
+	AvgLatency   float64 `json:"avg_latency"`
+	PacketLoss   float64 `json:"packet_loss"`
+	HealthSource string  `json:"health_source"` // ping, mtr
+}
+
+// RouteSearchResult is the response of SearchRoutesByHop.
+type RouteSearchResult struct {
+	WorkspaceID     uint              `json:"workspace_id"`
+	Query           string            `json:"query"`
+	Prefix          string            `json:"prefix"`
+	From            time.Time         `json:"from"`
+	To              time.Time         `json:"to"`
+	LookbackMinutes int               `json:"lookback_minutes"`
+	Paths           []RouteSearchPath `json:"paths"`
+	AffectedAgents  int               `json:"affected_agents"`
+	AffectedTargets int               `json:"affected_targets"`
+	CurrentPaths    int               `json:"current_paths"`
+	Truncated       bool              `json:"truncated"`
+}
+
+// parseRouteSearchHop parses an IP or CIDR into a masked prefix.
+func parseRouteSearchHop(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Prefix{}, fmt.Errorf("%w: hop required", ErrBadInput)
+	}
+	var p netip.Prefix
+	if strings.Contains(s, "/") {
+		var err error
+		if p, err = netip.ParsePrefix(s); err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: invalid prefix %q", ErrBadInput, s)
+		}
+	} else {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: invalid IP %q", ErrBadInput, s)
+		}
+		p = netip.PrefixFrom(a, a.BitLen())
+	}
+	p = p.Masked()
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	if (p.Addr().Is4() && p.Bits() < routeSearchMinBitsV4) || (p.Addr().Is6() && p.Bits() < routeSearchMinBitsV6) {
+		return netip.Prefix{}, fmt.Errorf("%w: prefix %s is too broad (min /%d for IPv4, /%d for IPv6)",
+			ErrBadInput, p, routeSearchMinBitsV4, routeSearchMinBitsV6)
+	}
+	return p, nil
+}
+
+// routeSearchLiteral returns a substring every MTR payload with a hop in
+// p must contain, or "" when there is none worth filtering on.
+func routeSearchLiteral(p netip.Prefix) string {
+	a := p.Addr()
+	if p.IsSingleIP() {
+		return `"` + a.String() + `"`
+	}
+	if a.Is4() {
+		b := a.As4()
+		octets := make([]string, 0, 3)
+		for i := 0; i < p.Bits()/8 && i < 3; i++ {
+			octets = append(octets, fmt.Sprintf("%d", b[i]))
+		}
+		return `"` + strings.Join(octets, ".") + "."
+	}
+	// The first hextet is fixed for /16 and longer; canonical text keeps
+	// it unless it is zero (then the address starts with "::").
+	b := a.As16()
+	if first := uint16(b[0])<<8 | uint16(b[1]); first != 0 {
+		return fmt.Sprintf(`"%x:`, first)
+	}
+	return ""
+}
+
+// SearchRoutesByHop returns the workspace's MTR paths that traversed q.Hop
+// within the lookback window.
+func SearchRoutesByHop(ctx context.Context, ch *sql.DB, pg *gorm.DB, q RouteSearchQuery) (*RouteSearchResult, error) {
+	prefix, err := parseRouteSearchHop(q.Hop)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case q.LookbackMinutes < 0:
+		return nil, fmt.Errorf("%w: lookback must be positive", ErrBadInput)
+	case q.LookbackMinutes == 0:
+		q.LookbackMinutes = routeSearchDefaultLookback
+	case q.LookbackMinutes > routeSearchMaxLookback:
+		q.LookbackMinutes = routeSearchMaxLookback
+	}
+
+	agents, err := getWorkspaceAgents(ctx, pg, q.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(agents))
+	var agentIDs []uint
+	for _, a := range agents {
+		names[a.ID] = a.Name
+		if q.AgentID == 0 || a.ID == q.AgentID {
+			agentIDs = append(agentIDs, a.ID)
+		}
+	}
+	if q.AgentID != 0 && len(agentIDs) == 0 {
+		return nil, ErrNotFound
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-time.Duration(q.LookbackMinutes) * time.Minute)
+	out := &RouteSearchResult{
+		WorkspaceID: q.WorkspaceID, Query: strings.TrimSpace(q.Hop), Prefix: prefix.String(),
+		From: from, To: to, LookbackMinutes: q.LookbackMinutes, Paths: []RouteSearchPath{},
+	}
+	if len(agentIDs) == 0 {
+		return out, nil
+	}
+
+	rows, truncated, err := queryRouteSearchRows(ctx, ch, agentIDs, from, to, routeSearchLiteral(prefix))
+	if err != nil {
+		return nil, err
+	}
+	out.Truncated = truncated
+
+	for _, r := range rows {
+		path, ok := matchRouteSearchRow(r, prefix)
+		if !ok {
+			continue // substring matched something other than a hop
+		}
+		path.AgentName = names[path.AgentID]
+		path.TargetAgentName = names[path.TargetAgentID]
+		out.Paths = append(out.Paths, path)
+	}
+	if len(out.Paths) == 0 {
+		return out, nil
+	}
+
+	// Current health from recent PINGs where the agent pings the target.
+	pathAgents := make(map[uint]bool)
+	for _, p := range out.Paths {
+		pathAgents[p.AgentID] = true
+	}
+	ids := make([]uint, 0, len(pathAgents))
+	for id := range pathAgents {
+		ids = append(ids, id)
+	}
+	ping, _ := getWorkspacePingMetrics(ctx, ch, ids, to.Add(-routeSearchHealthWindow))
+	applyRouteSearchHealth(out.Paths, ping)
+
+	summarizeRouteSearch(out)
+	return out, nil
+}
+
+// routeSearchRow is one path's aggregate from queryRouteSearchRows.
+type routeSearchRow struct {
+	ProbeID, AgentID, TargetAgent uint
+	Target                        string
+	LatestAt, MatchAt             time.Time
+	LatestPayload, MatchPayload   string
+}
+
+func queryRouteSearchRows(ctx context.Context, ch *sql.DB, agentIDs []uint, from, to time.Time, literal string) ([]routeSearchRow, bool, error) {
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	match := "1"
+	if literal != "" {
+		match = fmt.Sprintf("position(payload_raw, %s) > 0", chQuoteString(literal))
+	}
+	q := fmt.Sprintf(`
+SELECT
+    probe_id,
+    agent_id,
+    target_agent,
+    target,
+    max(created_at) AS latest_at,
+    argMax(payload_raw, created_at) AS latest_payload,
+    maxIf(created_at, %[1]s) AS match_at,
+    argMaxIf(payload_raw, created_at, %[1]s) AS match_payload
+FROM probe_data
+WHERE type = 'MTR'
+  AND agent_id IN (%[2]s)
+  AND created_at >= %[3]s
+  AND created_at < %[4]s
+GROUP BY probe_id, agent_id, target_agent, target
+HAVING countIf(%[1]s) > 0
+ORDER BY match_at DESC
+LIMIT %[5]d`, match, strings.Join(ids, ", "), chQuoteTime(from), chQuoteTime(to), routeSearchMaxPaths+1)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var out []routeSearchRow
+	for rows.Next() {
+		var r routeSearchRow
+		var probeID, agentID, targetAgent uint64
+		if err := rows.Scan(&probeID, &agentID, &targetAgent, &r.Target, &r.LatestAt, &r.LatestPayload, &r.MatchAt, &r.MatchPayload); err != nil {
+			return nil, false, err
+		}
+		r.ProbeID, r.AgentID, r.TargetAgent = uint(probeID), uint(agentID), uint(targetAgent)
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(out) > routeSearchMaxPaths {
+		return out[:routeSearchMaxPaths], true, nil
+	}
+	return out, false, nil
+}
+
+// matchRouteSearchRow builds the path for r if its matching trace has a
+// hop inside prefix.
+func matchRouteSearchRow(r routeSearchRow, prefix netip.Prefix) (RouteSearchPath, bool) {
+	var matchTrace mtrPayload
+	if json.Unmarshal([]byte(r.MatchPayload), &matchTrace) != nil {
+		return RouteSearchPath{}, false
+	}
+	hops := hopsInPrefix(matchTrace, prefix)
+	if len(hops) == 0 {
+		return RouteSearchPath{}, false
+	}
+	path := RouteSearchPath{
+		AgentID: r.AgentID, ProbeID: r.ProbeID, TargetAgentID: r.TargetAgent,
+		Target:      r.Target,
+		MatchedHops: hops, LastMatchedAt: r.MatchAt, LatestTraceAt: r.LatestAt,
+	}
+	if path.Target == "" {
+		path.Target = matchTrace.Report.Info.Target.Hostname
+		if path.Target == "" {
+			path.Target = matchTrace.Report.Info.Target.IP
+		}
+	}
+
+	latest := matchTrace
+	if r.LatestAt.After(r.MatchAt) {
+		latest = mtrPayload{}
+		_ = json.Unmarshal([]byte(r.LatestPayload), &latest)
+	}
+	path.Current = len(hopsInPrefix(latest, prefix)) > 0
+	if n := len(latest.Report.Hops); n > 0 {
+		last := latest.Report.Hops[n-1]
+		path.AvgLatency = parseFloat(last.Avg)
+		path.PacketLoss = parseFloat(last.LossPct)
+		path.HealthSource = "mtr"
+	}
+	return path, true
+}
+
+func hopsInPrefix(p mtrPayload, prefix netip.Prefix) []RouteSearchHop {
+	var out []RouteSearchHop
+	for i, hop := range p.Report.Hops {
+		for _, h := range hop.Hosts {
+			a, err := netip.ParseAddr(h.IP)
+			if err != nil || !prefix.Contains(a.Unmap()) {
+				continue
+			}
+			ttl := hop.TTL
+			if ttl == 0 {
+				ttl = i + 1
+			}
+			out = append(out, RouteSearchHop{
+				TTL: ttl, IP: h.IP, Hostname: h.Hostname,
+				AvgLatency: parseFloat(hop.Avg), PacketLoss: parseFloat(hop.LossPct),
+			})
+		}
+	}
+	return out
+}
+
+// applyRouteSearchHealth prefers PING stats for the path over the MTR
+// final hop, and sets Status.
+func applyRouteSearchHealth(paths []RouteSearchPath, ping map[string]pingStats) {
+	for i := range paths {
+		p := &paths[i]
+		for _, key := range []string{
+			fmt.Sprintf("%d:%s", p.AgentID, p.Target),
+			fmt.Sprintf("%d:%s", p.AgentID, stripPort(p.Target)),
+		} {
+			if s, ok := ping[key]; ok && s.Count > 0 {
+				p.AvgLatency, p.PacketLoss, p.HealthSource = s.AvgLatency, s.PacketLoss, "ping"
+				break
+			}
+		}
+		p.AvgLatency = roundTo(sanitizeFloat(p.AvgLatency), 2)
+		p.PacketLoss = roundTo(sanitizeFloat(p.PacketLoss), 2)
+		p.Status = [...]string{"critical", "degraded", "healthy"}[healthPriority(p.PacketLoss, p.AvgLatency)]
+	}
+}
+
+// summarizeRouteSearch counts affected agents/targets and orders paths:
+// current first, then worst health, then agent and target.
+func summarizeRouteSearch(out *RouteSearchResult) {
+	agents := make(map[uint]bool)
+	targets := make(map[string]bool)
+	out.CurrentPaths = 0
+	for _, p := range out.Paths {
+		agents[p.AgentID] = true
+		targets[p.Target] = true
+		if p.Current {
+			out.CurrentPaths++
+		}
+	}
+	out.AffectedAgents, out.AffectedTargets = len(agents), len(targets)
+	sort.SliceStable(out.Paths, func(i, j int) bool {
+		a, b := out.Paths[i], out.Paths[j]
+		if a.Current != b.Current {
+			return a.Current
+		}
+		if ha, hb := healthPriority(a.PacketLoss, a.AvgLatency), healthPriority(b.PacketLoss, b.AvgLatency); ha != hb {
+			return ha < hb
+		}
+		if a.AgentName != b.AgentName {
+			return a.AgentName < b.AgentName
+		}
+		return a.Target < b.Target
+	})
+}
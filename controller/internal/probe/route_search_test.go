@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRouteSearchHop(t *testing.T) {
+	for in, want := range map[string]string{
+		"203.0.113.9":         "203.0.113.9/32",
+		" 203.0.113.77/24 ":   "203.0.113.0/24",
+		"2001:db8::1":         "2001:db8::1/128",
+		"::ffff:10.1.0.0/112": "10.1.0.0/16",
+	} {
+		p, err := parseRouteSearchHop(in)
+		if err != nil || p.String() != want {
+			t.Errorf("%q = %v, %v; want %s", in, p, err, want)
+		}
+	}
+	for _, bad := range []string{"", "router1", "10.0.0.0/4", "2001::/8"} {
+		if _, err := parseRouteSearchHop(bad); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%q: err = %v, want ErrBadInput", bad, err)
+		}
+	}
+}
+
+func TestRouteSearchLiteral(t *testing.T) {
+	for in, want := range map[string]string{
+		"203.0.113.9":    `"203.0.113.9"`,
+		"203.0.113.0/24": `"203.0.113.`,
+		"172.16.0.0/12":  `"172.`,
+		"2001:db8::/32":  `"2001:`,
+		"::/16":          "",
+	} {
+		p, err := parseRouteSearchHop(in)
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if got := routeSearchLiteral(p); got != want {
+			t.Errorf("%s: literal = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatchRouteSearchRow(t *testing.T) {
+	prefix, _ := parseRouteSearchHop("198.51.100.0/24")
+	via := `{"report":{"info":{"target":{"ip":"192.0.2.10"}},"hops":[
+		{"ttl":1,"hosts":[{"ip":"10.0.0.1"}],"avg":"1.0","loss_pct":"0"},
+		{"ttl":2,"hosts":[{"ip":"198.51.100.7","hostname":"core1.carrier.net"}],"avg":"8.5","loss_pct":"20"},
+		{"ttl":3,"hosts":[{"ip":"192.0.2.10"}],"avg":"12.0","loss_pct":"0"}]}}`
+	around := `{"report":{"hops":[{"ttl":1,"hosts":[{"ip":"10.0.0.1"}],"avg":"1.0","loss_pct":"0"},
+		{"ttl":2,"hosts":[{"ip":"192.0.2.10"}],"avg":"30.0","loss_pct":"0"}]}}`
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// The route moved off the prefix after the matching trace.
+	path, ok := matchRouteSearchRow(routeSearchRow{
+		ProbeID: 3, AgentID: 1, MatchAt: now.Add(-10 * time.Minute), MatchPayload: via,
+		LatestAt: now, LatestPayload: around,
+	}, prefix)
+	if !ok || len(path.MatchedHops) != 1 || path.MatchedHops[0].TTL != 2 || path.MatchedHops[0].PacketLoss != 20 {
+		t.Fatalf("path = %+v, %v", path, ok)
+	}
+	if path.Current || path.Target != "192.0.2.10" || path.AvgLatency != 30 {
+		t.Errorf("path = %+v, want not current, target from payload, health from latest trace", path)
+	}
+
+	// Substring hits that are not hops ("198.51.100." in a hostname) are dropped.
+	falsePositive := `{"report":{"hops":[{"ttl":1,"hosts":[{"ip":"10.0.0.1","hostname":"198.51.100.5.example"}]}]}}`
+	if _, ok := matchRouteSearchRow(routeSearchRow{MatchPayload: falsePositive}, prefix); ok {
+		t.Error("hostname substring matched as a hop")
+	}
+}
+
+func TestRouteSearchHealthAndOrder(t *testing.T) {
+	out := &RouteSearchResult{Paths: []RouteSearchPath{
+		{AgentID: 1, AgentName: "b", Target: "192.0.2.10:443", Current: true, AvgLatency: 5, HealthSource: "mtr"},
+		{AgentID: 2, AgentName: "a", Target: "192.0.2.10", Current: false, PacketLoss: 80},
+		{AgentID: 3, AgentName: "c", Target: "192.0.2.20", Current: true},
+	}}
+	applyRouteSearchHealth(out.Paths, map[string]pingStats{
+		"1:192.0.2.10": {AvgLatency: 150, Count: 10},
+	})
+	if p := out.Paths[0]; p.HealthSource != "ping" || p.Status != "degraded" {
+		t.Errorf("ping health not applied: %+v", p)
+	}
+	summarizeRouteSearch(out)
+	if out.AffectedAgents != 3 || out.AffectedTargets != 3 || out.CurrentPaths != 2 {
+		t.Errorf("summary = %+v", out)
+	}
+	if out.Paths[0].AgentID != 1 || out.Paths[1].AgentID != 3 || out.Paths[2].AgentID != 2 {
+		t.Errorf("order = %d, %d, %d; want current paths first, worst health first", out.Paths[0].AgentID, out.Paths[1].AgentID, out.Paths[2].AgentID)
+	}
+}
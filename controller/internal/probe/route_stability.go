@@ -0,0 +1,389 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Historical Route Stability ──
+//
+// Answers "how often does our path to X change" over weeks rather than the
+// live route analysis' hours. MTR traces are sampled at one per path per
+// interval (range / routeStabilityBuckets, at least 5 minutes) so a 90-day
+// report reads a bounded number of payloads; route flaps shorter than the
+// interval can be missed and the interval is returned with the report.
+//
+// Traces are clustered into route variants: an exact hop-sequence match,
+// or ≥ routeEcmpSimilarityThreshold hop-set overlap (ECMP / load-balanced
+// hops) joins an existing variant. A change is recorded whenever
+// consecutive samples fall into different variants.
+
+const (
+	// routeStabilityBuckets is the target number of samples per path.
+	routeStabilityBuckets = 1440
+	// RouteStabilityMaxRange bounds the report range.
+	RouteStabilityMaxRange = 90 * 24 * time.Hour
+	// maxRouteStabilityChanges caps the change events returned per path
+	// (newest kept); ChangeCount still counts all of them.
+	maxRouteStabilityChanges = 200
+	maxRouteStabilityRows    = 100000
+)
+
+// RouteStabilityReport is the per-destination route history of a workspace.
+type RouteStabilityReport struct {
+	WorkspaceID           uint                        `json:"workspace_id"`
+	From                  time.Time                   `json:"from"`
+	To                    time.Time                   `json:"to"`
+	SampleIntervalSeconds int                         `json:"sample_interval_seconds"`
+	Destinations          []RouteStabilityDestination `json:"destinations"`
+}
+
+// RouteStabilityDestination groups every traced path to one destination.
+type RouteStabilityDestination struct {
+	Target          string               `json:"target"`
+	TargetIP        string               `json:"target_ip,omitempty"`
+	TargetAgentID   uint                 `json:"target_agent_id,omitempty"`
+	Paths           []RouteStabilityPath `json:"paths"`
+	TotalChanges    int                  `json:"total_changes"`
+	MaxUniqueRoutes int                  `json:"max_unique_routes"`
+}
+
+// RouteStabilityPath is the route history of one (probe, reporting agent) pair.
+type RouteStabilityPath struct {
+	ProbeID          uint               `json:"probe_id"`
+	AgentID          uint               `json:"agent_id"`
+	AgentName        string             `json:"agent_name"`
+	Traces           int                `json:"traces"`
+	FirstTrace       time.Time          `json:"first_trace"`
+	LastTrace        time.Time          `json:"last_trace"`
+	UniqueRoutes     int                `json:"unique_routes"`
+	DominantSharePct float64            `json:"dominant_share_pct"`
+	ChangeCount      int                `json:"change_count"`
+	ChangesPerDay    float64            `json:"changes_per_day"`
+	Routes           []RouteVariant     `json:"routes"`
+	Changes          []RouteChangeEvent `json:"changes"`
+}
+
+// RouteVariant is one distinct route seen on a path.
+type RouteVariant struct {
+	ID        int       `json:"id"`
+	Hops      []string  `json:"hops"` // hop IPs in order, "*" for silent hops
+	Traces    int       `json:"traces"`
+	SharePct  float64   `json:"share_pct"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// RouteChangeEvent is a switch between two route variants.
+type RouteChangeEvent struct {
+	At            time.Time `json:"at"`
+	FromRoute     int       `json:"from_route"`
+	ToRoute       int       `json:"to_route"`
+	HopsAdded     []string  `json:"hops_added,omitempty"`
+	HopsRemoved   []string  `json:"hops_removed,omitempty"`
+	DifferingHops []HopDiff `json:"differing_hops,omitempty"`
+}
+
+// HopDiff is a hop position whose responder changed.
+type HopDiff struct {
+	Hop  int    `json:"hop"` // 1-based
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RouteStabilityFilter narrows a report. Zero values mean "all".
+type RouteStabilityFilter struct {
+	From    time.Time
+	To      time.Time
+	Target  string // case-insensitive substring of target, IP or agent name
+	ProbeID uint
+	AgentID uint
+}
+
+// routeStabilityInterval returns the sampling interval for a range.
+func routeStabilityInterval(rng time.Duration) time.Duration {
+	iv := (rng / routeStabilityBuckets).Truncate(time.Minute)
+	if iv < 5*time.Minute {
+		iv = 5 * time.Minute
+	}
+	return iv
+}
+
+// ComputeRouteStabilityReport builds the per-destination report.
+func ComputeRouteStabilityReport(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID uint, f RouteStabilityFilter) (*RouteStabilityReport, error) {
+	if f.To.IsZero() {
+		f.To = time.Now().UTC()
+	}
+	if f.From.IsZero() {
+		f.From = f.To.Add(-30 * 24 * time.Hour)
+	}
+	if !f.From.Before(f.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrBadInput)
+	}
+	if f.To.Sub(f.From) > RouteStabilityMaxRange {
+		return nil, fmt.Errorf("%w: range exceeds %d days", ErrBadInput, int(RouteStabilityMaxRange.Hours()/24))
+	}
+	interval := routeStabilityInterval(f.To.Sub(f.From))
+
+	report := &RouteStabilityReport{
+		WorkspaceID:           workspaceID,
+		From:                  f.From,
+		To:                    f.To,
+		SampleIntervalSeconds: int(interval.Seconds()),
+		Destinations:          []RouteStabilityDestination{},
+	}
+
+	agents, err := getWorkspaceAgents(ctx, pg, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("get agents: %w", err)
+	}
+	agentByID := make(map[uint]agentInfo, len(agents))
+	var agentIDs []uint
+	for _, a := range agents {
+		agentByID[a.ID] = a
+		if f.AgentID == 0 || a.ID == f.AgentID {
+			agentIDs = append(agentIDs, a.ID)
+		}
+	}
+	if len(agentIDs) == 0 {
+		return report, nil
+	}
+
+	byPath, err := getSampledMTRByPath(ctx, ch, agentIDs, f, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	type destKey struct {
+		target      string
+		targetAgent uint
+	}
+	dests := make(map[destKey]*RouteStabilityDestination)
+	needle := strings.ToLower(strings.TrimSpace(f.Target))
+	for key, rows := range byPath {
+		// resolveMTRTarget reads the newest row first.
+		target, targetIP, _ := resolveMTRTarget(agentByID, []ProbeData{rows[len(rows)-1]}, key.targetAgent)
+		if target == "" {
+			continue
+		}
+		agentName := agentByID[key.agentID].Name
+		if needle != "" && !strings.Contains(strings.ToLower(target), needle) &&
+			!strings.Contains(targetIP, needle) && !strings.Contains(strings.ToLower(agentName), needle) {
+			continue
+		}
+		path := buildRouteStabilityPath(rows)
+		if path.Traces == 0 {
+			continue
+		}
+		path.ProbeID, path.AgentID, path.AgentName = key.probeID, key.agentID, agentName
+
+		dk := destKey{target: target, targetAgent: key.targetAgent}
+		d, ok := dests[dk]
+		if !ok {
+			d = &RouteStabilityDestination{Target: target, TargetIP: targetIP, TargetAgentID: key.targetAgent}
+			dests[dk] = d
+		}
+		d.Paths = append(d.Paths, path)
+		d.TotalChanges += path.ChangeCount
+		if path.UniqueRoutes > d.MaxUniqueRoutes {
+			d.MaxUniqueRoutes = path.UniqueRoutes
+		}
+	}
+
+	for _, d := range dests {
+		sort.Slice(d.Paths, func(i, j int) bool {
+			if d.Paths[i].ChangeCount != d.Paths[j].ChangeCount {
+				return d.Paths[i].ChangeCount > d.Paths[j].ChangeCount
+			}
+			return d.Paths[i].ProbeID < d.Paths[j].ProbeID
+		})
+		report.Destinations = append(report.Destinations, *d)
+	}
+	// Least stable destinations first.
+	sort.Slice(report.Destinations, func(i, j int) bool {
+		a, b := report.Destinations[i], report.Destinations[j]
+		if a.TotalChanges != b.TotalChanges {
+			return a.TotalChanges > b.TotalChanges
+		}
+		return a.Target < b.Target
+	})
+	return report, nil
+}
+
+// buildRouteStabilityPath clusters oldest-first traces into route variants
+// and records the changes between them.
+func buildRouteStabilityPath(rows []ProbeData) RouteStabilityPath {
+	var path RouteStabilityPath
+	var variants []*RouteVariant
+	bySig := make(map[string]int)
+	prev := -1
+	var prevHops []string
+
+	for _, row := range rows {
+		var mp MtrPayload
+		if err := json.Unmarshal(row.Payload, &mp); err != nil || len(mp.Report.Hops) == 0 {
+			continue
+		}
+		sig := getMtrRouteSignature(mp.Report.Hops)
+		hops := strings.Split(sig, "->")
+		if len(filterProbeRouteHops(hops)) == 0 {
+			continue
+		}
+
+		idx, ok := bySig[sig]
+		if !ok {
+			idx = -1
+			best := 0.0
+			for i, v := range variants {
+				if j := hopSetJaccard(v.Hops, hops); j >= routeEcmpSimilarityThreshold && j > best {
+					idx, best = i, j
+				}
+			}
+			if idx < 0 {
+				variants = append(variants, &RouteVariant{ID: len(variants) + 1, Hops: hops, FirstSeen: row.CreatedAt})
+				idx = len(variants) - 1
+			}
+			bySig[sig] = idx
+		}
+
+		v := variants[idx]
+		v.Traces++
+		v.LastSeen = row.CreatedAt
+		if path.Traces == 0 {
+			path.FirstTrace = row.CreatedAt
+		}
+		path.LastTrace = row.CreatedAt
+		path.Traces++
+
+		if prev >= 0 && idx != prev {
+			path.ChangeCount++
+			added, removed := diffHopsOrdered(prevHops, hops)
+			path.Changes = append(path.Changes, RouteChangeEvent{
+				At:            row.CreatedAt,
+				FromRoute:     variants[prev].ID,
+				ToRoute:       v.ID,
+				HopsAdded:     added,
+				HopsRemoved:   removed,
+				DifferingHops: diffHopPositions(prevHops, hops),
+			})
+		}
+		prev, prevHops = idx, hops
+	}
+
+	if len(path.Changes) > maxRouteStabilityChanges {
+		path.Changes = path.Changes[len(path.Changes)-maxRouteStabilityChanges:]
+	}
+	if path.Changes == nil {
+		path.Changes = []RouteChangeEvent{}
+	}
+	path.Routes = make([]RouteVariant, 0, len(variants))
+	for _, v := range variants {
+		v.SharePct = sanitizeFloat(float64(v.Traces) / float64(path.Traces) * 100)
+		if v.SharePct > path.DominantSharePct {
+			path.DominantSharePct = v.SharePct
+		}
+		path.Routes = append(path.Routes, *v)
+	}
+	sort.Slice(path.Routes, func(i, j int) bool { return path.Routes[i].Traces > path.Routes[j].Traces })
+	path.UniqueRoutes = len(variants)
+	if days := path.LastTrace.Sub(path.FirstTrace).Hours() / 24; days >= 1 {
+		path.ChangesPerDay = sanitizeFloat(float64(path.ChangeCount) / days)
+	} else {
+		path.ChangesPerDay = float64(path.ChangeCount)
+	}
+	return path
+}
+
+// diffHopPositions lists hop positions whose responder differs. Silent
+// hops ("*") on either side are not counted as changes; a hop present on
+// one side only is reported with an empty counterpart.
+func diffHopPositions(a, b []string) []HopDiff {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	var out []HopDiff
+	for i := 0; i < n; i++ {
+		var from, to string
+		if i < len(a) {
+			from = a[i]
+		}
+		if i < len(b) {
+			to = b[i]
+		}
+		if from == to || from == "*" || to == "*" {
+			continue
+		}
+		out = append(out, HopDiff{Hop: i + 1, From: from, To: to})
+	}
+	return out
+}
+
+// getSampledMTRByPath reads at most one MTR trace per path per interval,
+// grouped like getWorkspaceMTRByPath but sorted oldest-first.
+func getSampledMTRByPath(ctx context.Context, ch *sql.DB, agentIDs []uint, f RouteStabilityFilter, interval time.Duration) (map[mtrPathKey][]ProbeData, error) {
+	idStrs := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		idStrs[i] = fmt.Sprintf("%d", id)
+	}
+	probeFilter := ""
+	if f.ProbeID != 0 {
+		probeFilter = fmt.Sprintf("AND probe_id = %d", f.ProbeID)
+	}
+
+	q := fmt.Sprintf(`
+SELECT
+    created_at,
+    probe_id,
+    agent_id,
+    probe_agent_id,
+    target_agent,
+    payload_raw
+FROM probe_data
+WHERE type = 'MTR'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at < %s
+  %s
+ORDER BY probe_id, agent_id, target_agent, created_at ASC
+LIMIT 1 BY probe_id, agent_id, target_agent, toStartOfInterval(created_at, INTERVAL %d SECOND)
+LIMIT %d
+`, strings.Join(idStrs, ", "), chQuoteTime(f.From), chQuoteTime(f.To), probeFilter, int(interval.Seconds()), maxRouteStabilityRows)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("mtr stability query: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[mtrPathKey][]ProbeData)
+	for rows.Next() {
+		var createdAt time.Time
+		var probeID, agentID, probeAgentID, targetAgent uint64
+		var payloadRaw string
+		if err := rows.Scan(&createdAt, &probeID, &agentID, &probeAgentID, &targetAgent, &payloadRaw); err != nil {
+			continue
+		}
+		if probeAgentID == 0 {
+			probeAgentID = agentID
+		}
+		key := mtrPathKey{probeID: uint(probeID), agentID: uint(agentID), targetAgent: uint(targetAgent), probeAgentID: uint(probeAgentID)}
+		out[key] = append(out[key], ProbeData{
+			CreatedAt:    createdAt,
+			Type:         TypeMTR,
+			ProbeID:      uint(probeID),
+			ProbeAgentID: uint(probeAgentID),
+			AgentID:      uint(agentID),
+			TargetAgent:  uint(targetAgent),
+			Payload:      []byte(payloadRaw),
+		})
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+package probe
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func stabilityTrace(t *testing.T, at time.Time, hops ...string) ProbeData {
+	t.Helper()
+	var p MtrPayload
+	for i, ip := range hops {
+		h := MtrHop{TTL: i + 1}
+		if ip != "*" {
+			h.Hosts = []MtrHopHost{{IP: ip}}
+		}
+		p.Report.Hops = append(p.Report.Hops, h)
+	}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ProbeData{CreatedAt: at, Type: TypeMTR, Payload: raw}
+}
+
+// TestBuildRouteStabilityPath: distinct routes become variants with
+// shares, a switch and switch-back produce two change events naming the
+// differing hop, and an ECMP sibling joins the existing variant.
+func TestBuildRouteStabilityPath(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := []ProbeData{
+		stabilityTrace(t, t0, "10.0.0.1", "1.1.1.1", "2.2.2.2", "3.3.3.3", "9.9.9.9"),
+		stabilityTrace(t, t0.Add(1*time.Hour), "10.0.0.1", "1.1.1.1", "2.2.2.2", "3.3.3.3", "9.9.9.9"),
+		// One silent hop: same hop set, joins route 1.
+		stabilityTrace(t, t0.Add(2*time.Hour), "10.0.0.1", "1.1.1.1", "*", "3.3.3.3", "9.9.9.9"),
+		// Transit swapped: new route.
+		stabilityTrace(t, t0.Add(3*time.Hour), "10.0.0.1", "5.5.5.5", "6.6.6.6", "7.7.7.7", "9.9.9.9"),
+		stabilityTrace(t, t0.Add(48*time.Hour), "10.0.0.1", "1.1.1.1", "2.2.2.2", "3.3.3.3", "9.9.9.9"),
+		{CreatedAt: t0.Add(49 * time.Hour), Payload: []byte("not json")},
+	}
+
+	p := buildRouteStabilityPath(rows)
+	if p.Traces != 5 || p.UniqueRoutes != 2 || p.ChangeCount != 2 {
+		t.Fatalf("traces=%d routes=%d changes=%d", p.Traces, p.UniqueRoutes, p.ChangeCount)
+	}
+	if p.Routes[0].ID != 1 || p.Routes[0].Traces != 4 || p.Routes[0].SharePct != 80 || p.DominantSharePct != 80 {
+		t.Errorf("dominant route: %+v", p.Routes[0])
+	}
+	if !p.Routes[1].FirstSeen.Equal(t0.Add(3 * time.Hour)) {
+		t.Errorf("route 2 first seen %v", p.Routes[1].FirstSeen)
+	}
+
+	c := p.Changes[0]
+	if c.FromRoute != 1 || c.ToRoute != 2 || !c.At.Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("first change: %+v", c)
+	}
+	// Hop 3 was silent in the previous trace, so only hops 2 and 4 differ.
+	if len(c.DifferingHops) != 2 || c.DifferingHops[0].Hop != 2 || c.DifferingHops[0].To != "5.5.5.5" || c.DifferingHops[1].Hop != 4 {
+		t.Errorf("differing hops: %+v", c.DifferingHops)
+	}
+	if len(c.HopsAdded) != 3 || len(c.HopsRemoved) != 2 {
+		t.Errorf("added=%v removed=%v", c.HopsAdded, c.HopsRemoved)
+	}
+	if p.Changes[1].FromRoute != 2 || p.Changes[1].ToRoute != 1 {
+		t.Errorf("second change: %+v", p.Changes[1])
+	}
+	if p.ChangesPerDay != 1 {
+		t.Errorf("changes per day = %v", p.ChangesPerDay)
+	}
+}
+
+func TestRouteStabilityInterval(t *testing.T) {
+	if got := routeStabilityInterval(24 * time.Hour); got != 5*time.Minute {
+		t.Errorf("1 day: %s", got)
+	}
+	if got := routeStabilityInterval(30 * 24 * time.Hour); got != 30*time.Minute {
+		t.Errorf("30 days: %s", got)
+	}
+}
@@ -0,0 +1,272 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Runbooks ──
+//
+// Built-in remediation (suggestRemediation, buildFindings) is generic by
+// necessity. Runbooks let workspace admins attach their own steps and
+// links — "page the WAN on-call", "open a ticket with carrier X" — to a
+// finding category and an optional target glob. Matching runbooks are
+// appended to AnalysisFinding.Steps and DetectedIncident.Recommendations
+// when analysis is served.
+//
+// Category matches, in order of what is available on the item:
+//   - findings: Category (performance, routing, …) or an ID prefix
+//     (e.g. "route_instability")
+//   - incidents: Scope (infrastructure, agent-specific, target-specific)
+//     or an ID prefix (e.g. "dns_", "pmtu_blackhole")
+//
+// "*" matches every category. TargetPattern is a path.Match glob
+// ("10.1.*", "*.example.com"); empty matches any target.
+
+// RunbookCategoryAny matches every finding and incident.
+const RunbookCategoryAny = "*"
+
+// RunbookLink is a titled URL shown alongside the steps.
+type RunbookLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Runbook is a workspace-defined remediation playbook.
+type Runbook struct {
+	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	WorkspaceID   uint           `gorm:"index;not null" json:"workspace_id"`
+	Name          string         `gorm:"size:128;not null" json:"name"`
+	Category      string         `gorm:"size:64;not null" json:"category"`
+	TargetPattern string         `gorm:"size:256" json:"target_pattern,omitempty"`
+	Steps         datatypes.JSON `gorm:"type:jsonb" json:"steps"` // []string
+	Links         datatypes.JSON `gorm:"type:jsonb" json:"links"` // []RunbookLink
+	Enabled       bool           `gorm:"not null" json:"enabled"`
+}
+
+func (Runbook) TableName() string { return "runbooks" }
+
+// RunbookInput is the create/update body.
+type RunbookInput struct {
+	Name          string        `json:"name"`
+	Category      string        `json:"category"`
+	TargetPattern string        `json:"target_pattern"`
+	Steps         []string      `json:"steps"`
+	Links         []RunbookLink `json:"links"`
+	Enabled       *bool         `json:"enabled"`
+}
+
+// validate normalizes and checks the input.
+func (in *RunbookInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Category = strings.TrimSpace(in.Category)
+	in.TargetPattern = strings.TrimSpace(in.TargetPattern)
+	if in.Name == "" || in.Category == "" {
+		return fmt.Errorf("%w: name and category required", ErrBadInput)
+	}
+	if in.TargetPattern != "" {
+		if _, err := path.Match(in.TargetPattern, ""); err != nil {
+			return fmt.Errorf("%w: invalid target_pattern: %v", ErrBadInput, err)
+		}
+	}
+	steps := []string{}
+	for _, s := range in.Steps {
+		if s = strings.TrimSpace(s); s != "" {
+			steps = append(steps, s)
+		}
+	}
+	in.Steps = steps
+	if in.Links == nil {
+		in.Links = []RunbookLink{}
+	}
+	for _, l := range in.Links {
+		if !strings.HasPrefix(l.URL, "http://") && !strings.HasPrefix(l.URL, "https://") {
+			return fmt.Errorf("%w: link %q must be an http(s) URL", ErrBadInput, l.URL)
+		}
+	}
+	if len(in.Steps) == 0 && len(in.Links) == 0 {
+		return fmt.Errorf("%w: at least one step or link required", ErrBadInput)
+	}
+	return nil
+}
+
+func (in RunbookInput) apply(r *Runbook) {
+	r.Name = in.Name
+	r.Category = in.Category
+	r.TargetPattern = in.TargetPattern
+	steps, _ := json.Marshal(in.Steps)
+	links, _ := json.Marshal(in.Links)
+	r.Steps = datatypes.JSON(steps)
+	r.Links = datatypes.JSON(links)
+	if in.Enabled != nil {
+		r.Enabled = *in.Enabled
+	}
+}
+
+// ListRunbooks returns a workspace's runbooks.
+func ListRunbooks(ctx context.Context, db *gorm.DB, workspaceID uint) ([]Runbook, error) {
+	var out []Runbook
+	err := db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("category ASC, name ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// CreateRunbook adds a runbook to a workspace.
+func CreateRunbook(ctx context.Context, db *gorm.DB, workspaceID uint, in RunbookInput) (*Runbook, error) {
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	r := &Runbook{WorkspaceID: workspaceID, Enabled: true}
+	in.apply(r)
+	if err := db.WithContext(ctx).Create(r).Error; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateRunbook replaces a runbook's definition.
+func UpdateRunbook(ctx context.Context, db *gorm.DB, workspaceID, id uint, in RunbookInput) (*Runbook, error) {
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	var r Runbook
+	err := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	in.apply(&r)
+	if err := db.WithContext(ctx).Save(&r).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteRunbook removes a runbook.
+func DeleteRunbook(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).Delete(&Runbook{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ── Matching ──
+
+// compiledRunbook is a decoded runbook ready for matching.
+type compiledRunbook struct {
+	category string
+	pattern  string
+	lines    []string // steps, then "title: url" links
+}
+
+// loadRunbooks decodes a workspace's enabled runbooks. Errors degrade to
+// none so analysis never fails on a runbook lookup.
+func loadRunbooks(ctx context.Context, db *gorm.DB, workspaceID uint) []compiledRunbook {
+	if db == nil {
+		return nil
+	}
+	rows, err := ListRunbooks(ctx, db, workspaceID)
+	if err != nil {
+		return nil
+	}
+	var out []compiledRunbook
+	for _, r := range rows {
+		if !r.Enabled {
+			continue
+		}
+		out = append(out, compileRunbook(r))
+	}
+	return out
+}
+
+func compileRunbook(r Runbook) compiledRunbook {
+	var steps []string
+	var links []RunbookLink
+	_ = json.Unmarshal(r.Steps, &steps)
+	_ = json.Unmarshal(r.Links, &links)
+	lines := append([]string(nil), steps...)
+	for _, l := range links {
+		title := l.Title
+		if title == "" {
+			title = r.Name
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", title, l.URL))
+	}
+	return compiledRunbook{category: r.Category, pattern: r.TargetPattern, lines: lines}
+}
+
+// matches reports whether the runbook applies to an item with the given
+// category/scope, ID and targets.
+func (rb compiledRunbook) matches(category, id string, targets []string) bool {
+	if rb.category != RunbookCategoryAny && rb.category != category && !strings.HasPrefix(id, rb.category) {
+		return false
+	}
+	if rb.pattern == "" {
+		return true
+	}
+	for _, t := range targets {
+		for _, cand := range []string{t, stripPort(t)} {
+			if ok, _ := path.Match(rb.pattern, cand); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeSteps appends lines not already present.
+func mergeSteps(steps []string, lines []string) []string {
+	seen := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		seen[s] = true
+	}
+	for _, l := range lines {
+		if !seen[l] {
+			seen[l] = true
+			steps = append(steps, l)
+		}
+	}
+	return steps
+}
+
+// applyRunbooksToFindings merges matching runbook steps into findings
+// for a probe whose target is target.
+func applyRunbooksToFindings(runbooks []compiledRunbook, target string, findings []AnalysisFinding) {
+	for i := range findings {
+		for _, rb := range runbooks {
+			if rb.matches(findings[i].Category, findings[i].ID, []string{target}) {
+				findings[i].Steps = mergeSteps(findings[i].Steps, rb.lines)
+			}
+		}
+	}
+}
+
+// applyRunbooksToIncidents merges matching runbook steps into incident
+// recommendations.
+func applyRunbooksToIncidents(runbooks []compiledRunbook, incidents []DetectedIncident) {
+	for i := range incidents {
+		for _, rb := range runbooks {
+			if rb.matches(incidents[i].Scope, incidents[i].ID, incidents[i].AffectedTargets) {
+				incidents[i].Recommendations = mergeSteps(incidents[i].Recommendations, rb.lines)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestRunbooksMergeIntoIncidentsAndFindings verifies category/ID-prefix
+// and target-glob matching, link formatting, and de-duplication.
+func TestRunbooksMergeIntoIncidentsAndFindings(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&Runbook{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := CreateRunbook(ctx, db, 1, RunbookInput{
+		Name:          "Carrier escalation",
+		Category:      "infrastructure",
+		TargetPattern: "10.1.*",
+		Steps:         []string{"Open a ticket with carrier X", " "},
+		Links:         []RunbookLink{{Title: "Carrier portal", URL: "https://carrier.example.com"}},
+	}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := CreateRunbook(ctx, db, 1, RunbookInput{
+		Name:     "Routing",
+		Category: "route_",
+		Steps:    []string{"Check BGP session state on the edge routers"},
+	}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	off := false
+	if _, err := CreateRunbook(ctx, db, 1, RunbookInput{Name: "Off", Category: "*", Steps: []string{"never"}, Enabled: &off}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := CreateRunbook(ctx, db, 1, RunbookInput{Name: "bad", Category: "x", Links: []RunbookLink{{URL: "javascript:alert(1)"}}}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("non-http link: err = %v, want ErrBadInput", err)
+	}
+
+	runbooks := loadRunbooks(ctx, db, 1)
+	if len(runbooks) != 2 {
+		t.Fatalf("expected 2 enabled runbooks, got %d", len(runbooks))
+	}
+
+	incidents := []DetectedIncident{
+		{ID: "shared_target_10_1_0_5", Scope: "infrastructure", AffectedTargets: []string{"10.1.0.5:443"}, Recommendations: []string{"Open a ticket with carrier X"}},
+		{ID: "shared_target_10_2_0_5", Scope: "infrastructure", AffectedTargets: []string{"10.2.0.5"}},
+	}
+	applyRunbooksToIncidents(runbooks, incidents)
+	if got := incidents[0].Recommendations; len(got) != 2 || got[1] != "Carrier portal: https://carrier.example.com" {
+		t.Errorf("matched incident recommendations = %v", got)
+	}
+	if len(incidents[1].Recommendations) != 0 {
+		t.Errorf("non-matching target got runbook steps: %v", incidents[1].Recommendations)
+	}
+
+	findings := []AnalysisFinding{{ID: "route_instability", Category: "routing"}, {ID: "overall_poor", Category: "performance"}}
+	applyRunbooksToFindings(runbooks, "8.8.8.8", findings)
+	if len(findings[0].Steps) != 1 || len(findings[1].Steps) != 0 {
+		t.Errorf("finding steps = %v / %v", findings[0].Steps, findings[1].Steps)
+	}
+}
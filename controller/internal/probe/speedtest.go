@@ -4,8 +4,6 @@ import (
 	"context"
 	"database/sql"
 	"time"
-
-	log "github.com/sirupsen/logrus"
 )
 
 func initSpeedtest(db *sql.DB) {
@@ -15,16 +13,32 @@ func initSpeedtest(db *sql.DB) {
 			return nil
 		},
 		func(ctx context.Context, data ProbeData, p SpeedTestResult) error {
-			if err := SaveRecordCH(ctx, db, data, string(TypeSpeedtest), p); err != nil {
-				log.WithError(err).Error("save speedtest record (CH)")
+			if err := SaveSpeedtestCH(ctx, db, data, string(TypeSpeedtest), p); err != nil {
+				ingestEntry(data).WithError(err).Error("save speedtest record (CH)")
 				return err
 			}
 
-			log.Printf("[speedtest] pid=%d servers=%d timestamp=%v",
+			ingestEntry(data).Infof("[speedtest] pid=%d servers=%d timestamp=%v",
 				data.ProbeID, len(p.TestData), p.Timestamp)
 			return nil
 		},
 	))
+
+	// Server lists uploaded as probe results; the agents' cached lists for
+	// the panel come over the speedtest_servers event instead.
+	Register(NewHandler[[]SpeedTestServer](
+		TypeSpeedtestServer,
+		func(p []SpeedTestServer) error {
+			return nil
+		},
+		func(ctx context.Context, data ProbeData, p []SpeedTestServer) error {
+			if err := SaveSpeedtestCH(ctx, db, data, string(TypeSpeedtestServer), p); err != nil {
+				ingestEntry(data).WithError(err).Error("save speedtest servers record (CH)")
+				return err
+			}
+			return nil
+		},
+	))
 }
 
 type SpeedTestResult struct {
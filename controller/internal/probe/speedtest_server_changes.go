@@ -0,0 +1,211 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Speedtest Server Changes ──
+//
+// Speedtest results depend heavily on the server tested against: an
+// agent that auto-selects a different server, or is pointed at one, can
+// lose half its measured bandwidth without anything changing on its
+// circuit. speedtest_data records the tested server of every result
+// (server_id, server_name, server_host). A server is identified by its
+// ID, or by its host when the agent reported no ID.
+//
+// GetSpeedtestServerChanges lists every result whose server differs from
+// the agent's previous result. Bandwidth regression detection compares
+// the usual server of the baseline with that of the current window: when
+// it changed, the regression is reported as an info-severity measurement
+// artifact instead of a warning or critical degradation.
+
+// speedtestServerChangesLimit caps the rows scanned for server changes.
+const speedtestServerChangesLimit = 20000
+
+// SpeedtestServerChange is one switch of an agent's speedtest server.
+type SpeedtestServerChange struct {
+	AgentID        uint      `json:"agent_id"`
+	ProbeID        uint      `json:"probe_id"`
+	At             time.Time `json:"at"` // first result on the new server
+	FromServerID   string    `json:"from_server_id"`
+	FromServerName string    `json:"from_server_name,omitempty"`
+	FromServerHost string    `json:"from_server_host,omitempty"`
+	ToServerID     string    `json:"to_server_id"`
+	ToServerName   string    `json:"to_server_name,omitempty"`
+	ToServerHost   string    `json:"to_server_host,omitempty"`
+	// Download of the results either side of the switch.
+	DownloadBeforeMbps float64 `json:"download_before_mbps"`
+	DownloadAfterMbps  float64 `json:"download_after_mbps"`
+}
+
+// speedtestServerRow is one SPEEDTEST result's server and download.
+type speedtestServerRow struct {
+	AgentID    uint
+	ProbeID    uint
+	At         time.Time
+	ServerID   string
+	ServerName string
+	ServerHost string
+	DLBps      float64
+}
+
+// speedtestServerKey identifies a tested server; "" when the result
+// names none.
+func speedtestServerKey(id, host string) string {
+	if id = strings.TrimSpace(id); id != "" {
+		return id
+	}
+	return strings.ToLower(strings.TrimSpace(host))
+}
+
+// GetSpeedtestServerChanges returns the server switches of the agents'
+// SPEEDTEST results in [from, to), oldest first. The first result in the
+// window is compared with the last one before it.
+func GetSpeedtestServerChanges(ctx context.Context, ch *sql.DB, agentIDs []uint, from, to time.Time) ([]SpeedtestServerChange, error) {
+	if len(agentIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	idList := strings.Join(ids, ", ")
+
+	// The last result before the window, so a switch at its start counts.
+	prev := make(map[uint]speedtestServerRow)
+	lastBefore := fmt.Sprintf(`
+SELECT agent_id, probe_id, created_at, server_id, server_name, server_host, dl_bps
+FROM speedtest_data
+WHERE type = 'SPEEDTEST'
+  AND agent_id = %%d
+  AND server_count > 0
+  AND created_at < %s
+ORDER BY created_at DESC
+LIMIT 1
+`, chQuoteTime(from))
+	for _, id := range agentIDs {
+		rows, err := scanSpeedtestServerRows(ch.QueryContext(ctx, fmt.Sprintf(lastBefore, id)))
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 1 {
+			prev[id] = rows[0]
+		}
+	}
+
+	q := fmt.Sprintf(`
+SELECT agent_id, probe_id, created_at, server_id, server_name, server_host, dl_bps
+FROM speedtest_data
+WHERE type = 'SPEEDTEST'
+  AND agent_id IN (%s)
+  AND server_count > 0
+  AND created_at >= %s
+  AND created_at < %s
+ORDER BY created_at
+LIMIT %d
+`, idList, chQuoteTime(from), chQuoteTime(to), speedtestServerChangesLimit)
+	rows, err := scanSpeedtestServerRows(ch.QueryContext(ctx, q))
+	if err != nil {
+		return nil, err
+	}
+	return speedtestServerChanges(prev, rows), nil
+}
+
+func scanSpeedtestServerRows(rs *sql.Rows, err error) ([]speedtestServerRow, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	var out []speedtestServerRow
+	for rs.Next() {
+		var agentID, probeID uint64
+		var r speedtestServerRow
+		if err := rs.Scan(&agentID, &probeID, &r.At, &r.ServerID, &r.ServerName, &r.ServerHost, &r.DLBps); err != nil {
+			return nil, err
+		}
+		r.AgentID, r.ProbeID, r.At = uint(agentID), uint(probeID), r.At.UTC()
+		out = append(out, r)
+	}
+	return out, rs.Err()
+}
+
+// speedtestServerChanges walks each agent's results in time order and
+// records every change of server. prev holds the result before the first
+// of rows, per agent. Results without a server are skipped.
+func speedtestServerChanges(prev map[uint]speedtestServerRow, rows []speedtestServerRow) []SpeedtestServerChange {
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].At.Before(rows[j].At) })
+	last := make(map[uint]speedtestServerRow, len(prev))
+	for id, r := range prev {
+		last[id] = r
+	}
+	var out []SpeedtestServerChange
+	for _, r := range rows {
+		key := speedtestServerKey(r.ServerID, r.ServerHost)
+		if key == "" {
+			continue
+		}
+		p, ok := last[r.AgentID]
+		last[r.AgentID] = r
+		if !ok || speedtestServerKey(p.ServerID, p.ServerHost) == key {
+			continue
+		}
+		out = append(out, SpeedtestServerChange{
+			AgentID:            r.AgentID,
+			ProbeID:            r.ProbeID,
+			At:                 r.At,
+			FromServerID:       p.ServerID,
+			FromServerName:     p.ServerName,
+			FromServerHost:     p.ServerHost,
+			ToServerID:         r.ServerID,
+			ToServerName:       r.ServerName,
+			ToServerHost:       r.ServerHost,
+			DownloadBeforeMbps: roundTo(p.DLBps/1_000_000, 2),
+			DownloadAfterMbps:  roundTo(r.DLBps/1_000_000, 2),
+		})
+	}
+	return out
+}
+
+// usualSpeedtestServer returns the server most results ran against, the
+// lexically first on a tie, and its share of counted results.
+func usualSpeedtestServer(servers map[string]int) (string, float64) {
+	best, bestN, total := "", 0, 0
+	for k, n := range servers {
+		total += n
+		if n > bestN || (n == bestN && k < best) {
+			best, bestN = k, n
+		}
+	}
+	if total == 0 {
+		return "", 0
+	}
+	return best, float64(bestN) / float64(total)
+}
+
+// speedtestServerSwitch reports whether the usual server of the current
+// window differs from the baseline's, and names both. Windows whose
+// results name no server are not compared.
+func speedtestServerSwitch(base, curr speedtestStats) (from, to string, switched bool) {
+	from, _ = usualSpeedtestServer(base.Servers)
+	to, _ = usualSpeedtestServer(curr.Servers)
+	return from, to, from != "" && to != "" && from != to
+}
+
+// markSpeedtestServerArtifact turns a bandwidth regression into an info
+// incident explained by the server switch.
+func markSpeedtestServerArtifact(inc *DetectedIncident, direction string, before, after float64, from, to string) {
+	inc.Severity = "info"
+	inc.MeasurementArtifact = true
+	inc.Confidence = 0.3
+	inc.SuggestedCause = fmt.Sprintf("%s speed dropped from %.1f Mbps to %.1f Mbps, but the speedtest server changed from %s to %s — likely a measurement artifact of the new server rather than a real degradation", direction, before, after, from, to)
+	inc.Evidence = append(inc.Evidence, fmt.Sprintf("Usual speedtest server changed from %s to %s", from, to))
+	inc.Recommendations = []string{
+		fmt.Sprintf("Queue a speedtest against server %s to compare like for like", from),
+		"Pin the speedtest probe to one server if results should stay comparable",
+	}
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSpeedtestServerChanges verifies server switches are listed from the
+// typed columns and a bandwidth drop across a switch is reported as a
+// measurement artifact.
+func TestSpeedtestServerChanges(t *testing.T) {
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	db := store.DB()
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	save := func(ago time.Duration, id, host string, mbps float64) {
+		t.Helper()
+		res := SpeedTestResult{TestData: []SpeedTestServer{{
+			ID: id, Name: "srv " + id, Host: host,
+			DLSpeed: SpeedTestByteRate(mbps * 1_000_000 / 8), ULSpeed: SpeedTestByteRate(mbps * 1_000_000 / 8),
+		}}}
+		if err := SaveSpeedtestCH(ctx, db, ProbeData{AgentID: 1, ProbeID: 5, CreatedAt: now.Add(-ago)}, string(TypeSpeedtest), res); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	// A week on server 100, then the agent switches to 200 at a third of
+	// the bandwidth.
+	for d := 7; d >= 4; d-- {
+		save(time.Duration(d)*24*time.Hour, "100", "a.example:8080", 300)
+	}
+	for h := 3; h >= 1; h-- {
+		save(time.Duration(h)*time.Hour, "200", "b.example:8080", 100)
+	}
+
+	changes, err := GetSpeedtestServerChanges(ctx, db, []uint{1}, now.Add(-2*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("changes: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("changes = %+v, want one switch", changes)
+	}
+	c := changes[0]
+	if c.FromServerID != "100" || c.ToServerID != "200" || c.ToServerHost != "b.example:8080" ||
+		c.DownloadBeforeMbps != 300 || c.DownloadAfterMbps != 100 || !c.At.Equal(now.Add(-3*time.Hour)) {
+		t.Errorf("change = %+v", c)
+	}
+
+	agents := map[uint]agentInfo{1: {ID: 1, Name: "branch"}}
+	incs := detectSpeedtestIncidents(ctx, db, []uint{1}, now.Add(-6*time.Hour), now.Add(-8*24*time.Hour), agents)
+	if len(incs) != 2 {
+		t.Fatalf("incidents = %+v, want download and upload regressions", incs)
+	}
+	for _, inc := range incs {
+		if !inc.MeasurementArtifact || inc.Severity != "info" {
+			t.Errorf("%s: severity %s, artifact %v; want an info measurement artifact", inc.ID, inc.Severity, inc.MeasurementArtifact)
+		}
+	}
+}
+
+func TestSpeedtestServerSwitch(t *testing.T) {
+	base := speedtestStats{Servers: map[string]int{"100": 5, "200": 1}}
+	if _, _, switched := speedtestServerSwitch(base, speedtestStats{Servers: map[string]int{"100": 2, "200": 1}}); switched {
+		t.Error("same usual server reported as a switch")
+	}
+	if from, to, switched := speedtestServerSwitch(base, speedtestStats{Servers: map[string]int{"200": 3}}); !switched || from != "100" || to != "200" {
+		t.Errorf("switch = %s → %s, %v; want 100 → 200", from, to, switched)
+	}
+	if _, _, switched := speedtestServerSwitch(base, speedtestStats{}); switched {
+		t.Error("results without a server reported as a switch")
+	}
+	if k := speedtestServerKey("", " Speed.Example:8080 "); k != "speed.example:8080" {
+		t.Errorf("host key = %q", k)
+	}
+}
@@ -0,0 +1,257 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── Speedtest storage ──────────────────────────────────────────────────────
+//
+// SPEEDTEST and SPEEDTEST_SERVERS payloads carry the agent's whole server
+// list and are an order of magnitude larger than a PING or MTR row, while
+// arriving a few times a day at most. Mixed into probe_data they skew part
+// sizes and compression, so they live in their own table, speedtest_data.
+// It has the probe_data columns (so rows read back as ProbeData and API
+// responses don't change) plus typed columns for the tested server, which
+// the analysis readers aggregate without decoding JSON:
+//
+//	server_id, server_name,  first entry in test_data (the tested server)
+//	server_host
+//	server_count             len(test_data)
+//	dl_bps, ul_bps           bits per second
+//	latency_ms, jitter_ms
+//
+// FindProbeData, GetProbeDataByProbe and GetLatestByTypeAndAgent route
+// speedtest types here. Rows already in probe_data are copied over once,
+// the first time speedtest_data is created; the originals age out by TTL.
+
+const speedtestTable = "speedtest_data"
+
+// speedtestBackfillLimit caps the one-time copy of legacy probe_data rows.
+const speedtestBackfillLimit = 100000
+
+var speedtestDDL = `
+	CREATE TABLE IF NOT EXISTS speedtest_data (
+		created_at       DateTime('UTC')  DEFAULT now('UTC'),
+		received_at      DateTime('UTC')  DEFAULT now('UTC'),
+		type             LowCardinality(String),
+		probe_id         UInt64,
+		probe_agent_id   UInt64,
+		agent_id         UInt64,
+		triggered        Boolean,
+		triggered_reason String,
+		target           String,
+		target_agent     UInt64,
+		server_id        String,
+		server_name      String,
+		server_host      String,
+		server_count     UInt32,
+		dl_bps           Float64,
+		ul_bps           Float64,
+		latency_ms       Float64,
+		jitter_ms        Float64,
+		payload_raw      String CODEC(ZSTD(3))
+	)
+	ENGINE = MergeTree
+	PARTITION BY toYYYYMM(created_at)
+	ORDER BY (agent_id, type, created_at)
+	TTL %s
+	SETTINGS index_granularity = 8192%s;
+`
+
+var speedtestSQLiteDDL = []string{
+	`CREATE TABLE IF NOT EXISTS speedtest_data (
+			created_at       DATETIME NOT NULL,
+			received_at      DATETIME NOT NULL,
+			type             TEXT     NOT NULL,
+			probe_id         INTEGER  NOT NULL,
+			probe_agent_id   INTEGER  NOT NULL,
+			agent_id         INTEGER  NOT NULL,
+			triggered        BOOLEAN  NOT NULL DEFAULT 0,
+			triggered_reason TEXT     NOT NULL DEFAULT '',
+			target           TEXT     NOT NULL DEFAULT '',
+			target_agent     INTEGER  NOT NULL DEFAULT 0,
+			server_id        TEXT     NOT NULL DEFAULT '',
+			server_name      TEXT     NOT NULL DEFAULT '',
+			server_host      TEXT     NOT NULL DEFAULT '',
+			server_count     INTEGER  NOT NULL DEFAULT 0,
+			dl_bps           REAL     NOT NULL DEFAULT 0,
+			ul_bps           REAL     NOT NULL DEFAULT 0,
+			latency_ms       REAL     NOT NULL DEFAULT 0,
+			jitter_ms        REAL     NOT NULL DEFAULT 0,
+			payload_raw      TEXT     NOT NULL DEFAULT ''
+		)`,
+	`CREATE INDEX IF NOT EXISTS idx_speedtest_data_agent_created ON speedtest_data (agent_id, type, created_at)`,
+}
+
+const speedtestInsertColumns = `created_at, received_at, type, probe_id, probe_agent_id, agent_id,
+triggered, triggered_reason, target, target_agent,
+server_id, server_name, server_host, server_count, dl_bps, ul_bps, latency_ms, jitter_ms, payload_raw`
+
+const speedtestRowPlaceholder = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// isSpeedtestType reports whether rows of typ are stored in speedtest_data.
+func isSpeedtestType(typ string) bool {
+	return typ == string(TypeSpeedtest) || typ == string(TypeSpeedtestServer)
+}
+
+// probeDataTable returns the table holding rows of typ.
+func probeDataTable(typ string) string {
+	if isSpeedtestType(typ) {
+		return speedtestTable
+	}
+	return "probe_data"
+}
+
+// speedtestColumns are the typed columns derived from a payload.
+type speedtestColumns struct {
+	ServerID    string
+	ServerName  string
+	ServerHost  string
+	ServerCount uint32
+	DLBps       float64
+	ULBps       float64
+	LatencyMs   float64
+	JitterMs    float64
+}
+
+// speedtestColumnsFrom extracts the typed columns from a SPEEDTEST result
+// or a SPEEDTEST_SERVERS list. Payloads that don't decode leave them zero.
+func speedtestColumnsFrom(typ string, raw []byte) speedtestColumns {
+	var servers []SpeedTestServer
+	if typ == string(TypeSpeedtestServer) {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			var res SpeedTestResult
+			if json.Unmarshal(raw, &res) == nil {
+				servers = res.TestData
+			}
+		}
+		// A server list has no tested server.
+		return speedtestColumns{ServerCount: uint32(len(servers))}
+	}
+	var res SpeedTestResult
+	if err := json.Unmarshal(raw, &res); err != nil || len(res.TestData) == 0 {
+		return speedtestColumns{}
+	}
+	s := res.TestData[0]
+	return speedtestColumns{
+		ServerID:    s.ID,
+		ServerName:  s.Name,
+		ServerHost:  s.Host,
+		ServerCount: uint32(len(res.TestData)),
+		DLBps:       float64(s.DLSpeed) * 8,
+		ULBps:       float64(s.ULSpeed) * 8,
+		LatencyMs:   float64(s.Latency) / float64(time.Millisecond),
+		JitterMs:    float64(s.Jitter) / float64(time.Millisecond),
+	}
+}
+
+// SaveSpeedtestCH inserts one speedtest row into speedtest_data. Speedtests
+// are rare enough that they skip the batch writer.
+func SaveSpeedtestCH(ctx context.Context, ch *sql.DB, data ProbeData, kind string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	created := data.CreatedAt.UTC()
+	if created.IsZero() {
+		created = time.Now().UTC()
+	}
+	received := data.ReceivedAt.UTC()
+	if received.IsZero() {
+		received = time.Now().UTC()
+	}
+	return insertSpeedtestRow(ctx, ch, ProbeData{
+		CreatedAt:       created,
+		ReceivedAt:      received,
+		Type:            Type(kind),
+		ProbeID:         data.ProbeID,
+		ProbeAgentID:    data.ProbeAgentID,
+		AgentID:         data.AgentID,
+		Triggered:       data.Triggered,
+		TriggeredReason: data.TriggeredReason,
+		Target:          data.Target,
+		TargetAgent:     data.TargetAgent,
+	}, raw)
+}
+
+func insertSpeedtestRow(ctx context.Context, ch *sql.DB, r ProbeData, raw []byte) error {
+	cols := speedtestColumnsFrom(string(r.Type), raw)
+	ins := "INSERT INTO speedtest_data\n(" + speedtestInsertColumns + ")\nVALUES " + speedtestRowPlaceholder
+	_, err := ch.ExecContext(ctx, ins,
+		r.CreatedAt, r.ReceivedAt, string(r.Type),
+		uint64(r.ProbeID), uint64(r.ProbeAgentID), uint64(r.AgentID),
+		r.Triggered, r.TriggeredReason, r.Target, uint64(r.TargetAgent),
+		cols.ServerID, cols.ServerName, cols.ServerHost, cols.ServerCount,
+		cols.DLBps, cols.ULBps, cols.LatencyMs, cols.JitterMs,
+		string(raw),
+	)
+	return err
+}
+
+// migrateSpeedtestCH creates speedtest_data in ClickHouse and backfills it.
+func migrateSpeedtestCH(ctx context.Context, ch *sql.DB, retentionDays int) error {
+	if _, err := ch.ExecContext(ctx, fmt.Sprintf(speedtestDDL, RetentionTTL(speedtestTable, "created_at", retentionDays), StorageTiers().settingsClause())); err != nil {
+		return err
+	}
+	// Rows written before server_host existed read back empty.
+	if _, err := ch.ExecContext(ctx, `ALTER TABLE speedtest_data ADD COLUMN IF NOT EXISTS server_host String DEFAULT '' AFTER server_name`); err != nil {
+		return err
+	}
+	return backfillSpeedtestData(ctx, ch)
+}
+
+// backfillSpeedtestData copies speedtest rows written to probe_data before
+// speedtest_data existed. It only runs while speedtest_data is empty, so
+// it happens once.
+func backfillSpeedtestData(ctx context.Context, ch *sql.DB) error {
+	var have uint64
+	if err := ch.QueryRowContext(ctx, `SELECT count(*) FROM speedtest_data`).Scan(&have); err != nil {
+		return err
+	}
+	if have > 0 {
+		return nil
+	}
+	q := fmt.Sprintf(`
+SELECT
+    created_at, received_at, type, probe_id, agent_id, probe_agent_id,
+    triggered, triggered_reason, target, target_agent, payload_raw
+FROM probe_data
+WHERE type IN (%s, %s)
+ORDER BY created_at
+LIMIT %d`, chQuoteString(string(TypeSpeedtest)), chQuoteString(string(TypeSpeedtestServer)), speedtestBackfillLimit)
+	chRows, err := ch.QueryContext(ctx, q)
+	rows, err := scanProbeDataRows(ctx, chRows, err)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := insertSpeedtestRow(ctx, ch, r, r.Payload); err != nil {
+			return fmt.Errorf("speedtest backfill: %w", err)
+		}
+	}
+	if len(rows) > 0 {
+		log.Infof("Copied %d legacy speedtest rows from probe_data to speedtest_data", len(rows))
+	}
+	return nil
+}
+
+// migrateSpeedtestHostColumnSQLite adds server_host to embedded
+// speedtest_data tables created before it existed.
+func migrateSpeedtestHostColumnSQLite(ctx context.Context, db *sql.DB) error {
+	var n int
+	if err := db.QueryRowContext(ctx,
+		`SELECT count(*) FROM pragma_table_info('speedtest_data') WHERE name = 'server_host'`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `ALTER TABLE speedtest_data ADD COLUMN server_host TEXT NOT NULL DEFAULT ''`)
+	return err
+}
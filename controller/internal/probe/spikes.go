@@ -0,0 +1,400 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ── Spike Drill-Down ──
+//
+// Serves the panel's "click on a spike" view: the worst PING / TRAFFICSIM
+// samples of one probe in a window, each with the samples ±spikeContext
+// around it and the MTR trace from the same agent to the same target that
+// is closest in time. Samples inside an already-picked spike's context are
+// skipped so the top N are N distinct spikes rather than N points of the
+// same one.
+
+const (
+	// spikeContext is how far either side of a spike context samples reach.
+	spikeContext = 2 * time.Minute
+	// spikeMTRMaxGap bounds how far from a spike the nearest MTR may be.
+	spikeMTRMaxGap = 15 * time.Minute
+	// SpikeMaxRange bounds the drill-down window.
+	SpikeMaxRange = 7 * 24 * time.Hour
+
+	defaultSpikeLimit = 10
+	maxSpikeLimit     = 50
+	maxSpikeRows      = 50000
+	maxSpikeMTRRows   = 20000
+)
+
+// SpikeQuery selects the window and ranking. Zero values mean defaults:
+// the last 24 hours, 10 spikes, ranked by latency.
+type SpikeQuery struct {
+	From    time.Time
+	To      time.Time
+	Limit   int
+	By      string // "latency" (default) or "loss"
+	AgentID uint   // only samples reported by this agent
+}
+
+// Spike is one worst sample with its surroundings.
+type Spike struct {
+	Sample     EvidenceSample   `json:"sample"`
+	Context    []EvidenceSample `json:"context"` // chronological, includes the spike
+	NearestMTR *EvidenceTrace   `json:"nearest_mtr,omitempty"`
+	MTROffset  float64          `json:"mtr_offset_seconds,omitempty"` // trace time minus spike time
+}
+
+// SpikeReport is the drill-down response for one probe.
+type SpikeReport struct {
+	ProbeID uint      `json:"probe_id"`
+	Type    Type      `json:"type"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	By      string    `json:"by"`
+	Samples int       `json:"samples"` // samples in the window
+	Spikes  []Spike   `json:"spikes"`
+}
+
+// ProbeSpikes returns the worst samples of a PING or TRAFFICSIM probe.
+// Returns ErrNotFound when the probe is not in the workspace and
+// ErrUnsupported for other probe types.
+func ProbeSpikes(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID, probeID uint, q SpikeQuery) (*SpikeReport, error) {
+	p, err := GetByID(ctx, pg, probeID)
+	if err != nil || p == nil || p.WorkspaceID != workspaceID {
+		return nil, ErrNotFound
+	}
+	if p.Type != TypePing && p.Type != TypeTrafficSim {
+		return nil, fmt.Errorf("%w: spikes are available for PING and TRAFFICSIM probes", ErrUnsupported)
+	}
+
+	if q.To.IsZero() {
+		q.To = time.Now().UTC()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-24 * time.Hour)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrBadInput)
+	}
+	if q.To.Sub(q.From) > SpikeMaxRange {
+		return nil, fmt.Errorf("%w: range exceeds %d days", ErrBadInput, int(SpikeMaxRange.Hours()/24))
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultSpikeLimit
+	}
+	if q.Limit > maxSpikeLimit {
+		q.Limit = maxSpikeLimit
+	}
+	switch q.By {
+	case "":
+		q.By = "latency"
+	case "latency", "loss":
+	default:
+		return nil, fmt.Errorf("%w: by must be latency or loss", ErrBadInput)
+	}
+
+	report := &SpikeReport{ProbeID: probeID, Type: p.Type, From: q.From, To: q.To, By: q.By, Spikes: []Spike{}}
+
+	// Read the context margin on both sides so edge spikes keep theirs.
+	series, err := querySpikeSeries(ctx, ch, p, q.AgentID, q.From.Add(-spikeContext), q.To.Add(spikeContext))
+	if err != nil {
+		return nil, fmt.Errorf("spike samples: %w", err)
+	}
+	var inWindow []EvidenceSample
+	for _, s := range series {
+		if !s.Time.Before(q.From) && !s.Time.After(q.To) {
+			inWindow = append(inWindow, s)
+		}
+	}
+	report.Samples = len(inWindow)
+	report.Spikes = pickSpikes(series, inWindow, q.By, q.Limit)
+	if len(report.Spikes) == 0 {
+		return report, nil
+	}
+
+	traces, err := querySpikeMTRTimes(ctx, ch, report.Spikes)
+	if err != nil {
+		return nil, fmt.Errorf("spike mtr: %w", err)
+	}
+	attachNearestMTR(report.Spikes, traces)
+	if err := loadSpikeMTRPayloads(ctx, ch, report.Spikes); err != nil {
+		return nil, fmt.Errorf("spike mtr payloads: %w", err)
+	}
+	return report, nil
+}
+
+// sameSpikeSeries reports whether two samples are from the same agent and target.
+func sameSpikeSeries(a, b EvidenceSample) bool {
+	return a.AgentID == b.AgentID && a.Target == b.Target
+}
+
+// pickSpikes ranks candidates and keeps up to n spikes whose context
+// windows don't overlap one already kept on the same series. series is
+// the chronological sample list context is drawn from.
+func pickSpikes(series, candidates []EvidenceSample, by string, n int) []Spike {
+	ranked := append([]EvidenceSample(nil), candidates...)
+	if by == "loss" {
+		ranked = worstEvidenceSamples(ranked, len(ranked))
+	} else {
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if ranked[i].AvgLatency != ranked[j].AvgLatency {
+				return ranked[i].AvgLatency > ranked[j].AvgLatency
+			}
+			return ranked[i].PacketLoss > ranked[j].PacketLoss
+		})
+	}
+
+	out := []Spike{}
+	for _, s := range ranked {
+		if len(out) >= n {
+			break
+		}
+		overlaps := false
+		for _, kept := range out {
+			if sameSpikeSeries(kept.Sample, s) && absDuration(kept.Sample.Time.Sub(s.Time)) <= 2*spikeContext {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		sp := Spike{Sample: s, Context: []EvidenceSample{}}
+		for _, c := range series {
+			if sameSpikeSeries(c, s) && absDuration(c.Time.Sub(s.Time)) <= spikeContext {
+				sp.Context = append(sp.Context, c)
+			}
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+// attachNearestMTR sets each spike's nearest trace from traces (payloads
+// not yet loaded) from the same agent to the same host, within
+// spikeMTRMaxGap.
+func attachNearestMTR(spikes []Spike, traces []EvidenceTrace) {
+	for i := range spikes {
+		s := spikes[i].Sample
+		host := stripPort(s.Target)
+		var best *EvidenceTrace
+		var bestGap time.Duration
+		for j := range traces {
+			t := &traces[j]
+			if t.AgentID != s.AgentID || stripPort(t.Target) != host {
+				continue
+			}
+			gap := absDuration(t.Time.Sub(s.Time))
+			if gap > spikeMTRMaxGap {
+				continue
+			}
+			if best == nil || gap < bestGap {
+				best, bestGap = t, gap
+			}
+		}
+		if best != nil {
+			tr := *best
+			spikes[i].NearestMTR = &tr
+			spikes[i].MTROffset = tr.Time.Sub(s.Time).Seconds()
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// querySpikeSeries returns the probe's samples in [from, to], chronologically.
+func querySpikeSeries(ctx context.Context, ch *sql.DB, p *Probe, agentID uint, from, to time.Time) ([]EvidenceSample, error) {
+	agentFilter := ""
+	if agentID != 0 {
+		agentFilter = fmt.Sprintf("AND agent_id = %d", agentID)
+	}
+	q := fmt.Sprintf(`
+SELECT agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE probe_id = %d
+  AND type = '%s'
+  AND created_at >= %s
+  AND created_at <= %s
+  %s
+ORDER BY created_at ASC
+LIMIT %d
+`, p.ID, p.Type, chQuoteTime(from), chQuoteTime(to), agentFilter, maxSpikeRows)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvidenceSample
+	for rows.Next() {
+		var id uint64
+		var target, payloadRaw string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &target, &createdAt, &payloadRaw); err != nil {
+			continue
+		}
+		s, ok := spikeSample(p.Type, []byte(payloadRaw))
+		if !ok {
+			continue
+		}
+		s.Time, s.AgentID, s.Target = createdAt.UTC(), uint(id), target
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// spikeSample decodes latency and loss from a PING or TRAFFICSIM payload.
+func spikeSample(kind Type, raw []byte) (EvidenceSample, bool) {
+	switch kind {
+	case TypePing:
+		payload, err := ParsePingPayload(raw)
+		if err != nil {
+			return EvidenceSample{}, false
+		}
+		return EvidenceSample{
+			AvgLatency: sanitizeFloat(float64(payload.AvgRtt) / 1e6),
+			MaxLatency: sanitizeFloat(float64(payload.MaxRtt) / 1e6),
+			PacketLoss: sanitizeFloat(payload.PacketLoss),
+		}, true
+	case TypeTrafficSim:
+		var payload TrafficSimResult
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return EvidenceSample{}, false
+		}
+		return EvidenceSample{
+			AvgLatency: sanitizeFloat(payload.AverageRTT),
+			MaxLatency: sanitizeFloat(float64(payload.MaxRTT)),
+			PacketLoss: sanitizeFloat(payload.LossPercentage),
+		}, true
+	}
+	return EvidenceSample{}, false
+}
+
+// querySpikeMTRTimes lists MTR traces (without payloads) near the spikes
+// from the spikes' agents.
+func querySpikeMTRTimes(ctx context.Context, ch *sql.DB, spikes []Spike) ([]EvidenceTrace, error) {
+	seen := make(map[uint]bool)
+	var ids []string
+	from, to := spikes[0].Sample.Time, spikes[0].Sample.Time
+	for _, s := range spikes {
+		if !seen[s.Sample.AgentID] {
+			seen[s.Sample.AgentID] = true
+			ids = append(ids, fmt.Sprintf("%d", s.Sample.AgentID))
+		}
+		if s.Sample.Time.Before(from) {
+			from = s.Sample.Time
+		}
+		if s.Sample.Time.After(to) {
+			to = s.Sample.Time
+		}
+	}
+
+	q := fmt.Sprintf(`
+SELECT agent_id, target, created_at
+FROM probe_data
+WHERE type = 'MTR'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at <= %s
+ORDER BY created_at ASC
+LIMIT %d
+`, strings.Join(ids, ", "), chQuoteTime(from.Add(-spikeMTRMaxGap)), chQuoteTime(to.Add(spikeMTRMaxGap)), maxSpikeMTRRows)
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EvidenceTrace
+	for rows.Next() {
+		var agentID uint64
+		var target string
+		var createdAt time.Time
+		if err := rows.Scan(&agentID, &target, &createdAt); err != nil {
+			continue
+		}
+		out = append(out, EvidenceTrace{Time: createdAt.UTC(), AgentID: uint(agentID), Target: target})
+	}
+	return out, rows.Err()
+}
+
+// loadSpikeMTRPayloads fills in the payloads of the traces picked by
+// attachNearestMTR. Traces whose payload can't be read are dropped.
+func loadSpikeMTRPayloads(ctx context.Context, ch *sql.DB, spikes []Spike) error {
+	type traceKey struct {
+		agentID uint
+		target  string
+		at      int64
+	}
+	want := make(map[traceKey][]int)
+	ids := make(map[string]bool)
+	times := make(map[string]bool)
+	for i, s := range spikes {
+		if t := s.NearestMTR; t != nil {
+			k := traceKey{t.AgentID, t.Target, t.Time.Unix()}
+			want[k] = append(want[k], i)
+			ids[fmt.Sprintf("%d", t.AgentID)] = true
+			times[chQuoteTime(t.Time)] = true
+		}
+	}
+	if len(want) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf(`
+SELECT agent_id, target, created_at, payload_raw
+FROM probe_data
+WHERE type = 'MTR'
+  AND agent_id IN (%s)
+  AND created_at IN (%s)
+`, strings.Join(sortedKeys(ids), ", "), strings.Join(sortedKeys(times), ", "))
+
+	rows, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	loaded := make(map[traceKey]bool)
+	for rows.Next() {
+		var agentID uint64
+		var target, payloadRaw string
+		var createdAt time.Time
+		if err := rows.Scan(&agentID, &target, &createdAt, &payloadRaw); err != nil {
+			continue
+		}
+		k := traceKey{uint(agentID), target, createdAt.Unix()}
+		if loaded[k] || !json.Valid([]byte(payloadRaw)) {
+			continue
+		}
+		for _, i := range want[k] {
+			spikes[i].NearestMTR.Payload = json.RawMessage(payloadRaw)
+			loaded[k] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range spikes {
+		if t := spikes[i].NearestMTR; t != nil && t.Payload == nil {
+			spikes[i].NearestMTR, spikes[i].MTROffset = nil, 0
+		}
+	}
+	return nil
+}
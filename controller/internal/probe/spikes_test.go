@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPickSpikesDistinct verifies that neighbouring samples of one spike
+// are folded into its context instead of being reported as more spikes.
+func TestPickSpikesDistinct(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var series []EvidenceSample
+	for i := 0; i < 60; i++ {
+		series = append(series, EvidenceSample{Time: base.Add(time.Duration(i) * time.Minute), AgentID: 1, Target: "1.1.1.1", AvgLatency: 10})
+	}
+	series[10].AvgLatency = 200 // spike A
+	series[11].AvgLatency = 150 // same spike, next sample
+	series[40].AvgLatency = 120 // spike B
+
+	got := pickSpikes(series, series, "latency", 5)
+	if len(got) < 2 {
+		t.Fatalf("expected at least 2 spikes, got %d", len(got))
+	}
+	if got[0].Sample.AvgLatency != 200 || got[1].Sample.AvgLatency != 120 {
+		t.Errorf("got spikes %.0f, %.0f; want 200, 120", got[0].Sample.AvgLatency, got[1].Sample.AvgLatency)
+	}
+	if n := len(got[0].Context); n != 5 {
+		t.Errorf("expected 5 context samples (±2 minutes), got %d", n)
+	}
+	if len(pickSpikes(series, series, "latency", 1)) != 1 {
+		t.Error("limit not applied")
+	}
+}
+
+func TestPickSpikesByLoss(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	series := []EvidenceSample{
+		{Time: base, AgentID: 1, Target: "a", AvgLatency: 300},
+		{Time: base.Add(10 * time.Minute), AgentID: 1, Target: "a", AvgLatency: 20, PacketLoss: 50},
+	}
+	got := pickSpikes(series, series, "loss", 1)
+	if len(got) != 1 || got[0].Sample.PacketLoss != 50 {
+		t.Fatalf("expected the lossy sample first, got %+v", got)
+	}
+}
+
+func TestAttachNearestMTR(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	spikes := []Spike{
+		{Sample: EvidenceSample{Time: base, AgentID: 1, Target: "example.com:443"}},
+		{Sample: EvidenceSample{Time: base, AgentID: 2, Target: "example.com"}},
+	}
+	traces := []EvidenceTrace{
+		{Time: base.Add(-5 * time.Minute), AgentID: 1, Target: "example.com"},
+		{Time: base.Add(90 * time.Second), AgentID: 1, Target: "example.com"},
+		{Time: base.Add(time.Second), AgentID: 1, Target: "other.net"},
+		{Time: base.Add(-time.Hour), AgentID: 2, Target: "example.com"},
+	}
+	attachNearestMTR(spikes, traces)
+	if spikes[0].NearestMTR == nil || spikes[0].MTROffset != 90 {
+		t.Errorf("agent 1: expected the trace 90s later, got %+v (offset %v)", spikes[0].NearestMTR, spikes[0].MTROffset)
+	}
+	if spikes[1].NearestMTR != nil {
+		t.Error("agent 2: trace outside the max gap should not be attached")
+	}
+}
@@ -0,0 +1,182 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── ClickHouse Storage Tiers ──
+//
+// Long retention is cheaper when old parts leave the fast disks. With
+// CH_STORAGE_POLICY set, the telemetry tables are created with (or switched
+// to) that storage policy, and CH_TTL_MOVES adds TTL MOVE rules in front of
+// the retention DELETE:
+//
+//	CH_STORAGE_POLICY=tiered
+//	CH_TTL_MOVES=7:cold,30:disk:s3
+//
+// moves parts older than 7 days to the policy's "cold" volume and parts
+// older than 30 days to the "s3" disk. The policy, its volumes and disks
+// are defined in the ClickHouse server config; the controller only
+// references them. Moves at or beyond DATA_RETENTION_DAYS are skipped,
+// since the rows are deleted first.
+//
+// A storage policy can only be replaced by one that contains all of the
+// table's current disks, which ClickHouse checks when the policy is
+// applied to an existing table. Unset, tables keep the server's default
+// policy and a plain retention TTL, as before.
+
+// TTLMove is one TTL MOVE rule: parts older than Days go to Volume or Disk.
+type TTLMove struct {
+	Days   int
+	Volume string
+	Disk   string
+}
+
+// StorageTierConfig is the deployment's ClickHouse tiering (env:
+// CH_STORAGE_POLICY, CH_TTL_MOVES).
+type StorageTierConfig struct {
+	Policy string
+	Moves  []TTLMove
+}
+
+// Enabled reports whether any tiering is configured.
+func (c StorageTierConfig) Enabled() bool { return c.Policy != "" || len(c.Moves) > 0 }
+
+// tieredTables maps each telemetry table to its TTL column.
+var tieredTables = []struct{ table, column string }{
+	{"probe_data", "created_at"},
+	{speedtestTable, "created_at"},
+	{"analysis_snapshots", "generated_at"},
+	{"analysis_snapshot_versions", "generated_at"},
+}
+
+var chIdentRe = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+var storageTiers = sync.OnceValue(func() StorageTierConfig {
+	cfg, err := ParseStorageTierConfig(os.Getenv("CH_STORAGE_POLICY"), os.Getenv("CH_TTL_MOVES"))
+	if err != nil {
+		log.Warnf("ClickHouse storage tiers disabled: %v", err)
+		return StorageTierConfig{}
+	}
+	return cfg
+})
+
+// StorageTiers returns the configured ClickHouse storage tiering.
+func StorageTiers() StorageTierConfig { return storageTiers() }
+
+// ParseStorageTierConfig validates a policy name and a comma-separated
+// list of "<days>:<volume>" or "<days>:disk:<disk>" moves. Move ages must
+// increase.
+func ParseStorageTierConfig(policy, moves string) (StorageTierConfig, error) {
+	cfg := StorageTierConfig{Policy: strings.TrimSpace(policy)}
+	if cfg.Policy != "" && !chIdentRe.MatchString(cfg.Policy) {
+		return StorageTierConfig{}, fmt.Errorf("CH_STORAGE_POLICY: invalid policy name %q", cfg.Policy)
+	}
+	for _, item := range strings.Split(moves, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(parts[0]), "d"))
+		if err != nil || days <= 0 {
+			return StorageTierConfig{}, fmt.Errorf("CH_TTL_MOVES: %q: age must be a positive number of days", item)
+		}
+		var m TTLMove
+		switch {
+		case len(parts) == 2:
+			m = TTLMove{Days: days, Volume: strings.TrimSpace(parts[1])}
+		case len(parts) == 3 && strings.TrimSpace(parts[1]) == "disk":
+			m = TTLMove{Days: days, Disk: strings.TrimSpace(parts[2])}
+		default:
+			return StorageTierConfig{}, fmt.Errorf("CH_TTL_MOVES: %q: want <days>:<volume> or <days>:disk:<disk>", item)
+		}
+		if !chIdentRe.MatchString(m.Volume + m.Disk) {
+			return StorageTierConfig{}, fmt.Errorf("CH_TTL_MOVES: %q: invalid volume or disk name", item)
+		}
+		if n := len(cfg.Moves); n > 0 && days <= cfg.Moves[n-1].Days {
+			return StorageTierConfig{}, fmt.Errorf("CH_TTL_MOVES: %q: ages must increase", item)
+		}
+		cfg.Moves = append(cfg.Moves, m)
+	}
+	return cfg, nil
+}
+
+// TTLExpr is the table TTL for column: the moves younger than the
+// retention, then the retention DELETE.
+func (c StorageTierConfig) TTLExpr(column string, retentionDays int) string {
+	var rules []string
+	for _, m := range c.Moves {
+		if m.Days >= retentionDays {
+			continue
+		}
+		if m.Disk != "" {
+			rules = append(rules, fmt.Sprintf("%s + INTERVAL %d DAY TO DISK '%s'", column, m.Days, m.Disk))
+		} else {
+			rules = append(rules, fmt.Sprintf("%s + INTERVAL %d DAY TO VOLUME '%s'", column, m.Days, m.Volume))
+		}
+	}
+	rules = append(rules, fmt.Sprintf("%s + INTERVAL %d DAY DELETE", column, retentionDays))
+	return strings.Join(rules, ", ")
+}
+
+// settingsClause is appended to a CREATE TABLE's SETTINGS list.
+func (c StorageTierConfig) settingsClause() string {
+	if c.Policy == "" {
+		return ""
+	}
+	return fmt.Sprintf(", storage_policy = '%s'", c.Policy)
+}
+
+// RetentionTTL is the TTL expression for a table, with the configured
+// moves when the table is a tiered telemetry table.
+func RetentionTTL(table, column string, retentionDays int) string {
+	for _, t := range tieredTables {
+		if t.table == table {
+			return StorageTiers().TTLExpr(column, retentionDays)
+		}
+	}
+	return StorageTierConfig{}.TTLExpr(column, retentionDays)
+}
+
+// migrateStorageTiersCH applies the storage policy and TTL moves to
+// telemetry tables created before they were configured. New tables get
+// both from their DDL.
+func migrateStorageTiersCH(ctx context.Context, ch *sql.DB, retentionDays int) error {
+	cfg := StorageTiers()
+	if !cfg.Enabled() {
+		return nil
+	}
+	for _, t := range tieredTables {
+		if cfg.Policy != "" {
+			var current string
+			err := ch.QueryRowContext(ctx,
+				`SELECT storage_policy FROM system.tables WHERE database = currentDatabase() AND name = ?`, t.table).Scan(&current)
+			if err != nil {
+				return fmt.Errorf("storage policy of %s: %w", t.table, err)
+			}
+			if current != cfg.Policy {
+				q := fmt.Sprintf("ALTER TABLE %s MODIFY SETTING storage_policy = '%s'", t.table, cfg.Policy)
+				if _, err := ch.ExecContext(ctx, q); err != nil {
+					return fmt.Errorf("%s: switch storage policy %q → %q (the new policy must include the old one's disks): %w",
+						t.table, current, cfg.Policy, err)
+				}
+				log.Infof("ClickHouse: %s storage policy %s → %s", t.table, current, cfg.Policy)
+			}
+		}
+		q := fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", t.table, cfg.TTLExpr(t.column, retentionDays))
+		if _, err := ch.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("%s: set TTL moves: %w", t.table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package probe
+
+import "testing"
+
+func TestParseStorageTierConfig(t *testing.T) {
+	cfg, err := ParseStorageTierConfig("tiered", "7:cold, 30d:disk:s3, 400:archive")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !cfg.Enabled() || len(cfg.Moves) != 3 || cfg.Moves[1] != (TTLMove{Days: 30, Disk: "s3"}) {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	want := "created_at + INTERVAL 7 DAY TO VOLUME 'cold', created_at + INTERVAL 30 DAY TO DISK 's3', created_at + INTERVAL 90 DAY DELETE"
+	if got := cfg.TTLExpr("created_at", 90); got != want {
+		t.Errorf("ttl =\n%s\nwant\n%s", got, want)
+	}
+	if got := cfg.settingsClause(); got != ", storage_policy = 'tiered'" {
+		t.Errorf("settings = %q", got)
+	}
+
+	if got := (StorageTierConfig{}).TTLExpr("generated_at", 30); got != "generated_at + INTERVAL 30 DAY DELETE" {
+		t.Errorf("untiered ttl = %q", got)
+	}
+	if cfg, err := ParseStorageTierConfig("", ""); err != nil || cfg.Enabled() {
+		t.Errorf("empty = %+v, %v", cfg, err)
+	}
+
+	for _, bad := range [][2]string{
+		{"tiered'; DROP", ""},
+		{"", "30:cold,7:hot"},
+		{"", "0:cold"},
+		{"", "7:volume:cold"},
+		{"", "7:co'ld"},
+	} {
+		if _, err := ParseStorageTierConfig(bad[0], bad[1]); err == nil {
+			t.Errorf("ParseStorageTierConfig(%q, %q) should fail", bad[0], bad[1])
+		}
+	}
+}
@@ -3,7 +3,6 @@ package probe
 import (
 	"context"
 	"database/sql"
-	log "github.com/sirupsen/logrus"
 	"time"
 )
 
@@ -14,13 +13,21 @@ func initSysInfo(db *sql.DB) {
 			return nil
 		},
 		func(ctx context.Context, data ProbeData, p sysInfoPayload) error {
-			if err := SaveRecordCH(ctx, db, data, string(TypeSysInfo), p); err != nil {
-				log.WithError(err).Error("save sysinfo record (CH)")
+			stored, sealed, err := sealPayloadFor(ctx, data, TypeSysInfo, p)
+			if err != nil {
+				ingestEntry(data).WithError(err).Error("seal sysinfo record")
 				return err
 			}
+			if err := SaveRecordCH(ctx, db, data, string(TypeSysInfo), stored); err != nil {
+				ingestEntry(data).WithError(err).Error("save sysinfo record (CH)")
+				return err
+			}
+			if sealed {
+				return nil
+			}
 
 			// Store to DB / compute / alert as needed:
-			log.Printf("[sysinfo] hostname=%s timezone=%s timestamp=%s",
+			ingestEntry(data).Infof("[sysinfo] hostname=%s timezone=%s timestamp=%s",
 				p.HostInfo.Hostname, p.HostInfo.Timezone, p.Timestamp)
 			return nil
 		},
@@ -31,9 +38,17 @@ type sysInfoPayload struct {
 	HostInfo   SystemHostInfo       `json:"hostInfo" bson:"hostInfo"`
 	MemoryInfo SystemHostMemoryInfo `json:"memoryInfo" bson:"memoryInfo"`
 	CPUTimes   SystemCPUTimes       `json:"CPUTimes" bson:"CPUTimes"`
+	Disks      []SystemDiskInfo     `json:"disks,omitempty" bson:"disks"` // optional; older agents omit it
 	Timestamp  time.Time            `json:"timestamp" bson:"timestamp"`
 }
 
+// SystemDiskInfo is one mounted filesystem (values in bytes).
+type SystemDiskInfo struct {
+	Mountpoint string `json:"mountpoint" bson:"mountpoint"`
+	Total      uint64 `json:"total_bytes" bson:"total"`
+	Used       uint64 `json:"used_bytes" bson:"used"`
+}
+
 type SystemCPUTimes struct {
 	User    time.Duration `json:"user" bson:"user"`
 	System  time.Duration `json:"system" bson:"system"`
@@ -0,0 +1,238 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ── Target Catalog ──
+//
+// A workspace's curated list of the targets it cares about — SaaS
+// endpoints, internal service IPs, carrier looking glasses — each with a
+// name, description and optional criticality. Probes pick targets from it
+// (CreateInput.CatalogTargets), and analysis, incidents and the network map
+// label catalogued targets with the entry name when the probe itself has
+// no display name or circuit, the same way probe metadata does.
+
+// Catalog categories.
+const (
+	CatalogSaaS         = "saas"
+	CatalogInternal     = "internal"
+	CatalogLookingGlass = "looking_glass"
+	CatalogDNS          = "dns"
+	CatalogOther        = "other"
+)
+
+var catalogCategories = map[string]bool{
+	CatalogSaaS: true, CatalogInternal: true, CatalogLookingGlass: true, CatalogDNS: true, CatalogOther: true,
+}
+
+// CatalogEntry is one curated target in a workspace.
+type CatalogEntry struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:ux_target_catalog_ws_target" json:"workspace_id"`
+	Target      string    `gorm:"size:512;not null;uniqueIndex:ux_target_catalog_ws_target" json:"target"`
+	Name        string    `gorm:"size:128;not null" json:"name"`
+	Category    string    `gorm:"size:32;not null;index" json:"category"`
+	Description string    `gorm:"type:text" json:"description,omitempty"`
+	Criticality string    `gorm:"size:16" json:"criticality,omitempty"` // empty = unlabelled
+}
+
+func (CatalogEntry) TableName() string { return "target_catalog" }
+
+// Metadata is the entry as probe metadata, for labelling.
+func (e CatalogEntry) Metadata() *ProbeMetadata {
+	return &ProbeMetadata{DisplayName: e.Name, Criticality: e.Criticality}
+}
+
+// normalize trims and validates an entry before it is stored.
+func (e *CatalogEntry) normalize() error {
+	e.Target = strings.TrimSpace(e.Target)
+	e.Name = strings.TrimSpace(e.Name)
+	e.Category = strings.ToLower(strings.TrimSpace(e.Category))
+	e.Description = strings.TrimSpace(e.Description)
+	if e.WorkspaceID == 0 || e.Target == "" || e.Name == "" {
+		return fmt.Errorf("%w: workspace, target and name required", ErrBadInput)
+	}
+	if len(e.Name) > maxMetadataValueLen {
+		return fmt.Errorf("%w: name exceeds %d characters", ErrBadInput, maxMetadataValueLen)
+	}
+	if e.Category == "" {
+		e.Category = CatalogOther
+	}
+	if !catalogCategories[e.Category] {
+		return fmt.Errorf("%w: category must be one of saas, internal, looking_glass, dns, other", ErrBadInput)
+	}
+	if strings.TrimSpace(e.Criticality) == "" {
+		e.Criticality = ""
+		return nil
+	}
+	c, err := ParseCriticality(e.Criticality)
+	if err != nil {
+		return err
+	}
+	e.Criticality = string(c)
+	return nil
+}
+
+// ListCatalog returns a workspace's catalog, optionally one category,
+// ordered by category then name.
+func ListCatalog(ctx context.Context, db *gorm.DB, workspaceID uint, category string) ([]CatalogEntry, error) {
+	tx := db.WithContext(ctx).Where("workspace_id = ?", workspaceID)
+	if category != "" {
+		tx = tx.Where("category = ?", strings.ToLower(category))
+	}
+	var out []CatalogEntry
+	err := tx.Order("category ASC, name ASC").Find(&out).Error
+	return out, err
+}
+
+// CreateCatalogEntry adds an entry. A target already in the catalog is
+// rejected.
+func CreateCatalogEntry(ctx context.Context, db *gorm.DB, e CatalogEntry) (*CatalogEntry, error) {
+	e.ID = 0
+	if err := e.normalize(); err != nil {
+		return nil, err
+	}
+	var n int64
+	if err := db.WithContext(ctx).Model(&CatalogEntry{}).
+		Where("workspace_id = ? AND target = ?", e.WorkspaceID, e.Target).Count(&n).Error; err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, fmt.Errorf("%w: %s is already in the catalog", ErrBadInput, e.Target)
+	}
+	if err := db.WithContext(ctx).Create(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// UpdateCatalogEntry replaces an entry's fields.
+func UpdateCatalogEntry(ctx context.Context, db *gorm.DB, workspaceID, id uint, e CatalogEntry) (*CatalogEntry, error) {
+	var cur CatalogEntry
+	if err := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).First(&cur).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	e.ID, e.WorkspaceID, e.CreatedAt = cur.ID, cur.WorkspaceID, cur.CreatedAt
+	if err := e.normalize(); err != nil {
+		return nil, err
+	}
+	if e.Target != cur.Target {
+		var n int64
+		if err := db.WithContext(ctx).Model(&CatalogEntry{}).
+			Where("workspace_id = ? AND target = ? AND id <> ?", workspaceID, e.Target, id).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("%w: %s is already in the catalog", ErrBadInput, e.Target)
+		}
+	}
+	if err := db.WithContext(ctx).Save(&e).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// DeleteCatalogEntry removes an entry. Probes created from it keep their
+// targets; they only lose the label.
+func DeleteCatalogEntry(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).Delete(&CatalogEntry{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DefaultCatalog is a starter set of widely used public endpoints that a
+// workspace can import and then edit.
+var DefaultCatalog = []CatalogEntry{
+	{Target: "1.1.1.1", Name: "Cloudflare DNS", Category: CatalogDNS, Description: "Cloudflare public resolver (anycast)"},
+	{Target: "8.8.8.8", Name: "Google DNS", Category: CatalogDNS, Description: "Google public resolver (anycast)"},
+	{Target: "9.9.9.9", Name: "Quad9 DNS", Category: CatalogDNS, Description: "Quad9 public resolver (anycast)"},
+	{Target: "outlook.office365.com", Name: "Microsoft 365 Exchange", Category: CatalogSaaS, Description: "Exchange Online front door"},
+	{Target: "teams.microsoft.com", Name: "Microsoft Teams", Category: CatalogSaaS, Description: "Teams web and signalling"},
+	{Target: "www.google.com", Name: "Google", Category: CatalogSaaS, Description: "Google search front end"},
+	{Target: "zoom.us", Name: "Zoom", Category: CatalogSaaS, Description: "Zoom web and API"},
+	{Target: "slack.com", Name: "Slack", Category: CatalogSaaS, Description: "Slack web and API"},
+	{Target: "github.com", Name: "GitHub", Category: CatalogSaaS, Description: "GitHub web and git over HTTPS"},
+	{Target: "s3.amazonaws.com", Name: "AWS S3", Category: CatalogSaaS, Description: "Amazon S3 global endpoint"},
+}
+
+// ImportDefaultCatalog adds the DefaultCatalog entries the workspace does
+// not have yet and returns how many were added. Existing entries for the
+// same targets are left as they are.
+func ImportDefaultCatalog(ctx context.Context, db *gorm.DB, workspaceID uint) (int, error) {
+	if workspaceID == 0 {
+		return 0, fmt.Errorf("%w: workspace required", ErrBadInput)
+	}
+	rows := make([]CatalogEntry, len(DefaultCatalog))
+	for i, e := range DefaultCatalog {
+		e.WorkspaceID = workspaceID
+		rows[i] = e
+	}
+	res := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&rows)
+	return int(res.RowsAffected), res.Error
+}
+
+// ExpandCatalogTargets appends the targets of in.CatalogTargets to
+// in.Targets and clears CatalogTargets. Entries must belong to
+// workspaceID, which callers take from a trusted source rather than the
+// request body. Targets already listed are not repeated.
+func ExpandCatalogTargets(ctx context.Context, db *gorm.DB, workspaceID uint, in *CreateInput) error {
+	if len(in.CatalogTargets) == 0 {
+		return nil
+	}
+	var entries []CatalogEntry
+	if err := db.WithContext(ctx).
+		Where("workspace_id = ? AND id IN ?", workspaceID, in.CatalogTargets).
+		Find(&entries).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]string, len(entries))
+	for _, e := range entries {
+		byID[e.ID] = e.Target
+	}
+	have := make(map[string]bool, len(in.Targets))
+	for _, t := range in.Targets {
+		have[t] = true
+	}
+	for _, id := range in.CatalogTargets {
+		t, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("%w: catalog entry %d not found in workspace", ErrBadInput, id)
+		}
+		if !have[t] {
+			in.Targets = append(in.Targets, t)
+			have[t] = true
+		}
+	}
+	in.CatalogTargets = nil
+	return nil
+}
+
+// addCatalog indexes catalog entries for targets that no probe describes.
+func (ix probeMetadataIndex) addCatalog(entries []CatalogEntry) {
+	for _, e := range entries {
+		m := e.Metadata()
+		for _, key := range []string{e.Target, stripPort(e.Target)} {
+			if _, taken := ix.byTarget[key]; !taken {
+				ix.byTarget[key] = m
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+// TestTargetCatalog covers entry validation, the default import, probe
+// target expansion and catalog labels in the metadata index.
+func TestTargetCatalog(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&CatalogEntry{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+
+	pay, err := CreateCatalogEntry(ctx, db, CatalogEntry{
+		WorkspaceID: 1, Target: " pay.example.com ", Name: "Payments API", Category: "SaaS", Criticality: "High",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if pay.Target != "pay.example.com" || pay.Category != CatalogSaaS || pay.Criticality != "high" {
+		t.Errorf("normalized = %+v", pay)
+	}
+	for name, e := range map[string]CatalogEntry{
+		"duplicate":   {WorkspaceID: 1, Target: "pay.example.com", Name: "Again"},
+		"no name":     {WorkspaceID: 1, Target: "10.0.0.1"},
+		"category":    {WorkspaceID: 1, Target: "10.0.0.1", Name: "x", Category: "cdn"},
+		"criticality": {WorkspaceID: 1, Target: "10.0.0.1", Name: "x", Criticality: "urgent"},
+	} {
+		if _, err := CreateCatalogEntry(ctx, db, e); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%s: err = %v, want ErrBadInput", name, err)
+		}
+	}
+	core, _ := CreateCatalogEntry(ctx, db, CatalogEntry{WorkspaceID: 1, Target: "10.0.0.53:53", Name: "Core DNS", Category: CatalogInternal})
+	other, _ := CreateCatalogEntry(ctx, db, CatalogEntry{WorkspaceID: 2, Target: "10.9.9.9", Name: "Elsewhere"})
+
+	n, err := ImportDefaultCatalog(ctx, db, 1)
+	if err != nil || n != len(DefaultCatalog) {
+		t.Fatalf("import = %d, %v", n, err)
+	}
+	if n, _ := ImportDefaultCatalog(ctx, db, 1); n != 0 {
+		t.Errorf("second import added %d", n)
+	}
+	if list, _ := ListCatalog(ctx, db, 1, CatalogInternal); len(list) != 1 || list[0].ID != core.ID {
+		t.Errorf("internal = %+v", list)
+	}
+
+	in := CreateInput{WorkspaceID: 1, Targets: []string{"pay.example.com"}, CatalogTargets: []uint{pay.ID, core.ID}}
+	if err := ExpandCatalogTargets(ctx, db, 1, &in); err != nil {
+		t.Fatalf("expand: %v", err)
+	}
+	if len(in.Targets) != 2 || in.Targets[1] != "10.0.0.53:53" || in.CatalogTargets != nil {
+		t.Errorf("expanded = %v / %v", in.Targets, in.CatalogTargets)
+	}
+	in = CreateInput{WorkspaceID: 1, CatalogTargets: []uint{other.ID}}
+	if err := ExpandCatalogTargets(ctx, db, 1, &in); !errors.Is(err, ErrBadInput) {
+		t.Errorf("other workspace entry: err = %v", err)
+	}
+
+	// Probe metadata wins; the catalog labels the rest, with or without port.
+	db.Create(&Probe{WorkspaceID: 1, AgentID: 1, Type: TypePing, Metadata: datatypes.JSON(`{"display_name":"Checkout"}`),
+		Targets: []Target{{Target: "pay.example.com"}}})
+	ix := loadProbeMetadataIndex(ctx, db, 1)
+	if m := ix.forTarget("pay.example.com"); m == nil || m.DisplayName != "Checkout" {
+		t.Errorf("probe label = %+v", m)
+	}
+	if m := ix.forTarget("10.0.0.53"); m == nil || m.Label() != "Core DNS" {
+		t.Errorf("catalog label = %+v", m)
+	}
+	if m := ix.forTarget("10.9.9.9"); m != nil {
+		t.Errorf("other workspace labelled: %+v", m)
+	}
+
+	if _, err := UpdateCatalogEntry(ctx, db, 1, core.ID, CatalogEntry{Target: "pay.example.com", Name: "x"}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("update to taken target: err = %v", err)
+	}
+	if err := DeleteCatalogEntry(ctx, db, 2, core.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete from wrong workspace: err = %v", err)
+	}
+}
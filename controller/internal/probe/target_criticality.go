@@ -0,0 +1,118 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ── Target Criticality ──
+//
+// Operators label the targets that matter most (payment gateway, core
+// DNS, the VoIP SBC) so incidents touching them rank above noise on a
+// test host. Labels are keyed by workspace + target string rather than
+// stored on probe_targets rows, because probe updates replace target rows
+// wholesale and the same target is usually probed by several agents.
+
+// Criticality is a per-target importance label.
+type Criticality string
+
+const (
+	CriticalityLow      Criticality = "low"
+	CriticalityNormal   Criticality = "normal"
+	CriticalityHigh     Criticality = "high"
+	CriticalityCritical Criticality = "critical"
+)
+
+// criticalityWeight scales incident impact by the most important
+// affected target. Unlabelled targets are "normal" (1.0).
+var criticalityWeight = map[Criticality]float64{
+	CriticalityLow:      0.6,
+	CriticalityNormal:   1.0,
+	CriticalityHigh:     1.4,
+	CriticalityCritical: 1.8,
+}
+
+// ParseCriticality validates a criticality label (case-insensitive).
+func ParseCriticality(s string) (Criticality, error) {
+	c := Criticality(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := criticalityWeight[c]; !ok {
+		return "", fmt.Errorf("%w: criticality must be one of low, normal, high, critical", ErrBadInput)
+	}
+	return c, nil
+}
+
+// TargetCriticality labels one target string within a workspace.
+type TargetCriticality struct {
+	ID          uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	WorkspaceID uint        `gorm:"not null;uniqueIndex:ux_target_criticality_ws_target" json:"workspace_id"`
+	Target      string      `gorm:"size:512;not null;uniqueIndex:ux_target_criticality_ws_target" json:"target"`
+	Criticality Criticality `gorm:"size:16;not null" json:"criticality"`
+}
+
+func (TargetCriticality) TableName() string { return "target_criticality" }
+
+// ListTargetCriticality returns all labelled targets in a workspace.
+func ListTargetCriticality(ctx context.Context, db *gorm.DB, workspaceID uint) ([]TargetCriticality, error) {
+	var out []TargetCriticality
+	err := db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("target ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// SetTargetCriticality labels a target. Setting "normal" removes the
+// label, since that is the default.
+func SetTargetCriticality(ctx context.Context, db *gorm.DB, workspaceID uint, target string, c Criticality) (*TargetCriticality, error) {
+	target = strings.TrimSpace(target)
+	if workspaceID == 0 || target == "" {
+		return nil, fmt.Errorf("%w: workspace and target required", ErrBadInput)
+	}
+	if _, ok := criticalityWeight[c]; !ok {
+		return nil, fmt.Errorf("%w: unknown criticality %q", ErrBadInput, c)
+	}
+
+	if c == CriticalityNormal {
+		err := db.WithContext(ctx).
+			Where("workspace_id = ? AND target = ?", workspaceID, target).
+			Delete(&TargetCriticality{}).Error
+		if err != nil {
+			return nil, err
+		}
+		return &TargetCriticality{WorkspaceID: workspaceID, Target: target, Criticality: c}, nil
+	}
+
+	row := TargetCriticality{WorkspaceID: workspaceID, Target: target, Criticality: c}
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"criticality", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// targetCriticalityMap returns target → label for a workspace. Errors
+// degrade to an empty map so analysis never fails on a label lookup.
+func targetCriticalityMap(ctx context.Context, db *gorm.DB, workspaceID uint) map[string]Criticality {
+	out := make(map[string]Criticality)
+	if db == nil {
+		return out
+	}
+	rows, err := ListTargetCriticality(ctx, db, workspaceID)
+	if err != nil {
+		return out
+	}
+	for _, r := range rows {
+		out[r.Target] = r.Criticality
+	}
+	return out
+}
@@ -0,0 +1,445 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ── Target Groups ──
+//
+// A target group names a set of targets that together make up one
+// service ("Microsoft 365" = outlook, teams, login, sharepoint ...), so a
+// single status can be shown for the service instead of one per target.
+// Service health is computed from the materialized network map
+// destinations: each member target keeps its own status, every agent
+// probing any member gets a per-agent rollup, and the group status is
+// derived from both. Targets under maintenance are listed but not scored.
+
+const maxTargetGroupTargets = 200
+
+// Service health statuses. The first three match DestinationSummary.Status.
+const (
+	ServiceHealthy  = "healthy"
+	ServiceDegraded = "degraded"
+	ServiceCritical = "critical"
+	ServiceNoData   = "no_data"
+)
+
+// TargetGroup is a named set of targets in a workspace.
+type TargetGroup struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	WorkspaceID uint           `gorm:"not null;uniqueIndex:ux_target_groups_ws_name" json:"workspace_id"`
+	Name        string         `gorm:"size:128;not null;uniqueIndex:ux_target_groups_ws_name" json:"name"`
+	Description string         `gorm:"type:text" json:"description,omitempty"`
+	Targets     datatypes.JSON `gorm:"type:jsonb" json:"targets"` // []string
+}
+
+func (TargetGroup) TableName() string { return "target_groups" }
+
+// TargetGroupInput is the body of a create or update.
+type TargetGroupInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Targets     []string `json:"targets"`
+}
+
+// TargetList decodes the group's targets.
+func (g *TargetGroup) TargetList() []string {
+	var out []string
+	if len(g.Targets) > 0 {
+		_ = json.Unmarshal(g.Targets, &out)
+	}
+	return out
+}
+
+// toRow validates the input and converts it to a row. Targets are
+// trimmed and de-duplicated case-insensitively, keeping the first spelling.
+func (in TargetGroupInput) toRow(workspaceID uint) (TargetGroup, error) {
+	name := strings.TrimSpace(in.Name)
+	if workspaceID == 0 || name == "" {
+		return TargetGroup{}, fmt.Errorf("%w: workspace and name required", ErrBadInput)
+	}
+	if len(name) > maxMetadataValueLen {
+		return TargetGroup{}, fmt.Errorf("%w: name exceeds %d characters", ErrBadInput, maxMetadataValueLen)
+	}
+	seen := make(map[string]bool, len(in.Targets))
+	targets := make([]string, 0, len(in.Targets))
+	for _, t := range in.Targets {
+		t = strings.TrimSpace(t)
+		key := strings.ToLower(t)
+		if t == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return TargetGroup{}, fmt.Errorf("%w: at least one target required", ErrBadInput)
+	}
+	if len(targets) > maxTargetGroupTargets {
+		return TargetGroup{}, fmt.Errorf("%w: at most %d targets per group", ErrBadInput, maxTargetGroupTargets)
+	}
+	raw, _ := json.Marshal(targets)
+	return TargetGroup{
+		WorkspaceID: workspaceID,
+		Name:        name,
+		Description: strings.TrimSpace(in.Description),
+		Targets:     raw,
+	}, nil
+}
+
+// ListTargetGroups returns a workspace's groups ordered by name.
+func ListTargetGroups(ctx context.Context, db *gorm.DB, workspaceID uint) ([]TargetGroup, error) {
+	var out []TargetGroup
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("name ASC").Find(&out).Error
+	return out, err
+}
+
+// GetTargetGroup loads one group.
+func GetTargetGroup(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*TargetGroup, error) {
+	var g TargetGroup
+	if err := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).First(&g).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &g, nil
+}
+
+// CreateTargetGroup adds a group. Names are unique per workspace.
+func CreateTargetGroup(ctx context.Context, db *gorm.DB, workspaceID uint, in TargetGroupInput) (*TargetGroup, error) {
+	row, err := in.toRow(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTargetGroupName(ctx, db, workspaceID, row.Name, 0); err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// UpdateTargetGroup replaces a group's name, description and targets.
+func UpdateTargetGroup(ctx context.Context, db *gorm.DB, workspaceID, id uint, in TargetGroupInput) (*TargetGroup, error) {
+	cur, err := GetTargetGroup(ctx, db, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	row, err := in.toRow(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTargetGroupName(ctx, db, workspaceID, row.Name, id); err != nil {
+		return nil, err
+	}
+	row.ID, row.CreatedAt = cur.ID, cur.CreatedAt
+	if err := db.WithContext(ctx).Save(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// DeleteTargetGroup removes a group. Its targets and their probes are
+// untouched.
+func DeleteTargetGroup(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("workspace_id = ? AND id = ?", workspaceID, id).Delete(&TargetGroup{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func checkTargetGroupName(ctx context.Context, db *gorm.DB, workspaceID uint, name string, exceptID uint) error {
+	var n int64
+	if err := db.WithContext(ctx).Model(&TargetGroup{}).
+		Where("workspace_id = ? AND name = ? AND id <> ?", workspaceID, name, exceptID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: a group named %q already exists", ErrBadInput, name)
+	}
+	return nil
+}
+
+// ServiceTargetHealth is one member target in a service health report.
+type ServiceTargetHealth struct {
+	Target      string         `json:"target"`
+	Status      string         `json:"status"` // healthy, degraded, critical, no_data
+	AvgLatency  float64        `json:"avg_latency"`
+	PacketLoss  float64        `json:"packet_loss"`
+	AgentCount  int            `json:"agent_count"`
+	Maintenance bool           `json:"maintenance,omitempty"`
+	Metadata    *ProbeMetadata `json:"metadata,omitempty"`
+}
+
+// ServiceAgentHealth is one probing agent's view of the whole service.
+type ServiceAgentHealth struct {
+	AgentID         uint    `json:"agent_id"`
+	AgentName       string  `json:"agent_name"`
+	Status          string  `json:"status"`
+	TargetsHealthy  int     `json:"targets_healthy"`
+	TargetsProbed   int     `json:"targets_probed"`
+	AvgLatency      float64 `json:"avg_latency"`
+	WorstPacketLoss float64 `json:"worst_packet_loss"`
+}
+
+// ServiceHealth is the aggregated health of a target group.
+type ServiceHealth struct {
+	GroupID          uint                  `json:"group_id"`
+	Name             string                `json:"name"`
+	Status           string                `json:"status"`
+	Summary          string                `json:"summary"`
+	TargetCount      int                   `json:"target_count"`
+	HealthyCount     int                   `json:"healthy_count"`
+	DegradedCount    int                   `json:"degraded_count"`
+	CriticalCount    int                   `json:"critical_count"`
+	NoDataCount      int                   `json:"no_data_count"`
+	MaintenanceCount int                   `json:"maintenance_count"`
+	AgentCount       int                   `json:"agent_count"`
+	AvgLatency       float64               `json:"avg_latency"`
+	WorstPacketLoss  float64               `json:"worst_packet_loss"`
+	Targets          []ServiceTargetHealth `json:"targets"`
+	Agents           []ServiceAgentHealth  `json:"agents"`
+	GeneratedAt      time.Time             `json:"generated_at"`
+}
+
+// GroupServiceHealth computes a group's service health over the last
+// lookbackMinutes of network map data.
+func GroupServiceHealth(ctx context.Context, ch *sql.DB, pg *gorm.DB, workspaceID, groupID uint, lookbackMinutes int) (*ServiceHealth, error) {
+	g, err := GetTargetGroup(ctx, pg, workspaceID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	dests, generatedAt, err := MaterializedDestinations(ctx, ch, pg, workspaceID, lookbackMinutes)
+	if err != nil {
+		return nil, err
+	}
+	maint := activeMaintenanceTargets(ctx, pg, workspaceID, time.Now())
+	h := aggregateServiceHealth(g.TargetList(), dests, maint)
+	h.GroupID, h.Name, h.GeneratedAt = g.ID, g.Name, generatedAt
+	return h, nil
+}
+
+// statusFromPriority maps healthPriority back to a status string.
+func statusFromPriority(p int) string {
+	switch p {
+	case 0:
+		return ServiceCritical
+	case 1:
+		return ServiceDegraded
+	}
+	return ServiceHealthy
+}
+
+// aggregateServiceHealth rolls destinations up into a service report. A
+// member target matches destinations with or without a port and in any
+// case, so "outlook.office365.com" covers an MTR to the host and a
+// TrafficSim to host:443. Per-agent numbers come from each
+// destination's expanded endpoints.
+//
+// The service is critical when at least half of its scored targets are
+// critical, or when every probing agent sees it critical (the site has
+// lost the service even if other sites still reach it); degraded when any
+// scored target is not healthy; no_data when nothing was probed.
+func aggregateServiceHealth(targets []string, dests []DestinationSummary, maint maintenanceTargets) *ServiceHealth {
+	byKey := make(map[string][]*DestinationSummary, len(dests))
+	for i := range dests {
+		d := &dests[i]
+		for _, key := range []string{strings.ToLower(d.Target), strings.ToLower(stripPort(d.Target))} {
+			byKey[key] = append(byKey[key], d)
+		}
+	}
+
+	type agentAcc struct {
+		name      string
+		targets   map[string]int // member target -> worst priority
+		latencies []float64
+		worstLoss float64
+	}
+	agents := make(map[uint]*agentAcc)
+
+	h := &ServiceHealth{TargetCount: len(targets), Targets: make([]ServiceTargetHealth, 0, len(targets)), Agents: []ServiceAgentHealth{}}
+	var latencies []float64
+	for _, t := range targets {
+		th := ServiceTargetHealth{Target: t, Status: ServiceNoData}
+		matched := byKey[strings.ToLower(t)]
+		if len(matched) == 0 {
+			matched = byKey[strings.ToLower(stripPort(t))]
+		}
+		// A destination indexed under both its full and bare name may
+		// appear twice; count it once.
+		seen := make(map[*DestinationSummary]bool, len(matched))
+		var lat []float64
+		agentSet := make(map[uint]bool)
+		worst := 2
+		for _, d := range matched {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			if d.AvgLatency > 0 {
+				lat = append(lat, d.AvgLatency)
+			}
+			th.PacketLoss = maxF([]float64{th.PacketLoss, d.PacketLoss})
+			if p := healthPriority(d.PacketLoss, d.AvgLatency); p < worst {
+				worst = p
+			}
+			if th.Metadata == nil {
+				th.Metadata = d.Metadata
+			}
+			for _, ep := range d.ExpandedEndpoints {
+				agentSet[ep.AgentID] = true
+				a := agents[ep.AgentID]
+				if a == nil {
+					a = &agentAcc{name: ep.AgentName, targets: make(map[string]int)}
+					agents[ep.AgentID] = a
+				}
+				if maint.has(t) {
+					continue
+				}
+				p := healthPriority(ep.PacketLoss, ep.AvgLatency)
+				if cur, ok := a.targets[t]; !ok || p < cur {
+					a.targets[t] = p
+				}
+				if ep.AvgLatency > 0 {
+					a.latencies = append(a.latencies, ep.AvgLatency)
+				}
+				if ep.PacketLoss > a.worstLoss {
+					a.worstLoss = ep.PacketLoss
+				}
+			}
+			if d.AgentCount > th.AgentCount {
+				th.AgentCount = d.AgentCount
+			}
+		}
+		if len(agentSet) > th.AgentCount {
+			th.AgentCount = len(agentSet)
+		}
+		th.AvgLatency = sanitizeFloat(avg(lat))
+		th.PacketLoss = sanitizeFloat(th.PacketLoss)
+
+		switch {
+		case maint.has(t):
+			th.Maintenance = true
+			if len(seen) > 0 {
+				th.Status = statusFromPriority(worst)
+			}
+			h.MaintenanceCount++
+		case len(seen) == 0:
+			h.NoDataCount++
+		default:
+			th.Status = statusFromPriority(worst)
+			switch th.Status {
+			case ServiceCritical:
+				h.CriticalCount++
+			case ServiceDegraded:
+				h.DegradedCount++
+			default:
+				h.HealthyCount++
+			}
+			if th.AvgLatency > 0 {
+				latencies = append(latencies, th.AvgLatency)
+			}
+			if th.PacketLoss > h.WorstPacketLoss {
+				h.WorstPacketLoss = th.PacketLoss
+			}
+		}
+		h.Targets = append(h.Targets, th)
+	}
+	h.AvgLatency = sanitizeFloat(avg(latencies))
+
+	for id, a := range agents {
+		if len(a.targets) == 0 {
+			continue
+		}
+		ah := ServiceAgentHealth{
+			AgentID:         id,
+			AgentName:       a.name,
+			TargetsProbed:   len(a.targets),
+			AvgLatency:      sanitizeFloat(avg(a.latencies)),
+			WorstPacketLoss: sanitizeFloat(a.worstLoss),
+		}
+		critical := 0
+		for _, p := range a.targets {
+			switch p {
+			case 0:
+				critical++
+			case 2:
+				ah.TargetsHealthy++
+			}
+		}
+		switch {
+		case critical == ah.TargetsProbed:
+			ah.Status = ServiceCritical
+		case ah.TargetsHealthy < ah.TargetsProbed:
+			ah.Status = ServiceDegraded
+		default:
+			ah.Status = ServiceHealthy
+		}
+		h.Agents = append(h.Agents, ah)
+	}
+	h.AgentCount = len(h.Agents)
+	allAgentsCritical := h.AgentCount > 0
+	for _, a := range h.Agents {
+		if a.Status != ServiceCritical {
+			allAgentsCritical = false
+			break
+		}
+	}
+	sort.Slice(h.Agents, func(i, j int) bool {
+		pi, pj := serviceStatusRank(h.Agents[i].Status), serviceStatusRank(h.Agents[j].Status)
+		if pi != pj {
+			return pi < pj
+		}
+		return h.Agents[i].AgentName < h.Agents[j].AgentName
+	})
+
+	scored := h.HealthyCount + h.DegradedCount + h.CriticalCount
+	switch {
+	case scored == 0:
+		h.Status = ServiceNoData
+		h.Summary = "no recent data for any target"
+	case h.CriticalCount*2 >= scored || allAgentsCritical:
+		h.Status = ServiceCritical
+		h.Summary = fmt.Sprintf("%d of %d targets critical", h.CriticalCount, scored)
+		if allAgentsCritical {
+			h.Summary += "; unreachable from every probing agent"
+		}
+	case h.DegradedCount+h.CriticalCount > 0:
+		h.Status = ServiceDegraded
+		h.Summary = fmt.Sprintf("%d of %d targets degraded or critical", h.DegradedCount+h.CriticalCount, scored)
+	default:
+		h.Status = ServiceHealthy
+		h.Summary = fmt.Sprintf("all %d targets healthy", scored)
+	}
+	return h
+}
+
+func serviceStatusRank(s string) int {
+	switch s {
+	case ServiceCritical:
+		return 0
+	case ServiceDegraded:
+		return 1
+	case ServiceHealthy:
+		return 2
+	}
+	return 3
+}
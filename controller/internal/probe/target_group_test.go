@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTargetGroupCRUD(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&TargetGroup{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+
+	g, err := CreateTargetGroup(ctx, db, 1, TargetGroupInput{
+		Name:    " Microsoft 365 ",
+		Targets: []string{"outlook.office365.com", " Outlook.Office365.com", "teams.microsoft.com", ""},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if g.Name != "Microsoft 365" {
+		t.Errorf("name = %q", g.Name)
+	}
+	if got := g.TargetList(); len(got) != 2 || got[0] != "outlook.office365.com" {
+		t.Errorf("targets = %v, want de-duplicated pair", got)
+	}
+
+	if _, err := CreateTargetGroup(ctx, db, 1, TargetGroupInput{Name: "Microsoft 365", Targets: []string{"x"}}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("duplicate name: err = %v, want ErrBadInput", err)
+	}
+	if _, err := CreateTargetGroup(ctx, db, 2, TargetGroupInput{Name: "Microsoft 365", Targets: []string{"x"}}); err != nil {
+		t.Errorf("same name in another workspace: %v", err)
+	}
+	if _, err := CreateTargetGroup(ctx, db, 1, TargetGroupInput{Name: "Empty"}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("no targets: err = %v, want ErrBadInput", err)
+	}
+
+	up, err := UpdateTargetGroup(ctx, db, 1, g.ID, TargetGroupInput{Name: "M365", Targets: []string{"login.microsoftonline.com"}})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if up.Name != "M365" || len(up.TargetList()) != 1 {
+		t.Errorf("update = %+v", up)
+	}
+	if _, err := UpdateTargetGroup(ctx, db, 2, g.ID, TargetGroupInput{Name: "x", Targets: []string{"x"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update from other workspace: err = %v, want ErrNotFound", err)
+	}
+
+	if err := DeleteTargetGroup(ctx, db, 1, g.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := DeleteTargetGroup(ctx, db, 1, g.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAggregateServiceHealth(t *testing.T) {
+	ep := func(agentID uint, name string, lat, loss float64) ProbeEndpointDetail {
+		return ProbeEndpointDetail{AgentID: agentID, AgentName: name, AvgLatency: lat, PacketLoss: loss}
+	}
+	dests := []DestinationSummary{
+		{Target: "outlook.office365.com", AvgLatency: 20, Status: "healthy",
+			ExpandedEndpoints: []ProbeEndpointDetail{ep(1, "hq", 20, 0), ep(2, "branch", 22, 0)}},
+		{Target: "teams.microsoft.com:443", AvgLatency: 30, PacketLoss: 15, Status: "degraded",
+			ExpandedEndpoints: []ProbeEndpointDetail{ep(1, "hq", 25, 0), ep(2, "branch", 35, 30)}},
+		{Target: "login.microsoftonline.com", PacketLoss: 100, Status: "critical",
+			ExpandedEndpoints: []ProbeEndpointDetail{ep(2, "branch", 0, 100)}},
+	}
+	targets := []string{"Outlook.Office365.com", "teams.microsoft.com", "login.microsoftonline.com", "sharepoint.com"}
+
+	t.Run("degraded with per-target and per-agent breakdown", func(t *testing.T) {
+		h := aggregateServiceHealth(targets, dests, maintenanceTargets{"login.microsoftonline.com": true})
+		if h.Status != ServiceDegraded {
+			t.Errorf("status = %s, want degraded (%s)", h.Status, h.Summary)
+		}
+		if h.HealthyCount != 1 || h.DegradedCount != 1 || h.NoDataCount != 1 || h.MaintenanceCount != 1 {
+			t.Errorf("counts = %+v", h)
+		}
+		if h.Targets[1].Status != ServiceDegraded || h.Targets[1].AgentCount != 2 {
+			t.Errorf("teams (matched without port) = %+v", h.Targets[1])
+		}
+		if h.Targets[3].Status != ServiceNoData {
+			t.Errorf("sharepoint = %s, want no_data", h.Targets[3].Status)
+		}
+		if len(h.Agents) != 2 || h.Agents[0].AgentName != "branch" || h.Agents[0].Status != ServiceDegraded {
+			t.Fatalf("agents = %+v, want branch first and degraded", h.Agents)
+		}
+		if h.Agents[1].Status != ServiceHealthy || h.Agents[1].TargetsProbed != 2 {
+			t.Errorf("hq = %+v", h.Agents[1])
+		}
+	})
+
+	t.Run("half the targets critical", func(t *testing.T) {
+		h := aggregateServiceHealth(targets[1:3], dests, nil)
+		if h.Status != ServiceCritical {
+			t.Errorf("status = %s, want critical (%s)", h.Status, h.Summary)
+		}
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		h := aggregateServiceHealth([]string{"sharepoint.com"}, dests, nil)
+		if h.Status != ServiceNoData || h.AgentCount != 0 {
+			t.Errorf("health = %+v", h)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ── Target Maintenance ──
+//
+// A target that is known to be down (decommissioned server, planned
+// outage) should not keep workspace health red. Flagged targets are
+// dropped from health scoring and incident detection while probes keep
+// running and ClickHouse keeps recording their data. Like criticality,
+// flags are keyed by workspace + target string.
+
+// TargetMaintenance marks one target as expected down.
+type TargetMaintenance struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	WorkspaceID uint      `gorm:"not null;uniqueIndex:ux_target_maintenance_ws_target" json:"workspace_id"`
+	Target      string    `gorm:"size:512;not null;uniqueIndex:ux_target_maintenance_ws_target" json:"target"`
+	Reason      string    `gorm:"size:255" json:"reason,omitempty"`
+	// Until ends the flag automatically; nil keeps it until cleared.
+	Until           *time.Time `json:"until,omitempty"`
+	CreatedByUserID uint       `json:"created_by_user_id"`
+}
+
+func (TargetMaintenance) TableName() string { return "target_maintenance" }
+
+// Active reports whether the flag applies at now.
+func (m *TargetMaintenance) Active(now time.Time) bool {
+	return m.Until == nil || now.Before(*m.Until)
+}
+
+// ListTargetMaintenance returns all maintenance flags in a workspace,
+// including expired ones.
+func ListTargetMaintenance(ctx context.Context, db *gorm.DB, workspaceID uint) ([]TargetMaintenance, error) {
+	var out []TargetMaintenance
+	err := db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("target ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// SetTargetMaintenance flags a target as expected down, replacing any
+// existing flag for it.
+func SetTargetMaintenance(ctx context.Context, db *gorm.DB, workspaceID uint, target, reason string, until *time.Time, userID uint) (*TargetMaintenance, error) {
+	target = strings.TrimSpace(target)
+	if workspaceID == 0 || target == "" {
+		return nil, fmt.Errorf("%w: workspace and target required", ErrBadInput)
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("%w: until must be in the future", ErrBadInput)
+	}
+	if len(reason) > 255 {
+		return nil, fmt.Errorf("%w: reason must be at most 255 characters", ErrBadInput)
+	}
+
+	row := TargetMaintenance{
+		WorkspaceID:     workspaceID,
+		Target:          target,
+		Reason:          reason,
+		Until:           until,
+		CreatedByUserID: userID,
+	}
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "until", "created_by_user_id", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// ClearTargetMaintenance removes a target's maintenance flag.
+func ClearTargetMaintenance(ctx context.Context, db *gorm.DB, workspaceID uint, target string) error {
+	res := db.WithContext(ctx).
+		Where("workspace_id = ? AND target = ?", workspaceID, strings.TrimSpace(target)).
+		Delete(&TargetMaintenance{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// maintenanceTargets is the set of targets flagged at a point in time.
+type maintenanceTargets map[string]bool
+
+// activeMaintenanceTargets returns targets flagged at now. Errors degrade
+// to an empty set so analysis never fails on a flag lookup.
+func activeMaintenanceTargets(ctx context.Context, db *gorm.DB, workspaceID uint, now time.Time) maintenanceTargets {
+	out := make(maintenanceTargets)
+	if db == nil {
+		return out
+	}
+	rows, err := ListTargetMaintenance(ctx, db, workspaceID)
+	if err != nil {
+		return out
+	}
+	for i := range rows {
+		if rows[i].Active(now) {
+			out[rows[i].Target] = true
+		}
+	}
+	return out
+}
+
+// has matches a target with or without its port, so flagging
+// "example.com" covers "example.com:443" too.
+func (m maintenanceTargets) has(target string) bool {
+	return len(m) > 0 && (m[target] || m[stripPort(target)])
+}
+
+func (m maintenanceTargets) sorted() []string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(m))
+	for t := range m {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// dropMaintenanceKeys removes "agentID:target" entries for flagged
+// targets from a workspace metrics map.
+func dropMaintenanceKeys[T any](metrics map[string]T, m maintenanceTargets) {
+	if len(m) == 0 {
+		return
+	}
+	for key := range metrics {
+		if i := strings.IndexByte(key, ':'); i > 0 && m.has(key[i+1:]) {
+			delete(metrics, key)
+		}
+	}
+}
+
+// filterMaintenanceIncidents drops incidents whose affected targets are
+// all flagged and removes flagged targets from the rest. Incidents with
+// no targets (agent offline, infrastructure-wide) are kept.
+func filterMaintenanceIncidents(incidents []DetectedIncident, m maintenanceTargets) []DetectedIncident {
+	if len(m) == 0 {
+		return incidents
+	}
+	out := incidents[:0]
+	for _, inc := range incidents {
+		if len(inc.AffectedTargets) == 0 {
+			out = append(out, inc)
+			continue
+		}
+		kept := make([]string, 0, len(inc.AffectedTargets))
+		for _, t := range inc.AffectedTargets {
+			if !m.has(t) {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		inc.AffectedTargets = kept
+		out = append(out, inc)
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+// TestDropMaintenanceKeys verifies flagged targets are removed from
+// agent:target metric maps, with or without a port.
+func TestDropMaintenanceKeys(t *testing.T) {
+	m := maintenanceTargets{"old.example.com": true}
+	metrics := map[string]pingStats{
+		"1:old.example.com":     {Count: 10},
+		"2:old.example.com:443": {Count: 10},
+		"1:new.example.com":     {Count: 10},
+	}
+	dropMaintenanceKeys(metrics, m)
+	if len(metrics) != 1 {
+		t.Fatalf("expected 1 remaining entry, got %v", metrics)
+	}
+	if _, ok := metrics["1:new.example.com"]; !ok {
+		t.Error("unflagged target was dropped")
+	}
+}
+
+// TestFilterMaintenanceIncidents verifies incidents confined to flagged
+// targets disappear while mixed and target-less incidents survive.
+func TestFilterMaintenanceIncidents(t *testing.T) {
+	m := maintenanceTargets{"old.example.com": true}
+	in := []DetectedIncident{
+		{ID: "only_old", AffectedTargets: []string{"old.example.com"}},
+		{ID: "mixed", AffectedTargets: []string{"old.example.com", "new.example.com"}},
+		{ID: "agent_offline", AffectedTargets: []string{}},
+	}
+	out := filterMaintenanceIncidents(in, m)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 incidents, got %d", len(out))
+	}
+	if out[0].ID != "mixed" || len(out[0].AffectedTargets) != 1 || out[0].AffectedTargets[0] != "new.example.com" {
+		t.Errorf("mixed incident not trimmed: %+v", out[0])
+	}
+	if out[1].ID != "agent_offline" {
+		t.Errorf("target-less incident dropped: %+v", out)
+	}
+}
+
+func TestTargetMaintenanceActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	if !(&TargetMaintenance{}).Active(now) {
+		t.Error("flag without until should be active")
+	}
+	if !(&TargetMaintenance{Until: &future}).Active(now) {
+		t.Error("flag with future until should be active")
+	}
+	if (&TargetMaintenance{Until: &past}).Active(now) {
+		t.Error("expired flag should be inactive")
+	}
+}
@@ -0,0 +1,329 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+
+	_ "github.com/glebarez/go-sqlite" // registers the "sqlite" database/sql driver
+	log "github.com/sirupsen/logrus"
+)
+
+// ── Telemetry Storage ──
+//
+// probe_data (and analysis_snapshots) normally live in ClickHouse. For
+// single-host evaluation deployments TELEMETRY_BACKEND=sqlite keeps them
+// in an embedded SQLite file instead, so the controller runs without a
+// ClickHouse server.
+//
+// The write path (batch writer, SaveRecordCH) and the core readers
+// (GetProbeDataByProbe, FindProbeData, GetLatest*, aggregation) use
+// portable SQL and work unchanged against either backend through
+// ProbeDataStore.DB(). What differs — schema, retention and row
+// deletion — lives behind ProbeDataStore. Analysis queries that rely on
+// ClickHouse functions (argMax, JSONExtract, quantiles) fail on SQLite and
+// degrade the same way they do when ClickHouse is unreachable.
+
+// TelemetryBackend names a probe_data storage implementation.
+type TelemetryBackend string
+
+const (
+	TelemetryClickHouse TelemetryBackend = "clickhouse"
+	TelemetrySQLite     TelemetryBackend = "sqlite"
+)
+
+const defaultTelemetrySQLitePath = "netwatcher-telemetry.db"
+
+// ProbeDataStore is the storage interface behind probe_data.
+// It satisfies deletion.CHOps so the deletion worker can run against it.
+type ProbeDataStore interface {
+	Backend() TelemetryBackend
+	// DB is the handle passed wherever a ClickHouse *sql.DB was used.
+	DB() *sql.DB
+	// Migrate creates the telemetry tables.
+	Migrate(ctx context.Context, retentionDays int) error
+	// Prune deletes rows older than before. ClickHouse enforces retention
+	// with table TTLs and reports 0.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+	DeleteProbeDataByProbeID(ctx context.Context, probeID uint) error
+	DeleteProbeDataByAgentID(ctx context.Context, agentID uint) error
+	DeleteWorkspaceData(ctx context.Context, workspaceID uint) error
+	Close() error
+}
+
+// activeTelemetryBackend is set by OpenTelemetryStoreFromEnv.
+var activeTelemetryBackend = TelemetryClickHouse
+
+// EmbeddedTelemetry reports whether probe data is stored in embedded SQLite.
+func EmbeddedTelemetry() bool { return activeTelemetryBackend == TelemetrySQLite }
+
+// OpenTelemetryStoreFromEnv opens the backend selected by TELEMETRY_BACKEND
+// (clickhouse | sqlite, default clickhouse). The SQLite file is
+// TELEMETRY_SQLITE_PATH (default netwatcher-telemetry.db).
+func OpenTelemetryStoreFromEnv() (ProbeDataStore, error) {
+	switch backend := TelemetryBackend(strings.ToLower(getenv("TELEMETRY_BACKEND", string(TelemetryClickHouse)))); backend {
+	case TelemetryClickHouse:
+		ch, err := OpenClickHouseFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		activeTelemetryBackend = TelemetryClickHouse
+		return &clickHouseStore{db: ch}, nil
+	case TelemetrySQLite:
+		path := getenv("TELEMETRY_SQLITE_PATH", defaultTelemetrySQLitePath)
+		s, err := OpenSQLiteTelemetry(path)
+		if err != nil {
+			return nil, err
+		}
+		activeTelemetryBackend = TelemetrySQLite
+		log.Warnf("Embedded telemetry mode: probe data stored in SQLite (%s); intended for single-host evaluation", path)
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown TELEMETRY_BACKEND %q (want clickhouse or sqlite)", backend)
+	}
+}
+
+// ---- ClickHouse ----
+
+type clickHouseStore struct {
+	db *sql.DB
+}
+
+func (s *clickHouseStore) Backend() TelemetryBackend { return TelemetryClickHouse }
+func (s *clickHouseStore) DB() *sql.DB               { return s.db }
+func (s *clickHouseStore) Close() error              { return s.db.Close() }
+
+func (s *clickHouseStore) Migrate(ctx context.Context, retentionDays int) error {
+	if err := MigrateCH(ctx, s.db, retentionDays); err != nil {
+		return err
+	}
+	return MigrateCacheTablesCH(ctx, s.db)
+}
+
+func (s *clickHouseStore) Prune(context.Context, time.Time) (int64, error) { return 0, nil }
+
+func (s *clickHouseStore) DeleteProbeDataByProbeID(ctx context.Context, probeID uint) error {
+	return (&deletion.CHClient{DB: s.db}).DeleteProbeDataByProbeID(ctx, probeID)
+}
+
+func (s *clickHouseStore) DeleteProbeDataByAgentID(ctx context.Context, agentID uint) error {
+	return (&deletion.CHClient{DB: s.db}).DeleteProbeDataByAgentID(ctx, agentID)
+}
+
+func (s *clickHouseStore) DeleteWorkspaceData(ctx context.Context, workspaceID uint) error {
+	return (&deletion.CHClient{DB: s.db}).DeleteWorkspaceData(ctx, workspaceID)
+}
+
+// ---- Embedded SQLite ----
+
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteTelemetry opens (creating if needed) an embedded telemetry file.
+// WAL lets the analysis loop read while the batch writer inserts.
+func OpenSQLiteTelemetry(path string) (ProbeDataStore, error) {
+	dsn := path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite telemetry open: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("sqlite telemetry ping failed: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Backend() TelemetryBackend { return TelemetrySQLite }
+func (s *sqliteStore) DB() *sql.DB               { return s.db }
+func (s *sqliteStore) Close() error              { return s.db.Close() }
+
+// Migrate mirrors the ClickHouse columns so the portable readers and the
+// batch writer's INSERT work unchanged. Retention is enforced by Prune.
+func (s *sqliteStore) Migrate(ctx context.Context, _ int) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS probe_data (
+			id               INTEGER  NOT NULL DEFAULT 0,
+			created_at       DATETIME NOT NULL,
+			received_at      DATETIME NOT NULL,
+			type             TEXT     NOT NULL,
+			probe_id         INTEGER  NOT NULL,
+			probe_agent_id   INTEGER  NOT NULL,
+			agent_id         INTEGER  NOT NULL,
+			triggered        BOOLEAN  NOT NULL DEFAULT 0,
+			triggered_reason TEXT     NOT NULL DEFAULT '',
+			target           TEXT     NOT NULL DEFAULT '',
+			target_agent     INTEGER  NOT NULL DEFAULT 0,
+			payload_raw      TEXT     NOT NULL DEFAULT '',
+			dscp             INTEGER  NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_probe_data_type_probe_created ON probe_data (type, probe_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_probe_data_agent_created ON probe_data (agent_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_probe_data_agent_received ON probe_data (agent_id, received_at)`,
+		`CREATE TABLE IF NOT EXISTS analysis_snapshots (
+			workspace_id      INTEGER  NOT NULL,
+			generated_at      DATETIME NOT NULL,
+			overall_health    REAL,
+			grade             TEXT,
+			latency_score     REAL,
+			packet_loss_score REAL,
+			route_stability   REAL,
+			mos_score         REAL,
+			status            TEXT,
+			status_message    TEXT,
+			incident_count    INTEGER,
+			total_agents      INTEGER,
+			online_agents     INTEGER,
+			total_probes      INTEGER,
+			incidents_json    TEXT,
+			agents_json       TEXT,
+			llm_summary       TEXT NOT NULL DEFAULT '',
+			scoring_version   INTEGER NOT NULL DEFAULT 0,
+			llm_cache_key     TEXT NOT NULL DEFAULT '',
+			llm_cached        INTEGER NOT NULL DEFAULT 0,
+			llm_prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			llm_completion_tokens INTEGER NOT NULL DEFAULT 0,
+			enrichment_status TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analysis_snapshots_ws_generated ON analysis_snapshots (workspace_id, generated_at)`,
+		`CREATE TABLE IF NOT EXISTS analysis_snapshot_enrichments (
+			workspace_id          INTEGER  NOT NULL,
+			generated_at          DATETIME NOT NULL,
+			enrichment_status     TEXT     NOT NULL,
+			llm_summary           TEXT     NOT NULL DEFAULT '',
+			llm_cached            INTEGER  NOT NULL DEFAULT 0,
+			llm_prompt_tokens     INTEGER  NOT NULL DEFAULT 0,
+			llm_completion_tokens INTEGER  NOT NULL DEFAULT 0,
+			applied_at            DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analysis_snapshot_enrichments_ws_generated ON analysis_snapshot_enrichments (workspace_id, generated_at)`,
+		`CREATE TABLE IF NOT EXISTS analysis_snapshot_versions (
+			job_id            INTEGER  NOT NULL,
+			workspace_id      INTEGER  NOT NULL,
+			generated_at      DATETIME NOT NULL,
+			scoring_version   INTEGER  NOT NULL,
+			overall_health    REAL,
+			grade             TEXT,
+			latency_score     REAL,
+			packet_loss_score REAL,
+			route_stability   REAL,
+			mos_score         REAL,
+			status            TEXT,
+			incident_count    INTEGER,
+			total_agents      INTEGER,
+			online_agents     INTEGER,
+			total_probes      INTEGER,
+			incidents_json    TEXT,
+			agents_json       TEXT,
+			reprocessed_at    DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_analysis_snapshot_versions_ws_job ON analysis_snapshot_versions (workspace_id, job_id, generated_at)`,
+	}
+	stmts = append(stmts, speedtestSQLiteDDL...)
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlite telemetry migrate: %w", err)
+		}
+	}
+	if err := migrateLabelColumnsSQLite(ctx, s.db); err != nil {
+		return fmt.Errorf("sqlite telemetry migrate: %w", err)
+	}
+	if err := migrateEnrichmentColumnSQLite(ctx, s.db); err != nil {
+		return fmt.Errorf("sqlite telemetry migrate: %w", err)
+	}
+	if err := migrateSpeedtestHostColumnSQLite(ctx, s.db); err != nil {
+		return fmt.Errorf("sqlite telemetry migrate: %w", err)
+	}
+	if err := backfillSpeedtestData(ctx, s.db); err != nil {
+		return fmt.Errorf("sqlite telemetry migrate: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	cutoff := before.UTC().Format("2006-01-02 15:04:05")
+	var total int64
+	for _, q := range []string{
+		`DELETE FROM probe_data WHERE created_at < ?`,
+		`DELETE FROM speedtest_data WHERE created_at < ?`,
+		`DELETE FROM analysis_snapshots WHERE generated_at < ?`,
+		`DELETE FROM analysis_snapshot_enrichments WHERE generated_at < ?`,
+		`DELETE FROM analysis_snapshot_versions WHERE generated_at < ?`,
+	} {
+		res, err := s.db.ExecContext(ctx, q, cutoff)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+func (s *sqliteStore) DeleteProbeDataByProbeID(ctx context.Context, probeID uint) error {
+	return s.deleteWhere(ctx, deletion.ProbeDataTables, "probe_id", probeID)
+}
+
+func (s *sqliteStore) DeleteProbeDataByAgentID(ctx context.Context, agentID uint) error {
+	return s.deleteWhere(ctx, deletion.ProbeDataTables, "agent_id", agentID)
+}
+
+func (s *sqliteStore) DeleteWorkspaceData(ctx context.Context, workspaceID uint) error {
+	return s.deleteWhere(ctx, deletion.WorkspaceTables, "workspace_id", workspaceID)
+}
+
+// deleteWhere deletes the entity's rows from each table that exists.
+func (s *sqliteStore) deleteWhere(ctx context.Context, tables []string, column string, id uint) error {
+	for _, table := range tables {
+		var n int
+		if err := s.db.QueryRowContext(ctx,
+			`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n); err != nil {
+			return fmt.Errorf("sqlite delete by %s=%d: %w", column, id, err)
+		}
+		if n == 0 {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, column), id); err != nil {
+			return fmt.Errorf("sqlite delete %s by %s=%d: %w", table, column, id, err)
+		}
+	}
+	return nil
+}
+
+// RunTelemetryRetention prunes rows older than retentionDays every
+// interval until ctx is cancelled. A no-op loop for ClickHouse, whose
+// TTLs already expire data.
+func RunTelemetryRetention(ctx context.Context, store ProbeDataStore, retentionDays int, interval time.Duration) {
+	if store.Backend() == TelemetryClickHouse || retentionDays <= 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	prune := func() {
+		n, err := store.Prune(ctx, time.Now().UTC().AddDate(0, 0, -retentionDays))
+		if err != nil {
+			log.WithError(err).Warn("[telemetry] retention prune failed")
+			return
+		}
+		if n > 0 {
+			log.Infof("[telemetry] pruned %d rows older than %d days", n, retentionDays)
+		}
+	}
+	prune()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			prune()
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+)
+
+// TestSQLiteTelemetryRoundTrip verifies the portable write and read paths
+// run unchanged against the embedded backend, plus its retention and
+// deletion.
+func TestSQLiteTelemetryRoundTrip(t *testing.T) {
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db := store.DB()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	rows := []ProbeData{
+		{ProbeID: 7, AgentID: 1, ProbeAgentID: 1, Target: "8.8.8.8", CreatedAt: now.Add(-2 * time.Minute)},
+		{ProbeID: 7, AgentID: 1, ProbeAgentID: 1, Target: "8.8.8.8", CreatedAt: now.Add(-time.Minute), Triggered: true},
+		{ProbeID: 7, AgentID: 1, ProbeAgentID: 1, Target: "8.8.8.8", CreatedAt: now.AddDate(0, 0, -40)},
+		{ProbeID: 9, AgentID: 2, ProbeAgentID: 2, Target: "1.1.1.1", CreatedAt: now.Add(-time.Minute)},
+	}
+	for _, r := range rows {
+		if err := SaveRecordCH(ctx, db, r, string(TypePing), map[string]any{"avg_rtt": 12}); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	got, err := GetProbeDataByProbe(ctx, db, 7, nil, now.Add(-time.Hour), time.Time{}, false, 0, "")
+	if err != nil {
+		t.Fatalf("by probe: %v", err)
+	}
+	if len(got) != 2 || !got[0].CreatedAt.Equal(now.Add(-time.Minute)) || !got[0].Triggered {
+		t.Fatalf("by probe = %+v", got)
+	}
+
+	agent := uint64(2)
+	latest, err := GetLatestByTypeAndAgent(ctx, db, string(TypePing), agent, nil)
+	if err != nil || latest == nil || latest.ProbeID != 9 {
+		t.Fatalf("latest = %+v, err = %v", latest, err)
+	}
+
+	if n, err := store.Prune(ctx, now.AddDate(0, 0, -30)); err != nil || n != 1 {
+		t.Errorf("prune = %d, %v; want 1 row", n, err)
+	}
+	if err := store.DeleteProbeDataByProbeID(ctx, 7); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if left, _ := FindProbeData(ctx, db, FindParams{}); len(left) != 1 || left[0].ProbeID != 9 {
+		t.Errorf("remaining rows = %+v", left)
+	}
+}
+
+// TestTelemetryPurgeTables lists the telemetry tables a workspace purge
+// clears and verifies each loses only the purged agent's or workspace's
+// rows, restored archive copies included.
+func TestTelemetryPurgeTables(t *testing.T) {
+	want := map[string]string{
+		"probe_data":                    "agent_id",
+		"speedtest_data":                "agent_id",
+		"probe_data_restored":           "agent_id",
+		"speedtest_data_restored":       "agent_id",
+		"analysis_snapshots":            "workspace_id",
+		"analysis_snapshot_enrichments": "workspace_id",
+		"analysis_snapshot_versions":    "workspace_id",
+		"analysis_snapshots_restored":   "workspace_id",
+	}
+	got := map[string]string{}
+	for _, table := range deletion.ProbeDataTables {
+		got[table] = "agent_id"
+	}
+	for _, table := range deletion.WorkspaceTables {
+		got[table] = "workspace_id"
+	}
+	if !maps.Equal(got, want) {
+		t.Fatalf("purged tables = %v, want %v", got, want)
+	}
+
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db := store.DB()
+	// Nothing has been restored yet; the missing copies are skipped.
+	if err := store.DeleteWorkspaceData(ctx, 99); err != nil {
+		t.Fatalf("delete before restore: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range []uint{1, 2} {
+		r := ProbeData{ProbeID: id, AgentID: id, ProbeAgentID: id, Type: TypeSpeedtest, CreatedAt: now, ReceivedAt: now}
+		if err := SaveRecordCH(ctx, db, r, string(TypePing), map[string]any{"avg_rtt": 1}); err != nil {
+			t.Fatalf("probe_data: %v", err)
+		}
+		if err := insertSpeedtestRow(ctx, db, r, []byte(`{}`)); err != nil {
+			t.Fatalf("speedtest_data: %v", err)
+		}
+		for _, q := range []string{
+			`INSERT INTO analysis_snapshots (workspace_id, generated_at) VALUES (?, CURRENT_TIMESTAMP)`,
+			`INSERT INTO analysis_snapshot_enrichments (workspace_id, generated_at, enrichment_status, applied_at) VALUES (?, CURRENT_TIMESTAMP, 'done', CURRENT_TIMESTAMP)`,
+			`INSERT INTO analysis_snapshot_versions (job_id, workspace_id, generated_at, scoring_version, reprocessed_at) VALUES (1, ?, CURRENT_TIMESTAMP, 1, CURRENT_TIMESTAMP)`,
+		} {
+			if _, err := db.ExecContext(ctx, q, id); err != nil {
+				t.Fatalf("%s: %v", q, err)
+			}
+		}
+	}
+	for _, table := range []string{"probe_data", "speedtest_data", "analysis_snapshots"} {
+		if _, err := db.ExecContext(ctx, "CREATE TABLE "+table+"_restored AS SELECT * FROM "+table); err != nil {
+			t.Fatalf("restore %s: %v", table, err)
+		}
+	}
+
+	if err := store.DeleteProbeDataByAgentID(ctx, 1); err != nil {
+		t.Fatalf("delete agent: %v", err)
+	}
+	if err := store.DeleteWorkspaceData(ctx, 1); err != nil {
+		t.Fatalf("delete workspace: %v", err)
+	}
+	for table, column := range want {
+		var purged, kept int
+		q := "SELECT COALESCE(SUM(" + column + " = 1), 0), COALESCE(SUM(" + column + " = 2), 0) FROM " + table
+		if err := db.QueryRowContext(ctx, q).Scan(&purged, &kept); err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		if purged != 0 || kept != 1 {
+			t.Errorf("%s: %d purged rows left, %d kept rows; want 0 and 1", table, purged, kept)
+		}
+	}
+}
+
+// TestLabelColumnsFilter verifies label values written at ingest can be
+// filtered on without touching Postgres.
+func TestLabelColumnsFilter(t *testing.T) {
+	if _, set := os.LookupEnv("CH_LABEL_COLUMNS"); set {
+		t.Skip("assumes the default CH_LABEL_COLUMNS")
+	}
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Migrate must stay idempotent with the label columns present.
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	db := store.DB()
+
+	now := time.Now().UTC()
+	prod := LabelColumnValues([]byte(`{"env":"prod","site":"ams","owner":"netops"}`))
+	if prod["env"] != "prod" || prod["site"] != "ams" || prod["owner"] != "" {
+		t.Fatalf("label values = %v", prod)
+	}
+	rows := []ProbeData{
+		{ProbeID: 1, AgentID: 1, CreatedAt: now, Labels: prod},
+		{ProbeID: 2, AgentID: 1, CreatedAt: now, Labels: map[string]string{"env": "staging"}},
+		{ProbeID: 3, AgentID: 1, CreatedAt: now},
+	}
+	for _, r := range rows {
+		if err := SaveRecordCH(ctx, db, r, string(TypePing), map[string]any{"avg_rtt": 1}); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	got, err := FindProbeData(ctx, db, FindParams{Labels: map[string]string{"env": "prod"}})
+	if err != nil || len(got) != 1 || got[0].ProbeID != 1 {
+		t.Fatalf("env=prod = %+v, err = %v", got, err)
+	}
+	got, err = FindProbeData(ctx, db, FindParams{Labels: map[string]string{"env": "prod", "site": "fra"}})
+	if err != nil || len(got) != 0 {
+		t.Fatalf("env=prod,site=fra = %+v, err = %v", got, err)
+	}
+	if _, err := FindProbeData(ctx, db, FindParams{Labels: map[string]string{"owner": "netops"}}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("unconfigured label key: err = %v, want ErrBadInput", err)
+	}
+}
+
+func TestParseLabelColumns(t *testing.T) {
+	got := parseLabelColumns(" Env, site,env,,bad-key,9lives,region")
+	want := []string{"env", "site", "region"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// TestSpeedtestTable verifies speedtest rows land in speedtest_data with
+// typed columns, legacy probe_data rows are copied over once, and the
+// getters return both unchanged.
+func TestSpeedtestTable(t *testing.T) {
+	store, err := OpenSQLiteTelemetry(filepath.Join(t.TempDir(), "telemetry.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	db := store.DB()
+	now := time.Now().UTC().Truncate(time.Second)
+	result := func(dl float64) SpeedTestResult {
+		return SpeedTestResult{TestData: []SpeedTestServer{{
+			ID: "4242", Name: "Example ISP", DLSpeed: SpeedTestByteRate(dl), ULSpeed: SpeedTestByteRate(dl / 2),
+			Latency: 12 * time.Millisecond, Jitter: 2 * time.Millisecond,
+		}}}
+	}
+
+	if err := store.Migrate(ctx, 30); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// A row written to probe_data before speedtest_data existed; the next
+	// migration copies it, the one after must not copy it again.
+	if err := SaveRecordCH(ctx, db, ProbeData{AgentID: 1, Target: "4242", CreatedAt: now.Add(-2 * time.Hour)}, string(TypeSpeedtest), result(10_000_000)); err != nil {
+		t.Fatalf("legacy insert: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Migrate(ctx, 30); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+
+	if err := SaveSpeedtestCH(ctx, db, ProbeData{AgentID: 1, Target: "4242", CreatedAt: now.Add(-time.Hour)}, string(TypeSpeedtest), result(20_000_000)); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	typ := string(TypeSpeedtest)
+	agentID := uint64(1)
+	rows, err := FindProbeData(ctx, db, FindParams{Type: &typ, AgentID: &agentID})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("find = %d rows, %v; want legacy row copied once plus the new one", len(rows), err)
+	}
+	var got SpeedTestResult
+	if err := rows[0].DecodePayload(&got); err != nil || got.TestData[0].DLSpeed != 20_000_000 {
+		t.Errorf("latest payload = %+v, %v", got, err)
+	}
+	if _, err := FindProbeData(ctx, db, FindParams{Type: &typ, Labels: map[string]string{"site": "hq"}}); !errors.Is(err, ErrBadInput) {
+		t.Errorf("label filter on speedtests: err = %v, want ErrBadInput", err)
+	}
+
+	stats, err := getWorkspaceSpeedtestMetrics(ctx, db, []uint{1}, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	// 10 and 20 MB/s → 80 and 160 Mbps.
+	if s := stats["1:4242"]; s.Count != 2 || s.AvgDownload != 120 || s.AvgLatency != 12 {
+		t.Errorf("metrics = %+v", s)
+	}
+
+	if err := store.DeleteProbeDataByAgentID(ctx, 1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if left, _ := FindProbeData(ctx, db, FindParams{Type: &typ}); len(left) != 0 {
+		t.Errorf("speedtest rows left after agent delete: %d", len(left))
+	}
+}
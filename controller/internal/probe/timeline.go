@@ -0,0 +1,636 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/audit"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Workspace Timeline ──
+//
+// One chronological feed of what happened in a workspace, for the
+// activity view. Sources:
+//   - incident: analysis incidents appearing/disappearing between
+//     consecutive analysis snapshots, and alerts triggering/resolving
+//   - netinfo: diffs between consecutive NETINFO reports (diffNetInfo)
+//   - agent: WebSocket connects/disconnects (agent.StatusEvent); a
+//     reconnect within timelineMinOutage is not shown
+//   - config: the workspace audit log (audit.Entry)
+//   - annotation: notes users pin to a point in time
+//
+// A source that fails (e.g. ClickHouse unavailable) is listed in
+// Unavailable and the rest of the feed is still returned.
+
+const (
+	TimelineCategoryIncident   = "incident"
+	TimelineCategoryNetInfo    = "netinfo"
+	TimelineCategoryAgent      = "agent"
+	TimelineCategoryConfig     = "config"
+	TimelineCategoryAnnotation = "annotation"
+)
+
+// Event types.
+const (
+	TimelineIncidentOpened   = "incident_opened"
+	TimelineIncidentResolved = "incident_resolved"
+	TimelineNetInfoChange    = "netinfo_change"
+	TimelineAgentOffline     = "agent_offline"
+	TimelineAgentOnline      = "agent_online"
+	TimelineConfigChange     = "config_change"
+	TimelineAnnotationAdded  = "annotation"
+)
+
+var timelineCategories = []string{
+	TimelineCategoryIncident, TimelineCategoryNetInfo, TimelineCategoryAgent,
+	TimelineCategoryConfig, TimelineCategoryAnnotation,
+}
+
+const (
+	timelineDefaultWindow = 24 * time.Hour
+	timelineMaxWindow     = 7 * 24 * time.Hour
+	timelineDefaultLimit  = 200
+	timelineMaxLimit      = 1000
+	// timelineMinOutage hides disconnects the agent recovered from within
+	// this long (controller restarts, load balancer idle timeouts).
+	timelineMinOutage = 2 * time.Minute
+	// timelineMaxSnapshots bounds analysis snapshots read for incident
+	// transitions (7 days at one per minute).
+	timelineMaxSnapshots = 7 * 24 * 60
+)
+
+// TimelineEvent is one entry in the feed.
+type TimelineEvent struct {
+	At       time.Time `json:"at"`
+	Category string    `json:"category"`
+	Type     string    `json:"type"`
+	Severity string    `json:"severity,omitempty"` // info, warning, critical
+	Title    string    `json:"title"`
+	Detail   string    `json:"detail,omitempty"`
+	AgentID  *uint     `json:"agent_id,omitempty"`
+	ProbeID  *uint     `json:"probe_id,omitempty"`
+	UserID   *uint     `json:"user_id,omitempty"`
+	// Ref identifies the source record: an analysis incident ID, or
+	// "alert:12", "audit:7", "annotation:3".
+	Ref string `json:"ref,omitempty"`
+}
+
+// TimelineQuery selects a window of a workspace's timeline.
+type TimelineQuery struct {
+	WorkspaceID uint
+	From, To    time.Time // zero: last 24h
+	AgentID     uint      // 0 = all agents
+	Categories  []string  // empty = all
+	Limit       int       // 0 = 200
+}
+
+// Timeline is the GET /workspaces/:id/timeline response.
+type Timeline struct {
+	WorkspaceID uint            `json:"workspace_id"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Events      []TimelineEvent `json:"events"` // newest first
+	Truncated   bool            `json:"truncated"`
+	Unavailable []string        `json:"unavailable,omitempty"`
+}
+
+func (q *TimelineQuery) normalize(now time.Time) error {
+	if q.WorkspaceID == 0 {
+		return fmt.Errorf("%w: workspace required", ErrBadInput)
+	}
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-timelineDefaultWindow)
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrBadInput)
+	}
+	if q.To.Sub(q.From) > timelineMaxWindow {
+		return fmt.Errorf("%w: window exceeds %s", ErrBadInput, timelineMaxWindow)
+	}
+	switch {
+	case q.Limit < 0:
+		return fmt.Errorf("%w: limit must be positive", ErrBadInput)
+	case q.Limit == 0:
+		q.Limit = timelineDefaultLimit
+	case q.Limit > timelineMaxLimit:
+		q.Limit = timelineMaxLimit
+	}
+	for i, c := range q.Categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !slices.Contains(timelineCategories, c) {
+			return fmt.Errorf("%w: unknown category %q (want %s)", ErrBadInput, c, strings.Join(timelineCategories, ", "))
+		}
+		q.Categories[i] = c
+	}
+	return nil
+}
+
+func (q *TimelineQuery) wants(category string) bool {
+	return len(q.Categories) == 0 || slices.Contains(q.Categories, category)
+}
+
+// GetWorkspaceTimeline builds the workspace's timeline for q. ch may be
+// nil, in which case ClickHouse-backed sources are reported unavailable.
+func GetWorkspaceTimeline(ctx context.Context, ch *sql.DB, pg *gorm.DB, q TimelineQuery) (*Timeline, error) {
+	if err := q.normalize(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	agents, err := getWorkspaceAgents(ctx, pg, q.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(agents))
+	for _, a := range agents {
+		names[a.ID] = a.Name
+	}
+	if q.AgentID != 0 {
+		if _, ok := names[q.AgentID]; !ok {
+			return nil, ErrNotFound
+		}
+	}
+
+	out := &Timeline{WorkspaceID: q.WorkspaceID, From: q.From, To: q.To, Events: []TimelineEvent{}}
+	add := func(source string, events []TimelineEvent, err error) {
+		if err != nil {
+			log.Warnf("probe.GetWorkspaceTimeline: ws=%d %s: %v", q.WorkspaceID, source, err)
+			out.Unavailable = append(out.Unavailable, source)
+			return
+		}
+		out.Events = append(out.Events, events...)
+	}
+
+	if q.wants(TimelineCategoryIncident) {
+		evs, err := timelineAlertEvents(ctx, pg, q)
+		add("alerts", evs, err)
+		if ch == nil {
+			out.Unavailable = append(out.Unavailable, "analysis_snapshots")
+		} else {
+			evs, err := timelineSnapshotEvents(ctx, ch, q, names)
+			add("analysis_snapshots", evs, err)
+		}
+	}
+	if q.wants(TimelineCategoryNetInfo) {
+		if ch == nil {
+			out.Unavailable = append(out.Unavailable, "netinfo")
+		} else {
+			evs, err := timelineNetInfoEvents(ctx, ch, q, names)
+			add("netinfo", evs, err)
+		}
+	}
+	if q.wants(TimelineCategoryAgent) {
+		evs, err := agent.ListStatusEvents(ctx, pg, q.WorkspaceID, q.AgentID, q.From, q.To)
+		add("agent_status", agentStatusTimeline(evs, names, timelineMinOutage), err)
+	}
+	if q.wants(TimelineCategoryConfig) {
+		evs, err := timelineAuditEvents(ctx, pg, q)
+		add("audit_log", evs, err)
+	}
+	if q.wants(TimelineCategoryAnnotation) {
+		evs, err := timelineAnnotationEvents(ctx, pg, q)
+		add("annotations", evs, err)
+	}
+
+	out.Events, out.Truncated = sortTimeline(out.Events, q.Limit)
+	return out, nil
+}
+
+// sortTimeline orders events newest first and caps them at limit.
+func sortTimeline(events []TimelineEvent, limit int) ([]TimelineEvent, bool) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].At.Equal(events[j].At) {
+			return events[i].At.After(events[j].At)
+		}
+		return events[i].Type < events[j].Type
+	})
+	if len(events) > limit {
+		return events[:limit], true
+	}
+	return events, false
+}
+
+// ── Sources ──
+
+func timelineAlertEvents(ctx context.Context, pg *gorm.DB, q TimelineQuery) ([]TimelineEvent, error) {
+	var alerts []alert.Alert
+	db := pg.WithContext(ctx).
+		Where("workspace_id = ?", q.WorkspaceID).
+		Where("(triggered_at >= ? AND triggered_at < ?) OR (resolved_at >= ? AND resolved_at < ?)", q.From, q.To, q.From, q.To)
+	if q.AgentID != 0 {
+		db = db.Where("agent_id = ?", q.AgentID)
+	}
+	if err := db.Order("triggered_at DESC").Limit(timelineMaxLimit).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+
+	var out []TimelineEvent
+	for _, a := range alerts {
+		title := a.Message
+		if title == "" {
+			subject := a.ProbeTarget
+			if subject == "" {
+				subject = a.AgentName
+			}
+			title = fmt.Sprintf("%s alert on %s", a.Metric, subject)
+		}
+		ref := fmt.Sprintf("alert:%d", a.ID)
+		if !a.TriggeredAt.Before(q.From) && a.TriggeredAt.Before(q.To) {
+			out = append(out, TimelineEvent{
+				At: a.TriggeredAt, Category: TimelineCategoryIncident, Type: TimelineIncidentOpened,
+				Severity: string(a.Severity), Title: title,
+				Detail:  fmt.Sprintf("%s %.2f (threshold %.2f)", a.Metric, a.Value, a.Threshold),
+				AgentID: a.AgentID, ProbeID: a.ProbeID, Ref: ref,
+			})
+		}
+		if a.ResolvedAt != nil && !a.ResolvedAt.Before(q.From) && a.ResolvedAt.Before(q.To) {
+			out = append(out, TimelineEvent{
+				At: *a.ResolvedAt, Category: TimelineCategoryIncident, Type: TimelineIncidentResolved,
+				Severity: string(a.Severity), Title: "Resolved: " + title,
+				AgentID: a.AgentID, ProbeID: a.ProbeID, Ref: ref,
+			})
+		}
+	}
+	return out, nil
+}
+
+// timelineSnapshot is the part of an analysis snapshot the timeline reads.
+type timelineSnapshot struct {
+	At        time.Time
+	Incidents []DetectedIncident
+}
+
+func timelineSnapshotEvents(ctx context.Context, ch *sql.DB, q TimelineQuery, names map[uint]string) ([]TimelineEvent, error) {
+	rows, err := ch.QueryContext(ctx, fmt.Sprintf(`
+SELECT generated_at, incidents_json
+FROM analysis_snapshots
+WHERE workspace_id = %d
+  AND generated_at >= %s
+  AND generated_at < %s
+ORDER BY generated_at
+LIMIT %d`, q.WorkspaceID, chQuoteTime(q.From), chQuoteTime(q.To), timelineMaxSnapshots))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snaps []timelineSnapshot
+	for rows.Next() {
+		var s timelineSnapshot
+		var raw string
+		if err := rows.Scan(&s.At, &raw); err != nil {
+			return nil, err
+		}
+		if raw != "" && json.Unmarshal([]byte(raw), &s.Incidents) != nil {
+			continue
+		}
+		snaps = append(snaps, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	agentName := ""
+	if q.AgentID != 0 {
+		agentName = names[q.AgentID]
+	}
+	return incidentTransitions(snaps, agentName), nil
+}
+
+// incidentTransitions diffs consecutive snapshots (oldest first): an
+// incident ID that appears is opened, one that disappears is resolved at
+// the first snapshot without it. Incidents already open in the first
+// snapshot are not reported. A non-empty agentName keeps only incidents
+// affecting that agent.
+func incidentTransitions(snaps []timelineSnapshot, agentName string) []TimelineEvent {
+	var out []TimelineEvent
+	relevant := func(inc DetectedIncident) bool {
+		return agentName == "" || slices.Contains(inc.AffectedAgents, agentName)
+	}
+	var open map[string]DetectedIncident
+	for i, s := range snaps {
+		cur := make(map[string]DetectedIncident, len(s.Incidents))
+		for _, inc := range s.Incidents {
+			cur[inc.ID] = inc
+		}
+		if i > 0 {
+			for id, inc := range cur {
+				if _, was := open[id]; !was && relevant(inc) {
+					out = append(out, TimelineEvent{
+						At: s.At, Category: TimelineCategoryIncident, Type: TimelineIncidentOpened,
+						Severity: inc.Severity, Title: inc.Title, Detail: inc.SuggestedCause, Ref: id,
+					})
+				}
+			}
+			for id, inc := range open {
+				if _, still := cur[id]; !still && relevant(inc) {
+					out = append(out, TimelineEvent{
+						At: s.At, Category: TimelineCategoryIncident, Type: TimelineIncidentResolved,
+						Severity: inc.Severity, Title: "Resolved: " + inc.Title, Ref: id,
+					})
+				}
+			}
+		}
+		open = cur
+	}
+	return out
+}
+
+func timelineNetInfoEvents(ctx context.Context, ch *sql.DB, q TimelineQuery, names map[uint]string) ([]TimelineEvent, error) {
+	ids := make([]string, 0, len(names))
+	if q.AgentID != 0 {
+		ids = append(ids, fmt.Sprintf("%d", q.AgentID))
+	} else {
+		for id := range names {
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := ch.QueryContext(ctx, fmt.Sprintf(`
+SELECT agent_id, created_at, payload_raw
+FROM probe_data
+WHERE type = 'NETINFO'
+  AND agent_id IN (%s)
+  AND created_at >= %s
+  AND created_at < %s
+ORDER BY agent_id, created_at
+LIMIT %d`, strings.Join(ids, ", "), chQuoteTime(q.From), chQuoteTime(q.To), MaxRawRowsForAggregation))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TimelineEvent
+	var prevAgent uint64
+	var prev *netInfoPayload
+	for rows.Next() {
+		var agentID uint64
+		var at time.Time
+		var raw string
+		if err := rows.Scan(&agentID, &at, &raw); err != nil {
+			return nil, err
+		}
+		var p netInfoPayload
+		if raw == "" || json.Unmarshal(UnsealAgentPayload(ctx, uint(agentID), []byte(raw)), &p) != nil {
+			continue
+		}
+		if prev != nil && agentID == prevAgent {
+			for _, c := range diffNetInfo(uint(agentID), *prev, p, at) {
+				out = append(out, netInfoTimelineEvent(c, names[c.AgentID]))
+			}
+		}
+		prevAgent, prev = agentID, &p
+	}
+	return out, rows.Err()
+}
+
+// netInfoTimelineEvent describes a NETINFO change, reusing the incident
+// titles for the gateway/DNS/interface/VPN fields.
+func netInfoTimelineEvent(c netInfoChange, agentName string) TimelineEvent {
+	if agentName == "" {
+		agentName = fmt.Sprintf("Agent %d", c.AgentID)
+	}
+	aid := c.AgentID
+	ev := TimelineEvent{
+		At: c.DetectedAt, Category: TimelineCategoryNetInfo, Type: TimelineNetInfoChange,
+		Severity: "info", AgentID: &aid, Ref: c.Field,
+	}
+	switch c.Field {
+	case "public_ip":
+		ev.Title = fmt.Sprintf("Public IP changed on %s", agentName)
+	case "isp":
+		ev.Title = fmt.Sprintf("ISP changed on %s", agentName)
+		ev.Severity = "warning"
+	default:
+		if inc, ok := netInfoChangeIncident(c, agentName); ok {
+			ev.Title, ev.Severity = inc.Title, inc.Severity
+		} else {
+			ev.Title = fmt.Sprintf("%s changed on %s", c.Field, agentName)
+		}
+	}
+	if c.OldValue != "" && c.NewValue != "" {
+		ev.Detail = c.OldValue + " → " + c.NewValue
+	}
+	return ev
+}
+
+// agentStatusTimeline turns connect/disconnect events (oldest first) into
+// timeline entries. Repeated states are collapsed, and an outage shorter
+// than minOutage is dropped together with its recovery.
+func agentStatusTimeline(events []agent.StatusEvent, names map[uint]string, minOutage time.Duration) []TimelineEvent {
+	byAgent := make(map[uint][]agent.StatusEvent)
+	for _, e := range events {
+		byAgent[e.AgentID] = append(byAgent[e.AgentID], e)
+	}
+	var out []TimelineEvent
+	for id, evs := range byAgent {
+		name := names[id]
+		if name == "" {
+			name = fmt.Sprintf("Agent %d", id)
+		}
+		known, online := false, false
+		var offlineAt time.Time
+		for i := 0; i < len(evs); i++ {
+			e := evs[i]
+			if known && online == e.Online {
+				continue
+			}
+			known, online = true, e.Online
+			aid := id
+			if !e.Online {
+				// A quick reconnect hides the outage; the agent stays online.
+				if i+1 < len(evs) && evs[i+1].Online && evs[i+1].At.Sub(e.At) < minOutage {
+					i++
+					online = true
+					continue
+				}
+				offlineAt = e.At
+				out = append(out, TimelineEvent{
+					At: e.At, Category: TimelineCategoryAgent, Type: TimelineAgentOffline,
+					Severity: "warning", Title: fmt.Sprintf("%s went offline", name), AgentID: &aid,
+				})
+				continue
+			}
+			ev := TimelineEvent{
+				At: e.At, Category: TimelineCategoryAgent, Type: TimelineAgentOnline,
+				Severity: "info", Title: fmt.Sprintf("%s came online", name), AgentID: &aid,
+			}
+			if !offlineAt.IsZero() {
+				ev.Title = fmt.Sprintf("%s back online", name)
+				ev.Detail = fmt.Sprintf("offline for %s", e.At.Sub(offlineAt).Round(time.Second))
+				offlineAt = time.Time{}
+			}
+			if e.ClientIP != "" {
+				ev.Detail = strings.TrimPrefix(ev.Detail+", from "+e.ClientIP, ", ")
+			}
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func timelineAuditEvents(ctx context.Context, pg *gorm.DB, q TimelineQuery) ([]TimelineEvent, error) {
+	entries, err := audit.List(ctx, pg, q.WorkspaceID, audit.ListOptions{From: q.From, To: q.To, AgentID: q.AgentID, Limit: q.Limit})
+	if err != nil {
+		return nil, err
+	}
+	emails := make(map[uint]string)
+	var userIDs []uint
+	for _, e := range entries {
+		if e.UserID != 0 {
+			userIDs = append(userIDs, e.UserID)
+		}
+	}
+	if len(userIDs) > 0 {
+		var users []struct {
+			ID    uint
+			Email string
+		}
+		if err := pg.WithContext(ctx).Table("users").Select("id, email").Where("id IN ?", userIDs).Scan(&users).Error; err == nil {
+			for _, u := range users {
+				emails[u.ID] = u.Email
+			}
+		}
+	}
+
+	out := make([]TimelineEvent, 0, len(entries))
+	for _, e := range entries {
+		summary := e.Summary()
+		ev := TimelineEvent{
+			At: e.CreatedAt, Category: TimelineCategoryConfig, Type: TimelineConfigChange,
+			Title:   strings.ToUpper(summary[:1]) + summary[1:],
+			Detail:  e.Method + " " + e.Route,
+			AgentID: e.AgentID, Ref: fmt.Sprintf("audit:%d", e.ID),
+		}
+		if e.UserID != 0 {
+			uid := e.UserID
+			ev.UserID = &uid
+			if email := emails[uid]; email != "" {
+				ev.Detail = "by " + email
+			}
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func timelineAnnotationEvents(ctx context.Context, pg *gorm.DB, q TimelineQuery) ([]TimelineEvent, error) {
+	db := pg.WithContext(ctx).Where("workspace_id = ? AND at >= ? AND at < ?", q.WorkspaceID, q.From, q.To)
+	if q.AgentID != 0 {
+		db = db.Where("agent_id = ? OR agent_id IS NULL", q.AgentID)
+	}
+	var notes []TimelineAnnotation
+	if err := db.Order("at DESC").Limit(q.Limit).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	out := make([]TimelineEvent, 0, len(notes))
+	for _, n := range notes {
+		uid := n.UserID
+		out = append(out, TimelineEvent{
+			At: n.At, Category: TimelineCategoryAnnotation, Type: TimelineAnnotationAdded,
+			Title: n.Title, Detail: n.Body, AgentID: n.AgentID, ProbeID: n.ProbeID, UserID: &uid,
+			Ref: fmt.Sprintf("annotation:%d", n.ID),
+		})
+	}
+	return out, nil
+}
+
+// ── Annotations ──
+
+// TimelineAnnotation is a user note pinned to a point in time ("ISP
+// maintenance window", "swapped core switch"), optionally about one agent
+// or probe.
+type TimelineAnnotation struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	WorkspaceID uint           `gorm:"not null;index:idx_timeline_annotations_ws_at,priority:1" json:"workspace_id"`
+	At          time.Time      `gorm:"not null;index:idx_timeline_annotations_ws_at,priority:2" json:"at"`
+	UserID      uint           `gorm:"index" json:"user_id"`
+	Title       string         `gorm:"size:256;not null" json:"title"`
+	Body        string         `gorm:"size:4096" json:"body,omitempty"`
+	AgentID     *uint          `gorm:"index" json:"agent_id,omitempty"`
+	ProbeID     *uint          `json:"probe_id,omitempty"`
+}
+
+func (TimelineAnnotation) TableName() string { return "timeline_annotations" }
+
+// AnnotationInput is the create body. At defaults to now.
+type AnnotationInput struct {
+	At      *time.Time `json:"at"`
+	Title   string     `json:"title"`
+	Body    string     `json:"body"`
+	AgentID *uint      `json:"agent_id"`
+	ProbeID *uint      `json:"probe_id"`
+}
+
+// CreateAnnotation adds an annotation to a workspace's timeline. The
+// agent and probe, if given, must belong to the workspace.
+func CreateAnnotation(ctx context.Context, db *gorm.DB, workspaceID, userID uint, in AnnotationInput) (*TimelineAnnotation, error) {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Body = strings.TrimSpace(in.Body)
+	if in.Title == "" || len(in.Title) > 256 {
+		return nil, fmt.Errorf("%w: title required (max 256 characters)", ErrBadInput)
+	}
+	if len(in.Body) > 4096 {
+		return nil, fmt.Errorf("%w: body exceeds 4096 characters", ErrBadInput)
+	}
+	n := &TimelineAnnotation{WorkspaceID: workspaceID, UserID: userID, Title: in.Title, Body: in.Body, At: time.Now().UTC()}
+	if in.At != nil && !in.At.IsZero() {
+		n.At = in.At.UTC()
+	}
+	if in.AgentID != nil && *in.AgentID != 0 {
+		var count int64
+		if err := db.WithContext(ctx).Table("agents").
+			Where("id = ? AND workspace_id = ? AND deleted_at IS NULL", *in.AgentID, workspaceID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: agent %d not in workspace", ErrBadInput, *in.AgentID)
+		}
+		n.AgentID = in.AgentID
+	}
+	if in.ProbeID != nil && *in.ProbeID != 0 {
+		var count int64
+		if err := db.WithContext(ctx).Model(&Probe{}).
+			Where("id = ? AND workspace_id = ?", *in.ProbeID, workspaceID).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("%w: probe %d not in workspace", ErrBadInput, *in.ProbeID)
+		}
+		n.ProbeID = in.ProbeID
+	}
+	if err := db.WithContext(ctx).Create(n).Error; err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// DeleteAnnotation removes an annotation from a workspace's timeline.
+func DeleteAnnotation(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Delete(&TimelineAnnotation{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
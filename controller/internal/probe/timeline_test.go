@@ -0,0 +1,89 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+)
+
+func TestTimelineQueryNormalize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := TimelineQuery{WorkspaceID: 1, Categories: []string{" Config", "agent"}}
+	if err := q.normalize(now); err != nil {
+		t.Fatal(err)
+	}
+	if !q.From.Equal(now.Add(-24*time.Hour)) || q.Limit != timelineDefaultLimit {
+		t.Errorf("defaults = %+v", q)
+	}
+	if !q.wants(TimelineCategoryConfig) || q.wants(TimelineCategoryIncident) {
+		t.Errorf("categories = %v", q.Categories)
+	}
+
+	for _, bad := range []TimelineQuery{
+		{},
+		{WorkspaceID: 1, From: now, To: now.Add(-time.Hour)},
+		{WorkspaceID: 1, From: now.Add(-8 * 24 * time.Hour), To: now},
+		{WorkspaceID: 1, Categories: []string{"weather"}},
+	} {
+		if err := bad.normalize(now); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%+v: err = %v, want ErrBadInput", bad, err)
+		}
+	}
+}
+
+func TestIncidentTransitions(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 3, 1, 0, min, 0, 0, time.UTC) }
+	loss := DetectedIncident{ID: "loss_1", Title: "Packet loss to 10.0.0.1", Severity: "warning", AffectedAgents: []string{"hq"}}
+	dns := DetectedIncident{ID: "dns_2", Title: "DNS slow", Severity: "info", AffectedAgents: []string{"branch"}}
+	snaps := []timelineSnapshot{
+		{At: at(0), Incidents: []DetectedIncident{dns}}, // already open: not reported
+		{At: at(5), Incidents: []DetectedIncident{dns, loss}},
+		{At: at(10), Incidents: []DetectedIncident{loss}},
+		{At: at(15)},
+	}
+
+	evs := incidentTransitions(snaps, "")
+	if len(evs) != 3 {
+		t.Fatalf("events = %+v", evs)
+	}
+	if evs[0].Type != TimelineIncidentOpened || evs[0].Ref != "loss_1" || !evs[0].At.Equal(at(5)) {
+		t.Errorf("opened = %+v", evs[0])
+	}
+	if evs[1].Type != TimelineIncidentResolved || evs[1].Ref != "dns_2" || !evs[1].At.Equal(at(10)) {
+		t.Errorf("resolved = %+v", evs[1])
+	}
+
+	if evs := incidentTransitions(snaps, "branch"); len(evs) != 1 || evs[0].Ref != "dns_2" {
+		t.Errorf("agent-filtered events = %+v", evs)
+	}
+}
+
+func TestAgentStatusTimeline(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 3, 1, 0, min, 0, 0, time.UTC) }
+	events := []agent.StatusEvent{
+		{AgentID: 7, At: at(0), Online: true},
+		{AgentID: 7, At: at(1), Online: true}, // duplicate state
+		{AgentID: 7, At: at(10), Online: false},
+		{AgentID: 7, At: at(11), Online: true}, // blip: hidden
+		{AgentID: 7, At: at(20), Online: false},
+		{AgentID: 7, At: at(20), Online: false},
+		{AgentID: 7, At: at(50), Online: true},
+	}
+	evs := agentStatusTimeline(events, map[uint]string{7: "branch-01"}, 2*time.Minute)
+	if len(evs) != 3 {
+		t.Fatalf("events = %+v", evs)
+	}
+	if evs[1].Type != TimelineAgentOffline || !evs[1].At.Equal(at(20)) {
+		t.Errorf("offline = %+v", evs[1])
+	}
+	if evs[2].Title != "branch-01 back online" || evs[2].Detail != "offline for 30m0s" {
+		t.Errorf("online = %+v", evs[2])
+	}
+
+	sorted, truncated := sortTimeline(evs, 2)
+	if !truncated || len(sorted) != 2 || !sorted[0].At.Equal(at(50)) {
+		t.Errorf("sorted = %+v", sorted)
+	}
+}
@@ -0,0 +1,179 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Payload Timestamps ──
+//
+// Agents have sent MTR start/stop times in several shapes over the years:
+// RFC3339 with the host's offset, Go's time.String() form, naive
+// "YYYY-MM-DD HH:MM:SS" and Unix epochs. Timestamp accepts all of them at
+// ingest, rejects anything else, and always serializes as RFC3339 in UTC
+// with millisecond precision, so API consumers see one format whatever
+// the agent version. Times without a zone are taken as UTC.
+
+// TimestampFormat is how payload timestamps are written: RFC3339, UTC,
+// milliseconds.
+const TimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// timestampLayouts are the accepted string forms besides RFC3339.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999 -0700 MST", // Go time.String()
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999", // no zone: UTC
+	"2006-01-02 15:04:05.999999999", // no zone: UTC
+}
+
+// payloadTimestampKeys are the timestamp fields normalized per probe type
+// on the read path.
+var payloadTimestampKeys = map[Type][]string{
+	TypeMTR: {"start_timestamp", "stop_timestamp"},
+}
+
+// Timestamp is a payload time normalized to UTC. The zero value
+// serializes as null.
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp returns t as a UTC Timestamp.
+func NewTimestamp(t time.Time) Timestamp {
+	if t.IsZero() {
+		return Timestamp{}
+	}
+	return Timestamp{t.UTC()}
+}
+
+// ParseTimestamp parses an agent-sent time. Numbers are Unix epochs in
+// seconds, milliseconds, microseconds or nanoseconds, told apart by
+// magnitude. "" is the zero time.
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC(), nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return epochTime(f)
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: timestamp %q is not RFC3339, \"YYYY-MM-DD HH:MM:SS\" or a Unix epoch", ErrBadInput, s)
+}
+
+// epochTime converts a Unix epoch of unknown unit.
+func epochTime(f float64) (time.Time, error) {
+	if f <= 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, fmt.Errorf("%w: epoch timestamp %v out of range", ErrBadInput, f)
+	}
+	var ns float64
+	switch {
+	case f < 1e11: // seconds until year 5138
+		ns = f * 1e9
+	case f < 1e14:
+		ns = f * 1e6
+	case f < 1e17:
+		ns = f * 1e3
+	default:
+		ns = f
+	}
+	if ns > math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("%w: epoch timestamp %v out of range", ErrBadInput, f)
+	}
+	return time.Unix(0, int64(ns)).UTC(), nil
+}
+
+// UnmarshalJSON accepts a string or number in any ParseTimestamp form,
+// or null.
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	s := string(b)
+	if b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseTimestamp(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// MarshalJSON writes TimestampFormat, or null for the zero time.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.UTC().Format(TimestampFormat) + `"`), nil
+}
+
+// String returns TimestampFormat, or "" for the zero time.
+func (t Timestamp) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(TimestampFormat)
+}
+
+// NormalizePayloadTimestamps rewrites the timestamp fields of a payload
+// of the given type in TimestampFormat. Rows stored before ingest
+// normalization carry the agent's own format; payloads that don't parse
+// are returned unchanged.
+func NormalizePayloadTimestamps(kind Type, raw json.RawMessage) json.RawMessage {
+	keys := payloadTimestampKeys[kind]
+	if len(keys) == 0 || len(raw) == 0 {
+		return raw
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return raw
+	}
+	changed := false
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		var ts Timestamp
+		if err := ts.UnmarshalJSON(v); err != nil {
+			continue
+		}
+		out, _ := ts.MarshalJSON()
+		if !bytes.Equal(out, v) {
+			m[k], changed = out, true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// normalizeProbeDataTimes puts a row read from telemetry in UTC.
+func normalizeProbeDataTimes(r *ProbeData) {
+	r.CreatedAt, r.ReceivedAt = r.CreatedAt.UTC(), r.ReceivedAt.UTC()
+	r.Payload = NormalizePayloadTimestamps(r.Type, r.Payload)
+}
@@ -0,0 +1,108 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampFormats(t *testing.T) {
+	want := time.Date(2026, 6, 16, 18, 48, 1, 0, time.UTC)
+	for _, in := range []string{
+		"2026-06-16T11:48:01-07:00",
+		"2026-06-16T18:48:01Z",
+		"2026-06-16 11:48:01 -0700 PDT",
+		"2026-06-16 18:48:01",
+		"2026-06-16T18:48:01",
+		"1781635681",
+		"1781635681000",
+	} {
+		got, err := ParseTimestamp(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if !got.Equal(want) || got.Location() != time.UTC {
+			t.Errorf("%q = %v, want %v in UTC", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"yesterday", "16/06/2026 18:48", "-5"} {
+		if _, err := ParseTimestamp(in); !errors.Is(err, ErrBadInput) {
+			t.Errorf("%q: err = %v, want ErrBadInput", in, err)
+		}
+	}
+}
+
+func TestTimestampJSON(t *testing.T) {
+	var p mtrPayload
+	if err := json.Unmarshal([]byte(`{"start_timestamp": "2026-06-16T11:48:01.423973-07:00", "stop_timestamp": 1781635686.5}`), &p); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	out, _ := json.Marshal(struct {
+		Start Timestamp `json:"start"`
+		Stop  Timestamp `json:"stop"`
+		None  Timestamp `json:"none"`
+	}{p.StartTimestamp, p.StopTimestamp, Timestamp{}})
+	if want := `{"start":"2026-06-16T18:48:01.423Z","stop":"2026-06-16T18:48:06.500Z","none":null}`; string(out) != want {
+		t.Errorf("marshal = %s, want %s", out, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"start_timestamp": "last tuesday"}`), &p); !errors.Is(err, ErrBadInput) {
+		t.Errorf("bad format: err = %v, want ErrBadInput", err)
+	}
+}
+
+func TestNormalizePayloadTimestamps(t *testing.T) {
+	raw := json.RawMessage(`{"report":{"hops":[]},"start_timestamp":"2026-06-16T11:48:01-07:00","stop_timestamp":"2026-06-16T11:48:06-07:00"}`)
+	var got map[string]any
+	if err := json.Unmarshal(NormalizePayloadTimestamps(TypeMTR, raw), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got["start_timestamp"] != "2026-06-16T18:48:01.000Z" || got["stop_timestamp"] != "2026-06-16T18:48:06.000Z" || got["report"] == nil {
+		t.Errorf("normalized = %v", got)
+	}
+	if out := NormalizePayloadTimestamps(TypePing, raw); string(out) != string(raw) {
+		t.Errorf("PING payload rewritten: %s", out)
+	}
+}
+
+func TestAggregateMtrPayloadsUsesTraceTimes(t *testing.T) {
+	bucket := time.Date(2026, 6, 16, 18, 0, 0, 0, time.UTC)
+	hops := MtrReport{Hops: []MtrHop{{TTL: 1, Hosts: []MtrHopHost{{IP: "10.0.0.1"}}, Sent: 10, Recv: 10, Avg: "1.0"}}}
+	at := func(min, sec int) Timestamp {
+		return NewTimestamp(bucket.Add(time.Duration(min)*time.Minute + time.Duration(sec)*time.Second))
+	}
+
+	agg := aggregateMtrPayloads([]MtrPayload{
+		{Report: hops, StartTimestamp: at(3, 0), StopTimestamp: at(3, 5)},
+		{Report: hops, StartTimestamp: at(1, 0), StopTimestamp: at(1, 5)},
+	}, bucket, 5*time.Minute, "sig")
+	if !agg.StartTimestamp.Equal(at(1, 0).Time) || !agg.StopTimestamp.Equal(at(3, 5).Time) {
+		t.Errorf("span = %s – %s, want the traces' 18:01:00 – 18:03:05", agg.StartTimestamp, agg.StopTimestamp)
+	}
+	if agg.BucketStart == nil || agg.BucketEnd == nil || !agg.BucketEnd.Equal(bucket.Add(5*time.Minute)) {
+		t.Errorf("bucket = %v – %v", agg.BucketStart, agg.BucketEnd)
+	}
+
+	undated := aggregateMtrPayloads([]MtrPayload{{Report: hops}}, bucket, 5*time.Minute, "sig")
+	if !undated.StartTimestamp.IsZero() || !undated.StopTimestamp.IsZero() {
+		t.Errorf("traces without times got %s – %s", undated.StartTimestamp, undated.StopTimestamp)
+	}
+}
+
+func TestFillMtrTimestamps(t *testing.T) {
+	created := time.Date(2026, 6, 16, 18, 48, 0, 0, time.UTC)
+	var p mtrPayload
+	fillMtrTimestamps(&p, created)
+	if !p.StartTimestamp.Equal(created) || !p.StopTimestamp.Equal(created) {
+		t.Errorf("filled = %s – %s, want both %s", p.StartTimestamp, p.StopTimestamp, created)
+	}
+
+	p = mtrPayload{StopTimestamp: NewTimestamp(created.Add(-time.Minute))}
+	fillMtrTimestamps(&p, created)
+	if !p.StartTimestamp.Equal(p.StopTimestamp.Time) {
+		t.Errorf("start %s after stop %s", p.StartTimestamp, p.StopTimestamp)
+	}
+}
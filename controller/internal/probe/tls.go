@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -45,7 +44,7 @@ func initTLS(ch *sql.DB, pg *gorm.DB) {
 		},
 		func(ctx context.Context, data ProbeData, p TLSPayload) error {
 			if err := SaveRecordWithAlertEval(ctx, ch, pg, data, string(TypeTLS), p); err != nil {
-				log.WithError(err).Error("save TLS record (CH)")
+				ingestEntry(data).WithError(err).Error("save TLS record (CH)")
 				return err
 			}
 
@@ -54,7 +53,7 @@ func initTLS(ch *sql.DB, pg *gorm.DB) {
 				certInfo = p.Certificate.Subject
 			}
 
-			log.Printf("[tls] pid=%d target=%s protocol=%s version=%s cipher=%s days=%d expired=%v cert=%s",
+			ingestEntry(data).Infof("[tls] pid=%d target=%s protocol=%s version=%s cipher=%s days=%d expired=%v cert=%s",
 				data.ProbeID, data.Target, p.Protocol, p.TLSVersion, p.TLSCipherSuite, p.DaysUntilExpiry, p.IsExpired, certInfo)
 			return nil
 		},
@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
@@ -14,15 +13,25 @@ func initTrafficSim(db *sql.DB, pg *gorm.DB) {
 		TypeTrafficSim,
 		nil,
 		func(ctx context.Context, data ProbeData, p TrafficSimResult) error {
-			log.Infof("[trafficsim] RAW payload bytes: %s", string(data.Payload))
-			log.Infof("[trafficsim] Parsed TrafficSimResult: %+v", p)
+			// Older agents only report the marking inside the payload.
+			if data.DSCP == 0 && p.DSCPValue > 0 && p.DSCPValue <= maxDSCP {
+				data.DSCP = uint8(p.DSCPValue)
+			}
+			// Agent-to-agent cycles carry raw one-way delays; correct them
+			// with both agents' clock offsets while those are fresh.
+			if data.TargetAgent != 0 && correctOneWayDelay(p.OWD, data.AgentID, data.TargetAgent, time.Now()) {
+				ingestEntry(data).Debugf("[trafficsim] OWD corrected: fwd=%.2fms rev=%.2fms ±%.2fms",
+					p.OWD.ForwardMs, p.OWD.ReverseMs, p.OWD.SyncErrorMs)
+			}
+			ingestEntry(data).Debugf("[trafficsim] RAW payload bytes: %s", string(data.Payload))
+			ingestEntry(data).Debugf("[trafficsim] Parsed TrafficSimResult: %+v", p)
 
 			if err := SaveRecordWithAlertEval(ctx, db, pg, data, string(TypeTrafficSim), p); err != nil {
-				log.WithError(err).Error("save trafficsim record (CH)")
+				ingestEntry(data).WithError(err).Error("save trafficsim record (CH)")
 				return err
 			}
 
-			log.Printf("[trafficsim] pid=%d agent=%d loss=%.2f%% avgRTT=%.2fms",
+			ingestEntry(data).Infof("[trafficsim] pid=%d agent=%d loss=%.2f%% avgRTT=%.2fms",
 				data.ProbeID, data.AgentID, p.LossPercentage, p.AverageRTT)
 			return nil
 		},
@@ -91,6 +100,9 @@ type TrafficSimResult struct {
 	// Flow-level statistics
 	Flows map[string]interface{} `json:"flows,omitempty"`
 
+	// Per-direction one-way delay (agent-to-agent probes with clock sync)
+	OWD *OneWayDelay `json:"owd,omitempty"`
+
 	// Timestamps
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -0,0 +1,350 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── TrafficSim Port Sets ────────────────────────────────────────────────────
+//
+// A TRAFFICSIM target may name several ports so the same path can be
+// compared across QoS classes that middleboxes key on destination port:
+//
+//	host:5000            single port (unchanged)
+//	host:5000-5003       inclusive range
+//	host:5000,5060,8443  list (ranges may be mixed in: 5000,6000-6002)
+//
+// The stored target keeps the spec as written. ListForAgent expands it
+// into one single-port target per port on the same probe, like any other
+// multi-target probe, so the agent needs no changes, still sees each probe
+// ID once, and each port's results land in ClickHouse under its own
+// "host:port" target. detectPortThrottlingIncidents then compares ports
+// that share a host.
+
+// maxTrafficSimPorts caps how many ports a single target may expand to.
+// Every port is a full TrafficSim flow on the agent.
+const maxTrafficSimPorts = 16
+
+// Port throttling thresholds: a port is flagged when it is worse than the
+// best port on the same host by both the absolute and relative margin.
+const (
+	portThrottleMinSamples   = 5
+	portThrottleLossDeltaPct = 2.0  // percentage points
+	portThrottleLatencyRatio = 1.5  // × best port's average RTT
+	portThrottleLatencyMinMs = 10.0 // and at least this many ms slower
+)
+
+// hasTrafficSimPortSet reports whether target uses range/list syntax.
+func hasTrafficSimPortSet(target string) bool {
+	_, spec, ok := splitTrafficSimTarget(target)
+	return ok && strings.ContainsAny(spec, ",-")
+}
+
+// splitTrafficSimTarget splits "host:spec" on the last colon, keeping
+// bracketed IPv6 hosts intact.
+func splitTrafficSimTarget(target string) (host, spec string, ok bool) {
+	idx := strings.LastIndex(target, ":")
+	if idx <= 0 || idx == len(target)-1 {
+		return "", "", false
+	}
+	host = target[:idx]
+	if strings.Contains(host, ":") && !(strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]")) {
+		return "", "", false // bare IPv6 without a port
+	}
+	return strings.Trim(host, "[]"), target[idx+1:], true
+}
+
+// parsePortSet parses a port list/range spec into sorted, de-duplicated
+// ports.
+func parsePortSet(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	add := func(p int) error {
+		if p < 1 || p > 65535 {
+			return fmt.Errorf("port %d out of range", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+		if len(ports) > maxTrafficSimPorts {
+			return fmt.Errorf("more than %d ports", maxTrafficSimPorts)
+		}
+		return nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty port in %q", spec)
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil || end < start {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+			if end-start >= maxTrafficSimPorts {
+				return nil, fmt.Errorf("port range %q exceeds %d ports", part, maxTrafficSimPorts)
+			}
+		}
+		for p := start; p <= end; p++ {
+			if err := add(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// ExpandTrafficSimTarget expands a TRAFFICSIM target into one "host:port"
+// per port. Targets without a port set come back unchanged.
+func ExpandTrafficSimTarget(target string) ([]string, error) {
+	if !hasTrafficSimPortSet(target) {
+		return []string{target}, nil
+	}
+	host, spec, _ := splitTrafficSimTarget(target)
+	if host == "" {
+		return nil, fmt.Errorf("%w: missing host in %q", ErrTargetFormat, target)
+	}
+	ports, err := parsePortSet(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTargetFormat, err)
+	}
+	out := make([]string, len(ports))
+	for i, p := range ports {
+		out[i] = net.JoinHostPort(host, strconv.Itoa(p))
+	}
+	return out, nil
+}
+
+// validateTargetForType applies validateLiteralTarget, additionally
+// accepting port sets on TRAFFICSIM targets.
+func validateTargetForType(t string, probeType Type) bool {
+	if probeType == TypeTrafficSim && hasTrafficSimPortSet(t) {
+		_, err := ExpandTrafficSimTarget(t)
+		return err == nil
+	}
+	return validateLiteralTarget(t)
+}
+
+// expandTrafficSimPorts replaces the port-set targets of a TRAFFICSIM
+// probe with one single-port target per port. The probe is still one
+// entry with its own ID, so the agent never receives the same probe ID
+// twice. Probes without port sets are returned as-is.
+func expandTrafficSimPorts(p Probe) Probe {
+	if p.Type != TypeTrafficSim {
+		return p
+	}
+	targets := make([]Target, 0, len(p.Targets))
+	for _, t := range p.Targets {
+		addrs, err := ExpandTrafficSimTarget(t.Target)
+		if err != nil {
+			addrs = []string{t.Target} // stored before validation existed; let the agent report it
+		}
+		for _, addr := range addrs {
+			tt := t
+			tt.Target = addr
+			targets = append(targets, tt)
+		}
+	}
+	p.Targets = targets
+	return p
+}
+
+// ── Port comparison ──
+
+// portResultRow is one (agent, host:port) TRAFFICSIM aggregate.
+type portResultRow struct {
+	agentID   uint
+	target    string
+	samples   int
+	latencyMs float64
+	lossPct   float64
+}
+
+// PortThrottleFinding describes one port that performs worse than its
+// siblings on the same agent→host path.
+type PortThrottleFinding struct {
+	AgentID         uint    `json:"agent_id"`
+	Host            string  `json:"host"`
+	Port            string  `json:"port"`
+	BaselinePort    string  `json:"baseline_port"`
+	LossPct         float64 `json:"loss_pct"`
+	BaselineLossPct float64 `json:"baseline_loss_pct"`
+	LatencyMs       float64 `json:"latency_ms"`
+	BaselineLatency float64 `json:"baseline_latency_ms"`
+	Samples         int     `json:"samples"`
+}
+
+// comparePortResults groups rows by agent and host and flags ports that
+// are materially worse than the best-performing port. Paths probed on a
+// single port are skipped.
+func comparePortResults(rows []portResultRow) []PortThrottleFinding {
+	type pathKey struct {
+		agent uint
+		host  string
+	}
+	groups := make(map[pathKey][]portResultRow)
+	for _, r := range rows {
+		if r.samples < portThrottleMinSamples {
+			continue
+		}
+		host, port, err := net.SplitHostPort(r.target)
+		if err != nil || port == "" {
+			continue
+		}
+		k := pathKey{r.agentID, host}
+		groups[k] = append(groups[k], r)
+	}
+
+	var out []PortThrottleFinding
+	for k, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		// Baseline: lowest loss, then lowest latency.
+		sort.Slice(g, func(i, j int) bool {
+			if g[i].lossPct != g[j].lossPct {
+				return g[i].lossPct < g[j].lossPct
+			}
+			return g[i].latencyMs < g[j].latencyMs
+		})
+		best := g[0]
+		_, bestPort, _ := net.SplitHostPort(best.target)
+		for _, r := range g[1:] {
+			lossWorse := r.lossPct-best.lossPct >= portThrottleLossDeltaPct
+			latWorse := best.latencyMs > 0 &&
+				r.latencyMs >= best.latencyMs*portThrottleLatencyRatio &&
+				r.latencyMs-best.latencyMs >= portThrottleLatencyMinMs
+			if !lossWorse && !latWorse {
+				continue
+			}
+			_, port, _ := net.SplitHostPort(r.target)
+			out = append(out, PortThrottleFinding{
+				AgentID:         k.agent,
+				Host:            k.host,
+				Port:            port,
+				BaselinePort:    bestPort,
+				LossPct:         roundTo(r.lossPct, 2),
+				BaselineLossPct: roundTo(best.lossPct, 2),
+				LatencyMs:       roundTo(r.latencyMs, 2),
+				BaselineLatency: roundTo(best.latencyMs, 2),
+				Samples:         r.samples,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AgentID != out[j].AgentID {
+			return out[i].AgentID < out[j].AgentID
+		}
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Port < out[j].Port
+	})
+	return out
+}
+
+// getTrafficSimPortRows aggregates TRAFFICSIM results per agent and
+// target over the window.
+func getTrafficSimPortRows(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time) ([]portResultRow, error) {
+	ids := make([]string, len(agentIDs))
+	for i, id := range agentIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	q := fmt.Sprintf(`
+SELECT
+    agent_id,
+    target,
+    count() AS samples,
+    avg(JSONExtractFloat(payload_raw, 'averageRTT')) AS lat,
+    avg(JSONExtractFloat(payload_raw, 'lossPercentage')) AS loss
+FROM probe_data
+WHERE type = 'TRAFFICSIM'
+  AND agent_id IN (%s)
+  AND created_at >= %s%s
+  AND target != ''
+GROUP BY agent_id, target
+`, strings.Join(ids, ", "), chQuoteTime(from), asOfBound(ctx))
+
+	rs, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	var out []portResultRow
+	for rs.Next() {
+		var agentID, n uint64
+		var target string
+		var lat, loss sql.NullFloat64
+		if err := rs.Scan(&agentID, &target, &n, &lat, &loss); err != nil {
+			return nil, err
+		}
+		out = append(out, portResultRow{
+			agentID:   uint(agentID),
+			target:    target,
+			samples:   int(n),
+			latencyMs: sanitizeFloat(lat.Float64),
+			lossPct:   sanitizeFloat(loss.Float64),
+		})
+	}
+	return out, rs.Err()
+}
+
+// detectPortThrottlingIncidents flags agent→host paths where one
+// TrafficSim port is consistently worse than another — the signature of
+// port-based traffic shaping or QoS reclassification.
+func detectPortThrottlingIncidents(ctx context.Context, ch *sql.DB, agentIDs []uint, from time.Time, agentByID map[uint]agentInfo) []DetectedIncident {
+	if ch == nil || len(agentIDs) == 0 {
+		return nil
+	}
+	rows, err := getTrafficSimPortRows(ctx, ch, agentIDs, from)
+	if err != nil {
+		return nil
+	}
+
+	var incidents []DetectedIncident
+	for _, f := range comparePortResults(rows) {
+		agentName := fmt.Sprintf("%d", f.AgentID)
+		if a, ok := agentByID[f.AgentID]; ok {
+			agentName = a.Name
+		}
+		severity := "warning"
+		if f.LossPct-f.BaselineLossPct >= 10 {
+			severity = "critical"
+		}
+		incidents = append(incidents, DetectedIncident{
+			ID:              fmt.Sprintf("port_throttle_%d_%s_%s", f.AgentID, sanitizeKey(f.Host), f.Port),
+			Title:           fmt.Sprintf("Port %s to %s degraded vs port %s from %s", f.Port, f.Host, f.BaselinePort, agentName),
+			Severity:        severity,
+			Scope:           "target-specific",
+			SuggestedCause:  "Traffic to this port is treated differently on the path — likely port-based shaping, policing, or QoS reclassification",
+			AffectedAgents:  []string{agentName},
+			AffectedTargets: []string{f.Host},
+			Evidence: []string{
+				fmt.Sprintf("Port %s: %.2f%% loss, %.1fms avg RTT (%d samples)", f.Port, f.LossPct, f.LatencyMs, f.Samples),
+				fmt.Sprintf("Port %s: %.2f%% loss, %.1fms avg RTT", f.BaselinePort, f.BaselineLossPct, f.BaselineLatency),
+			},
+			Recommendations: []string{
+				"Compare DSCP markings and firewall/ISP policies applied to each port",
+				"Confirm the server side is not rate-limiting the degraded port",
+			},
+			Confidence:      math.Min(0.9, 0.5+float64(f.Samples)/100),
+			MatchedCriteria: fmt.Sprintf("loss +%.0fpp or RTT ×%.1f vs best port", portThrottleLossDeltaPct, portThrottleLatencyRatio),
+		})
+	}
+	return incidents
+}
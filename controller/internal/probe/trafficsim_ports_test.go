@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExpandTrafficSimTarget verifies range, list and single-port targets
+// expand to per-port addresses and malformed sets are rejected.
+func TestExpandTrafficSimTarget(t *testing.T) {
+	cases := map[string][]string{
+		"10.0.0.5:5000":            {"10.0.0.5:5000"},
+		"10.0.0.5:5000-5002":       {"10.0.0.5:5000", "10.0.0.5:5001", "10.0.0.5:5002"},
+		"host:6000,5000,5000-5001": {"host:5000", "host:5001", "host:6000"},
+		"[2001:db8::1]:5000,5001":  {"[2001:db8::1]:5000", "[2001:db8::1]:5001"},
+	}
+	for in, want := range cases {
+		got, err := ExpandTrafficSimTarget(in)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", in, got, want)
+		}
+	}
+
+	for _, bad := range []string{"host:5003-5000", "host:1-100", "host:5000,,5001", "host:0-2", ":5000-5001"} {
+		if validateTargetForType(bad, TypeTrafficSim) {
+			t.Errorf("%s: expected rejection", bad)
+		}
+	}
+	if validateTargetForType("host:5000-5001", TypePing) {
+		t.Error("port sets must only be accepted for TRAFFICSIM")
+	}
+}
+
+// TestExpandTrafficSimPortsProbe verifies a port-set probe stays one
+// probe entry with one single-port target per port, so its ID is sent to
+// the agent once.
+func TestExpandTrafficSimPortsProbe(t *testing.T) {
+	p := Probe{ID: 7, Type: TypeTrafficSim, Targets: []Target{{Target: "10.0.0.5:5000-5001"}, {Target: "10.0.0.6:6000"}}}
+	out := expandTrafficSimPorts(p)
+	if out.ID != 7 {
+		t.Fatalf("probe ID = %d, want 7", out.ID)
+	}
+	var got []string
+	for _, tt := range out.Targets {
+		got = append(got, tt.Target)
+	}
+	if want := []string{"10.0.0.5:5000", "10.0.0.5:5001", "10.0.0.6:6000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+	if len(p.Targets) != 2 || p.Targets[0].Target != "10.0.0.5:5000-5001" {
+		t.Error("source probe targets were mutated")
+	}
+
+}
+
+// TestComparePortResults verifies a lossy port is flagged against the
+// clean port on the same path, and single-port paths are ignored.
+func TestComparePortResults(t *testing.T) {
+	rows := []portResultRow{
+		{agentID: 1, target: "10.0.0.5:5000", samples: 30, latencyMs: 20, lossPct: 0.1},
+		{agentID: 1, target: "10.0.0.5:5060", samples: 30, latencyMs: 21, lossPct: 6},
+		{agentID: 1, target: "10.0.0.5:8443", samples: 30, latencyMs: 45, lossPct: 0.2},
+		{agentID: 1, target: "10.0.0.6:5000", samples: 30, latencyMs: 90, lossPct: 20},
+		{agentID: 2, target: "10.0.0.5:5060", samples: 2, latencyMs: 99, lossPct: 50},
+	}
+	got := comparePortResults(rows)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 findings, got %+v", got)
+	}
+	if got[0].Port != "5060" || got[0].BaselinePort != "5000" {
+		t.Errorf("loss finding = %+v", got[0])
+	}
+	if got[1].Port != "8443" || got[1].LatencyMs != 45 {
+		t.Errorf("latency finding = %+v", got[1])
+	}
+}
@@ -0,0 +1,209 @@
+package probe
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	apperr "netwatcher-controller/internal/errors"
+	"netwatcher-controller/internal/extid"
+)
+
+// ── Input Validation ──
+//
+// Create and Update check every field they can without the database
+// before doing anything else, and report all problems at once as an
+// *apperr.ValidationError (field, list index, reason) so the panel can
+// mark each offending input. It matches ErrBadInput with errors.Is.
+// Checks that need the database (duplicates, agent capabilities, external
+// ID uniqueness) still run afterwards and return their own errors.
+
+const (
+	maxIntervalSec = 86400
+	maxTimeoutSec  = 3600
+	maxDurationSec = 86400
+	maxProbeCount  = 10000
+)
+
+// ValidateCreateInput checks a CreateInput without touching the database.
+func ValidateCreateInput(in CreateInput) error {
+	v := &apperr.ValidationError{Kind: ErrBadInput}
+	if in.WorkspaceID == 0 {
+		v.Add("workspace_id", "required")
+	}
+	if in.AgentID == 0 {
+		v.Add("agent_id", "required")
+	}
+	switch {
+	case in.Type == "":
+		v.Add("type", "required")
+	case !in.Type.Valid():
+		v.Add("type", fmt.Sprintf("unknown probe type %q", in.Type))
+	}
+	if in.ExternalID != "" {
+		if _, err := extid.Normalize(in.ExternalID); err != nil {
+			v.Add("external_id", reasonOf(err, extid.ErrInvalid))
+		}
+	}
+
+	if len(in.Targets) == 0 && len(in.AgentTargets) == 0 && len(in.CatalogTargets) == 0 {
+		v.Add("targets", "at least one target, agent target or catalog target required")
+	}
+	if in.Type == TypeAgent && len(in.AgentTargets) == 0 {
+		v.Add("agent_targets", "AGENT probes need at least one agent target")
+	}
+	validateTargetList(v, "targets", in.Type, in.Targets)
+	for i, id := range in.AgentTargets {
+		switch {
+		case id == 0:
+			v.AddIndex("agent_targets", i, "agent ID required")
+		case in.AgentID != 0 && id == in.AgentID:
+			v.AddIndex("agent_targets", i, "a probe cannot target its own agent")
+		}
+	}
+
+	validateTiming(v, in.IntervalSec, in.TimeoutSec, in.Count, in.DurationSec)
+	if in.Type.Valid() {
+		if err := validateDSCP(in.Type, in.DSCP); err != nil {
+			v.Add("dscp", reasonOf(err, ErrBadInput))
+		}
+	}
+	if err := validateProbeMetadata(in.Metadata); err != nil {
+		v.Add("metadata", reasonOf(err, ErrBadInput))
+	}
+	return v.Err()
+}
+
+// ValidateUpdateInput checks the fields an UpdateInput sets against the
+// existing probe, without touching the database.
+func ValidateUpdateInput(in UpdateInput, existing *Probe) error {
+	v := &apperr.ValidationError{Kind: ErrBadInput}
+	if in.ExternalID != nil {
+		if _, err := extid.Normalize(*in.ExternalID); err != nil {
+			v.Add("external_id", reasonOf(err, extid.ErrInvalid))
+		}
+	}
+	validateTargetList(v, "replaceTargets", existing.Type, in.ReplaceTargets)
+	for i, id := range in.ReplaceAgentTargets {
+		switch {
+		case id == 0:
+			v.AddIndex("replaceAgentTargets", i, "agent ID required")
+		case id == existing.AgentID:
+			v.AddIndex("replaceAgentTargets", i, "a probe cannot target its own agent")
+		}
+	}
+
+	interval, timeout := existing.IntervalSec, existing.TimeoutSec
+	count, duration := 0, 0
+	if in.IntervalSec != nil {
+		interval = *in.IntervalSec
+		if interval == 0 {
+			v.Add("interval_sec", fmt.Sprintf("must be between 1 and %d", maxIntervalSec))
+		}
+	}
+	if in.TimeoutSec != nil {
+		timeout = *in.TimeoutSec
+		if timeout == 0 {
+			v.Add("timeout_sec", fmt.Sprintf("must be between 1 and %d", maxTimeoutSec))
+		}
+	}
+	if in.Count != nil {
+		count = *in.Count
+	}
+	if in.DurationSec != nil {
+		duration = *in.DurationSec
+	}
+	// Only re-check the pair when one of them changes, so probes stored
+	// before these bounds existed stay editable.
+	if in.IntervalSec == nil && in.TimeoutSec == nil {
+		interval, timeout = 0, 0
+	}
+	validateTiming(v, interval, timeout, count, duration)
+
+	if in.DSCP != nil {
+		if err := validateDSCP(existing.Type, *in.DSCP); err != nil {
+			v.Add("dscp", reasonOf(err, ErrBadInput))
+		}
+	}
+	if in.Metadata != nil {
+		if err := validateProbeMetadata(*in.Metadata); err != nil {
+			v.Add("metadata", reasonOf(err, ErrBadInput))
+		}
+	}
+	return v.Err()
+}
+
+// validateTargetList checks each literal target's format for the type.
+func validateTargetList(v *apperr.ValidationError, field string, typ Type, targets []string) {
+	for i, t := range targets {
+		if reason := targetProblem(typ, t); reason != "" {
+			v.AddIndex(field, i, reason)
+		}
+	}
+}
+
+// targetProblem returns why t is not a valid target for typ, or "".
+func targetProblem(typ Type, t string) string {
+	t = strings.TrimSpace(t)
+	if t == "" {
+		return "target is empty"
+	}
+	if typ == TypeTrafficSim && hasTrafficSimPortSet(t) {
+		if _, err := ExpandTrafficSimTarget(t); err != nil {
+			return reasonOf(err, ErrTargetFormat)
+		}
+		return ""
+	}
+	if strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://") {
+		if typ != TypeHTTP && typ != TypeTLS {
+			return fmt.Sprintf("URLs are only valid for HTTP and TLS probes, not %s", typ)
+		}
+		if u, err := url.Parse(t); err != nil || u.Hostname() == "" {
+			return "invalid URL"
+		}
+		return ""
+	}
+	host, port, err := net.SplitHostPort(t)
+	hasPort := err == nil
+	if hasPort {
+		if host == "" {
+			return "host required before the port"
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Sprintf("port %q must be 1-65535", port)
+		}
+	} else if strings.Count(t, ":") == 1 {
+		return "invalid host:port"
+	}
+	// TrafficSim clients connect to, and servers listen on, a UDP port.
+	if typ == TypeTrafficSim && !hasPort {
+		return "TRAFFICSIM targets need a port (host:port)"
+	}
+	return ""
+}
+
+// validateTiming checks interval, timeout, count and duration bounds. Zero
+// means "use the default" and is always accepted.
+func validateTiming(v *apperr.ValidationError, interval, timeout, count, duration int) {
+	if interval < 0 || interval > maxIntervalSec {
+		v.Add("interval_sec", fmt.Sprintf("must be between 1 and %d", maxIntervalSec))
+	}
+	if timeout < 0 || timeout > maxTimeoutSec {
+		v.Add("timeout_sec", fmt.Sprintf("must be between 1 and %d", maxTimeoutSec))
+	} else if interval > 0 && timeout > interval {
+		v.Add("timeout_sec", fmt.Sprintf("must not exceed interval_sec (%d)", interval))
+	}
+	if count < 0 || count > maxProbeCount {
+		v.Add("count", fmt.Sprintf("must be between 0 and %d", maxProbeCount))
+	}
+	if duration < 0 || duration > maxDurationSec {
+		v.Add("duration_sec", fmt.Sprintf("must be between 0 and %d", maxDurationSec))
+	}
+}
+
+// reasonOf strips the sentinel prefix from a wrapped error's message.
+func reasonOf(err, sentinel error) string {
+	return strings.TrimPrefix(err.Error(), sentinel.Error()+": ")
+}
@@ -0,0 +1,71 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+
+	apperr "netwatcher-controller/internal/errors"
+)
+
+// TestValidateCreateInput verifies every invalid field is reported with
+// its list index, and that the error still matches ErrBadInput.
+func TestValidateCreateInput(t *testing.T) {
+	ok := CreateInput{WorkspaceID: 1, AgentID: 2, Type: TypeTrafficSim, Targets: []string{"10.0.0.5:5000", "10.0.0.6:5000-5002"}, IntervalSec: 60, TimeoutSec: 10}
+	if err := ValidateCreateInput(ok); err != nil {
+		t.Fatalf("valid input: %v", err)
+	}
+
+	err := ValidateCreateInput(CreateInput{
+		WorkspaceID:  1,
+		AgentID:      2,
+		Type:         TypeTrafficSim,
+		Targets:      []string{"10.0.0.5:5000", "10.0.0.6", "10.0.0.7:70000", " "},
+		AgentTargets: []uint{2},
+		IntervalSec:  30,
+		TimeoutSec:   60,
+		DSCP:         99,
+	})
+	if !errors.Is(err, ErrBadInput) {
+		t.Fatalf("err = %v, want ErrBadInput", err)
+	}
+	var v *apperr.ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("err = %T, want *ValidationError", err)
+	}
+	got := make(map[string]bool)
+	for _, f := range v.Fields {
+		got[f.String()] = true
+	}
+	for _, want := range []string{
+		"targets[1]: TRAFFICSIM targets need a port (host:port)",
+		`targets[2]: port "70000" must be 1-65535`,
+		"targets[3]: target is empty",
+		"agent_targets[0]: a probe cannot target its own agent",
+		"timeout_sec: must not exceed interval_sec (30)",
+		"dscp: dscp must be 0-63",
+	} {
+		if !got[want] {
+			t.Errorf("missing %q in %v", want, v.Fields)
+		}
+	}
+	if len(v.Fields) != 6 {
+		t.Errorf("fields = %v, want 6", v.Fields)
+	}
+
+	err = ValidateCreateInput(CreateInput{Type: "WEATHER", Targets: []string{"https://example.com"}})
+	if !errors.As(err, &v) || len(v.Fields) != 4 {
+		t.Errorf("missing ids, unknown type, URL target: %v", err)
+	}
+}
+
+func TestValidateUpdateInput(t *testing.T) {
+	existing := &Probe{ID: 5, AgentID: 2, Type: TypePing, IntervalSec: 60, TimeoutSec: 10}
+	interval := 5
+	if err := ValidateUpdateInput(UpdateInput{ID: 5, IntervalSec: &interval}, existing); err == nil {
+		t.Error("interval below stored timeout accepted")
+	}
+	dscp := 46
+	if err := ValidateUpdateInput(UpdateInput{ID: 5, DSCP: &dscp, ReplaceTargets: []string{"1.1.1.1"}}, existing); err != nil {
+		t.Errorf("valid update: %v", err)
+	}
+}
@@ -185,21 +185,13 @@ LIMIT 2000
 		if payloadRaw == "" {
 			continue
 		}
-		var payload struct {
-			AvgRTT             int64   `json:"avg_rtt"`
-			StdDevRTT          int64   `json:"std_dev_rtt"`
-			PacketLoss         float64 `json:"packet_loss"`
-			PacketsSent        int     `json:"packets_sent,omitempty"`
-			PacketsRecv        int     `json:"packets_recv,omitempty"`
-			MaxConsecutiveLoss uint64  `json:"max_consecutive_loss,omitempty"`
-			TotalBursts        uint64  `json:"total_bursts,omitempty"`
-		}
-		if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
+		payload, err := ParsePingPayload([]byte(payloadRaw))
+		if err != nil {
 			continue
 		}
 
-		latMs := float64(payload.AvgRTT) / 1_000_000.0
-		jitMs := float64(payload.StdDevRTT) / 1_000_000.0
+		latMs := float64(payload.AvgRtt) / 1_000_000.0
+		jitMs := float64(payload.StdDevRtt) / 1_000_000.0
 		if latMs > 0 {
 			latencies = append(latencies, latMs)
 		}
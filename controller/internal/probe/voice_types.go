@@ -280,6 +280,8 @@ type AgentAnalysis struct {
 	AgentName        string               `json:"agent_name"`
 	IsOnline         bool                 `json:"is_online"`
 	Health           HealthVector         `json:"health"`
+	Mode             string               `json:"mode"`              // active, passive (see analysis_passive.go)
+	Passive          *PassiveHostHealth   `json:"passive,omitempty"` // host view when passive
 	VoiceQuality     *VoiceQualitySummary `json:"voice_quality,omitempty"`
 	Probes           []ProbeAnalysis      `json:"probes"`
 	ReturnPathProbes []ProbeAnalysis      `json:"return_path_probes"`
@@ -0,0 +1,381 @@
+package probe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/alert"
+
+	"gorm.io/gorm"
+)
+
+// ── Workspace Comparison ──
+//
+// Site-wide ranking of workspaces for MSP NOC teams: each workspace gets a
+// health score from its PING/TRAFFICSIM telemetry over the period, an
+// incident rate from the alerts raised in it, and its worst probes. The
+// priority score orders the list so the environment most in need of
+// attention comes first.
+
+const (
+	defaultCompareWindow = 7 * 24 * time.Hour
+	maxCompareWindow     = 90 * 24 * time.Hour
+	defaultCompareWorst  = 3
+	maxCompareWorst      = 20
+)
+
+// WorkspaceCompareQuery selects the period and how many worst probes to
+// list per workspace.
+type WorkspaceCompareQuery struct {
+	From        time.Time
+	To          time.Time
+	WorstProbes int
+}
+
+// WorkspaceComparison is the ranked result of CompareWorkspaces.
+type WorkspaceComparison struct {
+	From        time.Time             `json:"from"`
+	To          time.Time             `json:"to"`
+	Workspaces  []WorkspaceCompareRow `json:"workspaces"`
+	GeneratedAt time.Time             `json:"generated_at"`
+}
+
+// WorkspaceCompareRow summarises one workspace over the period.
+type WorkspaceCompareRow struct {
+	Rank              int     `json:"rank"`
+	WorkspaceID       uint    `json:"workspace_id"`
+	Name              string  `json:"name"`
+	Agents            int     `json:"agents"`
+	Probes            int     `json:"probes"`
+	ProbesWithData    int     `json:"probes_with_data"`
+	HealthScore       float64 `json:"health_score"` // mean probe health, 0-100; 0 with HasData=false
+	Grade             string  `json:"grade"`
+	HasData           bool    `json:"has_data"`
+	Incidents         int     `json:"incidents"`
+	CriticalIncidents int     `json:"critical_incidents"`
+	IncidentsPerDay   float64 `json:"incidents_per_day"`
+	// PriorityScore ranks workspaces: health deficit plus weighted
+	// incident rate. Higher means look here first.
+	PriorityScore float64               `json:"priority_score"`
+	WorstProbes   []WorkspaceWorstProbe `json:"worst_probes"`
+}
+
+// WorkspaceWorstProbe is one of a workspace's lowest-health probes.
+type WorkspaceWorstProbe struct {
+	ProbeID      uint    `json:"probe_id"`
+	AgentID      uint    `json:"agent_id"`
+	Type         Type    `json:"type"`
+	Target       string  `json:"target"`
+	HealthScore  float64 `json:"health_score"`
+	Grade        string  `json:"grade"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	PacketLoss   float64 `json:"packet_loss"`
+	Samples      int     `json:"samples"`
+}
+
+type compareProbeRow struct {
+	probeID uint
+	typ     string
+	target  string
+	samples int
+	lat     float64
+	p95     float64
+	loss    float64
+	jitter  float64
+}
+
+type compareWorkspace struct {
+	ID   uint
+	Name string
+}
+
+type compareProbeInfo struct {
+	ID          uint
+	WorkspaceID uint
+	AgentID     uint
+	Type        Type
+}
+
+type compareIncidentCount struct {
+	WorkspaceID uint
+	Severity    string
+	N           int
+}
+
+// CompareWorkspaces scores and ranks every workspace over the period.
+func CompareWorkspaces(ctx context.Context, ch *sql.DB, pg *gorm.DB, q WorkspaceCompareQuery) (*WorkspaceComparison, error) {
+	now := time.Now().UTC()
+	if q.To.IsZero() || q.To.After(now) {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultCompareWindow)
+	}
+	if !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrBadInput)
+	}
+	if q.To.Sub(q.From) > maxCompareWindow {
+		return nil, fmt.Errorf("%w: period may not exceed %d days", ErrBadInput, int(maxCompareWindow.Hours()/24))
+	}
+	if q.WorstProbes <= 0 {
+		q.WorstProbes = defaultCompareWorst
+	}
+	if q.WorstProbes > maxCompareWorst {
+		q.WorstProbes = maxCompareWorst
+	}
+
+	var workspaces []compareWorkspace
+	if err := pg.WithContext(ctx).Table("workspaces").Select("id, name").
+		Where("deleted_at IS NULL").Scan(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("list workspaces: %w", err)
+	}
+
+	var agentCounts []struct {
+		WorkspaceID uint
+		N           int
+	}
+	if err := pg.WithContext(ctx).Table("agents").Select("workspace_id, COUNT(*) AS n").
+		Where("deleted_at IS NULL").Group("workspace_id").Scan(&agentCounts).Error; err != nil {
+		return nil, fmt.Errorf("count agents: %w", err)
+	}
+
+	var probes []compareProbeInfo
+	if err := pg.WithContext(ctx).Model(&Probe{}).Select("id, workspace_id, agent_id, type").
+		Scan(&probes).Error; err != nil {
+		return nil, fmt.Errorf("list probes: %w", err)
+	}
+
+	var incidents []compareIncidentCount
+	if err := pg.WithContext(ctx).Model(&alert.Alert{}).Select("workspace_id, severity, COUNT(*) AS n").
+		Where("triggered_at >= ? AND triggered_at < ?", q.From, q.To).
+		Group("workspace_id, severity").Scan(&incidents).Error; err != nil {
+		return nil, fmt.Errorf("count incidents: %w", err)
+	}
+
+	var rows []compareProbeRow
+	if ch != nil {
+		var err error
+		if rows, err = queryCompareProbeRows(ctx, ch, q.From, q.To); err != nil {
+			return nil, fmt.Errorf("probe metrics: %w", err)
+		}
+	}
+
+	agents := make(map[uint]int, len(agentCounts))
+	for _, a := range agentCounts {
+		agents[a.WorkspaceID] = a.N
+	}
+	base := make([]WorkspaceCompareRow, len(workspaces))
+	for i, w := range workspaces {
+		base[i] = WorkspaceCompareRow{WorkspaceID: w.ID, Name: w.Name, Agents: agents[w.ID]}
+	}
+	return &WorkspaceComparison{
+		From:        q.From,
+		To:          q.To,
+		Workspaces:  buildWorkspaceComparison(base, probes, rows, incidents, q.To.Sub(q.From), q.WorstProbes),
+		GeneratedAt: now,
+	}, nil
+}
+
+func queryCompareProbeRows(ctx context.Context, ch *sql.DB, from, to time.Time) ([]compareProbeRow, error) {
+	pingLat := pingAvgRttNsSQL + " / 1000000.0"
+	q := fmt.Sprintf(`
+SELECT
+    probe_id,
+    type,
+    any(target) AS target,
+    count() AS samples,
+    avg(if(type = 'PING', %[1]s, JSONExtractFloat(payload_raw, 'averageRTT'))) AS lat,
+    quantile(0.95)(if(type = 'PING', %[1]s, JSONExtractFloat(payload_raw, 'averageRTT'))) AS p95,
+    avg(if(type = 'PING', %[2]s, JSONExtractFloat(payload_raw, 'lossPercentage'))) AS loss,
+    avg(if(type = 'PING', %[3]s / 1000000.0, JSONExtractFloat(payload_raw, 'jitterAvg'))) AS jitter
+FROM probe_data
+WHERE type IN ('PING', 'TRAFFICSIM')
+  AND created_at >= %[4]s
+  AND created_at < %[5]s
+GROUP BY probe_id, type
+`, pingLat, pingLossSQL, pingStdDevNsSQL, chQuoteTime(from), chQuoteTime(to))
+
+	rs, err := ch.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	var out []compareProbeRow
+	for rs.Next() {
+		var id, n uint64
+		var typ, target string
+		var lat, p95, loss, jit sql.NullFloat64
+		if err := rs.Scan(&id, &typ, &target, &n, &lat, &p95, &loss, &jit); err != nil {
+			return nil, err
+		}
+		out = append(out, compareProbeRow{
+			probeID: uint(id),
+			typ:     typ,
+			target:  target,
+			samples: int(n),
+			lat:     sanitizeFloat(lat.Float64),
+			p95:     sanitizeFloat(p95.Float64),
+			loss:    sanitizeFloat(loss.Float64),
+			jitter:  sanitizeFloat(jit.Float64),
+		})
+	}
+	return out, rs.Err()
+}
+
+// compareIncidentWeight is how many health points one incident per day is
+// worth in the priority score; critical incidents count triple.
+const compareIncidentWeight = 5
+
+// buildWorkspaceComparison is the pure scoring and ranking step,
+// separated from the queries for tests.
+func buildWorkspaceComparison(ws []WorkspaceCompareRow, probes []compareProbeInfo, rows []compareProbeRow, incidents []compareIncidentCount, period time.Duration, worst int) []WorkspaceCompareRow {
+	probeByID := make(map[uint]compareProbeInfo, len(probes))
+	probeCount := make(map[uint]int)
+	for _, p := range probes {
+		probeByID[p.ID] = p
+		probeCount[p.WorkspaceID]++
+	}
+
+	// Probes of deleted workspaces or deleted probes are skipped: their
+	// telemetry has no owner to rank.
+	scored := make(map[uint][]WorkspaceWorstProbe)
+	for _, r := range rows {
+		p, ok := probeByID[r.probeID]
+		if !ok || r.samples == 0 {
+			continue
+		}
+		hv := computeHealthVector(ProbeMetrics{
+			AvgLatency:  r.lat,
+			P95Latency:  r.p95,
+			PacketLoss:  r.loss,
+			JitterAvg:   r.jitter,
+			SampleCount: r.samples,
+		}, 100)
+		scored[p.WorkspaceID] = append(scored[p.WorkspaceID], WorkspaceWorstProbe{
+			ProbeID:      p.ID,
+			AgentID:      p.AgentID,
+			Type:         Type(r.typ),
+			Target:       r.target,
+			HealthScore:  hv.OverallHealth,
+			Grade:        hv.Grade,
+			AvgLatencyMs: roundTo(r.lat, 2),
+			PacketLoss:   roundTo(r.loss, 2),
+			Samples:      r.samples,
+		})
+	}
+
+	type incCount struct{ total, critical int }
+	inc := make(map[uint]incCount)
+	for _, c := range incidents {
+		ic := inc[c.WorkspaceID]
+		ic.total += c.N
+		if c.Severity == string(alert.SeverityCritical) {
+			ic.critical += c.N
+		}
+		inc[c.WorkspaceID] = ic
+	}
+
+	days := period.Hours() / 24
+	if days <= 0 {
+		days = 1
+	}
+	out := make([]WorkspaceCompareRow, 0, len(ws))
+	for _, w := range ws {
+		w.Probes = probeCount[w.WorkspaceID]
+		ps := scored[w.WorkspaceID]
+		sort.Slice(ps, func(i, j int) bool {
+			if ps[i].HealthScore != ps[j].HealthScore {
+				return ps[i].HealthScore < ps[j].HealthScore
+			}
+			return ps[i].ProbeID < ps[j].ProbeID
+		})
+		w.ProbesWithData = len(ps)
+		w.Grade = "unknown"
+		if len(ps) > 0 {
+			var sum float64
+			for _, p := range ps {
+				sum += p.HealthScore
+			}
+			w.HasData = true
+			w.HealthScore = clampScore(sum / float64(len(ps)))
+			w.Grade = gradeFromScore(w.HealthScore)
+		}
+		if len(ps) > worst {
+			ps = ps[:worst]
+		}
+		w.WorstProbes = append([]WorkspaceWorstProbe{}, ps...)
+
+		ic := inc[w.WorkspaceID]
+		w.Incidents, w.CriticalIncidents = ic.total, ic.critical
+		w.IncidentsPerDay = roundTo(float64(ic.total)/days, 2)
+		weighted := float64(ic.total-ic.critical) + 3*float64(ic.critical)
+		w.PriorityScore = compareIncidentWeight * weighted / days
+		if w.HasData {
+			w.PriorityScore += 100 - w.HealthScore
+		}
+		w.PriorityScore = roundTo(w.PriorityScore, 1)
+		out = append(out, w)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].PriorityScore != out[j].PriorityScore {
+			return out[i].PriorityScore > out[j].PriorityScore
+		}
+		return out[i].WorkspaceID < out[j].WorkspaceID
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+// WriteCSV writes one row per workspace in rank order. Worst probes are
+// flattened into a single "probe_id:type:target:health" column.
+func (c *WorkspaceComparison) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"rank", "workspace_id", "name", "priority_score", "health_score", "grade",
+		"agents", "probes", "probes_with_data", "incidents", "critical_incidents",
+		"incidents_per_day", "worst_probes",
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range c.Workspaces {
+		worst := make([]string, len(r.WorstProbes))
+		for i, p := range r.WorstProbes {
+			worst[i] = fmt.Sprintf("%d:%s:%s:%.1f", p.ProbeID, p.Type, p.Target, p.HealthScore)
+		}
+		health := ""
+		if r.HasData {
+			health = strconv.FormatFloat(r.HealthScore, 'f', 1, 64)
+		}
+		if err := cw.Write([]string{
+			strconv.Itoa(r.Rank),
+			strconv.FormatUint(uint64(r.WorkspaceID), 10),
+			r.Name,
+			strconv.FormatFloat(r.PriorityScore, 'f', 1, 64),
+			health,
+			r.Grade,
+			strconv.Itoa(r.Agents),
+			strconv.Itoa(r.Probes),
+			strconv.Itoa(r.ProbesWithData),
+			strconv.Itoa(r.Incidents),
+			strconv.Itoa(r.CriticalIncidents),
+			strconv.FormatFloat(r.IncidentsPerDay, 'f', 2, 64),
+			strings.Join(worst, "; "),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,85 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestBuildWorkspaceComparisonRanksWorstFirst(t *testing.T) {
+	ws := []WorkspaceCompareRow{
+		{WorkspaceID: 1, Name: "healthy"},
+		{WorkspaceID: 2, Name: "lossy"},
+		{WorkspaceID: 3, Name: "noisy"},
+		{WorkspaceID: 4, Name: "empty"},
+	}
+	probes := []compareProbeInfo{
+		{ID: 10, WorkspaceID: 1, Type: TypePing},
+		{ID: 20, WorkspaceID: 2, Type: TypePing},
+		{ID: 21, WorkspaceID: 2, Type: TypePing},
+		{ID: 30, WorkspaceID: 3, Type: TypePing},
+	}
+	rows := []compareProbeRow{
+		{probeID: 10, typ: "PING", target: "1.1.1.1", samples: 100, lat: 10, p95: 12, jitter: 1},
+		{probeID: 20, typ: "PING", target: "8.8.8.8", samples: 100, lat: 40, p95: 60, loss: 15, jitter: 5},
+		{probeID: 21, typ: "PING", target: "9.9.9.9", samples: 100, lat: 12, p95: 14, jitter: 1},
+		{probeID: 30, typ: "PING", target: "1.0.0.1", samples: 100, lat: 11, p95: 13, jitter: 1},
+		{probeID: 99, typ: "PING", target: "orphan", samples: 100, lat: 900, loss: 100}, // deleted probe
+	}
+	incidents := []compareIncidentCount{
+		{WorkspaceID: 3, Severity: "critical", N: 14},
+		{WorkspaceID: 3, Severity: "warning", N: 7},
+	}
+
+	out := buildWorkspaceComparison(ws, probes, rows, incidents, 7*24*time.Hour, 1)
+	if len(out) != 4 {
+		t.Fatalf("got %d rows, want 4", len(out))
+	}
+	order := []uint{out[0].WorkspaceID, out[1].WorkspaceID, out[2].WorkspaceID, out[3].WorkspaceID}
+	if order[0] != 3 || order[1] != 2 || order[3] != 4 {
+		t.Errorf("rank order = %v, want noisy(3), lossy(2), ..., empty(4)", order)
+	}
+	for i, r := range out {
+		if r.Rank != i+1 {
+			t.Errorf("row %d rank = %d", i, r.Rank)
+		}
+	}
+
+	lossy := out[1]
+	if lossy.Probes != 2 || lossy.ProbesWithData != 2 || len(lossy.WorstProbes) != 1 || lossy.WorstProbes[0].ProbeID != 20 {
+		t.Errorf("lossy = %+v, want 2 probes with worst probe 20 only", lossy)
+	}
+	noisy := out[0]
+	if noisy.Incidents != 21 || noisy.CriticalIncidents != 14 || noisy.IncidentsPerDay != 3 {
+		t.Errorf("noisy incidents = %d/%d/%.2f, want 21/14/3", noisy.Incidents, noisy.CriticalIncidents, noisy.IncidentsPerDay)
+	}
+	if empty := out[3]; empty.HasData || empty.Grade != "unknown" || empty.PriorityScore != 0 {
+		t.Errorf("empty = %+v, want no data and zero priority", empty)
+	}
+}
+
+func TestWorkspaceComparisonWriteCSV(t *testing.T) {
+	c := &WorkspaceComparison{Workspaces: []WorkspaceCompareRow{
+		{Rank: 1, WorkspaceID: 2, Name: "Acme, Inc", HasData: true, HealthScore: 61.5, Grade: "fair", PriorityScore: 38.5,
+			WorstProbes: []WorkspaceWorstProbe{{ProbeID: 20, Type: TypePing, Target: "8.8.8.8", HealthScore: 40}}},
+		{Rank: 2, WorkspaceID: 4, Name: "empty", Grade: "unknown"},
+	}}
+	var buf bytes.Buffer
+	if err := c.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want header + 2", len(recs))
+	}
+	if recs[1][2] != "Acme, Inc" || recs[1][4] != "61.5" || recs[1][12] != "20:PING:8.8.8.8:40.0" {
+		t.Errorf("row 1 = %v", recs[1])
+	}
+	if recs[2][4] != "" {
+		t.Errorf("no-data health = %q, want empty", recs[2][4])
+	}
+}
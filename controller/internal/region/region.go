@@ -0,0 +1,186 @@
+// Package region lets several controllers share one Postgres while each
+// keeps its agents' telemetry in the ClickHouse cluster of its own region,
+// so agents far apart don't ship results across oceans.
+//
+// Each controller names its region with CONTROLLER_REGION and each agent
+// names the region that owns its data (Agent.Region). A controller only
+// accepts results from agents it owns and only analyses those agents;
+// agents without a region belong to FEDERATION_HOME_REGION (default: the
+// local region). Controllers reach each other through FEDERATION_PEERS
+// (region=URL pairs) and authenticate with the shared FEDERATION_TOKEN, so
+// one controller can combine a workspace's analysis from every region.
+//
+// With CONTROLLER_REGION unset the controller owns everything, as in a
+// single-region deployment.
+package region
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HeaderRegion names the calling controller's region on peer requests.
+const HeaderRegion = "X-Netwatcher-Region"
+
+// ErrNoToken is returned when federation is used without FEDERATION_TOKEN.
+var ErrNoToken = errors.New("FEDERATION_TOKEN is not set")
+
+var nameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ValidName reports whether s can name a region: lowercase letters,
+// digits and dashes, up to 32 characters.
+func ValidName(s string) bool { return nameRe.MatchString(s) }
+
+// Local is this controller's region (CONTROLLER_REGION), or "" when
+// regions are not in use.
+func Local() string { return strings.ToLower(strings.TrimSpace(os.Getenv("CONTROLLER_REGION"))) }
+
+// Home is the region that owns agents without one.
+func Home() string {
+	if h := strings.ToLower(strings.TrimSpace(os.Getenv("FEDERATION_HOME_REGION"))); h != "" {
+		return h
+	}
+	return Local()
+}
+
+// Owner is the region owning an agent with the given region setting.
+func Owner(agentRegion string) string {
+	if agentRegion != "" {
+		return agentRegion
+	}
+	return Home()
+}
+
+// Owns reports whether this controller owns an agent's data.
+func Owns(agentRegion string) bool {
+	local := Local()
+	return local == "" || Owner(agentRegion) == local
+}
+
+// OwnedRegions lists the Agent.Region values this controller owns, for
+// query filters: its own region, plus "" when it is the home region. It
+// returns nil when regions are not in use.
+func OwnedRegions() []string {
+	local := Local()
+	if local == "" {
+		return nil
+	}
+	if Home() == local {
+		return []string{local, ""}
+	}
+	return []string{local}
+}
+
+// Peer is another region's controller.
+type Peer struct {
+	Region string `json:"region"`
+	URL    string `json:"url"`
+}
+
+var (
+	peersOnce sync.Once
+	peers     []Peer
+)
+
+// Peers are the other regions' controllers from FEDERATION_PEERS
+// ("eu=https://eu.api.example.com,us=https://us.api.example.com"). The
+// local region's entry, if listed, is left out.
+func Peers() []Peer {
+	peersOnce.Do(func() {
+		var err error
+		if peers, err = ParsePeers(os.Getenv("FEDERATION_PEERS"), Local()); err != nil {
+			log.Warnf("FEDERATION_PEERS: %v; federation disabled", err)
+			peers = nil
+		}
+	})
+	return peers
+}
+
+// ParsePeers parses a FEDERATION_PEERS value, skipping local.
+func ParsePeers(s, local string) ([]Peer, error) {
+	var out []Peer
+	seen := map[string]bool{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		url = strings.TrimRight(strings.TrimSpace(url), "/")
+		if !ok || !ValidName(name) {
+			return nil, fmt.Errorf("%q: want <region>=<url>", item)
+		}
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("%q: URL must start with http:// or https://", item)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("region %q listed twice", name)
+		}
+		seen[name] = true
+		if name != local {
+			out = append(out, Peer{Region: name, URL: url})
+		}
+	}
+	return out, nil
+}
+
+// Endpoint is the URL of the controller owning agentRegion, or "" when it
+// is not a known peer.
+func Endpoint(agentRegion string) string {
+	owner := Owner(agentRegion)
+	for _, p := range Peers() {
+		if p.Region == owner {
+			return p.URL
+		}
+	}
+	return ""
+}
+
+// Token is the shared peer secret (FEDERATION_TOKEN).
+func Token() string { return os.Getenv("FEDERATION_TOKEN") }
+
+// Authorized reports whether a peer request's bearer token matches.
+func Authorized(authorization string) bool {
+	token := Token()
+	got, ok := strings.CutPrefix(authorization, "Bearer ")
+	return token != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+var peerClient = &http.Client{}
+
+// Get fetches path from the peer and decodes the JSON response into out.
+// The request is bounded by ctx.
+func (p Peer) Get(ctx context.Context, path string, out any) error {
+	token := Token()
+	if token == "" {
+		return ErrNoToken
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(HeaderRegion, Local())
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", p.Region, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
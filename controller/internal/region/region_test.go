@@ -0,0 +1,50 @@
+package region
+
+import "testing"
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers("eu=https://eu.example.com/, us = https://us.example.com ,", "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0] != (Peer{Region: "us", URL: "https://us.example.com"}) {
+		t.Errorf("peers = %+v", peers)
+	}
+	for _, bad := range []string{"eu", "EU_1=https://x", "eu=ftp://x", "eu=https://a,eu=https://b"} {
+		if _, err := ParsePeers(bad, ""); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestOwns(t *testing.T) {
+	t.Setenv("CONTROLLER_REGION", "")
+	if !Owns("us") || OwnedRegions() != nil {
+		t.Error("a controller without a region must own every agent")
+	}
+
+	t.Setenv("CONTROLLER_REGION", "eu")
+	t.Setenv("FEDERATION_HOME_REGION", "")
+	if !Owns("eu") || !Owns("") || Owns("us") {
+		t.Error("eu (home) should own eu and unassigned agents only")
+	}
+
+	t.Setenv("FEDERATION_HOME_REGION", "us")
+	if Owns("") || Owner("") != "us" {
+		t.Error("unassigned agents belong to the home region")
+	}
+	if got := OwnedRegions(); len(got) != 1 || got[0] != "eu" {
+		t.Errorf("OwnedRegions = %v", got)
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	t.Setenv("FEDERATION_TOKEN", "")
+	if Authorized("Bearer ") {
+		t.Error("an empty token must never authorize")
+	}
+	t.Setenv("FEDERATION_TOKEN", "s3cret")
+	if !Authorized("Bearer s3cret") || Authorized("Bearer nope") || Authorized("s3cret") {
+		t.Error("bearer token check")
+	}
+}
@@ -0,0 +1,93 @@
+package reports
+
+import (
+	"fmt"
+	"time"
+
+	chart "github.com/wcharczuk/go-chart/v2"
+	"github.com/wcharczuk/go-chart/v2/drawing"
+
+	"netwatcher-controller/internal/probe"
+)
+
+// RenderIncidentEvidenceChart draws the latency timeline stored in an
+// incident evidence bundle as a PNG suitable for attaching to a ticket.
+// Samples with packet loss are marked in red; a vertical guide marks the
+// start of the incident window.
+func RenderIncidentEvidenceChart(b *probe.EvidenceBundle) ([]byte, error) {
+	if b == nil || len(b.Timeline) == 0 {
+		return nil, fmt.Errorf("RenderIncidentEvidenceChart: no samples")
+	}
+
+	xs := make([]time.Time, len(b.Timeline))
+	ys := make([]float64, len(b.Timeline))
+	var lossXs []time.Time
+	var lossYs []float64
+	maxY := 0.0
+	for i, s := range b.Timeline {
+		xs[i] = s.Time
+		ys[i] = s.AvgLatency
+		if s.AvgLatency > maxY {
+			maxY = s.AvgLatency
+		}
+		if s.PacketLoss > 0 {
+			lossXs = append(lossXs, s.Time)
+			lossYs = append(lossYs, s.AvgLatency)
+		}
+	}
+
+	if maxY <= 0 {
+		maxY = 1
+	}
+
+	series := []chart.Series{
+		chart.TimeSeries{
+			Name:    "Avg latency (ms)",
+			XValues: xs,
+			YValues: ys,
+			Style: chart.Style{
+				StrokeColor: drawing.Color{R: 0, G: 136, B: 204, A: 255},
+				StrokeWidth: 2.0,
+			},
+		},
+	}
+	if start := b.After.From; !start.IsZero() && start.After(xs[0]) {
+		series = append(series, chart.TimeSeries{
+			Name:    "Incident window",
+			XValues: []time.Time{start, start},
+			YValues: []float64{0, maxY},
+			Style: chart.Style{
+				StrokeColor:     drawing.Color{R: 107, G: 114, B: 128, A: 255},
+				StrokeWidth:     1.0,
+				StrokeDashArray: []float64{4, 4},
+			},
+		})
+	}
+	if len(lossXs) > 0 {
+		series = append(series, chart.TimeSeries{
+			Name:    "Packet loss",
+			XValues: lossXs,
+			YValues: lossYs,
+			Style: chart.Style{
+				StrokeWidth: chart.Disabled,
+				DotColor:    drawing.Color{R: 220, G: 38, B: 38, A: 255},
+				DotWidth:    3,
+			},
+		})
+	}
+
+	graph := chart.Chart{
+		Title:  truncateLabel(b.Incident.Title, 60),
+		Width:  defaultChartW,
+		Height: defaultChartH,
+		Series: series,
+		XAxis: chart.XAxis{
+			ValueFormatter: chart.TimeMinuteValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Range: &chart.ContinuousRange{Min: 0, Max: maxY * 1.1},
+		},
+		Background: chart.Style{Padding: chart.Box{Top: 24, Left: 12, Right: 12, Bottom: 12}},
+	}
+	return renderPNG(graph)
+}
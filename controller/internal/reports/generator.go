@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -1487,17 +1486,13 @@ LIMIT 2000
 			continue
 		}
 
-		var payload struct {
-			AvgRTT     int64   `json:"avg_rtt"`
-			StdDevRTT  int64   `json:"std_dev_rtt"`
-			PacketLoss float64 `json:"packet_loss"`
-		}
-		if err := json.Unmarshal([]byte(payloadRaw), &payload); err != nil {
+		payload, err := probe.ParsePingPayload([]byte(payloadRaw))
+		if err != nil {
 			continue
 		}
 
-		latMs := float64(payload.AvgRTT) / 1_000_000.0
-		jitterMs := float64(payload.StdDevRTT) / 1_000_000.0
+		latMs := float64(payload.AvgRtt) / 1_000_000.0
+		jitterMs := float64(payload.StdDevRtt) / 1_000_000.0
 
 		latencies = append(latencies, latMs)
 		totalLoss += payload.PacketLoss
@@ -136,7 +136,7 @@ func (g *Generator) fetchWorkspaceVoiceSummary(ctx context.Context, workspaceID
 		entry := WorkspaceVoiceAgentEntry{
 			AgentID:         id,
 			AgentName:       agentObj.Name,
-			IsOnline:        agentObj.LastSeenAt.After(time.Now().UTC().Add(-5 * time.Minute)),
+			IsOnline:        agentObj.Connectivity(time.Now().UTC()) != agent.ConnectivityOffline,
 			OverallMos:      vq.OverallMos,
 			OverallGrade:    vq.OverallGrade,
 			LatencyScore:    vq.LatencyScore,
@@ -2,11 +2,12 @@ package scheduler
 
 import (
 	"context"
-	"os"
 	"strconv"
 	"time"
 
 	"netwatcher-controller/internal/alert"
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/settings"
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -20,7 +21,7 @@ type AlertSchedulerConfig struct {
 // LoadAlertSchedulerConfig loads alert scheduler settings from environment variables
 func LoadAlertSchedulerConfig() *AlertSchedulerConfig {
 	minutes := 1 // Default: check every minute
-	if v := os.Getenv("OFFLINE_CHECK_INTERVAL_MINUTES"); v != "" {
+	if v := settings.Getenv("OFFLINE_CHECK_INTERVAL_MINUTES"); v != "" {
 		if i, err := strconv.Atoi(v); err == nil && i > 0 {
 			minutes = i
 		}
@@ -32,25 +33,42 @@ func LoadAlertSchedulerConfig() *AlertSchedulerConfig {
 
 // AlertScheduler handles periodic alert evaluations
 type AlertScheduler struct {
-	db     *gorm.DB
-	config *AlertSchedulerConfig
+	db       *gorm.DB
+	config   *AlertSchedulerConfig
+	reconfig chan *AlertSchedulerConfig
 }
 
 // NewAlertScheduler creates a new alert scheduler
 func NewAlertScheduler(db *gorm.DB, config *AlertSchedulerConfig) *AlertScheduler {
 	return &AlertScheduler{
-		db:     db,
-		config: config,
+		db:       db,
+		config:   config,
+		reconfig: make(chan *AlertSchedulerConfig, 1),
 	}
 }
 
+// Reconfigure applies a new offline check interval to the running
+// scheduler.
+func (s *AlertScheduler) Reconfigure(config *AlertSchedulerConfig) {
+	if config == nil || config.OfflineCheckInterval <= 0 {
+		return
+	}
+	select {
+	case <-s.reconfig:
+	default:
+	}
+	s.reconfig <- config
+}
+
 // Start begins the alert scheduler in a blocking loop
 func (s *AlertScheduler) Start(ctx context.Context) {
 	log.Infof("Starting alert scheduler (offline check interval: %v)", s.config.OfflineCheckInterval)
 
 	// Run once on startup (with a brief delay to let other systems initialize)
+	health.Register("alert_scheduler", s.config.OfflineCheckInterval, 5*time.Second)
 	time.Sleep(5 * time.Second)
 	s.runOfflineCheck(ctx)
+	health.Beat("alert_scheduler")
 
 	ticker := time.NewTicker(s.config.OfflineCheckInterval)
 	defer ticker.Stop()
@@ -58,10 +76,17 @@ func (s *AlertScheduler) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			health.Stop("alert_scheduler")
 			log.Info("Alert scheduler stopped")
 			return
+		case next := <-s.reconfig:
+			s.config = next
+			ticker.Reset(s.config.OfflineCheckInterval)
+			health.Register("alert_scheduler", s.config.OfflineCheckInterval, 0)
+			log.Infof("Alert scheduler reconfigured (offline check interval: %v)", s.config.OfflineCheckInterval)
 		case <-ticker.C:
 			s.runOfflineCheck(ctx)
+			health.Beat("alert_scheduler")
 		}
 	}
 }
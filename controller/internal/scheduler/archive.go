@@ -0,0 +1,423 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/health"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── ClickHouse Cold-Storage Archival ──
+//
+// TTL deletes telemetry after DATA_RETENTION_DAYS. When ARCHIVE_S3_URL is
+// set, each closed monthly partition is exported first, by ClickHouse
+// itself through the s3() table function, as Parquet:
+//
+//	<ARCHIVE_S3_URL>/<table>/<partition>/data.parquet
+//	<ARCHIVE_S3_URL>/<table>/<partition>/manifest.json
+//
+// The manifest records the row count, time range and the table's CREATE
+// statement so an archive can be read without this controller. GCS works
+// through its S3-compatible endpoint (https://storage.googleapis.com/...)
+// with HMAC keys. Archived partitions are tracked in Postgres; failures
+// raise a system incident and are retried on the next run.
+//
+// A partition is archived once its month has ended plus ARCHIVE_GRACE_DAYS
+// for late rows. TTL starts deleting a partition's first rows at month
+// start + retention, so retention must exceed a month plus the grace
+// period or rows are lost before export.
+//
+// Restores go into <table>_restored (same schema, no TTL) so restored
+// rows aren't deleted again straight away and don't mix with live data.
+
+// ArchiveSource is the SystemIncident source for archival failures.
+const ArchiveSource = "clickhouse_archive"
+
+// archiveTables are the tables that may be archived; names are spliced
+// into SQL, so only these are accepted.
+var archiveTables = map[string]bool{
+	"probe_data":         true,
+	"speedtest_data":     true,
+	"analysis_snapshots": true,
+}
+
+// Archived partition states.
+const (
+	ArchiveStatusArchived = "archived"
+	ArchiveStatusFailed   = "failed"
+)
+
+// ArchiveConfig holds archival settings.
+type ArchiveConfig struct {
+	Enabled       bool          `json:"enabled"`
+	URL           string        `json:"url"`
+	AccessKeyID   string        `json:"-"`
+	SecretKey     string        `json:"-"`
+	Interval      time.Duration `json:"-"`
+	GraceDays     int           `json:"grace_days"`
+	Tables        []string      `json:"tables"`
+	RetentionDays int           `json:"retention_days"`
+}
+
+// LoadArchiveConfig loads archival settings from environment variables.
+// Unknown table names in ARCHIVE_TABLES are dropped with a warning.
+func LoadArchiveConfig(retentionDays int) *ArchiveConfig {
+	cfg := &ArchiveConfig{
+		URL:           strings.TrimRight(strings.TrimSpace(os.Getenv("ARCHIVE_S3_URL")), "/"),
+		AccessKeyID:   os.Getenv("ARCHIVE_S3_ACCESS_KEY_ID"),
+		SecretKey:     os.Getenv("ARCHIVE_S3_SECRET_ACCESS_KEY"),
+		Interval:      time.Duration(getEnvInt("ARCHIVE_INTERVAL_HOURS", 24)) * time.Hour,
+		GraceDays:     getEnvInt("ARCHIVE_GRACE_DAYS", 1),
+		RetentionDays: retentionDays,
+	}
+	cfg.Enabled = cfg.URL != ""
+	tables := os.Getenv("ARCHIVE_TABLES")
+	if tables == "" {
+		tables = "probe_data,speedtest_data"
+	}
+	for _, t := range strings.Split(tables, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !archiveTables[t] {
+			log.Warnf("ARCHIVE_TABLES: %q cannot be archived, ignoring", t)
+			continue
+		}
+		cfg.Tables = append(cfg.Tables, t)
+	}
+	return cfg
+}
+
+// ArchivedPartition is one exported (or failed) table partition.
+type ArchivedPartition struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Table        string     `gorm:"column:table_name;size:64;not null;uniqueIndex:idx_archive_table_partition" json:"table"`
+	Partition    string     `gorm:"size:32;not null;uniqueIndex:idx_archive_table_partition" json:"partition"`
+	Status       string     `gorm:"size:16;index" json:"status"`
+	Rows         uint64     `json:"rows"`
+	MinTime      time.Time  `json:"min_time"`
+	MaxTime      time.Time  `json:"max_time"`
+	Location     string     `gorm:"size:1024" json:"location"`
+	Error        string     `gorm:"type:text" json:"error,omitempty"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+	RestoredAt   *time.Time `json:"restored_at,omitempty"`
+	RestoredRows uint64     `json:"restored_rows,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (ArchivedPartition) TableName() string { return "archived_partitions" }
+
+// ListArchivedPartitions returns archive records, newest partition first.
+func ListArchivedPartitions(ctx context.Context, db *gorm.DB) ([]ArchivedPartition, error) {
+	var out []ArchivedPartition
+	err := db.WithContext(ctx).Order("partition DESC, table_name").Find(&out).Error
+	return out, err
+}
+
+// partitionInfo is one active partition from system.parts.
+type partitionInfo struct {
+	Table     string
+	Partition string
+	Rows      uint64
+	MinTime   time.Time
+	MaxTime   time.Time
+}
+
+// partitionClosed reports whether a monthly (YYYYMM) partition ended at
+// least grace ago, so no more rows are expected for it.
+func partitionClosed(partition string, grace time.Duration, now time.Time) bool {
+	start, err := time.Parse("200601", partition)
+	if err != nil {
+		return false
+	}
+	return !now.Before(start.AddDate(0, 1, 0).Add(grace))
+}
+
+// chLiteral quotes s as a ClickHouse string literal.
+func chLiteral(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
+
+// Archiver exports closed partitions to object storage.
+type Archiver struct {
+	db     *gorm.DB
+	ch     *sql.DB
+	config *ArchiveConfig
+}
+
+// NewArchiver creates a new archiver.
+func NewArchiver(db *gorm.DB, ch *sql.DB, config *ArchiveConfig) *Archiver {
+	return &Archiver{db: db, ch: ch, config: config}
+}
+
+// Config returns the archiver's settings.
+func (a *Archiver) Config() *ArchiveConfig { return a.config }
+
+// s3Func returns an s3() table function call for object name under the
+// partition's prefix.
+func (a *Archiver) s3Func(table, partition, object, format string) string {
+	url := fmt.Sprintf("%s/%s/%s/%s", a.config.URL, table, partition, object)
+	if a.config.AccessKeyID == "" {
+		return fmt.Sprintf("s3(%s, %s)", chLiteral(url), chLiteral(format))
+	}
+	return fmt.Sprintf("s3(%s, %s, %s, %s)", chLiteral(url), chLiteral(a.config.AccessKeyID), chLiteral(a.config.SecretKey), chLiteral(format))
+}
+
+// Start runs archival periodically until ctx is cancelled.
+func (a *Archiver) Start(ctx context.Context) {
+	if !a.config.Enabled || a.ch == nil {
+		log.Info("ClickHouse archival disabled")
+		return
+	}
+	log.Infof("Starting ClickHouse archival to %s (interval: %v, tables: %s)",
+		a.config.URL, a.config.Interval, strings.Join(a.config.Tables, ", "))
+	if a.config.RetentionDays > 0 && a.config.RetentionDays <= 31+a.config.GraceDays {
+		log.Warnf("DATA_RETENTION_DAYS=%d is too short for monthly archival: TTL deletes the start of a month before it can be exported", a.config.RetentionDays)
+	}
+
+	health.Register("archiver", a.config.Interval, 0)
+
+	a.RunOnce(ctx)
+	health.Beat("archiver")
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			health.Stop("archiver")
+			log.Info("ClickHouse archival stopped")
+			return
+		case <-ticker.C:
+			a.RunOnce(ctx)
+			health.Beat("archiver")
+		}
+	}
+}
+
+// ArchiveRunResult summarizes one archival pass.
+type ArchiveRunResult struct {
+	Archived []ArchivedPartition `json:"archived"`
+	Failed   []ArchivedPartition `json:"failed"`
+}
+
+// RunOnce exports every closed partition that hasn't been archived yet.
+func (a *Archiver) RunOnce(ctx context.Context) (*ArchiveRunResult, error) {
+	res := &ArchiveRunResult{Archived: []ArchivedPartition{}, Failed: []ArchivedPartition{}}
+	parts, err := a.closedPartitions(ctx, time.Now().UTC())
+	if err != nil {
+		log.Errorf("Archiver: %v", err)
+		return nil, err
+	}
+	for _, p := range parts {
+		rec := a.archivePartition(ctx, p)
+		if rec.Status == ArchiveStatusArchived {
+			res.Archived = append(res.Archived, rec)
+		} else {
+			res.Failed = append(res.Failed, rec)
+		}
+	}
+
+	now := time.Now().UTC()
+	active := make(map[string]bool)
+	for _, rec := range res.Failed {
+		inc := SystemIncident{
+			Key:      fmt.Sprintf("clickhouse_archive:%s:%s", rec.Table, rec.Partition),
+			Source:   ArchiveSource,
+			Severity: "warning",
+			Title:    fmt.Sprintf("Archiving %s partition %s failed", rec.Table, rec.Partition),
+			Detail:   rec.Error + " — retried on the next run; TTL will delete the partition if it keeps failing.",
+		}
+		active[inc.Key] = true
+		if _, err := RaiseSystemIncident(ctx, a.db, inc, now); err != nil {
+			log.Errorf("Archiver: raise %s: %v", inc.Key, err)
+		}
+	}
+	if _, err := ResolveSystemIncidents(ctx, a.db, ArchiveSource, active, now); err != nil {
+		log.Errorf("Archiver: resolve: %v", err)
+	}
+	return res, nil
+}
+
+// closedPartitions lists active partitions of the configured tables that
+// are closed and not yet archived, oldest first.
+func (a *Archiver) closedPartitions(ctx context.Context, now time.Time) ([]partitionInfo, error) {
+	if len(a.config.Tables) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(a.config.Tables))
+	for i, t := range a.config.Tables {
+		names[i] = chLiteral(t)
+	}
+	rows, err := a.ch.QueryContext(ctx, fmt.Sprintf(`
+SELECT table, partition_id, sum(rows), min(min_time), max(max_time)
+FROM system.parts
+WHERE active AND database = currentDatabase() AND table IN (%s)
+GROUP BY table, partition_id
+ORDER BY partition_id, table`, strings.Join(names, ", ")))
+	if err != nil {
+		return nil, fmt.Errorf("query system.parts: %w", err)
+	}
+	defer rows.Close()
+
+	var all []partitionInfo
+	for rows.Next() {
+		var p partitionInfo
+		if err := rows.Scan(&p.Table, &p.Partition, &p.Rows, &p.MinTime, &p.MaxTime); err != nil {
+			return nil, fmt.Errorf("scan system.parts: %w", err)
+		}
+		if partitionClosed(p.Partition, time.Duration(a.config.GraceDays)*24*time.Hour, now) {
+			all = append(all, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var done []ArchivedPartition
+	if err := a.db.WithContext(ctx).Where("status = ?", ArchiveStatusArchived).Find(&done).Error; err != nil {
+		return nil, err
+	}
+	archived := make(map[string]bool, len(done))
+	for _, d := range done {
+		archived[d.Table+"/"+d.Partition] = true
+	}
+	out := all[:0]
+	for _, p := range all {
+		if !archived[p.Table+"/"+p.Partition] {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// archivePartition exports one partition with its manifest, verifies the
+// row count read back from storage, and records the outcome.
+func (a *Archiver) archivePartition(ctx context.Context, p partitionInfo) ArchivedPartition {
+	rec := ArchivedPartition{
+		Table:     p.Table,
+		Partition: p.Partition,
+		Rows:      p.Rows,
+		MinTime:   p.MinTime,
+		MaxTime:   p.MaxTime,
+		Location:  fmt.Sprintf("%s/%s/%s/data.parquet", a.config.URL, p.Table, p.Partition),
+	}
+	err := a.exportPartition(ctx, p)
+	now := time.Now().UTC()
+	if err != nil {
+		rec.Status, rec.Error = ArchiveStatusFailed, err.Error()
+		log.WithFields(log.Fields{"table": p.Table, "partition": p.Partition}).Errorf("Archiver: %v", err)
+	} else {
+		rec.Status, rec.ArchivedAt = ArchiveStatusArchived, &now
+		log.Infof("Archiver: exported %s partition %s (%d rows) to %s", p.Table, p.Partition, p.Rows, rec.Location)
+	}
+
+	var cur ArchivedPartition
+	q := a.db.WithContext(ctx).Where("table_name = ? AND partition = ?", p.Table, p.Partition).Limit(1).Find(&cur)
+	if q.Error == nil && cur.ID != 0 {
+		rec.ID = cur.ID
+		rec.RestoredAt, rec.RestoredRows = cur.RestoredAt, cur.RestoredRows
+	}
+	if err := a.db.WithContext(ctx).Save(&rec).Error; err != nil {
+		log.Errorf("Archiver: record %s/%s: %v", p.Table, p.Partition, err)
+	}
+	return rec
+}
+
+func (a *Archiver) exportPartition(ctx context.Context, p partitionInfo) error {
+	where := "_partition_id = " + chLiteral(p.Partition)
+	var rows uint64
+	if err := a.ch.QueryRowContext(ctx, fmt.Sprintf("SELECT count() FROM %s WHERE %s", p.Table, where)).Scan(&rows); err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+	if _, err := a.ch.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO FUNCTION %s SELECT * FROM %s WHERE %s SETTINGS s3_truncate_on_insert = 1",
+		a.s3Func(p.Table, p.Partition, "data.parquet", "Parquet"), p.Table, where)); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	var stored uint64
+	if err := a.ch.QueryRowContext(ctx, fmt.Sprintf("SELECT count() FROM %s",
+		a.s3Func(p.Table, p.Partition, "data.parquet", "Parquet"))).Scan(&stored); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if stored != rows {
+		return fmt.Errorf("verify: %d rows in archive, %d in table", stored, rows)
+	}
+	if _, err := a.ch.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO FUNCTION %s
+SELECT
+    %s AS "table",
+    %s AS "partition",
+    toUInt64(%d) AS rows,
+    %s AS min_time,
+    %s AS max_time,
+    'Parquet' AS format,
+    now('UTC') AS exported_at,
+    (SELECT create_table_query FROM system.tables WHERE database = currentDatabase() AND name = %s) AS create_table_query
+SETTINGS s3_truncate_on_insert = 1`,
+		a.s3Func(p.Table, p.Partition, "manifest.json", "JSONEachRow"),
+		chLiteral(p.Table), chLiteral(p.Partition), rows,
+		chLiteral(p.MinTime.UTC().Format(time.RFC3339)), chLiteral(p.MaxTime.UTC().Format(time.RFC3339)),
+		chLiteral(p.Table))); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return nil
+}
+
+// ErrArchiveNotFound is returned when restoring a partition that hasn't
+// been archived.
+var ErrArchiveNotFound = errors.New("partition not archived")
+
+// Restore imports an archived partition into <table>_restored, replacing
+// any earlier restore of the same partition, and returns the row count.
+func (a *Archiver) Restore(ctx context.Context, table, partition string) (uint64, error) {
+	if !archiveTables[table] {
+		return 0, ErrArchiveNotFound
+	}
+	var rec ArchivedPartition
+	if err := a.db.WithContext(ctx).
+		Where("table_name = ? AND partition = ? AND status = ?", table, partition, ArchiveStatusArchived).
+		Limit(1).Find(&rec).Error; err != nil {
+		return 0, err
+	}
+	if rec.ID == 0 {
+		return 0, ErrArchiveNotFound
+	}
+
+	restored := table + "_restored"
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS %s", restored, table),
+		fmt.Sprintf("ALTER TABLE %s REMOVE TTL", restored),
+		fmt.Sprintf("ALTER TABLE %s DROP PARTITION ID %s", restored, chLiteral(partition)),
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", restored, a.s3Func(table, partition, "data.parquet", "Parquet")),
+	} {
+		if _, err := a.ch.ExecContext(ctx, stmt); err != nil {
+			// REMOVE TTL fails once the TTL is already gone.
+			if strings.Contains(stmt, "REMOVE TTL") {
+				continue
+			}
+			return 0, fmt.Errorf("restore %s/%s: %w", table, partition, err)
+		}
+	}
+	var n uint64
+	if err := a.ch.QueryRowContext(ctx, fmt.Sprintf("SELECT count() FROM %s WHERE _partition_id = %s", restored, chLiteral(partition))).Scan(&n); err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if err := a.db.WithContext(ctx).Model(&ArchivedPartition{}).Where("id = ?", rec.ID).
+		Updates(map[string]any{"restored_at": now, "restored_rows": n}).Error; err != nil {
+		return n, err
+	}
+	log.Infof("Archiver: restored %s partition %s (%d rows) into %s", table, partition, n, restored)
+	return n, nil
+}
@@ -0,0 +1,345 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ── ClickHouse Optimize ──
+//
+// Bulk imports and batch-writer incidents can leave a table with many small
+// parts, which slows every query until background merges catch up. An
+// optimize job forces the merge with OPTIMIZE TABLE ... FINAL (optionally
+// DEDUPLICATE, which also drops rows duplicated by retried batches) and can
+// rebuild data-skipping indexes with ALTER TABLE ... MATERIALIZE INDEX.
+//
+// Jobs are started from the admin API and run in the background, one at a
+// time; tables are processed in order and the status reports per-table
+// part/row counts before and after plus live merge progress from
+// system.merges. A FINAL merge rewrites the whole partition, so a table is
+// skipped unless the disks have at least optimizeFreeSpaceFactor times its
+// size free (Force overrides).
+
+// optimizeTables are the tables an optimize job accepts; names are spliced
+// into SQL, so only these are allowed.
+var optimizeTables = []string{"probe_data", "speedtest_data", "analysis_snapshots", "analysis_snapshot_versions"}
+
+const (
+	optimizeFreeSpaceFactor = 1.2
+	optimizeTimeout         = 6 * time.Hour
+)
+
+// Optimize job and table states.
+const (
+	OptimizePending = "pending"
+	OptimizeRunning = "running"
+	OptimizeDone    = "done"
+	OptimizeFailed  = "failed"
+	OptimizeSkipped = "skipped"
+)
+
+var (
+	// ErrOptimizeRunning is returned when a job is already in progress.
+	ErrOptimizeRunning = errors.New("an optimize job is already running")
+	// ErrOptimizeInput is returned for unknown tables or malformed partitions.
+	ErrOptimizeInput = errors.New("invalid optimize request")
+)
+
+var partitionIDPattern = regexp.MustCompile(`^[0-9A-Za-z_-]{1,64}$`)
+
+// OptimizeRequest selects what an optimize job does.
+type OptimizeRequest struct {
+	Tables             []string `json:"tables"`    // default: all optimizeTables
+	Partition          string   `json:"partition"` // partition ID, e.g. "202405"; empty = whole table
+	Deduplicate        bool     `json:"deduplicate"`
+	MaterializeIndexes bool     `json:"materialize_indexes"`
+	Force              bool     `json:"force"` // skip the free-space check
+}
+
+// OptimizeTableProgress is one table's state within a job.
+type OptimizeTableProgress struct {
+	Table       string     `json:"table"`
+	Status      string     `json:"status"`
+	PartsBefore uint64     `json:"parts_before"`
+	PartsAfter  uint64     `json:"parts_after"`
+	RowsBefore  uint64     `json:"rows_before"`
+	RowsAfter   uint64     `json:"rows_after"`
+	Bytes       uint64     `json:"bytes_on_disk"`
+	Indexes     []string   `json:"indexes_materialized,omitempty"`
+	Merging     int        `json:"merges_in_progress"`
+	MergePct    float64    `json:"merge_progress_pct"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// OptimizeJob is the state of the current or last optimize job.
+type OptimizeJob struct {
+	Request    OptimizeRequest         `json:"request"`
+	Status     string                  `json:"status"`
+	StartedBy  uint                    `json:"started_by"`
+	StartedAt  time.Time               `json:"started_at"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+	Done       int                     `json:"tables_done"`
+	Tables     []OptimizeTableProgress `json:"tables"`
+}
+
+// Optimizer runs optimize jobs against ClickHouse, one at a time.
+type Optimizer struct {
+	ch  *sql.DB
+	mu  sync.Mutex
+	job *OptimizeJob
+}
+
+// NewOptimizer creates an optimizer.
+func NewOptimizer(ch *sql.DB) *Optimizer {
+	return &Optimizer{ch: ch}
+}
+
+// validateOptimizeRequest fills defaults and rejects unknown tables and
+// malformed partition IDs.
+func validateOptimizeRequest(req *OptimizeRequest) error {
+	if len(req.Tables) == 0 {
+		req.Tables = append([]string(nil), optimizeTables...)
+	}
+	seen := make(map[string]bool)
+	for _, t := range req.Tables {
+		known := false
+		for _, ok := range optimizeTables {
+			known = known || t == ok
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown table %q", ErrOptimizeInput, t)
+		}
+		if seen[t] {
+			return fmt.Errorf("%w: table %q listed twice", ErrOptimizeInput, t)
+		}
+		seen[t] = true
+	}
+	if req.Partition != "" && !partitionIDPattern.MatchString(req.Partition) {
+		return fmt.Errorf("%w: malformed partition ID %q", ErrOptimizeInput, req.Partition)
+	}
+	return nil
+}
+
+// Start validates req and runs the job in the background. It returns a
+// snapshot of the new job, or ErrOptimizeRunning.
+func (o *Optimizer) Start(req OptimizeRequest, userID uint) (*OptimizeJob, error) {
+	if err := validateOptimizeRequest(&req); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	if o.job != nil && o.job.Status == OptimizeRunning {
+		o.mu.Unlock()
+		return nil, ErrOptimizeRunning
+	}
+	job := &OptimizeJob{Request: req, Status: OptimizeRunning, StartedBy: userID, StartedAt: time.Now().UTC()}
+	for _, t := range req.Tables {
+		job.Tables = append(job.Tables, OptimizeTableProgress{Table: t, Status: OptimizePending})
+	}
+	o.job = job
+	snap := o.snapshotLocked()
+	o.mu.Unlock()
+
+	go o.run(req)
+	return snap, nil
+}
+
+// Status returns the current or last job, with live merge progress for
+// the table being optimized. Nil when no job has run.
+func (o *Optimizer) Status(ctx context.Context) *OptimizeJob {
+	o.mu.Lock()
+	snap := o.snapshotLocked()
+	o.mu.Unlock()
+	if snap == nil {
+		return nil
+	}
+	for i := range snap.Tables {
+		t := &snap.Tables[i]
+		if t.Status != OptimizeRunning {
+			continue
+		}
+		var n uint64
+		var pct sql.NullFloat64
+		err := o.ch.QueryRowContext(ctx, fmt.Sprintf(
+			`SELECT count(), max(progress) FROM system.merges WHERE database = currentDatabase() AND table = %s`, chLiteral(t.Table))).Scan(&n, &pct)
+		if err == nil {
+			t.Merging = int(n)
+			t.MergePct = math.Round(pct.Float64*1000) / 10
+		}
+	}
+	return snap
+}
+
+func (o *Optimizer) snapshotLocked() *OptimizeJob {
+	if o.job == nil {
+		return nil
+	}
+	cp := *o.job
+	cp.Tables = append([]OptimizeTableProgress(nil), o.job.Tables...)
+	return &cp
+}
+
+// update applies fn to table i under the lock.
+func (o *Optimizer) update(i int, fn func(*OptimizeTableProgress)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fn(&o.job.Tables[i])
+}
+
+func (o *Optimizer) run(req OptimizeRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), optimizeTimeout)
+	defer cancel()
+
+	failed := false
+	for i, table := range req.Tables {
+		err := o.optimizeTable(ctx, i, table, req)
+		now := time.Now().UTC()
+		o.update(i, func(t *OptimizeTableProgress) {
+			t.FinishedAt = &now
+			switch {
+			case err == nil:
+				t.Status = OptimizeDone
+			case t.Status == OptimizeSkipped:
+				t.Error = err.Error()
+			default:
+				t.Status, t.Error = OptimizeFailed, err.Error()
+			}
+		})
+		o.mu.Lock()
+		o.job.Done++
+		o.mu.Unlock()
+		if err != nil {
+			log.Warnf("ClickHouse optimize: %s: %v", table, err)
+			failed = failed || !errors.Is(err, errOptimizeSpace)
+		}
+	}
+
+	now := time.Now().UTC()
+	o.mu.Lock()
+	o.job.FinishedAt = &now
+	o.job.Status = OptimizeDone
+	if failed {
+		o.job.Status = OptimizeFailed
+	}
+	o.mu.Unlock()
+	log.Infof("ClickHouse optimize finished (%d tables)", len(req.Tables))
+}
+
+var errOptimizeSpace = errors.New("not enough free disk space for a FINAL merge")
+
+// optimizeTable runs the requested operations on one table.
+func (o *Optimizer) optimizeTable(ctx context.Context, i int, table string, req OptimizeRequest) error {
+	started := time.Now().UTC()
+	o.update(i, func(t *OptimizeTableProgress) { t.Status, t.StartedAt = OptimizeRunning, &started })
+
+	parts, rows, bytes, err := o.tableParts(ctx, table, req.Partition)
+	if err != nil {
+		return err
+	}
+	o.update(i, func(t *OptimizeTableProgress) { t.PartsBefore, t.RowsBefore, t.Bytes = parts, rows, bytes })
+	if parts == 0 {
+		return nil
+	}
+
+	if !req.Force {
+		var free uint64
+		if err := o.ch.QueryRowContext(ctx, `SELECT sum(free_space) FROM system.disks`).Scan(&free); err != nil {
+			return fmt.Errorf("query system.disks: %w", err)
+		}
+		if float64(free) < float64(bytes)*optimizeFreeSpaceFactor {
+			o.update(i, func(t *OptimizeTableProgress) { t.Status = OptimizeSkipped })
+			return fmt.Errorf("%w: %.1f GiB free, %.1f GiB needed (set force to override)",
+				errOptimizeSpace, gib(free), gib(uint64(float64(bytes)*optimizeFreeSpaceFactor)))
+		}
+	}
+
+	q := "OPTIMIZE TABLE " + table
+	if req.Partition != "" {
+		q += " PARTITION ID " + chLiteral(req.Partition)
+	}
+	q += " FINAL"
+	if req.Deduplicate {
+		q += " DEDUPLICATE"
+	}
+	if _, err := o.ch.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("optimize: %w", err)
+	}
+
+	if req.MaterializeIndexes {
+		indexes, err := o.skippingIndexes(ctx, table)
+		if err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			stmt := fmt.Sprintf("ALTER TABLE %s MATERIALIZE INDEX %s", table, quoteIdent(idx))
+			if req.Partition != "" {
+				stmt += " IN PARTITION ID " + chLiteral(req.Partition)
+			}
+			if _, err := o.ch.ExecContext(ctx, stmt+" SETTINGS mutations_sync = 1"); err != nil {
+				return fmt.Errorf("materialize index %s: %w", idx, err)
+			}
+			o.update(i, func(t *OptimizeTableProgress) { t.Indexes = append(t.Indexes, idx) })
+		}
+	}
+
+	parts, rows, _, err = o.tableParts(ctx, table, req.Partition)
+	if err != nil {
+		return err
+	}
+	o.update(i, func(t *OptimizeTableProgress) { t.PartsAfter, t.RowsAfter = parts, rows })
+	return nil
+}
+
+// tableParts returns the active part count, rows and bytes on disk for a
+// table, optionally limited to one partition.
+func (o *Optimizer) tableParts(ctx context.Context, table, partition string) (parts, rows, bytes uint64, err error) {
+	q := fmt.Sprintf(`SELECT count(), sum(rows), sum(bytes_on_disk) FROM system.parts
+WHERE active AND database = currentDatabase() AND table = %s`, chLiteral(table))
+	if partition != "" {
+		q += " AND partition_id = " + chLiteral(partition)
+	}
+	if err := o.ch.QueryRowContext(ctx, q).Scan(&parts, &rows, &bytes); err != nil {
+		return 0, 0, 0, fmt.Errorf("query system.parts: %w", err)
+	}
+	return parts, rows, bytes, nil
+}
+
+// skippingIndexes lists the table's data-skipping indexes.
+func (o *Optimizer) skippingIndexes(ctx context.Context, table string) ([]string, error) {
+	rows, err := o.ch.QueryContext(ctx, fmt.Sprintf(
+		`SELECT name FROM system.data_skipping_indices WHERE database = currentDatabase() AND table = %s ORDER BY name`, chLiteral(table)))
+	if err != nil {
+		return nil, fmt.Errorf("query system.data_skipping_indices: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// quoteIdent backquotes a ClickHouse identifier.
+func quoteIdent(s string) string {
+	out := []byte{'`'}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '`' || s[i] == '\\' {
+			out = append(out, '\\')
+		}
+		out = append(out, s[i])
+	}
+	return string(append(out, '`'))
+}
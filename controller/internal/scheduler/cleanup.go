@@ -4,12 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"strconv"
 	"time"
 
 	"netwatcher-controller/internal/deletion"
-	"netwatcher-controller/internal/users"
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/settings"
 
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -33,8 +34,10 @@ func LoadRetentionConfig() *RetentionConfig {
 	}
 }
 
+// getEnvInt reads an integer setting; runtime overrides (see
+// internal/settings) take precedence over the environment.
 func getEnvInt(key string, defaultVal int) int {
-	if v := os.Getenv(key); v != "" {
+	if v := settings.Getenv(key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
 			return i
 		}
@@ -44,27 +47,44 @@ func getEnvInt(key string, defaultVal int) int {
 
 // CleanupScheduler handles periodic cleanup of old data
 type CleanupScheduler struct {
-	db     *gorm.DB
-	ch     *sql.DB
-	config *RetentionConfig
+	db       *gorm.DB
+	ch       *sql.DB
+	config   *RetentionConfig
+	reconfig chan *RetentionConfig
 }
 
 // NewCleanupScheduler creates a new cleanup scheduler
 func NewCleanupScheduler(db *gorm.DB, ch *sql.DB, config *RetentionConfig) *CleanupScheduler {
 	return &CleanupScheduler{
-		db:     db,
-		ch:     ch,
-		config: config,
+		db:       db,
+		ch:       ch,
+		config:   config,
+		reconfig: make(chan *RetentionConfig, 1),
 	}
 }
 
+// Reconfigure applies new retention settings from the next cleanup run.
+func (s *CleanupScheduler) Reconfigure(config *RetentionConfig) {
+	if config == nil || config.CleanupInterval <= 0 {
+		return
+	}
+	select {
+	case <-s.reconfig:
+	default:
+	}
+	s.reconfig <- config
+}
+
 // Start begins the cleanup scheduler in a blocking loop
 func (s *CleanupScheduler) Start(ctx context.Context) {
 	log.Infof("Starting cleanup scheduler (interval: %v, soft-delete grace: %d days, data retention: %d days, backfill grace: %v)",
 		s.config.CleanupInterval, s.config.SoftDeleteGraceDays, s.config.DataRetentionDays, s.config.BackfillGracePeriod)
 
+	health.Register("cleanup_scheduler", s.config.CleanupInterval, 0)
+
 	// Run once on startup
 	s.runCleanup(ctx)
+	health.Beat("cleanup_scheduler")
 
 	ticker := time.NewTicker(s.config.CleanupInterval)
 	defer ticker.Stop()
@@ -72,10 +92,18 @@ func (s *CleanupScheduler) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			health.Stop("cleanup_scheduler")
 			log.Info("Cleanup scheduler stopped")
 			return
+		case next := <-s.reconfig:
+			s.config = next
+			ticker.Reset(s.config.CleanupInterval)
+			health.Register("cleanup_scheduler", s.config.CleanupInterval, 0)
+			log.Infof("Cleanup scheduler reconfigured (interval: %v, soft-delete grace: %d days, data retention: %d days)",
+				s.config.CleanupInterval, s.config.SoftDeleteGraceDays, s.config.DataRetentionDays)
 		case <-ticker.C:
 			s.runCleanup(ctx)
+			health.Beat("cleanup_scheduler")
 		}
 	}
 }
@@ -140,18 +168,8 @@ func (s *CleanupScheduler) runCleanup(ctx context.Context) {
 	store := deletion.NewQueueStore(s.db)
 	s.backfillDeletions(ctx, store, backfillCutoff)
 
-	// Sweep expired user tokens (password reset, email verification) so the
-	// user_tokens table doesn't grow without bound. ValidateToken already
-	// deletes on access, but tokens that are never validated linger.
-	tokenResult := s.db.WithContext(ctx).
-		Where("expires_at < ?", time.Now()).
-		Delete(&users.UserToken{})
-	if tokenResult.Error != nil {
-		log.Errorf("Failed to cleanup expired user tokens: %v", tokenResult.Error)
-	} else if tokenResult.RowsAffected > 0 {
-		log.Infof("Cleaned up %d expired user tokens", tokenResult.RowsAffected)
-		totalDeleted += tokenResult.RowsAffected
-	}
+	// Expired sessions, PINs, share links and user tokens are swept by
+	// the Janitor (janitor.go) on its own, shorter interval.
 
 	elapsed := time.Since(startTime)
 	if totalDeleted > 0 {
@@ -242,12 +260,10 @@ func (s *CleanupScheduler) backfillDeletions(ctx context.Context, store *deletio
 	}
 }
 
-// UpdateClickHouseTTL modifies table TTL to match configured retention
+// UpdateClickHouseTTL modifies table TTL to match configured retention,
+// keeping the CH_TTL_MOVES storage tier moves on telemetry tables.
 func UpdateClickHouseTTL(ctx context.Context, ch *sql.DB, table string, ttlColumn string, days int) error {
-	query := fmt.Sprintf(
-		"ALTER TABLE %s MODIFY TTL %s + INTERVAL %d DAY DELETE",
-		table, ttlColumn, days,
-	)
+	query := fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", table, probe.RetentionTTL(table, ttlColumn, days))
 	_, err := ch.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to update TTL for %s: %w", table, err)
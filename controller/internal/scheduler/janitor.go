@@ -0,0 +1,176 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/metrics"
+	"netwatcher-controller/internal/users"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// JanitorConfig holds per-table retention for short-lived auth artifacts.
+// Each retention is measured past the row's expiry (or consumption), so a
+// zero retention removes rows as soon as they expire.
+type JanitorConfig struct {
+	Interval           time.Duration // How often the janitor runs
+	SessionRetention   time.Duration // after sessions.expiry / logout
+	PinRetention       time.Duration // after agent_pins.consumed / expires_at
+	ShareLinkRetention time.Duration // after share_links.expires_at
+	UserTokenRetention time.Duration // after user_tokens.expires_at
+	// AgentStatusRetention bounds agent_status_events (the timeline's
+	// online/offline history), measured from the event.
+	AgentStatusRetention time.Duration
+	Enabled              bool
+}
+
+// LoadJanitorConfig loads janitor settings from environment variables.
+func LoadJanitorConfig() *JanitorConfig {
+	return &JanitorConfig{
+		Interval:             time.Duration(getEnvInt("JANITOR_INTERVAL_MINUTES", 60)) * time.Minute,
+		SessionRetention:     time.Duration(getEnvInt("JANITOR_SESSION_RETENTION_HOURS", 24)) * time.Hour,
+		PinRetention:         time.Duration(getEnvInt("JANITOR_PIN_RETENTION_HOURS", 24*7)) * time.Hour,
+		ShareLinkRetention:   time.Duration(getEnvInt("JANITOR_SHARE_LINK_RETENTION_HOURS", 24*7)) * time.Hour,
+		UserTokenRetention:   time.Duration(getEnvInt("JANITOR_USER_TOKEN_RETENTION_HOURS", 0)) * time.Hour,
+		AgentStatusRetention: time.Duration(getEnvInt("JANITOR_AGENT_STATUS_RETENTION_DAYS", 90)) * 24 * time.Hour,
+		Enabled:              getEnvInt("JANITOR_ENABLED", 1) != 0,
+	}
+}
+
+// JanitorResult reports rows removed per table by one run.
+type JanitorResult struct {
+	Deleted    map[string]int64  `json:"deleted"`
+	Errors     map[string]string `json:"errors,omitempty"`
+	Total      int64             `json:"total"`
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs int64             `json:"duration_ms"`
+}
+
+// Janitor removes expired sessions and their refresh tokens,
+// consumed/expired agent PINs, expired share links, expired user tokens and
+// old agent status events.
+//
+// Agent authentication nonces are verified per request and never stored,
+// so there is no nonce table to sweep.
+type Janitor struct {
+	db     *gorm.DB
+	config *JanitorConfig
+}
+
+// NewJanitor creates a new janitor.
+func NewJanitor(db *gorm.DB, config *JanitorConfig) *Janitor {
+	return &Janitor{db: db, config: config}
+}
+
+// Start runs the janitor periodically until ctx is cancelled.
+func (j *Janitor) Start(ctx context.Context) {
+	if !j.config.Enabled {
+		log.Info("Janitor disabled (JANITOR_ENABLED=0)")
+		return
+	}
+	log.Infof("Starting janitor (interval: %v)", j.config.Interval)
+
+	health.Register("janitor", j.config.Interval, 0)
+
+	j.RunOnce(ctx)
+	health.Beat("janitor")
+
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			health.Stop("janitor")
+			log.Info("Janitor stopped")
+			return
+		case <-ticker.C:
+			j.RunOnce(ctx)
+			health.Beat("janitor")
+		}
+	}
+}
+
+// RunOnce performs one cleanup pass. It is also used by the admin
+// endpoint to trigger cleanup on demand.
+func (j *Janitor) RunOnce(ctx context.Context) *JanitorResult {
+	now := time.Now()
+	res := &JanitorResult{
+		Deleted:   make(map[string]int64),
+		Errors:    make(map[string]string),
+		StartedAt: now.UTC(),
+	}
+
+	sweep := func(table string, q *gorm.DB) {
+		if q.Error != nil {
+			log.Errorf("Janitor: failed to clean %s: %v", table, q.Error)
+			res.Errors[table] = q.Error.Error()
+			return
+		}
+		res.Deleted[table] = q.RowsAffected
+		res.Total += q.RowsAffected
+		if m := metrics.Get(); m != nil && q.RowsAffected > 0 {
+			m.JanitorDeleted.WithLabelValues(table).Add(float64(q.RowsAffected))
+		}
+	}
+
+	// Sessions past expiry, or logged out (soft-deleted), beyond retention
+	sessionCutoff := now.Add(-j.config.SessionRetention)
+	sweep("sessions", j.db.WithContext(ctx).
+		Where("expiry < ? OR (deleted_at IS NOT NULL AND deleted_at < ?)", sessionCutoff, sessionCutoff).
+		Delete(&sessionModel{}))
+
+	// Refresh tokens: one row per rotation. Drop those expired past the
+	// session retention and any whose session was removed above.
+	sweep("refresh_tokens", j.db.WithContext(ctx).
+		Where("expires_at < ? OR session_id NOT IN (SELECT session_id FROM sessions)", sessionCutoff).
+		Delete(&users.RefreshToken{}))
+
+	// Consumed PINs, and unconsumed PINs past their expiry
+	pinCutoff := now.Add(-j.config.PinRetention)
+	sweep("agent_pins", j.db.WithContext(ctx).
+		Where("(consumed IS NOT NULL AND consumed < ?) OR (consumed IS NULL AND expires_at IS NOT NULL AND expires_at < ?)", pinCutoff, pinCutoff).
+		Delete(&pinModel{}))
+
+	// Expired share links
+	sweep("share_links", j.db.WithContext(ctx).
+		Where("expires_at < ?", now.Add(-j.config.ShareLinkRetention)).
+		Delete(&shareLinkModel{}))
+
+	// Expired user tokens (password reset, email verification).
+	// ValidateToken deletes on access, but tokens that are never
+	// validated linger.
+	sweep("user_tokens", j.db.WithContext(ctx).
+		Where("expires_at < ?", now.Add(-j.config.UserTokenRetention)).
+		Delete(&users.UserToken{}))
+
+	sweep("agent_status_events", j.db.WithContext(ctx).
+		Where("at < ?", now.Add(-j.config.AgentStatusRetention)).
+		Delete(&statusEventModel{}))
+
+	res.DurationMs = time.Since(now).Milliseconds()
+	if m := metrics.Get(); m != nil {
+		m.JanitorLastRun.Set(float64(now.Unix()))
+	}
+	if res.Total > 0 {
+		log.Infof("Janitor complete: removed %d rows %v in %v", res.Total, res.Deleted, time.Since(now))
+	} else {
+		log.Debugf("Janitor complete: nothing to remove (took %v)", time.Since(now))
+	}
+	return res
+}
+
+type sessionModel struct{}
+
+func (sessionModel) TableName() string { return "sessions" }
+
+type shareLinkModel struct{}
+
+func (shareLinkModel) TableName() string { return "share_links" }
+
+type statusEventModel struct{}
+
+func (statusEventModel) TableName() string { return "agent_status_events" }
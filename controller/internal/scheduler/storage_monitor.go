@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── ClickHouse Storage Monitor ──
+//
+// Polls system.disks and system.parts and raises system incidents when a
+// disk fills up or a table accumulates too many active parts in one
+// partition. ClickHouse delays inserts at parts_to_delay_insert (150) and
+// rejects them at parts_to_throw_insert (300) per partition, so the
+// default parts thresholds match those. Incidents resolve on their own
+// once usage drops back under the warning threshold.
+
+// StorageSource is the SystemIncident source for storage incidents.
+const StorageSource = "clickhouse_storage"
+
+// StorageConfig holds storage monitor thresholds.
+type StorageConfig struct {
+	Interval        time.Duration `json:"-"`
+	DiskWarnPct     float64       `json:"disk_warn_pct"`
+	DiskCriticalPct float64       `json:"disk_critical_pct"`
+	PartsWarn       int           `json:"parts_warn"`
+	PartsCritical   int           `json:"parts_critical"`
+	Enabled         bool          `json:"enabled"`
+}
+
+// LoadStorageConfig loads storage monitor settings from environment variables.
+func LoadStorageConfig() *StorageConfig {
+	return &StorageConfig{
+		Interval:        time.Duration(getEnvInt("CH_STORAGE_CHECK_INTERVAL_MINUTES", 5)) * time.Minute,
+		DiskWarnPct:     float64(getEnvInt("CH_DISK_WARN_PCT", 80)),
+		DiskCriticalPct: float64(getEnvInt("CH_DISK_CRITICAL_PCT", 90)),
+		PartsWarn:       getEnvInt("CH_PARTS_WARN", 150),
+		PartsCritical:   getEnvInt("CH_PARTS_CRITICAL", 300),
+		Enabled:         getEnvInt("CH_STORAGE_MONITOR_ENABLED", 1) != 0,
+	}
+}
+
+// DiskUsage is one ClickHouse disk.
+type DiskUsage struct {
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	TotalBytes uint64  `json:"total_bytes"`
+	FreeBytes  uint64  `json:"free_bytes"`
+	UsedBytes  uint64  `json:"used_bytes"`
+	UsedPct    float64 `json:"used_pct"`
+}
+
+// TableUsage is the active-part footprint of one table.
+type TableUsage struct {
+	Table                string `json:"table"`
+	Rows                 uint64 `json:"rows"`
+	BytesOnDisk          uint64 `json:"bytes_on_disk"`
+	ActiveParts          uint64 `json:"active_parts"`
+	MaxPartsPerPartition uint64 `json:"max_parts_per_partition"`
+}
+
+// StorageUsage is a snapshot of ClickHouse storage.
+type StorageUsage struct {
+	Disks     []DiskUsage  `json:"disks"`
+	Tables    []TableUsage `json:"tables"`
+	CheckedAt time.Time    `json:"checked_at"`
+}
+
+// CollectStorageUsage reads disk and part usage for the current database.
+func CollectStorageUsage(ctx context.Context, ch *sql.DB) (*StorageUsage, error) {
+	out := &StorageUsage{Disks: []DiskUsage{}, Tables: []TableUsage{}, CheckedAt: time.Now().UTC()}
+
+	rows, err := ch.QueryContext(ctx, `SELECT name, path, total_space, free_space FROM system.disks ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("query system.disks: %w", err)
+	}
+	for rows.Next() {
+		var d DiskUsage
+		if err := rows.Scan(&d.Name, &d.Path, &d.TotalBytes, &d.FreeBytes); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan system.disks: %w", err)
+		}
+		if d.TotalBytes > 0 && d.FreeBytes <= d.TotalBytes {
+			d.UsedBytes = d.TotalBytes - d.FreeBytes
+			d.UsedPct = float64(d.UsedBytes) / float64(d.TotalBytes) * 100
+		}
+		out.Disks = append(out.Disks, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = ch.QueryContext(ctx, `
+SELECT table, sum(rows), sum(bytes), sum(parts), max(parts)
+FROM (
+    SELECT table, partition_id, sum(rows) AS rows, sum(bytes_on_disk) AS bytes, count() AS parts
+    FROM system.parts
+    WHERE active AND database = currentDatabase()
+    GROUP BY table, partition_id
+)
+GROUP BY table
+ORDER BY sum(bytes) DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("query system.parts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TableUsage
+		if err := rows.Scan(&t.Table, &t.Rows, &t.BytesOnDisk, &t.ActiveParts, &t.MaxPartsPerPartition); err != nil {
+			return nil, fmt.Errorf("scan system.parts: %w", err)
+		}
+		out.Tables = append(out.Tables, t)
+	}
+	return out, rows.Err()
+}
+
+// storageIncidents returns the incidents usage warrants under cfg.
+func storageIncidents(usage *StorageUsage, cfg *StorageConfig) []SystemIncident {
+	var out []SystemIncident
+	for _, d := range usage.Disks {
+		if d.TotalBytes == 0 || d.UsedPct < cfg.DiskWarnPct {
+			continue
+		}
+		sev, threshold := "warning", cfg.DiskWarnPct
+		if d.UsedPct >= cfg.DiskCriticalPct {
+			sev, threshold = "critical", cfg.DiskCriticalPct
+		}
+		out = append(out, SystemIncident{
+			Key:       "clickhouse_disk:" + d.Name,
+			Source:    StorageSource,
+			Severity:  sev,
+			Title:     fmt.Sprintf("ClickHouse disk %q is %.1f%% full", d.Name, d.UsedPct),
+			Detail:    fmt.Sprintf("%s: %.1f GiB free of %.1f GiB. Lower DATA_RETENTION_DAYS, add storage, or drop old partitions before inserts start failing.", d.Path, gib(d.FreeBytes), gib(d.TotalBytes)),
+			Value:     d.UsedPct,
+			Threshold: threshold,
+		})
+	}
+	for _, t := range usage.Tables {
+		if t.MaxPartsPerPartition < uint64(cfg.PartsWarn) {
+			continue
+		}
+		sev, threshold := "warning", cfg.PartsWarn
+		if t.MaxPartsPerPartition >= uint64(cfg.PartsCritical) {
+			sev, threshold = "critical", cfg.PartsCritical
+		}
+		out = append(out, SystemIncident{
+			Key:       "clickhouse_parts:" + t.Table,
+			Source:    StorageSource,
+			Severity:  sev,
+			Title:     fmt.Sprintf("ClickHouse table %s has %d active parts in one partition", t.Table, t.MaxPartsPerPartition),
+			Detail:    fmt.Sprintf("%d active parts in total. Merges are falling behind inserts; check merge activity and batch insert size (CH_BATCH_SIZE).", t.ActiveParts),
+			Value:     float64(t.MaxPartsPerPartition),
+			Threshold: float64(threshold),
+		})
+	}
+	return out
+}
+
+func gib(b uint64) float64 { return float64(b) / (1 << 30) }
+
+// StorageMonitor periodically checks ClickHouse storage.
+type StorageMonitor struct {
+	db     *gorm.DB
+	ch     *sql.DB
+	config *StorageConfig
+}
+
+// NewStorageMonitor creates a new storage monitor.
+func NewStorageMonitor(db *gorm.DB, ch *sql.DB, config *StorageConfig) *StorageMonitor {
+	return &StorageMonitor{db: db, ch: ch, config: config}
+}
+
+// Config returns the monitor's thresholds.
+func (m *StorageMonitor) Config() *StorageConfig { return m.config }
+
+// Start runs the monitor periodically until ctx is cancelled.
+func (m *StorageMonitor) Start(ctx context.Context) {
+	if !m.config.Enabled || m.ch == nil {
+		log.Info("ClickHouse storage monitor disabled")
+		return
+	}
+	log.Infof("Starting ClickHouse storage monitor (interval: %v, disk warn/critical: %.0f%%/%.0f%%, parts warn/critical: %d/%d)",
+		m.config.Interval, m.config.DiskWarnPct, m.config.DiskCriticalPct, m.config.PartsWarn, m.config.PartsCritical)
+
+	health.Register("storage_monitor", m.config.Interval, 0)
+
+	m.RunOnce(ctx)
+	health.Beat("storage_monitor")
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			health.Stop("storage_monitor")
+			log.Info("ClickHouse storage monitor stopped")
+			return
+		case <-ticker.C:
+			m.RunOnce(ctx)
+			health.Beat("storage_monitor")
+		}
+	}
+}
+
+// RunOnce collects usage, updates metrics and opens or resolves incidents.
+func (m *StorageMonitor) RunOnce(ctx context.Context) (*StorageUsage, error) {
+	usage, err := CollectStorageUsage(ctx, m.ch)
+	if err != nil {
+		log.Errorf("Storage monitor: %v", err)
+		return nil, err
+	}
+
+	if mt := metrics.Get(); mt != nil {
+		for _, d := range usage.Disks {
+			mt.ClickHouseDiskUsedPct.WithLabelValues(d.Name).Set(d.UsedPct)
+		}
+		for _, t := range usage.Tables {
+			mt.ClickHouseMaxParts.WithLabelValues(t.Table).Set(float64(t.MaxPartsPerPartition))
+		}
+	}
+
+	now := time.Now().UTC()
+	active := make(map[string]bool)
+	for _, inc := range storageIncidents(usage, m.config) {
+		active[inc.Key] = true
+		opened, err := RaiseSystemIncident(ctx, m.db, inc, now)
+		if err != nil {
+			log.Errorf("Storage monitor: raise %s: %v", inc.Key, err)
+			continue
+		}
+		if opened {
+			entry := log.WithFields(log.Fields{"key": inc.Key, "value": inc.Value, "threshold": inc.Threshold})
+			if inc.Severity == "critical" {
+				entry.Error(inc.Title)
+			} else {
+				entry.Warn(inc.Title)
+			}
+		}
+	}
+	resolved, err := ResolveSystemIncidents(ctx, m.db, StorageSource, active, now)
+	if err != nil {
+		log.Errorf("Storage monitor: resolve: %v", err)
+	}
+	for _, key := range resolved {
+		log.Infof("Storage monitor: %s back under threshold", key)
+	}
+	return usage, nil
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SystemIncident is a controller-level problem (not tied to a workspace)
+// raised by a background monitor, e.g. ClickHouse running out of disk.
+// One row per Key; a re-raised key reopens its row. Resolved incidents
+// are kept for history.
+type SystemIncident struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Key         string     `gorm:"size:191;uniqueIndex;not null" json:"key"`
+	Source      string     `gorm:"size:64;index" json:"source"`
+	Severity    string     `gorm:"size:16" json:"severity"` // warning, critical
+	Title       string     `gorm:"size:255" json:"title"`
+	Detail      string     `gorm:"type:text" json:"detail"`
+	Value       float64    `json:"value"`
+	Threshold   float64    `json:"threshold"`
+	FirstSeenAt time.Time  `json:"first_seen_at"`
+	LastSeenAt  time.Time  `gorm:"index" json:"last_seen_at"`
+	ResolvedAt  *time.Time `gorm:"index" json:"resolved_at,omitempty"`
+}
+
+func (SystemIncident) TableName() string { return "system_incidents" }
+
+// RaiseSystemIncident opens or refreshes the incident for in.Key. It
+// returns true when the incident is new or was previously resolved, so
+// the caller can log the transition once.
+func RaiseSystemIncident(ctx context.Context, db *gorm.DB, in SystemIncident, now time.Time) (bool, error) {
+	var cur []SystemIncident
+	if err := db.WithContext(ctx).Where("key = ?", in.Key).Limit(1).Find(&cur).Error; err != nil {
+		return false, err
+	}
+	if len(cur) == 0 {
+		in.ID, in.FirstSeenAt, in.LastSeenAt, in.ResolvedAt = 0, now, now, nil
+		return true, db.WithContext(ctx).Create(&in).Error
+	}
+	opened := cur[0].ResolvedAt != nil
+	updates := map[string]any{
+		"source":       in.Source,
+		"severity":     in.Severity,
+		"title":        in.Title,
+		"detail":       in.Detail,
+		"value":        in.Value,
+		"threshold":    in.Threshold,
+		"last_seen_at": now,
+		"resolved_at":  nil,
+	}
+	if opened {
+		updates["first_seen_at"] = now
+	}
+	return opened, db.WithContext(ctx).Model(&SystemIncident{}).Where("id = ?", cur[0].ID).Updates(updates).Error
+}
+
+// ResolveSystemIncidents resolves open incidents from source whose key is
+// not in active. Returns the keys it resolved.
+func ResolveSystemIncidents(ctx context.Context, db *gorm.DB, source string, active map[string]bool, now time.Time) ([]string, error) {
+	var open []SystemIncident
+	if err := db.WithContext(ctx).Where("source = ? AND resolved_at IS NULL", source).Find(&open).Error; err != nil {
+		return nil, err
+	}
+	var resolved []string
+	for _, inc := range open {
+		if active[inc.Key] {
+			continue
+		}
+		if err := db.WithContext(ctx).Model(&SystemIncident{}).Where("id = ?", inc.ID).
+			Update("resolved_at", now).Error; err != nil {
+			return resolved, err
+		}
+		resolved = append(resolved, inc.Key)
+	}
+	return resolved, nil
+}
+
+// ListSystemIncidents returns open incidents, plus resolved ones when
+// includeResolved is set, most recently seen first.
+func ListSystemIncidents(ctx context.Context, db *gorm.DB, includeResolved bool, limit int) ([]SystemIncident, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := db.WithContext(ctx).Model(&SystemIncident{})
+	if !includeResolved {
+		q = q.Where("resolved_at IS NULL")
+	}
+	var out []SystemIncident
+	err := q.Order("last_seen_at DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/workspace"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// WorkspacePurgeConfig holds staged workspace deletion settings.
+type WorkspacePurgeConfig struct {
+	Retention time.Duration // Undo window between disabling and purging a workspace
+	Interval  time.Duration // How often due deletions are purged
+	BatchSize int           // Workspaces purged per run
+}
+
+// LoadWorkspacePurgeConfig loads workspace deletion settings from
+// environment variables.
+func LoadWorkspacePurgeConfig() *WorkspacePurgeConfig {
+	cfg := &WorkspacePurgeConfig{
+		Retention: time.Duration(getEnvInt("WORKSPACE_DELETION_RETENTION_DAYS", 7)) * 24 * time.Hour,
+		Interval:  time.Duration(getEnvInt("WORKSPACE_PURGE_INTERVAL_MINUTES", 15)) * time.Minute,
+		BatchSize: getEnvInt("WORKSPACE_PURGE_BATCH_SIZE", 5),
+	}
+	if cfg.Retention < 0 {
+		cfg.Retention = 0
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 5
+	}
+	return cfg
+}
+
+// WorkspacePurger purges workspaces whose deletion undo window has closed
+// and follows their ClickHouse cleanup to completion (see
+// workspace/teardown.go).
+type WorkspacePurger struct {
+	db            *gorm.DB
+	deletionStore *deletion.QueueStore
+	config        *WorkspacePurgeConfig
+}
+
+// NewWorkspacePurger creates a new workspace purger.
+func NewWorkspacePurger(db *gorm.DB, deletionStore *deletion.QueueStore, config *WorkspacePurgeConfig) *WorkspacePurger {
+	return &WorkspacePurger{db: db, deletionStore: deletionStore, config: config}
+}
+
+// Start runs the purger periodically until ctx is cancelled.
+func (p *WorkspacePurger) Start(ctx context.Context) {
+	log.Infof("Starting workspace purger (interval: %v, retention: %v)", p.config.Interval, p.config.Retention)
+
+	health.Register("workspace_purger", p.config.Interval, 0)
+
+	p.RunOnce(ctx)
+	health.Beat("workspace_purger")
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			health.Stop("workspace_purger")
+			log.Info("Workspace purger stopped")
+			return
+		case <-ticker.C:
+			p.RunOnce(ctx)
+			health.Beat("workspace_purger")
+		}
+	}
+}
+
+// RunOnce purges due workspaces and completes finished teardowns.
+func (p *WorkspacePurger) RunOnce(ctx context.Context) {
+	store := workspace.NewStore(p.db)
+	purged, err := store.PurgeDue(ctx, p.deletionStore, time.Now(), p.config.BatchSize)
+	if err != nil {
+		log.Errorf("Workspace purger: list due deletions failed: %v", err)
+	} else if purged > 0 {
+		log.Infof("Workspace purger: purged %d workspaces", purged)
+	}
+	completed, err := store.TrackPurged(ctx, p.deletionStore)
+	if err != nil {
+		log.Errorf("Workspace purger: track ClickHouse cleanup failed: %v", err)
+	} else if completed > 0 {
+		log.Infof("Workspace purger: completed %d workspace deletions", completed)
+	}
+}
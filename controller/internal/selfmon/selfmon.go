@@ -0,0 +1,334 @@
+// Package selfmon runs synthetic checks of the controller's own
+// dependencies — Postgres and ClickHouse round trips and the depth of its
+// work queues — and records them as PING results of a "controller" agent
+// in an internal workspace. Operators then watch the monitor with the same
+// charts, analysis and alert rules they use for the network.
+//
+// Each dependency is one target of the agent's PING probe. A check's
+// duration is its latency and a failed check is 100% loss. Queue targets
+// ("queue:<name>") carry the depth as the latency in milliseconds, so a
+// latency rule of 500 on "queue:email" fires at 500 pending emails.
+package selfmon
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/admin"
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/email"
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/users"
+	"netwatcher-controller/internal/workspace"
+)
+
+// Check targets.
+const (
+	TargetPostgres         = "postgres"
+	TargetClickHouseInsert = "clickhouse-insert"
+	TargetClickHouseSelect = "clickhouse-select"
+	TargetQueueBatchWriter = "queue:batch_writer"
+	TargetQueueEmail       = "queue:email"
+	TargetQueueDeletion    = "queue:deletion"
+)
+
+// DefaultWorkspaceName is the workspace created when none is configured.
+const DefaultWorkspaceName = "Controller Self-Monitoring"
+
+const agentName = "controller"
+
+// heartbeatDDL is the table the ClickHouse insert check writes to. Rows
+// only exist to be written; a one-day TTL keeps it empty.
+const heartbeatDDL = `
+CREATE TABLE IF NOT EXISTS selfmon_heartbeat
+(
+    at DateTime64(3, 'UTC'),
+    seq UInt64
+)
+ENGINE = MergeTree
+ORDER BY at
+TTL toDateTime(at) + INTERVAL 1 DAY`
+
+// Config controls self-monitoring (env: SELF_MONITOR_*).
+type Config struct {
+	Enabled     bool
+	WorkspaceID uint // 0 = find or create DefaultWorkspaceName
+	Interval    time.Duration
+	Timeout     time.Duration
+	// ClickHouse enables the ClickHouse checks; off for the embedded
+	// SQLite telemetry store.
+	ClickHouse bool
+}
+
+// LoadConfig reads the self-monitoring configuration from the environment.
+func LoadConfig() Config {
+	return Config{
+		Enabled:     os.Getenv("SELF_MONITOR_ENABLED") == "true",
+		WorkspaceID: uint(envInt("SELF_MONITOR_WORKSPACE_ID", 0)),
+		Interval:    time.Duration(max(envInt("SELF_MONITOR_INTERVAL_SEC", 60), 10)) * time.Second,
+		Timeout:     time.Duration(max(envInt("SELF_MONITOR_TIMEOUT_SEC", 10), 1)) * time.Second,
+	}
+}
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return n
+	}
+	return def
+}
+
+// Monitor runs the checks and records their results.
+type Monitor struct {
+	db  *gorm.DB
+	ch  *sql.DB
+	cfg Config
+
+	workspaceID uint
+	agentID     uint
+	probeID     uint
+	seq         uint64
+}
+
+// New returns a monitor; call Start to seed and run it.
+func New(db *gorm.DB, ch *sql.DB, cfg Config) *Monitor {
+	return &Monitor{db: db, ch: ch, cfg: cfg}
+}
+
+// Start seeds the workspace, agent and probe, then runs one round of
+// checks per interval until ctx is done.
+func (m *Monitor) Start(ctx context.Context) {
+	if err := m.seed(ctx); err != nil {
+		log.WithError(err).Error("[selfmon] seeding failed; self-monitoring disabled")
+		return
+	}
+	log.Infof("[selfmon] recording controller checks every %s in workspace %d (agent %d)", m.cfg.Interval, m.workspaceID, m.agentID)
+
+	health.Register("selfmon", m.cfg.Interval, 0)
+	defer health.Stop("selfmon")
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		m.tick(ctx, time.Now().UTC())
+		health.Beat("selfmon")
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// seed resolves the workspace and finds or creates the controller agent
+// and its PING probe, whose targets are the enabled checks.
+func (m *Monitor) seed(ctx context.Context) error {
+	wsID, err := m.resolveWorkspace(ctx)
+	if err != nil {
+		return err
+	}
+	m.workspaceID = wsID
+
+	var a agent.Agent
+	if err := m.db.WithContext(ctx).Where("workspace_id = ? AND name = ?", wsID, agentName).Limit(1).Find(&a).Error; err != nil {
+		return err
+	}
+	if a.ID == 0 {
+		out, err := agent.CreateAgent(ctx, m.db, agent.CreateInput{
+			WorkspaceID: wsID,
+			Name:        agentName,
+			Description: "Synthetic checks of the controller's own dependencies",
+			Version:     "self-monitor",
+			Metadata:    datatypes.JSON(`{"selfmon":true}`),
+		})
+		if err != nil {
+			return fmt.Errorf("create agent: %w", err)
+		}
+		a = *out.Agent
+	}
+	if err := m.db.WithContext(ctx).Model(&agent.Agent{}).Where("id = ?", a.ID).
+		Updates(map[string]any{"initialized": true}).Error; err != nil {
+		return err
+	}
+	m.agentID = a.ID
+
+	var existing probe.Probe
+	if err := m.db.WithContext(ctx).Where("agent_id = ? AND type = ?", a.ID, probe.TypePing).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if existing.ID != 0 {
+		m.probeID = existing.ID
+	} else {
+		p, err := probe.Create(ctx, m.db, probe.CreateInput{
+			WorkspaceID: wsID,
+			AgentID:     a.ID,
+			Type:        probe.TypePing,
+			Enabled:     true,
+			IntervalSec: int(m.cfg.Interval / time.Second),
+			Targets:     m.targets(),
+		})
+		if err != nil {
+			return fmt.Errorf("create probe: %w", err)
+		}
+		m.probeID = p.ID
+	}
+
+	if m.cfg.ClickHouse && m.ch != nil {
+		if _, err := m.ch.ExecContext(ctx, heartbeatDDL); err != nil {
+			return fmt.Errorf("create selfmon_heartbeat: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveWorkspace returns the configured workspace, or finds or creates
+// DefaultWorkspaceName owned by the earliest site admin.
+func (m *Monitor) resolveWorkspace(ctx context.Context) (uint, error) {
+	store := workspace.NewStore(m.db)
+	if m.cfg.WorkspaceID != 0 {
+		ws, err := store.GetWorkspace(ctx, m.cfg.WorkspaceID)
+		if err != nil {
+			return 0, fmt.Errorf("workspace %d: %w", m.cfg.WorkspaceID, err)
+		}
+		return ws.ID, nil
+	}
+	ws, err := store.GetWorkspaceByName(ctx, DefaultWorkspaceName)
+	if err == nil {
+		return ws.ID, nil
+	}
+	if !errors.Is(err, workspace.ErrNotFound) {
+		return 0, err
+	}
+	var owner users.User
+	if err := m.db.WithContext(ctx).Where("role = ?", admin.SiteAdminRole).Order("id").Limit(1).Find(&owner).Error; err != nil {
+		return 0, err
+	}
+	if owner.ID == 0 {
+		return 0, errors.New("no site admin to own the self-monitoring workspace; set SELF_MONITOR_WORKSPACE_ID")
+	}
+	ws, err = store.CreateWorkspace(ctx, workspace.CreateWorkspaceInput{
+		Name:        DefaultWorkspaceName,
+		OwnerID:     owner.ID,
+		Description: "Controller health checks (Postgres, ClickHouse, queues)",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create workspace: %w", err)
+	}
+	return ws.ID, nil
+}
+
+// targets lists the enabled checks.
+func (m *Monitor) targets() []string {
+	out := []string{TargetPostgres}
+	if m.cfg.ClickHouse && m.ch != nil {
+		out = append(out, TargetClickHouseInsert, TargetClickHouseSelect)
+	}
+	return append(out, TargetQueueBatchWriter, TargetQueueEmail, TargetQueueDeletion)
+}
+
+// tick runs every check once and dispatches the results.
+func (m *Monitor) tick(ctx context.Context, at time.Time) {
+	if err := m.db.WithContext(ctx).Model(&agent.Agent{}).Where("id = ?", m.agentID).
+		Update("last_seen_at", at).Error; err != nil {
+		log.WithError(err).Warn("[selfmon] agent heartbeat")
+	}
+	for _, target := range m.targets() {
+		var payload probe.PingPayload
+		if strings.HasPrefix(target, "queue:") {
+			depth, err := m.queueDepth(ctx, target)
+			payload = queuePayload(target, at, depth, err)
+		} else {
+			d, err := m.timeCheck(ctx, target)
+			payload = checkPayload(target, at, d, err)
+		}
+		raw, _ := json.Marshal(payload)
+		data := probe.ProbeData{
+			ProbeID: m.probeID, ProbeAgentID: m.agentID, AgentID: m.agentID, WorkspaceID: m.workspaceID,
+			Type: probe.TypePing, CreatedAt: at, ReceivedAt: at, Target: target, Payload: raw,
+		}
+		if err := probe.Dispatch(ctx, data); err != nil {
+			log.WithError(err).Warnf("[selfmon] dispatch %s", target)
+		}
+	}
+}
+
+// timeCheck runs one dependency round trip and returns how long it took.
+func (m *Monitor) timeCheck(ctx context.Context, target string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	var err error
+	switch target {
+	case TargetPostgres:
+		var one int
+		err = m.db.WithContext(ctx).Raw("SELECT 1").Scan(&one).Error
+	case TargetClickHouseInsert:
+		m.seq++
+		_, err = m.ch.ExecContext(ctx, `INSERT INTO selfmon_heartbeat (at, seq) VALUES (?, ?)`, time.Now().UTC(), m.seq)
+	case TargetClickHouseSelect:
+		// A representative read: recent rows from the ingest table.
+		var n uint64
+		err = m.ch.QueryRowContext(ctx, `SELECT count() FROM probe_data WHERE created_at >= now() - INTERVAL 5 MINUTE`).Scan(&n)
+	default:
+		err = fmt.Errorf("unknown check %q", target)
+	}
+	return time.Since(start), err
+}
+
+// queueDepth returns the number of items waiting in a work queue.
+func (m *Monitor) queueDepth(ctx context.Context, target string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+	defer cancel()
+	var n int64
+	switch target {
+	case TargetQueueBatchWriter:
+		queued, _, ok := probe.BatchWriterBacklog()
+		if !ok {
+			return 0, errors.New("batch writer not running")
+		}
+		return int64(queued), nil
+	case TargetQueueEmail:
+		err := m.db.WithContext(ctx).Model(&email.EmailQueue{}).Where("status = ?", email.StatusPending).Count(&n).Error
+		return n, err
+	case TargetQueueDeletion:
+		err := m.db.WithContext(ctx).Model(&deletion.DeletionJob{}).
+			Where("status IN ?", []string{deletion.StatusPending, deletion.StatusProcessing}).Count(&n).Error
+		return n, err
+	}
+	return 0, fmt.Errorf("unknown queue %q", target)
+}
+
+// checkPayload records a check of duration d as one PING packet: answered
+// in d, or lost when the check failed.
+func checkPayload(target string, at time.Time, d time.Duration, err error) probe.PingPayload {
+	p := probe.PingPayload{
+		StartTimestamp: at,
+		StopTimestamp:  at.Add(d),
+		PacketsSent:    1,
+		Addr:           target,
+	}
+	if err != nil {
+		log.WithError(err).Warnf("[selfmon] %s check failed", target)
+		p.PacketLoss = 100
+		return p
+	}
+	p.PacketsRecv = 1
+	p.MinRtt, p.MaxRtt, p.AvgRtt = d, d, d
+	return p
+}
+
+// queuePayload records a queue depth as the latency in milliseconds.
+func queuePayload(target string, at time.Time, depth int64, err error) probe.PingPayload {
+	return checkPayload(target, at, time.Duration(depth)*time.Millisecond, err)
+}
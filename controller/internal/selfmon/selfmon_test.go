@@ -0,0 +1,30 @@
+package selfmon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPayloads(t *testing.T) {
+	at := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	ok := checkPayload(TargetPostgres, at, 12*time.Millisecond, nil)
+	if ok.PacketLoss != 0 || ok.PacketsRecv != 1 || ok.AvgRtt != 12*time.Millisecond {
+		t.Errorf("successful check = %+v", ok)
+	}
+	failed := checkPayload(TargetClickHouseInsert, at, 10*time.Second, errors.New("timeout"))
+	if failed.PacketLoss != 100 || failed.PacketsRecv != 0 || failed.AvgRtt != 0 {
+		t.Errorf("failed check = %+v", failed)
+	}
+	if q := queuePayload(TargetQueueEmail, at, 250, nil); q.AvgRtt != 250*time.Millisecond || q.Addr != TargetQueueEmail {
+		t.Errorf("queue depth = %+v, want 250ms", q)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	m := &Monitor{}
+	if got := m.targets(); len(got) != 4 || got[0] != TargetPostgres {
+		t.Errorf("without ClickHouse = %v", got)
+	}
+}
@@ -0,0 +1,349 @@
+// Package settings lets site admins change selected environment settings
+// at runtime. Each setting is keyed by its environment variable; an
+// override stored in Postgres takes precedence over the environment, and
+// removing it falls back to the environment (then the subsystem's built-in
+// default) again.
+//
+// Subsystems read settings through Getenv instead of os.Getenv, and
+// register a callback with Subscribe to re-read their configuration when
+// one of their keys changes. Changes made through another controller
+// replica are picked up by Watch.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownSetting = errors.New("unknown setting")
+	ErrInvalidValue   = errors.New("invalid setting value")
+)
+
+// Kind is a setting's value type.
+type Kind string
+
+const (
+	KindInt    Kind = "int"
+	KindString Kind = "string"
+)
+
+// Setting describes one runtime-adjustable setting.
+type Setting struct {
+	Key         string   `json:"key"` // environment variable name
+	Subsystem   string   `json:"subsystem"`
+	Description string   `json:"description"`
+	Kind        Kind     `json:"kind"`
+	Min         int64    `json:"min,omitempty"`
+	Max         int64    `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"` // allowed string values
+	Secret      bool     `json:"secret,omitempty"`  // value is never returned
+}
+
+var registry = []Setting{
+	{Key: "BATCH_WRITER_SIZE", Subsystem: "batch_writer", Kind: KindInt, Min: 1, Max: 10000, Description: "Rows per ClickHouse insert (default 50)"},
+	{Key: "BATCH_WRITER_FLUSH_MS", Subsystem: "batch_writer", Kind: KindInt, Min: 100, Max: 60000, Description: "Milliseconds between flushes of a partial batch (default 2000)"},
+
+	{Key: "ANALYSIS_INTERVAL", Subsystem: "analysis", Kind: KindInt, Min: 30, Max: 86400, Description: "Seconds between background workspace analyses (default 300)"},
+	{Key: "ANALYSIS_MAX_CONCURRENT", Subsystem: "analysis", Kind: KindInt, Min: 1, Max: 1024, Description: "Workspaces analysed in parallel (default 4 × GOMAXPROCS)"},
+	{Key: "ANALYSIS_TRIGGER_LOSS_PCT", Subsystem: "analysis", Kind: KindInt, Min: 0, Max: 100, Description: "Packet loss (%) at which a result that follows a healthier one triggers an immediate analysis; 0 disables (default 50)"},
+	{Key: "ANALYSIS_TRIGGER_SILENCE_MINUTES", Subsystem: "analysis", Kind: KindInt, Min: 0, Max: 1440, Description: "Minutes without results after which an agent's next result triggers an immediate analysis; 0 disables (default 10)"},
+	{Key: "ANALYSIS_TRIGGER_DELAY_SECONDS", Subsystem: "analysis", Kind: KindInt, Min: 0, Max: 300, Description: "Seconds a triggered analysis waits to collect related results (default 5)"},
+	{Key: "ANALYSIS_TRIGGER_COOLDOWN_SECONDS", Subsystem: "analysis", Kind: KindInt, Min: 0, Max: 3600, Description: "Minimum seconds between triggered analyses of one workspace (default 60)"},
+	{Key: "ANALYSIS_TIME_BUDGET_SECONDS", Subsystem: "analysis", Kind: KindInt, Min: 1, Max: 600, Description: "Time budget for one workspace analysis's queries; the rest is marked partial (default 20)"},
+	{Key: "INCIDENT_STABILIZATION_MINUTES", Subsystem: "analysis", Kind: KindInt, Min: 0, Max: 1440, Description: "Minutes an incident must stay clear before it auto-resolves and recovery is notified (default 0)"},
+	{Key: "DATA_FRESHNESS_STALE_MINUTES", Subsystem: "analysis", Kind: KindInt, Min: 1, Max: 1440, Description: "Ingest lag after which responses are marked degraded (default 10)"},
+
+	{Key: "DATA_RETENTION_DAYS", Subsystem: "retention", Kind: KindInt, Min: 1, Max: 3650, Description: "Days of probe data kept in ClickHouse (default 90)"},
+	{Key: "SOFT_DELETE_GRACE_DAYS", Subsystem: "retention", Kind: KindInt, Min: 0, Max: 3650, Description: "Days before soft-deleted agents and probes are purged (default 30)"},
+	{Key: "CLEANUP_INTERVAL_HOURS", Subsystem: "retention", Kind: KindInt, Min: 1, Max: 720, Description: "Hours between cleanup runs (default 24)"},
+
+	{Key: "OFFLINE_CHECK_INTERVAL_MINUTES", Subsystem: "scheduler", Kind: KindInt, Min: 1, Max: 1440, Description: "Minutes between agent-offline alert checks (default 1)"},
+
+	{Key: "LLM_PROVIDER", Subsystem: "llm", Kind: KindString, Options: []string{"", "openai", "ollama", "openai+ollama"}, Description: "LLM provider for analysis summaries; empty disables"},
+	{Key: "LLM_MODEL", Subsystem: "llm", Kind: KindString, Description: "OpenAI-compatible model (default gpt-4o-mini)"},
+	{Key: "LLM_API_URL", Subsystem: "llm", Kind: KindString, Description: "OpenAI-compatible API endpoint"},
+	{Key: "LLM_API_KEY", Subsystem: "llm", Kind: KindString, Secret: true, Description: "OpenAI-compatible API key"},
+	{Key: "OLLAMA_URL", Subsystem: "llm", Kind: KindString, Description: "Ollama endpoint"},
+	{Key: "OLLAMA_MODEL", Subsystem: "llm", Kind: KindString, Description: "Ollama model (default llama3.2)"},
+	{Key: "LLM_MAX_TOKENS", Subsystem: "llm", Kind: KindInt, Min: 16, Max: 32768, Description: "Max tokens per summary (default 512)"},
+	{Key: "LLM_WORKSPACE_MONTHLY_TOKENS", Subsystem: "llm", Kind: KindInt, Min: 0, Max: 1 << 40, Description: "Default monthly token budget per workspace; 0 = unlimited"},
+}
+
+// Settings returns every runtime-adjustable setting.
+func Settings() []Setting {
+	out := make([]Setting, len(registry))
+	copy(out, registry)
+	return out
+}
+
+func lookup(key string) (Setting, bool) {
+	for _, s := range registry {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Validate checks a value for a setting and returns it normalised.
+func Validate(key, value string) (string, error) {
+	s, ok := lookup(key)
+	if !ok {
+		return "", ErrUnknownSetting
+	}
+	value = strings.TrimSpace(value)
+	switch s.Kind {
+	case KindInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s must be an integer", ErrInvalidValue, key)
+		}
+		if n < s.Min || n > s.Max {
+			return "", fmt.Errorf("%w: %s must be between %d and %d", ErrInvalidValue, key, s.Min, s.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case KindString:
+		if len(s.Options) > 0 {
+			for _, o := range s.Options {
+				if value == o {
+					return value, nil
+				}
+			}
+			return "", fmt.Errorf("%w: %s must be one of %q", ErrInvalidValue, key, s.Options)
+		}
+	}
+	return value, nil
+}
+
+// Override is a stored setting value.
+type Override struct {
+	Key       string    `gorm:"primaryKey;size:64" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedBy uint      `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Override) TableName() string { return "controller_settings" }
+
+// Value sources reported by List.
+const (
+	SourceOverride = "override"
+	SourceEnv      = "env"
+	SourceDefault  = "default"
+)
+
+// State is a setting's effective value.
+type State struct {
+	Setting
+	Value     string     `json:"value"` // empty for secrets and built-in defaults
+	Source    string     `json:"source"`
+	UpdatedBy uint       `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// secretMask replaces secret values in List.
+const secretMask = "********"
+
+type subscription struct {
+	keys map[string]bool
+	fn   func()
+}
+
+// Store holds the current overrides and notifies subscribers when the
+// effective value of one of their keys changes.
+type Store struct {
+	db *gorm.DB
+
+	mu        sync.RWMutex
+	overrides map[string]Override
+
+	subMu sync.Mutex
+	subs  []subscription
+}
+
+var (
+	defaultStore   *Store
+	defaultStoreMu sync.Mutex
+)
+
+// Default returns the process-wide store used by Getenv, creating it and
+// loading the stored overrides on first use. main calls it at startup.
+func Default(db *gorm.DB) *Store {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+	if defaultStore == nil {
+		defaultStore = NewStore(db)
+		if err := defaultStore.Load(context.Background()); err != nil {
+			log.WithError(err).Warn("[settings] loading overrides failed; using the environment")
+		}
+	}
+	return defaultStore
+}
+
+// NewStore returns a store with no overrides loaded.
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db, overrides: make(map[string]Override)}
+}
+
+// Getenv returns the override for key if one is stored, else the
+// environment variable. Before Default is called it is os.Getenv.
+func Getenv(key string) string {
+	defaultStoreMu.Lock()
+	s := defaultStore
+	defaultStoreMu.Unlock()
+	if s == nil {
+		return os.Getenv(key)
+	}
+	return s.Getenv(key)
+}
+
+// Getenv returns the override for key if one is stored, else the
+// environment variable.
+func (s *Store) Getenv(key string) string {
+	s.mu.RLock()
+	o, ok := s.overrides[key]
+	s.mu.RUnlock()
+	if ok {
+		return o.Value
+	}
+	return os.Getenv(key)
+}
+
+// List returns every setting's effective value. Secret values are masked.
+func (s *Store) List() []State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]State, 0, len(registry))
+	for _, st := range registry {
+		state := State{Setting: st, Source: SourceDefault}
+		if o, ok := s.overrides[st.Key]; ok {
+			at := o.UpdatedAt
+			state.Value, state.Source, state.UpdatedBy, state.UpdatedAt = o.Value, SourceOverride, o.UpdatedBy, &at
+		} else if v, ok := os.LookupEnv(st.Key); ok {
+			state.Value, state.Source = v, SourceEnv
+		}
+		if st.Secret && state.Value != "" {
+			state.Value = secretMask
+		}
+		out = append(out, state)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Subsystem < out[j].Subsystem })
+	return out
+}
+
+// Set stores an override and notifies subscribers.
+func (s *Store) Set(ctx context.Context, key, value string, userID uint) error {
+	v, err := Validate(key, value)
+	if err != nil {
+		return err
+	}
+	row := Override{Key: key, Value: v, UpdatedBy: userID, UpdatedAt: time.Now().UTC()}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		return err
+	}
+	return s.Load(ctx)
+}
+
+// Reset removes an override so the environment applies again, and
+// notifies subscribers.
+func (s *Store) Reset(ctx context.Context, key string) error {
+	if _, ok := lookup(key); !ok {
+		return ErrUnknownSetting
+	}
+	if err := s.db.WithContext(ctx).Where("key = ?", key).Delete(&Override{}).Error; err != nil {
+		return err
+	}
+	return s.Load(ctx)
+}
+
+// Subscribe calls fn after the effective value of any of keys changes.
+// Callbacks run on the goroutine that made or observed the change, after
+// the new values are visible through Getenv.
+func (s *Store) Subscribe(fn func(), keys ...string) {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	s.subMu.Lock()
+	s.subs = append(s.subs, subscription{keys: set, fn: fn})
+	s.subMu.Unlock()
+}
+
+// Load re-reads the overrides and notifies subscribers of the keys whose
+// value changed.
+func (s *Store) Load(ctx context.Context) error {
+	var rows []Override
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return err
+	}
+	next := make(map[string]Override, len(rows))
+	for _, r := range rows {
+		if _, ok := lookup(r.Key); ok {
+			next[r.Key] = r
+		}
+	}
+
+	s.mu.Lock()
+	var changed []string
+	for _, st := range registry {
+		before, hadBefore := s.overrides[st.Key]
+		after, hasAfter := next[st.Key]
+		if hadBefore != hasAfter || before.Value != after.Value {
+			changed = append(changed, st.Key)
+		}
+	}
+	s.overrides = next
+	s.mu.Unlock()
+
+	if len(changed) > 0 {
+		log.Infof("[settings] changed: %s", strings.Join(changed, ", "))
+		s.notify(changed)
+	}
+	return nil
+}
+
+func (s *Store) notify(changed []string) {
+	s.subMu.Lock()
+	subs := append([]subscription(nil), s.subs...)
+	s.subMu.Unlock()
+	for _, sub := range subs {
+		for _, k := range changed {
+			if sub.keys[k] {
+				sub.fn()
+				break
+			}
+		}
+	}
+}
+
+// Watch reloads the overrides every interval until ctx is done, so
+// changes made through another replica reach this one.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.WithError(err).Warn("[settings] reload failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&Override{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return NewStore(db)
+}
+
+func TestValidate(t *testing.T) {
+	if v, err := Validate("BATCH_WRITER_SIZE", " 200 "); err != nil || v != "200" {
+		t.Errorf("valid int = %q, %v", v, err)
+	}
+	for key, value := range map[string]string{
+		"BATCH_WRITER_SIZE":     "0",
+		"BATCH_WRITER_FLUSH_MS": "fast",
+		"LLM_PROVIDER":          "anthropic",
+	} {
+		if _, err := Validate(key, value); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s=%q: err = %v, want ErrInvalidValue", key, value, err)
+		}
+	}
+	if _, err := Validate("PATH", "/bin"); !errors.Is(err, ErrUnknownSetting) {
+		t.Errorf("unregistered key: err = %v", err)
+	}
+}
+
+// TestOverrideLifecycle verifies overrides win over the environment,
+// subscribers hear only about their keys, secrets are masked and Reset
+// falls back to the environment.
+func TestOverrideLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	t.Setenv("BATCH_WRITER_SIZE", "50")
+	t.Setenv("LLM_API_KEY", "")
+
+	var batch, llm int
+	s.Subscribe(func() { batch++ }, "BATCH_WRITER_SIZE", "BATCH_WRITER_FLUSH_MS")
+	s.Subscribe(func() { llm++ }, "LLM_API_KEY")
+
+	if err := s.Set(ctx, "BATCH_WRITER_SIZE", "500", 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Getenv("BATCH_WRITER_SIZE"); got != "500" {
+		t.Errorf("override = %q", got)
+	}
+	if batch != 1 || llm != 0 {
+		t.Errorf("notifications = %d/%d, want 1/0", batch, llm)
+	}
+	// Storing the same value again is not a change.
+	if err := s.Set(ctx, "BATCH_WRITER_SIZE", "500", 3); err != nil || batch != 1 {
+		t.Errorf("repeat set: batch = %d, err = %v", batch, err)
+	}
+
+	if err := s.Set(ctx, "LLM_API_KEY", "sk-secret", 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range s.List() {
+		switch st.Key {
+		case "LLM_API_KEY":
+			if st.Value != secretMask || st.Source != SourceOverride {
+				t.Errorf("secret state = %+v", st)
+			}
+		case "BATCH_WRITER_SIZE":
+			if st.Value != "500" || st.UpdatedBy != 3 || st.UpdatedAt == nil {
+				t.Errorf("override state = %+v", st)
+			}
+		}
+	}
+
+	if err := s.Reset(ctx, "BATCH_WRITER_SIZE"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Getenv("BATCH_WRITER_SIZE"); got != "50" || batch != 2 {
+		t.Errorf("after reset = %q, notifications %d", got, batch)
+	}
+	if err := s.Reset(ctx, "NOPE"); !errors.Is(err, ErrUnknownSetting) {
+		t.Errorf("reset unknown: err = %v", err)
+	}
+}
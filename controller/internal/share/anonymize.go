@@ -0,0 +1,219 @@
+// internal/share/anonymize.go
+package share
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// -------------------- Anonymization --------------------
+
+// Anonymizer replaces addressing in shared data with stable pseudonyms:
+// the same IP, hostname or ISP always maps to the same pseudonym within
+// one link, so paths and changes stay readable, while two links never
+// share a mapping. A nil Anonymizer leaves everything unchanged.
+//
+// IPs become "private-xxxxxxxx" or "public-xxxxxxxx" (ports are kept),
+// hostnames "host-xxxxxxxx" and ISP / AS names "isp-xxxxxxxx"; AS numbers
+// are zeroed.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer returns an Anonymizer keyed by key.
+func NewAnonymizer(key string) *Anonymizer {
+	return &Anonymizer{key: []byte(key)}
+}
+
+// Anonymizer returns the link's Anonymizer, or nil when the link shares
+// data as-is.
+func (l *ShareLink) Anonymizer() *Anonymizer {
+	if !l.Anonymize || l.AnonymizeKey == "" {
+		return nil
+	}
+	return NewAnonymizer(l.AnonymizeKey)
+}
+
+// Payload keys whose string values are hostnames or ISP names, and whose
+// numeric values are AS numbers. Keys are matched case-insensitively.
+var (
+	anonHostKeys = map[string]bool{
+		"host": true, "hostname": true, "hop_hostname": true, "fqdn": true,
+		"ptr": true, "rdns": true, "reverse_dns": true, "target": true,
+		"domain": true, "sni": true, "server_name": true, "common_name": true,
+		"dns_names": true, "san": true,
+	}
+	anonISPKeys = map[string]bool{
+		"isp": true, "org": true, "organization": true, "asn_org": true,
+		"as_org": true, "as_name": true, "asname": true, "provider": true,
+		"internet_provider": true, "carrier": true,
+	}
+	anonASNKeys = map[string]bool{"asn": true, "as_number": true}
+)
+
+// Addresses embedded in free text (DNS raw responses, error messages,
+// certificate subjects). Candidates are confirmed with net.ParseIP, so
+// times and MAC addresses are left alone.
+var (
+	anonIPv4Text = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	anonIPv6Text = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`)
+	anonHostText = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]*[a-z0-9]\b`)
+)
+
+func (a *Anonymizer) pseudonym(kind, v string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + ":" + strings.ToLower(v)))
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil))[:8]
+}
+
+// splitPort splits "host:port" / "[v6]:port", returning s unchanged with
+// no port otherwise.
+func splitPort(s string) (string, string) {
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		return h, p
+	}
+	return s, ""
+}
+
+func joinPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// IP returns the pseudonym for an IP address (optionally with a port).
+// Non-IP values are treated as hostnames.
+func (a *Anonymizer) IP(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	host, port := splitPort(s)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return a.Host(s)
+	}
+	kind := "public"
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || isCGNAT(ip) {
+		kind = "private"
+	}
+	return joinPort(a.pseudonym(kind, ip.String()), port)
+}
+
+// isCGNAT reports whether ip is in 100.64.0.0/10 (carrier-grade NAT).
+func isCGNAT(ip net.IP) bool {
+	v4 := ip.To4()
+	return v4 != nil && v4[0] == 100 && v4[1]&0xc0 == 64
+}
+
+// Host returns the pseudonym for a hostname or IP (optionally with a
+// port).
+func (a *Anonymizer) Host(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	host, port := splitPort(s)
+	if net.ParseIP(host) != nil {
+		return a.IP(s)
+	}
+	return joinPort(a.pseudonym("host", strings.TrimSuffix(host, ".")), port)
+}
+
+// ISP returns the pseudonym for an ISP or AS organisation name.
+func (a *Anonymizer) ISP(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	return a.pseudonym("isp", s)
+}
+
+// URL replaces the host of a URL and drops any credentials in it.
+func (a *Anonymizer) URL(s string) string {
+	if a == nil || s == "" {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return a.Host(s)
+	}
+	u.User = nil
+	u.Host = a.Host(u.Host)
+	return u.String()
+}
+
+// Payload anonymizes a probe payload: values of known hostname, ISP and
+// AS number keys, URL hosts, and IPs and hostnames inside any other
+// string. Payloads that aren't JSON objects or arrays are returned
+// unchanged.
+func (a *Anonymizer) Payload(raw json.RawMessage) json.RawMessage {
+	if a == nil || len(raw) == 0 {
+		return raw
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(a.walk("", v))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+func (a *Anonymizer) walk(key string, v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, x := range t {
+			t[k] = a.walk(strings.ToLower(k), x)
+		}
+		return t
+	case []any:
+		for i := range t {
+			t[i] = a.walk(key, t[i])
+		}
+		return t
+	case string:
+		switch {
+		case t == "":
+			return t
+		case anonISPKeys[key]:
+			return a.ISP(t)
+		case anonHostKeys[key]:
+			return a.Host(t)
+		case key == "url":
+			return a.URL(t)
+		}
+		if host, _ := splitPort(t); net.ParseIP(host) != nil {
+			return a.IP(t)
+		}
+		return a.text(t)
+	case json.Number:
+		if anonASNKeys[key] {
+			return 0
+		}
+		return t
+	}
+	return v
+}
+
+// text replaces the IPs and hostnames found in free text.
+func (a *Anonymizer) text(s string) string {
+	ip := func(m string) string {
+		if net.ParseIP(m) == nil {
+			return m
+		}
+		return a.IP(m)
+	}
+	s = anonIPv4Text.ReplaceAllStringFunc(s, ip)
+	s = anonIPv6Text.ReplaceAllStringFunc(s, ip)
+	return anonHostText.ReplaceAllStringFunc(s, a.Host)
+}
@@ -0,0 +1,145 @@
+// internal/share/badge.go
+package share
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"netwatcher-controller/internal/workspace"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBadgeNotFound = errors.New("badge not found")
+	ErrInvalidBadge  = errors.New("invalid badge")
+)
+
+// Badge subject kinds.
+const (
+	BadgeKindProbe = "probe"
+	BadgeKindAgent = "agent"
+)
+
+// Badge windows are bounded so one embed cannot trigger an arbitrarily
+// large ClickHouse scan.
+const (
+	DefaultBadgeWindow = 24 * time.Hour
+	MaxBadgeWindow     = 30 * 24 * time.Hour
+)
+
+// -------------------- Badge Model --------------------
+
+// Badge is a long-lived, read-only token that exposes a probe's or agent's
+// aggregated uptime, median latency and health grade for embedding in
+// wikis and dashboards. Unlike share links it never expires; it is revoked
+// by deleting it.
+type Badge struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Token is the unique identifier used in the public badge URL
+	Token string `gorm:"size:64;uniqueIndex:ux_badges_token" json:"token"`
+
+	// Scope: exactly one probe or agent in the workspace
+	WorkspaceID uint   `gorm:"index" json:"workspace_id"`
+	Kind        string `gorm:"size:16" json:"kind"` // probe, agent
+	SubjectID   uint   `json:"subject_id"`
+
+	// Label replaces the subject name on the rendered badge when set
+	Label string `gorm:"size:64" json:"label,omitempty"`
+
+	// WindowMinutes is the aggregation window
+	WindowMinutes int `gorm:"default:1440" json:"window_minutes"`
+
+	CreatedByUserID uint `json:"created_by_user_id"`
+}
+
+func (Badge) TableName() string { return "badges" }
+
+// CreateBadgeInput is the input for creating a badge.
+type CreateBadgeInput struct {
+	WorkspaceID     uint
+	Kind            string
+	SubjectID       uint
+	Label           string
+	Window          time.Duration // 0 = DefaultBadgeWindow
+	CreatedByUserID uint
+}
+
+// CreateBadge creates a badge token. The caller verifies the subject
+// belongs to the workspace.
+func CreateBadge(ctx context.Context, db *gorm.DB, in CreateBadgeInput) (*Badge, error) {
+	if (in.Kind != BadgeKindProbe && in.Kind != BadgeKindAgent) || in.SubjectID == 0 ||
+		in.Window < 0 || in.Window > MaxBadgeWindow || len(in.Label) > 64 {
+		return nil, ErrInvalidBadge
+	}
+	window := in.Window
+	if window == 0 {
+		window = DefaultBadgeWindow
+	}
+
+	token, err := GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	b := &Badge{
+		Token:           token,
+		WorkspaceID:     in.WorkspaceID,
+		Kind:            in.Kind,
+		SubjectID:       in.SubjectID,
+		Label:           in.Label,
+		WindowMinutes:   int(window / time.Minute),
+		CreatedByUserID: in.CreatedByUserID,
+	}
+	if b.WindowMinutes < 1 {
+		b.WindowMinutes = 1
+	}
+	if err := db.WithContext(ctx).Create(b).Error; err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBadgeByToken retrieves a badge by its token. Badges of a workspace
+// disabled pending deletion are not found.
+func GetBadgeByToken(ctx context.Context, db *gorm.DB, token string) (*Badge, error) {
+	var b Badge
+	err := db.WithContext(ctx).Where("token = ?", token).First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBadgeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if workspace.IsDisabled(ctx, db, b.WorkspaceID) {
+		return nil, ErrBadgeNotFound
+	}
+	return &b, nil
+}
+
+// ListBadges returns all badges in a workspace.
+func ListBadges(ctx context.Context, db *gorm.DB, workspaceID uint) ([]Badge, error) {
+	var badges []Badge
+	err := db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("created_at DESC").
+		Find(&badges).Error
+	return badges, err
+}
+
+// DeleteBadge revokes a badge by ID.
+func DeleteBadge(ctx context.Context, db *gorm.DB, workspaceID, badgeID uint) error {
+	result := db.WithContext(ctx).
+		Where("id = ? AND workspace_id = ?", badgeID, workspaceID).
+		Delete(&Badge{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBadgeNotFound
+	}
+	return nil
+}
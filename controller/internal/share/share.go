@@ -8,6 +8,8 @@ import (
 	"errors"
 	"time"
 
+	"netwatcher-controller/internal/workspace"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -19,6 +21,8 @@ var (
 	ErrShareLinkExpired  = errors.New("share link has expired")
 	ErrInvalidPassword   = errors.New("invalid password")
 	ErrPasswordRequired  = errors.New("password required")
+	ErrInvalidDataWindow = errors.New("invalid data window")
+	ErrOutsideDataWindow = errors.New("requested range is outside the shared data window")
 )
 
 // -------------------- ShareLink Model --------------------
@@ -52,6 +56,19 @@ type ShareLink struct {
 
 	// Computed: speedtest allowed only for short-term shares (<24h expiry)
 	AllowSpeedtest bool `gorm:"-" json:"allow_speedtest"`
+
+	// Optional probe data time-window restrictions. DataWindowSeconds is a
+	// rolling limit ("only the last 24h"); DataFrom/DataTo pin a fixed
+	// window, e.g. one incident. Both may be combined; zero values mean
+	// unrestricted.
+	DataWindowSeconds int        `gorm:"default:0" json:"data_window_seconds,omitempty"`
+	DataFrom          *time.Time `json:"data_from,omitempty"`
+	DataTo            *time.Time `json:"data_to,omitempty"`
+
+	// Anonymize replaces IPs, hostnames and ISP names in returned data with
+	// stable pseudonyms keyed by AnonymizeKey (see anonymize.go).
+	Anonymize    bool   `gorm:"default:false" json:"anonymize"`
+	AnonymizeKey string `gorm:"size:64" json:"-"`
 }
 
 func (ShareLink) TableName() string { return "share_links" }
@@ -65,6 +82,14 @@ type CreateInput struct {
 	CreatedByUserID uint
 	ExpiresIn       time.Duration // How long until expiration
 	Password        string        // Optional plaintext password
+
+	// Optional data window (see ShareLink.DataWindowSeconds/DataFrom/DataTo)
+	DataWindow time.Duration
+	DataFrom   *time.Time
+	DataTo     *time.Time
+
+	// Anonymize shares data with pseudonymized addressing.
+	Anonymize bool
 }
 
 // CreateOutput is returned after successful creation.
@@ -92,6 +117,10 @@ func GenerateToken() (string, error) {
 
 // Create creates a new share link for an agent.
 func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*CreateOutput, error) {
+	if in.DataWindow < 0 || (in.DataFrom != nil && in.DataTo != nil && !in.DataFrom.Before(*in.DataTo)) {
+		return nil, ErrInvalidDataWindow
+	}
+
 	token, err := GenerateToken()
 	if err != nil {
 		return nil, err
@@ -103,6 +132,19 @@ func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*CreateOutput, er
 		AgentID:         in.AgentID,
 		CreatedByUserID: in.CreatedByUserID,
 		ExpiresAt:       time.Now().Add(in.ExpiresIn),
+		DataFrom:        in.DataFrom,
+		DataTo:          in.DataTo,
+	}
+	if in.DataWindow > 0 {
+		link.DataWindowSeconds = int(in.DataWindow / time.Second)
+	}
+	if in.Anonymize {
+		// A per-link key keeps pseudonyms from being correlated across links.
+		key, err := GenerateToken()
+		if err != nil {
+			return nil, err
+		}
+		link.Anonymize, link.AnonymizeKey = true, key
 	}
 
 	// Hash password if provided
@@ -128,6 +170,7 @@ func Create(ctx context.Context, db *gorm.DB, in CreateInput) (*CreateOutput, er
 }
 
 // GetByToken retrieves a share link by its token without validation.
+// Links of a workspace disabled pending deletion are not found.
 func GetByToken(ctx context.Context, db *gorm.DB, token string) (*ShareLink, error) {
 	var link ShareLink
 	err := db.WithContext(ctx).Where("token = ?", token).First(&link).Error
@@ -137,6 +180,9 @@ func GetByToken(ctx context.Context, db *gorm.DB, token string) (*ShareLink, err
 	if err != nil {
 		return nil, err
 	}
+	if workspace.IsDisabled(ctx, db, link.WorkspaceID) {
+		return nil, ErrShareLinkNotFound
+	}
 
 	link.HasPassword = link.PasswordHash != ""
 	link.AllowSpeedtest = false // Never allow speedtest on shared pages
@@ -169,6 +215,44 @@ func Validate(ctx context.Context, db *gorm.DB, in ValidateInput) (*ShareLink, e
 	return link, nil
 }
 
+// HasDataWindow reports whether the link restricts probe data by time.
+func (l *ShareLink) HasDataWindow() bool {
+	return l.DataWindowSeconds > 0 || l.DataFrom != nil || l.DataTo != nil
+}
+
+// AllowsLiveData reports whether live streaming is within the window —
+// false once a fixed window has closed.
+func (l *ShareLink) AllowsLiveData(now time.Time) bool {
+	return l.DataTo == nil || now.Before(*l.DataTo)
+}
+
+// ClampRange narrows a requested [from, to] range (zero = open-ended) to
+// the link's data window. It returns ErrOutsideDataWindow when nothing of
+// the request falls inside the window.
+func (l *ShareLink) ClampRange(from, to, now time.Time) (time.Time, time.Time, error) {
+	var lo, hi time.Time
+	if l.DataWindowSeconds > 0 {
+		lo = now.Add(-time.Duration(l.DataWindowSeconds) * time.Second)
+	}
+	if l.DataFrom != nil && l.DataFrom.After(lo) {
+		lo = *l.DataFrom
+	}
+	if l.DataTo != nil {
+		hi = *l.DataTo
+	}
+
+	if !lo.IsZero() && (from.IsZero() || from.Before(lo)) {
+		from = lo
+	}
+	if !hi.IsZero() && (to.IsZero() || to.After(hi)) {
+		to = hi
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return time.Time{}, time.Time{}, ErrOutsideDataWindow
+	}
+	return from, to, nil
+}
+
 // RecordAccess increments the access count and updates last accessed time.
 func RecordAccess(ctx context.Context, db *gorm.DB, linkID uint) error {
 	now := time.Now()
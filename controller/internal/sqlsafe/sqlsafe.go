@@ -0,0 +1,79 @@
+// Package sqlsafe holds the shared helpers for building Postgres queries
+// from user input, and an optional audit of raw-SQL execution paths.
+//
+// Values always go through GORM placeholders; these helpers cover the two
+// places where placeholders alone are not enough:
+//
+//   - LIKE patterns, where user-supplied % and _ would otherwise act as
+//     wildcards (and a lone "%" scans the whole table), and
+//   - identifiers (column names), which cannot be bound and must be
+//     checked against a strict pattern before being interpolated.
+//
+// Set SQL_AUDIT_RAW=true to log every Raw / Exec statement with the Go
+// caller that issued it, to review which code paths bypass the builder.
+package sqlsafe
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MaxSearchLen caps free-text search input; longer input is truncated.
+const MaxSearchLen = 200
+
+var ErrBadIdentifier = errors.New("invalid SQL identifier")
+
+// identRE matches column or table.column names.
+var identRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Ident validates a column or table.column name for interpolation.
+func Ident(name string) error {
+	if !identRE.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrBadIdentifier, name)
+	}
+	return nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes LIKE metacharacters so s matches literally. Use with
+// ESCAPE '\'.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// ContainsPattern returns a lower-cased, escaped "%s%" pattern for a
+// case-insensitive substring match, with input capped at MaxSearchLen.
+func ContainsPattern(q string) string {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if len(q) > MaxSearchLen {
+		q = q[:MaxSearchLen]
+	}
+	return "%" + EscapeLike(q) + "%"
+}
+
+// Search adds a case-insensitive substring filter on any of columns.
+// Empty q leaves tx unchanged. An invalid column name is a programming
+// error and is added to tx so the query fails instead of running
+// unfiltered.
+func Search(tx *gorm.DB, q string, columns ...string) *gorm.DB {
+	if strings.TrimSpace(q) == "" || len(columns) == 0 {
+		return tx
+	}
+	pat := ContainsPattern(q)
+	clauses := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, col := range columns {
+		if err := Ident(col); err != nil {
+			_ = tx.AddError(err)
+			return tx
+		}
+		clauses[i] = "LOWER(" + col + `) LIKE ? ESCAPE '\'`
+		args[i] = pat
+	}
+	return tx.Where("("+strings.Join(clauses, " OR ")+")", args...)
+}
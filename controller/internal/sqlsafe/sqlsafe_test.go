@@ -0,0 +1,149 @@
+package sqlsafe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type row struct {
+	ID    uint
+	Name  string
+	Email string
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	seed := []row{
+		{Name: "alice", Email: "alice@example.com"},
+		{Name: "bob_smith", Email: "bob@example.com"},
+		{Name: "100% uptime", Email: "carol@example.com"},
+		{Name: `back\slash`, Email: "dave@example.com"},
+	}
+	if err := db.Create(&seed).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db
+}
+
+// TestSearchMaliciousInput runs injection and wildcard payloads through
+// Search and checks they match literally and leave the table intact.
+func TestSearchMaliciousInput(t *testing.T) {
+	db := newTestDB(t)
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"ALICE", []string{"alice"}},
+		{"%", []string{"100% uptime"}},
+		{"_", []string{"bob_smith"}},
+		{`\`, []string{`back\slash`}},
+		{"' OR '1'='1", nil},
+		{"'; DROP TABLE rows; --", nil},
+		{`%' OR 1=1 --`, nil},
+		{"a%e", nil}, // would match "alice" if % were a wildcard
+		{strings.Repeat("x", 5000), nil},
+	}
+	for _, tc := range cases {
+		var got []row
+		if err := Search(db.Model(&row{}), tc.q, "name", "email").Order("id").Find(&got).Error; err != nil {
+			t.Fatalf("q=%q: %v", tc.q, err)
+		}
+		var names []string
+		for _, r := range got {
+			names = append(names, r.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("q=%q: got %v, want %v", tc.q, names, tc.want)
+		}
+	}
+	var n int64
+	if err := db.Model(&row{}).Count(&n).Error; err != nil || n != 4 {
+		t.Fatalf("table damaged: count=%d err=%v", n, err)
+	}
+}
+
+func TestSearchRejectsBadColumn(t *testing.T) {
+	db := newTestDB(t)
+	var got []row
+	err := Search(db.Model(&row{}), "alice", "name) OR 1=1 --").Find(&got).Error
+	if !errors.Is(err, ErrBadIdentifier) {
+		t.Errorf("err = %v, want ErrBadIdentifier", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("query ran unfiltered: %v", got)
+	}
+}
+
+func TestIdent(t *testing.T) {
+	for _, ok := range []string{"name", "users.email", "_x1"} {
+		if Ident(ok) != nil {
+			t.Errorf("Ident(%q) rejected", ok)
+		}
+	}
+	for _, bad := range []string{"", "1name", "name;", "a.b.c", "name--", "LOWER(name)", "na me"} {
+		if Ident(bad) == nil {
+			t.Errorf("Ident(%q) accepted", bad)
+		}
+	}
+}
+
+// TestAuditLogsRawOnly verifies raw SQL is logged with its Go caller and
+// builder queries are not.
+func TestAuditLogsRawOnly(t *testing.T) {
+	db := newTestDB(t)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	if err := RegisterAudit(db); err != nil {
+		t.Fatal(err)
+	}
+	hook.Reset()
+
+	var rows []row
+	if err := db.Where("name = ?", "alice").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE rows SET email = ? WHERE id = ?", "x@example.com", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.Raw("SELECT COUNT(*) FROM rows").Scan(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var audited []*log.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "[sql-audit] raw SQL" {
+			audited = append(audited, e)
+		}
+	}
+	if len(audited) != 2 {
+		t.Fatalf("expected 2 audit entries (exec + raw), got %d", len(audited))
+	}
+	for _, e := range audited {
+		c, _ := e.Data["caller"].(string)
+		if !strings.Contains(c, "TestAuditLogsRawOnly") {
+			t.Errorf("caller = %q, want the test function", c)
+		}
+		if strings.Contains(e.Data["sql"].(string), "x@example.com") {
+			t.Error("bound values must not be logged")
+		}
+	}
+}
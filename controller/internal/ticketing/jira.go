@@ -0,0 +1,118 @@
+package ticketing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// jiraProvider uses the Jira REST API v2, which Cloud and Data Center
+// both serve. With a username the token is sent as basic auth (Cloud API
+// tokens); without one it is sent as a bearer personal access token.
+type jiraProvider struct {
+	baseURL   string
+	username  string
+	token     string
+	project   string
+	issueType string
+}
+
+func newJiraProvider(in *Integration) *jiraProvider {
+	issueType := in.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+	return &jiraProvider{
+		baseURL:   strings.TrimRight(in.BaseURL, "/"),
+		username:  in.Username,
+		token:     in.APIToken,
+		project:   in.ProjectKey,
+		issueType: issueType,
+	}
+}
+
+func (p *jiraProvider) Name() string { return ProviderJira }
+
+func (p *jiraProvider) auth(req *http.Request) {
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+}
+
+func (p *jiraProvider) Create(ctx context.Context, f Fields) (Ref, error) {
+	fields := map[string]any{
+		"project":     map[string]string{"key": p.project},
+		"summary":     f.Summary,
+		"description": f.Description,
+		"issuetype":   map[string]string{"name": p.issueType},
+		"labels":      []string{"netwatcher"},
+	}
+	if f.Priority != "" {
+		fields["priority"] = map[string]string{"name": f.Priority}
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := doJSON(ctx, p.Name(), http.MethodPost, p.baseURL+"/rest/api/2/issue", p.auth, map[string]any{"fields": fields}, &created); err != nil {
+		return Ref{}, err
+	}
+	if created.Key == "" {
+		return Ref{}, fmt.Errorf("jira: response has no issue key")
+	}
+	return Ref{ID: created.Key, Key: created.Key, URL: p.baseURL + "/browse/" + created.Key}, nil
+}
+
+func (p *jiraProvider) Status(ctx context.Context, id string) (Status, error) {
+	var issue struct {
+		Fields struct {
+			Status struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	u := p.baseURL + "/rest/api/2/issue/" + url.PathEscape(id) + "?fields=status"
+	if err := doJSON(ctx, p.Name(), http.MethodGet, u, p.auth, nil, &issue); err != nil {
+		return Status{}, err
+	}
+	st := issue.Fields.Status
+	return Status{Name: st.Name, Resolved: st.StatusCategory.Key == "done"}, nil
+}
+
+// Resolve applies the first available transition into the "done" status
+// category, since transition IDs differ per workflow.
+func (p *jiraProvider) Resolve(ctx context.Context, id, note string) error {
+	base := p.baseURL + "/rest/api/2/issue/" + url.PathEscape(id) + "/transitions"
+	var list struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := doJSON(ctx, p.Name(), http.MethodGet, base, p.auth, nil, &list); err != nil {
+		return err
+	}
+	for _, t := range list.Transitions {
+		if t.To.StatusCategory.Key != "done" {
+			continue
+		}
+		body := map[string]any{
+			"transition": map[string]string{"id": t.ID},
+			"update": map[string]any{
+				"comment": []map[string]any{{"add": map[string]string{"body": note}}},
+			},
+		}
+		return doJSON(ctx, p.Name(), http.MethodPost, base, p.auth, body, nil)
+	}
+	return fmt.Errorf("jira: issue %s has no transition to a done status", id)
+}
@@ -0,0 +1,110 @@
+// Package ticketing opens tickets in external trackers (Jira, ServiceNow)
+// for analysis incidents and keeps resolution state in sync both ways:
+// tickets are resolved when their incident clears, and tickets closed in
+// the tracker are marked resolved on the incident.
+package ticketing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Supported providers.
+const (
+	ProviderJira       = "jira"
+	ProviderServiceNow = "servicenow"
+)
+
+// Fields is the provider-neutral ticket content built from an incident.
+type Fields struct {
+	Summary     string
+	Description string
+	Priority    string // provider-specific value from the priority map
+}
+
+// Ref identifies a ticket in the external system.
+type Ref struct {
+	ID  string // API identifier (Jira issue key, ServiceNow sys_id)
+	Key string // human-readable key (Jira issue key, ServiceNow number)
+	URL string
+}
+
+// Status is the external state of a ticket.
+type Status struct {
+	Name     string
+	Resolved bool
+}
+
+// Provider talks to one external tracker.
+// Implementations must be safe for concurrent use.
+type Provider interface {
+	Create(ctx context.Context, f Fields) (Ref, error)
+	Status(ctx context.Context, id string) (Status, error)
+	// Resolve closes the ticket with a note explaining why.
+	Resolve(ctx context.Context, id, note string) error
+	Name() string
+}
+
+// NewProvider builds the client for an integration.
+func NewProvider(in *Integration) (Provider, error) {
+	switch in.Provider {
+	case ProviderJira:
+		return newJiraProvider(in), nil
+	case ProviderServiceNow:
+		return newServiceNowProvider(in), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown provider %q", ErrBadInput, in.Provider)
+	}
+}
+
+// httpClient is shared by the providers; trackers can be slow but a
+// stuck call must not hold up the analysis loop.
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// doJSON sends body (when non-nil) as JSON and decodes a JSON response
+// into out (when non-nil). auth sets the Authorization header.
+func doJSON(ctx context.Context, provider, method, url string, auth func(*http.Request), body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, rd)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	auth(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		msg := string(respBody)
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return fmt.Errorf("%s returned %d: %s", provider, resp.StatusCode, msg)
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
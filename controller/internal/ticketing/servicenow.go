@@ -0,0 +1,110 @@
+package ticketing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ServiceNow incident states that count as resolved.
+const (
+	snStateResolved = "6"
+	snStateClosed   = "7"
+	snStateCanceled = "8"
+)
+
+// serviceNowProvider uses the Table API on the incident table with basic
+// auth. The severity mapping sets both urgency and impact, which
+// ServiceNow combines into the incident priority.
+type serviceNowProvider struct {
+	baseURL         string
+	username        string
+	password        string
+	assignmentGroup string
+	closeCode       string
+}
+
+func newServiceNowProvider(in *Integration) *serviceNowProvider {
+	closeCode := in.ResolveCode
+	if closeCode == "" {
+		closeCode = "Solution provided"
+	}
+	return &serviceNowProvider{
+		baseURL:         strings.TrimRight(in.BaseURL, "/"),
+		username:        in.Username,
+		password:        in.APIToken,
+		assignmentGroup: in.AssignmentGroup,
+		closeCode:       closeCode,
+	}
+}
+
+func (p *serviceNowProvider) Name() string { return ProviderServiceNow }
+
+func (p *serviceNowProvider) auth(req *http.Request) {
+	req.SetBasicAuth(p.username, p.password)
+}
+
+func (p *serviceNowProvider) Create(ctx context.Context, f Fields) (Ref, error) {
+	body := map[string]string{
+		"short_description": f.Summary,
+		"description":       f.Description,
+	}
+	if f.Priority != "" {
+		body["urgency"] = f.Priority
+		body["impact"] = f.Priority
+	}
+	if p.assignmentGroup != "" {
+		body["assignment_group"] = p.assignmentGroup
+	}
+	var created struct {
+		Result struct {
+			SysID  string `json:"sys_id"`
+			Number string `json:"number"`
+		} `json:"result"`
+	}
+	if err := doJSON(ctx, p.Name(), http.MethodPost, p.baseURL+"/api/now/table/incident", p.auth, body, &created); err != nil {
+		return Ref{}, err
+	}
+	if created.Result.SysID == "" {
+		return Ref{}, fmt.Errorf("servicenow: response has no sys_id")
+	}
+	return Ref{
+		ID:  created.Result.SysID,
+		Key: created.Result.Number,
+		URL: p.baseURL + "/nav_to.do?uri=" + url.QueryEscape("incident.do?sys_id="+created.Result.SysID),
+	}, nil
+}
+
+func (p *serviceNowProvider) Status(ctx context.Context, id string) (Status, error) {
+	var rec struct {
+		Result struct {
+			State string `json:"state"`
+		} `json:"result"`
+	}
+	u := p.baseURL + "/api/now/table/incident/" + url.PathEscape(id) + "?sysparm_fields=state"
+	if err := doJSON(ctx, p.Name(), http.MethodGet, u, p.auth, nil, &rec); err != nil {
+		return Status{}, err
+	}
+	switch rec.Result.State {
+	case snStateResolved:
+		return Status{Name: "Resolved", Resolved: true}, nil
+	case snStateClosed:
+		return Status{Name: "Closed", Resolved: true}, nil
+	case snStateCanceled:
+		return Status{Name: "Canceled", Resolved: true}, nil
+	default:
+		return Status{Name: "state " + rec.Result.State}, nil
+	}
+}
+
+func (p *serviceNowProvider) Resolve(ctx context.Context, id, note string) error {
+	body := map[string]string{
+		"state":       snStateResolved,
+		"close_code":  p.closeCode,
+		"close_notes": note,
+	}
+	u := p.baseURL + "/api/now/table/incident/" + url.PathEscape(id)
+	return doJSON(ctx, p.Name(), http.MethodPatch, u, p.auth, body, nil)
+}
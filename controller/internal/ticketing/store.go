@@ -0,0 +1,320 @@
+package ticketing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBadInput = errors.New("bad input")
+	ErrNotFound = errors.New("not found")
+)
+
+// Ticket states as tracked by the controller.
+const (
+	StateOpen     = "open"
+	StateResolved = "resolved"
+)
+
+// Who resolved a ticket.
+const (
+	ResolvedByController = "controller" // incident cleared, ticket closed by us
+	ResolvedByExternal   = "external"   // closed in the tracker
+)
+
+// defaultPriorities maps incident severity to each provider's priority
+// values when an integration has no priority_map.
+var defaultPriorities = map[string]map[string]string{
+	ProviderJira:       {"critical": "Highest", "warning": "High", "info": "Medium"},
+	ProviderServiceNow: {"critical": "1", "warning": "2", "info": "3"},
+}
+
+var severityRank = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+// -------------------- Models --------------------
+
+// Integration is one workspace's connection to a ticket tracker.
+type Integration struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	WorkspaceID uint   `gorm:"index;not null" json:"workspace_id"`
+	Name        string `gorm:"size:128" json:"name"`
+	Provider    string `gorm:"size:16;not null" json:"provider"` // jira, servicenow
+	BaseURL     string `gorm:"size:512;not null" json:"base_url"`
+
+	// Credentials. Jira: account email + API token, or token alone for a
+	// bearer PAT. ServiceNow: user + password.
+	Username string `gorm:"size:255" json:"username,omitempty"`
+	APIToken string `gorm:"size:512" json:"-"`
+	HasToken bool   `gorm:"-" json:"has_token"`
+
+	ProjectKey      string `gorm:"size:64" json:"project_key,omitempty"`       // Jira
+	IssueType       string `gorm:"size:64" json:"issue_type,omitempty"`        // Jira, default Task
+	AssignmentGroup string `gorm:"size:128" json:"assignment_group,omitempty"` // ServiceNow
+	ResolveCode     string `gorm:"size:64" json:"resolve_code,omitempty"`      // ServiceNow close_code
+
+	// PriorityMap overrides the severity → priority mapping, e.g.
+	// {"critical": "P1", "warning": "P2"}.
+	PriorityMap datatypes.JSON `gorm:"type:jsonb" json:"priority_map,omitempty"`
+
+	// MinSeverity is the lowest incident severity that gets a ticket.
+	MinSeverity string `gorm:"size:16;default:'critical'" json:"min_severity"`
+	AutoCreate  bool   `gorm:"default:false" json:"auto_create"` // open tickets from the analysis loop
+	AutoResolve bool   `gorm:"default:true" json:"auto_resolve"` // close tickets when the incident clears
+	Enabled     bool   `gorm:"default:true;index" json:"enabled"`
+	LastError   string `gorm:"size:512" json:"last_error,omitempty"`
+}
+
+func (Integration) TableName() string { return "ticket_integrations" }
+
+// AfterFind exposes whether a token is stored without exposing it.
+func (in *Integration) AfterFind(*gorm.DB) error {
+	in.HasToken = in.APIToken != ""
+	return nil
+}
+
+// priority returns the mapped priority for a severity.
+func (in *Integration) priority(severity string) string {
+	if len(in.PriorityMap) > 0 {
+		var m map[string]string
+		if json.Unmarshal(in.PriorityMap, &m) == nil {
+			if p, ok := m[severity]; ok {
+				return p
+			}
+		}
+	}
+	return defaultPriorities[in.Provider][severity]
+}
+
+// wants reports whether an incident severity meets MinSeverity.
+func (in *Integration) wants(severity string) bool {
+	return severityRank[severity] >= severityRank[in.MinSeverity]
+}
+
+// Ticket links an analysis incident to a ticket in an external tracker.
+type Ticket struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	WorkspaceID   uint   `gorm:"not null;index:idx_incident_tickets_ws_incident" json:"workspace_id"`
+	IncidentID    string `gorm:"size:255;not null;index:idx_incident_tickets_ws_incident" json:"incident_id"`
+	IntegrationID uint   `gorm:"index;not null" json:"integration_id"`
+	Provider      string `gorm:"size:16" json:"provider"`
+
+	ExternalID  string `gorm:"size:128" json:"external_id"`
+	ExternalKey string `gorm:"size:128" json:"external_key"`
+	URL         string `gorm:"size:1024" json:"url"`
+
+	State          string     `gorm:"size:16;default:'open';index" json:"state"` // open, resolved
+	ExternalStatus string     `gorm:"size:64" json:"external_status,omitempty"`
+	ResolvedBy     string     `gorm:"size:16" json:"resolved_by,omitempty"` // controller, external
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	// IncidentActive is true while the analysis still reports the incident.
+	// A ticket closed in the tracker while its incident is active blocks a
+	// duplicate until the incident clears.
+	IncidentActive bool       `gorm:"default:true" json:"incident_active"`
+	LastSyncedAt   *time.Time `json:"last_synced_at,omitempty"`
+	CreatedByUser  uint       `json:"created_by_user_id,omitempty"` // 0 = created by the analysis loop
+}
+
+func (Ticket) TableName() string { return "incident_tickets" }
+
+// -------------------- Integration CRUD --------------------
+
+// IntegrationInput creates or updates an integration. Nil fields are
+// left unchanged on update.
+type IntegrationInput struct {
+	Name            *string            `json:"name"`
+	Provider        *string            `json:"provider"`
+	BaseURL         *string            `json:"base_url"`
+	Username        *string            `json:"username"`
+	APIToken        *string            `json:"api_token"`
+	ProjectKey      *string            `json:"project_key"`
+	IssueType       *string            `json:"issue_type"`
+	AssignmentGroup *string            `json:"assignment_group"`
+	ResolveCode     *string            `json:"resolve_code"`
+	PriorityMap     *map[string]string `json:"priority_map"`
+	MinSeverity     *string            `json:"min_severity"`
+	AutoCreate      *bool              `json:"auto_create"`
+	AutoResolve     *bool              `json:"auto_resolve"`
+	Enabled         *bool              `json:"enabled"`
+}
+
+func (in IntegrationInput) apply(it *Integration) error {
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	set(&it.Name, in.Name)
+	set(&it.Provider, in.Provider)
+	set(&it.BaseURL, in.BaseURL)
+	set(&it.Username, in.Username)
+	set(&it.APIToken, in.APIToken)
+	set(&it.ProjectKey, in.ProjectKey)
+	set(&it.IssueType, in.IssueType)
+	set(&it.AssignmentGroup, in.AssignmentGroup)
+	set(&it.ResolveCode, in.ResolveCode)
+	set(&it.MinSeverity, in.MinSeverity)
+	if in.PriorityMap != nil {
+		b, err := json.Marshal(*in.PriorityMap)
+		if err != nil {
+			return fmt.Errorf("%w: priority_map", ErrBadInput)
+		}
+		it.PriorityMap = datatypes.JSON(b)
+	}
+	if in.AutoCreate != nil {
+		it.AutoCreate = *in.AutoCreate
+	}
+	if in.AutoResolve != nil {
+		it.AutoResolve = *in.AutoResolve
+	}
+	if in.Enabled != nil {
+		it.Enabled = *in.Enabled
+	}
+	return validateIntegration(it)
+}
+
+func validateIntegration(it *Integration) error {
+	if it.Provider != ProviderJira && it.Provider != ProviderServiceNow {
+		return fmt.Errorf("%w: provider must be jira or servicenow", ErrBadInput)
+	}
+	u, err := url.Parse(it.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: base_url must be an http(s) URL", ErrBadInput)
+	}
+	if it.APIToken == "" {
+		return fmt.Errorf("%w: api_token is required", ErrBadInput)
+	}
+	if it.Provider == ProviderJira && it.ProjectKey == "" {
+		return fmt.Errorf("%w: project_key is required for jira", ErrBadInput)
+	}
+	if it.Provider == ProviderServiceNow && it.Username == "" {
+		return fmt.Errorf("%w: username is required for servicenow", ErrBadInput)
+	}
+	if it.MinSeverity == "" {
+		it.MinSeverity = "critical"
+	}
+	if _, ok := severityRank[it.MinSeverity]; !ok {
+		return fmt.Errorf("%w: min_severity must be info, warning or critical", ErrBadInput)
+	}
+	if len(it.Name) > 128 {
+		return fmt.Errorf("%w: name must be at most 128 characters", ErrBadInput)
+	}
+	return nil
+}
+
+// CreateIntegration validates and stores a new integration.
+func CreateIntegration(ctx context.Context, db *gorm.DB, workspaceID uint, in IntegrationInput) (*Integration, error) {
+	it := &Integration{WorkspaceID: workspaceID, AutoResolve: true, Enabled: true}
+	if err := in.apply(it); err != nil {
+		return nil, err
+	}
+	// gorm replaces zero values with column defaults on Create, so the
+	// booleans are written again explicitly.
+	if err := db.WithContext(ctx).Create(it).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Model(it).Select("auto_create", "auto_resolve", "enabled").Updates(it).Error; err != nil {
+		return nil, err
+	}
+	it.HasToken = true
+	return it, nil
+}
+
+// GetIntegration loads an integration scoped to its workspace.
+func GetIntegration(ctx context.Context, db *gorm.DB, workspaceID, id uint) (*Integration, error) {
+	var it Integration
+	err := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).First(&it).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// ListIntegrations returns a workspace's integrations.
+func ListIntegrations(ctx context.Context, db *gorm.DB, workspaceID uint) ([]Integration, error) {
+	var out []Integration
+	err := db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("id ASC").Find(&out).Error
+	return out, err
+}
+
+// UpdateIntegration applies a partial update.
+func UpdateIntegration(ctx context.Context, db *gorm.DB, workspaceID, id uint, in IntegrationInput) (*Integration, error) {
+	it, err := GetIntegration(ctx, db, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.apply(it); err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Select("*").Omit("created_at").Save(it).Error; err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// DeleteIntegration removes an integration. Ticket links are kept so the
+// references on past incidents survive.
+func DeleteIntegration(ctx context.Context, db *gorm.DB, workspaceID, id uint) error {
+	res := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).Delete(&Integration{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// -------------------- Tickets --------------------
+
+// ListTickets returns a workspace's ticket links, newest first.
+// incidentID filters when set.
+func ListTickets(ctx context.Context, db *gorm.DB, workspaceID uint, incidentID string, limit int) ([]Ticket, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	q := db.WithContext(ctx).Where("workspace_id = ?", workspaceID)
+	if incidentID != "" {
+		q = q.Where("incident_id = ?", incidentID)
+	}
+	var out []Ticket
+	err := q.Order("created_at DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
+// TicketsForIncidents returns the current ticket links for the given
+// incident IDs: open tickets, plus resolved ones whose incident is still
+// active. Errors degrade to an empty map.
+func TicketsForIncidents(ctx context.Context, db *gorm.DB, workspaceID uint, incidentIDs []string) map[string][]Ticket {
+	out := make(map[string][]Ticket)
+	if db == nil || len(incidentIDs) == 0 {
+		return out
+	}
+	var rows []Ticket
+	if err := db.WithContext(ctx).
+		Where("workspace_id = ? AND incident_id IN ? AND (state = ? OR incident_active = ?)", workspaceID, incidentIDs, StateOpen, true).
+		Order("created_at ASC").
+		Find(&rows).Error; err != nil {
+		return out
+	}
+	for _, t := range rows {
+		out[t.IncidentID] = append(out[t.IncidentID], t)
+	}
+	return out
+}
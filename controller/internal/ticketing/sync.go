@@ -0,0 +1,247 @@
+package ticketing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// statusPollInterval limits how often one open ticket's external status
+// is fetched.
+const statusPollInterval = 5 * time.Minute
+
+// Incident is the part of an analysis incident that goes into a ticket.
+type Incident struct {
+	ID              string
+	Title           string
+	Severity        string
+	Scope           string
+	SuggestedCause  string
+	AffectedAgents  []string
+	AffectedTargets []string
+	Evidence        []string
+	Recommendations []string
+	FirstSeenAt     *time.Time
+}
+
+// BuildFields maps an incident onto ticket content: the title becomes the
+// summary, severity the priority, and the evidence the description.
+func BuildFields(it *Integration, inc Incident) Fields {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Severity: %s\n", inc.Severity)
+	if inc.Scope != "" {
+		fmt.Fprintf(&b, "Scope: %s\n", inc.Scope)
+	}
+	if inc.FirstSeenAt != nil {
+		fmt.Fprintf(&b, "First seen: %s\n", inc.FirstSeenAt.UTC().Format(time.RFC3339))
+	}
+	if len(inc.AffectedAgents) > 0 {
+		fmt.Fprintf(&b, "Affected agents: %s\n", strings.Join(inc.AffectedAgents, ", "))
+	}
+	if len(inc.AffectedTargets) > 0 {
+		fmt.Fprintf(&b, "Affected targets: %s\n", strings.Join(inc.AffectedTargets, ", "))
+	}
+	if inc.SuggestedCause != "" {
+		fmt.Fprintf(&b, "\nSuggested cause: %s\n", inc.SuggestedCause)
+	}
+	if len(inc.Evidence) > 0 {
+		b.WriteString("\nEvidence:\n")
+		for _, e := range inc.Evidence {
+			fmt.Fprintf(&b, "- %s\n", e)
+		}
+	}
+	if len(inc.Recommendations) > 0 {
+		b.WriteString("\nRecommendations:\n")
+		for _, r := range inc.Recommendations {
+			fmt.Fprintf(&b, "- %s\n", r)
+		}
+	}
+	fmt.Fprintf(&b, "\nNetWatcher incident ID: %s\n", inc.ID)
+
+	summary := "[NetWatcher] " + inc.Title
+	if len(summary) > 250 {
+		summary = summary[:250]
+	}
+	return Fields{
+		Summary:     summary,
+		Description: b.String(),
+		Priority:    it.priority(inc.Severity),
+	}
+}
+
+// CreateTicket opens a ticket for an incident on demand. It fails with
+// ErrBadInput if the incident already has an open ticket in this
+// integration.
+func CreateTicket(ctx context.Context, db *gorm.DB, it *Integration, inc Incident, userID uint) (*Ticket, error) {
+	var open int64
+	if err := db.WithContext(ctx).Model(&Ticket{}).
+		Where("integration_id = ? AND incident_id = ? AND state = ?", it.ID, inc.ID, StateOpen).
+		Count(&open).Error; err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		return nil, fmt.Errorf("%w: incident already has an open ticket", ErrBadInput)
+	}
+	return openTicket(ctx, db, it, inc, userID)
+}
+
+func openTicket(ctx context.Context, db *gorm.DB, it *Integration, inc Incident, userID uint) (*Ticket, error) {
+	p, err := NewProvider(it)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := p.Create(ctx, BuildFields(it, inc))
+	recordResult(ctx, db, it, err)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	t := &Ticket{
+		WorkspaceID:    it.WorkspaceID,
+		IncidentID:     inc.ID,
+		IntegrationID:  it.ID,
+		Provider:       it.Provider,
+		ExternalID:     ref.ID,
+		ExternalKey:    ref.Key,
+		URL:            ref.URL,
+		State:          StateOpen,
+		IncidentActive: true,
+		LastSyncedAt:   &now,
+		CreatedByUser:  userID,
+	}
+	if err := db.WithContext(ctx).Create(t).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SyncWorkspace reconciles tickets with the incidents from one analysis
+// run. For each enabled integration it:
+//   - opens tickets for new incidents when AutoCreate is on,
+//   - resolves tickets whose incident cleared when AutoResolve is on,
+//   - marks tickets resolved when they were closed in the tracker.
+//
+// Provider errors are logged and stored on the integration; they never
+// abort the sync for other integrations.
+func SyncWorkspace(ctx context.Context, db *gorm.DB, workspaceID uint, incidents []Incident) error {
+	var integrations []Integration
+	if err := db.WithContext(ctx).Where("workspace_id = ? AND enabled = ?", workspaceID, true).Find(&integrations).Error; err != nil {
+		return fmt.Errorf("load integrations: %w", err)
+	}
+	if len(integrations) == 0 {
+		return nil
+	}
+
+	active := make(map[string]Incident, len(incidents))
+	for _, inc := range incidents {
+		active[inc.ID] = inc
+	}
+	now := time.Now().UTC()
+
+	for i := range integrations {
+		it := &integrations[i]
+		var tickets []Ticket
+		if err := db.WithContext(ctx).
+			Where("integration_id = ? AND (state = ? OR incident_active = ?)", it.ID, StateOpen, true).
+			Find(&tickets).Error; err != nil {
+			return fmt.Errorf("load tickets: %w", err)
+		}
+
+		covered := make(map[string]bool, len(tickets))
+		for j := range tickets {
+			t := &tickets[j]
+			if _, ok := active[t.IncidentID]; ok {
+				covered[t.IncidentID] = true
+				if t.State == StateOpen {
+					pollTicket(ctx, db, it, t, now)
+				}
+				continue
+			}
+			clearTicket(ctx, db, it, t, now)
+		}
+
+		if !it.AutoCreate {
+			continue
+		}
+		for _, inc := range incidents {
+			if covered[inc.ID] || !it.wants(inc.Severity) {
+				continue
+			}
+			if _, err := openTicket(ctx, db, it, inc, 0); err != nil {
+				log.Warnf("[ticketing] integration %d: open ticket for %s: %v", it.ID, inc.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pollTicket picks up resolution done in the tracker.
+func pollTicket(ctx context.Context, db *gorm.DB, it *Integration, t *Ticket, now time.Time) {
+	if t.LastSyncedAt != nil && now.Sub(*t.LastSyncedAt) < statusPollInterval {
+		return
+	}
+	p, err := NewProvider(it)
+	if err != nil {
+		return
+	}
+	st, err := p.Status(ctx, t.ExternalID)
+	recordResult(ctx, db, it, err)
+	if err != nil {
+		log.Warnf("[ticketing] integration %d: status of %s: %v", it.ID, t.ExternalKey, err)
+		return
+	}
+	updates := map[string]any{"external_status": st.Name, "last_synced_at": now}
+	if st.Resolved {
+		updates["state"] = StateResolved
+		updates["resolved_by"] = ResolvedByExternal
+		updates["resolved_at"] = now
+	}
+	db.WithContext(ctx).Model(t).Updates(updates)
+}
+
+// clearTicket handles a ticket whose incident is no longer reported.
+func clearTicket(ctx context.Context, db *gorm.DB, it *Integration, t *Ticket, now time.Time) {
+	updates := map[string]any{"incident_active": false}
+	if t.State == StateOpen && !it.AutoResolve {
+		// The ticket stays open for a human; keep following its status.
+		pollTicket(ctx, db, it, t, now)
+	}
+	if t.State == StateOpen && it.AutoResolve {
+		p, err := NewProvider(it)
+		if err == nil {
+			err = p.Resolve(ctx, t.ExternalID, "Incident cleared: NetWatcher no longer detects this issue.")
+		}
+		recordResult(ctx, db, it, err)
+		if err != nil {
+			// Leave it open and active so the next cycle retries.
+			log.Warnf("[ticketing] integration %d: resolve %s: %v", it.ID, t.ExternalKey, err)
+			return
+		}
+		updates["state"] = StateResolved
+		updates["resolved_by"] = ResolvedByController
+		updates["resolved_at"] = now
+		updates["last_synced_at"] = now
+	}
+	db.WithContext(ctx).Model(t).Updates(updates)
+}
+
+// recordResult keeps the integration's last_error current so broken
+// credentials show up in the panel.
+func recordResult(ctx context.Context, db *gorm.DB, it *Integration, err error) {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+	}
+	if msg == it.LastError {
+		return
+	}
+	it.LastError = msg
+	db.WithContext(ctx).Model(&Integration{}).Where("id = ?", it.ID).Update("last_error", msg)
+}
@@ -0,0 +1,123 @@
+package ticketing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func TestBuildFieldsPriorityMapping(t *testing.T) {
+	inc := Incident{ID: "agent_offline_3", Title: "Agent offline", Severity: "critical", Evidence: []string{"no heartbeat for 10m"}}
+
+	jira := &Integration{Provider: ProviderJira}
+	f := BuildFields(jira, inc)
+	if f.Priority != "Highest" {
+		t.Errorf("jira critical priority = %q, want Highest", f.Priority)
+	}
+	if !strings.Contains(f.Description, "- no heartbeat for 10m") || !strings.Contains(f.Description, "agent_offline_3") {
+		t.Errorf("description missing evidence or incident id:\n%s", f.Description)
+	}
+
+	sn := &Integration{Provider: ProviderServiceNow, PriorityMap: datatypes.JSON(`{"critical":"2"}`)}
+	if p := BuildFields(sn, inc).Priority; p != "2" {
+		t.Errorf("overridden priority = %q, want 2", p)
+	}
+	if p := BuildFields(sn, Incident{Severity: "warning"}).Priority; p != "2" {
+		t.Errorf("default servicenow warning priority = %q, want 2", p)
+	}
+}
+
+func TestIntegrationWants(t *testing.T) {
+	it := &Integration{MinSeverity: "warning"}
+	if it.wants("info") || !it.wants("warning") || !it.wants("critical") {
+		t.Error("min_severity warning should accept warning and critical only")
+	}
+}
+
+// TestJiraProviderLifecycle runs create, status and resolve against a fake
+// Jira and checks the transition into the done category is used.
+func TestJiraProviderLifecycle(t *testing.T) {
+	var transitioned string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ops@example.com" || pass != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue":
+			var body struct {
+				Fields map[string]any `json:"fields"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body.Fields["priority"].(map[string]any)["name"] != "High" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"key":"OPS-7"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/OPS-7":
+			_, _ = w.Write([]byte(`{"fields":{"status":{"name":"Done","statusCategory":{"key":"done"}}}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/OPS-7/transitions":
+			_, _ = w.Write([]byte(`{"transitions":[{"id":"11","to":{"statusCategory":{"key":"indeterminate"}}},{"id":"31","to":{"statusCategory":{"key":"done"}}}]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue/OPS-7/transitions":
+			var body struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			transitioned = body.Transition.ID
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	it := &Integration{Provider: ProviderJira, BaseURL: srv.URL + "/", Username: "ops@example.com", APIToken: "tok", ProjectKey: "OPS"}
+	p, err := NewProvider(it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref, err := p.Create(ctx, BuildFields(it, Incident{ID: "x", Title: "Loss", Severity: "warning"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Key != "OPS-7" || ref.URL != srv.URL+"/browse/OPS-7" {
+		t.Errorf("unexpected ref %+v", ref)
+	}
+	st, err := p.Status(ctx, ref.ID)
+	if err != nil || !st.Resolved {
+		t.Errorf("status = %+v, %v; want resolved", st, err)
+	}
+	if err := p.Resolve(ctx, ref.ID, "cleared"); err != nil {
+		t.Fatal(err)
+	}
+	if transitioned != "31" {
+		t.Errorf("used transition %q, want 31", transitioned)
+	}
+}
+
+func TestValidateIntegration(t *testing.T) {
+	cases := []struct {
+		name string
+		it   Integration
+		ok   bool
+	}{
+		{"jira ok", Integration{Provider: ProviderJira, BaseURL: "https://x.atlassian.net", APIToken: "t", ProjectKey: "OPS"}, true},
+		{"jira no project", Integration{Provider: ProviderJira, BaseURL: "https://x.atlassian.net", APIToken: "t"}, false},
+		{"servicenow no user", Integration{Provider: ProviderServiceNow, BaseURL: "https://x.service-now.com", APIToken: "t"}, false},
+		{"bad url", Integration{Provider: ProviderServiceNow, BaseURL: "ftp://x", Username: "u", APIToken: "t"}, false},
+		{"bad severity", Integration{Provider: ProviderJira, BaseURL: "https://x", APIToken: "t", ProjectKey: "O", MinSeverity: "high"}, false},
+	}
+	for _, tc := range cases {
+		if err := validateIntegration(&tc.it); (err == nil) != tc.ok {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+	}
+}
@@ -18,11 +18,14 @@ import (
 // -----------------------------------------------------------------------------
 
 type Session struct {
-	UserID    uint           `json:"user_id" gorm:"column:user_id;index;not null"`
-	SessionID uint           `json:"session_id" gorm:"primaryKey;autoIncrement"`
-	Expiry    time.Time      `json:"expiry" gorm:"column:expiry;index;not null"`
-	Created   time.Time      `json:"created" gorm:"column:created;index;not null"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"column:user_id;index;not null"`
+	SessionID uint      `json:"session_id" gorm:"primaryKey;autoIncrement"`
+	Expiry    time.Time `json:"expiry" gorm:"column:expiry;index;not null"`
+	Created   time.Time `json:"created" gorm:"column:created;index;not null"`
+	// RefreshedAt is the last refresh-token rotation; nil until the first.
+	RefreshedAt *time.Time     `json:"refreshed_at,omitempty" gorm:"column:refreshed_at"`
+	IP          string         `json:"ip,omitempty" gorm:"column:ip;size:64"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (Session) TableName() string { return "sessions" }
@@ -107,27 +110,27 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
-// RegisterUser creates a user and an initial session, returning a JWT.
-func RegisterUser(ctx context.Context, db *gorm.DB, in RegisterInput, ip string) (token string, u *User, sess *Session, err error) {
+// RegisterUser creates a user and an initial session, returning its tokens.
+func RegisterUser(ctx context.Context, db *gorm.DB, in RegisterInput, ip string, policyFor func(userID uint) SessionPolicy) (tokens *TokenPair, u *User, sess *Session, err error) {
 	email := strings.ToLower(strings.TrimSpace(in.Email))
 	if email == "" || strings.TrimSpace(in.Password) == "" {
-		return "", nil, nil, errors.New("email and password are required")
+		return nil, nil, nil, errors.New("email and password are required")
 	}
 	if len(in.Password) < MinPasswordLength {
-		return "", nil, nil, ErrPasswordTooShort
+		return nil, nil, nil, ErrPasswordTooShort
 	}
 
 	var exists int64
 	if err = db.WithContext(ctx).Model(&User{}).Where("email = ?", email).Count(&exists).Error; err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 	if exists > 0 {
-		return "", nil, nil, ErrDuplicateEmail
+		return nil, nil, nil, ErrDuplicateEmail
 	}
 
 	pwHash, err := hashPassword(in.Password)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	u = &User{
@@ -145,58 +148,48 @@ func RegisterUser(ctx context.Context, db *gorm.DB, in RegisterInput, ip string)
 	if err = db.WithContext(ctx).Create(u).Error; err != nil {
 		// best-effort duplicate detection
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
-			return "", nil, nil, ErrDuplicateEmail
+			return nil, nil, nil, ErrDuplicateEmail
 		}
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	sess, err = CreateUserSession(ctx, db, u.ID, 24*time.Hour)
+	tokens, sess, err = IssueSession(ctx, db, u.ID, ip, policyFor(u.ID))
 	if err != nil {
-		return "", nil, nil, err
-	}
-
-	token, err = SignUserToken(sess.SessionID, u.ID, time.Until(sess.Expiry))
-	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// best-effort login timestamp
 	_ = db.WithContext(ctx).Model(&User{}).Where("id = ?", u.ID).Update("last_login_at", time.Now()).Error
 
-	return token, u, sess, nil
+	return tokens, u, sess, nil
 }
 
-// LoginUser verifies password, creates a session, and returns a JWT.
-func LoginUser(ctx context.Context, db *gorm.DB, in LoginInput, ip string) (token string, u *User, sess *Session, err error) {
+// LoginUser verifies password, creates a session, and returns its tokens.
+func LoginUser(ctx context.Context, db *gorm.DB, in LoginInput, ip string, policyFor func(userID uint) SessionPolicy) (tokens *TokenPair, u *User, sess *Session, err error) {
 	email := strings.ToLower(strings.TrimSpace(in.Email))
 	if email == "" || strings.TrimSpace(in.Password) == "" {
-		return "", nil, nil, errors.New("email and password are required")
+		return nil, nil, nil, errors.New("email and password are required")
 	}
 
 	u = &User{}
 	if err = db.WithContext(ctx).Where("email = ?", email).First(u).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil, nil, ErrUserNotFound
+			return nil, nil, nil, ErrUserNotFound
 		}
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(in.Password)) != nil {
-		return "", nil, nil, ErrBadPassword
-	}
-
-	sess, err = CreateUserSession(ctx, db, u.ID, 24*time.Hour)
-	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, ErrBadPassword
 	}
 
-	token, err = SignUserToken(sess.SessionID, u.ID, time.Until(sess.Expiry))
+	tokens, sess, err = IssueSession(ctx, db, u.ID, ip, policyFor(u.ID))
 	if err != nil {
-		return "", nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	_ = db.WithContext(ctx).Model(&User{}).Where("id = ?", u.ID).Update("last_login_at", time.Now()).Error
-	return token, u, sess, nil
+	return tokens, u, sess, nil
 }
 
 // CreateUserSession creates a session row for a user.
@@ -0,0 +1,293 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// -----------------------------------------------------------------------------
+// Refresh tokens and sliding sessions
+//
+// A login issues a short-lived access JWT and an opaque refresh token bound
+// to the session. POST /auth/refresh trades the refresh token for a new
+// pair: the old token is marked used (rotation) and, when the policy
+// slides, the session's expiry moves forward by the idle timeout, never
+// past Created + MaxLifetime. Presenting a used refresh token again means
+// it was copied, so the whole session is revoked.
+// -----------------------------------------------------------------------------
+
+var (
+	ErrRefreshReused  = errors.New("refresh token already used; session revoked")
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// refreshReuseGrace lets a second refresh with the same token (two tabs
+// racing) fail quietly instead of revoking the session.
+const refreshReuseGrace = 30 * time.Second
+
+// RefreshToken is one link in a session's rotation chain. Only the SHA-256
+// of the token is stored.
+type RefreshToken struct {
+	ID           uint      `gorm:"primaryKey"`
+	SessionID    uint      `gorm:"index;not null"`
+	UserID       uint      `gorm:"index;not null"`
+	TokenHash    string    `gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+	UsedAt       *time.Time
+	RevokedAt    *time.Time
+	ReplacedByID *uint
+}
+
+func (RefreshToken) TableName() string { return "refresh_tokens" }
+
+// SessionPolicy sets token and session lifetimes. Sliding sessions are
+// extended on every refresh by IdleTimeout; fixed ones end IdleTimeout
+// after login. Neither outlives MaxLifetime.
+type SessionPolicy struct {
+	AccessTTL   time.Duration
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+	Sliding     bool
+}
+
+// DefaultSessionPolicy reads AUTH_ACCESS_TOKEN_TTL, AUTH_SESSION_IDLE_TIMEOUT
+// and AUTH_SESSION_MAX_LIFETIME (Go durations) and AUTH_SESSION_SLIDING.
+func DefaultSessionPolicy() SessionPolicy {
+	p := SessionPolicy{
+		AccessTTL:   durationEnv("AUTH_ACCESS_TOKEN_TTL", 15*time.Minute),
+		IdleTimeout: durationEnv("AUTH_SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		MaxLifetime: durationEnv("AUTH_SESSION_MAX_LIFETIME", 30*24*time.Hour),
+		Sliding:     strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_SESSION_SLIDING"))) != "false",
+	}
+	if p.MaxLifetime < p.IdleTimeout {
+		p.MaxLifetime = p.IdleTimeout
+	}
+	return p
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key))); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// Tighten returns the stricter of p and the non-zero limits in o; sliding
+// stays on only if both allow it.
+func (p SessionPolicy) Tighten(o SessionPolicy) SessionPolicy {
+	shorter := func(a, b time.Duration) time.Duration {
+		if b > 0 && b < a {
+			return b
+		}
+		return a
+	}
+	p.AccessTTL = shorter(p.AccessTTL, o.AccessTTL)
+	p.IdleTimeout = shorter(p.IdleTimeout, o.IdleTimeout)
+	p.MaxLifetime = shorter(p.MaxLifetime, o.MaxLifetime)
+	p.Sliding = p.Sliding && o.Sliding
+	if p.IdleTimeout > p.MaxLifetime {
+		p.IdleTimeout = p.MaxLifetime
+	}
+	return p
+}
+
+// sessionExpiry is when a session refreshed at now should end.
+func (p SessionPolicy) sessionExpiry(created, now time.Time) time.Time {
+	exp := created.Add(p.IdleTimeout)
+	if p.Sliding {
+		exp = now.Add(p.IdleTimeout)
+	}
+	if limit := created.Add(p.MaxLifetime); exp.After(limit) {
+		exp = limit
+	}
+	return exp
+}
+
+// TokenPair is what the auth endpoints return. Token is the access JWT,
+// kept under its historical name.
+type TokenPair struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresIn        int       `json:"expires_in"` // seconds
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionExpiresAt time.Time `json:"session_expires_at"`
+	SessionID        uint      `json:"session_id"`
+}
+
+func hashRefreshToken(tok string) string {
+	sum := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueSession creates a session for a user and its first token pair.
+func IssueSession(ctx context.Context, db *gorm.DB, userID uint, ip string, p SessionPolicy) (*TokenPair, *Session, error) {
+	now := time.Now()
+	s := &Session{
+		UserID:  userID,
+		Created: now,
+		Expiry:  p.sessionExpiry(now, now),
+		IP:      ip,
+	}
+	var pair *TokenPair
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(s).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, _, err = issueTokenPair(tx, s, p, now)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, s, nil
+}
+
+// issueTokenPair signs an access token and stores a refresh token that
+// lasts as long as the session.
+func issueTokenPair(tx *gorm.DB, s *Session, p SessionPolicy, now time.Time) (*TokenPair, *RefreshToken, error) {
+	raw, err := generateSecureToken(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	rt := &RefreshToken{
+		SessionID: s.SessionID,
+		UserID:    s.UserID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: s.Expiry,
+	}
+	if err := tx.Create(rt).Error; err != nil {
+		return nil, nil, err
+	}
+
+	accessExp := now.Add(p.AccessTTL)
+	if accessExp.After(s.Expiry) {
+		accessExp = s.Expiry
+	}
+	access, err := SignUserToken(s.SessionID, s.UserID, accessExp.Sub(now))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TokenPair{
+		Token:            access,
+		ExpiresAt:        accessExp.UTC(),
+		ExpiresIn:        int(accessExp.Sub(now) / time.Second),
+		RefreshToken:     raw,
+		RefreshExpiresAt: rt.ExpiresAt.UTC(),
+		SessionExpiresAt: s.Expiry.UTC(),
+		SessionID:        s.SessionID,
+	}, rt, nil
+}
+
+// RefreshSession rotates a refresh token. policyFor returns the policy for
+// the token's user, so workspace limits apply at each refresh.
+func RefreshSession(ctx context.Context, db *gorm.DB, refreshToken string, policyFor func(userID uint) SessionPolicy) (*TokenPair, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+	var rt RefreshToken
+	err := db.WithContext(ctx).Where("token_hash = ?", hashRefreshToken(refreshToken)).First(&rt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	switch {
+	case rt.RevokedAt != nil:
+		return nil, ErrSessionRevoked
+	case rt.UsedAt != nil:
+		if now.Sub(*rt.UsedAt) < refreshReuseGrace {
+			return nil, ErrInvalidToken
+		}
+		_ = RevokeSession(ctx, db, rt.SessionID)
+		return nil, ErrRefreshReused
+	case now.After(rt.ExpiresAt):
+		return nil, ErrExpiredToken
+	}
+
+	sess, err := GetSession(ctx, db, rt.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	p := policyFor(sess.UserID)
+
+	var pair *TokenPair
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Guard against a concurrent refresh with the same token.
+		res := tx.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL", rt.ID).Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+		sess.Expiry = p.sessionExpiry(sess.Created, now)
+		sess.RefreshedAt = &now
+		if err := tx.Model(&Session{}).Where("session_id = ?", sess.SessionID).
+			Updates(map[string]any{"expiry": sess.Expiry, "refreshed_at": now}).Error; err != nil {
+			return err
+		}
+		var next *RefreshToken
+		var err error
+		if pair, next, err = issueTokenPair(tx, sess, p, now); err != nil {
+			return err
+		}
+		return tx.Model(&RefreshToken{}).Where("id = ?", rt.ID).Update("replaced_by_id", next.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeSession ends a session and its refresh tokens.
+func RevokeSession(ctx context.Context, db *gorm.DB, sessionID uint) error {
+	now := time.Now()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&RefreshToken{}).
+			Where("session_id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Session{}, "session_id = ?", sessionID).Error
+	})
+}
+
+// RevokeUserSessions ends every session of a user except keep (0 for none)
+// and returns how many were ended.
+func RevokeUserSessions(ctx context.Context, db *gorm.DB, userID, keep uint) (int, error) {
+	var ids []uint
+	if err := db.WithContext(ctx).Model(&Session{}).
+		Where("user_id = ? AND session_id <> ?", userID, keep).
+		Pluck("session_id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := RevokeSession(ctx, db, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// ListUserSessions returns a user's live sessions, newest first.
+func ListUserSessions(ctx context.Context, db *gorm.DB, userID uint) ([]Session, error) {
+	var out []Session
+	err := db.WithContext(ctx).
+		Where("user_id = ? AND expiry > ?", userID, time.Now()).
+		Order("created DESC").
+		Find(&out).Error
+	return out, err
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	// A single connection keeps the in-memory database alive and shared.
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Session{}, &RefreshToken{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+var testPolicy = SessionPolicy{AccessTTL: 15 * time.Minute, IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour, Sliding: true}
+
+func testPolicyFor(uint) SessionPolicy { return testPolicy }
+
+// TestRefreshSessionRotates verifies a refresh issues a new pair for the
+// same session and links the spent token to its replacement.
+func TestRefreshSessionRotates(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	first, sess, err := IssueSession(ctx, db, 7, "192.0.2.1", testPolicy)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	next, err := RefreshSession(ctx, db, first.RefreshToken, testPolicyFor)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if next.RefreshToken == first.RefreshToken || next.SessionID != sess.SessionID {
+		t.Errorf("refresh = session %d, same token %v; want a new token for session %d",
+			next.SessionID, next.RefreshToken == first.RefreshToken, sess.SessionID)
+	}
+	claims, err := ParseUserToken(next.Token)
+	if err != nil || claims.SessionID != sess.SessionID || claims.UserID != 7 {
+		t.Errorf("access token claims = %+v (%v)", claims, err)
+	}
+
+	var old, cur RefreshToken
+	db.Where("token_hash = ?", hashRefreshToken(first.RefreshToken)).First(&old)
+	db.Where("token_hash = ?", hashRefreshToken(next.RefreshToken)).First(&cur)
+	if old.UsedAt == nil || old.ReplacedByID == nil || *old.ReplacedByID != cur.ID {
+		t.Errorf("spent token = %+v, want used and replaced by %d", old, cur.ID)
+	}
+	if cur.UsedAt != nil || cur.RevokedAt != nil {
+		t.Errorf("new token = %+v, want unused", cur)
+	}
+
+	// The new token keeps the chain going.
+	if _, err := RefreshSession(ctx, db, next.RefreshToken, testPolicyFor); err != nil {
+		t.Errorf("second refresh: %v", err)
+	}
+	if _, err := RefreshSession(ctx, db, "not-a-token", testPolicyFor); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// TestRefreshSessionReuse verifies a racing reuse within the grace window
+// is rejected quietly, while a later replay revokes the whole session.
+func TestRefreshSessionReuse(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	first, sess, err := IssueSession(ctx, db, 7, "192.0.2.1", testPolicy)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	next, err := RefreshSession(ctx, db, first.RefreshToken, testPolicyFor)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := RefreshSession(ctx, db, first.RefreshToken, testPolicyFor); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("reuse within grace err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := GetSession(ctx, db, sess.SessionID); err != nil {
+		t.Fatalf("session ended by a reuse within grace: %v", err)
+	}
+
+	past := time.Now().Add(-2 * refreshReuseGrace)
+	db.Model(&RefreshToken{}).Where("token_hash = ?", hashRefreshToken(first.RefreshToken)).Update("used_at", past)
+	if _, err := RefreshSession(ctx, db, first.RefreshToken, testPolicyFor); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("replay err = %v, want ErrRefreshReused", err)
+	}
+	if _, err := GetSession(ctx, db, sess.SessionID); err == nil {
+		t.Error("session still live after a replayed refresh token")
+	}
+	if _, err := RefreshSession(ctx, db, next.RefreshToken, testPolicyFor); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("current token err = %v, want ErrSessionRevoked", err)
+	}
+}
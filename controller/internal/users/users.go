@@ -6,6 +6,8 @@ import (
 	"strings"
 	"time"
 
+	"netwatcher-controller/internal/sqlsafe"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
@@ -189,10 +191,7 @@ func List(ctx context.Context, db *gorm.DB, limit, offset int, q string) ([]User
 		tx    = db.WithContext(ctx).Model(&User{})
 	)
 
-	if q != "" {
-		qLike := "%" + strings.ToLower(q) + "%"
-		tx = tx.Where("LOWER(email) LIKE ? OR LOWER(name) LIKE ?", qLike, qLike)
-	}
+	tx = sqlsafe.Search(tx, q, "email", "name")
 
 	if err := tx.Count(&count).Error; err != nil {
 		return nil, 0, err
@@ -0,0 +1,97 @@
+package vantage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// failureTTL keeps a failed target from being retried on every analysis run.
+const failureTTL = 5 * time.Minute
+
+// Checker caches provider results per target and runs at most one
+// measurement per target at a time. Measurements spend third-party
+// credits, so analysis only reads the cache and queues refreshes.
+type Checker struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]bool
+}
+
+type cacheEntry struct {
+	result  *Result
+	err     error
+	expires time.Time
+}
+
+// NewChecker wraps p with a result cache. Returns nil if p is nil.
+func NewChecker(p Provider, cfg Config) *Checker {
+	if p == nil {
+		return nil
+	}
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return &Checker{
+		provider: p,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		inflight: make(map[string]bool),
+	}
+}
+
+// Name returns the provider name.
+func (c *Checker) Name() string { return c.provider.Name() }
+
+// Cached returns a fresh cached result for target, if any.
+func (c *Checker) Cached(target string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[target]
+	if !ok || time.Now().After(e.expires) || e.result == nil {
+		return nil, false
+	}
+	return e.result, true
+}
+
+// Refresh starts a background measurement for target unless one is
+// running or a fresh entry (including a recent failure) exists.
+func (c *Checker) Refresh(target string) {
+	c.mu.Lock()
+	if c.inflight[target] {
+		c.mu.Unlock()
+		return
+	}
+	if e, ok := c.entries[target]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight[target] = true
+	c.mu.Unlock()
+
+	go func() {
+		if _, err := c.measure(context.Background(), target); err != nil {
+			log.Debugf("[vantage] %s check of %s failed: %v", c.provider.Name(), target, err)
+		}
+	}()
+}
+
+func (c *Checker) measure(ctx context.Context, target string) (*Result, error) {
+	r, err := c.provider.Measure(ctx, target)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, target)
+	ttl := c.ttl
+	if err != nil {
+		ttl = failureTTL
+	}
+	c.entries[target] = cacheEntry{result: r, err: err, expires: time.Now().Add(ttl)}
+	return r, err
+}
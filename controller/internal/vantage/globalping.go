@@ -0,0 +1,130 @@
+package vantage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const globalpingURL = "https://api.globalping.io/v1"
+
+// GlobalpingProvider implements Provider using the Globalping API.
+// Works without a token at the anonymous rate limit.
+type GlobalpingProvider struct {
+	token    string
+	limit    int
+	location string
+	timeout  time.Duration
+	client   *http.Client
+}
+
+// NewGlobalpingProvider creates a Globalping provider
+func NewGlobalpingProvider(cfg Config) *GlobalpingProvider {
+	loc := cfg.Location
+	if loc == "" {
+		loc = "world"
+	}
+	return &GlobalpingProvider{
+		token:    cfg.APIKey,
+		limit:    cfg.ProbeLimit,
+		location: loc,
+		timeout:  cfg.Timeout,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *GlobalpingProvider) Available() bool { return true }
+func (p *GlobalpingProvider) Name() string    { return "globalping" }
+
+func (p *GlobalpingProvider) Measure(ctx context.Context, target string) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]any{
+		"type":               "ping",
+		"target":             target,
+		"limit":              p.limit,
+		"locations":          []map[string]any{{"magic": p.location, "limit": p.limit}},
+		"measurementOptions": map[string]any{"packets": 3},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := p.do(ctx, "POST", globalpingURL+"/measurements", body, &created); err != nil {
+		return nil, err
+	}
+
+	for {
+		var m struct {
+			Status  string `json:"status"`
+			Results []struct {
+				Probe struct {
+					City    string `json:"city"`
+					Country string `json:"country"`
+					ASN     int    `json:"asn"`
+				} `json:"probe"`
+				Result struct {
+					Stats struct {
+						Avg   *float64 `json:"avg"`
+						Total int      `json:"total"`
+						Rcv   int      `json:"rcv"`
+					} `json:"stats"`
+				} `json:"result"`
+			} `json:"results"`
+		}
+		if err := p.do(ctx, "GET", globalpingURL+"/measurements/"+created.ID, nil, &m); err != nil {
+			return nil, err
+		}
+		if m.Status != "in-progress" {
+			stats := make([]probeStat, 0, len(m.Results))
+			for _, r := range m.Results {
+				s := probeStat{
+					Sent:     r.Result.Stats.Total,
+					Received: r.Result.Stats.Rcv,
+					Location: fmt.Sprintf("%s, %s (AS%d)", r.Probe.City, r.Probe.Country, r.Probe.ASN),
+				}
+				if r.Result.Stats.Avg != nil {
+					s.AvgRTTMs = *r.Result.Stats.Avg
+				}
+				stats = append(stats, s)
+			}
+			return summarize(p.Name(), target, stats)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("globalping measurement %s: %w", created.ID, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (p *GlobalpingProvider) do(ctx context.Context, method, url string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("globalping request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("globalping returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
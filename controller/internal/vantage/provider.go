@@ -0,0 +1,124 @@
+// Package vantage provides optional third-party vantage point checks
+// (Globalping, RIPE Atlas). Targets that agents see as degraded are pinged
+// from public probes so analysis can tell a local problem from a problem
+// at the target. When not configured, nothing is sent to third parties.
+package vantage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Result is the aggregated view of one target from external probes.
+type Result struct {
+	Source     string    `json:"source"` // provider name
+	Target     string    `json:"target"`
+	Probes     int       `json:"probes"`    // probes that returned a result
+	Reachable  int       `json:"reachable"` // probes that received at least one reply
+	AvgRTTMs   float64   `json:"avg_rtt_ms"`
+	LossPct    float64   `json:"loss_pct"`
+	Locations  []string  `json:"locations,omitempty"` // "City, CC (AS123)"
+	MeasuredAt time.Time `json:"measured_at"`
+}
+
+// Provider runs a one-off ping of a target from external probes.
+// Implementations must be safe for concurrent use.
+type Provider interface {
+	// Measure blocks until results are in or ctx expires.
+	Measure(ctx context.Context, target string) (*Result, error)
+
+	// Available returns true if the provider is properly configured.
+	Available() bool
+
+	// Name returns the provider name (e.g., "globalping", "ripe_atlas")
+	Name() string
+}
+
+// ErrNoResults is returned when a measurement finished without any probe
+// reporting back.
+var ErrNoResults = errors.New("no external probe results")
+
+// Config holds vantage configuration loaded from environment
+type Config struct {
+	Provider   string        // "globalping", "ripe_atlas", or "" (disabled)
+	APIKey     string        // Globalping token (optional) or RIPE Atlas key (required)
+	ProbeLimit int           // External probes per measurement (default: 3)
+	Location   string        // Globalping magic location / RIPE Atlas area (default: world)
+	CacheTTL   time.Duration // How long a result is reused (default: 15m)
+	Timeout    time.Duration // Per-measurement timeout (default: 90s)
+}
+
+// LoadConfig loads vantage configuration from environment variables
+func LoadConfig() Config {
+	cfg := Config{
+		Provider:   os.Getenv("VANTAGE_PROVIDER"),
+		APIKey:     os.Getenv("VANTAGE_API_KEY"),
+		ProbeLimit: 3,
+		Location:   os.Getenv("VANTAGE_LOCATION"),
+		CacheTTL:   15 * time.Minute,
+		Timeout:    90 * time.Second,
+	}
+	if v, err := strconv.Atoi(os.Getenv("VANTAGE_PROBE_LIMIT")); err == nil && v > 0 {
+		cfg.ProbeLimit = min(v, 10)
+	}
+	if d, err := time.ParseDuration(os.Getenv("VANTAGE_CACHE_TTL")); err == nil && d > 0 {
+		cfg.CacheTTL = d
+	}
+	return cfg
+}
+
+// NewProvider creates a vantage provider based on configuration.
+// Returns nil if not configured (disabled by default).
+func NewProvider(cfg Config) Provider {
+	switch cfg.Provider {
+	case "globalping":
+		return NewGlobalpingProvider(cfg)
+	case "ripe_atlas", "ripe":
+		if cfg.APIKey == "" {
+			return nil
+		}
+		return NewRIPEAtlasProvider(cfg)
+	default:
+		return nil
+	}
+}
+
+// summarize folds per-probe stats into a Result.
+func summarize(source, target string, probes []probeStat) (*Result, error) {
+	r := &Result{Source: source, Target: target, MeasuredAt: time.Now().UTC()}
+	var sent, recv int
+	var rttSum float64
+	for _, p := range probes {
+		if p.Sent == 0 {
+			continue
+		}
+		r.Probes++
+		sent += p.Sent
+		recv += p.Received
+		if p.Received > 0 {
+			r.Reachable++
+			rttSum += p.AvgRTTMs
+		}
+		if p.Location != "" {
+			r.Locations = append(r.Locations, p.Location)
+		}
+	}
+	if r.Probes == 0 {
+		return nil, ErrNoResults
+	}
+	if r.Reachable > 0 {
+		r.AvgRTTMs = rttSum / float64(r.Reachable)
+	}
+	r.LossPct = float64(sent-recv) / float64(sent) * 100
+	return r, nil
+}
+
+type probeStat struct {
+	Sent     int
+	Received int
+	AvgRTTMs float64
+	Location string
+}
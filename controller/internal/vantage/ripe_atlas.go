@@ -0,0 +1,135 @@
+package vantage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const ripeAtlasURL = "https://atlas.ripe.net/api/v2"
+
+// RIPEAtlasProvider implements Provider with one-off RIPE Atlas ping
+// measurements. Requires an API key with measurement credits; results
+// usually take one to two minutes.
+type RIPEAtlasProvider struct {
+	key     string
+	limit   int
+	area    string
+	timeout time.Duration
+	client  *http.Client
+}
+
+// NewRIPEAtlasProvider creates a RIPE Atlas provider
+func NewRIPEAtlasProvider(cfg Config) *RIPEAtlasProvider {
+	area := cfg.Location
+	if area == "" || area == "world" {
+		area = "WW"
+	}
+	return &RIPEAtlasProvider{
+		key:     cfg.APIKey,
+		limit:   cfg.ProbeLimit,
+		area:    area,
+		timeout: max(cfg.Timeout, 3*time.Minute),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (p *RIPEAtlasProvider) Available() bool { return p.key != "" }
+func (p *RIPEAtlasProvider) Name() string    { return "ripe_atlas" }
+
+func (p *RIPEAtlasProvider) Measure(ctx context.Context, target string) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]any{
+		"definitions": []map[string]any{{
+			"target":           target,
+			"af":               4,
+			"type":             "ping",
+			"packets":          3,
+			"resolve_on_probe": true,
+			"description":      "NetWatcher external vantage check",
+		}},
+		"probes":    []map[string]any{{"requested": p.limit, "type": "area", "value": p.area}},
+		"is_oneoff": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+	var created struct {
+		Measurements []int64 `json:"measurements"`
+	}
+	if err := p.do(ctx, "POST", ripeAtlasURL+"/measurements/", body, &created); err != nil {
+		return nil, err
+	}
+	if len(created.Measurements) == 0 {
+		return nil, fmt.Errorf("ripe atlas returned no measurement id")
+	}
+	id := created.Measurements[0]
+
+	// One-offs have no "finished" flag; poll until every requested probe
+	// reported or the timeout hits, then use what arrived.
+	var results []ripeResult
+	for {
+		select {
+		case <-ctx.Done():
+			if len(results) > 0 {
+				return summarize(p.Name(), target, ripeStats(results))
+			}
+			return nil, fmt.Errorf("ripe atlas measurement %d: %w", id, ctx.Err())
+		case <-time.After(10 * time.Second):
+		}
+		if err := p.do(ctx, "GET", fmt.Sprintf("%s/measurements/%d/results/?format=json", ripeAtlasURL, id), nil, &results); err != nil {
+			continue
+		}
+		if len(results) >= p.limit {
+			return summarize(p.Name(), target, ripeStats(results))
+		}
+	}
+}
+
+type ripeResult struct {
+	ProbeID int64   `json:"prb_id"`
+	Avg     float64 `json:"avg"` // -1 when no replies
+	Sent    int     `json:"sent"`
+	Rcvd    int     `json:"rcvd"`
+}
+
+func ripeStats(results []ripeResult) []probeStat {
+	stats := make([]probeStat, 0, len(results))
+	for _, r := range results {
+		stats = append(stats, probeStat{
+			Sent:     r.Sent,
+			Received: r.Rcvd,
+			AvgRTTMs: max(r.Avg, 0),
+			Location: fmt.Sprintf("probe %d", r.ProbeID),
+		})
+	}
+	return stats
+}
+
+func (p *RIPEAtlasProvider) do(ctx context.Context, method, url string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Key "+p.key)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ripe atlas request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ripe atlas returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- Service Accounts ---
+//
+// Service accounts are non-human principals for provisioning automation
+// (RMM tooling, config management). A service account belongs to one
+// workspace and holds only provisioning scopes: it can create agents and
+// issue bootstrap PINs for agents that have not bootstrapped yet. It is
+// not a workspace member and its key is rejected by every session-
+// authenticated route, so it has no access to probe data, analysis or
+// settings.
+
+// ServiceAccountScope is a provisioning permission.
+type ServiceAccountScope string
+
+const (
+	// ScopeAgentsCreate allows creating agents (with a bootstrap PIN).
+	ScopeAgentsCreate ServiceAccountScope = "agents:create"
+	// ScopeAgentsBootstrap allows issuing PINs for agents not yet bootstrapped.
+	ScopeAgentsBootstrap ServiceAccountScope = "agents:bootstrap"
+)
+
+// ServiceAccountKeyPrefix marks service account keys so they can be told
+// apart from session tokens and workspace API keys.
+const ServiceAccountKeyPrefix = "nwsa_"
+
+func (s ServiceAccountScope) Valid() bool {
+	switch s {
+	case ScopeAgentsCreate, ScopeAgentsBootstrap:
+		return true
+	default:
+		return false
+	}
+}
+
+type ServiceAccount struct {
+	ID          uint                  `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint                  `gorm:"not null;index" json:"workspace_id"`
+	Name        string                `gorm:"size:100;not null" json:"name"`
+	Scopes      string                `gorm:"size:255;not null" json:"-"`            // comma-separated ServiceAccountScope
+	KeyHash     string                `gorm:"size:64;not null;uniqueIndex" json:"-"` // SHA256 hash of the key
+	KeyPrefix   string                `gorm:"size:16;not null" json:"key_prefix"`    // First chars for display
+	CreatedBy   uint                  `gorm:"index" json:"created_by"`               // User who created it
+	CreatedAt   time.Time             `json:"created_at"`
+	LastUsedAt  *time.Time            `json:"last_used_at,omitempty"`
+	ExpiresAt   *time.Time            `gorm:"index" json:"expires_at,omitempty"`
+	DeletedAt   gorm.DeletedAt        `gorm:"index" json:"-"`
+	ScopeList   []ServiceAccountScope `gorm:"-" json:"scopes"`
+}
+
+func (ServiceAccount) TableName() string { return "workspace_service_accounts" }
+
+// AfterFind expands the stored scopes for JSON output.
+func (sa *ServiceAccount) AfterFind(*gorm.DB) error {
+	sa.ScopeList = parseScopes(sa.Scopes)
+	return nil
+}
+
+// HasScope reports whether the account holds scope.
+func (sa *ServiceAccount) HasScope(scope ServiceAccountScope) bool {
+	for _, s := range parseScopes(sa.Scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func parseScopes(raw string) []ServiceAccountScope {
+	out := []ServiceAccountScope{}
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, ServiceAccountScope(p))
+		}
+	}
+	return out
+}
+
+func (s *Store) AutoMigrateServiceAccounts(ctx context.Context) error {
+	return s.db.WithContext(ctx).AutoMigrate(&ServiceAccount{})
+}
+
+type CreateServiceAccountInput struct {
+	WorkspaceID uint                  `json:"workspace_id"`
+	Name        string                `json:"name"`
+	Scopes      []ServiceAccountScope `json:"scopes"`
+	ExpiresAt   *time.Time            `json:"expires_at,omitempty"`
+	CreatedBy   uint                  `json:"-"`
+}
+
+// CreateServiceAccount creates an account and returns its key, shown once.
+// Scopes default to every provisioning scope.
+func (s *Store) CreateServiceAccount(ctx context.Context, in CreateServiceAccountInput) (*ServiceAccount, string, error) {
+	if in.WorkspaceID == 0 || strings.TrimSpace(in.Name) == "" {
+		return nil, "", ErrInvalidInput
+	}
+	if len(in.Scopes) == 0 {
+		in.Scopes = []ServiceAccountScope{ScopeAgentsCreate, ScopeAgentsBootstrap}
+	}
+	seen := make(map[ServiceAccountScope]bool, len(in.Scopes))
+	scopes := make([]string, 0, len(in.Scopes))
+	for _, sc := range in.Scopes {
+		if !sc.Valid() {
+			return nil, "", fmt.Errorf("%w: unknown scope %q", ErrInvalidInput, sc)
+		}
+		if !seen[sc] {
+			seen[sc] = true
+			scopes = append(scopes, string(sc))
+		}
+	}
+	if in.ExpiresAt != nil && in.ExpiresAt.Before(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expires_at is in the past", ErrInvalidInput)
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("generate key: %w", err)
+	}
+	rawKey := ServiceAccountKeyPrefix + secret
+
+	sa := &ServiceAccount{
+		WorkspaceID: in.WorkspaceID,
+		Name:        strings.TrimSpace(in.Name),
+		Scopes:      strings.Join(scopes, ","),
+		KeyHash:     hashServiceAccountKey(rawKey),
+		KeyPrefix:   rawKey[:len(ServiceAccountKeyPrefix)+8],
+		CreatedBy:   in.CreatedBy,
+		ExpiresAt:   in.ExpiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(sa).Error; err != nil {
+		return nil, "", err
+	}
+	sa.ScopeList = parseScopes(sa.Scopes)
+	return sa, rawKey, nil
+}
+
+// ValidateServiceAccountKey resolves a key to its account. It returns nil,
+// nil for unknown, revoked or expired keys.
+func (s *Store) ValidateServiceAccountKey(ctx context.Context, rawKey string) (*ServiceAccount, error) {
+	if !strings.HasPrefix(rawKey, ServiceAccountKeyPrefix) {
+		return nil, nil
+	}
+	var sa ServiceAccount
+	err := s.db.WithContext(ctx).
+		Where("key_hash = ?", hashServiceAccountKey(rawKey)).
+		First(&sa).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if sa.ExpiresAt != nil && sa.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	s.db.WithContext(ctx).Model(&sa).Update("last_used_at", time.Now())
+
+	return &sa, nil
+}
+
+func (s *Store) ListServiceAccounts(ctx context.Context, workspaceID uint) ([]ServiceAccount, error) {
+	var out []ServiceAccount
+	err := s.db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("created_at DESC").
+		Find(&out).Error
+	return out, err
+}
+
+// DeleteServiceAccount revokes an account; its key stops working at once.
+func (s *Store) DeleteServiceAccount(ctx context.Context, id, workspaceID uint) error {
+	res := s.db.WithContext(ctx).
+		Where("id = ? AND workspace_id = ?", id, workspaceID).
+		Delete(&ServiceAccount{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func hashServiceAccountKey(rawKey string) string {
+	h := sha256.Sum256([]byte(rawKey))
+	return fmt.Sprintf("%x", h)
+}
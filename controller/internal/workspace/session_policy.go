@@ -0,0 +1,48 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SessionSettings is the "session" key of Workspace.Settings: limits a
+// workspace puts on its members' login sessions. Zero fields defer to the
+// controller defaults. A user in several workspaces gets the strictest
+// combination.
+type SessionSettings struct {
+	AccessTokenMinutes int   `json:"access_token_minutes,omitempty"`
+	IdleTimeoutMinutes int   `json:"idle_timeout_minutes,omitempty"`
+	MaxLifetimeHours   int   `json:"max_lifetime_hours,omitempty"`
+	Sliding            *bool `json:"sliding,omitempty"` // nil = sliding allowed
+}
+
+// ParseSessionSettings reads the session key from a settings blob; ok is
+// false when the workspace sets none.
+func ParseSessionSettings(settings []byte) (s SessionSettings, ok bool) {
+	if len(settings) == 0 {
+		return s, false
+	}
+	var blob struct {
+		Session *SessionSettings `json:"session"`
+	}
+	if err := json.Unmarshal(settings, &blob); err != nil || blob.Session == nil {
+		return s, false
+	}
+	return *blob.Session, true
+}
+
+// MemberSessionSettings returns the session settings of every workspace
+// the user belongs to that sets any.
+func (s *Store) MemberSessionSettings(ctx context.Context, userID uint) ([]SessionSettings, error) {
+	wss, err := s.ListWorkspacesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var out []SessionSettings
+	for _, ws := range wss {
+		if ss, ok := ParseSessionSettings(ws.Settings); ok {
+			out = append(out, ss)
+		}
+	}
+	return out, nil
+}
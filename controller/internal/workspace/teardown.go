@@ -0,0 +1,560 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ── Staged Deletion ──
+//
+// Deleting a workspace is a staged teardown, not a single cascade:
+//
+//  1. disable: ScheduleDeletion sets workspaces.disabled_at. Agents of a
+//     disabled workspace are refused at login and its share links stop
+//     resolving; members can still open it.
+//  2. retain: until PurgeAt (WORKSPACE_DELETION_RETENTION_DAYS after the
+//     request) RestoreWorkspace undoes the deletion.
+//  3. purge Postgres: PurgeDue hard-deletes every row keyed by the
+//     workspace, its agents and its probes, soft-deleted ones included,
+//     in one transaction.
+//  4. purge ClickHouse: one deletion job per agent removes its probe_data
+//     and speedtest_data rows, which carry no workspace_id, and one
+//     workspace job removes the analysis snapshots, their enrichments and
+//     versions. The tables are partitioned by month, not by workspace, so
+//     the rows go through the deletion worker's mutations rather than a
+//     partition drop. TrackPurged completes the deletion once every job
+//     has finished.
+//
+// The Deletion row outlives the workspace so the teardown can be followed
+// to the end.
+
+// Deletion statuses.
+const (
+	DeletionScheduled = "scheduled" // disabled, within the undo window
+	DeletionCanceled  = "canceled"  // restored before the purge
+	DeletionPurging   = "purging"   // Postgres purge in progress
+	DeletionPurged    = "purged"    // Postgres rows gone, ClickHouse jobs running
+	DeletionCompleted = "completed"
+	DeletionFailed    = "failed" // the Postgres purge exhausted its retries
+)
+
+// maxPurgeAttempts bounds Postgres purge retries.
+const maxPurgeAttempts = 5
+
+var (
+	ErrDeletionScheduled = errors.New("workspace deletion already scheduled")
+	ErrUndoWindowClosed  = errors.New("workspace purge has started, deletion can no longer be undone")
+)
+
+// Deletion records one staged workspace deletion.
+type Deletion struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	WorkspaceID   uint   `gorm:"not null;index" json:"workspace_id"`
+	WorkspaceName string `gorm:"size:200" json:"workspace_name"`
+	RequestedBy   uint   `json:"requested_by"`
+	Status        string `gorm:"size:20;not null;index" json:"status"`
+
+	PurgeAt        time.Time  `gorm:"index" json:"purge_at"` // end of the undo window
+	CanceledAt     *time.Time `json:"canceled_at,omitempty"`
+	CanceledBy     uint       `json:"canceled_by,omitempty"`
+	PurgeStartedAt *time.Time `json:"purge_started_at,omitempty"`
+	PurgedAt       *time.Time `json:"purged_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+
+	// AgentIDs are the purged agents (comma-separated) whose probe_data
+	// the deletion worker removes.
+	AgentIDs   string `gorm:"type:text" json:"-"`
+	RowsPurged int64  `json:"rows_purged"`
+	Attempts   int    `json:"attempts"`
+	LastError  string `gorm:"type:text" json:"last_error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Deletion) TableName() string { return "workspace_deletions" }
+
+func (d *Deletion) agentIDs() []uint {
+	var out []uint
+	for _, s := range strings.Split(d.AgentIDs, ",") {
+		if id, err := strconv.ParseUint(s, 10, 64); err == nil && id > 0 {
+			out = append(out, uint(id))
+		}
+	}
+	return out
+}
+
+// chJobs lists the ClickHouse cleanup jobs of a purge by entity type.
+func (d *Deletion) chJobs() map[string][]uint {
+	return map[string][]uint{
+		deletion.EntityAgent:     d.agentIDs(),
+		deletion.EntityWorkspace: {d.WorkspaceID},
+	}
+}
+
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// IsDisabled reports whether the workspace is disabled pending deletion.
+// Lookup errors report false so a database hiccup doesn't lock agents out.
+func IsDisabled(ctx context.Context, db *gorm.DB, id uint) bool {
+	var n int64
+	if err := db.WithContext(ctx).Model(&Workspace{}).
+		Where("id = ? AND disabled_at IS NOT NULL", id).
+		Count(&n).Error; err != nil {
+		return false
+	}
+	return n > 0
+}
+
+// ScheduleDeletion disables the workspace and schedules its purge once
+// retention has passed.
+func (s *Store) ScheduleDeletion(ctx context.Context, id, userID uint, retention time.Duration) (*Deletion, error) {
+	if retention < 0 {
+		retention = 0
+	}
+	now := time.Now()
+	var d *Deletion
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ws Workspace
+		if err := tx.First(&ws, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+		res := tx.Model(&Workspace{}).Where("id = ? AND disabled_at IS NULL", id).Update("disabled_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDeletionScheduled
+		}
+		d = &Deletion{
+			WorkspaceID:   id,
+			WorkspaceName: ws.Name,
+			RequestedBy:   userID,
+			Status:        DeletionScheduled,
+			PurgeAt:       now.Add(retention),
+		}
+		return tx.Create(d).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// RestoreWorkspace undoes a scheduled deletion before its purge and
+// re-enables the workspace.
+func (s *Store) RestoreWorkspace(ctx context.Context, id, userID uint) (*Deletion, error) {
+	now := time.Now()
+	var d Deletion
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", id).Order("id DESC").First(&d).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if d.Status == DeletionCanceled {
+			return ErrNotFound
+		}
+		res := tx.Model(&Deletion{}).
+			Where("id = ? AND status = ? AND purge_at > ?", d.ID, DeletionScheduled, now).
+			Updates(map[string]any{"status": DeletionCanceled, "canceled_at": now, "canceled_by": userID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUndoWindowClosed
+		}
+		return tx.Model(&Workspace{}).Where("id = ?", id).Update("disabled_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.Status, d.CanceledAt, d.CanceledBy = DeletionCanceled, &now, userID
+	return &d, nil
+}
+
+// GetDeletion returns the latest deletion of a workspace.
+func (s *Store) GetDeletion(ctx context.Context, workspaceID uint) (*Deletion, error) {
+	var d Deletion
+	if err := s.db.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("id DESC").First(&d).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDeletions returns recent deletions, newest first, optionally
+// filtered by status.
+func (s *Store) ListDeletions(ctx context.Context, status string, limit int) ([]Deletion, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	q := s.db.WithContext(ctx).Order("id DESC").Limit(limit)
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var out []Deletion
+	return out, q.Find(&out).Error
+}
+
+// ── Purge ──
+
+// Rows removed with a workspace, by the column that ties them to it.
+// Tables a deployment lacks, or that lack the column, are skipped.
+var (
+	purgeProbeTables = []string{"probe_targets", "alert_rules", "alerts", "route_baselines"}
+	purgeAgentTables = []string{
+		"probe_targets", "probes", "share_links", "agent_speedtest_servers", "speedtest_queue",
+		"agent_pins", "agent_status_events", "agent_connection_audit", "agent_public_ips",
+	}
+	purgeWorkspaceTables = []string{
+		"probes", "alert_rules", "alerts", "alert_silences", "maintenance_windows",
+		"workspace_notification_policies", "share_links", "badges", "speedtest_queue",
+		"target_catalog", "target_groups", "target_criticality", "target_maintenance",
+		"incident_history", "incident_samples", "incident_evidence", "incident_map_snapshots",
+		"incident_tickets", "ticket_integrations", "runbooks", "timeline_annotations", "onboarding_runs",
+		"analysis_reprocess_jobs", "workspace_default_probes", "data_streams", "report_configs",
+		"workspace_feature_flags", "workspace_llm_settings", "llm_usage", "llm_enrichment_jobs",
+		"workspace_api_keys", "workspace_service_accounts", "workspace_audit_log",
+		"agents", "workspace_members",
+	}
+)
+
+// purgeRows hard-deletes the workspace and every row keyed by it, its
+// agents or its probes, and returns the purged agent IDs.
+func (s *Store) purgeRows(ctx context.Context, id uint) ([]uint, int64, error) {
+	var agentIDs []uint
+	var total int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("agents").Where("workspace_id = ?", id).Pluck("id", &agentIDs).Error; err != nil {
+			return err
+		}
+		var probeIDs []uint
+		q := tx.Table("probes").Where("workspace_id = ?", id)
+		if len(agentIDs) > 0 {
+			q = q.Or("agent_id IN ?", agentIDs)
+		}
+		if err := q.Pluck("id", &probeIDs).Error; err != nil {
+			return err
+		}
+
+		purge := func(tables []string, column string, ids []uint) error {
+			if len(ids) == 0 {
+				return nil
+			}
+			for _, table := range tables {
+				if !tx.Migrator().HasColumn(table, column) {
+					continue
+				}
+				res := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s IN ?", table, column), ids)
+				if res.Error != nil {
+					return fmt.Errorf("purge %s: %w", table, res.Error)
+				}
+				total += res.RowsAffected
+			}
+			return nil
+		}
+		if err := purge(purgeProbeTables, "probe_id", probeIDs); err != nil {
+			return err
+		}
+		if err := purge(purgeAgentTables, "agent_id", agentIDs); err != nil {
+			return err
+		}
+		if err := purge(purgeWorkspaceTables, "workspace_id", []uint{id}); err != nil {
+			return err
+		}
+		res := tx.Exec("DELETE FROM workspaces WHERE id = ?", id)
+		if res.Error != nil {
+			return fmt.Errorf("purge workspaces: %w", res.Error)
+		}
+		total += res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return agentIDs, total, nil
+}
+
+// PurgeDue purges up to limit workspaces whose undo window has closed and
+// returns how many were purged. The deletion store may be nil in tests.
+func (s *Store) PurgeDue(ctx context.Context, deletionStore *deletion.QueueStore, now time.Time, limit int) (int, error) {
+	var due []Deletion
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND purge_at <= ?", DeletionScheduled, now).
+		Order("purge_at ASC").
+		Limit(limit).
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, d := range due {
+		ok, err := s.purge(ctx, deletionStore, d)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"workspace_id": d.WorkspaceID, "deletion_id": d.ID}).
+				Error("workspace.PurgeDue: purge failed")
+			continue
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purge runs the Postgres purge for one deletion and enqueues its
+// ClickHouse jobs. It reports false when the deletion was restored or
+// claimed elsewhere in the meantime.
+func (s *Store) purge(ctx context.Context, deletionStore *deletion.QueueStore, d Deletion) (bool, error) {
+	now := time.Now()
+	claim := s.db.WithContext(ctx).Model(&Deletion{}).
+		Where("id = ? AND status = ?", d.ID, DeletionScheduled).
+		Updates(map[string]any{
+			"status":           DeletionPurging,
+			"purge_started_at": now,
+			"attempts":         gorm.Expr("attempts + 1"),
+		})
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return false, nil
+	}
+
+	agentIDs, rows, err := s.purgeRows(ctx, d.WorkspaceID)
+	if err != nil {
+		attempts := d.Attempts + 1
+		updates := map[string]any{"last_error": err.Error()}
+		if attempts >= maxPurgeAttempts {
+			updates["status"] = DeletionFailed
+		} else {
+			updates["status"] = DeletionScheduled
+			updates["purge_at"] = now.Add(deletion.BackoffDuration(attempts))
+		}
+		if uerr := s.db.WithContext(ctx).Model(&Deletion{}).Where("id = ?", d.ID).Updates(updates).Error; uerr != nil {
+			log.WithError(uerr).WithField("deletion_id", d.ID).Error("workspace.purge: failed to record purge error")
+		}
+		return false, err
+	}
+
+	if deletionStore != nil {
+		d.AgentIDs = joinIDs(agentIDs)
+		for entity, ids := range d.chJobs() {
+			for _, id := range ids {
+				if err := deletionStore.Enqueue(ctx, entity, id); err != nil {
+					log.WithError(err).WithFields(log.Fields{"entity_type": entity, "entity_id": id}).
+						Error("workspace.purge: failed to enqueue CH cleanup")
+				}
+			}
+		}
+	}
+
+	done := time.Now()
+	updates := map[string]any{
+		"status":      DeletionPurged,
+		"purged_at":   done,
+		"agent_ids":   joinIDs(agentIDs),
+		"rows_purged": rows,
+		"last_error":  "",
+	}
+	if deletionStore == nil && len(agentIDs) == 0 {
+		updates["status"] = DeletionCompleted
+		updates["completed_at"] = done
+	}
+	if err := s.db.WithContext(ctx).Model(&Deletion{}).Where("id = ?", d.ID).Updates(updates).Error; err != nil {
+		return true, err
+	}
+	log.WithFields(log.Fields{"workspace_id": d.WorkspaceID, "agents": len(agentIDs), "rows": rows}).
+		Info("workspace purged from Postgres")
+	return true, nil
+}
+
+// TrackPurged completes purged deletions whose ClickHouse jobs have all
+// finished, and re-enqueues jobs that are missing because the enqueue
+// after the purge failed.
+func (s *Store) TrackPurged(ctx context.Context, deletionStore *deletion.QueueStore) (int, error) {
+	if deletionStore == nil {
+		return 0, nil
+	}
+	var purged []Deletion
+	if err := s.db.WithContext(ctx).Where("status = ?", DeletionPurged).Find(&purged).Error; err != nil {
+		return 0, err
+	}
+	completed := 0
+	for _, d := range purged {
+		p, missing, err := chProgress(ctx, deletionStore, &d)
+		if err != nil {
+			return completed, err
+		}
+		for entity, ids := range missing {
+			for _, id := range ids {
+				if err := deletionStore.Enqueue(ctx, entity, id); err != nil {
+					log.WithError(err).WithFields(log.Fields{"entity_type": entity, "entity_id": id}).
+						Warn("workspace.TrackPurged: enqueue CH cleanup failed")
+				}
+			}
+		}
+		if p.Open > 0 || p.Missing > 0 {
+			continue
+		}
+		updates := map[string]any{"status": DeletionCompleted, "completed_at": time.Now()}
+		if p.Failed > 0 {
+			updates["last_error"] = fmt.Sprintf("%d ClickHouse cleanup job(s) failed", p.Failed)
+		}
+		if err := s.db.WithContext(ctx).Model(&Deletion{}).Where("id = ?", d.ID).Updates(updates).Error; err != nil {
+			return completed, err
+		}
+		completed++
+	}
+	return completed, nil
+}
+
+// ── Progress ──
+
+// Step states.
+const (
+	StepPending  = "pending"
+	StepActive   = "active"
+	StepDone     = "done"
+	StepFailed   = "failed"
+	StepCanceled = "canceled"
+)
+
+// DeletionStep is one stage of a teardown. At is when the step finished,
+// or for an active retain step, when it ends.
+type DeletionStep struct {
+	Name  string     `json:"name"`
+	State string     `json:"state"`
+	At    *time.Time `json:"at,omitempty"`
+}
+
+// DeletionCHProgress counts the ClickHouse cleanup jobs of a purge, one per
+// purged agent plus one for the workspace, by state.
+type DeletionCHProgress struct {
+	Agents  int `json:"agents"`
+	Jobs    int `json:"jobs"`
+	Done    int `json:"done"`
+	Open    int `json:"open"`
+	Failed  int `json:"failed"`
+	Missing int `json:"missing"`
+}
+
+// DeletionStatus is a deletion with its teardown progress.
+type DeletionStatus struct {
+	Deletion
+	CanUndo    bool                `json:"can_undo"`
+	Steps      []DeletionStep      `json:"steps"`
+	Progress   float64             `json:"progress"` // percent
+	ClickHouse *DeletionCHProgress `json:"clickhouse,omitempty"`
+}
+
+// DeletionStatus returns the latest deletion of a workspace with its
+// progress. The deletion store may be nil, leaving out job counts.
+func (s *Store) DeletionStatus(ctx context.Context, deletionStore *deletion.QueueStore, workspaceID uint) (*DeletionStatus, error) {
+	d, err := s.GetDeletion(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	var ch *DeletionCHProgress
+	if deletionStore != nil && (d.Status == DeletionPurged || d.Status == DeletionCompleted) {
+		p, _, err := chProgress(ctx, deletionStore, d)
+		if err != nil {
+			return nil, err
+		}
+		ch = &p
+	}
+	st := deletionStatus(*d, ch, time.Now())
+	return &st, nil
+}
+
+// chProgress counts the ClickHouse jobs of a purge by state and returns
+// the missing ones by entity type.
+func chProgress(ctx context.Context, deletionStore *deletion.QueueStore, d *Deletion) (DeletionCHProgress, map[string][]uint, error) {
+	var p DeletionCHProgress
+	missing := map[string][]uint{}
+	for entity, ids := range d.chJobs() {
+		done, open, failed, miss, err := deletionStore.EntityProgress(ctx, entity, ids)
+		if err != nil {
+			return p, nil, err
+		}
+		if entity == deletion.EntityAgent {
+			p.Agents = len(ids)
+		}
+		p.Jobs += len(ids)
+		p.Done += done
+		p.Open += open
+		p.Failed += failed
+		p.Missing += len(miss)
+		if len(miss) > 0 {
+			missing[entity] = miss
+		}
+	}
+	return p, missing, nil
+}
+
+// deletionStatus derives the steps and progress of a deletion.
+func deletionStatus(d Deletion, ch *DeletionCHProgress, now time.Time) DeletionStatus {
+	created, purgeAt := d.CreatedAt, d.PurgeAt
+	disable := DeletionStep{Name: "disable", State: StepDone, At: &created}
+	retain := DeletionStep{Name: "retain", State: StepDone, At: d.PurgeStartedAt}
+	postgres := DeletionStep{Name: "purge_postgres", State: StepPending}
+	clickhouse := DeletionStep{Name: "purge_clickhouse", State: StepPending}
+
+	switch d.Status {
+	case DeletionScheduled:
+		retain.State, retain.At = StepActive, &purgeAt
+	case DeletionCanceled:
+		retain.State, retain.At = StepCanceled, d.CanceledAt
+		postgres.State, clickhouse.State = StepCanceled, StepCanceled
+	case DeletionPurging:
+		postgres.State = StepActive
+	case DeletionFailed:
+		postgres.State = StepFailed
+	case DeletionPurged:
+		postgres.State, postgres.At = StepDone, d.PurgedAt
+		clickhouse.State = StepActive
+	case DeletionCompleted:
+		postgres.State, postgres.At = StepDone, d.PurgedAt
+		clickhouse.State, clickhouse.At = StepDone, d.CompletedAt
+		if ch != nil && ch.Failed > 0 {
+			clickhouse.State = StepFailed
+		}
+	}
+
+	st := DeletionStatus{
+		Deletion:   d,
+		CanUndo:    d.Status == DeletionScheduled && now.Before(d.PurgeAt),
+		Steps:      []DeletionStep{disable, retain, postgres, clickhouse},
+		ClickHouse: ch,
+	}
+	for _, step := range st.Steps {
+		if step.State == StepDone {
+			st.Progress += 25
+		}
+	}
+	if clickhouse.State == StepActive && ch != nil && ch.Jobs > 0 {
+		st.Progress += 25 * float64(ch.Done+ch.Failed) / float64(ch.Jobs)
+	}
+	return st
+}
@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/deletion"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func countRows(t *testing.T, db *gorm.DB, table, where string, args ...any) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Table(table).Where(where, args...).Count(&n).Error; err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+// TestStagedDeletion walks a workspace through disable, undo, purge and
+// ClickHouse cleanup.
+func TestStagedDeletion(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ws.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	ctx := context.Background()
+	s := NewStore(db)
+	if err := s.AutoMigrate(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	dq := deletion.NewQueueStore(db)
+	if err := dq.AutoMigrate(ctx); err != nil {
+		t.Fatalf("migrate deletion jobs: %v", err)
+	}
+	for _, q := range []string{
+		"CREATE TABLE agents (id INTEGER PRIMARY KEY, workspace_id INTEGER, deleted_at DATETIME)",
+		"CREATE TABLE probes (id INTEGER PRIMARY KEY, workspace_id INTEGER, agent_id INTEGER)",
+		"CREATE TABLE probe_targets (id INTEGER PRIMARY KEY, probe_id INTEGER, agent_id INTEGER)",
+		"CREATE TABLE share_links (id INTEGER PRIMARY KEY, workspace_id INTEGER, agent_id INTEGER)",
+	} {
+		if err := db.Exec(q).Error; err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	ws, _ := s.CreateWorkspace(ctx, CreateWorkspaceInput{Name: "doomed", OwnerID: 1})
+	other, _ := s.CreateWorkspace(ctx, CreateWorkspaceInput{Name: "kept", OwnerID: 1})
+	db.Exec("INSERT INTO agents VALUES (10, ?, NULL), (11, ?, CURRENT_TIMESTAMP)", ws.ID, ws.ID)
+	db.Exec("INSERT INTO probes VALUES (100, ?, 10)", ws.ID)
+	db.Exec("INSERT INTO probe_targets VALUES (1000, 100, 10)")
+	db.Exec("INSERT INTO share_links VALUES (1, ?, 10)", ws.ID)
+	db.Exec("INSERT INTO agents VALUES (20, ?, NULL)", other.ID)
+
+	// Disable, then undo.
+	if _, err := s.ScheduleDeletion(ctx, ws.ID, 1, time.Hour); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+	if !IsDisabled(ctx, db, ws.ID) || IsDisabled(ctx, db, other.ID) {
+		t.Fatal("only the scheduled workspace should be disabled")
+	}
+	if _, err := s.ScheduleDeletion(ctx, ws.ID, 1, time.Hour); !errors.Is(err, ErrDeletionScheduled) {
+		t.Errorf("second schedule err = %v, want ErrDeletionScheduled", err)
+	}
+	if st, _ := s.DeletionStatus(ctx, dq, ws.ID); !st.CanUndo || st.Steps[1].State != StepActive || st.Progress != 25 {
+		t.Errorf("scheduled status = %+v", st)
+	}
+	if d, err := s.RestoreWorkspace(ctx, ws.ID, 2); err != nil || d.Status != DeletionCanceled || d.CanceledBy != 2 {
+		t.Fatalf("restore = %+v, %v", d, err)
+	}
+	if IsDisabled(ctx, db, ws.ID) {
+		t.Error("restored workspace is still disabled")
+	}
+	if _, err := s.RestoreWorkspace(ctx, ws.ID, 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second restore err = %v, want ErrNotFound", err)
+	}
+
+	// Once the window has closed there is no undo.
+	if _, err := s.ScheduleDeletion(ctx, ws.ID, 1, 0); err != nil {
+		t.Fatalf("reschedule: %v", err)
+	}
+	if _, err := s.RestoreWorkspace(ctx, ws.ID, 2); !errors.Is(err, ErrUndoWindowClosed) {
+		t.Errorf("late restore err = %v, want ErrUndoWindowClosed", err)
+	}
+
+	// Purge Postgres.
+	if n, err := s.PurgeDue(ctx, dq, time.Now().Add(time.Second), 10); err != nil || n != 1 {
+		t.Fatalf("purge = %d, %v", n, err)
+	}
+	for table, where := range map[string]string{
+		"workspaces": "id = ?", "workspace_members": "workspace_id = ?", "agents": "workspace_id = ?",
+		"probes": "workspace_id = ?", "share_links": "workspace_id = ?",
+	} {
+		if n := countRows(t, db, table, where, ws.ID); n != 0 {
+			t.Errorf("%s: %d rows left", table, n)
+		}
+	}
+	if n := countRows(t, db, "probe_targets", "probe_id = 100"); n != 0 {
+		t.Errorf("probe_targets: %d rows left", n)
+	}
+	if countRows(t, db, "agents", "id = 20") != 1 || countRows(t, db, "workspaces", "id = ?", other.ID) != 1 {
+		t.Error("purge touched another workspace")
+	}
+	st, err := s.DeletionStatus(ctx, dq, ws.ID)
+	if err != nil || st.Status != DeletionPurged || st.RowsPurged == 0 || st.ClickHouse == nil || st.ClickHouse.Agents != 2 || st.ClickHouse.Jobs != 3 || st.ClickHouse.Open != 3 || st.Progress != 75 {
+		t.Fatalf("purged status = %+v, %v", st, err)
+	}
+
+	// ClickHouse cleanup.
+	jobs, _ := dq.ListPending(ctx, 10)
+	if len(jobs) != 3 {
+		t.Fatalf("%d deletion jobs, want one per agent and one for the workspace", len(jobs))
+	}
+	var wsJobs int
+	for _, j := range jobs {
+		if j.EntityType == deletion.EntityWorkspace && j.EntityID == ws.ID {
+			wsJobs++
+		}
+	}
+	if wsJobs != 1 {
+		t.Errorf("%d workspace deletion jobs, want 1", wsJobs)
+	}
+	_ = dq.MarkCompleted(ctx, jobs[0].ID)
+	if n, _ := s.TrackPurged(ctx, dq); n != 0 {
+		t.Error("deletion completed with a job open")
+	}
+	if st, _ := s.DeletionStatus(ctx, dq, ws.ID); st.Progress != 75+25.0/3 {
+		t.Errorf("partly cleaned progress = %.1f, want 83.3", st.Progress)
+	}
+	_ = dq.MarkCompleted(ctx, jobs[1].ID)
+	_ = dq.MarkCompleted(ctx, jobs[2].ID)
+	if n, _ := s.TrackPurged(ctx, dq); n != 1 {
+		t.Error("deletion not completed")
+	}
+	if st, _ := s.DeletionStatus(ctx, dq, ws.ID); st.Status != DeletionCompleted || st.Progress != 100 || st.CanUndo {
+		t.Errorf("completed status = %+v", st)
+	}
+}
@@ -10,13 +10,11 @@ import (
 	"strings"
 	"time"
 
-	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/sqlsafe"
 
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // --- Roles ---
@@ -39,6 +37,19 @@ func (r Role) Valid() bool {
 	}
 }
 
+// roleRank orders roles in the hierarchy; unknown roles rank 0.
+var roleRank = map[Role]int{
+	RoleViewer: 1,
+	RoleUser:   2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// AtLeast returns true if r >= minRole in the hierarchy.
+func (r Role) AtLeast(minRole Role) bool {
+	return roleRank[r] >= roleRank[minRole]
+}
+
 // --- Models ---
 
 type Workspace struct {
@@ -50,6 +61,10 @@ type Workspace struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// DisabledAt is set while the workspace is scheduled for deletion
+	// (see teardown.go).
+	DisabledAt *time.Time `gorm:"index" json:"disabled_at,omitempty"`
+
 	// denormalized convenience
 	Description string `gorm:"size:255" json:"description"`
 }
@@ -105,7 +120,7 @@ func NewStore(db *gorm.DB) *Store {
 
 // AutoMigrate applies schema and helpful indexes. Call once at startup.
 func (s *Store) AutoMigrate(ctx context.Context) error {
-	if err := s.db.WithContext(ctx).AutoMigrate(&Workspace{}, &Member{}); err != nil {
+	if err := s.db.WithContext(ctx).AutoMigrate(&Workspace{}, &Member{}, &Deletion{}); err != nil {
 		return err
 	}
 	// helpful composite indexes
@@ -210,10 +225,7 @@ func (s *Store) ListWorkspaces(ctx context.Context, f ListWorkspacesFilter) ([]W
 	if f.OwnerID != 0 {
 		db = db.Where("owner_id = ?", f.OwnerID)
 	}
-	if q := strings.TrimSpace(f.Query); q != "" {
-		pat := "%" + strings.ToLower(q) + "%"
-		db = db.Where("LOWER(name) LIKE ?", pat, pat)
-	}
+	db = sqlsafe.Search(db, f.Query, "name")
 	limit := f.Limit
 	if limit <= 0 || limit > 200 {
 		limit = 50
@@ -278,98 +290,6 @@ func (s *Store) UpdateWorkspace(ctx context.Context, id uint, in UpdateWorkspace
 	return &ws, nil
 }
 
-// DeleteWorkspace soft-deletes the workspace and every dependent row
-// (agents, probes, targets, alert rules, alerts, route baselines, share
-// links, speedtest queue items, agent auth PINs, members). It then enqueues
-// one ClickHouse cleanup job per agent in the workspace so that the
-// background deletion worker can purge the matching probe_data rows off the
-// request thread. The deletion store may be nil in tests.
-func (s *Store) DeleteWorkspace(ctx context.Context, deletionStore *deletion.QueueStore, id uint) error {
-	var agentIDs []uint
-	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&wsAgent{}).Where("workspace_id = ?", id).Pluck("id", &agentIDs).Error; err != nil {
-			return err
-		}
-
-		if len(agentIDs) > 0 {
-			var probeIDs []uint
-			if err := tx.Model(&wsProbe{}).Where("agent_id IN ?", agentIDs).Pluck("id", &probeIDs).Error; err != nil {
-				return err
-			}
-
-			if len(probeIDs) > 0 {
-				if err := tx.Where("probe_id IN ?", probeIDs).Delete(&wsTarget{}).Error; err != nil {
-					return err
-				}
-				if err := tx.Where("probe_id IN ?", probeIDs).Delete(&wsAlertRule{}).Error; err != nil {
-					return err
-				}
-				if err := tx.Where("probe_id IN ?", probeIDs).Delete(&wsAlert{}).Error; err != nil {
-					return err
-				}
-				if err := tx.Where("probe_id IN ?", probeIDs).Delete(&wsRouteBaseline{}).Error; err != nil {
-					return err
-				}
-				if err := tx.Where("agent_id IN ?", agentIDs).Delete(&wsProbe{}).Error; err != nil {
-					return err
-				}
-			}
-
-			if err := tx.Where("agent_id IN ?", agentIDs).Delete(&wsShareLink{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("agent_id IN ?", agentIDs).Delete(&wsSpeedtestServer{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("agent_id IN ?", agentIDs).Delete(&wsSpeedtestQueue{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("agent_id IN ?", agentIDs).Delete(&wsAgentPin{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("workspace_id = ?", id).Delete(&wsAgent{}).Error; err != nil {
-				return err
-			}
-		}
-
-		if err := tx.Where("workspace_id = ?", id).Delete(&wsAlertRule{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Where("workspace_id = ?", id).Delete(&wsAlert{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Where("workspace_id = ?", id).Delete(&wsShareLink{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Where("workspace_id = ?", id).Delete(&wsSpeedtestQueue{}).Error; err != nil {
-			return err
-		}
-		if err := tx.Where("workspace_id = ?", id).Delete(&Member{}).Error; err != nil {
-			return err
-		}
-
-		res := tx.Delete(&Workspace{}, "id = ?", id)
-		if res.Error != nil {
-			return res.Error
-		}
-		if res.RowsAffected == 0 {
-			return ErrNotFound
-		}
-		return nil
-	}); err != nil {
-		return err
-	}
-
-	if deletionStore != nil {
-		for _, aid := range agentIDs {
-			if err := deletionStore.Enqueue(ctx, deletion.EntityAgent, aid); err != nil {
-				log.WithError(err).WithField("agent_id", aid).Error("workspace.DeleteWorkspace: failed to enqueue CH cleanup")
-			}
-		}
-	}
-	return nil
-}
-
 // --- Member API ---
 
 type AddMemberInput struct {
@@ -591,83 +511,9 @@ func (s *Store) UserHasRole(ctx context.Context, workspaceID, userID uint, minRo
 	if err != nil {
 		return false
 	}
-	return roleAtLeast(m.Role, minRole)
-}
-
-// roleAtLeast returns true if role >= minRole in the hierarchy.
-func roleAtLeast(role, minRole Role) bool {
-	hierarchy := map[Role]int{
-		RoleViewer: 1,
-		RoleUser:   2,
-		RoleAdmin:  3,
-		RoleOwner:  4,
-	}
-	return hierarchy[role] >= hierarchy[minRole]
-}
-
-// -------------------- Local table models for cascade deletion --------------------
-// These avoid circular imports with other packages.
-
-type wsAgent struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsAgent) TableName() string { return "agents" }
-
-type wsProbe struct {
-	ID uint `gorm:"primaryKey"`
+	return m.Role.AtLeast(minRole)
 }
 
-func (wsProbe) TableName() string { return "probes" }
-
-type wsTarget struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsTarget) TableName() string { return "probe_targets" }
-
-type wsAlertRule struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsAlertRule) TableName() string { return "alert_rules" }
-
-type wsAlert struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsAlert) TableName() string { return "alerts" }
-
-type wsRouteBaseline struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsRouteBaseline) TableName() string { return "route_baselines" }
-
-type wsShareLink struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsShareLink) TableName() string { return "share_links" }
-
-type wsSpeedtestServer struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsSpeedtestServer) TableName() string { return "agent_speedtest_servers" }
-
-type wsSpeedtestQueue struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsSpeedtestQueue) TableName() string { return "speedtest_queue" }
-
-type wsAgentPin struct {
-	ID uint `gorm:"primaryKey"`
-}
-
-func (wsAgentPin) TableName() string { return "agent_pins" }
-
 // --- Workspace API Keys ---
 
 type WorkspaceAPIKey struct {
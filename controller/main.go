@@ -15,26 +15,33 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"netwatcher-controller/internal/admin"
+	"netwatcher-controller/internal/bootstrap"
 	"netwatcher-controller/internal/database"
+	"netwatcher-controller/internal/datastream"
 	"netwatcher-controller/internal/deletion"
+	"netwatcher-controller/internal/devdata"
 	"netwatcher-controller/internal/email"
+	"netwatcher-controller/internal/features"
 	"netwatcher-controller/internal/geoip"
 	"netwatcher-controller/internal/llm"
+	"netwatcher-controller/internal/logging"
 	"netwatcher-controller/internal/logloki"
 	"netwatcher-controller/internal/metrics"
 	"netwatcher-controller/internal/oui"
 	"netwatcher-controller/internal/probe"
 	"netwatcher-controller/internal/reports"
 	"netwatcher-controller/internal/scheduler"
+	"netwatcher-controller/internal/selfmon"
+	"netwatcher-controller/internal/settings"
+	"netwatcher-controller/internal/vantage"
 	"netwatcher-controller/web"
 )
 
 func main() {
 	_ = godotenv.Load()
 
-	if os.Getenv("DEBUG") == "true" {
-		log.SetLevel(log.DebugLevel)
-	}
+	// Global and per-subsystem log levels (LOG_LEVEL, LOG_LEVELS, DEBUG).
+	logging.Configure()
 
 	// ---- DB ----
 	db, err := database.OpenFromEnv()
@@ -47,8 +54,22 @@ func main() {
 		log.WithError(err).Fatal("db index creation failed")
 	}
 
+	// ---- Feature Flags (shared cache for analysis loop and API) ----
+	features.Default(db)
+
+	// ---- Runtime Settings (admin overrides of selected env vars) ----
+	// Loaded before any subsystem reads its configuration.
+	runtimeSettings := settings.Default(db)
+
 	// ---- Admin Bootstrap ----
+	// BOOTSTRAP_FILE may override the admin credentials and seeds the
+	// workspace and agents below once the schema is in place.
+	bootSpec, err := bootstrap.LoadSpec()
+	if err != nil {
+		log.WithError(err).Fatal("bootstrap file invalid")
+	}
 	adminCfg := admin.LoadConfigFromEnv()
+	bootSpec.ApplyAdmin(&adminCfg)
 	if err := admin.BootstrapDefaultAdmin(context.Background(), db, adminCfg); err != nil {
 		log.WithError(err).Fatal("admin bootstrap failed")
 	}
@@ -59,25 +80,36 @@ func main() {
 		log.WithError(err).Warn("admin settings table ensure failed")
 	}
 
-	ch, err := probe.OpenClickHouseFromEnv()
+	// ---- Workspace Bootstrap (BOOTSTRAP_FILE / BOOTSTRAP_WORKSPACE) ----
+	if _, err := bootstrap.Run(context.Background(), db, bootSpec, adminCfg.DefaultAdminEmail); err != nil {
+		log.WithError(err).Fatal("workspace bootstrap failed")
+	}
+
+	// ---- Telemetry Store (ClickHouse, or embedded SQLite for single-host setups) ----
+	telemetry, err := probe.OpenTelemetryStoreFromEnv()
 	if err != nil {
-		log.WithError(err).Fatal("clickhouse open failed")
+		log.WithError(err).Fatal("telemetry store open failed")
 	}
+	ch := telemetry.DB()
 
 	// ---- Data Retention Config ----
 	retentionConfig := scheduler.LoadRetentionConfig()
 	log.Infof("Data retention: %d days, soft-delete grace: %d days",
 		retentionConfig.DataRetentionDays, retentionConfig.SoftDeleteGraceDays)
 
-	if err := probe.MigrateCH(context.Background(), ch, retentionConfig.DataRetentionDays); err != nil {
-		log.WithError(err).Fatal("clickhouse migrate failed")
-	}
-	if err := probe.MigrateCacheTablesCH(context.Background(), ch); err != nil {
-		log.WithError(err).Fatal("clickhouse cache tables migrate failed")
+	if err := telemetry.Migrate(context.Background(), retentionConfig.DataRetentionDays); err != nil {
+		log.WithError(err).Fatalf("%s migrate failed", telemetry.Backend())
 	}
 
 	probe.InitBatchWriter(ch)
 
+	// ---- Sensitive payload sealing (per-workspace opt-in) ----
+	sealCfg, err := probe.LoadPayloadSealConfig()
+	if err != nil {
+		log.WithError(err).Fatal("payload seal config invalid")
+	}
+	probe.InitPayloadSealer(db, sealCfg)
+
 	// ---- Email Worker ----
 	smtpConfig := email.LoadSMTPConfigFromEnv()
 	emailWorker := email.NewWorker(db, smtpConfig)
@@ -86,7 +118,7 @@ func main() {
 	}
 
 	// ---- Deletion Worker (async ClickHouse cleanup for probe/agent deletes) ----
-	deletionWorker := deletion.NewWorker(db, ch)
+	deletionWorker := deletion.NewWorkerWithOps(db, telemetry)
 	if err := deletionWorker.Start(); err != nil {
 		log.WithError(err).Fatal("deletion worker start failed")
 	}
@@ -117,7 +149,7 @@ func main() {
 			lokiHook.SetLabel("workspace_id", workspaceID)
 		}
 		lokiHook.Start()
-		log.AddHook(lokiHook)
+		logging.AddHook(lokiHook)
 		log.Infof("Loki log shipping enabled: %s", lokiURL)
 	}
 
@@ -133,7 +165,28 @@ func main() {
 	cleanupScheduler := scheduler.NewCleanupScheduler(db, ch, retentionConfig)
 	go cleanupScheduler.Start(cleanupCtx)
 
-	go scheduler.EnsureClickHouseTTL(context.Background(), ch, retentionConfig.DataRetentionDays)
+	if telemetry.Backend() == probe.TelemetryClickHouse {
+		go scheduler.EnsureClickHouseTTL(context.Background(), ch, retentionConfig.DataRetentionDays)
+	} else {
+		go probe.RunTelemetryRetention(cleanupCtx, telemetry, retentionConfig.DataRetentionDays, retentionConfig.CleanupInterval)
+	}
+
+	// ---- Janitor (expired sessions, PINs, share links, user tokens) ----
+	janitor := scheduler.NewJanitor(db, scheduler.LoadJanitorConfig())
+	go janitor.Start(cleanupCtx)
+
+	// ---- Workspace Purger (staged workspace deletion) ----
+	go scheduler.NewWorkspacePurger(db, deletionWorker.Store(), scheduler.LoadWorkspacePurgeConfig()).Start(cleanupCtx)
+
+	// ---- ClickHouse Storage Monitor (disk / parts soft quotas) ----
+	if telemetry.Backend() == probe.TelemetryClickHouse {
+		go scheduler.NewStorageMonitor(db, ch, scheduler.LoadStorageConfig()).Start(cleanupCtx)
+	}
+
+	// ---- ClickHouse Archival (closed partitions to S3/GCS before TTL) ----
+	if telemetry.Backend() == probe.TelemetryClickHouse {
+		go scheduler.NewArchiver(db, ch, scheduler.LoadArchiveConfig(retentionConfig.DataRetentionDays)).Start(cleanupCtx)
+	}
 
 	// ---- Alert Scheduler ----
 	alertConfig := scheduler.LoadAlertSchedulerConfig()
@@ -143,6 +196,9 @@ func main() {
 	// ---- AI Analysis Loop ----
 	analysisConfig := probe.LoadAnalysisLoopConfig()
 	go probe.StartAnalysisLoop(cleanupCtx, ch, db, analysisConfig)
+	go probe.StartDestinationMaterializer(cleanupCtx, ch, db, probe.LoadDestinationMaterializerConfig())
+	go probe.StartReprocessWorker(cleanupCtx, ch, db)
+	go probe.StartOnboardingSweeper(cleanupCtx, ch, db, deletionWorker.Store())
 
 	// ---- Report Scheduler ----
 	reportStore := reports.NewStore(db)
@@ -153,28 +209,80 @@ func main() {
 	}
 
 	// ---- Optional LLM Enrichment ----
-	llmConfig := llm.LoadConfig()
-	if llmP := llm.NewProvider(llmConfig); llmP != nil {
-		probe.SetLLMProvider(llmP)
+	// Per-workspace settings and token budgets are applied by the manager.
+	// Summaries are generated by a queue worker, off the analysis path.
+	probe.SetLLMManager(llm.NewManager(db, llm.LoadConfig()))
+	go probe.StartLLMEnrichmentWorker(cleanupCtx, ch)
+
+	// ---- Data Streams ----
+	// Forwards ingested probe data to workspace webhooks and Kafka topics.
+	go datastream.Start(cleanupCtx, db, datastream.LoadConfig())
+
+	// ---- Hot Reload ----
+	// Subsystems re-read their configuration when an admin changes one of
+	// their settings (PUT /admin/settings/:key) or another replica does.
+	runtimeSettings.Subscribe(func() {
+		probe.ReconfigureBatchWriter(probe.LoadBatchWriterConfig())
+	}, "BATCH_WRITER_SIZE", "BATCH_WRITER_FLUSH_MS")
+	runtimeSettings.Subscribe(func() {
+		probe.ReconfigureAnalysisLoop(probe.LoadAnalysisLoopConfig())
+	}, "ANALYSIS_INTERVAL", "ANALYSIS_MAX_CONCURRENT")
+	runtimeSettings.Subscribe(func() {
+		cfg := scheduler.LoadRetentionConfig()
+		cleanupScheduler.Reconfigure(cfg)
+		if telemetry.Backend() == probe.TelemetryClickHouse {
+			go scheduler.EnsureClickHouseTTL(context.Background(), ch, cfg.DataRetentionDays)
+		}
+	}, "DATA_RETENTION_DAYS", "SOFT_DELETE_GRACE_DAYS", "CLEANUP_INTERVAL_HOURS")
+	runtimeSettings.Subscribe(func() {
+		alertScheduler.Reconfigure(scheduler.LoadAlertSchedulerConfig())
+	}, "OFFLINE_CHECK_INTERVAL_MINUTES")
+	runtimeSettings.Subscribe(func() {
+		llm.ReconfigureAll(llm.LoadConfig())
+	}, "LLM_PROVIDER", "LLM_MODEL", "LLM_API_URL", "LLM_API_KEY", "OLLAMA_URL", "OLLAMA_MODEL", "LLM_MAX_TOKENS", "LLM_WORKSPACE_MONTHLY_TOKENS")
+	go runtimeSettings.Watch(cleanupCtx, 30*time.Second)
+
+	// ---- Optional Third-Party Vantage Comparison ----
+	vantageConfig := vantage.LoadConfig()
+	if vp := vantage.NewProvider(vantageConfig); vp != nil {
+		probe.SetVantageChecker(vantage.NewChecker(vp, vantageConfig))
 	}
 
+	// ---- Custom Analyzers ----
+	// Compiled-in analyzers register via probe.RegisterAnalyzer before this
+	// point; sidecars come from ANALYZER_SIDECARS.
+	probe.RegisterSidecarAnalyzersFromEnv()
+
 	// ---- Fiber (REST routes only) ----
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
 		BodyLimit:    10 * 1024 * 1024,
+		ErrorHandler: web.ErrorHandler,
 	})
 
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,PATCH,DELETE,OPTIONS",
-		AllowHeaders: "Authorization,Content-Type,X-Requested-With,Accept",
-		MaxAge:       86400,
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:  "Authorization,Content-Type,X-Requested-With,Accept,X-Request-ID",
+		ExposeHeaders: "X-Request-ID,X-Data-Watermark,X-Data-Degraded",
+		MaxAge:        86400,
 	}))
 
 	probe.InitWorkers(ch, db)
 
+	// ---- Self-Monitoring (controller dependency checks, SELF_MONITOR_ENABLED=true) ----
+	if selfCfg := selfmon.LoadConfig(); selfCfg.Enabled {
+		selfCfg.ClickHouse = telemetry.Backend() == probe.TelemetryClickHouse
+		go selfmon.New(db, ch, selfCfg).Start(cleanupCtx)
+	}
+
+	// ---- Dev Data Generator (local development only, DEV_DATA_GENERATOR=true) ----
+	if devCfg := devdata.LoadConfig(); devCfg.Enabled {
+		go devdata.New(db, devCfg).Start(cleanupCtx)
+	}
+
 	web.RegisterRoutes(app, db, ch, emailWorker.GetStore(), deletionWorker.Store(), geoStore, ouiStore, reportScheduler)
 
 	// ---- Build unified HTTP mux ----
@@ -1,16 +1,24 @@
 package web
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"netwatcher-controller/internal/admin"
 	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/chconsole"
 	"netwatcher-controller/internal/deletion"
 	"netwatcher-controller/internal/email"
+	"netwatcher-controller/internal/logging"
 	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/scheduler"
+	"netwatcher-controller/internal/settings"
 	"netwatcher-controller/internal/users"
 	"netwatcher-controller/internal/workspace"
 
@@ -21,7 +29,7 @@ import (
 
 // RegisterAdminRoutes mounts admin API endpoints under /admin
 // All routes require SITE_ADMIN role via AdminMiddleware
-func RegisterAdminRoutes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueStore, emailStore *email.QueueStore) {
+func RegisterAdminRoutes(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *deletion.QueueStore, emailStore *email.QueueStore) {
 	adminAPI := api.Group("/admin")
 	adminAPI.Use(AdminMiddleware(db))
 
@@ -39,9 +47,14 @@ func RegisterAdminRoutes(api fiber.Router, db *gorm.DB, deletionStore *deletion.
 
 	// Workspaces
 	adminAPI.Get("/workspaces", adminListWorkspacesHandler(db))
+	adminAPI.Get("/workspaces/compare", adminCompareWorkspacesHandler(db, ch)) // before /workspaces/:id
 	adminAPI.Get("/workspaces/:id", adminGetWorkspaceHandler(db))
 	adminAPI.Put("/workspaces/:id", adminUpdateWorkspaceHandler(db))
 	adminAPI.Delete("/workspaces/:id", adminDeleteWorkspaceHandler(db, deletionStore))
+	adminAPI.Get("/workspaces/:id/deletion", adminWorkspaceDeletionHandler(db, deletionStore))
+	adminAPI.Post("/workspaces/:id/restore", adminRestoreWorkspaceHandler(db, deletionStore))
+	adminAPI.Get("/workspace-deletions", adminListWorkspaceDeletionsHandler(db))
+	adminAPI.Put("/workspaces/:id/llm-budget", adminSetLLMBudgetHandler(db))
 
 	// Workspace members
 	adminAPI.Get("/workspaces/:id/members", adminListMembersHandler(db))
@@ -57,9 +70,39 @@ func RegisterAdminRoutes(api fiber.Router, db *gorm.DB, deletionStore *deletion.
 	adminAPI.Get("/global-agents", adminListGlobalAgentsHandler(db))
 	adminAPI.Put("/agents/:id/global", adminSetAgentGlobalHandler(db))
 
+	// Merge a re-registered duplicate agent into the original
+	adminAPI.Post("/agents/merge", adminMergeAgentsHandler(db, ch))
+
+	// Duplicate probes (same agent, type and targets) and merging them
+	adminAPI.Get("/probes/duplicates", adminDuplicateProbesHandler(db, ch))
+	adminAPI.Post("/probes/duplicates/merge", adminMergeProbesHandler(db, ch, deletionStore))
+
 	// Debug endpoints for session/connection diagnostics
 	adminAPI.Get("/debug/connections", adminDebugConnectionsHandler(db))
 
+	// Janitor — run expired sessions/PINs/share links/tokens cleanup now
+	adminAPI.Post("/janitor/run", adminRunJanitorHandler(db))
+
+	// ClickHouse storage soft quotas and controller-level incidents
+	adminAPI.Get("/clickhouse/storage", adminClickHouseStorageHandler(db, ch))
+	adminAPI.Get("/system-incidents", adminListSystemIncidentsHandler(db))
+
+	// ClickHouse cold-storage archival (S3/GCS Parquet exports) and restores
+	adminAPI.Get("/clickhouse/archive", adminListArchiveHandler(db, ch))
+	adminAPI.Post("/clickhouse/archive/run", adminRunArchiveHandler(db, ch))
+	adminAPI.Post("/clickhouse/archive/restore", adminRestoreArchiveHandler(db, ch))
+
+	// ClickHouse OPTIMIZE ... FINAL / index rebuilds, run in the background
+	optimizer := scheduler.NewOptimizer(ch)
+	adminAPI.Get("/clickhouse/optimize", adminOptimizeStatusHandler(ch, optimizer))
+	adminAPI.Post("/clickhouse/optimize", adminStartOptimizeHandler(ch, optimizer))
+
+	// Read-only query console over allowlisted tables (CH_CONSOLE_ENABLED),
+	// every attempt audited
+	adminAPI.Get("/clickhouse/query", adminCHConsoleConfigHandler(ch))
+	adminAPI.Post("/clickhouse/query", adminCHConsoleQueryHandler(db, ch))
+	adminAPI.Get("/clickhouse/query/log", adminCHConsoleLogHandler(db, ch))
+
 	// Voice thresholds — admin-global override applied on top of
 	// built-in defaults. Per-workspace overrides live in
 	// `Workspace.Settings.voice_thresholds`.
@@ -67,6 +110,383 @@ func RegisterAdminRoutes(api fiber.Router, db *gorm.DB, deletionStore *deletion.
 	adminAPI.Put("/voice-thresholds", adminSetVoiceThresholdsHandler(db))
 	adminAPI.Delete("/voice-thresholds", adminClearVoiceThresholdsHandler(db))
 	adminAPI.Get("/voice-thresholds/defaults", adminDefaultVoiceThresholdsHandler())
+
+	// Per-subsystem log levels, changed at runtime (not persisted)
+	adminAPI.Get("/log-levels", adminGetLogLevelsHandler())
+	adminAPI.Put("/log-levels", adminSetLogLevelsHandler())
+
+	// Runtime overrides of selected env settings (persisted, hot-reloaded)
+	adminAPI.Get("/settings", adminListSettingsHandler(db))
+	adminAPI.Put("/settings/:key", adminSetSettingHandler(db))
+	adminAPI.Delete("/settings/:key", adminResetSettingHandler(db))
+}
+
+// adminListSettingsHandler returns every runtime-adjustable setting with its
+// effective value and where it comes from. Secret values are masked.
+func adminListSettingsHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"data": settings.Default(db).List()})
+	}
+}
+
+// adminSetSettingHandler stores an override. Body: {"value": "..."}.
+// Subsystems using the setting pick it up without a restart.
+func adminSetSettingHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			Value *string `json:"value"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Value == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "value is required"})
+		}
+		key := c.Params("key")
+		if err := settings.Default(db).Set(c.UserContext(), key, *body.Value, currentUserID(c)); err != nil {
+			return settingsError(c, err)
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("Setting %s overridden", key)
+		return c.JSON(fiber.Map{"data": settings.Default(db).List()})
+	}
+}
+
+// adminResetSettingHandler removes an override so the environment value
+// applies again.
+func adminResetSettingHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("key")
+		if err := settings.Default(db).Reset(c.UserContext(), key); err != nil {
+			return settingsError(c, err)
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("Setting %s reset", key)
+		return c.JSON(fiber.Map{"data": settings.Default(db).List()})
+	}
+}
+
+func settingsError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, settings.ErrUnknownSetting):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, settings.ErrInvalidValue):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// adminGetLogLevelsHandler returns the global and per-subsystem log levels.
+func adminGetLogLevelsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"levels": logging.Levels(), "subsystems": logging.Subsystems()})
+	}
+}
+
+// adminSetLogLevelsHandler applies a {"subsystem": "level"} map. Nothing
+// changes unless every entry is valid.
+func adminSetLogLevelsHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body map[string]string
+		if err := c.BodyParser(&body); err != nil || len(body) == 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "body must map subsystems to levels"})
+		}
+		prev := logging.Levels()
+		for name, level := range body {
+			if err := logging.SetLevel(name, level); err != nil {
+				for n, l := range prev {
+					_ = logging.SetLevel(n, l)
+				}
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("Log levels changed: %v", body)
+		return c.JSON(fiber.Map{"levels": logging.Levels(), "subsystems": logging.Subsystems()})
+	}
+}
+
+// adminRunJanitorHandler runs one janitor pass on demand and returns the
+// per-table counts.
+func adminRunJanitorHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		res := scheduler.NewJanitor(db, scheduler.LoadJanitorConfig()).RunOnce(c.UserContext())
+		return c.JSON(res)
+	}
+}
+
+// adminClickHouseStorageHandler checks ClickHouse disk and parts usage
+// now (updating system incidents like a scheduled run) and returns it with
+// the thresholds and open storage incidents.
+func adminClickHouseStorageHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ch == nil || probe.EmbeddedTelemetry() {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "storage monitoring requires the ClickHouse telemetry backend"})
+		}
+		m := scheduler.NewStorageMonitor(db, ch, scheduler.LoadStorageConfig())
+		usage, err := m.RunOnce(c.UserContext())
+		if err != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		incidents, err := scheduler.ListSystemIncidents(c.UserContext(), db, false, 100)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		open := make([]scheduler.SystemIncident, 0, len(incidents))
+		for _, inc := range incidents {
+			if inc.Source == scheduler.StorageSource {
+				open = append(open, inc)
+			}
+		}
+		return c.JSON(fiber.Map{
+			"usage":      usage,
+			"thresholds": m.Config(),
+			"incidents":  open,
+		})
+	}
+}
+
+// newAdminArchiver returns the archiver, or nil when archival isn't
+// available (embedded telemetry or no ARCHIVE_S3_URL).
+func newAdminArchiver(db *gorm.DB, ch *sql.DB) *scheduler.Archiver {
+	if ch == nil || probe.EmbeddedTelemetry() {
+		return nil
+	}
+	cfg := scheduler.LoadArchiveConfig(scheduler.LoadRetentionConfig().DataRetentionDays)
+	if !cfg.Enabled {
+		return nil
+	}
+	return scheduler.NewArchiver(db, ch, cfg)
+}
+
+// adminListArchiveHandler returns the archival settings and every archived
+// or failed partition.
+func adminListArchiveHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		a := newAdminArchiver(db, ch)
+		if a == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "archival requires the ClickHouse telemetry backend and ARCHIVE_S3_URL"})
+		}
+		parts, err := scheduler.ListArchivedPartitions(c.UserContext(), db)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"config": a.Config(), "partitions": parts})
+	}
+}
+
+// adminRunArchiveHandler runs one archival pass now.
+func adminRunArchiveHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		a := newAdminArchiver(db, ch)
+		if a == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "archival requires the ClickHouse telemetry backend and ARCHIVE_S3_URL"})
+		}
+		res, err := a.RunOnce(c.UserContext())
+		if err != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(res)
+	}
+}
+
+// adminOptimizeStatusHandler returns the running or last optimize job.
+func adminOptimizeStatusHandler(ch *sql.DB, o *scheduler.Optimizer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ch == nil || probe.EmbeddedTelemetry() {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "optimize requires the ClickHouse telemetry backend"})
+		}
+		return c.JSON(fiber.Map{"job": o.Status(c.UserContext())})
+	}
+}
+
+// adminStartOptimizeHandler starts an optimize job. Body (all optional):
+// {"tables": ["probe_data"], "partition": "202405", "deduplicate": true,
+// "materialize_indexes": true, "force": false}. Responds 409 while a job
+// is running.
+func adminStartOptimizeHandler(ch *sql.DB, o *scheduler.Optimizer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ch == nil || probe.EmbeddedTelemetry() {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "optimize requires the ClickHouse telemetry backend"})
+		}
+		var req scheduler.OptimizeRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+			}
+		}
+		job, err := o.Start(req, currentUserID(c))
+		switch {
+		case errors.Is(err, scheduler.ErrOptimizeRunning):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error(), "job": o.Status(c.UserContext())})
+		case errors.Is(err, scheduler.ErrOptimizeInput):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("Started ClickHouse optimize on %v", job.Request.Tables)
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"job": job})
+	}
+}
+
+// chConsoleConfig returns the console settings, or false when the console
+// is off or there is no ClickHouse to query.
+func chConsoleConfig(ch *sql.DB) (chconsole.Config, bool) {
+	cfg := chconsole.LoadConfig()
+	return cfg, cfg.Enabled && ch != nil && !probe.EmbeddedTelemetry()
+}
+
+const chConsoleUnavailable = "the query console requires the ClickHouse telemetry backend and CH_CONSOLE_ENABLED=true"
+
+// adminCHConsoleConfigHandler returns the allowlisted tables and limits.
+func adminCHConsoleConfigHandler(ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg, ok := chConsoleConfig(ch)
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": chConsoleUnavailable})
+		}
+		return c.JSON(cfg)
+	}
+}
+
+// adminCHConsoleQueryHandler runs one read-only query. Body:
+// {"query": "SELECT ..."}. Rejected queries answer 400, ClickHouse errors
+// 502; either way the attempt is recorded.
+func adminCHConsoleQueryHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg, ok := chConsoleConfig(ch)
+		if !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": chConsoleUnavailable})
+		}
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Query) == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "query is required"})
+		}
+		userID := currentUserID(c)
+		res, err := chconsole.Run(c.UserContext(), ch, cfg, body.Query)
+
+		entry := chconsole.NewQueryLog(userID, body.Query, res, err)
+		entry.RequestID = requestID(c)
+		entry.ClientIP = fiberClientIP(c)
+		// Recorded even if the client has gone away.
+		if rerr := chconsole.Record(context.Background(), db, entry); rerr != nil {
+			log.Errorf("ClickHouse console: %v", rerr)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "could not record the query in the audit log"})
+		}
+		log.WithField(logging.FieldUser, userID).Infof("ClickHouse console query %d (%s, %d rows, %d ms) on %s",
+			entry.ID, entry.Status, entry.Rows, entry.DurationMs, entry.Tables)
+
+		switch {
+		case errors.Is(err, chconsole.ErrRejected):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "log_id": entry.ID})
+		case err != nil:
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error(), "log_id": entry.ID})
+		}
+		return c.JSON(fiber.Map{"log_id": entry.ID, "result": res})
+	}
+}
+
+// adminCHConsoleLogHandler lists recorded console queries, newest first.
+// Query: user_id, limit (default 100, max 500).
+func adminCHConsoleLogHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := chConsoleConfig(ch); !ok {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": chConsoleUnavailable})
+		}
+		limit := c.QueryInt("limit", 100)
+		if limit <= 0 || limit > 500 {
+			limit = 100
+		}
+		entries, err := chconsole.ListLog(c.UserContext(), db, uint(c.QueryInt("user_id", 0)), limit)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(entries))
+	}
+}
+
+// adminRestoreArchiveHandler imports an archived partition into
+// <table>_restored. Body: {"table": "probe_data", "partition": "202401"}.
+func adminRestoreArchiveHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		a := newAdminArchiver(db, ch)
+		if a == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "archival requires the ClickHouse telemetry backend and ARCHIVE_S3_URL"})
+		}
+		var body struct {
+			Table     string `json:"table"`
+			Partition string `json:"partition"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Table == "" || body.Partition == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "table and partition are required"})
+		}
+		n, err := a.Restore(c.UserContext(), body.Table, body.Partition)
+		if errors.Is(err, scheduler.ErrArchiveNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("Restored archived %s partition %s", body.Table, body.Partition)
+		return c.JSON(fiber.Map{"table": body.Table + "_restored", "partition": body.Partition, "rows": n})
+	}
+}
+
+// adminCompareWorkspacesHandler ranks all workspaces by health, incident
+// rate and worst probes so MSP NOC teams know which customer to look at
+// first. Query: from, to (RFC3339 or unix; default last 7 days, max 90),
+// worst (probes per workspace, default 3, max 20), format=csv.
+func adminCompareWorkspacesHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var q probe.WorkspaceCompareQuery
+		if v := c.Query("from"); v != "" {
+			t, ok := readTime(v)
+			if !ok {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid from"})
+			}
+			q.From = t
+		}
+		if v := c.Query("to"); v != "" {
+			t, ok := readTime(v)
+			if !ok {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid to"})
+			}
+			q.To = t
+		}
+		q.WorstProbes = c.QueryInt("worst", 0)
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		res, err := probe.CompareWorkspaces(ctx, ch, db, q)
+		if err != nil {
+			switch {
+			case errors.Is(err, probe.ErrBadInput):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, context.DeadlineExceeded):
+				return c.Status(http.StatusGatewayTimeout).JSON(fiber.Map{"error": "comparison timed out"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if c.Query("format") == "csv" {
+			var buf bytes.Buffer
+			if err := res.WriteCSV(&buf); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="workspace-compare-%s.csv"`, res.To.Format("20060102")))
+			return c.Send(buf.Bytes())
+		}
+		return c.JSON(res)
+	}
+}
+
+// adminListSystemIncidentsHandler lists controller-level incidents.
+// Query: include_resolved=true, limit (default 100, max 500)
+func adminListSystemIncidentsHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rows, err := scheduler.ListSystemIncidents(c.UserContext(), db, c.QueryBool("include_resolved"), c.QueryInt("limit", 100))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(rows))
+	}
 }
 
 // adminGetVoiceThresholdsHandler returns the current admin-global
@@ -409,18 +829,65 @@ func adminUpdateWorkspaceHandler(db *gorm.DB) fiber.Handler {
 	}
 }
 
+// adminDeleteWorkspaceHandler schedules a staged deletion like the owner's
+// DELETE; ?immediate=true skips the retention window so the purge runs on
+// the purger's next pass.
 func adminDeleteWorkspaceHandler(db *gorm.DB, deletionStore *deletion.QueueStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		store := workspace.NewStore(db)
 		id := uintParam(c, "id")
 
-		if err := store.DeleteWorkspace(context.Background(), deletionStore, id); err != nil {
-			if err == workspace.ErrNotFound {
-				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "workspace not found"})
-			}
+		retention := scheduler.LoadWorkspacePurgeConfig().Retention
+		if c.QueryBool("immediate") {
+			retention = 0
+		}
+		if _, err := store.ScheduleDeletion(c.UserContext(), id, currentUserID(c), retention); err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("admin: scheduled deletion of workspace %d (retention %v)", id, retention)
+
+		st, err := store.DeletionStatus(c.UserContext(), deletionStore, id)
+		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.JSON(fiber.Map{"ok": true})
+		return c.Status(http.StatusAccepted).JSON(st)
+	}
+}
+
+func adminWorkspaceDeletionHandler(db *gorm.DB, deletionStore *deletion.QueueStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		st, err := workspace.NewStore(db).DeletionStatus(c.UserContext(), deletionStore, uintParam(c, "id"))
+		if err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		return c.JSON(st)
+	}
+}
+
+func adminRestoreWorkspaceHandler(db *gorm.DB, deletionStore *deletion.QueueStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		store := workspace.NewStore(db)
+		id := uintParam(c, "id")
+		if _, err := store.RestoreWorkspace(c.UserContext(), id, currentUserID(c)); err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		log.WithField(logging.FieldUser, currentUserID(c)).Infof("admin: restored workspace %d", id)
+
+		st, err := store.DeletionStatus(c.UserContext(), deletionStore, id)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(st)
+	}
+}
+
+func adminListWorkspaceDeletionsHandler(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		out, err := workspace.NewStore(db).ListDeletions(c.UserContext(), c.Query("status"), c.QueryInt("limit", 50))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"data": out})
 	}
 }
 
@@ -715,3 +1182,74 @@ func adminSetAgentGlobalHandler(db *gorm.DB) fiber.Handler {
 		return c.JSON(a)
 	}
 }
+
+// adminMergeAgentsHandler merges a duplicate agent into a canonical one.
+// Send dry_run=true first to preview the changes; the real merge needs
+// confirm set to the duplicate's name and the duplicate disconnected.
+func adminMergeAgentsHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var in agent.MergeInput
+		if err := c.BodyParser(&in); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		if !in.DryRun && GetAgentHub().IsAgentConnected(in.DuplicateAgentID) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "duplicate agent is connected; stop it before merging"})
+		}
+
+		rep, err := agent.MergeAgents(c.UserContext(), db, in, func(ctx context.Context, from, to uint) error {
+			return probe.ReassignAgentProbeData(ctx, ch, from, to)
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, agent.ErrNotFound):
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			case errors.Is(err, agent.ErrMergeInvalid), errors.Is(err, agent.ErrMergeNotConfirmed):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !rep.DryRun {
+			log.Infof("[admin] user %d merged agent %d into %d", currentUserID(c), rep.DuplicateAgentID, rep.CanonicalAgentID)
+		}
+		return c.JSON(rep)
+	}
+}
+
+// adminDuplicateProbesHandler lists probes that duplicate another probe on
+// the same agent (same type and targets), optionally limited to one
+// workspace with ?workspace_id=.
+func adminDuplicateProbesHandler(db *gorm.DB, ch *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		wsID := uint(c.QueryInt("workspace_id", 0))
+		groups, err := probe.FindDuplicateProbeGroups(c.UserContext(), db, ch, wsID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"groups": groups, "total": len(groups)})
+	}
+}
+
+// adminMergeProbesHandler folds duplicate probes into the one kept.
+// dry_run reports what would move without changing anything.
+func adminMergeProbesHandler(db *gorm.DB, ch *sql.DB, deletionStore *deletion.QueueStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var in probe.MergeProbesInput
+		if err := c.BodyParser(&in); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		rep, err := probe.MergeDuplicateProbes(c.UserContext(), db, ch, deletionStore, in)
+		if err != nil {
+			switch {
+			case errors.Is(err, probe.ErrNotFound):
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+			case errors.Is(err, probe.ErrBadInput):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if !rep.DryRun {
+			log.Infof("[admin] user %d merged %d duplicate probe(s) into %d", currentUserID(c), len(rep.Merged), rep.KeepProbeID)
+		}
+		return c.JSON(rep)
+	}
+}
@@ -15,16 +15,16 @@ func AdminMiddleware(db *gorm.DB) fiber.Handler {
 		// Get user from context (set by JWTMiddleware)
 		userVal := c.Locals("user")
 		if userVal == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+			return APIError(c, 0, CodeAuthRequired, "unauthorized")
 		}
 
 		user, ok := userVal.(*users.User)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid user context"})
+			return APIError(c, 0, CodeAuthRequired, "invalid user context")
 		}
 
 		if !admin.IsSiteAdmin(user) {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "site admin access required"})
+			return APIError(c, 0, CodeSiteAdminRequired, "site admin access required")
 		}
 
 		return c.Next()
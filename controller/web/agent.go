@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/region"
 	"strconv"
 	"time"
 
@@ -20,6 +21,18 @@ type agentLoginRequest struct {
 	AgentID     uint   `json:"agent_id,omitempty"`
 	PSK         string `json:"psk,omitempty"`
 	PIN         string `json:"pin,omitempty"`
+
+	// Optional platform report; older agents omit these.
+	OS           string   `json:"os,omitempty"`
+	Arch         string   `json:"arch,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Optional config protocol announcement; see agent.Negotiation.
+	agent.Negotiation
+}
+
+func (r agentLoginRequest) platform() agent.PlatformInfo {
+	return agent.PlatformInfo{OS: r.OS, Arch: r.Arch, Capabilities: r.Capabilities}
 }
 
 type agentLoginResponse struct {
@@ -27,6 +40,31 @@ type agentLoginResponse struct {
 	PSK    string       `json:"psk,omitempty"`   // only on bootstrap
 	Agent  *agent.Agent `json:"agent,omitempty"` // convenience
 	Error  string       `json:"error,omitempty"` // on failure
+	// Protocol is the negotiated config protocol, set when the agent announced one.
+	Protocol int `json:"protocol,omitempty"`
+	// Region and Endpoint name the controller to use instead, with
+	// Error "wrong_region" (see internal/region).
+	Region   string `json:"region,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// recordLoginReport stores the platform and negotiation an agent sent with
+// its login. Returns true when anything was recorded.
+func recordLoginReport(c *fiber.Ctx, db *gorm.DB, id uint, req agentLoginRequest) bool {
+	if err := agent.UpdateAgentPlatform(c.UserContext(), db, id, req.platform()); err != nil {
+		log.WithError(err).Warn("update platform failed")
+	}
+	if err := agent.UpdateAgentNegotiation(c.UserContext(), db, id, req.Negotiation); err != nil {
+		log.WithError(err).Warn("update negotiation failed")
+	}
+	return !req.platform().Empty() || !req.Negotiation.Empty()
+}
+
+func (r agentLoginRequest) protocol() int {
+	if r.Negotiation.Empty() {
+		return 0
+	}
+	return agent.NegotiatedProtocol(r.Protocol)
 }
 
 // ---- Route registration ----
@@ -61,15 +99,35 @@ func agentAuth(api fiber.Router, db *gorm.DB) {
 					log.Warnf("Agent %d/%d login failed due to server error: %v", req.WorkspaceID, req.AgentID, err)
 					return c.Status(http.StatusServiceUnavailable).JSON(agentLoginResponse{Error: "server_error"})
 				}
+				// Disabled pending deletion: 503 keeps the agent retrying, so it
+				// reconnects if the deletion is undone
+				if errors.Is(err, agent.ErrWorkspaceDisabled) {
+					log.Infof("Agent %d/%d login refused: workspace disabled pending deletion", req.WorkspaceID, req.AgentID)
+					return c.Status(http.StatusServiceUnavailable).JSON(agentLoginResponse{Error: "workspace_disabled"})
+				}
 				return c.Status(http.StatusUnauthorized).JSON(agentLoginResponse{Error: "invalid_psk"})
 			}
+			// Another region's controller owns this agent's data
+			if !region.Owns(a.Region) {
+				return c.Status(http.StatusMisdirectedRequest).JSON(agentLoginResponse{
+					Error:    "wrong_region",
+					Region:   region.Owner(a.Region),
+					Endpoint: region.Endpoint(a.Region),
+				})
+			}
 			// Lightweight heartbeat
 			if err := agent.UpdateAgentSeen(c.UserContext(), db, a.ID, time.Now()); err != nil {
 				log.WithError(err).Warn("update last seen failed (psk login)")
 			}
+			if recordLoginReport(c, db, a.ID, req) {
+				if fresh, err := agent.GetAgentByID(c.UserContext(), db, a.ID); err == nil {
+					a = fresh
+				}
+			}
 			return c.Status(http.StatusOK).JSON(agentLoginResponse{
-				Status: "ok",
-				Agent:  a,
+				Status:   "ok",
+				Agent:    a,
+				Protocol: req.protocol(),
 			})
 		}
 
@@ -86,10 +144,16 @@ func agentAuth(api fiber.Router, db *gorm.DB) {
 			if err := agent.UpdateAgentSeen(c.UserContext(), db, out.Agent.ID, time.Now()); err != nil {
 				log.WithError(err).Warn("update last seen failed (pin bootstrap)")
 			}
+			if recordLoginReport(c, db, out.Agent.ID, req) {
+				if fresh, err := agent.GetAgentByID(c.UserContext(), db, out.Agent.ID); err == nil {
+					out.Agent = fresh
+				}
+			}
 			return c.Status(http.StatusOK).JSON(agentLoginResponse{
-				Status: "success",
-				PSK:    out.PSK, // <-- show once
-				Agent:  out.Agent,
+				Status:   "success",
+				PSK:      out.PSK, // <-- show once
+				Agent:    out.Agent,
+				Protocol: req.protocol(),
 			})
 		}
 
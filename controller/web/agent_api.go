@@ -3,13 +3,18 @@ package web
 
 import (
 	"database/sql"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/features"
 	"netwatcher-controller/internal/geoip"
 	"netwatcher-controller/internal/lookup"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/region"
 
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
@@ -43,12 +48,28 @@ func agentAPIMiddleware(db *gorm.DB) fiber.Handler {
 		if err != nil {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_psk"})
 		}
+		if !region.Owns(a.Region) {
+			return c.Status(http.StatusMisdirectedRequest).JSON(fiber.Map{
+				"error":    "wrong_region",
+				"region":   region.Owner(a.Region),
+				"endpoint": region.Endpoint(a.Region),
+			})
+		}
 
 		// Store agent in context for downstream handlers
 		c.Locals("agent", a)
 		c.Locals("agent_id", a.ID)
 		c.Locals("workspace_id", a.WorkspaceID)
 
+		go auditAgentConnection(db, agent.ConnectionInfo{
+			AgentID:     a.ID,
+			WorkspaceID: a.WorkspaceID,
+			Kind:        agent.ConnAPI,
+			ClientIP:    strings.Clone(fiberClientIP(c)),
+			UserAgent:   strings.Clone(c.Get("User-Agent")),
+			TLSVersion:  tlsVersionName(c.Context().TLSConnectionState()),
+		})
+
 		// Update last seen
 		if err := agent.UpdateAgentSeen(c.UserContext(), db, a.ID, time.Now()); err != nil {
 			log.WithError(err).Warn("failed to update agent last_seen")
@@ -150,4 +171,87 @@ func RegisterAgentAPI(api fiber.Router, db *gorm.DB, ch *sql.DB, geoStore *geoip
 
 		return c.JSON(result)
 	})
+
+	// GET /agent/api/features - Effective agent-facing feature flags for
+	// the agent's workspace, e.g. {"adaptive_probing": false}
+	agentAPI.Get("/features", func(c *fiber.Ctx) error {
+		wID, _ := c.Locals("workspace_id").(uint)
+		flags := features.Default(db)
+		out := make(map[string]bool)
+		for _, f := range features.Flags() {
+			if f.Agent {
+				out[f.Key] = flags.Enabled(c.UserContext(), wID, f.Key)
+			}
+		}
+		return c.JSON(out)
+	})
+
+	// POST /agent/api/clock/sync - One NTP-style exchange for estimating
+	// the agent's clock offset. Body: {"client_sent": unix nanos}; the
+	// response adds the controller's receive and send times.
+	agentAPI.Post("/clock/sync", func(c *fiber.Ctx) error {
+		received := time.Now()
+		var body struct {
+			ClientSent int64 `json:"client_sent"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		c.Set("Cache-Control", "no-store")
+		return c.JSON(fiber.Map{
+			"client_sent":     body.ClientSent,
+			"server_received": received.UnixNano(),
+			"server_sent":     time.Now().UnixNano(),
+		})
+	})
+
+	// POST /agent/api/clock/offset - Report the agent's clock offset, used
+	// to correct one-way delays in agent-to-agent TrafficSim results.
+	// Body: either the four timestamps of a /clock/sync exchange (unix
+	// nanos: client_sent, server_received, server_sent, client_received)
+	// or {"offset_ms", "rtt_ms", "source": "ntp"} from the agent's own NTP.
+	agentAPI.Post("/clock/offset", func(c *fiber.Ctx) error {
+		aID, _ := c.Locals("agent_id").(uint)
+		var body struct {
+			ClientSent     int64    `json:"client_sent"`
+			ServerReceived int64    `json:"server_received"`
+			ServerSent     int64    `json:"server_sent"`
+			ClientReceived int64    `json:"client_received"`
+			OffsetMs       *float64 `json:"offset_ms"`
+			RTTMs          float64  `json:"rtt_ms"`
+			Source         string   `json:"source"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		var s probe.ClockSample
+		switch {
+		case body.ClientSent != 0 && body.ServerReceived != 0 && body.ServerSent != 0 && body.ClientReceived != 0:
+			s.OffsetMs, s.RTTMs = probe.ClockOffsetFromExchange(time.Unix(0, body.ClientSent),
+				time.Unix(0, body.ServerReceived), time.Unix(0, body.ServerSent), time.Unix(0, body.ClientReceived))
+			s.Source = "controller"
+		case body.OffsetMs != nil:
+			s.OffsetMs, s.RTTMs, s.Source = *body.OffsetMs, body.RTTMs, body.Source
+			if s.Source == "" {
+				s.Source = "ntp"
+			}
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "send the sync exchange timestamps or offset_ms"})
+		}
+		if math.IsNaN(s.OffsetMs) || math.IsInf(s.OffsetMs, 0) || s.RTTMs < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid offset"})
+		}
+		s.MeasuredAt = time.Now()
+		probe.RecordClockOffset(aID, s)
+		return c.JSON(s)
+	})
+
+	// POST /agent/api/ingest-validation - Diff the agent's locally cached
+	// per-probe summary for a window against what the controller stored.
+	// Body: {"from": RFC3339, "to": RFC3339, "probes": [{"probe_id", "count", "first_at", "last_at"}]}
+	agentAPI.Post("/ingest-validation", func(c *fiber.Ctx) error {
+		wID, _ := c.Locals("workspace_id").(uint)
+		aID, _ := c.Locals("agent_id").(uint)
+		return handleIngestValidation(c, db, ch, wID, aID)
+	})
 }
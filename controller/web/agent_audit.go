@@ -0,0 +1,55 @@
+// web/agent_audit.go
+package web
+
+import (
+	"context"
+	"crypto/tls"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/alert"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// auditAgentConnection records how an agent connected and raises
+// unexpected_network alerts when it is the agent's first connection from
+// a network. Callers run it in a goroutine; info must not reference
+// request buffers.
+func auditAgentConnection(db *gorm.DB, info agent.ConnectionInfo) {
+	ctx := context.Background()
+	nc, err := agent.RecordConnection(ctx, db, info)
+	if err != nil {
+		log.Warnf("[agent-audit] agent=%d: record %s connection: %v", info.AgentID, info.Kind, err)
+		return
+	}
+	if nc == nil {
+		return
+	}
+	name := ""
+	if a, err := agent.GetAgentByWorkspaceAndID(ctx, db, nc.WorkspaceID, nc.AgentID); err == nil && a != nil {
+		name = a.Name
+	}
+	log.Warnf("[agent-audit] agent=%d (%s) %s from new network %s (ip %s, known %v)",
+		nc.AgentID, name, nc.Kind, nc.Network, nc.ClientIP, nc.Known)
+	if err := alert.EvaluateUnexpectedNetwork(ctx, db, alert.AgentNetworkContext{
+		WorkspaceID: nc.WorkspaceID,
+		AgentID:     nc.AgentID,
+		AgentName:   name,
+		Kind:        string(nc.Kind),
+		ClientIP:    nc.ClientIP,
+		Network:     nc.Network,
+		Known:       nc.Known,
+	}); err != nil {
+		log.Warnf("[agent-audit] agent=%d: %v", nc.AgentID, err)
+	}
+}
+
+// tlsVersionName is the negotiated TLS version, or "" for plaintext
+// (including TLS terminated by a proxy in front of the controller).
+func tlsVersionName(cs *tls.ConnectionState) string {
+	if cs == nil {
+		return ""
+	}
+	return tls.VersionName(cs.Version)
+}
@@ -87,7 +87,8 @@ func (h *AgentHub) RegisterAgent(agentID uint, conn *neffos.NSConn) {
 // UnregisterAgent removes an agent connection
 // Only removes if the agent is currently registered (prevents race conditions
 // where an old connection's disconnect event fires after a new connection was registered)
-func (h *AgentHub) UnregisterAgent(agentID uint, conn *neffos.NSConn) {
+// Returns true if the connection was removed, i.e. the agent is now offline.
+func (h *AgentHub) UnregisterAgent(agentID uint, conn *neffos.NSConn) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -96,11 +97,12 @@ func (h *AgentHub) UnregisterAgent(agentID uint, conn *neffos.NSConn) {
 		if current.conn == conn {
 			delete(h.connections, agentID)
 			log.Infof("[AgentHub] Agent %d unregistered (total: %d) conn_id=%s", agentID, len(h.connections), current.ConnID)
-		} else {
-			log.Debugf("[AgentHub] Agent %d disconnect ignored - connection was replaced (old=%s, current=%s)",
-				agentID, current.ConnID, current.ConnID)
+			return true
 		}
+		log.Debugf("[AgentHub] Agent %d disconnect ignored - connection was replaced (old=%s, current=%s)",
+			agentID, current.ConnID, current.ConnID)
 	}
+	return false
 }
 
 // DeactivateAgent sends a deactivation message to a connected agent
@@ -130,6 +132,25 @@ func (h *AgentHub) DeactivateAgent(agentID uint, reason string) bool {
 	return true
 }
 
+// DisconnectAgent closes a connected agent's WebSocket without telling it
+// to deactivate. Used after credential changes so the agent reconnects and
+// re-authenticates.
+func (h *AgentHub) DisconnectAgent(agentID uint) bool {
+	h.mu.RLock()
+	info, exists := h.connections[agentID]
+	h.mu.RUnlock()
+
+	if !exists || info.conn == nil {
+		return false
+	}
+	if err := info.conn.Disconnect(context.TODO()); err != nil {
+		log.Debugf("[AgentHub] Error disconnecting agent %d: %v", agentID, err)
+		return false
+	}
+	log.Infof("[AgentHub] Closed connection for agent %d", agentID)
+	return true
+}
+
 // IsAgentConnected checks if an agent is currently connected
 func (h *AgentHub) IsAgentConnected(agentID uint) bool {
 	h.mu.RLock()
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/extid"
 
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
@@ -29,9 +30,22 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 	as := ws.Group("/agents")
 	as.Use(RequireWorkspaceAccess(wsStore))
 
+	// GET /workspaces/{id}/overview
+	// One compact card per agent for the dashboard: connection state,
+	// health (from the latest analysis snapshot), public IP / ISP,
+	// version, probe count and worst probe.
+	ws.Get("/overview", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wsID := workspaceCtx(c).WorkspaceID
+		ov, err := probe.ComputeWorkspaceOverview(c.UserContext(), ch, db, wsID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(ov)
+	})
+
 	// GET /workspaces/{id}/agents
 	as.Get("/", func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
+		wsID := workspaceCtx(c).WorkspaceID
 		limit := intParam(c, "limit", 50, 1, 200)
 		offset := intParam(c, "offset", 0, 0, 1_000_000)
 		list, total, err := agent.ListAgentsByWorkspace(c.UserContext(), db, wsID, limit, offset)
@@ -43,8 +57,9 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 
 	// POST /workspaces/{id}/agents - requires CanEdit (USER+)
 	as.Post("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
+		wsID := workspaceCtx(c).WorkspaceID
 		var body struct {
+			ExternalID        string         `json:"external_id"`
 			Name              string         `json:"name"`
 			Description       string         `json:"description"`
 			Location          string         `json:"location"`
@@ -59,6 +74,8 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 			TrafficSimPort    int            `json:"trafficsim_port"`
 			TemplateAgentID   uint           `json:"template_agent_id"`
 			Bidirectional     *bool          `json:"bidirectional"`
+			// DefaultProbes=false skips the workspace default probe bundle.
+			DefaultProbes *bool `json:"default_probes"`
 		}
 		if err := c.BodyParser(&body); err != nil {
 			return c.SendStatus(http.StatusBadRequest)
@@ -79,6 +96,7 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 
 		out, err := agent.CreateAgent(c.UserContext(), db, agent.CreateInput{
 			WorkspaceID:       wsID,
+			ExternalID:        body.ExternalID,
 			Name:              body.Name,
 			Description:       body.Description,
 			PinLength:         body.PinLength,
@@ -93,6 +111,9 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 			TrafficSimPort:    body.TrafficSimPort,
 		})
 		if err != nil {
+			if v := validationError(err); v != nil {
+				return APIValidationError(c, v)
+			}
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 
@@ -110,27 +131,68 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 				// Log but don't fail - agent was already created
 				log.Warnf("Failed to copy probes from agent %d to %d: %v", body.TemplateAgentID, out.Agent.ID, err)
 			}
+		} else if body.DefaultProbes == nil || *body.DefaultProbes {
+			if _, err := probe.ApplyDefaultProbeBundle(c.UserContext(), db, wsID, out.Agent.ID, limitsConfig.MaxProbesPerAgent); err != nil {
+				// Log but don't fail - agent was already created
+				log.Warnf("Default probe bundle for agent %d incomplete: %v", out.Agent.ID, err)
+			}
 		}
 
 		return c.Status(http.StatusCreated).JSON(out)
 	})
 
+	// GET /workspaces/{id}/available-global-agents — all global agents visible
+	// to this workspace (own workspace + cross-workspace). The panel deduplicates
+	// against the local agent list and labels every entry with a "[Global]"
+	// prefix in the probe-create target dropdown.
+	as.Get("/global", func(c *fiber.Ctx) error {
+		globals, err := agent.ListGlobalAgentsForWorkspace(c.UserContext(), db)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"data": globals})
+	})
+
 	// /workspaces/{id}/agents/{agentID}
+	// Registered after the static /agents/* routes above: the agent check
+	// would otherwise treat "global" as an agent ID.
 	aid := as.Group("/:agentID")
+	aid.Use(RequireWorkspaceAgent(wsStore, db))
 
 	// GET /workspaces/{id}/agents/{agentID}
 	aid.Get("/", func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
-		a, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, wsID, aID)
-		if err != nil || a == nil {
-			return c.SendStatus(http.StatusNotFound)
+		wsc := workspaceCtx(c)
+		a, aID := wsc.Agent, wsc.AgentID
+		// Connection audit: source IP, user agent and TLS version per
+		// connection kind, most recent first.
+		conns, err := agent.ListConnections(c.UserContext(), db, aID, intOrDefault(c.Query("connections"), 20))
+		if err != nil {
+			log.Warnf("agent %d: list connections: %v", aID, err)
 		}
-		return c.JSON(a)
+		return c.JSON(struct {
+			*agent.Agent
+			Connections []agent.ConnectionRecord `json:"connections"`
+		}{a, conns})
+	})
+
+	// GET /workspaces/{id}/agents/{agentID}/reverse-probes?lookback=<minutes, default 60>
+	// Probes of any type that other agents run against this agent, with
+	// owner names and per-probe health - requires CanView (any member)
+	aid.Get("/reverse-probes", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
+		lookback := min(max(intOrDefault(c.Query("lookback"), 60), 5), 1440)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		list, err := probe.ListReverseProbesWithHealth(ctx, ch, db, wsID, aID, lookback)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
 	})
 
 	aid.Get("/netinfo", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		a, err := probe.GetLatestNetInfoForAgent(context.TODO(), ch, uint64(aID), nil)
 		if err != nil || a == nil {
 			return c.SendStatus(http.StatusNotFound)
@@ -138,8 +200,93 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		return c.JSON(a)
 	})
 
+	// GET /workspaces/{id}/agents/{agentID}/netinfo/history
+	// Bucketed NETINFO state (public IP, ISP, interfaces) and the changes
+	// between consecutive reports.
+	// Query: from, to (RFC3339 or unix; default last 24h, max 30d), bucket=<seconds, default auto>
+	aid.Get("/netinfo/history", func(c *fiber.Ctx) error {
+		aID := workspaceCtx(c).AgentID
+		out, err := probe.GetNetInfoHistory(c.UserContext(), ch, hostHistoryQuery(c, aID))
+		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(out)
+	})
+
+	// GET /workspaces/{id}/agents/{agentID}/public-ips
+	// Public IP change timeline recorded from NETINFO, newest first.
+	// Query: from=<RFC3339, optional>, limit=<default 200, max 1000>
+	aid.Get("/public-ips", func(c *fiber.Ctx) error {
+		aID := workspaceCtx(c).AgentID
+		from, _ := readTime(c.Query("from"))
+		rows, err := probe.ListPublicIPHistory(c.UserContext(), db, aID, from, intOrDefault(c.Query("limit"), 200))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(rows))
+	})
+
+	// GET /workspaces/{id}/agents/{agentID}/compat
+	// Negotiated config protocol and the probes probe_get withholds or trims.
+	aid.Get("/compat", func(c *fiber.Ctx) error {
+		out, err := probe.CheckAgentCompat(c.UserContext(), db, ch, workspaceCtx(c).Agent)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(out)
+	})
+
+	// POST /workspaces/{id}/agents/{agentID}/onboarding - requires CanEdit (USER+)
+	// Starts an onboarding validation (smoke PING/MTR probes + one queued
+	// speedtest) or returns the running one. Body (optional):
+	// {"target": "1.1.1.1", "skip_speedtest": false}
+	aid.Post("/onboarding", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.OnboardingInput
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&body); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+			}
+		}
+		wsc := workspaceCtx(c)
+		aID := wsc.AgentID
+		run, err := probe.StartOnboarding(c.UserContext(), db, wsc.WorkspaceID, aID, wsc.UserID, body)
+		if err != nil {
+			if errors.Is(err, probe.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		report, err := probe.EvaluateOnboarding(c.UserContext(), db, ch, deletionStore, run, GetAgentHub().IsAgentConnected(aID))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusAccepted).JSON(report)
+	})
+
+	// GET /workspaces/{id}/agents/{agentID}/onboarding
+	// Re-evaluates the latest onboarding run and returns its readiness checklist.
+	aid.Get("/onboarding", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		aID := wsc.AgentID
+		run, err := probe.LatestOnboardingRun(c.UserContext(), db, wsc.WorkspaceID, aID)
+		if err != nil {
+			if errors.Is(err, probe.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no onboarding run for this agent"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		report, err := probe.EvaluateOnboarding(c.UserContext(), db, ch, deletionStore, run, GetAgentHub().IsAgentConnected(aID))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(report)
+	})
+
 	aid.Get("/sysinfo", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		a, err := probe.GetLatestSysInfoForAgent(context.TODO(), ch, uint64(aID), nil)
 		if err != nil || a == nil {
 			return c.SendStatus(http.StatusNotFound)
@@ -147,10 +294,25 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		return c.JSON(a)
 	})
 
+	// GET /workspaces/{id}/agents/{agentID}/sysinfo/history
+	// Bucketed CPU, memory and disk usage. Same query as netinfo/history.
+	aid.Get("/sysinfo/history", func(c *fiber.Ctx) error {
+		aID := workspaceCtx(c).AgentID
+		out, err := probe.GetSysInfoHistory(c.UserContext(), ch, hostHistoryQuery(c, aID))
+		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(out)
+	})
+
 	// PATCH /workspaces/{id}/agents/{agentID} - requires CanEdit (USER+)
 	aid.Patch("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		var body struct {
+			ExternalID        *string         `json:"external_id"`
 			Name              *string         `json:"name"`
 			Description       *string         `json:"description"`
 			Location          *string         `json:"location"`
@@ -161,10 +323,35 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 			TrafficSimEnabled *bool           `json:"trafficsim_enabled"`
 			TrafficSimHost    *string         `json:"trafficsim_host"`
 			TrafficSimPort    *int            `json:"trafficsim_port"`
+
+			NetworkType             *string `json:"network_type"`
+			OfflineThresholdSeconds *int    `json:"offline_threshold_seconds"`
+
+			ProvisionedDownMbps *float64 `json:"provisioned_down_mbps"`
+			ProvisionedUpMbps   *float64 `json:"provisioned_up_mbps"`
+			Timezone            *string  `json:"timezone"`
+			Region              *string  `json:"region"`
 		}
 		if err := c.BodyParser(&body); err != nil {
 			return c.SendStatus(http.StatusBadRequest)
 		}
+		if err := agent.ValidatePatchInput(agent.PatchInput{
+			ExternalID:              body.ExternalID,
+			Name:                    body.Name,
+			Description:             body.Description,
+			Location:                body.Location,
+			PublicIPOverride:        body.PublicIPOverride,
+			TrafficSimHost:          body.TrafficSimHost,
+			TrafficSimPort:          body.TrafficSimPort,
+			NetworkType:             body.NetworkType,
+			OfflineThresholdSeconds: body.OfflineThresholdSeconds,
+			ProvisionedDownMbps:     body.ProvisionedDownMbps,
+			ProvisionedUpMbps:       body.ProvisionedUpMbps,
+			Timezone:                body.Timezone,
+			Region:                  body.Region,
+		}); err != nil {
+			return APIValidationError(c, validationError(err))
+		}
 
 		// Guard: disabling the TrafficSim server is only allowed if no other
 		// agent's AGENT probe (from any workspace) currently targets this agent.
@@ -195,6 +382,13 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		}
 
 		patch := map[string]any{}
+		if body.ExternalID != nil {
+			id, err := extid.Claim(c.UserContext(), db, "agents", workspaceCtx(c).WorkspaceID, aID, *body.ExternalID)
+			if err != nil {
+				return APIError(c, 0, CodeValidationFailed, err.Error())
+			}
+			patch["external_id"] = id
+		}
 		if body.Name != nil {
 			patch["name"] = *body.Name
 		}
@@ -225,6 +419,24 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		if body.TrafficSimPort != nil {
 			patch["trafficsim_port"] = *body.TrafficSimPort
 		}
+		if body.NetworkType != nil {
+			patch["network_type"] = *body.NetworkType
+		}
+		if body.OfflineThresholdSeconds != nil {
+			patch["offline_threshold_seconds"] = *body.OfflineThresholdSeconds
+		}
+		if body.ProvisionedDownMbps != nil {
+			patch["provisioned_down_mbps"] = *body.ProvisionedDownMbps
+		}
+		if body.ProvisionedUpMbps != nil {
+			patch["provisioned_up_mbps"] = *body.ProvisionedUpMbps
+		}
+		if body.Timezone != nil {
+			patch["timezone"] = *body.Timezone
+		}
+		if body.Region != nil {
+			patch["region"] = *body.Region
+		}
 
 		if err := agent.PatchAgentFields(c.UserContext(), db, aID, patch); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
@@ -235,7 +447,7 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 
 	// DELETE /workspaces/{id}/agents/{agentID} - requires CanManage (ADMIN+)
 	aid.Delete("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 
 		// Send deactivation message to connected agent BEFORE deletion
 		// This ensures the agent receives the message while still authenticated
@@ -251,7 +463,7 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 
 	// POST /workspaces/{id}/agents/{agentID}/heartbeat
 	aid.Post("/heartbeat", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		now := time.Now()
 		if err := agent.UpdateAgentSeen(c.UserContext(), db, aID, now); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
@@ -261,8 +473,8 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 
 	// POST /workspaces/{id}/agents/{agentID}/issue-pin - requires CanEdit (USER+)
 	aid.Post("/issue-pin", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
 		var body struct {
 			PinLength  int `json:"pinLength"`
 			TTLSeconds int `json:"ttlSeconds"`
@@ -284,8 +496,8 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 	// Invalidates existing PSK (disconnecting any connected agent), marks agent as uninitialized,
 	// and issues a new PIN for reinstallation on a different machine.
 	aid.Post("/regenerate", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
 		var body struct {
 			PinLength  int `json:"pinLength"`
 			TTLSeconds int `json:"ttlSeconds"`
@@ -327,17 +539,36 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		})
 	})
 
+	// POST /workspaces/{id}/agents/{agentID}/rotate-psk - requires CanManage (ADMIN+)
+	// Issues a new PSK for an already-bootstrapped agent without a PIN
+	// round-trip. The old PSK stops working immediately; the new one is
+	// returned once and must be installed in the agent's config.
+	aid.Post("/rotate-psk", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
+
+		psk, err := agent.RotatePSK(c.UserContext(), db, wsID, aID)
+		if err != nil {
+			if errors.Is(err, agent.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// Drop the session authenticated with the old PSK; the agent must
+		// reconnect with the new credential.
+		GetAgentHub().DisconnectAgent(aID)
+
+		return c.JSON(fiber.Map{"psk": psk})
+	})
+
 	// GET /workspaces/{id}/agents/{agentID}/pending-pin - requires CanEdit (USER+)
 	aid.Get("/pending-pin", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
 
 		// Check if agent is already initialized
-		a, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, wsID, aID)
-		if err != nil || a == nil {
-			return c.SendStatus(http.StatusNotFound)
-		}
-		if a.Initialized {
+		if wsc.Agent.Initialized {
 			// Agent already bootstrapped - no PIN to show
 			return c.JSON(fiber.Map{"pin": "", "initialized": true})
 		}
@@ -348,16 +579,13 @@ func panelAgents(api fiber.Router, db *gorm.DB, ch *sql.DB, deletionStore *delet
 		}
 		return c.JSON(fiber.Map{"pin": pin, "initialized": false})
 	})
+}
 
-	// GET /workspaces/{id}/available-global-agents — all global agents visible
-	// to this workspace (own workspace + cross-workspace). The panel deduplicates
-	// against the local agent list and labels every entry with a "[Global]"
-	// prefix in the probe-create target dropdown.
-	as.Get("/global", func(c *fiber.Ctx) error {
-		globals, err := agent.ListGlobalAgentsForWorkspace(c.UserContext(), db)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(fiber.Map{"data": globals})
-	})
+// hostHistoryQuery reads from, to and bucket for the host history
+// endpoints; probe.Get*History applies defaults and limits.
+func hostHistoryQuery(c *fiber.Ctx, agentID uint) probe.HostHistoryQuery {
+	q := probe.HostHistoryQuery{AgentID: agentID, BucketSec: intOrDefault(c.Query("bucket"), 0)}
+	q.From, _ = readTime(c.Query("from"))
+	q.To, _ = readTime(c.Query("to"))
+	return q
 }
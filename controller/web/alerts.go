@@ -3,6 +3,7 @@ package web
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -177,6 +178,117 @@ func panelAlerts(api fiber.Router, db *gorm.DB, ch *sql.DB) {
 		return c.JSON(fiber.Map{"ok": true})
 	})
 
+	// GET /workspaces/:id/alert-rules/:ruleID/webhook - Signing secret and verification doc (requires CanEdit)
+	rules.Get("/:ruleID/webhook", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		rule, err := alert.GetRuleByID(c.UserContext(), db, uintParam(c, "ruleID"))
+		if err != nil || rule.WorkspaceID != uintParam(c, "id") {
+			return APIError(c, 0, CodeNotFound, "alert rule not found")
+		}
+		return c.JSON(alert.WebhookDelivery(rule))
+	})
+
+	// POST /workspaces/:id/alert-rules/:ruleID/webhook/rotate-secret - New signing secret (requires CanEdit)
+	rules.Post("/:ruleID/webhook/rotate-secret", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		ruleID := uintParam(c, "ruleID")
+		rule, err := alert.GetRuleByID(c.UserContext(), db, ruleID)
+		if err != nil || rule.WorkspaceID != uintParam(c, "id") {
+			return APIError(c, 0, CodeNotFound, "alert rule not found")
+		}
+		secret, err := alert.RotateWebhookSecret(c.UserContext(), db, ruleID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		rule.WebhookSecret = secret
+		rule.HasWebhookSecret = true
+		return c.JSON(alert.WebhookDelivery(rule))
+	})
+
+	// -------------------- Notification Policy (per workspace) --------------------
+	policy := api.Group("/workspaces/:id/notification-policy")
+	policy.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/notification-policy - Dedup/renotify behavior for active alerts
+	policy.Get("/", func(c *fiber.Ctx) error {
+		p, err := alert.GetNotificationPolicy(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(p)
+	})
+
+	// PUT /workspaces/:id/notification-policy - Set the policy (requires CanManage)
+	policy.Put("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var input alert.NotificationPolicyInput
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		p, err := alert.SetNotificationPolicy(c.UserContext(), db, uintParam(c, "id"), currentUserID(c), input)
+		if err != nil {
+			if errors.Is(err, alert.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(p)
+	})
+
+	// -------------------- Silences (per workspace) --------------------
+	silences := api.Group("/workspaces/:id/silences")
+	silences.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/silences - Active and pending silences
+	// Query: state=active|pending|expired|all (comma-separated; default active,pending)
+	silences.Get("/", func(c *fiber.Ctx) error {
+		states := []string{alert.SilenceActive, alert.SilencePending}
+		if q := c.Query("state"); q == "all" {
+			states = nil
+		} else if q != "" {
+			states = queryList(c, "state")
+		}
+		list, err := alert.ListSilences(c.UserContext(), db, uintParam(c, "id"), states...)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/silences - Create a silence (requires CanEdit)
+	silences.Post("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var input alert.SilenceInput
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		s, err := alert.CreateSilence(c.UserContext(), db, uintParam(c, "id"), currentUserID(c), input)
+		if err != nil {
+			if errors.Is(err, alert.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusCreated).JSON(s)
+	})
+
+	// GET /workspaces/:id/silences/:silenceID - Get a silence
+	silences.Get("/:silenceID", func(c *fiber.Ctx) error {
+		s, err := alert.GetSilence(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "silenceID"))
+		if err != nil {
+			return APIError(c, 0, CodeNotFound, "silence not found")
+		}
+		return c.JSON(s)
+	})
+
+	// DELETE /workspaces/:id/silences/:silenceID - Expire a silence now (requires CanEdit)
+	silences.Delete("/:silenceID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		s, err := alert.ExpireSilence(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "silenceID"), currentUserID(c))
+		if errors.Is(err, alert.ErrNotFound) {
+			return APIError(c, 0, CodeNotFound, "silence not found")
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(s)
+	})
+
 	// GET /workspaces/:id/probes/:probeID/baseline - Get baseline stats for a probe
 	api.Get("/workspaces/:id/probes/:probeID/baseline", func(c *fiber.Ctx) error {
 		probeID := uintParam(c, "probeID")
@@ -17,15 +17,19 @@ import (
 	"netwatcher-controller/internal/agent"
 	"netwatcher-controller/internal/geoip"
 	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
 )
 
 func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.Store) {
+	wsStore := workspace.NewStore(pg)
+
 	// ------------------------------------------
 	// GET /workspaces/:id/analysis
-	// Workspace health overview with per-agent health vectors
-	// Query: lookback=<minutes, default 60>
+	// Workspace health overview with per-agent health vectors.
+	// Incidents are sorted by impact_score, highest first.
+	// Query: lookback=<minutes, default 60>, min_impact=<0-100, default 0>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] PANIC: %v", r)
@@ -33,14 +37,19 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		lookback := intOrDefault(c.Query("lookback"), 60)
 
-		analysis, err := probe.ComputeWorkspaceAnalysis(c.UserContext(), ch, pg, wID, lookback)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		analysis, err := probe.ComputeWorkspaceAnalysis(ctx, ch, pg, wID, lookback)
 		if err != nil {
 			log.Printf("[analysis] workspace=%d error: %v", wID, err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		if minImpact := floatOrDefault(c.Query("min_impact"), 0); minImpact > 0 {
+			analysis.Incidents = probe.FilterIncidentsByImpact(analysis.Incidents, minImpact)
+		}
 
 		jsonBytes, err := json.Marshal(analysis)
 		if err != nil {
@@ -52,12 +61,29 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 		return c.Send(jsonBytes)
 	})
 
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/global
+	// Workspace analysis combined across regions (see web/federation.go).
+	// Same as /analysis when no FEDERATION_PEERS are configured.
+	// Query: lookback=<minutes, default 60>, min_impact=<0-100, default 0>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/global", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 60)
+
+		fed := federatedWorkspaceAnalysis(c, pg, ch, wID, lookback)
+		if minImpact := floatOrDefault(c.Query("min_impact"), 0); minImpact > 0 {
+			fed.Incidents = probe.FilterIncidentsByImpact(fed.Incidents, minImpact)
+		}
+		return c.JSON(fed)
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/analysis/probes/:probeId
 	// Detailed probe analysis with bidirectional data
 	// Query: lookback=<minutes, default 60>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis/probes/:probeId", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis/probes/:probeId", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] probe PANIC: %v", r)
@@ -65,11 +91,13 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		probeID := uintParam(c, "probeId")
 		lookback := intOrDefault(c.Query("lookback"), 60)
 
-		analysis, err := probe.ComputeProbeAnalysis(c.UserContext(), ch, pg, wID, probeID, lookback)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		analysis, err := probe.ComputeProbeAnalysis(ctx, ch, pg, wID, probeID, lookback)
 		if err != nil {
 			log.Printf("[analysis] workspace=%d probe=%d error: %v", wID, probeID, err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -85,6 +113,35 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 		return c.Send(jsonBytes)
 	})
 
+	// ------------------------------------------
+	// POST /workspaces/:id/analysis/probes/health
+	// Compact health vectors for a list of probes (probe table chips),
+	// scored from one aggregation and cached per probe for a minute.
+	// Body: {"probe_ids": [1, 2, ...], "lookback": <minutes, default 60>}
+	// ------------------------------------------
+	api.Post("/workspaces/:id/analysis/probes/health", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		var body struct {
+			ProbeIDs []uint `json:"probe_ids"`
+			Lookback int    `json:"lookback"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+
+		wID := workspaceCtx(c).WorkspaceID
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		health, err := probe.ComputeProbeHealthBulk(ctx, ch, pg, wID, body.ProbeIDs, body.Lookback)
+		if errors.Is(err, probe.ErrBadInput) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			log.Printf("[analysis] workspace=%d probe health error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(health)
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/analysis/agents/:agentId
 	// Full agent detail: bidirectional analysis of every probe the
@@ -92,7 +149,7 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 	// voice quality summary, and the all-probes health score.
 	// Query: lookback=<minutes, default 60>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis/agents/:agentId", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis/agents/:agentId", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] agent PANIC: %v", r)
@@ -100,7 +157,7 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		agentID := uintParam(c, "agentId")
 		lookback := intOrDefault(c.Query("lookback"), 60)
 
@@ -110,7 +167,9 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found in workspace"})
 		}
 
-		analysis, err := probe.ComputePerAgentAnalysis(c.UserContext(), pg, ch, agentID, lookback)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		analysis, err := probe.ComputePerAgentAnalysis(ctx, pg, ch, agentID, lookback)
 		if err != nil {
 			log.Printf("[analysis] workspace=%d agent=%d error: %v", wID, agentID, err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -133,7 +192,7 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 	// them. Shaped for the health chord diagram.
 	// Query: lookback=<minutes, default 60>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis/mesh", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis/mesh", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] mesh PANIC: %v", r)
@@ -141,10 +200,12 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		lookback := intOrDefault(c.Query("lookback"), 60)
 
-		mesh, err := probe.ComputeWorkspaceHealthMesh(c.UserContext(), ch, pg, wID, lookback)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		mesh, err := probe.ComputeWorkspaceHealthMesh(ctx, ch, pg, wID, lookback)
 		if err != nil {
 			log.Printf("[analysis] mesh workspace=%d error: %v", wID, err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -152,12 +213,150 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 		return c.JSON(mesh)
 	})
 
+	// ------------------------------------------
+	// GET /workspaces/:id/mesh
+	// NxN source→destination latency / loss / MOS matrix between
+	// workspace agents (PING + TRAFFICSIM), aggregated in ClickHouse.
+	// Shaped for the mesh heatmap: cells[row=source][col=destination],
+	// null where no probes run between the pair.
+	// Query: lookback=<minutes, default 60>, group_by=<agent|location, default agent>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/mesh", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[analysis] mesh matrix PANIC: %v", r)
+				_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
+			}
+		}()
+
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 60)
+		groupBy := probe.MeshGroupBy(c.Query("group_by", string(probe.MeshGroupByAgent)))
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		matrix, err := probe.ComputeWorkspaceMeshMatrix(ctx, ch, pg, wID, lookback, groupBy)
+		if err != nil {
+			log.Printf("[analysis] mesh matrix workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(matrix)
+	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/dscp
+	// Per-DSCP-class latency / loss for every agent→host path measured
+	// under more than one marking, with classes doing worse than best
+	// effort listed as deprioritized.
+	// Query: lookback=<minutes, default 60>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/dscp", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[analysis] dscp PANIC: %v", r)
+				_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
+			}
+		}()
+
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 60)
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		cmp, err := probe.ComputeWorkspaceDSCPComparison(ctx, ch, pg, wID, lookback)
+		if err != nil {
+			log.Printf("[analysis] dscp workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(cmp)
+	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/external-check
+	// Compares agents' PING view of a target with third-party vantage
+	// points. Returns 202 while the external measurement is running.
+	// Query: target=<host or IP probed in the workspace>, lookback=<minutes, default 60>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/external-check", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 60)
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		cmp, err := probe.CompareExternalVantage(ctx, ch, pg, wID, c.Query("target"), lookback)
+		switch {
+		case errors.Is(err, probe.ErrVantageUnavailable):
+			return APIError(c, 0, CodeServiceUnavailable, err.Error())
+		case errors.Is(err, probe.ErrBadInput):
+			return APIError(c, 0, CodeValidationFailed, err.Error())
+		case err != nil:
+			log.Printf("[analysis] external-check workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if cmp.Pending {
+			return c.Status(http.StatusAccepted).JSON(cmp)
+		}
+		return c.JSON(cmp)
+	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/best-path
+	// Recommends which agent currently has the best path to each target
+	// probed by multiple agents.
+	// Query: target=<host or IP, optional>, lookback=<minutes, default 15>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/best-path", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 15)
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		report, err := probe.RecommendBestPaths(ctx, ch, pg, wID, c.Query("target"), lookback)
+		if err != nil {
+			log.Printf("[analysis] best-path workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(report)
+	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/route-search
+	// Every agent → target path whose recent MTR traces crossed a hop IP
+	// or prefix, with current health.
+	// Query: hop=<IP or CIDR>, lookback=<minutes, default 60, max 10080>, agent_id
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/route-search", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		result, err := probe.SearchRoutesByHop(ctx, ch, pg, probe.RouteSearchQuery{
+			WorkspaceID:     wID,
+			Hop:             c.Query("hop"),
+			LookbackMinutes: intOrDefault(c.Query("lookback"), 0),
+			AgentID:         uint(intOrDefault(c.Query("agent_id"), 0)),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, probe.ErrBadInput):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, probe.ErrNotFound):
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			case errors.Is(err, context.DeadlineExceeded):
+				return c.Status(http.StatusGatewayTimeout).JSON(fiber.Map{"error": "route search timed out"})
+			}
+			log.Printf("[analysis] route-search workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/analysis/routes
 	// Route/path analysis for cross-agent route comparison and divergence detection
 	// Query: lookback=<hours, default 24>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis/routes", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis/routes", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] routes PANIC: %v", r)
@@ -165,14 +364,14 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		lookbackHours := intOrDefault(c.Query("lookback"), 24)
 
 		// Bound the compute so a slow ClickHouse query never blows past
 		// the Fiber WriteTimeout (30s) and gets the connection killed
 		// mid-response. Returning 504 lets the client surface a real
 		// error instead of a hung spinner.
-		ctx, cancel := context.WithTimeout(c.UserContext(), 25*time.Second)
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
 		defer cancel()
 
 		// The probe package accepts a nil geoStore and skips ASN grouping.
@@ -201,12 +400,47 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 		return c.Send(jsonBytes)
 	})
 
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/routes/stability
+	// Long-range route stability per destination: unique routes, per-route
+	// share, change timeline and differing hops.
+	// Query: from, to (RFC3339 or unix; default last 30 days, max 90),
+	//        target=<substring>, probe_id, agent_id
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/routes/stability", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+		from, _ := readTime(c.Query("from"))
+		to, _ := readTime(c.Query("to"))
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+
+		report, err := probe.ComputeRouteStabilityReport(ctx, ch, pg, wID, probe.RouteStabilityFilter{
+			From:    from,
+			To:      to,
+			Target:  c.Query("target"),
+			ProbeID: uint(intOrDefault(c.Query("probe_id"), 0)),
+			AgentID: uint(intOrDefault(c.Query("agent_id"), 0)),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, probe.ErrBadInput):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, context.DeadlineExceeded):
+				return c.Status(http.StatusGatewayTimeout).JSON(fiber.Map{"error": "route stability report timed out"})
+			}
+			log.Printf("[analysis] route stability workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(report)
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/analysis/history
 	// Historical analysis snapshots for trend analysis
 	// Query: from=<RFC3339>, to=<RFC3339>, limit=<int, default 288>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/analysis/history", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/analysis/history", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[analysis] history PANIC: %v", r)
@@ -214,7 +448,7 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		limit := intOrDefault(c.Query("limit"), 288)
 
 		var from, to time.Time
@@ -252,6 +486,67 @@ func panelAnalysis(api fiber.Router, pg *gorm.DB, ch *sql.DB, geoStore *geoip.St
 		c.Set("Content-Type", "application/json")
 		return c.Send(jsonBytes)
 	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/analysis/forecast
+	// Capacity planning: linear trend projection of daily latency / loss
+	// (per probe) and health / bandwidth (per agent), flagging series
+	// projected to breach an SLO threshold within the horizon.
+	// Query: lookback_days=<int, default 30>, horizon_weeks=<int, default 4>,
+	//        latency_ms, loss_pct, bandwidth_mbps, health_score (SLO overrides),
+	//        probe_id, agent_id (optional scope)
+	// ------------------------------------------
+	api.Get("/workspaces/:id/analysis/forecast", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[analysis] forecast PANIC: %v", r)
+				_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
+			}
+		}()
+
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback_days"), 30)
+		horizon := intOrDefault(c.Query("horizon_weeks"), 4)
+		if lookback > 365 {
+			lookback = 365
+		}
+		if horizon > 52 {
+			horizon = 52
+		}
+
+		opts := probe.ForecastOptions{
+			LookbackDays: lookback,
+			HorizonWeeks: horizon,
+			SLO: probe.ForecastSLO{
+				LatencyMs:     floatOrDefault(c.Query("latency_ms"), probe.DefaultForecastSLO.LatencyMs),
+				LossPct:       floatOrDefault(c.Query("loss_pct"), probe.DefaultForecastSLO.LossPct),
+				BandwidthMbps: floatOrDefault(c.Query("bandwidth_mbps"), probe.DefaultForecastSLO.BandwidthMbps),
+				HealthScore:   floatOrDefault(c.Query("health_score"), probe.DefaultForecastSLO.HealthScore),
+			},
+		}
+		if v, ok := parseUint64(c.Query("probe_id")); ok {
+			opts.ProbeID = uint(v)
+		}
+		if v, ok := parseUint64(c.Query("agent_id")); ok {
+			opts.AgentID = uint(v)
+		}
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		forecast, err := probe.ComputeWorkspaceForecast(ctx, ch, pg, wID, opts)
+		if err != nil {
+			log.Printf("[analysis] forecast workspace=%d error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		jsonBytes, err := json.Marshal(forecast)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "json serialization failed"})
+		}
+
+		c.Set("Content-Type", "application/json")
+		return c.Send(jsonBytes)
+	})
 }
 
 // geoStoreAdapter wraps *geoip.Store to satisfy probe.GeoIPResolver. We can't
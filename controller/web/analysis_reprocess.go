@@ -0,0 +1,80 @@
+// web/analysis_reprocess.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelAnalysisReprocess mounts snapshot reprocessing — recomputing
+// historical analysis snapshots with the current scoring code and
+// comparing them to the live snapshots.
+func panelAnalysisReprocess(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	base := api.Group("/workspaces/:id/analysis/reprocess")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	reprocessError := func(c *fiber.Ctx, err error) error {
+		switch {
+		case errors.Is(err, probe.ErrBadInput):
+			return APIError(c, 0, CodeValidationFailed, err.Error())
+		case errors.Is(err, probe.ErrNotFound):
+			return APIError(c, 0, CodeNotFound, "reprocess job not found")
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// GET /workspaces/:id/analysis/reprocess - requires CanView (any member)
+	base.Get("/", func(c *fiber.Ctx) error {
+		jobs, err := probe.ListReprocessJobs(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return reprocessError(c, err)
+		}
+		return c.JSON(NewListResponse(jobs))
+	})
+
+	// POST /workspaces/:id/analysis/reprocess - requires CanManage (ADMIN+)
+	// Body: {"from": RFC3339, "to": RFC3339, "step_minutes": 0, "lookback_minutes": 60}
+	base.Post("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body probe.ReprocessInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		job, err := probe.CreateReprocessJob(c.UserContext(), db, uintParam(c, "id"), currentUserID(c), body)
+		if err != nil {
+			return reprocessError(c, err)
+		}
+		return c.Status(http.StatusAccepted).JSON(job)
+	})
+
+	// GET /workspaces/:id/analysis/reprocess/:jobID - requires CanView
+	base.Get("/:jobID", func(c *fiber.Ctx) error {
+		job, err := probe.GetReprocessJob(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "jobID"))
+		if err != nil {
+			return reprocessError(c, err)
+		}
+		return c.JSON(job)
+	})
+
+	// GET /workspaces/:id/analysis/reprocess/:jobID/compare - requires CanView
+	// Reprocessed snapshots paired with the live snapshots at the same time.
+	base.Get("/:jobID/compare", func(c *fiber.Ctx) error {
+		job, err := probe.GetReprocessJob(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "jobID"))
+		if err != nil {
+			return reprocessError(c, err)
+		}
+		cmp, err := probe.CompareReprocessJob(c.UserContext(), ch, job)
+		if err != nil {
+			return reprocessError(c, err)
+		}
+		return c.JSON(cmp)
+	})
+}
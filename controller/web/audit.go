@@ -0,0 +1,127 @@
+// web/audit.go
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"netwatcher-controller/internal/audit"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// auditSkipSegments are route segments under /workspaces/:id whose
+// mutating requests are not configuration changes: agent heartbeats,
+// data queries that happen to be POSTs, on-demand jobs, and timeline
+// annotations (which appear on the timeline themselves).
+var auditSkipSegments = map[string]bool{
+	"heartbeat":        true,
+	"probe-data":       true,
+	"analysis":         true,
+	"speedtest-queue":  true,
+	"incident-tickets": true,
+	"accept-invite":    true,
+	"timeline":         true,
+}
+
+// auditActionSegments are operations on the resource before them
+// ("/agents/:agentID/rotate-psk") and are recorded as the action.
+var auditActionSegments = map[string]bool{
+	"regenerate":         true,
+	"rotate-psk":         true,
+	"issue-pin":          true,
+	"copy":               true,
+	"onboarding":         true,
+	"transfer-ownership": true,
+	"rotate-secret":      true,
+}
+
+// ConfigAuditMiddleware records successful POST/PATCH/PUT/DELETE requests
+// under /workspaces/:id in the workspace audit log. It runs after the
+// handler, so the matched route pattern and response status are known;
+// failures to record are logged and never fail the request.
+func ConfigAuditMiddleware(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		var action string
+		switch c.Method() {
+		case http.MethodPost:
+			action = audit.ActionCreate
+		case http.MethodPatch, http.MethodPut:
+			action = audit.ActionUpdate
+		case http.MethodDelete:
+			action = audit.ActionDelete
+		default:
+			return err
+		}
+		status := c.Response().StatusCode()
+		if err != nil || status >= 400 {
+			return err
+		}
+		entry, ok := auditEntryForRoute(c.Route().Path, action, c.AllParams())
+		if !ok {
+			return nil
+		}
+		entry.Method = c.Method()
+		entry.Status = status
+		entry.UserID = currentUserID(c)
+		entry.RequestID = requestID(c)
+		if rerr := audit.Record(c.UserContext(), db, entry); rerr != nil {
+			log.Warnf("audit: ws=%d %s %s: %v", entry.WorkspaceID, entry.Method, entry.Route, rerr)
+		}
+		return nil
+	}
+}
+
+// auditEntryForRoute derives the audited resource from a route pattern:
+// the last static segment names it ("probes" → "probe") and a parameter
+// right after it is its ID. Routes outside /workspaces/:id, and the
+// segments in auditSkipSegments, are not audited.
+func auditEntryForRoute(route, action string, params map[string]string) (*audit.Entry, bool) {
+	const prefix = "/workspaces/:id"
+	if !strings.HasPrefix(route, prefix) {
+		return nil, false
+	}
+	wsID, err := strconv.ParseUint(params["id"], 10, 64)
+	if err != nil || wsID == 0 {
+		return nil, false
+	}
+	e := &audit.Entry{WorkspaceID: uint(wsID), Action: action, Route: route, Resource: "workspace"}
+
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(route, prefix), "/"), "/")
+	for i, seg := range segs {
+		if seg == "" {
+			continue
+		}
+		if auditSkipSegments[seg] {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, ":") {
+			if i > 0 && !strings.HasPrefix(segs[i-1], ":") {
+				id, _ := strconv.ParseUint(params[seg[1:]], 10, 64)
+				e.TargetID = uint(id)
+			}
+			continue
+		}
+		if auditActionSegments[seg] && i > 0 {
+			e.Action = seg
+			continue
+		}
+		e.Resource = strings.TrimSuffix(seg, "s")
+		e.TargetID = 0
+	}
+	if aid, err := strconv.ParseUint(params["agentID"], 10, 64); err == nil && aid > 0 {
+		id := uint(aid)
+		e.AgentID = &id
+	}
+	if len(params) > 0 {
+		b, _ := json.Marshal(params)
+		e.Params = b
+	}
+	return e, true
+}
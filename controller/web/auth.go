@@ -2,6 +2,7 @@
 package web
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 
 	"netwatcher-controller/internal/email"
 	"netwatcher-controller/internal/users"
+	"netwatcher-controller/internal/workspace"
 
 	"github.com/gofiber/fiber/v2"
 	log "github.com/sirupsen/logrus"
@@ -22,9 +24,14 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 
 	// GET /auth/config - public endpoint for panel to check registration settings
 	auth.Get("/config", func(c *fiber.Ctx) error {
+		p := users.DefaultSessionPolicy()
 		return c.JSON(fiber.Map{
-			"registration_enabled":        isRegistrationEnabled(),
-			"email_verification_required": isEmailVerificationRequired(),
+			"registration_enabled":         isRegistrationEnabled(),
+			"email_verification_required":  isEmailVerificationRequired(),
+			"access_token_ttl_seconds":     int(p.AccessTTL / time.Second),
+			"session_idle_timeout_seconds": int(p.IdleTimeout / time.Second),
+			"session_max_lifetime_seconds": int(p.MaxLifetime / time.Second),
+			"session_sliding":              p.Sliding,
 		})
 	})
 
@@ -54,7 +61,7 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 			Labels:   jsonFromMap(body.Labels),
 			Metadata: jsonFromMap(body.Metadata),
 		}
-		token, u, _, err := users.RegisterUser(c.UserContext(), db, in, c.IP())
+		tokens, u, _, err := users.RegisterUser(c.UserContext(), db, in, c.IP(), sessionPolicyFor(c.UserContext(), db))
 		if err != nil {
 			if errors.Is(err, users.ErrPasswordTooShort) {
 				return c.Status(http.StatusBadRequest).JSON(fiber.Map{
@@ -77,7 +84,7 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 			}
 		}
 
-		return c.JSON(fiber.Map{"token": token, "data": u})
+		return c.JSON(tokenResponse(tokens, fiber.Map{"data": u}))
 	})
 
 	// GET /auth/me - returns current authenticated user
@@ -112,6 +119,10 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 		if !ok {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid user context"})
 		}
+		sess, ok := currentSession(c)
+		if !ok {
+			return APIError(c, 0, CodeAuthRequired, "session required")
+		}
 
 		var body struct {
 			OldPassword string `json:"old_password"`
@@ -141,7 +152,12 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		return c.JSON(fiber.Map{"success": true})
+		// Sessions opened with the old password end; this one stays.
+		revoked, err := users.RevokeUserSessions(c.UserContext(), db, user.ID, sess.SessionID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "password changed but other sessions could not be revoked"})
+		}
+		return c.JSON(fiber.Map{"success": true, "revoked_sessions": revoked})
 	})
 
 	// POST /auth/login
@@ -154,11 +170,97 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 			return c.SendStatus(http.StatusBadRequest)
 		}
 		in := users.LoginInput{Email: body.Email, Password: body.Password}
-		token, u, _, err := users.LoginUser(c.UserContext(), db, in, c.IP())
+		tokens, u, _, err := users.LoginUser(c.UserContext(), db, in, c.IP(), sessionPolicyFor(c.UserContext(), db))
 		if err != nil {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.JSON(fiber.Map{"token": token, "data": u, "email_verification_required": isEmailVerificationRequired()})
+		return c.JSON(tokenResponse(tokens, fiber.Map{"data": u, "email_verification_required": isEmailVerificationRequired()}))
+	})
+
+	// POST /auth/refresh - trade a refresh token for a new token pair.
+	// The refresh token is single-use; replaying a used one revokes the
+	// session.
+	auth.Post("/refresh", rateLimitByIP(30, time.Minute), func(c *fiber.Ctx) error {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		tokens, err := users.RefreshSession(c.UserContext(), db, body.RefreshToken, sessionPolicyFor(c.UserContext(), db))
+		if err != nil {
+			switch {
+			case errors.Is(err, users.ErrRefreshReused):
+				log.WithField("ip", c.IP()).Warn("refresh token replayed; session revoked")
+				return APIError(c, 0, CodeAuthRequired, err.Error())
+			case errors.Is(err, users.ErrInvalidToken), errors.Is(err, users.ErrExpiredToken),
+				errors.Is(err, users.ErrSessionRevoked), errors.Is(err, users.ErrSessionNotFound):
+				return APIError(c, 0, CodeAuthRequired, "invalid or expired refresh token")
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(tokenResponse(tokens, nil))
+	})
+
+	// POST /auth/logout - revoke the current session. {"all": true} also
+	// ends the user's other sessions.
+	auth.Post("/logout", JWTMiddleware(db), func(c *fiber.Ctx) error {
+		var body struct {
+			All bool `json:"all"`
+		}
+		_ = c.BodyParser(&body)
+		sess, ok := currentSession(c)
+		if !ok {
+			return APIError(c, 0, CodeAuthRequired, "session required")
+		}
+		if body.All {
+			if _, err := users.RevokeUserSessions(c.UserContext(), db, sess.UserID, 0); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+		} else if err := users.RevokeSession(c.UserContext(), db, sess.SessionID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"success": true})
+	})
+
+	// GET /auth/sessions - the current user's live sessions
+	auth.Get("/sessions", JWTMiddleware(db), func(c *fiber.Ctx) error {
+		sess, ok := currentSession(c)
+		if !ok {
+			return APIError(c, 0, CodeAuthRequired, "session required")
+		}
+		list, err := users.ListUserSessions(c.UserContext(), db, sess.UserID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		out := make([]fiber.Map, 0, len(list))
+		for _, s := range list {
+			out = append(out, fiber.Map{
+				"session_id":   s.SessionID,
+				"created":      s.Created,
+				"expiry":       s.Expiry,
+				"refreshed_at": s.RefreshedAt,
+				"ip":           s.IP,
+				"current":      s.SessionID == sess.SessionID,
+			})
+		}
+		return c.JSON(NewListResponse(out))
+	})
+
+	// DELETE /auth/sessions/:sid - revoke one of the current user's sessions
+	auth.Delete("/sessions/:sid", JWTMiddleware(db), func(c *fiber.Ctx) error {
+		sess, ok := currentSession(c)
+		if !ok {
+			return APIError(c, 0, CodeAuthRequired, "session required")
+		}
+		target, err := users.GetSession(c.UserContext(), db, uintParam(c, "sid"))
+		if err != nil || target.UserID != sess.UserID {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+		if err := users.RevokeSession(c.UserContext(), db, target.SessionID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"success": true})
 	})
 
 	// POST /auth/verify-email - verify email with token
@@ -315,6 +417,11 @@ func registerAuthRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueStor
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update password"})
 		}
 
+		// A reset means the old password may be known to someone else:
+		// end every session.
+		if _, err := users.RevokeUserSessions(c.UserContext(), db, userID, 0); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "password reset but sessions could not be revoked"})
+		}
 		return c.JSON(fiber.Map{"success": true, "message": "password reset successfully"})
 	})
 }
@@ -340,3 +447,47 @@ func isEmailVerificationRequired() bool {
 	v := strings.ToLower(strings.TrimSpace(os.Getenv("REQUIRE_EMAIL_VERIFICATION")))
 	return v == "true" || v == "1" || v == "yes"
 }
+
+// tokenResponse merges a token pair's fields (token, expires_at,
+// refresh_token, …) into an auth response body.
+func tokenResponse(t *users.TokenPair, extra fiber.Map) fiber.Map {
+	out := fiber.Map{
+		"token":              t.Token,
+		"expires_at":         t.ExpiresAt,
+		"expires_in":         t.ExpiresIn,
+		"refresh_token":      t.RefreshToken,
+		"refresh_expires_at": t.RefreshExpiresAt,
+		"session_expires_at": t.SessionExpiresAt,
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
+
+// sessionPolicyFor returns the session policy for a user: the controller
+// defaults, tightened by the session settings of each of their workspaces.
+func sessionPolicyFor(ctx context.Context, db *gorm.DB) func(userID uint) users.SessionPolicy {
+	store := workspace.NewStore(db)
+	return func(userID uint) users.SessionPolicy {
+		p := users.DefaultSessionPolicy()
+		list, err := store.MemberSessionSettings(ctx, userID)
+		if err != nil {
+			log.WithError(err).WithField("user_id", userID).Warn("session policy: workspace settings unavailable; using defaults")
+			return p
+		}
+		for _, ss := range list {
+			p = p.Tighten(workspaceSessionPolicy(ss))
+		}
+		return p
+	}
+}
+
+func workspaceSessionPolicy(ss workspace.SessionSettings) users.SessionPolicy {
+	return users.SessionPolicy{
+		AccessTTL:   time.Duration(ss.AccessTokenMinutes) * time.Minute,
+		IdleTimeout: time.Duration(ss.IdleTimeoutMinutes) * time.Minute,
+		MaxLifetime: time.Duration(ss.MaxLifetimeHours) * time.Hour,
+		Sliding:     ss.Sliding == nil || *ss.Sliding,
+	}
+}
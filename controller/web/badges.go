@@ -0,0 +1,233 @@
+// web/badges.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/share"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// -------------------- Protected Endpoints (JWT auth) --------------------
+
+// panelBadges registers badge token management for workspace editors.
+func panelBadges(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/badges")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/badges - list badge tokens
+	base.Get("/", func(c *fiber.Ctx) error {
+		badges, err := share.ListBadges(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(badges))
+	})
+
+	// POST /workspaces/:id/badges - requires CanEdit (USER+)
+	base.Post("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		workspaceID := uintParam(c, "id")
+		var body struct {
+			Kind          string `json:"kind"` // probe, agent
+			SubjectID     uint   `json:"subject_id"`
+			Label         string `json:"label,omitempty"`
+			WindowMinutes int    `json:"window_minutes,omitempty"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+
+		// Verify the subject belongs to the workspace
+		switch body.Kind {
+		case share.BadgeKindProbe:
+			p, err := probe.GetByID(c.UserContext(), db, body.SubjectID)
+			if err != nil || p.WorkspaceID != workspaceID {
+				return APIError(c, 0, CodeProbeNotFound, "probe not found")
+			}
+		case share.BadgeKindAgent:
+			if _, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, workspaceID, body.SubjectID); err != nil {
+				return APIError(c, 0, CodeAgentNotFound, "agent not found")
+			}
+		}
+
+		b, err := share.CreateBadge(c.UserContext(), db, share.CreateBadgeInput{
+			WorkspaceID:     workspaceID,
+			Kind:            body.Kind,
+			SubjectID:       body.SubjectID,
+			Label:           body.Label,
+			Window:          time.Duration(body.WindowMinutes) * time.Minute,
+			CreatedByUserID: currentUserID(c),
+		})
+		if err != nil {
+			if errors.Is(err, share.ErrInvalidBadge) {
+				return APIError(c, 0, CodeValidationFailed, "kind must be probe or agent, subject_id is required, window_minutes must be at most 43200 and label at most 64 characters")
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusCreated).JSON(b)
+	})
+
+	// DELETE /workspaces/:id/badges/:badgeID - requires CanEdit (USER+)
+	base.Delete("/:badgeID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		err := share.DeleteBadge(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "badgeID"))
+		if err != nil {
+			if errors.Is(err, share.ErrBadgeNotFound) {
+				return APIError(c, 0, CodeNotFound, "badge not found")
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
+
+// -------------------- Public Endpoints (no auth) --------------------
+
+// RegisterBadgeRoutes registers the public, token-guarded badge endpoints.
+// Embeds are fetched on every page render, so responses are cacheable for
+// a minute and requests are rate limited per client IP.
+func RegisterBadgeRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
+	badges := app.Group("/badges", rateLimitByIP(120, time.Minute))
+
+	badges.Get("/:token.json", func(c *fiber.Ctx) error {
+		b, s, err := loadBadge(c, db, ch)
+		if err != nil {
+			return badgeError(c, err)
+		}
+		c.Set("Cache-Control", "public, max-age=60")
+		return c.JSON(fiber.Map{"label": badgeLabel(b, s), "summary": s})
+	})
+
+	// ?metric=uptime|latency|grade renders a single value; default shows all.
+	badges.Get("/:token.svg", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "image/svg+xml; charset=utf-8")
+		b, s, err := loadBadge(c, db, ch)
+		if err != nil {
+			c.Set("Cache-Control", "no-cache")
+			status := http.StatusInternalServerError
+			if errors.Is(err, share.ErrBadgeNotFound) || errors.Is(err, probe.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			return c.Status(status).SendString(renderBadgeSVG("netwatcher", "unavailable", badgeColorUnknown))
+		}
+		message, color := badgeMessage(s, c.Query("metric"))
+		c.Set("Cache-Control", "public, max-age=60")
+		return c.SendString(renderBadgeSVG(badgeLabel(b, s), message, color))
+	})
+}
+
+func loadBadge(c *fiber.Ctx, db *gorm.DB, ch *sql.DB) (*share.Badge, *probe.BadgeSummary, error) {
+	b, err := share.GetBadgeByToken(c.UserContext(), db, c.Params("token"))
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := probe.ComputeBadge(c.UserContext(), ch, db, b.Kind, b.WorkspaceID, b.SubjectID, b.WindowMinutes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, s, nil
+}
+
+func badgeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, share.ErrBadgeNotFound):
+		return APIError(c, 0, CodeNotFound, "badge not found")
+	case errors.Is(err, probe.ErrNotFound):
+		return APIError(c, 0, CodeNotFound, "badge subject no longer exists")
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to compute badge"})
+	}
+}
+
+func badgeLabel(b *share.Badge, s *probe.BadgeSummary) string {
+	if b.Label != "" {
+		return b.Label
+	}
+	if s.Name != "" {
+		return s.Name
+	}
+	return "netwatcher"
+}
+
+// Shields-style palette.
+const (
+	badgeColorExcellent = "#4c1"
+	badgeColorGood      = "#97ca00"
+	badgeColorFair      = "#dfb317"
+	badgeColorPoor      = "#fe7d37"
+	badgeColorCritical  = "#e05d44"
+	badgeColorUnknown   = "#9f9f9f"
+)
+
+func badgeGradeColor(grade string) string {
+	switch grade {
+	case "excellent":
+		return badgeColorExcellent
+	case "good":
+		return badgeColorGood
+	case "fair":
+		return badgeColorFair
+	case "poor":
+		return badgeColorPoor
+	case "critical":
+		return badgeColorCritical
+	default:
+		return badgeColorUnknown
+	}
+}
+
+// badgeMessage formats the right-hand side of the badge for metric.
+func badgeMessage(s *probe.BadgeSummary, metric string) (string, string) {
+	if s.Samples == 0 {
+		return "no data", badgeColorUnknown
+	}
+	color := badgeGradeColor(s.Grade)
+	switch metric {
+	case "uptime":
+		return fmt.Sprintf("%.2f%%", s.UptimePct), color
+	case "latency":
+		return fmt.Sprintf("%.0fms", s.MedianLatencyMs), color
+	case "grade":
+		return s.Grade, color
+	default:
+		return fmt.Sprintf("%.2f%% | %.0fms | %s", s.UptimePct, s.MedianLatencyMs, s.Grade), color
+	}
+}
+
+// renderBadgeSVG draws a flat two-part badge. Widths are estimated at
+// ~6.5px per character of 11px Verdana, which is close enough without
+// shipping font metrics.
+func renderBadgeSVG(label, message, color string) string {
+	if r := []rune(label); len(r) > 40 {
+		label = string(r[:39]) + "…"
+	}
+	lw := len([]rune(label))*13/2 + 10
+	mw := len([]rune(message))*13/2 + 10
+	w := lw + mw
+	label, message = html.EscapeString(label), html.EscapeString(message)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<title>%s: %s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		w, label, message,
+		label, message,
+		w,
+		lw, lw, mw, color, w,
+		lw/2, label, lw/2, label,
+		lw+mw/2, message, lw+mw/2, message)
+}
@@ -0,0 +1,194 @@
+// web/compress.go
+package web
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Response compression for the REST API.
+//
+// Network map and raw probe data responses can run to tens of MB of JSON,
+// which compresses 10–20x. CompressHandler negotiates zstd or gzip from
+// Accept-Encoding and compresses on the fly, so streamed responses (see
+// stream.go) stay streamed. It wraps the Fiber bridge only; WebSocket
+// routes need http.Hijacker and /metrics negotiates its own encoding.
+//
+// Configuration:
+//   HTTP_COMPRESSION=false            disable entirely
+//   HTTP_COMPRESSION_MIN_BYTES=1024   skip bodies with a smaller Content-Length
+
+const defaultCompressMinBytes = 1024
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	zstdPool = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return w
+	}}
+)
+
+// CompressHandler wraps next with Accept-Encoding negotiated compression.
+// Returns next unchanged when HTTP_COMPRESSION is false.
+func CompressHandler(next http.Handler) http.Handler {
+	if v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv("HTTP_COMPRESSION"))); err == nil && !v {
+		return next
+	}
+	minBytes := defaultCompressMinBytes
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("HTTP_COMPRESSION_MIN_BYTES"))); err == nil && n >= 0 {
+		minBytes = n
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: enc, minBytes: minBytes}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks zstd over gzip, honouring q=0 exclusions.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		accepted[name] = q > 0
+	}
+	switch {
+	case accepted["zstd"]:
+		return "zstd"
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["*"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressibleType reports whether a Content-Type is worth compressing.
+func compressibleType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		mt == "application/json",
+		strings.HasSuffix(mt, "+json"),
+		mt == "application/x-ndjson",
+		mt == "application/javascript",
+		mt == "application/xml",
+		mt == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter decides on the first WriteHeader/Write whether to
+// compress, based on status, Content-Type, Content-Encoding and length.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+
+	decided bool
+	enc     io.WriteCloser // nil when passing through
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.decided {
+		cw.decide(status)
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.enc.Write(p)
+}
+
+func (cw *compressWriter) decide(status int) {
+	cw.decided = true
+	h := cw.Header()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || !compressibleType(h.Get("Content-Type")) {
+		return
+	}
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil && n < cw.minBytes {
+			return
+		}
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", cw.encoding)
+	switch cw.encoding {
+	case "zstd":
+		zw := zstdPool.Get().(*zstd.Encoder)
+		zw.Reset(cw.ResponseWriter)
+		cw.enc = zw
+	default:
+		gw := gzipPool.Get().(*gzip.Writer)
+		gw.Reset(cw.ResponseWriter)
+		cw.enc = gw
+	}
+}
+
+// Flush pushes buffered compressed data to the client so streamed
+// responses arrive incrementally.
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close finishes the compressed stream and returns the encoder to its pool.
+func (cw *compressWriter) Close() {
+	if cw.enc == nil {
+		return
+	}
+	_ = cw.enc.Close()
+	switch e := cw.enc.(type) {
+	case *zstd.Encoder:
+		e.Reset(nil)
+		zstdPool.Put(e)
+	case *gzip.Writer:
+		e.Reset(io.Discard)
+		gzipPool.Put(e)
+	}
+	cw.enc = nil
+}
+
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -15,18 +16,28 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 
+	"netwatcher-controller/internal/agent"
 	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
 )
 
 func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	base := api.Group("/workspaces/:id/probe-data")
+	wsStore := workspace.NewStore(pg)
+
+	// Every probe-data route requires workspace membership; routes naming
+	// an agent or probe also check it belongs to the workspace.
+	base.Use(RequireWorkspaceAccess(wsStore))
 
 	// ------------------------------------------
 	// GET /workspaces/:id/network-map
-	// Aggregated network topology map for the workspace
-	// Query: lookback=<minutes, default 15>
+	// Aggregated network topology map for the workspace, served from the
+	// background build when one covers the lookback
+	// Query: lookback=<minutes, default 15>, agent_ids=1,2, targets=<globs>,
+	// probe_types=MTR,PING,TRAFFICSIM, min_severity=degraded|critical,
+	// max_hops, max_nodes, max_edges (all optional)
 	// ------------------------------------------
-	api.Get("/workspaces/:id/network-map", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/network-map", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[network-map] PANIC: %v", r)
@@ -34,14 +45,36 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		lookback := intOrDefault(c.Query("lookback"), 15)
 
-		mapData, err := probe.GetWorkspaceNetworkMap(c.UserContext(), ch, pg, wID, lookback)
+		filter := probe.NetworkMapFilter{
+			Targets:     queryList(c, "targets"),
+			ProbeTypes:  queryList(c, "probe_types"),
+			MinSeverity: strings.ToLower(c.Query("min_severity")),
+			MaxHops:     intOrDefault(c.Query("max_hops"), 0),
+			MaxNodes:    intOrDefault(c.Query("max_nodes"), 0),
+			MaxEdges:    intOrDefault(c.Query("max_edges"), 0),
+		}
+		for _, s := range queryList(c, "agent_ids") {
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "agent_ids must be a comma-separated list of IDs"})
+			}
+			filter.AgentIDs = append(filter.AgentIDs, uint(id))
+		}
+
+		mapData, err := probe.MaterializedNetworkMap(c.UserContext(), ch, pg, wID, lookback)
 		if err != nil {
 			log.Printf("[network-map] workspace=%d error: %v", wID, err)
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		if mapData, err = probe.FilterNetworkMap(mapData, filter); err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
 
 		// Explicitly marshal to check for JSON errors
 		jsonBytes, err := json.Marshal(mapData)
@@ -54,12 +87,33 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		return c.Send(jsonBytes)
 	})
 
+	// ------------------------------------------
+	// GET /workspaces/:id/network-map/destinations
+	// Per-destination summaries only, for overview panels
+	// Query: lookback=<minutes, default 15>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/network-map/destinations", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		wID := workspaceCtx(c).WorkspaceID
+		lookback := intOrDefault(c.Query("lookback"), 15)
+
+		dests, generatedAt, err := probe.MaterializedDestinations(c.UserContext(), ch, pg, wID, lookback)
+		if err != nil {
+			log.Printf("[network-map] workspace=%d destinations error: %v", wID, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{
+			"data":         dests,
+			"total":        len(dests),
+			"generated_at": generatedAt,
+		})
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/connectivity-matrix
 	// Aggregated connectivity matrix for the workspace
 	// Query: lookback=<minutes, default 15>
 	// ------------------------------------------
-	api.Get("/workspaces/:id/connectivity-matrix", func(c *fiber.Ctx) error {
+	api.Get("/workspaces/:id/connectivity-matrix", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[connectivity-matrix] PANIC: %v", r)
@@ -67,7 +121,7 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 			}
 		}()
 
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		lookback := intOrDefault(c.Query("lookback"), 15)
 
 		matrix, err := probe.GetWorkspaceConnectivityMatrix(c.UserContext(), ch, pg, wID, lookback)
@@ -94,11 +148,14 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// Returns aggregated MOS scores computed from TrafficSim metrics
 	// ------------------------------------------
 	base.Get("/mos-timeseries", func(c *fiber.Ctx) error {
-		wID := uintParam(c, "id")
+		wID := workspaceCtx(c).WorkspaceID
 		probeID := intOrDefault(c.Query("probeId"), 0)
 		if probeID == 0 {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "probeId is required"})
 		}
+		if !workspaceOwnsProbe(c, pg, uint(probeID)) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+		}
 
 		from, _ := readTime(c.Query("from"))
 		if from.IsZero() {
@@ -161,14 +218,28 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// ------------------------------------------
 	// GET /workspaces/:id/probe-data/find
 	// Flexible finder across ClickHouse with query params mirroring pd.FindParams
+	// Label filters: label.<key>=<value> for keys in CH_LABEL_COLUMNS
 	// ------------------------------------------
 	base.Get("/find", func(c *fiber.Ctx) error {
 		p, bad := readFindParams(c)
 		if bad != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": bad.Error()})
 		}
+		// probe_data has no workspace column: scope the search through an
+		// agent or probe of this workspace.
+		if p.ProbeID == nil && p.AgentID == nil && p.ProbeAgentID == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "probeId, agentId or probeAgentId is required"})
+		}
+		if (p.ProbeID != nil && !workspaceOwnsProbe(c, pg, uint(*p.ProbeID))) ||
+			(p.AgentID != nil && !workspaceOwnsAgent(c, pg, uint(*p.AgentID))) ||
+			(p.ProbeAgentID != nil && !workspaceOwnsAgent(c, pg, uint(*p.ProbeAgentID))) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe or agent not found"})
+		}
 		rows, err := probe.FindProbeData(c.UserContext(), ch, p)
 		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.JSON(NewListResponse(rows))
@@ -180,8 +251,8 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// This works around historical data having incorrect probe_id values
 	// Query: limit (default 25)
 	// ------------------------------------------
-	base.Get("/agents/:agentID/speedtests", func(c *fiber.Ctx) error {
-		agentID := uint64(uintParam(c, "agentID"))
+	base.Get("/agents/:agentID/speedtests", RequireWorkspaceAgent(wsStore, pg), func(c *fiber.Ctx) error {
+		agentID := uint64(workspaceCtx(c).AgentID)
 		limit := intOrDefault(c.Query("limit"), 25)
 
 		typ := string(probe.TypeSpeedtest)
@@ -203,7 +274,7 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// When aggregate > 0, returns time-bucket averaged data to reduce transfer
 	// When agentId is specified, filters by the reporting agent (for AGENT probes with bidirectional data)
 	// ------------------------------------------
-	base.Get("/probes/:probeID/data", func(c *fiber.Ctx) error {
+	base.Get("/probes/:probeID/data", requireWorkspaceProbe(pg), func(c *fiber.Ctx) error {
 		probeID := uint64(uintParam(c, "probeID"))
 
 		// Optional agentId filter - used for AGENT probes to filter by specific reporter
@@ -255,7 +326,51 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.JSON(NewListResponse(rows))
+		resp := NewListResponse(rows)
+		if agentID != nil {
+			resp.Freshness = dataFreshness(c, pg, ch, uint(*agentID))
+		} else {
+			resp.Freshness = dataFreshness(c, pg, ch)
+		}
+		return StreamListResponse(c, rows, resp)
+	})
+
+	// ------------------------------------------
+	// GET /workspaces/:id/probes/:probeID/spikes
+	// Worst samples of a PING/TRAFFICSIM probe with ±2 min of surrounding
+	// samples and the nearest MTR trace, for spike drill-down in the UI.
+	// Query: from, to (RFC3339 or unix; default last 24h, max 7 days),
+	//        limit=<default 10, max 50>, by=latency|loss, agentId=<uint>
+	// ------------------------------------------
+	api.Get("/workspaces/:id/probes/:probeID/spikes", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		if ch == nil {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "ClickHouse not available"})
+		}
+		from, _ := readTime(c.Query("from"))
+		to, _ := readTime(c.Query("to"))
+
+		ctx, cancel := heavyCHContext(c, ch, 20*time.Second)
+		defer cancel()
+
+		report, err := probe.ProbeSpikes(ctx, ch, pg, workspaceCtx(c).WorkspaceID, uintParam(c, "probeID"), probe.SpikeQuery{
+			From:    from,
+			To:      to,
+			Limit:   intOrDefault(c.Query("limit"), 0),
+			By:      c.Query("by"),
+			AgentID: uint(intOrDefault(c.Query("agentId"), 0)),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, probe.ErrNotFound):
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+			case errors.Is(err, probe.ErrBadInput), errors.Is(err, probe.ErrUnsupported):
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, context.DeadlineExceeded):
+				return c.Status(http.StatusGatewayTimeout).JSON(fiber.Map{"error": "spike query timed out"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(report)
 	})
 
 	// ------------------------------------------
@@ -272,6 +387,9 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		if !ok {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "agentId is required uint"})
 		}
+		if !workspaceOwnsAgent(c, pg, uint(agentID)) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+		}
 		var probeIDPtr *uint64
 		if v := c.Query("probeId"); v != "" {
 			if pid, ok := parseUint64(v); ok {
@@ -284,12 +402,65 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		dataFreshness(c, pg, ch, uint(agentID))
 		if row == nil {
 			return c.SendStatus(http.StatusNotFound)
 		}
 		return c.JSON(row)
 	})
 
+	// ------------------------------------------
+	// POST /workspaces/:id/probe-data/latest/batch
+	// Latest datapoint for each listed probe in one ClickHouse query, for
+	// frontends rendering probe lists.
+	// Body: {"probe_ids": [1, 2, 3]} (max 500). IDs outside the workspace
+	// are ignored; probes without data return latest: null.
+	// ------------------------------------------
+	base.Post("/latest/batch", func(c *fiber.Ctx) error {
+		var body struct {
+			ProbeIDs []uint `json:"probe_ids"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+		ids := uniqueUint(body.ProbeIDs)
+		if len(ids) == 0 {
+			return APIError(c, 0, CodeValidationFailed, "probe_ids is required")
+		}
+		if len(ids) > maxLatestBatch {
+			return APIError(c, 0, CodeValidationFailed, fmt.Sprintf("at most %d probe_ids per request", maxLatestBatch))
+		}
+
+		var owned []uint
+		if err := pg.WithContext(c.UserContext()).Model(&probe.Probe{}).
+			Where("id IN ? AND workspace_id = ?", ids, workspaceCtx(c).WorkspaceID).
+			Pluck("id", &owned).Error; err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		rows, err := probe.GetLatestMany(c.UserContext(), ch, owned)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		type item struct {
+			ProbeID uint             `json:"probe_id"`
+			Latest  *probe.ProbeData `json:"latest"`
+		}
+		inWorkspace := make(map[uint]bool, len(owned))
+		for _, pid := range owned {
+			inWorkspace[pid] = true
+		}
+		items := make([]item, 0, len(owned))
+		for _, pid := range ids { // request order
+			if inWorkspace[pid] {
+				items = append(items, item{ProbeID: pid, Latest: rows[pid]})
+			}
+		}
+		resp := NewListResponse(items)
+		resp.Freshness = dataFreshness(c, pg, ch)
+		return c.JSON(resp)
+	})
+
 	// ------------------------------------------
 	// GET /workspaces/:id/probe-data/by-target/data
 	// Timeseries for all probes (optionally filtered by type) that hit a literal target (probe_targets.target).
@@ -311,7 +482,7 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		latestOnly := boolOr(c.Query("latestOnly", ""), false)
 
 		// Lookup matching probes from Postgres
-		probeIDs, err := findProbeIDsByLiteralTarget(context.TODO(), pg, target, typ)
+		probeIDs, err := findProbeIDsByLiteralTarget(c.UserContext(), pg, workspaceCtx(c).WorkspaceID, target, typ)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -330,13 +501,16 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 			Rows    []probe.ProbeData `json:"rows,omitempty"`
 		}
 		out := make([]bundle, 0, len(probeIDs))
+		var latest map[uint]*probe.ProbeData
+		if latestOnly {
+			latest, err = probe.GetLatestMany(c.UserContext(), ch, probeIDs)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
 		for _, pid := range probeIDs {
 			if latestOnly {
-				row, err := probe.GetLatest(c.UserContext(), ch, probe.FindParams{ProbeID: uint64Ptr(uint64(pid))})
-				if err != nil {
-					return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-				}
-				out = append(out, bundle{ProbeID: pid, Latest: row})
+				out = append(out, bundle{ProbeID: pid, Latest: latest[pid]})
 			} else {
 				rows, err := probe.GetProbeDataByProbe(c.UserContext(), ch, uint64(pid), nil, from, to, false, limit, "")
 				if err != nil {
@@ -347,9 +521,10 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		}
 
 		return c.JSON(fiber.Map{
-			"target":   target,
-			"probeIds": probeIDs,
-			"bundles":  out,
+			"target":    target,
+			"probeIds":  probeIDs,
+			"bundles":   out,
+			"freshness": dataFreshness(c, pg, ch),
 		})
 	})
 
@@ -362,13 +537,14 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// Optional query: includeSelf=false (default false) to exclude current probe.
 	// Optional query: latest=true to attach latest datapoint for each similar probe.
 	// ------------------------------------------
-	base.Get("/probes/:probeID/similar", func(c *fiber.Ctx) error {
+	base.Get("/probes/:probeID/similar", requireWorkspaceProbe(pg), func(c *fiber.Ctx) error {
 		selfID := uintParam(c, "probeID")
 		sameType := boolOr(c.Query("sameType", ""), true)
 		includeSelf := boolOr(c.Query("includeSelf", ""), false)
 		withLatest := boolOr(c.Query("latest", ""), false)
 
 		// Load the reference probe & its targets
+		wsID := workspaceCtx(c).WorkspaceID
 		ref, err := probe.GetByID(c.UserContext(), pg, selfID)
 		if err != nil || ref == nil {
 			if err == nil {
@@ -381,12 +557,12 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 		literals, agentTargets := splitTargets(ref.Targets)
 
 		// Find similar by literal targets
-		simLit, err := findProbesByLiteralTargets(context.TODO(), pg, literals, ref.Type, sameType, includeSelf, selfID)
+		simLit, err := findProbesByLiteralTargets(c.UserContext(), pg, wsID, literals, ref.Type, sameType, includeSelf, selfID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 		// Find similar by target agents
-		simAgent, err := findProbesByTargetAgents(context.TODO(), pg, agentTargets, ref.Type, sameType, includeSelf, selfID)
+		simAgent, err := findProbesByTargetAgents(c.UserContext(), pg, wsID, agentTargets, ref.Type, sameType, includeSelf, selfID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -412,13 +588,13 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 			}
 			ids = uniqueUint(ids)
 
+			rows, err := probe.GetLatestMany(c.UserContext(), ch, ids)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
 			latest := make([]add, 0, len(ids))
 			for _, pid := range ids {
-				row, err := probe.GetLatest(c.UserContext(), ch, probe.FindParams{ProbeID: uint64Ptr(uint64(pid))})
-				if err != nil {
-					return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-				}
-				latest = append(latest, add{ProbeID: pid, Latest: row})
+				latest = append(latest, add{ProbeID: pid, Latest: rows[pid]})
 			}
 			resp["latest"] = latest
 		}
@@ -431,8 +607,8 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// DNS dashboard data - returns DNS probe results grouped by target hostname
 	// Query: limit (default 50), lookback (minutes, default 60)
 	// ------------------------------------------
-	base.Get("/agents/:agentID/dns", func(c *fiber.Ctx) error {
-		agentID := uint64(uintParam(c, "agentID"))
+	base.Get("/agents/:agentID/dns", RequireWorkspaceAgent(wsStore, pg), func(c *fiber.Ctx) error {
+		agentID := uint64(workspaceCtx(c).AgentID)
 		limit := intOrDefault(c.Query("limit"), 500)
 		lookbackMin := intOrDefault(c.Query("lookback"), 60)
 
@@ -511,8 +687,8 @@ func panelProbeData(api fiber.Router, pg *gorm.DB, ch *sql.DB) {
 	// HTTP/TLS dashboard data - returns HTTP and TLS probe results grouped by target URL
 	// Query: limit (default 500), lookback (minutes, default 60)
 	// ------------------------------------------
-	base.Get("/agents/:agentID/http", func(c *fiber.Ctx) error {
-		agentID := uint64(uintParam(c, "agentID"))
+	base.Get("/agents/:agentID/http", RequireWorkspaceAgent(wsStore, pg), func(c *fiber.Ctx) error {
+		agentID := uint64(workspaceCtx(c).AgentID)
 		limit := intOrDefault(c.Query("limit"), 500)
 		lookbackMin := intOrDefault(c.Query("lookback"), 60)
 
@@ -661,9 +837,27 @@ func readFindParams(c *fiber.Ctx) (probe.FindParams, error) {
 	p.Limit = intOrDefault(c.Query("limit"), 0)
 	p.Ascending = boolOr(c.Query("asc", ""), false)
 
+	// label.<key>=<value> filters on denormalized probe label columns.
+	for k, v := range c.Queries() {
+		key, ok := strings.CutPrefix(k, "label.")
+		if !ok {
+			continue
+		}
+		if !probe.IsLabelColumn(key) {
+			return p, fmt.Errorf("label %q is not filterable; configured label columns: %s", key, strings.Join(probe.LabelColumnKeys(), ", "))
+		}
+		if p.Labels == nil {
+			p.Labels = make(map[string]string)
+		}
+		p.Labels[key] = v
+	}
+
 	return p, nil
 }
 
+// maxLatestBatch caps probe IDs per /latest/batch request.
+const maxLatestBatch = 500
+
 func uint64Ptr(u uint64) *uint64 { return &u }
 
 func parseUint64(v string) (uint64, bool) {
@@ -682,6 +876,17 @@ func intOrDefault(v string, def int) int {
 	return i
 }
 
+func floatOrDefault(v string, def float64) float64 {
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
 func boolOr(val string, def bool) bool {
 	if val == "" {
 		return def
@@ -715,6 +920,17 @@ func readTime(v string) (time.Time, bool) {
 }
 
 // split Targets into literal host strings and target agent IDs
+// queryList splits a comma-separated query parameter, dropping blanks.
+func queryList(c *fiber.Ctx, name string) []string {
+	var out []string
+	for _, s := range strings.Split(c.Query(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func splitTargets(ts []probe.Target) (literals []string, agentIDs []uint) {
 	for _, t := range ts {
 		if t.AgentID != nil {
@@ -742,14 +958,14 @@ func uniqueUint(in []uint) []uint {
 
 // findProbeIDsByLiteralTarget finds probe IDs that have a specific literal target;
 // if typ != nil, restrict to probes.type = *typ.
-func findProbeIDsByLiteralTarget(ctxCtx context.Context, pg *gorm.DB, target string, typ *string) ([]uint, error) {
+func findProbeIDsByLiteralTarget(ctxCtx context.Context, pg *gorm.DB, workspaceID uint, target string, typ *string) ([]uint, error) {
 	ctx := ctxCtx
 	var ids []uint
 	q := pg.WithContext(ctx).
 		Table("probe_targets AS t").
 		Select("t.probe_id").
 		Joins("JOIN probes p ON p.id = t.probe_id").
-		Where("t.agent_id IS NULL AND t.target = ?", target)
+		Where("p.workspace_id = ? AND t.agent_id IS NULL AND t.target = ?", workspaceID, target)
 	if typ != nil && *typ != "" {
 		q = q.Where("p.type = ?", *typ)
 	}
@@ -759,7 +975,7 @@ func findProbeIDsByLiteralTarget(ctxCtx context.Context, pg *gorm.DB, target str
 	return uniqueUint(ids), nil
 }
 
-func findProbesByLiteralTargets(ctxCtx context.Context, pg *gorm.DB, targets []string, refType probe.Type, sameType, includeSelf bool, selfID uint) ([]probe.Probe, error) {
+func findProbesByLiteralTargets(ctxCtx context.Context, pg *gorm.DB, workspaceID uint, targets []string, refType probe.Type, sameType, includeSelf bool, selfID uint) ([]probe.Probe, error) {
 	ctx := ctxCtx
 	if len(targets) == 0 {
 		return []probe.Probe{}, nil
@@ -767,7 +983,7 @@ func findProbesByLiteralTargets(ctxCtx context.Context, pg *gorm.DB, targets []s
 	q := pg.WithContext(ctx).Model(&probe.Probe{}).
 		Preload("Targets").
 		Joins("JOIN probe_targets t ON t.probe_id = probes.id").
-		Where("t.agent_id IS NULL AND t.target IN ?", targets)
+		Where("probes.workspace_id = ? AND t.agent_id IS NULL AND t.target IN ?", workspaceID, targets)
 	if sameType {
 		q = q.Where("probes.type = ?", refType)
 	}
@@ -781,7 +997,7 @@ func findProbesByLiteralTargets(ctxCtx context.Context, pg *gorm.DB, targets []s
 	return out, nil
 }
 
-func findProbesByTargetAgents(ctxCtx context.Context, pg *gorm.DB, agentIDs []uint, refType probe.Type, sameType, includeSelf bool, selfID uint) ([]probe.Probe, error) {
+func findProbesByTargetAgents(ctxCtx context.Context, pg *gorm.DB, workspaceID uint, agentIDs []uint, refType probe.Type, sameType, includeSelf bool, selfID uint) ([]probe.Probe, error) {
 	ctx := ctxCtx
 	if len(agentIDs) == 0 {
 		return []probe.Probe{}, nil
@@ -789,7 +1005,7 @@ func findProbesByTargetAgents(ctxCtx context.Context, pg *gorm.DB, agentIDs []ui
 	q := pg.WithContext(ctx).Model(&probe.Probe{}).
 		Preload("Targets").
 		Joins("JOIN probe_targets t ON t.probe_id = probes.id").
-		Where("t.agent_id IN ?", agentIDs)
+		Where("probes.workspace_id = ? AND t.agent_id IN ?", workspaceID, agentIDs)
 	if sameType {
 		q = q.Where("probes.type = ?", refType)
 	}
@@ -802,3 +1018,49 @@ func findProbesByTargetAgents(ctxCtx context.Context, pg *gorm.DB, agentIDs []ui
 	}
 	return out, nil
 }
+
+// requireWorkspaceProbe responds 404 unless :probeID belongs to the
+// workspace verified by RequireWorkspaceAccess.
+func requireWorkspaceProbe(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !workspaceOwnsProbe(c, db, uintParam(c, "probeID")) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+		}
+		return c.Next()
+	}
+}
+
+// workspaceOwnsProbe reports whether probeID belongs to the request's
+// workspace.
+func workspaceOwnsProbe(c *fiber.Ctx, db *gorm.DB, probeID uint) bool {
+	var n int64
+	err := db.WithContext(c.UserContext()).Model(&probe.Probe{}).
+		Where("id = ? AND workspace_id = ?", probeID, workspaceCtx(c).WorkspaceID).
+		Count(&n).Error
+	return err == nil && n > 0
+}
+
+// workspaceOwnsAgent reports whether agentID belongs to the request's
+// workspace.
+func workspaceOwnsAgent(c *fiber.Ctx, db *gorm.DB, agentID uint) bool {
+	a, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, workspaceCtx(c).WorkspaceID, agentID)
+	return err == nil && a != nil
+}
+
+// dataFreshness computes the ingestion watermark for the workspace in the
+// route (optionally narrowed to agentIDs) and mirrors it into the
+// X-Data-Watermark / X-Data-Degraded headers for responses whose body
+// can't carry it. Errors yield nil; freshness never fails a read.
+func dataFreshness(c *fiber.Ctx, pg *gorm.DB, ch *sql.DB, agentIDs ...uint) *probe.DataFreshness {
+	f, err := probe.GetDataFreshness(c.UserContext(), ch, pg, workspaceCtx(c).WorkspaceID, agentIDs...)
+	if err != nil || f == nil {
+		return nil
+	}
+	if f.Watermark != nil {
+		c.Set("X-Data-Watermark", f.Watermark.Format(time.RFC3339))
+	}
+	if f.Degraded {
+		c.Set("X-Data-Degraded", "true")
+	}
+	return f
+}
@@ -0,0 +1,108 @@
+// web/data_streams.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/datastream"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelDataStreams mounts the outbound probe data streams. Delivery runs
+// in the datastream dispatcher; these routes configure it.
+func panelDataStreams(api fiber.Router, db *gorm.DB) {
+	wsStore := workspace.NewStore(db)
+
+	streams := api.Group("/workspaces/:id/data-streams")
+	streams.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/data-streams - requires CanView (any member)
+	// Secrets are never returned; has_secret reports whether one is set.
+	// stats are this controller's delivery counters.
+	streams.Get("/", func(c *fiber.Ctx) error {
+		list, err := datastream.ListStreams(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i := range list {
+			list[i].Stats = datastream.Stats(list[i].ID)
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// GET /workspaces/:id/data-streams/:streamId - requires CanView (any member)
+	streams.Get("/:streamId", func(c *fiber.Ctx) error {
+		s, err := datastream.GetStream(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "streamId"))
+		if err != nil {
+			return dataStreamError(c, err)
+		}
+		s.Stats = datastream.Stats(s.ID)
+		return c.JSON(s)
+	})
+
+	// POST /workspaces/:id/data-streams - requires CanManage (ADMIN+)
+	streams.Post("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body datastream.StreamInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		s, err := datastream.CreateStream(c.UserContext(), db, uintParam(c, "id"), body)
+		if err != nil {
+			return dataStreamError(c, err)
+		}
+		datastream.Changed()
+		return c.Status(http.StatusCreated).JSON(s)
+	})
+
+	// PATCH /workspaces/:id/data-streams/:streamId - requires CanManage (ADMIN+)
+	// Omitted fields are unchanged; omit secret to keep the stored one.
+	streams.Patch("/:streamId", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body datastream.StreamInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		s, err := datastream.UpdateStream(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "streamId"), body)
+		if err != nil {
+			return dataStreamError(c, err)
+		}
+		datastream.Changed()
+		return c.JSON(s)
+	})
+
+	// DELETE /workspaces/:id/data-streams/:streamId - requires CanManage (ADMIN+)
+	streams.Delete("/:streamId", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		if err := datastream.DeleteStream(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "streamId")); err != nil {
+			return dataStreamError(c, err)
+		}
+		datastream.Changed()
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// POST /workspaces/:id/data-streams/:streamId/test - requires CanManage (ADMIN+)
+	// Sends one sample record (type TEST) and reports the endpoint's answer.
+	streams.Post("/:streamId/test", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		s, err := datastream.GetStream(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "streamId"))
+		if err != nil {
+			return dataStreamError(c, err)
+		}
+		if err := datastream.SendTest(c.UserContext(), s); err != nil {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"ok": false, "error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"ok": true})
+	})
+}
+
+func dataStreamError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, datastream.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "data stream not found"})
+	case errors.Is(err, datastream.ErrBadInput):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestProbeDataWorkspaceScoping verifies probe-data and analysis routes
+// reject other workspaces, and agents or probes from another workspace,
+// before touching ClickHouse.
+func TestProbeDataWorkspaceScoping(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&workspace.Member{}, &agent.Agent{}, &probe.Probe{}, &probe.Target{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&workspace.Member{WorkspaceID: 1, UserID: 1, Role: workspace.RoleViewer}).Error; err != nil {
+		t.Fatalf("member: %v", err)
+	}
+	for _, a := range []agent.Agent{{ID: 10, WorkspaceID: 1, Name: "hq"}, {ID: 20, WorkspaceID: 2, Name: "other"}} {
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatalf("agent: %v", err)
+		}
+	}
+	other := probe.Probe{ID: 200, WorkspaceID: 2, AgentID: 20, Type: probe.TypePing, Targets: []probe.Target{{Target: "8.8.8.8"}}}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", uint(1))
+		return c.Next()
+	})
+	panelProbeData(app, db, nil)
+	panelAnalysis(app, db, nil, nil)
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/workspaces/2/analysis/global", http.StatusForbidden},
+		{"/workspaces/2/mesh", http.StatusForbidden},
+		{"/workspaces/2/analysis/dscp", http.StatusForbidden},
+		{"/workspaces/2/analysis/best-path", http.StatusForbidden},
+		{"/workspaces/2/analysis/routes/stability", http.StatusForbidden},
+		{"/workspaces/2/analysis/forecast", http.StatusForbidden},
+		{"/workspaces/2/network-map/destinations", http.StatusForbidden},
+		{"/workspaces/2/connectivity-matrix", http.StatusForbidden},
+		{"/workspaces/2/probes/200/spikes", http.StatusForbidden},
+		{"/workspaces/2/probe-data/agents/20/dns", http.StatusForbidden},
+		{"/workspaces/1/probe-data/agents/20/dns", http.StatusNotFound},
+		{"/workspaces/1/probe-data/agents/20/http", http.StatusNotFound},
+		{"/workspaces/1/probe-data/agents/20/speedtests", http.StatusNotFound},
+		{"/workspaces/1/probe-data/probes/200/data", http.StatusNotFound},
+		{"/workspaces/1/probe-data/probes/200/similar", http.StatusNotFound},
+		{"/workspaces/1/probe-data/mos-timeseries?probeId=200", http.StatusNotFound},
+		{"/workspaces/1/probe-data/latest?type=PING&agentId=20", http.StatusNotFound},
+		{"/workspaces/1/probe-data/find?agentId=20", http.StatusNotFound},
+		{"/workspaces/1/probe-data/find?probeId=200", http.StatusNotFound},
+		{"/workspaces/1/probe-data/find?type=PING", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.path, resp.StatusCode, tc.want)
+		}
+	}
+
+	// Another workspace's probe to the same target is not listed.
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/workspaces/1/probe-data/by-target/data?target=8.8.8.8", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		ProbeIDs []uint `json:"probeIds"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK || len(body.ProbeIDs) != 0 {
+		t.Errorf("by-target = %d %+v (%v), want no probes", resp.StatusCode, body, err)
+	}
+}
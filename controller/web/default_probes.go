@@ -0,0 +1,50 @@
+// web/default_probes.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelDefaultProbes mounts the workspace default probe bundle — the
+// probes created on every new agent that isn't copied from a template.
+func panelDefaultProbes(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/default-probes")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/default-probes - requires CanView (any member)
+	base.Get("/", func(c *fiber.Ctx) error {
+		list, err := probe.GetDefaultProbeBundle(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// PUT /workspaces/:id/default-probes - requires CanManage (ADMIN+)
+	// Replaces the whole bundle; an empty list clears it.
+	base.Put("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body struct {
+			Probes []probe.DefaultProbeInput `json:"probes"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		list, err := probe.SetDefaultProbeBundle(c.UserContext(), db, uintParam(c, "id"), currentUserID(c), body.Probes)
+		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) || errors.Is(err, probe.ErrTargetFormat) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+}
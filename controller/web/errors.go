@@ -0,0 +1,298 @@
+// web/errors.go
+// Structured error envelope, machine-readable error codes and request IDs.
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	apperr "netwatcher-controller/internal/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrorCode is a stable, machine-readable failure identifier. Clients
+// branch on code; the human-readable error message may change.
+type ErrorCode string
+
+const (
+	CodeBadRequest            ErrorCode = "BAD_REQUEST"
+	CodeValidationFailed      ErrorCode = "VALIDATION_FAILED"
+	CodeAuthRequired          ErrorCode = "AUTH_REQUIRED"
+	CodeInvalidCredentials    ErrorCode = "INVALID_CREDENTIALS"
+	CodeForbidden             ErrorCode = "FORBIDDEN"
+	CodeWorkspaceAccessDenied ErrorCode = "WORKSPACE_ACCESS_DENIED"
+	CodeInsufficientRole      ErrorCode = "INSUFFICIENT_ROLE"
+	CodeSiteAdminRequired     ErrorCode = "SITE_ADMIN_REQUIRED"
+	CodeNotFound              ErrorCode = "NOT_FOUND"
+	CodeWorkspaceNotFound     ErrorCode = "WORKSPACE_NOT_FOUND"
+	CodeAgentNotFound         ErrorCode = "AGENT_NOT_FOUND"
+	CodeProbeNotFound         ErrorCode = "PROBE_NOT_FOUND"
+	CodeAlertNotFound         ErrorCode = "ALERT_NOT_FOUND"
+	CodeShareLinkNotFound     ErrorCode = "SHARE_LINK_NOT_FOUND"
+	CodeShareLinkExpired      ErrorCode = "SHARE_LINK_EXPIRED"
+	CodePasswordRequired      ErrorCode = "PASSWORD_REQUIRED"
+	CodeConflict              ErrorCode = "CONFLICT"
+	CodeLimitExceeded         ErrorCode = "LIMIT_EXCEEDED"
+	CodeRateLimited           ErrorCode = "RATE_LIMITED"
+	CodePayloadTooLarge       ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeCHTimeout             ErrorCode = "CH_TIMEOUT"
+	CodeUpstreamTimeout       ErrorCode = "UPSTREAM_TIMEOUT"
+	CodeServiceUnavailable    ErrorCode = "SERVICE_UNAVAILABLE"
+	CodeInternal              ErrorCode = "INTERNAL_ERROR"
+)
+
+// codeStatus is the canonical HTTP status for each code.
+var codeStatus = map[ErrorCode]int{
+	CodeBadRequest:            http.StatusBadRequest,
+	CodeValidationFailed:      http.StatusBadRequest,
+	CodeAuthRequired:          http.StatusUnauthorized,
+	CodeInvalidCredentials:    http.StatusUnauthorized,
+	CodePasswordRequired:      http.StatusUnauthorized,
+	CodeForbidden:             http.StatusForbidden,
+	CodeWorkspaceAccessDenied: http.StatusForbidden,
+	CodeInsufficientRole:      http.StatusForbidden,
+	CodeSiteAdminRequired:     http.StatusForbidden,
+	CodeNotFound:              http.StatusNotFound,
+	CodeWorkspaceNotFound:     http.StatusNotFound,
+	CodeAgentNotFound:         http.StatusNotFound,
+	CodeProbeNotFound:         http.StatusNotFound,
+	CodeAlertNotFound:         http.StatusNotFound,
+	CodeShareLinkNotFound:     http.StatusNotFound,
+	CodeShareLinkExpired:      http.StatusGone,
+	CodeConflict:              http.StatusConflict,
+	CodeLimitExceeded:         http.StatusForbidden,
+	CodeRateLimited:           http.StatusTooManyRequests,
+	CodePayloadTooLarge:       http.StatusRequestEntityTooLarge,
+	CodeCHTimeout:             http.StatusGatewayTimeout,
+	CodeUpstreamTimeout:       http.StatusGatewayTimeout,
+	CodeServiceUnavailable:    http.StatusServiceUnavailable,
+	CodeInternal:              http.StatusInternalServerError,
+}
+
+// StatusForCode returns the HTTP status for a code (500 if unknown).
+func StatusForCode(code ErrorCode) int {
+	if s, ok := codeStatus[code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// codeForStatus is the fallback code when nothing more specific matches.
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeAuthRequired
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusGone:
+		return CodeShareLinkExpired
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeUpstreamTimeout
+	}
+	return CodeInternal
+}
+
+// chTimeoutRe matches ClickHouse timeouts: TIMEOUT_EXCEEDED (code 159),
+// max_execution_time, or a driver read timeout.
+var chTimeoutRe = regexp.MustCompile(`(?i)(code: 159|timeout_exceeded|max_execution_time|clickhouse.*(timeout|deadline))`)
+
+// inferErrorCode derives a code for legacy {"error": "..."} responses from
+// the status, message and route, so handlers that predate the envelope
+// still return specific codes.
+func inferErrorCode(status int, msg, path string) ErrorCode {
+	m := strings.ToLower(msg)
+	switch {
+	case chTimeoutRe.MatchString(msg):
+		return CodeCHTimeout
+	case strings.Contains(m, "deadline exceeded") || strings.Contains(m, "i/o timeout"):
+		return CodeUpstreamTimeout
+	}
+
+	switch status {
+	case http.StatusNotFound:
+		for _, p := range []struct {
+			needle string
+			code   ErrorCode
+		}{
+			{"probe", CodeProbeNotFound},
+			{"agent", CodeAgentNotFound},
+			{"alert", CodeAlertNotFound},
+			{"share link", CodeShareLinkNotFound},
+			{"workspace", CodeWorkspaceNotFound},
+		} {
+			if strings.Contains(m, p.needle) {
+				return p.code
+			}
+		}
+	case http.StatusForbidden:
+		switch {
+		case strings.Contains(m, "site admin"):
+			return CodeSiteAdminRequired
+		case strings.Contains(m, "insufficient permissions"):
+			return CodeInsufficientRole
+		case strings.Contains(m, "limit"):
+			return CodeLimitExceeded
+		case strings.Contains(m, "access denied") && strings.Contains(path, "/workspaces/"):
+			return CodeWorkspaceAccessDenied
+		}
+	case http.StatusUnauthorized:
+		switch {
+		case strings.Contains(m, "password required"):
+			return CodePasswordRequired
+		case strings.Contains(m, "invalid password"), strings.Contains(m, "invalid credentials"), strings.Contains(m, "incorrect password"):
+			return CodeInvalidCredentials
+		}
+	}
+	return codeForStatus(status)
+}
+
+// -------------------- Request IDs --------------------
+
+const (
+	headerRequestID = "X-Request-ID"
+	ctxRequestIDKey = "requestID"
+)
+
+// validRequestID accepts client-supplied IDs that are safe to echo.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{8,64}$`)
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware assigns every request an ID — the caller's
+// X-Request-ID when well-formed, otherwise a random one — and echoes it
+// in the response header.
+func RequestIDMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(headerRequestID)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Locals(ctxRequestIDKey, id)
+		c.Set(headerRequestID, id)
+		return c.Next()
+	}
+}
+
+// requestID returns the current request's ID ("" outside the middleware).
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(ctxRequestIDKey).(string)
+	return id
+}
+
+// -------------------- Envelope --------------------
+
+// APIError writes a structured error response. status 0 uses the code's
+// canonical status.
+func APIError(c *fiber.Ctx, status int, code ErrorCode, msg string) error {
+	if status == 0 {
+		status = StatusForCode(code)
+	}
+	return c.Status(status).JSON(ErrorResponse{Error: msg, Code: string(code), RequestID: requestID(c)})
+}
+
+// validationError returns err as a field-level validation error, or nil.
+func validationError(err error) *apperr.ValidationError {
+	var v *apperr.ValidationError
+	if errors.As(err, &v) {
+		return v
+	}
+	return nil
+}
+
+// APIValidationError writes a VALIDATION_FAILED response listing each
+// invalid field (field, index for list entries, reason).
+func APIValidationError(c *fiber.Ctx, v *apperr.ValidationError) error {
+	return c.Status(StatusForCode(CodeValidationFailed)).JSON(ErrorResponse{
+		Error:     v.Error(),
+		Code:      string(CodeValidationFailed),
+		RequestID: requestID(c),
+		Fields:    v.Fields,
+	})
+}
+
+// ErrorEnvelopeMiddleware normalizes every 4xx/5xx response into the
+// envelope: legacy {"error": "..."} bodies gain code and request_id, and
+// bare status responses (c.SendStatus) get a JSON body. Extra fields a
+// handler set (required_role, requires_password, …) are preserved.
+func ErrorEnvelopeMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			// Returned errors are rendered by ErrorHandler.
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < 400 || c.Method() == fiber.MethodHead {
+			return nil
+		}
+
+		body := c.Response().Body()
+		contentType := string(c.Response().Header.ContentType())
+
+		var env map[string]any
+		switch {
+		case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+			if json.Unmarshal(body, &env) != nil {
+				return nil
+			}
+			if _, ok := env["error"].(string); !ok {
+				return nil
+			}
+		case len(body) <= 512:
+			msg := strings.TrimSpace(string(body))
+			if msg == "" {
+				msg = http.StatusText(status)
+			}
+			env = map[string]any{"error": msg}
+		default:
+			return nil
+		}
+
+		if _, ok := env["code"].(string); !ok {
+			code := inferErrorCode(status, env["error"].(string), c.Path())
+			env["code"] = string(code)
+			// Timeouts surfaced as generic 500s get their canonical status.
+			if status == http.StatusInternalServerError && StatusForCode(code) == http.StatusGatewayTimeout {
+				status = http.StatusGatewayTimeout
+			}
+		}
+		env["request_id"] = requestID(c)
+		return c.Status(status).JSON(env)
+	}
+}
+
+// ErrorHandler renders errors returned from handlers (fiber.Error or any
+// other error) as the envelope. Install via fiber.Config.ErrorHandler.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status = fe.Code
+	}
+	code := inferErrorCode(status, err.Error(), c.Path())
+	if status == http.StatusInternalServerError {
+		status = StatusForCode(code)
+	}
+	return APIError(c, status, code, err.Error())
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"strings"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/probe"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// externalIDDBKey holds the database uintParam uses to resolve external IDs.
+const externalIDDBKey = "external_id_db"
+
+// ExternalIDMiddleware lets probe and agent route parameters (:probeID,
+// :agentID and their camel-case variants) take an external ID — the ULID
+// or slug in a probe's or agent's external_id — instead of the numeric ID.
+// uintParam resolves them within the route's workspace (:id) on first use.
+func ExternalIDMiddleware(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(externalIDDBKey, db)
+		return c.Next()
+	}
+}
+
+// resolveExternalParam returns the numeric ID for an external ID in route
+// parameter name, or 0 when the parameter isn't a probe or agent, the
+// workspace is unknown or nothing matches.
+func resolveExternalParam(c *fiber.Ctx, name, ref string) uint {
+	cacheKey := "external_id:" + name
+	if id, ok := c.Locals(cacheKey).(uint); ok {
+		return id
+	}
+	db, _ := c.Locals(externalIDDBKey).(*gorm.DB)
+	wsID := uintParam(c, "id")
+	if db == nil || wsID == 0 {
+		return 0
+	}
+	var id uint
+	switch lower := strings.ToLower(name); {
+	case strings.HasPrefix(lower, "probe"):
+		id, _ = probe.ResolveExternalID(c.UserContext(), db, wsID, ref)
+	case strings.HasPrefix(lower, "agent"):
+		id, _ = agent.ResolveExternalID(c.UserContext(), db, wsID, ref)
+	}
+	c.Locals(cacheKey, id)
+	return id
+}
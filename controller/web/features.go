@@ -0,0 +1,56 @@
+// web/features.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/features"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelFeatures exposes per-workspace feature flags so the panel can hide
+// disabled subsystems and admins can opt workspaces in or out.
+func panelFeatures(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/features")
+	wsStore := workspace.NewStore(db)
+	flags := features.Default(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/features - requires CanView (any member)
+	// Lists every flag with its default and effective value.
+	base.Get("/", func(c *fiber.Ctx) error {
+		list, err := flags.List(c.UserContext(), uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// PUT /workspaces/:id/features/:key - requires CanManage (ADMIN+)
+	// Body: {"enabled": true|false|null}; null removes the override.
+	base.Put("/:key", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		var body struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		if err := flags.Set(c.UserContext(), wID, c.Params("key"), body.Enabled, currentUserID(c)); err != nil {
+			if errors.Is(err, features.ErrUnknownFlag) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		list, err := flags.List(c.UserContext(), wID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+}
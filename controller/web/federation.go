@@ -0,0 +1,92 @@
+// web/federation.go
+// Controller-to-controller API for multi-region deployments (see
+// internal/region).
+package web
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/region"
+)
+
+// federationPeerTimeout leaves a federated request time to answer with the
+// regions that did respond.
+const federationPeerTimeout = 20 * time.Second
+
+// registerFederationRoutes mounts the peer endpoints. They authenticate
+// with FEDERATION_TOKEN instead of a user session and are absent (404)
+// when no token is configured.
+func registerFederationRoutes(app *fiber.App, pg *gorm.DB, ch *sql.DB) {
+	if region.Token() == "" {
+		return
+	}
+	fed := app.Group("/federation", func(c *fiber.Ctx) error {
+		if !region.Authorized(c.Get("Authorization")) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid federation token"})
+		}
+		return c.Next()
+	})
+
+	// ------------------------------------------
+	// GET /federation/region
+	// This controller's region and the home region of unassigned agents
+	// ------------------------------------------
+	fed.Get("/region", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"region": region.Local(), "home": region.Home()})
+	})
+
+	// ------------------------------------------
+	// GET /federation/workspaces/:id/analysis
+	// This region's part of a workspace analysis
+	// Query: lookback=<minutes, default 60>
+	// ------------------------------------------
+	fed.Get("/workspaces/:id/analysis", func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		lookback := intOrDefault(c.Query("lookback"), 60)
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		analysis, err := probe.ComputeWorkspaceAnalysis(ctx, ch, pg, wID, lookback)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(analysis)
+	})
+}
+
+// federatedWorkspaceAnalysis computes the local analysis and fetches every
+// peer region's in parallel, then merges them.
+func federatedWorkspaceAnalysis(c *fiber.Ctx, pg *gorm.DB, ch *sql.DB, wID uint, lookback int) *probe.FederatedAnalysis {
+	peers := region.Peers()
+	parts := make([]probe.RegionalAnalysis, len(peers)+1)
+
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p region.Peer) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(c.UserContext(), federationPeerTimeout)
+			defer cancel()
+			var a probe.WorkspaceAnalysis
+			err := p.Get(ctx, fmt.Sprintf("/federation/workspaces/%d/analysis?lookback=%d", wID, lookback), &a)
+			parts[i+1] = probe.RegionalAnalysis{Region: p.Region, Analysis: &a, Err: err}
+		}(i, p)
+	}
+
+	ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+	defer cancel()
+	local, err := probe.ComputeWorkspaceAnalysis(ctx, ch, pg, wID, lookback)
+	parts[0] = probe.RegionalAnalysis{Region: region.Local(), Analysis: local, Err: err}
+
+	wg.Wait()
+	return probe.MergeRegionalAnalyses(wID, parts)
+}
@@ -0,0 +1,134 @@
+// web/health.go
+package web
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"netwatcher-controller/internal/health"
+	"netwatcher-controller/internal/probe"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// healthCheckTimeout bounds each dependency check so a hung database
+// can't hold the probe past an orchestrator's own timeout.
+const healthCheckTimeout = 2 * time.Second
+
+// batchBacklogNotReady is the batch writer queue fill ratio above which
+// the controller reports not-ready: ingest is about to block on enqueue.
+const batchBacklogNotReady = 0.8
+
+type dependencyStatus struct {
+	Status    string `json:"status"` // ok | fail
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Queued    *int   `json:"queued,omitempty"`
+	Capacity  *int   `json:"capacity,omitempty"`
+}
+
+// registerHealthRoutes mounts unauthenticated health endpoints for load
+// balancers and orchestrators. Must be registered before the JWT group.
+//
+//	/healthz  always 200 while the process serves HTTP (kept for existing clients)
+//	/livez    200 unless a background worker has stalled; restart on failure
+//	/readyz   200 when Postgres, ClickHouse and the ingest queue are usable;
+//	          stop routing traffic on failure
+func registerHealthRoutes(app *fiber.App, pg *gorm.DB, ch *sql.DB) {
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"ok": true}) })
+
+	// -------------------------------------------
+	// GET /livez
+	// -------------------------------------------
+	app.Get("/livez", func(c *fiber.Ctx) error {
+		workers := health.Workers()
+		ok := true
+		for _, w := range workers {
+			if !w.Alive {
+				ok = false
+			}
+		}
+		return c.Status(healthStatusCode(ok)).JSON(fiber.Map{
+			"status":  healthStatusString(ok),
+			"workers": workers,
+		})
+	})
+
+	// -------------------------------------------
+	// GET /readyz
+	// -------------------------------------------
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		checks := map[string]dependencyStatus{
+			"postgres":     checkPostgres(c.UserContext(), pg),
+			"clickhouse":   checkClickHouse(c.UserContext(), ch),
+			"batch_writer": checkBatchWriter(),
+		}
+		ok := true
+		for _, d := range checks {
+			if d.Status != "ok" {
+				ok = false
+			}
+		}
+		return c.Status(healthStatusCode(ok)).JSON(fiber.Map{
+			"status": healthStatusString(ok),
+			"checks": checks,
+		})
+	})
+}
+
+func checkPostgres(ctx context.Context, pg *gorm.DB) dependencyStatus {
+	sqlDB, err := pg.DB()
+	if err != nil {
+		return dependencyStatus{Status: "fail", Error: err.Error()}
+	}
+	return timedPing(ctx, sqlDB.PingContext)
+}
+
+func checkClickHouse(ctx context.Context, ch *sql.DB) dependencyStatus {
+	if ch == nil {
+		return dependencyStatus{Status: "fail", Error: "not configured"}
+	}
+	return timedPing(ctx, ch.PingContext)
+}
+
+func timedPing(ctx context.Context, ping func(context.Context) error) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := ping(ctx)
+	d := dependencyStatus{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		d.Status = "fail"
+		d.Error = err.Error()
+	}
+	return d
+}
+
+func checkBatchWriter() dependencyStatus {
+	queued, capacity, ok := probe.BatchWriterBacklog()
+	if !ok {
+		return dependencyStatus{Status: "fail", Error: "not started"}
+	}
+	d := dependencyStatus{Status: "ok", Queued: &queued, Capacity: &capacity}
+	if capacity > 0 && float64(queued)/float64(capacity) >= batchBacklogNotReady {
+		d.Status = "fail"
+		d.Error = "ingest queue near capacity"
+	}
+	return d
+}
+
+func healthStatusCode(ok bool) int {
+	if ok {
+		return fiber.StatusOK
+	}
+	return fiber.StatusServiceUnavailable
+}
+
+func healthStatusString(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "fail"
+}
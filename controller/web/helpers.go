@@ -8,6 +8,9 @@ import (
 	"strconv"
 	"strings"
 
+	apperr "netwatcher-controller/internal/errors"
+	"netwatcher-controller/internal/extid"
+	"netwatcher-controller/internal/probe"
 	"netwatcher-controller/internal/workspace"
 
 	"github.com/gofiber/fiber/v2"
@@ -59,9 +62,14 @@ func getUserID(c *fiber.Ctx) uint {
 
 // -------------------- Parameter Parsing --------------------
 
-// uintParam extracts a uint path parameter by name.
+// uintParam extracts a uint path parameter by name. Probe and agent
+// parameters may hold an external ID instead (see ExternalIDMiddleware).
 func uintParam(c *fiber.Ctx, name string) uint {
-	v, _ := strconv.Atoi(c.Params(name))
+	raw := c.Params(name)
+	if extid.IsRef(raw) {
+		return resolveExternalParam(c, name, raw)
+	}
+	v, _ := strconv.Atoi(raw)
 	if v < 0 {
 		return 0
 	}
@@ -133,6 +141,8 @@ type ListResponse struct {
 	Total  int         `json:"total,omitempty"`
 	Limit  int         `json:"limit,omitempty"`
 	Offset int         `json:"offset,omitempty"`
+	// Freshness is the ingestion watermark for ClickHouse-backed lists.
+	Freshness *probe.DataFreshness `json:"freshness,omitempty"`
 }
 
 // NewListResponse creates a ListResponse with just data (no pagination).
@@ -153,9 +163,12 @@ func NewPaginatedResponse(data interface{}, total, limit, offset int) ListRespon
 // -------------------- Error Response Helpers --------------------
 
 // ErrorResponse represents a standardized error response.
+// Code is one of the ErrorCode constants in errors.go.
 type ErrorResponse struct {
-	Error string `json:"error"`
-	Code  string `json:"code,omitempty"`
+	Error     string              `json:"error"`
+	Code      string              `json:"code,omitempty"`
+	RequestID string              `json:"request_id,omitempty"`
+	Fields    []apperr.FieldIssue `json:"fields,omitempty"` // VALIDATION_FAILED only
 }
 
 // NewErrorResponse creates an error response from an error.
@@ -0,0 +1,77 @@
+// web/incident_evidence.go
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/reports"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelIncidentEvidence exposes the evidence bundles the analysis loop
+// captures for warning and critical incidents. Bundles live in Postgres
+// and outlive the ClickHouse rows they were copied from.
+func panelIncidentEvidence(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/incident-evidence")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/incident-evidence - requires CanView (any member)
+	// Query: incident_id=<id> (optional), limit=<n, default 100, max 500>
+	// Returns metadata only; fetch a single entry for its bundle.
+	base.Get("/", func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		list, err := probe.ListIncidentEvidence(c.UserContext(), db, wID, c.Query("incident_id"), intOrDefault(c.Query("limit"), 100))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// GET /workspaces/:id/incident-evidence/:evidenceId - requires CanView
+	// Query: download=true sets Content-Disposition for ticket attachments.
+	base.Get("/:evidenceId", func(c *fiber.Ctx) error {
+		row, err := probe.GetIncidentEvidence(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "evidenceId"))
+		if err != nil {
+			return evidenceError(c, err)
+		}
+		if c.QueryBool("download") {
+			c.Attachment(fmt.Sprintf("incident-evidence-%d.json", row.ID))
+		}
+		return c.JSON(row)
+	})
+
+	// GET /workspaces/:id/incident-evidence/:evidenceId/chart.png - requires CanView
+	// Latency timeline with the incident window and loss samples marked.
+	base.Get("/:evidenceId/chart.png", func(c *fiber.Ctx) error {
+		row, err := probe.GetIncidentEvidence(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "evidenceId"))
+		if err != nil {
+			return evidenceError(c, err)
+		}
+		var bundle probe.EvidenceBundle
+		if err := json.Unmarshal(row.Bundle, &bundle); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "corrupt evidence bundle"})
+		}
+		png, err := reports.RenderIncidentEvidenceChart(&bundle)
+		if err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no samples to chart"})
+		}
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.Send(png)
+	})
+}
+
+func evidenceError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, probe.ErrNotFound) {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "evidence not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
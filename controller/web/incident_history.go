@@ -0,0 +1,109 @@
+// web/incident_history.go
+package web
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// incidentHistoryCSVLimit caps a CSV export, which ignores paging.
+const incidentHistoryCSVLimit = 10000
+
+// panelIncidentHistory exposes the incidents the analysis loop has
+// recorded, filtered and paged, with a CSV export for ops reviews, and the
+// probe samples behind each one.
+func panelIncidentHistory(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	base := api.Group("/workspaces/:id/incidents")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/incidents - requires CanView (any member)
+	// Query: status=open|resolved, severity, scope, agent=<name>, target,
+	//        from/to (RFC3339), sort=opened_at|impact,
+	//        limit (default 50, max 500), offset, format=csv
+	base.Get("/", func(c *fiber.Ctx) error {
+		q := probe.IncidentHistoryQuery{
+			WorkspaceID: workspaceCtx(c).WorkspaceID,
+			Status:      c.Query("status"),
+			Severity:    c.Query("severity"),
+			Scope:       c.Query("scope"),
+			Agent:       c.Query("agent"),
+			Target:      c.Query("target"),
+			Sort:        c.Query("sort"),
+			Limit:       intParam(c, "limit", 50, 1, 500),
+			Offset:      intParam(c, "offset", 0, 0, 1<<30),
+		}
+		for name, dst := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+			if v := c.Query(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": name + " must be RFC3339"})
+				}
+				*dst = t
+			}
+		}
+		csvExport := c.Query("format") == "csv"
+		if csvExport {
+			q.Limit, q.Offset = incidentHistoryCSVLimit, 0
+		}
+
+		list, total, err := probe.ListIncidentHistory(c.UserContext(), db, q)
+		if errors.Is(err, probe.ErrBadInput) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if csvExport {
+			var buf bytes.Buffer
+			if err := probe.WriteIncidentHistoryCSV(&buf, list); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="incidents-%d-%s.csv"`, q.WorkspaceID, time.Now().UTC().Format("20060102")))
+			return c.Send(buf.Bytes())
+		}
+		return c.JSON(NewPaginatedResponse(list, int(total), q.Limit, q.Offset))
+	})
+	// GET /workspaces/:id/incidents/:recordID/samples - requires CanView
+	// The probe_data rows that breached thresholds during one incident run.
+	// Query: type=PING|TRAFFICSIM, agent_id, limit (default 100, max 1000),
+	//        offset, payload=true (attach the raw rows still in ClickHouse)
+	base.Get("/:recordID/samples", func(c *fiber.Ctx) error {
+		q := probe.IncidentSampleQuery{
+			WorkspaceID: workspaceCtx(c).WorkspaceID,
+			RecordID:    uintParam(c, "recordID"),
+			Type:        c.Query("type"),
+			AgentID:     uint(max(intOrDefault(c.Query("agent_id"), 0), 0)),
+			Limit:       intParam(c, "limit", 100, 1, 1000),
+			Offset:      intParam(c, "offset", 0, 0, 1<<30),
+		}
+		list, total, err := probe.ListIncidentSamples(c.UserContext(), db, q)
+		switch {
+		case errors.Is(err, probe.ErrBadInput):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, probe.ErrNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "incident not found"})
+		case err != nil:
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if c.QueryBool("payload") {
+			if err := probe.AttachSamplePayloads(c.UserContext(), ch, list); err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		return c.JSON(NewPaginatedResponse(list, int(total), q.Limit, q.Offset))
+	})
+}
@@ -0,0 +1,47 @@
+// web/incident_map_snapshots.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelIncidentMapSnapshots exposes the network map snapshots the analysis
+// loop takes when a critical incident opens, so the topology can be
+// reviewed after routes recover.
+func panelIncidentMapSnapshots(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/incident-map-snapshots")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/incident-map-snapshots - requires CanView (any member)
+	// Query: incident_id=<id> (optional), limit=<n, default 100, max 500>
+	// Returns metadata only; fetch a single entry for its map.
+	base.Get("/", func(c *fiber.Ctx) error {
+		list, err := probe.ListIncidentMapSnapshots(c.UserContext(), db, uintParam(c, "id"), c.Query("incident_id"), intOrDefault(c.Query("limit"), 100))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// GET /workspaces/:id/incident-map-snapshots/:snapshotId - requires CanView
+	// The map field has the same shape as GET /workspaces/:id/network-map.
+	base.Get("/:snapshotId", func(c *fiber.Ctx) error {
+		row, err := probe.GetIncidentMapSnapshot(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "snapshotId"))
+		if errors.Is(err, probe.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "map snapshot not found"})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(row)
+	})
+}
@@ -0,0 +1,52 @@
+// web/ingest_validation.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelIngestValidation lets an operator submit an agent's locally cached
+// result summary (read from the agent's logs or status page) and see which
+// results never reached ClickHouse. Agents submit the same body to
+// POST /agent/api/ingest-validation.
+func panelIngestValidation(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	base := api.Group("/workspaces/:id/agents/:agentID/ingest-validation")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore), RequireWorkspaceAgent(wsStore, db))
+
+	// POST /workspaces/:id/agents/:agentID/ingest-validation - requires CanView (any member)
+	// Read-only: the body is compared, nothing is stored.
+	base.Post("/", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		return handleIngestValidation(c, db, ch, wsc.WorkspaceID, wsc.AgentID)
+	})
+}
+
+// handleIngestValidation parses an IngestValidationRequest and returns the
+// diff for the agent.
+func handleIngestValidation(c *fiber.Ctx, db *gorm.DB, ch *sql.DB, workspaceID, agentID uint) error {
+	var req probe.IngestValidationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+	}
+	report, err := probe.ValidateIngest(c.UserContext(), ch, db, workspaceID, agentID, req)
+	if err != nil {
+		if errors.Is(err, probe.ErrBadInput) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !report.Consistent {
+		ingestLog.WithFields(agentFields(agentID, workspaceID)).Warnf("[ingest-validation] %s", report)
+	}
+	return c.JSON(report)
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"net/http"
 	"strings"
-	"time"
 
 	"netwatcher-controller/internal/email"
 	"netwatcher-controller/internal/users"
@@ -103,26 +102,20 @@ func RegisterInviteRoutes(app *fiber.App, db *gorm.DB, emailStore *email.QueueSt
 			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		// Create session and return JWT
-		session, err := users.CreateUserSession(c.UserContext(), db, user.ID, 24*time.Hour*30) // 30 days
+		// Create session and return its tokens
+		tokens, _, err := users.IssueSession(c.UserContext(), db, user.ID, c.IP(), sessionPolicyFor(c.UserContext(), db)(user.ID))
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create session"})
 		}
 
-		jwtToken, err := users.SignUserToken(session.SessionID, user.ID, 24*time.Hour*30)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to sign token"})
-		}
-
 		// Refresh user data after updates
 		user, _ = users.Get(c.UserContext(), db, user.ID)
 
-		return c.JSON(fiber.Map{
-			"token":        jwtToken,
+		return c.JSON(tokenResponse(tokens, fiber.Map{
 			"user":         user,
 			"member":       member,
 			"workspace_id": info.WorkspaceID,
-		})
+		}))
 	})
 }
 
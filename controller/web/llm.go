@@ -0,0 +1,81 @@
+// web/llm.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/llm"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelLLM exposes a workspace's LLM enrichment settings and token usage.
+// Budgets are set by site admins (see adminSetLLMBudgetHandler).
+func panelLLM(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/llm")
+	wsStore := workspace.NewStore(db)
+	mgr := llm.NewManager(db, llm.LoadConfig())
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/llm - requires CanView (any member)
+	// Settings, effective monthly budget, and usage for the last 12 months.
+	base.Get("/", func(c *fiber.Ctx) error {
+		st, err := mgr.Status(c.UserContext(), uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(st)
+	})
+
+	// PUT /workspaces/:id/llm - requires CanManage (ADMIN+)
+	// Body: {"enabled": bool, "provider": "openai|ollama|", "model": "..."}; omitted fields are unchanged.
+	base.Put("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body llm.SettingsInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		wID := uintParam(c, "id")
+		if _, err := mgr.UpdateSettings(c.UserContext(), wID, body, currentUserID(c)); err != nil {
+			return llmError(c, err)
+		}
+		st, err := mgr.Status(c.UserContext(), wID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(st)
+	})
+}
+
+// adminSetLLMBudgetHandler sets a workspace's monthly LLM token budget.
+// Body: {"monthly_token_budget": n}; 0 = deployment default, -1 = unlimited.
+func adminSetLLMBudgetHandler(db *gorm.DB) fiber.Handler {
+	mgr := llm.NewManager(db, llm.LoadConfig())
+	return func(c *fiber.Ctx) error {
+		var body struct {
+			MonthlyTokenBudget *int64 `json:"monthly_token_budget"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.MonthlyTokenBudget == nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "monthly_token_budget is required"})
+		}
+		wID := uintParam(c, "id")
+		if _, err := mgr.SetBudget(c.UserContext(), wID, *body.MonthlyTokenBudget, currentUserID(c)); err != nil {
+			return llmError(c, err)
+		}
+		st, err := mgr.Status(c.UserContext(), wID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(st)
+	}
+}
+
+func llmError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, llm.ErrBadSettings) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
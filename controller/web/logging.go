@@ -0,0 +1,18 @@
+package web
+
+import (
+	"netwatcher-controller/internal/logging"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Subsystem loggers (see internal/logging).
+var (
+	webLog    = logging.For(logging.Web)
+	ingestLog = logging.For(logging.Ingest)
+)
+
+// agentFields tags a log line with an agent and its workspace.
+func agentFields(agentID, workspaceID uint) log.Fields {
+	return log.Fields{logging.FieldAgent: agentID, logging.FieldWorkspace: workspaceID}
+}
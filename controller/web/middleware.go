@@ -24,12 +24,12 @@ func JWTMiddleware(db *gorm.DB) fiber.Handler {
 		auth := c.Get("Authorization")
 		const pref = "Bearer "
 		if !strings.HasPrefix(auth, pref) {
-			return c.SendStatus(http.StatusUnauthorized)
+			return APIError(c, 0, CodeAuthRequired, "authentication required")
 		}
 		tok := strings.TrimSpace(auth[len(pref):])
 		u, sess, err := users.GetUserFromToken(c.UserContext(), db, tok)
 		if err != nil || u == nil || sess == nil {
-			return c.SendStatus(http.StatusUnauthorized)
+			return APIError(c, 0, CodeAuthRequired, "invalid or expired session")
 		}
 		c.Locals(ctxUserKey, u)
 		c.Locals(ctxUserIDKey, u.ID)
@@ -38,6 +38,12 @@ func JWTMiddleware(db *gorm.DB) fiber.Handler {
 	}
 }
 
+// currentSession returns the session JWTMiddleware stored for the request.
+func currentSession(c *fiber.Ctx) (*users.Session, bool) {
+	sess, ok := c.Locals(ctxSessionKey).(*users.Session)
+	return sess, ok && sess != nil
+}
+
 // APIKeyAuthMiddleware validates X-API-Key header for workspace-scoped metrics endpoints.
 func APIKeyAuthMiddleware(db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
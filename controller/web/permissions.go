@@ -1,7 +1,7 @@
 package web
 
 import (
-	"net/http"
+	"errors"
 
 	"netwatcher-controller/internal/workspace"
 
@@ -17,48 +17,32 @@ const (
 )
 
 // RequireRole returns middleware that checks if the user has at least the specified role
-// in the workspace identified by the "id" URL parameter.
+// in the workspace identified by the "id" URL parameter. Membership is loaded once
+// per request and shared through the WorkspaceContext.
 func RequireRole(store *workspace.Store, minRole workspace.Role) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := currentUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "authentication required"})
+		wsc, err := resolveWorkspace(c, store)
+		if err != nil {
+			if errors.Is(err, errWorkspaceNoAccess) {
+				return insufficientRole(c, minRole)
+			}
+			return workspaceError(c, err)
 		}
-
-		wsID := uintParam(c, "id")
-		if wsID == 0 {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "workspace id required"})
-		}
-
-		if !store.UserHasRole(c.UserContext(), wsID, userID, minRole) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{
-				"error":         "insufficient permissions",
-				"required_role": string(minRole),
-			})
+		if !wsc.Can(minRole) {
+			return insufficientRole(c, minRole)
 		}
-
 		return c.Next()
 	}
 }
 
 // RequireWorkspaceAccess is a simpler middleware that only checks if the user
-// has any access to the workspace (any role).
+// has any access to the workspace (any role). It resolves the WorkspaceContext
+// read by later handlers via workspaceCtx.
 func RequireWorkspaceAccess(store *workspace.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := currentUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "authentication required"})
+		if _, err := resolveWorkspace(c, store); err != nil {
+			return workspaceError(c, err)
 		}
-
-		wsID := uintParam(c, "id")
-		if wsID == 0 {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "workspace id required"})
-		}
-
-		if !store.UserHasAccess(c.UserContext(), wsID, userID) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
-		}
-
 		return c.Next()
 	}
 }
@@ -78,25 +62,6 @@ func RequireProbeRole(store *workspace.Store, minRole workspace.Role) fiber.Hand
 // RequireMemberManagement checks if user can manage members (ADMIN or higher)
 // with additional validation that ADMIN cannot modify OWNER or other ADMINs.
 func RequireMemberManagement(store *workspace.Store) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userID := currentUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "authentication required"})
-		}
-
-		wsID := uintParam(c, "id")
-		if wsID == 0 {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "workspace id required"})
-		}
-
-		// Must be at least ADMIN
-		if !store.UserHasRole(c.UserContext(), wsID, userID, workspace.RoleAdmin) {
-			return c.Status(http.StatusForbidden).JSON(fiber.Map{
-				"error":         "insufficient permissions",
-				"required_role": string(workspace.RoleAdmin),
-			})
-		}
-
-		return c.Next()
-	}
+	// Must be at least ADMIN; the per-target checks live in the handlers.
+	return RequireRole(store, workspace.RoleAdmin)
 }
@@ -0,0 +1,67 @@
+// web/probe_advisor.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelProbeAdvisor exposes probe placement recommendations for an SLO
+// scope, built from the configured probes and recent PING latency.
+func panelProbeAdvisor(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	wsStore := workspace.NewStore(db)
+
+	// GET /workspaces/:id/probe-advisor - requires CanView (any member)
+	// Query: agent_ids=1,2,3, targets=a,b (comma-separated, optional),
+	//        min_criticality=low|normal|high|critical, latency_ms (SLO),
+	//        lookback=<minutes, default 60>
+	api.Get("/workspaces/:id/probe-advisor", RequireWorkspaceAccess(wsStore), func(c *fiber.Ctx) error {
+		scope := probe.PlacementScope{
+			WorkspaceID:     workspaceCtx(c).WorkspaceID,
+			LatencyMs:       floatOrDefault(c.Query("latency_ms"), 0),
+			LookbackMinutes: intParam(c, "lookback", 60, 5, 1440),
+		}
+		for _, s := range strings.Split(c.Query("agent_ids"), ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "agent_ids must be a comma-separated list of IDs"})
+			}
+			scope.AgentIDs = append(scope.AgentIDs, uint(id))
+		}
+		for _, s := range strings.Split(c.Query("targets"), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				scope.Targets = append(scope.Targets, s)
+			}
+		}
+		if v := c.Query("min_criticality"); v != "" {
+			crit, err := probe.ParseCriticality(v)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			scope.MinCriticality = crit
+		}
+
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		advice, err := probe.AdviseProbePlacement(ctx, ch, db, scope)
+		if errors.Is(err, probe.ErrBadInput) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(advice)
+	})
+}
@@ -20,12 +20,13 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 	base := api.Group("/workspaces/:id/agents/:agentID/probes")
 	wsStore := workspace.NewStore(db)
 
-	// Apply workspace access check to all probe routes
-	base.Use(RequireWorkspaceAccess(wsStore))
+	// Apply workspace access check to all probe routes, and verify the
+	// agent belongs to the workspace
+	base.Use(RequireWorkspaceAccess(wsStore), RequireWorkspaceAgent(wsStore, db))
 
 	// GET /workspaces/:id/agents/:agentID/probes - requires CanView (any member)
 	base.Get("/", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		list, err := probe.ListByAgent(c.UserContext(), db, aID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -38,8 +39,8 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 	// targets include this agent. Surfaces a read-only "configured elsewhere,
 	// targeting me" view; editing/deletion always happens on the owner side.
 	base.Get("/reverse", func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
+		wsc := workspaceCtx(c)
+		wsID, aID := wsc.WorkspaceID, wsc.AgentID
 		list, err := probe.ListReverseAgentProbesWithOwners(c.UserContext(), db, wsID, aID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -49,12 +50,15 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 
 	// POST /workspaces/:id/agents/:agentID/probes - requires CanEdit (USER+)
 	base.Post("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		wsc := workspaceCtx(c)
+		aID := wsc.AgentID
 		var input probe.CreateInput
 
 		if err := c.BodyParser(&input); err != nil {
 			return c.SendStatus(http.StatusBadRequest)
 		}
+		// The route decides where the probe lives, never the body.
+		input.AgentID, input.WorkspaceID = aID, wsc.WorkspaceID
 
 		// Check agent probe limit
 		if err := limits.CanAddProbe(c.UserContext(), db, limitsConfig, aID); err != nil {
@@ -64,15 +68,71 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		// Optional pre-flight: findings are returned as warnings alongside
+		// the created probe and never block creation.
+		var preflight *probe.PreflightReport
+		if c.QueryBool("preflight") {
+			if err := probe.ExpandCatalogTargets(c.UserContext(), db, wsc.WorkspaceID, &input); err != nil {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			rep := probe.Preflight(c.UserContext(), input.Type, input.Targets)
+			preflight = &rep
+		}
+
 		p, err := probe.Create(c.UserContext(), db, input)
+		// ?on_duplicate=warn creates the probe anyway and reports the
+		// existing one; the default rejects it with a reference.
+		var dup *probe.DuplicateProbeError
+		if errors.As(err, &dup) && c.Query("on_duplicate") == "warn" {
+			input.AllowDuplicate = true
+			p, err = probe.Create(c.UserContext(), db, input)
+		} else {
+			dup = nil
+		}
 		if err != nil {
+			if v := validationError(err); v != nil {
+				return APIValidationError(c, v)
+			}
+			if errors.As(err, &dup) {
+				return c.Status(http.StatusConflict).JSON(fiber.Map{
+					"error":             err.Error(),
+					"code":              CodeConflict,
+					"existing_probe_id": dup.ExistingProbeID,
+					"duplicate":         dup,
+				})
+			}
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
+		if preflight != nil || dup != nil {
+			return c.Status(http.StatusCreated).JSON(struct {
+				*probe.Probe
+				Preflight   *probe.PreflightReport     `json:"preflight,omitempty"`
+				DuplicateOf *probe.DuplicateProbeError `json:"duplicate_of,omitempty"`
+			}{p, preflight, dup})
+		}
 		return c.Status(http.StatusCreated).JSON(p)
 	})
 
+	// POST /workspaces/:id/agents/:agentID/probes/preflight - requires CanEdit (USER+)
+	// Runs the pre-flight checks for a probe body without creating it.
+	base.Post("/preflight", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var input probe.CreateInput
+		if err := c.BodyParser(&input); err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		if !input.Type.Valid() {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid probe type"})
+		}
+		input.WorkspaceID = workspaceCtx(c).WorkspaceID
+		if err := probe.ExpandCatalogTargets(c.UserContext(), db, input.WorkspaceID, &input); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(probe.Preflight(c.UserContext(), input.Type, input.Targets))
+	})
+
 	// /workspaces/:id/agents/:agentID/probes/:probeID
 	pid := base.Group("/:probeID")
+	pid.Use(requireAgentProbe(db))
 
 	// GET /workspaces/:id/agents/:agentID/probes/:probeID - requires CanView (any member)
 	pid.Get("/", func(c *fiber.Ctx) error {
@@ -88,12 +148,14 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 	pid.Patch("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
 		id := uintParam(c, "probeID")
 		var body struct {
+			ExternalID          *string         `json:"external_id"`
 			Enabled             *bool           `json:"enabled"`
 			IntervalSec         *int            `json:"interval_sec"`
 			TimeoutSec          *int            `json:"timeout_sec"`
 			Count               *int            `json:"count"`
 			DurationSec         *int            `json:"duration_sec"`
 			BindInterface       *string         `json:"bind_interface"`
+			DSCP                *int            `json:"dscp"`
 			Labels              *map[string]any `json:"labels"`
 			Metadata            *map[string]any `json:"metadata"`
 			ReplaceTargets      []string        `json:"replaceTargets"`
@@ -104,12 +166,14 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 		}
 		in := probe.UpdateInput{
 			ID:                  id,
+			ExternalID:          body.ExternalID,
 			Enabled:             body.Enabled,
 			IntervalSec:         body.IntervalSec,
 			TimeoutSec:          body.TimeoutSec,
 			Count:               body.Count,
 			DurationSec:         body.DurationSec,
 			BindInterface:       body.BindInterface,
+			DSCP:                body.DSCP,
 			Labels:              jsonPtrFromMap(body.Labels),
 			Metadata:            jsonPtrFromMap(body.Metadata),
 			ReplaceTargets:      body.ReplaceTargets,
@@ -117,6 +181,9 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 		}
 		p, err := probe.Update(c.UserContext(), db, in)
 		if err != nil {
+			if v := validationError(err); v != nil {
+				return APIValidationError(c, v)
+			}
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.JSON(p)
@@ -136,7 +203,7 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 	// record itself is left intact (re-issue a PIN to reconfigure). ClickHouse
 	// cleanup is enqueued asynchronously.
 	base.Delete("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		if err := probe.DeleteByAgent(c.UserContext(), db, deletionStore, aID); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -172,6 +239,11 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 		if len(destIDs) == 0 {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "dest must contain valid agent IDs"})
 		}
+		for _, id := range append([]uint{sourceID}, destIDs...) {
+			if !workspaceOwnsAgent(c, db, id) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			}
+		}
 
 		// Parse probe types (optional)
 		var probeTypes []probe.Type
@@ -192,7 +264,7 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 	// POST /workspaces/:id/probes/copy - Copy probes between agents
 	// Requires CanEdit (USER+) permission
 	wsProbes.Post("/copy", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
+		wsID := workspaceCtx(c).WorkspaceID
 
 		var input probe.CopyInput
 		if err := c.BodyParser(&input); err != nil {
@@ -218,3 +290,15 @@ func panelProbes(api fiber.Router, db *gorm.DB, deletionStore *deletion.QueueSto
 		return c.JSON(result)
 	})
 }
+
+// requireAgentProbe responds 404 unless :probeID belongs to the agent
+// verified by RequireWorkspaceAgent.
+func requireAgentProbe(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := probe.GetByID(c.UserContext(), db, uintParam(c, "probeID"))
+		if err != nil || p == nil || p.AgentID != workspaceCtx(c).AgentID {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+		}
+		return c.Next()
+	}
+}
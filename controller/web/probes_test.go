@@ -0,0 +1,117 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestProbeRoutesWorkspaceScoping verifies probe creation takes its agent
+// and workspace from the route, not the body, and probe matching rejects
+// agents from another workspace.
+func TestProbeRoutesWorkspaceScoping(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&workspace.Member{}, &agent.Agent{}, &probe.Probe{}, &probe.Target{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&workspace.Member{WorkspaceID: 1, UserID: 1, Role: workspace.RoleUser}).Error; err != nil {
+		t.Fatalf("member: %v", err)
+	}
+	for _, a := range []agent.Agent{{ID: 10, WorkspaceID: 1, Name: "hq"}, {ID: 11, WorkspaceID: 1, Name: "branch"}, {ID: 20, WorkspaceID: 2, Name: "other"}} {
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatalf("agent: %v", err)
+		}
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", uint(1))
+		return c.Next()
+	})
+	panelProbes(app, db, nil, nil)
+
+	body := `{"type":"PING","workspace_id":2,"agent_id":20,"targets":["8.8.8.8"]}`
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/1/agents/10/probes", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status %d, want 201", resp.StatusCode)
+	}
+	var p probe.Probe
+	if err := db.Last(&p).Error; err != nil {
+		t.Fatalf("load probe: %v", err)
+	}
+	if p.WorkspaceID != 1 || p.AgentID != 10 {
+		t.Errorf("stored probe workspace %d agent %d, want 1 and 10", p.WorkspaceID, p.AgentID)
+	}
+
+	for path, want := range map[string]int{
+		"/workspaces/1/probes/matching?source=10&dest=11":    http.StatusOK,
+		"/workspaces/1/probes/matching?source=20&dest=11":    http.StatusNotFound,
+		"/workspaces/1/probes/matching?source=10&dest=11,20": http.StatusNotFound,
+	} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
+
+// TestProbeCreateCatalogScoping verifies catalog targets are looked up in
+// the route's workspace, so another workspace's entry is rejected even when
+// the body names that workspace.
+func TestProbeCreateCatalogScoping(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&workspace.Member{}, &agent.Agent{}, &probe.Probe{}, &probe.Target{}, &probe.CatalogEntry{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := db.Create(&workspace.Member{WorkspaceID: 1, UserID: 1, Role: workspace.RoleUser}).Error; err != nil {
+		t.Fatalf("member: %v", err)
+	}
+	if err := db.Create(&agent.Agent{ID: 10, WorkspaceID: 1, Name: "hq"}).Error; err != nil {
+		t.Fatalf("agent: %v", err)
+	}
+	private := probe.CatalogEntry{WorkspaceID: 2, Target: "10.9.9.9", Name: "Private"}
+	if err := db.Create(&private).Error; err != nil {
+		t.Fatalf("catalog: %v", err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("userID", uint(1))
+		return c.Next()
+	})
+	panelProbes(app, db, nil, nil)
+
+	body := fmt.Sprintf(`{"type":"PING","workspace_id":2,"catalog_targets":[%d]}`, private.ID)
+	for _, path := range []string{"/workspaces/1/agents/10/probes", "/workspaces/1/agents/10/probes?preflight=true", "/workspaces/1/agents/10/probes/preflight"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", path, resp.StatusCode)
+		}
+	}
+	var n int64
+	db.Model(&probe.Probe{}).Count(&n)
+	if n != 0 {
+		t.Errorf("%d probes created from another workspace's catalog", n)
+	}
+}
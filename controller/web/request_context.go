@@ -0,0 +1,75 @@
+// web/request_context.go
+// Request contexts: client disconnects and ClickHouse query budgets.
+package web
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"netwatcher-controller/internal/probe"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// ctxHTTPRequestKey carries the net/http request context across the Fiber
+// bridge (see fiberHandler). It is cancelled when the client disconnects.
+const ctxHTTPRequestKey = "httpRequestContext"
+
+// defaultRequestBudget matches the HTTP server's WriteTimeout: past it
+// the response can't be written anyway.
+const defaultRequestBudget = 30 * time.Second
+
+// heavyCHBudget bounds analysis endpoints a little under WriteTimeout so
+// they can still answer 504 instead of having the connection cut.
+const heavyCHBudget = 25 * time.Second
+
+// requestBudget reads CH_REQUEST_TIMEOUT (seconds; 0 disables the
+// deadline, leaving only disconnect cancellation).
+func requestBudget() time.Duration {
+	v := os.Getenv("CH_REQUEST_TIMEOUT")
+	if v == "" {
+		return defaultRequestBudget
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Warnf("CH_REQUEST_TIMEOUT: invalid value %q, using %v", v, defaultRequestBudget)
+		return defaultRequestBudget
+	}
+	return time.Duration(n) * time.Second
+}
+
+// RequestContextMiddleware gives every request a UserContext that is
+// cancelled when the client disconnects or the request budget runs out,
+// and tags the request's ClickHouse queries with its request ID. Must run
+// after RequestIDMiddleware.
+func RequestContextMiddleware() fiber.Handler {
+	budget := requestBudget()
+	return func(c *fiber.Ctx) error {
+		base := c.UserContext()
+		if hc, ok := c.Locals(ctxHTTPRequestKey).(context.Context); ok {
+			base = hc
+		}
+		// Client-supplied request IDs may repeat across clients; the
+		// suffix keeps a KILL from reaching another request's queries.
+		ctx, cancel := probe.WithCHBudget(base, budget, requestID(c)+"/"+newRequestID()[:8])
+		defer cancel()
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// heavyCHContext narrows the request context to budget for endpoints that
+// run expensive ClickHouse queries, and kills those queries server-side if
+// the request ends first. Always call the returned cancel.
+func heavyCHContext(c *fiber.Ctx, ch *sql.DB, budget time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), budget)
+	stop := probe.KillCHQueriesOnCancel(ctx, ch)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
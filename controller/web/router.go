@@ -24,7 +24,12 @@ import (
 func RegisterRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB, emailStore *email.QueueStore, deletionStore *deletion.QueueStore, geoStore *geoip.Store, ouiStore *oui.Store, reportScheduler *reports.Scheduler) {
 	limitsConfig := limits.LoadFromEnv()
 
+	// Request IDs, the structured error envelope and request contexts
+	// apply to every route registered below, so they must come first.
+	app.Use(RequestIDMiddleware(), ErrorEnvelopeMiddleware(), RequestContextMiddleware())
+
 	// ----- Public (no auth) -----
+	registerHealthRoutes(app, db, ch)
 	registerAuthRoutes(app, db, emailStore)
 	agentAuth(app, db)
 	RegisterInviteRoutes(app, db, emailStore)
@@ -33,15 +38,38 @@ func RegisterRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB, emailStore *email.Q
 	// Public share access routes — MUST be registered before the JWT group,
 	// because app.Group("/") applies its middleware to all routes declared after it.
 	RegisterShareRoutes(app, db, ch)
+	RegisterBadgeRoutes(app, db, ch)
+
+	// Controller-to-controller (FEDERATION_TOKEN auth) — before the JWT group.
+	registerFederationRoutes(app, db, ch)
+
+	// Agent provisioning for service accounts — also before the JWT group.
+	RegisterProvisioningRoutes(app, db, limitsConfig)
 
 	// ----- Protected (JWT) -----
 	api := app.Group("/")
 	api.Use(JWTMiddleware(db))
+	// Records successful workspace config changes for the timeline.
+	api.Use(ConfigAuditMiddleware(db))
+	// Probe and agent route parameters also accept external IDs.
+	api.Use(ExternalIDMiddleware(db))
 
 	panelWorkspaces(api, db, emailStore, deletionStore, limitsConfig)
 	panelProbes(api, db, deletionStore, limitsConfig)
+	panelTargets(api, db, ch)
+	panelIncidentEvidence(api, db)
+	panelIncidentMapSnapshots(api, db)
+	panelIncidentHistory(api, db, ch)
+	panelTicketing(api, db, ch)
+	panelDataStreams(api, db)
+	panelFeatures(api, db)
+	panelLLM(api, db)
+	panelRunbooks(api, db)
+	panelDefaultProbes(api, db)
+	panelServiceAccounts(api, db)
 	panelAgents(api, db, ch, deletionStore, limitsConfig)
 	panelProbeData(api, db, ch)
+	panelIngestValidation(api, db, ch)
 	panelSpeedtest(api, db, ch)
 	panelGeoIP(api, geoStore, ch)
 	panelWhois(api, ch)
@@ -49,11 +77,15 @@ func RegisterRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB, emailStore *email.Q
 	panelOUI(api, ouiStore)
 	panelAlerts(api, db, ch)
 	panelShareLinks(api, db)
+	panelBadges(api, db)
 	panelAnalysis(api, db, ch, geoStore)
+	panelProbeAdvisor(api, db, ch)
+	panelAnalysisReprocess(api, db, ch)
+	panelTimeline(api, db, ch)
 	panelReports(api, db, ch, emailStore, reportScheduler)
 	agentReports(api, db, ch)
 	workspaceVoiceReport(api, db, ch)
-	RegisterAdminRoutes(api, db, deletionStore, emailStore)
+	RegisterAdminRoutes(api, db, ch, deletionStore, emailStore)
 
 	// Workspace-scoped metrics (API key auth)
 	// Metrics include workspace_id labels; customers use Prometheus relabeling to filter
@@ -61,9 +93,6 @@ func RegisterRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB, emailStore *email.Q
 	workspaceMetrics.Use(APIKeyAuthMiddleware(db))
 	workspaceMetrics.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
-	// Health
-	app.Get("/healthz", func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"ok": true}) })
-
 	// Server time (public, no auth)
 	app.Get("/api/v1/time", func(c *fiber.Ctx) error {
 		now := time.Now().UTC()
@@ -76,7 +105,7 @@ func RegisterRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB, emailStore *email.Q
 
 // BuildHTTPMux creates a net/http.ServeMux that routes:
 //   - /ws/*  paths → native net/http WebSocket handlers (supports http.Hijacker)
-//   - everything else → Fiber app via adaptor.FiberApp
+//   - everything else → Fiber app via fiberHandler (see stream.go), wrapped in CompressHandler
 //
 // This is necessary because Fiber uses fasthttp under the hood, and fasthttp's
 // response writer does not implement http.Hijacker, which gorilla/websocket
@@ -100,8 +129,8 @@ func BuildHTTPMux(app *fiber.App, db *gorm.DB, ch *sql.DB) http.Handler {
 	// --- Prometheus metrics endpoint (internal/controller metrics) ---
 	mux.Handle("/metrics", promhttp.Handler())
 
-	// --- Everything else → Fiber ---
-	mux.Handle("/", adaptor.FiberApp(app))
+	// --- Everything else → Fiber (compressed, streaming-aware bridge) ---
+	mux.Handle("/", CompressHandler(fiberHandler(app)))
 
 	return mux
 }
@@ -0,0 +1,75 @@
+// web/runbooks.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelRunbooks mounts workspace runbooks — custom remediation steps
+// merged into analysis findings and incident recommendations.
+func panelRunbooks(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/runbooks")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	runbookError := func(c *fiber.Ctx, err error) error {
+		switch {
+		case errors.Is(err, probe.ErrBadInput):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, probe.ErrNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "runbook not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// GET /workspaces/:id/runbooks - requires CanView (any member)
+	base.Get("/", func(c *fiber.Ctx) error {
+		list, err := probe.ListRunbooks(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return runbookError(c, err)
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/runbooks - requires CanManage (ADMIN+)
+	base.Post("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body probe.RunbookInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		rb, err := probe.CreateRunbook(c.UserContext(), db, uintParam(c, "id"), body)
+		if err != nil {
+			return runbookError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(rb)
+	})
+
+	// PUT /workspaces/:id/runbooks/:runbookID - requires CanManage (ADMIN+)
+	base.Put("/:runbookID", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body probe.RunbookInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		rb, err := probe.UpdateRunbook(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "runbookID"), body)
+		if err != nil {
+			return runbookError(c, err)
+		}
+		return c.JSON(rb)
+	})
+
+	// DELETE /workspaces/:id/runbooks/:runbookID - requires CanManage (ADMIN+)
+	base.Delete("/:runbookID", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		if err := probe.DeleteRunbook(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "runbookID")); err != nil {
+			return runbookError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
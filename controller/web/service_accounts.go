@@ -0,0 +1,222 @@
+// web/service_accounts.go
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/limits"
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const ctxServiceAccountKey = "serviceAccount"
+
+// ServiceAccountMiddleware authenticates Authorization: Bearer nwsa_… keys
+// for the workspace in :id and requires scope.
+func ServiceAccountMiddleware(db *gorm.DB, scope workspace.ServiceAccountScope) fiber.Handler {
+	wsStore := workspace.NewStore(db)
+	return func(c *fiber.Ctx) error {
+		auth := c.Get("Authorization")
+		const pref = "Bearer "
+		if !strings.HasPrefix(auth, pref) {
+			return APIError(c, 0, CodeAuthRequired, "service account key required")
+		}
+		sa, err := wsStore.ValidateServiceAccountKey(c.UserContext(), strings.TrimSpace(auth[len(pref):]))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if sa == nil {
+			return APIError(c, 0, CodeInvalidCredentials, "invalid or expired service account key")
+		}
+		if sa.WorkspaceID != uintParam(c, "id") {
+			return APIError(c, 0, CodeWorkspaceAccessDenied, "access denied")
+		}
+		if !sa.HasScope(scope) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error":          "service account lacks scope",
+				"code":           CodeInsufficientRole,
+				"required_scope": string(scope),
+			})
+		}
+		c.Locals(ctxServiceAccountKey, sa)
+		return c.Next()
+	}
+}
+
+// panelServiceAccounts mounts service account management for workspace
+// admins.
+func panelServiceAccounts(api fiber.Router, db *gorm.DB) {
+	base := api.Group("/workspaces/:id/service-accounts")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore), RequireRole(wsStore, CanManage))
+
+	// GET /workspaces/:id/service-accounts - requires CanManage (ADMIN+)
+	base.Get("/", func(c *fiber.Ctx) error {
+		list, err := wsStore.ListServiceAccounts(c.UserContext(), uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/service-accounts - requires CanManage (ADMIN+)
+	// The key is returned once and cannot be retrieved later.
+	base.Post("/", func(c *fiber.Ctx) error {
+		var body struct {
+			Name      string                          `json:"name"`
+			Scopes    []workspace.ServiceAccountScope `json:"scopes"`
+			ExpiresAt *time.Time                      `json:"expires_at"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		sa, key, err := wsStore.CreateServiceAccount(c.UserContext(), workspace.CreateServiceAccountInput{
+			WorkspaceID: uintParam(c, "id"),
+			Name:        body.Name,
+			Scopes:      body.Scopes,
+			ExpiresAt:   body.ExpiresAt,
+			CreatedBy:   currentUserID(c),
+		})
+		if err != nil {
+			if errors.Is(err, workspace.ErrInvalidInput) {
+				return APIError(c, 0, CodeValidationFailed, err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusCreated).JSON(fiber.Map{"service_account": sa, "key": key})
+	})
+
+	// DELETE /workspaces/:id/service-accounts/:saID - requires CanManage (ADMIN+)
+	base.Delete("/:saID", func(c *fiber.Ctx) error {
+		if err := wsStore.DeleteServiceAccount(c.UserContext(), uintParam(c, "saID"), uintParam(c, "id")); err != nil {
+			if errors.Is(err, workspace.ErrNotFound) {
+				return APIError(c, 0, CodeNotFound, "service account not found")
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
+
+// RegisterProvisioningRoutes mounts the service-account-authenticated
+// agent provisioning endpoints. They must be registered before the JWT
+// group, which would otherwise reject service account keys.
+func RegisterProvisioningRoutes(app *fiber.App, db *gorm.DB, limitsConfig *limits.Config) {
+	base := app.Group("/provision/workspaces/:id/agents")
+
+	// POST /provision/workspaces/:id/agents - scope agents:create
+	// Creates an agent and returns its bootstrap PIN (shown once).
+	base.Post("/", ServiceAccountMiddleware(db, workspace.ScopeAgentsCreate), func(c *fiber.Ctx) error {
+		wsID := uintParam(c, "id")
+		sa := c.Locals(ctxServiceAccountKey).(*workspace.ServiceAccount)
+		var body struct {
+			Name             string         `json:"name"`
+			Description      string         `json:"description"`
+			Location         string         `json:"location"`
+			PublicIPOverride string         `json:"public_ip_override"`
+			PinLength        int            `json:"pinLength"`
+			PinTTLSeconds    int            `json:"pinTTLSeconds"`
+			Labels           map[string]any `json:"labels"`
+			Metadata         map[string]any `json:"metadata"`
+			TemplateAgentID  uint           `json:"template_agent_id"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		var ttl *time.Duration
+		if body.PinTTLSeconds > 0 {
+			d := time.Duration(body.PinTTLSeconds) * time.Second
+			ttl = &d
+		}
+
+		if err := limits.CanAddAgent(c.UserContext(), db, limitsConfig, wsID); err != nil {
+			if errors.Is(err, limits.ErrAgentLimitReached) {
+				return APIError(c, 0, CodeLimitExceeded, err.Error())
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// Record which service account enrolled the agent.
+		if body.Metadata == nil {
+			body.Metadata = map[string]any{}
+		}
+		body.Metadata["provisioned_by_service_account"] = sa.ID
+
+		out, err := agent.CreateAgent(c.UserContext(), db, agent.CreateInput{
+			WorkspaceID:      wsID,
+			Name:             body.Name,
+			Description:      body.Description,
+			PinLength:        body.PinLength,
+			Location:         body.Location,
+			PublicIPOverride: body.PublicIPOverride,
+			Labels:           jsonFromMap(body.Labels),
+			Metadata:         jsonFromMap(body.Metadata),
+			PINTTL:           ttl,
+		})
+		if err != nil {
+			if v := validationError(err); v != nil {
+				return APIValidationError(c, v)
+			}
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// Template must be an agent in the same workspace.
+		if body.TemplateAgentID != 0 {
+			if tmpl, _ := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, wsID, body.TemplateAgentID); tmpl != nil {
+				if _, err := probe.CopyProbes(c.UserContext(), db, probe.CopyInput{
+					SourceAgentID: body.TemplateAgentID,
+					DestAgentIDs:  []uint{out.Agent.ID},
+					WorkspaceID:   wsID,
+				}); err != nil {
+					log.Warnf("Failed to copy probes from agent %d to %d: %v", body.TemplateAgentID, out.Agent.ID, err)
+				}
+			}
+		} else if _, err := probe.ApplyDefaultProbeBundle(c.UserContext(), db, wsID, out.Agent.ID, limitsConfig.MaxProbesPerAgent); err != nil {
+			log.Warnf("Default probe bundle for agent %d incomplete: %v", out.Agent.ID, err)
+		}
+
+		log.Infof("Service account %d (%s) provisioned agent %d in workspace %d", sa.ID, sa.Name, out.Agent.ID, wsID)
+		return c.Status(http.StatusCreated).JSON(out)
+	})
+
+	// POST /provision/workspaces/:id/agents/:agentID/issue-pin - scope agents:bootstrap
+	// Issues a fresh bootstrap PIN for an agent that has not bootstrapped.
+	base.Post("/:agentID/issue-pin", ServiceAccountMiddleware(db, workspace.ScopeAgentsBootstrap), func(c *fiber.Ctx) error {
+		wsID := uintParam(c, "id")
+		aID := uintParam(c, "agentID")
+		var body struct {
+			PinLength  int `json:"pinLength"`
+			TTLSeconds int `json:"ttlSeconds"`
+		}
+		_ = c.BodyParser(&body)
+
+		a, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, wsID, aID)
+		if err != nil || a == nil {
+			return APIError(c, 0, CodeAgentNotFound, "agent not found")
+		}
+		// Re-keying a live agent would hand its identity to the caller.
+		if a.Initialized {
+			return APIError(c, http.StatusConflict, CodeConflict, "agent already bootstrapped")
+		}
+
+		var ttl *time.Duration
+		if body.TTLSeconds > 0 {
+			d := time.Duration(body.TTLSeconds) * time.Second
+			ttl = &d
+		}
+		pin, err := agent.IssuePIN(c.UserContext(), db, wsID, aID, ifZero(body.PinLength, 9), ttl)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"pin": pin})
+	})
+}
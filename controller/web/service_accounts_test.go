@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestServiceAccountScoping verifies a service account key only works on
+// its own workspace, only for the scopes it holds, and never on
+// session-authenticated routes.
+func TestServiceAccountScoping(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	s := workspace.NewStore(db)
+	if err := s.AutoMigrateServiceAccounts(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	create := func(wsID uint, scopes ...workspace.ServiceAccountScope) (*workspace.ServiceAccount, string) {
+		t.Helper()
+		sa, key, err := s.CreateServiceAccount(ctx, workspace.CreateServiceAccountInput{WorkspaceID: wsID, Name: "rmm", Scopes: scopes})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		return sa, key
+	}
+	_, full := create(1)
+	_, bootstrapOnly := create(1, workspace.ScopeAgentsBootstrap)
+	expired, expiredKey := create(1)
+	db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute))
+	revoked, revokedKey := create(1)
+	if err := s.DeleteServiceAccount(ctx, revoked.ID, 1); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	app := fiber.New()
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) }
+	app.Post("/provision/workspaces/:id/agents", ServiceAccountMiddleware(db, workspace.ScopeAgentsCreate), ok)
+	app.Post("/provision/workspaces/:id/agents/:agentID/issue-pin", ServiceAccountMiddleware(db, workspace.ScopeAgentsBootstrap), ok)
+	app.Get("/workspaces/:id/agents", JWTMiddleware(db), ok)
+
+	cases := []struct {
+		name, method, path, key string
+		want                    int
+	}{
+		{"own workspace", http.MethodPost, "/provision/workspaces/1/agents", full, http.StatusOK},
+		{"other workspace", http.MethodPost, "/provision/workspaces/2/agents", full, http.StatusForbidden},
+		{"missing scope", http.MethodPost, "/provision/workspaces/1/agents", bootstrapOnly, http.StatusForbidden},
+		{"held scope", http.MethodPost, "/provision/workspaces/1/agents/5/issue-pin", bootstrapOnly, http.StatusOK},
+		{"expired", http.MethodPost, "/provision/workspaces/1/agents", expiredKey, http.StatusUnauthorized},
+		{"revoked", http.MethodPost, "/provision/workspaces/1/agents", revokedKey, http.StatusUnauthorized},
+		{"no key", http.MethodPost, "/provision/workspaces/1/agents", "", http.StatusUnauthorized},
+		{"session route", http.MethodGet, "/workspaces/1/agents", full, http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.key)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
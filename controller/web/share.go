@@ -22,34 +22,24 @@ import (
 
 // panelShareLinks registers share link management endpoints for authenticated users.
 func panelShareLinks(api fiber.Router, db *gorm.DB) {
-	// Create share link for an agent
-	api.Post("/workspaces/:id/agents/:agentID/share-links", func(c *fiber.Ctx) error {
-		workspaceID := uintParam(c, "id")
-		agentID := uintParam(c, "agentID")
-
-		userID := getUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
-		}
+	wsStore := workspace.NewStore(db)
+	links := api.Group("/workspaces/:id/agents/:agentID/share-links")
+	links.Use(RequireWorkspaceAccess(wsStore), RequireWorkspaceAgent(wsStore, db))
 
-		// Verify user has access to workspace
-		if !fiberHasWorkspaceAccess(c, db, workspaceID, userID) {
-			return nil // response already sent
-		}
-
-		// Verify agent belongs to workspace
-		_, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, workspaceID, agentID)
-		if err != nil {
-			if errors.Is(err, agent.ErrNotFound) {
-				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
-			}
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		}
+	// Create share link for an agent
+	links.Post("/", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
 
 		// Parse request body
 		var body struct {
 			ExpiresInSeconds int    `json:"expires_in_seconds"`
 			Password         string `json:"password,omitempty"`
+			// Optional probe data window: rolling seconds and/or fixed range
+			DataWindowSeconds int        `json:"data_window_seconds,omitempty"`
+			DataFrom          *time.Time `json:"data_from,omitempty"`
+			DataTo            *time.Time `json:"data_to,omitempty"`
+			// Pseudonymize IPs, hostnames and ISP names in shared data
+			Anonymize bool `json:"anonymize,omitempty"`
 		}
 		if err := c.BodyParser(&body); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
@@ -67,13 +57,20 @@ func panelShareLinks(api fiber.Router, db *gorm.DB) {
 
 		// Create share link
 		output, err := share.Create(c.UserContext(), db, share.CreateInput{
-			WorkspaceID:     workspaceID,
-			AgentID:         agentID,
-			CreatedByUserID: userID,
+			WorkspaceID:     wsc.WorkspaceID,
+			AgentID:         wsc.AgentID,
+			CreatedByUserID: wsc.UserID,
 			ExpiresIn:       expiresIn,
 			Password:        body.Password,
+			DataWindow:      time.Duration(body.DataWindowSeconds) * time.Second,
+			DataFrom:        body.DataFrom,
+			DataTo:          body.DataTo,
+			Anonymize:       body.Anonymize,
 		})
 		if err != nil {
+			if errors.Is(err, share.ErrInvalidDataWindow) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "data_from must be before data_to and data_window_seconds must not be negative"})
+			}
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
@@ -81,45 +78,20 @@ func panelShareLinks(api fiber.Router, db *gorm.DB) {
 	})
 
 	// List share links for an agent
-	api.Get("/workspaces/:id/agents/:agentID/share-links", func(c *fiber.Ctx) error {
-		workspaceID := uintParam(c, "id")
-		agentID := uintParam(c, "agentID")
-
-		userID := getUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
-		}
-
-		// Verify user has access to workspace
-		if !fiberHasWorkspaceAccess(c, db, workspaceID, userID) {
-			return nil // response already sent
-		}
-
-		links, err := share.ListByAgent(c.UserContext(), db, workspaceID, agentID)
+	links.Get("/", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		list, err := share.ListByAgent(c.UserContext(), db, wsc.WorkspaceID, wsc.AgentID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		return c.JSON(fiber.Map{"items": links, "total": len(links)})
+		return c.JSON(fiber.Map{"items": list, "total": len(list)})
 	})
 
 	// Delete (revoke) a share link
-	api.Delete("/workspaces/:id/agents/:agentID/share-links/:linkID", func(c *fiber.Ctx) error {
-		workspaceID := uintParam(c, "id")
-		agentID := uintParam(c, "agentID")
-		linkID := uintParam(c, "linkID")
-
-		userID := getUserID(c)
-		if userID == 0 {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
-		}
-
-		// Verify user has access to workspace
-		if !fiberHasWorkspaceAccess(c, db, workspaceID, userID) {
-			return nil // response already sent
-		}
-
-		err := share.Delete(c.UserContext(), db, workspaceID, agentID, linkID)
+	links.Delete("/:linkID", func(c *fiber.Ctx) error {
+		wsc := workspaceCtx(c)
+		err := share.Delete(c.UserContext(), db, wsc.WorkspaceID, wsc.AgentID, uintParam(c, "linkID"))
 		if err != nil {
 			if errors.Is(err, share.ErrShareLinkNotFound) {
 				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "share link not found"})
@@ -131,21 +103,6 @@ func panelShareLinks(api fiber.Router, db *gorm.DB) {
 	})
 }
 
-// fiberHasWorkspaceAccess checks if the user has access to the workspace.
-func fiberHasWorkspaceAccess(c *fiber.Ctx, db *gorm.DB, workspaceID, userID uint) bool {
-	store := workspace.NewStore(db)
-	_, err := store.GetMemberByUserID(c.UserContext(), workspaceID, userID)
-	if err != nil {
-		if errors.Is(err, workspace.ErrNotFound) {
-			_ = c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "access denied"})
-			return false
-		}
-		_ = c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-		return false
-	}
-	return true
-}
-
 // -------------------- Public Endpoints (no auth) --------------------
 
 // RegisterShareRoutes registers public share link access endpoints.
@@ -190,6 +147,9 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			}
 		}
 
+		anon := link.Anonymizer()
+		publicIP = anon.IP(publicIP)
+
 		// Get owned probes AND reverse probes (from other agents targeting this one)
 		owned, reverse, err := probe.ListByAgentWithReverse(c.UserContext(), db, link.AgentID)
 		if err != nil {
@@ -200,12 +160,12 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 		var probes []probe.Probe
 		for _, p := range owned {
 			if p.Enabled {
-				probes = append(probes, p)
+				probes = append(probes, anonymizeProbe(anon, p))
 			}
 		}
 		for _, p := range reverse {
 			if p.Enabled {
-				probes = append(probes, p)
+				probes = append(probes, anonymizeProbe(anon, p))
 			}
 		}
 
@@ -225,6 +185,7 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 				continue
 			}
 			v.OwnerAgentName = redactedOwnerName
+			v.Probe = anonymizeProbe(anon, v.Probe)
 			publicReverseProbes = append(publicReverseProbes, v)
 		}
 
@@ -246,6 +207,8 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			"reverse_count":   len(reverse), // Number of probes from other agents targeting this one
 			"expires_at":      link.ExpiresAt,
 			"allow_speedtest": link.AllowSpeedtest,
+			"data_window":     shareDataWindow(link),
+			"anonymized":      link.Anonymize,
 		})
 	})
 
@@ -269,6 +232,8 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			"expired":         expired,
 			"expires_at":      link.ExpiresAt,
 			"allow_speedtest": link.AllowSpeedtest,
+			"data_window":     shareDataWindow(link),
+			"anonymized":      link.Anonymize,
 		})
 	})
 
@@ -412,6 +377,12 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			toTime, _ = time.Parse(time.RFC3339, to)
 		}
 
+		// Enforce the link's data window
+		fromTime, toTime, err = link.ClampRange(fromTime, toTime, time.Now().UTC())
+		if err != nil {
+			return fiberHandleShareError(c, err)
+		}
+
 		// Use the SAME logic as the normal panel endpoint (data.go)
 		var rows []probe.ProbeData
 		var queryErr error
@@ -438,6 +409,8 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to query probe data"})
 		}
 
+		anonymizeProbeData(link.Anonymizer(), rows)
+
 		// Return the SAME format as the normal panel - NewListResponse(rows)
 		return c.JSON(NewListResponse(rows))
 	})
@@ -464,7 +437,10 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 		limit := intOrDefault(c.Query("limit"), 500)
 		lookbackMin := intOrDefault(c.Query("lookback"), 60)
 
-		from := time.Now().UTC().Add(-time.Duration(lookbackMin) * time.Minute)
+		from, to, err := link.ClampRange(time.Now().UTC().Add(-time.Duration(lookbackMin)*time.Minute), time.Time{}, time.Now().UTC())
+		if err != nil {
+			return fiberHandleShareError(c, err)
+		}
 
 		agentID := uint64(link.AgentID)
 		typ := string(probe.TypeDNS)
@@ -472,11 +448,13 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			Type:    &typ,
 			AgentID: &agentID,
 			From:    from,
+			To:      to,
 			Limit:   limit,
 		})
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to query DNS data"})
 		}
+		anonymizeProbeData(link.Anonymizer(), rows)
 
 		// Group results by target hostname (same logic as data.go)
 		type dnsGroupEntry struct {
@@ -554,7 +532,10 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 		limit := intOrDefault(c.Query("limit"), 500)
 		lookbackMin := intOrDefault(c.Query("lookback"), 60)
 
-		from := time.Now().UTC().Add(-time.Duration(lookbackMin) * time.Minute)
+		from, to, err := link.ClampRange(time.Now().UTC().Add(-time.Duration(lookbackMin)*time.Minute), time.Time{}, time.Now().UTC())
+		if err != nil {
+			return fiberHandleShareError(c, err)
+		}
 
 		agentID := uint64(link.AgentID)
 		httpType := string(probe.TypeHTTP)
@@ -567,6 +548,7 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			Type:    &httpType,
 			AgentID: &agentID,
 			From:    from,
+			To:      to,
 			Limit:   limit,
 		})
 		if err != nil {
@@ -578,12 +560,14 @@ func RegisterShareRoutes(app *fiber.App, db *gorm.DB, ch *sql.DB) {
 			Type:    &tlsType,
 			AgentID: &agentID,
 			From:    from,
+			To:      to,
 			Limit:   limit,
 		})
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "failed to query TLS data"})
 		}
 		allRows = append(allRows, rows...)
+		anonymizeProbeData(link.Anonymizer(), allRows)
 
 		type httpGroupEntry struct {
 			CreatedAt time.Time       `json:"created_at"`
@@ -656,7 +640,50 @@ func fiberHandleShareError(c *fiber.Ctx, err error) error {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "password required", "requires_password": true})
 	case errors.Is(err, share.ErrInvalidPassword):
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password"})
+	case errors.Is(err, share.ErrOutsideDataWindow):
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "data_window": true})
 	default:
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 }
+
+// shareDataWindow describes a link's data window for public viewers, or
+// nil when probe data is unrestricted.
+func shareDataWindow(link *share.ShareLink) fiber.Map {
+	if !link.HasDataWindow() {
+		return nil
+	}
+	return fiber.Map{
+		"window_seconds": link.DataWindowSeconds,
+		"from":           link.DataFrom,
+		"to":             link.DataTo,
+		"live":           link.AllowsLiveData(time.Now()),
+	}
+}
+
+// anonymizeProbe returns a copy of p with its target addresses
+// pseudonymized. A nil anon returns p unchanged.
+func anonymizeProbe(anon *share.Anonymizer, p probe.Probe) probe.Probe {
+	if anon == nil {
+		return p
+	}
+	targets := make([]probe.Target, len(p.Targets))
+	for i, t := range p.Targets {
+		t.Target = anon.Host(t.Target)
+		targets[i] = t
+	}
+	p.Targets = targets
+	return p
+}
+
+// anonymizeProbeData pseudonymizes the target and payload of each row in
+// place. A nil anon leaves rows unchanged.
+func anonymizeProbeData(anon *share.Anonymizer, rows []probe.ProbeData) {
+	if anon == nil {
+		return
+	}
+	for i := range rows {
+		rows[i].Target = anon.Host(rows[i].Target)
+		rows[i].Payload = anon.Payload(rows[i].Payload)
+	}
+}
@@ -4,8 +4,10 @@ package web
 import (
 	"database/sql"
 	"net/http"
+	"netwatcher-controller/internal/probe"
 	"netwatcher-controller/internal/speedtest"
 	"netwatcher-controller/internal/workspace"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -19,14 +21,14 @@ func panelSpeedtest(api fiber.Router, db *gorm.DB, ch *sql.DB) {
 
 	// Speedtest routes under individual agents
 	st := ws.Group("/agents/:agentID")
-	st.Use(RequireWorkspaceAccess(wsStore))
+	st.Use(RequireWorkspaceAccess(wsStore), RequireWorkspaceAgent(wsStore, db))
 
 	// -------------------- Queue Endpoints --------------------
 
 	// GET /workspaces/:id/agents/:agentID/speedtest-queue
 	// List queue items for an agent
 	st.Get("/speedtest-queue", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		var status *speedtest.QueueStatus
 		if s := c.Query("status"); s != "" {
 			st := speedtest.QueueStatus(s)
@@ -43,9 +45,8 @@ func panelSpeedtest(api fiber.Router, db *gorm.DB, ch *sql.DB) {
 	// POST /workspaces/:id/agents/:agentID/speedtest-queue
 	// Add a new speedtest to the queue - requires CanEdit (USER+)
 	st.Post("/speedtest-queue", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
-		wsID := uintParam(c, "id")
-		aID := uintParam(c, "agentID")
-		userID := getUserID(c)
+		wsc := workspaceCtx(c)
+		wsID, aID, userID := wsc.WorkspaceID, wsc.AgentID, wsc.UserID
 
 		var body struct {
 			ServerID   string `json:"server_id"`
@@ -95,11 +96,33 @@ func panelSpeedtest(api fiber.Router, db *gorm.DB, ch *sql.DB) {
 	// GET /workspaces/:id/agents/:agentID/speedtest-servers
 	// Get cached speedtest servers for an agent
 	st.Get("/speedtest-servers", func(c *fiber.Ctx) error {
-		aID := uintParam(c, "agentID")
+		aID := workspaceCtx(c).AgentID
 		servers, err := speedtest.ListServersForAgent(c.UserContext(), db, aID)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.JSON(fiber.Map{"data": servers, "total": len(servers)})
 	})
+
+	// GET /workspaces/:id/agents/:agentID/speedtest-server-changes
+	// Switches of the tested speedtest server, oldest first.
+	// Query: from=<RFC3339|unix, default 30 days ago>, to=<default now>
+	st.Get("/speedtest-server-changes", func(c *fiber.Ctx) error {
+		to, ok := readTime(c.Query("to"))
+		if !ok {
+			to = time.Now().UTC()
+		}
+		from, ok := readTime(c.Query("from"))
+		if !ok {
+			from = to.Add(-30 * 24 * time.Hour)
+		}
+		if !from.Before(to) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "from must be before to"})
+		}
+		changes, err := probe.GetSpeedtestServerChanges(c.UserContext(), ch, []uint{workspaceCtx(c).AgentID}, from, to)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"data": changes, "total": len(changes)})
+	})
 }
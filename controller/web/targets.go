@@ -0,0 +1,259 @@
+// web/targets.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelTargets mounts workspace-wide target settings: the criticality
+// label used to weight incident impact scores, maintenance flags that
+// exclude expected-down targets from health scoring and incidents, and the
+// curated target catalog probes pick targets from, and target groups that
+// report one health status for a multi-target service.
+func panelTargets(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	base := api.Group("/workspaces/:id/targets")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/targets/criticality - requires CanView (any member)
+	// Lists targets with a non-default criticality label.
+	base.Get("/criticality", func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		list, err := probe.ListTargetCriticality(c.UserContext(), db, wID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// PUT /workspaces/:id/targets/criticality - requires CanEdit (USER+)
+	// Body: {"target": "10.0.0.1", "criticality": "low|normal|high|critical"}
+	// Setting "normal" clears the label.
+	base.Put("/criticality", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		var body struct {
+			Target      string `json:"target"`
+			Criticality string `json:"criticality"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		crit, err := probe.ParseCriticality(body.Criticality)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		row, err := probe.SetTargetCriticality(c.UserContext(), db, wID, body.Target, crit)
+		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(row)
+	})
+
+	// GET /workspaces/:id/targets/maintenance - requires CanView (any member)
+	// Lists maintenance flags, including expired ones (see "active").
+	base.Get("/maintenance", func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		list, err := probe.ListTargetMaintenance(c.UserContext(), db, wID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		now := time.Now()
+		type entry struct {
+			probe.TargetMaintenance
+			Active bool `json:"active"`
+		}
+		out := make([]entry, len(list))
+		for i := range list {
+			out[i] = entry{TargetMaintenance: list[i], Active: list[i].Active(now)}
+		}
+		return c.JSON(NewListResponse(out))
+	})
+
+	// PUT /workspaces/:id/targets/maintenance - requires CanEdit (USER+)
+	// Body: {"target": "old-db.example.com", "reason": "decommissioned", "until": "2026-01-01T00:00:00Z"}
+	// "until" is optional; without it the flag stays until deleted.
+	base.Put("/maintenance", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		var body struct {
+			Target string     `json:"target"`
+			Reason string     `json:"reason"`
+			Until  *time.Time `json:"until"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		row, err := probe.SetTargetMaintenance(c.UserContext(), db, wID, body.Target, body.Reason, body.Until, currentUserID(c))
+		if err != nil {
+			if errors.Is(err, probe.ErrBadInput) {
+				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(row)
+	})
+
+	// DELETE /workspaces/:id/targets/maintenance?target=... - requires CanEdit (USER+)
+	base.Delete("/maintenance", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		target := c.Query("target")
+		if target == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "target is required"})
+		}
+		if err := probe.ClearTargetMaintenance(c.UserContext(), db, wID, target); err != nil {
+			if errors.Is(err, probe.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "maintenance flag not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// GET /workspaces/:id/targets/catalog?category= - requires CanView (any member)
+	base.Get("/catalog", func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		list, err := probe.ListCatalog(c.UserContext(), db, wID, c.Query("category"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/targets/catalog - requires CanEdit (USER+)
+	// Body: {"target": "api.stripe.com", "name": "Stripe API", "category": "saas",
+	//        "description": "...", "criticality": "high"}
+	base.Post("/catalog", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.CatalogEntry
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		body.WorkspaceID = uintParam(c, "id")
+		row, err := probe.CreateCatalogEntry(c.UserContext(), db, body)
+		if err != nil {
+			return catalogError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(row)
+	})
+
+	// POST /workspaces/:id/targets/catalog/defaults - requires CanEdit (USER+)
+	// Adds the built-in starter entries the workspace doesn't have yet.
+	base.Post("/catalog/defaults", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		n, err := probe.ImportDefaultCatalog(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return catalogError(c, err)
+		}
+		return c.JSON(fiber.Map{"added": n})
+	})
+
+	// PUT /workspaces/:id/targets/catalog/:entryID - requires CanEdit (USER+)
+	// Replaces the entry; body as for POST.
+	base.Put("/catalog/:entryID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.CatalogEntry
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		row, err := probe.UpdateCatalogEntry(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "entryID"), body)
+		if err != nil {
+			return catalogError(c, err)
+		}
+		return c.JSON(row)
+	})
+
+	// DELETE /workspaces/:id/targets/catalog/:entryID - requires CanEdit (USER+)
+	base.Delete("/catalog/:entryID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		if err := probe.DeleteCatalogEntry(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "entryID")); err != nil {
+			return catalogError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// GET /workspaces/:id/targets/groups - requires CanView (any member)
+	base.Get("/groups", func(c *fiber.Ctx) error {
+		list, err := probe.ListTargetGroups(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/targets/groups - requires CanEdit (USER+)
+	// Body: {"name": "Microsoft 365", "description": "...",
+	//        "targets": ["outlook.office365.com", "teams.microsoft.com"]}
+	base.Post("/groups", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.TargetGroupInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		row, err := probe.CreateTargetGroup(c.UserContext(), db, uintParam(c, "id"), body)
+		if err != nil {
+			return targetGroupError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(row)
+	})
+
+	// PUT /workspaces/:id/targets/groups/:groupID - requires CanEdit (USER+)
+	// Replaces the group; body as for POST.
+	base.Put("/groups/:groupID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.TargetGroupInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		row, err := probe.UpdateTargetGroup(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "groupID"), body)
+		if err != nil {
+			return targetGroupError(c, err)
+		}
+		return c.JSON(row)
+	})
+
+	// DELETE /workspaces/:id/targets/groups/:groupID - requires CanEdit (USER+)
+	base.Delete("/groups/:groupID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		if err := probe.DeleteTargetGroup(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "groupID")); err != nil {
+			return targetGroupError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	// GET /workspaces/:id/targets/groups/:groupID/health?lookback=15 - requires CanView (any member)
+	// One status for the whole service, with per-target and per-agent
+	// breakdowns. lookback is in minutes.
+	base.Get("/groups/:groupID/health", func(c *fiber.Ctx) error {
+		lookback := intOrDefault(c.Query("lookback"), 15)
+		h, err := probe.GroupServiceHealth(c.UserContext(), ch, db, uintParam(c, "id"), uintParam(c, "groupID"), lookback)
+		if err != nil {
+			return targetGroupError(c, err)
+		}
+		return c.JSON(h)
+	})
+}
+
+func targetGroupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, probe.ErrBadInput):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, probe.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "target group not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+func catalogError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, probe.ErrBadInput):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, probe.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "catalog entry not found"})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
@@ -0,0 +1,127 @@
+// web/ticketing.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/ticketing"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelTicketing mounts Jira / ServiceNow integrations and the ticket
+// links they create. Syncing runs in the analysis loop; these routes
+// configure it and open tickets on demand.
+func panelTicketing(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	wsStore := workspace.NewStore(db)
+
+	integrations := api.Group("/workspaces/:id/ticket-integrations")
+	integrations.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/ticket-integrations - requires CanView (any member)
+	// Credentials are never returned; has_token reports whether one is set.
+	integrations.Get("/", func(c *fiber.Ctx) error {
+		list, err := ticketing.ListIntegrations(c.UserContext(), db, uintParam(c, "id"))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/ticket-integrations - requires CanManage (ADMIN+)
+	integrations.Post("/", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body ticketing.IntegrationInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		it, err := ticketing.CreateIntegration(c.UserContext(), db, uintParam(c, "id"), body)
+		if err != nil {
+			return ticketingError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(it)
+	})
+
+	// PATCH /workspaces/:id/ticket-integrations/:integrationId - requires CanManage (ADMIN+)
+	// Omitted fields are unchanged; omit api_token to keep the stored one.
+	integrations.Patch("/:integrationId", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		var body ticketing.IntegrationInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		it, err := ticketing.UpdateIntegration(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "integrationId"), body)
+		if err != nil {
+			return ticketingError(c, err)
+		}
+		return c.JSON(it)
+	})
+
+	// DELETE /workspaces/:id/ticket-integrations/:integrationId - requires CanManage (ADMIN+)
+	integrations.Delete("/:integrationId", RequireRole(wsStore, CanManage), func(c *fiber.Ctx) error {
+		if err := ticketing.DeleteIntegration(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "integrationId")); err != nil {
+			return ticketingError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
+	tickets := api.Group("/workspaces/:id/incident-tickets")
+	tickets.Use(RequireWorkspaceAccess(wsStore))
+
+	// GET /workspaces/:id/incident-tickets - requires CanView (any member)
+	// Query: incident_id=<id> (optional), limit=<n, default 100, max 500>
+	tickets.Get("/", func(c *fiber.Ctx) error {
+		list, err := ticketing.ListTickets(c.UserContext(), db, uintParam(c, "id"), c.Query("incident_id"), intOrDefault(c.Query("limit"), 100))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(NewListResponse(list))
+	})
+
+	// POST /workspaces/:id/incident-tickets - requires CanEdit (USER+)
+	// Body: {"integration_id": 1, "incident_id": "agent_offline_12"}
+	// The incident must appear in the latest analysis snapshot.
+	tickets.Post("/", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		wID := uintParam(c, "id")
+		var body struct {
+			IntegrationID uint   `json:"integration_id"`
+			IncidentID    string `json:"incident_id"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.IntegrationID == 0 || body.IncidentID == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "integration_id and incident_id are required"})
+		}
+		it, err := ticketing.GetIntegration(c.UserContext(), db, wID, body.IntegrationID)
+		if err != nil {
+			return ticketingError(c, err)
+		}
+		inc, err := probe.FindRecentIncident(c.UserContext(), ch, wID, body.IncidentID)
+		if err != nil {
+			if errors.Is(err, probe.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "incident is not active"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		t, err := ticketing.CreateTicket(c.UserContext(), db, it, probe.TicketIncident(*inc), currentUserID(c))
+		if err != nil {
+			if errors.Is(err, ticketing.ErrBadInput) || errors.Is(err, ticketing.ErrNotFound) {
+				return ticketingError(c, err)
+			}
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusCreated).JSON(t)
+	})
+}
+
+func ticketingError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ticketing.ErrNotFound):
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "integration not found"})
+	case errors.Is(err, ticketing.ErrBadInput):
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
@@ -0,0 +1,78 @@
+// web/timeline.go
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// panelTimeline mounts the workspace activity timeline and its
+// annotations.
+func panelTimeline(api fiber.Router, db *gorm.DB, ch *sql.DB) {
+	base := api.Group("/workspaces/:id/timeline")
+	wsStore := workspace.NewStore(db)
+
+	base.Use(RequireWorkspaceAccess(wsStore))
+
+	timelineError := func(c *fiber.Ctx, err error) error {
+		switch {
+		case errors.Is(err, probe.ErrBadInput):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, probe.ErrNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// GET /workspaces/:id/timeline?from=&to=&agent_id=&categories=incident,config&limit=
+	// Incidents, NETINFO changes, agent status, config changes and
+	// annotations, newest first - requires CanView (any member)
+	base.Get("/", func(c *fiber.Ctx) error {
+		q := probe.TimelineQuery{
+			WorkspaceID: uintParam(c, "id"),
+			AgentID:     uint(max(intOrDefault(c.Query("agent_id"), 0), 0)),
+			Limit:       intOrDefault(c.Query("limit"), 0),
+		}
+		q.From, _ = readTime(c.Query("from"))
+		q.To, _ = readTime(c.Query("to"))
+		if v := c.Query("categories"); v != "" {
+			q.Categories = strings.Split(v, ",")
+		}
+		ctx, cancel := heavyCHContext(c, ch, heavyCHBudget)
+		defer cancel()
+		out, err := probe.GetWorkspaceTimeline(ctx, ch, db, q)
+		if err != nil {
+			return timelineError(c, err)
+		}
+		return c.JSON(out)
+	})
+
+	// POST /workspaces/:id/timeline/annotations - requires CanEdit (USER+)
+	base.Post("/annotations", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		var body probe.AnnotationInput
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid body"})
+		}
+		n, err := probe.CreateAnnotation(c.UserContext(), db, uintParam(c, "id"), currentUserID(c), body)
+		if err != nil {
+			return timelineError(c, err)
+		}
+		return c.Status(http.StatusCreated).JSON(n)
+	})
+
+	// DELETE /workspaces/:id/timeline/annotations/:annotationID - requires CanEdit (USER+)
+	base.Delete("/annotations/:annotationID", RequireRole(wsStore, CanEdit), func(c *fiber.Ctx) error {
+		if err := probe.DeleteAnnotation(c.UserContext(), db, uintParam(c, "id"), uintParam(c, "annotationID")); err != nil {
+			return timelineError(c, err)
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
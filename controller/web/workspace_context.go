@@ -0,0 +1,135 @@
+// web/workspace_context.go
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/workspace"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ctxWorkspaceKey holds the *WorkspaceContext resolved for the request.
+const ctxWorkspaceKey = "workspaceCtx"
+
+// WorkspaceContext is the workspace and the caller's membership, resolved
+// once per request by RequireWorkspaceAccess / RequireRole and reused by
+// every later middleware and handler instead of re-reading the :id param
+// and re-querying membership.
+type WorkspaceContext struct {
+	WorkspaceID uint
+	UserID      uint
+	Member      *workspace.Member
+
+	// AgentID and Agent are set by RequireWorkspaceAgent once :agentID
+	// has been verified to belong to the workspace.
+	AgentID uint
+	Agent   *agent.Agent
+}
+
+// Role returns the caller's role in the workspace.
+func (w *WorkspaceContext) Role() workspace.Role {
+	if w == nil || w.Member == nil {
+		return ""
+	}
+	return w.Member.Role
+}
+
+// Can reports whether the caller has at least minRole.
+func (w *WorkspaceContext) Can(minRole workspace.Role) bool {
+	return w != nil && w.Member != nil && w.Member.Role.AtLeast(minRole)
+}
+
+// workspaceCtx returns the context resolved by the workspace middlewares,
+// or nil on routes that don't use them.
+func workspaceCtx(c *fiber.Ctx) *WorkspaceContext {
+	wsc, _ := c.Locals(ctxWorkspaceKey).(*WorkspaceContext)
+	return wsc
+}
+
+var (
+	errWorkspaceAuth     = errors.New("authentication required")
+	errWorkspaceID       = errors.New("workspace id required")
+	errWorkspaceNoAccess = errors.New("access denied")
+)
+
+// resolveWorkspace returns the request's WorkspaceContext, loading the
+// caller's membership on first use. Nested groups (e.g. /agents and
+// /agents/:agentID) share the cached result.
+func resolveWorkspace(c *fiber.Ctx, store *workspace.Store) (*WorkspaceContext, error) {
+	userID := currentUserID(c)
+	if userID == 0 {
+		return nil, errWorkspaceAuth
+	}
+	wsID := uintParam(c, "id")
+	if wsID == 0 {
+		return nil, errWorkspaceID
+	}
+	if wsc := workspaceCtx(c); wsc != nil && wsc.WorkspaceID == wsID && wsc.UserID == userID {
+		return wsc, nil
+	}
+
+	m, err := store.GetMemberByUserID(c.UserContext(), wsID, userID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrNotFound) {
+			return nil, errWorkspaceNoAccess
+		}
+		return nil, err
+	}
+	wsc := &WorkspaceContext{WorkspaceID: wsID, UserID: userID, Member: m}
+	c.Locals(ctxWorkspaceKey, wsc)
+	return wsc, nil
+}
+
+// workspaceError writes the response for a resolveWorkspace error.
+func workspaceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errWorkspaceAuth):
+		return APIError(c, 0, CodeAuthRequired, err.Error())
+	case errors.Is(err, errWorkspaceID):
+		return APIError(c, 0, CodeBadRequest, err.Error())
+	case errors.Is(err, errWorkspaceNoAccess):
+		return APIError(c, 0, CodeWorkspaceAccessDenied, err.Error())
+	default:
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
+
+// insufficientRole writes the 403 returned when the caller's role is below
+// minRole.
+func insufficientRole(c *fiber.Ctx, minRole workspace.Role) error {
+	return c.Status(http.StatusForbidden).JSON(fiber.Map{
+		"error":         "insufficient permissions",
+		"code":          CodeInsufficientRole,
+		"required_role": string(minRole),
+	})
+}
+
+// RequireWorkspaceAgent returns middleware that verifies the :agentID
+// route parameter belongs to the workspace, responding 404 otherwise, and
+// records the agent on the WorkspaceContext. Without it, agent-scoped
+// routes would act on any agent ID a workspace member supplies.
+func RequireWorkspaceAgent(store *workspace.Store, db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		wsc, err := resolveWorkspace(c, store)
+		if err != nil {
+			return workspaceError(c, err)
+		}
+		aID := uintParam(c, "agentID")
+		if wsc.Agent != nil && wsc.AgentID == aID {
+			return c.Next()
+		}
+		a, err := agent.GetAgentByWorkspaceAndID(c.UserContext(), db, wsc.WorkspaceID, aID)
+		if err != nil || a == nil {
+			if err == nil || errors.Is(err, agent.ErrNotFound) {
+				return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "agent not found"})
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		wsc.AgentID, wsc.Agent = a.ID, a
+		return c.Next()
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"netwatcher-controller/internal/email"
 	"netwatcher-controller/internal/limits"
 	"netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/scheduler"
 	"netwatcher-controller/internal/users"
 	"netwatcher-controller/internal/workspace"
 
@@ -50,6 +51,18 @@ func hasWorkspaceOverride(settings []byte) bool {
 	return s.VoiceThresholds != nil
 }
 
+// workspaceDeletionError writes the response for a staged deletion error.
+func workspaceDeletionError(c *fiber.Ctx, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, workspace.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, workspace.ErrDeletionScheduled), errors.Is(err, workspace.ErrUndoWindowClosed):
+		status = http.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+}
+
 func panelWorkspaces(api fiber.Router, db *gorm.DB, emailStore *email.QueueStore, deletionStore *deletion.QueueStore, limitsConfig *limits.Config) {
 	wsParty := api.Group("/workspaces")
 	store := workspace.NewStore(db)
@@ -150,14 +163,11 @@ func panelWorkspaces(api fiber.Router, db *gorm.DB, emailStore *email.QueueStore
 
 	// GET /workspaces/:id - requires CanView (any member)
 	wsID.Get("/", func(c *fiber.Ctx) error {
-		id := uintParam(c, "id")
-		userID := currentUserID(c)
-		ws, err := store.GetWorkspace(c.UserContext(), id)
+		wsc := workspaceCtx(c)
+		ws, err := store.GetWorkspace(c.UserContext(), wsc.WorkspaceID)
 		if err != nil || ws == nil {
 			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
 		}
-		// Add user's role to response
-		member, _ := store.GetMemberByUserID(c.UserContext(), id, userID)
 		response := fiber.Map{
 			"id":          ws.ID,
 			"name":        ws.Name,
@@ -167,9 +177,8 @@ func panelWorkspaces(api fiber.Router, db *gorm.DB, emailStore *email.QueueStore
 			"created_at":  ws.CreatedAt,
 			"updated_at":  ws.UpdatedAt,
 		}
-		if member != nil {
-			response["my_role"] = member.Role
-		}
+		// Caller's role, resolved by RequireWorkspaceAccess
+		response["my_role"] = wsc.Role()
 		return c.JSON(response)
 	})
 
@@ -201,17 +210,43 @@ func panelWorkspaces(api fiber.Router, db *gorm.DB, emailStore *email.QueueStore
 	})
 
 	// DELETE /workspaces/:id - requires CanOwn (OWNER only)
+	// Disables the workspace and schedules its purge after the retention
+	// window; see workspace/teardown.go.
 	wsID.Delete("/", RequireRole(store, CanOwn), func(c *fiber.Ctx) error {
 		id := uintParam(c, "id")
-		err := store.DeleteWorkspace(c.UserContext(), deletionStore, id)
+		retention := scheduler.LoadWorkspacePurgeConfig().Retention
+		if _, err := store.ScheduleDeletion(c.UserContext(), id, currentUserID(c), retention); err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		st, err := store.DeletionStatus(c.UserContext(), deletionStore, id)
 		if err != nil {
-			status := http.StatusBadRequest
-			if err == workspace.ErrNotFound {
-				status = http.StatusNotFound
-			}
-			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.JSON(fiber.Map{"ok": true})
+		return c.Status(http.StatusAccepted).JSON(st)
+	})
+
+	// GET /workspaces/:id/deletion - stage and progress of the workspace's
+	// deletion, and whether it can still be undone
+	wsID.Get("/deletion", func(c *fiber.Ctx) error {
+		st, err := store.DeletionStatus(c.UserContext(), deletionStore, uintParam(c, "id"))
+		if err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		return c.JSON(st)
+	})
+
+	// POST /workspaces/:id/restore - undo a scheduled deletion within the
+	// retention window; requires CanOwn
+	wsID.Post("/restore", RequireRole(store, CanOwn), func(c *fiber.Ctx) error {
+		id := uintParam(c, "id")
+		if _, err := store.RestoreWorkspace(c.UserContext(), id, currentUserID(c)); err != nil {
+			return workspaceDeletionError(c, err)
+		}
+		st, err := store.DeletionStatus(c.UserContext(), deletionStore, id)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(st)
 	})
 
 	// GET /workspaces/:id/voice-thresholds
@@ -310,6 +345,95 @@ func panelWorkspaces(api fiber.Router, db *gorm.DB, emailStore *email.QueueStore
 		return c.JSON(fiber.Map{"ok": true})
 	})
 
+	// GET /workspaces/:id/session-policy - the workspace's limits on
+	// member sessions and the controller defaults they tighten.
+	wsID.Get("/session-policy", func(c *fiber.Ctx) error {
+		ws, err := store.GetWorkspace(c.UserContext(), uintParam(c, "id"))
+		if err != nil || ws == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		ss, ok := workspace.ParseSessionSettings(ws.Settings)
+		source := "defaults"
+		if ok {
+			source = "workspace"
+		}
+		d := users.DefaultSessionPolicy()
+		return c.JSON(fiber.Map{
+			"source":    source,
+			"workspace": ss,
+			"defaults": fiber.Map{
+				"access_token_minutes": int(d.AccessTTL / time.Minute),
+				"idle_timeout_minutes": int(d.IdleTimeout / time.Minute),
+				"max_lifetime_hours":   int(d.MaxLifetime / time.Hour),
+				"sliding":              d.Sliding,
+			},
+		})
+	})
+
+	// PUT /workspaces/:id/session-policy - requires CanManage. Applies to
+	// every member's next login or refresh; stricter limits from a
+	// member's other workspaces still win.
+	wsID.Put("/session-policy", RequireRole(store, CanManage), func(c *fiber.Ctx) error {
+		id := uintParam(c, "id")
+		var body workspace.SessionSettings
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid JSON body: " + err.Error()})
+		}
+		switch {
+		case body.AccessTokenMinutes < 0, body.IdleTimeoutMinutes < 0, body.MaxLifetimeHours < 0:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "lifetimes must not be negative"})
+		case body.IdleTimeoutMinutes > 0 && body.IdleTimeoutMinutes < 5:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "idle_timeout_minutes must be at least 5"})
+		case body.AccessTokenMinutes > 0 && body.IdleTimeoutMinutes > 0 && body.AccessTokenMinutes > body.IdleTimeoutMinutes:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "access_token_minutes must be ≤ idle_timeout_minutes"})
+		}
+		ws, err := store.GetWorkspace(c.UserContext(), id)
+		if err != nil || ws == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		var settings map[string]any
+		if len(ws.Settings) > 0 {
+			_ = jsonFromBytes(ws.Settings, &settings)
+		}
+		if settings == nil {
+			settings = map[string]any{}
+		}
+		settings["session"] = body
+		raw, _ := jsonToBytes(settings)
+		jsonVal := datatypes.JSON(raw)
+		if _, err := store.UpdateWorkspace(c.UserContext(), id, workspace.UpdateWorkspaceInput{
+			Settings: &jsonVal,
+		}); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"ok": true, "workspace": body})
+	})
+
+	// DELETE /workspaces/:id/session-policy - requires CanManage.
+	wsID.Delete("/session-policy", RequireRole(store, CanManage), func(c *fiber.Ctx) error {
+		id := uintParam(c, "id")
+		ws, err := store.GetWorkspace(c.UserContext(), id)
+		if err != nil || ws == nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		var settings map[string]any
+		if len(ws.Settings) > 0 {
+			_ = jsonFromBytes(ws.Settings, &settings)
+		}
+		if settings == nil {
+			return c.JSON(fiber.Map{"ok": true})
+		}
+		delete(settings, "session")
+		raw, _ := jsonToBytes(settings)
+		jsonVal := datatypes.JSON(raw)
+		if _, err := store.UpdateWorkspace(c.UserContext(), id, workspace.UpdateWorkspaceInput{
+			Settings: &jsonVal,
+		}); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"ok": true})
+	})
+
 	// ----- Members -----
 
 	// GET /workspaces/:id/members
@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"net/http"
 	"netwatcher-controller/internal/agent"
+	"netwatcher-controller/internal/datastream"
+	"netwatcher-controller/internal/logging"
 	"netwatcher-controller/internal/lookup"
 	probe "netwatcher-controller/internal/probe"
+	"netwatcher-controller/internal/region"
 	"netwatcher-controller/internal/speedtest"
 	"netwatcher-controller/internal/users"
 	"strconv"
@@ -91,17 +94,23 @@ func setupNeffosServers(db *gorm.DB, ch *sql.DB) (agentServer *neffos.Server, pa
 		if err != nil {
 			// Check if agent was deleted - return proper error to signal deactivation
 			if errors.Is(err, agent.ErrAgentDeleted) {
-				log.Infof("WS: Agent %d/%d attempted connect after deletion", wsID64, agID64)
+				webLog.WithFields(agentFields(uint(agID64), uint(wsID64))).Info("WS: agent attempted connect after deletion")
 				return errors.New("agent_deleted: agent has been removed from workspace")
 			}
 			// Check for transient server errors (DB down, storage full, etc.)
 			// Return 503 so agents know to retry instead of deactivating
 			if errors.Is(err, agent.ErrServerError) {
-				log.Warnf("WS: Agent %d/%d auth failed due to server error: %v", wsID64, agID64, err)
+				webLog.WithFields(agentFields(uint(agID64), uint(wsID64))).WithError(err).Warn("WS: agent auth failed due to server error")
 				return errors.New("service unavailable: server error")
 			}
+			if errors.Is(err, agent.ErrWorkspaceDisabled) {
+				return errors.New("service unavailable: workspace disabled")
+			}
 			return errors.New("unauthorized: invalid psk")
 		}
+		if !region.Owns(a.Region) {
+			return fmt.Errorf("wrong_region: agent belongs to region %s (%s)", region.Owner(a.Region), region.Endpoint(a.Region))
+		}
 
 		_ = agent.UpdateAgentSeen(context.TODO(), db, a.ID, time.Now())
 
@@ -118,8 +127,15 @@ func setupNeffosServers(db *gorm.DB, ch *sql.DB) (agentServer *neffos.Server, pa
 		c.Set("client_type", "agent")
 		c.Set("conn_id", c.ID())
 		c.Set("client_ip", clientIP)
+		c.Set("user_agent", r.Header.Get("User-Agent"))
+		c.Set("tls_version", tlsVersionName(r.TLS))
+
+		go auditAgentConnection(db, agent.ConnectionInfo{
+			AgentID: a.ID, WorkspaceID: a.WorkspaceID, Kind: agent.ConnControl,
+			ClientIP: clientIP, UserAgent: r.Header.Get("User-Agent"), TLSVersion: tlsVersionName(r.TLS),
+		})
 
-		log.Infof("WS auth ok — agent %d (ws %d) conn_id=%s", a.ID, a.WorkspaceID, c.ID())
+		webLog.WithFields(agentFields(a.ID, a.WorkspaceID)).Infof("WS auth ok — agent conn_id=%s", c.ID())
 		return nil
 	}
 
@@ -156,7 +172,7 @@ func setupNeffosServers(db *gorm.DB, ch *sql.DB) (agentServer *neffos.Server, pa
 		c.Set("session_id", sess.SessionID)
 		c.Set("client_type", "panel")
 
-		log.Infof("WS auth ok — panel user %d (session %d) connected as %s", u.ID, sess.SessionID, c.ID())
+		webLog.WithField(logging.FieldUser, u.ID).Infof("WS auth ok — panel user (session %d) connected as %s", sess.SessionID, c.ID())
 		return nil
 	}
 
@@ -174,7 +190,7 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 				connID := nsConn.Conn.Get("conn_id").(string)
 				clientIP := nsConn.Conn.Get("client_ip").(string)
 
-				log.Infof("[NS_CONNECT] agent=%d ws=%d conn_id=%s ip=%s ns=%s", aid, wsid, connID, clientIP, msg.Namespace)
+				webLog.WithFields(agentFields(aid, wsid)).Infof("[NS_CONNECT] conn_id=%s ip=%s ns=%s", connID, clientIP, msg.Namespace)
 
 				// Register with AgentHub with full metadata for debugging
 				GetAgentHub().RegisterAgentWithInfo(AgentConnectionInfo{
@@ -185,18 +201,30 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 					ConnectedAt: time.Now(),
 					conn:        nsConn,
 				})
+				if err := agent.RecordStatusEvent(context.TODO(), db, agent.StatusEvent{
+					AgentID: aid, WorkspaceID: wsid, Online: true, ClientIP: clientIP,
+				}); err != nil {
+					webLog.WithFields(agentFields(aid, wsid)).WithError(err).Warn("[NS_CONNECT] record status event")
+				}
 
 				return nil
 			},
 			neffos.OnNamespaceDisconnect: func(nsConn *neffos.NSConn, msg neffos.Message) error {
 				aid, _ := nsConn.Conn.Get("agent_id").(uint)
+				wsid, _ := nsConn.Conn.Get("workspace_id").(uint)
 				connID := nsConn.Conn.Get("conn_id").(string)
 
 				// Unregister from AgentHub - pass connection to prevent race condition
 				// where old disconnect removes newly registered connection
-				GetAgentHub().UnregisterAgent(aid, nsConn)
+				if GetAgentHub().UnregisterAgent(aid, nsConn) {
+					if err := agent.RecordStatusEvent(context.TODO(), db, agent.StatusEvent{
+						AgentID: aid, WorkspaceID: wsid, Online: false,
+					}); err != nil {
+						webLog.WithFields(agentFields(aid, wsid)).WithError(err).Warn("[NS_DISCONNECT] record status event")
+					}
+				}
 
-				log.Infof("[NS_DISCONNECT] agent=%d conn_id=%s ns=%s", aid, connID, msg.Namespace)
+				webLog.WithFields(agentFields(aid, wsid)).Infof("[NS_DISCONNECT] conn_id=%s ns=%s", connID, msg.Namespace)
 				return nil
 			},
 
@@ -222,8 +250,11 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 			},
 
 			"version": func(nsConn *neffos.NSConn, msg neffos.Message) error {
+				// Newer agents also announce their config protocol, probe
+				// types and optional fields here (see agent.Negotiation).
 				var versionData = struct {
 					Version string `json:"version"`
+					agent.Negotiation
 				}{}
 
 				aid, _ := nsConn.Conn.Get("agent_id").(uint)
@@ -247,7 +278,20 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 					log.Error(err)
 				}
 
-				nsConn.Emit("version", []byte("ok"))
+				// Legacy agents expect a plain "ok"; negotiating agents get
+				// the protocol both sides will use.
+				if versionData.Negotiation.Empty() {
+					nsConn.Emit("version", []byte("ok"))
+					return nil
+				}
+				if err := agent.UpdateAgentNegotiation(context.TODO(), db, a.ID, versionData.Negotiation); err != nil {
+					log.WithError(err).Warnf("[version] failed to record negotiation for agent %d", a.ID)
+				}
+				reply, _ := json.Marshal(map[string]any{
+					"status":   "ok",
+					"protocol": agent.NegotiatedProtocol(versionData.Protocol),
+				})
+				nsConn.Emit("version", reply)
 				return nil
 			},
 
@@ -271,6 +315,12 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 					log.Errorf("probe_get: %v", err)
 				}
 
+				// Withhold or trim config this agent build can't handle.
+				ownedP, warnings := probe.FilterForAgent(a, ownedP)
+				for _, w := range warnings {
+					log.Warnf("[probe_get] agent %d: probe %d (%s): %s", a.ID, w.ProbeID, w.Type, w.Reason)
+				}
+
 				typeCounts := make(map[string]int)
 				var probeIDs []uint
 				for _, p := range ownedP {
@@ -296,6 +346,18 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 				wsid, _ := nsConn.Conn.Get("workspace_id").(uint)
 				connID := nsConn.Conn.Get("conn_id").(string)
 
+				// Audit the first upload on each connection.
+				if audited, _ := nsConn.Conn.Get("upload_audited").(bool); !audited {
+					nsConn.Conn.Set("upload_audited", true)
+					clientIP, _ := nsConn.Conn.Get("client_ip").(string)
+					ua, _ := nsConn.Conn.Get("user_agent").(string)
+					tlsVersion, _ := nsConn.Conn.Get("tls_version").(string)
+					go auditAgentConnection(db, agent.ConnectionInfo{
+						AgentID: aid, WorkspaceID: wsid, Kind: agent.ConnUpload,
+						ClientIP: clientIP, UserAgent: ua, TLSVersion: tlsVersion,
+					})
+				}
+
 				var pp probe.ProbeData
 				if err := json.Unmarshal(msg.Body, &pp); err != nil {
 					log.Error(err)
@@ -303,6 +365,7 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 				}
 
 				pp.AgentID = aid
+				pp.WorkspaceID = wsid
 				if pp.CreatedAt.IsZero() {
 					pp.CreatedAt = time.Now()
 				}
@@ -321,21 +384,31 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 					pp.CreatedAt = pp.ReceivedAt
 				}*/
 
+				if ok, backoff := probe.AllowIngest(aid, pp.ProbeID); !ok {
+					reply, _ := json.Marshal(backoff)
+					nsConn.Emit("probe_post_backoff", reply)
+					return nil
+				}
+
 				targetInfo := pp.Target
 				if pp.TargetAgent > 0 {
 					targetInfo = fmt.Sprintf("agent:%d", pp.TargetAgent)
 				}
-				log.Infof("[probe_post] agent=%d probe=%d type=%s target=%s",
-					aid, pp.ProbeID, pp.Type, targetInfo)
+				ingestLog.WithFields(agentFields(aid, wsid)).WithFields(log.Fields{
+					logging.FieldProbe: pp.ProbeID, logging.FieldType: string(pp.Type), logging.FieldTarget: targetInfo,
+				}).Debug("[probe_post] received")
 
+				var probeLabels map[string]string
 				if pp.ProbeID != 0 {
 					p, err := probe.GetByID(context.TODO(), db, pp.ProbeID)
 					if err == nil && p != nil {
 						pp.ProbeAgentID = p.AgentID
+						pp.Labels = probe.LabelColumnValues(p.Labels)
+						probeLabels = datastream.ProbeLabels(p.Labels)
 
 						if pp.Type == probe.TypeNetInfo && p.AgentID != aid {
-							log.Errorf("[SESSION_INTEGRITY] NETINFO probe %d owned by agent %d but submitted by agent %d (conn_id=%s, ws=%d)",
-								pp.ProbeID, p.AgentID, aid, connID, wsid)
+							ingestLog.WithFields(agentFields(aid, wsid)).WithField(logging.FieldProbe, pp.ProbeID).
+								Errorf("[SESSION_INTEGRITY] NETINFO probe owned by agent %d submitted by another agent (conn_id=%s)", p.AgentID, connID)
 						}
 
 						if pp.TargetAgent == 0 && len(p.Targets) > 0 {
@@ -356,9 +429,31 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 				}
 
 				if err := probe.Dispatch(context.TODO(), pp); err != nil {
-					log.Errorf("probe_post dispatch: %v", err)
+					ingestLog.WithFields(agentFields(aid, wsid)).WithField(logging.FieldProbe, pp.ProbeID).WithError(err).Error("probe_post dispatch")
 					return err
 				}
+				pp.Payload = probe.NormalizePayloadTimestamps(pp.Type, pp.Payload)
+
+				// Streams leave the controller, so they get the payload as
+				// stored: sealed fields stay sealed.
+				if exported, err := probe.ExportPayload(context.TODO(), pp); err != nil {
+					ingestLog.WithFields(agentFields(aid, wsid)).WithField(logging.FieldProbe, pp.ProbeID).WithError(err).Warn("probe_post stream payload")
+				} else {
+					datastream.Publish(datastream.Record{
+						WorkspaceID:  wsid,
+						ProbeID:      pp.ProbeID,
+						AgentID:      pp.AgentID,
+						ProbeAgentID: pp.ProbeAgentID,
+						TargetAgent:  pp.TargetAgent,
+						Type:         string(pp.Type),
+						Target:       pp.Target,
+						Triggered:    pp.Triggered,
+						CreatedAt:    pp.CreatedAt,
+						ReceivedAt:   pp.ReceivedAt,
+						Labels:       probeLabels,
+						Payload:      exported,
+					})
+				}
 
 				broadcastData := ProbeDataBroadcast{
 					WorkspaceID:  wsid,
@@ -497,6 +592,16 @@ func getAgentWebsocketEvents(db *gorm.DB, ch *sql.DB) neffos.Namespaces {
 
 						if err := probe.Dispatch(context.TODO(), pp); err != nil {
 							log.Errorf("speedtest_result dispatch: %v", err)
+						} else {
+							datastream.Publish(datastream.Record{
+								WorkspaceID: queueItem.WorkspaceID,
+								AgentID:     aid,
+								Type:        string(pp.Type),
+								Target:      pp.Target,
+								CreatedAt:   pp.CreatedAt,
+								ReceivedAt:  pp.ReceivedAt,
+								Payload:     pp.Payload,
+							})
 						}
 					}
 				} else {
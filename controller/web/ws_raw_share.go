@@ -28,6 +28,8 @@ type RawShareConn struct {
 	AgentID uint
 	Conn    *websocket.Conn
 	Send    chan []byte
+	// Anon pseudonymizes broadcasts for anonymized links; nil otherwise.
+	Anon *share.Anonymizer
 }
 
 // Global share hub
@@ -61,6 +63,11 @@ func setupRawShareWS(db *gorm.DB) http.Handler {
 			http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusUnauthorized)
 			return
 		}
+		// Fixed data windows that have closed exclude live data.
+		if !link.AllowsLiveData(time.Now()) {
+			http.Error(w, `{"error":"`+share.ErrOutsideDataWindow.Error()+`"}`, http.StatusForbidden)
+			return
+		}
 
 		ws, err := rawUpgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -79,6 +86,7 @@ func setupRawShareWS(db *gorm.DB) http.Handler {
 			AgentID: link.AgentID,
 			Conn:    ws,
 			Send:    make(chan []byte, 256),
+			Anon:    link.Anonymizer(),
 		}
 
 		rawShareHub.Register(conn)
@@ -166,8 +174,17 @@ func (h *RawShareHub) BroadcastToShare(agentID uint, data ProbeDataBroadcast) {
 
 	for connID := range recipients {
 		if conn, ok := h.conns[connID]; ok {
+			msg := payload
+			if conn.Anon != nil {
+				anon := data
+				anon.Target = conn.Anon.Host(data.Target)
+				anon.Payload = conn.Anon.Payload(data.Payload)
+				if msg, err = json.Marshal(map[string]interface{}{"event": "probe_data", "data": anon}); err != nil {
+					continue
+				}
+			}
 			select {
-			case conn.Send <- payload:
+			case conn.Send <- msg:
 			default:
 			}
 		}
@@ -1,6 +1,6 @@
 import type { AxiosInstance, AxiosRequestConfig } from "axios";
 import axios from "axios";
-import { getSession, clearSession } from "@/session";
+import { getSession, setSession, clearSession } from "@/session";
 
 function baseURL(): string {
     // Prefer a global override if present (e.g., set on index.html)
@@ -31,10 +31,44 @@ client.interceptors.request.use((config) => {
     return config;
 });
 
-// Response interceptor to handle 401 (unauthorized/session expired)
+// One refresh at a time: concurrent 401s wait for the same attempt, since
+// the refresh token is single-use.
+let refreshing: Promise<string | null> | null = null;
+
+function refreshAccessToken(): Promise<string | null> {
+    if (!refreshing) {
+        refreshing = (async () => {
+            const session = getSession();
+            if (!session?.refreshToken) return null;
+            try {
+                // Plain axios: this call must not go through the interceptors.
+                const { data } = await axios.post(`${baseURL()}/auth/refresh`, { refresh_token: session.refreshToken });
+                setSession({ ...session, token: data.token, refreshToken: data.refresh_token, expiresAt: data.expires_at });
+                return data.token as string;
+            } catch {
+                return null;
+            }
+        })().finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+}
+
+// Response interceptor to handle 401 (unauthorized/session expired): try
+// the refresh token once, then fall back to the login page.
 client.interceptors.response.use(
     (response) => response,
-    (error) => {
+    async (error) => {
+        const config = error.config as (AxiosRequestConfig & { _retried?: boolean }) | undefined;
+        if (error.response?.status === 401 && config && !config._retried) {
+            config._retried = true;
+            const token = await refreshAccessToken();
+            if (token) {
+                (config.headers as any).Authorization = `Bearer ${token}`;
+                return client.request(config);
+            }
+        }
         if (error.response?.status === 401) {
             // Clear the invalid session
             clearSession();
@@ -8,6 +8,9 @@ export interface SessionUser {
 
 export interface Session {
     token: string;
+    // Single-use token for POST /auth/refresh; rotated on every refresh.
+    refreshToken?: string;
+    expiresAt?: string;
     user?: SessionUser;
 }
 